@@ -0,0 +1,367 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+// Package abuse keeps the moderation queue of abuse reports about pastes
+// A report can also open a ticket: an email to the abuse address with a
+// snapshot of the paste attached, so it can be handled from a mailbox even
+// after the paste is gone
+package abuse
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/dispatch"
+	"github.com/casjay-forks/caspaste/src/email"
+	"github.com/casjay-forks/caspaste/src/logger"
+	"github.com/casjay-forks/caspaste/src/storage"
+	"github.com/casjay-forks/caspaste/src/validation"
+)
+
+// ErrInvalidReport is returned for a report with a bad reason or contact email
+var ErrInvalidReport = errors.New("abuse: invalid report")
+
+// ErrTicketsDisabled is returned when sending a ticket without a mailer
+var ErrTicketsDisabled = errors.New("abuse: tickets are not enabled")
+
+const (
+	// ReasonMaxLength is the longest report reason
+	ReasonMaxLength = 2000
+	// SnapshotMaxSize is the largest paste body attached to a ticket
+	SnapshotMaxSize = 1 << 20
+	// subjectReasonLength is how much of the reason goes in the ticket subject
+	subjectReasonLength = 60
+)
+
+// Store is implemented by storage.DB
+type Store interface {
+	AbuseReportList(state string) ([]storage.AbuseReport, error)
+	AbuseReportGet(id string) (storage.AbuseReport, error)
+	AbuseReportAdd(r storage.AbuseReport) (storage.AbuseReport, error)
+	AbuseReportSetState(id, state, resolution string) error
+	AbuseReportSetTicket(id, ticket string) error
+	PasteGet(id string) (storage.Paste, error)
+}
+
+// Mailer is implemented by *email.Client
+type Mailer interface {
+	IsEnabled() bool
+	TestConnection() error
+	SendWithAttachments(to, subject, body string, attachments ...email.Attachment) error
+	// Server names the mail server, for the dispatch circuit breaker
+	Server() string
+}
+
+// Queue files abuse reports and opens their tickets
+type Queue struct {
+	store Store
+	log   logger.Logger
+
+	mu      sync.RWMutex
+	mailer  Mailer
+	to      string
+	baseURL string
+	pool    *dispatch.Pool
+}
+
+// New creates a queue backed by store, without tickets
+func New(store Store, log logger.Logger) *Queue {
+	return &Queue{store: store, log: log}
+}
+
+// SetTickets emails a ticket to address for each new report; a nil mailer
+// turns tickets off
+// baseURL (e.g. https://paste.example.com) is used to link to the paste
+func (q *Queue) SetTickets(mailer Mailer, address, baseURL string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.mailer = mailer
+	q.to = address
+	q.baseURL = strings.TrimSuffix(baseURL, "/")
+}
+
+// SetDispatcher sends the tickets of new reports on a pool of workers; without
+// one they are sent while the report is filed
+func (q *Queue) SetDispatcher(pool *dispatch.Pool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pool = pool
+}
+
+// TicketAddress returns where tickets are sent, or "" when tickets are off
+func (q *Queue) TicketAddress() string {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.mailer == nil {
+		return ""
+	}
+	return q.to
+}
+
+// Report files an open report about an existing paste
+// The ticket, if enabled, is queued with the paste as it is now
+func (q *Queue) Report(pasteID, reason, contact, ip string) (storage.AbuseReport, error) {
+	r := storage.AbuseReport{
+		PasteID: pasteID,
+		Reason:  strings.TrimSpace(reason),
+		Email:   strings.TrimSpace(contact),
+		IP:      ip,
+	}
+	if r.Reason == "" {
+		return r, fmt.Errorf("%w: a reason is required", ErrInvalidReport)
+	}
+	if len(r.Reason) > ReasonMaxLength {
+		return r, fmt.Errorf("%w: reason is longer than %d characters", ErrInvalidReport, ReasonMaxLength)
+	}
+	if r.Email != "" {
+		if err := validation.ValidateEmail(r.Email); err != nil {
+			return r, fmt.Errorf("%w: %v", ErrInvalidReport, err)
+		}
+	}
+
+	paste, err := q.store.PasteGet(pasteID)
+	if err != nil {
+		return r, err
+	}
+	r, err = q.store.AbuseReportAdd(r)
+	if err != nil {
+		return r, err
+	}
+	q.log.Info(fmt.Sprintf("Abuse report %s filed for paste %s", r.ID, r.PasteID))
+
+	if q.TicketAddress() != "" {
+		r.Ticket = storage.AbuseTicketSent
+		if err := q.queueTicket(r, &paste); err != nil {
+			r.Ticket = storage.AbuseTicketFailed
+		}
+	}
+	return r, nil
+}
+
+// queueTicket sends the ticket of a new report on the dispatch pool
+// A ticket the pool turns away is marked failed, to be sent again from the
+// admin panel
+func (q *Queue) queueTicket(r storage.AbuseReport, paste *storage.Paste) error {
+	q.mu.RLock()
+	mailer, pool := q.mailer, q.pool
+	q.mu.RUnlock()
+	if mailer == nil {
+		return ErrTicketsDisabled
+	}
+
+	done := func(err error) {
+		q.recordTicket(r.ID, err)
+		if err != nil {
+			q.log.Error(fmt.Errorf("abuse report %s: ticket not sent: %w", r.ID, err))
+		}
+	}
+	if pool == nil {
+		err := q.mailTicket(r, paste)
+		done(err)
+		return err
+	}
+
+	err := pool.Submit(dispatch.Job{
+		Kind:        "email",
+		Destination: mailer.Server(),
+		Deliver: func(ctx context.Context) error {
+			return q.mailTicket(r, paste)
+		},
+		Done: done,
+	})
+	if err != nil {
+		done(err)
+	}
+	return err
+}
+
+// List returns the reports in a state ("" = all), newest first
+func (q *Queue) List(state string) ([]storage.AbuseReport, error) {
+	return q.store.AbuseReportList(state)
+}
+
+// Get returns a report by ID
+func (q *Queue) Get(id string) (storage.AbuseReport, error) {
+	return q.store.AbuseReportGet(id)
+}
+
+// Resolve closes a report; resolution says what was done about it
+// Once the paste is deleted, or its creator banned, the other open reports
+// about it need no review either, so they are closed the same way
+func (q *Queue) Resolve(id, resolution string) (storage.AbuseReport, error) {
+	r, err := q.setState(id, storage.AbuseReportResolved, resolution)
+	if err != nil {
+		return r, err
+	}
+	if resolution != storage.AbuseResolutionDeleted && resolution != storage.AbuseResolutionBanned {
+		return r, nil
+	}
+
+	open, err := q.store.AbuseReportList(storage.AbuseReportOpen)
+	if err != nil {
+		return r, err
+	}
+	for _, other := range open {
+		if other.PasteID != r.PasteID {
+			continue
+		}
+		if err := q.store.AbuseReportSetState(other.ID, storage.AbuseReportResolved, resolution); err != nil {
+			return r, err
+		}
+	}
+	return r, nil
+}
+
+// Reopen puts a resolved report back in the queue
+func (q *Queue) Reopen(id string) (storage.AbuseReport, error) {
+	return q.setState(id, storage.AbuseReportOpen, storage.AbuseResolutionNone)
+}
+
+func (q *Queue) setState(id, state, resolution string) (storage.AbuseReport, error) {
+	if err := q.store.AbuseReportSetState(id, state, resolution); err != nil {
+		return storage.AbuseReport{}, err
+	}
+	return q.store.AbuseReportGet(id)
+}
+
+// SendTicket sends the ticket of a report again, with the paste as it is now
+func (q *Queue) SendTicket(id string) (storage.AbuseReport, error) {
+	r, err := q.store.AbuseReportGet(id)
+	if err != nil {
+		return r, err
+	}
+	if q.TicketAddress() == "" {
+		return r, ErrTicketsDisabled
+	}
+
+	var paste *storage.Paste
+	if p, err := q.store.PasteGet(r.PasteID); err == nil {
+		paste = &p
+	} else if !errors.Is(err, storage.ErrNotFoundID) {
+		return r, err
+	}
+	if err := q.sendTicket(r, paste); err != nil {
+		return r, err
+	}
+	return q.store.AbuseReportGet(id)
+}
+
+// sendTicket emails a report and records the result; paste is nil once the
+// paste has been deleted
+func (q *Queue) sendTicket(r storage.AbuseReport, paste *storage.Paste) error {
+	err := q.mailTicket(r, paste)
+	q.recordTicket(r.ID, err)
+	return err
+}
+
+// mailTicket emails a report
+func (q *Queue) mailTicket(r storage.AbuseReport, paste *storage.Paste) error {
+	q.mu.RLock()
+	mailer, to, baseURL := q.mailer, q.to, q.baseURL
+	q.mu.RUnlock()
+	if mailer == nil {
+		return ErrTicketsDisabled
+	}
+
+	// The client only sends once the server has answered
+	var err error
+	if !mailer.IsEnabled() {
+		err = mailer.TestConnection()
+	}
+	if err == nil {
+		subject, body, attachments := ticket(r, paste, baseURL)
+		err = mailer.SendWithAttachments(to, subject, body, attachments...)
+	}
+	return err
+}
+
+// recordTicket stores whether the ticket of a report was sent
+func (q *Queue) recordTicket(id string, err error) {
+	state := storage.AbuseTicketSent
+	if err != nil {
+		state = storage.AbuseTicketFailed
+	}
+	if setErr := q.store.AbuseReportSetTicket(id, state); setErr != nil {
+		q.log.Error(fmt.Errorf("abuse report %s: %w", id, setErr))
+	}
+}
+
+// ticket builds the email of a report
+func ticket(r storage.AbuseReport, paste *storage.Paste, baseURL string) (string, string, []email.Attachment) {
+	summary := []rune(strings.Join(strings.Fields(r.Reason), " "))
+	if len(summary) > subjectReasonLength {
+		summary = append([]rune(strings.TrimSpace(string(summary[:subjectReasonLength]))), []rune("...")...)
+	}
+	subject := fmt.Sprintf("[Abuse #%s] Paste %s: %s", r.ID, r.PasteID, string(summary))
+
+	contact := r.Email
+	if contact == "" {
+		contact = "not given"
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "Report:      %s\r\n", r.ID)
+	fmt.Fprintf(&body, "Paste:       %s/%s\r\n", baseURL, r.PasteID)
+	fmt.Fprintf(&body, "Reported at: %s\r\n", time.Unix(r.CreatedAt, 0).UTC().Format(time.RFC3339))
+	fmt.Fprintf(&body, "Reporter IP: %s\r\n", r.IP)
+	fmt.Fprintf(&body, "Contact:     %s\r\n", contact)
+	body.WriteString("\r\nReason:\r\n")
+	body.WriteString(strings.ReplaceAll(strings.ReplaceAll(r.Reason, "\r\n", "\n"), "\n", "\r\n"))
+	body.WriteString("\r\n\r\n")
+
+	if paste == nil {
+		body.WriteString("The paste no longer exists, so no snapshot is attached.\r\n")
+		return subject, body.String(), nil
+	}
+
+	expires := "never"
+	if paste.DeleteTime > 0 {
+		expires = time.Unix(paste.DeleteTime, 0).UTC().Format(time.RFC3339)
+	}
+	fmt.Fprintf(&body, "Title:       %s\r\n", paste.Title)
+	fmt.Fprintf(&body, "Syntax:      %s\r\n", paste.Syntax)
+	fmt.Fprintf(&body, "Created:     %s\r\n", time.Unix(paste.CreateTime, 0).UTC().Format(time.RFC3339))
+	fmt.Fprintf(&body, "Expires:     %s\r\n", expires)
+	fmt.Fprintf(&body, "Private:     %t\r\n", paste.IsPrivate)
+	fmt.Fprintf(&body, "Burn after reading: %t\r\n", paste.OneUse)
+
+	attachment := snapshot(paste, &body)
+	return subject, body.String(), []email.Attachment{attachment}
+}
+
+// snapshot attaches a paste's content, noting in body if it was cut short
+func snapshot(paste *storage.Paste, body *strings.Builder) email.Attachment {
+	a := email.Attachment{
+		Name:        "paste-" + paste.ID + ".txt",
+		ContentType: "text/plain; charset=UTF-8",
+		Data:        []byte(paste.Body),
+	}
+	switch {
+	case paste.IsURL:
+		a.Data = []byte(paste.OriginalURL + "\n")
+	case paste.IsFile:
+		a.Name = "paste-" + paste.ID + "-" + path.Base(paste.FileName)
+		a.ContentType = paste.MimeType
+		// Files are stored base64 encoded; older ones are raw
+		if data, err := base64.StdEncoding.DecodeString(paste.Body); err == nil {
+			a.Data = data
+		}
+	}
+
+	if len(a.Data) > SnapshotMaxSize {
+		a.Data = a.Data[:SnapshotMaxSize]
+		fmt.Fprintf(body, "\r\nThe attached snapshot is cut to its first %d bytes.\r\n", SnapshotMaxSize)
+	} else {
+		body.WriteString("\r\nA snapshot of the paste is attached.\r\n")
+	}
+	return a
+}
@@ -14,20 +14,53 @@
 package admin
 
 import (
+	"encoding/json"
 	"fmt"
+	"html"
 	"net/http"
 	"strings"
 	"sync"
+
+	"github.com/casjay-forks/caspaste/src/abuse"
+	"github.com/casjay-forks/caspaste/src/csp"
+	"github.com/casjay-forks/caspaste/src/domain"
+	"github.com/casjay-forks/caspaste/src/firewall"
+	"github.com/casjay-forks/caspaste/src/geoip"
+	"github.com/casjay-forks/caspaste/src/spam"
+	"github.com/casjay-forks/caspaste/src/maintenance"
+	"github.com/casjay-forks/caspaste/src/storage"
 )
 
 // Panel represents the admin panel
 type Panel struct {
-	basePath   string
-	apiPath    string
-	apiVersion string
-	enabled    bool
-	setupDone  bool
-	mu         sync.RWMutex
+	basePath    string
+	apiPath     string
+	apiVersion  string
+	enabled     bool
+	setupDone   bool
+	domains     *domain.Service
+	pastes      *storage.DB
+	branding    BrandingService
+	content     ContentService
+	maintenance *maintenance.Schedule
+	rateLimits  RateLimitService
+	policies    PolicyService
+	backups     BackupService
+	network     NetworkStatus
+	csp         CSPStatus
+	cspReports  *csp.Collector
+	firewall    *firewall.Firewall
+	geoIP       *geoip.Client
+	spam        *spam.Filter
+	abuse       *abuse.Queue
+	bulk        map[string]*bulkPreview
+	settings    SettingsService
+	logDir      string
+	logFiles    map[string]string
+	streams     chan struct{}
+	closeOnce   sync.Once
+	csrfToken   func(r *http.Request) string
+	mu          sync.RWMutex
 }
 
 // Config holds admin panel configuration
@@ -75,6 +108,7 @@ func New(cfg *Config) *Panel {
 		apiVersion: cfg.APIVersion,
 		apiPath:    "api/" + cfg.APIVersion + "/" + cfg.BasePath,
 		enabled:    cfg.Enabled,
+		streams:    make(chan struct{}),
 	}
 }
 
@@ -99,6 +133,24 @@ func (p *Panel) SetSetupDone(done bool) {
 	p.setupDone = done
 }
 
+// SetCSRFTokenFunc sets how forms get the CSRF token for a request
+func (p *Panel) SetCSRFTokenFunc(fn func(r *http.Request) string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.csrfToken = fn
+}
+
+// csrfInput returns the hidden CSRF field for a form, if CSRF is enabled
+func (p *Panel) csrfInput(r *http.Request) string {
+	p.mu.RLock()
+	fn := p.csrfToken
+	p.mu.RUnlock()
+	if fn == nil {
+		return ""
+	}
+	return `<input type="hidden" name="csrf_token" value="` + html.EscapeString(fn(r)) + `">`
+}
+
 // BasePath returns the admin panel base path
 func (p *Panel) BasePath() string {
 	return p.basePath
@@ -184,16 +236,33 @@ func (p *Panel) Handler() http.Handler {
 	mux.HandleFunc("/server/network/", p.handleServerNetworkRoot)
 	mux.HandleFunc("/server/network/tor", p.handleServerNetworkTor)
 	mux.HandleFunc("/server/network/geoip", p.handleServerNetworkGeoIP)
+	mux.HandleFunc("/server/network/outbound", p.handleServerNetworkOutbound)
 
 	// Security settings
 	mux.HandleFunc("/server/security/", p.handleServerSecurityRoot)
 	mux.HandleFunc("/server/security/auth", p.handleServerSecurityAuth)
 	mux.HandleFunc("/server/security/tokens", p.handleServerSecurityTokens)
 	mux.HandleFunc("/server/security/firewall", p.handleServerSecurityFirewall)
+	mux.HandleFunc("/server/security/csp", p.handleServerSecurityCSP)
+	mux.HandleFunc("/server/security/spam", p.handleServerSecuritySpam)
 
 	// User management (if multi-user enabled)
+	mux.HandleFunc("/server/users", p.handleServerUsers)
 	mux.HandleFunc("/server/users/", p.handleServerUsers)
 
+	// Custom domains (PART 36)
+	mux.HandleFunc("/server/domains", p.handleServerDomains)
+	mux.HandleFunc("/server/domains/", p.handleServerDomainDetail)
+	mux.HandleFunc("/server/branding", p.handleServerBranding)
+	mux.HandleFunc("/server/content", p.handleServerContent)
+	mux.HandleFunc("/server/content/", p.handleServerContentPage)
+	mux.HandleFunc("/server/maintenance", p.handleServerMaintenance)
+	mux.HandleFunc("/server/ratelimit", p.handleServerRateLimits)
+	mux.HandleFunc("/server/reports", p.handleServerReports)
+	mux.HandleFunc("/server/pinned", p.handleServerPinned)
+	mux.HandleFunc("/server/pastes", p.handleServerPastes)
+	mux.HandleFunc("/server/pastes/bulk", p.handleServerPastesBulk)
+
 	return mux
 }
 
@@ -214,13 +283,40 @@ func (p *Panel) APIHandler() http.Handler {
 	mux.HandleFunc("/server/email", p.apiServerEmail)
 	mux.HandleFunc("/server/scheduler", p.apiServerScheduler)
 	mux.HandleFunc("/server/logs", p.apiServerLogs)
+	mux.HandleFunc("/server/logs/", p.apiServerLogs)
+	mux.HandleFunc("/server/logs/audit", p.apiServerLogsAudit)
 	mux.HandleFunc("/server/backup", p.apiServerBackup)
+	mux.HandleFunc("/server/backup/", p.apiServerBackup)
 	mux.HandleFunc("/server/info", p.apiServerInfo)
 	mux.HandleFunc("/server/metrics", p.apiServerMetrics)
 	mux.HandleFunc("/server/network/geoip", p.apiServerNetworkGeoIP)
+	mux.HandleFunc("/server/network/geoip/update", p.apiServerNetworkGeoIPUpdate)
 	mux.HandleFunc("/server/network/tor", p.apiServerNetworkTor)
+	mux.HandleFunc("/server/network/outbound", p.apiServerNetworkOutbound)
 	mux.HandleFunc("/server/security/tokens", p.apiServerSecurityTokens)
+	mux.HandleFunc("/server/security/csp", p.apiServerSecurityCSP)
+	mux.HandleFunc("/server/security/firewall", p.apiServerSecurityFirewall)
+	mux.HandleFunc("/server/security/firewall/", p.apiServerSecurityFirewall)
+	mux.HandleFunc("/server/security/spam", p.apiServerSecuritySpam)
+	mux.HandleFunc("/server/security/spam/", p.apiServerSecuritySpam)
 	mux.HandleFunc("/server/users", p.apiServerUsers)
+	mux.HandleFunc("/server/domains", p.apiServerDomains)
+	mux.HandleFunc("/server/domains/", p.apiServerDomain)
+	mux.HandleFunc("/server/branding", p.apiServerBranding)
+	mux.HandleFunc("/server/branding/", p.apiServerBrandingAsset)
+	mux.HandleFunc("/server/content", p.apiServerContent)
+	mux.HandleFunc("/server/content/", p.apiServerContent)
+	mux.HandleFunc("/server/maintenance/windows", p.apiServerMaintenance)
+	mux.HandleFunc("/server/maintenance/windows/", p.apiServerMaintenance)
+	mux.HandleFunc("/server/ratelimit", p.apiServerRateLimits)
+	mux.HandleFunc("/server/ratelimit/", p.apiServerRateLimits)
+	mux.HandleFunc("/server/policies", p.apiServerPolicies)
+	mux.HandleFunc("/server/pastes", p.apiServerPastes)
+	mux.HandleFunc("/server/pastes/", p.apiServerPastes)
+	mux.HandleFunc("/server/reports", p.apiServerReports)
+	mux.HandleFunc("/server/reports/", p.apiServerReports)
+	mux.HandleFunc("/server/templates", p.apiServerTemplates)
+	mux.HandleFunc("/server/templates/", p.apiServerTemplates)
 
 	return mux
 }
@@ -231,7 +327,7 @@ func (p *Panel) handleDashboard(w http.ResponseWriter, r *http.Request) {
 		http.NotFound(w, r)
 		return
 	}
-	p.renderPage(w, "Dashboard", p.dashboardContent())
+	p.renderPage(w, "Dashboard", p.dashboardContent(r))
 }
 
 // Admin's own profile
@@ -259,10 +355,6 @@ func (p *Panel) handleServerRoot(w http.ResponseWriter, r *http.Request) {
 	http.NotFound(w, r)
 }
 
-func (p *Panel) handleServerSettings(w http.ResponseWriter, r *http.Request) {
-	p.renderPage(w, "Server Settings", p.serverSettingsContent())
-}
-
 func (p *Panel) handleServerSSL(w http.ResponseWriter, r *http.Request) {
 	p.renderPage(w, "SSL/TLS", p.serverSSLContent())
 }
@@ -275,18 +367,6 @@ func (p *Panel) handleServerScheduler(w http.ResponseWriter, r *http.Request) {
 	p.renderPage(w, "Scheduled Tasks", p.serverSchedulerContent())
 }
 
-func (p *Panel) handleServerLogs(w http.ResponseWriter, r *http.Request) {
-	p.renderPage(w, "Server Logs", p.serverLogsContent())
-}
-
-func (p *Panel) handleServerLogsAudit(w http.ResponseWriter, r *http.Request) {
-	p.renderPage(w, "Audit Logs", p.serverLogsAuditContent())
-}
-
-func (p *Panel) handleServerBackup(w http.ResponseWriter, r *http.Request) {
-	p.renderPage(w, "Backup & Restore", p.serverBackupContent())
-}
-
 func (p *Panel) handleServerUpdates(w http.ResponseWriter, r *http.Request) {
 	p.renderPage(w, "Updates", p.serverUpdatesContent())
 }
@@ -296,7 +376,7 @@ func (p *Panel) handleServerInfo(w http.ResponseWriter, r *http.Request) {
 }
 
 func (p *Panel) handleServerMetrics(w http.ResponseWriter, r *http.Request) {
-	p.renderPage(w, "Metrics Dashboard", p.serverMetricsContent())
+	p.renderPage(w, "Metrics Dashboard", p.serverMetricsContent()+p.pasteStorageContent(r.Context()))
 }
 
 func (p *Panel) handleServerNetworkRoot(w http.ResponseWriter, r *http.Request) {
@@ -311,10 +391,6 @@ func (p *Panel) handleServerNetworkTor(w http.ResponseWriter, r *http.Request) {
 	p.renderPage(w, "Tor Configuration", p.serverNetworkTorContent())
 }
 
-func (p *Panel) handleServerNetworkGeoIP(w http.ResponseWriter, r *http.Request) {
-	p.renderPage(w, "GeoIP Settings", p.serverNetworkGeoIPContent())
-}
-
 func (p *Panel) handleServerSecurityRoot(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Path == "/server/security/" || r.URL.Path == "/server/security" {
 		http.Redirect(w, r, "/"+p.basePath+"/server/security/auth", http.StatusSeeOther)
@@ -331,14 +407,6 @@ func (p *Panel) handleServerSecurityTokens(w http.ResponseWriter, r *http.Reques
 	p.renderPage(w, "API Tokens", p.serverSecurityTokensContent())
 }
 
-func (p *Panel) handleServerSecurityFirewall(w http.ResponseWriter, r *http.Request) {
-	p.renderPage(w, "Firewall Rules", p.serverSecurityFirewallContent())
-}
-
-func (p *Panel) handleServerUsers(w http.ResponseWriter, r *http.Request) {
-	p.renderPage(w, "User Management", p.serverUsersContent())
-}
-
 // renderPage renders an admin page with the common layout
 func (p *Panel) renderPage(w http.ResponseWriter, title, content string) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -523,6 +591,38 @@ func (p *Panel) renderPage(w http.ResponseWriter, title, content string) {
         .mt-lg {
             margin-top: 1.5rem;
         }
+        .table {
+            width: 100%%;
+            border-collapse: collapse;
+        }
+        .table th, .table td {
+            text-align: left;
+            padding: 0.5rem;
+            border-bottom: 1px solid var(--border);
+        }
+        .table a { color: var(--accent); }
+        .filters, .card form {
+            display: flex;
+            gap: 0.5rem;
+            margin-bottom: 0.5rem;
+        }
+        .card form.stacked {
+            flex-direction: column;
+            align-items: flex-start;
+        }
+        .card form.stacked label { display: flex; flex-direction: column; gap: 0.25rem; width: 100%%; }
+        .notice-error { border-color: var(--error); color: var(--error); }
+        .notice-success { border-color: var(--success); color: var(--success); }
+        .notice-warning { border-color: var(--warning); color: var(--warning); }
+        .field-error { color: var(--error); }
+        .card pre { white-space: pre-wrap; overflow: auto; max-height: 30rem; }
+        input, select, textarea {
+            background: var(--bg-primary);
+            color: var(--text-primary);
+            border: 1px solid var(--border);
+            border-radius: 4px;
+            padding: 0.4rem;
+        }
         .footer {
             height: 40px;
             background: var(--bg-secondary);
@@ -549,7 +649,7 @@ func (p *Panel) renderPage(w http.ResponseWriter, title, content string) {
                 <h1>CasPaste</h1>
             </div>
             <ul class="sidebar-nav">
-                <li><a href="/%s/">Dashboard</a></li>
+                <li><a href="/%s">Dashboard</a></li>
             </ul>
             <div class="sidebar-section">
                 <div class="sidebar-section-title">Account</div>
@@ -563,6 +663,13 @@ func (p *Panel) renderPage(w http.ResponseWriter, title, content string) {
                 <div class="sidebar-section-title">Server</div>
                 <ul class="sidebar-nav">
                     <li><a href="/%s/server/settings">Settings</a></li>
+                    <li><a href="/%s/server/branding">Branding</a></li>
+                    <li><a href="/%s/server/content">Content Pages</a></li>
+                    <li><a href="/%s/server/maintenance">Maintenance</a></li>
+                    <li><a href="/%s/server/ratelimit">Rate Limits</a></li>
+                    <li><a href="/%s/server/pastes">Pastes</a></li>
+                    <li><a href="/%s/server/reports">Abuse Reports</a></li>
+                    <li><a href="/%s/server/pinned">Pinned Pastes</a></li>
                     <li><a href="/%s/server/ssl">SSL/TLS</a></li>
                     <li><a href="/%s/server/email">Email</a></li>
                     <li><a href="/%s/server/scheduler">Scheduler</a></li>
@@ -577,6 +684,7 @@ func (p *Panel) renderPage(w http.ResponseWriter, title, content string) {
                 <ul class="sidebar-nav">
                     <li><a href="/%s/server/network/geoip">GeoIP</a></li>
                     <li><a href="/%s/server/network/tor">Tor</a></li>
+                    <li><a href="/%s/server/network/outbound">Outbound</a></li>
                 </ul>
             </div>
             <div class="sidebar-section">
@@ -585,12 +693,15 @@ func (p *Panel) renderPage(w http.ResponseWriter, title, content string) {
                     <li><a href="/%s/server/security/auth">Authentication</a></li>
                     <li><a href="/%s/server/security/tokens">API Tokens</a></li>
                     <li><a href="/%s/server/security/firewall">Firewall</a></li>
+                    <li><a href="/%s/server/security/csp">Content Security Policy</a></li>
+                    <li><a href="/%s/server/security/spam">Spam Filter</a></li>
                 </ul>
             </div>
             <div class="sidebar-section">
                 <div class="sidebar-section-title">Users</div>
                 <ul class="sidebar-nav">
-                    <li><a href="/%s/server/users/">Manage Users</a></li>
+                    <li><a href="/%s/server/users">Manage Users</a></li>
+                    <li><a href="/%s/server/domains">Domains</a></li>
                 </ul>
             </div>
         </nav>
@@ -598,7 +709,7 @@ func (p *Panel) renderPage(w http.ResponseWriter, title, content string) {
             <header class="header">
                 <div class="header-left">
                     <div class="breadcrumb">
-                        <a href="/%s/">Admin</a>
+                        <a href="/%s">Admin</a>
                         <span>/</span>
                         <span>%s</span>
                     </div>
@@ -626,41 +737,16 @@ func (p *Panel) renderPage(w http.ResponseWriter, title, content string) {
 </html>`,
 		title,
 		p.basePath, p.basePath, p.basePath, p.basePath,
-		p.basePath, p.basePath, p.basePath, p.basePath, p.basePath, p.basePath, p.basePath, p.basePath,
-		p.basePath, p.basePath,
+		p.basePath, p.basePath, p.basePath, p.basePath, p.basePath, p.basePath, p.basePath, p.basePath, p.basePath, p.basePath, p.basePath, p.basePath, p.basePath, p.basePath, p.basePath,
 		p.basePath, p.basePath, p.basePath,
-		p.basePath,
+		p.basePath, p.basePath, p.basePath, p.basePath, p.basePath,
+		p.basePath, p.basePath,
 		p.basePath, title, title, content)
 	w.Write([]byte(html))
 }
 
 // Content generators for each page
 
-func (p *Panel) dashboardContent() string {
-	return `<div class="stats-grid">
-    <div class="stat-card">
-        <div class="stat-value">0</div>
-        <div class="stat-label">Total Pastes</div>
-    </div>
-    <div class="stat-card">
-        <div class="stat-value">0</div>
-        <div class="stat-label">Active Users</div>
-    </div>
-    <div class="stat-card">
-        <div class="stat-value">0 MB</div>
-        <div class="stat-label">Storage Used</div>
-    </div>
-    <div class="stat-card">
-        <div class="stat-value">0</div>
-        <div class="stat-label">Requests Today</div>
-    </div>
-</div>
-<div class="card mt-lg">
-    <div class="card-title">System Status</div>
-    <p>Server is running normally.</p>
-</div>`
-}
-
 func (p *Panel) profileContent() string {
 	return `<div class="card">
     <div class="card-title">Admin Profile</div>
@@ -682,13 +768,6 @@ func (p *Panel) notificationsContent() string {
 </div>`
 }
 
-func (p *Panel) serverSettingsContent() string {
-	return `<div class="card">
-    <div class="card-title">General Settings</div>
-    <p>Configure server settings.</p>
-</div>`
-}
-
 func (p *Panel) serverSSLContent() string {
 	return `<div class="card">
     <div class="card-title">SSL/TLS Configuration</div>
@@ -710,27 +789,6 @@ func (p *Panel) serverSchedulerContent() string {
 </div>`
 }
 
-func (p *Panel) serverLogsContent() string {
-	return `<div class="card">
-    <div class="card-title">Server Logs</div>
-    <p>View server logs and activity.</p>
-</div>`
-}
-
-func (p *Panel) serverLogsAuditContent() string {
-	return `<div class="card">
-    <div class="card-title">Audit Logs</div>
-    <p>View security audit logs.</p>
-</div>`
-}
-
-func (p *Panel) serverBackupContent() string {
-	return `<div class="card">
-    <div class="card-title">Backup & Restore</div>
-    <p>Create backups and restore from previous backups.</p>
-</div>`
-}
-
 func (p *Panel) serverUpdatesContent() string {
 	return `<div class="card">
     <div class="card-title">Updates</div>
@@ -759,13 +817,6 @@ func (p *Panel) serverNetworkTorContent() string {
 </div>`
 }
 
-func (p *Panel) serverNetworkGeoIPContent() string {
-	return `<div class="card">
-    <div class="card-title">GeoIP Settings</div>
-    <p>Configure GeoIP blocking and location detection.</p>
-</div>`
-}
-
 func (p *Panel) serverSecurityAuthContent() string {
 	return `<div class="card">
     <div class="card-title">Authentication Settings</div>
@@ -780,27 +831,8 @@ func (p *Panel) serverSecurityTokensContent() string {
 </div>`
 }
 
-func (p *Panel) serverSecurityFirewallContent() string {
-	return `<div class="card">
-    <div class="card-title">Firewall Rules</div>
-    <p>Configure IP blocking and firewall rules.</p>
-</div>`
-}
-
-func (p *Panel) serverUsersContent() string {
-	return `<div class="card">
-    <div class="card-title">User Management</div>
-    <p>Manage user accounts (if multi-user mode enabled).</p>
-</div>`
-}
-
 // API Handlers
 
-func (p *Panel) apiStatus(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(`{"ok": true, "data": {"status": "running"}}` + "\n"))
-}
-
 func (p *Panel) apiProfile(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Write([]byte(`{"ok": true, "data": {"username": "admin"}}` + "\n"))
@@ -811,11 +843,6 @@ func (p *Panel) apiPreferences(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(`{"ok": true, "data": {"theme": "dark", "language": "en"}}` + "\n"))
 }
 
-func (p *Panel) apiServerSettings(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(`{"ok": true, "data": {}}` + "\n"))
-}
-
 func (p *Panel) apiServerSSL(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Write([]byte(`{"ok": true, "data": {"enabled": false}}` + "\n"))
@@ -831,29 +858,18 @@ func (p *Panel) apiServerScheduler(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(`{"ok": true, "data": {"tasks": []}}` + "\n"))
 }
 
-func (p *Panel) apiServerLogs(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(`{"ok": true, "data": {"logs": []}}` + "\n"))
-}
-
-func (p *Panel) apiServerBackup(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(`{"ok": true, "data": {"backups": []}}` + "\n"))
-}
-
 func (p *Panel) apiServerInfo(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Write([]byte(`{"ok": true, "data": {"version": "1.0.0"}}` + "\n"))
 }
 
 func (p *Panel) apiServerMetrics(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(`{"ok": true, "data": {"uptime": 0}}` + "\n"))
-}
-
-func (p *Panel) apiServerNetworkGeoIP(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(`{"ok": true, "data": {"enabled": false}}` + "\n"))
+	stats, err := p.pasteStorageStats(r.Context())
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "SERVER_ERROR", err.Error())
+		return
+	}
+	writeAPIData(w, map[string]interface{}{"uptime": 0, "storage": stats})
 }
 
 func (p *Panel) apiServerNetworkTor(w http.ResponseWriter, r *http.Request) {
@@ -866,7 +882,15 @@ func (p *Panel) apiServerSecurityTokens(w http.ResponseWriter, r *http.Request)
 	w.Write([]byte(`{"ok": true, "data": {"tokens": []}}` + "\n"))
 }
 
-func (p *Panel) apiServerUsers(w http.ResponseWriter, r *http.Request) {
+// writeAPIData writes a successful admin API response
+func writeAPIData(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "data": data})
+}
+
+// writeAPIError writes a failed admin API response
+func writeAPIError(w http.ResponseWriter, status int, code, message string) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(`{"ok": true, "data": {"users": []}}` + "\n"))
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": code, "message": message})
 }
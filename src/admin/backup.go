@@ -0,0 +1,203 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package admin
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// BackupArchive is a backup file in the backup directory
+type BackupArchive struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	Created time.Time `json:"created"`
+	// Made by the scheduled job, and so subject to the retention count
+	Scheduled bool `json:"scheduled"`
+}
+
+// BackupStatus describes the scheduled backup job and the archives on disk
+type BackupStatus struct {
+	Schedule  string `json:"schedule"`
+	Retention int    `json:"retention"`
+	Dir       string `json:"dir"`
+	// Remote copies, e.g. "s3://bucket/prefix" or "sftp://host/dir"
+	Uploads []string `json:"uploads"`
+	// Whether this replica runs the job; only the leader does
+	Leader     bool      `json:"leader"`
+	LastRun    time.Time `json:"last_run"`
+	LastStatus string    `json:"last_status"`
+	LastError  string    `json:"last_error,omitempty"`
+	NextRun    time.Time `json:"next_run"`
+	// Newest first
+	Archives []BackupArchive `json:"archives"`
+}
+
+// BackupService reports on scheduled backups and starts one on request
+type BackupService interface {
+	BackupStatus() (BackupStatus, error)
+	// RunBackup starts the job in the background
+	RunBackup() error
+}
+
+// SetBackupService enables the backup page of the admin panel
+func (p *Panel) SetBackupService(svc BackupService) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.backups = svc
+}
+
+func (p *Panel) backupService() BackupService {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.backups
+}
+
+// backupTime formats a job time, which is zero until there is one
+func backupTime(t time.Time, none string) string {
+	if t.IsZero() {
+		return none
+	}
+	return t.Format("2006-01-02 15:04:05 MST")
+}
+
+// UI handlers
+
+// handleServerBackup shows the backup job and the archives, and runs the job
+func (p *Panel) handleServerBackup(w http.ResponseWriter, r *http.Request) {
+	svc := p.backupService()
+	if svc == nil {
+		p.renderPage(w, "Backup & Restore", `<div class="card">
+    <div class="card-title">Backup & Restore</div>
+    <p>Scheduled backups are not enabled. Set <code>backup.enabled: true</code> in the config file, or back up from the command line with <code>caspaste --maintenance backup</code>.</p>
+</div>`)
+		return
+	}
+
+	var errMsg, message string
+	if r.Method == http.MethodPost {
+		if err := svc.RunBackup(); err != nil {
+			errMsg = err.Error()
+		} else {
+			http.Redirect(w, r, "/"+p.basePath+"/server/backup?started=1", http.StatusSeeOther)
+			return
+		}
+	} else if r.URL.Query().Get("started") != "" {
+		message = "Backup started. Reload this page to see when it is done."
+	}
+
+	status, err := svc.BackupStatus()
+	if err != nil && errMsg == "" {
+		errMsg = err.Error()
+	}
+
+	var out strings.Builder
+	if errMsg != "" {
+		fmt.Fprintf(&out, `<div class="card notice-error">%s</div>
+`, html.EscapeString(errMsg))
+	}
+	if message != "" {
+		fmt.Fprintf(&out, `<div class="card notice-success">%s</div>
+`, message)
+	}
+
+	uploads := "none"
+	if len(status.Uploads) > 0 {
+		uploads = strings.Join(status.Uploads, ", ")
+	}
+	lastStatus := status.LastStatus
+	if status.LastError != "" {
+		lastStatus += ": " + status.LastError
+	}
+	var leaderNote string
+	if !status.Leader {
+		leaderNote = `
+    <p>This replica is not the leader; the leader runs the job, and its archives are in its own backup directory.</p>`
+	}
+	fmt.Fprintf(&out, `<div class="card">
+    <div class="card-title">Scheduled Backups</div>
+    <table class="table">
+        <tbody>
+            <tr><th>Schedule</th><td>%s</td></tr>
+            <tr><th>Archives kept</th><td>%d</td></tr>
+            <tr><th>Directory</th><td>%s</td></tr>
+            <tr><th>Uploaded to</th><td>%s</td></tr>
+            <tr><th>Last run</th><td>%s</td></tr>
+            <tr><th>Last status</th><td>%s</td></tr>
+            <tr><th>Next run</th><td>%s</td></tr>
+        </tbody>
+    </table>%s
+    <form method="post">%s<input type="hidden" name="action" value="run"><button type="submit" class="btn btn-primary">Run now</button></form>
+</div>
+`, html.EscapeString(status.Schedule), status.Retention, html.EscapeString(status.Dir), html.EscapeString(uploads),
+		backupTime(status.LastRun, "never"), html.EscapeString(lastStatus), backupTime(status.NextRun, "not scheduled"),
+		leaderNote, p.csrfInput(r))
+
+	fmt.Fprintf(&out, `<div class="card">
+    <div class="card-title">Archives</div>
+    <p>Restore with <code>caspaste --maintenance "restore %s"</code>; <code>--dry-run</code> shows what would be replaced.</p>
+    <table class="table">
+        <thead><tr><th>Name</th><th>Size</th><th>Created</th><th>Kind</th></tr></thead>
+        <tbody>`, html.EscapeString(filepath.Join(status.Dir, "NAME")))
+	for _, a := range status.Archives {
+		kind := "manual"
+		if a.Scheduled {
+			kind = "scheduled"
+		}
+		fmt.Fprintf(&out, `
+            <tr><td>%s</td><td>%.2f MB</td><td>%s</td><td>%s</td></tr>`,
+			html.EscapeString(a.Name), float64(a.Size)/1024/1024, backupTime(a.Created, ""), kind)
+	}
+	if len(status.Archives) == 0 {
+		out.WriteString(`
+            <tr><td colspan="4">No backups yet</td></tr>`)
+	}
+	out.WriteString(`
+        </tbody>
+    </table>
+</div>`)
+
+	p.renderPage(w, "Backup & Restore", out.String())
+}
+
+// API handlers
+
+// apiServerBackup handles
+//
+//	GET  /server/backup      - job status and archives
+//	POST /server/backup/run  - start a backup now
+func (p *Panel) apiServerBackup(w http.ResponseWriter, r *http.Request) {
+	svc := p.backupService()
+	if svc == nil {
+		writeAPIError(w, http.StatusNotFound, "FEATURE_DISABLED", "Scheduled backups are not enabled")
+		return
+	}
+
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/server/backup"), "/")
+	switch {
+	case rest == "" && r.Method == http.MethodGet:
+		// Shown below
+	case rest == "run" && r.Method == http.MethodPost:
+		if err := svc.RunBackup(); err != nil {
+			writeAPIError(w, http.StatusConflict, "BACKUP_NOT_STARTED", err.Error())
+			return
+		}
+	default:
+		writeAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	status, err := svc.BackupStatus()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "SERVER_ERROR", err.Error())
+		return
+	}
+	writeAPIData(w, status)
+}
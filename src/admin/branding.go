@@ -0,0 +1,325 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/casjay-forks/caspaste/src/config"
+)
+
+// MaxBrandingAssetSize is the largest logo or favicon upload
+const MaxBrandingAssetSize = 1 << 20
+
+// brandingAssetTypes are the accepted upload types; SVG is left out because
+// it can carry scripts
+var brandingAssetTypes = map[string]bool{
+	"image/png":    true,
+	"image/jpeg":   true,
+	"image/gif":    true,
+	"image/webp":   true,
+	"image/x-icon": true,
+}
+
+// BrandingService reads and saves the instance branding
+// Saved changes are live on the next page load
+type BrandingService interface {
+	Branding() config.Branding
+	UpdateBranding(b config.Branding) (config.Branding, error)
+	// UploadBrandingAsset stores a logo or favicon ("logo", "favicon")
+	UploadBrandingAsset(ctx context.Context, kind string, data []byte) (config.Branding, error)
+	DeleteBrandingAsset(ctx context.Context, kind string) (config.Branding, error)
+}
+
+// SetBrandingService enables the branding editor in the admin panel
+func (p *Panel) SetBrandingService(svc BrandingService) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.branding = svc
+}
+
+func (p *Panel) brandingService() BrandingService {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.branding
+}
+
+// readBrandingAsset reads an upload from a multipart "file" field or the raw body
+// and checks its size and image type
+func readBrandingAsset(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, MaxBrandingAssetSize+64<<10)
+
+	var src io.Reader = r.Body
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			return nil, fmt.Errorf("no file uploaded")
+		}
+		defer file.Close()
+		src = file
+	}
+
+	data, err := io.ReadAll(io.LimitReader(src, MaxBrandingAssetSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("upload is larger than %d KB", MaxBrandingAssetSize>>10)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("no file uploaded")
+	}
+	if len(data) > MaxBrandingAssetSize {
+		return nil, fmt.Errorf("upload is larger than %d KB", MaxBrandingAssetSize>>10)
+	}
+	if !brandingAssetTypes[http.DetectContentType(data)] {
+		return nil, fmt.Errorf("upload must be a PNG, JPEG, GIF, WebP or ICO image")
+	}
+	return data, nil
+}
+
+// writeBrandingError maps branding errors to admin API errors
+func writeBrandingError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, config.ErrInvalidBranding):
+		writeAPIError(w, http.StatusBadRequest, "INVALID_BRANDING", err.Error())
+	case errors.Is(err, config.ErrBrandingReadOnly):
+		writeAPIError(w, http.StatusConflict, "READ_ONLY", err.Error())
+	default:
+		writeAPIError(w, http.StatusInternalServerError, "SERVER_ERROR", "Failed to save branding")
+	}
+}
+
+// UI handlers
+
+// handleServerBranding renders the branding editor and applies its forms
+func (p *Panel) handleServerBranding(w http.ResponseWriter, r *http.Request) {
+	svc := p.brandingService()
+	if svc == nil {
+		p.renderPage(w, "Branding", `<div class="card">
+    <div class="card-title">Branding</div>
+    <p>Branding is not enabled.</p>
+</div>`)
+		return
+	}
+
+	// On a failed save the form keeps what was entered
+	b := svc.Branding()
+	var message, errMsg string
+	if r.Method == http.MethodPost {
+		var err error
+		switch r.URL.Query().Get("action") {
+		case "upload":
+			var data []byte
+			data, err = readBrandingAsset(w, r)
+			if err == nil {
+				_, err = svc.UploadBrandingAsset(r.Context(), r.FormValue("kind"), data)
+			}
+		case "remove":
+			_, err = svc.DeleteBrandingAsset(r.Context(), r.FormValue("kind"))
+		default:
+			b.Title = strings.TrimSpace(r.FormValue("title"))
+			b.TagLine = strings.TrimSpace(r.FormValue("tagline"))
+			b.Colors = config.BrandColors{
+				Header:     strings.TrimSpace(r.FormValue("color_header")),
+				HeaderFont: strings.TrimSpace(r.FormValue("color_header_font")),
+				Link:       strings.TrimSpace(r.FormValue("color_link")),
+				Accent:     strings.TrimSpace(r.FormValue("color_accent")),
+			}
+			b.FooterLinks = parseFooterLinks(r.FormValue("footer_links"))
+			_, err = svc.UpdateBranding(b)
+		}
+		if err != nil {
+			errMsg = err.Error()
+		} else {
+			http.Redirect(w, r, "/"+p.basePath+"/server/branding?saved=1", http.StatusSeeOther)
+			return
+		}
+	} else if r.URL.Query().Get("saved") != "" {
+		message = "Branding saved. Pages use it from the next load."
+	}
+
+	csrf := p.csrfInput(r)
+
+	var out strings.Builder
+	if errMsg != "" {
+		fmt.Fprintf(&out, `<div class="card notice-error">%s</div>
+`, html.EscapeString(errMsg))
+	}
+	if message != "" {
+		fmt.Fprintf(&out, `<div class="card notice-success">%s</div>
+`, message)
+	}
+
+	var links strings.Builder
+	for _, link := range b.FooterLinks {
+		fmt.Fprintf(&links, "%s | %s\n", link.Label, link.URL)
+	}
+
+	fmt.Fprintf(&out, `<div class="card">
+    <div class="card-title">Site</div>
+    <form method="post" class="stacked">%s
+        <label>Title <input type="text" name="title" value="%s" maxlength="%d"></label>
+        <label>Tagline <input type="text" name="tagline" value="%s" maxlength="%d"></label>
+        <label>Header color <input type="text" name="color_header" value="%s" placeholder="theme"></label>
+        <label>Header text color <input type="text" name="color_header_font" value="%s" placeholder="theme"></label>
+        <label>Link color <input type="text" name="color_link" value="%s" placeholder="theme"></label>
+        <label>Accent color <input type="text" name="color_accent" value="%s" placeholder="theme"></label>
+        <label>Footer links, one "Label | URL" per line
+            <textarea name="footer_links" rows="4">%s</textarea></label>
+        <button type="submit" class="btn btn-primary">Save</button>
+    </form>
+</div>
+`,
+		csrf,
+		html.EscapeString(b.Title), config.BrandingTitleMaxLength,
+		html.EscapeString(b.TagLine), config.BrandingTagLineMaxLength,
+		html.EscapeString(b.Colors.Header), html.EscapeString(b.Colors.HeaderFont),
+		html.EscapeString(b.Colors.Link), html.EscapeString(b.Colors.Accent),
+		html.EscapeString(links.String()))
+
+	assets := []struct{ kind, label, value string }{
+		{"logo", "Logo", b.Logo},
+		{"favicon", "Favicon", b.Favicon},
+	}
+	for _, a := range assets {
+		current := "Default"
+		if a.value != "" {
+			current = html.EscapeString(a.value)
+		}
+		fmt.Fprintf(&out, `<div class="card">
+    <div class="card-title">%s</div>
+    <p>Current: %s</p>
+    <form method="post" action="?action=upload" enctype="multipart/form-data">%s
+        <input type="hidden" name="kind" value="%s">
+        <input type="file" name="file" accept="image/png,image/jpeg,image/gif,image/webp,image/x-icon" required>
+        <button type="submit" class="btn btn-primary">Upload</button>
+    </form>`, a.label, current, csrf, a.kind)
+		if a.value != "" {
+			fmt.Fprintf(&out, `
+    <form method="post" action="?action=remove">%s
+        <input type="hidden" name="kind" value="%s">
+        <button type="submit" class="btn btn-secondary">Use default</button>
+    </form>`, csrf, a.kind)
+		}
+		fmt.Fprintf(&out, `
+    <p>PNG, JPEG, GIF, WebP or ICO, up to %d KB.</p>
+</div>
+`, MaxBrandingAssetSize>>10)
+	}
+
+	p.renderPage(w, "Branding", out.String())
+}
+
+// parseFooterLinks reads "Label | URL" lines; validation happens on save
+func parseFooterLinks(s string) []config.FooterLink {
+	var links []config.FooterLink
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		label, link, _ := strings.Cut(line, "|")
+		links = append(links, config.FooterLink{
+			Label: strings.TrimSpace(label),
+			URL:   strings.TrimSpace(link),
+		})
+	}
+	return links
+}
+
+// API handlers
+
+// apiServerBranding handles
+//
+//	GET /server/branding  - current branding
+//	PUT /server/branding  - replace branding (logo and favicon are kept if omitted)
+func (p *Panel) apiServerBranding(w http.ResponseWriter, r *http.Request) {
+	svc := p.brandingService()
+	if svc == nil {
+		writeAPIError(w, http.StatusNotFound, "FEATURE_DISABLED", "Branding is not enabled")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeAPIData(w, svc.Branding())
+
+	case http.MethodPut:
+		current := svc.Branding()
+		var b config.Branding
+		body, err := io.ReadAll(io.LimitReader(r.Body, 64<<10))
+		if err != nil || json.Unmarshal(body, &b) != nil {
+			writeAPIError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid JSON body")
+			return
+		}
+		var fields map[string]json.RawMessage
+		json.Unmarshal(body, &fields)
+		if _, ok := fields["logo"]; !ok {
+			b.Logo = current.Logo
+		}
+		if _, ok := fields["favicon"]; !ok {
+			b.Favicon = current.Favicon
+		}
+
+		b, err = svc.UpdateBranding(b)
+		if err != nil {
+			writeBrandingError(w, err)
+			return
+		}
+		writeAPIData(w, b)
+
+	default:
+		writeAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+	}
+}
+
+// apiServerBrandingAsset handles
+//
+//	POST   /server/branding/{logo|favicon}  - upload (multipart "file" field or raw body)
+//	DELETE /server/branding/{logo|favicon}  - go back to the default
+func (p *Panel) apiServerBrandingAsset(w http.ResponseWriter, r *http.Request) {
+	svc := p.brandingService()
+	if svc == nil {
+		writeAPIError(w, http.StatusNotFound, "FEATURE_DISABLED", "Branding is not enabled")
+		return
+	}
+
+	kind := strings.TrimPrefix(r.URL.Path, "/server/branding/")
+	if kind != "logo" && kind != "favicon" {
+		writeAPIError(w, http.StatusNotFound, "NOT_FOUND", "Unknown branding asset")
+		return
+	}
+
+	var b config.Branding
+	var err error
+	switch r.Method {
+	case http.MethodPost:
+		data, readErr := readBrandingAsset(w, r)
+		if readErr != nil {
+			writeAPIError(w, http.StatusBadRequest, "INVALID_UPLOAD", readErr.Error())
+			return
+		}
+		b, err = svc.UploadBrandingAsset(r.Context(), kind, data)
+	case http.MethodDelete:
+		b, err = svc.DeleteBrandingAsset(r.Context(), kind)
+	default:
+		writeAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+	if err != nil {
+		writeBrandingError(w, err)
+		return
+	}
+	writeAPIData(w, b)
+}
@@ -0,0 +1,301 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package admin
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/audit"
+	"github.com/casjay-forks/caspaste/src/netshare"
+	"github.com/casjay-forks/caspaste/src/storage"
+)
+
+// A bulk action is run in two steps: a preview counts the matching pastes
+// and returns a token, and only the pastes counted by the preview are then
+// changed when the token is confirmed
+
+// bulkPreviewTTL is how long a preview can be confirmed
+const bulkPreviewTTL = 15 * time.Minute
+
+// bulkSampleSize is how many of the matching pastes a preview shows
+const bulkSampleSize = 20
+
+// bulkPreview is a counted bulk action waiting to be confirmed
+type bulkPreview struct {
+	action  string
+	filter  storage.BulkFilter
+	ids     []string
+	expires time.Time
+}
+
+// bulkRequest is the filter and action of a preview
+type bulkRequest struct {
+	IPRange     string `json:"ip_range"`
+	From        string `json:"from"`
+	To          string `json:"to"`
+	ContentHash string `json:"content_hash"`
+	User        string `json:"user"`
+	Action      string `json:"action"`
+}
+
+// filter reads the dates of the request the way the admin lists do
+func (req bulkRequest) filter() (storage.BulkFilter, error) {
+	f := storage.BulkFilter{
+		IPRange:     req.IPRange,
+		ContentHash: req.ContentHash,
+		User:        req.User,
+	}
+	var err error
+	if f.From, err = parseListDate(req.From, false); err != nil {
+		return f, err
+	}
+	if f.To, err = parseListDate(req.To, true); err != nil {
+		return f, err
+	}
+	return f, f.Check()
+}
+
+// bulkPrepare counts the pastes a bulk action would change and keeps them
+// under a new token, returning the token and the matching pastes
+func (p *Panel) bulkPrepare(db *storage.DB, req bulkRequest) (string, []storage.ModerationItem, time.Time, error) {
+	if req.Action != storage.BulkDelete && req.Action != storage.BulkExpire {
+		return "", nil, time.Time{}, fmt.Errorf("action must be %q or %q", storage.BulkDelete, storage.BulkExpire)
+	}
+	filter, err := req.filter()
+	if err != nil {
+		return "", nil, time.Time{}, err
+	}
+	items, err := db.PasteBulkMatch(filter)
+	if err != nil {
+		return "", nil, time.Time{}, err
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, time.Time{}, err
+	}
+	token := hex.EncodeToString(b)
+
+	preview := &bulkPreview{
+		action:  req.Action,
+		filter:  filter,
+		ids:     make([]string, len(items)),
+		expires: time.Now().Add(bulkPreviewTTL),
+	}
+	for i, item := range items {
+		preview.ids[i] = item.ID
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.bulk == nil {
+		p.bulk = make(map[string]*bulkPreview)
+	}
+	for t, old := range p.bulk {
+		if time.Now().After(old.expires) {
+			delete(p.bulk, t)
+		}
+	}
+	p.bulk[token] = preview
+	return token, items, preview.expires, nil
+}
+
+// errBulkToken is returned for a preview token that is unknown, expired or
+// already used
+var errBulkToken = errors.New("the preview has expired or was already used; preview the action again")
+
+// bulkApply runs the previewed action of token once, and audits it
+func (p *Panel) bulkApply(db *storage.DB, token, ip string) (storage.BulkResult, error) {
+	p.mu.Lock()
+	preview, ok := p.bulk[token]
+	delete(p.bulk, token)
+	p.mu.Unlock()
+	if !ok || time.Now().After(preview.expires) {
+		return storage.BulkResult{}, errBulkToken
+	}
+
+	result, err := db.PasteBulkApply(preview.action, preview.ids)
+	if err != nil {
+		return result, err
+	}
+	event := audit.EventPasteBulkDeleted
+	if preview.action == storage.BulkExpire {
+		event = audit.EventPasteBulkExpired
+	}
+	audit.PasteBulk(event, preview.filter.String(), result.Matched, result.Done, result.Skipped, result.Failed, ip)
+	return result, nil
+}
+
+// apiPasteBulk handles the two steps of a bulk action
+//
+//	POST /server/pastes/bulk/preview {"ip_range": "", "from": "", "to": "", "content_hash": "", "user": "", "action": "delete|expire"}
+//	POST /server/pastes/bulk         {"token": "..."}
+func (p *Panel) apiPasteBulk(w http.ResponseWriter, r *http.Request, db *storage.DB, step string) {
+	if r.Method != http.MethodPost {
+		writeAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	if step == "preview" {
+		var req bulkRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "Invalid JSON body")
+			return
+		}
+		token, items, expires, err := p.bulkPrepare(db, req)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+			return
+		}
+		writeAPIData(w, map[string]interface{}{
+			"token":      token,
+			"action":     req.Action,
+			"count":      len(items),
+			"sample":     items[:min(len(items), bulkSampleSize)],
+			"expires_at": expires.UTC().Format(time.RFC3339),
+		})
+		return
+	}
+
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		writeAPIError(w, http.StatusBadRequest, "BAD_REQUEST", "A preview token is required")
+		return
+	}
+	result, err := p.bulkApply(db, req.Token, netshare.GetClientAddr(r).String())
+	if err == errBulkToken {
+		writeAPIError(w, http.StatusConflict, "PREVIEW_EXPIRED", err.Error())
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "SERVER_ERROR", "Failed to apply the bulk action")
+		return
+	}
+	writeAPIData(w, result)
+}
+
+// UI handlers
+
+// handleServerPastesBulk deletes or expires the pastes matching a filter,
+// after showing how many match
+func (p *Panel) handleServerPastesBulk(w http.ResponseWriter, r *http.Request) {
+	db := p.pasteStore(r.Context())
+	if db == nil {
+		p.renderPage(w, "Bulk Actions", `<div class="card">
+    <div class="card-title">Bulk Actions</div>
+    <p>Paste management is not enabled.</p>
+</div>`)
+		return
+	}
+
+	// The form starts from the query, so other pages can link to a filter
+	req := bulkRequest{
+		IPRange:     r.URL.Query().Get("ip_range"),
+		From:        r.URL.Query().Get("from"),
+		To:          r.URL.Query().Get("to"),
+		ContentHash: r.URL.Query().Get("content_hash"),
+		User:        r.URL.Query().Get("user"),
+		Action:      storage.BulkDelete,
+	}
+	csrf := p.csrfInput(r)
+
+	var out strings.Builder
+	if r.Method == http.MethodPost {
+		if token := r.FormValue("token"); token != "" {
+			result, err := p.bulkApply(db, token, netshare.GetClientAddr(r).String())
+			if err != nil {
+				fmt.Fprintf(&out, `<div class="card notice-error">%s</div>
+`, html.EscapeString(err.Error()))
+			} else {
+				fmt.Fprintf(&out, `<div class="card notice-success">%s: %d of %d pastes changed, %d skipped, %d failed.</div>
+`, html.EscapeString(result.Action), result.Done, result.Matched, result.Skipped, result.Failed)
+			}
+		} else {
+			req = bulkRequest{
+				IPRange:     r.FormValue("ip_range"),
+				From:        r.FormValue("from"),
+				To:          r.FormValue("to"),
+				ContentHash: r.FormValue("content_hash"),
+				User:        r.FormValue("user"),
+				Action:      r.FormValue("action"),
+			}
+			token, items, expires, err := p.bulkPrepare(db, req)
+			if err != nil {
+				fmt.Fprintf(&out, `<div class="card notice-error">%s</div>
+`, html.EscapeString(err.Error()))
+			} else {
+				out.WriteString(bulkPreviewContent(csrf, req.Action, token, items, expires))
+			}
+		}
+	}
+
+	fmt.Fprintf(&out, `<div class="card">
+    <div class="card-title">Bulk Actions</div>
+    <p>Delete or expire every paste matching a filter, such as a spam wave. Every filter given must match. The matching pastes are counted first, and only those are changed once confirmed; legal holds and write-once pastes are skipped.</p>
+    <form method="post">
+        %s
+        <input type="text" name="ip_range" value="%s" placeholder="IP address or CIDR range">
+        <input type="date" name="from" value="%s" title="Created from">
+        <input type="date" name="to" value="%s" title="Created until">
+        <input type="text" name="content_hash" value="%s" placeholder="Content hash (sha256:...)">
+        <input type="text" name="user" value="%s" placeholder="Username or author">
+        %s
+        <button type="submit" class="btn btn-secondary">Preview</button>
+    </form>
+    <p><a href="/%s/server/pastes">Back to pastes</a></p>
+</div>`, csrf, html.EscapeString(req.IPRange), html.EscapeString(req.From), html.EscapeString(req.To),
+		html.EscapeString(req.ContentHash), html.EscapeString(req.User),
+		statusSelect("action", req.Action,
+			storage.BulkDelete, "Delete",
+			storage.BulkExpire, "Expire now"),
+		p.basePath)
+
+	p.renderPage(w, "Bulk Actions", out.String())
+}
+
+// bulkPreviewContent shows the count and a sample of a previewed action,
+// with the button that confirms it
+func bulkPreviewContent(csrf, action, token string, items []storage.ModerationItem, expires time.Time) string {
+	var out strings.Builder
+	if len(items) == 0 {
+		return `<div class="card notice-warning">No pastes match the filter.</div>
+`
+	}
+	fmt.Fprintf(&out, `<div class="card notice-warning">
+    <div class="card-title">%d pastes match</div>
+    <p>Showing the first %d. Confirm before %s UTC to %s them; pastes created since the preview are left alone.</p>
+    <table class="table">
+        <thead><tr><th>Created (UTC)</th><th>Paste</th><th>Title</th><th>User</th><th>IP</th><th>Size</th></tr></thead>
+        <tbody>`, len(items), min(len(items), bulkSampleSize), expires.UTC().Format(time.TimeOnly), html.EscapeString(action))
+	for _, paste := range items[:min(len(items), bulkSampleSize)] {
+		user := paste.Owner
+		if user == "" {
+			user = paste.Author
+		}
+		fmt.Fprintf(&out, `
+            <tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>`,
+			time.Unix(paste.CreateTime, 0).UTC().Format(time.RFC3339), paste.ID,
+			html.EscapeString(paste.Title), html.EscapeString(user), html.EscapeString(paste.CreatorIP),
+			sizeString(paste.Size))
+	}
+	fmt.Fprintf(&out, `
+        </tbody>
+    </table>
+    <form method="post">%s<input type="hidden" name="token" value="%s"><button class="btn btn-secondary">%s %d pastes</button></form>
+</div>
+`, csrf, token, map[string]string{storage.BulkDelete: "Delete", storage.BulkExpire: "Expire"}[action], len(items))
+	return out.String()
+}
@@ -0,0 +1,352 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/content"
+	"github.com/casjay-forks/caspaste/src/storage"
+)
+
+// contentVariables are replaced in pages when they are published
+var contentVariables = []string{
+	"{fqdn}", "{version}", "{protocol}", "{server.title}",
+	"{server.administrator.name}", "{server.administrator.email}",
+	"{web.security.contact.email}", "{web.security.contact.name}",
+}
+
+// ContentService edits the about, rules and terms pages
+// Saved pages are live on the next request
+type ContentService interface {
+	ContentPage(name string) (content.Source, error)
+	SaveContentPage(name, body string, markdown bool, author string) (storage.ContentRevision, error)
+	PreviewContentPage(body string, markdown bool) string
+	ContentRevisions(name string, limit int) ([]storage.ContentRevision, error)
+	ContentRevision(name string, revision int64) (storage.ContentRevision, error)
+}
+
+// SetContentService enables the content page editor in the admin panel
+func (p *Panel) SetContentService(svc ContentService) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.content = svc
+}
+
+func (p *Panel) contentService() ContentService {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.content
+}
+
+// writeContentError maps content errors to admin API errors
+func writeContentError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, content.ErrUnknownPage):
+		writeAPIError(w, http.StatusNotFound, "PAGE_NOT_FOUND", "Unknown content page")
+	case errors.Is(err, storage.ErrContentRevisionNotFound):
+		writeAPIError(w, http.StatusNotFound, "REVISION_NOT_FOUND", "Revision not found")
+	case errors.Is(err, content.ErrTooLarge):
+		writeAPIError(w, http.StatusRequestEntityTooLarge, "TOO_LARGE", err.Error())
+	case errors.Is(err, content.ErrReadOnly):
+		writeAPIError(w, http.StatusConflict, "READ_ONLY", err.Error())
+	default:
+		writeAPIError(w, http.StatusInternalServerError, "SERVER_ERROR", "Failed to save page")
+	}
+}
+
+// UI handlers
+
+// handleServerContent lists the content pages
+func (p *Panel) handleServerContent(w http.ResponseWriter, r *http.Request) {
+	svc := p.contentService()
+	if svc == nil {
+		p.renderPage(w, "Content Pages", `<div class="card">
+    <div class="card-title">Content Pages</div>
+    <p>Content editing is not enabled.</p>
+</div>`)
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString(`<div class="card">
+    <div class="card-title">Content Pages</div>
+    <table class="table">
+        <thead><tr><th>Page</th><th>Format</th><th>File</th></tr></thead>
+        <tbody>`)
+	for _, name := range content.Names {
+		src, err := svc.ContentPage(name)
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(&b, `
+            <tr><td><a href="/%s/server/content/%s">%s</a></td><td>%s</td><td>%s</td></tr>`,
+			p.basePath, name, name, contentFormat(src.Markdown), contentFile(src))
+	}
+	b.WriteString(`
+        </tbody>
+    </table>
+</div>`)
+
+	p.renderPage(w, "Content Pages", b.String())
+}
+
+// handleServerContentPage renders the editor for one page and handles
+// preview, publish and restore
+func (p *Panel) handleServerContentPage(w http.ResponseWriter, r *http.Request) {
+	svc := p.contentService()
+	if svc == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/server/content/")
+	if name == "" {
+		p.handleServerContent(w, r)
+		return
+	}
+	src, err := svc.ContentPage(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	body, markdown := src.Body, src.Markdown
+	var preview, message, errMsg string
+
+	if r.Method == http.MethodPost {
+		body = strings.ReplaceAll(r.FormValue("body"), "\r\n", "\n")
+		markdown = r.FormValue("markdown") != ""
+		switch r.FormValue("action") {
+		case "preview":
+			preview = svc.PreviewContentPage(body, markdown)
+		case "restore":
+			revision, _ := strconv.ParseInt(r.FormValue("revision"), 10, 64)
+			rev, err := svc.ContentRevision(name, revision)
+			if err == nil {
+				_, err = svc.SaveContentPage(name, rev.Body, rev.Markdown, fmt.Sprintf("admin (restored #%d)", revision))
+			}
+			if err != nil {
+				errMsg = err.Error()
+				break
+			}
+			http.Redirect(w, r, "/"+p.basePath+"/server/content/"+name+"?published=1", http.StatusSeeOther)
+			return
+		default:
+			if _, err := svc.SaveContentPage(name, body, markdown, "admin"); err != nil {
+				errMsg = err.Error()
+				break
+			}
+			http.Redirect(w, r, "/"+p.basePath+"/server/content/"+name+"?published=1", http.StatusSeeOther)
+			return
+		}
+	} else if revision, err := strconv.ParseInt(r.URL.Query().Get("revision"), 10, 64); err == nil {
+		rev, err := svc.ContentRevision(name, revision)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		body, markdown = rev.Body, rev.Markdown
+		message = fmt.Sprintf("Loaded revision #%d. Publish to make it live.", revision)
+	} else if r.URL.Query().Get("published") != "" {
+		message = "Published. The page is live now."
+	}
+
+	csrf := p.csrfInput(r)
+	checked := ""
+	if markdown {
+		checked = " checked"
+	}
+
+	var out strings.Builder
+	if errMsg != "" {
+		fmt.Fprintf(&out, `<div class="card notice-error">%s</div>
+`, html.EscapeString(errMsg))
+	}
+	if message != "" {
+		fmt.Fprintf(&out, `<div class="card notice-success">%s</div>
+`, message)
+	}
+	fmt.Fprintf(&out, `<div class="card">
+    <div class="card-title">Edit %s</div>
+    <p>File: %s</p>
+    <form method="post" class="stacked">%s
+        <textarea name="body" rows="20" style="width: 100%%; font-family: monospace;">%s</textarea>
+        <label><span><input type="checkbox" name="markdown" value="1"%s> Markdown</span></label>
+        <p>Variables: %s</p>
+        <div>
+            <button type="submit" name="action" value="preview" class="btn btn-secondary">Preview</button>
+            <button type="submit" name="action" value="publish" class="btn btn-primary">Publish</button>
+        </div>
+    </form>
+</div>
+`, name, contentFile(src), csrf, html.EscapeString(body), checked, html.EscapeString(strings.Join(contentVariables, " ")))
+
+	if preview != "" {
+		fmt.Fprintf(&out, `<div class="card">
+    <div class="card-title">Preview</div>
+    %s
+</div>
+`, preview)
+	}
+
+	revisions, _ := svc.ContentRevisions(name, 50)
+	out.WriteString(`<div class="card">
+    <div class="card-title">Revisions</div>
+    <table class="table">
+        <thead><tr><th>#</th><th>Saved</th><th>Author</th><th>Format</th><th></th></tr></thead>
+        <tbody>`)
+	for _, rev := range revisions {
+		fmt.Fprintf(&out, `
+            <tr><td>%d</td><td>%s</td><td>%s</td><td>%s</td><td><a href="?revision=%d">Load</a>
+                <form method="post">%s<input type="hidden" name="action" value="restore"><input type="hidden" name="revision" value="%d"><button class="btn btn-secondary">Restore</button></form></td></tr>`,
+			rev.Revision, time.Unix(rev.CreatedAt, 0).UTC().Format(time.RFC3339), html.EscapeString(rev.Author),
+			contentFormat(rev.Markdown), rev.Revision, csrf, rev.Revision)
+	}
+	out.WriteString(`
+        </tbody>
+    </table>
+</div>`)
+
+	p.renderPage(w, "Content: "+name, out.String())
+}
+
+func contentFormat(markdown bool) string {
+	if markdown {
+		return "Markdown"
+	}
+	return "Text"
+}
+
+func contentFile(src content.Source) string {
+	if src.Default {
+		return "built-in default"
+	}
+	return html.EscapeString(src.Path)
+}
+
+// API handlers
+
+// apiServerContent handles
+//
+//	GET  /server/content                                  - list pages
+//	GET  /server/content/{page}                           - page source
+//	PUT  /server/content/{page}                           - publish ({"body": "...", "markdown": true})
+//	POST /server/content/{page}/preview                   - render without saving
+//	GET  /server/content/{page}/revisions                 - revision history
+//	GET  /server/content/{page}/revisions/{n}             - one revision
+//	POST /server/content/{page}/revisions/{n}/restore     - publish a revision again
+func (p *Panel) apiServerContent(w http.ResponseWriter, r *http.Request) {
+	svc := p.contentService()
+	if svc == nil {
+		writeAPIError(w, http.StatusNotFound, "FEATURE_DISABLED", "Content editing is not enabled")
+		return
+	}
+
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/server/content"), "/")
+	if rest == "" {
+		if r.Method != http.MethodGet {
+			writeAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+			return
+		}
+		pages := []content.Source{}
+		for _, name := range content.Names {
+			src, err := svc.ContentPage(name)
+			if err != nil {
+				writeContentError(w, err)
+				return
+			}
+			pages = append(pages, src)
+		}
+		writeAPIData(w, pages)
+		return
+	}
+
+	parts := strings.Split(rest, "/")
+	name := parts[0]
+	src, err := svc.ContentPage(name)
+	if err != nil {
+		writeContentError(w, err)
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		writeAPIData(w, src)
+
+	case len(parts) == 1 && r.Method == http.MethodPut,
+		len(parts) == 2 && parts[1] == "preview" && r.Method == http.MethodPost:
+		var req struct {
+			Body     *string `json:"body"`
+			Markdown *bool   `json:"markdown"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, content.MaxSize+4096)).Decode(&req); err != nil || req.Body == nil {
+			writeAPIError(w, http.StatusBadRequest, "INVALID_JSON", "Expected a JSON body with \"body\"")
+			return
+		}
+		markdown := src.Markdown
+		if req.Markdown != nil {
+			markdown = *req.Markdown
+		}
+		if len(parts) == 2 {
+			writeAPIData(w, map[string]interface{}{"html": svc.PreviewContentPage(*req.Body, markdown)})
+			return
+		}
+		rev, err := svc.SaveContentPage(name, *req.Body, markdown, "admin api")
+		if err != nil {
+			writeContentError(w, err)
+			return
+		}
+		src, _ = svc.ContentPage(name)
+		writeAPIData(w, map[string]interface{}{"page": src, "revision": rev})
+
+	case len(parts) == 2 && parts[1] == "revisions" && r.Method == http.MethodGet:
+		revisions, err := svc.ContentRevisions(name, 100)
+		if err != nil {
+			writeContentError(w, err)
+			return
+		}
+		writeAPIData(w, revisions)
+
+	case len(parts) >= 3 && len(parts) <= 4 && parts[1] == "revisions":
+		revision, err := strconv.ParseInt(parts[2], 10, 64)
+		if err != nil {
+			writeAPIError(w, http.StatusNotFound, "REVISION_NOT_FOUND", "Revision not found")
+			return
+		}
+		rev, err := svc.ContentRevision(name, revision)
+		if err != nil {
+			writeContentError(w, err)
+			return
+		}
+		if len(parts) == 3 && r.Method == http.MethodGet {
+			writeAPIData(w, rev)
+			return
+		}
+		if len(parts) != 4 || parts[3] != "restore" || r.Method != http.MethodPost {
+			writeAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+			return
+		}
+		saved, err := svc.SaveContentPage(name, rev.Body, rev.Markdown, fmt.Sprintf("admin api (restored #%d)", revision))
+		if err != nil {
+			writeContentError(w, err)
+			return
+		}
+		src, _ = svc.ContentPage(name)
+		writeAPIData(w, map[string]interface{}{"page": src, "revision": saved})
+
+	default:
+		writeAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+	}
+}
@@ -0,0 +1,162 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package admin
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/csp"
+)
+
+// CSPPolicy is the Content Security Policy sent for a path
+type CSPPolicy struct {
+	// path.Match pattern, or "*" for the paths no override matches
+	Path   string `json:"path"`
+	Policy string `json:"policy"`
+	// Sent as Content-Security-Policy-Report-Only
+	ReportOnly bool `json:"report_only"`
+}
+
+// CSPStatus describes the policies sent and whether violations are collected
+type CSPStatus struct {
+	Reports  bool        `json:"reports"`
+	Policies []CSPPolicy `json:"policies"`
+}
+
+// SetCSP sets the policies the security page shows and the collector of
+// the violation reports browsers send
+func (p *Panel) SetCSP(status CSPStatus, reports *csp.Collector) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.csp = status
+	p.cspReports = reports
+}
+
+func (p *Panel) cspStatus() (CSPStatus, *csp.Collector) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.csp, p.cspReports
+}
+
+// UI handlers
+
+// handleServerSecurityCSP shows the policies and the violations reported
+func (p *Panel) handleServerSecurityCSP(w http.ResponseWriter, r *http.Request) {
+	status, reports := p.cspStatus()
+	if r.Method == http.MethodPost && r.FormValue("action") == "clear" && reports != nil {
+		reports.Reset()
+		http.Redirect(w, r, "/"+p.basePath+"/server/security/csp", http.StatusSeeOther)
+		return
+	}
+
+	var out strings.Builder
+	out.WriteString(`<div class="card">
+    <div class="card-title">Content Security Policy</div>
+    <table class="table">
+        <thead><tr><th>Path</th><th>Mode</th><th>Policy</th></tr></thead>
+        <tbody>`)
+	for _, policy := range status.Policies {
+		mode := "Enforced"
+		if policy.ReportOnly {
+			mode = "Report only"
+		}
+		fmt.Fprintf(&out, `
+            <tr><td><code>%s</code></td><td>%s</td><td><code>%s</code></td></tr>`,
+			html.EscapeString(policy.Path), mode, html.EscapeString(policy.Policy))
+	}
+	out.WriteString(`
+        </tbody>
+    </table>
+</div>`)
+
+	if !status.Reports || reports == nil {
+		out.WriteString(`
+<div class="card">
+    <div class="card-title">Violation Reports</div>
+    <p>Reports are turned off (<code>security.headers.disable_csp_reports</code>).</p>
+</div>`)
+		p.renderPage(w, "Content Security Policy", out.String())
+		return
+	}
+
+	fmt.Fprintf(&out, `
+<div class="card">
+    <div class="card-title">Violations</div>
+    <p>%d reports since the server started or the list was cleared. Reports are kept in memory.</p>
+    <form method="post">%s<input type="hidden" name="action" value="clear"><button class="btn btn-secondary">Clear</button></form>
+    <table class="table">
+        <thead><tr><th>Directive</th><th>Blocked</th><th>Page</th><th>Count</th><th>Last seen (UTC)</th></tr></thead>
+        <tbody>`, reports.Total(), p.csrfInput(r))
+	for _, v := range reports.Violations() {
+		fmt.Fprintf(&out, `
+            <tr><td>%s</td><td>%s</td><td>%s</td><td>%d</td><td>%s</td></tr>`,
+			html.EscapeString(v.Directive), html.EscapeString(v.BlockedURI), html.EscapeString(v.Path),
+			v.Count, time.Unix(v.LastSeen, 0).UTC().Format(time.RFC3339))
+	}
+	out.WriteString(`
+        </tbody>
+    </table>
+</div>
+<div class="card">
+    <div class="card-title">Recent Reports</div>
+    <table class="table">
+        <thead><tr><th>Time (UTC)</th><th>Page</th><th>Directive</th><th>Blocked</th><th>Source</th><th>Mode</th></tr></thead>
+        <tbody>`)
+	for _, report := range reports.Recent() {
+		source := report.SourceFile
+		if source != "" && report.Line > 0 {
+			source = fmt.Sprintf("%s:%d", source, report.Line)
+		}
+		fmt.Fprintf(&out, `
+            <tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>`,
+			time.Unix(report.Time, 0).UTC().Format(time.RFC3339), html.EscapeString(report.DocumentURI),
+			html.EscapeString(report.Directive), html.EscapeString(report.BlockedURI),
+			html.EscapeString(source), report.Disposition)
+	}
+	out.WriteString(`
+        </tbody>
+    </table>
+</div>`)
+
+	p.renderPage(w, "Content Security Policy", out.String())
+}
+
+// API handlers
+
+// apiServerSecurityCSP handles
+//
+//	GET    /server/security/csp  - policies, violation counts and recent reports
+//	DELETE /server/security/csp  - clear the reports
+func (p *Panel) apiServerSecurityCSP(w http.ResponseWriter, r *http.Request) {
+	status, reports := p.cspStatus()
+	switch r.Method {
+	case http.MethodGet:
+		data := map[string]interface{}{
+			"reports":    status.Reports,
+			"policies":   status.Policies,
+			"total":      int64(0),
+			"violations": []csp.Violation{},
+			"recent":     []csp.Report{},
+		}
+		if reports != nil {
+			data["total"] = reports.Total()
+			data["violations"] = reports.Violations()
+			data["recent"] = reports.Recent()
+		}
+		writeAPIData(w, data)
+	case http.MethodDelete:
+		if reports != nil {
+			reports.Reset()
+		}
+		writeAPIData(w, map[string]interface{}{"cleared": true})
+	default:
+		writeAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+	}
+}
@@ -0,0 +1,189 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package admin
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/metric"
+	"github.com/casjay-forks/caspaste/src/storage"
+)
+
+// dashboardTopSyntaxes is how many syntaxes the dashboard lists
+const dashboardTopSyntaxes = 5
+
+// dashboardRefresh is how often the dashboard reloads its statistics
+const dashboardRefresh = 10 * time.Second
+
+// dashboardStats is what the dashboard shows; paste and user counts are
+// zero when paste management is not enabled
+type dashboardStats struct {
+	Status       string                `json:"status"`
+	Offline      bool                  `json:"offline"`
+	Pastes       int64                 `json:"pastes"`
+	PastesToday  int64                 `json:"pastes_today"`
+	ActiveUsers  int64                 `json:"active_users"`
+	StorageBytes int64                 `json:"storage_bytes"`
+	TopSyntaxes  []storage.SyntaxCount `json:"top_syntaxes"`
+	Requests     metric.RequestStats   `json:"requests"`
+}
+
+// dashboardStats counts the live pastes, today's pastes from midnight UTC,
+// users with a session and recent requests
+func (p *Panel) dashboardStats(ctx context.Context) (dashboardStats, error) {
+	stats := dashboardStats{
+		Status:      "running",
+		Offline:     p.networkStatus().Offline,
+		TopSyntaxes: []storage.SyntaxCount{},
+		Requests:    metric.Requests(),
+	}
+	db := p.pasteStore(ctx)
+	if db == nil {
+		return stats, nil
+	}
+
+	pastes, err := db.PasteStats()
+	if err != nil {
+		return stats, err
+	}
+	stats.Pastes = pastes.Total
+	stats.StorageBytes = pastes.Bytes
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	if stats.PastesToday, err = db.PasteCountSince(today); err != nil {
+		return stats, err
+	}
+	if stats.ActiveUsers, err = db.ActiveUserCount(); err != nil {
+		return stats, err
+	}
+	syntaxes, err := db.PasteTopSyntaxes(dashboardTopSyntaxes)
+	if err != nil {
+		return stats, err
+	}
+	if syntaxes != nil {
+		stats.TopSyntaxes = syntaxes
+	}
+	return stats, nil
+}
+
+// apiStatus reports the dashboard statistics
+func (p *Panel) apiStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+	stats, err := p.dashboardStats(r.Context())
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "SERVER_ERROR", "Failed to read statistics")
+		return
+	}
+	writeAPIData(w, stats)
+}
+
+func (p *Panel) dashboardContent(r *http.Request) string {
+	stats, err := p.dashboardStats(r.Context())
+
+	var out strings.Builder
+	if err != nil {
+		fmt.Fprintf(&out, `<div class="card notice-error">Failed to read statistics: %s</div>
+`, html.EscapeString(err.Error()))
+	}
+	fmt.Fprintf(&out, `<div class="stats-grid">
+    <div class="stat-card">
+        <div class="stat-value" id="stat-pastes">%d</div>
+        <div class="stat-label">Total Pastes</div>
+    </div>
+    <div class="stat-card">
+        <div class="stat-value" id="stat-pastes-today">%d</div>
+        <div class="stat-label">Pastes Today</div>
+    </div>
+    <div class="stat-card">
+        <div class="stat-value" id="stat-active-users">%d</div>
+        <div class="stat-label">Active Users</div>
+    </div>
+    <div class="stat-card">
+        <div class="stat-value" id="stat-storage">%s</div>
+        <div class="stat-label">Storage Used</div>
+    </div>
+    <div class="stat-card">
+        <div class="stat-value" id="stat-request-rate">%.1f</div>
+        <div class="stat-label">Requests / Minute</div>
+    </div>
+    <div class="stat-card">
+        <div class="stat-value" id="stat-requests-today">%d</div>
+        <div class="stat-label">Requests Today</div>
+    </div>
+</div>
+<div class="card mt-lg">
+    <div class="card-title">Top Syntaxes</div>
+    <table class="table">
+        <thead><tr><th>Syntax</th><th>Pastes</th></tr></thead>
+        <tbody id="top-syntaxes">`,
+		stats.Pastes, stats.PastesToday, stats.ActiveUsers, sizeString(stats.StorageBytes),
+		stats.Requests.PerMinute, stats.Requests.Today)
+	for _, s := range stats.TopSyntaxes {
+		fmt.Fprintf(&out, `
+            <tr><td>%s</td><td>%d</td></tr>`, html.EscapeString(s.Syntax), s.Count)
+	}
+	out.WriteString(`
+        </tbody>
+    </table>
+</div>
+<div class="card mt-lg">
+    <div class="card-title">System Status</div>
+    <p>Server is running normally.</p>`)
+	if stats.Offline {
+		fmt.Fprintf(&out, `
+    <p>Offline mode: features that reach the internet are off (<a href="/%s/server/network/outbound">details</a>).</p>`, p.basePath)
+	}
+	fmt.Fprintf(&out, `
+    <p>Statistics refresh every %d seconds. Requests are counted since the server started.</p>
+</div>
+<script>
+(function () {
+    function size(n) {
+        var units = ["GiB", "MiB", "KiB"];
+        for (var i = 0; i < units.length; i++) {
+            var unit = Math.pow(1024, units.length - i);
+            if (n >= unit) return (n / unit).toFixed(1) + " " + units[i];
+        }
+        return n + " B";
+    }
+    function set(id, value) {
+        document.getElementById(id).textContent = value;
+    }
+    function refresh() {
+        fetch("/%s/status", {credentials: "same-origin", headers: {"Accept": "application/json"}})
+            .then(function (res) { return res.json(); })
+            .then(function (body) {
+                if (!body.ok) return;
+                var d = body.data;
+                set("stat-pastes", d.pastes);
+                set("stat-pastes-today", d.pastes_today);
+                set("stat-active-users", d.active_users);
+                set("stat-storage", size(d.storage_bytes));
+                set("stat-request-rate", d.requests.per_minute.toFixed(1));
+                set("stat-requests-today", d.requests.today);
+                var rows = document.getElementById("top-syntaxes");
+                rows.textContent = "";
+                d.top_syntaxes.forEach(function (s) {
+                    var tr = rows.insertRow();
+                    tr.insertCell().textContent = s.syntax;
+                    tr.insertCell().textContent = s.count;
+                });
+            })
+            .catch(function () {});
+    }
+    setInterval(refresh, %d);
+})();
+</script>`, int(dashboardRefresh.Seconds()), p.apiPath, dashboardRefresh.Milliseconds())
+	return out.String()
+}
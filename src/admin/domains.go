@@ -0,0 +1,300 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/domain"
+)
+
+// SetDomainService enables custom domain management in the admin panel
+func (p *Panel) SetDomainService(svc *domain.Service) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.domains = svc
+}
+
+func (p *Panel) domainService() *domain.Service {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.domains
+}
+
+// domainFilterFromQuery builds a list filter from ?status=&ssl_status=&verification=&owner_type=&owner_id=&q=&page=
+func domainFilterFromQuery(q url.Values) domain.ListFilter {
+	f := domain.ListFilter{
+		Status:             q.Get("status"),
+		SSLStatus:          q.Get("ssl_status"),
+		VerificationStatus: q.Get("verification"),
+		OwnerType:          q.Get("owner_type"),
+		Search:             q.Get("q"),
+		Limit:              50,
+	}
+	f.OwnerID, _ = strconv.ParseInt(q.Get("owner_id"), 10, 64)
+	if page, err := strconv.Atoi(q.Get("page")); err == nil && page > 1 {
+		f.Offset = (page - 1) * f.Limit
+	}
+	return f
+}
+
+// UI handlers
+
+// handleServerDomains renders the domain list with filters
+func (p *Panel) handleServerDomains(w http.ResponseWriter, r *http.Request) {
+	svc := p.domainService()
+	if svc == nil {
+		p.renderPage(w, "Custom Domains", `<div class="card">
+    <div class="card-title">Custom Domains</div>
+    <p>Custom domains are not enabled.</p>
+</div>`)
+		return
+	}
+
+	q := r.URL.Query()
+	domains, total, err := svc.List(r.Context(), domainFilterFromQuery(q))
+	if err != nil {
+		p.renderPage(w, "Custom Domains", `<div class="card"><p>Failed to list domains.</p></div>`)
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString(`<div class="card">
+    <form method="get" class="filters">
+        <input type="text" name="q" placeholder="Search domains" value="` + html.EscapeString(q.Get("q")) + `">
+        ` + selectFilter("status", q.Get("status"), domain.StatusPending, domain.StatusActive, domain.StatusSuspended, domain.StatusError) + `
+        ` + selectFilter("ssl_status", q.Get("ssl_status"), domain.SSLStatusNone, domain.SSLStatusPending, domain.SSLStatusActive, domain.SSLStatusExpired, domain.SSLStatusError) + `
+        ` + selectFilter("owner_type", q.Get("owner_type"), domain.OwnerTypeUser, domain.OwnerTypeOrg) + `
+        <button type="submit" class="btn btn-secondary">Filter</button>
+    </form>
+</div>
+<div class="card">
+    <div class="card-title">`)
+	fmt.Fprintf(&b, "%d domains", total)
+	b.WriteString(`</div>
+    <table class="table">
+        <thead><tr><th>Domain</th><th>Owner</th><th>Status</th><th>Verification</th><th>SSL</th><th>Created</th></tr></thead>
+        <tbody>`)
+	for _, d := range domains {
+		fmt.Fprintf(&b, `
+            <tr><td><a href="/%s/server/domains/%s">%s</a></td><td>%s #%d</td><td>%s</td><td>%s (%s)</td><td>%s</td><td>%s</td></tr>`,
+			p.basePath, url.PathEscape(d.Domain), html.EscapeString(d.Domain),
+			d.OwnerType, d.OwnerID, d.Status, d.VerificationStatus, d.VerificationMethod, d.SSLStatus,
+			time.Unix(d.CreatedAt, 0).UTC().Format("2006-01-02"))
+	}
+	b.WriteString(`
+        </tbody>
+    </table>
+</div>`)
+
+	p.renderPage(w, "Custom Domains", b.String())
+}
+
+// handleServerDomainDetail renders one domain with its history and handles admin actions
+func (p *Panel) handleServerDomainDetail(w http.ResponseWriter, r *http.Request) {
+	svc := p.domainService()
+	if svc == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/server/domains/")
+	if name == "" {
+		p.handleServerDomains(w, r)
+		return
+	}
+	d, err := svc.GetByDomain(r.Context(), name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		if _, err := p.domainAction(r.Context(), svc, d, r.FormValue("action"), r.FormValue("reason")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Redirect(w, r, "/"+p.basePath+"/server/domains/"+url.PathEscape(d.Domain), http.StatusSeeOther)
+		return
+	}
+
+	audit, _ := svc.GetAudit(r.Context(), d.ID, 100)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<div class="card">
+    <div class="card-title">%s</div>
+    <p>Owner: %s #%d</p>
+    <p>Status: %s</p>
+    <p>Verification: %s via %s (%d checks)</p>
+    <p>SSL: %s</p>`,
+		html.EscapeString(d.Domain), d.OwnerType, d.OwnerID, d.Status,
+		d.VerificationStatus, d.VerificationMethod, d.CheckCount, d.SSLStatus)
+	if d.SuspendedReason != "" {
+		fmt.Fprintf(&b, `
+    <p>Suspended: %s</p>`, html.EscapeString(d.SuspendedReason))
+	}
+	b.WriteString(`
+</div>
+<div class="card">
+    <div class="card-title">Actions</div>
+    <form method="post"><input type="hidden" name="action" value="verify"><button class="btn btn-secondary">Force re-verify</button></form>`)
+	if d.Status == domain.StatusSuspended {
+		b.WriteString(`
+    <form method="post"><input type="hidden" name="action" value="unsuspend"><button class="btn btn-primary">Unsuspend</button></form>`)
+	} else {
+		b.WriteString(`
+    <form method="post"><input type="hidden" name="action" value="suspend"><input type="text" name="reason" placeholder="Reason" required><button class="btn btn-primary">Suspend</button></form>`)
+	}
+	b.WriteString(`
+</div>
+<div class="card">
+    <div class="card-title">History</div>
+    <table class="table">
+        <thead><tr><th>Time</th><th>Action</th><th>Actor</th><th>Details</th></tr></thead>
+        <tbody>`)
+	for _, e := range audit {
+		fmt.Fprintf(&b, `
+            <tr><td>%s</td><td>%s</td><td>%s #%d</td><td>%s</td></tr>`,
+			time.Unix(e.CreatedAt, 0).UTC().Format(time.RFC3339), html.EscapeString(e.Action),
+			html.EscapeString(e.ActorType), e.ActorID, html.EscapeString(e.Details))
+	}
+	b.WriteString(`
+        </tbody>
+    </table>
+</div>`)
+
+	p.renderPage(w, "Domain: "+html.EscapeString(d.Domain), b.String())
+}
+
+// domainAction runs an admin action on a domain
+func (p *Panel) domainAction(ctx context.Context, svc *domain.Service, d *domain.CustomDomain, action, reason string) (interface{}, error) {
+	switch action {
+	case "verify":
+		return svc.Verify(ctx, d.ID)
+	case "suspend":
+		if strings.TrimSpace(reason) == "" {
+			return nil, fmt.Errorf("a suspension reason is required")
+		}
+		return nil, svc.Suspend(ctx, d.ID, reason)
+	case "unsuspend":
+		return nil, svc.Unsuspend(ctx, d.ID)
+	}
+	return nil, fmt.Errorf("unknown action %q", action)
+}
+
+func selectFilter(name, current string, options ...string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<select name="%s"><option value="">%s: any</option>`, name, name)
+	for _, opt := range options {
+		selected := ""
+		if opt == current {
+			selected = " selected"
+		}
+		fmt.Fprintf(&b, `<option value="%s"%s>%s</option>`, opt, selected, opt)
+	}
+	b.WriteString(`</select>`)
+	return b.String()
+}
+
+// API handlers
+
+// apiServerDomains handles GET /server/domains with the same filters as the UI
+func (p *Panel) apiServerDomains(w http.ResponseWriter, r *http.Request) {
+	svc := p.domainService()
+	if svc == nil {
+		writeAPIError(w, http.StatusNotFound, "FEATURE_DISABLED", "Custom domains are not enabled")
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	f := domainFilterFromQuery(r.URL.Query())
+	domains, total, err := svc.List(r.Context(), f)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "SERVER_ERROR", "Failed to list domains")
+		return
+	}
+
+	writeAPIData(w, map[string]interface{}{
+		"domains": domains,
+		"total":   total,
+		"limit":   f.Limit,
+		"offset":  f.Offset,
+	})
+}
+
+// apiServerDomain handles
+//
+//	GET  /server/domains/{domain}            - domain with audit history
+//	POST /server/domains/{domain}/verify     - force re-verification
+//	POST /server/domains/{domain}/suspend    - suspend ({"reason": "..."})
+//	POST /server/domains/{domain}/unsuspend  - unsuspend
+func (p *Panel) apiServerDomain(w http.ResponseWriter, r *http.Request) {
+	svc := p.domainService()
+	if svc == nil {
+		writeAPIError(w, http.StatusNotFound, "FEATURE_DISABLED", "Custom domains are not enabled")
+		return
+	}
+
+	rest := strings.TrimPrefix(r.URL.Path, "/server/domains/")
+	name, action, _ := strings.Cut(rest, "/")
+
+	d, err := svc.GetByDomain(r.Context(), name)
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, "DOMAIN_NOT_FOUND", "Domain not found")
+		return
+	}
+
+	if action == "" {
+		if r.Method != http.MethodGet {
+			writeAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+			return
+		}
+		audit, err := svc.GetAudit(r.Context(), d.ID, 100)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, "SERVER_ERROR", "Failed to load history")
+			return
+		}
+		writeAPIData(w, map[string]interface{}{
+			"domain":  d,
+			"history": audit,
+		})
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		writeAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+
+	result, err := p.domainAction(r.Context(), svc, d, action, req.Reason)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "ACTION_FAILED", err.Error())
+		return
+	}
+
+	d, _ = svc.GetByID(r.Context(), d.ID)
+	writeAPIData(w, map[string]interface{}{
+		"domain": d,
+		"result": result,
+	})
+}
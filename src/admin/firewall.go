@@ -0,0 +1,245 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/audit"
+	"github.com/casjay-forks/caspaste/src/cli"
+	"github.com/casjay-forks/caspaste/src/firewall"
+	"github.com/casjay-forks/caspaste/src/netshare"
+	"github.com/casjay-forks/caspaste/src/storage"
+)
+
+// SetFirewall enables managing the firewall bans in the admin panel
+func (p *Panel) SetFirewall(fw *firewall.Firewall) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.firewall = fw
+}
+
+func (p *Panel) firewallService() *firewall.Firewall {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.firewall
+}
+
+// writeFirewallError maps firewall errors to admin API errors
+func writeFirewallError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, firewall.ErrInvalidBan):
+		writeAPIError(w, http.StatusBadRequest, "INVALID_BAN", err.Error())
+	case errors.Is(err, storage.ErrIPBanNotFound):
+		writeAPIError(w, http.StatusNotFound, "NOT_FOUND", "Ban not found")
+	default:
+		writeAPIError(w, http.StatusInternalServerError, "SERVER_ERROR", "Failed to save the ban")
+	}
+}
+
+// parseBanDuration reads how long a ban lasts ("" = no end)
+func parseBanDuration(duration string) (time.Duration, error) {
+	if duration = strings.TrimSpace(duration); duration == "" {
+		return 0, nil
+	}
+	d, err := cli.ParseDuration(duration)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%w: invalid duration %q", firewall.ErrInvalidBan, duration)
+	}
+	return d, nil
+}
+
+// addBan bans a network for the admin at r; a ban covering the admin's own
+// address is refused, as it would lock them out of the admin panel too
+func addBan(fw *firewall.Firewall, r *http.Request, network, duration, reason string) (storage.IPBan, error) {
+	adminIP := netshare.GetClientAddr(r)
+	d, err := parseBanDuration(duration)
+	if err == nil {
+		var n *net.IPNet
+		if n, err = firewall.ParseNetwork(network); err == nil && n.Contains(adminIP) {
+			err = fmt.Errorf("%w: %s includes your own address", firewall.ErrInvalidBan, strings.TrimSpace(network))
+		}
+	}
+	var ban storage.IPBan
+	if err == nil {
+		ban, err = fw.Add(network, reason, firewall.SourceAdmin, "admin "+adminIP.String(), d)
+	}
+	audit.IPBan(audit.EventIPBanned, strings.TrimSpace(network), reason, ban.ExpiresAt, adminIP.String(), err)
+	return ban, err
+}
+
+// updateBan changes the reason and length of a ban
+func updateBan(fw *firewall.Firewall, r *http.Request, id, duration, reason string) (storage.IPBan, error) {
+	d, err := parseBanDuration(duration)
+	var ban storage.IPBan
+	if err == nil {
+		ban, err = fw.Update(id, reason, d)
+	}
+	audit.IPBan(audit.EventIPBanUpdated, ban.Network, reason, ban.ExpiresAt, netshare.GetClientAddr(r).String(), err)
+	return ban, err
+}
+
+// removeBan lifts a ban
+func removeBan(fw *firewall.Firewall, r *http.Request, id string) error {
+	ban, err := fw.Get(id)
+	if err == nil {
+		err = fw.Remove(id)
+	}
+	audit.IPBan(audit.EventIPUnbanned, ban.Network, ban.Reason, ban.ExpiresAt, netshare.GetClientAddr(r).String(), err)
+	return err
+}
+
+// UI handlers
+
+// handleServerSecurityFirewall lists the bans, and adds, extends and lifts them
+func (p *Panel) handleServerSecurityFirewall(w http.ResponseWriter, r *http.Request) {
+	fw := p.firewallService()
+	if fw == nil {
+		p.renderPage(w, "Firewall Rules", `<div class="card">
+    <div class="card-title">Firewall Rules</div>
+    <p>The firewall is not enabled.</p>
+</div>`)
+		return
+	}
+
+	var errMsg string
+	if r.Method == http.MethodPost {
+		var err error
+		switch r.FormValue("action") {
+		case "remove":
+			err = removeBan(fw, r, r.FormValue("id"))
+		case "update":
+			_, err = updateBan(fw, r, r.FormValue("id"), r.FormValue("duration"), r.FormValue("reason"))
+		default:
+			_, err = addBan(fw, r, r.FormValue("network"), r.FormValue("duration"), r.FormValue("reason"))
+		}
+		if err == nil {
+			http.Redirect(w, r, "/"+p.basePath+"/server/security/firewall", http.StatusSeeOther)
+			return
+		}
+		errMsg = err.Error()
+	}
+
+	bans, err := fw.List()
+	if err != nil && errMsg == "" {
+		errMsg = err.Error()
+	}
+
+	csrf := p.csrfInput(r)
+
+	var out strings.Builder
+	if errMsg != "" {
+		fmt.Fprintf(&out, `<div class="card notice-error">%s</div>
+`, html.EscapeString(errMsg))
+	}
+	out.WriteString(`<div class="card">
+    <div class="card-title">Firewall Rules</div>
+    <p>Banned addresses and networks get 403 on every request, the admin panel included. Automatic bans are added for addresses that keep hitting the rate limits.</p>
+    <table class="table">
+        <thead><tr><th>IP or network</th><th>Source</th><th>Reason</th><th>Added (UTC)</th><th>Until (UTC)</th><th></th></tr></thead>
+        <tbody>`)
+	for _, ban := range bans {
+		until := "no end"
+		if ban.ExpiresAt != 0 {
+			until = time.Unix(ban.ExpiresAt, 0).UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(&out, `
+            <tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td>
+                <td><form method="post">%s<input type="hidden" name="action" value="update"><input type="hidden" name="id" value="%s"><input type="hidden" name="reason" value="%s"><input type="text" name="duration" placeholder="New length, e.g. 7d; empty = no end"><button class="btn btn-secondary">Set</button></form>
+                    <form method="post">%s<input type="hidden" name="action" value="remove"><input type="hidden" name="id" value="%s"><button class="btn btn-secondary">Lift</button></form></td></tr>`,
+			html.EscapeString(ban.Network), ban.Source, html.EscapeString(ban.Reason),
+			time.Unix(ban.CreatedAt, 0).UTC().Format(time.RFC3339), until,
+			csrf, ban.ID, html.EscapeString(ban.Reason), csrf, ban.ID)
+	}
+	fmt.Fprintf(&out, `
+        </tbody>
+    </table>
+    <form method="post" class="stacked">%s
+        <label><span>IP or network</span><input type="text" name="network" placeholder="203.0.113.7 or 10.0.0.0/8" required></label>
+        <label><span>Duration (e.g. 30m, 12h, 7d; empty = no end)</span><input type="text" name="duration" value="1d"></label>
+        <label><span>Reason</span><input type="text" name="reason"></label>
+        <div><button type="submit" class="btn btn-primary">Ban</button></div>
+    </form>
+</div>`, csrf)
+
+	p.renderPage(w, "Firewall Rules", out.String())
+}
+
+// API handlers
+
+// apiServerSecurityFirewall handles
+//
+//	GET    /server/security/firewall       - bans in force
+//	POST   /server/security/firewall       - ban {"network", "duration", "reason"}
+//	GET    /server/security/firewall/{id}  - one ban
+//	PUT    /server/security/firewall/{id}  - change {"duration", "reason"}
+//	DELETE /server/security/firewall/{id}  - lift a ban
+func (p *Panel) apiServerSecurityFirewall(w http.ResponseWriter, r *http.Request) {
+	fw := p.firewallService()
+	if fw == nil {
+		writeAPIError(w, http.StatusNotFound, "FEATURE_DISABLED", "The firewall is not enabled")
+		return
+	}
+
+	var req struct {
+		Network  string `json:"network"`
+		Duration string `json:"duration"`
+		Reason   string `json:"reason"`
+	}
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/server/security/firewall"), "/")
+	if r.Method == http.MethodPost || r.Method == http.MethodPut {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid JSON body")
+			return
+		}
+	}
+
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		bans, err := fw.List()
+		if err != nil {
+			writeFirewallError(w, err)
+			return
+		}
+		writeAPIData(w, map[string]interface{}{"bans": bans})
+	case id == "" && r.Method == http.MethodPost:
+		ban, err := addBan(fw, r, req.Network, req.Duration, req.Reason)
+		if err != nil {
+			writeFirewallError(w, err)
+			return
+		}
+		writeAPIData(w, ban)
+	case id != "" && r.Method == http.MethodGet:
+		ban, err := fw.Get(id)
+		if err != nil {
+			writeFirewallError(w, err)
+			return
+		}
+		writeAPIData(w, ban)
+	case id != "" && r.Method == http.MethodPut:
+		ban, err := updateBan(fw, r, id, req.Duration, req.Reason)
+		if err != nil {
+			writeFirewallError(w, err)
+			return
+		}
+		writeAPIData(w, ban)
+	case id != "" && r.Method == http.MethodDelete:
+		if err := removeBan(fw, r, id); err != nil {
+			writeFirewallError(w, err)
+			return
+		}
+		writeAPIData(w, map[string]interface{}{"id": id, "deleted": true})
+	default:
+		writeAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+	}
+}
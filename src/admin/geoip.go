@@ -0,0 +1,239 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/geoip"
+	"github.com/casjay-forks/caspaste/src/outbound"
+)
+
+// SetGeoIP enables the GeoIP page of the admin panel
+func (p *Panel) SetGeoIP(client *geoip.Client) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.geoIP = client
+}
+
+func (p *Panel) geoIPClient() *geoip.Client {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.geoIP
+}
+
+// updateGeoIP downloads the databases and opens them
+func updateGeoIP(client *geoip.Client) error {
+	if err := client.UpdateDatabases(); err != nil {
+		return err
+	}
+	return client.Load()
+}
+
+// UI handlers
+
+// handleServerNetworkGeoIP shows the databases, the policies and the
+// requests per country, and looks up addresses
+func (p *Panel) handleServerNetworkGeoIP(w http.ResponseWriter, r *http.Request) {
+	client := p.geoIPClient()
+	if client == nil {
+		p.renderPage(w, "GeoIP Settings", `<div class="card">
+    <div class="card-title">GeoIP Settings</div>
+    <p>GeoIP is not enabled (<code>server.geoip.enabled</code>).</p>
+</div>`)
+		return
+	}
+
+	var notice, noticeClass string
+	if r.Method == http.MethodPost && r.FormValue("action") == "update" {
+		if err := updateGeoIP(client); err != nil {
+			notice, noticeClass = "Update failed: "+err.Error(), "notice-error"
+		} else {
+			notice, noticeClass = "Databases updated", "notice-success"
+		}
+	}
+
+	var out strings.Builder
+	if notice != "" {
+		fmt.Fprintf(&out, `<div class="card %s">%s</div>
+`, noticeClass, html.EscapeString(notice))
+	}
+
+	loaded, lastUpdate := "No", "Never"
+	if client.Loaded() {
+		loaded = "Yes"
+	}
+	if t := client.GetLastUpdate(); !t.IsZero() {
+		lastUpdate = t.UTC().Format(time.RFC3339)
+	}
+	updateButton := fmt.Sprintf(`<form method="post">%s<input type="hidden" name="action" value="update"><button class="btn btn-secondary">Update now</button></form>`, p.csrfInput(r))
+	if outbound.Offline() {
+		updateButton = `<p>Downloads are off in offline mode; place the databases in the directory yourself.</p>`
+	}
+	fmt.Fprintf(&out, `<div class="card">
+    <div class="card-title">GeoIP Settings</div>
+    <table class="table">
+        <tbody>
+            <tr><th>Source</th><td>%s</td></tr>
+            <tr><th>Databases loaded</th><td>%s</td></tr>
+            <tr><th>Last update (UTC)</th><td>%s</td></tr>
+        </tbody>
+    </table>
+    %s
+</div>
+`, html.EscapeString(client.Source()), loaded, lastUpdate, updateButton)
+
+	out.WriteString(`<div class="card">
+    <div class="card-title">Restrictions</div>
+    <p>Set in <code>server.geoip.viewing</code> and <code>server.geoip.creation</code>. The viewing policy applies to every request but the admin panel; the creation policy to paste creation as well.</p>
+    <table class="table">
+        <thead><tr><th>Policy</th><th>Denied countries</th><th>Allowed countries</th><th>Denied networks</th><th>Exempt users</th><th>Status</th></tr></thead>
+        <tbody>`)
+	for _, row := range []struct {
+		name   string
+		policy geoip.Policy
+	}{{"Viewing", client.ViewingPolicy()}, {"Creation", client.CreationPolicy()}} {
+		asns := make([]string, len(row.policy.DenyASNs))
+		for i, asn := range row.policy.DenyASNs {
+			asns[i] = fmt.Sprintf("AS%d", asn)
+		}
+		fmt.Fprintf(&out, `
+            <tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%d</td></tr>`,
+			row.name, listOrDash(row.policy.DenyCountries), listOrDash(row.policy.AllowCountries),
+			listOrDash(asns), listOrDash(row.policy.ExemptUsers), row.policy.Status)
+	}
+	out.WriteString(`
+        </tbody>
+    </table>
+</div>
+`)
+
+	ip := strings.TrimSpace(r.URL.Query().Get("ip"))
+	fmt.Fprintf(&out, `<div class="card">
+    <div class="card-title">Look Up an Address</div>
+    <form method="get" class="stacked">
+        <label><span>IP address</span><input type="text" name="ip" value="%s" placeholder="203.0.113.7"></label>
+        <div><button type="submit" class="btn btn-primary">Look up</button></div>
+    </form>`, html.EscapeString(ip))
+	if ip != "" {
+		if result, err := client.Lookup(ip); err != nil {
+			fmt.Fprintf(&out, `
+    <p>%s</p>`, html.EscapeString(err.Error()))
+		} else {
+			network := "-"
+			if result.ASN != 0 {
+				network = fmt.Sprintf("AS%d %s", result.ASN, result.ASNOrg)
+			}
+			fmt.Fprintf(&out, `
+    <table class="table">
+        <tbody>
+            <tr><th>Country</th><td>%s %s</td></tr>
+            <tr><th>Network</th><td>%s</td></tr>
+        </tbody>
+    </table>`, html.EscapeString(result.CountryCode), html.EscapeString(result.Country), html.EscapeString(network))
+		}
+	}
+	out.WriteString(`
+</div>
+`)
+
+	out.WriteString(`<div class="card">
+    <div class="card-title">Requests by Country</div>
+    <p>Since the server started.</p>
+    <table class="table">
+        <thead><tr><th>Country</th><th>Views</th><th>Pastes created</th><th>Refused</th></tr></thead>
+        <tbody>`)
+	for _, s := range client.Stats() {
+		fmt.Fprintf(&out, `
+            <tr><td>%s</td><td>%d</td><td>%d</td><td>%d</td></tr>`,
+			html.EscapeString(s.CountryCode), s.Views, s.Creations, s.Refused)
+	}
+	out.WriteString(`
+        </tbody>
+    </table>
+</div>`)
+
+	p.renderPage(w, "GeoIP Settings", out.String())
+}
+
+// listOrDash joins a list for a table cell
+func listOrDash(items []string) string {
+	if len(items) == 0 {
+		return "-"
+	}
+	return html.EscapeString(strings.Join(items, ", "))
+}
+
+// API handlers
+
+// apiServerNetworkGeoIP handles
+//
+//	GET /server/network/geoip         - databases, policies and requests per country
+//	GET /server/network/geoip?ip={ip} - look up an address
+func (p *Panel) apiServerNetworkGeoIP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+	client := p.geoIPClient()
+	if client == nil {
+		writeAPIData(w, map[string]interface{}{"enabled": false})
+		return
+	}
+
+	if ip := strings.TrimSpace(r.URL.Query().Get("ip")); ip != "" {
+		result, err := client.Lookup(ip)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, "INVALID_IP", err.Error())
+			return
+		}
+		writeAPIData(w, result)
+		return
+	}
+
+	var lastUpdate *time.Time
+	if t := client.GetLastUpdate(); !t.IsZero() {
+		lastUpdate = &t
+	}
+	writeAPIData(w, map[string]interface{}{
+		"enabled":     true,
+		"source":      client.Source(),
+		"loaded":      client.Loaded(),
+		"last_update": lastUpdate,
+		"viewing":     client.ViewingPolicy(),
+		"creation":    client.CreationPolicy(),
+		"countries":   client.Stats(),
+	})
+}
+
+// apiServerNetworkGeoIPUpdate handles
+//
+//	POST /server/network/geoip/update - download the databases now
+func (p *Panel) apiServerNetworkGeoIPUpdate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+	client := p.geoIPClient()
+	if client == nil {
+		writeAPIError(w, http.StatusNotFound, "FEATURE_DISABLED", "GeoIP is not enabled")
+		return
+	}
+	if err := updateGeoIP(client); err != nil {
+		if errors.Is(err, outbound.ErrOffline) {
+			writeAPIError(w, http.StatusConflict, "OFFLINE", err.Error())
+			return
+		}
+		writeAPIError(w, http.StatusBadGateway, "UPDATE_FAILED", err.Error())
+		return
+	}
+	writeAPIData(w, map[string]interface{}{"updated": true, "last_update": client.GetLastUpdate()})
+}
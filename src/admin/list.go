@@ -0,0 +1,183 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package admin
+
+import (
+	"fmt"
+	"html"
+	"maps"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// listPageSize is how many rows a page of an admin list has by default
+const listPageSize = 50
+
+// listMaxPageSize bounds ?per_page=
+const listMaxPageSize = 100
+
+// listParams are the filters, sorting and paging shared by the admin lists
+// of users, pastes and audit logs:
+//
+//	?q=          search
+//	?status=     status, per list
+//	?role=       user role
+//	?from=, ?to= dates (YYYY-MM-DD or RFC 3339); to is inclusive for dates
+//	?sort=       sort key, per list
+//	?order=      asc or desc (default)
+//	?page=, ?per_page=
+type listParams struct {
+	Search  string
+	Status  string
+	Role    string
+	From    time.Time
+	To      time.Time
+	Sort    string
+	Desc    bool
+	Page    int
+	PerPage int
+}
+
+// parseListParams reads the list parameters from a query string
+func parseListParams(q url.Values) (listParams, error) {
+	l := listParams{
+		Search:  strings.TrimSpace(q.Get("q")),
+		Status:  q.Get("status"),
+		Role:    q.Get("role"),
+		Sort:    q.Get("sort"),
+		Desc:    q.Get("order") != "asc",
+		Page:    1,
+		PerPage: listPageSize,
+	}
+	if page, err := strconv.Atoi(q.Get("page")); err == nil && page > 1 {
+		l.Page = page
+	}
+	if n, err := strconv.Atoi(q.Get("per_page")); err == nil && n > 0 {
+		l.PerPage = min(n, listMaxPageSize)
+	}
+
+	var err error
+	if l.From, err = parseListDate(q.Get("from"), false); err != nil {
+		return l, err
+	}
+	if l.To, err = parseListDate(q.Get("to"), true); err != nil {
+		return l, err
+	}
+	return l, nil
+}
+
+// parseListDate reads a date or time; the end of a range given as a date
+// is the start of the next day, so the day is included
+func parseListDate(value string, end bool) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q: use YYYY-MM-DD or RFC 3339", value)
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// offset is how many rows come before the page
+func (l listParams) offset() int {
+	return (l.Page - 1) * l.PerPage
+}
+
+// pages is how many pages total rows fill, at least one
+func (l listParams) pages(total int) int {
+	return max(1, (total+l.PerPage-1)/l.PerPage)
+}
+
+// data is the API response for a page of a list, with the rows under key
+func (l listParams) data(key string, rows interface{}, total int) map[string]interface{} {
+	return map[string]interface{}{
+		key:        rows,
+		"total":    total,
+		"page":     l.Page,
+		"per_page": l.PerPage,
+		"pages":    l.pages(total),
+		"limit":    l.PerPage,
+		"offset":   l.offset(),
+	}
+}
+
+// dateInputs are the from and to fields of a filter form
+func dateInputs(q url.Values) string {
+	return fmt.Sprintf(`<input type="date" name="from" value="%s" title="Created from">
+        <input type="date" name="to" value="%s" title="Created until">`,
+		html.EscapeString(q.Get("from")), html.EscapeString(q.Get("to")))
+}
+
+// sortInputs keep the sort order when a filter form is submitted
+func sortInputs(q url.Values) string {
+	return fmt.Sprintf(`<input type="hidden" name="sort" value="%s"><input type="hidden" name="order" value="%s">`,
+		html.EscapeString(q.Get("sort")), html.EscapeString(q.Get("order")))
+}
+
+// statusSelect is a select of name with options as value/label pairs, the
+// first being "all"
+func statusSelect(name, current string, options ...string) string {
+	var out strings.Builder
+	fmt.Fprintf(&out, `<select name="%s">`, name)
+	for i := 0; i+1 < len(options); i += 2 {
+		selected := ""
+		if options[i] == current {
+			selected = " selected"
+		}
+		fmt.Fprintf(&out, `<option value="%s"%s>%s</option>`, options[i], selected, options[i+1])
+	}
+	out.WriteString(`</select>`)
+	return out.String()
+}
+
+// sortHeader is a table header that sorts the list by key, reversing the
+// order when the list is already sorted by it
+func (l listParams) sortHeader(q url.Values, key, label string) string {
+	q = maps.Clone(q)
+	q.Del("page")
+	q.Set("sort", key)
+	mark := ""
+	order := "desc"
+	if l.Sort == key {
+		mark = " ▼"
+		if l.Desc {
+			order = "asc"
+		} else {
+			mark = " ▲"
+		}
+	}
+	q.Set("order", order)
+	return fmt.Sprintf(`<th><a href="?%s">%s</a>%s</th>`, html.EscapeString(q.Encode()), label, mark)
+}
+
+// pager shows where the page is in the list, with links to the others
+func (l listParams) pager(q url.Values, total int) string {
+	q = maps.Clone(q)
+	pages := l.pages(total)
+	link := func(page int, label string) string {
+		q.Set("page", strconv.Itoa(page))
+		return fmt.Sprintf(`<a href="?%s">%s</a>`, html.EscapeString(q.Encode()), label)
+	}
+
+	parts := []string{fmt.Sprintf("Page %d of %d, %d total", l.Page, pages, total)}
+	if l.Page > 1 {
+		parts = append(parts, link(1, "First"), link(l.Page-1, "Previous"))
+	}
+	if l.Page < pages {
+		parts = append(parts, link(l.Page+1, "Next"), link(pages, "Last"))
+	}
+	return `<p>` + strings.Join(parts, " | ") + `</p>`
+}
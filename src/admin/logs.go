@@ -0,0 +1,539 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/audit"
+)
+
+// auditQueryFromQuery reads ?event= besides the list parameters; ?status=
+// is the result, success or failure, and entries are always in time order
+func auditQueryFromQuery(q url.Values) (audit.Query, listParams, error) {
+	l, err := parseListParams(q)
+	return audit.Query{
+		Search:    l.Search,
+		Event:     strings.TrimSpace(q.Get("event")),
+		Result:    l.Status,
+		From:      l.From,
+		To:        l.To,
+		Ascending: !l.Desc,
+		Limit:     l.PerPage,
+		Offset:    l.offset(),
+	}, l, err
+}
+
+// apiServerLogsAudit lists the audit log, newest first
+//
+//	GET /server/logs/audit   ?q=, ?event=, ?status=, ?from=, ?to=, ?order=, ?page=, ?per_page=
+func (p *Panel) apiServerLogsAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+	aq, l, err := auditQueryFromQuery(r.URL.Query())
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+	entries, total, err := audit.GetLogger().Search(aq)
+	if err == audit.ErrNotSearchable {
+		writeAPIError(w, http.StatusNotFound, "FEATURE_DISABLED", err.Error())
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "SERVER_ERROR", "Failed to read the audit log")
+		return
+	}
+	writeAPIData(w, l.data("entries", entries, total))
+}
+
+// handleServerLogsAudit lists the audit log, with search and filters
+func (p *Panel) handleServerLogsAudit(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	aq, l, err := auditQueryFromQuery(query)
+	var entries []audit.Entry
+	var total int
+	if err == nil {
+		entries, total, err = audit.GetLogger().Search(aq)
+	}
+
+	var out strings.Builder
+	if err != nil {
+		fmt.Fprintf(&out, `<div class="card notice-error">%s</div>
+`, html.EscapeString(err.Error()))
+	}
+	fmt.Fprintf(&out, `<div class="card">
+    <div class="card-title">Audit Logs</div>
+    <form method="get">
+        <input type="text" name="q" value="%s" placeholder="Search">
+        %s
+        %s
+        %s
+        %s
+        <button type="submit" class="btn btn-secondary">Search</button>
+    </form>
+    %s
+    <table class="table">
+        <thead><tr>%s<th>Event</th><th>Result</th><th>Actor</th><th>Target</th><th>IP</th><th>Details</th></tr></thead>
+        <tbody>`, html.EscapeString(l.Search),
+		statusSelect("event", aq.Event,
+			"", "All events",
+			"admin.", "Admin",
+			"user.", "User",
+			"security.", "Security",
+			"server.", "Server",
+			"backup.", "Backup",
+			"config.", "Config",
+			"paste.", "Paste"),
+		statusSelect("status", l.Status,
+			"", "All results",
+			"success", "Success",
+			"failure", "Failure"),
+		dateInputs(query), sortInputs(query), l.pager(query, total),
+		l.sortHeader(query, "", "Time (UTC)"))
+	for _, e := range entries {
+		var actor, target, ip string
+		if e.Actor != nil {
+			actor = strings.TrimSpace(e.Actor.Type + " " + e.Actor.ID)
+		}
+		if e.Target != nil {
+			target = strings.TrimSpace(e.Target.Type + " " + e.Target.ID)
+		}
+		if e.Client != nil {
+			ip = e.Client.IP
+		}
+		var details []string
+		for _, k := range slices.Sorted(maps.Keys(e.Details)) {
+			details = append(details, fmt.Sprintf("%s=%v", k, e.Details[k]))
+		}
+		fmt.Fprintf(&out, `
+            <tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>`,
+			html.EscapeString(e.Time), html.EscapeString(e.Event), html.EscapeString(e.Result),
+			html.EscapeString(actor), html.EscapeString(target), html.EscapeString(ip),
+			html.EscapeString(strings.Join(details, ", ")))
+	}
+	fmt.Fprintf(&out, `
+        </tbody>
+    </table>
+    %s
+</div>`, l.pager(query, total))
+
+	p.renderPage(w, "Audit Logs", out.String())
+}
+
+// logTailMax bounds how much of the end of a log is read for its recent lines
+const logTailMax = 1 << 20
+
+// logLinesMax bounds ?lines=
+const logLinesMax = 1000
+
+// logPollInterval is how often a followed log is checked for new lines
+const logPollInterval = time.Second
+
+// logHeartbeat is how often an idle stream sends a comment, so proxies
+// keep the connection open
+const logHeartbeat = 15 * time.Second
+
+// logLevels orders the levels of ?level=, which is the least severe shown
+var logLevels = map[string]int{"debug": 1, "info": 2, "warn": 3, "error": 4}
+
+var (
+	// [INFO] in text lines, "level":"INFO" in JSON lines
+	logLevelRegex = regexp.MustCompile(`\[(DEBUG|INFO|WARN|ERROR)\]|"level":"(DEBUG|INFO|WARN|ERROR)"`)
+	// The status of an access log line, in any of its formats
+	logStatusRegex = regexp.MustCompile(`" ([1-5][0-9]{2}) |"status":([1-5][0-9]{2})| [A-Z]+ \S+ ([1-5][0-9]{2}) `)
+)
+
+// SetLogFiles lets the admin panel show the server logs, given by name
+// (access, error, server, debug) as file names in dir
+func (p *Panel) SetLogFiles(dir string, files map[string]string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.logDir = dir
+	p.logFiles = files
+}
+
+// logPath returns the file of the named log, or "" if it is not kept
+func (p *Panel) logPath(name string) string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.logFiles[name] == "" {
+		return ""
+	}
+	return filepath.Join(p.logDir, p.logFiles[name])
+}
+
+// logNames returns the names of the logs kept in files, sorted
+func (p *Panel) logNames() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return slices.Sorted(maps.Keys(p.logFiles))
+}
+
+// CloseStreams ends the log streams, which would otherwise hold a graceful
+// shutdown open until it times out
+func (p *Panel) CloseStreams() {
+	p.closeOnce.Do(func() { close(p.streams) })
+}
+
+// logFilter selects log lines by level and text
+type logFilter struct {
+	// Least severe level shown; lines without a level are left out when set
+	Level  string
+	Search string
+}
+
+// logFilterFromQuery reads ?level= and ?q=
+func logFilterFromQuery(q url.Values) (logFilter, error) {
+	f := logFilter{
+		Level:  strings.ToLower(strings.TrimSpace(q.Get("level"))),
+		Search: strings.ToLower(strings.TrimSpace(q.Get("q"))),
+	}
+	if f.Level != "" && logLevels[f.Level] == 0 {
+		return f, fmt.Errorf("invalid level %q: use debug, info, warn or error", f.Level)
+	}
+	return f, nil
+}
+
+// match reports whether line is selected by the filter
+func (f logFilter) match(line string) bool {
+	if f.Level != "" && logLevels[logLineLevel(line)] < logLevels[f.Level] {
+		return false
+	}
+	return f.Search == "" || strings.Contains(strings.ToLower(line), f.Search)
+}
+
+// logLineLevel is the level of a log line; access log lines have none, so
+// their status stands in: 5xx is an error and 4xx a warning
+func logLineLevel(line string) string {
+	if m := logLevelRegex.FindStringSubmatch(line); m != nil {
+		return strings.ToLower(m[1] + m[2])
+	}
+	m := logStatusRegex.FindStringSubmatch(line)
+	if m == nil {
+		return ""
+	}
+	switch (m[1] + m[2] + m[3])[0] {
+	case '5':
+		return "error"
+	case '4':
+		return "warn"
+	}
+	return "info"
+}
+
+// logLinesFromQuery reads ?lines=, how many recent lines are shown
+func logLinesFromQuery(q url.Values, def int) int {
+	n, err := strconv.Atoi(q.Get("lines"))
+	if err != nil || n < 0 {
+		return def
+	}
+	return min(n, logLinesMax)
+}
+
+// readLogTail returns the last n lines of the file matching f, and the size
+// of the file read; a log that does not exist yet is empty
+func readLogTail(path string, n int, f logFilter) ([]string, int64, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return []string{}, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	size := info.Size()
+	start := max(0, size-logTailMax)
+	buf := make([]byte, size-start)
+	if _, err := file.ReadAt(buf, start); err != nil && err != io.EOF {
+		return nil, 0, err
+	}
+
+	lines := strings.Split(strings.TrimRight(string(buf), "\n"), "\n")
+	// The first line is cut unless the read started at the beginning
+	if start > 0 && len(lines) > 0 {
+		lines = lines[1:]
+	}
+	matched := []string{}
+	for i := len(lines) - 1; i >= 0 && len(matched) < n; i-- {
+		line := strings.TrimRight(lines[i], "\r")
+		if line != "" && f.match(line) {
+			matched = append(matched, line)
+		}
+	}
+	slices.Reverse(matched)
+	return matched, size, nil
+}
+
+// apiServerLogs lists the server logs, shows the recent lines of one,
+// or follows one as server-sent events
+//
+//	GET /server/logs                        list the logs
+//	GET /server/logs/{name}                 recent lines (?lines=100, ?level=, ?q=)
+//	GET /server/logs/{name}/stream          recent lines, then new lines as they are written
+func (p *Panel) apiServerLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+	names := p.logNames()
+	if len(names) == 0 {
+		writeAPIError(w, http.StatusNotFound, "FEATURE_DISABLED", "Logs are not kept in files")
+		return
+	}
+
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/server/logs"), "/")
+	if rest == "" {
+		logs := []map[string]interface{}{}
+		for _, name := range names {
+			path := p.logPath(name)
+			entry := map[string]interface{}{"name": name, "file": path, "size": 0, "modified": ""}
+			if info, err := os.Stat(path); err == nil {
+				entry["size"] = info.Size()
+				entry["modified"] = info.ModTime().UTC().Format(time.RFC3339)
+			}
+			logs = append(logs, entry)
+		}
+		writeAPIData(w, map[string]interface{}{"logs": logs})
+		return
+	}
+
+	name, action, _ := strings.Cut(rest, "/")
+	path := p.logPath(name)
+	if path == "" || (action != "" && action != "stream") {
+		writeAPIError(w, http.StatusNotFound, "NOT_FOUND", "Unknown log")
+		return
+	}
+	f, err := logFilterFromQuery(r.URL.Query())
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+	lines := logLinesFromQuery(r.URL.Query(), 100)
+
+	if action == "stream" {
+		p.streamLog(w, r, path, lines, f)
+		return
+	}
+	tail, _, err := readLogTail(path, lines, f)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "SERVER_ERROR", "Failed to read the log")
+		return
+	}
+	writeAPIData(w, map[string]interface{}{"name": name, "lines": tail})
+}
+
+// streamLog sends the last lines of a log, then each new matching line, as
+// server-sent events until the client goes away; a log that is truncated
+// or rotated is followed from its start
+func (p *Panel) streamLog(w http.ResponseWriter, r *http.Request, path string, lines int, f logFilter) {
+	tail, offset, err := readLogTail(path, lines, f)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "SERVER_ERROR", "Failed to read the log")
+		return
+	}
+
+	// The stream outlives the server's write timeout, so each write extends it
+	rc := http.NewResponseController(w)
+	send := func(lines ...string) error {
+		rc.SetWriteDeadline(time.Now().Add(logHeartbeat * 2))
+		for _, line := range lines {
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", line); err != nil {
+				return err
+			}
+		}
+		if len(lines) == 0 {
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+				return err
+			}
+		}
+		return rc.Flush()
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	if err := send(tail...); err != nil {
+		return
+	}
+
+	var current os.FileInfo
+	if info, err := os.Stat(path); err == nil {
+		current = info
+	}
+	partial := ""
+	idle := time.Now()
+	ticker := time.NewTicker(logPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-p.streams:
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(path)
+		if err == nil {
+			if current == nil || !os.SameFile(current, info) || info.Size() < offset {
+				offset, partial = 0, ""
+			}
+			current = info
+		}
+		var matched []string
+		if err == nil && info.Size() > offset {
+			var chunk string
+			chunk, offset = readLogFrom(path, offset, info.Size())
+			chunk = partial + chunk
+			// A line is sent once it is complete
+			end := strings.LastIndexByte(chunk, '\n')
+			partial = chunk[end+1:]
+			for _, line := range strings.Split(chunk[:max(end, 0)], "\n") {
+				line = strings.TrimRight(line, "\r")
+				if line != "" && f.match(line) {
+					matched = append(matched, line)
+				}
+			}
+		}
+
+		if len(matched) > 0 || time.Since(idle) >= logHeartbeat {
+			if err := send(matched...); err != nil {
+				return
+			}
+			idle = time.Now()
+		}
+	}
+}
+
+// readLogFrom returns the log from offset up to size, at most logTailMax of
+// it, and the offset after what was read
+func readLogFrom(path string, offset, size int64) (string, int64) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", offset
+	}
+	defer file.Close()
+
+	// Far behind, the stream skips ahead rather than sending all of it
+	if size-offset > logTailMax {
+		offset = size - logTailMax
+	}
+	buf := make([]byte, size-offset)
+	n, _ := file.ReadAt(buf, offset)
+	return string(buf[:n]), offset + int64(n)
+}
+
+// handleServerLogs shows the recent lines of a server log, then follows it
+func (p *Panel) handleServerLogs(w http.ResponseWriter, r *http.Request) {
+	names := p.logNames()
+	if len(names) == 0 {
+		p.renderPage(w, "Server Logs", fmt.Sprintf(`<div class="card">
+    <div class="card-title">Server Logs</div>
+    <p>Logs are not kept in files, as in a container; read them from its output. The <a href="/%s/server/logs/audit">audit log</a> may still be kept.</p>
+</div>`, p.basePath))
+		return
+	}
+
+	query := r.URL.Query()
+	name := query.Get("log")
+	if p.logPath(name) == "" {
+		name = names[0]
+		if slices.Contains(names, "server") {
+			name = "server"
+		}
+	}
+	f, err := logFilterFromQuery(query)
+	lines := logLinesFromQuery(query, 200)
+	var tail []string
+	if err == nil {
+		tail, _, err = readLogTail(p.logPath(name), lines, f)
+	}
+
+	var out strings.Builder
+	if err != nil {
+		fmt.Fprintf(&out, `<div class="card notice-error">%s</div>
+`, html.EscapeString(err.Error()))
+	}
+	options := make([]string, 0, len(names)*2)
+	for _, n := range names {
+		options = append(options, n, n+".log")
+	}
+	stream := url.Values{"level": {f.Level}, "q": {query.Get("q")}, "lines": {"0"}}
+	fmt.Fprintf(&out, `<div class="card">
+    <div class="card-title">Server Logs</div>
+    <form method="get">
+        %s
+        %s
+        <input type="text" name="q" value="%s" placeholder="Text">
+        <input type="number" name="lines" value="%d" min="0" max="%d" title="Recent lines">
+        <button type="submit" class="btn btn-secondary">Show</button>
+        <label><input type="checkbox" id="log-follow" checked> Follow</label>
+    </form>
+    <p id="log-status">%s: the last %d matching lines.</p>
+    <pre id="log-lines">%s</pre>
+    <p>The <a href="/%s/server/logs/audit">audit log</a> has its own search.</p>
+</div>
+<script>
+(function () {
+    var pre = document.getElementById("log-lines");
+    var follow = document.getElementById("log-follow");
+    var status = document.getElementById("log-status");
+    var source = null;
+    function open() {
+        source = new EventSource("/%s/server/logs/%s/stream?%s");
+        source.onopen = function () { status.textContent = "Following %s."; };
+        source.onerror = function () { status.textContent = "Disconnected, retrying..."; };
+        source.onmessage = function (e) {
+            pre.appendChild(document.createTextNode(e.data + "\n"));
+            while (pre.childNodes.length > %d) pre.removeChild(pre.firstChild);
+            window.scrollTo(0, document.body.scrollHeight);
+        };
+    }
+    follow.addEventListener("change", function () {
+        if (follow.checked) {
+            open();
+        } else if (source) {
+            source.close();
+            status.textContent = "Paused; lines written meanwhile are not shown.";
+        }
+    });
+    open();
+})();
+</script>`,
+		statusSelect("log", name, options...),
+		statusSelect("level", f.Level,
+			"", "All levels",
+			"debug", "Debug and up",
+			"info", "Info and up",
+			"warn", "Warnings and errors",
+			"error", "Errors"),
+		html.EscapeString(query.Get("q")), lines, logLinesMax,
+		html.EscapeString(name+".log"), len(tail), html.EscapeString(strings.Join(tail, "\n")+"\n"),
+		p.basePath, p.apiPath, name, stream.Encode(), name+".log", logLinesMax)
+
+	p.renderPage(w, "Server Logs", out.String())
+}
@@ -0,0 +1,268 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/maintenance"
+	"github.com/casjay-forks/caspaste/src/storage"
+)
+
+// maintenanceTimeLayout is the value format of datetime-local inputs
+const maintenanceTimeLayout = "2006-01-02T15:04"
+
+// SetMaintenanceSchedule enables scheduling maintenance windows
+func (p *Panel) SetMaintenanceSchedule(s *maintenance.Schedule) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.maintenance = s
+}
+
+func (p *Panel) maintenanceSchedule() *maintenance.Schedule {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.maintenance
+}
+
+// writeMaintenanceError maps maintenance errors to admin API errors
+func writeMaintenanceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, maintenance.ErrInvalidWindow):
+		writeAPIError(w, http.StatusBadRequest, "INVALID_WINDOW", err.Error())
+	case errors.Is(err, storage.ErrMaintenanceWindowNotFound):
+		writeAPIError(w, http.StatusNotFound, "NOT_FOUND", "Maintenance window not found")
+	default:
+		writeAPIError(w, http.StatusInternalServerError, "SERVER_ERROR", "Failed to save maintenance window")
+	}
+}
+
+// findWindow returns a window of the schedule by ID
+func findWindow(s *maintenance.Schedule, id string) (storage.MaintenanceWindow, error) {
+	for _, w := range s.List() {
+		if w.ID == id {
+			return w, nil
+		}
+	}
+	return storage.MaintenanceWindow{}, storage.ErrMaintenanceWindowNotFound
+}
+
+// endWindow ends a running window now
+func endWindow(s *maintenance.Schedule, id string) (storage.MaintenanceWindow, error) {
+	window, err := findWindow(s, id)
+	if err != nil {
+		return window, err
+	}
+	now := time.Now().Unix()
+	if window.StartsAt > now || window.EndsAt <= now {
+		return window, fmt.Errorf("%w: the window is not running", maintenance.ErrInvalidWindow)
+	}
+	window.EndsAt = now
+	return s.Update(window)
+}
+
+// windowStatus describes a window relative to now
+func windowStatus(w storage.MaintenanceWindow, now int64) string {
+	switch {
+	case w.EndsAt <= now:
+		return "Ended"
+	case w.StartsAt <= now:
+		return "Running"
+	case w.AnnounceAt <= now:
+		return "Announced"
+	}
+	return "Scheduled"
+}
+
+// UI handlers
+
+// handleServerMaintenance lists maintenance windows and schedules new ones
+func (p *Panel) handleServerMaintenance(w http.ResponseWriter, r *http.Request) {
+	s := p.maintenanceSchedule()
+	if s == nil {
+		p.renderPage(w, "Maintenance", `<div class="card">
+    <div class="card-title">Maintenance Windows</div>
+    <p>Maintenance scheduling is not enabled.</p>
+</div>`)
+		return
+	}
+
+	var errMsg string
+	if r.Method == http.MethodPost {
+		var err error
+		switch r.FormValue("action") {
+		case "end":
+			_, err = endWindow(s, r.FormValue("id"))
+		case "delete":
+			err = s.Delete(r.FormValue("id"))
+		default:
+			err = addWindowFromForm(s, r)
+		}
+		if err == nil {
+			http.Redirect(w, r, "/"+p.basePath+"/server/maintenance", http.StatusSeeOther)
+			return
+		}
+		errMsg = err.Error()
+	}
+
+	csrf := p.csrfInput(r)
+	now := time.Now().Unix()
+
+	var out strings.Builder
+	if errMsg != "" {
+		fmt.Fprintf(&out, `<div class="card notice-error">%s</div>
+`, html.EscapeString(errMsg))
+	}
+	out.WriteString(`<div class="card">
+    <div class="card-title">Maintenance Windows</div>
+    <p>During a window every page and API request gets a 503, except the admin panel and admin API. A banner announces the window beforehand.</p>
+    <table class="table">
+        <thead><tr><th>Starts (UTC)</th><th>Ends (UTC)</th><th>Status</th><th>Message</th><th></th></tr></thead>
+        <tbody>`)
+	for _, window := range s.List() {
+		status := windowStatus(window, now)
+		action := ""
+		switch status {
+		case "Running":
+			action = fmt.Sprintf(`<form method="post">%s<input type="hidden" name="action" value="end"><input type="hidden" name="id" value="%s"><button class="btn btn-secondary">End now</button></form>`,
+				csrf, window.ID)
+		default:
+			action = fmt.Sprintf(`<form method="post">%s<input type="hidden" name="action" value="delete"><input type="hidden" name="id" value="%s"><button class="btn btn-secondary">Delete</button></form>`,
+				csrf, window.ID)
+		}
+		fmt.Fprintf(&out, `
+            <tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>`,
+			time.Unix(window.StartsAt, 0).UTC().Format(time.RFC3339), time.Unix(window.EndsAt, 0).UTC().Format(time.RFC3339),
+			status, html.EscapeString(window.Message), action)
+	}
+	fmt.Fprintf(&out, `
+        </tbody>
+    </table>
+</div>
+<div class="card">
+    <div class="card-title">Schedule a Window</div>
+    <form method="post" class="stacked">%s
+        <label><span>Starts (UTC)</span><input type="datetime-local" name="starts_at" required></label>
+        <label><span>Ends (UTC)</span><input type="datetime-local" name="ends_at" required></label>
+        <label><span>Announce (hours before)</span><input type="number" name="announce_hours" min="0" value="%d"></label>
+        <label><span>Message</span><input type="text" name="message" maxlength="%d"></label>
+        <div><button type="submit" class="btn btn-primary">Schedule</button></div>
+    </form>
+</div>`, csrf, int(maintenance.DefaultAnnounce/time.Hour), maintenance.MessageMaxLength)
+
+	p.renderPage(w, "Maintenance", out.String())
+}
+
+// addWindowFromForm schedules a window from the admin panel form
+func addWindowFromForm(s *maintenance.Schedule, r *http.Request) error {
+	starts, err := time.Parse(maintenanceTimeLayout, r.FormValue("starts_at"))
+	if err != nil {
+		return fmt.Errorf("%w: invalid start time", maintenance.ErrInvalidWindow)
+	}
+	ends, err := time.Parse(maintenanceTimeLayout, r.FormValue("ends_at"))
+	if err != nil {
+		return fmt.Errorf("%w: invalid end time", maintenance.ErrInvalidWindow)
+	}
+	window := storage.MaintenanceWindow{
+		StartsAt: starts.Unix(),
+		EndsAt:   ends.Unix(),
+		Message:  strings.TrimSpace(r.FormValue("message")),
+	}
+	if hours, err := strconv.Atoi(r.FormValue("announce_hours")); err == nil && hours >= 0 {
+		window.AnnounceAt = starts.Add(-time.Duration(hours) * time.Hour).Unix()
+	}
+	_, err = s.Add(window, time.Now())
+	return err
+}
+
+// API handlers
+
+// apiServerMaintenance handles
+//
+//	GET    /server/maintenance/windows            - list windows
+//	POST   /server/maintenance/windows            - schedule {"starts_at", "ends_at", "announce_at", "message"}
+//	GET    /server/maintenance/windows/{id}       - one window
+//	PUT    /server/maintenance/windows/{id}       - replace times and message
+//	DELETE /server/maintenance/windows/{id}       - remove a window
+//	POST   /server/maintenance/windows/{id}/end   - end a running window now
+func (p *Panel) apiServerMaintenance(w http.ResponseWriter, r *http.Request) {
+	s := p.maintenanceSchedule()
+	if s == nil {
+		writeAPIError(w, http.StatusNotFound, "FEATURE_DISABLED", "Maintenance scheduling is not enabled")
+		return
+	}
+
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/server/maintenance/windows"), "/")
+	if rest == "" {
+		switch r.Method {
+		case http.MethodGet:
+			writeAPIData(w, s.List())
+		case http.MethodPost:
+			var window storage.MaintenanceWindow
+			if err := json.NewDecoder(r.Body).Decode(&window); err != nil {
+				writeAPIError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid JSON body")
+				return
+			}
+			window, err := s.Add(window, time.Now())
+			if err != nil {
+				writeMaintenanceError(w, err)
+				return
+			}
+			writeAPIData(w, window)
+		default:
+			writeAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		}
+		return
+	}
+
+	id, action, _ := strings.Cut(rest, "/")
+	window, err := findWindow(s, id)
+	if err != nil {
+		writeMaintenanceError(w, err)
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		writeAPIData(w, window)
+	case action == "" && r.Method == http.MethodPut:
+		var update storage.MaintenanceWindow
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid JSON body")
+			return
+		}
+		update.ID, update.CreatedAt = window.ID, window.CreatedAt
+		window, err = s.Update(update)
+		if err != nil {
+			writeMaintenanceError(w, err)
+			return
+		}
+		writeAPIData(w, window)
+	case action == "" && r.Method == http.MethodDelete:
+		if err := s.Delete(id); err != nil {
+			writeMaintenanceError(w, err)
+			return
+		}
+		writeAPIData(w, map[string]string{"deleted": id})
+	case action == "end" && r.Method == http.MethodPost:
+		window, err = endWindow(s, id)
+		if err != nil {
+			writeMaintenanceError(w, err)
+			return
+		}
+		writeAPIData(w, window)
+	default:
+		writeAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+	}
+}
@@ -0,0 +1,318 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/audit"
+	"github.com/casjay-forks/caspaste/src/netshare"
+	"github.com/casjay-forks/caspaste/src/storage"
+)
+
+// reviewBodyMax is how much of a paste the review page shows
+const reviewBodyMax = 64 << 10
+
+// moderationFilterFromQuery reads ?ip= and ?user= besides the list
+// parameters; ?frozen=1 is ?status=frozen
+func moderationFilterFromQuery(q url.Values) (storage.ModerationFilter, listParams, error) {
+	l, err := parseListParams(q)
+	if q.Get("frozen") == "1" || q.Get("frozen") == "true" {
+		l.Status = storage.ModerationFrozen
+	}
+	return storage.ModerationFilter{
+		IP:     strings.TrimSpace(q.Get("ip")),
+		User:   strings.TrimSpace(q.Get("user")),
+		Search: l.Search,
+		Status: l.Status,
+		From:   l.From,
+		To:     l.To,
+		Sort:   l.Sort,
+		Desc:   l.Desc,
+	}, l, err
+}
+
+// moderatePaste freezes, unfreezes or deletes a paste; every action is
+// audited, including refused ones
+func moderatePaste(db *storage.DB, id, action, reason, ip string) (string, error) {
+	var event string
+	var err error
+	switch action {
+	case "freeze":
+		event = audit.EventPasteFrozen
+		err = db.PasteFreeze(id, reason, "admin "+ip)
+	case "unfreeze":
+		event = audit.EventPasteUnfrozen
+		err = db.PasteUnfreeze(id)
+	case "delete":
+		// Legal holds and WORM mode still apply; legal-delete bypasses WORM
+		event = audit.EventPasteForceDeleted
+		err = db.PasteDelete(id)
+	default:
+		return "", storage.ErrNotFoundID
+	}
+	audit.PasteModeration(event, id, reason, ip, err)
+	return event, err
+}
+
+// API handlers
+
+// apiPasteModerationList lists every paste, private and frozen ones included
+func (p *Panel) apiPasteModerationList(w http.ResponseWriter, r *http.Request, db *storage.DB) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	f, l, err := moderationFilterFromQuery(r.URL.Query())
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+	pastes, total, err := db.PasteModerationList(f, l.PerPage, l.offset())
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "SERVER_ERROR", "Failed to list pastes")
+		return
+	}
+	writeAPIData(w, l.data("pastes", pastes, total))
+}
+
+// apiPasteModeration shows, deletes, freezes or unfreezes one paste
+func (p *Panel) apiPasteModeration(w http.ResponseWriter, r *http.Request, db *storage.DB, id, action string) {
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		paste, err := db.PasteGetForReview(id)
+		if err != nil {
+			writePasteError(w, err)
+			return
+		}
+		frozen, err := db.PasteFreezeGet(id)
+		if err != nil && err != storage.ErrNotFrozen {
+			writePasteError(w, err)
+			return
+		}
+		writeAPIData(w, map[string]interface{}{
+			"paste":  paste,
+			"frozen": frozen,
+		})
+		return
+	case action == "freeze" && r.Method == http.MethodGet:
+		frozen, err := db.PasteFreezeGet(id)
+		if err != nil {
+			writePasteError(w, err)
+			return
+		}
+		writeAPIData(w, frozen)
+		return
+	case action == "" && r.Method == http.MethodDelete:
+		action = "delete"
+	case action == "freeze" && r.Method == http.MethodPost:
+	case action == "freeze" && r.Method == http.MethodDelete:
+		action = "unfreeze"
+	default:
+		writeAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+
+	event, err := moderatePaste(db, id, action, req.Reason, netshare.GetClientAddr(r).String())
+	if err != nil {
+		writePasteError(w, err)
+		return
+	}
+	writeAPIData(w, map[string]interface{}{
+		"paste_id": id,
+		"action":   event,
+	})
+}
+
+// UI handlers
+
+// handleServerPastes lists every paste for moderation, with search by
+// address, user, title and status
+func (p *Panel) handleServerPastes(w http.ResponseWriter, r *http.Request) {
+	db := p.pasteStore(r.Context())
+	if db == nil {
+		p.renderPage(w, "Pastes", `<div class="card">
+    <div class="card-title">Pastes</div>
+    <p>Paste management is not enabled.</p>
+</div>`)
+		return
+	}
+
+	var errMsg string
+	if r.Method == http.MethodPost {
+		action := r.FormValue("action")
+		_, err := moderatePaste(db, strings.TrimSpace(r.FormValue("id")), action,
+			r.FormValue("reason"), netshare.GetClientAddr(r).String())
+		if err == nil {
+			// A deleted paste has nothing left to review
+			query := r.URL.Query()
+			if action == "delete" {
+				query.Del("review")
+			}
+			target := "/" + p.basePath + "/server/pastes"
+			if len(query) > 0 {
+				target += "?" + query.Encode()
+			}
+			http.Redirect(w, r, target, http.StatusSeeOther)
+			return
+		}
+		errMsg = err.Error()
+	}
+
+	if id := r.URL.Query().Get("review"); id != "" && errMsg == "" {
+		p.renderPage(w, "Review Paste", p.pasteReviewContent(r, db, id))
+		return
+	}
+
+	query := r.URL.Query()
+	f, l, err := moderationFilterFromQuery(query)
+	var pastes []storage.ModerationItem
+	var total int
+	if err == nil {
+		pastes, total, err = db.PasteModerationList(f, l.PerPage, l.offset())
+	}
+	if err != nil {
+		errMsg = err.Error()
+	}
+
+	csrf := p.csrfInput(r)
+
+	var out strings.Builder
+	if errMsg != "" {
+		fmt.Fprintf(&out, `<div class="card notice-error">%s</div>
+`, html.EscapeString(errMsg))
+	}
+	fmt.Fprintf(&out, `<div class="card">
+    <div class="card-title">Pastes</div>
+    <p>Every paste, private ones included. A frozen paste is hidden from everyone until it is unfrozen or deleted. Use <a href="/%s/server/pastes/bulk">bulk actions</a> to remove a spam wave.</p>
+    <form method="get">
+        <input type="text" name="q" value="%s" placeholder="Paste ID or title">
+        <input type="text" name="ip" value="%s" placeholder="IP address">
+        <input type="text" name="user" value="%s" placeholder="Username or author">
+        %s
+        %s
+        %s
+        <button type="submit" class="btn btn-secondary">Search</button>
+    </form>
+    %s
+    <table class="table">
+        <thead><tr>%s<th>Paste</th>%s<th>User</th><th>IP</th>%s%s<th>Status</th><th></th></tr></thead>
+        <tbody>`, p.basePath, html.EscapeString(f.Search), html.EscapeString(f.IP), html.EscapeString(f.User),
+		statusSelect("status", l.Status,
+			"", "All pastes",
+			storage.ModerationActive, "Active",
+			storage.ModerationExpired, "Expired",
+			storage.ModerationFrozen, "Frozen",
+			storage.ModerationPrivate, "Private",
+			storage.ModerationPublic, "Public",
+			storage.ModerationOneUse, "Burn after reading",
+			storage.ModerationEncrypted, "Encrypted"),
+		dateInputs(query), sortInputs(query), l.pager(query, total),
+		l.sortHeader(query, "created", "Created (UTC)"), l.sortHeader(query, "title", "Title"),
+		l.sortHeader(query, "size", "Size"), l.sortHeader(query, "expires", "Expires (UTC)"))
+	for _, paste := range pastes {
+		user := paste.Owner
+		if user == "" {
+			user = paste.Author
+		}
+		expires := "never"
+		if paste.DeleteTime != 0 {
+			expires = time.Unix(paste.DeleteTime, 0).UTC().Format(time.RFC3339)
+		}
+		var flags []string
+		if paste.Private {
+			flags = append(flags, "private")
+		}
+		if paste.OneUse {
+			flags = append(flags, "burn after reading")
+		}
+		if paste.Encrypted {
+			flags = append(flags, "encrypted")
+		}
+		freeze := fmt.Sprintf(`<form method="post">%s<input type="hidden" name="id" value="%s"><input type="hidden" name="action" value="freeze"><input type="text" name="reason" placeholder="Reason" required><button class="btn btn-secondary">Freeze</button></form>`,
+			csrf, paste.ID)
+		if paste.Frozen != nil {
+			flags = append(flags, "frozen: "+paste.Frozen.Reason)
+			freeze = fmt.Sprintf(`<form method="post">%s<input type="hidden" name="id" value="%s"><input type="hidden" name="action" value="unfreeze"><button class="btn btn-secondary">Unfreeze</button></form>`,
+				csrf, paste.ID)
+		}
+		fmt.Fprintf(&out, `
+            <tr><td>%s</td><td><a href="?review=%s">%s</a></td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td>
+                <td>%s<form method="post">%s<input type="hidden" name="id" value="%s"><input type="hidden" name="action" value="delete"><button class="btn btn-secondary">Delete</button></form></td></tr>`,
+			time.Unix(paste.CreateTime, 0).UTC().Format(time.RFC3339), paste.ID, paste.ID,
+			html.EscapeString(paste.Title), html.EscapeString(user), html.EscapeString(paste.CreatorIP),
+			sizeString(paste.Size), expires, html.EscapeString(strings.Join(flags, ", ")), freeze, csrf, paste.ID)
+	}
+	fmt.Fprintf(&out, `
+        </tbody>
+    </table>
+    %s
+</div>`, l.pager(query, total))
+
+	p.renderPage(w, "Pastes", out.String())
+}
+
+// pasteReviewContent shows a paste, frozen or not, with its moderation actions
+func (p *Panel) pasteReviewContent(r *http.Request, db *storage.DB, id string) string {
+	paste, err := db.PasteGetForReview(id)
+	if err != nil {
+		return fmt.Sprintf(`<div class="card notice-error">%s</div>`, html.EscapeString(err.Error()))
+	}
+	frozen, _ := db.PasteFreezeGet(id)
+
+	// Copies of a spammed paste share its hash, so they can be removed together
+	copies := ""
+	if hash, _ := db.PasteContentHash(id); hash != "" {
+		copies = fmt.Sprintf(`<p>Content hash <code>%s</code>, <a href="/%s/server/pastes/bulk?content_hash=%s">find copies</a></p>`,
+			hash, p.basePath, url.QueryEscape(hash))
+	}
+
+	csrf := p.csrfInput(r)
+	body := paste.Body
+	truncated := ""
+	if len(body) > reviewBodyMax {
+		body = body[:reviewBodyMax]
+		truncated = fmt.Sprintf(`<p>Showing the first %d KiB.</p>`, reviewBodyMax>>10)
+	}
+
+	var out strings.Builder
+	if frozen != nil {
+		fmt.Fprintf(&out, `<div class="card notice-warning">Frozen by %s at %s: %s</div>
+`, html.EscapeString(frozen.FrozenBy), time.Unix(frozen.FrozenAt, 0).UTC().Format(time.RFC3339), html.EscapeString(frozen.Reason))
+	}
+	action := fmt.Sprintf(`<form method="post">%s<input type="hidden" name="id" value="%s"><input type="hidden" name="action" value="freeze"><input type="text" name="reason" placeholder="Reason" required><button class="btn btn-secondary">Freeze</button></form>`,
+		csrf, paste.ID)
+	if frozen != nil {
+		action = fmt.Sprintf(`<form method="post">%s<input type="hidden" name="id" value="%s"><input type="hidden" name="action" value="unfreeze"><button class="btn btn-secondary">Unfreeze</button></form>`,
+			csrf, paste.ID)
+	}
+	fmt.Fprintf(&out, `<div class="card">
+    <div class="card-title">%s</div>
+    <p>Paste <code>%s</code>, created %s, syntax %s</p>
+    %s
+    %s
+    <pre>%s</pre>
+    %s
+    <form method="post">%s<input type="hidden" name="id" value="%s"><input type="hidden" name="action" value="delete"><button class="btn btn-secondary">Delete</button></form>
+    <p><a href="/%s/server/pastes">Back to pastes</a></p>
+</div>`,
+		html.EscapeString(paste.Title), paste.ID,
+		time.Unix(paste.CreateTime, 0).UTC().Format(time.RFC3339), html.EscapeString(paste.Syntax),
+		copies, truncated, html.EscapeString(body), action, csrf, paste.ID, p.basePath)
+	return out.String()
+}
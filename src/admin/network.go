@@ -0,0 +1,98 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package admin
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+)
+
+// OutboundFeature is a feature that connects to other hosts
+type OutboundFeature struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	// Why it is off, or where it connects
+	Detail string `json:"detail"`
+}
+
+// NetworkStatus describes the connections the server makes to other hosts
+type NetworkStatus struct {
+	// Offline mode turns off the features that reach the internet
+	Offline bool `json:"offline"`
+	// Proxy URL without credentials, "none", or "" for the environment
+	Proxy    string            `json:"proxy"`
+	Features []OutboundFeature `json:"features"`
+}
+
+// SetNetworkStatus sets what the outbound page of the admin panel shows
+func (p *Panel) SetNetworkStatus(status NetworkStatus) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.network = status
+}
+
+func (p *Panel) networkStatus() NetworkStatus {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.network
+}
+
+// UI handlers
+
+// handleServerNetworkOutbound lists the outbound features and whether each is on
+func (p *Panel) handleServerNetworkOutbound(w http.ResponseWriter, r *http.Request) {
+	p.renderPage(w, "Outbound Connections", p.serverNetworkOutboundContent())
+}
+
+func (p *Panel) serverNetworkOutboundContent() string {
+	status := p.networkStatus()
+
+	var out strings.Builder
+	if status.Offline {
+		out.WriteString(`<div class="card notice-warning">Offline mode is on (<code>network.offline</code>): features that reach the internet are turned off.</div>
+`)
+	}
+
+	proxy := status.Proxy
+	switch proxy {
+	case "":
+		proxy = "from HTTPS_PROXY / HTTP_PROXY, if set"
+	case "none":
+		proxy = "none (direct connections)"
+	}
+	fmt.Fprintf(&out, `<div class="card">
+    <div class="card-title">Outbound Connections</div>
+    <p>Proxy: %s</p>
+    <table class="table">
+        <thead><tr><th>Feature</th><th>Status</th><th>Detail</th></tr></thead>
+        <tbody>`, html.EscapeString(proxy))
+	for _, f := range status.Features {
+		state := "Off"
+		if f.Enabled {
+			state = "On"
+		}
+		fmt.Fprintf(&out, `
+            <tr><td>%s</td><td>%s</td><td>%s</td></tr>`,
+			html.EscapeString(f.Name), state, html.EscapeString(f.Detail))
+	}
+	out.WriteString(`
+        </tbody>
+    </table>
+</div>`)
+	return out.String()
+}
+
+// API handlers
+
+func (p *Panel) apiServerNetworkOutbound(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+	writeAPIData(w, p.networkStatus())
+}
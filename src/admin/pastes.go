@@ -0,0 +1,341 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/audit"
+	"github.com/casjay-forks/caspaste/src/netshare"
+	"github.com/casjay-forks/caspaste/src/storage"
+)
+
+// SetPasteStore enables paste management (legal holds, templates) in the admin API
+func (p *Panel) SetPasteStore(db storage.DB) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pastes = &db
+}
+
+// pasteStore returns the paste storage with its queries bound to ctx, or nil
+func (p *Panel) pasteStore(ctx context.Context) *storage.DB {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.pastes == nil {
+		return nil
+	}
+	db := p.pastes.WithContext(ctx)
+	return &db
+}
+
+// apiServerPastes handles moderation, legal actions and pins on pastes
+//
+//	GET    /server/pastes                   list every paste (?ip=, ?user=, ?frozen=1, ?page=)
+//	GET    /server/pastes/{id}              show a paste, frozen or not
+//	DELETE /server/pastes/{id}              delete a paste
+//	GET    /server/pastes/{id}/freeze       show the freeze on a paste
+//	POST   /server/pastes/{id}/freeze       hide a paste pending review {"reason": "..."}
+//	DELETE /server/pastes/{id}/freeze       make a frozen paste visible again
+//	GET    /server/pastes/pinned            list pinned pastes
+//	PUT    /server/pastes/{id}/pin          pin a paste {"position": 0, "keep_after_expiry": false}
+//	DELETE /server/pastes/{id}/pin          unpin a paste
+//	GET    /server/pastes/legal-holds       list legal holds
+//	GET    /server/pastes/{id}/legal-hold   show the hold on a paste
+//	POST   /server/pastes/{id}/legal-hold   place a hold {"reason": "..."}
+//	DELETE /server/pastes/{id}/legal-hold   release a hold {"reason": "..."}
+//	POST   /server/pastes/{id}/legal-delete delete before expiry, bypassing WORM {"reason": "..."}
+//	POST   /server/pastes/bulk/preview      count the pastes matching a filter, see apiPasteBulk
+//	POST   /server/pastes/bulk              delete or expire the previewed pastes {"token": "..."}
+func (p *Panel) apiServerPastes(w http.ResponseWriter, r *http.Request) {
+	db := p.pasteStore(r.Context())
+	if db == nil {
+		writeAPIError(w, http.StatusNotFound, "FEATURE_DISABLED", "Paste management is not enabled")
+		return
+	}
+
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/server/pastes"), "/")
+	if rest == "" {
+		p.apiPasteModerationList(w, r, db)
+		return
+	}
+	if rest == "legal-holds" {
+		if r.Method != http.MethodGet {
+			writeAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+			return
+		}
+		holds, err := db.PasteLegalHolds()
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, "SERVER_ERROR", "Failed to list legal holds")
+			return
+		}
+		writeAPIData(w, map[string]interface{}{
+			"worm":  db.WORM(),
+			"holds": holds,
+		})
+		return
+	}
+
+	if rest == "bulk" || rest == "bulk/preview" {
+		_, step, _ := strings.Cut(rest, "/")
+		p.apiPasteBulk(w, r, db, step)
+		return
+	}
+
+	if rest == "pinned" {
+		if r.Method != http.MethodGet {
+			writeAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+			return
+		}
+		pins, err := db.PastePins()
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, "SERVER_ERROR", "Failed to list pinned pastes")
+			return
+		}
+		writeAPIData(w, pins)
+		return
+	}
+
+	id, action, _ := strings.Cut(rest, "/")
+	if id == "" {
+		writeAPIError(w, http.StatusNotFound, "NOT_FOUND", "Not found")
+		return
+	}
+	if action == "pin" {
+		p.apiPastePin(w, r, db, id)
+		return
+	}
+	if action == "" || action == "freeze" {
+		p.apiPasteModeration(w, r, db, id, action)
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if r.Method != http.MethodGet {
+		json.NewDecoder(r.Body).Decode(&req)
+	}
+	ip := netshare.GetClientAddr(r).String()
+
+	var event string
+	var err error
+	switch {
+	case action == "legal-hold" && r.Method == http.MethodGet:
+		hold, err := db.PasteLegalHoldGet(id)
+		if err != nil {
+			writePasteError(w, err)
+			return
+		}
+		writeAPIData(w, hold)
+		return
+	case action == "legal-hold" && r.Method == http.MethodPost:
+		event = audit.EventPasteLegalHold
+		err = db.PasteLegalHoldSet(id, req.Reason, "admin "+ip)
+	case action == "legal-hold" && r.Method == http.MethodDelete:
+		event = audit.EventPasteLegalRelease
+		if strings.TrimSpace(req.Reason) == "" {
+			err = storage.ErrReasonRequired
+		} else {
+			err = db.PasteLegalHoldRelease(id)
+		}
+	case action == "legal-delete" && r.Method == http.MethodPost:
+		event = audit.EventPasteLegalDelete
+		err = db.PasteLegalDelete(id, req.Reason)
+	case action == "legal-hold" || action == "legal-delete":
+		writeAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	default:
+		writeAPIError(w, http.StatusNotFound, "NOT_FOUND", "Not found")
+		return
+	}
+
+	// Every legal action is audited, including refused ones
+	audit.PasteLegalAction(event, id, req.Reason, ip, err)
+	if err != nil {
+		writePasteError(w, err)
+		return
+	}
+
+	writeAPIData(w, map[string]interface{}{
+		"paste_id": id,
+		"action":   event,
+	})
+}
+
+// apiPastePin pins, re-orders or unpins a paste
+func (p *Panel) apiPastePin(w http.ResponseWriter, r *http.Request, db *storage.DB, id string) {
+	ip := netshare.GetClientAddr(r).String()
+	switch r.Method {
+	case http.MethodPut:
+		var req struct {
+			Position        int  `json:"position"`
+			KeepAfterExpiry bool `json:"keep_after_expiry"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid JSON body")
+			return
+		}
+		pin, err := db.PastePinSet(storage.PastePin{
+			PasteID:         id,
+			Position:        req.Position,
+			KeepAfterExpiry: req.KeepAfterExpiry,
+			CreatedBy:       "admin " + ip,
+		})
+		if err != nil {
+			writePasteError(w, err)
+			return
+		}
+		audit.PastePin(audit.EventPastePinned, id, ip)
+		writeAPIData(w, pin)
+	case http.MethodDelete:
+		if err := db.PastePinRemove(id); err != nil {
+			writePasteError(w, err)
+			return
+		}
+		audit.PastePin(audit.EventPasteUnpinned, id, ip)
+		writeAPIData(w, map[string]interface{}{
+			"paste_id": id,
+			"action":   audit.EventPasteUnpinned,
+		})
+	default:
+		writeAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+	}
+}
+
+// UI handlers
+
+// handleServerPinned shows the pinned pastes and pins new ones
+func (p *Panel) handleServerPinned(w http.ResponseWriter, r *http.Request) {
+	db := p.pasteStore(r.Context())
+	if db == nil {
+		p.renderPage(w, "Pinned Pastes", `<div class="card">
+    <div class="card-title">Pinned Pastes</div>
+    <p>Paste management is not enabled.</p>
+</div>`)
+		return
+	}
+
+	var errMsg string
+	if r.Method == http.MethodPost {
+		id := strings.TrimSpace(r.FormValue("id"))
+		ip := netshare.GetClientAddr(r).String()
+		var err error
+		if r.FormValue("action") == "unpin" {
+			err = db.PastePinRemove(id)
+			if err == nil {
+				audit.PastePin(audit.EventPasteUnpinned, id, ip)
+			}
+		} else {
+			var position int
+			position, err = strconv.Atoi(strings.TrimSpace(r.FormValue("position")))
+			if err != nil {
+				err = errors.New("position must be a number")
+			} else {
+				_, err = db.PastePinSet(storage.PastePin{
+					PasteID:         id,
+					Position:        position,
+					KeepAfterExpiry: r.FormValue("keep_after_expiry") != "",
+					CreatedBy:       "admin " + ip,
+				})
+			}
+			if err == nil {
+				audit.PastePin(audit.EventPastePinned, id, ip)
+			}
+		}
+		if err == nil {
+			http.Redirect(w, r, "/"+p.basePath+"/server/pinned", http.StatusSeeOther)
+			return
+		}
+		errMsg = err.Error()
+	}
+
+	pins, err := db.PastePins()
+	if err != nil {
+		errMsg = err.Error()
+	}
+
+	csrf := p.csrfInput(r)
+
+	var out strings.Builder
+	if errMsg != "" {
+		fmt.Fprintf(&out, `<div class="card notice-error">%s</div>
+`, html.EscapeString(errMsg))
+	}
+	out.WriteString(`<div class="card">
+    <div class="card-title">Pinned Pastes</div>
+    <p>Pinned pastes are listed first on the public list and on the homepage, lowest position first. A kept paste stays up after it expires.</p>
+    <table class="table">
+        <thead><tr><th>Paste</th><th>Title</th><th>Position</th><th>Keep after expiry</th><th>Pinned (UTC)</th><th></th></tr></thead>
+        <tbody>`)
+	for _, pin := range pins {
+		keep := ""
+		if pin.KeepAfterExpiry {
+			keep = " checked"
+		}
+		fmt.Fprintf(&out, `
+            <tr><td><a href="/%s">%s</a></td><td>%s</td>
+                <td><input type="number" name="position" value="%d" form="pin-%s"></td>
+                <td><input type="checkbox" name="keep_after_expiry" value="1"%s form="pin-%s"></td>
+                <td>%s</td>
+                <td><form id="pin-%s" method="post">%s<input type="hidden" name="id" value="%s"><button type="submit" class="btn btn-secondary">Save</button></form>
+                    <form method="post">%s<input type="hidden" name="id" value="%s"><input type="hidden" name="action" value="unpin"><button class="btn btn-secondary">Unpin</button></form></td></tr>`,
+			pin.PasteID, pin.PasteID, html.EscapeString(pin.Title),
+			pin.Position, pin.PasteID,
+			keep, pin.PasteID,
+			time.Unix(pin.CreatedAt, 0).UTC().Format(time.RFC3339),
+			pin.PasteID, csrf, pin.PasteID,
+			csrf, pin.PasteID)
+	}
+	fmt.Fprintf(&out, `
+        </tbody>
+    </table>
+    <form method="post" class="stacked">%s
+        <label><span>Paste ID</span><input type="text" name="id" required></label>
+        <label><span>Position</span><input type="number" name="position" value="%d"></label>
+        <label><span><input type="checkbox" name="keep_after_expiry" value="1"> Keep after expiry</span></label>
+        <div><button type="submit" class="btn btn-primary">Pin</button></div>
+    </form>
+</div>`, csrf, len(pins))
+
+	p.renderPage(w, "Pinned Pastes", out.String())
+}
+
+// writePasteError maps storage errors to admin API errors
+func writePasteError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, storage.ErrNotFoundID):
+		writeAPIError(w, http.StatusNotFound, "PASTE_NOT_FOUND", "Paste not found")
+	case errors.Is(err, storage.ErrNoLegalHold):
+		writeAPIError(w, http.StatusNotFound, "NO_LEGAL_HOLD", "Paste is not under legal hold")
+	case errors.Is(err, storage.ErrLegalHold):
+		writeAPIError(w, http.StatusConflict, "LEGAL_HOLD", "Paste is under legal hold")
+	case errors.Is(err, storage.ErrNotPinned):
+		writeAPIError(w, http.StatusNotFound, "NOT_PINNED", "Paste is not pinned")
+	case errors.Is(err, storage.ErrPinNotAllowed):
+		writeAPIError(w, http.StatusBadRequest, "PIN_NOT_ALLOWED", "Private and burn-after-reading pastes cannot be pinned")
+	case errors.Is(err, storage.ErrFrozen):
+		writeAPIError(w, http.StatusConflict, "ALREADY_FROZEN", "Paste is already frozen")
+	case errors.Is(err, storage.ErrNotFrozen):
+		writeAPIError(w, http.StatusNotFound, "NOT_FROZEN", "Paste is not frozen")
+	case errors.Is(err, storage.ErrWORM):
+		writeAPIError(w, http.StatusConflict, "WORM", "Paste is write-once until it expires; use legal-delete")
+	case errors.Is(err, storage.ErrReasonRequired):
+		writeAPIError(w, http.StatusBadRequest, "REASON_REQUIRED", "A reason is required")
+	case errors.Is(err, storage.ErrUnavailable):
+		writeAPIError(w, http.StatusServiceUnavailable, "UNAVAILABLE", "The database is unavailable")
+	default:
+		writeAPIError(w, http.StatusInternalServerError, "SERVER_ERROR", err.Error())
+	}
+}
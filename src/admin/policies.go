@@ -0,0 +1,106 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package admin
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/casjay-forks/caspaste/src/config"
+)
+
+// maxPolicyBundleSize is the largest policy bundle accepted on import
+const maxPolicyBundleSize = 1 << 20
+
+// PolicyImport reports what an imported policy bundle changed
+type PolicyImport struct {
+	// Config keys that differ from the running config
+	Changed []string `json:"changed"`
+	// Keys applied at once
+	Applied []string `json:"applied"`
+	// Keys that take effect after a restart
+	Restart []string `json:"restart"`
+}
+
+// PolicyService exports and imports the policy settings of the config file
+type PolicyService interface {
+	ExportPolicies() (config.PolicyBundle, error)
+	ImportPolicies(bundle config.PolicyBundle) (PolicyImport, error)
+}
+
+// SetPolicyService enables policy bundles in the admin API
+func (p *Panel) SetPolicyService(svc PolicyService) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.policies = svc
+}
+
+func (p *Panel) policyService() PolicyService {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.policies
+}
+
+// apiServerPolicies handles
+//
+//	GET /server/policies - the policy bundle as YAML
+//	PUT /server/policies - import a YAML policy bundle into the config file
+func (p *Panel) apiServerPolicies(w http.ResponseWriter, r *http.Request) {
+	svc := p.policyService()
+	if svc == nil {
+		writeAPIError(w, http.StatusNotFound, "FEATURE_DISABLED", "Policy bundles are not enabled")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		bundle, err := svc.ExportPolicies()
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, "SERVER_ERROR", "Failed to read policies")
+			return
+		}
+		data, err := bundle.Marshal()
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, "SERVER_ERROR", "Failed to write policies")
+			return
+		}
+		w.Header().Set("Content-Type", "application/yaml; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="caspaste-policies.yml"`)
+		w.Write(data)
+
+	case http.MethodPut, http.MethodPost:
+		data, err := io.ReadAll(io.LimitReader(r.Body, maxPolicyBundleSize+1))
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, "INVALID_BODY", "Failed to read body")
+			return
+		}
+		if len(data) > maxPolicyBundleSize {
+			writeAPIError(w, http.StatusRequestEntityTooLarge, "TOO_LARGE", "Policy bundle is larger than 1 MB")
+			return
+		}
+		bundle, err := config.ParsePolicyBundle(data)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, "INVALID_POLICY", err.Error())
+			return
+		}
+		result, err := svc.ImportPolicies(bundle)
+		switch {
+		case errors.Is(err, config.ErrInvalidPolicy):
+			writeAPIError(w, http.StatusBadRequest, "INVALID_POLICY", err.Error())
+		case errors.Is(err, config.ErrPoliciesReadOnly):
+			writeAPIError(w, http.StatusConflict, "READ_ONLY", err.Error())
+		case err != nil:
+			writeAPIError(w, http.StatusInternalServerError, "SERVER_ERROR", "Failed to save policies")
+		default:
+			writeAPIData(w, result)
+		}
+
+	default:
+		writeAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+	}
+}
@@ -0,0 +1,307 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/cli"
+	"github.com/casjay-forks/caspaste/src/config"
+	"github.com/casjay-forks/caspaste/src/netshare"
+)
+
+// rateLimitUsageShown is the number of busiest IPs listed per class in the UI
+const rateLimitUsageShown = 10
+
+// RateLimitClass is the limits and current counters of a route class
+type RateLimitClass struct {
+	Name   string                    `json:"name"`
+	Limits config.RateLimitWindows   `json:"limits"`
+	Usage  []netshare.RateLimitUsage `json:"usage"`
+}
+
+// RateLimitService tunes rate limits at runtime
+// Changes are saved to the config file and apply at once
+type RateLimitService interface {
+	RateLimitClasses() []RateLimitClass
+	RateLimitRules() (exempt, ban []netshare.RateLimitRule)
+	SetRateLimit(class string, limits config.RateLimitWindows) error
+	AddRateLimitRule(kind string, rule netshare.RateLimitRule) error
+	RemoveRateLimitRule(kind, ip string) error
+}
+
+// SetRateLimitService enables rate limit tuning in the admin panel
+func (p *Panel) SetRateLimitService(svc RateLimitService) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rateLimits = svc
+}
+
+func (p *Panel) rateLimitService() RateLimitService {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.rateLimits
+}
+
+// writeRateLimitError maps rate limit errors to admin API errors
+func writeRateLimitError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, netshare.ErrInvalidRateLimitRule):
+		writeAPIError(w, http.StatusBadRequest, "INVALID_RULE", err.Error())
+	case errors.Is(err, netshare.ErrRateLimitRuleNotFound):
+		writeAPIError(w, http.StatusNotFound, "NOT_FOUND", "No rule for this IP")
+	case errors.Is(err, config.ErrRateLimitsReadOnly):
+		writeAPIError(w, http.StatusConflict, "READ_ONLY", err.Error())
+	default:
+		writeAPIError(w, http.StatusInternalServerError, "SERVER_ERROR", "Failed to save rate limits")
+	}
+}
+
+// newRateLimitRule builds an exemption or ban lasting duration ("" = no end)
+func newRateLimitRule(ip, duration, reason string) (netshare.RateLimitRule, error) {
+	rule := netshare.RateLimitRule{IP: strings.TrimSpace(ip), Reason: strings.TrimSpace(reason)}
+	if duration = strings.TrimSpace(duration); duration != "" {
+		d, err := cli.ParseDuration(duration)
+		if err != nil || d <= 0 {
+			return rule, fmt.Errorf("%w: invalid duration %q", netshare.ErrInvalidRateLimitRule, duration)
+		}
+		rule.Until = time.Now().Add(d).UTC().Format(time.RFC3339)
+	}
+	return rule, nil
+}
+
+// checkSelfBan refuses a ban that covers the admin's own address, which would
+// lock them out of the admin panel along with everything else
+func checkSelfBan(kind string, rule netshare.RateLimitRule, r *http.Request) error {
+	if kind != "ban" {
+		return nil
+	}
+	network, err := rule.Network()
+	if err != nil {
+		return err
+	}
+	if network.Contains(netshare.GetClientAddr(r)) {
+		return fmt.Errorf("%w: %s includes your own address", netshare.ErrInvalidRateLimitRule, rule.IP)
+	}
+	return nil
+}
+
+// UI handlers
+
+// handleServerRateLimits shows the limits, counters, exemptions and bans
+func (p *Panel) handleServerRateLimits(w http.ResponseWriter, r *http.Request) {
+	svc := p.rateLimitService()
+	if svc == nil {
+		p.renderPage(w, "Rate Limits", `<div class="card">
+    <div class="card-title">Rate Limits</div>
+    <p>Rate limit tuning is not enabled.</p>
+</div>`)
+		return
+	}
+
+	var errMsg string
+	if r.Method == http.MethodPost {
+		var err error
+		switch r.FormValue("action") {
+		case "limits":
+			var limits config.RateLimitWindows
+			limits, err = parseRateLimitForm(r)
+			if err == nil {
+				err = svc.SetRateLimit(r.FormValue("class"), limits)
+			}
+		case "remove":
+			err = svc.RemoveRateLimitRule(r.FormValue("kind"), r.FormValue("ip"))
+		default:
+			var rule netshare.RateLimitRule
+			rule, err = newRateLimitRule(r.FormValue("ip"), r.FormValue("duration"), r.FormValue("reason"))
+			if err == nil {
+				err = checkSelfBan(r.FormValue("kind"), rule, r)
+			}
+			if err == nil {
+				err = svc.AddRateLimitRule(r.FormValue("kind"), rule)
+			}
+		}
+		if err == nil {
+			http.Redirect(w, r, "/"+p.basePath+"/server/ratelimit", http.StatusSeeOther)
+			return
+		}
+		errMsg = err.Error()
+	}
+
+	csrf := p.csrfInput(r)
+
+	var out strings.Builder
+	if errMsg != "" {
+		fmt.Fprintf(&out, `<div class="card notice-error">%s</div>
+`, html.EscapeString(errMsg))
+	}
+	out.WriteString(`<div class="card">
+    <div class="card-title">Limits</div>
+    <p>Requests per IP in each period; 0 = unlimited. Changes apply at once and are saved to the config file.</p>
+    <table class="table">
+        <thead><tr><th>Class</th><th>Per 5 min</th><th>Per 15 min</th><th>Per hour</th><th></th></tr></thead>
+        <tbody>`)
+	classes := svc.RateLimitClasses()
+	for _, class := range classes {
+		fmt.Fprintf(&out, `
+            <tr><td>%s</td>
+                <td><input type="number" name="per_5min" min="0" value="%d" form="limits-%s"></td>
+                <td><input type="number" name="per_15min" min="0" value="%d" form="limits-%s"></td>
+                <td><input type="number" name="per_1hour" min="0" value="%d" form="limits-%s"></td>
+                <td><form id="limits-%s" method="post">%s<input type="hidden" name="action" value="limits"><input type="hidden" name="class" value="%s"><button type="submit" class="btn btn-secondary">Save</button></form></td></tr>`,
+			class.Name, class.Limits.Per5Min, class.Name, class.Limits.Per15Min, class.Name, class.Limits.Per1Hour, class.Name,
+			class.Name, csrf, class.Name)
+	}
+	out.WriteString(`
+        </tbody>
+    </table>
+</div>
+<div class="card">
+    <div class="card-title">Busiest IPs</div>
+    <table class="table">
+        <thead><tr><th>Class</th><th>IP</th><th>5 min</th><th>15 min</th><th>Hour</th></tr></thead>
+        <tbody>`)
+	for _, class := range classes {
+		for i, u := range class.Usage {
+			if i == rateLimitUsageShown {
+				break
+			}
+			fmt.Fprintf(&out, `
+            <tr><td>%s</td><td>%s</td><td>%d</td><td>%d</td><td>%d</td></tr>`,
+				class.Name, html.EscapeString(u.IP), u.Per5Min, u.Per15Min, u.Per1Hour)
+		}
+	}
+	out.WriteString(`
+        </tbody>
+    </table>
+</div>
+<div class="card">
+    <div class="card-title">Exemptions and Bans</div>
+    <p>Exempt IPs skip every rate limit. Banned IPs get 429 on rate limited routes until the ban ends.</p>
+    <table class="table">
+        <thead><tr><th>Kind</th><th>IP or network</th><th>Until (UTC)</th><th>Reason</th><th></th></tr></thead>
+        <tbody>`)
+	exempt, ban := svc.RateLimitRules()
+	for _, list := range []struct {
+		kind  string
+		rules []netshare.RateLimitRule
+	}{{"exempt", exempt}, {"ban", ban}} {
+		for _, rule := range list.rules {
+			until := rule.Until
+			if until == "" {
+				until = "no end"
+			}
+			fmt.Fprintf(&out, `
+            <tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td><form method="post">%s<input type="hidden" name="action" value="remove"><input type="hidden" name="kind" value="%s"><input type="hidden" name="ip" value="%s"><button class="btn btn-secondary">Remove</button></form></td></tr>`,
+				list.kind, html.EscapeString(rule.IP), html.EscapeString(until), html.EscapeString(rule.Reason),
+				csrf, list.kind, html.EscapeString(rule.IP))
+		}
+	}
+	fmt.Fprintf(&out, `
+        </tbody>
+    </table>
+    <form method="post" class="stacked">%s
+        <label><span>Kind</span><select name="kind"><option value="exempt">Exempt</option><option value="ban">Ban</option></select></label>
+        <label><span>IP or network</span><input type="text" name="ip" placeholder="203.0.113.7 or 10.0.0.0/8" required></label>
+        <label><span>Duration (e.g. 30m, 12h, 7d; empty = no end)</span><input type="text" name="duration" value="1h"></label>
+        <label><span>Reason</span><input type="text" name="reason"></label>
+        <div><button type="submit" class="btn btn-primary">Add</button></div>
+    </form>
+</div>`, csrf)
+
+	p.renderPage(w, "Rate Limits", out.String())
+}
+
+// parseRateLimitForm reads the limits of a class from the form
+func parseRateLimitForm(r *http.Request) (config.RateLimitWindows, error) {
+	var limits config.RateLimitWindows
+	for name, field := range map[string]*uint{
+		"per_5min":  &limits.Per5Min,
+		"per_15min": &limits.Per15Min,
+		"per_1hour": &limits.Per1Hour,
+	} {
+		n, err := strconv.ParseUint(r.FormValue(name), 10, 32)
+		if err != nil {
+			return limits, fmt.Errorf("%w: %s must be a number", netshare.ErrInvalidRateLimitRule, name)
+		}
+		*field = uint(n)
+	}
+	return limits, nil
+}
+
+// API handlers
+
+// apiServerRateLimits handles
+//
+//	GET    /server/ratelimit               - limits, counters, exemptions and bans
+//	PUT    /server/ratelimit/{class}       - set limits {"per_5min", "per_15min", "per_1hour"}
+//	POST   /server/ratelimit/exempt        - exempt {"ip", "duration", "reason"}
+//	DELETE /server/ratelimit/exempt?ip=    - remove an exemption
+//	POST   /server/ratelimit/ban           - ban {"ip", "duration", "reason"}
+//	DELETE /server/ratelimit/ban?ip=       - remove a ban
+func (p *Panel) apiServerRateLimits(w http.ResponseWriter, r *http.Request) {
+	svc := p.rateLimitService()
+	if svc == nil {
+		writeAPIError(w, http.StatusNotFound, "FEATURE_DISABLED", "Rate limit tuning is not enabled")
+		return
+	}
+
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/server/ratelimit"), "/")
+	var err error
+	switch {
+	case rest == "" && r.Method == http.MethodGet:
+		// Shown below
+	case (rest == "exempt" || rest == "ban") && r.Method == http.MethodPost:
+		var req struct {
+			IP       string `json:"ip"`
+			Duration string `json:"duration"`
+			Reason   string `json:"reason"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid JSON body")
+			return
+		}
+		var rule netshare.RateLimitRule
+		rule, err = newRateLimitRule(req.IP, req.Duration, req.Reason)
+		if err == nil {
+			err = checkSelfBan(rest, rule, r)
+		}
+		if err == nil {
+			err = svc.AddRateLimitRule(rest, rule)
+		}
+	case (rest == "exempt" || rest == "ban") && r.Method == http.MethodDelete:
+		err = svc.RemoveRateLimitRule(rest, r.URL.Query().Get("ip"))
+	case rest != "" && r.Method == http.MethodPut:
+		var limits config.RateLimitWindows
+		if err := json.NewDecoder(r.Body).Decode(&limits); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid JSON body")
+			return
+		}
+		err = svc.SetRateLimit(rest, limits)
+	default:
+		writeAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+	if err != nil {
+		writeRateLimitError(w, err)
+		return
+	}
+
+	exempt, ban := svc.RateLimitRules()
+	writeAPIData(w, map[string]interface{}{
+		"classes": svc.RateLimitClasses(),
+		"exempt":  exempt,
+		"ban":     ban,
+	})
+}
@@ -0,0 +1,298 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/abuse"
+	"github.com/casjay-forks/caspaste/src/audit"
+	"github.com/casjay-forks/caspaste/src/firewall"
+	"github.com/casjay-forks/caspaste/src/netshare"
+	"github.com/casjay-forks/caspaste/src/storage"
+)
+
+// SetAbuseQueue enables the abuse report moderation queue
+func (p *Panel) SetAbuseQueue(q *abuse.Queue) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.abuse = q
+}
+
+func (p *Panel) abuseQueue() *abuse.Queue {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.abuse
+}
+
+// Reports can be acted on only with paste management and the firewall
+var (
+	errReportPastesDisabled   = errors.New("paste management is not enabled")
+	errReportFirewallDisabled = errors.New("the firewall is not enabled")
+)
+
+// writeReportError maps abuse report errors to admin API errors; deleting
+// the paste or banning its creator can fail as those do
+func writeReportError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, storage.ErrAbuseReportNotFound):
+		writeAPIError(w, http.StatusNotFound, "NOT_FOUND", "Report not found")
+	case errors.Is(err, abuse.ErrTicketsDisabled):
+		writeAPIError(w, http.StatusConflict, "TICKETS_DISABLED", "Abuse tickets are not enabled")
+	case errors.Is(err, errReportPastesDisabled), errors.Is(err, errReportFirewallDisabled):
+		writeAPIError(w, http.StatusConflict, "FEATURE_DISABLED", err.Error())
+	case errors.Is(err, firewall.ErrInvalidBan), errors.Is(err, storage.ErrIPBanNotFound):
+		writeFirewallError(w, err)
+	default:
+		writePasteError(w, err)
+	}
+}
+
+// reportAction acts on a report:
+//
+//	dismiss  close it, there is nothing to act on
+//	delete   delete the paste and close it
+//	ban      ban the address the paste came from for duration, delete the
+//	         paste and close it
+//	resolve  close it, having acted elsewhere
+//	reopen   put it back in the queue
+//	ticket   email its ticket again
+func (p *Panel) reportAction(r *http.Request, q *abuse.Queue, id, action, duration string) (storage.AbuseReport, error) {
+	ip := netshare.GetClientAddr(r).String()
+	var report storage.AbuseReport
+	var err error
+	switch action {
+	case "resolve":
+		report, err = q.Resolve(id, storage.AbuseResolutionNone)
+		if err == nil {
+			audit.AbuseReport(audit.EventReportResolved, "admin", report.ID, report.PasteID, ip)
+		}
+	case "dismiss":
+		report, err = q.Resolve(id, storage.AbuseResolutionDismissed)
+		if err == nil {
+			audit.AbuseReport(audit.EventReportDismissed, "admin", report.ID, report.PasteID, ip)
+		}
+	case "delete", "ban":
+		resolution := storage.AbuseResolutionDeleted
+		if action == "ban" {
+			resolution = storage.AbuseResolutionBanned
+		}
+		if report, err = q.Get(id); err == nil {
+			err = p.removeReportedPaste(r, report, action == "ban", duration)
+		}
+		if err == nil {
+			report, err = q.Resolve(id, resolution)
+		}
+		if err == nil {
+			audit.AbuseReport(audit.EventReportResolved, "admin", report.ID, report.PasteID, ip)
+		}
+	case "reopen":
+		report, err = q.Reopen(id)
+		if err == nil {
+			audit.AbuseReport(audit.EventReportReopened, "admin", report.ID, report.PasteID, ip)
+		}
+	case "ticket":
+		report, err = q.SendTicket(id)
+	default:
+		err = storage.ErrAbuseReportNotFound
+	}
+	return report, err
+}
+
+// removeReportedPaste deletes the paste of a report, banning the address it
+// was created from first when ban is set; the ban and the deletion are
+// audited as when made from the firewall and paste pages
+// A paste that is already gone counts as deleted, but its creator cannot
+// be looked up to ban
+func (p *Panel) removeReportedPaste(r *http.Request, report storage.AbuseReport, ban bool, duration string) error {
+	db := p.pasteStore(r.Context())
+	if db == nil {
+		return errReportPastesDisabled
+	}
+	reason := "abuse report " + report.ID
+
+	if ban {
+		fw := p.firewallService()
+		if fw == nil {
+			return errReportFirewallDisabled
+		}
+		creator, err := db.PasteCreatorIP(report.PasteID)
+		if err != nil {
+			return err
+		}
+		if creator == "" {
+			return fmt.Errorf("%w: paste %s has no recorded address", firewall.ErrInvalidBan, report.PasteID)
+		}
+		if _, err := addBan(fw, r, creator, duration, reason); err != nil {
+			return err
+		}
+	}
+
+	_, err := moderatePaste(db, report.PasteID, "delete", reason, netshare.GetClientAddr(r).String())
+	if errors.Is(err, storage.ErrNotFoundID) {
+		return nil
+	}
+	return err
+}
+
+// reportState reads the state filter: open (default), resolved or all
+func reportState(r *http.Request) string {
+	switch state := r.URL.Query().Get("state"); state {
+	case storage.AbuseReportResolved:
+		return state
+	case "all":
+		return ""
+	}
+	return storage.AbuseReportOpen
+}
+
+// UI handlers
+
+// handleServerReports shows the abuse report queue
+func (p *Panel) handleServerReports(w http.ResponseWriter, r *http.Request) {
+	q := p.abuseQueue()
+	if q == nil {
+		p.renderPage(w, "Abuse Reports", `<div class="card">
+    <div class="card-title">Abuse Reports</div>
+    <p>Abuse reports are not enabled.</p>
+</div>`)
+		return
+	}
+
+	var errMsg string
+	if r.Method == http.MethodPost {
+		_, err := p.reportAction(r, q, r.FormValue("id"), r.FormValue("action"), r.FormValue("duration"))
+		if err == nil {
+			target := "/" + p.basePath + "/server/reports"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusSeeOther)
+			return
+		}
+		errMsg = err.Error()
+	}
+
+	state := reportState(r)
+	reports, err := q.List(state)
+	if err != nil {
+		errMsg = err.Error()
+	}
+
+	csrf := p.csrfInput(r)
+	tickets := "Tickets are off; set <code>server.abuse.tickets</code> and <code>server.smtp</code> to email each report."
+	if to := q.TicketAddress(); to != "" {
+		tickets = "Each report is emailed to " + html.EscapeString(to) + " with a snapshot of the paste."
+	}
+
+	var out strings.Builder
+	if errMsg != "" {
+		fmt.Fprintf(&out, `<div class="card notice-error">%s</div>
+`, html.EscapeString(errMsg))
+	}
+	fmt.Fprintf(&out, `<div class="card">
+    <div class="card-title">Abuse Reports</div>
+    <p>%s</p>
+    <p><a href="?state=open">Open</a> | <a href="?state=resolved">Resolved</a> | <a href="?state=all">All</a></p>
+    <table class="table">
+        <thead><tr><th>Reported (UTC)</th><th>Paste</th><th>Reason</th><th>Contact</th><th>IP</th><th>Ticket</th><th>Outcome</th><th></th></tr></thead>
+        <tbody>`, tickets)
+	for _, report := range reports {
+		form := func(action, label string) string {
+			return fmt.Sprintf(`<form method="post">%s<input type="hidden" name="id" value="%s"><input type="hidden" name="action" value="%s"><button class="btn btn-secondary">%s</button></form>`,
+				csrf, report.ID, action, label)
+		}
+		var buttons, outcome string
+		if report.State == storage.AbuseReportResolved {
+			buttons = form("reopen", "Reopen")
+			outcome = report.Resolution
+			if outcome == storage.AbuseResolutionNone {
+				outcome = "resolved"
+			}
+		} else {
+			buttons = form("dismiss", "Dismiss") + form("delete", "Delete paste") +
+				fmt.Sprintf(`<form method="post">%s<input type="hidden" name="id" value="%s"><input type="hidden" name="action" value="ban"><input type="text" name="duration" value="1d" placeholder="e.g. 7d; empty = no end"><button class="btn btn-secondary">Ban creator and delete</button></form>`,
+					csrf, report.ID)
+			outcome = "open"
+		}
+		if q.TicketAddress() != "" {
+			buttons += form("ticket", "Send ticket")
+		}
+		ticket := report.Ticket
+		if ticket == "" {
+			ticket = "none"
+		}
+		fmt.Fprintf(&out, `
+            <tr><td>%s</td><td><a href="/%s">%s</a></td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>`,
+			time.Unix(report.CreatedAt, 0).UTC().Format(time.RFC3339), report.PasteID, report.PasteID,
+			html.EscapeString(report.Reason), html.EscapeString(report.Email), html.EscapeString(report.IP), ticket, outcome, buttons)
+	}
+	out.WriteString(`
+        </tbody>
+    </table>
+</div>`)
+
+	p.renderPage(w, "Abuse Reports", out.String())
+}
+
+// API handlers
+
+// apiServerReports handles
+//
+//	GET  /server/reports?state=open|resolved|all  - list reports (default: open)
+//	GET  /server/reports/{id}                     - one report
+//	POST /server/reports/{id}/dismiss             - close a report, nothing to act on
+//	POST /server/reports/{id}/delete              - delete the paste and close the report
+//	POST /server/reports/{id}/ban                 - ban the paste's creator {"duration"}, delete the paste and close the report
+//	POST /server/reports/{id}/resolve             - close a report, having acted elsewhere
+//	POST /server/reports/{id}/reopen              - put a report back in the queue
+//	POST /server/reports/{id}/ticket              - email the ticket again
+func (p *Panel) apiServerReports(w http.ResponseWriter, r *http.Request) {
+	q := p.abuseQueue()
+	if q == nil {
+		writeAPIError(w, http.StatusNotFound, "FEATURE_DISABLED", "Abuse reports are not enabled")
+		return
+	}
+
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/server/reports"), "/")
+	id, action, _ := strings.Cut(rest, "/")
+
+	var report storage.AbuseReport
+	var err error
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		reports, err := q.List(reportState(r))
+		if err != nil {
+			writeReportError(w, err)
+			return
+		}
+		writeAPIData(w, reports)
+		return
+	case id != "" && action == "" && r.Method == http.MethodGet:
+		report, err = q.Get(id)
+	case id != "" && action != "" && r.Method == http.MethodPost:
+		var req struct {
+			Duration string `json:"duration"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		report, err = p.reportAction(r, q, id, action, req.Duration)
+	default:
+		writeAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+	if err != nil {
+		writeReportError(w, err)
+		return
+	}
+	writeAPIData(w, report)
+}
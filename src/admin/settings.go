@@ -0,0 +1,430 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/casjay-forks/caspaste/src/audit"
+	"github.com/casjay-forks/caspaste/src/config"
+	"github.com/casjay-forks/caspaste/src/netshare"
+)
+
+// SettingsResult is what saving the settings changed
+type SettingsResult struct {
+	// Keys of the config file that changed
+	Changed []string `json:"changed"`
+	// Keys applied at once
+	Applied []string `json:"applied"`
+	// Keys that take effect after a restart
+	Pending []string `json:"pending"`
+	// Set when the settings were only checked, not saved
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// SettingsService edits the server settings in the config file
+// Saved settings are validated, together with the rest of the config file,
+// written in one step and reloaded; CheckSettings validates without saving
+type SettingsService interface {
+	Settings() (config.Settings, error)
+	SaveSettings(s config.Settings) (SettingsResult, error)
+	CheckSettings(s config.Settings) (SettingsResult, error)
+}
+
+// SetSettingsService enables the settings editor in the admin panel
+func (p *Panel) SetSettingsService(svc SettingsService) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.settings = svc
+}
+
+func (p *Panel) settingsService() SettingsService {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.settings
+}
+
+// writeSettingsError maps settings errors to admin API errors; invalid
+// settings are listed in "fields"
+func writeSettingsError(w http.ResponseWriter, err error) {
+	var invalid config.SettingsError
+	switch {
+	case errors.As(err, &invalid):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ok": false, "error": "INVALID_SETTINGS", "message": err.Error(), "fields": invalid,
+		})
+	case errors.Is(err, config.ErrSettingsReadOnly):
+		writeAPIError(w, http.StatusConflict, "READ_ONLY", err.Error())
+	default:
+		writeAPIError(w, http.StatusInternalServerError, "SERVER_ERROR", "Failed to save settings")
+	}
+}
+
+// saveSettings saves the settings and audits the keys that changed
+func saveSettings(svc SettingsService, s config.Settings, ip string) (SettingsResult, error) {
+	result, err := svc.SaveSettings(s)
+	if err == nil && len(result.Changed) > 0 {
+		audit.ConfigUpdated(result.Changed, ip)
+	}
+	return result, err
+}
+
+// UI handlers
+
+// handleServerSettings edits the title, limits, rate limits and
+// registration mode
+func (p *Panel) handleServerSettings(w http.ResponseWriter, r *http.Request) {
+	svc := p.settingsService()
+	if svc == nil {
+		p.renderPage(w, "Server Settings", `<div class="card">
+    <div class="card-title">General Settings</div>
+    <p>The settings editor is not enabled.</p>
+</div>`)
+		return
+	}
+
+	var out strings.Builder
+	s, err := svc.Settings()
+	fields := map[string]string{}
+	if r.Method == http.MethodPost {
+		var invalid config.SettingsError
+		s, invalid = parseSettingsForm(r)
+		var result SettingsResult
+		if len(invalid) > 0 {
+			err = invalid
+		} else {
+			result, err = saveSettings(svc, s, netshare.GetClientAddr(r).String())
+		}
+		if err == nil {
+			out.WriteString(settingsResultContent(result))
+		}
+	}
+
+	var invalid config.SettingsError
+	if errors.As(err, &invalid) {
+		fields = invalid.Fields()
+		out.WriteString(`<div class="card notice-error">Some settings are invalid; nothing was saved.`)
+		// Settings outside the form are in the config file only
+		formKeys := settingsFormKeys()
+		var others []string
+		for _, f := range invalid {
+			if !formKeys[f.Field] {
+				others = append(others, fmt.Sprintf(`<li><code>%s</code>: %s</li>`, html.EscapeString(f.Field), html.EscapeString(f.Message)))
+			}
+		}
+		if len(others) > 0 {
+			fmt.Fprintf(&out, `
+    <p>Fix these in the config file:</p>
+    <ul>%s</ul>
+`, strings.Join(others, ""))
+		}
+		out.WriteString(`</div>
+`)
+	} else if err != nil {
+		fmt.Fprintf(&out, `<div class="card notice-error">%s</div>
+`, html.EscapeString(err.Error()))
+	}
+
+	// fieldError is the message shown under an invalid field
+	fieldError := func(key string) string {
+		if msg, ok := fields[key]; ok {
+			return fmt.Sprintf(`<small class="field-error">%s</small>`, html.EscapeString(msg))
+		}
+		return ""
+	}
+	csrf := p.csrfInput(r)
+	fmt.Fprintf(&out, `<div class="card">
+    <div class="card-title">General Settings</div>
+    <p>Saved to the config file, then reloaded. Most settings apply at once; the rest are listed after saving as needing a restart.</p>
+    <form method="post" class="stacked">%s
+        <label>Title <input type="text" name="server.title" value="%s" maxlength="%d" required>%s</label>
+        <label>Tagline <input type="text" name="server.tagline" value="%s" maxlength="%d">%s</label>
+        <label>Description <input type="text" name="server.description" value="%s" maxlength="%d">%s</label>
+        <label>Registration %s%s</label>
+        <label>Title max length (0 = no titles, -1 = unlimited) <input type="number" name="limits.title_max_length" value="%d" min="-1">%s</label>
+        <label>Body max length in bytes (-1 = unlimited) <input type="number" name="limits.body_max_length" value="%d" min="-1">%s</label>
+        <label>Max paste lifetime (e.g. 30d, or never) <input type="text" name="limits.max_paste_lifetime" value="%s">%s</label>
+        <table class="table">
+            <thead><tr><th>Rate limit</th><th>Per 5 min</th><th>Per 15 min</th><th>Per hour</th></tr></thead>
+            <tbody>`, csrf,
+		html.EscapeString(s.Title), config.BrandingTitleMaxLength, fieldError("server.title"),
+		html.EscapeString(s.TagLine), config.BrandingTagLineMaxLength, fieldError("server.tagline"),
+		html.EscapeString(s.Description), config.SettingsDescriptionMaxLength, fieldError("server.description"),
+		statusSelect("server.registration", s.Registration,
+			config.RegistrationPublic, "Public: anyone can register",
+			config.RegistrationPrivate, "Private: by invitation only",
+			config.RegistrationDisabled, "Disabled"),
+		fieldError("server.registration"),
+		s.TitleMaxLength, fieldError("limits.title_max_length"),
+		s.BodyMaxLength, fieldError("limits.body_max_length"),
+		html.EscapeString(s.MaxPasteLifetime), fieldError("limits.max_paste_lifetime"))
+	for _, class := range config.RateLimitClasses {
+		key := "limits.rate_limit." + config.RateLimitKey(class)
+		limits := s.RateLimits[class]
+		fmt.Fprintf(&out, `
+                <tr><td>%s</td>
+                    <td><input type="number" name="%s.per_5min" value="%d" min="0">%s</td>
+                    <td><input type="number" name="%s.per_15min" value="%d" min="0">%s</td>
+                    <td><input type="number" name="%s.per_1hour" value="%d" min="0">%s</td></tr>`,
+			class,
+			key, limits.Per5Min, fieldError(key+".per_5min"),
+			key, limits.Per15Min, fieldError(key+".per_15min"),
+			key, limits.Per1Hour, fieldError(key+".per_1hour"))
+	}
+	fmt.Fprintf(&out, `
+            </tbody>
+        </table>
+        <p>Requests per IP in each period; 0 = unlimited. Exemptions and bans are on the <a href="/%s/server/ratelimit">rate limits</a> page.</p>
+        <button type="submit" class="btn btn-primary">Save</button>
+    </form>
+</div>`, p.basePath)
+
+	p.renderPage(w, "Server Settings", out.String())
+}
+
+// settingsResultContent tells what saving changed
+func settingsResultContent(result SettingsResult) string {
+	if len(result.Changed) == 0 {
+		return `<div class="card notice-success">Nothing changed.</div>
+`
+	}
+	var out strings.Builder
+	fmt.Fprintf(&out, `<div class="card notice-success">Saved: %s.</div>
+`, html.EscapeString(strings.Join(result.Changed, ", ")))
+	if len(result.Pending) > 0 {
+		fmt.Fprintf(&out, `<div class="card notice-warning">Take effect after a restart: %s.</div>
+`, html.EscapeString(strings.Join(result.Pending, ", ")))
+	}
+	return out.String()
+}
+
+// settingsJSONKeys are the config file keys of the JSON settings fields,
+// but for rate_limits
+var settingsJSONKeys = map[string]string{
+	"title":              "server.title",
+	"tagline":            "server.tagline",
+	"description":        "server.description",
+	"registration":       "server.registration",
+	"title_max_length":   "limits.title_max_length",
+	"body_max_length":    "limits.body_max_length",
+	"max_paste_lifetime": "limits.max_paste_lifetime",
+}
+
+// settingsFormKeys returns the keys of the fields of the settings form
+func settingsFormKeys() map[string]bool {
+	keys := make(map[string]bool, len(settingsJSONKeys)+3*len(config.RateLimitClasses))
+	for _, key := range settingsJSONKeys {
+		keys[key] = true
+	}
+	for _, class := range config.RateLimitClasses {
+		for _, name := range []string{"per_5min", "per_15min", "per_1hour"} {
+			keys["limits.rate_limit."+config.RateLimitKey(class)+"."+name] = true
+		}
+	}
+	return keys
+}
+
+// patchSettings sets the fields of s present in the JSON object body;
+// rate limit windows left out of a class are kept
+func patchSettings(s *config.Settings, body io.Reader) error {
+	var fields map[string]json.RawMessage
+	if err := json.NewDecoder(body).Decode(&fields); err != nil {
+		return err
+	}
+
+	var invalid config.SettingsError
+	for name, raw := range fields {
+		if name == "rate_limits" {
+			invalid = append(invalid, patchRateLimits(s, raw)...)
+			continue
+		}
+		key, ok := settingsJSONKeys[name]
+		if !ok {
+			invalid = append(invalid, config.FieldError{Field: name, Message: "unknown setting"})
+			continue
+		}
+		one, _ := json.Marshal(map[string]json.RawMessage{name: raw})
+		if err := json.Unmarshal(one, s); err != nil {
+			invalid = append(invalid, config.FieldError{Field: key, Message: jsonTypeMessage(err)})
+		}
+	}
+	if len(invalid) > 0 {
+		sort.Slice(invalid, func(i, j int) bool { return invalid[i].Field < invalid[j].Field })
+		return invalid
+	}
+	return nil
+}
+
+// patchRateLimits sets the rate limit windows present in raw
+func patchRateLimits(s *config.Settings, raw json.RawMessage) config.SettingsError {
+	var classes map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &classes); err != nil {
+		return config.SettingsError{{Field: "limits.rate_limit", Message: jsonTypeMessage(err)}}
+	}
+	var invalid config.SettingsError
+	for class, raw := range classes {
+		key := config.RateLimitKey(class)
+		if key == "" {
+			invalid = append(invalid, config.FieldError{
+				Field:   "limits.rate_limit." + class,
+				Message: "unknown route class; use " + strings.Join(config.RateLimitClasses, ", "),
+			})
+			continue
+		}
+		limits := s.RateLimits[class]
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&limits); err != nil {
+			field := "limits.rate_limit." + key
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &typeErr) && typeErr.Field != "" {
+				field += "." + typeErr.Field
+			}
+			invalid = append(invalid, config.FieldError{Field: field, Message: jsonTypeMessage(err)})
+			continue
+		}
+		if s.RateLimits == nil {
+			s.RateLimits = map[string]config.RateLimitWindows{}
+		}
+		s.RateLimits[class] = limits
+	}
+	return invalid
+}
+
+// jsonTypeMessage describes a JSON decoding error of one setting
+func jsonTypeMessage(err error) string {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		switch typeErr.Type.Kind() {
+		case reflect.Int:
+			return "must be a number"
+		case reflect.Uint:
+			return "must be a number, 0 or more"
+		case reflect.String:
+			return "must be a string"
+		}
+		return "has the wrong type"
+	}
+	return strings.TrimPrefix(err.Error(), "json: ")
+}
+
+// parseSettingsForm reads the settings form, whose fields are named by
+// their keys in the config file
+func parseSettingsForm(r *http.Request) (config.Settings, config.SettingsError) {
+	var invalid config.SettingsError
+	number := func(key string) int {
+		n, err := strconv.Atoi(strings.TrimSpace(r.FormValue(key)))
+		if err != nil {
+			invalid = append(invalid, config.FieldError{Field: key, Message: "must be a number"})
+		}
+		return n
+	}
+	s := config.Settings{
+		Title:            strings.TrimSpace(r.FormValue("server.title")),
+		TagLine:          strings.TrimSpace(r.FormValue("server.tagline")),
+		Description:      strings.TrimSpace(r.FormValue("server.description")),
+		Registration:     r.FormValue("server.registration"),
+		TitleMaxLength:   number("limits.title_max_length"),
+		BodyMaxLength:    number("limits.body_max_length"),
+		MaxPasteLifetime: strings.TrimSpace(r.FormValue("limits.max_paste_lifetime")),
+		RateLimits:       map[string]config.RateLimitWindows{},
+	}
+	for _, class := range config.RateLimitClasses {
+		key := "limits.rate_limit." + config.RateLimitKey(class)
+		var limits config.RateLimitWindows
+		for name, field := range map[string]*uint{
+			"per_5min":  &limits.Per5Min,
+			"per_15min": &limits.Per15Min,
+			"per_1hour": &limits.Per1Hour,
+		} {
+			n, err := strconv.ParseUint(strings.TrimSpace(r.FormValue(key+"."+name)), 10, 32)
+			if err != nil {
+				invalid = append(invalid, config.FieldError{Field: key + "." + name, Message: "must be a number, 0 or more"})
+			}
+			*field = uint(n)
+		}
+		s.RateLimits[class] = limits
+	}
+	return s, invalid
+}
+
+// API handlers
+
+// apiServerSettings handles
+//
+//	GET   /server/settings                - the settings, as saved in the config file
+//	PUT   /server/settings                - replace them; rate limit classes left out are kept
+//	PATCH /server/settings                - change the settings present in the body
+//	PATCH /server/settings?dry_run=true   - only validate the change
+func (p *Panel) apiServerSettings(w http.ResponseWriter, r *http.Request) {
+	svc := p.settingsService()
+	if svc == nil {
+		writeAPIError(w, http.StatusNotFound, "FEATURE_DISABLED", "The settings editor is not enabled")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s, err := svc.Settings()
+		if err != nil {
+			writeSettingsError(w, err)
+			return
+		}
+		writeAPIData(w, s)
+	case http.MethodPut:
+		var s config.Settings
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid JSON body")
+			return
+		}
+		result, err := saveSettings(svc, s, netshare.GetClientAddr(r).String())
+		if err != nil {
+			writeSettingsError(w, err)
+			return
+		}
+		writeAPIData(w, result)
+	case http.MethodPatch:
+		s, err := svc.Settings()
+		if err != nil {
+			writeSettingsError(w, err)
+			return
+		}
+		var invalid config.SettingsError
+		if err := patchSettings(&s, r.Body); errors.As(err, &invalid) {
+			writeSettingsError(w, err)
+			return
+		} else if err != nil {
+			writeAPIError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid JSON body")
+			return
+		}
+
+		var result SettingsResult
+		if dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run")); dryRun {
+			result, err = svc.CheckSettings(s)
+		} else {
+			result, err = saveSettings(svc, s, netshare.GetClientAddr(r).String())
+		}
+		if err != nil {
+			writeSettingsError(w, err)
+			return
+		}
+		writeAPIData(w, result)
+	default:
+		writeAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+	}
+}
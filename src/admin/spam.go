@@ -0,0 +1,182 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/casjay-forks/caspaste/src/spam"
+	"github.com/casjay-forks/caspaste/src/storage"
+)
+
+// Pastes the spam filter holds are frozen by storage.HeldBy; they are
+// reviewed in the paste list, where unfreezing publishes them
+
+// SetSpamFilter sets the filter the spam page shows and tests
+func (p *Panel) SetSpamFilter(filter *spam.Filter) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.spam = filter
+}
+
+func (p *Panel) spamFilter() *spam.Filter {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.spam
+}
+
+// spamTest is a paste to run the rules on without storing it
+type spamTest struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+// UI handlers
+
+// handleServerSecuritySpam shows the rules and counters, and tests the
+// rules on a title and body
+func (p *Panel) handleServerSecuritySpam(w http.ResponseWriter, r *http.Request) {
+	filter := p.spamFilter()
+	if filter == nil {
+		p.renderPage(w, "Spam Filter", `<div class="card">
+    <div class="card-title">Spam Filter</div>
+    <p>The spam filter is not available.</p>
+</div>`)
+		return
+	}
+	cfg, stats := filter.Config(), filter.Stats()
+
+	var out strings.Builder
+	status := "Off (<code>security.spam.enabled</code>): pastes are published unscanned"
+	if cfg.Enabled {
+		status = "On: matching pastes are held for review"
+	}
+	dumps := "Off"
+	if cfg.CredentialDumps.Enabled {
+		dumps = fmt.Sprintf("%d or more credential lines, at least half the paste; lone tokens from %d characters and %.1f bits per character",
+			cfg.CredentialDumps.MinLines, cfg.CredentialDumps.MinLength, cfg.CredentialDumps.Entropy)
+	}
+	safeBrowsing := "Off (no <code>security.spam.safe_browsing.api_key</code>)"
+	if filter.SafeBrowsingEnabled() {
+		safeBrowsing = "Links are looked up at " + html.EscapeString(cfg.SafeBrowsing.APIURL)
+	} else if cfg.SafeBrowsing.APIKey != "" {
+		safeBrowsing = "Off (offline)"
+	}
+	fmt.Fprintf(&out, `<div class="card">
+    <div class="card-title">Spam Filter</div>
+    <table class="table">
+        <tr><th>Status</th><td>%s</td></tr>
+        <tr><th>Keywords</th><td>%d</td></tr>
+        <tr><th>Patterns</th><td>%d</td></tr>
+        <tr><th>Credential dumps</th><td>%s</td></tr>
+        <tr><th>Safe Browsing</th><td>%s</td></tr>
+    </table>
+    <p>Held pastes are frozen by <code>%s</code>: <a href="/%s/server/pastes?status=frozen">review them</a>, then unfreeze to publish or delete.</p>
+</div>`, status, len(cfg.Keywords), len(cfg.Patterns), dumps, safeBrowsing, storage.HeldBy, p.basePath)
+
+	fmt.Fprintf(&out, `
+<div class="card">
+    <div class="card-title">Since the server started</div>
+    <table class="table">
+        <tr><th>Scanned</th><td>%d</td></tr>
+        <tr><th>Held</th><td>%d</td></tr>`, stats.Scanned, stats.Held)
+	rules := make([]string, 0, len(stats.ByRule))
+	for rule := range stats.ByRule {
+		rules = append(rules, rule)
+	}
+	sort.Strings(rules)
+	for _, rule := range rules {
+		fmt.Fprintf(&out, `
+        <tr><th>Held by %s</th><td>%d</td></tr>`, html.EscapeString(rule), stats.ByRule[rule])
+	}
+	fmt.Fprintf(&out, `
+        <tr><th>Failed Safe Browsing lookups</th><td>%d</td></tr>
+    </table>
+</div>`, stats.LookupErrors)
+
+	test := spamTest{Title: r.FormValue("title"), Body: r.FormValue("body")}
+	fmt.Fprintf(&out, `
+<div class="card">
+    <div class="card-title">Test</div>
+    <p>Run the rules on a paste without storing it.</p>
+    <form method="post">%s
+        <div class="form-group"><label>Title</label><input type="text" name="title" value="%s"></div>
+        <div class="form-group"><label>Body</label><textarea name="body" rows="8">%s</textarea></div>
+        <button class="btn btn-primary">Test</button>
+    </form>`, p.csrfInput(r), html.EscapeString(test.Title), html.EscapeString(test.Body))
+	if r.Method == http.MethodPost {
+		matches := filter.Scan(r.Context(), test.Title, test.Body, nil)
+		if len(matches) == 0 {
+			out.WriteString(`
+    <p>No rule matches; this paste would be published.</p>`)
+		} else {
+			out.WriteString(`
+    <p>This paste would be held for review:</p>
+    <ul>`)
+			for _, m := range matches {
+				fmt.Fprintf(&out, `
+        <li>%s</li>`, html.EscapeString(m.String()))
+			}
+			out.WriteString(`
+    </ul>`)
+		}
+	}
+	out.WriteString(`
+</div>`)
+
+	p.renderPage(w, "Spam Filter", out.String())
+}
+
+// API handlers
+
+// apiServerSecuritySpam handles
+//
+//	GET  /server/security/spam       - status, rule counts and counters
+//	POST /server/security/spam/test  - the matches of {"title", "body"}
+func (p *Panel) apiServerSecuritySpam(w http.ResponseWriter, r *http.Request) {
+	filter := p.spamFilter()
+	if filter == nil {
+		writeAPIError(w, http.StatusServiceUnavailable, "UNAVAILABLE", "Spam filter is not available")
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/server/security/spam" && r.Method == http.MethodGet:
+		cfg := filter.Config()
+		writeAPIData(w, map[string]interface{}{
+			"enabled":          cfg.Enabled,
+			"keywords":         len(cfg.Keywords),
+			"patterns":         len(cfg.Patterns),
+			"credential_dumps": cfg.CredentialDumps.Enabled,
+			"safe_browsing":    filter.SafeBrowsingEnabled(),
+			"held_by":          storage.HeldBy,
+			"stats":            filter.Stats(),
+		})
+	case r.URL.Path == "/server/security/spam/test" && r.Method == http.MethodPost:
+		var test spamTest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&test); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid JSON body")
+			return
+		}
+		matches := filter.Scan(r.Context(), test.Title, test.Body, nil)
+		if matches == nil {
+			matches = []spam.Match{}
+		}
+		writeAPIData(w, map[string]interface{}{
+			"held":    len(matches) > 0,
+			"matches": matches,
+		})
+	case r.URL.Path == "/server/security/spam" || r.URL.Path == "/server/security/spam/test":
+		writeAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+	default:
+		writeAPIError(w, http.StatusNotFound, "NOT_FOUND", "Not found")
+	}
+}
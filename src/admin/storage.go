@@ -0,0 +1,203 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/storage"
+)
+
+// pasteStorage is the paste size distribution and the body storage decisions
+type pasteStorage struct {
+	Sizes  []storage.PasteSizeBucket `json:"sizes"`
+	Policy *storage.BodyPolicyStats  `json:"policy,omitempty"`
+	Cache  *storage.PasteCacheStats  `json:"cache,omitempty"`
+	// The circuit breaker, when on
+	Breaker *storage.BreakerStats `json:"breaker,omitempty"`
+}
+
+// pasteStorageStats returns the paste storage figures, or nil without a paste store
+func (p *Panel) pasteStorageStats(ctx context.Context) (*pasteStorage, error) {
+	db := p.pasteStore(ctx)
+	if db == nil {
+		return nil, nil
+	}
+	// While the database is down the sizes are unknown, but the breaker and
+	// cache figures are what is worth seeing
+	sizes, err := db.PasteSizes()
+	if err != nil && !errors.Is(err, storage.ErrUnavailable) {
+		return nil, err
+	}
+	stats := &pasteStorage{Sizes: sizes}
+	if breaker := db.Breaker(); breaker != nil {
+		b := breaker.Stats()
+		stats.Breaker = &b
+	}
+	if policy := db.BodyPolicy(); policy != nil {
+		s := policy.Stats()
+		stats.Policy = &s
+	}
+	if cache := db.PasteCache(); cache != nil {
+		c := cache.Stats()
+		stats.Cache = &c
+	}
+	return stats, nil
+}
+
+// pasteStorageContent renders the Paste Storage card of the metrics page
+func (p *Panel) pasteStorageContent(ctx context.Context) string {
+	stats, err := p.pasteStorageStats(ctx)
+	if err != nil {
+		return fmt.Sprintf(`<div class="card notice-error">%s</div>
+`, html.EscapeString(err.Error()))
+	}
+	if stats == nil {
+		return ""
+	}
+
+	var out strings.Builder
+	if b := stats.Breaker; b != nil {
+		state := "Available"
+		if b.State == storage.CircuitOpen {
+			state = "Unavailable: cached pastes are served read-only, everything else fails with 503"
+		}
+		lastCheck := "never"
+		if b.LastCheck != 0 {
+			lastCheck = time.Unix(b.LastCheck, 0).UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(&out, `<div class="card">
+    <div class="card-title">Database</div>
+    <p>The database is checked every %s. Set in <code>database.breaker</code>.</p>
+    <table class="table">
+        <tbody>
+            <tr><td>State</td><td>%s, since %s</td></tr>
+            <tr><td>Last check</td><td>%s</td></tr>
+            <tr><td>Failed checks in a row</td><td>%d</td></tr>
+            <tr><td>Last error</td><td>%s</td></tr>
+            <tr><td>Times unavailable</td><td>%d</td></tr>
+            <tr><td>Queries refused</td><td>%d</td></tr>
+        </tbody>
+    </table>
+    <p>Counts are since the server started.</p>
+</div>
+`, b.Interval, state, time.Unix(b.Since, 0).UTC().Format(time.RFC3339), lastCheck,
+			b.Failures, html.EscapeString(b.LastError), b.Opened, b.Rejected)
+	}
+	out.WriteString(`<div class="card">
+    <div class="card-title">Paste Storage</div>
+    <p>Live pastes by size, as stored: inline in the database, compressed in the database (zstd or gzip), or in the blob store.</p>
+    <table class="table">
+        <thead><tr><th>Size</th><th>Inline</th><th>Compressed</th><th>Blob</th><th>Total size</th></tr></thead>
+        <tbody>`)
+	for _, b := range stats.Sizes {
+		fmt.Fprintf(&out, `
+            <tr><td>%s</td><td>%d</td><td>%d</td><td>%d</td><td>%s</td></tr>`,
+			b.Range, b.Inline, b.Zstd+b.Gzip, b.Blob, sizeString(b.Bytes))
+	}
+	out.WriteString(`
+        </tbody>
+    </table>
+</div>`)
+
+	if c := stats.Cache; c != nil {
+		tier := "none"
+		if c.Tier {
+			tier = "shared"
+		}
+		fmt.Fprintf(&out, `
+<div class="card">
+    <div class="card-title">Paste Cache</div>
+    <p>Recently fetched pastes are served from memory. Set in <code>database.cache</code>.</p>
+    <table class="table">
+        <tbody>
+            <tr><td>Hit rate</td><td>%.1f%% (%d hits, %d misses)</td></tr>
+            <tr><td>Cached</td><td>%d of %d pastes, %s of %s</td></tr>
+            <tr><td>Evictions</td><td>%d</td></tr>
+            <tr><td>Largest cached paste</td><td>%s</td></tr>
+            <tr><td>TTL</td><td>%s</td></tr>
+            <tr><td>Second tier</td><td>%s</td></tr>
+        </tbody>
+    </table>
+    <p>Counts are since the server started.</p>
+</div>`, c.HitRate, c.Hits, c.Misses, c.Items, c.Config.MaxItems, sizeString(c.Bytes), sizeString(c.Config.MaxBytes),
+			c.Evictions, sizeString(int64(c.Config.MaxPasteSize)), c.TTL, tier)
+	}
+
+	if stats.Policy == nil {
+		return out.String()
+	}
+	policy := stats.Policy
+	cfg := policy.Config
+	blobs := "off (no blob store)"
+	if policy.BlobStore {
+		blobs = threshold(cfg.BlobMinSize)
+	}
+	adaptive := "off"
+	if cfg.Adaptive {
+		adaptive = "on"
+	}
+	fmt.Fprintf(&out, `
+<div class="card">
+    <div class="card-title">Storage Decisions</div>
+    <p>Compress from %s when it saves at least %d%%; blob store from %s; adaptive compression %s. Set in <code>database.bodies</code>.</p>
+    <table class="table">
+        <thead><tr><th>Strategy</th><th>Written</th><th>Read</th><th>Size written</th><th>Avg write (ms)</th><th>Avg read (ms)</th></tr></thead>
+        <tbody>`, threshold(cfg.CompressMinSize), cfg.CompressMinSavings, blobs, adaptive)
+	for _, s := range policy.Strategies {
+		fmt.Fprintf(&out, `
+            <tr><td>%s</td><td>%d</td><td>%d</td><td>%s</td><td>%.2f</td><td>%.2f</td></tr>`,
+			s.Strategy, s.Writes, s.Reads, sizeString(s.Bytes), s.AvgWriteMs, s.AvgReadMs)
+	}
+	out.WriteString(`
+        </tbody>
+    </table>
+    <table class="table">
+        <thead><tr><th>Paste kind</th><th>Compressed</th><th>Avg saving</th><th>Compressing</th></tr></thead>
+        <tbody>`)
+	for _, c := range policy.Compression {
+		compressing := "yes"
+		if !c.Compressing {
+			compressing = "no, probing"
+		}
+		fmt.Fprintf(&out, `
+            <tr><td>%s</td><td>%d</td><td>%.1f%%</td><td>%s</td></tr>`,
+			c.Kind, c.Samples, c.Savings, compressing)
+	}
+	out.WriteString(`
+        </tbody>
+    </table>
+    <p>Counts are since the server started.</p>
+</div>`)
+	return out.String()
+}
+
+// threshold shows a size threshold, where 0 turns the strategy off
+func threshold(size int) string {
+	if size <= 0 {
+		return "never"
+	}
+	return sizeString(int64(size))
+}
+
+// sizeString formats a byte count in binary units
+func sizeString(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GiB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
@@ -0,0 +1,89 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/casjay-forks/caspaste/src/storage"
+)
+
+// apiServerTemplates manages paste templates
+//
+//	GET    /server/templates         list templates
+//	POST   /server/templates         create or replace a template
+//	GET    /server/templates/{name}  get a template
+//	PUT    /server/templates/{name}  create or replace a template
+//	DELETE /server/templates/{name}  delete a template
+func (p *Panel) apiServerTemplates(w http.ResponseWriter, r *http.Request) {
+	db := p.pasteStore(r.Context())
+	if db == nil {
+		writeAPIError(w, http.StatusNotFound, "FEATURE_DISABLED", "Paste management is not enabled")
+		return
+	}
+
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/server/templates"), "/")
+
+	switch {
+	case name == "" && r.Method == http.MethodGet:
+		templates, err := db.TemplateList()
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, "SERVER_ERROR", "Failed to list templates")
+			return
+		}
+		writeAPIData(w, templates)
+
+	case name != "" && r.Method == http.MethodGet:
+		tmpl, err := db.TemplateGet(name)
+		if err != nil {
+			writeTemplateError(w, err)
+			return
+		}
+		writeAPIData(w, tmpl)
+
+	case (name == "" && r.Method == http.MethodPost) || (name != "" && r.Method == http.MethodPut):
+		var tmpl storage.PasteTemplate
+		if err := json.NewDecoder(r.Body).Decode(&tmpl); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid JSON body")
+			return
+		}
+		if name != "" {
+			tmpl.Name = name
+		}
+		if err := db.TemplateSave(tmpl); err != nil {
+			writeTemplateError(w, err)
+			return
+		}
+		tmpl, _ = db.TemplateGet(tmpl.Name)
+		writeAPIData(w, tmpl)
+
+	case name != "" && r.Method == http.MethodDelete:
+		if err := db.TemplateDelete(name); err != nil {
+			writeTemplateError(w, err)
+			return
+		}
+		writeAPIData(w, map[string]interface{}{"deleted": name})
+
+	default:
+		writeAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+	}
+}
+
+// writeTemplateError maps storage errors to admin API errors
+func writeTemplateError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, storage.ErrTemplateNotFound):
+		writeAPIError(w, http.StatusNotFound, "TEMPLATE_NOT_FOUND", "Template not found")
+	case errors.Is(err, storage.ErrTemplateName):
+		writeAPIError(w, http.StatusBadRequest, "INVALID_NAME", err.Error())
+	default:
+		writeAPIError(w, http.StatusInternalServerError, "SERVER_ERROR", err.Error())
+	}
+}
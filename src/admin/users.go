@@ -0,0 +1,152 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package admin
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/user"
+)
+
+// userQueryFromParams turns the list parameters into a user query
+func userQueryFromParams(l listParams) user.Query {
+	q := user.Query{
+		Search: l.Search,
+		Role:   l.Role,
+		Status: l.Status,
+		Sort:   l.Sort,
+		Desc:   l.Desc,
+		Limit:  l.PerPage,
+		Offset: l.offset(),
+	}
+	if !l.From.IsZero() {
+		q.From = l.From.Unix()
+	}
+	if !l.To.IsZero() {
+		q.To = l.To.Unix()
+	}
+	return q
+}
+
+// userStatus describes an account for the user list
+func userStatus(u user.User) string {
+	var flags []string
+	if u.LockedUntil > time.Now().Unix() {
+		flags = append(flags, "locked")
+	}
+	if !u.EmailVerified {
+		flags = append(flags, "unverified")
+	}
+	if u.TOTPEnabled {
+		flags = append(flags, "2FA")
+	}
+	if len(flags) == 0 {
+		return "active"
+	}
+	return strings.Join(flags, ", ")
+}
+
+// apiServerUsers lists the user accounts
+//
+//	GET /server/users   ?q=, ?role=, ?status=, ?from=, ?to=, ?sort=, ?order=, ?page=, ?per_page=
+func (p *Panel) apiServerUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+	db := p.pasteStore(r.Context())
+	if db == nil {
+		writeAPIError(w, http.StatusNotFound, "FEATURE_DISABLED", "User management is not enabled")
+		return
+	}
+
+	l, err := parseListParams(r.URL.Query())
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+	users, total, err := db.Users().Search(r.Context(), userQueryFromParams(l))
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "SERVER_ERROR", "Failed to list users")
+		return
+	}
+	writeAPIData(w, l.data("users", users, total))
+}
+
+// handleServerUsers lists the user accounts, with search and filters
+func (p *Panel) handleServerUsers(w http.ResponseWriter, r *http.Request) {
+	db := p.pasteStore(r.Context())
+	if db == nil {
+		p.renderPage(w, "User Management", `<div class="card">
+    <div class="card-title">User Management</div>
+    <p>User management is not enabled.</p>
+</div>`)
+		return
+	}
+
+	query := r.URL.Query()
+	l, err := parseListParams(query)
+	var users []user.User
+	var total int
+	if err == nil {
+		users, total, err = db.Users().Search(r.Context(), userQueryFromParams(l))
+	}
+
+	var out strings.Builder
+	if err != nil {
+		fmt.Fprintf(&out, `<div class="card notice-error">%s</div>
+`, html.EscapeString(err.Error()))
+	}
+	fmt.Fprintf(&out, `<div class="card">
+    <div class="card-title">User Management</div>
+    <form method="get">
+        <input type="text" name="q" value="%s" placeholder="Username, email or name">
+        %s
+        %s
+        %s
+        %s
+        <button type="submit" class="btn btn-secondary">Search</button>
+    </form>
+    %s
+    <table class="table">
+        <thead><tr>%s%s<th>Name</th><th>Role</th><th>Status</th>%s%s</tr></thead>
+        <tbody>`, html.EscapeString(l.Search),
+		statusSelect("role", l.Role,
+			"", "All roles",
+			user.RoleAdmin, "Admin",
+			user.RoleUser, "User"),
+		statusSelect("status", l.Status,
+			"", "All users",
+			user.StatusActive, "Active",
+			user.StatusLocked, "Locked",
+			user.StatusUnverified, "Unverified email",
+			user.StatusMFA, "2FA enabled"),
+		dateInputs(query), sortInputs(query), l.pager(query, total),
+		l.sortHeader(query, "username", "Username"), l.sortHeader(query, "email", "Email"),
+		l.sortHeader(query, "created", "Created (UTC)"), l.sortHeader(query, "last_login", "Last Login (UTC)"))
+	for _, u := range users {
+		lastLogin := "never"
+		if u.LastLogin != 0 {
+			lastLogin = time.Unix(u.LastLogin, 0).UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(&out, `
+            <tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>`,
+			html.EscapeString(u.Username), html.EscapeString(u.Email), html.EscapeString(u.DisplayName),
+			html.EscapeString(u.Role), userStatus(u),
+			time.Unix(u.CreatedAt, 0).UTC().Format(time.RFC3339), lastLogin)
+	}
+	fmt.Fprintf(&out, `
+        </tbody>
+    </table>
+    %s
+</div>`, l.pager(query, total))
+
+	p.renderPage(w, "User Management", out.String())
+}
@@ -8,16 +8,23 @@ package apiv1
 
 import (
 	"net/http"
+	"strings"
 	"time"
 
 	chromaLexers "github.com/alecthomas/chroma/v2/lexers"
 
+	"github.com/casjay-forks/caspaste/src/abuse"
 	"github.com/casjay-forks/caspaste/src/caspasswd"
 	"github.com/casjay-forks/caspaste/src/config"
+	"github.com/casjay-forks/caspaste/src/content"
+	"github.com/casjay-forks/caspaste/src/directory"
 	"github.com/casjay-forks/caspaste/src/httputil"
 	"github.com/casjay-forks/caspaste/src/logger"
 	"github.com/casjay-forks/caspaste/src/netshare"
+	"github.com/casjay-forks/caspaste/src/oauth"
+	"github.com/casjay-forks/caspaste/src/redact"
 	"github.com/casjay-forks/caspaste/src/storage"
+	"github.com/casjay-forks/caspaste/src/token"
 )
 
 type Data struct {
@@ -34,10 +41,26 @@ type Data struct {
 	TitleMaxLen int
 	BodyMaxLen  int
 	MaxLifeTime int64
+	// Largest streamed upload in bytes; 0 = streaming uploads off
+	StreamMaxSize int64
 
-	ServerAbout      string
-	ServerRules      string
-	ServerTermsOfUse string
+	Redaction *redact.Policy
+
+	Content *content.Set
+
+	// Abuse report queue; nil = reports are not taken
+	Abuse *abuse.Queue
+
+	// API tokens; tokens with the status:read scope can read the server
+	// stats on private instances. nil = Basic auth only
+	Tokens *token.Service
+
+	// OAuth provider; oat_ access tokens open private instances and gists
+	// with the pastes scopes. nil = OAuth tokens are not accepted
+	OAuth *oauth.Service
+
+	// Instance directory listed at /server/peers; nil = none configured
+	Directory *directory.Service
 
 	AdminName string
 	AdminMail string
@@ -53,9 +76,10 @@ type Data struct {
 func Load(db storage.DB, cfg config.Config) *Data {
 	lexers := chromaLexers.Names(false)
 
-	// Initialize brute force protection if authentication is required (server.public=false)
+	// Initialize brute force protection whenever Basic auth is checked: for every
+	// request when server.public=false, and for user drafts on public servers
 	var bruteForce *caspasswd.BruteForceProtection
-	if !cfg.Public && cfg.CasPasswdFile != "" {
+	if cfg.CasPasswdFile != "" {
 		// 5 failed attempts = 15 minute lockout
 		bruteForce = caspasswd.NewBruteForceProtection(5, 15*time.Minute)
 	}
@@ -69,10 +93,10 @@ func Load(db storage.DB, cfg config.Config) *Data {
 		Version:           cfg.Version,
 		TitleMaxLen:       cfg.TitleMaxLen,
 		BodyMaxLen:        cfg.BodyMaxLen,
+		StreamMaxSize:     cfg.StreamMaxSize,
 		MaxLifeTime:       cfg.MaxLifeTime,
-		ServerAbout:       cfg.ServerAbout,
-		ServerRules:       cfg.ServerRules,
-		ServerTermsOfUse:  cfg.ServerTermsOfUse,
+		Redaction:         cfg.Redaction,
+		Content:           cfg.Content,
 		AdminName:         cfg.AdminName,
 		AdminMail:         cfg.AdminMail,
 		Public:            cfg.Public,
@@ -82,11 +106,19 @@ func Load(db storage.DB, cfg config.Config) *Data {
 	}
 }
 
+// db binds the storage to a request, so its queries stop when the client goes
+// away and the pastes it creates record the client's address
+func (data *Data) db(req *http.Request) storage.DB {
+	return data.DB.WithContext(req.Context()).WithClientIP(netshare.GetClientAddr(req))
+}
+
 func (data *Data) Hand(rw http.ResponseWriter, req *http.Request) {
 	// Process request
 	var err error
 
 	rw.Header().Set("Server", config.Software+"/"+data.Version)
+	setVersionHeaders(rw)
+	recordClientVersion(req)
 
 	// Build API paths dynamically per AI.md PART 14
 	apiBase := config.APIBasePath()
@@ -105,8 +137,22 @@ func (data *Data) Hand(rw http.ResponseWriter, req *http.Request) {
 	case apiBase + "/pastes":
 		// Route by method: POST=create, GET=list or get single
 		err = data.handlePastes(rw, req)
+	case apiBase + "/pastes/validate":
+		err = data.validatePaste(rw, req)
+	case apiBase + "/pastes/stream":
+		err = data.handleStream(rw, req)
 	case apiBase + "/server/info":
 		err = data.handleServerInfo(rw, req)
+	case apiBase + "/server/info/stats":
+		err = data.handleServerStats(rw, req)
+	case apiBase + "/server/peers":
+		err = data.handleServerPeers(rw, req)
+	case apiBase + "/templates":
+		err = data.handleTemplates(rw, req)
+	case apiBase + "/users/drafts":
+		err = data.handleDrafts(rw, req)
+	case apiBase + "/users/pgp-keys":
+		err = data.handlePGPKeys(rw, req)
 
 	// External API Compatibility endpoints per AI.md "External API Compatibility"
 	// pastebin.com compatibility
@@ -129,9 +175,44 @@ func (data *Data) Hand(rw http.ResponseWriter, req *http.Request) {
 		err = data.handleCompat(rw, req)
 	case "/compat", "/paste":
 		err = data.handleCompat(rw, req)
+	case "/documents":
+		err = data.handleCompat(rw, req)
+	case "/":
+		err = data.handleCompat(rw, req)
 
 	default:
-		err = netshare.ErrNotFound
+		// Paste sub-resources: /api/v1/pastes/{id} and /api/v1/pastes/{id}/{action}
+		if id, action, ok := pasteActionPath(routePath, apiBase); ok && action == "format" {
+			err = data.handleFormat(rw, req, id)
+		} else if ok && action == "report" {
+			err = data.handleReport(rw, req, id)
+		} else if ok && action == "fork" {
+			err = data.handleFork(rw, req, id)
+		} else if ok && action == "share" {
+			err = data.handleShare(rw, req, id)
+		} else if ok && action == "verify" {
+			err = data.handleVerify(rw, req, id)
+		} else if ok && action == "signature" {
+			err = data.handleSignature(rw, req, id)
+		} else if ok && action == "series" {
+			err = data.handleSeries(rw, req, id, true)
+		} else if id, ok := seriesPath(routePath, apiBase); ok {
+			err = data.handleSeries(rw, req, id, false)
+		} else if id, ok := pastePath(routePath, apiBase); ok {
+			err = data.handlePaste(rw, req, id)
+		} else if id, ok := draftPath(routePath, apiBase); ok {
+			err = data.handleDraft(rw, req, id)
+		} else if fingerprint, ok := pgpKeyPath(routePath, apiBase); ok {
+			err = data.handlePGPKey(rw, req, fingerprint)
+		} else if editor, ok := editorPath(routePath, apiBase); ok {
+			err = data.handleEditor(rw, req, editor)
+		} else if strings.HasPrefix(routePath, "/documents/") {
+			err = data.handleCompat(rw, req)
+		} else if gistPath, ok := gistRoute(routePath); ok {
+			err = data.handleGists(rw, req, gistPath)
+		} else {
+			err = netshare.ErrNotFound
+		}
 	}
 
 	// Log
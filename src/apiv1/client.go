@@ -0,0 +1,48 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package apiv1
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/casjay-forks/caspaste/src/config"
+	"github.com/casjay-forks/caspaste/src/metric"
+)
+
+// Clients name themselves and the API version they were built for in
+// X-Client-Version, e.g. "caspaste-cli/1.2.0 api/v1"
+const clientVersionHeader = "X-Client-Version"
+
+// setVersionHeaders tells clients which API this is and the oldest
+// caspaste-cli that works with it, so they can warn without asking first
+func setVersionHeaders(rw http.ResponseWriter) {
+	rw.Header().Set("X-API-Version", config.APIVersion())
+	rw.Header().Set("X-Min-Client-Version", config.MinClientVersion)
+}
+
+// recordClientVersion counts the request by client for telemetry
+func recordClientVersion(req *http.Request) {
+	header := req.Header.Get(clientVersionHeader)
+	if header == "" {
+		return
+	}
+
+	var name, version, api string
+	for _, field := range strings.Fields(header) {
+		product, value, ok := strings.Cut(field, "/")
+		if !ok {
+			continue
+		}
+		if product == "api" {
+			api = value
+		} else if name == "" {
+			name, version = product, value
+		}
+	}
+	metric.RecordClient(name, version, api)
+}
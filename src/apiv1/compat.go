@@ -8,6 +8,7 @@ package apiv1
 
 // External API Compatibility - Create endpoints only per AI.md PART 14
 // Supports: termbin, sprunge, ix.io, pastebin.com, stikked, microbin, lenpaste
+// hastebin and PrivateBin are in hastebin.go and privatebin.go, and also read pastes
 //
 // Per AI.md "External API Compatibility":
 // - Match the exact response format of the target service
@@ -27,6 +28,7 @@ import (
 	"github.com/casjay-forks/caspaste/src/httputil"
 	"github.com/casjay-forks/caspaste/src/lineend"
 	"github.com/casjay-forks/caspaste/src/netshare"
+	"github.com/casjay-forks/caspaste/src/redact"
 	"github.com/casjay-forks/caspaste/src/storage"
 )
 
@@ -91,6 +93,18 @@ func (data *Data) handleCompat(rw http.ResponseWriter, req *http.Request) error
 	case path == "/compat" || path == "/paste":
 		return data.handleGenericCompat(rw, req)
 
+	// hastebin compatibility
+	// POST /documents, GET /documents/{key}
+	// Original returns: JSON with key (and data)
+	case path == "/documents" || strings.HasPrefix(path, "/documents/"):
+		return data.handleHastebinCompat(rw, req)
+
+	// PrivateBin compatibility
+	// POST / and GET /?{id} with X-Requested-With: JSONHttpRequest
+	// Original returns: JSON with status
+	case IsPrivateBinRequest(req):
+		return data.handlePrivateBinCompat(rw, req)
+
 	default:
 		return netshare.ErrNotFound
 	}
@@ -156,7 +170,8 @@ func (data *Data) handleSprungeCompat(rw http.ResponseWriter, req *http.Request)
 		Syntax: "plaintext",
 	}
 
-	pasteID, createTime, deleteTime, err := data.DB.PasteAdd(paste)
+	data.redactCompat(req, &paste)
+	pasteID, createTime, deleteTime, err := data.db(req).PasteAdd(paste)
 	if err != nil {
 		return err
 	}
@@ -209,7 +224,8 @@ func (data *Data) handleIxCompat(rw http.ResponseWriter, req *http.Request) erro
 		Syntax: "plaintext",
 	}
 
-	pasteID, createTime, deleteTime, err := data.DB.PasteAdd(paste)
+	data.redactCompat(req, &paste)
+	pasteID, createTime, deleteTime, err := data.db(req).PasteAdd(paste)
 	if err != nil {
 		return err
 	}
@@ -273,7 +289,8 @@ func (data *Data) handlePastebinCompat(rw http.ResponseWriter, req *http.Request
 		}
 	}
 
-	pasteID, createTime, deleteTime, err := data.DB.PasteAdd(paste)
+	data.redactCompat(req, &paste)
+	pasteID, createTime, deleteTime, err := data.db(req).PasteAdd(paste)
 	if err != nil {
 		return err
 	}
@@ -346,7 +363,8 @@ func (data *Data) handleStikkedCompat(rw http.ResponseWriter, req *http.Request)
 		}
 	}
 
-	pasteID, createTime, deleteTime, err := data.DB.PasteAdd(paste)
+	data.redactCompat(req, &paste)
+	pasteID, createTime, deleteTime, err := data.db(req).PasteAdd(paste)
 	if err != nil {
 		return err
 	}
@@ -416,7 +434,8 @@ func (data *Data) handleMicrobinCompat(rw http.ResponseWriter, req *http.Request
 		}
 	}
 
-	pasteID, createTime, deleteTime, err := data.DB.PasteAdd(paste)
+	data.redactCompat(req, &paste)
+	pasteID, createTime, deleteTime, err := data.db(req).PasteAdd(paste)
 	if err != nil {
 		return err
 	}
@@ -510,7 +529,8 @@ func (data *Data) handleLenpasteCompat(rw http.ResponseWriter, req *http.Request
 		}
 	}
 
-	pasteID, createTime, deleteTime, err := data.DB.PasteAdd(paste)
+	data.redactCompat(req, &paste)
+	pasteID, createTime, deleteTime, err := data.db(req).PasteAdd(paste)
 	if err != nil {
 		return err
 	}
@@ -556,7 +576,8 @@ func (data *Data) handleTermbinCompat(rw http.ResponseWriter, req *http.Request)
 		Syntax: "plaintext",
 	}
 
-	pasteID, createTime, deleteTime, err := data.DB.PasteAdd(paste)
+	data.redactCompat(req, &paste)
+	pasteID, createTime, deleteTime, err := data.db(req).PasteAdd(paste)
 	if err != nil {
 		return err
 	}
@@ -668,7 +689,8 @@ func (data *Data) handleGenericCompat(rw http.ResponseWriter, req *http.Request)
 		}
 	}
 
-	pasteID, createTime, deleteTime, err := data.DB.PasteAdd(paste)
+	data.redactCompat(req, &paste)
+	pasteID, createTime, deleteTime, err := data.db(req).PasteAdd(paste)
 	if err != nil {
 		return err
 	}
@@ -689,6 +711,21 @@ func (data *Data) handleGenericCompat(rw http.ResponseWriter, req *http.Request)
 // Helper functions
 
 // normalizeSyntax validates and normalizes syntax to a known lexer
+// redactCompat applies the redaction policy to pastes from compatibility endpoints
+// The redact override is read from the query string or an already parsed form
+func (data *Data) redactCompat(req *http.Request, paste *storage.Paste) {
+	requested := req.URL.Query().Get("redact")
+	if req.PostForm != nil && req.PostForm.Get("redact") != "" {
+		requested = req.PostForm.Get("redact")
+	}
+	if paste.IsFile || !data.Redaction.ShouldRedact(requested) {
+		return
+	}
+	report := &redact.Report{}
+	paste.Title = data.Redaction.Redact(paste.Title, report)
+	paste.Body = data.Redaction.Redact(paste.Body, report)
+}
+
 func normalizeSyntax(syntax string, lexers []string) string {
 	if syntax == "" {
 		return "plaintext"
@@ -0,0 +1,50 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package apiv1
+
+import (
+	"net/http"
+
+	"github.com/casjay-forks/caspaste/src/audit"
+	"github.com/casjay-forks/caspaste/src/netshare"
+	"github.com/casjay-forks/caspaste/src/storage"
+	"github.com/casjay-forks/caspaste/src/token"
+)
+
+// DELETE /api/v1/pastes?id=X - delete a paste
+// Needs Basic auth (caspasswd file) or an API token with the read-write scope;
+// anonymous pastes have no owner, so without either nobody can delete them
+func (data *Data) deletePaste(rw http.ResponseWriter, req *http.Request) error {
+	// Tokens skip Basic auth
+	user := "token"
+	if data.Tokens == nil || !data.Tokens.Authorize(req, token.ScopeReadWrite) {
+		var err error
+		user, err = data.basicAuthUser(rw, req)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Get paste ID (already parsed by handlePastes)
+	pasteID := req.Form.Get("id")
+	if pasteID == "" {
+		return netshare.ErrBadRequest
+	}
+
+	ip := netshare.GetClientAddr(req).String()
+	err := data.db(req).PasteDelete(pasteID)
+	if err == storage.ErrWORM || err == storage.ErrLegalHold {
+		// Record tampering attempts on write-once pastes
+		audit.PasteModifyDenied(pasteID, "delete", ip, rw.Header().Get("X-Request-ID"))
+	}
+	if err != nil {
+		return err
+	}
+	audit.PasteDeleted(pasteID, user, ip, rw.Header().Get("X-Request-ID"))
+
+	return writeSuccess(rw, req, map[string]string{"id": pasteID}, "Paste deleted", "deleted: "+pasteID+"\n")
+}
@@ -0,0 +1,154 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package apiv1
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/casjay-forks/caspaste/src/netshare"
+	"github.com/casjay-forks/caspaste/src/storage"
+	"github.com/casjay-forks/caspaste/src/web"
+)
+
+// draftMaxBytes caps a draft request body before the title and body length checks
+const draftMaxBytes = 32 << 20
+
+// GET /api/v1/users/drafts - list the drafts of the logged-in user
+func (data *Data) handleDrafts(rw http.ResponseWriter, req *http.Request) error {
+	if req.Method != "GET" {
+		return netshare.ErrMethodNotAllowed
+	}
+
+	owner, err := data.draftOwner(rw, req)
+	if err != nil {
+		return err
+	}
+
+	drafts, err := data.db(req).DraftList(owner)
+	if err != nil {
+		return err
+	}
+
+	var textBuilder strings.Builder
+	for _, d := range drafts {
+		fmt.Fprintf(&textBuilder, "%s\t%s\t%s\n", d.ID, time.Unix(d.UpdatedAt, 0).UTC().Format(time.RFC3339), d.Title)
+	}
+
+	msg := fmt.Sprintf("%d drafts found", len(drafts))
+	return writeSuccess(rw, req, drafts, msg, textBuilder.String())
+}
+
+// GET /api/v1/users/drafts/{id} - get one draft
+// PUT /api/v1/users/drafts/{id} - create or replace a draft (title, body, syntax)
+// DELETE /api/v1/users/drafts/{id} - delete a draft
+// Saving uses PUT rather than POST so that browsers always send a CORS preflight,
+// which keeps other sites from writing drafts with the user's session cookie
+func (data *Data) handleDraft(rw http.ResponseWriter, req *http.Request, id string) error {
+	if req.Method != "GET" && req.Method != "PUT" && req.Method != "DELETE" {
+		return netshare.ErrMethodNotAllowed
+	}
+
+	owner, err := data.draftOwner(rw, req)
+	if err != nil {
+		return err
+	}
+
+	if !storage.ValidDraftID(id) {
+		return storage.ErrDraftID
+	}
+
+	switch req.Method {
+	case "PUT":
+		draft, err := data.readDraft(req)
+		if err != nil {
+			return err
+		}
+		draft.ID = id
+
+		draft, err = data.db(req).DraftSave(owner, draft)
+		if err != nil {
+			return err
+		}
+		return writeSuccess(rw, req, draft, "Draft saved", "")
+
+	case "DELETE":
+		if err := data.db(req).DraftDelete(owner, id); err != nil {
+			return err
+		}
+		return writeSuccess(rw, req, nil, "Draft deleted", "")
+
+	default:
+		draft, err := data.db(req).DraftGet(owner, id)
+		if err != nil {
+			return err
+		}
+		// For text format, return the draft body
+		return writeSuccess(rw, req, draft, "Draft retrieved", draft.Body)
+	}
+}
+
+// draftOwner returns the logged-in user: a web login session or Basic auth
+// Drafts are private, so they need a user even on public servers
+func (data *Data) draftOwner(rw http.ResponseWriter, req *http.Request) (string, error) {
+	// Autosave runs every few seconds, so drafts share the read rate limit
+	if err := data.RateLimitGet.CheckAndUse(netshare.GetClientAddr(req)); err != nil {
+		return "", err
+	}
+
+	if user, ok := web.SessionUser(req); ok {
+		return user, nil
+	}
+	return data.basicAuthUser(rw, req)
+}
+
+// readDraft reads a draft from a JSON or form request body
+func (data *Data) readDraft(req *http.Request) (storage.Draft, error) {
+	var draft storage.Draft
+
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if mediaType == "application/json" {
+		if err := json.NewDecoder(http.MaxBytesReader(nil, req.Body, draftMaxBytes)).Decode(&draft); err != nil {
+			return draft, netshare.ErrBadRequest
+		}
+	} else {
+		req.Body = http.MaxBytesReader(nil, req.Body, draftMaxBytes)
+		if err := req.ParseForm(); err != nil {
+			return draft, netshare.ErrBadRequest
+		}
+		draft.Title = req.PostForm.Get("title")
+		draft.Body = req.PostForm.Get("body")
+		draft.Syntax = req.PostForm.Get("syntax")
+	}
+
+	// Drafts follow the limits of the pastes they become
+	if utf8.RuneCountInString(draft.Title) > data.TitleMaxLen && data.TitleMaxLen >= 0 {
+		return draft, netshare.ErrPayloadTooLarge
+	}
+	if utf8.RuneCountInString(draft.Body) > data.BodyMaxLen && data.BodyMaxLen > 0 {
+		return draft, netshare.ErrPayloadTooLarge
+	}
+	if len(draft.Syntax) > 64 {
+		return draft, netshare.ErrBadRequest
+	}
+
+	return draft, nil
+}
+
+// draftPath returns the draft ID of /api/v1/users/drafts/{id}
+func draftPath(path, apiBase string) (string, bool) {
+	id, ok := strings.CutPrefix(path, apiBase+"/users/drafts/")
+	if !ok || id == "" || strings.Contains(id, "/") {
+		return "", false
+	}
+	return id, true
+}
@@ -0,0 +1,336 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package apiv1
+
+// Editor plugin API, see docs/api.md "Editor Plugins"
+// A plugin trades a read-write API token for an editor token once, and keeps
+// only that: it can create pastes, and list and edit the ones its owner made
+// through this API, but nothing else
+// Pastes are sent as forms, with the fields of POST /api/v1/pastes
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/casjay-forks/caspaste/src/audit"
+	"github.com/casjay-forks/caspaste/src/netshare"
+	"github.com/casjay-forks/caspaste/src/storage"
+	"github.com/casjay-forks/caspaste/src/token"
+	"github.com/casjay-forks/caspaste/src/web"
+)
+
+// Longest editor token name, e.g. "VS Code on laptop"
+const maxEditorTokenName = 64
+
+// editorLanguages maps editor language IDs (VS Code's, and Neovim filetypes)
+// that are not lexer names or aliases
+var editorLanguages = map[string]string{
+	"shellscript":     "bash",
+	"javascriptreact": "react",
+	"typescriptreact": "typescript",
+	"jsonc":           "json",
+	"terraform":       "hcl",
+}
+
+var (
+	errEditorTokenCreate = errors.New("Editor tokens are made with a read-write token")
+	errEditorTokenRevoke = errors.New("Only editor tokens can be revoked here")
+)
+
+type editorTokenAnswer struct {
+	Token     string   `json:"token"`
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	ExpiresAt *int64   `json:"expiresAt,omitempty"`
+}
+
+type editorPasteAnswer struct {
+	ID         string `json:"id"`
+	URL        string `json:"url"`
+	RawURL     string `json:"rawUrl"`
+	Title      string `json:"title"`
+	Syntax     string `json:"syntax"`
+	DeleteTime int64  `json:"deleteTime"`
+}
+
+type editorListAnswer struct {
+	Pastes []storage.PasteListItem `json:"pastes"`
+	Limit  int                     `json:"limit"`
+	Offset int                     `json:"offset"`
+}
+
+// editorPath returns what follows /api/v1/editor/ in path
+func editorPath(path, apiBase string) (string, bool) {
+	rest, ok := strings.CutPrefix(path, apiBase+"/editor/")
+	return rest, ok && rest != ""
+}
+
+// handleEditor routes the editor API
+// POST, DELETE /api/v1/editor/token - get an editor token, or revoke it
+// GET, POST /api/v1/editor/pastes - list my pastes, or create one
+// PUT, PATCH /api/v1/editor/pastes/{id} - update one of my pastes
+func (data *Data) handleEditor(rw http.ResponseWriter, req *http.Request, path string) error {
+	if data.Tokens == nil {
+		return netshare.ErrNotFound
+	}
+
+	switch {
+	case path == "token" && req.Method == "POST":
+		return data.editorTokenCreate(rw, req)
+	case path == "token" && req.Method == "DELETE":
+		return data.editorTokenRevoke(rw, req)
+	case path == "pastes" && req.Method == "GET":
+		return data.editorList(rw, req)
+	case path == "pastes" && req.Method == "POST":
+		return data.editorCreate(rw, req)
+	case strings.HasPrefix(path, "pastes/") && (req.Method == "PUT" || req.Method == "PATCH"):
+		id := strings.TrimPrefix(path, "pastes/")
+		if id == "" || strings.Contains(id, "/") {
+			return netshare.ErrNotFound
+		}
+		return data.editorUpdate(rw, req, id)
+	case path == "token" || path == "pastes" || strings.HasPrefix(path, "pastes/"):
+		return netshare.ErrMethodNotAllowed
+	}
+	return netshare.ErrNotFound
+}
+
+// editorAuth returns the token of the request and who it belongs to
+// Editor tokens are accepted, and read-write ones, which may do the same
+func (data *Data) editorAuth(req *http.Request) (*token.TokenInfo, storage.PasteOwner, error) {
+	scheme, credential, _ := strings.Cut(req.Header.Get("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return nil, storage.PasteOwner{}, netshare.ErrUnauthorized
+	}
+	info, err := data.Tokens.Validate(strings.TrimSpace(credential))
+	if err != nil || !(info.HasScope(token.ScopeEditor) || info.CanWrite()) {
+		return nil, storage.PasteOwner{}, netshare.ErrUnauthorized
+	}
+
+	if info.Type == "org" {
+		return info, storage.PasteOwner{OrgID: info.OwnerID}, nil
+	}
+	return info, storage.PasteOwner{UserID: info.OwnerID}, nil
+}
+
+// POST /api/v1/editor/token - make an editor token for the owner of the
+// read-write token the request is made with
+// Form: name (shown in the token list), expiresIn (seconds; default never)
+func (data *Data) editorTokenCreate(rw http.ResponseWriter, req *http.Request) error {
+	info, _, err := data.editorAuth(req)
+	if err != nil {
+		return err
+	}
+	// An editor token cannot make more of itself
+	if !info.CanWrite() {
+		return errEditorTokenCreate
+	}
+	if err := req.ParseForm(); err != nil {
+		return netshare.ErrBadRequest
+	}
+
+	name := strings.TrimSpace(req.PostForm.Get("name"))
+	if name == "" {
+		name = "editor"
+	}
+	if utf8.RuneCountInString(name) > maxEditorTokenName {
+		return netshare.ErrPayloadTooLarge
+	}
+
+	var expiresAt *int64
+	if s := req.PostForm.Get("expiresIn"); s != "" {
+		seconds, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || seconds <= 0 {
+			return netshare.ErrBadRequest
+		}
+		at := time.Now().Unix() + seconds
+		expiresAt = &at
+	}
+
+	scopes := []string{token.ScopeEditor}
+	var value string
+	if info.Type == "org" {
+		value, _, err = data.Tokens.CreateOrgToken(info.OwnerID, info.UserID, name, scopes, expiresAt)
+	} else {
+		value, _, err = data.Tokens.CreateUserToken(info.OwnerID, name, scopes, expiresAt)
+	}
+	if err != nil {
+		return err
+	}
+
+	answer := editorTokenAnswer{Token: value, Name: name, Scopes: scopes, ExpiresAt: expiresAt}
+	return writeSuccess(rw, req, answer, "Editor token created", "token: "+value+"\n")
+}
+
+// DELETE /api/v1/editor/token - revoke the token the request is made with,
+// for when a plugin signs out
+func (data *Data) editorTokenRevoke(rw http.ResponseWriter, req *http.Request) error {
+	info, _, err := data.editorAuth(req)
+	if err != nil {
+		return err
+	}
+	// Revoking a read-write token here would surprise its other users
+	if !info.IsEditorOnly() {
+		return errEditorTokenRevoke
+	}
+
+	if info.Type == "org" {
+		err = data.Tokens.RevokeOrgToken(info.Token.ID, info.OwnerID)
+	} else {
+		err = data.Tokens.RevokeUserToken(info.Token.ID, info.OwnerID)
+	}
+	if err != nil {
+		return err
+	}
+	return writeSuccess(rw, req, map[string]string{"name": info.Token.Name}, "Editor token revoked", "")
+}
+
+// GET /api/v1/editor/pastes?limit=&offset= - the pastes made with tokens of
+// the same owner, private ones included
+func (data *Data) editorList(rw http.ResponseWriter, req *http.Request) error {
+	_, owner, err := data.editorAuth(req)
+	if err != nil {
+		return err
+	}
+	if err := data.RateLimitGet.CheckAndUse(netshare.GetClientAddr(req)); err != nil {
+		return err
+	}
+
+	query := req.URL.Query()
+	limit, offset := 50, 0
+	if s := query.Get("limit"); s != "" {
+		if limit, err = strconv.Atoi(s); err != nil || limit <= 0 || limit > 100 {
+			return netshare.ErrBadRequest
+		}
+	}
+	if s := query.Get("offset"); s != "" {
+		if offset, err = strconv.Atoi(s); err != nil || offset < 0 {
+			return netshare.ErrBadRequest
+		}
+	}
+
+	pastes, err := data.db(req).PasteListOwned(owner, limit, offset)
+	if err != nil {
+		return err
+	}
+
+	var textBuilder strings.Builder
+	for _, p := range pastes {
+		fmt.Fprintf(&textBuilder, "%s\t%s\n", p.ID, p.Title)
+	}
+	msg := fmt.Sprintf("%d pastes found", len(pastes))
+	return writeSuccess(rw, req, editorListAnswer{Pastes: pastes, Limit: limit, Offset: offset}, msg, textBuilder.String())
+}
+
+// POST /api/v1/editor/pastes - create a paste from an editor selection
+// Besides the fields of POST /api/v1/pastes, fileName names the file the
+// selection is from: it is the default title, and picks the syntax when
+// none is sent; syntax may be an editor language ID
+func (data *Data) editorCreate(rw http.ResponseWriter, req *http.Request) error {
+	_, owner, err := data.editorAuth(req)
+	if err != nil {
+		return err
+	}
+	if err := data.editorForm(req); err != nil {
+		return err
+	}
+
+	db := data.db(req)
+	pasteID, _, _, _, err := netshare.PasteAddFromForm(req, db, data.RateLimitNew, data.TitleMaxLen, data.BodyMaxLen, data.MaxLifeTime, data.Lexers, data.Redaction)
+	if err != nil {
+		return err
+	}
+	if err := db.PasteOwnerSet(pasteID, owner); err != nil {
+		return err
+	}
+
+	paste, err := db.PasteGet(pasteID)
+	if err != nil {
+		return err
+	}
+	answer := data.editorAnswer(req, paste)
+	return writeSuccess(rw, req, answer, "Paste created", "url: "+answer.URL+"\n")
+}
+
+// PUT /api/v1/editor/pastes/{id} - update a paste made with a token of the
+// same owner, with the fields of PUT /api/v1/pastes/{id}
+func (data *Data) editorUpdate(rw http.ResponseWriter, req *http.Request, id string) error {
+	_, owner, err := data.editorAuth(req)
+	if err != nil {
+		return err
+	}
+
+	db := data.db(req)
+	pasteOwner, err := db.PasteOwnerGet(id)
+	if err != nil {
+		return err
+	}
+	// Someone else's paste is reported as missing, as it is from this API
+	if pasteOwner != owner {
+		return storage.ErrNotFoundID
+	}
+	if err := data.editorForm(req); err != nil {
+		return err
+	}
+
+	ip := netshare.GetClientAddr(req).String()
+	paste, changed, _, err := netshare.PasteUpdateFromForm(req, id, true, db, data.RateLimitNew, data.TitleMaxLen, data.BodyMaxLen, data.MaxLifeTime, data.Lexers, data.Redaction)
+	if err == storage.ErrWORM || err == storage.ErrLegalHold {
+		audit.PasteModifyDenied(id, "edit", ip, rw.Header().Get("X-Request-ID"))
+	}
+	if err != nil {
+		return err
+	}
+	if len(changed) > 0 {
+		audit.PasteUpdated(id, "token", changed, ip, rw.Header().Get("X-Request-ID"))
+	}
+
+	answer := data.editorAnswer(req, paste)
+	return writeSuccess(rw, req, answer, "Paste updated", "url: "+answer.URL+"\n")
+}
+
+// editorForm parses the form and fills in the title and syntax from
+// fileName, and maps editor language IDs to lexer names
+func (data *Data) editorForm(req *http.Request) error {
+	if err := req.ParseForm(); err != nil {
+		return netshare.ErrBadRequest
+	}
+	// Parsed now so the changes below are kept; ignored when not multipart
+	req.ParseMultipartForm(52428800)
+
+	form := req.PostForm
+	fileName := form.Get("fileName")
+	if fileName != "" && form.Get("title") == "" && req.Method == "POST" {
+		form.Set("title", fileName)
+	}
+	syntax := form.Get("syntax")
+	if syntax == "" && fileName != "" {
+		syntax = web.DetectSyntaxFromFilename(fileName)
+	}
+	if lexer, ok := editorLanguages[strings.ToLower(syntax)]; ok {
+		syntax = lexer
+	}
+	if syntax != "" && !strings.EqualFold(syntax, "autodetect") {
+		form.Set("syntax", normalizeSyntax(syntax, data.Lexers))
+	}
+	return nil
+}
+
+func (data *Data) editorAnswer(req *http.Request, paste storage.Paste) editorPasteAnswer {
+	return editorPasteAnswer{
+		ID:         paste.ID,
+		URL:        netshare.BuildPasteURL(req, paste.ID),
+		RawURL:     netshare.BuildPasteURL(req, "raw/"+paste.ID),
+		Title:      paste.Title,
+		Syntax:     paste.Syntax,
+		DeleteTime: paste.DeleteTime,
+	}
+}
@@ -13,8 +13,11 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/casjay-forks/caspaste/src/abuse"
+	"github.com/casjay-forks/caspaste/src/format"
 	"github.com/casjay-forks/caspaste/src/httputil"
 	"github.com/casjay-forks/caspaste/src/netshare"
+	"github.com/casjay-forks/caspaste/src/pgp"
 	"github.com/casjay-forks/caspaste/src/storage"
 )
 
@@ -36,6 +39,7 @@ type ErrorInfo struct {
 // getErrorInfo maps errors to their codes and messages per AI.md PART 16
 func getErrorInfo(e error) ErrorInfo {
 	var eTmp429 *netshare.RateLimitError
+	var eFormat *format.SyntaxError
 
 	switch {
 	case e == netshare.ErrBadRequest:
@@ -46,6 +50,8 @@ func getErrorInfo(e error) ErrorInfo {
 		return ErrorInfo{404, "NOT_FOUND", "Paste not found"}
 	case e == netshare.ErrNotFound:
 		return ErrorInfo{404, "NOT_FOUND", "Resource not found"}
+	case e == storage.ErrShareLinkNotFound:
+		return ErrorInfo{404, "NOT_FOUND", "Share link not found"}
 	case e == netshare.ErrMethodNotAllowed:
 		return ErrorInfo{405, "METHOD_NOT_ALLOWED", "Method not allowed"}
 	case e == netshare.ErrPayloadTooLarge:
@@ -54,6 +60,48 @@ func getErrorInfo(e error) ErrorInfo {
 		return ErrorInfo{429, "RATE_LIMITED", "Too many requests"}
 	case errors.As(e, &eTmp429):
 		return ErrorInfo{429, "RATE_LIMITED", "Too many requests"}
+	case errors.Is(e, storage.ErrUnavailable):
+		return ErrorInfo{503, "UNAVAILABLE", "The database is unavailable; cached pastes can be read, nothing can be created or changed until it is back"}
+	case errors.Is(e, storage.ErrHeldForReview):
+		return ErrorInfo{202, "HELD_FOR_REVIEW", "The paste was received and is held for review by an admin before it is published"}
+	case e == storage.ErrWORM || e == storage.ErrLegalHold:
+		return ErrorInfo{403, "FORBIDDEN", "Paste cannot be modified"}
+	case e == storage.ErrDraftNotFound:
+		return ErrorInfo{404, "NOT_FOUND", "Draft not found"}
+	case e == storage.ErrDraftID:
+		return ErrorInfo{400, "BAD_REQUEST", e.Error()}
+	case e == storage.ErrDraftLimit:
+		return ErrorInfo{409, "CONFLICT", "Draft limit reached, delete old drafts first"}
+	case e == format.ErrUnsupported:
+		return ErrorInfo{400, "BAD_REQUEST", "No formatter for this syntax"}
+	case errors.Is(e, abuse.ErrInvalidReport):
+		return ErrorInfo{400, "BAD_REQUEST", e.Error()}
+	case errors.Is(e, pgp.ErrInvalidKey), errors.Is(e, pgp.ErrInvalidSignature), errors.Is(e, pgp.ErrUnsupported):
+		return ErrorInfo{400, "BAD_REQUEST", e.Error()}
+	case errors.Is(e, pgp.ErrWrongKey), errors.Is(e, pgp.ErrBadSignature):
+		return ErrorInfo{422, "UNPROCESSABLE", e.Error()}
+	case e == storage.ErrSignatureKey:
+		return ErrorInfo{422, "UNPROCESSABLE", "No public key for the signature, register it or send it as publicKey"}
+	case e == storage.ErrPGPKeyProof:
+		return ErrorInfo{422, "UNPROCESSABLE", "The proof is not a signature of the challenge made with this key"}
+	case e == storage.ErrPGPKeyNotFound:
+		return ErrorInfo{404, "NOT_FOUND", "PGP key not found"}
+	case e == storage.ErrPGPKeyExists:
+		return ErrorInfo{409, "CONFLICT", "PGP key is already registered"}
+	case e == storage.ErrPGPKeyLimit:
+		return ErrorInfo{409, "CONFLICT", "PGP key limit reached, remove a key first"}
+	case e == errEditorTokenCreate || e == errEditorTokenRevoke:
+		return ErrorInfo{403, "FORBIDDEN", e.Error()}
+	case e == errSeriesNotFound:
+		return ErrorInfo{404, "NOT_FOUND", e.Error()}
+	case e == storage.ErrSeriesKey:
+		return ErrorInfo{403, "FORBIDDEN", "Wrong series key"}
+	case e == storage.ErrSeriesFull:
+		return ErrorInfo{409, "CONFLICT", fmt.Sprintf("A series has at most %d parts", storage.MaxSeriesParts)}
+	case e == storage.ErrGistEmpty:
+		return ErrorInfo{422, "UNPROCESSABLE", "A gist needs at least one file"}
+	case errors.As(e, &eFormat):
+		return ErrorInfo{422, "UNPROCESSABLE", eFormat.Error()}
 	default:
 		return ErrorInfo{500, "SERVER_ERROR", "Internal server error"}
 	}
@@ -71,6 +119,9 @@ func (data *Data) writeError(rw http.ResponseWriter, req *http.Request, e error)
 	if errors.As(e, &eTmp429) {
 		rw.Header().Set("Retry-After", strconv.FormatInt(eTmp429.RetryAfter, 10))
 	}
+	if errors.Is(e, storage.ErrUnavailable) {
+		rw.Header().Set("Retry-After", strconv.Itoa(data.DB.Breaker().RetryAfter()))
+	}
 
 	// Check response format per AI.md PART 14 content negotiation
 	format := httputil.GetAPIResponseFormat(req)
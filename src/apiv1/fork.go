@@ -0,0 +1,124 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package apiv1
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/casjay-forks/caspaste/src/netshare"
+	"github.com/casjay-forks/caspaste/src/storage"
+	"github.com/casjay-forks/caspaste/src/web"
+)
+
+type forkPasteAnswer struct {
+	ID         string `json:"id"`
+	URL        string `json:"url"`
+	ForkOf     string `json:"forkOf"`
+	Author     string `json:"author"`
+	CreateTime int64  `json:"createTime"`
+	DeleteTime int64  `json:"deleteTime"`
+}
+
+// POST /api/v1/pastes/{id}/fork - copy a paste into a new one that links back to it
+// The fork keeps the title, body, syntax, tags and privacy of the paste and is
+// credited to the caller (session or Basic auth), or left anonymous
+// Form fields: expiration (seconds, as for new pastes), editable
+func (data *Data) handleFork(rw http.ResponseWriter, req *http.Request, id string) error {
+	if req.Method != "POST" {
+		return netshare.ErrMethodNotAllowed
+	}
+
+	var user string
+	var err error
+	if _, _, ok := req.BasicAuth(); ok {
+		if user, err = data.basicAuthUser(rw, req); err != nil {
+			return err
+		}
+	} else if sessionUser, ok := web.SessionUser(req); ok {
+		user = sessionUser
+	} else if err = data.checkAuth(rw, req); err != nil {
+		// Check auth (required when server.public=false)
+		return err
+	}
+
+	// A fork is a new paste
+	if err := data.RateLimitNew.CheckAndUse(netshare.GetClientAddr(req)); err != nil {
+		return err
+	}
+	if err := req.ParseForm(); err != nil {
+		return netshare.ErrBadRequest
+	}
+
+	parent, err := data.db(req).PasteGet(id)
+	if err != nil {
+		return err
+	}
+	// Copying a burn-after-reading paste would keep it past its last view,
+	// and a short URL has no body to fork
+	if parent.OneUse || parent.IsURL {
+		return netshare.ErrBadRequest
+	}
+	if utf8.RuneCountInString(parent.Body) > data.BodyMaxLen && data.BodyMaxLen > 0 {
+		return netshare.ErrPayloadTooLarge
+	}
+
+	fork := storage.Paste{
+		Title:      parent.Title,
+		Body:       parent.Body,
+		Syntax:     parent.Syntax,
+		Author:     user,
+		IsFile:     parent.IsFile,
+		FileName:   parent.FileName,
+		MimeType:   parent.MimeType,
+		IsEditable: req.PostForm.Get("editable") == "true",
+		IsPrivate:  parent.IsPrivate,
+		Encrypted:  parent.Encrypted,
+		Tags:       parent.Tags,
+		ForkOf:     parent.ID,
+	}
+
+	// Same limits as the expiration of new pastes
+	if expirStr := req.PostForm.Get("expiration"); expirStr != "" {
+		expir, err := strconv.ParseInt(expirStr, 10, 64)
+		if err != nil {
+			return netshare.ErrBadRequest
+		}
+		if data.MaxLifeTime > 0 && (expir > data.MaxLifeTime || expir <= 0) {
+			return netshare.ErrBadRequest
+		}
+		if expir > 0 {
+			fork.DeleteTime = time.Now().Unix() + expir
+		}
+	}
+
+	forkID, createTime, deleteTime, err := data.db(req).PasteAdd(fork)
+	if err != nil {
+		return err
+	}
+
+	answer := forkPasteAnswer{
+		ID:         forkID,
+		URL:        netshare.BuildPasteURL(req, forkID),
+		ForkOf:     parent.ID,
+		Author:     user,
+		CreateTime: createTime,
+		DeleteTime: deleteTime,
+	}
+
+	var textBuilder strings.Builder
+	fmt.Fprintf(&textBuilder, "id: %s\n", answer.ID)
+	fmt.Fprintf(&textBuilder, "url: %s\n", answer.URL)
+	fmt.Fprintf(&textBuilder, "forkOf: %s\n", answer.ForkOf)
+	fmt.Fprintf(&textBuilder, "createTime: %d\n", answer.CreateTime)
+	fmt.Fprintf(&textBuilder, "deleteTime: %d\n", answer.DeleteTime)
+
+	return writeSuccess(rw, req, answer, "Paste forked", textBuilder.String())
+}
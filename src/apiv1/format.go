@@ -0,0 +1,110 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package apiv1
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/casjay-forks/caspaste/src/audit"
+	"github.com/casjay-forks/caspaste/src/format"
+	"github.com/casjay-forks/caspaste/src/netshare"
+	"github.com/casjay-forks/caspaste/src/storage"
+)
+
+type formatAnswer struct {
+	ID     string `json:"id"`
+	Syntax string `json:"syntax"`
+	Body   string `json:"body"`
+	// False when the paste was already formatted
+	Changed bool `json:"changed"`
+	// True when the formatted body replaced the stored one
+	Saved bool `json:"saved"`
+}
+
+// POST /api/v1/pastes/{id}/format - format a paste with its language formatter
+// POST /api/v1/pastes/{id}/format?save=true - also store the result (editable pastes only)
+func (data *Data) handleFormat(rw http.ResponseWriter, req *http.Request, pasteID string) error {
+	if req.Method != "POST" {
+		return netshare.ErrMethodNotAllowed
+	}
+
+	req.ParseForm()
+	save := req.Form.Get("save") == "true"
+
+	// Saving changes a paste, so it is limited like creating one
+	rateLimit := data.RateLimitGet
+	if save {
+		if err := data.checkAuth(rw, req); err != nil {
+			return err
+		}
+		rateLimit = data.RateLimitNew
+	}
+	if err := rateLimit.CheckAndUse(netshare.GetClientAddr(req)); err != nil {
+		return err
+	}
+
+	paste, err := data.db(req).PasteGet(pasteID)
+	if err != nil {
+		return err
+	}
+
+	// Formatting a one-use paste would reveal it without burning it, and an
+	// encrypted body cannot be formatted by the server
+	if paste.IsFile || paste.IsURL || paste.OneUse || paste.Encrypted {
+		return netshare.ErrBadRequest
+	}
+
+	body, err := format.Format(paste.Syntax, paste.Body)
+	if err != nil {
+		return err
+	}
+
+	answer := formatAnswer{
+		ID:      paste.ID,
+		Syntax:  paste.Syntax,
+		Body:    body,
+		Changed: body != paste.Body,
+	}
+
+	if save && answer.Changed {
+		if !paste.IsEditable {
+			return netshare.ErrUnauthorized
+		}
+		paste.Body = body
+		err = data.db(req).PasteUpdate(paste)
+		if err == storage.ErrWORM || err == storage.ErrLegalHold {
+			// Record tampering attempts on write-once pastes
+			audit.PasteModifyDenied(paste.ID, "format", netshare.GetClientAddr(req).String(), rw.Header().Get("X-Request-ID"))
+		}
+		if err != nil {
+			return err
+		}
+		answer.Saved = true
+	}
+
+	msg := "Paste formatted"
+	if answer.Saved {
+		msg = "Paste formatted and saved"
+	}
+
+	// For text format, return the formatted body
+	return writeSuccess(rw, req, answer, msg, body)
+}
+
+// pasteActionPath splits /api/v1/pastes/{id}/{action} into id and action
+func pasteActionPath(path, apiBase string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(path, apiBase+"/pastes/")
+	if !ok {
+		return "", "", false
+	}
+	id, action, ok := strings.Cut(rest, "/")
+	if !ok || id == "" || action == "" {
+		return "", "", false
+	}
+	return id, action, true
+}
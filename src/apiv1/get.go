@@ -7,11 +7,20 @@
 package apiv1
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/casjay-forks/caspaste/src/netshare"
+	"github.com/casjay-forks/caspaste/src/raw"
+	"github.com/casjay-forks/caspaste/src/storage"
 )
 
+type getPasteAnswer struct {
+	storage.Paste
+	// PGP signature and whether it matches; omitted when the paste is not signed
+	Signature *storage.SignatureStatus `json:"signature,omitempty"`
+}
+
 // GET /api/v1/pastes?id=X - get single paste per AI.md PART 14
 func (data *Data) getPaste(rw http.ResponseWriter, req *http.Request) error {
 	// Check rate limit
@@ -29,15 +38,24 @@ func (data *Data) getPaste(rw http.ResponseWriter, req *http.Request) error {
 	}
 
 	// Get paste
-	paste, err := data.DB.PasteGet(pasteID)
+	paste, err := data.db(req).PasteGet(pasteID)
 	if err != nil {
 		return err
 	}
 
-	// If "one use" (burn after reading) paste - delete it after returning content
+	// Checked before the view is counted, which may delete the paste
+	answer := getPasteAnswer{Paste: paste}
+	// A paste served from cache while the database is unavailable has no
+	// signature status
+	answer.Signature, err = data.db(req).PasteSignatureGet(paste.ID, raw.Content(paste))
+	if err != nil && !errors.Is(err, storage.ErrUnavailable) {
+		return err
+	}
+
+	// If "one use" (burn after reading) paste - count the view, and delete
+	// it after the last one
 	if paste.OneUse {
-		// Delete paste immediately - burn after reading just works
-		err = data.DB.PasteDelete(pasteID)
+		answer.ViewsLeft, err = data.db(req).PasteView(pasteID)
 		if err != nil {
 			return err
 		}
@@ -45,5 +63,5 @@ func (data *Data) getPaste(rw http.ResponseWriter, req *http.Request) error {
 
 	// Return response with content negotiation per AI.md PART 14, 16
 	// For text format, return just the raw paste body (useful for curl/wget)
-	return writeSuccess(rw, req, paste, "Paste retrieved", paste.Body)
+	return writeSuccess(rw, req, answer, "Paste retrieved", paste.Body)
 }
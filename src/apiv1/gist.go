@@ -0,0 +1,317 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package apiv1
+
+// GitHub Gist compatibility per AI.md "External API Compatibility"
+// A subset of the Gist REST API, so gist tools (gh gist, editor plugins)
+// can use CasPaste by changing their base URL to https://{server} or, for
+// GitHub Enterprise style clients, https://{server}/api/v3
+// POST /gists creates, GET /gists/{id} reads, GET /gists lists the caller's
+// gists and GET /gists/public everyone's public gists
+// Each file is stored as a paste; a secret gist is made of private pastes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/casjay-forks/caspaste/src/netshare"
+	"github.com/casjay-forks/caspaste/src/oauth"
+	"github.com/casjay-forks/caspaste/src/raw"
+	"github.com/casjay-forks/caspaste/src/storage"
+	"github.com/casjay-forks/caspaste/src/web"
+)
+
+// maxGistFiles is the most files a gist may have
+const maxGistFiles = 50
+
+type gistRequest struct {
+	Description string `json:"description"`
+	Public      bool   `json:"public"`
+	Files       map[string]struct {
+		Content string `json:"content"`
+	} `json:"files"`
+}
+
+type gistAnswer struct {
+	URL         string                    `json:"url"`
+	ID          string                    `json:"id"`
+	HTMLURL     string                    `json:"html_url"`
+	Files       map[string]gistFileAnswer `json:"files"`
+	Public      bool                      `json:"public"`
+	CreatedAt   string                    `json:"created_at"`
+	UpdatedAt   string                    `json:"updated_at"`
+	Description string                    `json:"description"`
+	Comments    int                       `json:"comments"`
+	Owner       gistOwnerAnswer           `json:"owner"`
+	Truncated   bool                      `json:"truncated"`
+}
+
+type gistFileAnswer struct {
+	Filename string `json:"filename"`
+	Type     string `json:"type"`
+	Language string `json:"language"`
+	RawURL   string `json:"raw_url"`
+	Size     int    `json:"size"`
+	// Only sent for a single gist, as GitHub does
+	Truncated *bool   `json:"truncated,omitempty"`
+	Content   *string `json:"content,omitempty"`
+}
+
+type gistOwnerAnswer struct {
+	Login string `json:"login"`
+}
+
+type gistError struct {
+	Message string `json:"message"`
+}
+
+// gistRoute returns the part of a Gist API path from /gists on
+func gistRoute(path string) (string, bool) {
+	path = strings.TrimPrefix(path, "/api/v3")
+	if path == "/gists" || strings.HasPrefix(path, "/gists/") {
+		return path, true
+	}
+	return "", false
+}
+
+// handleGists routes the Gist API; errors are answered in GitHub's format
+func (data *Data) handleGists(rw http.ResponseWriter, req *http.Request, path string) error {
+	var status int
+	var answer interface{}
+	var err error
+
+	switch id := strings.TrimPrefix(path, "/gists/"); {
+	case path == "/gists" && req.Method == "POST":
+		status = http.StatusCreated
+		answer, err = data.gistCreate(rw, req)
+	case path == "/gists" && req.Method == "GET":
+		answer, err = data.gistList(rw, req, false)
+	case path == "/gists/public" && req.Method == "GET":
+		answer, err = data.gistList(rw, req, true)
+	case id != path && id != "" && !strings.Contains(id, "/") && req.Method == "GET":
+		answer, err = data.gistGet(rw, req, id)
+	case path == "/gists" || id != path:
+		err = netshare.ErrMethodNotAllowed
+	default:
+		err = netshare.ErrNotFound
+	}
+	if err != nil {
+		data.Log.HttpError(req, err)
+		info := getErrorInfo(err)
+		status, answer = info.Code, gistError{Message: info.Message}
+	}
+
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if status != 0 {
+		rw.WriteHeader(status)
+	}
+	return json.NewEncoder(rw).Encode(answer)
+}
+
+// gistOwner returns who is calling: an API token ("token" or "Bearer"
+// scheme, as gist clients send it), the web session or Basic auth
+// Tokens need the read-write scope to create gists; OAuth access tokens
+// act for the user who granted them and need pastes:write
+func (data *Data) gistOwner(rw http.ResponseWriter, req *http.Request, write bool) (string, error) {
+	scheme, credential, _ := strings.Cut(req.Header.Get("Authorization"), " ")
+	if strings.HasPrefix(strings.TrimSpace(credential), oauth.PrefixAccessToken) {
+		scope := oauth.ScopePastesRead
+		if write {
+			scope = oauth.ScopePastesWrite
+		}
+		grant := data.oauthGrant(req, scope)
+		if grant == nil {
+			return "", netshare.ErrUnauthorized
+		}
+		return fmt.Sprintf("user:%d", grant.UserID), nil
+	}
+	if strings.EqualFold(scheme, "token") || strings.EqualFold(scheme, "Bearer") {
+		if data.Tokens == nil {
+			return "", netshare.ErrUnauthorized
+		}
+		info, err := data.Tokens.Validate(strings.TrimSpace(credential))
+		if err != nil || (write && !info.CanWrite()) || !info.CanRead() {
+			return "", netshare.ErrUnauthorized
+		}
+		return fmt.Sprintf("%s:%d", info.Type, info.OwnerID), nil
+	}
+	if user, ok := web.SessionUser(req); ok {
+		return user, nil
+	}
+	return data.basicAuthUser(rw, req)
+}
+
+// gistAuth checks the caller may read gists: anyone on a public server,
+// otherwise whoever gistOwner accepts
+func (data *Data) gistAuth(rw http.ResponseWriter, req *http.Request) error {
+	if data.Public || data.CasPasswdFile == "" {
+		return nil
+	}
+	_, err := data.gistOwner(rw, req, false)
+	return err
+}
+
+// POST /gists - create a gist from {"description", "public", "files": {name: {"content"}}}
+func (data *Data) gistCreate(rw http.ResponseWriter, req *http.Request) (interface{}, error) {
+	// Gists have an owner so they can be listed
+	owner, err := data.gistOwner(rw, req, true)
+	if err != nil {
+		return nil, err
+	}
+	if err := data.RateLimitNew.CheckAndUse(netshare.GetClientAddr(req)); err != nil {
+		return nil, err
+	}
+
+	var gistReq gistRequest
+	if err := json.NewDecoder(req.Body).Decode(&gistReq); err != nil {
+		return nil, netshare.ErrBadRequest
+	}
+	if len(gistReq.Files) > maxGistFiles {
+		return nil, netshare.ErrPayloadTooLarge
+	}
+	if data.TitleMaxLen > 0 && utf8.RuneCountInString(gistReq.Description) > data.TitleMaxLen {
+		return nil, netshare.ErrPayloadTooLarge
+	}
+
+	// GitHub lists files by name
+	names := make([]string, 0, len(gistReq.Files))
+	for name := range gistReq.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	gist := storage.Gist{
+		Description: gistReq.Description,
+		Owner:       owner,
+		Public:      gistReq.Public,
+	}
+	var deleteTime int64
+	if data.MaxLifeTime > 0 {
+		deleteTime = time.Now().Unix() + data.MaxLifeTime
+	}
+	for _, name := range names {
+		content := gistReq.Files[name].Content
+		if name == "" || strings.ContainsAny(name, "/\\") || content == "" {
+			return nil, netshare.ErrBadRequest
+		}
+		if data.TitleMaxLen > 0 && utf8.RuneCountInString(name) > data.TitleMaxLen {
+			return nil, netshare.ErrPayloadTooLarge
+		}
+		if data.BodyMaxLen > 0 && utf8.RuneCountInString(content) > data.BodyMaxLen {
+			return nil, netshare.ErrPayloadTooLarge
+		}
+
+		paste := storage.Paste{
+			Title:      name,
+			Body:       content,
+			Syntax:     normalizeSyntax(web.DetectSyntaxFromFilename(name), data.Lexers),
+			Author:     owner,
+			IsPrivate:  !gistReq.Public,
+			DeleteTime: deleteTime,
+		}
+		data.redactCompat(req, &paste)
+		gist.Files = append(gist.Files, storage.GistFile{Name: name, Paste: paste})
+	}
+
+	gist, err = data.db(req).GistAdd(gist)
+	if err != nil {
+		return nil, err
+	}
+	return data.gistAnswer(req, gist, true), nil
+}
+
+// GET /gists/{id}
+func (data *Data) gistGet(rw http.ResponseWriter, req *http.Request, id string) (interface{}, error) {
+	if err := data.gistAuth(rw, req); err != nil {
+		return nil, err
+	}
+	if err := data.RateLimitGet.CheckAndUse(netshare.GetClientAddr(req)); err != nil {
+		return nil, err
+	}
+
+	gist, err := data.db(req).GistGet(id)
+	if err != nil {
+		return nil, err
+	}
+	return data.gistAnswer(req, gist, true), nil
+}
+
+// GET /gists - the caller's gists; GET /gists/public - all public gists
+// Paged with per_page (default 30, at most 100) and page, from 1
+func (data *Data) gistList(rw http.ResponseWriter, req *http.Request, public bool) (interface{}, error) {
+	var owner string
+	var err error
+	if public {
+		err = data.gistAuth(rw, req)
+	} else {
+		owner, err = data.gistOwner(rw, req, false)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := data.RateLimitGet.CheckAndUse(netshare.GetClientAddr(req)); err != nil {
+		return nil, err
+	}
+
+	query := req.URL.Query()
+	perPage, err := strconv.Atoi(query.Get("per_page"))
+	if err != nil || perPage <= 0 {
+		perPage = 30
+	}
+	perPage = min(perPage, 100)
+	page, err := strconv.Atoi(query.Get("page"))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+
+	gists, err := data.db(req).GistList(owner, perPage, (page-1)*perPage)
+	if err != nil {
+		return nil, err
+	}
+	answer := make([]gistAnswer, 0, len(gists))
+	for _, gist := range gists {
+		answer = append(answer, data.gistAnswer(req, gist, false))
+	}
+	return answer, nil
+}
+
+// gistAnswer shapes a gist as GitHub does; file contents are only sent for
+// a single gist
+func (data *Data) gistAnswer(req *http.Request, gist storage.Gist, withContent bool) gistAnswer {
+	answer := gistAnswer{
+		URL:         netshare.BuildPasteURL(req, "gists/"+gist.ID),
+		ID:          gist.ID,
+		HTMLURL:     netshare.BuildPasteURL(req, gist.ID),
+		Files:       make(map[string]gistFileAnswer, len(gist.Files)),
+		Public:      gist.Public,
+		CreatedAt:   time.Unix(gist.CreateTime, 0).UTC().Format(time.RFC3339),
+		UpdatedAt:   time.Unix(gist.UpdateTime, 0).UTC().Format(time.RFC3339),
+		Description: gist.Description,
+		Owner:       gistOwnerAnswer{Login: gist.Owner},
+	}
+	for _, file := range gist.Files {
+		content := raw.Content(file.Paste)
+		fileAnswer := gistFileAnswer{
+			Filename: file.Name,
+			Type:     "text/plain",
+			Language: file.Paste.Syntax,
+			RawURL:   netshare.BuildPasteURL(req, "raw/"+file.Paste.ID),
+			Size:     len(content),
+		}
+		if withContent {
+			text, truncated := string(content), false
+			fileAnswer.Content, fileAnswer.Truncated = &text, &truncated
+		}
+		answer.Files[file.Name] = fileAnswer
+	}
+	return answer
+}
@@ -0,0 +1,108 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package apiv1
+
+// hastebin compatibility per AI.md "External API Compatibility"
+// POST /documents with the raw body returns {"key": "..."}, and
+// GET /documents/{key} returns {"key": "...", "data": "..."}
+// Clients open {server}/{key} and {server}/raw/{key}, which CasPaste serves
+// as it is
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/casjay-forks/caspaste/src/lineend"
+	"github.com/casjay-forks/caspaste/src/netshare"
+	"github.com/casjay-forks/caspaste/src/storage"
+)
+
+type hastebinDocument struct {
+	Key  string `json:"key"`
+	Data string `json:"data,omitempty"`
+}
+
+// handleHastebinCompat handles hastebin style paste creation and retrieval
+func (data *Data) handleHastebinCompat(rw http.ResponseWriter, req *http.Request) error {
+	if key, ok := strings.CutPrefix(req.URL.Path, "/documents/"); ok {
+		return data.handleHastebinGet(rw, req, key)
+	}
+	if req.Method != "POST" {
+		return netshare.ErrMethodNotAllowed
+	}
+
+	if err := data.checkAuth(rw, req); err != nil {
+		return err
+	}
+	err := data.RateLimitNew.CheckAndUse(netshare.GetClientAddr(req))
+	if err != nil {
+		return err
+	}
+
+	// Read raw body
+	bodyBytes, err := io.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+
+	body := string(bodyBytes)
+	if body == "" {
+		return netshare.ErrBadRequest
+	}
+	if utf8.RuneCountInString(body) > data.BodyMaxLen && data.BodyMaxLen > 0 {
+		return netshare.ErrPayloadTooLarge
+	}
+
+	paste := storage.Paste{
+		Body:   lineend.UnknownToUnix(body),
+		Syntax: "plaintext",
+	}
+
+	data.redactCompat(req, &paste)
+	pasteID, _, _, err := data.db(req).PasteAdd(paste)
+	if err != nil {
+		return err
+	}
+
+	// hastebin returns JSON with the key only
+	return writeHastebinResponse(rw, hastebinDocument{Key: pasteID})
+}
+
+// handleHastebinGet returns a paste as a hastebin document; a "one use"
+// paste counts a view, as with GET /api/v1/pastes
+func (data *Data) handleHastebinGet(rw http.ResponseWriter, req *http.Request, key string) error {
+	if req.Method != "GET" {
+		return netshare.ErrMethodNotAllowed
+	}
+
+	if err := data.checkAuth(rw, req); err != nil {
+		return err
+	}
+	err := data.RateLimitGet.CheckAndUse(netshare.GetClientAddr(req))
+	if err != nil {
+		return err
+	}
+
+	paste, err := data.db(req).PasteGet(key)
+	if err != nil {
+		return err
+	}
+	if paste.OneUse {
+		if _, err := data.db(req).PasteView(paste.ID); err != nil {
+			return err
+		}
+	}
+
+	return writeHastebinResponse(rw, hastebinDocument{Key: paste.ID, Data: string(netshare.PasteContent(paste))})
+}
+
+func writeHastebinResponse(rw http.ResponseWriter, doc hastebinDocument) error {
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	return json.NewEncoder(rw).Encode(doc)
+}
@@ -7,11 +7,13 @@ package apiv1
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/casjay-forks/caspaste/src/httputil"
+	"github.com/casjay-forks/caspaste/src/storage"
 )
 
 type healthzResponse struct {
@@ -44,10 +46,14 @@ func (data *Data) handleHealthz(rw http.ResponseWriter, req *http.Request) error
 	}
 
 	// Try to ping database
-	_, err := data.DB.PasteDeleteExpired()
+	_, err := data.db(req).PasteDeleteExpired()
 	if err != nil {
 		healthData.Status = "degraded"
 		healthData.Database = "error"
+		// The circuit breaker is open; cached pastes are served read-only
+		if errors.Is(err, storage.ErrUnavailable) {
+			healthData.Database = "unavailable"
+		}
 	}
 
 	// Determine response format per AI.md PART 14
@@ -13,8 +13,22 @@ import (
 	"strings"
 
 	"github.com/casjay-forks/caspaste/src/netshare"
+	"github.com/casjay-forks/caspaste/src/storage"
 )
 
+// listResponse is a page of the public list with the tags it can be
+// filtered by
+type listResponse struct {
+	Pastes []storage.PasteListItem `json:"pastes"`
+	Total  int                     `json:"total"`
+	Limit  int                     `json:"limit"`
+	Offset int                     `json:"offset"`
+	// Filter applied with ?tag=
+	Tag string `json:"tag,omitempty"`
+	// Most used tags on the public list, for browsing
+	Tags []storage.TagCount `json:"tags"`
+}
+
 // GET /api/v1/pastes - list pastes per AI.md PART 14
 func (data *Data) listPastes(rw http.ResponseWriter, req *http.Request) error {
 	// Check rate limit
@@ -44,8 +58,25 @@ func (data *Data) listPastes(rw http.ResponseWriter, req *http.Request) error {
 		offset = parsedOffset
 	}
 
+	tag := strings.ToLower(query.Get("tag"))
+	if tag != "" && !storage.ValidTag(tag) {
+		return netshare.ErrBadRequest
+	}
+
 	// Get paste list from database
-	pastes, err := data.DB.PasteList(limit, offset)
+	db := data.db(req)
+	pastes, err := db.PasteList(limit, offset, tag)
+	if err != nil {
+		return err
+	}
+	if pastes == nil {
+		pastes = []storage.PasteListItem{}
+	}
+	total, err := db.PasteListCount(tag)
+	if err != nil {
+		return err
+	}
+	tags, err := db.PasteTagCounts(50)
 	if err != nil {
 		return err
 	}
@@ -62,5 +93,12 @@ func (data *Data) listPastes(rw http.ResponseWriter, req *http.Request) error {
 
 	// Return response with content negotiation per AI.md PART 14, 16
 	msg := fmt.Sprintf("%d pastes found", len(pastes))
-	return writeSuccess(rw, req, pastes, msg, textBuilder.String())
+	return writeSuccess(rw, req, listResponse{
+		Pastes: pastes,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+		Tag:    tag,
+		Tags:   tags,
+	}, msg, textBuilder.String())
 }
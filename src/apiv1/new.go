@@ -14,6 +14,7 @@ import (
 
 	"github.com/casjay-forks/caspaste/src/caspasswd"
 	"github.com/casjay-forks/caspaste/src/netshare"
+	"github.com/casjay-forks/caspaste/src/redact"
 )
 
 type newPasteAnswer struct {
@@ -21,12 +22,44 @@ type newPasteAnswer struct {
 	URL        string `json:"url"`
 	CreateTime int64  `json:"createTime"`
 	DeleteTime int64  `json:"deleteTime"`
+	// What the server redacted before storage (omitted when redaction did not run)
+	Redaction *redact.Report `json:"redaction,omitempty"`
+	// Series the paste was added to, and its part; the key is only given
+	// when a series is started, and is needed to append to it
+	Series     string `json:"series,omitempty"`
+	SeriesPart int    `json:"seriesPart,omitempty"`
+	SeriesKey  string `json:"seriesKey,omitempty"`
+}
+
+// validatePasteAnswer is what POST /api/v1/pastes would do with a request
+type validatePasteAnswer struct {
+	Valid bool `json:"valid"`
+	// Set when the paste would be refused: the status and error of the answer
+	Status  int    `json:"status,omitempty"`
+	Error   string `json:"error,omitempty"`
+	Message string `json:"message,omitempty"`
+
+	// Set when the paste would be stored, as it would be stored
+	Title      string         `json:"title,omitempty"`
+	Syntax     string         `json:"syntax,omitempty"`
+	Size       int            `json:"size,omitempty"`
+	IsFile     bool           `json:"isFile,omitempty"`
+	MimeType   string         `json:"mimeType,omitempty"`
+	IsPrivate  bool           `json:"isPrivate,omitempty"`
+	Encrypted  bool           `json:"encrypted,omitempty"`
+	DeleteTime int64          `json:"deleteTime,omitempty"`
+	MaxViews   int            `json:"maxViews,omitempty"`
+	Tags       []string       `json:"tags,omitempty"`
+	Signed     bool           `json:"signed,omitempty"`
+	Redaction  *redact.Report `json:"redaction,omitempty"`
 }
 
 // handlePastes handles all paste operations per AI.md PART 14
 // POST /api/v1/pastes - create new paste
 // GET /api/v1/pastes?id=X - get single paste
 // GET /api/v1/pastes - list pastes
+// PUT /api/v1/pastes?id=X - update a paste (see updatePaste)
+// DELETE /api/v1/pastes?id=X - delete a paste
 func (data *Data) handlePastes(rw http.ResponseWriter, req *http.Request) error {
 	switch req.Method {
 	case "POST":
@@ -38,6 +71,12 @@ func (data *Data) handlePastes(rw http.ResponseWriter, req *http.Request) error
 			return data.getPaste(rw, req)
 		}
 		return data.listPastes(rw, req)
+	case "PUT":
+		req.ParseForm()
+		return data.updatePaste(rw, req, req.Form.Get("id"), false)
+	case "DELETE":
+		req.ParseForm()
+		return data.deletePaste(rw, req)
 	default:
 		return netshare.ErrMethodNotAllowed
 	}
@@ -48,39 +87,8 @@ func (data *Data) createPaste(rw http.ResponseWriter, req *http.Request) error {
 	var err error
 
 	// Check auth (required when server.public=false)
-	if !data.Public && data.CasPasswdFile != "" {
-		clientIP := netshare.GetClientAddr(req)
-
-		// Check if IP is blocked due to too many failed attempts
-		if data.BruteForce != nil && data.BruteForce.CheckBlocked(clientIP) {
-			// Return 429 Too Many Requests with retry-after header
-			remaining := data.BruteForce.GetRemainingLockout(clientIP)
-			rw.Header().Set("Retry-After", strconv.Itoa(int(remaining.Seconds())))
-			return netshare.ErrTooManyRequests
-		}
-
-		isAuthenticated := false
-
-		user, pass, authProvided := req.BasicAuth()
-		if authProvided {
-			isAuthenticated, err = caspasswd.LoadAndCheck(data.CasPasswdFile, user, pass)
-			if err != nil {
-				return err
-			}
-		}
-
-		if !isAuthenticated {
-			// Record failed attempt
-			if data.BruteForce != nil {
-				data.BruteForce.RecordFailure(clientIP)
-			}
-			return netshare.ErrUnauthorized
-		}
-
-		// Record successful login
-		if data.BruteForce != nil {
-			data.BruteForce.RecordSuccess(clientIP)
-		}
+	if err = data.checkAuth(rw, req); err != nil {
+		return err
 	}
 
 	// Check method
@@ -89,7 +97,11 @@ func (data *Data) createPaste(rw http.ResponseWriter, req *http.Request) error {
 	}
 
 	// Get form data and create paste
-	pasteID, createTime, deleteTime, err := netshare.PasteAddFromForm(req, data.DB, data.RateLimitNew, data.TitleMaxLen, data.BodyMaxLen, data.MaxLifeTime, data.Lexers)
+	pasteID, createTime, deleteTime, report, err := netshare.PasteAddFromForm(req, data.db(req), data.RateLimitNew, data.TitleMaxLen, data.BodyMaxLen, data.MaxLifeTime, data.Lexers, data.Redaction)
+	if err != nil {
+		return err
+	}
+	seriesID, seriesPart, seriesKey, err := data.seriesAdd(req, pasteID)
 	if err != nil {
 		return err
 	}
@@ -102,6 +114,10 @@ func (data *Data) createPaste(rw http.ResponseWriter, req *http.Request) error {
 		URL:        url,
 		CreateTime: createTime,
 		DeleteTime: deleteTime,
+		Redaction:  report,
+		Series:     seriesID,
+		SeriesPart: seriesPart,
+		SeriesKey:  seriesKey,
 	}
 
 	// Build text representation for plain text response
@@ -110,7 +126,133 @@ func (data *Data) createPaste(rw http.ResponseWriter, req *http.Request) error {
 	fmt.Fprintf(&textBuilder, "url: %s\n", answer.URL)
 	fmt.Fprintf(&textBuilder, "createTime: %d\n", answer.CreateTime)
 	fmt.Fprintf(&textBuilder, "deleteTime: %d\n", answer.DeleteTime)
+	if report != nil {
+		fmt.Fprintf(&textBuilder, "redacted: %s\n", report)
+	}
+	if seriesID != "" {
+		fmt.Fprintf(&textBuilder, "series: %s\n", seriesID)
+		fmt.Fprintf(&textBuilder, "seriesPart: %d\n", seriesPart)
+	}
+	if seriesKey != "" {
+		fmt.Fprintf(&textBuilder, "seriesKey: %s\n", seriesKey)
+	}
 
 	// Return response with content negotiation per AI.md PART 14, 16
 	return writeSuccess(rw, req, answer, "Paste created", textBuilder.String())
 }
+
+// POST /api/v1/pastes/validate - run the checks of POST /api/v1/pastes on
+// the same form, without storing anything, and say what would happen
+// A paste that would be refused is still a successful answer, with
+// valid false and the status and error POST /api/v1/pastes would give
+func (data *Data) validatePaste(rw http.ResponseWriter, req *http.Request) error {
+	if err := data.checkAuth(rw, req); err != nil {
+		return err
+	}
+	if req.Method != "POST" {
+		return netshare.ErrMethodNotAllowed
+	}
+	// Nothing is stored, so this counts against reads rather than new pastes
+	if err := data.RateLimitGet.CheckAndUse(netshare.GetClientAddr(req)); err != nil {
+		return err
+	}
+
+	form, err := netshare.PasteCheckForm(req, data.db(req), data.TitleMaxLen, data.BodyMaxLen, data.MaxLifeTime, data.Lexers, data.Redaction)
+	if err != nil {
+		info := getErrorInfo(err)
+		// Failures of the server are not an answer about the paste
+		if info.Code >= 500 {
+			return err
+		}
+		answer := validatePasteAnswer{Status: info.Code, Error: info.ErrCode, Message: info.Message}
+		text := fmt.Sprintf("valid: false\nstatus: %d\nerror: %s\nmessage: %s\n", info.Code, info.ErrCode, info.Message)
+		return writeSuccess(rw, req, answer, "Paste would be refused", text)
+	}
+
+	paste := form.Paste
+	answer := validatePasteAnswer{
+		Valid:      true,
+		Title:      paste.Title,
+		Syntax:     paste.Syntax,
+		Size:       len(paste.Body),
+		IsFile:     paste.IsFile,
+		MimeType:   paste.MimeType,
+		IsPrivate:  paste.IsPrivate,
+		Encrypted:  paste.Encrypted,
+		DeleteTime: paste.DeleteTime,
+		MaxViews:   paste.MaxViews,
+		Tags:       paste.Tags,
+		Signed:     form.Signature != "",
+		Redaction:  form.Redaction,
+	}
+
+	var textBuilder strings.Builder
+	fmt.Fprintf(&textBuilder, "valid: true\n")
+	fmt.Fprintf(&textBuilder, "title: %s\n", answer.Title)
+	fmt.Fprintf(&textBuilder, "syntax: %s\n", answer.Syntax)
+	fmt.Fprintf(&textBuilder, "size: %d\n", answer.Size)
+	fmt.Fprintf(&textBuilder, "deleteTime: %d\n", answer.DeleteTime)
+	if form.Redaction != nil {
+		fmt.Fprintf(&textBuilder, "redacted: %s\n", form.Redaction)
+	}
+	return writeSuccess(rw, req, answer, "Paste would be accepted", textBuilder.String())
+}
+
+// checkAuth enforces Basic auth when server.public=false
+// OAuth access tokens with the pastes scope for the method are accepted too
+func (data *Data) checkAuth(rw http.ResponseWriter, req *http.Request) error {
+	if !data.Public && data.CasPasswdFile != "" {
+		if data.oauthGrant(req, oauthScope(req)) != nil {
+			return nil
+		}
+		_, err := data.basicAuthUser(rw, req)
+		return err
+	}
+
+	return nil
+}
+
+// basicAuthUser checks Basic auth against the caspasswd file and returns the user name
+// Failed attempts count towards the brute force lockout
+func (data *Data) basicAuthUser(rw http.ResponseWriter, req *http.Request) (string, error) {
+	var err error
+
+	if data.CasPasswdFile == "" {
+		return "", netshare.ErrUnauthorized
+	}
+
+	clientIP := netshare.GetClientAddr(req)
+
+	// Check if IP is blocked due to too many failed attempts
+	if data.BruteForce != nil && data.BruteForce.CheckBlocked(clientIP) {
+		// Return 429 Too Many Requests with retry-after header
+		remaining := data.BruteForce.GetRemainingLockout(clientIP)
+		rw.Header().Set("Retry-After", strconv.Itoa(int(remaining.Seconds())))
+		return "", netshare.ErrTooManyRequests
+	}
+
+	isAuthenticated := false
+
+	user, pass, authProvided := req.BasicAuth()
+	if authProvided {
+		isAuthenticated, err = caspasswd.LoadAndCheck(data.CasPasswdFile, user, pass)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if !isAuthenticated {
+		// Record failed attempt
+		if data.BruteForce != nil {
+			data.BruteForce.RecordFailure(clientIP)
+		}
+		return "", netshare.ErrUnauthorized
+	}
+
+	// Record successful login
+	if data.BruteForce != nil {
+		data.BruteForce.RecordSuccess(clientIP)
+	}
+
+	return user, nil
+}
@@ -0,0 +1,43 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package apiv1
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/casjay-forks/caspaste/src/oauth"
+)
+
+// oauthGrant returns the grant behind an oat_ bearer token when it holds the scope
+// Returns nil for other credentials, so callers fall back to their usual checks
+func (data *Data) oauthGrant(req *http.Request, scope string) *oauth.Grant {
+	if data.OAuth == nil {
+		return nil
+	}
+	scheme, credential, _ := strings.Cut(req.Header.Get("Authorization"), " ")
+	credential = strings.TrimSpace(credential)
+	if !strings.EqualFold(scheme, "Bearer") && !strings.EqualFold(scheme, "token") {
+		return nil
+	}
+	if !strings.HasPrefix(credential, oauth.PrefixAccessToken) {
+		return nil
+	}
+	grant, err := data.OAuth.ValidateAccessToken(credential)
+	if err != nil || !grant.HasScope(scope) {
+		return nil
+	}
+	return grant
+}
+
+// oauthScope is the scope an OAuth client needs for the request method:
+// pastes:read to read, pastes:write for anything else
+func oauthScope(req *http.Request) string {
+	if req.Method == http.MethodGet || req.Method == http.MethodHead {
+		return oauth.ScopePastesRead
+	}
+	return oauth.ScopePastesWrite
+}
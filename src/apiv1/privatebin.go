@@ -0,0 +1,220 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package apiv1
+
+// PrivateBin compatibility per AI.md "External API Compatibility"
+// PrivateBin clients POST a JSON paste to the server root, and GET /?{id},
+// both with "X-Requested-With: JSONHttpRequest"
+// Pastes are encrypted by the client in PrivateBin's own format, so they are
+// stored as sent: the server keeps the envelope and cannot show the content
+// Only API version 2 is supported; comments and deletion are not
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/netshare"
+	"github.com/casjay-forks/caspaste/src/storage"
+)
+
+// IsPrivateBinRequest reports whether a request to the server root comes
+// from a PrivateBin client, and so belongs to the API rather than the web UI
+func IsPrivateBinRequest(req *http.Request) bool {
+	return req.URL.Path == "/" && req.Header.Get("X-Requested-With") == "JSONHttpRequest"
+}
+
+// privateBinPaste is the part of a PrivateBin paste that is stored
+type privateBinPaste struct {
+	V int `json:"v"`
+	// Cipher parameters, format, discussion and burn after reading flags
+	AData json.RawMessage `json:"adata"`
+	// Base64 of the ciphertext
+	CT string `json:"ct"`
+}
+
+type privateBinRequest struct {
+	privateBinPaste
+	Meta struct {
+		Expire string `json:"expire"`
+	} `json:"meta"`
+
+	// Set on comments and deletions, which are not supported
+	PasteID     string `json:"pasteid"`
+	DeleteToken string `json:"deletetoken"`
+}
+
+type privateBinResponse struct {
+	Status  int    `json:"status"`
+	Message string `json:"message,omitempty"`
+	ID      string `json:"id,omitempty"`
+	URL     string `json:"url,omitempty"`
+	// Always empty: pastes cannot be deleted through this API
+	DeleteToken *string `json:"deletetoken,omitempty"`
+
+	// Set when a paste is read
+	*privateBinPaste
+	Meta         *privateBinMeta `json:"meta,omitempty"`
+	Comments     *[]struct{}     `json:"comments,omitempty"`
+	CommentCount *int            `json:"comment_count,omitempty"`
+}
+
+type privateBinMeta struct {
+	Created    int64 `json:"created"`
+	TimeToLive int64 `json:"time_to_live,omitempty"`
+}
+
+// privateBinExpire maps PrivateBin expiration names to seconds; 0 = never
+var privateBinExpire = map[string]int64{
+	"5min":   5 * 60,
+	"10min":  10 * 60,
+	"1hour":  60 * 60,
+	"1day":   24 * 60 * 60,
+	"1week":  7 * 24 * 60 * 60,
+	"1month": 30 * 24 * 60 * 60,
+	"1year":  365 * 24 * 60 * 60,
+	"never":  0,
+}
+
+// handlePrivateBinCompat handles PrivateBin style paste creation and
+// retrieval
+// Original returns: JSON with status 0, or status 1 and a message on error,
+// always with HTTP 200
+func (data *Data) handlePrivateBinCompat(rw http.ResponseWriter, req *http.Request) error {
+	var resp privateBinResponse
+	var err error
+	switch req.Method {
+	case "POST":
+		resp, err = data.privateBinCreate(rw, req)
+	case "GET":
+		resp, err = data.privateBinGet(rw, req)
+	default:
+		err = netshare.ErrMethodNotAllowed
+	}
+	if err != nil {
+		data.Log.HttpError(req, err)
+		resp = privateBinResponse{Status: 1, Message: getErrorInfo(err).Message}
+	}
+
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	return json.NewEncoder(rw).Encode(resp)
+}
+
+func (data *Data) privateBinCreate(rw http.ResponseWriter, req *http.Request) (privateBinResponse, error) {
+	if err := data.checkAuth(rw, req); err != nil {
+		return privateBinResponse{}, err
+	}
+	err := data.RateLimitNew.CheckAndUse(netshare.GetClientAddr(req))
+	if err != nil {
+		return privateBinResponse{}, err
+	}
+
+	var pbReq privateBinRequest
+	if err := json.NewDecoder(req.Body).Decode(&pbReq); err != nil {
+		return privateBinResponse{}, netshare.ErrBadRequest
+	}
+	if pbReq.PasteID != "" || pbReq.DeleteToken != "" {
+		return privateBinResponse{Status: 1, Message: "Comments and deletion are not supported by this server."}, nil
+	}
+
+	// adata is [[cipher parameters], format, open discussion, burn after reading]
+	var adata []json.RawMessage
+	if pbReq.V != 2 || pbReq.CT == "" || json.Unmarshal(pbReq.AData, &adata) != nil || len(adata) != 4 {
+		return privateBinResponse{}, netshare.ErrBadRequest
+	}
+	if len(pbReq.CT) > data.BodyMaxLen && data.BodyMaxLen > 0 {
+		return privateBinResponse{}, netshare.ErrPayloadTooLarge
+	}
+	body, err := json.Marshal(pbReq.privateBinPaste)
+	if err != nil {
+		return privateBinResponse{}, err
+	}
+
+	// Stored as sent, and not listed: nobody can read it without the key
+	paste := storage.Paste{
+		Title:     "PrivateBin paste",
+		Body:      string(body),
+		Syntax:    normalizeSyntax("json", data.Lexers),
+		IsPrivate: true,
+	}
+	if string(adata[3]) == "1" {
+		paste.OneUse = true
+		paste.MaxViews = 1
+	}
+
+	// PrivateBin defaults to a week, and shortens longer times to the limit
+	expire, ok := privateBinExpire[pbReq.Meta.Expire]
+	if !ok {
+		expire = privateBinExpire["1week"]
+	}
+	if data.MaxLifeTime > 0 && (expire == 0 || expire > data.MaxLifeTime) {
+		expire = data.MaxLifeTime
+	}
+	if expire > 0 {
+		paste.DeleteTime = time.Now().Unix() + expire
+	}
+
+	pasteID, _, _, err := data.db(req).PasteAdd(paste)
+	if err != nil {
+		return privateBinResponse{}, err
+	}
+
+	deleteToken := ""
+	return privateBinResponse{ID: pasteID, URL: "/?" + pasteID, DeleteToken: &deleteToken}, nil
+}
+
+// privateBinGet returns a paste by the ID in the query: /?{id} or
+// /?pasteid={id}; a "one use" paste counts a view
+func (data *Data) privateBinGet(rw http.ResponseWriter, req *http.Request) (privateBinResponse, error) {
+	if err := data.checkAuth(rw, req); err != nil {
+		return privateBinResponse{}, err
+	}
+	err := data.RateLimitGet.CheckAndUse(netshare.GetClientAddr(req))
+	if err != nil {
+		return privateBinResponse{}, err
+	}
+
+	pasteID := req.URL.Query().Get("pasteid")
+	if pasteID == "" {
+		pasteID, _ = url.QueryUnescape(strings.SplitN(req.URL.RawQuery, "&", 2)[0])
+	}
+	if pasteID == "" {
+		return privateBinResponse{}, netshare.ErrBadRequest
+	}
+
+	paste, err := data.db(req).PasteGet(pasteID)
+	if err != nil {
+		return privateBinResponse{}, err
+	}
+
+	// Pastes not created through this API cannot be decrypted by the client
+	var stored privateBinPaste
+	if json.Unmarshal([]byte(paste.Body), &stored) != nil || stored.V != 2 || stored.CT == "" {
+		return privateBinResponse{}, storage.ErrNotFoundID
+	}
+
+	if paste.OneUse {
+		if _, err := data.db(req).PasteView(paste.ID); err != nil {
+			return privateBinResponse{}, err
+		}
+	}
+
+	meta := &privateBinMeta{Created: paste.CreateTime}
+	if paste.DeleteTime > 0 {
+		meta.TimeToLive = max(paste.DeleteTime-time.Now().Unix(), 0)
+	}
+	comments, commentCount := []struct{}{}, 0
+	return privateBinResponse{
+		ID:              paste.ID,
+		URL:             "/?" + paste.ID,
+		privateBinPaste: &stored,
+		Meta:            meta,
+		Comments:        &comments,
+		CommentCount:    &commentCount,
+	}, nil
+}
@@ -0,0 +1,77 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package apiv1
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+
+	"github.com/casjay-forks/caspaste/src/audit"
+	"github.com/casjay-forks/caspaste/src/netshare"
+)
+
+// reportMaxBytes bounds the body of a report request
+const reportMaxBytes = 16 << 10
+
+type reportRequest struct {
+	Reason string `json:"reason"`
+	Email  string `json:"email"`
+}
+
+type reportAnswer struct {
+	ID      string `json:"id"`
+	PasteID string `json:"paste_id"`
+	State   string `json:"state"`
+	// True when a ticket is being emailed to the abuse address
+	Ticket bool `json:"ticket"`
+}
+
+// POST /api/v1/pastes/{id}/report - report a paste {"reason", "email"}
+func (data *Data) handleReport(rw http.ResponseWriter, req *http.Request, pasteID string) error {
+	if req.Method != "POST" {
+		return netshare.ErrMethodNotAllowed
+	}
+	if data.Abuse == nil {
+		return netshare.ErrNotFound
+	}
+
+	// Reports may open tickets by email, so they are limited like new pastes
+	ip := netshare.GetClientAddr(req)
+	if err := data.RateLimitNew.CheckAndUse(ip); err != nil {
+		return err
+	}
+
+	var report reportRequest
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if mediaType == "application/json" {
+		if err := json.NewDecoder(http.MaxBytesReader(nil, req.Body, reportMaxBytes)).Decode(&report); err != nil {
+			return netshare.ErrBadRequest
+		}
+	} else {
+		req.Body = http.MaxBytesReader(nil, req.Body, reportMaxBytes)
+		if err := req.ParseForm(); err != nil {
+			return netshare.ErrBadRequest
+		}
+		report.Reason = req.PostForm.Get("reason")
+		report.Email = req.PostForm.Get("email")
+	}
+
+	r, err := data.Abuse.Report(pasteID, report.Reason, report.Email, ip.String())
+	if err != nil {
+		return err
+	}
+	audit.AbuseReport(audit.EventPasteReported, "anonymous", r.ID, r.PasteID, ip.String())
+
+	answer := reportAnswer{
+		ID:      r.ID,
+		PasteID: r.PasteID,
+		State:   r.State,
+		Ticket:  r.Ticket != "",
+	}
+	return writeSuccess(rw, req, answer, "Report received", "")
+}
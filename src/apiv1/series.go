@@ -0,0 +1,112 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package apiv1
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/casjay-forks/caspaste/src/netshare"
+	"github.com/casjay-forks/caspaste/src/storage"
+)
+
+var errSeriesNotFound = errors.New("Series not found")
+
+type seriesAnswer struct {
+	ID         string             `json:"id"`
+	CreateTime int64              `json:"createTime"`
+	Parts      []seriesPartAnswer `json:"parts"`
+}
+
+type seriesPartAnswer struct {
+	storage.SeriesPart
+	URL string `json:"url"`
+}
+
+// seriesPath returns the ID of a /api/v1/series/{id} path
+func seriesPath(path, apiBase string) (string, bool) {
+	id, ok := strings.CutPrefix(path, apiBase+"/series/")
+	if !ok || id == "" || strings.Contains(id, "/") {
+		return "", false
+	}
+	return id, true
+}
+
+// seriesAdd puts a newly created paste in a series, as asked by the form
+// fields of POST /api/v1/pastes:
+//
+//	series=new                - start a series with the paste as part 1
+//	series={id}&seriesKey={k} - append the paste to series {id}
+//
+// It returns the series and part, and the key of a new series. The paste
+// is deleted again when it cannot be added
+func (data *Data) seriesAdd(req *http.Request, pasteID string) (string, int, string, error) {
+	db := data.db(req)
+	seriesID := strings.TrimSpace(req.FormValue("series"))
+	switch seriesID {
+	case "":
+		return "", 0, "", nil
+	case "new":
+		key, err := db.SeriesStart(pasteID)
+		if err != nil {
+			db.PasteDelete(pasteID)
+			return "", 0, "", err
+		}
+		return pasteID, 1, key, nil
+	}
+
+	part, err := db.SeriesAppend(seriesID, req.FormValue("seriesKey"), pasteID)
+	if err != nil {
+		db.PasteDelete(pasteID)
+		if err == storage.ErrNotFoundID {
+			return "", 0, "", errSeriesNotFound
+		}
+		return "", 0, "", err
+	}
+	return seriesID, part, "", nil
+}
+
+// GET /api/v1/series/{id} - the parts of a series, in order
+// GET /api/v1/pastes/{id}/series - the series paste {id} is part of
+func (data *Data) handleSeries(rw http.ResponseWriter, req *http.Request, id string, byPaste bool) error {
+	if req.Method != "GET" {
+		return netshare.ErrMethodNotAllowed
+	}
+	if err := data.RateLimitGet.CheckAndUse(netshare.GetClientAddr(req)); err != nil {
+		return err
+	}
+
+	db := data.db(req)
+	if byPaste {
+		paste, err := db.PasteGet(id)
+		if err != nil {
+			return err
+		}
+		if paste.Series == "" {
+			return errSeriesNotFound
+		}
+		id = paste.Series
+	}
+	series, err := db.SeriesGet(id)
+	if err == storage.ErrNotFoundID {
+		return errSeriesNotFound
+	} else if err != nil {
+		return err
+	}
+
+	answer := seriesAnswer{ID: series.ID, CreateTime: series.CreateTime}
+	var textBuilder strings.Builder
+	fmt.Fprintf(&textBuilder, "id: %s\n", series.ID)
+	for _, part := range series.Parts {
+		url := netshare.BuildPasteURL(req, part.ID)
+		answer.Parts = append(answer.Parts, seriesPartAnswer{SeriesPart: part, URL: url})
+		fmt.Fprintf(&textBuilder, "part %d: %s\n", part.Part, url)
+	}
+
+	return writeSuccess(rw, req, answer, "Series", textBuilder.String())
+}
@@ -10,13 +10,21 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/casjay-forks/caspaste/src/config"
+	"github.com/casjay-forks/caspaste/src/content"
+	"github.com/casjay-forks/caspaste/src/directory"
 	"github.com/casjay-forks/caspaste/src/netshare"
+	"github.com/casjay-forks/caspaste/src/storage"
+	"github.com/casjay-forks/caspaste/src/token"
 )
 
 type serverInfoType struct {
 	Software          string   `json:"software"`
 	Version           string   `json:"version"`
+	APIVersion        string   `json:"apiVersion"`
+	MinClientVersion  string   `json:"minClientVersion"`
 	TitleMaxLen       int      `json:"titleMaxlength"`
 	BodyMaxLen        int      `json:"bodyMaxlength"`
 	MaxLifeTime       int64    `json:"maxLifeTime"`
@@ -41,12 +49,14 @@ func (data *Data) handleServerInfo(rw http.ResponseWriter, req *http.Request) er
 	serverInfo := serverInfoType{
 		Software:          "CasPaste",
 		Version:           data.Version,
+		APIVersion:        config.APIVersion(),
+		MinClientVersion:  config.MinClientVersion,
 		TitleMaxLen:       data.TitleMaxLen,
 		BodyMaxLen:        data.BodyMaxLen,
 		MaxLifeTime:       data.MaxLifeTime,
-		ServerAbout:       data.ServerAbout,
-		ServerRules:       data.ServerRules,
-		ServerTermsOfUse:  data.ServerTermsOfUse,
+		ServerAbout:       data.Content.Get(content.About).Text,
+		ServerRules:       data.Content.Get(content.Rules).Text,
+		ServerTermsOfUse:  data.Content.Get(content.Terms).Text,
 		AdminName:         data.AdminName,
 		AdminMail:         data.AdminMail,
 		Syntaxes:          data.Lexers,
@@ -58,6 +68,8 @@ func (data *Data) handleServerInfo(rw http.ResponseWriter, req *http.Request) er
 	var textBuilder strings.Builder
 	fmt.Fprintf(&textBuilder, "software: %s\n", serverInfo.Software)
 	fmt.Fprintf(&textBuilder, "version: %s\n", serverInfo.Version)
+	fmt.Fprintf(&textBuilder, "apiVersion: %s\n", serverInfo.APIVersion)
+	fmt.Fprintf(&textBuilder, "minClientVersion: %s\n", serverInfo.MinClientVersion)
 	fmt.Fprintf(&textBuilder, "titleMaxLength: %d\n", serverInfo.TitleMaxLen)
 	fmt.Fprintf(&textBuilder, "bodyMaxLength: %d\n", serverInfo.BodyMaxLen)
 	fmt.Fprintf(&textBuilder, "maxLifeTime: %d\n", serverInfo.MaxLifeTime)
@@ -68,3 +80,86 @@ func (data *Data) handleServerInfo(rw http.ResponseWriter, req *http.Request) er
 	// Return response with content negotiation per AI.md PART 14, 16
 	return writeSuccess(rw, req, serverInfo, "Server info", textBuilder.String())
 }
+
+type serverStatsType struct {
+	Version string             `json:"version"`
+	Uptime  int64              `json:"uptime"`
+	Pastes  storage.PasteStats `json:"pastes"`
+}
+
+// GET /api/v1/server/info/stats - paste counts for monitoring tools
+// Private instances need Basic auth or an API token with the status:read scope
+func (data *Data) handleServerStats(rw http.ResponseWriter, req *http.Request) error {
+	// Check method
+	if req.Method != "GET" {
+		return netshare.ErrMethodNotAllowed
+	}
+
+	// Monitoring tokens skip Basic auth
+	if data.Tokens == nil || !data.Tokens.Authorize(req, token.ScopeStatusRead) {
+		if err := data.checkAuth(rw, req); err != nil {
+			return err
+		}
+	}
+
+	pastes, err := data.db(req).PasteStats()
+	if err != nil {
+		return err
+	}
+	stats := serverStatsType{
+		Version: data.Version,
+		Uptime:  int64(time.Since(startTime).Seconds()),
+		Pastes:  pastes,
+	}
+
+	// Build text representation for plain text response
+	var textBuilder strings.Builder
+	fmt.Fprintf(&textBuilder, "version: %s\n", stats.Version)
+	fmt.Fprintf(&textBuilder, "uptime: %d\n", stats.Uptime)
+	fmt.Fprintf(&textBuilder, "pastes: %d\n", pastes.Total)
+	fmt.Fprintf(&textBuilder, "private: %d\n", pastes.Private)
+	fmt.Fprintf(&textBuilder, "oneUse: %d\n", pastes.OneUse)
+	fmt.Fprintf(&textBuilder, "files: %d\n", pastes.Files)
+	fmt.Fprintf(&textBuilder, "urls: %d\n", pastes.URLs)
+	fmt.Fprintf(&textBuilder, "bytes: %d\n", pastes.Bytes)
+
+	// Return response with content negotiation per AI.md PART 14, 16
+	return writeSuccess(rw, req, stats, "Server stats", textBuilder.String())
+}
+
+type serverPeersType struct {
+	// False when the server has no instance directory configured
+	Enabled bool `json:"enabled"`
+	// When the list was fetched from the directory; 0 = not yet
+	Updated int64             `json:"updated"`
+	Servers []directory.Entry `json:"servers"`
+}
+
+// GET /api/v1/server/peers - public instances from the instance directory
+func (data *Data) handleServerPeers(rw http.ResponseWriter, req *http.Request) error {
+	// Check method
+	if req.Method != "GET" {
+		return netshare.ErrMethodNotAllowed
+	}
+
+	peers := serverPeersType{Servers: []directory.Entry{}}
+	if data.Directory != nil {
+		servers, updated := data.Directory.Peers()
+		peers.Enabled = true
+		if servers != nil {
+			peers.Servers = servers
+		}
+		if !updated.IsZero() {
+			peers.Updated = updated.Unix()
+		}
+	}
+
+	// Build text representation for plain text response
+	var textBuilder strings.Builder
+	for _, peer := range peers.Servers {
+		fmt.Fprintf(&textBuilder, "%s\t%s\n", peer.URL, peer.Name)
+	}
+
+	// Return response with content negotiation per AI.md PART 14, 16
+	return writeSuccess(rw, req, peers, "Server peers", textBuilder.String())
+}
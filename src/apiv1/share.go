@@ -0,0 +1,141 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package apiv1
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/cli"
+	"github.com/casjay-forks/caspaste/src/netshare"
+	"github.com/casjay-forks/caspaste/src/storage"
+	"github.com/casjay-forks/caspaste/src/web"
+)
+
+// Share links last an hour unless the caller asks otherwise
+const defaultShareLinkTTL = time.Hour
+
+type shareLinkAnswer struct {
+	storage.ShareLink
+	Token string `json:"token"`
+	URL   string `json:"url"`
+}
+
+// GET|POST|DELETE /api/v1/pastes/{id}/share - time-limited links to a paste
+// POST creates a link (form field ttl, e.g. "30m", "1h", "7d"; default 1h),
+// GET lists the links and DELETE ?link={link id} revokes one
+// Listing and revoking need a user: the paste author sees every link, others
+// only the links they created
+func (data *Data) handleShare(rw http.ResponseWriter, req *http.Request, id string) error {
+	var user string
+	var err error
+	if _, _, ok := req.BasicAuth(); ok {
+		if user, err = data.basicAuthUser(rw, req); err != nil {
+			return err
+		}
+	} else if sessionUser, ok := web.SessionUser(req); ok {
+		user = sessionUser
+	} else if err = data.checkAuth(rw, req); err != nil {
+		// Check auth (required when server.public=false)
+		return err
+	}
+
+	switch req.Method {
+	case "POST":
+		return data.handleShareCreate(rw, req, id, user)
+	case "GET", "DELETE":
+		if user == "" {
+			return netshare.ErrUnauthorized
+		}
+	default:
+		return netshare.ErrMethodNotAllowed
+	}
+
+	paste, err := data.db(req).PasteGet(id)
+	if err != nil {
+		return err
+	}
+	links, err := data.db(req).ShareLinkList(paste.ID)
+	if err != nil {
+		return err
+	}
+	if paste.Author != user {
+		own := []storage.ShareLink{}
+		for _, link := range links {
+			if link.CreatedBy == user {
+				own = append(own, link)
+			}
+		}
+		links = own
+	}
+
+	if req.Method == "DELETE" {
+		linkID := req.URL.Query().Get("link")
+		for _, link := range links {
+			if link.ID == linkID {
+				if err := data.db(req).ShareLinkDelete(paste.ID, linkID); err != nil {
+					return err
+				}
+				return writeSuccess(rw, req, link, "Share link revoked", "revoked: "+linkID+"\n")
+			}
+		}
+		return storage.ErrShareLinkNotFound
+	}
+
+	var textBuilder strings.Builder
+	for _, link := range links {
+		fmt.Fprintf(&textBuilder, "%s\texpires %s\t%s\n", link.ID, time.Unix(link.ExpiresAt, 0).UTC().Format(time.RFC3339), link.CreatedBy)
+	}
+	msg := fmt.Sprintf("%d share links found", len(links))
+	return writeSuccess(rw, req, links, msg, textBuilder.String())
+}
+
+func (data *Data) handleShareCreate(rw http.ResponseWriter, req *http.Request, id, user string) error {
+	if err := data.RateLimitGet.CheckAndUse(netshare.GetClientAddr(req)); err != nil {
+		return err
+	}
+	if err := req.ParseForm(); err != nil {
+		return netshare.ErrBadRequest
+	}
+
+	ttl := defaultShareLinkTTL
+	if ttlStr := req.PostForm.Get("ttl"); ttlStr != "" {
+		var err error
+		ttl, err = cli.ParseDuration(ttlStr)
+		if err != nil || ttl <= 0 || ttl > storage.ShareLinkMaxTTL {
+			return netshare.ErrBadRequest
+		}
+	}
+
+	paste, err := data.db(req).PasteGet(id)
+	if err != nil {
+		return err
+	}
+	// A short URL is opened through /u/, which a share link does not cover
+	if paste.IsURL {
+		return netshare.ErrBadRequest
+	}
+
+	token, link, err := data.db(req).ShareLinkAdd(paste.ID, user, ttl)
+	if err != nil {
+		return err
+	}
+
+	answer := shareLinkAnswer{
+		ShareLink: link,
+		Token:     token,
+		URL:       netshare.BuildPasteURL(req, "s/"+token),
+	}
+
+	var textBuilder strings.Builder
+	fmt.Fprintf(&textBuilder, "id: %s\n", answer.ID)
+	fmt.Fprintf(&textBuilder, "url: %s\n", answer.URL)
+	fmt.Fprintf(&textBuilder, "expiresAt: %d\n", answer.ExpiresAt)
+
+	return writeSuccess(rw, req, answer, "Share link created", textBuilder.String())
+}
@@ -0,0 +1,177 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package apiv1
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/netshare"
+	"github.com/casjay-forks/caspaste/src/raw"
+	"github.com/casjay-forks/caspaste/src/storage"
+	"github.com/casjay-forks/caspaste/src/token"
+	"github.com/casjay-forks/caspaste/src/web"
+)
+
+// GET /api/v1/pastes/{id}/signature - PGP signature of a paste and whether
+// it matches; does not count a view
+// DELETE /api/v1/pastes/{id}/signature - remove it (Basic auth or a
+// read-write token)
+// A signature is attached with the signature and publicKey fields when a
+// paste is created or updated
+func (data *Data) handleSignature(rw http.ResponseWriter, req *http.Request, id string) error {
+	switch req.Method {
+	case "GET":
+		if err := data.checkAuth(rw, req); err != nil {
+			return err
+		}
+		if err := data.RateLimitGet.CheckAndUse(netshare.GetClientAddr(req)); err != nil {
+			return err
+		}
+
+		paste, err := data.db(req).PasteGet(id)
+		if err != nil {
+			return err
+		}
+		status, err := data.db(req).PasteSignatureGet(paste.ID, raw.Content(paste))
+		if err != nil {
+			return err
+		}
+		if status == nil {
+			return netshare.ErrNotFound
+		}
+		return writeSuccess(rw, req, status, "Paste signature", signatureText(status))
+
+	case "DELETE":
+		if data.Tokens == nil || !data.Tokens.Authorize(req, token.ScopeReadWrite) {
+			if _, err := data.basicAuthUser(rw, req); err != nil {
+				return err
+			}
+		}
+		if _, err := data.db(req).PasteGet(id); err != nil {
+			return err
+		}
+		if err := data.db(req).PasteSignatureDelete(id); err != nil {
+			return err
+		}
+		return writeSuccess(rw, req, nil, "Signature removed", "")
+
+	default:
+		return netshare.ErrMethodNotAllowed
+	}
+}
+
+// signatureText is the text answer for a signature status
+func signatureText(status *storage.SignatureStatus) string {
+	var textBuilder strings.Builder
+	fmt.Fprintf(&textBuilder, "status: %s\n", status.Status)
+	if status.Fingerprint != "" {
+		fmt.Fprintf(&textBuilder, "fingerprint: %s\n", status.Fingerprint)
+	}
+	for _, uid := range status.UserIDs {
+		fmt.Fprintf(&textBuilder, "uid: %s\n", uid)
+	}
+	if status.Owner != "" {
+		fmt.Fprintf(&textBuilder, "owner: %s\n", status.Owner)
+	}
+	if status.SignedAt > 0 {
+		fmt.Fprintf(&textBuilder, "signedAt: %s\n", time.Unix(status.SignedAt, 0).UTC().Format(time.RFC3339))
+	}
+	return textBuilder.String()
+}
+
+type pgpKeysAnswer struct {
+	// Text to sign with a key to register it
+	Challenge string           `json:"challenge"`
+	Keys      []storage.PGPKey `json:"keys"`
+}
+
+// GET /api/v1/users/pgp-keys - PGP keys of the logged-in user, and the
+// challenge to sign to register another
+// POST /api/v1/users/pgp-keys - register a key: publicKey (armored) and
+// proof, a detached signature of the challenge made with it
+// Pastes signed with a registered key show its owner, and need not carry
+// the key
+func (data *Data) handlePGPKeys(rw http.ResponseWriter, req *http.Request) error {
+	owner, err := data.pgpKeyOwner(rw, req)
+	if err != nil {
+		return err
+	}
+
+	switch req.Method {
+	case "GET":
+		keys, err := data.db(req).PGPKeyList(owner)
+		if err != nil {
+			return err
+		}
+		answer := pgpKeysAnswer{Challenge: storage.PGPKeyChallenge(owner), Keys: keys}
+
+		var textBuilder strings.Builder
+		fmt.Fprintf(&textBuilder, "challenge: %s\n", answer.Challenge)
+		for _, k := range keys {
+			fmt.Fprintf(&textBuilder, "%s\t%s\n", k.Fingerprint, strings.Join(k.UserIDs, ", "))
+		}
+		return writeSuccess(rw, req, answer, fmt.Sprintf("%d PGP keys", len(keys)), textBuilder.String())
+
+	case "POST":
+		req.Body = http.MaxBytesReader(rw, req.Body, 128<<10)
+		if err := req.ParseForm(); err != nil {
+			return netshare.ErrPayloadTooLarge
+		}
+		publicKey, proof := req.PostForm.Get("publicKey"), req.PostForm.Get("proof")
+		if publicKey == "" || proof == "" {
+			return netshare.ErrBadRequest
+		}
+		key, err := data.db(req).PGPKeyAdd(owner, publicKey, proof)
+		if err != nil {
+			return err
+		}
+		return writeSuccess(rw, req, key, "PGP key registered", "fingerprint: "+key.Fingerprint+"\n")
+
+	default:
+		return netshare.ErrMethodNotAllowed
+	}
+}
+
+// DELETE /api/v1/users/pgp-keys/{fingerprint} - remove a key of the
+// logged-in user
+func (data *Data) handlePGPKey(rw http.ResponseWriter, req *http.Request, fingerprint string) error {
+	owner, err := data.pgpKeyOwner(rw, req)
+	if err != nil {
+		return err
+	}
+	if req.Method != "DELETE" {
+		return netshare.ErrMethodNotAllowed
+	}
+	if err := data.db(req).PGPKeyDelete(owner, fingerprint); err != nil {
+		return err
+	}
+	return writeSuccess(rw, req, nil, "PGP key removed", "")
+}
+
+// pgpKeyOwner returns the user whose keys a request manages: the web
+// session's, or the Basic auth one's
+func (data *Data) pgpKeyOwner(rw http.ResponseWriter, req *http.Request) (string, error) {
+	if err := data.RateLimitGet.CheckAndUse(netshare.GetClientAddr(req)); err != nil {
+		return "", err
+	}
+
+	if user, ok := web.SessionUser(req); ok {
+		return user, nil
+	}
+	return data.basicAuthUser(rw, req)
+}
+
+// pgpKeyPath returns the fingerprint of /api/v1/users/pgp-keys/{fingerprint}
+func pgpKeyPath(path, apiBase string) (string, bool) {
+	fingerprint, ok := strings.CutPrefix(path, apiBase+"/users/pgp-keys/")
+	if !ok || fingerprint == "" || strings.Contains(fingerprint, "/") {
+		return "", false
+	}
+	return fingerprint, true
+}
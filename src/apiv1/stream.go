@@ -0,0 +1,60 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package apiv1
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/netshare"
+)
+
+// streamUploadTimeout replaces the server's read and write timeouts for a
+// streamed upload, which takes as long as the client needs to send it
+const streamUploadTimeout = time.Hour
+
+// POST /api/v1/pastes/stream - create a paste from a streamed body
+// The body (plain or chunked) is the paste, or the "file" part of a
+// multipart form; it goes straight to the blob store, up to
+// database.bodies.stream_max_size bytes. Fields are query parameters
+func (data *Data) handleStream(rw http.ResponseWriter, req *http.Request) error {
+	if data.StreamMaxSize <= 0 {
+		return netshare.ErrNotFound
+	}
+
+	// Check auth (required when server.public=false)
+	if err := data.checkAuth(rw, req); err != nil {
+		return err
+	}
+
+	// The server's timeouts are meant for form posts; errors mean the
+	// connection cannot change them, and the upload then has the usual limits
+	rc := http.NewResponseController(rw)
+	rc.SetReadDeadline(time.Now().Add(streamUploadTimeout))
+	rc.SetWriteDeadline(time.Now().Add(streamUploadTimeout))
+
+	pasteID, createTime, deleteTime, err := netshare.PasteAddFromStream(req, data.db(req), data.RateLimitNew, data.TitleMaxLen, data.StreamMaxSize, data.MaxLifeTime, data.Lexers)
+	if err != nil {
+		return err
+	}
+
+	answer := newPasteAnswer{
+		ID:         pasteID,
+		URL:        netshare.BuildPasteURL(req, pasteID),
+		CreateTime: createTime,
+		DeleteTime: deleteTime,
+	}
+
+	var textBuilder strings.Builder
+	fmt.Fprintf(&textBuilder, "id: %s\n", answer.ID)
+	fmt.Fprintf(&textBuilder, "url: %s\n", answer.URL)
+	fmt.Fprintf(&textBuilder, "createTime: %d\n", answer.CreateTime)
+	fmt.Fprintf(&textBuilder, "deleteTime: %d\n", answer.DeleteTime)
+
+	return writeSuccess(rw, req, answer, "Paste created", textBuilder.String())
+}
@@ -0,0 +1,55 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package apiv1
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/casjay-forks/caspaste/src/netshare"
+	"github.com/casjay-forks/caspaste/src/storage"
+)
+
+// GET /api/v1/templates - list paste templates
+// GET /api/v1/templates?name=X - get one template
+func (data *Data) handleTemplates(rw http.ResponseWriter, req *http.Request) error {
+	if req.Method != "GET" {
+		return netshare.ErrMethodNotAllowed
+	}
+
+	// Check rate limit
+	err := data.RateLimitGet.CheckAndUse(netshare.GetClientAddr(req))
+	if err != nil {
+		return err
+	}
+
+	if name := req.URL.Query().Get("name"); name != "" {
+		tmpl, err := data.db(req).TemplateGet(name)
+		if err == storage.ErrTemplateNotFound {
+			return netshare.ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		// For text format, return the body skeleton
+		return writeSuccess(rw, req, tmpl, "Template retrieved", tmpl.Body)
+	}
+
+	templates, err := data.db(req).TemplateList()
+	if err != nil {
+		return err
+	}
+
+	var textBuilder strings.Builder
+	for _, t := range templates {
+		fmt.Fprintf(&textBuilder, "%s\t%s\n", t.Name, t.Description)
+	}
+
+	msg := fmt.Sprintf("%d templates found", len(templates))
+	return writeSuccess(rw, req, templates, msg, textBuilder.String())
+}
@@ -0,0 +1,116 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package apiv1
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/casjay-forks/caspaste/src/audit"
+	"github.com/casjay-forks/caspaste/src/netshare"
+	"github.com/casjay-forks/caspaste/src/redact"
+	"github.com/casjay-forks/caspaste/src/storage"
+	"github.com/casjay-forks/caspaste/src/token"
+)
+
+type updatePasteAnswer struct {
+	ID         string `json:"id"`
+	URL        string `json:"url"`
+	Title      string `json:"title"`
+	Syntax     string `json:"syntax"`
+	DeleteTime int64  `json:"deleteTime"`
+	// Fields that changed (empty when the form matched the paste)
+	Changed []string `json:"changed"`
+	// What the server redacted before storage (omitted when redaction did not run)
+	Redaction *redact.Report `json:"redaction,omitempty"`
+}
+
+// handlePaste handles /api/v1/pastes/{id}
+// PUT, PATCH - update a paste; needs Basic auth or an API token with the read-write scope
+func (data *Data) handlePaste(rw http.ResponseWriter, req *http.Request, id string) error {
+	switch req.Method {
+	case "PUT", "PATCH":
+		return data.updatePaste(rw, req, id, true)
+	default:
+		return netshare.ErrMethodNotAllowed
+	}
+}
+
+// updatePaste changes the title, body, syntax or expiration of a paste
+// Form fields left out are kept
+// The server's owners (Basic auth or a read-write token) may change any paste and its
+// expiration; anyone else only pastes created as editable, and only when ownerOnly is false
+func (data *Data) updatePaste(rw http.ResponseWriter, req *http.Request, id string, ownerOnly bool) error {
+	// Tokens skip Basic auth
+	var user string
+	var err error
+	if data.Tokens != nil && data.Tokens.Authorize(req, token.ScopeReadWrite) {
+		user = "token"
+	} else if _, _, ok := req.BasicAuth(); ok || ownerOnly {
+		if user, err = data.basicAuthUser(rw, req); err != nil {
+			return err
+		}
+	} else if err = data.checkAuth(rw, req); err != nil {
+		// Check auth (required when server.public=false)
+		return err
+	}
+
+	if id == "" {
+		return netshare.ErrBadRequest
+	}
+
+	ip := netshare.GetClientAddr(req).String()
+	paste, changed, report, err := netshare.PasteUpdateFromForm(req, id, user != "", data.db(req), data.RateLimitNew, data.TitleMaxLen, data.BodyMaxLen, data.MaxLifeTime, data.Lexers, data.Redaction)
+	if err == storage.ErrWORM || err == storage.ErrLegalHold {
+		// Record tampering attempts on write-once pastes
+		audit.PasteModifyDenied(id, "edit", ip, rw.Header().Get("X-Request-ID"))
+	}
+	if err != nil {
+		return err
+	}
+	if len(changed) > 0 {
+		audit.PasteUpdated(id, user, changed, ip, rw.Header().Get("X-Request-ID"))
+	}
+
+	answer := updatePasteAnswer{
+		ID:         paste.ID,
+		URL:        netshare.BuildPasteURL(req, paste.ID),
+		Title:      paste.Title,
+		Syntax:     paste.Syntax,
+		DeleteTime: paste.DeleteTime,
+		Changed:    changed,
+		Redaction:  report,
+	}
+	if answer.Changed == nil {
+		answer.Changed = []string{}
+	}
+
+	var textBuilder strings.Builder
+	fmt.Fprintf(&textBuilder, "id: %s\n", answer.ID)
+	fmt.Fprintf(&textBuilder, "url: %s\n", answer.URL)
+	fmt.Fprintf(&textBuilder, "deleteTime: %d\n", answer.DeleteTime)
+	fmt.Fprintf(&textBuilder, "changed: %s\n", strings.Join(answer.Changed, ","))
+	if report != nil {
+		fmt.Fprintf(&textBuilder, "redacted: %s\n", report)
+	}
+
+	msg := "Paste updated"
+	if len(changed) == 0 {
+		msg = "No changes"
+	}
+	return writeSuccess(rw, req, answer, msg, textBuilder.String())
+}
+
+// pastePath returns the paste ID of /api/v1/pastes/{id}
+func pastePath(path, apiBase string) (string, bool) {
+	id, ok := strings.CutPrefix(path, apiBase+"/pastes/")
+	if !ok || id == "" || strings.Contains(id, "/") {
+		return "", false
+	}
+	return id, true
+}
@@ -0,0 +1,80 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package apiv1
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/casjay-forks/caspaste/src/netshare"
+	"github.com/casjay-forks/caspaste/src/raw"
+)
+
+type verifyAnswer struct {
+	ID        string `json:"id"`
+	Algorithm string `json:"algorithm"`
+	// Hex SHA-256 of the content /raw/{id} serves
+	Digest string `json:"digest"`
+	Size   int    `json:"size"`
+	// false when the stored body no longer matches the checksum recorded
+	// when it was written
+	Intact bool `json:"intact"`
+	// Whether the sha256 parameter matches Digest; omitted without it
+	Match *bool `json:"match,omitempty"`
+}
+
+// GET /api/v1/pastes/{id}/verify[?sha256={hex}] - checksum of a paste
+// Reports the SHA-256 of the content /raw/{id} serves (also sent there in
+// the Repr-Digest header) without counting a view, so a client can check a
+// download before or after it reads a burn-after-reading paste
+func (data *Data) handleVerify(rw http.ResponseWriter, req *http.Request, id string) error {
+	if req.Method != "GET" {
+		return netshare.ErrMethodNotAllowed
+	}
+
+	// Check auth (required when server.public=false)
+	if err := data.checkAuth(rw, req); err != nil {
+		return err
+	}
+
+	if err := data.RateLimitGet.CheckAndUse(netshare.GetClientAddr(req)); err != nil {
+		return err
+	}
+
+	paste, err := data.db(req).PasteGet(id)
+	if err != nil {
+		return err
+	}
+	intact, err := data.db(req).PasteBodyIntact(paste)
+	if err != nil {
+		return err
+	}
+
+	content := raw.Content(paste)
+	answer := verifyAnswer{
+		ID:        paste.ID,
+		Algorithm: "sha-256",
+		Digest:    raw.Digest(content),
+		Size:      len(content),
+		Intact:    intact,
+	}
+	if sum := req.URL.Query().Get("sha256"); sum != "" {
+		match := strings.EqualFold(sum, answer.Digest)
+		answer.Match = &match
+	}
+
+	var textBuilder strings.Builder
+	fmt.Fprintf(&textBuilder, "id: %s\n", answer.ID)
+	fmt.Fprintf(&textBuilder, "sha256: %s\n", answer.Digest)
+	fmt.Fprintf(&textBuilder, "size: %d\n", answer.Size)
+	fmt.Fprintf(&textBuilder, "intact: %t\n", answer.Intact)
+	if answer.Match != nil {
+		fmt.Fprintf(&textBuilder, "match: %t\n", *answer.Match)
+	}
+
+	return writeSuccess(rw, req, answer, "Paste checksum", textBuilder.String())
+}
@@ -0,0 +1,364 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+// Package archive renders the public paste corpus to a static HTML and raw-file tree
+// The tree can be served by any static web server or uploaded to archive.org
+package archive
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/storage"
+)
+
+// ManifestFile records what was exported so later runs can be incremental
+const ManifestFile = "manifest.json"
+
+// pageSize is how many pastes are read from the database at a time
+const pageSize = 200
+
+// idRegex limits paste IDs to names that are safe as file names
+var idRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ErrNoDir is returned when no output directory is given
+var ErrNoDir = errors.New("archive: output directory required")
+
+// Options controls an export
+type Options struct {
+	// Output directory
+	Dir string
+	// Only rewrite pastes that are new or changed since the last export
+	Incremental bool
+	// Remove pastes that are no longer public; otherwise the archive keeps them
+	Prune bool
+	// Site title used in page headers (default: CasPaste)
+	Title string
+}
+
+// Result summarises an export
+type Result struct {
+	Total     int
+	Written   int
+	Unchanged int
+	// Paths (relative to Dir) written or removed by this run, for syncing elsewhere
+	Changed []string
+	Removed []string
+}
+
+// Entry describes one exported paste in the manifest
+type Entry struct {
+	ID         string `json:"id"`
+	Title      string `json:"title"`
+	Syntax     string `json:"syntax"`
+	FileName   string `json:"file_name,omitempty"`
+	CreateTime int64  `json:"create_time"`
+	SHA256     string `json:"sha256"`
+}
+
+// Manifest is the index of an exported tree
+type Manifest struct {
+	GeneratedAt int64            `json:"generated_at"`
+	Pastes      map[string]Entry `json:"pastes"`
+}
+
+// Export renders every public paste into opts.Dir
+//
+//	index.html      list of pastes, newest first
+//	p/{id}.html     paste page
+//	raw/{id}        raw paste content
+//	manifest.json   export index used for incremental runs
+func Export(db storage.DB, opts Options) (*Result, error) {
+	if opts.Dir == "" {
+		return nil, ErrNoDir
+	}
+	if opts.Title == "" {
+		opts.Title = "CasPaste"
+	}
+	for _, dir := range []string{opts.Dir, filepath.Join(opts.Dir, "p"), filepath.Join(opts.Dir, "raw")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	previous, err := LoadManifest(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{}
+	current := &Manifest{Pastes: make(map[string]Entry)}
+
+	for offset := 0; ; offset += pageSize {
+		pastes, err := db.PasteListPublic(pageSize, offset)
+		if err != nil {
+			return result, err
+		}
+
+		for _, paste := range pastes {
+			if !idRegex.MatchString(paste.ID) {
+				continue
+			}
+			result.Total++
+
+			content := pasteContent(paste)
+			entry := Entry{
+				ID:         paste.ID,
+				Title:      paste.Title,
+				Syntax:     paste.Syntax,
+				FileName:   paste.FileName,
+				CreateTime: paste.CreateTime,
+				SHA256:     contentHash(paste, content),
+			}
+			current.Pastes[paste.ID] = entry
+
+			if old, ok := previous.Pastes[paste.ID]; opts.Incremental && ok && old.SHA256 == entry.SHA256 && exists(opts.Dir, pagePath(paste.ID)) {
+				result.Unchanged++
+				continue
+			}
+
+			if err := writeFile(opts.Dir, rawPath(paste.ID), content); err != nil {
+				return result, err
+			}
+			page, err := renderPaste(opts.Title, paste, content)
+			if err != nil {
+				return result, err
+			}
+			if err := writeFile(opts.Dir, pagePath(paste.ID), page); err != nil {
+				return result, err
+			}
+			result.Written++
+			result.Changed = append(result.Changed, pagePath(paste.ID), rawPath(paste.ID))
+		}
+
+		if len(pastes) < pageSize {
+			break
+		}
+	}
+
+	// Pastes that expired or were deleted since the last run
+	for id, old := range previous.Pastes {
+		if _, ok := current.Pastes[id]; ok {
+			continue
+		}
+		if !opts.Prune {
+			current.Pastes[id] = old
+			continue
+		}
+		for _, rel := range []string{pagePath(id), rawPath(id)} {
+			if err := os.Remove(filepath.Join(opts.Dir, rel)); err != nil && !os.IsNotExist(err) {
+				return result, err
+			}
+			result.Removed = append(result.Removed, rel)
+		}
+	}
+
+	index, err := renderIndex(opts.Title, current)
+	if err != nil {
+		return result, err
+	}
+	if err := writeFile(opts.Dir, "index.html", index); err != nil {
+		return result, err
+	}
+
+	current.GeneratedAt = time.Now().Unix()
+	manifest, err := json.MarshalIndent(current, "", "  ")
+	if err != nil {
+		return result, err
+	}
+	if err := writeFile(opts.Dir, ManifestFile, manifest); err != nil {
+		return result, err
+	}
+	result.Changed = append(result.Changed, "index.html", ManifestFile)
+
+	return result, nil
+}
+
+// LoadManifest reads the manifest of an existing export (empty if there is none)
+func LoadManifest(dir string) (*Manifest, error) {
+	m := &Manifest{Pastes: make(map[string]Entry)}
+
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	if m.Pastes == nil {
+		m.Pastes = make(map[string]Entry)
+	}
+	return m, nil
+}
+
+// sortedEntries returns manifest entries newest first
+func (m *Manifest) sortedEntries() []Entry {
+	entries := make([]Entry, 0, len(m.Pastes))
+	for _, e := range m.Pastes {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].CreateTime != entries[j].CreateTime {
+			return entries[i].CreateTime > entries[j].CreateTime
+		}
+		return entries[i].ID < entries[j].ID
+	})
+	return entries
+}
+
+func pagePath(id string) string {
+	return "p/" + id + ".html"
+}
+
+func rawPath(id string) string {
+	return "raw/" + id
+}
+
+// pasteContent returns the raw bytes of a paste; uploads are stored base64 encoded
+func pasteContent(paste storage.Paste) []byte {
+	if paste.IsFile {
+		if data, err := base64.StdEncoding.DecodeString(paste.Body); err == nil {
+			return data
+		}
+	}
+	return []byte(paste.Body)
+}
+
+// contentHash covers everything that affects the rendered output
+func contentHash(paste storage.Paste, content []byte) string {
+	h := sha256.New()
+	for _, field := range []string{paste.Title, paste.Syntax, paste.Author, paste.AuthorURL, paste.FileName, paste.MimeType} {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+	h.Write(content)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func exists(dir, rel string) bool {
+	_, err := os.Stat(filepath.Join(dir, rel))
+	return err == nil
+}
+
+// writeFile writes atomically so a static server never sees a partial page
+func writeFile(dir, rel string, data []byte) error {
+	path := filepath.Join(dir, filepath.FromSlash(rel))
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Page templates
+
+type pastePage struct {
+	SiteTitle string
+	Paste     storage.Paste
+	Content   string
+	IsBinary  bool
+	Created   string
+}
+
+type indexPage struct {
+	SiteTitle string
+	Generated string
+	Entries   []Entry
+}
+
+var funcs = template.FuncMap{"date": formatDate}
+
+func formatDate(unix int64) string {
+	return time.Unix(unix, 0).UTC().Format("2006-01-02 15:04 MST")
+}
+
+const pageHead = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<style>
+body { font-family: sans-serif; max-width: 960px; margin: 2rem auto; padding: 0 1rem; }
+pre { background: #f6f8fa; padding: 1rem; overflow-x: auto; }
+table { width: 100%; border-collapse: collapse; }
+td, th { text-align: left; padding: 0.4rem; border-bottom: 1px solid #ddd; }
+.meta { color: #666; }
+</style>
+`
+
+var pasteTmpl = template.Must(template.New("paste").Funcs(funcs).Parse(pageHead + `<title>{{if .Paste.Title}}{{.Paste.Title}}{{else}}{{.Paste.ID}}{{end}} | {{.SiteTitle}}</title>
+</head>
+<body>
+<p><a href="../index.html">{{.SiteTitle}} archive</a></p>
+<h1>{{if .Paste.Title}}{{.Paste.Title}}{{else}}{{.Paste.ID}}{{end}}</h1>
+<p class="meta">{{.Created}}{{if .Paste.Syntax}} &middot; {{.Paste.Syntax}}{{end}}{{if .Paste.Author}} &middot; {{.Paste.Author}}{{end}} &middot; <a href="../raw/{{.Paste.ID}}">raw</a></p>
+{{if .IsBinary}}<p>Binary file: <a href="../raw/{{.Paste.ID}}">{{.Paste.FileName}}</a> ({{.Paste.MimeType}})</p>{{else}}<pre>{{.Content}}</pre>{{end}}
+</body>
+</html>
+`))
+
+var indexTmpl = template.Must(template.New("index").Funcs(funcs).Parse(pageHead + `<title>{{.SiteTitle}} archive</title>
+</head>
+<body>
+<h1>{{.SiteTitle}} archive</h1>
+<p class="meta">{{len .Entries}} pastes &middot; generated {{.Generated}}</p>
+<table>
+<thead><tr><th>Title</th><th>Language</th><th>Created</th></tr></thead>
+<tbody>
+{{range .Entries}}<tr><td><a href="p/{{.ID}}.html">{{if .Title}}{{.Title}}{{else}}{{.ID}}{{end}}</a></td><td>{{.Syntax}}</td><td>{{date .CreateTime}}</td></tr>
+{{end}}</tbody>
+</table>
+</body>
+</html>
+`))
+
+func renderPaste(siteTitle string, paste storage.Paste, content []byte) ([]byte, error) {
+	data := pastePage{
+		SiteTitle: siteTitle,
+		Paste:     paste,
+		Created:   formatDate(paste.CreateTime),
+		IsBinary:  paste.IsFile && !isText(paste.MimeType),
+	}
+	if !data.IsBinary {
+		data.Content = string(content)
+	}
+	return render(pasteTmpl, data)
+}
+
+func renderIndex(siteTitle string, m *Manifest) ([]byte, error) {
+	return render(indexTmpl, indexPage{
+		SiteTitle: siteTitle,
+		Generated: time.Now().UTC().Format(time.RFC3339),
+		Entries:   m.sortedEntries(),
+	})
+}
+
+func render(tmpl *template.Template, data interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// isText reports whether an uploaded file can be shown inline
+func isText(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "text/") || mimeType == "application/json" || mimeType == "application/xml"
+}
@@ -0,0 +1,178 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+// Package asciicast reads and writes asciicast v2 terminal recordings
+// See https://docs.asciinema.org/manual/asciicast/v2/
+package asciicast
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Syntax is the paste syntax used for recordings
+const Syntax = "Asciicast"
+
+// MaxSize is the largest terminal accepted in a header
+const MaxSize = 1000
+
+var ErrInvalid = errors.New("asciicast: not a valid asciicast v2 recording")
+
+// Header is the first line of a recording
+type Header struct {
+	Version       int               `json:"version"`
+	Width         int               `json:"width"`
+	Height        int               `json:"height"`
+	Timestamp     int64             `json:"timestamp,omitempty"`
+	Duration      float64           `json:"duration,omitempty"`
+	IdleTimeLimit float64           `json:"idle_time_limit,omitempty"`
+	Command       string            `json:"command,omitempty"`
+	Title         string            `json:"title,omitempty"`
+	Env           map[string]string `json:"env,omitempty"`
+}
+
+// IsCastFile reports whether a file name has the asciicast extension
+func IsCastFile(name string) bool {
+	return strings.EqualFold(filepath.Ext(name), ".cast")
+}
+
+// Parse validates a recording and returns its header
+// Every event line must be [time, type, data] with non-decreasing time
+func Parse(body string) (*Header, error) {
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), len(body)+1)
+
+	var header *Header
+	var last float64
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		if header == nil {
+			header = &Header{}
+			if err := json.Unmarshal([]byte(text), header); err != nil {
+				return nil, ErrInvalid
+			}
+			if header.Version != 2 || header.Width < 1 || header.Height < 1 ||
+				header.Width > MaxSize || header.Height > MaxSize {
+				return nil, ErrInvalid
+			}
+			continue
+		}
+
+		var event []json.RawMessage
+		if err := json.Unmarshal([]byte(text), &event); err != nil || len(event) != 3 {
+			return nil, fmt.Errorf("%w: bad event on line %d", ErrInvalid, line)
+		}
+		var t float64
+		var kind, data string
+		if json.Unmarshal(event[0], &t) != nil || json.Unmarshal(event[1], &kind) != nil ||
+			json.Unmarshal(event[2], &data) != nil || t < last || kind == "" {
+			return nil, fmt.Errorf("%w: bad event on line %d", ErrInvalid, line)
+		}
+		last = t
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if header == nil {
+		return nil, ErrInvalid
+	}
+	return header, nil
+}
+
+// Writer records terminal output as asciicast v2 events
+// It is safe for concurrent use
+type Writer struct {
+	mu      sync.Mutex
+	w       io.Writer
+	start   time.Time
+	pending []byte
+}
+
+// NewWriter writes the header and starts the clock
+func NewWriter(w io.Writer, header Header) (*Writer, error) {
+	header.Version = 2
+	if header.Timestamp == 0 {
+		header.Timestamp = time.Now().Unix()
+	}
+	data, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fmt.Fprintf(w, "%s\n", data); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w, start: time.Now()}, nil
+}
+
+// Write records p as an output event
+// Incomplete UTF-8 sequences are held back until the rest arrives
+func (cw *Writer) Write(p []byte) (int, error) {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	buf := append(cw.pending, p...)
+	cut := len(buf)
+	for i := len(buf) - 1; i >= 0 && i >= len(buf)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(buf[i]) {
+			if !utf8.FullRune(buf[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	cw.pending = append([]byte(nil), buf[cut:]...)
+
+	if cut > 0 {
+		if err := cw.event("o", string(buf[:cut])); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Resize records a terminal resize event
+func (cw *Writer) Resize(width, height int) error {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	return cw.event("r", fmt.Sprintf("%dx%d", width, height))
+}
+
+func (cw *Writer) event(kind, data string) error {
+	payload, err := json.Marshal([]interface{}{
+		float64(time.Since(cw.start).Microseconds()) / 1e6, kind, data,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(cw.w, "%s\n", payload)
+	return err
+}
+
+// Flush records output held back by Write
+func (cw *Writer) Flush() error {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	if len(cw.pending) == 0 {
+		return nil
+	}
+	data := string(cw.pending)
+	cw.pending = nil
+	return cw.event("o", data)
+}
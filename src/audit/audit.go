@@ -13,6 +13,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -37,6 +38,9 @@ const (
 	EventInvalidToken      = "security.invalid_token"
 	EventBruteForceDetect  = "security.brute_force_detected"
 	EventIPBlocked         = "security.ip_blocked"
+	EventIPBanned          = "security.ip_banned"
+	EventIPBanUpdated      = "security.ip_ban_updated"
+	EventIPUnbanned        = "security.ip_unbanned"
 
 	// Server events
 	EventServerStarted     = "server.started"
@@ -51,6 +55,36 @@ const (
 
 	// Config events
 	EventConfigUpdated     = "config.updated"
+
+	// Paste events (WORM mode)
+	EventPasteModifyDenied = "paste.modify_denied"
+	EventPasteLegalHold    = "paste.legal_hold"
+	EventPasteLegalRelease = "paste.legal_hold_released"
+	EventPasteLegalDelete  = "paste.legal_delete"
+
+	// Abuse report events
+	EventPasteReported     = "paste.reported"
+	EventReportResolved    = "paste.report_resolved"
+	EventReportDismissed   = "paste.report_dismissed"
+	EventReportReopened    = "paste.report_reopened"
+
+	// Pinned paste events
+	EventPastePinned       = "paste.pinned"
+	EventPasteUnpinned     = "paste.unpinned"
+
+	// Paste deleted or changed through the API
+	EventPasteDeleted      = "paste.deleted"
+	EventPasteUpdated      = "paste.updated"
+
+	// Paste moderation by an admin
+	EventPasteFrozen       = "paste.frozen"
+	EventPasteUnfrozen     = "paste.unfrozen"
+	EventPasteForceDeleted = "paste.force_deleted"
+	EventPasteBulkDeleted  = "paste.bulk_deleted"
+	EventPasteBulkExpired  = "paste.bulk_expired"
+
+	// Paste held for review by the spam filter
+	EventPasteHeld         = "paste.held"
 )
 
 // Entry represents a single audit log entry per AI.md PART 11
@@ -97,6 +131,10 @@ type Client struct {
 	UserAgent string `json:"user_agent,omitempty"`
 	// Request ID for tracing
 	RequestID string `json:"request_id,omitempty"`
+	// Reputation score of the IP (0-100), when IP reputation is enabled
+	Reputation *int `json:"reputation,omitempty"`
+	// Country code of the IP, when GeoIP is enabled ("XX" = private or unknown)
+	Country string `json:"country,omitempty"`
 }
 
 // Config represents audit log configuration
@@ -111,12 +149,15 @@ type Config struct {
 	MaskEmails bool
 	// IncludeUserAgent includes user agent in client info
 	IncludeUserAgent bool
+	// Writer receives entries instead of the file when set (e.g. stdout in containers)
+	Writer io.Writer
 }
 
 // Logger provides audit logging functionality
 type Logger struct {
 	config Config
 	file   *os.File
+	out    io.Writer
 	mu     sync.Mutex
 }
 
@@ -124,6 +165,12 @@ type Logger struct {
 var globalLogger *Logger
 var globalMu sync.RWMutex
 
+// reputationScore returns the cached reputation score of an IP (nil = none)
+var reputationScore func(ip string) (int, bool)
+
+// countryOf returns the country code of an IP (nil = none)
+var countryOf func(ip string) string
+
 // Init initializes the global audit logger
 func Init(cfg Config) error {
 	logger, err := New(cfg)
@@ -136,6 +183,22 @@ func Init(cfg Config) error {
 	return nil
 }
 
+// SetReputation records the reputation score of client IPs in entries
+// score must not block; it should only read cached scores
+func SetReputation(score func(ip string) (int, bool)) {
+	globalMu.Lock()
+	reputationScore = score
+	globalMu.Unlock()
+}
+
+// SetCountry records the country code of client IPs in entries
+// country returns "" for an IP it cannot place
+func SetCountry(country func(ip string) string) {
+	globalMu.Lock()
+	countryOf = country
+	globalMu.Unlock()
+}
+
 // GetLogger returns the global audit logger (nil if not initialized)
 func GetLogger() *Logger {
 	globalMu.RLock()
@@ -164,6 +227,10 @@ func New(cfg Config) (*Logger, error) {
 		return &Logger{config: cfg}, nil
 	}
 
+	if cfg.Writer != nil {
+		return &Logger{config: cfg, out: cfg.Writer}, nil
+	}
+
 	// Set defaults
 	if cfg.Filename == "" {
 		cfg.Filename = "audit.log"
@@ -186,6 +253,7 @@ func New(cfg Config) (*Logger, error) {
 	return &Logger{
 		config: cfg,
 		file:   file,
+		out:    file,
 	}, nil
 }
 
@@ -240,7 +308,7 @@ func (l *Logger) maskEmails(s string) string {
 
 // Log writes an audit entry
 func (l *Logger) Log(entry Entry) error {
-	if !l.config.Enabled || l.file == nil {
+	if !l.config.Enabled || l.out == nil {
 		return nil
 	}
 
@@ -254,6 +322,17 @@ func (l *Logger) Log(entry Entry) error {
 	if entry.Result == "" {
 		entry.Result = "success"
 	}
+	globalMu.RLock()
+	score, country := reputationScore, countryOf
+	globalMu.RUnlock()
+	if score != nil && entry.Client != nil && entry.Client.IP != "" && entry.Client.Reputation == nil {
+		if s, ok := score(entry.Client.IP); ok {
+			entry.Client.Reputation = &s
+		}
+	}
+	if country != nil && entry.Client != nil && entry.Client.IP != "" && entry.Client.Country == "" {
+		entry.Client.Country = country(entry.Client.IP)
+	}
 
 	// Mask emails in details
 	if l.config.MaskEmails && entry.Details != nil {
@@ -274,7 +353,7 @@ func (l *Logger) Log(entry Entry) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	_, err = l.file.Write(append(data, '\n'))
+	_, err = l.out.Write(append(data, '\n'))
 	if err != nil {
 		return fmt.Errorf("failed to write audit entry: %w", err)
 	}
@@ -414,6 +493,161 @@ func (l *Logger) LogBruteForceDetected(ip string, attemptCount int, requestID st
 		})
 }
 
+// LogPasteModifyDenied logs a refused edit or delete of a write-once paste
+func (l *Logger) LogPasteModifyDenied(pasteID string, action string, ip string, requestID string) error {
+	return l.LogFailure(EventPasteModifyDenied, &Actor{Type: "anonymous"},
+		&Client{IP: ip, RequestID: requestID},
+		"paste is write-once",
+		map[string]interface{}{
+			"paste_id": pasteID,
+			"action":   action,
+		})
+}
+
+// LogPasteLegalAction logs a legal hold, release or legal delete by an admin
+func (l *Logger) LogPasteLegalAction(event string, pasteID string, reason string, ip string, err error) error {
+	actor := &Actor{Type: "admin"}
+	client := &Client{IP: ip}
+	details := map[string]interface{}{
+		"paste_id":     pasteID,
+		"legal_reason": reason,
+	}
+	if err != nil {
+		return l.LogFailure(event, actor, client, err.Error(), details)
+	}
+	return l.LogSuccess(event, actor, client, details)
+}
+
+// LogMaintenanceWindow logs a scheduled maintenance window starting or ending
+func (l *Logger) LogMaintenanceWindow(event string, windowID string, endsAt int64) error {
+	return l.LogSuccess(event, &Actor{Type: "system", ID: "scheduler"}, nil,
+		map[string]interface{}{
+			"window_id": windowID,
+			"ends_at":   endsAt,
+		})
+}
+
+// LogAbuseReport logs an abuse report being filed, resolved or reopened
+func (l *Logger) LogAbuseReport(event, actorType, reportID, pasteID, ip string) error {
+	return l.LogSuccess(event, &Actor{Type: actorType}, &Client{IP: ip},
+		map[string]interface{}{
+			"report_id": reportID,
+			"paste_id":  pasteID,
+		})
+}
+
+// LogPastePin logs an admin pinning or unpinning a paste
+func (l *Logger) LogPastePin(event, pasteID, ip string) error {
+	return l.LogSuccess(event, &Actor{Type: "admin"}, &Client{IP: ip},
+		map[string]interface{}{
+			"paste_id": pasteID,
+		})
+}
+
+// LogPasteModeration logs an admin freezing, unfreezing or deleting a
+// paste, including refused attempts
+func (l *Logger) LogPasteModeration(event, pasteID, reason, ip string, err error) error {
+	actor := &Actor{Type: "admin"}
+	client := &Client{IP: ip}
+	details := map[string]interface{}{
+		"paste_id": pasteID,
+	}
+	if reason != "" {
+		details["reason"] = reason
+	}
+	if err != nil {
+		return l.LogFailure(event, actor, client, err.Error(), details)
+	}
+	return l.LogSuccess(event, actor, client, details)
+}
+
+// LogPasteHeld logs the spam filter holding a paste created or edited from
+// ip for review, with the rules it matched
+func (l *Logger) LogPasteHeld(pasteID, reason, ip string) error {
+	return l.LogSuccess(EventPasteHeld, &Actor{Type: "system", ID: "spam"}, &Client{IP: ip}, map[string]interface{}{
+		"paste_id": pasteID,
+		"reason":   reason,
+	})
+}
+
+// LogConfigUpdated logs an admin changing settings in the config file
+func (l *Logger) LogConfigUpdated(keys []string, ip string) error {
+	return l.LogSuccess(EventConfigUpdated, &Actor{Type: "admin"}, &Client{IP: ip}, map[string]interface{}{
+		"keys": keys,
+	})
+}
+
+// LogPasteBulk logs an admin deleting or expiring the pastes matching a
+// filter, with how many were changed, skipped or failed
+func (l *Logger) LogPasteBulk(event, filter string, matched, done, skipped, failed int, ip string) error {
+	details := map[string]interface{}{
+		"filter":  filter,
+		"matched": matched,
+		"done":    done,
+		"skipped": skipped,
+		"failed":  failed,
+	}
+	if failed > 0 {
+		return l.LogFailure(event, &Actor{Type: "admin"}, &Client{IP: ip},
+			fmt.Sprintf("%d of %d pastes failed", failed, matched), details)
+	}
+	return l.LogSuccess(event, &Actor{Type: "admin"}, &Client{IP: ip}, details)
+}
+
+// LogIPBlocked logs a request refused because of its client IP
+func (l *Logger) LogIPBlocked(ip, endpoint, reason, requestID string) error {
+	return l.LogFailure(EventIPBlocked, &Actor{Type: "anonymous"},
+		&Client{IP: ip, RequestID: requestID},
+		reason,
+		map[string]interface{}{
+			"endpoint": endpoint,
+		})
+}
+
+// LogIPBan logs a firewall ban added, changed or lifted; ip is the admin's
+// address, or empty for a ban the server added itself
+func (l *Logger) LogIPBan(event, network, reason string, expiresAt int64, ip string, err error) error {
+	actor, client := &Actor{Type: "system", ID: "firewall"}, (*Client)(nil)
+	if ip != "" {
+		actor, client = &Actor{Type: "admin"}, &Client{IP: ip}
+	}
+	details := map[string]interface{}{
+		"network":    network,
+		"expires_at": expiresAt,
+	}
+	if reason != "" {
+		details["reason"] = reason
+	}
+	if err != nil {
+		return l.LogFailure(event, actor, client, err.Error(), details)
+	}
+	return l.LogSuccess(event, actor, client, details)
+}
+
+// LogPasteDeleted logs a paste deleted through the API by an authenticated user
+func (l *Logger) LogPasteDeleted(pasteID, user, ip, requestID string) error {
+	return l.LogSuccess(EventPasteDeleted, &Actor{Type: "user", ID: user},
+		&Client{IP: ip, RequestID: requestID},
+		map[string]interface{}{
+			"paste_id": pasteID,
+		})
+}
+
+// LogPasteUpdated logs a paste changed through the API; user is empty when
+// an anonymous client edited an editable paste
+func (l *Logger) LogPasteUpdated(pasteID, user string, fields []string, ip, requestID string) error {
+	actor := &Actor{Type: "anonymous"}
+	if user != "" {
+		actor = &Actor{Type: "user", ID: user}
+	}
+	return l.LogSuccess(EventPasteUpdated, actor,
+		&Client{IP: ip, RequestID: requestID},
+		map[string]interface{}{
+			"paste_id": pasteID,
+			"fields":   fields,
+		})
+}
+
 // Global convenience functions (use globalLogger)
 
 // AdminLogin logs an admin login event using the global logger
@@ -444,6 +678,21 @@ func CSRFFailure(ip, endpoint, requestID string) {
 	}
 }
 
+// IPBlocked logs a request refused because of its client IP using the
+// global logger
+func IPBlocked(ip, endpoint, reason, requestID string) {
+	if l := GetLogger(); l != nil {
+		l.LogIPBlocked(ip, endpoint, reason, requestID)
+	}
+}
+
+// IPBan logs a firewall ban added, changed or lifted using the global logger
+func IPBan(event, network, reason string, expiresAt int64, ip string, err error) {
+	if l := GetLogger(); l != nil {
+		l.LogIPBan(event, network, reason, expiresAt, ip, err)
+	}
+}
+
 // ServerStarted logs server startup using the global logger
 func ServerStarted(version, mode string) {
 	if l := GetLogger(); l != nil {
@@ -464,3 +713,80 @@ func BruteForceDetected(ip string, attemptCount int, requestID string) {
 		l.LogBruteForceDetected(ip, attemptCount, requestID)
 	}
 }
+
+// PasteModifyDenied logs a refused paste modification using the global logger
+func PasteModifyDenied(pasteID, action, ip, requestID string) {
+	if l := GetLogger(); l != nil {
+		l.LogPasteModifyDenied(pasteID, action, ip, requestID)
+	}
+}
+
+// PasteLegalAction logs an admin legal action using the global logger
+func PasteLegalAction(event, pasteID, reason, ip string, err error) {
+	if l := GetLogger(); l != nil {
+		l.LogPasteLegalAction(event, pasteID, reason, ip, err)
+	}
+}
+
+// AbuseReport logs an abuse report event using the global logger
+func AbuseReport(event, actorType, reportID, pasteID, ip string) {
+	if l := GetLogger(); l != nil {
+		l.LogAbuseReport(event, actorType, reportID, pasteID, ip)
+	}
+}
+
+// PastePin logs a paste being pinned or unpinned using the global logger
+func PastePin(event, pasteID, ip string) {
+	if l := GetLogger(); l != nil {
+		l.LogPastePin(event, pasteID, ip)
+	}
+}
+
+// PasteModeration logs a moderation action on a paste using the global logger
+func PasteModeration(event, pasteID, reason, ip string, err error) {
+	if l := GetLogger(); l != nil {
+		l.LogPasteModeration(event, pasteID, reason, ip, err)
+	}
+}
+
+// PasteHeld logs a paste held by the spam filter using the global logger
+func PasteHeld(pasteID, reason, ip string) {
+	if l := GetLogger(); l != nil {
+		l.LogPasteHeld(pasteID, reason, ip)
+	}
+}
+
+// ConfigUpdated logs a settings change using the global logger
+func ConfigUpdated(keys []string, ip string) {
+	if l := GetLogger(); l != nil {
+		l.LogConfigUpdated(keys, ip)
+	}
+}
+
+// PasteBulk logs a bulk action on pastes using the global logger
+func PasteBulk(event, filter string, matched, done, skipped, failed int, ip string) {
+	if l := GetLogger(); l != nil {
+		l.LogPasteBulk(event, filter, matched, done, skipped, failed, ip)
+	}
+}
+
+// PasteDeleted logs a paste deleted through the API using the global logger
+func PasteDeleted(pasteID, user, ip, requestID string) {
+	if l := GetLogger(); l != nil {
+		l.LogPasteDeleted(pasteID, user, ip, requestID)
+	}
+}
+
+// PasteUpdated logs a paste changed through the API using the global logger
+func PasteUpdated(pasteID, user string, fields []string, ip, requestID string) {
+	if l := GetLogger(); l != nil {
+		l.LogPasteUpdated(pasteID, user, fields, ip, requestID)
+	}
+}
+
+// MaintenanceWindow logs a maintenance window starting or ending using the global logger
+func MaintenanceWindow(event, windowID string, endsAt int64) {
+	if l := GetLogger(); l != nil {
+		l.LogMaintenanceWindow(event, windowID, endsAt)
+	}
+}
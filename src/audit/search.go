@@ -0,0 +1,136 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrNotSearchable is returned when entries are not kept in a file, such as
+// when audit logging is off or written to stdout
+var ErrNotSearchable = errors.New("audit: the audit log is not kept in a file")
+
+// maxLineSize bounds an entry read back from the file
+const maxLineSize = 1 << 20
+
+// Query selects and pages audit entries; empty fields match every entry
+type Query struct {
+	// Part of the event, actor, target, IP or details, case-insensitively
+	Search string
+	// Event type, or a prefix such as "paste." for a group of events
+	Event string
+	// "success" or "failure"
+	Result string
+	// Logged at or after From and before To; zero times are open
+	From time.Time
+	To   time.Time
+	// Oldest first instead of newest first
+	Ascending bool
+	Limit     int
+	// Offset is how many matching entries are skipped
+	Offset int
+}
+
+// match reports whether an entry, as logged in line, is selected by q
+func (q Query) match(e *Entry, line []byte) bool {
+	if q.Event != "" && e.Event != q.Event && !(strings.HasSuffix(q.Event, ".") && strings.HasPrefix(e.Event, q.Event)) {
+		return false
+	}
+	if q.Result != "" && e.Result != q.Result {
+		return false
+	}
+	if !q.From.IsZero() || !q.To.IsZero() {
+		t, err := time.Parse(time.RFC3339Nano, e.Time)
+		if err != nil {
+			return false
+		}
+		if !q.From.IsZero() && t.Before(q.From) {
+			return false
+		}
+		if !q.To.IsZero() && !t.Before(q.To) {
+			return false
+		}
+	}
+	// The line holds every field, so it is searched as written
+	if q.Search != "" && !strings.Contains(strings.ToLower(string(line)), strings.ToLower(q.Search)) {
+		return false
+	}
+	return true
+}
+
+// Search returns a page of the logged entries matching q, and how many
+// match; the file is read as it is, so entries written while searching may
+// be left out
+func (l *Logger) Search(q Query) ([]Entry, int, error) {
+	if l == nil || l.file == nil {
+		return nil, 0, ErrNotSearchable
+	}
+	path := filepath.Join(l.config.Directory, l.config.Filename)
+
+	// Newest first needs the total to find the page, so the file is read twice
+	total := -1
+	if !q.Ascending {
+		var err error
+		if total, err = scanEntries(path, q, nil); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	// first and last are the positions of the page among the matches,
+	// oldest first
+	first, last := q.Offset, q.Offset+q.Limit
+	if !q.Ascending {
+		first, last = total-q.Offset-q.Limit, total-q.Offset
+	}
+	entries := []Entry{}
+	n, err := scanEntries(path, q, func(i int, e Entry) {
+		if i >= first && i < last {
+			entries = append(entries, e)
+		}
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if !q.Ascending {
+		for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+			entries[i], entries[j] = entries[j], entries[i]
+		}
+	}
+	return entries, n, nil
+}
+
+// scanEntries calls fn with the position and entry of each match in the
+// file, oldest first, and returns how many matched; unreadable lines are
+// skipped
+func scanEntries(path string, q Query, fn func(int, Entry)) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64<<10), maxLineSize)
+	n := 0
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		var e Entry
+		if json.Unmarshal(line, &e) != nil || !q.match(&e, line) {
+			continue
+		}
+		if fn != nil {
+			fn(n, e)
+		}
+		n++
+	}
+	return n, scanner.Err()
+}
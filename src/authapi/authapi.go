@@ -8,9 +8,7 @@
 package authapi
 
 import (
-	"crypto/sha256"
 	"database/sql"
-	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -20,7 +18,9 @@ import (
 
 	"github.com/casjay-forks/caspaste/src/config"
 	"github.com/casjay-forks/caspaste/src/httputil"
+	"github.com/casjay-forks/caspaste/src/jwt"
 	"github.com/casjay-forks/caspaste/src/recovery"
+	"github.com/casjay-forks/caspaste/src/securetoken"
 	"github.com/casjay-forks/caspaste/src/session"
 	"github.com/casjay-forks/caspaste/src/totp"
 	"github.com/casjay-forks/caspaste/src/user"
@@ -43,6 +43,7 @@ type Service struct {
 	userService     *user.Service
 	sessionService  *session.Service
 	recoveryService *recovery.Service
+	jwtIssuer       *jwt.Issuer
 	config          *config.UsersConfig
 }
 
@@ -57,6 +58,11 @@ func NewService(db *sql.DB, userSvc *user.Service, sessSvc *session.Service, rec
 	}
 }
 
+// SetJWTIssuer enables stateless JWT issuance on login (nil disables it)
+func (s *Service) SetJWTIssuer(issuer *jwt.Issuer) {
+	s.jwtIssuer = issuer
+}
+
 // RegisterRequest is the request body for registration
 type RegisterRequest struct {
 	Username    string `json:"username"`
@@ -105,6 +111,9 @@ type AuthResponse struct {
 	SessionToken string     `json:"session_token,omitempty"`
 	ExpiresAt    int64      `json:"expires_at,omitempty"`
 	RequiresTOTP bool       `json:"requires_totp,omitempty"`
+	// Stateless JWT, only present when JWT auth is enabled
+	AccessToken          string `json:"access_token,omitempty"`
+	AccessTokenExpiresAt int64  `json:"access_token_expires_at,omitempty"`
 }
 
 // HandleRegister handles POST /api/v1/auth/register
@@ -164,7 +173,7 @@ func (s *Service) HandleRegister(w http.ResponseWriter, r *http.Request) error {
 		Role:        s.config.Roles.Default,
 	}
 
-	newUser, err := s.userService.Create(input)
+	newUser, err := s.userService.Create(r.Context(), input)
 	if err != nil {
 		switch {
 		case errors.Is(err, user.ErrUsernameTaken):
@@ -238,7 +247,7 @@ func (s *Service) HandleLogin(w http.ResponseWriter, r *http.Request) error {
 	}
 
 	// Authenticate user
-	authUser, err := s.userService.Authenticate(req.Identifier, req.Password)
+	authUser, err := s.userService.Authenticate(r.Context(), req.Identifier, req.Password)
 	if err != nil {
 		switch {
 		case errors.Is(err, user.ErrAccountLocked):
@@ -284,11 +293,21 @@ func (s *Service) HandleLogin(w http.ResponseWriter, r *http.Request) error {
 	// Set session cookie
 	setSessionCookie(w, r, sessionToken)
 
-	return writeSuccess(w, r, AuthResponse{
+	resp := AuthResponse{
 		User:         authUser,
 		SessionToken: sessionToken,
 		ExpiresAt:    time.Now().Add(session.DefaultSessionDuration).Unix(),
-	}, "Login successful", "Logged in successfully")
+	}
+
+	// Issue a JWT alongside the session for stateless API clients
+	if s.jwtIssuer != nil {
+		resp.AccessToken, resp.AccessTokenExpiresAt, err = s.jwtIssuer.Issue(authUser.ID, authUser.Username, authUser.Role)
+		if err != nil {
+			return writeError(w, r, http.StatusInternalServerError, "TOKEN_ERROR", "Failed to issue access token")
+		}
+	}
+
+	return writeSuccess(w, r, resp, "Login successful", "Logged in successfully")
 }
 
 // HandleLogout handles POST /api/v1/auth/logout
@@ -330,7 +349,7 @@ func (s *Service) HandlePasswordForgot(w http.ResponseWriter, r *http.Request) e
 	// Always return success to prevent email enumeration
 	// In background, check if user exists and send reset email
 	go func() {
-		u, err := s.userService.GetByEmail(req.Email)
+		u, err := s.userService.GetByEmail(r.Context(), req.Email)
 		if err == nil && u != nil {
 			// TODO: Generate reset token and send email
 			s.createPasswordResetToken(u.ID)
@@ -363,7 +382,7 @@ func (s *Service) HandlePasswordReset(w http.ResponseWriter, r *http.Request) er
 	}
 
 	// Update password
-	if err := s.userService.UpdatePassword(userID, req.NewPassword); err != nil {
+	if err := s.userService.UpdatePassword(r.Context(), userID, req.NewPassword); err != nil {
 		if errors.Is(err, user.ErrInvalidPassword) {
 			return writeError(w, r, http.StatusBadRequest, "INVALID_PASSWORD", "Password does not meet requirements")
 		}
@@ -397,7 +416,7 @@ func (s *Service) HandleVerifyEmail(w http.ResponseWriter, r *http.Request) erro
 	}
 
 	// Mark email as verified
-	if err := s.userService.SetEmailVerified(userID, true); err != nil {
+	if err := s.userService.SetEmailVerified(r.Context(), userID, true); err != nil {
 		return writeError(w, r, http.StatusInternalServerError, "VERIFICATION_FAILED", "Failed to verify email")
 	}
 
@@ -423,7 +442,7 @@ func (s *Service) HandleRecoveryUse(w http.ResponseWriter, r *http.Request) erro
 	}
 
 	// Get user
-	u, err := s.userService.GetByIdentifier(req.Identifier)
+	u, err := s.userService.GetByIdentifier(r.Context(), req.Identifier)
 	if err != nil {
 		return writeError(w, r, http.StatusUnauthorized, "INVALID_CREDENTIALS", "Invalid credentials")
 	}
@@ -443,7 +462,7 @@ func (s *Service) HandleRecoveryUse(w http.ResponseWriter, r *http.Request) erro
 	}
 
 	// Disable 2FA after successful recovery
-	if err := s.userService.SetTOTPEnabled(u.ID, false, ""); err != nil {
+	if err := s.userService.SetTOTPEnabled(r.Context(), u.ID, false, ""); err != nil {
 		return writeError(w, r, http.StatusInternalServerError, "RECOVERY_FAILED", "Failed to disable 2FA")
 	}
 
@@ -504,7 +523,7 @@ func (s *Service) verifyInvite(code string) (bool, error) {
 
 	err := s.db.QueryRow(`
 		SELECT expires_at, used_at FROM user_invites WHERE token_hash = ?
-	`, hashToken(code)).Scan(&expiresAt, &usedAt)
+	`, securetoken.Hash(code)).Scan(&expiresAt, &usedAt)
 	if err == sql.ErrNoRows {
 		return false, nil
 	}
@@ -523,7 +542,7 @@ func (s *Service) verifyInvite(code string) (bool, error) {
 }
 
 func (s *Service) markInviteUsed(code string) {
-	s.db.Exec("UPDATE user_invites SET used_at = ? WHERE token_hash = ?", time.Now().Unix(), hashToken(code))
+	s.db.Exec("UPDATE user_invites SET used_at = ? WHERE token_hash = ?", time.Now().Unix(), securetoken.Hash(code))
 }
 
 func (s *Service) getInvite(token string) (*Invite, error) {
@@ -532,7 +551,7 @@ func (s *Service) getInvite(token string) (*Invite, error) {
 
 	err := s.db.QueryRow(`
 		SELECT username, expires_at, used_at FROM user_invites WHERE token_hash = ?
-	`, hashToken(token)).Scan(&invite.Username, &invite.ExpiresAt, &usedAt)
+	`, securetoken.Hash(token)).Scan(&invite.Username, &invite.ExpiresAt, &usedAt)
 	if err == sql.ErrNoRows {
 		return nil, errors.New("invite not found")
 	}
@@ -551,11 +570,14 @@ func (s *Service) getInvite(token string) (*Invite, error) {
 }
 
 func (s *Service) createPasswordResetToken(userID int64) (string, error) {
-	token := generateToken(32)
-	tokenHash := hashToken(token)
+	token, err := securetoken.GenerateString(32, securetoken.AlphaNum)
+	if err != nil {
+		return "", err
+	}
+	tokenHash := securetoken.Hash(token)
 	expiresAt := time.Now().Add(1 * time.Hour).Unix()
 
-	_, err := s.db.Exec(`
+	_, err = s.db.Exec(`
 		INSERT INTO password_resets (user_id, token_hash, expires_at, created_at)
 		VALUES (?, ?, ?, ?)
 	`, userID, tokenHash, expiresAt, time.Now().Unix())
@@ -573,7 +595,7 @@ func (s *Service) verifyPasswordResetToken(token string) (int64, error) {
 
 	err := s.db.QueryRow(`
 		SELECT user_id, expires_at, used_at FROM password_resets WHERE token_hash = ?
-	`, hashToken(token)).Scan(&userID, &expiresAt, &usedAt)
+	`, securetoken.Hash(token)).Scan(&userID, &expiresAt, &usedAt)
 	if err == sql.ErrNoRows {
 		return 0, errors.New("token not found")
 	}
@@ -592,7 +614,7 @@ func (s *Service) verifyPasswordResetToken(token string) (int64, error) {
 }
 
 func (s *Service) markPasswordResetUsed(token string) {
-	s.db.Exec("UPDATE password_resets SET used_at = ? WHERE token_hash = ?", time.Now().Unix(), hashToken(token))
+	s.db.Exec("UPDATE password_resets SET used_at = ? WHERE token_hash = ?", time.Now().Unix(), securetoken.Hash(token))
 }
 
 func (s *Service) verifyEmailToken(token string) (int64, error) {
@@ -602,7 +624,7 @@ func (s *Service) verifyEmailToken(token string) (int64, error) {
 
 	err := s.db.QueryRow(`
 		SELECT user_id, expires_at, verified_at FROM email_verifications WHERE token_hash = ?
-	`, hashToken(token)).Scan(&userID, &expiresAt, &verifiedAt)
+	`, securetoken.Hash(token)).Scan(&userID, &expiresAt, &verifiedAt)
 	if err == sql.ErrNoRows {
 		return 0, errors.New("token not found")
 	}
@@ -621,7 +643,7 @@ func (s *Service) verifyEmailToken(token string) (int64, error) {
 }
 
 func (s *Service) markEmailVerificationUsed(token string) {
-	s.db.Exec("UPDATE email_verifications SET verified_at = ? WHERE token_hash = ?", time.Now().Unix(), hashToken(token))
+	s.db.Exec("UPDATE email_verifications SET verified_at = ? WHERE token_hash = ?", time.Now().Unix(), securetoken.Hash(token))
 }
 
 // Response helpers
@@ -790,19 +812,3 @@ func clearSessionCookie(w http.ResponseWriter, r *http.Request) {
 		MaxAge:   -1,
 	})
 }
-
-func generateToken(length int) string {
-	const chars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	b := make([]byte, length)
-	for i := range b {
-		b[i] = chars[time.Now().UnixNano()%int64(len(chars))]
-		time.Sleep(time.Nanosecond)
-	}
-	return string(b)
-}
-
-func hashToken(token string) string {
-	// Use crypto/sha256 for secure token hashing
-	h := sha256.Sum256([]byte(token))
-	return hex.EncodeToString(h[:])
-}
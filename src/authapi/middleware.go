@@ -0,0 +1,90 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package authapi
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/casjay-forks/caspaste/src/jwt"
+	"github.com/casjay-forks/caspaste/src/token"
+	"github.com/casjay-forks/caspaste/src/user"
+	"github.com/casjay-forks/caspaste/src/web"
+)
+
+// SessionAuthenticator resolves database-backed session tokens
+func (s *Service) SessionAuthenticator() web.APIAuthenticator {
+	return func(r *http.Request, credential string) (*web.AuthUser, bool) {
+		if jwt.LooksLikeJWT(credential) || strings.HasPrefix(credential, token.PrefixUser) || strings.HasPrefix(credential, token.PrefixOrg) {
+			return nil, false
+		}
+		userID, err := s.sessionService.GetUserID(credential)
+		if err != nil {
+			return nil, false
+		}
+		u, err := s.userService.GetByID(r.Context(), userID)
+		if err != nil {
+			return nil, false
+		}
+		return toAuthUser(u), true
+	}
+}
+
+// JWTAuthenticator resolves JWTs; the signature needs no session lookup, but
+// the role comes from the user record, so a demoted or deleted account loses
+// its access before the token expires
+// Returns an authenticator that never matches when JWT issuance is disabled
+func (s *Service) JWTAuthenticator() web.APIAuthenticator {
+	return func(r *http.Request, credential string) (*web.AuthUser, bool) {
+		if s.jwtIssuer == nil || !jwt.LooksLikeJWT(credential) {
+			return nil, false
+		}
+		claims, err := s.jwtIssuer.Parse(credential)
+		if err != nil {
+			return nil, false
+		}
+		userID, err := claims.UserID()
+		if err != nil {
+			return nil, false
+		}
+		u, err := s.userService.GetByID(r.Context(), userID)
+		if err != nil {
+			return nil, false
+		}
+		return toAuthUser(u), true
+	}
+}
+
+// TokenAuthenticator resolves usr_ and org_ API tokens
+func TokenAuthenticator(tokenSvc *token.Service, userSvc *user.Service) web.APIAuthenticator {
+	return func(r *http.Request, credential string) (*web.AuthUser, bool) {
+		if !strings.HasPrefix(credential, token.PrefixUser) && !strings.HasPrefix(credential, token.PrefixOrg) {
+			return nil, false
+		}
+		info, err := tokenSvc.Validate(credential)
+		if err != nil || info.IsMonitoringOnly() || info.IsEditorOnly() {
+			return nil, false
+		}
+		u, err := userSvc.GetByID(r.Context(), info.UserID)
+		if err != nil {
+			return nil, false
+		}
+		return toAuthUser(u), true
+	}
+}
+
+func toAuthUser(u *user.User) *web.AuthUser {
+	return &web.AuthUser{
+		ID:            u.ID,
+		Username:      u.Username,
+		Email:         u.Email,
+		DisplayName:   u.DisplayName,
+		Role:          u.Role,
+		EmailVerified: u.EmailVerified,
+		TOTPEnabled:   u.TOTPEnabled,
+	}
+}
@@ -0,0 +1,184 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+// Package blob stores binary assets (uploaded logos, favicons) by key
+// Keys are slash-separated names like "branding/logo"; the content type
+// is sniffed from the data when it is read back
+package blob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when a key has no blob
+var ErrNotFound = errors.New("blob: not found")
+
+// ErrInvalidKey is returned for empty keys and keys that leave the store
+var ErrInvalidKey = errors.New("blob: invalid key")
+
+// Store is a key/value store for binary assets
+type Store interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// FS stores blobs as files under a directory
+type FS struct {
+	dir string
+}
+
+// NewFS creates a filesystem store rooted at dir, creating it if needed
+func NewFS(dir string) (*FS, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("blob: %w", err)
+	}
+	return &FS{dir: dir}, nil
+}
+
+// path maps a key to a file, rejecting keys that escape the directory
+func (s *FS) path(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return "", ErrInvalidKey
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return "", ErrInvalidKey
+		}
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+// Put writes a blob, replacing any existing one atomically
+func (s *FS) Put(ctx context.Context, key string, data []byte) error {
+	_, err := s.PutStream(ctx, key, bytes.NewReader(data))
+	return err
+}
+
+// Streamer is implemented by stores that can write a blob from a reader
+// without holding it in memory
+type Streamer interface {
+	PutStream(ctx context.Context, key string, r io.Reader) (int64, error)
+}
+
+// PutStream writes a blob from r and returns its size; like Put it replaces
+// any existing blob atomically, and nothing is stored if reading r fails
+func (s *FS) PutStream(ctx context.Context, key string, r io.Reader) (int64, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, fmt.Errorf("blob: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".blob-*")
+	if err != nil {
+		return 0, fmt.Errorf("blob: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return 0, fmt.Errorf("blob: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, fmt.Errorf("blob: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return 0, fmt.Errorf("blob: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return 0, fmt.Errorf("blob: %w", err)
+	}
+	return size, nil
+}
+
+// Get reads a blob
+func (s *FS) Get(ctx context.Context, key string) ([]byte, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("blob: %w", err)
+	}
+	return data, nil
+}
+
+// Delete removes a blob; deleting a missing blob is not an error
+func (s *FS) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("blob: %w", err)
+	}
+	return nil
+}
+
+// Info describes a stored blob
+type Info struct {
+	Key     string
+	ModTime time.Time
+	// Temp marks the temporary file of a write that never finished
+	Temp bool
+}
+
+// Lister is implemented by stores that can enumerate their blobs
+type Lister interface {
+	List(ctx context.Context, prefix string) ([]Info, error)
+}
+
+// List returns the blobs whose key starts with prefix, including the
+// temporary files left by interrupted writes
+func (s *FS) List(ctx context.Context, prefix string) ([]Info, error) {
+	var infos []Info
+	err := filepath.WalkDir(s.dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		infos = append(infos, Info{
+			Key:     key,
+			ModTime: fi.ModTime(),
+			Temp:    strings.HasPrefix(d.Name(), ".blob-"),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("blob: %w", err)
+	}
+	return infos, nil
+}
@@ -0,0 +1,361 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+// Package bootstrap provisions the admin account, API tokens, organizations
+// and custom domains from the environment and bootstrap.yml
+// Automated deployments (Helm, Ansible, compose) set credentials up front
+// instead of reading generated ones from the startup banner. Apply runs on
+// every start and only creates what is missing, so restarts are harmless.
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/casjay-forks/caspaste/src/caspasswd"
+	"github.com/casjay-forks/caspaste/src/domain"
+	"github.com/casjay-forks/caspaste/src/org"
+	"github.com/casjay-forks/caspaste/src/token"
+	"github.com/casjay-forks/caspaste/src/user"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFile is the name of the provisioning file in the config directory
+const DefaultFile = "bootstrap.yml"
+
+// bootstrapTokenName is the name the CASPASTE_BOOTSTRAP_TOKEN is stored under
+const bootstrapTokenName = "bootstrap"
+
+// Admin is the administrator account set through the environment
+type Admin struct {
+	Username     string
+	Email        string
+	PasswordHash string
+	// Token is an API token (usr_ prefix) for the admin, optional
+	Token string
+}
+
+// File is the contents of bootstrap.yml
+type File struct {
+	Orgs    []Org    `yaml:"orgs"`
+	Tokens  []Token  `yaml:"tokens"`
+	Domains []Domain `yaml:"domains"`
+}
+
+// Org is an organization to create
+type Org struct {
+	Slug        string `yaml:"slug"`
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	Visibility  string `yaml:"visibility"`
+	// Owner username (default: the admin)
+	Owner string `yaml:"owner"`
+}
+
+// Token is an API token to import; the value is never stored in the file
+// itself but read from an environment variable or a mounted secret
+type Token struct {
+	Name string `yaml:"name"`
+	// Exactly one of User and Org owns the token
+	User      string   `yaml:"user"`
+	Org       string   `yaml:"org"`
+	Scopes    []string `yaml:"scopes"`
+	ValueEnv  string   `yaml:"value_env"`
+	ValueFile string   `yaml:"value_file"`
+}
+
+// Domain is a custom domain to register
+type Domain struct {
+	Domain string `yaml:"domain"`
+	// Exactly one of User and Org owns the domain
+	User string `yaml:"user"`
+	Org  string `yaml:"org"`
+}
+
+// AdminFromEnv reads CASPASTE_ADMIN_USER, CASPASTE_ADMIN_PASSWORD_HASH,
+// CASPASTE_ADMIN_EMAIL and CASPASTE_BOOTSTRAP_TOKEN
+// Returns nil when none of them is set
+func AdminFromEnv() (*Admin, error) {
+	a := &Admin{
+		Username:     strings.TrimSpace(os.Getenv("CASPASTE_ADMIN_USER")),
+		Email:        strings.TrimSpace(os.Getenv("CASPASTE_ADMIN_EMAIL")),
+		PasswordHash: strings.TrimSpace(os.Getenv("CASPASTE_ADMIN_PASSWORD_HASH")),
+		Token:        strings.TrimSpace(os.Getenv("CASPASTE_BOOTSTRAP_TOKEN")),
+	}
+	if a.Username == "" && a.PasswordHash == "" && a.Token == "" {
+		return nil, nil
+	}
+
+	if a.Username == "" || a.PasswordHash == "" {
+		return nil, errors.New("CASPASTE_ADMIN_USER and CASPASTE_ADMIN_PASSWORD_HASH must be set together")
+	}
+	if strings.Contains(a.Username, ":") {
+		return nil, errors.New("CASPASTE_ADMIN_USER cannot contain ':'")
+	}
+	if !caspasswd.ValidHash(a.PasswordHash) {
+		return nil, errors.New("CASPASTE_ADMIN_PASSWORD_HASH must be an argon2id, pbkdf2-sha256 or bcrypt hash, not a plain password")
+	}
+	if a.Token != "" && (!strings.HasPrefix(a.Token, token.PrefixUser) || len(a.Token) < len(token.PrefixUser)+32) {
+		return nil, fmt.Errorf("CASPASTE_BOOTSTRAP_TOKEN must start with %s followed by at least 32 characters", token.PrefixUser)
+	}
+	return a, nil
+}
+
+// FilePath returns CASPASTE_BOOTSTRAP_FILE, or bootstrap.yml in configDir
+func FilePath(configDir string) string {
+	if path := os.Getenv("CASPASTE_BOOTSTRAP_FILE"); path != "" {
+		return path
+	}
+	return filepath.Join(configDir, DefaultFile)
+}
+
+// LoadFile reads a bootstrap file; a missing file returns nil
+func LoadFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var f File
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	for i, t := range f.Tokens {
+		if t.Name == "" {
+			return nil, fmt.Errorf("%s: tokens[%d]: name is required", path, i)
+		}
+		if (t.User == "") == (t.Org == "") {
+			return nil, fmt.Errorf("%s: token %q: set exactly one of user or org", path, t.Name)
+		}
+		if (t.ValueEnv == "") == (t.ValueFile == "") {
+			return nil, fmt.Errorf("%s: token %q: set exactly one of value_env or value_file", path, t.Name)
+		}
+		for _, scope := range t.Scopes {
+			if !token.IsValidScope(scope) {
+				return nil, fmt.Errorf("%s: token %q: invalid scope %q", path, t.Name, scope)
+			}
+		}
+	}
+	for i, d := range f.Domains {
+		if d.Domain == "" {
+			return nil, fmt.Errorf("%s: domains[%d]: domain is required", path, i)
+		}
+		if (d.User == "") == (d.Org == "") {
+			return nil, fmt.Errorf("%s: domain %q: set exactly one of user or org", path, d.Domain)
+		}
+	}
+	for i, o := range f.Orgs {
+		if o.Slug == "" {
+			return nil, fmt.Errorf("%s: orgs[%d]: slug is required", path, i)
+		}
+	}
+
+	return &f, nil
+}
+
+// Services are the account services provisioning goes through
+// The server passes the ones its handlers use, so secrets are encrypted
+// and names checked the same way
+type Services struct {
+	Users   *user.Service
+	Orgs    *org.Service
+	Tokens  *token.Service
+	Domains *domain.Service
+}
+
+// Apply provisions admin and the contents of f, either of which may be nil
+// Existing orgs and domains are left as they are; the admin's password hash,
+// role and tokens are brought in line with the configured values
+func Apply(ctx context.Context, svc Services, admin *Admin, f *File, logf func(format string, args ...interface{})) error {
+	if logf == nil {
+		logf = func(string, ...interface{}) {}
+	}
+
+	users, orgs, tokens, domains := svc.Users, svc.Orgs, svc.Tokens, svc.Domains
+
+	if admin != nil {
+		adminUser, err := applyAdmin(ctx, users, admin, logf)
+		if err != nil {
+			return fmt.Errorf("admin %q: %w", admin.Username, err)
+		}
+		if admin.Token != "" {
+			err := tokens.ImportUserToken(adminUser.ID, bootstrapTokenName, admin.Token, []string{token.ScopeGlobal})
+			if err != nil {
+				return fmt.Errorf("CASPASTE_BOOTSTRAP_TOKEN: %w", err)
+			}
+		}
+	}
+
+	if f == nil {
+		return nil
+	}
+
+	lookupUser := func(username string) (*user.User, error) {
+		if username == "" {
+			if admin == nil {
+				return nil, errors.New("no owner given and CASPASTE_ADMIN_USER is not set")
+			}
+			username = admin.Username
+		}
+		u, err := users.GetByUsername(ctx, username)
+		if err != nil {
+			return nil, fmt.Errorf("user %q: %w", username, err)
+		}
+		return u, nil
+	}
+	lookupOrg := func(slug string) (*org.Org, error) {
+		o, err := orgs.GetBySlug(ctx, slug)
+		if err != nil {
+			return nil, fmt.Errorf("org %q: %w", slug, err)
+		}
+		return o, nil
+	}
+
+	for _, o := range f.Orgs {
+		if existing, _ := orgs.GetBySlug(ctx, o.Slug); existing != nil {
+			continue
+		}
+		owner, err := lookupUser(o.Owner)
+		if err != nil {
+			return fmt.Errorf("org %q: %w", o.Slug, err)
+		}
+		name := o.Name
+		if name == "" {
+			name = o.Slug
+		}
+		if _, err := orgs.Create(ctx, org.CreateOrgInput{
+			Slug:        o.Slug,
+			Name:        name,
+			Description: o.Description,
+			Visibility:  o.Visibility,
+		}, owner.ID); err != nil {
+			return fmt.Errorf("org %q: %w", o.Slug, err)
+		}
+		logf("Bootstrap: created org %s", o.Slug)
+	}
+
+	for _, t := range f.Tokens {
+		value, err := tokenValue(t)
+		if err != nil {
+			return fmt.Errorf("token %q: %w", t.Name, err)
+		}
+		scopes := t.Scopes
+		if len(scopes) == 0 {
+			scopes = []string{token.ScopeGlobal}
+		}
+
+		if t.User != "" {
+			u, err := lookupUser(t.User)
+			if err != nil {
+				return fmt.Errorf("token %q: %w", t.Name, err)
+			}
+			err = tokens.ImportUserToken(u.ID, t.Name, value, scopes)
+			if err != nil {
+				return fmt.Errorf("token %q: %w (user tokens start with %s)", t.Name, err, token.PrefixUser)
+			}
+			continue
+		}
+
+		o, err := lookupOrg(t.Org)
+		if err != nil {
+			return fmt.Errorf("token %q: %w", t.Name, err)
+		}
+		err = tokens.ImportOrgToken(o.ID, o.OwnerID, t.Name, value, scopes)
+		if err != nil {
+			return fmt.Errorf("token %q: %w (org tokens start with %s)", t.Name, err, token.PrefixOrg)
+		}
+	}
+
+	for _, d := range f.Domains {
+		if existing, _ := domains.GetByDomain(ctx, domain.NormalizeDomain(d.Domain)); existing != nil {
+			continue
+		}
+		ownerType, ownerID := domain.OwnerTypeUser, int64(0)
+		if d.User != "" {
+			u, err := lookupUser(d.User)
+			if err != nil {
+				return fmt.Errorf("domain %q: %w", d.Domain, err)
+			}
+			ownerID = u.ID
+		} else {
+			o, err := lookupOrg(d.Org)
+			if err != nil {
+				return fmt.Errorf("domain %q: %w", d.Domain, err)
+			}
+			ownerType, ownerID = domain.OwnerTypeOrg, o.ID
+		}
+		if _, err := domains.Create(ctx, ownerType, ownerID, d.Domain); err != nil {
+			return fmt.Errorf("domain %q: %w", d.Domain, err)
+		}
+		logf("Bootstrap: registered domain %s (pending verification)", d.Domain)
+	}
+
+	return nil
+}
+
+// applyAdmin creates the admin account or updates its hash and role
+func applyAdmin(ctx context.Context, users *user.Service, admin *Admin, logf func(string, ...interface{})) (*user.User, error) {
+	existing, err := users.GetByUsername(ctx, admin.Username)
+	if err != nil && !errors.Is(err, user.ErrUserNotFound) {
+		return nil, err
+	}
+
+	if existing == nil {
+		if err := user.ValidateEmail(admin.Email); err != nil {
+			return nil, fmt.Errorf("email %q: %w (set CASPASTE_ADMIN_EMAIL)", admin.Email, err)
+		}
+		created, err := users.Create(ctx, user.CreateUserInput{
+			Username:      admin.Username,
+			Email:         admin.Email,
+			PasswordHash:  admin.PasswordHash,
+			Role:          user.RoleAdmin,
+			AllowReserved: true,
+		})
+		if err != nil {
+			return nil, err
+		}
+		logf("Bootstrap: created admin account %s", admin.Username)
+		return created, nil
+	}
+
+	if existing.PasswordHash != admin.PasswordHash {
+		if err := users.SetPasswordHash(ctx, existing.ID, admin.PasswordHash); err != nil {
+			return nil, err
+		}
+		logf("Bootstrap: updated password of admin account %s", admin.Username)
+	}
+	if existing.Role != user.RoleAdmin {
+		if err := users.SetRole(ctx, existing.ID, user.RoleAdmin); err != nil {
+			return nil, err
+		}
+	}
+	return existing, nil
+}
+
+// tokenValue reads a token from its environment variable or secret file
+func tokenValue(t Token) (string, error) {
+	if t.ValueEnv != "" {
+		value := strings.TrimSpace(os.Getenv(t.ValueEnv))
+		if value == "" {
+			return "", fmt.Errorf("environment variable %s is not set", t.ValueEnv)
+		}
+		return value, nil
+	}
+	data, err := os.ReadFile(t.ValueFile)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
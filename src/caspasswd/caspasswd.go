@@ -8,7 +8,9 @@ package caspasswd
 
 import (
 	"bytes"
+	"crypto/pbkdf2"
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/base64"
 	"errors"
@@ -20,6 +22,9 @@ import (
 
 	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
+
+	"github.com/casjay-forks/caspaste/src/cryptopolicy"
+	"github.com/casjay-forks/caspaste/src/securetoken"
 )
 
 type Data map[string]string
@@ -82,37 +87,185 @@ const (
 	ArgonSaltLen = 16
 )
 
-func (data Data) Check(user string, pass string) bool {
-	storedPass, exist := data[user]
-	if !exist {
-		return false
+// PBKDF2-HMAC-SHA256 is used instead of Argon2id in strict crypto mode, where
+// only FIPS-approved algorithms are allowed (OWASP 2023: 600000 iterations)
+const (
+	PBKDF2Iterations = 600000
+	pbkdf2Prefix     = "$pbkdf2-sha256$"
+)
+
+// Params holds tunable Argon2id parameters
+type Params struct {
+	// Iterations
+	Time uint32
+	// Memory in KB
+	Memory uint32
+	// Parallelism
+	Threads uint8
+}
+
+// Minimum accepted parameters (OWASP floor: 19 MB, 2 iterations)
+const (
+	minArgonTime   = 2
+	minArgonMemory = 19 * 1024
+)
+
+// currentParams is used for all new hashes (set once during config load)
+var currentParams = DefaultParams()
+
+// DefaultParams returns the built-in Argon2id parameters
+func DefaultParams() Params {
+	return Params{Time: ArgonTime, Memory: ArgonMemory, Threads: ArgonThreads}
+}
+
+// CurrentParams returns the parameters used for new hashes
+func CurrentParams() Params {
+	return currentParams
+}
+
+// SetParams sets the parameters used for new hashes
+// Zero fields keep their default; values below the safe minimum are rejected
+func SetParams(p Params) error {
+	p, err := checkParams(p)
+	if err != nil {
+		return err
 	}
+	currentParams = p
+	return nil
+}
 
-	// Check if the stored password is an argon2id hash
-	// Format: $argon2id$v=19$m=65536,t=3,p=4$salt$hash
-	if strings.HasPrefix(storedPass, "$argon2id$") {
-		return verifyArgon2Hash(storedPass, pass)
+// CheckParams reports whether SetParams would accept p, without setting it
+func CheckParams(p Params) error {
+	_, err := checkParams(p)
+	return err
+}
+
+// checkParams returns p with defaults for its zero fields, or why it is
+// rejected
+func checkParams(p Params) (Params, error) {
+	def := DefaultParams()
+	if p.Time == 0 {
+		p.Time = def.Time
+	}
+	if p.Memory == 0 {
+		p.Memory = def.Memory
+	}
+	if p.Threads == 0 {
+		p.Threads = def.Threads
+	}
+	if p.Time < minArgonTime {
+		return p, fmt.Errorf("caspasswd: argon2 time must be at least %d", minArgonTime)
+	}
+	if p.Memory < minArgonMemory {
+		return p, fmt.Errorf("caspasswd: argon2 memory must be at least %d KB", minArgonMemory)
 	}
+	return p, nil
+}
+
+// parseArgon2Params extracts the parameters from an encoded argon2id hash
+func parseArgon2Params(encodedHash string) (Params, bool) {
+	parts := strings.Split(encodedHash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return Params{}, false
+	}
+	var p Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Time, &p.Threads); err != nil {
+		return Params{}, false
+	}
+	return p, true
+}
 
-	// Check if the stored password is a bcrypt hash (migration support)
-	// Bcrypt hashes start with $2a$, $2b$, or $2y$
-	// Per AI.md PART 11: bcrypt verification allowed for migration, then rehash to Argon2id
-	if strings.HasPrefix(storedPass, "$2a$") ||
-		strings.HasPrefix(storedPass, "$2b$") ||
-		strings.HasPrefix(storedPass, "$2y$") {
-		err := bcrypt.CompareHashAndPassword([]byte(storedPass), []byte(pass))
+// parsePBKDF2Iterations extracts the iteration count from a pbkdf2-sha256 hash
+func parsePBKDF2Iterations(encodedHash string) (int, bool) {
+	parts := strings.Split(encodedHash, "$")
+	if len(parts) != 5 || parts[1] != "pbkdf2-sha256" {
+		return 0, false
+	}
+	var iterations int
+	if _, err := fmt.Sscanf(parts[2], "i=%d", &iterations); err != nil || iterations <= 0 {
+		return 0, false
+	}
+	return iterations, true
+}
+
+// VerifyHash verifies a password against an encoded hash
+// Accepts argon2id (any parameters), pbkdf2-sha256, and bcrypt for migration
+func VerifyHash(encodedHash, password string) bool {
+	if strings.HasPrefix(encodedHash, "$argon2id$") {
+		return verifyArgon2Hash(encodedHash, password)
+	}
+	if strings.HasPrefix(encodedHash, pbkdf2Prefix) {
+		return verifyPBKDF2Hash(encodedHash, password)
+	}
+	if isBcryptHash(encodedHash) {
+		return bcrypt.CompareHashAndPassword([]byte(encodedHash), []byte(password)) == nil
+	}
+	return false
+}
+
+// HashNeedsRehash reports whether an encoded hash should be upgraded:
+// bcrypt hashes and argon2id hashes weaker than the current parameters; in
+// strict crypto mode, every hash that is not pbkdf2-sha256
+func HashNeedsRehash(encodedHash string) bool {
+	if isBcryptHash(encodedHash) {
+		return true
+	}
+	if iterations, ok := parsePBKDF2Iterations(encodedHash); ok {
+		return iterations < PBKDF2Iterations
+	}
+	if cryptopolicy.Strict() {
+		return true
+	}
+	p, ok := parseArgon2Params(encodedHash)
+	if !ok {
+		return false
+	}
+	return p.Time < currentParams.Time || p.Memory < currentParams.Memory || p.Threads != currentParams.Threads
+}
+
+// ValidHash reports whether encodedHash is an argon2id, pbkdf2-sha256 or
+// bcrypt hash, the formats accepted from outside (e.g. CASPASTE_ADMIN_PASSWORD_HASH)
+func ValidHash(encodedHash string) bool {
+	if _, ok := parseArgon2Params(encodedHash); ok {
+		return true
+	}
+	if _, ok := parsePBKDF2Iterations(encodedHash); ok {
+		return true
+	}
+	if isBcryptHash(encodedHash) {
+		_, err := bcrypt.Cost([]byte(encodedHash))
 		return err == nil
 	}
+	return false
+}
+
+// isBcryptHash reports whether a hash uses a bcrypt prefix ($2a$, $2b$, $2y$)
+func isBcryptHash(encodedHash string) bool {
+	return strings.HasPrefix(encodedHash, "$2a$") ||
+		strings.HasPrefix(encodedHash, "$2b$") ||
+		strings.HasPrefix(encodedHash, "$2y$")
+}
 
-	// Unrecognized hash format - reject
+func (data Data) Check(user string, pass string) bool {
+	storedPass, exist := data[user]
+	if !exist {
+		return false
+	}
+
+	// Argon2id (any parameters), pbkdf2-sha256 or bcrypt (migration support)
 	// Per AI.md PART 11: NEVER store or accept plaintext passwords
-	return false
+	return VerifyHash(storedPass, pass)
 }
 
-// HashPassword generates an argon2id hash from a plain text password
+// HashPassword generates an argon2id hash from a plain text password, or a
+// pbkdf2-sha256 one in strict crypto mode
 // Use this to create password hashes for the caspasswd file
 // Returns hash in format: $argon2id$v=19$m=65536,t=3,p=4$salt$hash
 func HashPassword(password string) (string, error) {
+	if cryptopolicy.Strict() {
+		return hashPBKDF2(password)
+	}
+
 	// Generate random salt
 	salt := make([]byte, ArgonSaltLen)
 	_, err := cryptoRandRead(salt)
@@ -120,8 +273,9 @@ func HashPassword(password string) (string, error) {
 		return "", err
 	}
 
-	// Generate the hash
-	hash := argon2.IDKey([]byte(password), salt, ArgonTime, ArgonMemory, ArgonThreads, ArgonKeyLen)
+	// Generate the hash with the configured parameters
+	p := currentParams
+	hash := argon2.IDKey([]byte(password), salt, p.Time, p.Memory, p.Threads, ArgonKeyLen)
 
 	// Encode to base64
 	b64Salt := base64.RawStdEncoding.EncodeToString(salt)
@@ -129,7 +283,7 @@ func HashPassword(password string) (string, error) {
 
 	// Format: $argon2id$v=19$m=65536,t=3,p=4$salt$hash
 	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
-		argon2.Version, ArgonMemory, ArgonTime, ArgonThreads, b64Salt, b64Hash), nil
+		argon2.Version, p.Memory, p.Time, p.Threads, b64Salt, b64Hash), nil
 }
 
 // verifyArgon2Hash verifies an argon2id hash
@@ -168,6 +322,42 @@ func verifyArgon2Hash(encodedHash, password string) bool {
 	return subtle.ConstantTimeCompare(hash, expectedHash) == 1
 }
 
+// hashPBKDF2 generates a hash in format: $pbkdf2-sha256$i=600000$salt$hash
+func hashPBKDF2(password string) (string, error) {
+	salt := make([]byte, ArgonSaltLen)
+	if _, err := cryptoRandRead(salt); err != nil {
+		return "", err
+	}
+	hash, err := pbkdf2.Key(sha256.New, password, salt, PBKDF2Iterations, ArgonKeyLen)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%si=%d$%s$%s", pbkdf2Prefix, PBKDF2Iterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(hash)), nil
+}
+
+// verifyPBKDF2Hash verifies a pbkdf2-sha256 hash
+func verifyPBKDF2Hash(encodedHash, password string) bool {
+	iterations, ok := parsePBKDF2Iterations(encodedHash)
+	if !ok {
+		return false
+	}
+	parts := strings.Split(encodedHash, "$")
+	salt, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	expectedHash, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false
+	}
+	hash, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(expectedHash))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(hash, expectedHash) == 1
+}
+
 // cryptoRandRead is a helper to read random bytes using crypto/rand
 func cryptoRandRead(b []byte) (int, error) {
 	return rand.Read(b)
@@ -184,15 +374,7 @@ func LoadAndCheck(path string, user string, pass string) (bool, error) {
 
 // GenerateRandomPassword generates a random password of specified length
 func GenerateRandomPassword(length int) (string, error) {
-	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789!@#$%^&*"
-	b := make([]byte, length)
-	if _, err := rand.Read(b); err != nil {
-		return "", err
-	}
-	for i := range b {
-		b[i] = charset[int(b[i])%len(charset)]
-	}
-	return string(b), nil
+	return securetoken.GenerateString(length, securetoken.Password)
 }
 
 // GenerateCredentialsFile creates a password file with auto-generated admin credentials
@@ -235,29 +417,16 @@ func FileExistsAndHasUsers(path string) bool {
 	return len(data) > 0
 }
 
-// NeedsRehash checks if a user's password needs to be rehashed to Argon2id
-// Returns true for bcrypt hashes (migration from legacy systems)
+// NeedsRehash checks if a user's password needs to be rehashed
+// Returns true for bcrypt hashes (migration from legacy systems) and for
+// argon2id hashes created with weaker parameters than currently configured
 // Per AI.md PART 11: bcrypt passwords should be automatically migrated to Argon2id
 func (data Data) NeedsRehash(user string) bool {
 	storedPass, exist := data[user]
 	if !exist {
 		return false
 	}
-
-	// Argon2id hashes do NOT need rehashing
-	if strings.HasPrefix(storedPass, "$argon2id$") {
-		return false
-	}
-
-	// Bcrypt hashes need rehashing to Argon2id
-	if strings.HasPrefix(storedPass, "$2a$") ||
-		strings.HasPrefix(storedPass, "$2b$") ||
-		strings.HasPrefix(storedPass, "$2y$") {
-		return true
-	}
-
-	// Unrecognized format - no rehash (Check() will reject it anyway)
-	return false
+	return HashNeedsRehash(storedPass)
 }
 
 // RehashPassword rehashes a user's password to Argon2id and updates the password file
@@ -273,7 +442,7 @@ func RehashPassword(path, user, password string) error {
 	// Generate new Argon2id hash
 	newHash, err := HashPassword(password)
 	if err != nil {
-		return fmt.Errorf("failed to generate Argon2id hash: %w", err)
+		return fmt.Errorf("failed to generate password hash: %w", err)
 	}
 
 	// Update the user's password
@@ -283,6 +452,30 @@ func RehashPassword(path, user, password string) error {
 	return writePasswordFile(path, data)
 }
 
+// SetUserHash sets the password hash of user, creating the file if needed
+// Other users in the file are kept
+func SetUserHash(path, user, encodedHash string) error {
+	if user == "" || strings.Contains(user, ":") {
+		return fmt.Errorf("invalid username %q", user)
+	}
+	if !ValidHash(encodedHash) {
+		return errors.New("password hash must be argon2id, pbkdf2-sha256 or bcrypt")
+	}
+
+	data, err := LoadFile(path)
+	if err != nil {
+		if _, statErr := os.Stat(path); !os.IsNotExist(statErr) {
+			return fmt.Errorf("failed to load password file: %w", err)
+		}
+		data = make(Data)
+	}
+	if data[user] == encodedHash {
+		return nil
+	}
+	data[user] = encodedHash
+	return writePasswordFile(path, data)
+}
+
 // writePasswordFile writes the password data to file
 func writePasswordFile(path string, data Data) error {
 	var content strings.Builder
@@ -12,6 +12,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/casjay-forks/caspaste/src/validation"
 )
 
 func exitOnError(msg string) {
@@ -167,8 +169,9 @@ func writeVar(val string, to interface{}, preHook func(string) (string, error))
 		*to = val
 
 	case *bool:
-		val := true
-		*to = val
+		// Only environment variables reach here; CASPASTE_X=false turns a switch off
+		parsed, ok := validation.ParseBool(val)
+		*to = parsed || !ok
 
 	case *uint:
 		val, err := strconv.ParseUint(val, 10, 64)
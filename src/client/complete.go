@@ -0,0 +1,235 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	// historySize is the number of recent paste IDs kept for completion
+	historySize = 100
+	// completionCacheTTL is how long server values are reused by completion
+	completionCacheTTL = 24 * time.Hour
+	// completionTimeout keeps tab completion responsive on slow servers
+	completionTimeout = 2 * time.Second
+)
+
+// Values completed when the server cannot be reached
+var (
+	fallbackSyntaxes  = []string{"plaintext", "go", "python", "javascript", "typescript", "rust", "java", "c", "cpp", "ruby", "php", "bash", "shell", "json", "yaml", "xml", "html", "css", "markdown", "sql"}
+	fallbackTemplates = []string{"incident", "stacktrace", "config-diff", "sql-explain"}
+	lifetimeValues    = []string{"10m", "1h", "1d", "1w", "1M", "1y", "never"}
+)
+
+// completionCache is the on-disk cache of values fetched from the server
+type completionCache struct {
+	Server    string    `json:"server"`
+	FetchedAt time.Time `json:"fetchedAt"`
+	Values    []string  `json:"values"`
+}
+
+// getCachePath returns the path of a file in the CLI cache directory
+func getCachePath(name string) string {
+	// Check XDG_CACHE_HOME first
+	if xdg := os.Getenv("XDG_CACHE_HOME"); xdg != "" {
+		return filepath.Join(xdg, "casjay-forks", "caspaste", name)
+	}
+	// Windows keeps per-user caches in %LOCALAPPDATA%
+	if runtime.GOOS == "windows" {
+		if dir, err := os.UserCacheDir(); err == nil {
+			return filepath.Join(dir, "casjay-forks", "caspaste", name)
+		}
+	}
+	// Fall back to ~/.cache
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".cache", "casjay-forks", "caspaste", name)
+}
+
+// loadHistory returns recently used paste IDs, newest first
+func loadHistory() []string {
+	path := getCachePath("history")
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(string(data))
+}
+
+// recordHistory remembers a paste ID for completion, ignoring write errors
+func recordHistory(id string) {
+	path := getCachePath("history")
+	if path == "" || id == "" {
+		return
+	}
+
+	ids := []string{id}
+	for _, old := range loadHistory() {
+		if old != id && len(ids) < historySize {
+			ids = append(ids, old)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return
+	}
+	os.WriteFile(path, []byte(strings.Join(ids, "\n")+"\n"), 0600)
+}
+
+// forgetHistory drops a deleted paste ID from the completion history
+func forgetHistory(id string) {
+	path := getCachePath("history")
+	if path == "" {
+		return
+	}
+
+	history := loadHistory()
+	var ids []string
+	for _, old := range history {
+		if old != id {
+			ids = append(ids, old)
+		}
+	}
+	if len(ids) == len(history) {
+		return
+	}
+	os.WriteFile(path, []byte(strings.Join(ids, "\n")+"\n"), 0600)
+}
+
+// handleComplete prints completion candidates, one per line, for shell scripts
+// Usage: caspaste-cli __complete ids|syntaxes|templates|lifetimes|config-keys
+func handleComplete() {
+	if len(os.Args) < 3 {
+		os.Exit(1)
+	}
+	quietRequests = true
+
+	var values []string
+	switch os.Args[2] {
+	case "ids":
+		values = loadHistory()
+	case "syntaxes":
+		values = serverValues("syntaxes", fetchSyntaxes, fallbackSyntaxes)
+	case "templates":
+		values = serverValues("templates", fetchTemplateNames, fallbackTemplates)
+	case "lifetimes":
+		values = lifetimeValues
+	case "config-keys":
+		values = configKeyNames()
+	default:
+		os.Exit(1)
+	}
+
+	for _, v := range values {
+		fmt.Println(v)
+	}
+}
+
+// serverValues returns values from the cache, refreshing it from the server
+// when it is stale or belongs to another server
+func serverValues(name string, fetch func(Config) ([]string, error), fallback []string) []string {
+	cfg := loadConfig()
+	if cfg.Server == "" {
+		return fallback
+	}
+
+	path := getCachePath("completion-" + name + ".json")
+	var cache completionCache
+	if path != "" {
+		if data, err := os.ReadFile(path); err == nil && json.Unmarshal(data, &cache) == nil {
+			if cache.Server == cfg.Server && time.Since(cache.FetchedAt) < completionCacheTTL && len(cache.Values) > 0 {
+				return cache.Values
+			}
+		}
+	}
+
+	values, err := fetch(cfg)
+	if err != nil || len(values) == 0 {
+		// A stale list for the same server beats the generic one
+		if cache.Server == cfg.Server && len(cache.Values) > 0 {
+			return cache.Values
+		}
+		return fallback
+	}
+
+	if path != "" && os.MkdirAll(filepath.Dir(path), 0700) == nil {
+		cache = completionCache{Server: cfg.Server, FetchedAt: time.Now(), Values: values}
+		if data, err := json.Marshal(cache); err == nil {
+			os.WriteFile(path, data, 0600)
+		}
+	}
+	return values
+}
+
+// fetchCompletionData makes a short GET request and returns the response data
+func fetchCompletionData(endpoint string, cfg Config) (json.RawMessage, error) {
+	resp, err := makeRequestTimeout("GET", endpoint, nil, "", cfg, completionTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("server returned %s", resp.Status)
+	}
+	return parseAPIResponse(body)
+}
+
+func fetchSyntaxes(cfg Config) ([]string, error) {
+	data, err := fetchCompletionData("/api/v1/server/info", cfg)
+	if err != nil {
+		return nil, err
+	}
+	var info ServerInfoResponse
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, err
+	}
+
+	// Shells split candidates on whitespace, so complete the lexer names
+	// in the lowercase form the server also accepts
+	syntaxes := make([]string, 0, len(info.Syntaxes))
+	for _, s := range info.Syntaxes {
+		if !strings.ContainsAny(s, " \t") {
+			syntaxes = append(syntaxes, strings.ToLower(s))
+		}
+	}
+	return syntaxes, nil
+}
+
+func fetchTemplateNames(cfg Config) ([]string, error) {
+	data, err := fetchCompletionData("/api/v1/templates", cfg)
+	if err != nil {
+		return nil, err
+	}
+	var templates []TemplateResponse
+	if err := json.Unmarshal(data, &templates); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(templates))
+	for _, t := range templates {
+		names = append(names, t.Name)
+	}
+	return names, nil
+}
@@ -0,0 +1,337 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configKeys lists the keys accepted by config get, set and unset
+// with the environment variable that overrides each of them
+var configKeys = []struct {
+	Name string
+	Env  string
+}{
+	{"server", "CASPASTE_SERVER"},
+	{"servers", "CASPASTE_SERVERS"},
+	{"username", "CASPASTE_USERNAME"},
+	{"password", "CASPASTE_PASSWORD"},
+	{"update_branch", "CASPASTE_UPDATE_BRANCH"},
+	{"timeout", "CASPASTE_TIMEOUT"},
+	{"retries", "CASPASTE_RETRIES"},
+	{"proxy", "CASPASTE_PROXY"},
+	{"ca_file", "CASPASTE_CA_FILE"},
+	{"client_cert", "CASPASTE_CLIENT_CERT"},
+	{"client_key", "CASPASTE_CLIENT_KEY"},
+}
+
+func handleConfig() {
+	args := os.Args[2:]
+	if len(args) == 0 {
+		showConfig()
+		return
+	}
+
+	switch args[0] {
+	case "show":
+		showConfig()
+	case "get":
+		if len(args) != 2 {
+			configUsageError("config get KEY")
+		}
+		handleConfigGet(args[1])
+	case "set":
+		if len(args) != 3 {
+			configUsageError("config set KEY VALUE")
+		}
+		handleConfigSet(args[1], args[2])
+	case "unset":
+		if len(args) != 2 {
+			configUsageError("config unset KEY")
+		}
+		handleConfigSet(args[1], "")
+	case "edit":
+		handleConfigEdit()
+	case "-h", "--help", "help":
+		printCommandHelp("config")
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown config command: %s\n\n", args[0])
+		printCommandHelp("config")
+		os.Exit(1)
+	}
+}
+
+func configUsageError(usage string) {
+	fmt.Fprintf(os.Stderr, "Usage: caspaste-cli %s\n", usage)
+	os.Exit(1)
+}
+
+func configKeyNames() []string {
+	names := make([]string, 0, len(configKeys))
+	for _, key := range configKeys {
+		names = append(names, key.Name)
+	}
+	return names
+}
+
+// configField returns the field of cfg stored under key
+func configField(cfg *Config, key string) (*string, error) {
+	switch key {
+	case "server":
+		return &cfg.Server, nil
+	case "username":
+		return &cfg.Username, nil
+	case "password":
+		return &cfg.Password, nil
+	case "update_branch":
+		return &cfg.UpdateBranch, nil
+	case "timeout":
+		return &cfg.Timeout, nil
+	case "retries":
+		return &cfg.Retries, nil
+	case "proxy":
+		return &cfg.Proxy, nil
+	case "ca_file":
+		return &cfg.CAFile, nil
+	case "client_cert":
+		return &cfg.ClientCert, nil
+	case "client_key":
+		return &cfg.ClientKey, nil
+	}
+	return nil, fmt.Errorf("unknown config key %q (valid keys: %s)", key, strings.Join(configKeyNames(), ", "))
+}
+
+// validateConfig checks values before they are written to the config file
+func validateConfig(cfg Config) error {
+	if cfg.Server != "" {
+		u, err := url.Parse(cfg.Server)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("server: %q is not an http(s) URL", cfg.Server)
+		}
+	}
+	for _, server := range cfg.Servers {
+		u, err := url.Parse(server)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("servers: %q is not an http(s) URL", server)
+		}
+	}
+	if strings.Contains(cfg.Username, ":") {
+		return errors.New("username: must not contain ':'")
+	}
+	if strings.ContainsAny(cfg.Username, "\r\n") || strings.ContainsAny(cfg.Password, "\r\n") {
+		return errors.New("username and password must not contain line breaks")
+	}
+	if cfg.UpdateBranch != "" && !validUpdateBranch(cfg.UpdateBranch) {
+		return fmt.Errorf("update_branch: %q is not one of %s", cfg.UpdateBranch, strings.Join(updateBranches, ", "))
+	}
+	if cfg.Timeout != "" {
+		if _, err := parseTimeout(cfg.Timeout); err != nil {
+			return err
+		}
+	}
+	if cfg.Retries != "" {
+		if _, err := parseRetries(cfg.Retries); err != nil {
+			return err
+		}
+	}
+	return validateTransport(cfg)
+}
+
+func showConfig() {
+	cfg := loadConfig()
+	configPath := getConfigPath()
+
+	fmt.Printf("Config file: %s\n", configPath)
+	if _, err := os.Stat(getMachineConfigPath()); err == nil {
+		fmt.Printf("Machine config: %s\n", getMachineConfigPath())
+	}
+	fmt.Println()
+	fmt.Printf("Server:   %s\n", cfg.Server)
+	if len(cfg.Servers) > 0 {
+		fmt.Printf("Fallback: %s\n", strings.Join(cfg.Servers, ", "))
+	}
+	fmt.Printf("Username: %s\n", cfg.Username)
+	if cfg.Password != "" {
+		fmt.Printf("Password: ******* (set)\n")
+	} else {
+		fmt.Printf("Password: (not set)\n")
+	}
+	fmt.Printf("Updates:  %s branch\n", updateBranch(cfg))
+	timeout := "none"
+	if d := requestTimeout(cfg); d > 0 {
+		timeout = d.String()
+	}
+	fmt.Printf("Timeout:  %s, %d retries\n", timeout, requestRetries(cfg))
+	if cfg.Proxy != "" {
+		fmt.Printf("Proxy:    %s\n", cfg.Proxy)
+	}
+	if cfg.CAFile != "" {
+		fmt.Printf("CA file:  %s\n", cfg.CAFile)
+	}
+	if cfg.ClientCert != "" {
+		fmt.Printf("Client certificate: %s\n", cfg.ClientCert)
+	}
+}
+
+// handleConfigGet prints the value the CLI will use, including environment overrides
+func handleConfigGet(key string) {
+	cfg := loadConfig()
+	if key == "servers" {
+		// A list, shown the way config set and CASPASTE_SERVERS take it
+		if len(cfg.Servers) == 0 {
+			os.Exit(1)
+		}
+		fmt.Println(strings.Join(cfg.Servers, ","))
+		return
+	}
+	field, err := configField(&cfg, key)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if *field == "" {
+		os.Exit(1)
+	}
+	fmt.Println(*field)
+}
+
+// handleConfigSet sets or, with an empty value, removes a key in the config file
+func handleConfigSet(key, value string) {
+	cfg := loadConfigFile()
+	if key == "servers" {
+		cfg.Servers = splitServers(value)
+	} else {
+		field, err := configField(&cfg, key)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if key == "server" {
+			value = strings.TrimSuffix(value, "/")
+		}
+		*field = value
+	}
+
+	if err := validateConfig(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := saveConfig(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	for _, k := range configKeys {
+		if k.Name == key && os.Getenv(k.Env) != "" {
+			fmt.Fprintf(os.Stderr, "Warning: %s is set and overrides %s\n", k.Env, key)
+		}
+	}
+}
+
+// handleConfigEdit opens a copy of the config file in an editor and saves it
+// only if it is still valid
+func handleConfigEdit() {
+	configPath := getConfigPath()
+	if configPath == "" {
+		fmt.Fprintln(os.Stderr, "Error: could not determine config path")
+		os.Exit(1)
+	}
+	if err := os.MkdirAll(filepath.Dir(configPath), 0700); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to create config directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		data, _ = yaml.Marshal(Config{})
+	}
+
+	// Edit a copy next to the config so a broken file never replaces it
+	tmp, err := os.CreateTemp(filepath.Dir(configPath), "cli-*.yml")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	tmpPath := tmp.Name()
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := runEditor(tmpPath); err != nil {
+		os.Remove(tmpPath)
+		fmt.Fprintf(os.Stderr, "Error: editor failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	edited, err := os.ReadFile(tmpPath)
+	if err != nil {
+		os.Remove(tmpPath)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var cfg Config
+	decoder := yaml.NewDecoder(bytes.NewReader(edited))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		fmt.Fprintf(os.Stderr, "Error: invalid config: %v\nYour changes were kept in %s\n", err, tmpPath)
+		os.Exit(1)
+	}
+	if err := validateConfig(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid config: %v\nYour changes were kept in %s\n", err, tmpPath)
+		os.Exit(1)
+	}
+
+	os.Remove(tmpPath)
+	if err := saveConfig(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Configuration saved to %s\n", configPath)
+}
+
+// runEditor opens path in $VISUAL or $EDITOR, which may include arguments
+func runEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		}
+	}
+
+	parts := strings.Fields(editor)
+	cmd := exec.Command(parts[0], append(parts[1:], path)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
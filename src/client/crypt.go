@@ -0,0 +1,90 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// End-to-end encrypted pastes, compatible with the web UI (crypt.js): the body
+// is base64(12-byte nonce || AES-256-GCM ciphertext and tag), and the key is
+// base64url without padding in the URL fragment, which the server never sees
+
+var errNoKey = errors.New("paste is encrypted; give the full URL or ID#key")
+
+// newPasteKey returns a random key in its URL form
+func newPasteKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(key), nil
+}
+
+func pasteCipher(key string) (cipher.AEAD, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(key, "="))
+	if err != nil || len(raw) != 32 {
+		return nil, errors.New("invalid paste key")
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptBody seals a paste body with a key from newPasteKey
+func encryptBody(plain []byte, key string) (string, error) {
+	aead, err := pasteCipher(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, plain, nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptBody opens a body sealed by encryptBody or the web UI
+func decryptBody(body, key string) (string, error) {
+	aead, err := pasteCipher(key)
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(body))
+	if err != nil || len(data) < aead.NonceSize()+aead.Overhead() {
+		return "", errors.New("paste body is not encrypted data")
+	}
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("wrong key for this paste")
+	}
+	return string(plain), nil
+}
+
+// splitPasteRef splits "ID", "ID#key" or a paste URL into the ID and key
+func splitPasteRef(ref string) (id, key string) {
+	id, key, _ = strings.Cut(ref, "#")
+	if strings.Contains(id, "://") {
+		if u, err := url.Parse(id); err == nil {
+			id = u.Path
+		}
+	}
+	id = strings.TrimRight(id, "/")
+	if i := strings.LastIndex(id, "/"); i >= 0 {
+		id = id[i+1:]
+	}
+	return id, key
+}
@@ -0,0 +1,75 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// quietRequests keeps requests from writing to the terminal, for shell
+// completion, which runs while the user is typing
+var quietRequests bool
+
+// requestServers returns the servers a request may go to, in order: the
+// configured server, then the fallbacks for reads that are safe to repeat
+func requestServers(cfg Config, method string, canRetry bool) []string {
+	servers := []string{strings.TrimSuffix(cfg.Server, "/")}
+	if !canRetry || (method != "GET" && method != "HEAD") {
+		return servers
+	}
+	for _, server := range cfg.Servers {
+		server = strings.TrimSuffix(server, "/")
+		if server == "" || containsString(servers, server) {
+			continue
+		}
+		servers = append(servers, server)
+	}
+	return servers
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// splitServers parses a comma-separated list of servers, as in CASPASTE_SERVERS
+func splitServers(value string) []string {
+	var servers []string
+	for _, server := range strings.Split(value, ",") {
+		if server = strings.TrimSpace(server); server != "" {
+			servers = append(servers, strings.TrimSuffix(server, "/"))
+		}
+	}
+	return servers
+}
+
+// failureReason shortens a request error to its cause; the server is
+// already named next to it
+func failureReason(err error) string {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err.Error()
+	}
+	return err.Error()
+}
+
+// reportFailover tells the user which server answered and why the ones
+// before it were skipped
+func reportFailover(server string, failures []string) {
+	if quietRequests {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Note: using %s (%s)\n", server, strings.Join(failures, "; "))
+}
@@ -0,0 +1,93 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+)
+
+type ForkPasteResponse struct {
+	ID     string `json:"id"`
+	URL    string `json:"url"`
+	ForkOf string `json:"forkOf"`
+	Author string `json:"author"`
+}
+
+func handleFork() {
+	cfg := loadConfig()
+
+	args := parseCommand("fork")
+	pasteID, key := splitPasteRef(args.Positional[0])
+
+	form := url.Values{}
+	if args.Has("editable") {
+		form.Set("editable", "true")
+	}
+
+	// POST /api/v1/pastes/{id}/fork
+	resp, err := makeRequest("POST", "/api/v1/pastes/"+url.PathEscape(pasteID)+"/fork", strings.NewReader(form.Encode()), "application/x-www-form-urlencoded", cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	switch resp.StatusCode {
+	case 200:
+	case 400:
+		fmt.Fprintf(os.Stderr, "Error: This paste cannot be forked (burn-after-reading pastes and short URLs cannot)\n")
+		os.Exit(1)
+	case 401:
+		fmt.Fprintf(os.Stderr, "Error: Authentication required. Run 'caspaste-cli login' to configure credentials.\n")
+		os.Exit(3)
+	case 404:
+		fmt.Fprintf(os.Stderr, "Error: Paste not found\n")
+		os.Exit(4)
+	default:
+		// Parse unified error response per AI.md PART 16
+		_, parseErr := parseAPIResponse(body)
+		if parseErr != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", parseErr)
+		} else {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", resp.Status)
+		}
+		os.Exit(1)
+	}
+
+	data, parseErr := parseAPIResponse(body)
+	if parseErr != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", parseErr)
+		os.Exit(1)
+	}
+
+	var result ForkPasteResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing response: %v\n", err)
+		os.Exit(1)
+	}
+
+	recordHistory(result.ID)
+
+	fmt.Printf("Paste forked from %s\n", result.ForkOf)
+	fmt.Printf("ID:  %s\n", result.ID)
+	// An encrypted fork opens with the key of the paste it copies
+	if key != "" {
+		fmt.Printf("URL: %s#%s\n", result.URL, key)
+	} else {
+		fmt.Printf("URL: %s\n", result.URL)
+	}
+	if result.Author != "" {
+		fmt.Printf("Author: %s\n", result.Author)
+	}
+}
@@ -17,8 +17,11 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"gopkg.in/yaml.v3"
 
@@ -36,9 +39,25 @@ var (
 
 // Config represents the CLI configuration file
 type Config struct {
-	Server   string `yaml:"server"`
-	Username string `yaml:"username"`
-	Password string `yaml:"password"`
+	Server string `yaml:"server"`
+	// Servers are tried in order for reads when Server cannot be reached
+	// or fails with a 5xx error
+	Servers  []string `yaml:"servers,omitempty"`
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	// UpdateBranch is the release channel of 'caspaste-cli update'
+	UpdateBranch string `yaml:"update_branch,omitempty"`
+	// Timeout of each request, e.g. "30s"; "0" waits forever
+	Timeout string `yaml:"timeout,omitempty"`
+	// Retries of a request that failed in a way worth retrying
+	Retries string `yaml:"retries,omitempty"`
+	// Proxy URL (http, https, socks5, socks5h), or "none" to ignore HTTPS_PROXY
+	Proxy string `yaml:"proxy,omitempty"`
+	// PEM file of CA certificates trusted besides the system ones
+	CAFile string `yaml:"ca_file,omitempty"`
+	// PEM client certificate, and its key if not in the same file
+	ClientCert string `yaml:"client_cert,omitempty"`
+	ClientKey  string `yaml:"client_key,omitempty"`
 }
 
 // APIResponse is the unified response wrapper per AI.md PART 16
@@ -47,32 +66,63 @@ type APIResponse struct {
 	Data    json.RawMessage `json:"data,omitempty"`
 	Error   string          `json:"error,omitempty"`
 	Message string          `json:"message,omitempty"`
+	// EndsAt is set on MAINTENANCE errors during a scheduled window
+	EndsAt int64 `json:"ends_at,omitempty"`
 }
 
 // API response types (data payloads)
 type NewPasteResponse struct {
-	ID         string `json:"id"`
-	URL        string `json:"url"`
-	CreateTime int64  `json:"createTime"`
-	DeleteTime int64  `json:"deleteTime"`
+	ID         string           `json:"id"`
+	URL        string           `json:"url"`
+	CreateTime int64            `json:"createTime"`
+	DeleteTime int64            `json:"deleteTime"`
+	Redaction  *RedactionReport `json:"redaction,omitempty"`
+	// Set when the paste was added to a series; the key only for a new one
+	Series     string `json:"series,omitempty"`
+	SeriesPart int    `json:"seriesPart,omitempty"`
+	SeriesKey  string `json:"seriesKey,omitempty"`
+}
+
+// RedactionReport lists values the server masked before storing a paste
+type RedactionReport struct {
+	Total   int            `json:"total"`
+	Matches map[string]int `json:"matches"`
 }
 
 type GetPasteResponse struct {
-	ID         string `json:"id"`
-	Title      string `json:"title"`
-	Body       string `json:"body"`
-	Syntax     string `json:"syntax"`
-	CreateTime int64  `json:"createTime"`
-	DeleteTime int64  `json:"deleteTime"`
-	OneUse     bool   `json:"oneUse"`
+	ID         string   `json:"id"`
+	Title      string   `json:"title"`
+	Body       string   `json:"body"`
+	Syntax     string   `json:"syntax"`
+	CreateTime int64    `json:"createTime"`
+	DeleteTime int64    `json:"deleteTime"`
+	OneUse     bool     `json:"oneUse"`
+	MaxViews   int      `json:"maxViews"`
+	ViewsLeft  int      `json:"viewsLeft"`
+	Encrypted  bool     `json:"encrypted"`
+	IsFile     bool     `json:"isFile"`
+	Tags       []string `json:"tags"`
+	ForkOf     string   `json:"forkOf"`
+	Forks      int      `json:"forks"`
+
+	Signature *PasteSignature `json:"signature"`
+}
+
+type TemplateResponse struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Title       string `json:"title"`
+	Body        string `json:"body"`
+	Syntax      string `json:"syntax"`
 }
 
 type ListPasteItem struct {
-	ID         string `json:"id"`
-	Title      string `json:"title"`
-	Syntax     string `json:"syntax"`
-	CreateTime int64  `json:"createTime"`
-	DeleteTime int64  `json:"deleteTime"`
+	ID         string   `json:"id"`
+	Title      string   `json:"title"`
+	Syntax     string   `json:"syntax"`
+	CreateTime int64    `json:"createTime"`
+	DeleteTime int64    `json:"deleteTime"`
+	Tags       []string `json:"tags"`
 }
 
 type ListResponse struct {
@@ -80,8 +130,30 @@ type ListResponse struct {
 	Total  int             `json:"total"`
 }
 
+type PeersResponse struct {
+	Enabled bool        `json:"enabled"`
+	Updated int64       `json:"updated"`
+	Servers []PeerEntry `json:"servers"`
+}
+
+type PeerEntry struct {
+	Name     string `json:"name"`
+	URL      string `json:"url"`
+	Version  string `json:"version"`
+	Policies struct {
+		Public      bool  `json:"public"`
+		MaxLifeTime int64 `json:"maxLifeTime"`
+	} `json:"policies"`
+	Capacity struct {
+		BodyMaxLength int    `json:"bodyMaxLength"`
+		Pastes        string `json:"pastes"`
+	} `json:"capacity"`
+}
+
 type ServerInfoResponse struct {
 	Version           string   `json:"version"`
+	APIVersion        string   `json:"apiVersion"`
+	MinClientVersion  string   `json:"minClientVersion"`
 	TitleMaxLen       int      `json:"titleMaxlength"`
 	BodyMaxLen        int      `json:"bodyMaxlength"`
 	MaxLifeTime       int64    `json:"maxLifeTime"`
@@ -105,6 +177,10 @@ func parseAPIResponse(body []byte) (json.RawMessage, error) {
 	}
 
 	if !resp.OK {
+		if resp.EndsAt != 0 {
+			return nil, fmt.Errorf("%s: %s (until %s)", resp.Error, resp.Message,
+				time.Unix(resp.EndsAt, 0).Format(time.RFC3339))
+		}
 		if resp.Message != "" {
 			return nil, fmt.Errorf("%s: %s", resp.Error, resp.Message)
 		}
@@ -122,10 +198,40 @@ func parseAPIResponse(body []byte) (json.RawMessage, error) {
 func main() {
 	// Handle --shell completions/init commands first (per AI.md PART 8/33)
 	if len(os.Args) >= 2 && os.Args[1] == "--shell" {
-		completion.Handle(os.Args[1:])
+		completion.HandleSpec(os.Args[1:], cliSpec, Version)
 		return
 	}
 
+	// Global flags before the command: --strict refuses servers that need a
+	// newer client, --no-retry sends each request once, --proxy and
+	// --insecure change how the server is reached
+	for len(os.Args) >= 2 {
+		n := 1
+		switch arg := os.Args[1]; {
+		case arg == "--strict":
+			strictVersion = true
+		case arg == "--no-retry":
+			noRetry = true
+		case arg == "--insecure":
+			insecureTLS = true
+		case arg == "--proxy":
+			if len(os.Args) < 3 {
+				fmt.Fprintln(os.Stderr, "Error: --proxy needs a URL")
+				os.Exit(1)
+			}
+			flagProxy = os.Args[2]
+			n = 2
+		case strings.HasPrefix(arg, "--proxy="):
+			flagProxy = strings.TrimPrefix(arg, "--proxy=")
+		default:
+			n = 0
+		}
+		if n == 0 {
+			break
+		}
+		os.Args = append(os.Args[:1], os.Args[1+n:]...)
+	}
+
 	// Detect display mode per AI.md PART 33
 	mode := display.DetectForCLI()
 
@@ -141,8 +247,16 @@ func main() {
 
 	command := os.Args[1]
 
+	// "<command> --help" and "help <command>" print the command's help
+	if len(os.Args) > 2 && (os.Args[2] == "-h" || os.Args[2] == "--help") && printCommandHelp(command) {
+		return
+	}
+
 	switch command {
 	case "help", "--help", "-h":
+		if len(os.Args) > 2 && printCommandHelp(os.Args[2]) {
+			return
+		}
 		printUsage()
 	case "version", "--version", "-v":
 		fmt.Printf("caspaste-cli v%s\n", Version)
@@ -154,10 +268,28 @@ func main() {
 		handleGet()
 	case "list", "ls":
 		handleList()
+	case "edit":
+		handleEdit()
+	case "delete", "rm":
+		handleDelete()
+	case "fork":
+		handleFork()
+	case "share":
+		handleShare()
+	case "templates":
+		handleTemplates()
+	case "rec":
+		handleRec()
+	case "update":
+		handleUpdate()
 	case "info", "server-info":
 		handleServerInfo()
+	case "__complete":
+		handleComplete()
 	case "health", "healthz":
 		handleHealth()
+	case "servers", "peers":
+		handleServers()
 	case "login":
 		// If TUI mode available, use TUI setup wizard
 		if mode == display.ModeTUI {
@@ -224,57 +356,7 @@ func launchSetupWizard() {
 }
 
 func printUsage() {
-	fmt.Printf(`CasPaste CLI v%s
-A command-line client for CasPaste pastebin servers.
-
-Usage: caspaste-cli <command> [options]
-
-Commands:
-  config              Show or edit configuration
-  login               Configure server and credentials interactively
-  new, create, paste  Create a new paste
-  get, show, view     Get a paste by ID
-  list, ls            List pastes
-  info, server-info   Get server information
-  health, healthz     Check server health
-  help                Show this help message
-  version             Show version
-
-Shell Completions:
-  --shell completions [SHELL]   Print shell completion script
-  --shell init [SHELL]          Print shell init command for eval
-  --shell --help                Show shell integration help
-
-  Supported shells: bash, zsh, fish, sh, dash, ksh, powershell, pwsh
-  If SHELL is omitted, it is auto-detected from $SHELL.
-
-  Example: eval "$(caspaste-cli --shell init)"
-
-Examples:
-  # Configure server and credentials
-  caspaste-cli login
-
-  # Create paste from stdin
-  echo "Hello World" | caspaste-cli new
-
-  # Create paste from file
-  caspaste-cli new -f script.py -s python
-
-  # Get a paste
-  caspaste-cli get abc123
-
-  # List recent pastes
-  caspaste-cli list -n 10
-
-Configuration:
-  Config file: ~/.config/casjay-forks/caspaste/cli.yml
-
-  Or use environment variables:
-    CASPASTE_SERVER=https://paste.example.com
-    CASPASTE_USERNAME=admin
-    CASPASTE_PASSWORD=secret
-
-`, Version)
+	fmt.Println(cliSpec.Help(Version))
 }
 
 // getConfigPath returns the path to the config file
@@ -283,6 +365,12 @@ func getConfigPath() string {
 	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
 		return filepath.Join(xdg, "casjay-forks", "caspaste", "cli.yml")
 	}
+	// Windows keeps per-user settings in %APPDATA%
+	if runtime.GOOS == "windows" {
+		if dir, err := os.UserConfigDir(); err == nil {
+			return filepath.Join(dir, "casjay-forks", "caspaste", "cli.yml")
+		}
+	}
 	// Fall back to ~/.config
 	home, err := os.UserHomeDir()
 	if err != nil {
@@ -291,18 +379,43 @@ func getConfigPath() string {
 	return filepath.Join(home, ".config", "casjay-forks", "caspaste", "cli.yml")
 }
 
-// loadConfig loads configuration from file and environment
-func loadConfig() Config {
-	var cfg Config
-
-	// Load from file first
-	configPath := getConfigPath()
-	if configPath != "" {
-		data, err := os.ReadFile(configPath)
-		if err == nil {
-			yaml.Unmarshal(data, &cfg)
+// getMachineConfigPath returns the machine-wide config file, which installers
+// and administrators use to preset values such as the server for every user
+func getMachineConfigPath() string {
+	if runtime.GOOS == "windows" {
+		programData := os.Getenv("ProgramData")
+		if programData == "" {
+			programData = `C:\ProgramData`
 		}
+		return filepath.Join(programData, "casjay-forks", "caspaste", "cli.yml")
 	}
+	return "/etc/casjay-forks/caspaste/cli.yml"
+}
+
+// readConfigFile merges the values set in path into cfg
+func readConfigFile(path string, cfg *Config) {
+	if path == "" {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		yaml.Unmarshal(data, cfg)
+	}
+}
+
+// loadConfigFile loads configuration from the user's config file only
+func loadConfigFile() Config {
+	var cfg Config
+	readConfigFile(getConfigPath(), &cfg)
+	return cfg
+}
+
+// loadConfig loads configuration from the machine and user files and environment
+func loadConfig() Config {
+	// Machine-wide values first, then the user's file overrides them
+	var cfg Config
+	readConfigFile(getMachineConfigPath(), &cfg)
+	readConfigFile(getConfigPath(), &cfg)
 
 	// Environment variables override file config
 	if server := os.Getenv("CASPASTE_SERVER"); server != "" {
@@ -314,6 +427,36 @@ func loadConfig() Config {
 	if password := os.Getenv("CASPASTE_PASSWORD"); password != "" {
 		cfg.Password = password
 	}
+	if servers := os.Getenv("CASPASTE_SERVERS"); servers != "" {
+		cfg.Servers = splitServers(servers)
+	}
+	if branch := os.Getenv("CASPASTE_UPDATE_BRANCH"); branch != "" {
+		cfg.UpdateBranch = branch
+	}
+	if timeout := os.Getenv("CASPASTE_TIMEOUT"); timeout != "" {
+		cfg.Timeout = timeout
+	}
+	if retries := os.Getenv("CASPASTE_RETRIES"); retries != "" {
+		cfg.Retries = retries
+	}
+	if proxy := os.Getenv("CASPASTE_PROXY"); proxy != "" {
+		cfg.Proxy = proxy
+	}
+	if caFile := os.Getenv("CASPASTE_CA_FILE"); caFile != "" {
+		cfg.CAFile = caFile
+	}
+	if cert := os.Getenv("CASPASTE_CLIENT_CERT"); cert != "" {
+		cfg.ClientCert = cert
+	}
+	if key := os.Getenv("CASPASTE_CLIENT_KEY"); key != "" {
+		cfg.ClientKey = key
+	}
+	if flagProxy != "" {
+		cfg.Proxy = flagProxy
+	}
+	if os.Getenv("CASPASTE_INSECURE") == "1" {
+		insecureTLS = true
+	}
 
 	return cfg
 }
@@ -344,13 +487,52 @@ func saveConfig(cfg Config) error {
 	return nil
 }
 
-// makeRequest makes an HTTP request with optional basic auth
+// makeRequest makes an HTTP request with optional basic auth, with the
+// configured timeout
 func makeRequest(method, endpoint string, body io.Reader, contentType string, cfg Config) (*http.Response, error) {
+	return makeRequestTimeout(method, endpoint, body, contentType, cfg, requestTimeout(cfg))
+}
+
+// makeRequestTimeout is makeRequest with a custom client timeout
+// Reads fail over to the fallback servers in order on connection errors and
+// 5xx responses; the last server's answer is returned whatever it is
+func makeRequestTimeout(method, endpoint string, body io.Reader, contentType string, cfg Config, timeout time.Duration) (*http.Response, error) {
 	if cfg.Server == "" {
 		return nil, fmt.Errorf("server not configured. Run 'caspaste-cli login' first")
 	}
 
-	url := strings.TrimSuffix(cfg.Server, "/") + endpoint
+	servers := requestServers(cfg, method, body == nil)
+	var failures []string
+	for i, server := range servers {
+		resp, err := sendRequest(server, method, endpoint, body, contentType, cfg, timeout)
+		if i == len(servers)-1 {
+			if err != nil && len(failures) > 0 {
+				return nil, fmt.Errorf("all servers failed: %s; %s: %s", strings.Join(failures, "; "), server, failureReason(err))
+			}
+			if err == nil && len(failures) > 0 {
+				reportFailover(server, failures)
+			}
+			return resp, err
+		}
+		if err == nil && resp.StatusCode < 500 {
+			if len(failures) > 0 {
+				reportFailover(server, failures)
+			}
+			return resp, nil
+		}
+		if err != nil {
+			failures = append(failures, server+": "+failureReason(err))
+		} else {
+			resp.Body.Close()
+			failures = append(failures, server+": "+resp.Status)
+		}
+	}
+	return nil, fmt.Errorf("no server to send the request to")
+}
+
+// sendRequest sends one request to server, retrying as retry.go describes
+func sendRequest(server, method, endpoint string, body io.Reader, contentType string, cfg Config, timeout time.Duration) (*http.Response, error) {
+	url := server + endpoint
 
 	req, err := http.NewRequest(method, url, body)
 	if err != nil {
@@ -359,6 +541,7 @@ func makeRequest(method, endpoint string, body io.Reader, contentType string, cf
 
 	// Set User-Agent per AI.md requirement
 	req.Header.Set("User-Agent", "caspaste-cli/"+Version)
+	req.Header.Set("X-Client-Version", clientVersionHeader())
 
 	if contentType != "" {
 		req.Header.Set("Content-Type", contentType)
@@ -369,22 +552,16 @@ func makeRequest(method, endpoint string, body io.Reader, contentType string, cf
 		req.SetBasicAuth(cfg.Username, cfg.Password)
 	}
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	return client.Do(req)
-}
-
-func handleConfig() {
-	cfg := loadConfig()
-	configPath := getConfigPath()
-
-	fmt.Printf("Config file: %s\n\n", configPath)
-	fmt.Printf("Server:   %s\n", cfg.Server)
-	fmt.Printf("Username: %s\n", cfg.Username)
-	if cfg.Password != "" {
-		fmt.Printf("Password: ******* (set)\n")
-	} else {
-		fmt.Printf("Password: (not set)\n")
+	transport, err := httpTransport(cfg)
+	if err != nil {
+		return nil, err
 	}
+	client := &http.Client{Timeout: timeout, Transport: transport}
+	resp, err := doWithRetry(client, req, requestRetries(cfg))
+	if err == nil {
+		checkServerVersion(resp)
+	}
+	return resp, err
 }
 
 func handleLogin() {
@@ -449,57 +626,53 @@ func handleLogin() {
 func handleNew() {
 	cfg := loadConfig()
 
-	// Parse flags
-	var title, syntax, lifetime, filePath string
-	var oneUse, private bool
-
-	args := os.Args[2:]
-	for i := 0; i < len(args); i++ {
-		switch args[i] {
-		case "-t", "--title":
-			if i+1 < len(args) {
-				title = args[i+1]
-				i++
-			}
-		case "-s", "--syntax":
-			if i+1 < len(args) {
-				syntax = args[i+1]
-				i++
-			}
-		case "-l", "--lifetime":
-			if i+1 < len(args) {
-				lifetime = args[i+1]
-				i++
-			}
-		case "-f", "--file":
-			if i+1 < len(args) {
-				filePath = args[i+1]
-				i++
+	args := parseCommand("new")
+	if args.Has("stream") {
+		handleNewStream(cfg, args)
+		return
+	}
+	title := args.Value("title")
+	syntax := args.Value("syntax")
+	lifetime := args.Value("lifetime")
+	filePath := args.Value("file")
+	templateName := args.Value("template")
+	oneUse := args.Has("one-use")
+	maxViews := args.Value("max-views")
+	tags := args.Value("tags")
+	private := args.Has("private")
+	encrypt := args.Has("encrypt")
+	signKey := args.Value("sign-key")
+	sign := args.Has("sign") || signKey != ""
+	signatureFile := args.Value("signature")
+	if (sign || signatureFile != "") && encrypt {
+		fmt.Fprintf(os.Stderr, "Error: encrypted pastes cannot be signed\n")
+		os.Exit(1)
+	}
+	if sign && signatureFile != "" {
+		fmt.Fprintf(os.Stderr, "Error: --sign and --signature cannot be used together\n")
+		os.Exit(1)
+	}
+	split := args.Has("split")
+	if split {
+		// Each part would need its own key or signature, and a part read
+		// through the index would burn
+		for _, flag := range []string{"encrypt", "sign", "sign-key", "signature", "one-use", "max-views"} {
+			if args.Has(flag) {
+				fmt.Fprintf(os.Stderr, "Error: --split cannot be used with --%s\n", flag)
+				os.Exit(1)
 			}
-		case "-1", "--one-use":
-			oneUse = true
-		case "-p", "--private":
-			private = true
-		case "-h", "--help":
-			fmt.Println(`Create a new paste
-
-Usage: caspaste-cli new [options]
-
-Options:
-  -f, --file FILE      Read content from file (default: stdin)
-  -t, --title TITLE    Paste title
-  -s, --syntax SYNTAX  Syntax highlighting (e.g., python, go, bash)
-  -l, --lifetime TIME  Expiration time (e.g., 1h, 1d, 1w, never)
-  -1, --one-use        Delete after first view
-  -p, --private        Don't show in public listings
-
-Examples:
-  echo "Hello" | caspaste-cli new
-  caspaste-cli new -f script.py -s python -t "My Script"
-  cat log.txt | caspaste-cli new -l 1h -1`)
-			return
 		}
 	}
+	var redact string
+	switch {
+	case args.Has("redact") && args.Has("no-redact"):
+		fmt.Fprintf(os.Stderr, "Error: --redact and --no-redact cannot be used together\n")
+		os.Exit(1)
+	case args.Has("redact"):
+		redact = "true"
+	case args.Has("no-redact"):
+		redact = "false"
+	}
 
 	// Read content
 	var content []byte
@@ -533,6 +706,26 @@ Examples:
 		}
 	}
 
+	// Template supplies the title, syntax and a body skeleton the content is appended to
+	if templateName != "" {
+		tmpl, err := fetchTemplate(templateName, cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if title == "" || (filePath != "" && title == filepath.Base(filePath)) {
+			title = tmpl.Title
+		}
+		if syntax == "" {
+			syntax = tmpl.Syntax
+		}
+		body := tmpl.Body
+		if len(content) > 0 && body != "" && !strings.HasSuffix(body, "\n") {
+			body += "\n"
+		}
+		content = append([]byte(body), content...)
+	}
+
 	if len(content) == 0 {
 		fmt.Fprintf(os.Stderr, "Error: empty content\n")
 		os.Exit(1)
@@ -541,6 +734,22 @@ Examples:
 	// Build form data
 	form := url.Values{}
 	form.Set("body", string(content))
+
+	// Encrypted pastes are sealed here; the key only goes into the printed URL
+	var key string
+	if encrypt {
+		key, err = newPasteKey()
+		if err == nil {
+			var sealed string
+			sealed, err = encryptBody(content, key)
+			form.Set("body", sealed)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error encrypting paste: %v\n", err)
+			os.Exit(1)
+		}
+		form.Set("encrypted", "true")
+	}
 	if title != "" {
 		form.Set("title", title)
 	}
@@ -553,10 +762,77 @@ Examples:
 	if oneUse {
 		form.Set("oneUse", "true")
 	}
+	if maxViews != "" {
+		if n, err := strconv.Atoi(maxViews); err != nil || n < 1 {
+			fmt.Fprintf(os.Stderr, "Error: --max-views must be a number of views\n")
+			os.Exit(1)
+		}
+		form.Set("maxViews", maxViews)
+	}
+	if tags != "" {
+		form.Set("tags", tags)
+	}
 	if private {
 		form.Set("private", "true")
 	}
+	if redact != "" {
+		form.Set("redact", redact)
+	}
+
+	// The signature covers the content as sent, so it is not redacted
+	// unless asked for
+	if (sign || signatureFile != "") && redact == "" {
+		form.Set("redact", "false")
+	}
+	if sign {
+		signature, publicKey, err := gpgSign(content, signKey)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error signing paste: %v\n", err)
+			os.Exit(1)
+		}
+		form.Set("signature", signature)
+		form.Set("publicKey", publicKey)
+	} else if signatureFile != "" {
+		signature, err := os.ReadFile(signatureFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading signature: %v\n", err)
+			os.Exit(1)
+		}
+		form.Set("signature", string(signature))
+	}
 
+	// Content over the server's body limit becomes a series of pastes
+	if split {
+		if limit := serverBodyLimit(cfg); limit > 0 && utf8.RuneCount(content) > limit {
+			handleNewSplit(cfg, form, string(content), title, limit)
+			return
+		}
+	}
+
+	result := createPaste(form, cfg)
+
+	fmt.Printf("Paste created!\n")
+	fmt.Printf("ID:  %s\n", result.ID)
+	if key != "" {
+		fmt.Printf("URL: %s#%s\n", result.URL, key)
+		fmt.Printf("Key: %s (only in the URL; it cannot be recovered if lost)\n", key)
+	} else {
+		fmt.Printf("URL: %s\n", result.URL)
+	}
+	if result.DeleteTime > 0 {
+		fmt.Printf("Expires: %s\n", time.Unix(result.DeleteTime, 0).Format(time.RFC3339))
+	}
+	if result.Redaction != nil && result.Redaction.Total > 0 {
+		fmt.Printf("Redacted: %d value(s)\n", result.Redaction.Total)
+		for name, count := range result.Redaction.Matches {
+			fmt.Printf("  %-16s %d\n", name, count)
+		}
+	}
+}
+
+// createPaste posts a paste form to the server and returns the new paste;
+// errors end the program
+func createPaste(form url.Values, cfg Config) NewPasteResponse {
 	// Make request - POST to /api/v1/pastes per REST API spec
 	resp, err := makeRequest("POST", "/api/v1/pastes", strings.NewReader(form.Encode()), "application/x-www-form-urlencoded", cfg)
 	if err != nil {
@@ -602,29 +878,26 @@ Examples:
 		os.Exit(1)
 	}
 
-	fmt.Printf("Paste created!\n")
-	fmt.Printf("ID:  %s\n", result.ID)
-	fmt.Printf("URL: %s\n", result.URL)
-	if result.DeleteTime > 0 {
-		fmt.Printf("Expires: %s\n", time.Unix(result.DeleteTime, 0).Format(time.RFC3339))
-	}
+	recordHistory(result.ID)
+	return result
 }
 
 func handleGet() {
 	cfg := loadConfig()
 
-	if len(os.Args) < 3 {
-		fmt.Fprintf(os.Stderr, "Usage: caspaste-cli get <paste-id>\n")
-		os.Exit(1)
-	}
-
-	pasteID := os.Args[2]
+	args := parseCommand("get")
+	pasteID, key := splitPasteRef(args.Positional[0])
+	raw := args.Has("raw")
 
-	// Check for raw output flag
-	raw := false
-	for _, arg := range os.Args[3:] {
-		if arg == "-r" || arg == "--raw" {
-			raw = true
+	// The checksum is fetched first: reading a burn-after-reading paste may
+	// delete it
+	var checksum VerifyResponse
+	if args.Has("verify") {
+		var err error
+		checksum, err = fetchChecksum(pasteID, cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
 		}
 	}
 
@@ -667,6 +940,31 @@ func handleGet() {
 		os.Exit(1)
 	}
 
+	if !result.OneUse {
+		recordHistory(result.ID)
+	}
+
+	// An encrypted body is checked as served, before it is decrypted
+	if args.Has("verify") {
+		if err := checkChecksum(result.Body, result.IsFile, checksum); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if result.Encrypted {
+		if key == "" {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", errNoKey)
+			os.Exit(1)
+		}
+		plain, err := decryptBody(result.Body, key)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		result.Body = plain
+	}
+
 	if raw {
 		fmt.Print(result.Body)
 	} else {
@@ -675,43 +973,288 @@ func handleGet() {
 			fmt.Printf("Title:   %s\n", result.Title)
 		}
 		fmt.Printf("Syntax:  %s\n", result.Syntax)
+		if result.Encrypted {
+			fmt.Println("Encrypt: Yes (decrypted locally)")
+		}
+		if args.Has("verify") {
+			fmt.Printf("SHA-256: %s (verified)\n", checksum.Digest)
+		}
 		fmt.Printf("Created: %s\n", time.Unix(result.CreateTime, 0).Format(time.RFC3339))
 		if result.DeleteTime > 0 {
 			fmt.Printf("Expires: %s\n", time.Unix(result.DeleteTime, 0).Format(time.RFC3339))
 		}
-		if result.OneUse {
+		if len(result.Tags) > 0 {
+			fmt.Printf("Tags:    %s\n", strings.Join(result.Tags, ", "))
+		}
+		if result.ForkOf != "" {
+			fmt.Printf("Fork of: %s\n", result.ForkOf)
+		}
+		if result.Forks > 0 {
+			fmt.Printf("Forks:   %d\n", result.Forks)
+		}
+		if result.Signature != nil {
+			fmt.Printf("Signed:  %s\n", result.Signature)
+		}
+		if result.OneUse && result.ViewsLeft == 0 {
 			fmt.Println("OneUse:  Yes (this paste is now deleted)")
+		} else if result.OneUse {
+			fmt.Printf("OneUse:  %d of %d views left\n", result.ViewsLeft, result.MaxViews)
 		}
 		fmt.Println("\n--- Content ---")
 		fmt.Println(result.Body)
 	}
 }
 
-func handleList() {
+func handleEdit() {
 	cfg := loadConfig()
 
-	// Parse flags
-	limit := "20"
-	offset := "0"
-
-	args := os.Args[2:]
-	for i := 0; i < len(args); i++ {
-		switch args[i] {
-		case "-n", "--limit":
-			if i+1 < len(args) {
-				limit = args[i+1]
-				i++
-			}
-		case "-o", "--offset":
-			if i+1 < len(args) {
-				offset = args[i+1]
-				i++
+	args := parseCommand("edit")
+	pasteID, key := splitPasteRef(args.Positional[0])
+	filePath := args.Value("file")
+	title := args.Value("title")
+	syntax := args.Value("syntax")
+	titleSet := args.Has("title")
+
+	// GET /api/v1/pastes?id= per REST API spec
+	resp, err := makeRequest("GET", "/api/v1/pastes?id="+url.QueryEscape(pasteID), nil, "", cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	exitOnEditError(resp, body, cfg)
+
+	data, parseErr := parseAPIResponse(body)
+	if parseErr != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", parseErr)
+		os.Exit(1)
+	}
+	var paste GetPasteResponse
+	if err := json.Unmarshal(data, &paste); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing response: %v\n", err)
+		os.Exit(1)
+	}
+	if paste.OneUse && paste.ViewsLeft == 0 {
+		// Reading it just deleted it, so there is nothing left to save to
+		fmt.Fprintf(os.Stderr, "Error: Paste %s was burn-after-reading and is now deleted\n", pasteID)
+		os.Exit(1)
+	}
+
+	// Encrypted pastes are edited as plain text and sealed again with the same
+	// key; without the key only the title and syntax can change
+	sealed := paste.Encrypted && key == ""
+	if sealed && (filePath != "" || (!titleSet && syntax == "")) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", errNoKey)
+		os.Exit(1)
+	}
+	if paste.Encrypted && !sealed {
+		paste.Body, err = decryptBody(paste.Body, key)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// New body: file, piped stdin, or the editor
+	newBody := paste.Body
+	stat, _ := os.Stdin.Stat()
+	switch {
+	case sealed:
+		// The body stays as stored
+	case filePath != "":
+		content, err := os.ReadFile(filePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
+			os.Exit(1)
+		}
+		newBody = string(content)
+	case (stat.Mode() & os.ModeCharDevice) == 0:
+		content, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading stdin: %v\n", err)
+			os.Exit(1)
+		}
+		newBody = string(content)
+	case !titleSet && syntax == "":
+		newBody, err = editInEditor(paste)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Send only what changed
+	form := url.Values{}
+	if newBody != paste.Body {
+		if strings.TrimSpace(newBody) == "" {
+			fmt.Fprintf(os.Stderr, "Error: The new body is empty; use 'caspaste-cli delete' to remove a paste\n")
+			os.Exit(1)
+		}
+		if paste.Encrypted {
+			ciphertext, err := encryptBody([]byte(newBody), key)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error encrypting paste: %v\n", err)
+				os.Exit(1)
 			}
+			newBody = ciphertext
+		}
+		form.Set("body", newBody)
+	}
+	if titleSet && title != paste.Title {
+		form.Set("title", title)
+	}
+	if syntax != "" && !strings.EqualFold(syntax, paste.Syntax) {
+		form.Set("syntax", syntax)
+	}
+	if len(form) == 0 {
+		fmt.Println("No changes")
+		return
+	}
+
+	// PUT /api/v1/pastes?id= per REST API spec
+	resp, err = makeRequest("PUT", "/api/v1/pastes?id="+url.QueryEscape(pasteID), strings.NewReader(form.Encode()), "application/x-www-form-urlencoded", cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	exitOnEditError(resp, body, cfg)
+
+	recordHistory(pasteID)
+	fmt.Printf("Updated paste %s\n", pasteID)
+}
+
+// editInEditor opens a paste body in the user's editor and returns the result
+func editInEditor(paste GetPasteResponse) (string, error) {
+	f, err := os.CreateTemp("", "caspaste-"+paste.ID+"-*.txt")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.WriteString(paste.Body); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	if err := runEditor(f.Name()); err != nil {
+		return "", fmt.Errorf("editor: %w", err)
+	}
+	content, err := os.ReadFile(f.Name())
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// exitOnEditError exits with the code for a failed edit request
+func exitOnEditError(resp *http.Response, body []byte, cfg Config) {
+	switch resp.StatusCode {
+	case 200:
+		return
+	case 401:
+		if cfg.Username == "" {
+			fmt.Fprintf(os.Stderr, "Error: Paste is not editable, or authentication is required (see 'caspaste-cli login')\n")
+		} else {
+			fmt.Fprintf(os.Stderr, "Error: Paste is not editable, or authentication failed for user %s\n", cfg.Username)
+		}
+		os.Exit(3)
+	case 404:
+		fmt.Fprintf(os.Stderr, "Error: Paste not found\n")
+		os.Exit(4)
+	}
+
+	// Parse unified error response per AI.md PART 16
+	_, parseErr := parseAPIResponse(body)
+	if parseErr != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", parseErr)
+	} else {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", resp.Status)
+	}
+	os.Exit(1)
+}
+
+func handleDelete() {
+	cfg := loadConfig()
+
+	args := parseCommand("delete")
+	pasteID := args.Positional[0]
+	force := args.Has("force")
+
+	if !force {
+		fmt.Printf("Delete paste %s? [y/N]: ", pasteID)
+		input, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		input = strings.ToLower(strings.TrimSpace(input))
+		if input != "y" && input != "yes" {
+			fmt.Println("Aborted")
+			os.Exit(1)
+		}
+	}
+
+	// DELETE /api/v1/pastes?id= per REST API spec
+	resp, err := makeRequest("DELETE", "/api/v1/pastes?id="+url.QueryEscape(pasteID), nil, "", cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	switch resp.StatusCode {
+	case 200:
+		forgetHistory(pasteID)
+		fmt.Printf("Deleted paste %s\n", pasteID)
+		return
+	case 401:
+		if cfg.Username == "" {
+			fmt.Fprintf(os.Stderr, "Error: Authentication required. Run 'caspaste-cli login' to set credentials\n")
+		} else {
+			fmt.Fprintf(os.Stderr, "Error: Authentication failed for user %s\n", cfg.Username)
+		}
+		os.Exit(3)
+	case 404:
+		fmt.Fprintf(os.Stderr, "Error: Paste not found\n")
+		os.Exit(4)
+	}
+
+	// Parse unified error response per AI.md PART 16
+	_, parseErr := parseAPIResponse(body)
+	if parseErr != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", parseErr)
+	} else {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", resp.Status)
+	}
+	os.Exit(1)
+}
+
+func handleList() {
+	cfg := loadConfig()
+
+	args := parseCommand("list")
+	limit, offset := 20, 0
+	for name, to := range map[string]*int{"limit": &limit, "offset": &offset} {
+		if !args.Has(name) {
+			continue
 		}
+		n, err := strconv.Atoi(args.Value(name))
+		if err != nil || n < 0 {
+			fmt.Fprintf(os.Stderr, "Error: --%s must be a number, got %q\n", name, args.Value(name))
+			os.Exit(1)
+		}
+		*to = n
 	}
 
 	// GET /api/v1/pastes without id parameter returns list per REST API spec
-	endpoint := fmt.Sprintf("/api/v1/pastes?limit=%s&offset=%s", limit, offset)
+	endpoint := fmt.Sprintf("/api/v1/pastes?limit=%d&offset=%d", limit, offset)
+	if tag := args.Value("tag"); tag != "" {
+		endpoint += "&tag=" + url.QueryEscape(tag)
+	}
 	resp, err := makeRequest("GET", endpoint, nil, "", cfg)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -757,8 +1300,8 @@ func handleList() {
 		return
 	}
 
-	fmt.Printf("%-12s %-30s %-12s %s\n", "ID", "TITLE", "SYNTAX", "CREATED")
-	fmt.Println(strings.Repeat("-", 70))
+	fmt.Printf("%-12s %-30s %-12s %-10s %s\n", "ID", "TITLE", "SYNTAX", "CREATED", "TAGS")
+	fmt.Println(strings.Repeat("-", 80))
 
 	for _, p := range result.Pastes {
 		title := p.Title
@@ -769,7 +1312,90 @@ func handleList() {
 			title = title[:25] + "..."
 		}
 		created := time.Unix(p.CreateTime, 0).Format("2006-01-02")
-		fmt.Printf("%-12s %-30s %-12s %s\n", p.ID, title, p.Syntax, created)
+		fmt.Printf("%-12s %-30s %-12s %-10s %s\n", p.ID, title, p.Syntax, created, strings.Join(p.Tags, ","))
+	}
+}
+
+// fetchTemplate gets a paste template from the server
+func fetchTemplate(name string, cfg Config) (*TemplateResponse, error) {
+	resp, err := makeRequest("GET", "/api/v1/templates?name="+url.QueryEscape(name), nil, "", cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode == 404 {
+		return nil, fmt.Errorf("template %q not found (see 'caspaste-cli templates')", name)
+	}
+	if resp.StatusCode != 200 {
+		// Parse unified error response per AI.md PART 16
+		_, parseErr := parseAPIResponse(body)
+		if parseErr != nil {
+			return nil, parseErr
+		}
+		return nil, fmt.Errorf("server returned: %s", resp.Status)
+	}
+
+	// Parse unified success response per AI.md PART 16
+	data, parseErr := parseAPIResponse(body)
+	if parseErr != nil {
+		return nil, parseErr
+	}
+
+	var result TemplateResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func handleTemplates() {
+	cfg := loadConfig()
+
+	resp, err := makeRequest("GET", "/api/v1/templates", nil, "", cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != 200 {
+		// Parse unified error response per AI.md PART 16
+		_, parseErr := parseAPIResponse(body)
+		if parseErr != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", parseErr)
+		} else {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", resp.Status)
+		}
+		os.Exit(1)
+	}
+
+	// Parse unified success response per AI.md PART 16
+	data, parseErr := parseAPIResponse(body)
+	if parseErr != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", parseErr)
+		os.Exit(1)
+	}
+
+	var templates []TemplateResponse
+	if err := json.Unmarshal(data, &templates); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing response: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(templates) == 0 {
+		fmt.Println("No templates found")
+		return
+	}
+
+	fmt.Printf("%-16s %-12s %s\n", "NAME", "SYNTAX", "DESCRIPTION")
+	fmt.Println(strings.Repeat("-", 70))
+	for _, t := range templates {
+		fmt.Printf("%-16s %-12s %s\n", t.Name, t.Syntax, t.Description)
 	}
 }
 
@@ -812,6 +1438,18 @@ func handleServerInfo() {
 
 	fmt.Printf("Server: %s\n", cfg.Server)
 	fmt.Printf("Version: %s\n", result.Version)
+	if result.APIVersion != "" {
+		fmt.Printf("API Version: %s (client: %s)\n", result.APIVersion, apiVersion)
+	}
+	if result.MinClientVersion != "" {
+		compatible := "yes"
+		if cmp, ok := compareVersions(Version, result.MinClientVersion); !ok {
+			compatible = "unknown (development build)"
+		} else if cmp < 0 || result.APIVersion != apiVersion {
+			compatible = "no, run 'caspaste-cli update'"
+		}
+		fmt.Printf("Min Client Version: %s (this client: %s, compatible: %s)\n", result.MinClientVersion, Version, compatible)
+	}
 	fmt.Printf("Title Max Length: %d\n", result.TitleMaxLen)
 	fmt.Printf("Body Max Length: %d bytes (%.1f MB)\n", result.BodyMaxLen, float64(result.BodyMaxLen)/1024/1024)
 	if result.MaxLifeTime > 0 {
@@ -824,6 +1462,77 @@ func handleServerInfo() {
 	fmt.Printf("Supported Syntaxes: %d languages\n", len(result.Syntaxes))
 }
 
+// handleServers lists the public instances the server knows from its directory
+func handleServers() {
+	cfg := loadConfig()
+
+	resp, err := makeRequest("GET", "/api/v1/server/peers", nil, "", cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode == http.StatusNotFound {
+		fmt.Fprintf(os.Stderr, "Error: %s does not list other servers (needs a newer CasPaste)\n", cfg.Server)
+		os.Exit(4)
+	}
+	if resp.StatusCode != 200 {
+		// Parse unified error response per AI.md PART 16
+		_, parseErr := parseAPIResponse(body)
+		if parseErr != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", parseErr)
+		} else {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", resp.Status)
+		}
+		os.Exit(1)
+	}
+
+	data, parseErr := parseAPIResponse(body)
+	if parseErr != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", parseErr)
+		os.Exit(1)
+	}
+
+	var result PeersResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing response: %v\n", err)
+		os.Exit(1)
+	}
+
+	if !result.Enabled {
+		fmt.Printf("%s has no instance directory configured\n", cfg.Server)
+		return
+	}
+	if len(result.Servers) == 0 {
+		if result.Updated == 0 {
+			fmt.Println("The server has not fetched the directory yet")
+		} else {
+			fmt.Println("No servers listed")
+		}
+		return
+	}
+
+	fmt.Printf("%-40s %-24s %-8s %-10s %-10s %s\n", "URL", "NAME", "ACCESS", "MAX SIZE", "PASTES", "VERSION")
+	fmt.Println(strings.Repeat("-", 104))
+	for _, s := range result.Servers {
+		access := "account"
+		if s.Policies.Public {
+			access = "open"
+		}
+		maxSize := "-"
+		if s.Capacity.BodyMaxLength > 0 {
+			maxSize = fmt.Sprintf("%.1f MB", float64(s.Capacity.BodyMaxLength)/1024/1024)
+		}
+		fmt.Printf("%-40s %-24s %-8s %-10s %-10s %s\n", s.URL, s.Name, access, maxSize, s.Capacity.Pastes, s.Version)
+	}
+	if result.Updated > 0 {
+		fmt.Printf("\nDirectory fetched %s\n", time.Unix(result.Updated, 0).Format(time.RFC3339))
+	}
+}
+
 func handleHealth() {
 	cfg := loadConfig()
 
@@ -0,0 +1,30 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// startPTY is only implemented on Linux
+func startPTY(cmd *exec.Cmd, width, height int) (*os.File, error) {
+	return nil, errors.New("terminal recording is not supported on " + runtime.GOOS)
+}
+
+func resizePTY(pty *os.File, width, height int) error {
+	return nil
+}
+
+func watchResize(fn func()) func() {
+	return func() {}
+}
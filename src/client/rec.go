@@ -0,0 +1,163 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/casjay-forks/caspaste/src/asciicast"
+)
+
+// handleRec records a terminal session as asciicast v2 and uploads it on exit
+func handleRec() {
+	cfg := loadConfig()
+
+	args := parseCommand("rec")
+	title := args.Value("title")
+	command := args.Value("command")
+	output := args.Value("output")
+	noUpload := args.Has("no-upload")
+
+	if noUpload && output == "" {
+		fmt.Fprintf(os.Stderr, "Error: --no-upload requires -o FILE\n")
+		os.Exit(1)
+	}
+	if !noUpload && cfg.Server == "" {
+		fmt.Fprintf(os.Stderr, "Error: No server configured. Run 'caspaste-cli login' first.\n")
+		os.Exit(1)
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		fmt.Fprintf(os.Stderr, "Error: rec must be run in an interactive terminal\n")
+		os.Exit(1)
+	}
+
+	// The recording is written to disk as it happens, so a crash keeps it
+	path := output
+	if path == "" {
+		f, err := os.CreateTemp("", "caspaste-*.cast")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		path = f.Name()
+		f.Close()
+		defer os.Remove(path)
+	}
+
+	if err := recordSession(path, title, command); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("Recording finished.")
+
+	if output != "" {
+		fmt.Printf("Saved: %s\n", output)
+	}
+	if noUpload {
+		return
+	}
+
+	result, err := uploadFile(path, cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: upload failed: %v\n", err)
+		if output == "" {
+			// Keep the recording so it is not lost
+			keep := filepath.Join(".", filepath.Base(path))
+			if data, readErr := os.ReadFile(path); readErr == nil && os.WriteFile(keep, data, 0600) == nil {
+				fmt.Fprintf(os.Stderr, "Recording kept in %s\n", keep)
+			}
+		}
+		os.Exit(1)
+	}
+
+	recordHistory(result.ID)
+
+	fmt.Printf("Recording uploaded!\n")
+	fmt.Printf("ID:  %s\n", result.ID)
+	fmt.Printf("URL: %s\n", result.URL)
+}
+
+// recordSession runs command in a pseudo-terminal and records its output to path
+func recordSession(path, title, command string) error {
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+	var cmd *exec.Cmd
+	if command != "" {
+		cmd = exec.Command(shell, "-c", command)
+	} else {
+		cmd = exec.Command(shell)
+	}
+	cmd.Env = append(os.Environ(), "CASPASTE_REC=1")
+
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		return err
+	}
+	// Some terminals (serial consoles, nested PTYs) report no size
+	if width <= 0 || height <= 0 {
+		width, height = 80, 24
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	rec, err := asciicast.NewWriter(f, asciicast.Header{
+		Width:   width,
+		Height:  height,
+		Title:   title,
+		Command: command,
+		Env: map[string]string{
+			"SHELL": shell,
+			"TERM":  os.Getenv("TERM"),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	pty, err := startPTY(cmd, width, height)
+	if err != nil {
+		return err
+	}
+	defer pty.Close()
+
+	fmt.Printf("Recording started, exit the shell to finish (%s)\n", time.Now().Format(time.Kitchen))
+
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return err
+	}
+	defer term.Restore(int(os.Stdin.Fd()), state)
+
+	// Follow terminal resizes
+	stopResize := watchResize(func() {
+		if w, h, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+			resizePTY(pty, w, h)
+			rec.Resize(w, h)
+		}
+	})
+	defer stopResize()
+
+	go io.Copy(pty, os.Stdin)
+
+	// Reading the PTY fails once the child exits and its side is closed
+	io.Copy(io.MultiWriter(os.Stdout, rec), pty)
+	cmd.Wait()
+	return rec.Flush()
+}
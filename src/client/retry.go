@@ -0,0 +1,189 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Requests that may pass on a second try are sent again, waiting longer
+// each time: connection errors and 502, 503 and 504 answers for requests
+// that are safe to repeat, and 429 and 503 answers, which mean the server
+// did not act on the request, for any request whose body can be sent again
+// --no-retry before the command sends each request once
+
+const (
+	// defaultRequestTimeout is the timeout of each request unless configured
+	defaultRequestTimeout = 30 * time.Second
+	// defaultRetries is the number of retries unless configured
+	defaultRetries = 3
+	// maxRetries bounds the configured number of retries
+	maxRetries = 10
+	// retryBaseDelay doubles with each retry, up to retryMaxDelay
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 10 * time.Second
+	// retryAfterMax is the longest Retry-After waited for; a server asking
+	// for longer gets its answer returned instead
+	retryAfterMax = time.Minute
+)
+
+// noRetry sends each request once (--no-retry)
+var noRetry bool
+
+// parseTimeout reads a timeout setting such as "30s" or "2m"; 0 means none
+func parseTimeout(value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("timeout: %q is not a duration such as 30s or 2m", value)
+	}
+	return d, nil
+}
+
+// parseRetries reads a retries setting
+func parseRetries(value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 || n > maxRetries {
+		return 0, fmt.Errorf("retries: %q is not a number from 0 to %d", value, maxRetries)
+	}
+	return n, nil
+}
+
+// requestTimeout returns the timeout of each request
+func requestTimeout(cfg Config) time.Duration {
+	if cfg.Timeout == "" {
+		return defaultRequestTimeout
+	}
+	d, err := parseTimeout(cfg.Timeout)
+	if err != nil {
+		return defaultRequestTimeout
+	}
+	return d
+}
+
+// requestRetries returns how often a failed request is sent again
+// Shell completion never waits for a retry, as the user is typing
+func requestRetries(cfg Config) int {
+	if noRetry || quietRequests {
+		return 0
+	}
+	if cfg.Retries == "" {
+		return defaultRetries
+	}
+	n, err := parseRetries(cfg.Retries)
+	if err != nil {
+		return defaultRetries
+	}
+	return n
+}
+
+// idempotentMethod reports whether sending a request twice does no more
+// than sending it once
+func idempotentMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// retryDelay returns how long to wait before retry number attempt+1, and
+// false if the answer or error is final
+func retryDelay(method string, resp *http.Response, err error, attempt int) (time.Duration, bool) {
+	if err != nil {
+		return backoff(attempt), idempotentMethod(method)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		if !idempotentMethod(method) {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+
+	if wait, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+		return wait, wait <= retryAfterMax
+	}
+	return backoff(attempt), true
+}
+
+// backoff returns a random wait between half and all of the delay for the
+// attempt, so clients that failed together do not retry together
+func backoff(attempt int) time.Duration {
+	d := retryMaxDelay
+	if attempt < 8 {
+		d = min(retryBaseDelay<<attempt, retryMaxDelay)
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// parseRetryAfter reads a Retry-After header, in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// reportRetry tells the user why a request is sent again
+func reportRetry(wait time.Duration, resp *http.Response, err error) {
+	if quietRequests {
+		return
+	}
+	reason := ""
+	if err != nil {
+		reason = failureReason(err)
+	} else {
+		reason = resp.Status
+	}
+	fmt.Fprintf(os.Stderr, "Note: %s, retrying in %s\n", reason, wait.Round(100*time.Millisecond))
+}
+
+// doWithRetry sends req, and again while retryDelay allows and retries are
+// left; a request whose body cannot be read again is sent once
+func doWithRetry(client *http.Client, req *http.Request, retries int) (*http.Response, error) {
+	if req.Body != nil && req.GetBody == nil {
+		retries = 0
+	}
+	for attempt := 0; ; attempt++ {
+		resp, err := client.Do(req)
+		if attempt == retries {
+			return resp, err
+		}
+		wait, ok := retryDelay(req.Method, resp, err, attempt)
+		if !ok {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		reportRetry(wait, resp, err)
+		time.Sleep(wait)
+
+		req = req.Clone(req.Context())
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, errors.Join(errors.New("request body cannot be sent again"), err)
+			}
+			req.Body = body
+		}
+	}
+}
@@ -0,0 +1,129 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+type ShareLinkResponse struct {
+	ID        string `json:"id"`
+	PasteID   string `json:"pasteId"`
+	CreatedBy string `json:"createdBy"`
+	ExpiresAt int64  `json:"expiresAt"`
+	URL       string `json:"url"`
+}
+
+func handleShare() {
+	cfg := loadConfig()
+
+	args := parseCommand("share")
+	pasteID, key := splitPasteRef(args.Positional[0])
+	endpoint := "/api/v1/pastes/" + url.PathEscape(pasteID) + "/share"
+
+	var resp *http.Response
+	var err error
+	switch {
+	case args.Has("list"):
+		// GET /api/v1/pastes/{id}/share
+		resp, err = makeRequest("GET", endpoint, nil, "", cfg)
+	case args.Has("revoke"):
+		// DELETE /api/v1/pastes/{id}/share?link={link id}
+		resp, err = makeRequest("DELETE", endpoint+"?link="+url.QueryEscape(args.Value("revoke")), nil, "", cfg)
+	default:
+		// POST /api/v1/pastes/{id}/share
+		form := url.Values{}
+		if ttl := args.Value("ttl"); ttl != "" {
+			form.Set("ttl", ttl)
+		}
+		resp, err = makeRequest("POST", endpoint, strings.NewReader(form.Encode()), "application/x-www-form-urlencoded", cfg)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	switch resp.StatusCode {
+	case 200:
+	case 400:
+		fmt.Fprintf(os.Stderr, "Error: Invalid TTL (use e.g. 30m, 1h or 7d, at most 30d)\n")
+		os.Exit(1)
+	case 401:
+		fmt.Fprintf(os.Stderr, "Error: Authentication required. Run 'caspaste-cli login' to configure credentials.\n")
+		os.Exit(3)
+	case 404:
+		if args.Has("revoke") {
+			fmt.Fprintf(os.Stderr, "Error: Share link not found\n")
+		} else {
+			fmt.Fprintf(os.Stderr, "Error: Paste not found\n")
+		}
+		os.Exit(4)
+	default:
+		// Parse unified error response per AI.md PART 16
+		_, parseErr := parseAPIResponse(body)
+		if parseErr != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", parseErr)
+		} else {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", resp.Status)
+		}
+		os.Exit(1)
+	}
+
+	data, parseErr := parseAPIResponse(body)
+	if parseErr != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", parseErr)
+		os.Exit(1)
+	}
+
+	switch {
+	case args.Has("list"):
+		var links []ShareLinkResponse
+		if err := json.Unmarshal(data, &links); err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing response: %v\n", err)
+			os.Exit(1)
+		}
+		if len(links) == 0 {
+			fmt.Println("No share links")
+			return
+		}
+		for _, link := range links {
+			fmt.Printf("%s  expires %s", link.ID, time.Unix(link.ExpiresAt, 0).Format(time.RFC3339))
+			if link.CreatedBy != "" {
+				fmt.Printf("  by %s", link.CreatedBy)
+			}
+			fmt.Println()
+		}
+
+	case args.Has("revoke"):
+		fmt.Printf("Share link %s revoked\n", args.Value("revoke"))
+
+	default:
+		var result ShareLinkResponse
+		if err := json.Unmarshal(data, &result); err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing response: %v\n", err)
+			os.Exit(1)
+		}
+		// The key of an encrypted paste stays in the fragment of the link
+		if key != "" {
+			fmt.Printf("URL: %s#%s\n", result.URL, key)
+		} else {
+			fmt.Printf("URL: %s\n", result.URL)
+		}
+		fmt.Printf("Expires: %s\n", time.Unix(result.ExpiresAt, 0).Format(time.RFC3339))
+		fmt.Printf("Link ID: %s\n", result.ID)
+	}
+}
@@ -0,0 +1,95 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// PasteSignature is the signature status the server sends with a paste
+type PasteSignature struct {
+	Status      string   `json:"status"`
+	Fingerprint string   `json:"fingerprint"`
+	UserIDs     []string `json:"userIds"`
+	Owner       string   `json:"owner"`
+}
+
+// String describes the status on one line, as 'get' prints it
+func (s PasteSignature) String() string {
+	switch s.Status {
+	case "good":
+		desc := "good, " + s.Fingerprint
+		if len(s.UserIDs) > 0 {
+			desc += " " + s.UserIDs[0]
+		}
+		if s.Owner != "" {
+			desc += " (registered by " + s.Owner + ")"
+		}
+		return desc
+	case "bad":
+		return "BAD, the content does not match (" + s.Fingerprint + ")"
+	}
+	return "unknown key, cannot be checked"
+}
+
+// gpgSign makes a detached armored signature of content with gpg, using
+// keyID or the default key, and exports the public key that made it so the
+// server can check it without the key being registered
+func gpgSign(content []byte, keyID string) (signature, publicKey string, err error) {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		return "", "", errors.New("gpg not found in PATH")
+	}
+
+	args := []string{"--batch", "--yes", "--armor", "--detach-sign", "--status-fd", "2"}
+	if keyID != "" {
+		args = append(args, "--local-user", keyID)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("gpg", args...)
+	cmd.Stdin = bytes.NewReader(content)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", "", fmt.Errorf("gpg: %v\n%s", err, gpgMessages(stderr.Bytes()))
+	}
+
+	// [GNUPG:] SIG_CREATED D 22 8 00 1700000000 FINGERPRINT
+	var fingerprint string
+	scanner := bufio.NewScanner(&stderr)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 8 && fields[0] == "[GNUPG:]" && fields[1] == "SIG_CREATED" {
+			fingerprint = fields[7]
+		}
+	}
+	if fingerprint == "" {
+		return "", "", errors.New("gpg: no signature was made")
+	}
+
+	// The fingerprint of a subkey exports its primary key too
+	export := exec.Command("gpg", "--batch", "--armor", "--export", fingerprint+"!")
+	key, err := export.Output()
+	if err != nil || len(key) == 0 {
+		return "", "", fmt.Errorf("gpg: cannot export key %s", fingerprint)
+	}
+	return stdout.String(), string(key), nil
+}
+
+// gpgMessages drops the status lines from gpg's stderr
+func gpgMessages(stderr []byte) string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(string(stderr)), "\n") {
+		if !strings.HasPrefix(line, "[GNUPG:]") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
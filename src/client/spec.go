@@ -0,0 +1,297 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/casjay-forks/caspaste/src/completion"
+)
+
+// cliSpec declares every command and flag of the CLI. Help output, the man
+// page (--shell man), the shell completion scripts and argument parsing are
+// generated from it, so a new command or flag is added here and in its
+// handler only.
+var cliSpec = &completion.Spec{
+	Name:    "caspaste-cli",
+	Title:   "CasPaste CLI",
+	Summary: "A command-line client for CasPaste pastebin servers.",
+	Flags: []completion.Flag{
+		{Short: "h", Long: "help", Summary: "Show this help message"},
+		{Short: "v", Long: "version", Summary: "Show version"},
+		{Long: "shell", Arg: "SUBCOMMAND", Summary: "Shell integration: completions [SHELL], init [SHELL], man"},
+		{Long: "strict", Summary: "Exit when the server requires a newer client (before the command)"},
+		{Long: "no-retry", Summary: "Send each request once, without retries (before the command)"},
+		{Long: "proxy", Arg: "URL", Summary: "Proxy to reach the server through: http, https, socks5 or none (before the command)"},
+		{Long: "insecure", Summary: "Do not check the server certificate, for lab servers (before the command)"},
+	},
+	Commands: []completion.Command{
+		{
+			Name:    "config",
+			Summary: "Show configuration (set, get, unset, edit)",
+			Commands: []completion.Command{
+				{Name: "show", Summary: "Show configuration (default)"},
+				{Name: "get", Usage: "KEY", Summary: "Print the value of KEY", Complete: "config-keys"},
+				{Name: "set", Usage: "KEY VALUE", Summary: "Set KEY to VALUE in the config file", Complete: "config-keys"},
+				{Name: "unset", Usage: "KEY", Summary: "Remove KEY from the config file", Complete: "config-keys"},
+				{Name: "edit", Summary: "Open the config file in $VISUAL or $EDITOR"},
+			},
+			Description: "Keys: server, servers, username, password, update_branch, timeout, retries,\nproxy, ca_file, client_cert, client_key",
+			Examples: []completion.Example{
+				{Command: "caspaste-cli config set server https://paste.example.com"},
+				{Command: "caspaste-cli config get server"},
+			},
+		},
+		{
+			Name:    "login",
+			Summary: "Configure server and credentials interactively",
+		},
+		{
+			Name:    "new",
+			Aliases: []string{"create", "paste"},
+			Summary: "Create a new paste",
+			Flags: []completion.Flag{
+				{Short: "f", Long: "file", Arg: "FILE", Summary: "Read content from file (default: stdin)", Files: true},
+				{Short: "t", Long: "title", Arg: "TITLE", Summary: "Paste title"},
+				{Short: "s", Long: "syntax", Arg: "SYNTAX", Summary: "Syntax highlighting (e.g., python, go, bash)", Complete: "syntaxes"},
+				{Short: "l", Long: "lifetime", Arg: "TIME", Summary: "Expiration time (e.g., 1h, 1d, 1w, never)", Complete: "lifetimes"},
+				{Short: "T", Long: "template", Arg: "NAME", Summary: "Start from a server template (see 'caspaste-cli templates')", Complete: "templates"},
+				{Short: "1", Long: "one-use", Summary: "Delete after first view"},
+				{Long: "max-views", Arg: "N", Summary: "Delete after N views"},
+				{Long: "tags", Arg: "TAGS", Summary: "Comma-separated tags, e.g. deploy,nginx"},
+				{Short: "p", Long: "private", Summary: "Don't show in public listings"},
+				{Short: "e", Long: "encrypt", Summary: "Encrypt locally; the key is only in the printed URL"},
+				{Long: "redact", Summary: "Ask the server to mask IPs, emails and tokens"},
+				{Long: "no-redact", Summary: "Skip server-side redaction (if the server allows it)"},
+				{Long: "stream", Summary: "Send the content as it is read, for files too large to hold in memory"},
+				{Long: "split", Summary: "Split content over the server's size limit into a series of pastes"},
+				{Long: "sign", Summary: "Sign the content with gpg's default key"},
+				{Long: "sign-key", Arg: "KEY", Summary: "Sign the content with this gpg key"},
+				{Long: "signature", Arg: "FILE", Summary: "Attach a detached armored signature made with a registered key", Files: true},
+			},
+			Examples: []completion.Example{
+				{Command: `echo "Hello" | caspaste-cli new`},
+				{Command: `caspaste-cli new -f script.py -s python -t "My Script"`},
+				{Command: "cat log.txt | caspaste-cli new -l 1h -1"},
+				{Command: "cat trace.txt | caspaste-cli new -T stacktrace"},
+				{Command: "caspaste-cli new -e -f secrets.env"},
+				{Command: "caspaste-cli new --stream -f /var/log/huge.log -l 1d"},
+				{Command: "journalctl -b | caspaste-cli new --split -t \"boot log\""},
+				{Command: "caspaste-cli new --sign -f release-notes.md"},
+			},
+		},
+		{
+			Name:        "get",
+			Aliases:     []string{"show", "view"},
+			Usage:       "<paste-id> [options]",
+			Summary:     "Get a paste by ID",
+			Description: "The paste can also be given as its URL. Encrypted pastes need the key:\nuse the full URL or ID#key, and the paste is decrypted locally.",
+			Complete:    "ids",
+			Flags: []completion.Flag{
+				{Short: "r", Long: "raw", Summary: "Print only the paste body"},
+				{Long: "verify", Summary: "Check the content against the server's SHA-256 checksum"},
+			},
+			Examples: []completion.Example{
+				{Command: "caspaste-cli get abc123"},
+				{Command: "caspaste-cli get abc123 -r --verify > app.log"},
+				{Command: "caspaste-cli get 'https://paste.example.com/abc123#KEY' -r"},
+			},
+		},
+		{
+			Name:        "edit",
+			Usage:       "<paste-id> [options]",
+			Summary:     "Edit a paste by ID",
+			Description: "Fetch a paste, change it in $VISUAL or $EDITOR (or replace its body with\na file or stdin) and save it back. Without the credentials from\n'caspaste-cli login' only pastes created as editable can be changed.\nEncrypted pastes need ID#key; they are decrypted and sealed again locally.",
+			Complete:    "ids",
+			Flags: []completion.Flag{
+				{Short: "f", Long: "file", Arg: "FILE", Summary: "Replace the body with the file (default: editor, or stdin when piped)", Files: true},
+				{Short: "t", Long: "title", Arg: "TITLE", Summary: "New title"},
+				{Short: "s", Long: "syntax", Arg: "SYNTAX", Summary: "New syntax highlighting", Complete: "syntaxes"},
+			},
+			Examples: []completion.Example{
+				{Command: "caspaste-cli edit abc123"},
+				{Command: "caspaste-cli edit abc123 -f script.py"},
+				{Command: `caspaste-cli edit abc123 -t "New title"`},
+				{Command: "sort notes.txt | caspaste-cli edit abc123"},
+			},
+		},
+		{
+			Name:    "list",
+			Aliases: []string{"ls"},
+			Summary: "List pastes",
+			Flags: []completion.Flag{
+				{Short: "n", Long: "limit", Arg: "N", Summary: "Number of pastes to list (default: 20)"},
+				{Short: "o", Long: "offset", Arg: "N", Summary: "Number of pastes to skip (default: 0)"},
+				{Long: "tag", Arg: "TAG", Summary: "Only list pastes with this tag"},
+			},
+		},
+		{
+			Name:        "delete",
+			Aliases:     []string{"rm"},
+			Usage:       "<paste-id> [options]",
+			Summary:     "Delete a paste by ID",
+			Description: "Needs the credentials from 'caspaste-cli login'; the server refuses\nanonymous deletes.",
+			Complete:    "ids",
+			Flags: []completion.Flag{
+				{Short: "f", Long: "force", Summary: "Delete without asking for confirmation"},
+			},
+			Examples: []completion.Example{
+				{Command: "caspaste-cli delete abc123"},
+				{Command: "caspaste-cli rm abc123 --force"},
+			},
+		},
+		{
+			Name:        "fork",
+			Usage:       "<paste-id> [options]",
+			Summary:     "Copy a paste into a new one that links back to it",
+			Description: "The fork keeps the title, body, syntax and tags, and is credited to the\nuser from 'caspaste-cli login'. Burn-after-reading pastes cannot be\nforked.",
+			Complete:    "ids",
+			Flags: []completion.Flag{
+				{Short: "e", Long: "editable", Summary: "Let anyone edit the fork"},
+			},
+			Examples: []completion.Example{
+				{Command: "caspaste-cli fork abc123"},
+			},
+		},
+		{
+			Name:        "share",
+			Usage:       "<paste-id> [options]",
+			Summary:     "Create a time-limited link to a paste",
+			Description: "The link opens the paste without logging in until it expires; the\npaste's own expiration is unchanged. --list and --revoke need the\ncredentials from 'caspaste-cli login'.",
+			Complete:    "ids",
+			Flags: []completion.Flag{
+				{Long: "ttl", Arg: "TIME", Summary: "How long the link stays valid (e.g., 30m, 1h, 7d; default: 1h)"},
+				{Long: "list", Summary: "List the links to the paste instead"},
+				{Long: "revoke", Arg: "LINK", Summary: "Revoke the link with this ID instead"},
+			},
+			Examples: []completion.Example{
+				{Command: "caspaste-cli share abc123 --ttl 1h"},
+				{Command: "caspaste-cli share abc123 --list"},
+			},
+		},
+		{
+			Name:    "templates",
+			Summary: "List paste templates",
+		},
+		{
+			Name:        "rec",
+			Summary:     "Record a terminal session and upload it",
+			Description: "Record a terminal session and upload it as a playable paste when the\nshell exits.",
+			Flags: []completion.Flag{
+				{Short: "t", Long: "title", Arg: "TITLE", Summary: "Recording title"},
+				{Short: "c", Long: "command", Arg: "CMD", Summary: "Command to record (default: $SHELL)"},
+				{Short: "o", Long: "output", Arg: "FILE", Summary: "Also keep the recording in FILE (.cast)", Files: true},
+				{Long: "no-upload", Summary: "Only save the recording locally (requires -o)"},
+			},
+		},
+		{
+			Name:    "update",
+			Summary: "Update caspaste-cli to the latest release",
+			Commands: []completion.Command{
+				{Name: "yes", Summary: "Download and install the latest release (default)"},
+				{Name: "check", Summary: "Check for a newer release without installing it"},
+				{Name: "branch", Usage: "stable|beta|daily", Summary: "Set the release channel in the config file"},
+			},
+			Description: "Release binaries are checked against their published checksum and,\nin official builds, their signature before the running binary is\nreplaced. The channel is read from update_branch in the config file\n(default: stable).",
+			Examples: []completion.Example{
+				{Command: "caspaste-cli update check"},
+				{Command: "caspaste-cli update"},
+				{Command: "caspaste-cli update branch beta"},
+			},
+		},
+		{
+			Name:    "info",
+			Aliases: []string{"server-info"},
+			Summary: "Get server information",
+		},
+		{
+			Name:    "health",
+			Aliases: []string{"healthz"},
+			Summary: "Check server health",
+		},
+		{
+			Name:    "servers",
+			Aliases: []string{"peers"},
+			Summary: "List public CasPaste servers from the server's instance directory",
+		},
+		{
+			Name:    "help",
+			Summary: "Show this help message",
+		},
+		{
+			Name:    "version",
+			Summary: "Show version",
+		},
+	},
+	Examples: []completion.Example{
+		{Summary: "Configure server and credentials", Command: "caspaste-cli login"},
+		{Summary: "Create paste from stdin", Command: `echo "Hello World" | caspaste-cli new`},
+		{Summary: "Create paste from file", Command: "caspaste-cli new -f script.py -s python"},
+		{Summary: "Create an incident report from a template", Command: "caspaste-cli new --template incident < notes.md"},
+		{Summary: "Record a terminal session (uploaded when the shell exits)", Command: `caspaste-cli rec -t "Deploy walkthrough"`},
+		{Summary: "Configure the server without prompts", Command: "caspaste-cli config set server https://paste.example.com"},
+		{Summary: "Get a paste", Command: "caspaste-cli get abc123"},
+		{Summary: "List recent pastes", Command: "caspaste-cli list -n 10"},
+		{Summary: "Edit a paste in your editor", Command: "caspaste-cli edit abc123"},
+		{Summary: "Delete a paste", Command: "caspaste-cli delete abc123"},
+		{Summary: "Update the CLI to the latest release", Command: "caspaste-cli update"},
+		{Summary: "Enable shell completion", Command: `eval "$(caspaste-cli --shell init)"`},
+		{Summary: "Install the man page", Command: "caspaste-cli --shell man > ~/.local/share/man/man1/caspaste-cli.1"},
+	},
+	Sections: []completion.Section{
+		{
+			Title: "Shell Integration",
+			Body: `--shell completions [SHELL]   Print shell completion script
+--shell init [SHELL]          Print shell init command for eval
+--shell man                   Print the man page
+--shell --help                Show shell integration help
+
+Supported shells: bash, zsh, fish, sh, dash, ksh, powershell, pwsh
+If SHELL is omitted, it is auto-detected from $SHELL.`,
+		},
+		{
+			Title: "Configuration",
+			Body: `Config file: ~/.config/casjay-forks/caspaste/cli.yml
+  (Windows: %APPDATA%\casjay-forks\caspaste\cli.yml)
+Run 'caspaste-cli config' to see the files in use.
+
+Or use environment variables:
+  CASPASTE_SERVER=https://paste.example.com
+  CASPASTE_USERNAME=admin
+  CASPASTE_PASSWORD=secret
+  CASPASTE_UPDATE_BRANCH=stable`,
+		},
+	},
+}
+
+// printCommandHelp prints the help of a command, returning false if there is none
+func printCommandHelp(name string) bool {
+	c, ok := cliSpec.Command(name)
+	if !ok || c.Name == "help" || c.Name == "version" {
+		return false
+	}
+	fmt.Print(cliSpec.CommandHelp(c))
+	return true
+}
+
+// parseCommand parses the arguments of a command against its flags, printing
+// the command's help for -h and exiting on a usage error
+func parseCommand(name string) *completion.Args {
+	c, _ := cliSpec.Command(name)
+	args, err := c.Parse(os.Args[2:])
+	if errors.Is(err, completion.ErrHelp) {
+		printCommandHelp(c.Name)
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\nRun 'caspaste-cli %s --help' for usage.\n", err, c.Name)
+		os.Exit(1)
+	}
+	return args
+}
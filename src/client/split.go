@@ -0,0 +1,132 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// serverBodyLimit returns the server's body limit in characters (0 = none);
+// errors end the program
+func serverBodyLimit(cfg Config) int {
+	// GET /api/v1/server/info per REST API spec
+	resp, err := makeRequest("GET", "/api/v1/server/info", nil, "", cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		fmt.Fprintf(os.Stderr, "Error: cannot read the server's size limit: %s\n", resp.Status)
+		os.Exit(1)
+	}
+
+	data, parseErr := parseAPIResponse(body)
+	if parseErr != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", parseErr)
+		os.Exit(1)
+	}
+	var info ServerInfoResponse
+	if err := json.Unmarshal(data, &info); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing response: %v\n", err)
+		os.Exit(1)
+	}
+	return info.BodyMaxLen
+}
+
+// handleNewSplit is 'new --split' for content over the body limit: each
+// part of at most limit characters becomes a paste of one series, and an
+// index paste lists them, unless the list itself is over the limit
+// form holds the options of every part
+func handleNewSplit(cfg Config, form url.Values, content, title string, limit int) {
+	parts := splitContent(content, limit)
+	fmt.Printf("Splitting into %d parts of at most %d characters\n", len(parts), limit)
+
+	var series, seriesKey string
+	urls := make([]string, 0, len(parts))
+	for i, part := range parts {
+		form.Set("body", part)
+		if i == 0 {
+			form.Set("series", "new")
+		} else {
+			form.Set("series", series)
+			form.Set("seriesKey", seriesKey)
+		}
+
+		// Parts created so far are printed before an error ends the program
+		result := createPaste(form, cfg)
+		if i == 0 {
+			if result.Series == "" {
+				fmt.Fprintf(os.Stderr, "Error: this server does not support paste series\n")
+				os.Exit(1)
+			}
+			series, seriesKey = result.Series, result.SeriesKey
+		}
+		urls = append(urls, result.URL)
+		fmt.Printf("Part %d/%d: %s\n", i+1, len(parts), result.URL)
+		if i == 0 && result.DeleteTime > 0 {
+			fmt.Printf("Expires: %s\n", time.Unix(result.DeleteTime, 0).Format(time.RFC3339))
+		}
+	}
+
+	// The index is a plain paste with the same options, outside the series
+	var index strings.Builder
+	if title != "" {
+		fmt.Fprintf(&index, "%s\n\n", title)
+	}
+	for i, u := range urls {
+		fmt.Fprintf(&index, "Part %d/%d: %s\n", i+1, len(urls), u)
+	}
+	fmt.Printf("Series: %s/api/v1/series/%s\n", strings.TrimSuffix(cfg.Server, "/"), url.PathEscape(series))
+	if utf8.RuneCountInString(index.String()) > limit {
+		fmt.Printf("Index: not created, the list of parts is over the size limit\n")
+		return
+	}
+	form.Del("series")
+	form.Del("seriesKey")
+	form.Set("body", index.String())
+	form.Set("syntax", "plaintext")
+	if title != "" {
+		form.Set("title", title+" (index)")
+	}
+	result := createPaste(form, cfg)
+	fmt.Printf("Index: %s\n", result.URL)
+}
+
+// splitContent cuts content into parts of at most limit characters,
+// after the last line end in each part when there is one
+func splitContent(content string, limit int) []string {
+	var parts []string
+	for utf8.RuneCountInString(content) > limit {
+		end, n := len(content), 0
+		for i := range content {
+			if n == limit {
+				end = i
+				break
+			}
+			n++
+		}
+		cut := end
+		if nl := strings.LastIndexByte(content[:end], '\n'); nl >= 0 {
+			cut = nl + 1
+		}
+		parts = append(parts, content[:cut])
+		content = content[cut:]
+	}
+	if content != "" {
+		parts = append(parts, content)
+	}
+	return parts
+}
@@ -0,0 +1,171 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/cli"
+	"github.com/casjay-forks/caspaste/src/completion"
+)
+
+// handleNewStream is 'new --stream': the file or stdin is sent to the server
+// as it is read, so a large log never has to fit in memory
+func handleNewStream(cfg Config, args *completion.Args) {
+	for _, flag := range []string{"template", "encrypt", "redact", "no-redact"} {
+		if args.Has(flag) {
+			fmt.Fprintf(os.Stderr, "Error: --stream cannot be used with --%s\n", flag)
+			os.Exit(1)
+		}
+	}
+
+	title := args.Value("title")
+	syntax := args.Value("syntax")
+	filePath := args.Value("file")
+
+	var body io.Reader = os.Stdin
+	if filePath != "" {
+		f, err := os.Open(filePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		body = f
+
+		// Auto-detect syntax from extension if not specified
+		if syntax == "" {
+			ext := strings.TrimPrefix(filepath.Ext(filePath), ".")
+			syntax = extToSyntax(ext)
+		}
+		// Use filename as title if not specified
+		if title == "" {
+			title = filepath.Base(filePath)
+		}
+	}
+
+	query := url.Values{}
+	if title != "" {
+		query.Set("title", title)
+	}
+	if syntax != "" {
+		query.Set("syntax", syntax)
+	}
+	if lifetime := args.Value("lifetime"); lifetime != "" {
+		seconds, err := lifetimeSeconds(lifetime)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --lifetime %q\n", lifetime)
+			os.Exit(1)
+		}
+		if seconds > 0 {
+			query.Set("expiration", strconv.FormatInt(seconds, 10))
+		}
+	}
+	if args.Has("one-use") {
+		query.Set("oneUse", "true")
+	}
+	if maxViews := args.Value("max-views"); maxViews != "" {
+		if n, err := strconv.Atoi(maxViews); err != nil || n < 1 {
+			fmt.Fprintf(os.Stderr, "Error: --max-views must be a number of views\n")
+			os.Exit(1)
+		}
+		query.Set("maxViews", maxViews)
+	}
+	if tags := args.Value("tags"); tags != "" {
+		query.Set("tags", tags)
+	}
+	if args.Has("private") {
+		query.Set("private", "true")
+	}
+
+	// POST /api/v1/pastes/stream, without a client timeout: the upload takes
+	// as long as it takes
+	resp, err := makeRequestTimeout("POST", "/api/v1/pastes/stream?"+query.Encode(), body, "text/plain; charset=utf-8", cfg, 0)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+
+	switch resp.StatusCode {
+	case 200:
+	case 400:
+		fmt.Fprintf(os.Stderr, "Error: The server refused the paste (empty content or invalid options)\n")
+		os.Exit(1)
+	case 401:
+		fmt.Fprintf(os.Stderr, "Error: Authentication required. Run 'caspaste-cli login' to configure credentials.\n")
+		os.Exit(3)
+	case 404:
+		fmt.Fprintf(os.Stderr, "Error: This server does not take streamed uploads\n")
+		os.Exit(1)
+	case 413:
+		fmt.Fprintf(os.Stderr, "Error: The content is larger than the server allows\n")
+		os.Exit(1)
+	default:
+		// Parse unified error response per AI.md PART 16
+		_, parseErr := parseAPIResponse(respBody)
+		if parseErr != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", parseErr)
+		} else {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", resp.Status)
+		}
+		os.Exit(1)
+	}
+
+	data, parseErr := parseAPIResponse(respBody)
+	if parseErr != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", parseErr)
+		os.Exit(1)
+	}
+
+	var result NewPasteResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing response: %v\n", err)
+		os.Exit(1)
+	}
+
+	recordHistory(result.ID)
+
+	fmt.Printf("Paste created!\n")
+	fmt.Printf("ID:  %s\n", result.ID)
+	fmt.Printf("URL: %s\n", result.URL)
+	if result.DeleteTime > 0 {
+		fmt.Printf("Expires: %s\n", time.Unix(result.DeleteTime, 0).Format(time.RFC3339))
+	}
+}
+
+// lifetimeSeconds converts a --lifetime value to seconds (0 = never)
+// Months (M) count 30 days and years (y) 365
+func lifetimeSeconds(s string) (int64, error) {
+	switch {
+	case s == "never":
+		return 0, nil
+	case strings.HasSuffix(s, "M"), strings.HasSuffix(s, "y"):
+		n, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid lifetime %q", s)
+		}
+		if strings.HasSuffix(s, "M") {
+			return n * 30 * 24 * 60 * 60, nil
+		}
+		return n * 365 * 24 * 60 * 60, nil
+	}
+	d, err := cli.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	return int64(d / time.Second), nil
+}
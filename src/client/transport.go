@@ -0,0 +1,129 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+
+	"github.com/casjay-forks/caspaste/src/cryptopolicy"
+)
+
+// Requests go through the proxy in the proxy setting (or --proxy), else
+// through the one in HTTPS_PROXY, HTTP_PROXY and NO_PROXY; "none" ignores
+// those. The server certificate is checked against the system roots plus
+// ca_file, and client_cert is sent when the server asks for one
+
+// proxyNone turns off the proxy, including the one in the environment
+const proxyNone = "none"
+
+var (
+	// flagProxy is the proxy given with --proxy, over any configured one
+	flagProxy string
+	// insecureTLS skips server certificate checks (--insecure)
+	insecureTLS bool
+)
+
+// transport is shared by all requests, so connections are reused
+var (
+	transportOnce sync.Once
+	transport     *http.Transport
+	transportErr  error
+)
+
+// httpTransport returns the transport for requests, built from cfg on first use
+func httpTransport(cfg Config) (*http.Transport, error) {
+	transportOnce.Do(func() {
+		transport, transportErr = newTransport(cfg)
+	})
+	return transport, transportErr
+}
+
+func newTransport(cfg Config) (*http.Transport, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+
+	switch cfg.Proxy {
+	case "":
+		t.Proxy = http.ProxyFromEnvironment
+	case proxyNone:
+		t.Proxy = nil
+	default:
+		proxy, err := parseProxy(cfg.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		t.Proxy = http.ProxyURL(proxy)
+	}
+
+	tlsCfg := cryptopolicy.ApplyTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("ca_file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca_file: no PEM certificates in %s", cfg.CAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+	if cfg.ClientCert != "" {
+		// The key may be in the certificate file
+		keyFile := cfg.ClientKey
+		if keyFile == "" {
+			keyFile = cfg.ClientCert
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCert, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("client_cert: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	if insecureTLS {
+		tlsCfg.InsecureSkipVerify = true
+		if !quietRequests {
+			fmt.Fprintln(os.Stderr, "Warning: --insecure: server certificates are not checked")
+		}
+	}
+	t.TLSClientConfig = tlsCfg
+	return t, nil
+}
+
+// parseProxy checks a proxy URL: http, https, socks5 or socks5h (the proxy
+// resolves host names)
+func parseProxy(value string) (*url.URL, error) {
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("proxy: %q is not a URL such as http://proxy:3128 or socks5://proxy:1080", value)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+		return u, nil
+	}
+	return nil, fmt.Errorf("proxy: scheme %q is not one of http, https, socks5, socks5h", u.Scheme)
+}
+
+// validateTransport checks the proxy and TLS settings before they are saved
+func validateTransport(cfg Config) error {
+	if cfg.Proxy != "" && cfg.Proxy != proxyNone {
+		if _, err := parseProxy(cfg.Proxy); err != nil {
+			return err
+		}
+	}
+	if cfg.ClientKey != "" && cfg.ClientCert == "" {
+		return errors.New("client_key: set client_cert too")
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/outbound"
+	"github.com/casjay-forks/caspaste/src/updater"
+)
+
+// updateBranches are the release channels, as for the server's --update
+var updateBranches = []string{"stable", "beta", "daily"}
+
+func validUpdateBranch(branch string) bool {
+	for _, b := range updateBranches {
+		if b == branch {
+			return true
+		}
+	}
+	return false
+}
+
+// updateBranch returns the configured release channel, stable by default
+func updateBranch(cfg Config) string {
+	if cfg.UpdateBranch == "" {
+		return "stable"
+	}
+	return cfg.UpdateBranch
+}
+
+// handleUpdate checks for and installs CLI releases with the server's updater
+func handleUpdate() {
+	args := os.Args[2:]
+	cmd := "yes"
+	if len(args) > 0 {
+		cmd = strings.ToLower(args[0])
+	}
+
+	switch cmd {
+	case "check", "yes":
+		if len(args) > 1 {
+			fmt.Fprintf(os.Stderr, "Usage: caspaste-cli update %s\n", cmd)
+			os.Exit(1)
+		}
+	case "branch":
+		if len(args) != 2 {
+			fmt.Fprintf(os.Stderr, "Usage: caspaste-cli update branch {%s}\n", strings.Join(updateBranches, "|"))
+			os.Exit(1)
+		}
+		setUpdateBranch(strings.ToLower(args[1]))
+		return
+	case "-h", "--help", "help":
+		printCommandHelp("update")
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown update command: %s\n\n", args[0])
+		printCommandHelp("update")
+		os.Exit(1)
+	}
+
+	cfg := loadConfig()
+	if err := validateConfig(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Releases are downloaded through the same proxy as requests to the server
+	if err := outbound.Configure(outbound.Config{Proxy: cfg.Proxy, CAFile: cfg.CAFile}); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	updateCfg := updater.DefaultConfig(Version)
+	updateCfg.BinaryName = "caspaste-cli"
+	updateCfg.Branch = updateBranch(cfg)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	result, err := updater.CheckForUpdate(ctx, updateCfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error checking for updates: %v\n", err)
+		os.Exit(1)
+	}
+	if result.Release == nil {
+		fmt.Printf("caspaste-cli v%s is up to date (%s branch)\n", Version, updateCfg.Branch)
+		return
+	}
+
+	if cmd == "check" {
+		fmt.Printf("Update available: %s -> %s (%s branch)\n", Version, result.NewVersion, updateCfg.Branch)
+		fmt.Println("Run 'caspaste-cli update' to install")
+		return
+	}
+
+	fmt.Printf("Updating caspaste-cli %s -> %s...\n", Version, result.NewVersion)
+	if err := updater.DoUpdate(ctx, updateCfg, result.Release); err != nil {
+		fmt.Fprintf(os.Stderr, "Update failed: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// setUpdateBranch stores the release channel in the config file
+func setUpdateBranch(branch string) {
+	if !validUpdateBranch(branch) {
+		fmt.Fprintf(os.Stderr, "Error: invalid branch '%s'\nValid branches: %s\n", branch, strings.Join(updateBranches, ", "))
+		os.Exit(1)
+	}
+	handleConfigSet("update_branch", branch)
+	fmt.Printf("Update branch set to: %s\n", branch)
+}
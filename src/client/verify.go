@@ -0,0 +1,78 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+)
+
+type VerifyResponse struct {
+	ID        string `json:"id"`
+	Algorithm string `json:"algorithm"`
+	Digest    string `json:"digest"`
+	Size      int    `json:"size"`
+	Intact    bool   `json:"intact"`
+}
+
+// fetchChecksum asks the server for the checksum of a paste; it does not
+// count a view, so it is asked before a burn-after-reading paste is read
+func fetchChecksum(pasteID string, cfg Config) (VerifyResponse, error) {
+	var result VerifyResponse
+
+	// GET /api/v1/pastes/{id}/verify
+	resp, err := makeRequest("GET", "/api/v1/pastes/"+url.PathEscape(pasteID)+"/verify", nil, "", cfg)
+	if err != nil {
+		return result, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	switch resp.StatusCode {
+	case 200:
+	case 404:
+		return result, fmt.Errorf("paste not found")
+	default:
+		if _, parseErr := parseAPIResponse(body); parseErr != nil {
+			return result, parseErr
+		}
+		return result, fmt.Errorf("%s", resp.Status)
+	}
+
+	data, err := parseAPIResponse(body)
+	if err != nil {
+		return result, err
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return result, fmt.Errorf("parsing response: %w", err)
+	}
+	return result, nil
+}
+
+// checkChecksum compares a paste body from the API with the checksum the
+// server reported, hashing it as /raw/ serves it (file bodies decoded)
+func checkChecksum(body string, isFile bool, want VerifyResponse) error {
+	if !want.Intact {
+		return fmt.Errorf("the server's copy of the paste is damaged (it no longer matches its stored checksum)")
+	}
+
+	content := []byte(body)
+	if isFile {
+		if data, err := base64.StdEncoding.DecodeString(body); err == nil {
+			content = data
+		}
+	}
+	sum := sha256.Sum256(content)
+	if got := hex.EncodeToString(sum[:]); got != want.Digest {
+		return fmt.Errorf("checksum mismatch: got %d bytes with sha256 %s, want %d bytes with sha256 %s", len(content), got, want.Size, want.Digest)
+	}
+	return nil
+}
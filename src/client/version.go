@@ -0,0 +1,125 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// apiVersion is the server API this client was built for
+const apiVersion = "v1"
+
+var (
+	// strictVersion makes an incompatible server an error (--strict)
+	strictVersion bool
+	// versionChecked is set once a response with version headers was seen
+	versionChecked bool
+)
+
+// clientVersionHeader is sent with every request for server-side telemetry
+func clientVersionHeader() string {
+	return "caspaste-cli/" + Version + " api/" + apiVersion
+}
+
+// parseVersion splits "1.2.3", "v1.2" or "1.2.3-beta" into numbers; dev
+// builds ("unknown") and daily builds (a timestamp) are not comparable
+func parseVersion(v string) ([]int, bool) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	v, _, _ = strings.Cut(v, "-")
+	parts := strings.Split(v, ".")
+	if len(parts) < 2 {
+		return nil, false
+	}
+	nums := make([]int, len(parts))
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nil, false
+		}
+		nums[i] = n
+	}
+	return nums, true
+}
+
+// compareVersions returns -1, 0 or 1 as a is older than, equal to or newer
+// than b; ok is false when either version is not comparable
+func compareVersions(a, b string) (cmp int, ok bool) {
+	va, okA := parseVersion(a)
+	vb, okB := parseVersion(b)
+	if !okA || !okB {
+		return 0, false
+	}
+	for i := 0; i < len(va) || i < len(vb); i++ {
+		var x, y int
+		if i < len(va) {
+			x = va[i]
+		}
+		if i < len(vb) {
+			y = vb[i]
+		}
+		if x != y {
+			if x < y {
+				return -1, true
+			}
+			return 1, true
+		}
+	}
+	return 0, true
+}
+
+// checkServerVersion compares this client with the server on the first API
+// response: it warns, or exits with --strict, when the server needs a newer
+// client or speaks another API version
+func checkServerVersion(resp *http.Response) {
+	if versionChecked || quietRequests {
+		return
+	}
+	minClient := resp.Header.Get("X-Min-Client-Version")
+	serverAPI := resp.Header.Get("X-API-Version")
+	if minClient == "" && serverAPI == "" {
+		// Servers before version negotiation, or not an API response
+		return
+	}
+	versionChecked = true
+
+	serverVersion := strings.TrimPrefix(resp.Header.Get("Server"), "CasPaste/")
+	var problems []string
+	if serverAPI != "" && serverAPI != apiVersion {
+		problems = append(problems, fmt.Sprintf("server API is %s, this client uses %s", serverAPI, apiVersion))
+	}
+	if cmp, ok := compareVersions(Version, minClient); ok && cmp < 0 {
+		problems = append(problems, fmt.Sprintf("server %s requires caspaste-cli %s or newer, this is %s", serverVersion, minClient, Version))
+	}
+
+	if len(problems) == 0 {
+		// A newer major release may have changed things a client cannot see
+		if cmp, ok := compareVersions(majorVersion(Version), majorVersion(serverVersion)); ok && cmp < 0 {
+			fmt.Fprintf(os.Stderr, "Warning: server %s is newer than caspaste-cli %s; run 'caspaste-cli update' if something fails\n", serverVersion, Version)
+		}
+		return
+	}
+
+	msg := strings.Join(problems, "; ")
+	if strictVersion {
+		fmt.Fprintf(os.Stderr, "Error: %s\nRun 'caspaste-cli update' to upgrade\n", msg)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "Warning: %s\nRun 'caspaste-cli update' to upgrade, or use --strict to stop on this\n", msg)
+}
+
+// majorVersion returns "N.0" for a version "N.x.y", or "" if it has none
+func majorVersion(v string) string {
+	nums, ok := parseVersion(v)
+	if !ok {
+		return ""
+	}
+	return strconv.Itoa(nums[0]) + ".0"
+}
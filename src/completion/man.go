@@ -0,0 +1,107 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package completion
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Man returns the spec as a roff man page for section 1
+func (s *Spec) Man(version string) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, ".TH %s 1 \"\" \"%s\" \"User Commands\"\n", manEscape(strings.ToUpper(s.Name)), manEscape(s.Name+" "+version))
+	b.WriteString(".SH NAME\n")
+	fmt.Fprintf(&b, "%s \\- %s\n", manEscape(s.Name), manEscape(s.Summary))
+
+	b.WriteString(".SH SYNOPSIS\n")
+	fmt.Fprintf(&b, ".B %s\n\\fIcommand\\fR [\\fIoptions\\fR]\n", manEscape(s.Name))
+
+	if len(s.Flags) > 0 {
+		b.WriteString(".SH OPTIONS\n")
+		writeManFlags(&b, s.Flags)
+	}
+
+	b.WriteString(".SH COMMANDS\n")
+	for _, c := range s.Commands {
+		b.WriteString(".TP\n")
+		fmt.Fprintf(&b, ".B %s\n", manEscape(strings.TrimSpace(strings.Join(c.Names(), ", ")+" "+c.Usage)))
+		b.WriteString(manText(c.Summary))
+		if c.Description != "" {
+			b.WriteString(".IP\n")
+			b.WriteString(manText(c.Description))
+		}
+		if len(c.Commands) > 0 || len(c.Flags) > 0 {
+			b.WriteString(".RS\n")
+			for _, sub := range c.Commands {
+				b.WriteString(".TP\n")
+				fmt.Fprintf(&b, ".B %s\n", manEscape(strings.TrimSpace(sub.Name+" "+sub.Usage)))
+				b.WriteString(manText(sub.Summary))
+			}
+			writeManFlags(&b, c.Flags)
+			b.WriteString(".RE\n")
+		}
+	}
+
+	if len(s.Examples) > 0 {
+		b.WriteString(".SH EXAMPLES\n")
+		for _, e := range s.Examples {
+			if e.Summary != "" {
+				b.WriteString(".PP\n")
+				b.WriteString(manText(e.Summary))
+			}
+			b.WriteString(".PP\n.RS\n.nf\n")
+			b.WriteString(manText(e.Command))
+			b.WriteString(".fi\n.RE\n")
+		}
+	}
+
+	for _, section := range s.Sections {
+		fmt.Fprintf(&b, ".SH %s\n", manEscape(strings.ToUpper(section.Title)))
+		b.WriteString(".nf\n")
+		b.WriteString(manText(strings.TrimRight(section.Body, "\n")))
+		b.WriteString(".fi\n")
+	}
+
+	return b.String()
+}
+
+func writeManFlags(b *strings.Builder, flags []Flag) {
+	for _, f := range flags {
+		b.WriteString(".TP\n")
+		names := flagNames(f)
+		for i, n := range names {
+			names[i] = "\\fB" + manEscape(n) + "\\fR"
+		}
+		synopsis := strings.Join(names, ", ")
+		if f.Arg != "" {
+			synopsis += " \\fI" + manEscape(f.Arg) + "\\fR"
+		}
+		b.WriteString(synopsis + "\n")
+		b.WriteString(manText(f.Summary))
+	}
+}
+
+// manEscape escapes backslashes and hyphens for roff
+func manEscape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\e`)
+	return strings.ReplaceAll(s, "-", `\-`)
+}
+
+// manText escapes text and keeps lines from being read as roff requests
+func manText(s string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(s, "\n") {
+		line = manEscape(line)
+		if strings.HasPrefix(line, ".") || strings.HasPrefix(line, "'") {
+			line = `\&` + line
+		}
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
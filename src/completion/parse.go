@@ -0,0 +1,138 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package completion
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrHelp is returned by Parse when -h or --help is given
+var ErrHelp = errors.New("help requested")
+
+// Args are the parsed arguments of a command
+type Args struct {
+	// Values of the flags given, by long name; switches are "true"
+	values map[string]string
+	// Positional holds the arguments that are not flags, in order
+	Positional []string
+}
+
+// Value returns the value of a flag, or "" when it was not given
+func (a *Args) Value(long string) string {
+	return a.values[long]
+}
+
+// Has reports whether a flag was given, even with an empty value
+func (a *Args) Has(long string) bool {
+	_, ok := a.values[long]
+	return ok
+}
+
+// Parse parses the arguments after the command name against the command's flags
+// Flags and positional arguments may be mixed, and "--" ends the flags. Short
+// switches may be combined ("-1p"); a value may be attached ("-tTitle",
+// "--title=Title") or be the next argument. A flag given twice keeps the
+// last value
+// Each "<arg>" in the usage is a required positional argument, and no others
+// are accepted
+func (c Command) Parse(args []string) (*Args, error) {
+	parsed := &Args{values: map[string]string{}}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			parsed.Positional = append(parsed.Positional, args[i+1:]...)
+			i = len(args)
+
+		case strings.HasPrefix(arg, "--"):
+			name, value, attached := strings.Cut(arg[2:], "=")
+			f, ok := c.flag("", name)
+			if !ok {
+				if name == helpFlag.Long {
+					return nil, ErrHelp
+				}
+				return nil, fmt.Errorf("unknown flag --%s", name)
+			}
+			switch {
+			case f.Arg == "" && attached:
+				return nil, fmt.Errorf("flag --%s takes no value", name)
+			case f.Arg == "":
+				value = "true"
+			case !attached:
+				if i+1 >= len(args) {
+					return nil, fmt.Errorf("flag --%s needs a value (%s)", name, f.Arg)
+				}
+				i++
+				value = args[i]
+			}
+			parsed.values[f.Long] = value
+
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			// A run of short switches, the last of which may take a value
+			for j := 1; j < len(arg); j++ {
+				short := arg[j : j+1]
+				f, ok := c.flag(short, "")
+				if !ok {
+					if short == helpFlag.Short {
+						return nil, ErrHelp
+					}
+					return nil, fmt.Errorf("unknown flag -%s", short)
+				}
+				if f.Arg == "" {
+					parsed.values[f.Long] = "true"
+					continue
+				}
+				value := arg[j+1:]
+				if value == "" {
+					if i+1 >= len(args) {
+						return nil, fmt.Errorf("flag -%s needs a value (%s)", short, f.Arg)
+					}
+					i++
+					value = args[i]
+				}
+				parsed.values[f.Long] = value
+				break
+			}
+
+		default:
+			parsed.Positional = append(parsed.Positional, arg)
+		}
+	}
+
+	required := usageArgs(c.Usage)
+	if len(parsed.Positional) < len(required) {
+		return nil, fmt.Errorf("missing %s", required[len(parsed.Positional)])
+	}
+	if len(parsed.Positional) > len(required) {
+		return nil, fmt.Errorf("unexpected argument %q", parsed.Positional[len(required)])
+	}
+	return parsed, nil
+}
+
+// flag returns the flag of a command by its short or long name
+func (c Command) flag(short, long string) (Flag, bool) {
+	for _, f := range c.Flags {
+		if (short != "" && f.Short == short) || (long != "" && f.Long == long) {
+			return f, true
+		}
+	}
+	return Flag{}, false
+}
+
+// usageArgs returns the required arguments of a usage, e.g. ["<paste-id>"]
+func usageArgs(usage string) []string {
+	var required []string
+	for _, field := range strings.Fields(usage) {
+		if strings.HasPrefix(field, "<") {
+			required = append(required, field)
+		}
+	}
+	return required
+}
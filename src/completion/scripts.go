@@ -0,0 +1,458 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package completion
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Completion scripts generated from a Spec. Dynamic values come from
+// "<binary> __complete KIND", which prints one candidate per line.
+
+const (
+	shellNames   = "bash zsh fish sh dash ksh powershell pwsh"
+	shellSubcmds = "completions init man --help"
+)
+
+// allFlags returns the global flags with the flags of every command
+func (s *Spec) allFlags() []Flag {
+	flags := append([]Flag{}, s.Flags...)
+	for _, c := range s.Commands {
+		flags = append(flags, c.Flags...)
+	}
+	return flags
+}
+
+// dashedNames returns the dashed names of flags, without duplicates
+func dashedNames(flags []Flag) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, f := range flags {
+		for _, n := range flagNames(f) {
+			if !seen[n] {
+				seen[n] = true
+				names = append(names, n)
+			}
+		}
+	}
+	return names
+}
+
+// bashValues returns the bash statements completing the value of f
+func bashValues(binaryName string, f Flag) string {
+	switch {
+	case f.Files:
+		return "_filedir"
+	case f.Complete != "":
+		return fmt.Sprintf(`COMPREPLY=($(compgen -W "$(%s __complete %s 2>/dev/null)" -- "${cur}"))`, binaryName, f.Complete)
+	case len(f.Values) > 0:
+		return fmt.Sprintf(`COMPREPLY=($(compgen -W "%s" -- "${cur}"))`, strings.Join(f.Values, " "))
+	}
+	return ""
+}
+
+// writeBashFlagValues writes a case on ${prev} completing flag values
+func writeBashFlagValues(b *strings.Builder, binaryName string, flags []Flag, indent string) {
+	var valued []Flag
+	for _, f := range flags {
+		if f.Arg != "" {
+			valued = append(valued, f)
+		}
+	}
+	if len(valued) == 0 {
+		return
+	}
+
+	fmt.Fprintf(b, "%scase \"${prev}\" in\n", indent)
+	for _, f := range valued {
+		fmt.Fprintf(b, "%s    %s)\n", indent, strings.Join(flagNames(f), "|"))
+		if values := bashValues(binaryName, f); values != "" {
+			fmt.Fprintf(b, "%s        %s\n", indent, values)
+		}
+		fmt.Fprintf(b, "%s        return\n%s        ;;\n", indent, indent)
+	}
+	fmt.Fprintf(b, "%sesac\n", indent)
+}
+
+// GenerateBash returns a bash completion script for the spec
+func (s *Spec) GenerateBash() string {
+	var b strings.Builder
+	fn := "_" + s.Name + "_completions"
+
+	fmt.Fprintf(&b, "# Bash completion for %s\n# Generated by %s --shell completions bash\n\n", s.Name, s.Name)
+	fmt.Fprintf(&b, "%s() {\n    local cur prev words cword\n    _init_completion || return\n\n", fn)
+
+	b.WriteString(`    # Handle --shell subcommands
+    if [[ "${words[1]}" == "--shell" ]]; then
+        case "${cword}" in
+            2)
+                COMPREPLY=($(compgen -W "` + shellSubcmds + `" -- "${cur}"))
+                ;;
+            3)
+                COMPREPLY=($(compgen -W "` + shellNames + `" -- "${cur}"))
+                ;;
+        esac
+        return
+    fi
+
+    # Complete commands and global flags
+    if [[ ${cword} -eq 1 ]]; then
+        COMPREPLY=($(compgen -W "` + strings.Join(s.CommandNames(), " ") + " " + strings.Join(dashedNames(s.Flags), " ") + `" -- "${cur}"))
+        return
+    fi
+
+    case "${words[1]}" in
+`)
+	for _, c := range s.Commands {
+		fmt.Fprintf(&b, "        %s)\n", strings.Join(c.Names(), "|"))
+		writeBashFlagValues(&b, s.Name, c.Flags, "            ")
+		b.WriteString("            if [[ \"${cur}\" == -* ]]; then\n")
+		fmt.Fprintf(&b, "                COMPREPLY=($(compgen -W \"%s\" -- \"${cur}\"))\n", strings.Join(dashedNames(append(append([]Flag{}, c.Flags...), helpFlag)), " "))
+
+		if len(c.Commands) > 0 {
+			var subNames []string
+			for _, sub := range c.Commands {
+				subNames = append(subNames, sub.Names()...)
+			}
+			b.WriteString("            elif [[ ${cword} -eq 2 ]]; then\n")
+			fmt.Fprintf(&b, "                COMPREPLY=($(compgen -W \"%s\" -- \"${cur}\"))\n", strings.Join(subNames, " "))
+			var subCases strings.Builder
+			for _, sub := range c.Commands {
+				if sub.Complete != "" {
+					fmt.Fprintf(&subCases, "                    %s)\n", strings.Join(sub.Names(), "|"))
+					fmt.Fprintf(&subCases, "                        COMPREPLY=($(compgen -W \"$(%s __complete %s 2>/dev/null)\" -- \"${cur}\"))\n", s.Name, sub.Complete)
+					subCases.WriteString("                        ;;\n")
+				}
+			}
+			if subCases.Len() > 0 {
+				b.WriteString("            elif [[ ${cword} -eq 3 ]]; then\n")
+				b.WriteString("                case \"${words[2]}\" in\n")
+				b.WriteString(subCases.String())
+				b.WriteString("                esac\n")
+			}
+		} else if c.Complete != "" {
+			b.WriteString("            elif [[ ${cword} -eq 2 ]]; then\n")
+			fmt.Fprintf(&b, "                COMPREPLY=($(compgen -W \"$(%s __complete %s 2>/dev/null)\" -- \"${cur}\"))\n", s.Name, c.Complete)
+		}
+		b.WriteString("            fi\n            return\n            ;;\n")
+	}
+	b.WriteString("    esac\n\n")
+
+	writeBashFlagValues(&b, s.Name, s.Flags, "    ")
+	fmt.Fprintf(&b, "}\n\ncomplete -F %s %s\n", fn, s.Name)
+
+	return b.String()
+}
+
+// zshQuote quotes s for a single-quoted zsh word
+func zshQuote(s string) string {
+	return strings.ReplaceAll(s, "'", `'\''`)
+}
+
+// zshDescription escapes the [description] of an _arguments spec
+func zshDescription(s string) string {
+	s = strings.ReplaceAll(s, "[", `\[`)
+	return zshQuote(strings.ReplaceAll(s, "]", `\]`))
+}
+
+// zshFlag returns the _arguments spec of a flag
+func zshFlag(binaryName string, f Flag) string {
+	names := flagNames(f)
+	var spec string
+	if len(names) == 1 {
+		spec = "'" + names[0] + "[" + zshDescription(f.Summary) + "]"
+	} else {
+		spec = "'(" + strings.Join(names, " ") + ")'{" + strings.Join(names, ",") + "}'[" + zshDescription(f.Summary) + "]"
+	}
+	if f.Arg != "" {
+		action := " "
+		switch {
+		case f.Files:
+			action = "_files"
+		case f.Complete != "":
+			action = "{_" + binaryName + "_values " + f.Complete + "}"
+		case len(f.Values) > 0:
+			action = "(" + strings.Join(f.Values, " ") + ")"
+		}
+		spec += ":" + zshQuote(strings.ToLower(f.Arg)) + ":" + action
+	}
+	return spec + "'"
+}
+
+// zshDescribe returns _describe entries for commands
+func zshDescribe(commands []Command, indent string) string {
+	var b strings.Builder
+	for _, c := range commands {
+		for _, n := range c.Names() {
+			fmt.Fprintf(&b, "%s'%s:%s'\n", indent, strings.ReplaceAll(n, ":", `\:`), zshQuote(c.Summary))
+		}
+	}
+	return b.String()
+}
+
+// GenerateZsh returns a zsh completion script for the spec
+func (s *Spec) GenerateZsh() string {
+	var b strings.Builder
+	fn := "_" + s.Name
+
+	fmt.Fprintf(&b, "#compdef %s\n# Zsh completion for %s\n# Generated by %s --shell completions zsh\n\n", s.Name, s.Name, s.Name)
+
+	fmt.Fprintf(&b, `# Values from the server and recent paste history
+%s_values() {
+    local -a values
+    values=(${(f)"$(%s __complete $1 2>/dev/null)"})
+    compadd -a values
+}
+
+`, fn, s.Name)
+
+	fmt.Fprintf(&b, "%s() {\n    local curcontext=\"$curcontext\" state line\n    local -a commands\n    commands=(\n", fn)
+	b.WriteString(zshDescribe(s.Commands, "        "))
+	b.WriteString("    )\n\n    _arguments -C \\\n")
+	for _, f := range s.Flags {
+		if f.Long == "shell" {
+			fmt.Fprintf(&b, "        '--shell[%s]:subcommand:(%s):shell:(%s)' \\\n", zshDescription(f.Summary), shellSubcmds, shellNames)
+			continue
+		}
+		fmt.Fprintf(&b, "        %s \\\n", zshFlag(s.Name, f))
+	}
+	b.WriteString(`        '1: :->command' \
+        '*:: :->args'
+
+    case "$state" in
+        command)
+            _describe -t commands 'command' commands
+            ;;
+        args)
+            case "${words[1]}" in
+`)
+	for _, c := range s.Commands {
+		fmt.Fprintf(&b, "                %s)\n", strings.Join(c.Names(), "|"))
+		if len(c.Commands) > 0 {
+			b.WriteString("                    local -a subcommands\n                    subcommands=(\n")
+			b.WriteString(zshDescribe(c.Commands, "                        "))
+			b.WriteString("                    )\n")
+			b.WriteString("                    if (( CURRENT == 2 )); then\n")
+			b.WriteString("                        _describe -t commands 'command' subcommands\n")
+			var subCases strings.Builder
+			for _, sub := range c.Commands {
+				if sub.Complete != "" {
+					fmt.Fprintf(&subCases, "                            %s)\n", strings.Join(sub.Names(), "|"))
+					fmt.Fprintf(&subCases, "                                %s_values %s\n                                ;;\n", fn, sub.Complete)
+				}
+			}
+			if subCases.Len() > 0 {
+				b.WriteString("                    elif (( CURRENT == 3 )); then\n")
+				b.WriteString("                        case \"${words[2]}\" in\n")
+				b.WriteString(subCases.String())
+				b.WriteString("                        esac\n")
+			}
+			b.WriteString("                    fi\n                    ;;\n")
+			continue
+		}
+
+		var specs []string
+		for _, f := range append(append([]Flag{}, c.Flags...), helpFlag) {
+			specs = append(specs, zshFlag(s.Name, f))
+		}
+		if c.Complete != "" {
+			message := "argument"
+			if fields := strings.Fields(c.Usage); len(fields) > 0 {
+				message = strings.Trim(fields[0], "<>[]")
+			}
+			specs = append(specs, fmt.Sprintf("'1:%s:{%s_values %s}'", zshQuote(message), fn, c.Complete))
+		}
+		b.WriteString("                    _arguments \\\n                        ")
+		b.WriteString(strings.Join(specs, " \\\n                        "))
+		b.WriteString("\n                    ;;\n")
+	}
+	fmt.Fprintf(&b, `            esac
+            ;;
+    esac
+}
+
+%s "$@"
+`, fn)
+
+	return b.String()
+}
+
+// fishQuote quotes s for a single-quoted fish word
+func fishQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return strings.ReplaceAll(s, "'", `\'`)
+}
+
+// fishFlag returns the complete arguments of a flag, without the condition
+func fishFlag(binaryName string, f Flag) string {
+	var b strings.Builder
+	if f.Short != "" {
+		b.WriteString(" -s " + f.Short)
+	}
+	if f.Long != "" {
+		b.WriteString(" -l " + f.Long)
+	}
+	fmt.Fprintf(&b, " -d '%s'", fishQuote(f.Summary))
+	if f.Arg != "" {
+		switch {
+		case f.Files:
+			b.WriteString(" -r -F")
+		case f.Complete != "":
+			fmt.Fprintf(&b, " -x -a '(%s __complete %s 2>/dev/null)'", binaryName, f.Complete)
+		case len(f.Values) > 0:
+			fmt.Fprintf(&b, " -x -a '%s'", strings.Join(f.Values, " "))
+		default:
+			b.WriteString(" -x")
+		}
+	}
+	return b.String()
+}
+
+// GenerateFish returns a fish completion script for the spec
+func (s *Spec) GenerateFish() string {
+	var b strings.Builder
+	using := "__fish_" + strings.ReplaceAll(s.Name, "-", "_") + "_using"
+
+	fmt.Fprintf(&b, "# Fish completion for %s\n# Generated by %s --shell completions fish\n\n", s.Name, s.Name)
+
+	// using COUNT COMMAND... is true when the command line has COUNT words
+	// (any count when 0) and its first argument is one of the commands
+	fmt.Fprintf(&b, `function %s
+    set -l words (commandline -opc)
+    test (count $words) -ge 2; or return 1
+    if test $argv[1] -gt 0
+        test (count $words) -eq $argv[1]; or return 1
+    end
+    contains -- $words[2] $argv[2..-1]
+end
+
+`, using)
+
+	fmt.Fprintf(&b, "complete -c %s -f\n\n# Commands\n", s.Name)
+	for _, c := range s.Commands {
+		for _, n := range c.Names() {
+			fmt.Fprintf(&b, "complete -c %s -n '__fish_use_subcommand' -a '%s' -d '%s'\n", s.Name, n, fishQuote(c.Summary))
+		}
+	}
+
+	b.WriteString("\n# Global flags\n")
+	for _, f := range s.Flags {
+		if f.Long == "shell" {
+			fmt.Fprintf(&b, "complete -c %s -n '__fish_use_subcommand' -l shell -d '%s' -x -a '%s'\n", s.Name, fishQuote(f.Summary), shellSubcmds)
+			fmt.Fprintf(&b, "complete -c %s -n '__fish_seen_argument -l shell' -x -a '%s'\n", s.Name, shellNames)
+			continue
+		}
+		fmt.Fprintf(&b, "complete -c %s -n '__fish_use_subcommand'%s\n", s.Name, fishFlag(s.Name, f))
+	}
+
+	for _, c := range s.Commands {
+		names := strings.Join(c.Names(), " ")
+		fmt.Fprintf(&b, "\n# %s\n", c.Name)
+		for _, f := range c.Flags {
+			fmt.Fprintf(&b, "complete -c %s -n '%s 0 %s'%s\n", s.Name, using, names, fishFlag(s.Name, f))
+		}
+		if c.Complete != "" {
+			fmt.Fprintf(&b, "complete -c %s -n '%s 2 %s' -a '(%s __complete %s 2>/dev/null)'\n", s.Name, using, names, s.Name, c.Complete)
+		}
+		for _, sub := range c.Commands {
+			fmt.Fprintf(&b, "complete -c %s -n '%s 2 %s' -a '%s' -d '%s'\n", s.Name, using, names, sub.Name, fishQuote(sub.Summary))
+			if sub.Complete != "" {
+				fmt.Fprintf(&b, "complete -c %s -n '%s 3 %s; and contains -- (commandline -opc)[3] %s' -a '(%s __complete %s 2>/dev/null)'\n",
+					s.Name, using, names, strings.Join(sub.Names(), " "), s.Name, sub.Complete)
+			}
+		}
+	}
+
+	return b.String()
+}
+
+// GeneratePosix returns a basic word-list completion script for the spec
+func (s *Spec) GeneratePosix() string {
+	words := append(s.CommandNames(), dashedNames(s.allFlags())...)
+
+	return fmt.Sprintf(`# POSIX shell completion for %s
+# Generated by %s --shell completions sh
+# Add to your shell profile for tab completion
+
+_%s_complete() {
+    local words="%s"
+    local cur="${COMP_WORDS[COMP_CWORD]}"
+    COMPREPLY=($(compgen -W "$words" -- "$cur"))
+}
+
+complete -F _%s_complete %s
+`, s.Name, s.Name, s.Name, strings.Join(words, " "), s.Name, s.Name)
+}
+
+// psList returns a PowerShell array literal
+func psList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	}
+	return "@(" + strings.Join(quoted, ", ") + ")"
+}
+
+// GeneratePowershell returns a PowerShell completion script for the spec
+func (s *Spec) GeneratePowershell() string {
+	// Flag values by flag name: fixed lists or a __complete kind
+	var values strings.Builder
+	for _, f := range s.allFlags() {
+		var v string
+		switch {
+		case f.Complete != "":
+			v = "'" + f.Complete + "'"
+		case len(f.Values) > 0:
+			v = psList(f.Values)
+		default:
+			continue
+		}
+		for _, n := range flagNames(f) {
+			fmt.Fprintf(&values, "        '%s' = %s\n", n, v)
+		}
+	}
+
+	return fmt.Sprintf(`# PowerShell completion for %s
+# Generated by %s --shell completions powershell
+
+Register-ArgumentCompleter -Native -CommandName %s -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+
+    $commands = %s
+    $flags = %s
+    $shells = %s
+    $shellSubcmds = %s
+    $flagValues = @{
+%s    }
+
+    $elements = $commandAst.CommandElements
+    $lastWord = if ($elements.Count -gt 1) { $elements[-1].Extent.Text } else { '' }
+    $secondLastWord = if ($elements.Count -gt 2) { $elements[-2].Extent.Text } else { '' }
+    $prev = if ($wordToComplete -eq '') { $lastWord } else { $secondLastWord }
+
+    $candidates = $commands + $flags
+    if ($prev -eq '--shell') {
+        $candidates = $shellSubcmds
+    } elseif ($prev -eq 'completions' -or $prev -eq 'init') {
+        $candidates = $shells
+    } elseif ($flagValues.ContainsKey($prev)) {
+        $candidates = $flagValues[$prev]
+        if ($candidates -is [string]) {
+            $candidates = @(& %s __complete $candidates 2>$null)
+        }
+    }
+
+    $candidates | Where-Object { $_ -like "$wordToComplete*" } | ForEach-Object {
+        [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+    }
+}
+`, s.Name, s.Name, s.Name,
+		psList(s.CommandNames()), psList(dashedNames(s.allFlags())),
+		psList(strings.Fields(shellNames)), psList(strings.Fields(shellSubcmds)),
+		values.String(), s.Name)
+}
@@ -0,0 +1,243 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package completion
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Spec declares the commands and flags of a CLI binary. Help output, the man
+// page and the shell completion scripts are all generated from it.
+type Spec struct {
+	// Name is the binary name, e.g. caspaste-cli
+	Name string
+	// Title and Summary head the help output and the man page
+	Title   string
+	Summary string
+	// Flags are accepted before any command
+	Flags    []Flag
+	Commands []Command
+	Examples []Example
+	// Sections are free-form help sections such as Configuration
+	Sections []Section
+}
+
+// Command is a CLI command with its own flags and, optionally, subcommands
+type Command struct {
+	Name    string
+	Aliases []string
+	// Usage describes the arguments after the command name, e.g. "<paste-id>"
+	Usage       string
+	Summary     string
+	Description string
+	Flags       []Flag
+	Commands    []Command
+	// Complete is the __complete kind that completes the first argument
+	Complete string
+	Examples []Example
+}
+
+// Flag is a command-line option
+type Flag struct {
+	// Short and Long are given without dashes
+	Short string
+	Long  string
+	// Arg is the value placeholder; switches have none
+	Arg     string
+	Summary string
+	// Values completes a fixed set of values
+	Values []string
+	// Complete is the __complete kind that completes the value
+	Complete string
+	// Files completes file names
+	Files bool
+}
+
+// Example is a command line shown in help and the man page
+type Example struct {
+	Summary string
+	Command string
+}
+
+// Section is a free-form block of help text
+type Section struct {
+	Title string
+	Body  string
+}
+
+// helpFlag is added to the options of every command
+var helpFlag = Flag{Short: "h", Long: "help", Summary: "Show this help"}
+
+// Names returns the command name followed by its aliases
+func (c Command) Names() []string {
+	return append([]string{c.Name}, c.Aliases...)
+}
+
+// Command returns the command called name or one of its aliases
+func (s *Spec) Command(name string) (Command, bool) {
+	for _, c := range s.Commands {
+		for _, n := range c.Names() {
+			if n == name {
+				return c, true
+			}
+		}
+	}
+	return Command{}, false
+}
+
+// CommandNames returns every command name and alias
+func (s *Spec) CommandNames() []string {
+	var names []string
+	for _, c := range s.Commands {
+		names = append(names, c.Names()...)
+	}
+	return names
+}
+
+// Help returns the top-level help text
+func (s *Spec) Help(version string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s v%s\n%s\n\n", s.Title, version, s.Summary)
+	fmt.Fprintf(&b, "Usage: %s <command> [options]\n", s.Name)
+
+	b.WriteString("\nCommands:\n")
+	rows := make([][2]string, 0, len(s.Commands))
+	for _, c := range s.Commands {
+		rows = append(rows, [2]string{strings.Join(c.Names(), ", "), c.Summary})
+	}
+	writeRows(&b, rows)
+
+	if len(s.Flags) > 0 {
+		b.WriteString("\nOptions:\n")
+		writeFlags(&b, s.Flags)
+	}
+
+	writeExamples(&b, s.Examples)
+
+	for _, section := range s.Sections {
+		fmt.Fprintf(&b, "\n%s:\n", section.Title)
+		for _, line := range strings.Split(strings.TrimRight(section.Body, "\n"), "\n") {
+			if line == "" {
+				b.WriteString("\n")
+			} else {
+				b.WriteString("  " + line + "\n")
+			}
+		}
+	}
+
+	return b.String()
+}
+
+// CommandHelp returns the help text of one command
+func (s *Spec) CommandHelp(c Command) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n\n", c.Summary)
+	fmt.Fprintf(&b, "Usage: %s\n", strings.TrimSpace(s.Name+" "+c.Name+" "+commandUsage(c)))
+
+	if c.Description != "" {
+		fmt.Fprintf(&b, "\n%s\n", strings.TrimRight(c.Description, "\n"))
+	}
+	if len(c.Aliases) > 0 {
+		fmt.Fprintf(&b, "\nAliases: %s\n", strings.Join(c.Aliases, ", "))
+	}
+
+	if len(c.Commands) > 0 {
+		b.WriteString("\nCommands:\n")
+		rows := make([][2]string, 0, len(c.Commands))
+		for _, sub := range c.Commands {
+			rows = append(rows, [2]string{strings.TrimSpace(sub.Name + " " + sub.Usage), sub.Summary})
+		}
+		writeRows(&b, rows)
+	}
+
+	b.WriteString("\nOptions:\n")
+	writeFlags(&b, append(append([]Flag{}, c.Flags...), helpFlag))
+
+	writeExamples(&b, c.Examples)
+	return b.String()
+}
+
+// commandUsage returns the argument synopsis of a command
+func commandUsage(c Command) string {
+	if c.Usage != "" {
+		return c.Usage
+	}
+	if len(c.Commands) > 0 {
+		return "[command]"
+	}
+	if len(c.Flags) > 0 {
+		return "[options]"
+	}
+	return ""
+}
+
+// flagSynopsis returns "-f, --file FILE" or "    --redact"
+func flagSynopsis(f Flag) string {
+	var synopsis string
+	switch {
+	case f.Short != "" && f.Long != "":
+		synopsis = "-" + f.Short + ", --" + f.Long
+	case f.Short != "":
+		synopsis = "-" + f.Short
+	default:
+		synopsis = "    --" + f.Long
+	}
+	if f.Arg != "" {
+		synopsis += " " + f.Arg
+	}
+	return synopsis
+}
+
+// flagNames returns the dashed names of a flag
+func flagNames(f Flag) []string {
+	var names []string
+	if f.Short != "" {
+		names = append(names, "-"+f.Short)
+	}
+	if f.Long != "" {
+		names = append(names, "--"+f.Long)
+	}
+	return names
+}
+
+func writeFlags(b *strings.Builder, flags []Flag) {
+	rows := make([][2]string, 0, len(flags))
+	for _, f := range flags {
+		rows = append(rows, [2]string{flagSynopsis(f), f.Summary})
+	}
+	writeRows(b, rows)
+}
+
+// writeRows writes two aligned columns
+func writeRows(b *strings.Builder, rows [][2]string) {
+	width := 0
+	for _, row := range rows {
+		if len(row[0]) > width {
+			width = len(row[0])
+		}
+	}
+	for _, row := range rows {
+		fmt.Fprintf(b, "  %-*s  %s\n", width, row[0], row[1])
+	}
+}
+
+func writeExamples(b *strings.Builder, examples []Example) {
+	if len(examples) == 0 {
+		return
+	}
+	b.WriteString("\nExamples:\n")
+	for i, e := range examples {
+		if e.Summary != "" {
+			if i > 0 {
+				b.WriteString("\n")
+			}
+			fmt.Fprintf(b, "  # %s\n", e.Summary)
+		}
+		fmt.Fprintf(b, "  %s\n", e.Command)
+	}
+}
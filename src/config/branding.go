@@ -0,0 +1,150 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrInvalidBranding wraps every branding validation error
+var ErrInvalidBranding = errors.New("invalid branding")
+
+// ErrBrandingReadOnly is returned when branding cannot be saved because
+// the config comes from the environment rather than a file
+var ErrBrandingReadOnly = errors.New("branding is read-only: the config is built from the environment")
+
+// Branding limits
+const (
+	BrandingTitleMaxLength   = 64
+	BrandingTagLineMaxLength = 160
+	BrandingMaxFooterLinks   = 10
+	BrandingLabelMaxLength   = 64
+)
+
+// BrandingAssetPath is the URL prefix of uploaded logo and favicon files
+const BrandingAssetPath = "/branding/"
+
+var hexColorRegex = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+
+// BrandColors overrides theme colors; empty values keep the theme's color
+type BrandColors struct {
+	// Header and nav background
+	Header string `yaml:"header" json:"header"`
+	// Header and nav text
+	HeaderFont string `yaml:"header_font" json:"header_font"`
+	// Links
+	Link string `yaml:"link" json:"link"`
+	// Primary buttons
+	Accent string `yaml:"accent" json:"accent"`
+}
+
+// FooterLink is an extra link shown in the page footer
+type FooterLink struct {
+	Label string `yaml:"label" json:"label"`
+	URL   string `yaml:"url" json:"url"`
+}
+
+// Branding is the instance look: the parts of server and web.branding
+// that the admin panel edits and templates render
+type Branding struct {
+	Title       string       `json:"title"`
+	TagLine     string       `json:"tagline"`
+	Logo        string       `json:"logo"`
+	Favicon     string       `json:"favicon"`
+	Colors      BrandColors  `json:"colors"`
+	FooterLinks []FooterLink `json:"footer_links"`
+}
+
+// Branding returns the branding settings of the config
+func (cfg *YAMLConfig) Branding() Branding {
+	return Branding{
+		Title:       cfg.Server.Title,
+		TagLine:     cfg.Server.TagLine,
+		Logo:        cfg.Web.Branding.Logo,
+		Favicon:     cfg.Web.Branding.Favicon,
+		Colors:      cfg.Web.Branding.Colors,
+		FooterLinks: append([]FooterLink(nil), cfg.Web.Branding.FooterLinks...),
+	}
+}
+
+// SetBranding stores branding settings in the config
+func (cfg *YAMLConfig) SetBranding(b Branding) {
+	cfg.Server.Title = b.Title
+	cfg.Server.TagLine = b.TagLine
+	cfg.Web.Branding.Logo = b.Logo
+	cfg.Web.Branding.Favicon = b.Favicon
+	cfg.Web.Branding.Colors = b.Colors
+	cfg.Web.Branding.FooterLinks = append([]FooterLink(nil), b.FooterLinks...)
+}
+
+// Validate checks lengths, colors and URLs
+// Colors must be hex because they are written into the stylesheet as is
+func (b Branding) Validate() error {
+	if utf8.RuneCountInString(b.Title) > BrandingTitleMaxLength {
+		return fmt.Errorf("%w: title is longer than %d characters", ErrInvalidBranding, BrandingTitleMaxLength)
+	}
+	if utf8.RuneCountInString(b.TagLine) > BrandingTagLineMaxLength {
+		return fmt.Errorf("%w: tagline is longer than %d characters", ErrInvalidBranding, BrandingTagLineMaxLength)
+	}
+
+	if err := validateAsset("logo", b.Logo); err != nil {
+		return err
+	}
+	if err := validateAsset("favicon", b.Favicon); err != nil {
+		return err
+	}
+
+	colors := map[string]string{
+		"header":      b.Colors.Header,
+		"header_font": b.Colors.HeaderFont,
+		"link":        b.Colors.Link,
+		"accent":      b.Colors.Accent,
+	}
+	for name, color := range colors {
+		if color != "" && !hexColorRegex.MatchString(color) {
+			return fmt.Errorf("%w: colors.%s must be a hex color like #1a2b3c", ErrInvalidBranding, name)
+		}
+	}
+
+	if len(b.FooterLinks) > BrandingMaxFooterLinks {
+		return fmt.Errorf("%w: at most %d footer links are allowed", ErrInvalidBranding, BrandingMaxFooterLinks)
+	}
+	for i, link := range b.FooterLinks {
+		label := strings.TrimSpace(link.Label)
+		if label == "" || utf8.RuneCountInString(label) > BrandingLabelMaxLength {
+			return fmt.Errorf("%w: footer link %d needs a label of 1-%d characters", ErrInvalidBranding, i+1, BrandingLabelMaxLength)
+		}
+		if !isWebURL(link.URL) && !isSitePath(link.URL) {
+			return fmt.Errorf("%w: footer link %q must be an http(s) URL or a path on this site", ErrInvalidBranding, label)
+		}
+	}
+
+	return nil
+}
+
+// validateAsset accepts an http(s) URL, an uploaded asset or a local file
+func validateAsset(name, value string) error {
+	if value == "" || isWebURL(value) || strings.HasPrefix(value, BrandingAssetPath) || filepath.IsAbs(value) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s must be an http(s) URL, an uploaded file or an absolute file path", ErrInvalidBranding, name)
+}
+
+func isWebURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func isSitePath(s string) bool {
+	return strings.HasPrefix(s, "/") && !strings.HasPrefix(s, "//")
+}
@@ -7,12 +7,18 @@
 package config
 
 import (
+	"github.com/casjay-forks/caspaste/src/content"
 	"github.com/casjay-forks/caspaste/src/logger"
 	"github.com/casjay-forks/caspaste/src/netshare"
+	"github.com/casjay-forks/caspaste/src/redact"
 )
 
 const Software = "CasPaste"
 
+// MinClientVersion is the oldest caspaste-cli release that works with this
+// server's API; raise it when a change would break older clients
+const MinClientVersion = "1.0.0"
+
 // Default API and admin path values
 const (
 	DefaultAPIVersion = "v1"
@@ -67,8 +73,12 @@ func AdminAPIPath() string {
 type Config struct {
 	Log logger.Logger
 
-	RateLimitNew *netshare.RateLimitSystem
-	RateLimitGet *netshare.RateLimitSystem
+	RateLimitNew   *netshare.RateLimitSystem
+	RateLimitGet   *netshare.RateLimitSystem
+	RateLimitAuth  *netshare.RateLimitSystem
+	RateLimitAdmin *netshare.RateLimitSystem
+	// Exemptions and bans shared by the rate limit systems
+	RateLimitRules *netshare.RateLimitRules
 
 	// API and admin paths
 	APIVersion string
@@ -79,12 +89,15 @@ type Config struct {
 	TitleMaxLen int
 	BodyMaxLen  int
 	MaxLifeTime int64
+	// Largest streamed upload in bytes; 0 = streaming uploads off
+	StreamMaxSize int64
+
+	// Redaction policy for new pastes (nil = never redact)
+	Redaction *redact.Policy
 
-	// Content
-	ServerAbout      string
-	ServerRules      string
-	ServerTermsOfUse string
-	SecurityTxt      string
+	// Content (about, rules and terms are replaced live by the admin panel)
+	Content     *content.Set
+	SecurityTxt string
 
 	// Server info
 	FQDN        string
@@ -100,10 +113,11 @@ type Config struct {
 	SiteRobotsAllow      string
 	SiteRobotsDeny       string
 	SiteRobotsAgentsDeny []string
+	// X-Robots-Tag for paste pages (empty = none)
+	SiteRobotsPasteTag string
 
-	// Branding
-	Logo    string
-	Favicon string
+	// Branding (title, logo, colors and footer links)
+	Branding Branding
 
 	// Authentication
 	// true = open/public (no auth), false = auth required
@@ -116,6 +130,7 @@ type Config struct {
 	UiDefaultLifetime string
 	UiDefaultTheme    string
 	UiThemesDir       string
+	UiRelatedPastes   bool
 
 	// Multi-User Configuration (PART 34)
 	Users UsersConfig
@@ -135,6 +150,7 @@ type UsersConfig struct {
 	Profile      ProfileConfig
 	Auth         UserAuthConfig
 	Limits       UserLimitsConfig
+	OAuth        OAuthProviderConfig
 }
 
 // RegistrationConfig contains registration settings
@@ -191,6 +207,25 @@ type UserAuthConfig struct {
 	PasswordRequireUppercase bool
 	PasswordRequireNumber    bool
 	PasswordRequireSpecial   bool
+	// Stateless JWT issuance on login
+	JWT JWTConfig
+}
+
+// JWTConfig contains stateless JWT settings
+// Keys are shared by every node so tokens verify without shared session storage
+type JWTConfig struct {
+	// Issue a JWT on login and accept it on the API
+	Enabled bool
+	// Keyring file (default: {config_dir}/jwt.keys)
+	KeyFile string
+	// Environment variable holding a fixed secret; replaces the keyring file
+	SecretEnv string
+	// Token lifetime; JWTs cannot be revoked so keep this short
+	TTL string
+	// Rotate the signing key after this many days (0 = manual rotation only)
+	RotateDays int
+	// Value for the iss claim (default: server FQDN)
+	Issuer string
 }
 
 // UserLimitsConfig contains per-user limits
@@ -200,6 +235,17 @@ type UserLimitsConfig struct {
 	RequestsPerDay    int
 }
 
+// OAuthProviderConfig contains OAuth2 authorization server settings
+type OAuthProviderConfig struct {
+	// Allow users to register third-party applications
+	Enabled bool
+	// Allow clients without a secret (PKCE required)
+	AllowPublicClients bool
+	// Token lifetimes
+	AccessTokenTTL  string
+	RefreshTokenTTL string
+}
+
 // FeaturesConfig contains optional feature settings per PART 35, 36
 type FeaturesConfig struct {
 	Organizations OrganizationsConfig
@@ -210,6 +256,10 @@ type FeaturesConfig struct {
 type OrganizationsConfig struct {
 	// Enable organization support
 	Enabled bool
+	// Slugs that cannot be used, including look-alikes (paypa1, pаypal)
+	ReservedSlugs []string
+	// Optional file of additional reserved slugs, one per line
+	BlocklistFile string
 }
 
 // CustomDomainsConfig contains custom domain settings per PART 36
@@ -234,6 +284,8 @@ type CustomDomainsConfig struct {
 	SSLRenewalDays int
 	// Reserved domains that cannot be used
 	Reserved []string
+	// Optional file of reserved words; domain labels matching them (or look-alikes) are rejected
+	BlocklistFile string
 }
 
 // DefaultUsersConfig returns default user configuration
@@ -269,11 +321,24 @@ func DefaultUsersConfig() UsersConfig {
 			PasswordRequireUppercase: false,
 			PasswordRequireNumber:    false,
 			PasswordRequireSpecial:   false,
+			JWT: JWTConfig{
+				Enabled:    false,
+				KeyFile:    "",
+				TTL:        "15m",
+				RotateDays: 30,
+				Issuer:     "",
+			},
 		},
 		Limits: UserLimitsConfig{
 			RequestsPerMinute: 0,
 			RequestsPerDay:    0,
 		},
+		OAuth: OAuthProviderConfig{
+			Enabled:            false,
+			AllowPublicClients: true,
+			AccessTokenTTL:     "1h",
+			RefreshTokenTTL:    "30d",
+		},
 	}
 }
 
@@ -282,6 +347,10 @@ func DefaultFeaturesConfig() FeaturesConfig {
 	return FeaturesConfig{
 		Organizations: OrganizationsConfig{
 			Enabled: false,
+			ReservedSlugs: []string{
+				"admin", "api", "caspaste", "official", "security",
+				"support", "staff", "verified", "www",
+			},
 		},
 		CustomDomains: CustomDomainsConfig{
 			Enabled:           false,
@@ -141,6 +141,10 @@ func ApplyEnvironmentOverrides(cfg *YAMLConfig) {
 	if val := getEnv("BIND"); val != "" {
 		cfg.Server.Listen = val
 	}
+	// Several addresses, e.g. "10.0.0.5:8080,tls://[::1]:8443,unix:/run/caspaste.sock"
+	if val := getEnv("LISTENERS"); val != "" {
+		cfg.Server.Listeners = ParseListeners(val)
+	}
 	// Now string format: "8080" or "8080,64453"
 	if val := getEnv("PORT"); val != "" {
 		cfg.Server.Port = val
@@ -174,6 +178,14 @@ func ApplyEnvironmentOverrides(cfg *YAMLConfig) {
 		cfg.Server.Administrator.From = val
 	}
 
+	// Abuse reports
+	if val := getEnv("ABUSE_EMAIL"); val != "" {
+		cfg.Server.Abuse.Email = val
+	}
+	if val := getEnv("ABUSE_TICKETS"); val != "" {
+		cfg.Server.Abuse.Tickets = validation.IsTruthy(val)
+	}
+
 	// Web security contact
 	if val := getEnv("WEB_SECURITY_CONTACT_EMAIL"); val != "" {
 		cfg.Web.Security.Contact.Email = val
@@ -189,6 +201,15 @@ func ApplyEnvironmentOverrides(cfg *YAMLConfig) {
 	if val := getEnv("SITE_ROBOTS_DENY"); val != "" {
 		cfg.Web.SEO.Robots.Deny = val
 	}
+	if val := getEnv("SITE_ROBOTS_AI_PRESETS"); val != "" {
+		cfg.Web.SEO.Robots.Agents.Presets = strings.Split(val, ",")
+	}
+	if val := getEnv("SITE_ROBOTS_ENFORCE"); val != "" {
+		cfg.Web.SEO.Robots.Agents.Enforce = validation.IsTruthy(val)
+	}
+	if val := getEnv("SITE_ROBOTS_NOINDEX_PASTES"); val != "" {
+		cfg.Web.SEO.Robots.NoindexPastes = validation.IsTruthy(val)
+	}
 	// Legacy compatibility
 	if val := getEnv("ROBOTS_DISALLOW"); val != "" {
 		if validation.IsTruthy(val) {
@@ -225,6 +246,23 @@ func ApplyEnvironmentOverrides(cfg *YAMLConfig) {
 		cfg.Database.CleanupPeriod = val
 	}
 
+	// Cluster settings
+	if val := getEnv("LEADER_ELECTION"); val != "" {
+		cfg.Server.Cluster.LeaderElection = strings.ToLower(val)
+	}
+	if val := getEnv("LEASE_NAME"); val != "" {
+		cfg.Server.Cluster.LeaseName = val
+	}
+	if val := getEnv("LEASE_DURATION"); val != "" {
+		cfg.Server.Cluster.LeaseDuration = val
+	}
+	if val := getEnv("LEASE_NAMESPACE"); val != "" {
+		cfg.Server.Cluster.Namespace = val
+	}
+	if val := getEnv("CONFIG_RELOAD"); val != "" {
+		cfg.Server.ConfigReload = val
+	}
+
 	// Security settings
 	if val := getEnv("PASSWORD_FILE"); val != "" {
 		cfg.Security.PasswordFile = val
@@ -282,6 +320,40 @@ func ApplyEnvironmentOverrides(cfg *YAMLConfig) {
 		}
 	}
 
+	// Rate limits - login and registration
+	if val := getEnv("AUTH_REQUESTS_PER_5MIN"); val != "" {
+		if num, err := strconv.ParseUint(val, 10, 32); err == nil {
+			cfg.Limits.RateLimit.Auth.Per5Min = uint(num)
+		}
+	}
+	if val := getEnv("AUTH_REQUESTS_PER_15MIN"); val != "" {
+		if num, err := strconv.ParseUint(val, 10, 32); err == nil {
+			cfg.Limits.RateLimit.Auth.Per15Min = uint(num)
+		}
+	}
+	if val := getEnv("AUTH_REQUESTS_PER_1HOUR"); val != "" {
+		if num, err := strconv.ParseUint(val, 10, 32); err == nil {
+			cfg.Limits.RateLimit.Auth.Per1Hour = uint(num)
+		}
+	}
+
+	// Rate limits - admin panel and API
+	if val := getEnv("ADMIN_REQUESTS_PER_5MIN"); val != "" {
+		if num, err := strconv.ParseUint(val, 10, 32); err == nil {
+			cfg.Limits.RateLimit.Admin.Per5Min = uint(num)
+		}
+	}
+	if val := getEnv("ADMIN_REQUESTS_PER_15MIN"); val != "" {
+		if num, err := strconv.ParseUint(val, 10, 32); err == nil {
+			cfg.Limits.RateLimit.Admin.Per15Min = uint(num)
+		}
+	}
+	if val := getEnv("ADMIN_REQUESTS_PER_1HOUR"); val != "" {
+		if num, err := strconv.ParseUint(val, 10, 32); err == nil {
+			cfg.Limits.RateLimit.Admin.Per1Hour = uint(num)
+		}
+	}
+
 	// UI settings -> Web.UI
 	if val := getEnv("UI_DEFAULT_LIFETIME"); val != "" {
 		cfg.Web.UI.DefaultLifetime = val
@@ -292,6 +364,9 @@ func ApplyEnvironmentOverrides(cfg *YAMLConfig) {
 	if val := getEnv("UI_THEMES_DIR"); val != "" {
 		cfg.Web.UI.ThemesDir = val
 	}
+	if val := getEnv("UI_RELATED_PASTES"); val != "" {
+		cfg.Web.UI.RelatedPastes = validation.IsTruthy(val)
+	}
 
 	// Content settings -> Web.Content
 	if val := getEnv("CONTENT_ABOUT"); val != "" {
@@ -326,6 +401,11 @@ func ApplyEnvironmentOverrides(cfg *YAMLConfig) {
 	if val := getEnv("LOGS_DIR"); val != "" {
 		cfg.Directories.Logs = val
 	}
+
+	// Logging
+	if val := getEnv("LOG_LEVEL"); val != "" {
+		cfg.Logging.Level = strings.ToLower(val)
+	}
 }
 
 // ApplyCriticalOverrides applies security-critical environment variables on EVERY run
@@ -347,6 +427,39 @@ func ApplyCriticalOverrides(cfg *YAMLConfig) {
 		cfg.Security.PasswordFile = val
 	}
 
+	// WORM (write-once) compliance mode
+	if val := getEnv("WORM_MODE"); val != "" {
+		cfg.Security.WORM = validation.IsTruthy(val)
+	}
+
+	// Strict (FIPS) crypto policy
+	if val := getEnv("FIPS"); val != "" {
+		cfg.Security.FIPS = validation.IsTruthy(val)
+	}
+
+	// Paste redaction policy
+	if val := getEnv("REDACTION_ENABLED"); val != "" {
+		cfg.Security.Redaction.Enabled = validation.IsTruthy(val)
+	}
+	if val := getEnv("REDACTION_ALLOW_OVERRIDE"); val != "" {
+		cfg.Security.Redaction.AllowOverride = validation.IsTruthy(val)
+	}
+
+	// IP reputation API key, kept out of the config file
+	if val := getEnv("REPUTATION_API_KEY"); val != "" {
+		cfg.Security.Reputation.APIKey = val
+	}
+
+	// Safe Browsing API key for the spam filter, kept out of the config file
+	if val := getEnv("SPAM_SAFE_BROWSING_API_KEY"); val != "" {
+		cfg.Security.Spam.SafeBrowsing.APIKey = val
+	}
+
+	// MaxMind license key for GeoIP downloads, kept out of the config file
+	if val := getEnv("MAXMIND_LICENSE_KEY"); val != "" {
+		cfg.Server.GeoIP.MaxMind.LicenseKey = val
+	}
+
 	// TLS settings - critical for HTTPS security
 	if val := getEnv("TLS_MIN_VERSION"); val != "" {
 		cfg.Security.TLS.MinVersion = val
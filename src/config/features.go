@@ -0,0 +1,37 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package config
+
+// FeaturesConfig returns the organization and custom domain settings of the config
+// Empty lists and durations keep their DefaultFeaturesConfig values
+func (cfg *YAMLConfig) FeaturesConfig() FeaturesConfig {
+	features := DefaultFeaturesConfig()
+
+	orgs := cfg.Features.Organizations
+	features.Organizations.Enabled = orgs.Enabled
+	features.Organizations.BlocklistFile = orgs.BlocklistFile
+	if len(orgs.ReservedSlugs) > 0 {
+		features.Organizations.ReservedSlugs = orgs.ReservedSlugs
+	}
+
+	domains := cfg.Features.CustomDomains
+	features.CustomDomains.Enabled = domains.Enabled
+	features.CustomDomains.MaxDomainsPerUser = domains.MaxDomainsPerUser
+	features.CustomDomains.MaxDomainsPerOrg = domains.MaxDomainsPerOrg
+	features.CustomDomains.RequireSSL = domains.RequireSSL
+	features.CustomDomains.AllowApex = domains.AllowApex
+	features.CustomDomains.AllowSubdomain = domains.AllowSubdomain
+	features.CustomDomains.AllowWildcard = domains.AllowWildcard
+	features.CustomDomains.SSLRenewalDays = domains.SSLRenewalDays
+	features.CustomDomains.BlocklistFile = domains.BlocklistFile
+	if domains.VerificationTTL != "" {
+		features.CustomDomains.VerificationTTL = domains.VerificationTTL
+	}
+	if len(domains.Reserved) > 0 {
+		features.CustomDomains.Reserved = domains.Reserved
+	}
+	return features
+}
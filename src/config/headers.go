@@ -0,0 +1,69 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package config
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Content Security Policies of the default per-path overrides
+const (
+	// The OpenAPI and GraphQL explorers load their scripts and styles from unpkg
+	CSPAPIExplorer = "default-src 'self'; script-src 'self' 'unsafe-inline' https://unpkg.com; style-src 'self' 'unsafe-inline' https://unpkg.com; img-src 'self' data: https:; font-src 'self' data: https://unpkg.com; connect-src 'self'; object-src 'none'; base-uri 'self'; form-action 'self'"
+	// Raw pastes are shown as they are, sandboxed and with nothing loaded
+	CSPRaw = "default-src 'none'; img-src 'self'; media-src 'self'; style-src 'unsafe-inline'; sandbox"
+	// Paste pages load nothing from other hosts, so a paste cannot track
+	// its readers with remote images
+	CSPPaste = "default-src 'self'; script-src 'self' 'unsafe-inline'; style-src 'self' 'unsafe-inline'; img-src 'self' data:; font-src 'self' data:; connect-src 'self'; media-src 'self'; object-src 'none'; base-uri 'none'; form-action 'self'; frame-ancestors 'self'"
+)
+
+// HeaderPath overrides security headers for the paths matching Path, a
+// pattern as in path.Match: /openapi, /raw/*, or /* for every top-level
+// page such as a paste
+type HeaderPath struct {
+	Path string `yaml:"path"`
+	// Empty keeps security.headers.content_security_policy
+	ContentSecurityPolicy string `yaml:"content_security_policy"`
+	// Empty keeps security.headers.x_frame_options
+	XFrameOptions string `yaml:"x_frame_options"`
+	// Only report violations of this path's policy, see csp_report_only
+	CSPReportOnly bool `yaml:"csp_report_only"`
+}
+
+// DefaultHeaderPaths relax the policy for the API explorers and tighten it
+// for pastes; the first match wins, so specific paths come first
+func DefaultHeaderPaths() []HeaderPath {
+	return []HeaderPath{
+		{Path: "/openapi", ContentSecurityPolicy: CSPAPIExplorer},
+		{Path: "/graphql", ContentSecurityPolicy: CSPAPIExplorer},
+		{Path: "/raw/*", ContentSecurityPolicy: CSPRaw},
+		{Path: "/*", ContentSecurityPolicy: CSPPaste},
+	}
+}
+
+// HeaderPaths returns the configured overrides, or the default ones when
+// security.headers.paths is not set
+func HeaderPaths(cfg *YAMLConfig) []HeaderPath {
+	if cfg.Security.Headers.Paths == nil {
+		return DefaultHeaderPaths()
+	}
+	return cfg.Security.Headers.Paths
+}
+
+// ValidateHeaderPaths checks the patterns of security.headers.paths
+func ValidateHeaderPaths(paths []HeaderPath) error {
+	for i, p := range paths {
+		if !strings.HasPrefix(p.Path, "/") {
+			return fmt.Errorf("security.headers.paths[%d]: path %q must start with /", i, p.Path)
+		}
+		if _, err := path.Match(p.Path, "/"); err != nil {
+			return fmt.Errorf("security.headers.paths[%d]: path %q: %w", i, p.Path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package config
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// UnixPrefix marks a listener address as a unix socket path
+const UnixPrefix = "unix:"
+
+// Listener is an address the server accepts connections on, see
+// server.listeners
+type Listener struct {
+	// host:port, [ipv6]:port, :port, or unix:/path/to/socket
+	Address string `yaml:"address" json:"address"`
+	// Serve HTTPS on this address
+	TLS bool `yaml:"tls" json:"tls"`
+}
+
+// Unix returns the socket path of a unix listener, or ""
+func (l Listener) Unix() string {
+	if !strings.HasPrefix(l.Address, UnixPrefix) {
+		return ""
+	}
+	return strings.TrimPrefix(l.Address, UnixPrefix)
+}
+
+// Port returns the TCP port of a listener, or 0 for a unix socket
+func (l Listener) Port() int {
+	if l.Unix() != "" {
+		return 0
+	}
+	_, port, _ := net.SplitHostPort(l.Address)
+	n, _ := strconv.Atoi(port)
+	return n
+}
+
+// ValidateListeners checks server.listeners: every address must be a TCP
+// address with a port, or an absolute unix socket path, and appear once
+func ValidateListeners(listeners []Listener) error {
+	seen := map[string]bool{}
+	for i, l := range listeners {
+		if strings.HasPrefix(l.Address, UnixPrefix) {
+			if path := l.Unix(); !filepath.IsAbs(path) {
+				return fmt.Errorf("server.listeners[%d]: unix socket path %q must be absolute", i, path)
+			}
+		} else {
+			host, port, err := net.SplitHostPort(l.Address)
+			if err != nil {
+				return fmt.Errorf("server.listeners[%d]: address %q: want host:port, [ipv6]:port or unix:/path", i, l.Address)
+			}
+			if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+				return fmt.Errorf("server.listeners[%d]: invalid port %q", i, port)
+			}
+			if host != "" && net.ParseIP(host) == nil {
+				return fmt.Errorf("server.listeners[%d]: host %q must be an IP address", i, host)
+			}
+		}
+		if seen[l.Address] {
+			return fmt.Errorf("server.listeners[%d]: address %q is listed twice", i, l.Address)
+		}
+		seen[l.Address] = true
+	}
+	return nil
+}
+
+// ParseListeners reads listeners from a comma-separated list, as in
+// CASPASTE_LISTENERS; an address prefixed with tls:// serves HTTPS
+func ParseListeners(value string) []Listener {
+	var listeners []Listener
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		l := Listener{Address: field}
+		if rest, ok := strings.CutPrefix(field, "tls://"); ok {
+			l = Listener{Address: rest, TLS: true}
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners
+}
@@ -0,0 +1,188 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/casjay-forks/caspaste/src/cli"
+	"github.com/casjay-forks/caspaste/src/netshare"
+	"github.com/casjay-forks/caspaste/src/redact"
+)
+
+// PolicyBundleVersion is the format version written to policy bundles
+const PolicyBundleVersion = 1
+
+// ErrInvalidPolicy wraps every policy bundle validation error
+var ErrInvalidPolicy = errors.New("invalid policy bundle")
+
+// ErrPoliciesReadOnly is returned when policies cannot be imported because
+// the config is built from the environment
+var ErrPoliciesReadOnly = errors.New("policies are read-only: the config is built from the environment")
+
+// PolicyBundle is the policy part of the server config: rate limits, quotas,
+// retention, moderation rules and reserved slugs
+// It is exported and imported on its own so operators can keep policies in
+// version control apart from the rest of server.yml
+type PolicyBundle struct {
+	Version       int              `yaml:"version"`
+	RateLimits    RateLimitPolicy  `yaml:"rate_limits"`
+	Quotas        QuotaPolicy      `yaml:"quotas"`
+	Retention     RetentionPolicy  `yaml:"retention"`
+	Moderation    ModerationPolicy `yaml:"moderation"`
+	ReservedSlugs []string         `yaml:"reserved_slugs"`
+}
+
+// RateLimitPolicy has the fields of limits.rate_limit
+type RateLimitPolicy struct {
+	GetPastes RateLimitWindows         `yaml:"get_pastes"`
+	NewPastes RateLimitWindows         `yaml:"new_pastes"`
+	Auth      RateLimitWindows         `yaml:"auth"`
+	Admin     RateLimitWindows         `yaml:"admin"`
+	Exempt    []netshare.RateLimitRule `yaml:"exempt"`
+	Ban       []netshare.RateLimitRule `yaml:"ban"`
+}
+
+// QuotaPolicy limits the size of pastes and uploads
+type QuotaPolicy struct {
+	TitleMaxLength   int      `yaml:"title_max_length"`
+	BodyMaxLength    int      `yaml:"body_max_length"`
+	MaxFileSize      int64    `yaml:"max_file_size"`
+	AllowedMIMETypes []string `yaml:"allowed_mime_types"`
+}
+
+// RetentionPolicy decides how long pastes are kept
+type RetentionPolicy struct {
+	MaxPasteLifetime string `yaml:"max_paste_lifetime"`
+	WORM             bool   `yaml:"worm"`
+}
+
+// ModerationPolicy holds the rules applied to new pastes
+type ModerationPolicy struct {
+	// Has the fields of security.redaction
+	Redaction struct {
+		Enabled       bool             `yaml:"enabled"`
+		AllowOverride bool             `yaml:"allow_override"`
+		Builtins      []string         `yaml:"builtins"`
+		Patterns      []redact.Pattern `yaml:"patterns"`
+		Replacement   string           `yaml:"replacement"`
+	} `yaml:"redaction"`
+}
+
+// Policies returns the policy settings of the config
+func (cfg *YAMLConfig) Policies() PolicyBundle {
+	var b PolicyBundle
+	b.Version = PolicyBundleVersion
+	b.RateLimits = RateLimitPolicy{
+		GetPastes: cfg.Limits.RateLimit.GetPastes,
+		NewPastes: cfg.Limits.RateLimit.NewPastes,
+		Auth:      cfg.Limits.RateLimit.Auth,
+		Admin:     cfg.Limits.RateLimit.Admin,
+		Exempt:    append([]netshare.RateLimitRule(nil), cfg.Limits.RateLimit.Exempt...),
+		Ban:       append([]netshare.RateLimitRule(nil), cfg.Limits.RateLimit.Ban...),
+	}
+	b.Quotas = QuotaPolicy{
+		TitleMaxLength:   cfg.Limits.TitleMaxLength,
+		BodyMaxLength:    cfg.Limits.BodyMaxLength,
+		MaxFileSize:      cfg.Security.Upload.MaxFileSize,
+		AllowedMIMETypes: append([]string(nil), cfg.Security.Upload.AllowedMIME...),
+	}
+	b.Retention = RetentionPolicy{
+		MaxPasteLifetime: cfg.Limits.MaxPasteLifetime,
+		WORM:             cfg.Security.WORM,
+	}
+	b.Moderation.Redaction = cfg.Security.Redaction
+	b.ReservedSlugs = append([]string(nil), cfg.Limits.ReservedSlugs...)
+	return b
+}
+
+// SetPolicies stores policy settings in the config
+func (cfg *YAMLConfig) SetPolicies(b PolicyBundle) {
+	cfg.Limits.RateLimit.GetPastes = b.RateLimits.GetPastes
+	cfg.Limits.RateLimit.NewPastes = b.RateLimits.NewPastes
+	cfg.Limits.RateLimit.Auth = b.RateLimits.Auth
+	cfg.Limits.RateLimit.Admin = b.RateLimits.Admin
+	cfg.Limits.RateLimit.Exempt = append([]netshare.RateLimitRule(nil), b.RateLimits.Exempt...)
+	cfg.Limits.RateLimit.Ban = append([]netshare.RateLimitRule(nil), b.RateLimits.Ban...)
+	cfg.Limits.TitleMaxLength = b.Quotas.TitleMaxLength
+	cfg.Limits.BodyMaxLength = b.Quotas.BodyMaxLength
+	cfg.Security.Upload.MaxFileSize = b.Quotas.MaxFileSize
+	cfg.Security.Upload.AllowedMIME = append([]string(nil), b.Quotas.AllowedMIMETypes...)
+	cfg.Limits.MaxPasteLifetime = b.Retention.MaxPasteLifetime
+	cfg.Security.WORM = b.Retention.WORM
+	cfg.Security.Redaction = b.Moderation.Redaction
+	cfg.Limits.ReservedSlugs = append([]string(nil), b.ReservedSlugs...)
+}
+
+// ParsePolicyBundle reads and validates a policy bundle
+// Unknown keys are rejected so a typo cannot silently drop a policy
+func ParsePolicyBundle(data []byte) (PolicyBundle, error) {
+	var b PolicyBundle
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&b); err != nil {
+		return b, fmt.Errorf("%w: %v", ErrInvalidPolicy, err)
+	}
+	if b.Version != PolicyBundleVersion {
+		return b, fmt.Errorf("%w: version %d is not supported (expected %d)", ErrInvalidPolicy, b.Version, PolicyBundleVersion)
+	}
+	return b, b.Validate()
+}
+
+// Validate checks the values the server would refuse to start with
+func (b PolicyBundle) Validate() error {
+	if err := netshare.NewRateLimitRules().Set(b.RateLimits.Exempt, b.RateLimits.Ban); err != nil {
+		return fmt.Errorf("%w: rate_limits: %v", ErrInvalidPolicy, err)
+	}
+
+	if b.Quotas.BodyMaxLength == 0 {
+		return fmt.Errorf("%w: quotas.body_max_length cannot be 0", ErrInvalidPolicy)
+	}
+	if b.Quotas.MaxFileSize < 0 {
+		return fmt.Errorf("%w: quotas.max_file_size cannot be negative", ErrInvalidPolicy)
+	}
+
+	switch lifetime := b.Retention.MaxPasteLifetime; lifetime {
+	case "", "never", "unlimited":
+	default:
+		duration, err := cli.ParseDuration(lifetime)
+		if err != nil {
+			return fmt.Errorf("%w: retention.max_paste_lifetime: %v", ErrInvalidPolicy, err)
+		}
+		if duration < 10*time.Minute {
+			return fmt.Errorf("%w: retention.max_paste_lifetime cannot be less than 10 minutes", ErrInvalidPolicy)
+		}
+	}
+
+	r := b.Moderation.Redaction
+	_, err := redact.NewPolicy(redact.Config{
+		Enabled:       r.Enabled,
+		AllowOverride: r.AllowOverride,
+		Builtins:      r.Builtins,
+		Patterns:      r.Patterns,
+		Replacement:   r.Replacement,
+	})
+	if err != nil {
+		return fmt.Errorf("%w: moderation.redaction: %v", ErrInvalidPolicy, err)
+	}
+	return nil
+}
+
+// Marshal writes the bundle as YAML with a header naming what it is
+func (b PolicyBundle) Marshal() ([]byte, error) {
+	data, err := yaml.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+	header := "# CasPaste policy bundle\n# Import with PUT /api/{version}/{admin_path}/server/policies\n"
+	return append([]byte(header), data...), nil
+}
@@ -0,0 +1,69 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package config
+
+import (
+	"errors"
+
+	"github.com/casjay-forks/caspaste/src/netshare"
+)
+
+// ErrRateLimitsReadOnly is returned when rate limits cannot be saved because
+// the config is built from the environment
+var ErrRateLimitsReadOnly = errors.New("rate limits are read-only: the config is built from the environment")
+
+// Rate limit route classes
+const (
+	RateLimitGet   = "get"
+	RateLimitNew   = "new"
+	RateLimitAuth  = "auth"
+	RateLimitAdmin = "admin"
+)
+
+// RateLimitClasses lists the route classes in display order
+var RateLimitClasses = []string{RateLimitGet, RateLimitNew, RateLimitAuth, RateLimitAdmin}
+
+// RateLimitWindows is the request limit of a route class per period (0 = unlimited)
+type RateLimitWindows struct {
+	// Requests per 5 minutes
+	Per5Min uint `yaml:"per_5min" json:"per_5min"`
+	// Requests per 15 minutes
+	Per15Min uint `yaml:"per_15min" json:"per_15min"`
+	// Requests per 1 hour
+	Per1Hour uint `yaml:"per_1hour" json:"per_1hour"`
+}
+
+// RateLimitClass returns the limits of a route class, or nil for an unknown class
+func (c *YAMLConfig) RateLimitClass(class string) *RateLimitWindows {
+	switch class {
+	case RateLimitGet:
+		return &c.Limits.RateLimit.GetPastes
+	case RateLimitNew:
+		return &c.Limits.RateLimit.NewPastes
+	case RateLimitAuth:
+		return &c.Limits.RateLimit.Auth
+	case RateLimitAdmin:
+		return &c.Limits.RateLimit.Admin
+	}
+	return nil
+}
+
+// RateLimitSystem returns the running rate limit system of a route class,
+// or nil for an unknown class
+func (c *Config) RateLimitSystem(class string) *netshare.RateLimitSystem {
+	switch class {
+	case RateLimitGet:
+		return c.RateLimitGet
+	case RateLimitNew:
+		return c.RateLimitNew
+	case RateLimitAuth:
+		return c.RateLimitAuth
+	case RateLimitAdmin:
+		return c.RateLimitAdmin
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// AICrawlerPresets groups known AI crawler user agents by operator
+// Use the preset "all" to deny every crawler listed here
+var AICrawlerPresets = map[string][]string{
+	"amazon":      {"Amazonbot"},
+	"anthropic":   {"ClaudeBot", "Claude-Web", "anthropic-ai"},
+	"apple":       {"Applebot-Extended"},
+	"bytedance":   {"Bytespider"},
+	"cohere":      {"cohere-ai"},
+	"commoncrawl": {"CCBot"},
+	"diffbot":     {"Diffbot"},
+	"google":      {"Google-Extended"},
+	"meta":        {"FacebookBot", "Meta-ExternalAgent"},
+	"omgili":      {"Omgilibot"},
+	"openai":      {"GPTBot", "ChatGPT-User", "OAI-SearchBot"},
+	"perplexity":  {"PerplexityBot"},
+}
+
+// ExpandCrawlerPresets merges preset user agents into an explicit agent list
+// Duplicates are dropped case-insensitively; unknown preset names are an error
+func ExpandCrawlerPresets(presets, agents []string) ([]string, error) {
+	var names []string
+	for _, preset := range presets {
+		preset = strings.ToLower(strings.TrimSpace(preset))
+		if preset == "all" {
+			all := make([]string, 0, len(AICrawlerPresets))
+			for name := range AICrawlerPresets {
+				all = append(all, name)
+			}
+			sort.Strings(all)
+			names = append(names, all...)
+			continue
+		}
+		if _, ok := AICrawlerPresets[preset]; !ok {
+			return nil, fmt.Errorf("unknown AI crawler preset %q", preset)
+		}
+		names = append(names, preset)
+	}
+
+	seen := make(map[string]bool)
+	var result []string
+	add := func(agent string) {
+		key := strings.ToLower(agent)
+		if agent == "" || seen[key] {
+			return
+		}
+		seen[key] = true
+		result = append(result, agent)
+	}
+
+	for _, agent := range agents {
+		add(strings.TrimSpace(agent))
+	}
+	for _, name := range names {
+		for _, agent := range AICrawlerPresets[name] {
+			add(agent)
+		}
+	}
+	return result, nil
+}
+
+// PasteRobotsTag returns the X-Robots-Tag value for paste pages
+// noindexPastes forces noindex even when a custom tag omits it
+func PasteRobotsTag(tag string, noindexPastes bool) string {
+	tag = strings.TrimSpace(tag)
+	if !noindexPastes {
+		return tag
+	}
+	if tag == "" {
+		return "noindex, nofollow, noarchive"
+	}
+	if !strings.Contains(strings.ToLower(tag), "noindex") {
+		return "noindex, " + tag
+	}
+	return tag
+}
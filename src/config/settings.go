@@ -0,0 +1,195 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/casjay-forks/caspaste/src/cli"
+)
+
+// ErrSettingsReadOnly is returned when settings cannot be saved because the
+// config is built from the environment
+var ErrSettingsReadOnly = errors.New("settings are read-only: the config is built from the environment")
+
+// Registration modes
+const (
+	// Anyone can create an account
+	RegistrationPublic = "public"
+	// Accounts are created from an admin's invitation only
+	RegistrationPrivate = "private"
+	// No accounts can be created
+	RegistrationDisabled = "disabled"
+)
+
+// SettingsDescriptionMaxLength bounds server.description
+const SettingsDescriptionMaxLength = 300
+
+// minPasteLifetime is the shortest limits.max_paste_lifetime
+const minPasteLifetime = 10 * time.Minute
+
+// rateLimitKeys are the yaml keys of the rate limit route classes
+var rateLimitKeys = map[string]string{
+	RateLimitGet:   "get_pastes",
+	RateLimitNew:   "new_pastes",
+	RateLimitAuth:  "auth",
+	RateLimitAdmin: "admin",
+}
+
+// Settings are the server settings edited in the admin panel
+type Settings struct {
+	Title        string `json:"title"`
+	TagLine      string `json:"tagline"`
+	Description  string `json:"description"`
+	Registration string `json:"registration"`
+
+	TitleMaxLength   int    `json:"title_max_length"`
+	BodyMaxLength    int    `json:"body_max_length"`
+	MaxPasteLifetime string `json:"max_paste_lifetime"`
+
+	// Limits by route class, see RateLimitClasses
+	RateLimits map[string]RateLimitWindows `json:"rate_limits"`
+}
+
+// FieldError is an invalid setting, by its key in the config file
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// SettingsError lists every invalid setting
+type SettingsError []FieldError
+
+func (e SettingsError) Error() string {
+	parts := make([]string, len(e))
+	for i, f := range e {
+		parts[i] = f.Field + ": " + f.Message
+	}
+	return "invalid settings: " + strings.Join(parts, "; ")
+}
+
+// Fields returns the message of each invalid setting by its key
+func (e SettingsError) Fields() map[string]string {
+	fields := make(map[string]string, len(e))
+	for _, f := range e {
+		fields[f.Field] = f.Message
+	}
+	return fields
+}
+
+// Settings returns the settings of the config
+func (c *YAMLConfig) Settings() Settings {
+	s := Settings{
+		Title:            c.Server.Title,
+		TagLine:          c.Server.TagLine,
+		Description:      c.Server.Description,
+		Registration:     c.Server.Registration,
+		TitleMaxLength:   c.Limits.TitleMaxLength,
+		BodyMaxLength:    c.Limits.BodyMaxLength,
+		MaxPasteLifetime: c.Limits.MaxPasteLifetime,
+		RateLimits:       make(map[string]RateLimitWindows, len(RateLimitClasses)),
+	}
+	if s.Registration == "" {
+		s.Registration = RegistrationPublic
+	}
+	for _, class := range RateLimitClasses {
+		s.RateLimits[class] = *c.RateLimitClass(class)
+	}
+	return s
+}
+
+// SetSettings stores settings in the config; rate limits of classes left
+// out of s are kept
+func (c *YAMLConfig) SetSettings(s Settings) {
+	c.Server.Title = s.Title
+	c.Server.TagLine = s.TagLine
+	c.Server.Description = s.Description
+	c.Server.Registration = s.Registration
+	c.Limits.TitleMaxLength = s.TitleMaxLength
+	c.Limits.BodyMaxLength = s.BodyMaxLength
+	c.Limits.MaxPasteLifetime = s.MaxPasteLifetime
+	for class, limits := range s.RateLimits {
+		if w := c.RateLimitClass(class); w != nil {
+			*w = limits
+		}
+	}
+}
+
+// Validate checks every setting, returning a SettingsError naming each
+// invalid one
+func (s Settings) Validate() error {
+	var errs SettingsError
+	add := func(field, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if strings.TrimSpace(s.Title) == "" {
+		add("server.title", "is required")
+	} else if utf8.RuneCountInString(s.Title) > BrandingTitleMaxLength {
+		add("server.title", "must be at most %d characters", BrandingTitleMaxLength)
+	}
+	if utf8.RuneCountInString(s.TagLine) > BrandingTagLineMaxLength {
+		add("server.tagline", "must be at most %d characters", BrandingTagLineMaxLength)
+	}
+	if utf8.RuneCountInString(s.Description) > SettingsDescriptionMaxLength {
+		add("server.description", "must be at most %d characters", SettingsDescriptionMaxLength)
+	}
+	switch s.Registration {
+	case "", RegistrationPublic, RegistrationPrivate, RegistrationDisabled:
+	default:
+		add("server.registration", "must be public, private or disabled")
+	}
+
+	if s.BodyMaxLength == 0 {
+		add("limits.body_max_length", "cannot be 0; use -1 for no limit")
+	}
+	if err := checkPasteLifetime(s.MaxPasteLifetime); err != nil {
+		add("limits.max_paste_lifetime", "%s", err)
+	}
+
+	classes := make([]string, 0, len(s.RateLimits))
+	for class := range s.RateLimits {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	for _, class := range classes {
+		if rateLimitKeys[class] == "" {
+			add("limits.rate_limit."+class, "unknown route class; use %s", strings.Join(RateLimitClasses, ", "))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// checkPasteLifetime checks limits.max_paste_lifetime the way startup
+// reads it
+func checkPasteLifetime(value string) error {
+	if value == "" || value == "never" || value == "unlimited" {
+		return nil
+	}
+	d, err := cli.ParseDuration(value)
+	if err != nil {
+		return errors.New(`must be "never" or a duration such as 30d`)
+	}
+	if d < minPasteLifetime {
+		return errors.New("cannot be less than 10 minutes")
+	}
+	return nil
+}
+
+// RateLimitKey returns the key of a route class in the config file, under
+// limits.rate_limit
+func RateLimitKey(class string) string {
+	return rateLimitKeys[class]
+}
@@ -0,0 +1,37 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package config
+
+// UsersConfig returns the multi-user settings of the config
+// Settings the YAML file does not carry keep their DefaultUsersConfig values
+func (cfg *YAMLConfig) UsersConfig() UsersConfig {
+	users := DefaultUsersConfig()
+	users.Enabled = cfg.Users.Enabled
+	if cfg.Server.Registration != "" {
+		users.Registration.Mode = cfg.Server.Registration
+	}
+
+	jwt := cfg.Users.Auth.JWT
+	users.Auth.JWT.Enabled = jwt.Enabled
+	users.Auth.JWT.KeyFile = jwt.KeyFile
+	users.Auth.JWT.SecretEnv = jwt.SecretEnv
+	users.Auth.JWT.RotateDays = jwt.RotateDays
+	users.Auth.JWT.Issuer = jwt.Issuer
+	if jwt.TTL != "" {
+		users.Auth.JWT.TTL = jwt.TTL
+	}
+
+	oauth := cfg.Users.OAuth
+	users.OAuth.Enabled = oauth.Enabled
+	users.OAuth.AllowPublicClients = oauth.AllowPublicClients
+	if oauth.AccessTokenTTL != "" {
+		users.OAuth.AccessTokenTTL = oauth.AccessTokenTTL
+	}
+	if oauth.RefreshTokenTTL != "" {
+		users.OAuth.RefreshTokenTTL = oauth.RefreshTokenTTL
+	}
+	return users
+}
@@ -0,0 +1,49 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"os"
+	"time"
+)
+
+// WatchFile calls onChange whenever the contents of path change, until ctx is done
+// The file is polled rather than watched with inotify: Kubernetes updates a
+// mounted ConfigMap by swapping a symlink, which inotify on the file misses
+func WatchFile(ctx context.Context, path string, interval time.Duration, onChange func()) {
+	last := fileHash(path)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			current := fileHash(path)
+			// A missing file mid-update is not a change; wait for the new one
+			if current == nil || bytes.Equal(current, last) {
+				continue
+			}
+			last = current
+			onChange()
+		}
+	}
+}
+
+func fileHash(path string) []byte {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
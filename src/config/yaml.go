@@ -9,9 +9,13 @@ package config
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"gopkg.in/yaml.v3"
+
+	"github.com/casjay-forks/caspaste/src/netshare"
+	"github.com/casjay-forks/caspaste/src/redact"
 )
 
 // YAMLConfig represents the YAML configuration file structure
@@ -26,12 +30,17 @@ type YAMLConfig struct {
 		Listen string `yaml:"listen"`
 		// Port number (empty=auto-detect available port)
 		Port string `yaml:"port"`
+		// Addresses to accept connections on, each with or without TLS; when
+		// set, listen and port are not bound
+		Listeners []Listener `yaml:"listeners"`
 		// Server title
 		Title string `yaml:"title"`
 		// Server tagline (short description)
 		TagLine string `yaml:"tagline"`
 		// Server description (longer description for meta tags)
 		Description string `yaml:"description"`
+		// Who can create an account: public, private (invitation only) or disabled (default: public)
+		Registration string `yaml:"registration"`
 
 		Proxy struct {
 			// Additional trusted proxy IPs/CIDRs (appended to default private ranges)
@@ -47,6 +56,26 @@ type YAMLConfig struct {
 			From string `yaml:"from"`
 		} `yaml:"administrator"`
 
+		SMTP struct {
+			// SMTP server host (empty = email disabled)
+			Host string `yaml:"host"`
+			// SMTP server port (default: 587)
+			Port int `yaml:"port"`
+			// Username and password (optional)
+			Username string `yaml:"username"`
+			Password string `yaml:"password"`
+			// auto, starttls, tls or none (default: auto)
+			TLS string `yaml:"tls"`
+		} `yaml:"smtp"`
+
+		// Abuse reports about pastes
+		Abuse struct {
+			// Address reports are sent to, e.g. abuse@{fqdn} (empty = administrator email)
+			Email string `yaml:"email"`
+			// Email a ticket with a snapshot of the paste for each report (default: false, needs smtp)
+			Tickets bool `yaml:"tickets"`
+		} `yaml:"abuse"`
+
 		Timeouts struct {
 			// Read timeout in seconds (default: 15)
 			Read int `yaml:"read"`
@@ -68,11 +97,159 @@ type YAMLConfig struct {
 			IncludeRuntime bool `yaml:"include_runtime"`
 			// Optional bearer token for authentication
 			Token string `yaml:"token"`
+			// IP addresses and CIDR networks allowed to scrape; empty = any
+			AllowedIPs []string `yaml:"allowed_ips"`
 			// Histogram buckets for request duration (seconds)
 			DurationBuckets []float64 `yaml:"duration_buckets"`
 			// Histogram buckets for request/response size (bytes)
 			SizeBuckets []float64 `yaml:"size_buckets"`
 		} `yaml:"metrics"`
+
+		// DNS upstreams for domain verification and FQDN resolution
+		DNS struct {
+			// Nameserver IPs, optional port (empty=system resolver)
+			Servers []string `yaml:"servers"`
+			// DNS-over-HTTPS endpoints, tried after servers
+			DoH []string `yaml:"doh"`
+			// Lookup timeout in seconds per upstream (default: 5)
+			Timeout int `yaml:"timeout"`
+		} `yaml:"dns"`
+
+		// Public IP discovery for custom domain A-record verification
+		PublicIP struct {
+			// Static public IPs; when set, no third-party service is contacted
+			Static []string `yaml:"static"`
+			// Never contact third-party services to discover the public IP
+			DisableDiscovery bool `yaml:"disable_discovery"`
+			// STUN servers (host:port), tried before the HTTP services
+			STUN []string `yaml:"stun"`
+			// HTTP services returning the caller's IP as plain text
+			Services []string `yaml:"services"`
+		} `yaml:"public_ip"`
+
+		// Static read-only mirror of public pastes, regenerated on a schedule
+		Mirror struct {
+			// Enable the mirror job (default: false)
+			Enabled bool `yaml:"enabled"`
+			// Cron schedule (default: hourly)
+			Schedule string `yaml:"schedule"`
+			// Output directory (default: {data_dir}/mirror)
+			Dir string `yaml:"dir"`
+			// Optional S3-compatible bucket the mirror is pushed to
+			S3 struct {
+				Endpoint  string `yaml:"endpoint"`
+				Region    string `yaml:"region"`
+				Bucket    string `yaml:"bucket"`
+				Prefix    string `yaml:"prefix"`
+				AccessKey string `yaml:"access_key"`
+				SecretKey string `yaml:"secret_key"`
+			} `yaml:"s3"`
+		} `yaml:"mirror"`
+
+		// Running several replicas against one database
+		Cluster struct {
+			// Who runs background jobs: auto, database, kubernetes, none
+			// (default: auto = database for postgres/mysql, none for sqlite)
+			LeaderElection string `yaml:"leader_election"`
+			// Lease name, shared by all replicas (default: caspaste)
+			LeaseName string `yaml:"lease_name"`
+			// Lease duration; a new leader takes over this long after the old one dies (default: 15s)
+			LeaseDuration string `yaml:"lease_duration"`
+			// Kubernetes namespace of the Lease (default: the pod's namespace)
+			Namespace string `yaml:"namespace"`
+		} `yaml:"cluster"`
+
+		// Outbound deliveries (abuse tickets, notification emails) run on a
+		// bounded pool of workers; 0 or empty = the default
+		Dispatch struct {
+			// Deliveries sent at the same time (default: 4)
+			Workers int `yaml:"workers"`
+			// Deliveries waiting for a worker; more are refused (default: 100)
+			Queue int `yaml:"queue"`
+			// Failures in a row that pause deliveries to a destination (default: 5)
+			FailureThreshold int `yaml:"failure_threshold"`
+			// How long a failing destination is paused (default: 1m)
+			Cooldown string `yaml:"cooldown"`
+			// Longest a delivery may take (default: 30s)
+			Timeout string `yaml:"timeout"`
+		} `yaml:"dispatch"`
+
+		// Opt-in usage ping for the maintainers: version, OS/arch, database
+		// driver and a rounded paste count; see caspaste --telemetry show
+		Telemetry struct {
+			// Send the ping (default: false)
+			Enabled bool `yaml:"enabled"`
+			// Collector URL the ping is posted to; required when enabled
+			Endpoint string `yaml:"endpoint"`
+			// Cron schedule (default: weekly)
+			Schedule string `yaml:"schedule"`
+		} `yaml:"telemetry"`
+
+		// Central directory of public instances: list its peers at
+		// /api/v1/server/peers and, opt-in, announce this instance there
+		Directory struct {
+			// Directory API base URL (empty = no directory)
+			URL string `yaml:"url"`
+			// Register this instance; only public instances are registered (default: false)
+			Register bool `yaml:"register"`
+			// Name in the directory (default: server.title)
+			Name string `yaml:"name"`
+			// URL of this instance as listed (default: https://{fqdn})
+			PublicURL string `yaml:"public_url"`
+			// Cron schedule for registering and refreshing peers (default: daily)
+			Schedule string `yaml:"schedule"`
+		} `yaml:"directory"`
+
+		// GeoIP country and ASN lookups from ip-location-db or MaxMind (MMDB)
+		// databases, downloaded on first run and refreshed weekly
+		GeoIP struct {
+			// Look up client addresses (default: false)
+			Enabled bool `yaml:"enabled"`
+			// Directory of the MMDB files (default: {security_dir}/geoip)
+			Dir string `yaml:"dir"`
+			// Where the databases are downloaded from: ip-location-db or maxmind (default: ip-location-db)
+			Source string `yaml:"source"`
+			// MaxMind account, for source: maxmind
+			MaxMind struct {
+				AccountID  string `yaml:"account_id"`
+				LicenseKey string `yaml:"license_key"`
+				// Edition IDs (default: GeoLite2-Country, GeoLite2-ASN)
+				CountryEdition string `yaml:"country_edition"`
+				ASNEdition     string `yaml:"asn_edition"`
+			} `yaml:"maxmind"`
+			// Restrict every request but paste creation (reading pastes, the
+			// web interface, the API) by country or network
+			Viewing struct {
+				// Country codes (ISO 3166-1 alpha-2) that may not view
+				DenyCountries []string `yaml:"deny_countries"`
+				// When set, only these countries may view
+				AllowCountries []string `yaml:"allow_countries"`
+				// AS numbers that may not view
+				DenyASNs []uint `yaml:"deny_asns"`
+				// Usernames allowed from anywhere, "user:{id}" for API tokens;
+				// "*" = every signed-in user
+				ExemptUsers []string `yaml:"exempt_users"`
+				// Status of refusals: 451 or 403 (default: 451)
+				Status int `yaml:"status"`
+			} `yaml:"viewing"`
+			// Restrict paste creation (not reading) by country or network
+			Creation struct {
+				// Country codes (ISO 3166-1 alpha-2) that may not create pastes
+				DenyCountries []string `yaml:"deny_countries"`
+				// When set, only these countries may create pastes
+				AllowCountries []string `yaml:"allow_countries"`
+				// AS numbers that may not create pastes
+				DenyASNs []uint `yaml:"deny_asns"`
+				// Usernames allowed from anywhere, "user:{id}" for API tokens;
+				// "*" = every signed-in user
+				ExemptUsers []string `yaml:"exempt_users"`
+				// Status of refusals: 451 or 403 (default: 451)
+				Status int `yaml:"status"`
+			} `yaml:"creation"`
+		} `yaml:"geoip"`
+
+		// How often to check this file for changes, e.g. a ConfigMap update (default: 10s, off = only on SIGHUP)
+		ConfigReload string `yaml:"config_reload"`
 	} `yaml:"server"`
 
 	Database struct {
@@ -86,12 +263,259 @@ type YAMLConfig struct {
 		MaxIdleConns int `yaml:"max_idle_conns"`
 		// Cleanup interval (e.g. "1m", "5m")
 		CleanupPeriod string `yaml:"cleanup_period"`
+
+		// How paste bodies are stored: inline in the row, compressed in the
+		// row, or in the blob store ({data_dir}/blobs); sizes in bytes, 0 = never
+		Bodies struct {
+			// zstd, gzip or off; bodies already compressed are still read
+			// when this changes (default: zstd)
+			Compression string `yaml:"compression"`
+			// Compress bodies at least this big (default: 4096)
+			CompressMinSize int `yaml:"compress_min_size"`
+			// Keep a compressed body only if it is this many percent smaller (default: 20)
+			CompressMinSavings int `yaml:"compress_min_savings"`
+			// Move bodies at least this big to the blob store (default: 1048576)
+			BlobMinSize int `yaml:"blob_min_size"`
+			// Stop compressing text or file pastes while they are not saving
+			// compress_min_savings, retrying now and then (default: true)
+			Adaptive bool `yaml:"adaptive"`
+			// Largest body accepted by the streaming upload endpoint, which
+			// writes straight to the blob store; 0 = endpoint off (default: 1073741824)
+			StreamMaxSize int64 `yaml:"stream_max_size"`
+		} `yaml:"bodies"`
+
+		// In-memory cache of recently fetched pastes, least recently used out
+		Cache struct {
+			// Cache pastes (default: true)
+			Enabled bool `yaml:"enabled"`
+			// Most pastes kept (default: 1000)
+			MaxItems int `yaml:"max_items"`
+			// Most bytes kept (default: 67108864 = 64 MB)
+			MaxMemory int64 `yaml:"max_memory"`
+			// Bigger pastes are read from the database every time (default: 1048576)
+			MaxPasteSize int `yaml:"max_paste_size"`
+			// How long a paste is served before it is read again; bounds how
+			// stale an edit made on another replica can be (default: 1m, 0 = no limit)
+			TTL string `yaml:"ttl"`
+			// memory, or redis to share cached pastes and rate limit counters
+			// between replicas; in-process state is used while Redis is
+			// unreachable (default: memory)
+			Driver string `yaml:"driver"`
+			Redis  struct {
+				// host:port or redis://[:password@]host:port[/db], rediss:// for TLS
+				Address string `yaml:"address"`
+				// Password, if not in the address
+				Password string `yaml:"password"`
+				// Database number, if not in the address (default: 0)
+				DB int `yaml:"db"`
+			} `yaml:"redis"`
+		} `yaml:"cache"`
+
+		// Circuit breaker: the database is checked now and then, and while
+		// it does not answer, cached pastes are served read-only and
+		// everything else fails at once with 503 instead of timing out
+		Breaker struct {
+			// Check the database (default: true)
+			Enabled bool `yaml:"enabled"`
+			// How often the database is checked (default: 5s)
+			Interval string `yaml:"interval"`
+			// Longest a check may take (default: 2s)
+			Timeout string `yaml:"timeout"`
+			// Failed checks in a row that open the circuit (default: 2)
+			Failures int `yaml:"failures"`
+		} `yaml:"breaker"`
+
+		// Garbage collector: removes rows of deleted pastes, users and orgs,
+		// expired sessions, old domain audit rows and unused blobs
+		GC struct {
+			// Run the collector (default: true)
+			Enabled bool `yaml:"enabled"`
+			// Cron schedule (default: @daily)
+			Schedule string `yaml:"schedule"`
+			// Keep domain audit rows this long (default: 90d, 0 = forever)
+			AuditRetention string `yaml:"audit_retention"`
+		} `yaml:"gc"`
 	} `yaml:"database"`
 
+	// Automatic backups, taken by the leader on a schedule
+	Backup struct {
+		// Run the backup job (default: false)
+		Enabled bool `yaml:"enabled"`
+		// Cron schedule (default: @daily)
+		Schedule string `yaml:"schedule"`
+		// Scheduled archives kept, locally and remotely (default: 7)
+		Retention int `yaml:"retention"`
+		// Backup directory, also used by --maintenance backup (default: per
+		// platform; --backup and CASPASTE_BACKUP_DIR take precedence)
+		Dir string `yaml:"dir"`
+		// Optional S3-compatible bucket each archive is uploaded to
+		S3 struct {
+			Endpoint  string `yaml:"endpoint"`
+			Region    string `yaml:"region"`
+			Bucket    string `yaml:"bucket"`
+			Prefix    string `yaml:"prefix"`
+			AccessKey string `yaml:"access_key"`
+			SecretKey string `yaml:"secret_key"`
+		} `yaml:"s3"`
+		// Optional SFTP server each archive is uploaded to
+		SFTP struct {
+			Host     string `yaml:"host"`
+			Port     int    `yaml:"port"`
+			User     string `yaml:"user"`
+			Password string `yaml:"password"`
+			// Private key file (no passphrase)
+			KeyFile string `yaml:"key_file"`
+			// known_hosts file with the server's key (required)
+			KnownHosts string `yaml:"known_hosts"`
+			// Remote directory (default: the login directory)
+			Dir string `yaml:"dir"`
+		} `yaml:"sftp"`
+	} `yaml:"backup"`
+
+	Network struct {
+		// Turn off the features that reach the internet: public IP
+		// discovery, update checks, ACME, telemetry, the directory and
+		// GeoIP downloads; email and backup uploads still go to the
+		// configured hosts (default: false)
+		Offline bool `yaml:"offline"`
+
+		// Connections the server makes: public IP lookup, ACME, the
+		// updater, email, backup uploads, the directory and telemetry
+		Outbound struct {
+			// Proxy URL: http, https, socks5 or socks5h; "none" connects
+			// directly (default: HTTPS_PROXY/HTTP_PROXY from the environment)
+			Proxy string `yaml:"proxy"`
+			// Comma-separated hosts, domains and CIDRs reached directly, as
+			// in NO_PROXY (default: NO_PROXY from the environment)
+			NoProxy string `yaml:"no_proxy"`
+			// PEM file of CA certificates trusted besides the system ones
+			CAFile string `yaml:"ca_file"`
+		} `yaml:"outbound"`
+	} `yaml:"network"`
+
 	Security struct {
 		// Path to password file (auto-generated when server.public=false)
 		PasswordFile string `yaml:"password_file"`
 
+		// Argon2id password hashing per AI.md PART 11
+		// Existing hashes are upgraded transparently on next successful login
+		PasswordHashing struct {
+			// Iterations (default: 3, minimum: 2)
+			Time uint32 `yaml:"time"`
+			// Memory in KB (default: 65536 = 64 MB, minimum: 19456)
+			Memory uint32 `yaml:"memory"`
+			// Parallelism (default: 4)
+			Threads uint8 `yaml:"threads"`
+		} `yaml:"password_hashing"`
+
+		// Master key for encrypting secrets at rest (TOTP secrets, SSL credentials)
+		// Priority: command > env > file
+		MasterKey struct {
+			// Keyring file (default: {config_dir}/master.key, created if missing)
+			File string `yaml:"file"`
+			// Environment variable holding the key (default: CASPASTE_MASTER_KEY)
+			Env string `yaml:"env"`
+			// Command that prints the key, e.g. a KMS CLI (default: empty)
+			Command string `yaml:"command"`
+		} `yaml:"master_key"`
+
+		// WORM (write-once) compliance mode: pastes cannot be edited or deleted
+		// before expiry; admins can still place legal holds and legal deletes
+		WORM bool `yaml:"worm"`
+
+		// Strict crypto: TLS, SSH and new password hashes use FIPS-approved
+		// algorithms only; always on in a fips build (default: false)
+		FIPS bool `yaml:"fips"`
+
+		// Redaction masks IPs, emails and tokens in new pastes before storage
+		Redaction struct {
+			// Redact every new paste (default: false)
+			Enabled bool `yaml:"enabled"`
+			// Let clients choose per paste with redact=true/false (default: true)
+			AllowOverride bool `yaml:"allow_override"`
+			// Builtin rules: private_key, jwt, bearer_token, aws_access_key, github_token,
+			// slack_token, email, ipv4, ipv6 (default: all)
+			Builtins []string `yaml:"builtins"`
+			// Custom rules: [{name, regex, replacement}]
+			Patterns []redact.Pattern `yaml:"patterns"`
+			// Replacement text; {name} is the rule name (default: [REDACTED:{name}])
+			Replacement string `yaml:"replacement"`
+		} `yaml:"redaction"`
+
+		// IP reputation scores clients from DNS blocklists and an
+		// AbuseIPDB-style API; scores are recorded in audit events
+		Reputation struct {
+			// Score client IPs (default: false)
+			Enabled bool `yaml:"enabled"`
+			// DNSBL zones, e.g. zen.spamhaus.org; a listing scores 100
+			DNSBL []string `yaml:"dnsbl"`
+			// AbuseIPDB-style check endpoint (default: AbuseIPDB)
+			APIURL string `yaml:"api_url"`
+			// API key; empty = no API lookups
+			APIKey string `yaml:"api_key"`
+			// Score (1-100) from which an IP gets stricter rate limits (default: 50)
+			Threshold int `yaml:"threshold"`
+			// Rate limits of those IPs are divided by this (default: 4)
+			LimitDivisor uint `yaml:"limit_divisor"`
+			// Score from which writes are refused with 403; 0 = never (default: 0)
+			BlockThreshold int `yaml:"block_threshold"`
+			// How long scores are kept (default: 1h)
+			CacheTTL string `yaml:"cache_ttl"`
+			// Bound on the lookups of one IP (default: 2s)
+			Timeout string `yaml:"timeout"`
+		} `yaml:"reputation"`
+
+		// Firewall bans addresses and networks from the whole server; bans
+		// are kept in the database and managed in the admin panel
+		Firewall struct {
+			// How often bans added on other replicas are loaded (default: 30s)
+			Refresh string `yaml:"refresh"`
+			// Ban addresses that keep hitting the rate limits
+			AutoBan struct {
+				// Ban automatically (default: true)
+				Enabled bool `yaml:"enabled"`
+				// Rate limited requests within window that get an address banned (default: 20)
+				Violations int `yaml:"violations"`
+				// Period the violations are counted in (default: 10m)
+				Window string `yaml:"window"`
+				// How long the ban lasts (default: 1h)
+				Duration string `yaml:"duration"`
+			} `yaml:"auto_ban"`
+		} `yaml:"firewall"`
+
+		// Spam filter scans new and edited pastes; a paste that matches is
+		// held, frozen, for an admin to review instead of being published
+		Spam struct {
+			// Scan pastes (default: false)
+			Enabled bool `yaml:"enabled"`
+			// Words and phrases, matched case-insensitively
+			Keywords []string `yaml:"keywords"`
+			// Regular expressions (RE2 syntax)
+			Patterns []string `yaml:"patterns"`
+			// Hold every paste from an address security.reputation rates bad (default: false)
+			BadReputation bool `yaml:"bad_reputation"`
+			// Hold lists of logins and passwords, keys or tokens
+			CredentialDumps struct {
+				// Look for dumps (default: true)
+				Enabled bool `yaml:"enabled"`
+				// Credential lines that make a dump (default: 20)
+				MinLines int `yaml:"min_lines"`
+				// Shortest lone token counted as a secret (default: 20)
+				MinLength int `yaml:"min_length"`
+				// Bits per character from which a lone token looks random (default: 4.0)
+				Entropy float64 `yaml:"entropy"`
+			} `yaml:"credential_dumps"`
+			// Look up links in Google Safe Browsing
+			SafeBrowsing struct {
+				// API key; empty = no lookups
+				APIKey string `yaml:"api_key"`
+				// Lookup API endpoint (default: Google's v4 API)
+				APIURL string `yaml:"api_url"`
+				// Bound on one lookup; a failed lookup publishes the paste (default: 5s)
+				Timeout string `yaml:"timeout"`
+			} `yaml:"safe_browsing"`
+		} `yaml:"spam"`
+
 		Headers struct {
 			// X-Frame-Options header
 			XFrameOptions string `yaml:"x_frame_options"`
@@ -107,6 +531,14 @@ type YAMLConfig struct {
 			PermissionsPolicy string `yaml:"permissions_policy"`
 			// Strict-Transport-Security header
 			StrictTransportSecurity string `yaml:"strict_transport_security"`
+			// Send the CSP as Content-Security-Policy-Report-Only: violations
+			// are reported but nothing is blocked
+			CSPReportOnly bool `yaml:"csp_report_only"`
+			// Stop browsers sending violations to /csp-report for the admin panel
+			DisableCSPReports bool `yaml:"disable_csp_reports"`
+			// Overrides for some paths, first match wins; unset uses
+			// DefaultHeaderPaths, [] none
+			Paths []HeaderPath `yaml:"paths"`
 		} `yaml:"headers"`
 
 		TLS struct {
@@ -165,6 +597,8 @@ type YAMLConfig struct {
 			DefaultTheme string `yaml:"default_theme"`
 			// Themes directory (default: {data_dir}/web/themes)
 			ThemesDir string `yaml:"themes_dir"`
+			// Show related public pastes (same author or syntax) on paste pages
+			RelatedPastes bool `yaml:"related_pastes"`
 		} `yaml:"ui"`
 
 		Content struct {
@@ -183,6 +617,10 @@ type YAMLConfig struct {
 			Logo string `yaml:"logo"`
 			// Favicon path or URL (e.g. "/static/favicon.ico" or "https://example.com/favicon.ico")
 			Favicon string `yaml:"favicon"`
+			// Colors override the theme (hex, empty = theme color)
+			Colors BrandColors `yaml:"colors"`
+			// Extra footer links (label and http(s) URL or site path)
+			FooterLinks []FooterLink `yaml:"footer_links"`
 		} `yaml:"branding"`
 
 		Security struct {
@@ -203,7 +641,15 @@ type YAMLConfig struct {
 				Agents struct {
 					// User agents to deny
 					Deny []string `yaml:"deny"`
+					// Named AI crawler presets to deny (openai, anthropic, commoncrawl, ..., or all)
+					Presets []string `yaml:"presets"`
+					// Reject denied agents with 403 instead of relying on robots.txt alone
+					Enforce bool `yaml:"enforce"`
 				} `yaml:"agents"`
+				// X-Robots-Tag header sent on paste pages (e.g. "noindex, nofollow")
+				XRobotsTag string `yaml:"x_robots_tag"`
+				// Mark every paste noindex regardless of x_robots_tag
+				NoindexPastes bool `yaml:"noindex_pastes"`
 			} `yaml:"robots"`
 		} `yaml:"seo"`
 	} `yaml:"web"`
@@ -215,28 +661,97 @@ type YAMLConfig struct {
 		BodyMaxLength int `yaml:"body_max_length"`
 		// Max paste lifetime (e.g. "30d", "never")
 		MaxPasteLifetime string `yaml:"max_paste_lifetime"`
+		// Usernames nobody can register, on top of the built-in list
+		ReservedSlugs []string `yaml:"reserved_slugs"`
 
 		RateLimit struct {
-			GetPastes struct {
-				// GET requests per 5 minutes
-				Per5Min uint `yaml:"per_5min"`
-				// GET requests per 15 minutes
-				Per15Min uint `yaml:"per_15min"`
-				// GET requests per 1 hour
-				Per1Hour uint `yaml:"per_1hour"`
-			} `yaml:"get_pastes"`
-
-			NewPastes struct {
-				// POST requests per 5 minutes
-				Per5Min uint `yaml:"per_5min"`
-				// POST requests per 15 minutes
-				Per15Min uint `yaml:"per_15min"`
-				// POST requests per 1 hour
-				Per1Hour uint `yaml:"per_1hour"`
-			} `yaml:"new_pastes"`
+			// Reading pastes
+			GetPastes RateLimitWindows `yaml:"get_pastes"`
+			// Creating and editing pastes
+			NewPastes RateLimitWindows `yaml:"new_pastes"`
+			// Login, registration and password reset submissions
+			Auth RateLimitWindows `yaml:"auth"`
+			// Admin panel and admin API
+			Admin RateLimitWindows `yaml:"admin"`
+
+			// IPs or networks not rate limited
+			Exempt []netshare.RateLimitRule `yaml:"exempt"`
+			// IPs or networks refused on rate limited routes
+			Ban []netshare.RateLimitRule `yaml:"ban"`
 		} `yaml:"rate_limit"`
 	} `yaml:"limits"`
 
+	Users struct {
+		// Database-backed accounts with sign-in and the user pages (default: false)
+		Enabled bool `yaml:"enabled"`
+
+		Auth struct {
+			JWT struct {
+				// Issue a JWT on sign-in and accept it on the API (default: false)
+				Enabled bool `yaml:"enabled"`
+				// Signing keys shared by every replica (default: {config_dir}/jwt.keys, created if missing)
+				KeyFile string `yaml:"key_file"`
+				// Environment variable holding a fixed secret of 32 bytes or more; when set,
+				// it replaces key_file and keys are not rotated (default: CASPASTE_JWT_SECRET)
+				SecretEnv string `yaml:"secret_env"`
+				// Token lifetime; a JWT cannot be revoked, so keep it short (default: 15m)
+				TTL string `yaml:"ttl"`
+				// Rotate the signing key after this many days, 0 = never; must be 0 when the
+				// secret_env variable is set (default: 30)
+				RotateDays int `yaml:"rotate_days"`
+				// iss claim (default: the server FQDN)
+				Issuer string `yaml:"issuer"`
+			} `yaml:"jwt"`
+		} `yaml:"auth"`
+
+		OAuth struct {
+			// Let users register applications that act on their pastes (default: false)
+			Enabled bool `yaml:"enabled"`
+			// Allow clients without a secret; they must use PKCE (default: true)
+			AllowPublicClients bool `yaml:"allow_public_clients"`
+			// Access token lifetime (default: 1h)
+			AccessTokenTTL string `yaml:"access_token_ttl"`
+			// Refresh token lifetime (default: 30d)
+			RefreshTokenTTL string `yaml:"refresh_token_ttl"`
+		} `yaml:"oauth"`
+	} `yaml:"users"`
+
+	Features struct {
+		Organizations struct {
+			// Let users create organizations (default: false)
+			Enabled bool `yaml:"enabled"`
+			// Slugs nobody can use, including look-alikes such as paypa1 (default: admin, api, caspaste, ...)
+			ReservedSlugs []string `yaml:"reserved_slugs"`
+			// File of more reserved slugs, one per line (default: none)
+			BlocklistFile string `yaml:"blocklist_file"`
+		} `yaml:"organizations"`
+
+		CustomDomains struct {
+			// Let users and organizations serve their pastes on their own domains (default: false)
+			Enabled bool `yaml:"enabled"`
+			// Domains per user, 0 = unlimited (default: 5)
+			MaxDomainsPerUser int `yaml:"max_domains_per_user"`
+			// Domains per organization, 0 = unlimited (default: 20)
+			MaxDomainsPerOrg int `yaml:"max_domains_per_org"`
+			// Require SSL on every custom domain (default: true)
+			RequireSSL bool `yaml:"require_ssl"`
+			// Allow apex domains such as example.com (default: true)
+			AllowApex bool `yaml:"allow_apex"`
+			// Allow subdomains such as paste.example.com (default: true)
+			AllowSubdomain bool `yaml:"allow_subdomain"`
+			// Allow wildcard domains such as *.example.com (default: false)
+			AllowWildcard bool `yaml:"allow_wildcard"`
+			// Lifetime of a verification token (default: 24h)
+			VerificationTTL string `yaml:"verification_ttl"`
+			// Renew certificates this many days before they expire (default: 7)
+			SSLRenewalDays int `yaml:"ssl_renewal_days"`
+			// Domains nobody can add; *.x covers every domain under x (default: localhost, *.local, *.test, *.example, *.invalid)
+			Reserved []string `yaml:"reserved"`
+			// File of reserved words; domain labels matching them or their look-alikes are refused (default: none)
+			BlocklistFile string `yaml:"blocklist_file"`
+		} `yaml:"custom_domains"`
+	} `yaml:"features"`
+
 	Directories struct {
 		// Data directory
 		Data string `yaml:"data"`
@@ -329,13 +844,37 @@ func LoadYAMLConfig(path string) (*YAMLConfig, error) {
 }
 
 // SaveYAMLConfig saves configuration to YAML file
+// The file is replaced in one step, so the config watcher and a crash
+// never see it half written
 func SaveYAMLConfig(path string, cfg *YAMLConfig) error {
 	data, err := yaml.Marshal(cfg)
 	if err != nil {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
 
-	err = os.WriteFile(path, data, 0644)
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), mode)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to write config file: %w", err)
 	}
@@ -357,6 +896,12 @@ func ResolvePlaceholders(cfg *YAMLConfig, fqdn, dataDir, configDir string) {
 	// Server section
 	cfg.Server.Administrator.Email = replace(cfg.Server.Administrator.Email)
 	cfg.Server.Administrator.From = replace(cfg.Server.Administrator.From)
+	cfg.Server.Abuse.Email = replace(cfg.Server.Abuse.Email)
+	cfg.Server.Mirror.Dir = replace(cfg.Server.Mirror.Dir)
+	cfg.Backup.Dir = replace(cfg.Backup.Dir)
+	cfg.Backup.SFTP.KeyFile = replace(cfg.Backup.SFTP.KeyFile)
+	cfg.Backup.SFTP.KnownHosts = replace(cfg.Backup.SFTP.KnownHosts)
+	cfg.Network.Outbound.CAFile = replace(cfg.Network.Outbound.CAFile)
 
 	// Web section
 	cfg.Web.UI.ThemesDir = replace(cfg.Web.UI.ThemesDir)
@@ -370,6 +915,10 @@ func ResolvePlaceholders(cfg *YAMLConfig, fqdn, dataDir, configDir string) {
 
 	// Security section
 	cfg.Security.PasswordFile = replace(cfg.Security.PasswordFile)
+	cfg.Security.MasterKey.File = replace(cfg.Security.MasterKey.File)
+	cfg.Users.Auth.JWT.KeyFile = replace(cfg.Users.Auth.JWT.KeyFile)
+	cfg.Features.Organizations.BlocklistFile = replace(cfg.Features.Organizations.BlocklistFile)
+	cfg.Features.CustomDomains.BlocklistFile = replace(cfg.Features.CustomDomains.BlocklistFile)
 	cfg.Security.TLS.CertFile = replace(cfg.Security.TLS.CertFile)
 	cfg.Security.TLS.KeyFile = replace(cfg.Security.TLS.KeyFile)
 
@@ -380,6 +929,9 @@ func ResolvePlaceholders(cfg *YAMLConfig, fqdn, dataDir, configDir string) {
 	if cfg.Web.UI.ThemesDir == "" {
 		cfg.Web.UI.ThemesDir = dataDir + "/web/themes"
 	}
+	if cfg.Server.Mirror.Dir == "" {
+		cfg.Server.Mirror.Dir = dataDir + "/mirror"
+	}
 }
 
 // GetDefaultPrivateProxies returns the default trusted proxy CIDR ranges
@@ -405,6 +957,21 @@ func GetAllTrustedProxies(cfg *YAMLConfig) []string {
 
 // GenerateDefaultYAMLConfig generates a default configuration file with sane defaults
 func GenerateDefaultYAMLConfig(path string) error {
+	data, err := yaml.Marshal(DefaultYAMLConfig())
+	if err != nil {
+		return fmt.Errorf("failed to marshal default config: %w", err)
+	}
+
+	err = os.WriteFile(path, data, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write default config: %w", err)
+	}
+
+	return nil
+}
+
+// DefaultYAMLConfig returns the default configuration without writing it
+func DefaultYAMLConfig() *YAMLConfig {
 	defaultConfig := YAMLConfig{}
 
 	// ============================================================================
@@ -414,9 +981,11 @@ func GenerateDefaultYAMLConfig(path string) error {
 	defaultConfig.Server.FQDN = ""      // Empty = auto-detect from X-Forwarded-Host (trusted proxies) or hostname; Set to override
 	defaultConfig.Server.Listen = "all" // Listen on all interfaces (IPv4 + IPv6)
 	defaultConfig.Server.Port = ""      // Empty = auto-detect available port at runtime
+	defaultConfig.Server.Listeners = []Listener{}
 	defaultConfig.Server.Title = "CasPaste"
 	defaultConfig.Server.TagLine = "A simple paste service"
 	defaultConfig.Server.Description = "CasPaste is a simple, fast, and secure paste service for sharing code snippets and text"
+	defaultConfig.Server.Registration = RegistrationPublic
 
 	// Additional trusted proxy IPs/CIDRs to append to default private ranges
 	// Default private ranges (always trusted): 10.0.0.0/8, 172.16.0.0/12, 192.168.0.0/16, 127.0.0.0/8, ::1, fc00::/7, fe80::/10
@@ -426,6 +995,8 @@ func GenerateDefaultYAMLConfig(path string) error {
 	defaultConfig.Server.Administrator.Name = "CasPaste Administrator"
 	defaultConfig.Server.Administrator.Email = "administrator@{fqdn}"
 	defaultConfig.Server.Administrator.From = "\"CasPaste\" <no-reply@{fqdn}>"
+	defaultConfig.Server.SMTP.Port = 587
+	defaultConfig.Server.SMTP.TLS = "auto"
 	
 	defaultConfig.Server.Timeouts.Read = 15
 	defaultConfig.Server.Timeouts.Write = 15
@@ -437,9 +1008,63 @@ func GenerateDefaultYAMLConfig(path string) error {
 	defaultConfig.Server.Metrics.IncludeSystem = true
 	defaultConfig.Server.Metrics.IncludeRuntime = true
 	defaultConfig.Server.Metrics.Token = "" // Empty = no auth (use firewall instead)
+	defaultConfig.Server.Metrics.AllowedIPs = []string{} // Empty = any source
 	defaultConfig.Server.Metrics.DurationBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
 	defaultConfig.Server.Metrics.SizeBuckets = []float64{100, 1000, 10000, 100000, 1000000, 10000000}
 
+	// DNS upstreams (empty = system resolver)
+	defaultConfig.Server.DNS.Servers = []string{}
+	defaultConfig.Server.DNS.DoH = []string{}
+	defaultConfig.Server.DNS.Timeout = 5
+	defaultConfig.Server.GeoIP.Enabled = false
+	defaultConfig.Server.GeoIP.Creation.DenyCountries = []string{}
+	defaultConfig.Server.GeoIP.Creation.AllowCountries = []string{}
+	defaultConfig.Server.GeoIP.Creation.DenyASNs = []uint{}
+	defaultConfig.Server.GeoIP.Creation.ExemptUsers = []string{}
+	defaultConfig.Server.GeoIP.Creation.Status = 451
+	defaultConfig.Server.GeoIP.Source = "ip-location-db"
+	defaultConfig.Server.GeoIP.MaxMind.CountryEdition = "GeoLite2-Country"
+	defaultConfig.Server.GeoIP.MaxMind.ASNEdition = "GeoLite2-ASN"
+	defaultConfig.Server.GeoIP.Viewing.DenyCountries = []string{}
+	defaultConfig.Server.GeoIP.Viewing.AllowCountries = []string{}
+	defaultConfig.Server.GeoIP.Viewing.DenyASNs = []uint{}
+	defaultConfig.Server.GeoIP.Viewing.ExemptUsers = []string{}
+	defaultConfig.Server.GeoIP.Viewing.Status = 451
+
+	// Public IP discovery (set static IPs or disable_discovery to avoid third-party lookups)
+	defaultConfig.Server.PublicIP.Static = []string{}
+	defaultConfig.Server.PublicIP.DisableDiscovery = false
+	defaultConfig.Server.PublicIP.STUN = []string{}
+	defaultConfig.Server.PublicIP.Services = []string{
+		"https://api.ipify.org",
+		"https://icanhazip.com",
+		"https://ifconfig.me/ip",
+	}
+
+	// Static mirror (bucket is optional; leave endpoint empty for a local directory only)
+	defaultConfig.Server.Mirror.Enabled = false
+	defaultConfig.Server.Mirror.Schedule = "0 * * * *"
+	defaultConfig.Server.Mirror.Dir = "" // Empty = {data_dir}/mirror
+	defaultConfig.Server.Mirror.S3.Region = "us-east-1"
+
+	// Leader election for background jobs (auto = database lease when postgres/mysql is shared)
+	defaultConfig.Server.Cluster.LeaderElection = "auto"
+	defaultConfig.Server.Cluster.LeaseName = "caspaste"
+	defaultConfig.Server.Cluster.LeaseDuration = "15s"
+	defaultConfig.Server.Cluster.Namespace = "" // Empty = the pod's namespace
+	defaultConfig.Server.Dispatch.Workers = 4
+	defaultConfig.Server.Dispatch.Queue = 100
+	defaultConfig.Server.Dispatch.FailureThreshold = 5
+	defaultConfig.Server.Dispatch.Cooldown = "1m"
+	defaultConfig.Server.Dispatch.Timeout = "30s"
+	defaultConfig.Server.Telemetry.Enabled = false // Opt-in only
+	defaultConfig.Server.Telemetry.Endpoint = ""
+	defaultConfig.Server.Telemetry.Schedule = "@weekly"
+	defaultConfig.Server.Directory.URL = ""
+	defaultConfig.Server.Directory.Register = false // Opt-in only
+	defaultConfig.Server.Directory.Schedule = "@daily"
+	defaultConfig.Server.ConfigReload = "10s"
+
 	// ============================================================================
 	// DATABASE CONFIGURATION
 	// ============================================================================
@@ -450,11 +1075,70 @@ func GenerateDefaultYAMLConfig(path string) error {
 	defaultConfig.Database.MaxOpenConns = 25
 	defaultConfig.Database.MaxIdleConns = 5
 	defaultConfig.Database.CleanupPeriod = "1m"
+	defaultConfig.Database.Bodies.Compression = "zstd"
+	defaultConfig.Database.Bodies.CompressMinSize = 4096
+	defaultConfig.Database.Bodies.CompressMinSavings = 20
+	defaultConfig.Database.Bodies.BlobMinSize = 1 << 20
+	defaultConfig.Database.Bodies.Adaptive = true
+	defaultConfig.Database.Bodies.StreamMaxSize = 1 << 30
+	defaultConfig.Database.Cache.Enabled = true
+	defaultConfig.Database.Cache.MaxItems = 1000
+	defaultConfig.Database.Cache.MaxMemory = 64 << 20
+	defaultConfig.Database.Cache.MaxPasteSize = 1 << 20
+	defaultConfig.Database.Cache.TTL = "1m"
+	defaultConfig.Database.Cache.Driver = "memory"
+	defaultConfig.Database.Cache.Redis.Address = "localhost:6379"
+	defaultConfig.Database.Breaker.Enabled = true
+	defaultConfig.Database.Breaker.Interval = "5s"
+	defaultConfig.Database.Breaker.Timeout = "2s"
+	defaultConfig.Database.Breaker.Failures = 2
+	defaultConfig.Database.GC.Enabled = true
+	defaultConfig.Database.GC.Schedule = "@daily"
+	defaultConfig.Database.GC.AuditRetention = "90d"
+
+	// Automatic backups (uploads are optional; leave endpoint and host empty for local archives only)
+	defaultConfig.Backup.Enabled = false
+	defaultConfig.Backup.Schedule = "@daily"
+	defaultConfig.Backup.Retention = 7
+	defaultConfig.Backup.Dir = "" // Empty = platform default
+	defaultConfig.Backup.S3.Region = "us-east-1"
+	defaultConfig.Backup.SFTP.Port = 22
 
 	// ============================================================================
 	// SECURITY CONFIGURATION
 	// ============================================================================
 	defaultConfig.Security.PasswordFile = "" // Empty = auto-generate when server.public=false
+	defaultConfig.Security.PasswordHashing.Time = 3
+	defaultConfig.Security.PasswordHashing.Memory = 64 * 1024
+	defaultConfig.Security.PasswordHashing.Threads = 4
+	defaultConfig.Security.MasterKey.File = ""
+	defaultConfig.Security.MasterKey.Env = "CASPASTE_MASTER_KEY"
+	defaultConfig.Security.MasterKey.Command = ""
+	defaultConfig.Security.WORM = false
+	defaultConfig.Security.Redaction.Enabled = false
+	defaultConfig.Security.Redaction.AllowOverride = true
+	defaultConfig.Security.Redaction.Builtins = redact.DefaultBuiltins
+	defaultConfig.Security.Redaction.Replacement = redact.DefaultReplacement
+	defaultConfig.Security.Reputation.Enabled = false
+	defaultConfig.Security.Reputation.DNSBL = []string{}
+	defaultConfig.Security.Reputation.Threshold = 50
+	defaultConfig.Security.Reputation.LimitDivisor = 4
+	defaultConfig.Security.Reputation.CacheTTL = "1h"
+	defaultConfig.Security.Reputation.Timeout = "2s"
+	defaultConfig.Security.Firewall.Refresh = "30s"
+	defaultConfig.Security.Firewall.AutoBan.Enabled = true
+	defaultConfig.Security.Firewall.AutoBan.Violations = 20
+	defaultConfig.Security.Firewall.AutoBan.Window = "10m"
+	defaultConfig.Security.Firewall.AutoBan.Duration = "1h"
+	defaultConfig.Security.Spam.Enabled = false
+	defaultConfig.Security.Spam.Keywords = []string{}
+	defaultConfig.Security.Spam.Patterns = []string{}
+	defaultConfig.Security.Spam.BadReputation = false
+	defaultConfig.Security.Spam.CredentialDumps.Enabled = true
+	defaultConfig.Security.Spam.CredentialDumps.MinLines = 20
+	defaultConfig.Security.Spam.CredentialDumps.MinLength = 20
+	defaultConfig.Security.Spam.CredentialDumps.Entropy = 4.0
+	defaultConfig.Security.Spam.SafeBrowsing.Timeout = "5s"
 	
 	// HTTP Security Headers per AI.md PART 11
 	defaultConfig.Security.Headers.XFrameOptions = "SAMEORIGIN"
@@ -464,6 +1148,7 @@ func GenerateDefaultYAMLConfig(path string) error {
 	defaultConfig.Security.Headers.ReferrerPolicy = "strict-origin-when-cross-origin"
 	defaultConfig.Security.Headers.PermissionsPolicy = "geolocation=(), microphone=(), camera=()"
 	defaultConfig.Security.Headers.StrictTransportSecurity = "max-age=31536000; includeSubDomains"
+	defaultConfig.Security.Headers.Paths = DefaultHeaderPaths()
 	
 	// TLS Configuration
 	defaultConfig.Security.TLS.MinVersion = "1.2"
@@ -518,6 +1203,7 @@ func GenerateDefaultYAMLConfig(path string) error {
 	defaultConfig.Web.UI.DefaultLifetime = "never"
 	defaultConfig.Web.UI.DefaultTheme = "dark" // Accepts: "dark" (dracula), "light" (github), "auto", or full path like "dark/dracula"
 	defaultConfig.Web.UI.ThemesDir = ""        // Empty = {data_dir}/web/themes (resolved at runtime)
+	defaultConfig.Web.UI.RelatedPastes = true
 
 	// Content Pages - all empty = auto-generated from embedded defaults
 	// If set, paths are relative to {data_dir}/web/docs unless absolute
@@ -549,6 +1235,10 @@ func GenerateDefaultYAMLConfig(path string) error {
 		"FacebookBot",
 		"Diffbot",
 	}
+	defaultConfig.Web.SEO.Robots.Agents.Presets = []string{}
+	defaultConfig.Web.SEO.Robots.Agents.Enforce = false
+	defaultConfig.Web.SEO.Robots.XRobotsTag = ""
+	defaultConfig.Web.SEO.Robots.NoindexPastes = false
 
 	// ============================================================================
 	// LIMITS & RATE LIMITING
@@ -567,6 +1257,50 @@ func GenerateDefaultYAMLConfig(path string) error {
 	defaultConfig.Limits.RateLimit.NewPastes.Per15Min = 30
 	defaultConfig.Limits.RateLimit.NewPastes.Per1Hour = 40
 
+	// Rate limiting for login and registration submissions
+	defaultConfig.Limits.RateLimit.Auth.Per5Min = 10
+	defaultConfig.Limits.RateLimit.Auth.Per15Min = 20
+	defaultConfig.Limits.RateLimit.Auth.Per1Hour = 50
+
+	// Rate limiting for the admin panel and admin API
+	defaultConfig.Limits.RateLimit.Admin.Per5Min = 300
+	defaultConfig.Limits.RateLimit.Admin.Per15Min = 600
+	defaultConfig.Limits.RateLimit.Admin.Per1Hour = 1500
+
+	// ============================================================================
+	// USERS
+	// ============================================================================
+	defaultConfig.Users.Enabled = false
+	defaultConfig.Users.Auth.JWT.Enabled = false
+	defaultConfig.Users.Auth.JWT.KeyFile = ""
+	defaultConfig.Users.Auth.JWT.SecretEnv = "CASPASTE_JWT_SECRET"
+	defaultConfig.Users.Auth.JWT.TTL = "15m"
+	defaultConfig.Users.Auth.JWT.RotateDays = 30
+	defaultConfig.Users.Auth.JWT.Issuer = ""
+	defaultConfig.Users.OAuth.Enabled = false
+	defaultConfig.Users.OAuth.AllowPublicClients = true
+	defaultConfig.Users.OAuth.AccessTokenTTL = "1h"
+	defaultConfig.Users.OAuth.RefreshTokenTTL = "30d"
+
+	// ============================================================================
+	// FEATURES
+	// ============================================================================
+	features := DefaultFeaturesConfig()
+	defaultConfig.Features.Organizations.Enabled = false
+	defaultConfig.Features.Organizations.ReservedSlugs = features.Organizations.ReservedSlugs
+	defaultConfig.Features.Organizations.BlocklistFile = ""
+	defaultConfig.Features.CustomDomains.Enabled = false
+	defaultConfig.Features.CustomDomains.MaxDomainsPerUser = 5
+	defaultConfig.Features.CustomDomains.MaxDomainsPerOrg = 20
+	defaultConfig.Features.CustomDomains.RequireSSL = true
+	defaultConfig.Features.CustomDomains.AllowApex = true
+	defaultConfig.Features.CustomDomains.AllowSubdomain = true
+	defaultConfig.Features.CustomDomains.AllowWildcard = false
+	defaultConfig.Features.CustomDomains.VerificationTTL = "24h"
+	defaultConfig.Features.CustomDomains.SSLRenewalDays = 7
+	defaultConfig.Features.CustomDomains.Reserved = features.CustomDomains.Reserved
+	defaultConfig.Features.CustomDomains.BlocklistFile = ""
+
 	// ============================================================================
 	// DIRECTORIES
 	// ============================================================================
@@ -612,16 +1346,5 @@ func GenerateDefaultYAMLConfig(path string) error {
 	defaultConfig.Logging.Audit.MaskEmails = true
 	defaultConfig.Logging.Audit.IncludeUserAgent = true
 
-	// Write to file
-	data, err := yaml.Marshal(defaultConfig)
-	if err != nil {
-		return fmt.Errorf("failed to marshal default config: %w", err)
-	}
-
-	err = os.WriteFile(path, data, 0644)
-	if err != nil {
-		return fmt.Errorf("failed to write default config: %w", err)
-	}
-
-	return nil
+	return &defaultConfig
 }
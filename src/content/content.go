@@ -0,0 +1,98 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+// Package content holds the published about, rules and terms pages
+// The admin panel replaces a page and every handler sees it on the next request
+package content
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrUnknownPage = errors.New("content: unknown page")
+	ErrTooLarge    = errors.New("content: page is larger than 256 KB")
+	ErrReadOnly    = errors.New("content: the config is built from the environment, so a new content file cannot be recorded")
+)
+
+// MaxSize is the largest page the admin panel saves
+const MaxSize = 256 << 10
+
+// Page names
+const (
+	About = "about"
+	Rules = "rules"
+	Terms = "terms"
+)
+
+// Names lists the editable pages in display order
+var Names = []string{About, Rules, Terms}
+
+// Valid reports whether name is an editable page
+func Valid(name string) bool {
+	for _, n := range Names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// IsMarkdownPath reports whether a content file is rendered as markdown
+func IsMarkdownPath(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".md", ".markdown":
+		return true
+	}
+	return false
+}
+
+// Source is a page as stored, before template variables are replaced
+type Source struct {
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	Markdown bool   `json:"markdown"`
+	// Default is true when no file is configured and the built-in text is used
+	Default bool   `json:"default"`
+	Body    string `json:"body"`
+}
+
+// Page is a published page with template variables already replaced
+type Page struct {
+	Text     string
+	Markdown bool
+}
+
+// Set holds the published pages; it is safe for concurrent use
+type Set struct {
+	mu    sync.RWMutex
+	pages map[string]Page
+}
+
+// NewSet creates an empty set
+func NewSet() *Set {
+	return &Set{pages: make(map[string]Page)}
+}
+
+// Get returns a page; a missing page is empty
+func (s *Set) Get(name string) Page {
+	if s == nil {
+		return Page{}
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.pages[name]
+}
+
+// Put publishes a page
+func (s *Set) Put(name string, page Page) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pages[name] = page
+}
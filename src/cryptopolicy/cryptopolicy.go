@@ -0,0 +1,124 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+// Package cryptopolicy is the crypto policy of the process. By default any
+// algorithm the code uses is allowed; in strict mode TLS, SSH and password
+// hashing are limited to FIPS-approved algorithms
+// Strict mode is on when built with the fips tag, when the Go FIPS 140-3
+// module is enabled (GOFIPS140 or GODEBUG=fips140), or when SetStrict(true)
+// was called from the configuration
+package cryptopolicy
+
+import (
+	"crypto/fips140"
+	"crypto/tls"
+	"slices"
+	"sync/atomic"
+)
+
+// Where strict mode comes from
+const (
+	SourceBuildTag = "fips build tag"
+	SourceModule   = "Go FIPS 140-3 module"
+	SourceConfig   = "configuration"
+)
+
+// configured is strict mode turned on by SetStrict
+var configured atomic.Bool
+
+// SetStrict turns strict mode on or off for the configuration; it stays on
+// in a fips build or with the Go FIPS module enabled
+func SetStrict(on bool) {
+	configured.Store(on)
+}
+
+// Strict reports whether only FIPS-approved algorithms may be used
+func Strict() bool {
+	return buildTag || fips140.Enabled() || configured.Load()
+}
+
+// Sources lists why strict mode is on, empty when it is off
+func Sources() []string {
+	var sources []string
+	if buildTag {
+		sources = append(sources, SourceBuildTag)
+	}
+	if fips140.Enabled() {
+		sources = append(sources, SourceModule)
+	}
+	if configured.Load() {
+		sources = append(sources, SourceConfig)
+	}
+	return sources
+}
+
+// ModuleEnabled reports whether Go's FIPS 140-3 module is in use; without
+// it strict mode limits which algorithms are chosen, but the implementations
+// are not the validated ones
+func ModuleEnabled() bool {
+	return fips140.Enabled()
+}
+
+// TLSCipherSuites are the TLS 1.2 suites allowed in strict mode; TLS 1.3
+// suites are chosen by Go, which only offers AES-GCM with the module enabled
+var TLSCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+}
+
+// TLSCurves are the key exchange curves allowed in strict mode
+var TLSCurves = []tls.CurveID{tls.CurveP256, tls.CurveP384, tls.CurveP521}
+
+// ApplyTLS limits cfg to TLS 1.2 or later and the approved suites and
+// curves in strict mode, keeping the configured ones that are approved
+// It returns cfg, which is left alone outside strict mode
+func ApplyTLS(cfg *tls.Config) *tls.Config {
+	if cfg == nil || !Strict() {
+		return cfg
+	}
+	if cfg.MinVersion < tls.VersionTLS12 {
+		cfg.MinVersion = tls.VersionTLS12
+	}
+	cfg.CipherSuites = approved(cfg.CipherSuites, TLSCipherSuites)
+	cfg.CurvePreferences = approved(cfg.CurvePreferences, TLSCurves)
+	return cfg
+}
+
+// approved returns the configured values that are allowed, or all allowed
+// values when none of the configured ones are
+func approved[T comparable](configured, allowed []T) []T {
+	var out []T
+	for _, v := range configured {
+		if slices.Contains(allowed, v) {
+			out = append(out, v)
+		}
+	}
+	if len(out) == 0 {
+		return slices.Clone(allowed)
+	}
+	return out
+}
+
+// SSH algorithms allowed in strict mode, for backup uploads over SFTP
+var (
+	SSHKeyExchanges = []string{
+		"ecdh-sha2-nistp256", "ecdh-sha2-nistp384", "ecdh-sha2-nistp521",
+		"diffie-hellman-group14-sha256",
+	}
+	SSHCiphers = []string{
+		"aes128-gcm@openssh.com", "aes256-gcm@openssh.com",
+		"aes128-ctr", "aes192-ctr", "aes256-ctr",
+	}
+	SSHMACs = []string{
+		"hmac-sha2-256-etm@openssh.com", "hmac-sha2-512-etm@openssh.com",
+		"hmac-sha2-256", "hmac-sha2-512",
+	}
+	SSHHostKeyAlgorithms = []string{
+		"ecdsa-sha2-nistp256", "ecdsa-sha2-nistp384", "ecdsa-sha2-nistp521",
+		"ssh-ed25519", "rsa-sha2-256", "rsa-sha2-512",
+	}
+)
@@ -0,0 +1,12 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+//go:build fips
+// +build fips
+
+package cryptopolicy
+
+// buildTag is set by building with -tags fips
+const buildTag = true
@@ -0,0 +1,256 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+// Package csp collects the Content Security Policy violation reports that
+// browsers send, so admins can see what a policy blocks, or would block in
+// report-only mode, before enforcing it
+// Reports are kept in memory: the most recent ones, and a count per
+// directive, blocked resource and page
+package csp
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReportPath is where browsers send reports
+const ReportPath = "/csp-report"
+
+// EndpointName is the name the Reporting API knows ReportPath by
+const EndpointName = "csp-endpoint"
+
+// Limits on what is kept
+const (
+	// Largest report body read
+	maxBodySize = 64 << 10
+	// Distinct violations counted; later ones are only in the recent list
+	maxViolations = 500
+	// Longest value kept from a report
+	maxField = 512
+)
+
+// Dispositions of a report
+const (
+	DispositionEnforce = "enforce"
+	DispositionReport  = "report"
+)
+
+// Report is one violation
+type Report struct {
+	Time int64 `json:"time"`
+	// Page the violation happened on, without its query
+	DocumentURI string `json:"document_uri"`
+	Directive   string `json:"directive"`
+	// Resource that was blocked: a URL without its query, or a keyword
+	// such as inline or eval
+	BlockedURI string `json:"blocked_uri"`
+	SourceFile string `json:"source_file,omitempty"`
+	Line       int    `json:"line,omitempty"`
+	// DispositionEnforce when blocked, DispositionReport when only reported
+	Disposition string `json:"disposition"`
+}
+
+// Violation counts the reports of one directive, blocked resource and page
+type Violation struct {
+	Directive  string `json:"directive"`
+	BlockedURI string `json:"blocked_uri"`
+	Path       string `json:"path"`
+	Count      int64  `json:"count"`
+	LastSeen   int64  `json:"last_seen"`
+}
+
+// Collector keeps the reports sent to ReportPath
+type Collector struct {
+	mu         sync.Mutex
+	keep       int
+	recent     []Report
+	violations map[string]*Violation
+	total      int64
+}
+
+// NewCollector returns a collector that keeps the last keep reports
+func NewCollector(keep int) *Collector {
+	if keep <= 0 {
+		keep = 100
+	}
+	return &Collector{keep: keep, violations: make(map[string]*Violation)}
+}
+
+// Add records a report
+func (c *Collector) Add(r Report) {
+	if r.Time == 0 {
+		r.Time = time.Now().Unix()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.total++
+	c.recent = append(c.recent, r)
+	if len(c.recent) > c.keep {
+		c.recent = c.recent[len(c.recent)-c.keep:]
+	}
+
+	path := r.DocumentURI
+	if u, err := url.Parse(r.DocumentURI); err == nil && u.Path != "" {
+		path = u.Path
+	}
+	key := r.Directive + "\x00" + r.BlockedURI + "\x00" + path
+	v, ok := c.violations[key]
+	if !ok {
+		if len(c.violations) >= maxViolations {
+			return
+		}
+		v = &Violation{Directive: r.Directive, BlockedURI: r.BlockedURI, Path: path}
+		c.violations[key] = v
+	}
+	v.Count++
+	v.LastSeen = r.Time
+}
+
+// Recent returns the kept reports, newest first
+func (c *Collector) Recent() []Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]Report, len(c.recent))
+	for i, r := range c.recent {
+		out[len(out)-1-i] = r
+	}
+	return out
+}
+
+// Violations returns the counted violations, most reported first
+func (c *Collector) Violations() []Violation {
+	c.mu.Lock()
+	out := make([]Violation, 0, len(c.violations))
+	for _, v := range c.violations {
+		out = append(out, *v)
+	}
+	c.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].LastSeen > out[j].LastSeen
+	})
+	return out
+}
+
+// Total is the number of reports received since the start or the last Reset
+func (c *Collector) Total() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.total
+}
+
+// Reset forgets every report
+func (c *Collector) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.recent = nil
+	c.violations = make(map[string]*Violation)
+	c.total = 0
+}
+
+// ServeHTTP accepts reports in both formats browsers use: report-uri
+// (application/csp-report) and the Reporting API (application/reports+json)
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	reports, ok := parse(body)
+	if !ok {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	for _, report := range reports {
+		c.Add(report)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parse reads a report-uri report or a list of Reporting API reports
+func parse(body []byte) ([]Report, bool) {
+	var legacy struct {
+		Report *struct {
+			DocumentURI        string `json:"document-uri"`
+			ViolatedDirective  string `json:"violated-directive"`
+			EffectiveDirective string `json:"effective-directive"`
+			BlockedURI         string `json:"blocked-uri"`
+			SourceFile         string `json:"source-file"`
+			LineNumber         int    `json:"line-number"`
+			Disposition        string `json:"disposition"`
+		} `json:"csp-report"`
+	}
+	if err := json.Unmarshal(body, &legacy); err == nil && legacy.Report != nil {
+		lr := legacy.Report
+		directive := lr.EffectiveDirective
+		if directive == "" {
+			directive, _, _ = strings.Cut(lr.ViolatedDirective, " ")
+		}
+		return []Report{newReport(lr.DocumentURI, directive, lr.BlockedURI, lr.SourceFile, lr.LineNumber, lr.Disposition)}, true
+	}
+
+	var batch []struct {
+		Type string `json:"type"`
+		Body struct {
+			DocumentURL        string `json:"documentURL"`
+			EffectiveDirective string `json:"effectiveDirective"`
+			BlockedURL         string `json:"blockedURL"`
+			SourceFile         string `json:"sourceFile"`
+			LineNumber         int    `json:"lineNumber"`
+			Disposition        string `json:"disposition"`
+		} `json:"body"`
+	}
+	if err := json.Unmarshal(body, &batch); err != nil {
+		return nil, false
+	}
+	var reports []Report
+	for _, entry := range batch {
+		if entry.Type != "csp-violation" {
+			continue
+		}
+		b := entry.Body
+		reports = append(reports, newReport(b.DocumentURL, b.EffectiveDirective, b.BlockedURL, b.SourceFile, b.LineNumber, b.Disposition))
+	}
+	return reports, true
+}
+
+func newReport(document, directive, blocked, source string, line int, disposition string) Report {
+	if disposition != DispositionReport {
+		disposition = DispositionEnforce
+	}
+	return Report{
+		DocumentURI: clean(document),
+		Directive:   clean(directive),
+		BlockedURI:  clean(blocked),
+		SourceFile:  clean(source),
+		Line:        line,
+		Disposition: disposition,
+	}
+}
+
+// clean drops the query and fragment of a URL, which may hold tokens, and
+// cuts long values
+func clean(s string) string {
+	s, _, _ = strings.Cut(s, "#")
+	s, _, _ = strings.Cut(s, "?")
+	if len(s) > maxField {
+		s = s[:maxField]
+	}
+	return s
+}
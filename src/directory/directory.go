@@ -0,0 +1,155 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+// Package directory talks to a central directory of public CasPaste
+// instances: it registers this instance and keeps the list of peers
+// The directory API is a single resource, {url}/servers: POST an Entry to
+// register or refresh an instance (keyed by its URL), GET the list
+package directory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/outbound"
+)
+
+const (
+	requestTimeout = 30 * time.Second
+	// Largest directory listing read
+	maxListSize = 4 << 20
+	// Most peers kept from a listing
+	maxPeers = 1000
+)
+
+// Entry describes an instance in the directory
+type Entry struct {
+	Name     string   `json:"name"`
+	URL      string   `json:"url"`
+	Version  string   `json:"version"`
+	Policies Policies `json:"policies"`
+	Capacity Capacity `json:"capacity"`
+}
+
+// Policies are the rules a visitor needs to know before using an instance
+type Policies struct {
+	// Anyone can create pastes without an account
+	Public bool `json:"public"`
+	// Longest paste lifetime in seconds; -1 = unlimited
+	MaxLifeTime int64  `json:"maxLifeTime"`
+	TermsURL    string `json:"termsURL"`
+}
+
+// Capacity is what an instance accepts and how busy it is
+type Capacity struct {
+	BodyMaxLength  int `json:"bodyMaxLength"`
+	TitleMaxLength int `json:"titleMaxLength"`
+	// Live pastes, rounded like the telemetry ping
+	Pastes string `json:"pastes"`
+}
+
+// Service registers with a directory and caches its list of peers
+type Service struct {
+	url    string
+	client *http.Client
+
+	mu      sync.RWMutex
+	peers   []Entry
+	updated time.Time
+}
+
+// New returns a Service for the directory at url
+func New(url string) *Service {
+	return &Service{
+		url:    strings.TrimSuffix(url, "/"),
+		client: outbound.Client(requestTimeout),
+	}
+}
+
+// Register announces entry to the directory
+func (s *Service) Register(ctx context.Context, entry Entry) error {
+	if entry.URL == "" {
+		return errors.New("no public URL for this instance")
+	}
+	body, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url+"/servers", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "CasPaste/"+entry.Version)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("directory returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Refresh reloads the list of peers; the old list is kept on errors
+func (s *Service) Refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url+"/servers", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("directory returned %s", resp.Status)
+	}
+
+	var list struct {
+		Servers []Entry `json:"servers"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxListSize)).Decode(&list); err != nil {
+		return fmt.Errorf("invalid directory listing: %w", err)
+	}
+
+	// Only entries a client can use are listed
+	peers := make([]Entry, 0, len(list.Servers))
+	for _, entry := range list.Servers {
+		if !strings.HasPrefix(entry.URL, "https://") && !strings.HasPrefix(entry.URL, "http://") {
+			continue
+		}
+		peers = append(peers, entry)
+		if len(peers) == maxPeers {
+			break
+		}
+	}
+
+	s.mu.Lock()
+	s.peers = peers
+	s.updated = time.Now()
+	s.mu.Unlock()
+	return nil
+}
+
+// Peers returns the cached list and when it was fetched (zero = never)
+func (s *Service) Peers() ([]Entry, time.Time) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.peers, s.updated
+}
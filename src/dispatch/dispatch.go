@@ -0,0 +1,326 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+// Package dispatch runs outbound deliveries (notification emails, webhooks,
+// federation pushes) on a bounded pool of workers
+// The queue is bounded, so a slow or dead destination pushes back on callers
+// instead of piling up goroutines, and each destination has a circuit
+// breaker that pauses deliveries to it after repeated failures
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/metric"
+)
+
+// ErrQueueFull is returned when the queue has no room for a delivery
+var ErrQueueFull = errors.New("dispatch: queue is full")
+
+// ErrCircuitOpen is returned for a destination that has been failing
+var ErrCircuitOpen = errors.New("dispatch: destination is failing, deliveries are paused")
+
+// ErrStopped is returned once the pool is stopping
+var ErrStopped = errors.New("dispatch: pool is stopped")
+
+// Defaults for zero config values
+const (
+	DefaultWorkers          = 4
+	DefaultQueueSize        = 100
+	DefaultFailureThreshold = 5
+	DefaultCooldown         = time.Minute
+	DefaultTimeout          = 30 * time.Second
+)
+
+// Config holds the limits of the pool; zero values use the defaults
+type Config struct {
+	// Deliveries run at the same time
+	Workers int
+	// Deliveries waiting for a worker
+	QueueSize int
+	// Failures in a row that open the circuit of a destination
+	FailureThreshold int
+	// How long an open circuit rejects deliveries before one is tried again
+	Cooldown time.Duration
+	// Longest a delivery may take
+	Timeout time.Duration
+}
+
+// Job is one outbound delivery
+type Job struct {
+	// Kind of delivery, for metrics, e.g. "email"
+	Kind string
+	// Where the delivery goes, e.g. "smtp://mail.example.com:587"; deliveries
+	// to the same destination share a circuit breaker
+	Destination string
+	// Deliver sends the delivery; ctx ends after the timeout
+	Deliver func(ctx context.Context) error
+	// Done is called with the result once the job leaves the queue, if set
+	Done func(error)
+}
+
+// circuit states
+const (
+	stateClosed   = "closed"
+	stateOpen     = "open"
+	stateHalfOpen = "half-open"
+)
+
+// breaker tracks the failures of one destination
+type breaker struct {
+	state    string
+	failures int
+	openedAt time.Time
+	// A half-open circuit lets a single delivery through
+	trial bool
+
+	delivered int64
+	failed    int64
+	rejected  int64
+	lastError string
+}
+
+// Pool runs deliveries on a fixed number of workers
+type Pool struct {
+	cfg  Config
+	jobs chan Job
+	wg   sync.WaitGroup
+
+	mu       sync.Mutex
+	stopped  bool
+	breakers map[string]*breaker
+	dropped  int64
+}
+
+// New starts a pool of workers
+func New(cfg Config) *Pool {
+	if cfg.Workers <= 0 {
+		cfg.Workers = DefaultWorkers
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DefaultQueueSize
+	}
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = DefaultFailureThreshold
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = DefaultCooldown
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+
+	p := &Pool{
+		cfg:      cfg,
+		jobs:     make(chan Job, cfg.QueueSize),
+		breakers: make(map[string]*breaker),
+	}
+	for i := 0; i < cfg.Workers; i++ {
+		p.wg.Add(1)
+		go p.work()
+	}
+	return p
+}
+
+// Submit queues a delivery without waiting
+// It fails at once with ErrQueueFull when the workers are behind, or with
+// ErrCircuitOpen when the destination has been failing
+func (p *Pool) Submit(job Job) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.stopped {
+		return ErrStopped
+	}
+	if b := p.breaker(job.Destination); b.state == stateOpen && time.Since(b.openedAt) < p.cfg.Cooldown {
+		b.rejected++
+		metric.RecordDelivery(job.Kind, "rejected")
+		return fmt.Errorf("%w: %s", ErrCircuitOpen, job.Destination)
+	}
+
+	select {
+	case p.jobs <- job:
+		metric.UpdateDispatchQueue(len(p.jobs))
+		return nil
+	default:
+		p.dropped++
+		metric.RecordDelivery(job.Kind, "dropped")
+		return ErrQueueFull
+	}
+}
+
+// Stop stops taking deliveries and waits for the queued ones until ctx ends
+func (p *Pool) Stop(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.stopped {
+		p.stopped = true
+		close(p.jobs)
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *Pool) work() {
+	defer p.wg.Done()
+	for job := range p.jobs {
+		metric.UpdateDispatchQueue(len(p.jobs))
+		err := p.run(job)
+		if job.Done != nil {
+			job.Done(err)
+		}
+	}
+}
+
+// run delivers a job unless its circuit opened while it was queued
+func (p *Pool) run(job Job) error {
+	if !p.allow(job.Destination) {
+		metric.RecordDelivery(job.Kind, "rejected")
+		return fmt.Errorf("%w: %s", ErrCircuitOpen, job.Destination)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.cfg.Timeout)
+	defer cancel()
+	start := time.Now()
+	err := job.Deliver(ctx)
+	metric.RecordDeliveryDuration(job.Kind, time.Since(start))
+
+	p.record(job.Destination, err)
+	if err != nil {
+		metric.RecordDelivery(job.Kind, "failure")
+		return err
+	}
+	metric.RecordDelivery(job.Kind, "success")
+	return nil
+}
+
+// allow reports whether a delivery to a destination may go ahead, moving an
+// open circuit to half-open once the cooldown has passed
+func (p *Pool) allow(destination string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	b := p.breaker(destination)
+	switch b.state {
+	case stateOpen:
+		if time.Since(b.openedAt) < p.cfg.Cooldown {
+			b.rejected++
+			return false
+		}
+		b.state = stateHalfOpen
+		b.trial = true
+		metric.UpdateCircuitState(destination, b.state)
+		return true
+	case stateHalfOpen:
+		// Only the trial delivery goes through until it reports back
+		if b.trial {
+			b.rejected++
+			return false
+		}
+		b.trial = true
+		return true
+	}
+	return true
+}
+
+// record updates the circuit of a destination with a delivery result
+func (p *Pool) record(destination string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	b := p.breaker(destination)
+	b.trial = false
+	if err == nil {
+		b.delivered++
+		b.failures = 0
+		if b.state != stateClosed {
+			b.state = stateClosed
+			metric.UpdateCircuitState(destination, b.state)
+		}
+		return
+	}
+
+	b.failed++
+	b.failures++
+	b.lastError = err.Error()
+	if b.state == stateHalfOpen || b.failures >= p.cfg.FailureThreshold {
+		b.state = stateOpen
+		b.openedAt = time.Now()
+		metric.UpdateCircuitState(destination, b.state)
+	}
+}
+
+// breaker returns the circuit of a destination; p.mu must be held
+func (p *Pool) breaker(destination string) *breaker {
+	b, ok := p.breakers[destination]
+	if !ok {
+		b = &breaker{state: stateClosed}
+		p.breakers[destination] = b
+	}
+	return b
+}
+
+// DestinationStats shows the deliveries to one destination since start
+type DestinationStats struct {
+	Destination string `json:"destination"`
+	State       string `json:"state"`
+	Delivered   int64  `json:"delivered"`
+	Failed      int64  `json:"failed"`
+	Rejected    int64  `json:"rejected"`
+	LastError   string `json:"last_error,omitempty"`
+}
+
+// Stats is a snapshot of the pool
+type Stats struct {
+	Workers      int                `json:"workers"`
+	QueueSize    int                `json:"queue_size"`
+	Queued       int                `json:"queued"`
+	Dropped      int64              `json:"dropped"`
+	Destinations []DestinationStats `json:"destinations"`
+}
+
+// Stats returns a snapshot of the pool
+func (p *Pool) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := Stats{
+		Workers:      p.cfg.Workers,
+		QueueSize:    p.cfg.QueueSize,
+		Queued:       len(p.jobs),
+		Dropped:      p.dropped,
+		Destinations: []DestinationStats{},
+	}
+	for name, b := range p.breakers {
+		stats.Destinations = append(stats.Destinations, DestinationStats{
+			Destination: name,
+			State:       b.state,
+			Delivered:   b.delivered,
+			Failed:      b.failed,
+			Rejected:    b.rejected,
+			LastError:   b.lastError,
+		})
+	}
+	sort.Slice(stats.Destinations, func(i, j int) bool {
+		return stats.Destinations[i].Destination < stats.Destinations[j].Destination
+	})
+	return stats
+}
@@ -210,7 +210,7 @@ func DetectForCLI() Mode {
 			"config", "login",
 			"new", "create", "paste",
 			"get", "show", "view",
-			"list", "ls",
+			"list", "ls", "templates", "rec",
 			"info", "server-info",
 			"health", "healthz",
 		}
@@ -7,14 +7,18 @@
 package domain
 
 import (
-	"database/sql"
+	"context"
 	"errors"
-	"io"
 	"net"
-	"net/http"
 	"strings"
 	"sync"
 	"time"
+
+	"golang.org/x/net/publicsuffix"
+
+	"github.com/casjay-forks/caspaste/src/homoglyph"
+	"github.com/casjay-forks/caspaste/src/resolver"
+	"github.com/casjay-forks/caspaste/src/secrets"
 )
 
 // Owner type constants
@@ -30,6 +34,16 @@ const (
 	VerificationStatusFailed   = "failed"
 )
 
+// Verification method constants
+const (
+	// VerificationMethodARecord requires the domain to resolve to a server IP
+	VerificationMethodARecord = "a_record"
+	// VerificationMethodTXT requires a TXT record at the challenge name (works behind CDNs)
+	VerificationMethodTXT = "txt"
+	// VerificationMethodCNAME requires the domain to be a CNAME of the server FQDN
+	VerificationMethodCNAME = "cname"
+)
+
 // SSL status constants
 const (
 	SSLStatusNone    = "none"
@@ -59,6 +73,9 @@ var (
 	ErrMaxDomainsReached    = errors.New("maximum number of domains reached")
 	ErrInvalidDomain        = errors.New("invalid domain")
 	ErrReservedDomain       = errors.New("domain is reserved")
+	ErrInvalidMethod        = errors.New("invalid verification method")
+	ErrPublicSuffix         = errors.New("domain is a public suffix")
+	ErrConfusableDomain     = errors.New("domain mixes look-alike characters from different scripts")
 )
 
 // CustomDomain represents a custom domain per PART 36
@@ -70,6 +87,9 @@ type CustomDomain struct {
 	IsApex             bool    `json:"is_apex"`
 	IsWildcard         bool    `json:"is_wildcard"`
 	VerificationStatus string  `json:"verification_status"`
+	VerificationMethod string  `json:"verification_method"`
+	VerificationToken  string  `json:"verification_token,omitempty"`
+	SubdomainMode      string  `json:"subdomain_mode,omitempty"`
 	VerifiedAt         *int64  `json:"verified_at,omitempty"`
 	VerifiedIP         string  `json:"verified_ip,omitempty"`
 	LastCheckAt        *int64  `json:"last_check_at,omitempty"`
@@ -92,8 +112,11 @@ type CustomDomain struct {
 
 // DNSInstructions contains DNS setup instructions
 type DNSInstructions struct {
+	Method       string   `json:"method"`
 	Target       string   `json:"target"`
 	TargetIPs    []string `json:"target_ips"`
+	TXTName      string   `json:"txt_name"`
+	TXTValue     string   `json:"txt_value"`
 	Instructions string   `json:"instructions"`
 }
 
@@ -103,205 +126,268 @@ type VerifyResult struct {
 	Error      string   `json:"error,omitempty"`
 	Message    string   `json:"message,omitempty"`
 	ResolvedTo []string `json:"resolved_to,omitempty"`
+	// verifiedIP is recorded on success for A-record verification
+	verifiedIP string
 }
 
 // Service provides custom domain operations
 type Service struct {
-	db         *sql.DB
-	serverFQDN string
-	serverIPs  []net.IP
-	ipsMutex   sync.RWMutex
-	lastIPCheck time.Time
+	store             Store
+	serverFQDN        string
+	serverIPs         []net.IP
+	ipsMutex          sync.RWMutex
+	lastIPCheck       time.Time
+	ipDiscovery       IPDiscoveryConfig
+	staticIPs         []net.IP
+	externalIP        net.IP
+	lastExternalCheck time.Time
+	cipher            *secrets.Cipher
+	resolver          *resolver.Resolver
+	reserved          *homoglyph.Checker
 }
 
 // NewService creates a new domain service
-func NewService(db *sql.DB, serverFQDN string) *Service {
-	s := &Service{
-		db:         db,
+func NewService(store Store, serverFQDN string) *Service {
+	// Server IPs are discovered lazily on first use, not at startup
+	return &Service{
+		store:      store,
 		serverFQDN: serverFQDN,
 	}
-	// Initialize server IPs
-	s.refreshPublicIPs()
-	return s
+}
+
+// SetCipher enables envelope encryption of SSL credentials at rest
+func (s *Service) SetCipher(c *secrets.Cipher) {
+	s.cipher = c
+}
+
+// IsValidVerificationMethod reports whether method is a supported verification method
+func IsValidVerificationMethod(method string) bool {
+	switch method {
+	case VerificationMethodARecord, VerificationMethodTXT, VerificationMethodCNAME:
+		return true
+	}
+	return false
+}
+
+// SetReservedChecker blocks domains whose labels are, or look like, reserved words
+func (s *Service) SetReservedChecker(c *homoglyph.Checker) {
+	s.reserved = c
+}
+
+// SetResolver routes verification and FQDN lookups through configured DNS upstreams
+func (s *Service) SetResolver(r *resolver.Resolver) {
+	s.resolver = r
 }
 
 // Create creates a new custom domain
-func (s *Service) Create(ownerType string, ownerID int64, domain string) (*CustomDomain, error) {
+func (s *Service) Create(ctx context.Context, ownerType string, ownerID int64, domain string) (*CustomDomain, error) {
 	// Validate domain
 	if err := ValidateDomain(domain); err != nil {
 		return nil, err
 	}
+	if err := s.checkReserved(domain); err != nil {
+		return nil, err
+	}
 
 	// Normalize domain
 	domain = NormalizeDomain(domain)
 
 	// Check if already exists
-	existing, _ := s.GetByDomain(domain)
+	existing, _ := s.GetByDomain(ctx, domain)
 	if existing != nil {
 		return nil, ErrDomainAlreadyExists
 	}
 
-	// Determine if apex or subdomain
-	isApex := IsApexDomain(domain)
-	isWildcard := strings.HasPrefix(domain, "*.")
+	token, err := generateVerificationToken()
+	if err != nil {
+		return nil, err
+	}
 
 	now := time.Now().Unix()
 
-	result, err := s.db.Exec(`
-		INSERT INTO custom_domains (owner_type, owner_id, domain, is_apex, is_wildcard, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
-	`, ownerType, ownerID, domain, boolToInt(isApex), boolToInt(isWildcard), now, now)
+	// Determine if apex or subdomain
+	id, err := s.store.Insert(ctx, &CustomDomain{
+		OwnerType:          ownerType,
+		OwnerID:            ownerID,
+		Domain:             domain,
+		IsApex:             IsApexDomain(domain),
+		IsWildcard:         strings.HasPrefix(domain, "*."),
+		VerificationMethod: VerificationMethodARecord,
+		VerificationToken:  token,
+		CreatedAt:          now,
+		UpdatedAt:          now,
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	id, _ := result.LastInsertId()
-
 	// Log audit
-	s.logAudit(id, "created", ownerType, ownerID, nil)
+	s.logAudit(ctx, id, "created", ownerType, ownerID, nil)
 
-	return s.GetByID(id)
+	return s.GetByID(ctx, id)
 }
 
 // GetByID retrieves a domain by ID
-func (s *Service) GetByID(id int64) (*CustomDomain, error) {
-	return s.scanDomain(s.db.QueryRow(`
-		SELECT id, owner_type, owner_id, domain, is_apex, is_wildcard,
-		       verification_status, verified_at, verified_ip, last_check_at, check_count,
-		       ssl_enabled, ssl_status, ssl_challenge, ssl_provider, ssl_credentials,
-		       ssl_cert_pem, ssl_key_pem, ssl_issued_at, ssl_expires_at, ssl_last_error,
-		       status, suspended_reason, created_at, updated_at
-		FROM custom_domains WHERE id = ?
-	`, id))
+func (s *Service) GetByID(ctx context.Context, id int64) (*CustomDomain, error) {
+	d, err := s.store.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return d, s.decrypt(d)
 }
 
 // GetByDomain retrieves a domain by domain name
-func (s *Service) GetByDomain(domain string) (*CustomDomain, error) {
-	domain = NormalizeDomain(domain)
-	return s.scanDomain(s.db.QueryRow(`
-		SELECT id, owner_type, owner_id, domain, is_apex, is_wildcard,
-		       verification_status, verified_at, verified_ip, last_check_at, check_count,
-		       ssl_enabled, ssl_status, ssl_challenge, ssl_provider, ssl_credentials,
-		       ssl_cert_pem, ssl_key_pem, ssl_issued_at, ssl_expires_at, ssl_last_error,
-		       status, suspended_reason, created_at, updated_at
-		FROM custom_domains WHERE LOWER(domain) = LOWER(?)
-	`, domain))
+func (s *Service) GetByDomain(ctx context.Context, domain string) (*CustomDomain, error) {
+	d, err := s.store.GetByDomain(ctx, NormalizeDomain(domain))
+	if err != nil {
+		return nil, err
+	}
+	return d, s.decrypt(d)
 }
 
 // GetByOwner retrieves all domains for an owner
-func (s *Service) GetByOwner(ownerType string, ownerID int64) ([]CustomDomain, error) {
-	rows, err := s.db.Query(`
-		SELECT id, owner_type, owner_id, domain, is_apex, is_wildcard,
-		       verification_status, verified_at, verified_ip, last_check_at, check_count,
-		       ssl_enabled, ssl_status, ssl_challenge, ssl_provider, ssl_credentials,
-		       ssl_cert_pem, ssl_key_pem, ssl_issued_at, ssl_expires_at, ssl_last_error,
-		       status, suspended_reason, created_at, updated_at
-		FROM custom_domains WHERE owner_type = ? AND owner_id = ?
-		ORDER BY domain
-	`, ownerType, ownerID)
+func (s *Service) GetByOwner(ctx context.Context, ownerType string, ownerID int64) ([]CustomDomain, error) {
+	domains, err := s.store.ListByOwner(ctx, ownerType, ownerID)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var domains []CustomDomain
-	for rows.Next() {
-		d, err := s.scanDomainRow(rows)
-		if err != nil {
+	for i := range domains {
+		if err := s.decrypt(&domains[i]); err != nil {
 			return nil, err
 		}
-		domains = append(domains, *d)
 	}
-
 	return domains, nil
 }
 
+// decrypt opens the SSL credentials of a domain read from the store
+func (s *Service) decrypt(d *CustomDomain) error {
+	var err error
+	d.SSLCredentials, err = s.cipher.Decrypt(d.SSLCredentials)
+	return err
+}
+
+// ListFilter narrows an admin listing of domains (empty fields match everything)
+type ListFilter struct {
+	Status             string
+	SSLStatus          string
+	VerificationStatus string
+	OwnerType          string
+	OwnerID            int64
+	// Search matches a substring of the domain name
+	Search string
+	Limit  int
+	Offset int
+}
+
+// AuditEntry is one entry in a domain's history
+type AuditEntry struct {
+	Action    string `json:"action"`
+	ActorType string `json:"actor_type"`
+	ActorID   int64  `json:"actor_id"`
+	Details   string `json:"details,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// List returns domains across all owners matching the filter, and the total match count
+func (s *Service) List(ctx context.Context, f ListFilter) ([]CustomDomain, int, error) {
+	if f.Limit <= 0 || f.Limit > 500 {
+		f.Limit = 50
+	}
+
+	domains, total, err := s.store.List(ctx, f)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range domains {
+		if err := s.decrypt(&domains[i]); err != nil {
+			return nil, 0, err
+		}
+	}
+	return domains, total, nil
+}
+
+// GetAudit returns a domain's verification and audit history, newest first
+func (s *Service) GetAudit(ctx context.Context, id int64, limit int) ([]AuditEntry, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	return s.store.Audit(ctx, id, limit)
+}
+
 // Delete removes a custom domain
-func (s *Service) Delete(id int64) error {
+func (s *Service) Delete(ctx context.Context, id int64) error {
 	// Get domain for audit
-	d, err := s.GetByID(id)
+	d, err := s.GetByID(ctx, id)
 	if err != nil {
 		return err
 	}
 
-	_, err = s.db.Exec("DELETE FROM custom_domains WHERE id = ?", id)
-	if err != nil {
+	if err := s.store.Delete(ctx, id); err != nil {
 		return err
 	}
 
-	s.logAudit(id, "deleted", d.OwnerType, d.OwnerID, nil)
+	s.logAudit(ctx, id, "deleted", d.OwnerType, d.OwnerID, nil)
 	return nil
 }
 
-// Verify verifies a custom domain by checking DNS resolution
-func (s *Service) Verify(id int64) (*VerifyResult, error) {
-	d, err := s.GetByID(id)
+// Verify verifies a custom domain using its configured verification method
+func (s *Service) Verify(ctx context.Context, id int64) (*VerifyResult, error) {
+	d, err := s.GetByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 
-	// Refresh server IPs if stale
-	s.refreshPublicIPsIfNeeded()
+	var result *VerifyResult
+	switch d.VerificationMethod {
+	case VerificationMethodTXT:
+		if err := s.ensureVerificationToken(ctx, d); err != nil {
+			return nil, err
+		}
+		result = s.verifyTXT(d)
+	case VerificationMethodCNAME:
+		result = s.verifyCNAME(d)
+	default:
+		result = s.verifyARecord(d)
+	}
 
-	// Resolve the domain
-	ips, err := net.LookupIP(d.Domain)
-	if err != nil {
-		s.updateVerificationStatus(id, VerificationStatusFailed)
-		return &VerifyResult{
-			OK:      false,
-			Error:   "DNS_LOOKUP_FAILED",
-			Message: "DNS lookup failed. Please check your DNS configuration.",
-		}, nil
+	if !result.OK {
+		s.store.RecordCheck(ctx, id, VerificationStatusFailed)
+		details := "method=" + d.VerificationMethod + " error=" + result.Error
+		s.logAudit(ctx, id, "verification_failed", d.OwnerType, d.OwnerID, &details)
+		return result, nil
 	}
 
-	// Check if any resolved IP matches server IP
-	serverIPs := s.GetServerPublicIPs()
-	matched := false
-	var resolvedIPs []string
-
-	for _, ip := range ips {
-		resolvedIPs = append(resolvedIPs, ip.String())
-		for _, serverIP := range serverIPs {
-			if ip.Equal(serverIP) {
-				matched = true
-				break
-			}
-		}
+	// Success - update status (a suspended domain stays suspended)
+	if err := s.store.SetVerified(ctx, id, result.verifiedIP); err != nil {
+		return nil, err
 	}
 
-	if !matched {
-		s.updateVerificationStatus(id, VerificationStatusFailed)
-		return &VerifyResult{
-			OK:         false,
-			Error:      "DNS_MISMATCH",
-			Message:    "Domain does not resolve to this server. DNS propagation can take up to 48 hours.",
-			ResolvedTo: resolvedIPs,
-		}, nil
+	details := "method=" + d.VerificationMethod
+	s.logAudit(ctx, id, "verified", d.OwnerType, d.OwnerID, &details)
+
+	return result, nil
+}
+
+// SetVerificationMethod changes how a domain is verified
+func (s *Service) SetVerificationMethod(ctx context.Context, id int64, method string) error {
+	if !IsValidVerificationMethod(method) {
+		return ErrInvalidMethod
 	}
 
-	// Success - update status
-	now := time.Now().Unix()
-	_, err = s.db.Exec(`
-		UPDATE custom_domains SET
-			verification_status = ?, verified_at = ?, verified_ip = ?,
-			status = ?, updated_at = ?
-		WHERE id = ?
-	`, VerificationStatusVerified, now, resolvedIPs[0], StatusActive, now, id)
+	d, err := s.GetByID(ctx, id)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if err := s.ensureVerificationToken(ctx, d); err != nil {
+		return err
 	}
 
-	s.logAudit(id, "verified", d.OwnerType, d.OwnerID, nil)
-
-	return &VerifyResult{
-		OK:         true,
-		ResolvedTo: resolvedIPs,
-	}, nil
+	return s.store.SetVerificationMethod(ctx, id, method)
 }
 
 // GetDNSInstructions returns DNS setup instructions for a domain
-func (s *Service) GetDNSInstructions(id int64) (*DNSInstructions, error) {
-	d, err := s.GetByID(id)
+func (s *Service) GetDNSInstructions(ctx context.Context, id int64) (*DNSInstructions, error) {
+	d, err := s.GetByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
@@ -312,247 +398,68 @@ func (s *Service) GetDNSInstructions(id int64) (*DNSInstructions, error) {
 		ipStrs = append(ipStrs, ip.String())
 	}
 
+	if err := s.ensureVerificationToken(ctx, d); err != nil {
+		return nil, err
+	}
+
 	var instructions string
-	if d.IsApex {
+	switch {
+	case d.VerificationMethod == VerificationMethodTXT:
+		instructions = "Add a TXT record named " + ChallengeName(d.Domain) + " with the value above. Proxied (CDN) records are supported."
+	case d.VerificationMethod == VerificationMethodCNAME:
+		instructions = "Add a CNAME record pointing to " + s.serverFQDN + "."
+	case d.IsApex:
 		instructions = "Add A/AAAA records pointing to the IP addresses above."
-	} else {
+	default:
 		instructions = "Add a CNAME record pointing to " + s.serverFQDN + ", or A/AAAA records pointing to the IPs above."
 	}
 
 	return &DNSInstructions{
+		Method:       d.VerificationMethod,
 		Target:       s.serverFQDN,
 		TargetIPs:    ipStrs,
+		TXTName:      ChallengeName(d.Domain),
+		TXTValue:     d.VerificationToken,
 		Instructions: instructions,
 	}, nil
 }
 
 // Suspend suspends a domain
-func (s *Service) Suspend(id int64, reason string) error {
-	now := time.Now().Unix()
-	_, err := s.db.Exec(`
-		UPDATE custom_domains SET status = ?, suspended_reason = ?, updated_at = ?
-		WHERE id = ?
-	`, StatusSuspended, reason, now, id)
-	if err != nil {
+func (s *Service) Suspend(ctx context.Context, id int64, reason string) error {
+	if err := s.store.SetStatus(ctx, id, StatusSuspended, reason); err != nil {
 		return err
 	}
 
-	s.logAudit(id, "suspended", "admin", 0, &reason)
+	s.logAudit(ctx, id, "suspended", "admin", 0, &reason)
 	return nil
 }
 
 // Unsuspend unsuspends a domain
-func (s *Service) Unsuspend(id int64) error {
-	now := time.Now().Unix()
-	_, err := s.db.Exec(`
-		UPDATE custom_domains SET status = ?, suspended_reason = NULL, updated_at = ?
-		WHERE id = ?
-	`, StatusActive, now, id)
-	if err != nil {
+func (s *Service) Unsuspend(ctx context.Context, id int64) error {
+	if err := s.store.SetStatus(ctx, id, StatusActive, ""); err != nil {
 		return err
 	}
 
-	s.logAudit(id, "unsuspended", "admin", 0, nil)
+	s.logAudit(ctx, id, "unsuspended", "admin", 0, nil)
 	return nil
 }
 
 // CountByOwner returns the count of domains for an owner
-func (s *Service) CountByOwner(ownerType string, ownerID int64) (int, error) {
-	var count int
-	err := s.db.QueryRow(`
-		SELECT COUNT(*) FROM custom_domains WHERE owner_type = ? AND owner_id = ?
-	`, ownerType, ownerID).Scan(&count)
-	return count, err
-}
-
-// GetServerPublicIPs returns the server's public IP addresses
-func (s *Service) GetServerPublicIPs() []net.IP {
-	s.ipsMutex.RLock()
-	defer s.ipsMutex.RUnlock()
-	return s.serverIPs
-}
-
-// RefreshPublicIPs refreshes the cached public IPs
-func (s *Service) RefreshPublicIPs() {
-	s.refreshPublicIPs()
-}
-
-func (s *Service) refreshPublicIPs() {
-	s.ipsMutex.Lock()
-	defer s.ipsMutex.Unlock()
-
-	var ips []net.IP
-
-	// From FQDN
-	if s.serverFQDN != "" {
-		if resolved, err := net.LookupIP(s.serverFQDN); err == nil {
-			ips = append(ips, resolved...)
-		}
-	}
-
-	// From external IP services
-	externalIP := getExternalIP()
-	if externalIP != nil {
-		ips = append(ips, externalIP)
-	}
-
-	s.serverIPs = ips
-	s.lastIPCheck = time.Now()
-}
-
-func (s *Service) refreshPublicIPsIfNeeded() {
-	s.ipsMutex.RLock()
-	stale := time.Since(s.lastIPCheck) > 12*time.Hour
-	s.ipsMutex.RUnlock()
-
-	if stale {
-		s.refreshPublicIPs()
-	}
+func (s *Service) CountByOwner(ctx context.Context, ownerType string, ownerID int64) (int, error) {
+	return s.store.CountByOwner(ctx, ownerType, ownerID)
 }
 
-// getExternalIP gets the external IP using a public service
-func getExternalIP() net.IP {
-	services := []string{
-		"https://api.ipify.org",
-		"https://icanhazip.com",
-		"https://ifconfig.me/ip",
-	}
-
-	client := &http.Client{Timeout: 5 * time.Second}
-
-	for _, svc := range services {
-		resp, err := client.Get(svc)
-		if err != nil {
-			continue
-		}
-		defer resp.Body.Close()
-
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			continue
-		}
-
-		ip := net.ParseIP(strings.TrimSpace(string(body)))
-		if ip != nil {
-			return ip
-		}
+func (s *Service) logAudit(ctx context.Context, domainID int64, action, actorType string, actorID int64, details *string) {
+	e := AuditEntry{
+		Action:    action,
+		ActorType: actorType,
+		ActorID:   actorID,
+		CreatedAt: time.Now().Unix(),
 	}
-
-	return nil
-}
-
-func (s *Service) updateVerificationStatus(id int64, status string) {
-	now := time.Now().Unix()
-	s.db.Exec(`
-		UPDATE custom_domains SET
-			verification_status = ?, last_check_at = ?, check_count = check_count + 1, updated_at = ?
-		WHERE id = ?
-	`, status, now, now, id)
-}
-
-func (s *Service) logAudit(domainID int64, action, actorType string, actorID int64, details *string) {
-	now := time.Now().Unix()
-	var detailsVal interface{}
 	if details != nil {
-		detailsVal = *details
-	}
-	s.db.Exec(`
-		INSERT INTO custom_domain_audit (domain_id, action, actor_type, actor_id, details, created_at)
-		VALUES (?, ?, ?, ?, ?, ?)
-	`, domainID, action, actorType, actorID, detailsVal, now)
-}
-
-func (s *Service) scanDomain(row *sql.Row) (*CustomDomain, error) {
-	d := &CustomDomain{}
-	var isApex, isWildcard, sslEnabled int
-	var verifiedAt, lastCheckAt, sslIssuedAt, sslExpiresAt sql.NullInt64
-	var verifiedIP, sslChallenge, sslProvider, sslCredentials, sslCertPEM, sslKeyPEM, sslLastError, suspendedReason sql.NullString
-
-	err := row.Scan(
-		&d.ID, &d.OwnerType, &d.OwnerID, &d.Domain, &isApex, &isWildcard,
-		&d.VerificationStatus, &verifiedAt, &verifiedIP, &lastCheckAt, &d.CheckCount,
-		&sslEnabled, &d.SSLStatus, &sslChallenge, &sslProvider, &sslCredentials,
-		&sslCertPEM, &sslKeyPEM, &sslIssuedAt, &sslExpiresAt, &sslLastError,
-		&d.Status, &suspendedReason, &d.CreatedAt, &d.UpdatedAt,
-	)
-	if err == sql.ErrNoRows {
-		return nil, ErrDomainNotFound
-	}
-	if err != nil {
-		return nil, err
-	}
-
-	d.IsApex = isApex == 1
-	d.IsWildcard = isWildcard == 1
-	d.SSLEnabled = sslEnabled == 1
-
-	if verifiedAt.Valid {
-		d.VerifiedAt = &verifiedAt.Int64
-	}
-	if lastCheckAt.Valid {
-		d.LastCheckAt = &lastCheckAt.Int64
-	}
-	if sslIssuedAt.Valid {
-		d.SSLIssuedAt = &sslIssuedAt.Int64
-	}
-	if sslExpiresAt.Valid {
-		d.SSLExpiresAt = &sslExpiresAt.Int64
-	}
-	d.VerifiedIP = verifiedIP.String
-	d.SSLChallenge = sslChallenge.String
-	d.SSLProvider = sslProvider.String
-	d.SSLCredentials = sslCredentials.String
-	d.SSLCertPEM = sslCertPEM.String
-	d.SSLKeyPEM = sslKeyPEM.String
-	d.SSLLastError = sslLastError.String
-	d.SuspendedReason = suspendedReason.String
-
-	return d, nil
-}
-
-func (s *Service) scanDomainRow(rows *sql.Rows) (*CustomDomain, error) {
-	d := &CustomDomain{}
-	var isApex, isWildcard, sslEnabled int
-	var verifiedAt, lastCheckAt, sslIssuedAt, sslExpiresAt sql.NullInt64
-	var verifiedIP, sslChallenge, sslProvider, sslCredentials, sslCertPEM, sslKeyPEM, sslLastError, suspendedReason sql.NullString
-
-	err := rows.Scan(
-		&d.ID, &d.OwnerType, &d.OwnerID, &d.Domain, &isApex, &isWildcard,
-		&d.VerificationStatus, &verifiedAt, &verifiedIP, &lastCheckAt, &d.CheckCount,
-		&sslEnabled, &d.SSLStatus, &sslChallenge, &sslProvider, &sslCredentials,
-		&sslCertPEM, &sslKeyPEM, &sslIssuedAt, &sslExpiresAt, &sslLastError,
-		&d.Status, &suspendedReason, &d.CreatedAt, &d.UpdatedAt,
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	d.IsApex = isApex == 1
-	d.IsWildcard = isWildcard == 1
-	d.SSLEnabled = sslEnabled == 1
-
-	if verifiedAt.Valid {
-		d.VerifiedAt = &verifiedAt.Int64
-	}
-	if lastCheckAt.Valid {
-		d.LastCheckAt = &lastCheckAt.Int64
-	}
-	if sslIssuedAt.Valid {
-		d.SSLIssuedAt = &sslIssuedAt.Int64
+		e.Details = *details
 	}
-	if sslExpiresAt.Valid {
-		d.SSLExpiresAt = &sslExpiresAt.Int64
-	}
-	d.VerifiedIP = verifiedIP.String
-	d.SSLChallenge = sslChallenge.String
-	d.SSLProvider = sslProvider.String
-	d.SSLCredentials = sslCredentials.String
-	d.SSLCertPEM = sslCertPEM.String
-	d.SSLKeyPEM = sslKeyPEM.String
-	d.SSLLastError = sslLastError.String
-	d.SuspendedReason = suspendedReason.String
-
-	return d, nil
+	s.store.AddAudit(ctx, domainID, e)
 }
 
 // ValidateDomain validates a domain name
@@ -582,6 +489,37 @@ func ValidateDomain(domain string) error {
 		}
 	}
 
+	// Reject public suffixes outright; *.co.uk would claim every .co.uk site
+	if IsPublicSuffix(domain) {
+		return ErrPublicSuffix
+	}
+
+	// Reject punycode/IDN labels that mix scripts (e.g. Latin with Cyrillic а)
+	for _, label := range strings.Split(domain, ".") {
+		if homoglyph.IsMixedScript(label) {
+			return ErrConfusableDomain
+		}
+	}
+
+	return nil
+}
+
+// checkReserved rejects domains with a label matching a reserved word
+// The public suffix is ignored so "com" or "co.uk" never trip the check
+func (s *Service) checkReserved(domain string) error {
+	if s.reserved == nil {
+		return nil
+	}
+
+	name := strings.TrimPrefix(domain, "*.")
+	if suffix, _ := publicsuffix.PublicSuffix(name); suffix != name {
+		name = strings.TrimSuffix(name, "."+suffix)
+	}
+	for _, label := range strings.Split(name, ".") {
+		if _, ok := s.reserved.Match(label); ok {
+			return ErrReservedDomain
+		}
+	}
 	return nil
 }
 
@@ -590,28 +528,28 @@ func NormalizeDomain(domain string) string {
 	return strings.ToLower(strings.TrimSpace(domain))
 }
 
-// IsApexDomain checks if a domain is an apex domain (no subdomain)
+// IsApexDomain checks if a domain is an apex domain (registrable domain, no subdomain)
+// Uses the public suffix list so multi-part suffixes (co.uk, github.io) are handled
 func IsApexDomain(domain string) bool {
-	parts := strings.Split(domain, ".")
-	// An apex domain has only 2 parts (e.g., example.com)
-	// But some TLDs have multiple parts (e.g., co.uk), so we check for common patterns
-	if len(parts) <= 2 {
-		return true
-	}
-	// Check for known multi-part TLDs
-	multiPartTLDs := []string{"co.uk", "org.uk", "com.au", "net.au", "co.nz"}
-	suffix := strings.Join(parts[len(parts)-2:], ".")
-	for _, tld := range multiPartTLDs {
-		if suffix == tld && len(parts) == 3 {
-			return true
-		}
+	domain = NormalizeDomain(domain)
+	apex, err := publicsuffix.EffectiveTLDPlusOne(domain)
+	if err != nil {
+		return false
 	}
-	return false
+	return apex == domain
+}
+
+// IsPublicSuffix reports whether a domain is itself a public suffix (com, co.uk, github.io)
+// Such names are shared by many registrants and can never be claimed
+func IsPublicSuffix(domain string) bool {
+	domain = strings.TrimPrefix(NormalizeDomain(domain), "*.")
+	suffix, _ := publicsuffix.PublicSuffix(domain)
+	return suffix == domain
 }
 
 // ConfigureSSL configures SSL for a domain
-func (s *Service) ConfigureSSL(id int64, challenge, provider string, credentials map[string]string) error {
-	d, err := s.GetByID(id)
+func (s *Service) ConfigureSSL(ctx context.Context, id int64, challenge, provider string, credentials map[string]string) error {
+	d, err := s.GetByID(ctx, id)
 	if err != nil {
 		return err
 	}
@@ -620,6 +558,11 @@ func (s *Service) ConfigureSSL(id int64, challenge, provider string, credentials
 		return ErrDomainNotVerified
 	}
 
+	// Wildcard certificates can only be issued via DNS-01
+	if d.IsWildcard && challenge != SSLChallengeDNS01 {
+		return ErrWildcardRequiresDNS01
+	}
+
 	// Serialize credentials
 	var credStr string
 	if len(credentials) > 0 {
@@ -630,26 +573,23 @@ func (s *Service) ConfigureSSL(id int64, challenge, provider string, credentials
 		}
 		credStr = strings.Join(parts, ";")
 	}
-
-	now := time.Now().Unix()
-	_, err = s.db.Exec(`
-		UPDATE custom_domains SET
-			ssl_challenge = ?, ssl_provider = ?, ssl_credentials = ?,
-			ssl_status = ?, updated_at = ?
-		WHERE id = ?
-	`, challenge, provider, credStr, SSLStatusPending, now, id)
+	credStr, err = s.cipher.Encrypt(credStr)
 	if err != nil {
 		return err
 	}
 
-	s.logAudit(id, "ssl_configured", d.OwnerType, d.OwnerID, nil)
+	if err := s.store.SetSSLConfig(ctx, id, challenge, provider, credStr); err != nil {
+		return err
+	}
+
+	s.logAudit(ctx, id, "ssl_configured", d.OwnerType, d.OwnerID, nil)
 	return nil
 }
 
 // IssueCertificate issues an SSL certificate for a domain
 // This is a placeholder - actual implementation would use ACME/Let's Encrypt
-func (s *Service) IssueCertificate(id int64) error {
-	d, err := s.GetByID(id)
+func (s *Service) IssueCertificate(ctx context.Context, id int64) error {
+	d, err := s.GetByID(ctx, id)
 	if err != nil {
 		return err
 	}
@@ -665,40 +605,26 @@ func (s *Service) IssueCertificate(id int64) error {
 	// 4. Store certificate and key
 
 	// For now, just mark as pending
-	now := time.Now().Unix()
-	_, err = s.db.Exec(`
-		UPDATE custom_domains SET
-			ssl_enabled = 1, ssl_status = ?, updated_at = ?
-		WHERE id = ?
-	`, SSLStatusPending, now, id)
-	if err != nil {
+	if err := s.store.EnableSSL(ctx, id); err != nil {
 		return err
 	}
 
-	s.logAudit(id, "ssl_issued", d.OwnerType, d.OwnerID, nil)
+	s.logAudit(ctx, id, "ssl_issued", d.OwnerType, d.OwnerID, nil)
 	return nil
 }
 
 // RenewExpiring renews certificates expiring within the specified days
-func (s *Service) RenewExpiring(renewBeforeDays int) (int, error) {
+func (s *Service) RenewExpiring(ctx context.Context, renewBeforeDays int) (int, error) {
 	threshold := time.Now().AddDate(0, 0, renewBeforeDays).Unix()
 
-	rows, err := s.db.Query(`
-		SELECT id FROM custom_domains
-		WHERE ssl_enabled = 1 AND ssl_status = ? AND ssl_expires_at < ?
-	`, SSLStatusActive, threshold)
+	ids, err := s.store.ExpiringCertificates(ctx, threshold)
 	if err != nil {
 		return 0, err
 	}
-	defer rows.Close()
 
 	renewed := 0
-	for rows.Next() {
-		var id int64
-		if err := rows.Scan(&id); err != nil {
-			continue
-		}
-		if err := s.IssueCertificate(id); err == nil {
+	for _, id := range ids {
+		if err := s.IssueCertificate(ctx, id); err == nil {
 			renewed++
 		}
 	}
@@ -707,38 +633,20 @@ func (s *Service) RenewExpiring(renewBeforeDays int) (int, error) {
 }
 
 // CleanupUnverified removes unverified domains older than the specified duration
-func (s *Service) CleanupUnverified(maxAge time.Duration) (int64, error) {
-	cutoff := time.Now().Add(-maxAge).Unix()
-
-	result, err := s.db.Exec(`
-		DELETE FROM custom_domains
-		WHERE verification_status = ? AND created_at < ?
-	`, VerificationStatusPending, cutoff)
-	if err != nil {
-		return 0, err
-	}
-
-	return result.RowsAffected()
+func (s *Service) CleanupUnverified(ctx context.Context, maxAge time.Duration) (int64, error) {
+	return s.store.DeleteUnverified(ctx, time.Now().Add(-maxAge).Unix())
 }
 
 // RetryPendingVerifications retries verification for pending domains
-func (s *Service) RetryPendingVerifications() (int, error) {
-	rows, err := s.db.Query(`
-		SELECT id FROM custom_domains
-		WHERE verification_status = ? AND check_count < 10
-	`, VerificationStatusPending)
+func (s *Service) RetryPendingVerifications(ctx context.Context) (int, error) {
+	ids, err := s.store.PendingVerifications(ctx, 10)
 	if err != nil {
 		return 0, err
 	}
-	defer rows.Close()
 
 	verified := 0
-	for rows.Next() {
-		var id int64
-		if err := rows.Scan(&id); err != nil {
-			continue
-		}
-		result, _ := s.Verify(id)
+	for _, id := range ids {
+		result, _ := s.Verify(ctx, id)
 		if result != nil && result.OK {
 			verified++
 		}
@@ -749,10 +657,3 @@ func (s *Service) RetryPendingVerifications() (int, error) {
 
 // ErrDomainTaken is returned when a domain is already registered
 var ErrDomainTaken = ErrDomainAlreadyExists
-
-func boolToInt(b bool) int {
-	if b {
-		return 1
-	}
-	return 0
-}
@@ -0,0 +1,293 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package domain
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/outbound"
+)
+
+// DefaultIPServices are the HTTP services queried when no list is configured
+// Each returns the caller's address as plain text
+var DefaultIPServices = []string{
+	"https://api.ipify.org",
+	"https://icanhazip.com",
+	"https://ifconfig.me/ip",
+}
+
+const (
+	// ipRefreshInterval is how often the FQDN is re-resolved
+	ipRefreshInterval = 12 * time.Hour
+	// externalIPInterval is how often third-party discovery runs; it is
+	// deliberately longer than ipRefreshInterval so refreshes reuse the result
+	externalIPInterval = 7 * 24 * time.Hour
+	// discoveryTimeout bounds each discovery request
+	discoveryTimeout = 5 * time.Second
+)
+
+// ErrInvalidStaticIP is returned when a configured static IP cannot be parsed
+var ErrInvalidStaticIP = errors.New("invalid static IP")
+
+// IPDiscoveryConfig controls how the server learns its public IPs for A-record verification
+// IPs from the server FQDN are always used; the options below only govern external discovery
+type IPDiscoveryConfig struct {
+	// Static public IPs; when set, no external discovery is performed
+	StaticIPs []string
+	// Disable contacting third-party services entirely; offline mode
+	// (network.offline) does too
+	Disabled bool
+	// HTTP services returning the caller's IP as plain text (nil = DefaultIPServices)
+	Services []string
+	// STUN servers (host or host:port), tried before the HTTP services
+	STUNServers []string
+}
+
+// SetIPDiscovery configures public IP discovery and clears any cached result
+func (s *Service) SetIPDiscovery(cfg IPDiscoveryConfig) error {
+	var static []net.IP
+	for _, raw := range cfg.StaticIPs {
+		ip := net.ParseIP(strings.TrimSpace(raw))
+		if ip == nil {
+			return fmt.Errorf("%w: %q", ErrInvalidStaticIP, raw)
+		}
+		static = append(static, ip)
+	}
+
+	s.ipsMutex.Lock()
+	defer s.ipsMutex.Unlock()
+	s.ipDiscovery = cfg
+	s.staticIPs = static
+	s.externalIP = nil
+	s.lastExternalCheck = time.Time{}
+	s.lastIPCheck = time.Time{}
+	return nil
+}
+
+// GetServerPublicIPs returns the server's public IP addresses
+func (s *Service) GetServerPublicIPs() []net.IP {
+	s.refreshPublicIPsIfNeeded()
+
+	s.ipsMutex.RLock()
+	defer s.ipsMutex.RUnlock()
+	return s.serverIPs
+}
+
+// RefreshPublicIPs re-resolves the server FQDN
+// A previously discovered external IP is reused until it expires
+func (s *Service) RefreshPublicIPs() {
+	s.refreshPublicIPs()
+}
+
+func (s *Service) refreshPublicIPs() {
+	s.ipsMutex.Lock()
+	defer s.ipsMutex.Unlock()
+
+	var ips []net.IP
+
+	// From FQDN
+	if s.serverFQDN != "" {
+		if resolved, err := s.resolver.LookupIP(s.serverFQDN); err == nil {
+			ips = append(ips, resolved...)
+		}
+	}
+
+	// Static IPs replace external discovery
+	switch {
+	case len(s.staticIPs) > 0:
+		ips = append(ips, s.staticIPs...)
+	case !s.ipDiscovery.Disabled && !outbound.Offline():
+		if s.externalIP == nil || time.Since(s.lastExternalCheck) > externalIPInterval {
+			if ip := s.discoverExternalIP(); ip != nil {
+				s.externalIP = ip
+			}
+			// Record failed attempts too, so an unreachable service is not hammered
+			s.lastExternalCheck = time.Now()
+		}
+		if s.externalIP != nil {
+			ips = append(ips, s.externalIP)
+		}
+	}
+
+	s.serverIPs = ips
+	s.lastIPCheck = time.Now()
+}
+
+func (s *Service) refreshPublicIPsIfNeeded() {
+	s.ipsMutex.RLock()
+	stale := time.Since(s.lastIPCheck) > ipRefreshInterval
+	s.ipsMutex.RUnlock()
+
+	if stale {
+		s.refreshPublicIPs()
+	}
+}
+
+// discoverExternalIP asks the configured STUN servers, then HTTP services, for our address
+func (s *Service) discoverExternalIP() net.IP {
+	for _, server := range s.ipDiscovery.STUNServers {
+		ip, err := stunExternalIP(server)
+		if err == nil {
+			log.Printf("[INFO] domain: public IP %s discovered via stun:%s", ip, server)
+			return ip
+		}
+		log.Printf("[WARN] domain: STUN discovery via %s failed: %v", server, err)
+	}
+
+	services := s.ipDiscovery.Services
+	if services == nil {
+		services = DefaultIPServices
+	}
+	for _, svc := range services {
+		if ip := httpExternalIP(svc); ip != nil {
+			log.Printf("[INFO] domain: public IP %s discovered via %s", ip, svc)
+			return ip
+		}
+	}
+
+	return nil
+}
+
+// httpExternalIP gets the external IP from a plain-text HTTP service
+func httpExternalIP(url string) net.IP {
+	client := outbound.Client(discoveryTimeout)
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 256))
+	if err != nil {
+		return nil
+	}
+
+	return net.ParseIP(strings.TrimSpace(string(body)))
+}
+
+// STUN (RFC 5389) constants
+const (
+	stunBindingRequest   = 0x0001
+	stunBindingSuccess   = 0x0101
+	stunMagicCookie      = 0x2112A442
+	stunMappedAddress    = 0x0001
+	stunXORMappedAddress = 0x0020
+	stunDefaultPort      = "3478"
+)
+
+var errSTUNResponse = errors.New("invalid STUN response")
+
+// stunExternalIP sends a STUN binding request and returns the reflexive address
+func stunExternalIP(server string) (net.IP, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, stunDefaultPort)
+	}
+
+	conn, err := net.DialTimeout("udp", server, discoveryTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(discoveryTimeout))
+
+	// 20-byte header: type, length, magic cookie, 96-bit transaction ID
+	req := make([]byte, 20)
+	binary.BigEndian.PutUint16(req[0:], stunBindingRequest)
+	binary.BigEndian.PutUint32(req[4:], stunMagicCookie)
+	if _, err := rand.Read(req[8:20]); err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(req); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 1024)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	resp := buf[:n]
+	if n < 20 || binary.BigEndian.Uint16(resp[0:]) != stunBindingSuccess || !bytes.Equal(resp[8:20], req[8:20]) {
+		return nil, errSTUNResponse
+	}
+
+	attrs := resp[20:]
+	if length := int(binary.BigEndian.Uint16(resp[2:])); length <= len(attrs) {
+		attrs = attrs[:length]
+	}
+
+	var mapped net.IP
+	for len(attrs) >= 4 {
+		typ := binary.BigEndian.Uint16(attrs[0:])
+		length := int(binary.BigEndian.Uint16(attrs[2:]))
+		if 4+length > len(attrs) {
+			break
+		}
+		value := attrs[4 : 4+length]
+
+		switch typ {
+		case stunXORMappedAddress:
+			// Address is XORed with the magic cookie and transaction ID
+			if ip := stunAddress(value, resp[4:20]); ip != nil {
+				return ip, nil
+			}
+		case stunMappedAddress:
+			mapped = stunAddress(value, nil)
+		}
+
+		// Attributes are padded to 4-byte boundaries
+		next := 4 + (length+3)&^3
+		if next > len(attrs) {
+			break
+		}
+		attrs = attrs[next:]
+	}
+
+	if mapped != nil {
+		return mapped, nil
+	}
+	return nil, errSTUNResponse
+}
+
+// stunAddress decodes a (XOR-)MAPPED-ADDRESS value; key is nil for plain MAPPED-ADDRESS
+func stunAddress(value, key []byte) net.IP {
+	if len(value) < 4 {
+		return nil
+	}
+
+	var size int
+	switch value[1] {
+	case 0x01:
+		size = net.IPv4len
+	case 0x02:
+		size = net.IPv6len
+	default:
+		return nil
+	}
+	if len(value) < 4+size {
+		return nil
+	}
+
+	ip := make(net.IP, size)
+	copy(ip, value[4:4+size])
+	if key != nil {
+		for i := range ip {
+			ip[i] ^= key[i]
+		}
+	}
+	return ip
+}
@@ -0,0 +1,529 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package domain
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// queryTimeout bounds each call to the database, on top of the caller's context
+const queryTimeout = 5 * time.Second
+
+// domainColumns are the columns scanDomain reads, in order
+const domainColumns = `id, owner_type, owner_id, domain, is_apex, is_wildcard,
+	verification_status, verified_at, verified_ip, last_check_at, check_count,
+	ssl_enabled, ssl_status, ssl_challenge, ssl_provider, ssl_credentials,
+	ssl_cert_pem, ssl_key_pem, ssl_issued_at, ssl_expires_at, ssl_last_error,
+	status, suspended_reason, created_at, updated_at,
+	verification_method, verification_token, subdomain_mode`
+
+// sqlStore keeps custom domains in the custom_domains tables of a SQLite or
+// PostgreSQL database
+type sqlStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore returns a Store backed by an open database
+func NewSQLStore(db *sql.DB) Store {
+	return &sqlStore{db: db}
+}
+
+func (s *sqlStore) Insert(ctx context.Context, d *CustomDomain) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO custom_domains (owner_type, owner_id, domain, is_apex, is_wildcard, verification_method, verification_token, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, d.OwnerType, d.OwnerID, d.Domain, boolToInt(d.IsApex), boolToInt(d.IsWildcard), d.VerificationMethod, d.VerificationToken, d.CreatedAt, d.UpdatedAt)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+func (s *sqlStore) GetByID(ctx context.Context, id int64) (*CustomDomain, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	return scanDomain(s.db.QueryRowContext(ctx, "SELECT "+domainColumns+" FROM custom_domains WHERE id = ?", id))
+}
+
+func (s *sqlStore) GetByDomain(ctx context.Context, domain string) (*CustomDomain, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	return scanDomain(s.db.QueryRowContext(ctx, "SELECT "+domainColumns+" FROM custom_domains WHERE LOWER(domain) = LOWER(?)", domain))
+}
+
+func (s *sqlStore) ListByOwner(ctx context.Context, ownerType string, ownerID int64) ([]CustomDomain, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+domainColumns+`
+		FROM custom_domains WHERE owner_type = ? AND owner_id = ?
+		ORDER BY domain
+	`, ownerType, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	return scanDomains(rows)
+}
+
+func (s *sqlStore) List(ctx context.Context, f ListFilter) ([]CustomDomain, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	var where []string
+	var args []interface{}
+	if f.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, f.Status)
+	}
+	if f.SSLStatus != "" {
+		where = append(where, "ssl_status = ?")
+		args = append(args, f.SSLStatus)
+	}
+	if f.VerificationStatus != "" {
+		where = append(where, "verification_status = ?")
+		args = append(args, f.VerificationStatus)
+	}
+	if f.OwnerType != "" {
+		where = append(where, "owner_type = ?")
+		args = append(args, f.OwnerType)
+	}
+	if f.OwnerID > 0 {
+		where = append(where, "owner_id = ?")
+		args = append(args, f.OwnerID)
+	}
+	if f.Search != "" {
+		where = append(where, "domain LIKE ?")
+		args = append(args, "%"+strings.ToLower(f.Search)+"%")
+	}
+
+	clause := ""
+	if len(where) > 0 {
+		clause = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM custom_domains"+clause, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	args = append(args, f.Limit, f.Offset)
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+domainColumns+`
+		FROM custom_domains`+clause+`
+		ORDER BY created_at DESC LIMIT ? OFFSET ?
+	`, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	domains, err := scanDomains(rows)
+	return domains, total, err
+}
+
+func (s *sqlStore) CountByOwner(ctx context.Context, ownerType string, ownerID int64) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	var count int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM custom_domains WHERE owner_type = ? AND owner_id = ?
+	`, ownerType, ownerID).Scan(&count)
+	return count, err
+}
+
+func (s *sqlStore) Delete(ctx context.Context, id int64) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, "DELETE FROM custom_domains WHERE id = ?", id)
+	return err
+}
+
+func (s *sqlStore) DeleteUnverified(ctx context.Context, cutoff int64) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, `
+		DELETE FROM custom_domains
+		WHERE verification_status = ? AND created_at < ?
+	`, VerificationStatusPending, cutoff)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+func (s *sqlStore) SetVerified(ctx context.Context, id int64, verifiedIP string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	now := time.Now().Unix()
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE custom_domains SET
+			verification_status = ?, verified_at = ?, verified_ip = ?,
+			status = CASE WHEN status = ? THEN status ELSE ? END, updated_at = ?
+		WHERE id = ?
+	`, VerificationStatusVerified, now, verifiedIP, StatusSuspended, StatusActive, now, id)
+	return err
+}
+
+func (s *sqlStore) RecordCheck(ctx context.Context, id int64, status string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	now := time.Now().Unix()
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE custom_domains SET
+			verification_status = ?, last_check_at = ?, check_count = check_count + 1, updated_at = ?
+		WHERE id = ?
+	`, status, now, now, id)
+	return err
+}
+
+func (s *sqlStore) SetVerificationMethod(ctx context.Context, id int64, method string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE custom_domains SET verification_method = ?, updated_at = ?
+		WHERE id = ?
+	`, method, time.Now().Unix(), id)
+	return err
+}
+
+func (s *sqlStore) SetVerificationToken(ctx context.Context, id int64, token string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE custom_domains SET verification_token = ?, updated_at = ?
+		WHERE id = ?
+	`, token, time.Now().Unix(), id)
+	return err
+}
+
+func (s *sqlStore) PendingVerifications(ctx context.Context, maxChecks int) ([]int64, error) {
+	return s.queryIDs(ctx, `
+		SELECT id FROM custom_domains
+		WHERE verification_status = ? AND check_count < ?
+	`, VerificationStatusPending, maxChecks)
+}
+
+func (s *sqlStore) SetStatus(ctx context.Context, id int64, status, reason string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	var suspendedReason interface{}
+	if status == StatusSuspended {
+		suspendedReason = reason
+	}
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE custom_domains SET status = ?, suspended_reason = ?, updated_at = ?
+		WHERE id = ?
+	`, status, suspendedReason, time.Now().Unix(), id)
+	return err
+}
+
+func (s *sqlStore) SetSSLConfig(ctx context.Context, id int64, challenge, provider, credentials string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE custom_domains SET
+			ssl_challenge = ?, ssl_provider = ?, ssl_credentials = ?,
+			ssl_status = ?, updated_at = ?
+		WHERE id = ?
+	`, challenge, provider, credentials, SSLStatusPending, time.Now().Unix(), id)
+	return err
+}
+
+func (s *sqlStore) EnableSSL(ctx context.Context, id int64) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE custom_domains SET
+			ssl_enabled = 1, ssl_status = ?, updated_at = ?
+		WHERE id = ?
+	`, SSLStatusPending, time.Now().Unix(), id)
+	return err
+}
+
+func (s *sqlStore) ExpiringCertificates(ctx context.Context, before int64) ([]int64, error) {
+	return s.queryIDs(ctx, `
+		SELECT id FROM custom_domains
+		WHERE ssl_enabled = 1 AND ssl_status = ? AND ssl_expires_at < ?
+	`, SSLStatusActive, before)
+}
+
+// queryIDs runs a query selecting domain IDs
+func (s *sqlStore) queryIDs(ctx context.Context, query string, args ...interface{}) ([]int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (s *sqlStore) AddAudit(ctx context.Context, domainID int64, e AuditEntry) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	var details interface{}
+	if e.Details != "" {
+		details = e.Details
+	}
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO custom_domain_audit (domain_id, action, actor_type, actor_id, details, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, domainID, e.Action, e.ActorType, e.ActorID, details, e.CreatedAt)
+	return err
+}
+
+func (s *sqlStore) Audit(ctx context.Context, domainID int64, limit int) ([]AuditEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT action, actor_type, actor_id, details, created_at
+		FROM custom_domain_audit WHERE domain_id = ?
+		ORDER BY created_at DESC, id DESC LIMIT ?
+	`, domainID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		var actorID sql.NullInt64
+		var details sql.NullString
+		if err := rows.Scan(&e.Action, &e.ActorType, &actorID, &details, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.ActorID = actorID.Int64
+		e.Details = details.String
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+func (s *sqlStore) SetSubdomainMode(ctx context.Context, id int64, mode string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE custom_domains SET subdomain_mode = ?, updated_at = ?
+		WHERE id = ?
+	`, mode, time.Now().Unix(), id)
+	return err
+}
+
+func (s *sqlStore) SubdomainUser(ctx context.Context, domainID int64, label string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	var userID int64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT user_id FROM custom_domain_subdomains WHERE domain_id = ? AND label = ?
+	`, domainID, label).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, ErrUserNotFound
+	}
+	return userID, err
+}
+
+func (s *sqlStore) SetSubdomainMapping(ctx context.Context, domainID int64, label string, userID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO custom_domain_subdomains (domain_id, label, user_id, created_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(domain_id, label) DO UPDATE SET user_id = excluded.user_id
+	`, domainID, label, userID, time.Now().Unix())
+	return err
+}
+
+func (s *sqlStore) DeleteSubdomainMapping(ctx context.Context, domainID int64, label string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, `
+		DELETE FROM custom_domain_subdomains WHERE domain_id = ? AND label = ?
+	`, domainID, label)
+	if err != nil {
+		return err
+	}
+	affected, _ := result.RowsAffected()
+	if affected == 0 {
+		return ErrDomainNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) SubdomainMappings(ctx context.Context, domainID int64) ([]SubdomainMapping, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT m.label, m.user_id, u.username, m.created_at
+		FROM custom_domain_subdomains m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.domain_id = ?
+		ORDER BY m.label
+	`, domainID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mappings []SubdomainMapping
+	for rows.Next() {
+		var m SubdomainMapping
+		if err := rows.Scan(&m.Label, &m.UserID, &m.Username, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		mappings = append(mappings, m)
+	}
+	return mappings, rows.Err()
+}
+
+func (s *sqlStore) OwnerMember(ctx context.Context, ownerType string, ownerID int64, username string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	var userID int64
+	var err error
+	if ownerType == OwnerTypeOrg {
+		err = s.db.QueryRowContext(ctx, `
+			SELECT u.id FROM users u
+			JOIN org_members m ON m.user_id = u.id
+			WHERE m.org_id = ? AND LOWER(u.username) = LOWER(?)
+		`, ownerID, username).Scan(&userID)
+	} else {
+		err = s.db.QueryRowContext(ctx, `
+			SELECT id FROM users WHERE id = ? AND LOWER(username) = LOWER(?)
+		`, ownerID, username).Scan(&userID)
+	}
+	if err == sql.ErrNoRows {
+		return 0, ErrUserNotFound
+	}
+	return userID, err
+}
+
+// scanner is a *sql.Row or *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanDomains(rows *sql.Rows) ([]CustomDomain, error) {
+	defer rows.Close()
+
+	var domains []CustomDomain
+	for rows.Next() {
+		d, err := scanDomain(rows)
+		if err != nil {
+			return nil, err
+		}
+		domains = append(domains, *d)
+	}
+	return domains, rows.Err()
+}
+
+func scanDomain(row scanner) (*CustomDomain, error) {
+	d := &CustomDomain{}
+	var isApex, isWildcard, sslEnabled int
+	var verifiedAt, lastCheckAt, sslIssuedAt, sslExpiresAt sql.NullInt64
+	var verifiedIP, sslChallenge, sslProvider, sslCredentials, sslCertPEM, sslKeyPEM, sslLastError, suspendedReason sql.NullString
+	var verificationMethod, verificationToken, subdomainMode sql.NullString
+
+	err := row.Scan(
+		&d.ID, &d.OwnerType, &d.OwnerID, &d.Domain, &isApex, &isWildcard,
+		&d.VerificationStatus, &verifiedAt, &verifiedIP, &lastCheckAt, &d.CheckCount,
+		&sslEnabled, &d.SSLStatus, &sslChallenge, &sslProvider, &sslCredentials,
+		&sslCertPEM, &sslKeyPEM, &sslIssuedAt, &sslExpiresAt, &sslLastError,
+		&d.Status, &suspendedReason, &d.CreatedAt, &d.UpdatedAt,
+		&verificationMethod, &verificationToken, &subdomainMode,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrDomainNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	d.IsApex = isApex == 1
+	d.IsWildcard = isWildcard == 1
+	d.SSLEnabled = sslEnabled == 1
+
+	if verifiedAt.Valid {
+		d.VerifiedAt = &verifiedAt.Int64
+	}
+	if lastCheckAt.Valid {
+		d.LastCheckAt = &lastCheckAt.Int64
+	}
+	if sslIssuedAt.Valid {
+		d.SSLIssuedAt = &sslIssuedAt.Int64
+	}
+	if sslExpiresAt.Valid {
+		d.SSLExpiresAt = &sslExpiresAt.Int64
+	}
+	d.VerifiedIP = verifiedIP.String
+	d.SSLChallenge = sslChallenge.String
+	d.SSLProvider = sslProvider.String
+	d.SSLCredentials = sslCredentials.String
+	d.SSLCertPEM = sslCertPEM.String
+	d.SSLKeyPEM = sslKeyPEM.String
+	d.SSLLastError = sslLastError.String
+	d.SuspendedReason = suspendedReason.String
+	d.VerificationMethod = verificationMethod.String
+	if d.VerificationMethod == "" {
+		d.VerificationMethod = VerificationMethodARecord
+	}
+	d.VerificationToken = verificationToken.String
+	if d.IsWildcard {
+		d.SubdomainMode = subdomainMode.String
+		if d.SubdomainMode == "" {
+			d.SubdomainMode = SubdomainModeOwner
+		}
+	}
+
+	return d, nil
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,65 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package domain
+
+import (
+	"context"
+)
+
+// Store persists custom domains, their audit history and subdomain mappings
+// Implementations return ErrDomainNotFound for missing domains, and leave
+// SSLCredentials as stored; the Service validates, verifies and encrypts
+type Store interface {
+	// Insert adds a domain and returns its ID
+	Insert(ctx context.Context, d *CustomDomain) (int64, error)
+	GetByID(ctx context.Context, id int64) (*CustomDomain, error)
+	// GetByDomain matches the name case-insensitively
+	GetByDomain(ctx context.Context, domain string) (*CustomDomain, error)
+	// ListByOwner lists an owner's domains by name
+	ListByOwner(ctx context.Context, ownerType string, ownerID int64) ([]CustomDomain, error)
+	// List returns a page of matching domains, newest first, and the match count
+	List(ctx context.Context, f ListFilter) ([]CustomDomain, int, error)
+	CountByOwner(ctx context.Context, ownerType string, ownerID int64) (int, error)
+	Delete(ctx context.Context, id int64) error
+	// DeleteUnverified removes domains still pending verification that were
+	// created before cutoff, and returns how many were removed
+	DeleteUnverified(ctx context.Context, cutoff int64) (int64, error)
+
+	// SetVerified records a successful verification; the domain becomes
+	// active unless it is suspended
+	SetVerified(ctx context.Context, id int64, verifiedIP string) error
+	// RecordCheck sets the verification status and counts a check
+	RecordCheck(ctx context.Context, id int64, status string) error
+	SetVerificationMethod(ctx context.Context, id int64, method string) error
+	SetVerificationToken(ctx context.Context, id int64, token string) error
+	// PendingVerifications lists domains pending verification checked fewer
+	// than maxChecks times
+	PendingVerifications(ctx context.Context, maxChecks int) ([]int64, error)
+	// SetStatus changes the status; reason is kept for suspended domains only
+	SetStatus(ctx context.Context, id int64, status, reason string) error
+
+	// SetSSLConfig stores how certificates are issued and marks SSL pending
+	SetSSLConfig(ctx context.Context, id int64, challenge, provider, credentials string) error
+	// EnableSSL turns SSL on with a pending certificate
+	EnableSSL(ctx context.Context, id int64) error
+	// ExpiringCertificates lists domains with an active certificate expiring before t
+	ExpiringCertificates(ctx context.Context, before int64) ([]int64, error)
+
+	AddAudit(ctx context.Context, domainID int64, e AuditEntry) error
+	// Audit returns up to limit entries, newest first
+	Audit(ctx context.Context, domainID int64, limit int) ([]AuditEntry, error)
+
+	SetSubdomainMode(ctx context.Context, id int64, mode string) error
+	// SubdomainUser returns the user a label is mapped to, or ErrUserNotFound
+	SubdomainUser(ctx context.Context, domainID int64, label string) (int64, error)
+	SetSubdomainMapping(ctx context.Context, domainID int64, label string, userID int64) error
+	// DeleteSubdomainMapping returns ErrDomainNotFound when there was no mapping
+	DeleteSubdomainMapping(ctx context.Context, domainID int64, label string) error
+	SubdomainMappings(ctx context.Context, domainID int64) ([]SubdomainMapping, error)
+	// OwnerMember finds a user by name among the members of an org, or
+	// matches the user that owns a domain; ErrUserNotFound if there is none
+	OwnerMember(ctx context.Context, ownerType string, ownerID int64, username string) (int64, error)
+}
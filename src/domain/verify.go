@@ -0,0 +1,147 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package domain
+
+import (
+	"context"
+	"strings"
+
+	"github.com/casjay-forks/caspaste/src/securetoken"
+)
+
+// ChallengePrefix is the label under which TXT verification records live
+const ChallengePrefix = "_caspaste-challenge"
+
+// ChallengeName returns the TXT record name for a domain
+// Wildcard domains are verified on their base domain
+func ChallengeName(domain string) string {
+	return ChallengePrefix + "." + strings.TrimPrefix(domain, "*.")
+}
+
+func generateVerificationToken() (string, error) {
+	token, err := securetoken.Hex(16)
+	if err != nil {
+		return "", err
+	}
+	return "caspaste-verify=" + token, nil
+}
+
+// ensureVerificationToken assigns a token to domains created before TXT verification existed
+func (s *Service) ensureVerificationToken(ctx context.Context, d *CustomDomain) error {
+	if d.VerificationToken != "" {
+		return nil
+	}
+
+	token, err := generateVerificationToken()
+	if err != nil {
+		return err
+	}
+	if err := s.store.SetVerificationToken(ctx, d.ID, token); err != nil {
+		return err
+	}
+	d.VerificationToken = token
+	return nil
+}
+
+// verifyARecord checks that the domain resolves to one of the server's IPs
+func (s *Service) verifyARecord(d *CustomDomain) *VerifyResult {
+	// Refresh server IPs if stale
+	s.refreshPublicIPsIfNeeded()
+
+	// Resolve the domain
+	ips, err := s.resolver.LookupIP(probeName(d.Domain))
+	if err != nil {
+		return &VerifyResult{
+			OK:      false,
+			Error:   "DNS_LOOKUP_FAILED",
+			Message: "DNS lookup failed. Please check your DNS configuration.",
+		}
+	}
+
+	// Check if any resolved IP matches server IP
+	serverIPs := s.GetServerPublicIPs()
+	var resolvedIPs []string
+	var matchedIP string
+
+	for _, ip := range ips {
+		resolvedIPs = append(resolvedIPs, ip.String())
+		for _, serverIP := range serverIPs {
+			if matchedIP == "" && ip.Equal(serverIP) {
+				matchedIP = ip.String()
+			}
+		}
+	}
+
+	if matchedIP == "" {
+		return &VerifyResult{
+			OK:         false,
+			Error:      "DNS_MISMATCH",
+			Message:    "Domain does not resolve to this server. If it is behind a CDN, use TXT verification instead.",
+			ResolvedTo: resolvedIPs,
+		}
+	}
+
+	return &VerifyResult{OK: true, ResolvedTo: resolvedIPs, verifiedIP: matchedIP}
+}
+
+// verifyTXT checks for the domain's challenge token in a TXT record
+func (s *Service) verifyTXT(d *CustomDomain) *VerifyResult {
+	name := ChallengeName(d.Domain)
+	records, err := s.resolver.LookupTXT(name)
+	if err != nil {
+		return &VerifyResult{
+			OK:      false,
+			Error:   "DNS_LOOKUP_FAILED",
+			Message: "No TXT record found at " + name + ". DNS propagation can take up to 48 hours.",
+		}
+	}
+
+	for _, record := range records {
+		if strings.TrimSpace(record) == d.VerificationToken {
+			return &VerifyResult{OK: true, ResolvedTo: records}
+		}
+	}
+
+	return &VerifyResult{
+		OK:         false,
+		Error:      "TXT_MISMATCH",
+		Message:    "TXT record at " + name + " does not contain the verification token.",
+		ResolvedTo: records,
+	}
+}
+
+// verifyCNAME checks that the domain is an alias of the server FQDN
+func (s *Service) verifyCNAME(d *CustomDomain) *VerifyResult {
+	if s.serverFQDN == "" {
+		return &VerifyResult{
+			OK:      false,
+			Error:   "NO_SERVER_FQDN",
+			Message: "CNAME verification requires the server FQDN to be configured.",
+		}
+	}
+
+	cname, err := s.resolver.LookupCNAME(probeName(d.Domain))
+	if err != nil {
+		return &VerifyResult{
+			OK:      false,
+			Error:   "DNS_LOOKUP_FAILED",
+			Message: "DNS lookup failed. Please check your DNS configuration.",
+		}
+	}
+
+	target := strings.TrimSuffix(strings.ToLower(cname), ".")
+	if target != strings.TrimSuffix(strings.ToLower(s.serverFQDN), ".") {
+		return &VerifyResult{
+			OK:         false,
+			Error:      "CNAME_MISMATCH",
+			Message:    "Domain is not a CNAME of " + s.serverFQDN + ".",
+			ResolvedTo: []string{target},
+		}
+	}
+
+	return &VerifyResult{OK: true, ResolvedTo: []string{target}}
+}
@@ -0,0 +1,212 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package domain
+
+import (
+	"context"
+	"errors"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// Subdomain modes for wildcard domains
+const (
+	// SubdomainModeOwner serves every subdomain as the domain owner
+	SubdomainModeOwner = "owner"
+	// SubdomainModeMembers maps member.example.com to the org member (or user) with that username
+	SubdomainModeMembers = "members"
+)
+
+// SSL challenge constants
+const (
+	SSLChallengeHTTP01    = "http-01"
+	SSLChallengeTLSALPN01 = "tls-alpn-01"
+	SSLChallengeDNS01     = "dns-01"
+)
+
+// Wildcard errors
+var (
+	ErrWildcardRequiresDNS01 = errors.New("wildcard certificates require the dns-01 challenge")
+	ErrInvalidSubdomainMode  = errors.New("invalid subdomain mode")
+	ErrNotWildcard           = errors.New("domain is not a wildcard domain")
+	ErrInvalidLabel          = errors.New("invalid subdomain label")
+	ErrUserNotFound          = errors.New("user not found")
+)
+
+// labelRegex matches a single DNS label
+var labelRegex = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// HostMatch is the result of resolving a request host to a custom domain
+type HostMatch struct {
+	Domain *CustomDomain
+	// Label is the subdomain matched by a wildcard (empty for exact matches)
+	Label string
+	// UserID is the user a wildcard subdomain maps to (0 = domain owner)
+	UserID int64
+}
+
+// SubdomainMapping maps one label of a wildcard domain to a user
+type SubdomainMapping struct {
+	Label     string `json:"label"`
+	UserID    int64  `json:"user_id"`
+	Username  string `json:"username"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// MatchWildcard reports whether host is covered by a wildcard pattern and returns the matched label
+// Like TLS certificates, a wildcard covers exactly one label: *.example.com matches
+// a.example.com but not example.com or a.b.example.com
+func MatchWildcard(pattern, host string) (string, bool) {
+	if !strings.HasPrefix(pattern, "*.") {
+		return "", false
+	}
+	suffix := pattern[1:]
+	if !strings.HasSuffix(host, suffix) {
+		return "", false
+	}
+	label := strings.TrimSuffix(host, suffix)
+	if label == "" || strings.Contains(label, ".") {
+		return "", false
+	}
+	return label, true
+}
+
+// ResolveHost finds the active custom domain serving a request host
+// Exact matches win over wildcards. Returns ErrDomainNotFound when nothing matches.
+func (s *Service) ResolveHost(ctx context.Context, host string) (*HostMatch, error) {
+	host = NormalizeDomain(host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(host, ".")
+
+	if d, err := s.GetByDomain(ctx, host); err == nil {
+		if d.Status != StatusActive {
+			return nil, ErrDomainNotFound
+		}
+		return &HostMatch{Domain: d}, nil
+	}
+
+	// Try the wildcard one level up
+	dot := strings.Index(host, ".")
+	if dot <= 0 {
+		return nil, ErrDomainNotFound
+	}
+	d, err := s.GetByDomain(ctx, "*"+host[dot:])
+	if err != nil || d.Status != StatusActive {
+		return nil, ErrDomainNotFound
+	}
+
+	label, _ := MatchWildcard(d.Domain, host)
+	match := &HostMatch{Domain: d, Label: label}
+
+	// Explicit mappings take priority over the subdomain mode
+	userID, err := s.store.SubdomainUser(ctx, d.ID, label)
+	if err == nil {
+		match.UserID = userID
+		return match, nil
+	}
+
+	if d.SubdomainMode == SubdomainModeMembers {
+		userID, err := s.lookupMember(ctx, d, label)
+		if err != nil {
+			return nil, ErrDomainNotFound
+		}
+		match.UserID = userID
+	}
+
+	return match, nil
+}
+
+// HostResolver adapts ResolveHost for web.CustomDomainMiddleware
+func (s *Service) HostResolver() func(ctx context.Context, host string) (interface{}, bool) {
+	return func(ctx context.Context, host string) (interface{}, bool) {
+		match, err := s.ResolveHost(ctx, host)
+		if err != nil {
+			return nil, false
+		}
+		return match, true
+	}
+}
+
+// lookupMember resolves a subdomain label to a member of the domain owner
+func (s *Service) lookupMember(ctx context.Context, d *CustomDomain, username string) (int64, error) {
+	return s.store.OwnerMember(ctx, d.OwnerType, d.OwnerID, username)
+}
+
+// SetSubdomainMode sets how a wildcard domain maps subdomains
+func (s *Service) SetSubdomainMode(ctx context.Context, id int64, mode string) error {
+	if mode != SubdomainModeOwner && mode != SubdomainModeMembers {
+		return ErrInvalidSubdomainMode
+	}
+
+	d, err := s.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !d.IsWildcard {
+		return ErrNotWildcard
+	}
+
+	if err := s.store.SetSubdomainMode(ctx, id, mode); err != nil {
+		return err
+	}
+
+	details := "mode=" + mode
+	s.logAudit(ctx, id, "subdomain_mode_changed", d.OwnerType, d.OwnerID, &details)
+	return nil
+}
+
+// SetSubdomainMapping maps a label of a wildcard domain to a user
+// For org domains the user must be a member of the org
+func (s *Service) SetSubdomainMapping(ctx context.Context, id int64, label, username string) error {
+	label = strings.ToLower(strings.TrimSpace(label))
+	if !labelRegex.MatchString(label) {
+		return ErrInvalidLabel
+	}
+
+	d, err := s.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !d.IsWildcard {
+		return ErrNotWildcard
+	}
+
+	userID, err := s.lookupMember(ctx, d, username)
+	if err != nil {
+		return err
+	}
+
+	if err := s.store.SetSubdomainMapping(ctx, id, label, userID); err != nil {
+		return err
+	}
+
+	details := "label=" + label
+	s.logAudit(ctx, id, "subdomain_mapped", d.OwnerType, d.OwnerID, &details)
+	return nil
+}
+
+// DeleteSubdomainMapping removes an explicit subdomain mapping
+func (s *Service) DeleteSubdomainMapping(ctx context.Context, id int64, label string) error {
+	return s.store.DeleteSubdomainMapping(ctx, id, strings.ToLower(label))
+}
+
+// ListSubdomainMappings lists explicit subdomain mappings for a domain
+func (s *Service) ListSubdomainMappings(ctx context.Context, id int64) ([]SubdomainMapping, error) {
+	return s.store.SubdomainMappings(ctx, id)
+}
+
+// probeName returns a concrete name to resolve when verifying a domain
+// Wildcards are checked via a fixed label since "*" itself cannot be queried
+func probeName(domain string) string {
+	if strings.HasPrefix(domain, "*.") {
+		return "caspaste-probe" + domain[1:]
+	}
+	return domain
+}
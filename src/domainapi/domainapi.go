@@ -51,6 +51,23 @@ type APIResponse struct {
 // AddDomainRequest is the request body for adding a custom domain
 type AddDomainRequest struct {
 	Domain string `json:"domain"`
+	// Method is the verification method: a_record (default), txt or cname
+	Method string `json:"method,omitempty"`
+}
+
+// VerifyDomainRequest is the optional request body for verifying a domain
+type VerifyDomainRequest struct {
+	// Method switches the verification method before verifying
+	Method string `json:"method,omitempty"`
+}
+
+// SubdomainRequest is the request body for wildcard subdomain settings
+type SubdomainRequest struct {
+	// Mode is owner or members (PUT)
+	Mode string `json:"mode,omitempty"`
+	// Label and Username add an explicit mapping (POST)
+	Label    string `json:"label,omitempty"`
+	Username string `json:"username,omitempty"`
 }
 
 // ConfigureSSLRequest is the request body for configuring SSL
@@ -76,7 +93,7 @@ func (s *Service) HandleListUserDomains(w http.ResponseWriter, r *http.Request)
 		return writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required")
 	}
 
-	domains, err := s.domainService.GetByOwner("user", authUser.ID)
+	domains, err := s.domainService.GetByOwner(r.Context(), "user", authUser.ID)
 	if err != nil {
 		return writeError(w, r, http.StatusInternalServerError, "LIST_FAILED", "Failed to list domains")
 	}
@@ -103,7 +120,7 @@ func (s *Service) HandleAddUserDomain(w http.ResponseWriter, r *http.Request) er
 
 	// Check domain limit
 	if s.config.MaxDomainsPerUser > 0 {
-		existing, _ := s.domainService.GetByOwner("user", authUser.ID)
+		existing, _ := s.domainService.GetByOwner(r.Context(), "user", authUser.ID)
 		if len(existing) >= s.config.MaxDomainsPerUser {
 			return writeError(w, r, http.StatusBadRequest, "LIMIT_REACHED", "Maximum number of domains reached")
 		}
@@ -122,7 +139,7 @@ func (s *Service) HandleAddUserDomain(w http.ResponseWriter, r *http.Request) er
 	domainStr := strings.ToLower(strings.TrimSpace(req.Domain))
 
 	// Check domain type restrictions
-	isApex := !strings.Contains(domainStr, ".")
+	isApex := domain.IsApexDomain(domainStr)
 	isWildcard := strings.HasPrefix(domainStr, "*.")
 
 	if isApex && !s.config.AllowApex {
@@ -135,6 +152,10 @@ func (s *Service) HandleAddUserDomain(w http.ResponseWriter, r *http.Request) er
 		return writeError(w, r, http.StatusBadRequest, "SUBDOMAIN_NOT_ALLOWED", "Subdomains are not allowed")
 	}
 
+	if req.Method != "" && !domain.IsValidVerificationMethod(req.Method) {
+		return writeError(w, r, http.StatusBadRequest, "INVALID_METHOD", "Verification method must be a_record, txt or cname")
+	}
+
 	// Check reserved domains
 	for _, reserved := range s.config.Reserved {
 		if matchDomain(domainStr, reserved) {
@@ -143,20 +164,33 @@ func (s *Service) HandleAddUserDomain(w http.ResponseWriter, r *http.Request) er
 	}
 
 	// Create domain
-	newDomain, err := s.domainService.Create("user", authUser.ID, domainStr)
+	newDomain, err := s.domainService.Create(r.Context(), "user", authUser.ID, domainStr)
 	if err != nil {
 		switch {
 		case errors.Is(err, domain.ErrDomainTaken):
 			return writeError(w, r, http.StatusConflict, "DOMAIN_TAKEN", "This domain is already registered")
 		case errors.Is(err, domain.ErrInvalidDomain):
 			return writeError(w, r, http.StatusBadRequest, "INVALID_DOMAIN", "Invalid domain format")
+		case errors.Is(err, domain.ErrPublicSuffix):
+			return writeError(w, r, http.StatusBadRequest, "PUBLIC_SUFFIX", "Public suffixes cannot be registered")
+		case errors.Is(err, domain.ErrConfusableDomain):
+			return writeError(w, r, http.StatusBadRequest, "CONFUSABLE_DOMAIN", "Domain mixes look-alike characters from different scripts")
+		case errors.Is(err, domain.ErrReservedDomain):
+			return writeError(w, r, http.StatusBadRequest, "DOMAIN_RESERVED", "This domain is reserved")
 		default:
 			return writeError(w, r, http.StatusInternalServerError, "CREATE_FAILED", "Failed to add domain")
 		}
 	}
 
+	if req.Method != "" {
+		if err := s.domainService.SetVerificationMethod(r.Context(), newDomain.ID, req.Method); err != nil {
+			return writeError(w, r, http.StatusBadRequest, "INVALID_METHOD", "Verification method must be a_record, txt or cname")
+		}
+		newDomain, _ = s.domainService.GetByID(r.Context(), newDomain.ID)
+	}
+
 	// Get DNS instructions
-	instructions, _ := s.domainService.GetDNSInstructions(newDomain.ID)
+	instructions, _ := s.domainService.GetDNSInstructions(r.Context(), newDomain.ID)
 
 	return writeSuccess(w, r, map[string]interface{}{
 		"domain":       newDomain,
@@ -179,7 +213,7 @@ func (s *Service) HandleGetUserDomain(w http.ResponseWriter, r *http.Request, do
 		return writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required")
 	}
 
-	d, err := s.domainService.GetByDomain(domainStr)
+	d, err := s.domainService.GetByDomain(r.Context(), domainStr)
 	if err != nil {
 		return writeError(w, r, http.StatusNotFound, "DOMAIN_NOT_FOUND", "Domain not found")
 	}
@@ -207,7 +241,7 @@ func (s *Service) HandleDeleteUserDomain(w http.ResponseWriter, r *http.Request,
 		return writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required")
 	}
 
-	d, err := s.domainService.GetByDomain(domainStr)
+	d, err := s.domainService.GetByDomain(r.Context(), domainStr)
 	if err != nil {
 		return writeError(w, r, http.StatusNotFound, "DOMAIN_NOT_FOUND", "Domain not found")
 	}
@@ -217,7 +251,7 @@ func (s *Service) HandleDeleteUserDomain(w http.ResponseWriter, r *http.Request,
 		return writeError(w, r, http.StatusNotFound, "DOMAIN_NOT_FOUND", "Domain not found")
 	}
 
-	if err := s.domainService.Delete(d.ID); err != nil {
+	if err := s.domainService.Delete(r.Context(), d.ID); err != nil {
 		return writeError(w, r, http.StatusInternalServerError, "DELETE_FAILED", "Failed to delete domain")
 	}
 
@@ -239,7 +273,7 @@ func (s *Service) HandleVerifyUserDomain(w http.ResponseWriter, r *http.Request,
 		return writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required")
 	}
 
-	d, err := s.domainService.GetByDomain(domainStr)
+	d, err := s.domainService.GetByDomain(r.Context(), domainStr)
 	if err != nil {
 		return writeError(w, r, http.StatusNotFound, "DOMAIN_NOT_FOUND", "Domain not found")
 	}
@@ -257,8 +291,16 @@ func (s *Service) HandleVerifyUserDomain(w http.ResponseWriter, r *http.Request,
 		}, "Already verified", "Domain is already verified")
 	}
 
+	// Optionally switch verification method
+	var req VerifyDomainRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err == nil && req.Method != "" {
+		if err := s.domainService.SetVerificationMethod(r.Context(), d.ID, req.Method); err != nil {
+			return writeError(w, r, http.StatusBadRequest, "INVALID_METHOD", "Verification method must be a_record, txt or cname")
+		}
+	}
+
 	// Attempt verification
-	result, err := s.domainService.Verify(d.ID)
+	result, err := s.domainService.Verify(r.Context(), d.ID)
 	if err != nil {
 		return writeError(w, r, http.StatusInternalServerError, "VERIFY_FAILED", "Verification failed")
 	}
@@ -291,7 +333,7 @@ func (s *Service) HandleGetUserDomainDNS(w http.ResponseWriter, r *http.Request,
 		return writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required")
 	}
 
-	d, err := s.domainService.GetByDomain(domainStr)
+	d, err := s.domainService.GetByDomain(r.Context(), domainStr)
 	if err != nil {
 		return writeError(w, r, http.StatusNotFound, "DOMAIN_NOT_FOUND", "Domain not found")
 	}
@@ -301,7 +343,7 @@ func (s *Service) HandleGetUserDomainDNS(w http.ResponseWriter, r *http.Request,
 		return writeError(w, r, http.StatusNotFound, "DOMAIN_NOT_FOUND", "Domain not found")
 	}
 
-	instructions, err := s.domainService.GetDNSInstructions(d.ID)
+	instructions, err := s.domainService.GetDNSInstructions(r.Context(), d.ID)
 	if err != nil {
 		return writeError(w, r, http.StatusInternalServerError, "DNS_ERROR", "Failed to get DNS instructions")
 	}
@@ -324,7 +366,7 @@ func (s *Service) HandleGetUserDomainSSL(w http.ResponseWriter, r *http.Request,
 		return writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required")
 	}
 
-	d, err := s.domainService.GetByDomain(domainStr)
+	d, err := s.domainService.GetByDomain(r.Context(), domainStr)
 	if err != nil {
 		return writeError(w, r, http.StatusNotFound, "DOMAIN_NOT_FOUND", "Domain not found")
 	}
@@ -358,7 +400,7 @@ func (s *Service) HandleConfigureUserDomainSSL(w http.ResponseWriter, r *http.Re
 		return writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required")
 	}
 
-	d, err := s.domainService.GetByDomain(domainStr)
+	d, err := s.domainService.GetByDomain(r.Context(), domainStr)
 	if err != nil {
 		return writeError(w, r, http.StatusNotFound, "DOMAIN_NOT_FOUND", "Domain not found")
 	}
@@ -383,17 +425,20 @@ func (s *Service) HandleConfigureUserDomainSSL(w http.ResponseWriter, r *http.Re
 	}
 
 	// Configure SSL
-	if err := s.domainService.ConfigureSSL(d.ID, req.Challenge, req.Provider, req.Credentials); err != nil {
+	if err := s.domainService.ConfigureSSL(r.Context(), d.ID, req.Challenge, req.Provider, req.Credentials); err != nil {
+		if errors.Is(err, domain.ErrWildcardRequiresDNS01) {
+			return writeError(w, r, http.StatusBadRequest, "DNS01_REQUIRED", "Wildcard domains require the dns-01 challenge")
+		}
 		return writeError(w, r, http.StatusInternalServerError, "SSL_CONFIGURE_FAILED", "Failed to configure SSL")
 	}
 
 	// Issue certificate
-	if err := s.domainService.IssueCertificate(d.ID); err != nil {
+	if err := s.domainService.IssueCertificate(r.Context(), d.ID); err != nil {
 		return writeError(w, r, http.StatusInternalServerError, "SSL_ISSUE_FAILED", "Failed to issue SSL certificate")
 	}
 
 	// Get updated domain
-	d, _ = s.domainService.GetByDomain(domainStr)
+	d, _ = s.domainService.GetByDomain(r.Context(), domainStr)
 
 	return writeSuccess(w, r, map[string]interface{}{
 		"ssl_enabled": d.SSLEnabled,
@@ -419,17 +464,17 @@ func (s *Service) HandleListOrgDomains(w http.ResponseWriter, r *http.Request, s
 		return writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required")
 	}
 
-	o, err := s.orgService.GetBySlug(slug)
+	o, err := s.orgService.GetBySlug(r.Context(), slug)
 	if err != nil {
 		return writeError(w, r, http.StatusNotFound, "ORG_NOT_FOUND", "Organization not found")
 	}
 
 	// Check membership
-	if !s.orgService.IsMember(o.ID, authUser.ID) {
+	if !s.orgService.IsMember(r.Context(), o.ID, authUser.ID) {
 		return writeError(w, r, http.StatusForbidden, "FORBIDDEN", "You must be a member to view domains")
 	}
 
-	domains, err := s.domainService.GetByOwner("org", o.ID)
+	domains, err := s.domainService.GetByOwner(r.Context(), "org", o.ID)
 	if err != nil {
 		return writeError(w, r, http.StatusInternalServerError, "LIST_FAILED", "Failed to list domains")
 	}
@@ -454,20 +499,20 @@ func (s *Service) HandleAddOrgDomain(w http.ResponseWriter, r *http.Request, slu
 		return writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required")
 	}
 
-	o, err := s.orgService.GetBySlug(slug)
+	o, err := s.orgService.GetBySlug(r.Context(), slug)
 	if err != nil {
 		return writeError(w, r, http.StatusNotFound, "ORG_NOT_FOUND", "Organization not found")
 	}
 
 	// Check permission (admin or owner)
-	role := s.orgService.GetMemberRole(o.ID, authUser.ID)
+	role := s.orgService.GetMemberRole(r.Context(), o.ID, authUser.ID)
 	if role != "owner" && role != "admin" {
 		return writeError(w, r, http.StatusForbidden, "FORBIDDEN", "You don't have permission to add domains")
 	}
 
 	// Check domain limit
 	if s.config.MaxDomainsPerOrg > 0 {
-		existing, _ := s.domainService.GetByOwner("org", o.ID)
+		existing, _ := s.domainService.GetByOwner(r.Context(), "org", o.ID)
 		if len(existing) >= s.config.MaxDomainsPerOrg {
 			return writeError(w, r, http.StatusBadRequest, "LIMIT_REACHED", "Maximum number of domains reached")
 		}
@@ -484,6 +529,10 @@ func (s *Service) HandleAddOrgDomain(w http.ResponseWriter, r *http.Request, slu
 
 	domainStr := strings.ToLower(strings.TrimSpace(req.Domain))
 
+	if req.Method != "" && !domain.IsValidVerificationMethod(req.Method) {
+		return writeError(w, r, http.StatusBadRequest, "INVALID_METHOD", "Verification method must be a_record, txt or cname")
+	}
+
 	// Check reserved domains
 	for _, reserved := range s.config.Reserved {
 		if matchDomain(domainStr, reserved) {
@@ -491,19 +540,32 @@ func (s *Service) HandleAddOrgDomain(w http.ResponseWriter, r *http.Request, slu
 		}
 	}
 
-	newDomain, err := s.domainService.Create("org", o.ID, domainStr)
+	newDomain, err := s.domainService.Create(r.Context(), "org", o.ID, domainStr)
 	if err != nil {
 		switch {
 		case errors.Is(err, domain.ErrDomainTaken):
 			return writeError(w, r, http.StatusConflict, "DOMAIN_TAKEN", "This domain is already registered")
 		case errors.Is(err, domain.ErrInvalidDomain):
 			return writeError(w, r, http.StatusBadRequest, "INVALID_DOMAIN", "Invalid domain format")
+		case errors.Is(err, domain.ErrPublicSuffix):
+			return writeError(w, r, http.StatusBadRequest, "PUBLIC_SUFFIX", "Public suffixes cannot be registered")
+		case errors.Is(err, domain.ErrConfusableDomain):
+			return writeError(w, r, http.StatusBadRequest, "CONFUSABLE_DOMAIN", "Domain mixes look-alike characters from different scripts")
+		case errors.Is(err, domain.ErrReservedDomain):
+			return writeError(w, r, http.StatusBadRequest, "DOMAIN_RESERVED", "This domain is reserved")
 		default:
 			return writeError(w, r, http.StatusInternalServerError, "CREATE_FAILED", "Failed to add domain")
 		}
 	}
 
-	instructions, _ := s.domainService.GetDNSInstructions(newDomain.ID)
+	if req.Method != "" {
+		if err := s.domainService.SetVerificationMethod(r.Context(), newDomain.ID, req.Method); err != nil {
+			return writeError(w, r, http.StatusBadRequest, "INVALID_METHOD", "Verification method must be a_record, txt or cname")
+		}
+		newDomain, _ = s.domainService.GetByID(r.Context(), newDomain.ID)
+	}
+
+	instructions, _ := s.domainService.GetDNSInstructions(r.Context(), newDomain.ID)
 
 	return writeSuccess(w, r, map[string]interface{}{
 		"domain":       newDomain,
@@ -526,17 +588,17 @@ func (s *Service) HandleGetOrgDomain(w http.ResponseWriter, r *http.Request, slu
 		return writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required")
 	}
 
-	o, err := s.orgService.GetBySlug(slug)
+	o, err := s.orgService.GetBySlug(r.Context(), slug)
 	if err != nil {
 		return writeError(w, r, http.StatusNotFound, "ORG_NOT_FOUND", "Organization not found")
 	}
 
 	// Check membership
-	if !s.orgService.IsMember(o.ID, authUser.ID) {
+	if !s.orgService.IsMember(r.Context(), o.ID, authUser.ID) {
 		return writeError(w, r, http.StatusForbidden, "FORBIDDEN", "You must be a member to view domains")
 	}
 
-	d, err := s.domainService.GetByDomain(domainStr)
+	d, err := s.domainService.GetByDomain(r.Context(), domainStr)
 	if err != nil || d.OwnerType != "org" || d.OwnerID != o.ID {
 		return writeError(w, r, http.StatusNotFound, "DOMAIN_NOT_FOUND", "Domain not found")
 	}
@@ -559,23 +621,23 @@ func (s *Service) HandleDeleteOrgDomain(w http.ResponseWriter, r *http.Request,
 		return writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required")
 	}
 
-	o, err := s.orgService.GetBySlug(slug)
+	o, err := s.orgService.GetBySlug(r.Context(), slug)
 	if err != nil {
 		return writeError(w, r, http.StatusNotFound, "ORG_NOT_FOUND", "Organization not found")
 	}
 
 	// Check permission (admin or owner)
-	role := s.orgService.GetMemberRole(o.ID, authUser.ID)
+	role := s.orgService.GetMemberRole(r.Context(), o.ID, authUser.ID)
 	if role != "owner" && role != "admin" {
 		return writeError(w, r, http.StatusForbidden, "FORBIDDEN", "You don't have permission to delete domains")
 	}
 
-	d, err := s.domainService.GetByDomain(domainStr)
+	d, err := s.domainService.GetByDomain(r.Context(), domainStr)
 	if err != nil || d.OwnerType != "org" || d.OwnerID != o.ID {
 		return writeError(w, r, http.StatusNotFound, "DOMAIN_NOT_FOUND", "Domain not found")
 	}
 
-	if err := s.domainService.Delete(d.ID); err != nil {
+	if err := s.domainService.Delete(r.Context(), d.ID); err != nil {
 		return writeError(w, r, http.StatusInternalServerError, "DELETE_FAILED", "Failed to delete domain")
 	}
 
@@ -597,18 +659,18 @@ func (s *Service) HandleVerifyOrgDomain(w http.ResponseWriter, r *http.Request,
 		return writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required")
 	}
 
-	o, err := s.orgService.GetBySlug(slug)
+	o, err := s.orgService.GetBySlug(r.Context(), slug)
 	if err != nil {
 		return writeError(w, r, http.StatusNotFound, "ORG_NOT_FOUND", "Organization not found")
 	}
 
 	// Check permission (admin or owner)
-	role := s.orgService.GetMemberRole(o.ID, authUser.ID)
+	role := s.orgService.GetMemberRole(r.Context(), o.ID, authUser.ID)
 	if role != "owner" && role != "admin" {
 		return writeError(w, r, http.StatusForbidden, "FORBIDDEN", "You don't have permission to verify domains")
 	}
 
-	d, err := s.domainService.GetByDomain(domainStr)
+	d, err := s.domainService.GetByDomain(r.Context(), domainStr)
 	if err != nil || d.OwnerType != "org" || d.OwnerID != o.ID {
 		return writeError(w, r, http.StatusNotFound, "DOMAIN_NOT_FOUND", "Domain not found")
 	}
@@ -620,7 +682,15 @@ func (s *Service) HandleVerifyOrgDomain(w http.ResponseWriter, r *http.Request,
 		}, "Already verified", "Domain is already verified")
 	}
 
-	result, err := s.domainService.Verify(d.ID)
+	// Optionally switch verification method
+	var req VerifyDomainRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err == nil && req.Method != "" {
+		if err := s.domainService.SetVerificationMethod(r.Context(), d.ID, req.Method); err != nil {
+			return writeError(w, r, http.StatusBadRequest, "INVALID_METHOD", "Verification method must be a_record, txt or cname")
+		}
+	}
+
+	result, err := s.domainService.Verify(r.Context(), d.ID)
 	if err != nil {
 		return writeError(w, r, http.StatusInternalServerError, "VERIFY_FAILED", "Verification failed")
 	}
@@ -638,6 +708,112 @@ func (s *Service) HandleVerifyOrgDomain(w http.ResponseWriter, r *http.Request,
 	}, "Verification pending", result.Message)
 }
 
+// HandleUserDomainSubdomains handles /api/v1/users/domains/{domain}/subdomains
+func (s *Service) HandleUserDomainSubdomains(w http.ResponseWriter, r *http.Request, domainStr string) error {
+	if s.config == nil || !s.config.Enabled {
+		return writeError(w, r, http.StatusForbidden, "FEATURE_DISABLED", "Custom domains are not enabled")
+	}
+
+	authUser := web.GetAuthUser(r.Context())
+	if authUser == nil {
+		return writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required")
+	}
+
+	d, err := s.domainService.GetByDomain(r.Context(), domainStr)
+	if err != nil || d.OwnerType != "user" || d.OwnerID != authUser.ID {
+		return writeError(w, r, http.StatusNotFound, "DOMAIN_NOT_FOUND", "Domain not found")
+	}
+
+	return s.handleSubdomains(w, r, d)
+}
+
+// HandleOrgDomainSubdomains handles /api/v1/orgs/{slug}/domains/{domain}/subdomains
+func (s *Service) HandleOrgDomainSubdomains(w http.ResponseWriter, r *http.Request, slug, domainStr string) error {
+	if s.config == nil || !s.config.Enabled {
+		return writeError(w, r, http.StatusForbidden, "FEATURE_DISABLED", "Custom domains are not enabled")
+	}
+
+	authUser := web.GetAuthUser(r.Context())
+	if authUser == nil {
+		return writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required")
+	}
+
+	o, err := s.orgService.GetBySlug(r.Context(), slug)
+	if err != nil {
+		return writeError(w, r, http.StatusNotFound, "ORG_NOT_FOUND", "Organization not found")
+	}
+
+	// Reading is open to members; changes need admin or owner
+	role := s.orgService.GetMemberRole(r.Context(), o.ID, authUser.ID)
+	if role == "" {
+		return writeError(w, r, http.StatusNotFound, "ORG_NOT_FOUND", "Organization not found")
+	}
+	if r.Method != http.MethodGet && role != "owner" && role != "admin" {
+		return writeError(w, r, http.StatusForbidden, "FORBIDDEN", "You don't have permission to manage subdomains")
+	}
+
+	d, err := s.domainService.GetByDomain(r.Context(), domainStr)
+	if err != nil || d.OwnerType != "org" || d.OwnerID != o.ID {
+		return writeError(w, r, http.StatusNotFound, "DOMAIN_NOT_FOUND", "Domain not found")
+	}
+
+	return s.handleSubdomains(w, r, d)
+}
+
+// handleSubdomains lists (GET), sets the mode (PUT), maps (POST) or unmaps (DELETE ?label=) subdomains
+func (s *Service) handleSubdomains(w http.ResponseWriter, r *http.Request, d *domain.CustomDomain) error {
+	if !d.IsWildcard {
+		return writeError(w, r, http.StatusBadRequest, "NOT_WILDCARD", "Subdomain mappings require a wildcard domain")
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req SubdomainRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return writeError(w, r, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+		}
+		if err := s.domainService.SetSubdomainMode(r.Context(), d.ID, req.Mode); err != nil {
+			return writeError(w, r, http.StatusBadRequest, "INVALID_MODE", "Subdomain mode must be owner or members")
+		}
+	case http.MethodPost:
+		var req SubdomainRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return writeError(w, r, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+		}
+		if err := s.domainService.SetSubdomainMapping(r.Context(), d.ID, req.Label, req.Username); err != nil {
+			switch {
+			case errors.Is(err, domain.ErrInvalidLabel):
+				return writeError(w, r, http.StatusBadRequest, "INVALID_LABEL", "Invalid subdomain label")
+			case errors.Is(err, domain.ErrUserNotFound):
+				return writeError(w, r, http.StatusBadRequest, "USER_NOT_FOUND", "User not found or not a member")
+			default:
+				return writeError(w, r, http.StatusInternalServerError, "MAPPING_FAILED", "Failed to save subdomain mapping")
+			}
+		}
+	case http.MethodDelete:
+		if err := s.domainService.DeleteSubdomainMapping(r.Context(), d.ID, r.URL.Query().Get("label")); err != nil {
+			return writeError(w, r, http.StatusNotFound, "MAPPING_NOT_FOUND", "Subdomain mapping not found")
+		}
+	default:
+		return writeError(w, r, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+	}
+
+	d, err := s.domainService.GetByID(r.Context(), d.ID)
+	if err != nil {
+		return writeError(w, r, http.StatusInternalServerError, "SERVER_ERROR", "Failed to load domain")
+	}
+	mappings, err := s.domainService.ListSubdomainMappings(r.Context(), d.ID)
+	if err != nil {
+		return writeError(w, r, http.StatusInternalServerError, "SERVER_ERROR", "Failed to list subdomain mappings")
+	}
+
+	return writeSuccess(w, r, map[string]interface{}{
+		"mode":     d.SubdomainMode,
+		"mappings": mappings,
+	}, "Subdomains listed", fmt.Sprintf("Subdomain mode: %s, %d explicit mappings", d.SubdomainMode, len(mappings)))
+}
+
 // Helper functions
 
 func matchDomain(domain, pattern string) bool {
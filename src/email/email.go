@@ -8,17 +8,28 @@
 package email
 
 import (
+	"bytes"
 	"crypto/tls"
+	"encoding/base64"
 	"fmt"
+	"mime"
+	"mime/multipart"
 	"net"
+	"net/textproto"
 	"net/smtp"
 	"os"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/casjay-forks/caspaste/src/outbound"
 )
 
+// smtpDialTimeout bounds connecting to the SMTP server, through the
+// outbound proxy if there is one
+const smtpDialTimeout = 30 * time.Second
+
 // Config holds SMTP configuration
 type Config struct {
 	Host     string
@@ -91,7 +102,7 @@ func (c *Client) TestConnection() error {
 	}
 
 	addr := fmt.Sprintf("%s:%d", c.config.Host, c.config.Port)
-	conn, err := net.DialTimeout("tcp", addr, 10*time.Second)
+	conn, err := outbound.Dial(addr, 10*time.Second)
 	if err != nil {
 		return fmt.Errorf("failed to connect to SMTP server: %w", err)
 	}
@@ -193,7 +204,37 @@ func (c *Client) Send(to, subject, body string) error {
 	// Build message
 	msg := buildMessage(from, c.config.FromName, to, subject, body)
 
-	// Connect and send
+	return c.deliver(from, to, msg)
+}
+
+// Attachment is a file attached to an email
+type Attachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// SendWithAttachments sends an email with files attached
+func (c *Client) SendWithAttachments(to, subject, body string, attachments ...Attachment) error {
+	if !c.IsEnabled() {
+		return fmt.Errorf("email not enabled: SMTP not configured")
+	}
+
+	from := c.config.FromEmail
+	if from == "" {
+		return fmt.Errorf("from email not configured")
+	}
+
+	msg, err := buildMultipartMessage(from, c.config.FromName, to, subject, body, attachments)
+	if err != nil {
+		return err
+	}
+
+	return c.deliver(from, to, msg)
+}
+
+// deliver connects to the SMTP server and sends a built message
+func (c *Client) deliver(from, to string, msg []byte) error {
 	addr := fmt.Sprintf("%s:%d", c.config.Host, c.config.Port)
 
 	var auth smtp.Auth
@@ -207,28 +248,24 @@ func (c *Client) Send(to, subject, body string) error {
 		return c.sendWithTLS(addr, auth, from, to, msg)
 	case "starttls":
 		return c.sendWithStartTLS(addr, auth, from, to, msg)
-	case "none":
-		return smtp.SendMail(addr, auth, from, []string{to}, msg)
 	default:
-		// Auto mode: try StartTLS first, fall back to plain
-		if err := c.sendWithStartTLS(addr, auth, from, to, msg); err == nil {
-			return nil
-		}
-		return smtp.SendMail(addr, auth, from, []string{to}, msg)
+		// "none" and auto mode: STARTTLS is still used when the server
+		// offers it, as smtp.SendMail does, but not required
+		return c.sendWithStartTLS(addr, auth, from, to, msg)
 	}
 }
 
 // sendWithTLS sends email over implicit TLS (port 465)
 func (c *Client) sendWithTLS(addr string, auth smtp.Auth, from, to string, msg []byte) error {
-	tlsConfig := &tls.Config{
-		ServerName: c.config.Host,
-	}
-
-	conn, err := tls.Dial("tcp", addr, tlsConfig)
+	rawConn, err := outbound.Dial(addr, smtpDialTimeout)
 	if err != nil {
-		return fmt.Errorf("TLS dial failed: %w", err)
+		return fmt.Errorf("dial failed: %w", err)
 	}
+	conn := tls.Client(rawConn, outbound.TLSConfig(c.config.Host))
 	defer conn.Close()
+	if err := conn.Handshake(); err != nil {
+		return fmt.Errorf("TLS handshake failed: %w", err)
+	}
 
 	client, err := smtp.NewClient(conn, c.config.Host)
 	if err != nil {
@@ -270,7 +307,7 @@ func (c *Client) sendWithTLS(addr string, auth smtp.Auth, from, to string, msg [
 
 // sendWithStartTLS sends email using STARTTLS
 func (c *Client) sendWithStartTLS(addr string, auth smtp.Auth, from, to string, msg []byte) error {
-	conn, err := net.Dial("tcp", addr)
+	conn, err := outbound.Dial(addr, smtpDialTimeout)
 	if err != nil {
 		return fmt.Errorf("dial failed: %w", err)
 	}
@@ -284,10 +321,7 @@ func (c *Client) sendWithStartTLS(addr string, auth smtp.Auth, from, to string,
 
 	// Try STARTTLS
 	if ok, _ := client.Extension("STARTTLS"); ok {
-		tlsConfig := &tls.Config{
-			ServerName: c.config.Host,
-		}
-		if err := client.StartTLS(tlsConfig); err != nil {
+		if err := client.StartTLS(outbound.TLSConfig(c.config.Host)); err != nil {
 			return fmt.Errorf("STARTTLS failed: %w", err)
 		}
 	}
@@ -346,6 +380,70 @@ func buildMessage(from, fromName, to, subject, body string) []byte {
 	return []byte(msg.String())
 }
 
+// buildMultipartMessage builds a multipart/mixed message with the body as
+// the first part and each attachment base64 encoded after it
+func buildMultipartMessage(from, fromName, to, subject, body string, attachments []Attachment) ([]byte, error) {
+	var parts bytes.Buffer
+	mw := multipart.NewWriter(&parts)
+
+	textHeader := textproto.MIMEHeader{}
+	textHeader.Set("Content-Type", "text/plain; charset=UTF-8")
+	textHeader.Set("Content-Transfer-Encoding", "8bit")
+	pw, err := mw.CreatePart(textHeader)
+	if err != nil {
+		return nil, err
+	}
+	pw.Write([]byte(body))
+
+	for _, a := range attachments {
+		contentType := a.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", contentType)
+		header.Set("Content-Transfer-Encoding", "base64")
+		header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": a.Name}))
+		pw, err := mw.CreatePart(header)
+		if err != nil {
+			return nil, err
+		}
+		// Base64 lines are limited to 76 characters (RFC 2045)
+		encoded := base64.StdEncoding.EncodeToString(a.Data)
+		for len(encoded) > 76 {
+			pw.Write([]byte(encoded[:76] + "\r\n"))
+			encoded = encoded[76:]
+		}
+		pw.Write([]byte(encoded + "\r\n"))
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg strings.Builder
+	if fromName != "" {
+		msg.WriteString(fmt.Sprintf("From: %s <%s>\r\n", mime.QEncoding.Encode("UTF-8", fromName), from))
+	} else {
+		msg.WriteString(fmt.Sprintf("From: %s\r\n", from))
+	}
+	msg.WriteString(fmt.Sprintf("To: %s\r\n", to))
+	msg.WriteString(fmt.Sprintf("Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", subject)))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString(fmt.Sprintf("Content-Type: multipart/mixed; boundary=%q\r\n", mw.Boundary()))
+	msg.WriteString(fmt.Sprintf("Date: %s\r\n", time.Now().Format(time.RFC1123Z)))
+	msg.WriteString("\r\n")
+	msg.Write(parts.Bytes())
+
+	return []byte(msg.String()), nil
+}
+
+// Server returns the SMTP server mail is delivered to, e.g. smtp://mail.example.com:587
+func (c *Client) Server() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return "smtp://" + net.JoinHostPort(c.config.Host, strconv.Itoa(c.config.Port))
+}
+
 // GetConfig returns the current SMTP configuration (for display)
 func (c *Client) GetConfig() map[string]interface{} {
 	c.mu.RLock()
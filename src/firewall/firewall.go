@@ -0,0 +1,321 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+// Package firewall bans IP addresses and networks from the whole server
+// Bans are kept in the database, so every replica applies them, and cached
+// in memory so requests are checked without a query
+// Addresses that keep hitting the rate limits can be banned for a while
+// automatically
+package firewall
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/storage"
+)
+
+const (
+	// SourceAdmin is a ban added by an admin
+	SourceAdmin = "admin"
+	// SourceAuto is a ban added for repeated rate limit violations
+	SourceAuto = "auto"
+
+	// DefaultRefresh is how often bans added on other replicas are loaded
+	DefaultRefresh = 30 * time.Second
+	// DefaultViolations is the count of rate limited requests that gets
+	// an address banned
+	DefaultViolations = 20
+	// DefaultWindow is the period the violations are counted in
+	DefaultWindow = 10 * time.Minute
+	// DefaultDuration is how long an automatic ban lasts
+	DefaultDuration = time.Hour
+
+	// maxTracked bounds the addresses whose violations are counted
+	maxTracked = 100000
+)
+
+// ErrInvalidBan is returned for a ban that cannot be parsed
+var ErrInvalidBan = errors.New("invalid ban")
+
+// AutoBan bans addresses that are rate limited too often
+type AutoBan struct {
+	Enabled bool
+	// Rate limited requests within Window that get an address banned
+	Violations int
+	Window     time.Duration
+	// How long the ban lasts
+	Duration time.Duration
+}
+
+// withDefaults fills the unset fields of a
+func (a AutoBan) withDefaults() AutoBan {
+	if a.Violations <= 0 {
+		a.Violations = DefaultViolations
+	}
+	if a.Window <= 0 {
+		a.Window = DefaultWindow
+	}
+	if a.Duration <= 0 {
+		a.Duration = DefaultDuration
+	}
+	return a
+}
+
+type compiledBan struct {
+	ban     storage.IPBan
+	network *net.IPNet
+}
+
+type violations struct {
+	first time.Time
+	count int
+}
+
+// Firewall checks client addresses against the bans; it is safe for
+// concurrent use
+type Firewall struct {
+	db storage.DB
+
+	mu   sync.RWMutex
+	bans []compiledBan
+
+	autoMu     sync.Mutex
+	auto       AutoBan
+	violations map[string]*violations
+
+	// Called after an automatic ban is added (nil = none)
+	onAutoBan func(ban storage.IPBan)
+}
+
+// New creates a firewall over the bans in db; call Refresh to load them
+func New(db storage.DB, auto AutoBan) *Firewall {
+	return &Firewall{
+		db:         db,
+		auto:       auto.withDefaults(),
+		violations: make(map[string]*violations),
+	}
+}
+
+// SetAutoBan replaces the automatic ban settings; counted violations are
+// forgotten
+func (fw *Firewall) SetAutoBan(auto AutoBan) {
+	fw.autoMu.Lock()
+	defer fw.autoMu.Unlock()
+	fw.auto = auto.withDefaults()
+	fw.violations = make(map[string]*violations)
+}
+
+// OnAutoBan sets a function called after each automatic ban, e.g. for the
+// audit log
+func (fw *Firewall) OnAutoBan(fn func(ban storage.IPBan)) {
+	fw.autoMu.Lock()
+	defer fw.autoMu.Unlock()
+	fw.onAutoBan = fn
+}
+
+// Refresh loads the bans from the database
+func (fw *Firewall) Refresh() error {
+	bans, err := fw.db.IPBanList()
+	if err != nil {
+		return err
+	}
+	compiled := make([]compiledBan, 0, len(bans))
+	for _, ban := range bans {
+		network, err := ParseNetwork(ban.Network)
+		if err != nil {
+			continue
+		}
+		compiled = append(compiled, compiledBan{ban: ban, network: network})
+	}
+
+	fw.mu.Lock()
+	fw.bans = compiled
+	fw.mu.Unlock()
+	return nil
+}
+
+// Start refreshes the bans every interval, so bans added on other replicas
+// apply; errors are passed to logErr
+func (fw *Firewall) Start(interval time.Duration, logErr func(error)) {
+	if interval <= 0 {
+		interval = DefaultRefresh
+	}
+	go func() {
+		for range time.Tick(interval) {
+			if err := fw.Refresh(); err != nil && logErr != nil {
+				logErr(err)
+			}
+		}
+	}()
+}
+
+// Check returns the ban covering ip, if any
+func (fw *Firewall) Check(ip net.IP) (storage.IPBan, bool) {
+	if ip == nil {
+		return storage.IPBan{}, false
+	}
+	now := time.Now().Unix()
+
+	fw.mu.RLock()
+	defer fw.mu.RUnlock()
+	for _, b := range fw.bans {
+		if (b.ban.ExpiresAt == 0 || b.ban.ExpiresAt > now) && b.network.Contains(ip) {
+			return b.ban, true
+		}
+	}
+	return storage.IPBan{}, false
+}
+
+// List returns the bans in force, newest first
+func (fw *Firewall) List() ([]storage.IPBan, error) {
+	return fw.db.IPBanList()
+}
+
+// Get returns a ban by ID
+func (fw *Firewall) Get(id string) (storage.IPBan, error) {
+	return fw.db.IPBanGet(id)
+}
+
+// Add bans an address or network for d (0 = no end)
+func (fw *Firewall) Add(network, reason, source, createdBy string, d time.Duration) (storage.IPBan, error) {
+	canonical, err := CanonicalNetwork(network)
+	if err != nil {
+		return storage.IPBan{}, err
+	}
+	ban := storage.IPBan{
+		Network:   canonical,
+		Reason:    strings.TrimSpace(reason),
+		Source:    source,
+		CreatedBy: createdBy,
+		ExpiresAt: expiresAt(d),
+	}
+	if ban, err = fw.db.IPBanAdd(ban); err != nil {
+		return ban, err
+	}
+	return ban, fw.Refresh()
+}
+
+// Update changes the reason of a ban and makes it last d from now (0 = no end)
+func (fw *Firewall) Update(id, reason string, d time.Duration) (storage.IPBan, error) {
+	if err := fw.db.IPBanUpdate(id, strings.TrimSpace(reason), expiresAt(d)); err != nil {
+		return storage.IPBan{}, err
+	}
+	if err := fw.Refresh(); err != nil {
+		return storage.IPBan{}, err
+	}
+	return fw.db.IPBanGet(id)
+}
+
+// Remove lifts a ban
+func (fw *Firewall) Remove(id string) error {
+	if err := fw.db.IPBanDelete(id); err != nil {
+		return err
+	}
+	return fw.Refresh()
+}
+
+// RateLimited counts a request from ip refused by a rate limit, and bans ip
+// once it has been refused too often; see netshare.Violations
+func (fw *Firewall) RateLimited(ip net.IP) {
+	if ip == nil || ip.IsLoopback() {
+		return
+	}
+	if _, banned := fw.Check(ip); banned {
+		return
+	}
+
+	fw.autoMu.Lock()
+	auto, onAutoBan := fw.auto, fw.onAutoBan
+	if !auto.Enabled {
+		fw.autoMu.Unlock()
+		return
+	}
+	now := time.Now()
+	key := ip.String()
+	v := fw.violations[key]
+	if v == nil || now.Sub(v.first) >= auto.Window {
+		if v == nil && len(fw.violations) >= maxTracked {
+			fw.pruneViolations(now, auto.Window)
+		}
+		v = &violations{first: now}
+		fw.violations[key] = v
+	}
+	v.count++
+	count := v.count
+	if count >= auto.Violations {
+		delete(fw.violations, key)
+	}
+	fw.autoMu.Unlock()
+
+	if count < auto.Violations {
+		return
+	}
+	reason := fmt.Sprintf("%d rate limited requests in %s", count, auto.Window)
+	ban, err := fw.Add(key, reason, SourceAuto, "", auto.Duration)
+	if err == nil && onAutoBan != nil {
+		onAutoBan(ban)
+	}
+}
+
+// pruneViolations drops the counts whose window has ended, or all of them
+// when none has; called with autoMu held
+func (fw *Firewall) pruneViolations(now time.Time, window time.Duration) {
+	for key, v := range fw.violations {
+		if now.Sub(v.first) >= window {
+			delete(fw.violations, key)
+		}
+	}
+	if len(fw.violations) >= maxTracked {
+		fw.violations = make(map[string]*violations)
+	}
+}
+
+// expiresAt returns the end of a ban lasting d from now in unix seconds (0 = no end)
+func expiresAt(d time.Duration) int64 {
+	if d <= 0 {
+		return 0
+	}
+	return time.Now().Add(d).Unix()
+}
+
+// ParseNetwork parses an IP address or CIDR network; an address is a
+// network of one
+func ParseNetwork(s string) (*net.IPNet, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("%w: %q is not an IP address", ErrInvalidBan, s)
+		}
+		bits := 128
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, network, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q is not a network", ErrInvalidBan, s)
+	}
+	return network, nil
+}
+
+// CanonicalNetwork returns an address or network the way bans store it:
+// host bits of a network cleared, and a network of one written as the address
+func CanonicalNetwork(s string) (string, error) {
+	network, err := ParseNetwork(s)
+	if err != nil {
+		return "", err
+	}
+	if ones, bits := network.Mask.Size(); ones == bits {
+		return network.IP.String(), nil
+	}
+	return network.String(), nil
+}
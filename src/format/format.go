@@ -0,0 +1,118 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+// Package format pretty-prints paste content with embedded formatters
+// Everything runs in-process; no external tools are executed
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	goformat "go/format"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrUnsupported is returned when no formatter exists for a syntax
+var ErrUnsupported = errors.New("format: no formatter for this syntax")
+
+// SyntaxError wraps a parse error from a formatter
+type SyntaxError struct {
+	Language string
+	Err      error
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("format: invalid %s: %v", e.Language, e.Err)
+}
+
+func (e *SyntaxError) Unwrap() error {
+	return e.Err
+}
+
+type formatter struct {
+	language string
+	run      func(string) (string, error)
+}
+
+// formatters maps lower-case syntax names and aliases to formatters
+var formatters = map[string]formatter{
+	"go":     {"Go", formatGo},
+	"golang": {"Go", formatGo},
+	"json":   {"JSON", formatJSON},
+	"yaml":   {"YAML", formatYAML},
+	"yml":    {"YAML", formatYAML},
+}
+
+// Supported reports whether a formatter exists for syntax
+func Supported(syntax string) bool {
+	_, ok := formatters[strings.ToLower(strings.TrimSpace(syntax))]
+	return ok
+}
+
+// Format returns body formatted according to syntax
+func Format(syntax, body string) (string, error) {
+	f, ok := formatters[strings.ToLower(strings.TrimSpace(syntax))]
+	if !ok {
+		return "", ErrUnsupported
+	}
+	out, err := f.run(body)
+	if err != nil {
+		return "", &SyntaxError{Language: f.language, Err: err}
+	}
+	return out, nil
+}
+
+// formatGo runs gofmt
+func formatGo(body string) (string, error) {
+	out, err := goformat.Source([]byte(body))
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// formatJSON indents with two spaces, keeping key order
+func formatJSON(body string) (string, error) {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, []byte(strings.TrimSpace(body)), "", "  "); err != nil {
+		return "", err
+	}
+	buf.WriteByte('\n')
+	return buf.String(), nil
+}
+
+// formatYAML re-encodes every document with two-space indentation
+// Decoding into nodes keeps comments, key order and multi-document streams
+func formatYAML(body string) (string, error) {
+	dec := yaml.NewDecoder(strings.NewReader(body))
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if err := enc.Encode(&doc); err != nil {
+			return "", err
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
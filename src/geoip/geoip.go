@@ -14,8 +14,11 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/casjay-forks/caspaste/src/outbound"
 )
 
 // Database URLs from ip-location-db (no API key required)
@@ -33,6 +36,8 @@ type Config struct {
 	ASNEnabled    bool
 	CountryEnabled bool
 	CityEnabled   bool
+	// Download from MaxMind instead of ip-location-db (nil = ip-location-db)
+	MaxMind *MaxMindConfig
 }
 
 // DefaultConfig returns the default GeoIP configuration
@@ -69,7 +74,15 @@ type Client struct {
 	enabled     bool
 	lastUpdate  time.Time
 	denySet     map[string]bool
+	// Open databases; nil when missing
+	country     *Reader
+	asn         *Reader
+	creation    Policy
+	viewing     Policy
 	mu          sync.RWMutex
+	// Requests per country, see RecordRequest
+	stats       map[string]*CountryStats
+	statsMu     sync.Mutex
 }
 
 // NewClient creates a new GeoIP client
@@ -145,11 +158,28 @@ func (c *Client) Lookup(ipStr string) (*Result, error) {
 		return result, nil
 	}
 
-	// Note: Actual MMDB lookup would require oschwald/maxminddb-golang
-	// This is a placeholder that would be expanded with actual DB lookups
-	// For now, return a minimal result indicating lookup is available
-	result.CountryCode = "XX"
-	result.Country = "Unknown"
+	c.mu.RLock()
+	country, asn := c.country, c.asn
+	c.mu.RUnlock()
+
+	if country != nil {
+		record, err := country.Lookup(ip)
+		if err != nil {
+			return nil, err
+		}
+		result.CountryCode, result.Country = countryOf(record)
+	}
+	if asn != nil {
+		record, err := asn.Lookup(ip)
+		if err != nil {
+			return nil, err
+		}
+		result.ASN, result.ASNOrg = asnOf(record)
+	}
+	if result.CountryCode == "" {
+		result.CountryCode = "XX"
+		result.Country = "Unknown"
+	}
 
 	// Check deny list
 	c.mu.RLock()
@@ -159,6 +189,84 @@ func (c *Client) Lookup(ipStr string) (*Result, error) {
 	return result, nil
 }
 
+// countryOf reads the country of an ip-location-db (country_code) or a
+// MaxMind (country.iso_code) record
+func countryOf(record map[string]interface{}) (code, name string) {
+	if code, ok := record["country_code"].(string); ok {
+		return strings.ToUpper(code), ""
+	}
+	country, _ := record["country"].(map[string]interface{})
+	code, _ = country["iso_code"].(string)
+	names, _ := country["names"].(map[string]interface{})
+	name, _ = names["en"].(string)
+	return strings.ToUpper(code), name
+}
+
+// asnOf reads the AS number and organization of an ASN record; both
+// databases use the MaxMind field names
+func asnOf(record map[string]interface{}) (uint, string) {
+	number, _ := record["autonomous_system_number"].(uint64)
+	org, _ := record["autonomous_system_organization"].(string)
+	return uint(number), org
+}
+
+// Load opens the country and ASN databases in the configured directory
+// A missing database is skipped: its lookups return nothing
+func (c *Client) Load() error {
+	var country, asn *Reader
+	var errs []error
+	open := func(enabled bool, name string) *Reader {
+		if !enabled || c.config.Dir == "" {
+			return nil
+		}
+		r, err := OpenReader(filepath.Join(c.config.Dir, name))
+		if err != nil && !os.IsNotExist(err) {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+		return r
+	}
+	country = open(c.config.CountryEnabled, "country.mmdb")
+	asn = open(c.config.ASNEnabled, "asn.mmdb")
+
+	c.mu.Lock()
+	c.country, c.asn = country, asn
+	// Databases downloaded before a restart
+	if c.lastUpdate.IsZero() && c.config.Dir != "" {
+		if info, err := os.Stat(filepath.Join(c.config.Dir, "country.mmdb")); err == nil {
+			c.lastUpdate = info.ModTime()
+		}
+	}
+	c.mu.Unlock()
+
+	if len(errs) > 0 {
+		return fmt.Errorf("database load errors: %v", errs)
+	}
+	return nil
+}
+
+// Country returns the country code of ip, "XX" for private and unknown
+// addresses, or "" when GeoIP is disabled or no country database is open
+func (c *Client) Country(ip string) string {
+	c.mu.RLock()
+	loaded := c.country != nil
+	c.mu.RUnlock()
+	if !loaded {
+		return ""
+	}
+	result, err := c.Lookup(ip)
+	if err != nil {
+		return ""
+	}
+	return result.CountryCode
+}
+
+// Loaded reports whether a country or ASN database is open
+func (c *Client) Loaded() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.country != nil || c.asn != nil
+}
+
 // LookupRequest extracts IP from HTTP request and performs lookup
 func (c *Client) LookupRequest(r *http.Request) (*Result, error) {
 	ip := GetClientIP(r)
@@ -196,12 +304,19 @@ func (c *Client) UpdateDatabases() error {
 	if c.config.Dir == "" {
 		return fmt.Errorf("GeoIP directory not configured")
 	}
+	if outbound.Offline() {
+		return outbound.ErrOffline
+	}
 
 	// Create directory if it doesn't exist
 	if err := os.MkdirAll(c.config.Dir, 0755); err != nil {
 		return fmt.Errorf("failed to create GeoIP directory: %w", err)
 	}
 
+	if c.config.MaxMind != nil {
+		return c.updateMaxMind()
+	}
+
 	var errs []error
 
 	// Download ASN database
@@ -241,7 +356,7 @@ func downloadFile(url, destPath string) error {
 	// Create temp file
 	tmpPath := destPath + ".tmp"
 
-	resp, err := http.Get(url)
+	resp, err := outbound.Client(0).Get(url)
 	if err != nil {
 		return fmt.Errorf("download failed: %w", err)
 	}
@@ -279,6 +394,14 @@ func (c *Client) GetLastUpdate() time.Time {
 	return c.lastUpdate
 }
 
+// Source names where the databases are downloaded from
+func (c *Client) Source() string {
+	if c.config.MaxMind != nil {
+		return SourceMaxMind
+	}
+	return SourceIPLocationDB
+}
+
 // GetConfig returns the current configuration (for display)
 func (c *Client) GetConfig() map[string]interface{} {
 	c.mu.RLock()
@@ -291,6 +414,7 @@ func (c *Client) GetConfig() map[string]interface{} {
 		"asn_enabled":    c.config.ASNEnabled,
 		"country_enabled": c.config.CountryEnabled,
 		"city_enabled":   c.config.CityEnabled,
+		"source":         c.Source(),
 		"last_update":    c.lastUpdate,
 	}
 }
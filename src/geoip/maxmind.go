@@ -0,0 +1,144 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package geoip
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/outbound"
+)
+
+const (
+	// SourceIPLocationDB downloads the free ip-location-db databases
+	SourceIPLocationDB = "ip-location-db"
+	// SourceMaxMind downloads the MaxMind GeoLite2 or GeoIP2 databases
+	SourceMaxMind = "maxmind"
+
+	// MaxMindDownloadURL is where MaxMind databases are downloaded from;
+	// %s is the edition ID
+	MaxMindDownloadURL = "https://download.maxmind.com/geoip/databases/%s/download?suffix=tar.gz"
+	// DefaultMaxMindCountryEdition is the free MaxMind country database
+	DefaultMaxMindCountryEdition = "GeoLite2-Country"
+	// DefaultMaxMindASNEdition is the free MaxMind ASN database
+	DefaultMaxMindASNEdition = "GeoLite2-ASN"
+)
+
+// MaxMindConfig holds the MaxMind account the databases are downloaded with
+type MaxMindConfig struct {
+	AccountID  string
+	LicenseKey string
+	// Edition IDs, e.g. GeoLite2-Country or GeoIP2-Country
+	CountryEdition string
+	ASNEdition     string
+}
+
+// updateMaxMind downloads the country and ASN databases from MaxMind
+func (c *Client) updateMaxMind() error {
+	mm := c.config.MaxMind
+	if mm.AccountID == "" || mm.LicenseKey == "" {
+		return fmt.Errorf("MaxMind account ID and license key are required")
+	}
+	countryEdition, asnEdition := mm.CountryEdition, mm.ASNEdition
+	if countryEdition == "" {
+		countryEdition = DefaultMaxMindCountryEdition
+	}
+	if asnEdition == "" {
+		asnEdition = DefaultMaxMindASNEdition
+	}
+
+	var errs []error
+	if c.config.ASNEnabled {
+		if err := downloadMaxMind(mm, asnEdition, filepath.Join(c.config.Dir, "asn.mmdb")); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", asnEdition, err))
+		}
+	}
+	if c.config.CountryEnabled {
+		if err := downloadMaxMind(mm, countryEdition, filepath.Join(c.config.Dir, "country.mmdb")); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", countryEdition, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("database update errors: %v", errs)
+	}
+
+	c.mu.Lock()
+	c.lastUpdate = time.Now()
+	c.mu.Unlock()
+	return nil
+}
+
+// downloadMaxMind downloads an edition and writes the MMDB file in its
+// archive to destPath
+func downloadMaxMind(mm *MaxMindConfig, edition, destPath string) error {
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf(MaxMindDownloadURL, url.PathEscape(edition)), nil)
+	if err != nil {
+		return err
+	}
+	// Not sent on the redirect to the storage host
+	req.SetBasicAuth(mm.AccountID, mm.LicenseKey)
+
+	resp, err := outbound.Client(0).Do(req)
+	if err != nil {
+		return fmt.Errorf("download failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download returned status %d", resp.StatusCode)
+	}
+
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return fmt.Errorf("invalid archive: %w", err)
+	}
+	defer gz.Close()
+
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return fmt.Errorf("no MMDB file in the archive")
+		}
+		if err != nil {
+			return fmt.Errorf("invalid archive: %w", err)
+		}
+		if header.Typeflag == tar.TypeReg && strings.HasSuffix(path.Base(header.Name), ".mmdb") {
+			return writeDatabase(archive, destPath)
+		}
+	}
+}
+
+// writeDatabase checks that r holds an MMDB database and writes it to
+// destPath, replacing the old file only once the new one is complete
+func writeDatabase(r io.Reader, destPath string) error {
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to read database: %w", err)
+	}
+	if _, err := NewReader(buf); err != nil {
+		return err
+	}
+
+	tmpPath := destPath + ".tmp"
+	if err := os.WriteFile(tmpPath, buf, 0644); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := os.Rename(tmpPath, destPath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to rename file: %w", err)
+	}
+	return nil
+}
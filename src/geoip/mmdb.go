@@ -0,0 +1,296 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"os"
+)
+
+// metadataMarker starts the metadata section at the end of an MMDB file
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// errInvalidDatabase is returned for files that are not valid MMDB databases
+var errInvalidDatabase = errors.New("geoip: invalid MMDB database")
+
+// Reader looks up addresses in a MaxMind DB (MMDB) file, the format of both
+// the ip-location-db and the MaxMind GeoLite2 databases
+// The whole file is kept in memory; a Reader is safe for concurrent use
+type Reader struct {
+	buf        []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	// Start of the data section
+	dataStart uint
+	// Node the IPv4 addresses start at in an IPv6 tree
+	ipv4Start uint
+	// Metadata of the database, e.g. database_type and build_epoch
+	Metadata map[string]interface{}
+}
+
+// OpenReader reads the MMDB file at path
+func OpenReader(path string) (*Reader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReader(buf)
+}
+
+// NewReader parses an MMDB database held in buf
+func NewReader(buf []byte) (*Reader, error) {
+	at := bytes.LastIndex(buf, metadataMarker)
+	if at < 0 {
+		return nil, errInvalidDatabase
+	}
+	metaStart := uint(at + len(metadataMarker))
+	r := &Reader{buf: buf[:at]}
+
+	meta, _, err := decode(buf, metaStart, metaStart, 0)
+	if err != nil {
+		return nil, err
+	}
+	metadata, ok := meta.(map[string]interface{})
+	if !ok {
+		return nil, errInvalidDatabase
+	}
+	r.Metadata = metadata
+	r.nodeCount = metaUint(metadata, "node_count")
+	r.recordSize = metaUint(metadata, "record_size")
+	r.ipVersion = metaUint(metadata, "ip_version")
+	if r.recordSize != 24 && r.recordSize != 28 && r.recordSize != 32 {
+		return nil, fmt.Errorf("geoip: unsupported MMDB record size %d", r.recordSize)
+	}
+	if r.ipVersion != 4 && r.ipVersion != 6 {
+		return nil, fmt.Errorf("geoip: unsupported MMDB IP version %d", r.ipVersion)
+	}
+
+	treeSize := r.nodeCount * r.recordSize / 4
+	r.dataStart = treeSize + 16
+	if r.dataStart > uint(len(r.buf)) {
+		return nil, errInvalidDatabase
+	}
+
+	// IPv4 addresses live under ::/96 in an IPv6 tree
+	if r.ipVersion == 6 {
+		for i := 0; i < 96 && r.ipv4Start < r.nodeCount; i++ {
+			r.ipv4Start = r.record(r.ipv4Start, 0)
+		}
+	}
+	return r, nil
+}
+
+// Lookup returns the record of ip, or nil when the database has none
+func (r *Reader) Lookup(ip net.IP) (map[string]interface{}, error) {
+	node, bits := uint(0), 128
+	addr := ip.To16()
+	if v4 := ip.To4(); v4 != nil {
+		addr, bits = v4, 32
+		if r.ipVersion == 6 {
+			node = r.ipv4Start
+		}
+	} else if r.ipVersion == 4 {
+		return nil, nil
+	}
+	if addr == nil {
+		return nil, fmt.Errorf("geoip: invalid IP address")
+	}
+
+	for i := 0; i < bits && node < r.nodeCount; i++ {
+		bit := uint(addr[i>>3]>>(7-uint(i&7))) & 1
+		node = r.record(node, bit)
+	}
+	if node == r.nodeCount {
+		return nil, nil
+	}
+	if node < r.nodeCount {
+		return nil, errInvalidDatabase
+	}
+
+	offset := node - r.nodeCount - 16 + r.dataStart
+	value, _, err := decode(r.buf, offset, r.dataStart, 0)
+	if err != nil {
+		return nil, err
+	}
+	record, _ := value.(map[string]interface{})
+	return record, nil
+}
+
+// record returns the left (bit 0) or right (bit 1) record of a search tree node
+func (r *Reader) record(node, bit uint) uint {
+	size := r.recordSize / 4
+	at := node * size
+	if at+size > uint(len(r.buf)) {
+		return r.nodeCount
+	}
+	b := r.buf[at : at+size]
+
+	switch r.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+// maxDecodeDepth bounds nested maps, arrays and pointers in a record
+const maxDecodeDepth = 32
+
+// decode reads the value at offset of buf; pointers are relative to base
+// It returns the value and the offset just after it
+func decode(buf []byte, offset, base uint, depth int) (interface{}, uint, error) {
+	if depth > maxDecodeDepth || offset >= uint(len(buf)) {
+		return nil, 0, errInvalidDatabase
+	}
+	ctrl := buf[offset]
+	offset++
+	kind := uint(ctrl >> 5)
+
+	// Pointers: the value is elsewhere in the data section
+	if kind == 1 {
+		ss, vvv := uint(ctrl>>3)&3, uint(ctrl&7)
+		n := ss + 1
+		if offset+n > uint(len(buf)) {
+			return nil, 0, errInvalidDatabase
+		}
+		p := beUint(buf[offset : offset+n])
+		switch ss {
+		case 0:
+			p |= vvv << 8
+		case 1:
+			p = (p | vvv<<16) + 2048
+		case 2:
+			p = (p | vvv<<24) + 526336
+		}
+		value, _, err := decode(buf, base+p, base, depth+1)
+		return value, offset + n, err
+	}
+
+	if kind == 0 {
+		if offset >= uint(len(buf)) {
+			return nil, 0, errInvalidDatabase
+		}
+		kind = 7 + uint(buf[offset])
+		offset++
+	}
+
+	size := uint(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if offset+n > uint(len(buf)) {
+			return nil, 0, errInvalidDatabase
+		}
+		extra := beUint(buf[offset : offset+n])
+		offset += n
+		switch n {
+		case 1:
+			size = 29 + extra
+		case 2:
+			size = 285 + extra
+		default:
+			size = 65821 + extra
+		}
+	}
+
+	switch kind {
+	case 7: // map
+		m := make(map[string]interface{}, min(size, 1024))
+		for i := uint(0); i < size; i++ {
+			key, next, err := decode(buf, offset, base, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, 0, errInvalidDatabase
+			}
+			value, next, err := decode(buf, next, base, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[k] = value
+			offset = next
+		}
+		return m, offset, nil
+	case 11: // array
+		a := make([]interface{}, 0, min(size, 1024))
+		for i := uint(0); i < size; i++ {
+			value, next, err := decode(buf, offset, base, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, value)
+			offset = next
+		}
+		return a, offset, nil
+	case 14: // boolean: the size is the value
+		return size != 0, offset, nil
+	}
+
+	if offset+size > uint(len(buf)) {
+		return nil, 0, errInvalidDatabase
+	}
+	b := buf[offset : offset+size]
+	offset += size
+
+	switch kind {
+	case 2: // UTF-8 string
+		return string(b), offset, nil
+	case 3: // double
+		if size != 8 {
+			return nil, 0, errInvalidDatabase
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+	case 4: // bytes
+		return append([]byte(nil), b...), offset, nil
+	case 5, 6, 9: // uint16, uint32, uint64
+		if size > 8 {
+			return nil, 0, errInvalidDatabase
+		}
+		return uint64(beUint(b)), offset, nil
+	case 8: // int32
+		if size > 4 {
+			return nil, 0, errInvalidDatabase
+		}
+		return int64(int32(uint32(beUint(b)))), offset, nil
+	case 10: // uint128
+		return new(big.Int).SetBytes(b), offset, nil
+	case 15: // float
+		if size != 4 {
+			return nil, 0, errInvalidDatabase
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), offset, nil
+	}
+	return nil, 0, fmt.Errorf("geoip: unsupported MMDB data type %d", kind)
+}
+
+// beUint reads a big-endian unsigned integer of up to 8 bytes
+func beUint(b []byte) uint {
+	var v uint
+	for _, c := range b {
+		v = v<<8 | uint(c)
+	}
+	return v
+}
+
+// metaUint returns an unsigned integer metadata field, or 0
+func metaUint(meta map[string]interface{}, key string) uint {
+	v, _ := meta[key].(uint64)
+	return uint(v)
+}
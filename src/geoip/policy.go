@@ -0,0 +1,166 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package geoip
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+const (
+	// ActionView is any request that does not create a paste
+	ActionView = "view"
+	// ActionCreate is a request that creates a paste
+	ActionCreate = "create"
+)
+
+// Policy restricts paste creation or viewing by the country and network of
+// the client address
+// Addresses the databases do not know, and private ones, are not refused
+type Policy struct {
+	// Country codes (ISO 3166-1 alpha-2) that are refused
+	DenyCountries []string `json:"deny_countries"`
+	// When set, only these countries are allowed
+	AllowCountries []string `json:"allow_countries"`
+	// AS numbers that are refused
+	DenyASNs []uint `json:"deny_asns"`
+	// Usernames allowed from anywhere; "*" = every signed-in user
+	ExemptUsers []string `json:"exempt_users"`
+	// Status of refusals: 451 (Unavailable For Legal Reasons) or 403
+	Status int `json:"status"`
+}
+
+// Active reports whether the policy refuses anything
+func (p Policy) Active() bool {
+	return len(p.DenyCountries) > 0 || len(p.AllowCountries) > 0 || len(p.DenyASNs) > 0
+}
+
+// Exempt reports whether username is allowed from anywhere
+func (p Policy) Exempt(username string) bool {
+	if username == "" {
+		return false
+	}
+	return slices.Contains(p.ExemptUsers, "*") || slices.ContainsFunc(p.ExemptUsers, func(u string) bool {
+		return strings.EqualFold(u, username)
+	})
+}
+
+// refusal returns why the client of result is refused, or nil when it is
+// not; exemptions are not checked
+func (p Policy) refusal(result *Result, action string) *Refusal {
+	if !p.Active() {
+		return nil
+	}
+	refusal := &Refusal{Status: p.Status, Action: action, CountryCode: result.CountryCode, ASN: result.ASN}
+	if result.ASN != 0 && slices.Contains(p.DenyASNs, result.ASN) {
+		refusal.Reason = "asn"
+		return refusal
+	}
+	if result.CountryCode == "XX" {
+		return nil
+	}
+	if slices.Contains(p.DenyCountries, result.CountryCode) ||
+		len(p.AllowCountries) > 0 && !slices.Contains(p.AllowCountries, result.CountryCode) {
+		refusal.Reason = "country"
+		return refusal
+	}
+	return nil
+}
+
+// withDefaults returns p with upper case country codes and a valid status
+func (p Policy) withDefaults() Policy {
+	p.DenyCountries = upperCodes(p.DenyCountries)
+	p.AllowCountries = upperCodes(p.AllowCountries)
+	if p.Status != http.StatusForbidden {
+		p.Status = http.StatusUnavailableForLegalReasons
+	}
+	return p
+}
+
+// Refusal is why a client is refused
+type Refusal struct {
+	// HTTP status to answer with
+	Status int
+	// ActionView or ActionCreate
+	Action string
+	// "country" or "asn"
+	Reason      string
+	CountryCode string
+	ASN         uint
+}
+
+// SetCreationPolicy replaces the paste creation policy
+func (c *Client) SetCreationPolicy(p Policy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.creation = p.withDefaults()
+}
+
+// SetViewingPolicy replaces the policy of the requests that do not create
+// pastes
+func (c *Client) SetViewingPolicy(p Policy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.viewing = p.withDefaults()
+}
+
+// upperCodes returns the country codes in upper case
+func upperCodes(codes []string) []string {
+	upper := make([]string, 0, len(codes))
+	for _, code := range codes {
+		if code = strings.ToUpper(strings.TrimSpace(code)); code != "" {
+			upper = append(upper, code)
+		}
+	}
+	return upper
+}
+
+// CreationPolicy returns the paste creation policy
+func (c *Client) CreationPolicy() Policy {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.creation
+}
+
+// ViewingPolicy returns the policy of the requests that do not create pastes
+func (c *Client) ViewingPolicy() Policy {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.viewing
+}
+
+// Check returns why the client of result may not make a request, or nil
+// when it may; the viewing policy applies to every request, the creation
+// policy to paste creation as well
+// username returns who is signed in ("" = anonymous), and is only called
+// for a client that would be refused
+func (c *Client) Check(result *Result, creation bool, username func() string) *Refusal {
+	if result == nil || !c.IsEnabled() {
+		return nil
+	}
+	policies := []Policy{c.ViewingPolicy()}
+	actions := []string{ActionView}
+	if creation {
+		policies = append(policies, c.CreationPolicy())
+		actions = append(actions, ActionCreate)
+	}
+
+	user, userKnown := "", false
+	for i, policy := range policies {
+		refusal := policy.refusal(result, actions[i])
+		if refusal == nil {
+			continue
+		}
+		if !userKnown {
+			user, userKnown = username(), true
+		}
+		if !policy.Exempt(user) {
+			return refusal
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package geoip
+
+import (
+	"sort"
+)
+
+// CountryStats counts the requests from one country since the server started
+type CountryStats struct {
+	CountryCode string `json:"country_code"`
+	Views       uint64 `json:"views"`
+	Creations   uint64 `json:"creations"`
+	// Requests refused by the viewing or creation policy
+	Refused uint64 `json:"refused"`
+}
+
+// RecordRequest counts a request from a country; action is ActionView or
+// ActionCreate
+func (c *Client) RecordRequest(countryCode, action string, refused bool) {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	if c.stats == nil {
+		c.stats = make(map[string]*CountryStats)
+	}
+	s := c.stats[countryCode]
+	if s == nil {
+		s = &CountryStats{CountryCode: countryCode}
+		c.stats[countryCode] = s
+	}
+	if action == ActionCreate {
+		s.Creations++
+	} else {
+		s.Views++
+	}
+	if refused {
+		s.Refused++
+	}
+}
+
+// Stats returns the request counts of each country, busiest first
+func (c *Client) Stats() []CountryStats {
+	c.statsMu.Lock()
+	stats := make([]CountryStats, 0, len(c.stats))
+	for _, s := range c.stats {
+		stats = append(stats, *s)
+	}
+	c.statsMu.Unlock()
+
+	sort.Slice(stats, func(i, j int) bool {
+		a, b := stats[i].Views+stats[i].Creations, stats[j].Views+stats[j].Creations
+		if a != b {
+			return a > b
+		}
+		return stats[i].CountryCode < stats[j].CountryCode
+	})
+	return stats
+}
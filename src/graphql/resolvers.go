@@ -9,7 +9,11 @@ package graphql
 
 import (
 	"errors"
+	"fmt"
+	"strconv"
 
+	"github.com/casjay-forks/caspaste/src/netshare"
+	"github.com/casjay-forks/caspaste/src/redact"
 	"github.com/casjay-forks/caspaste/src/storage"
 )
 
@@ -22,6 +26,7 @@ type Resolvers struct {
 	maxBodyLen  int
 	maxTitleLen int
 	lexers      []string
+	redaction   *redact.Policy
 }
 
 // ResolversConfig holds configuration for resolvers
@@ -33,6 +38,7 @@ type ResolversConfig struct {
 	MaxBodyLen  int
 	MaxTitleLen int
 	Lexers      []string
+	Redaction   *redact.Policy
 }
 
 // NewResolvers creates a new resolvers instance
@@ -45,6 +51,7 @@ func NewResolvers(cfg *ResolversConfig) *Resolvers {
 		maxBodyLen:  cfg.MaxBodyLen,
 		maxTitleLen: cfg.MaxTitleLen,
 		lexers:      cfg.Lexers,
+		redaction:   cfg.Redaction,
 	}
 }
 
@@ -74,12 +81,15 @@ type PasteResult struct {
 	CreateTime  int64  `json:"createTime"`
 	DeleteTime  int64  `json:"deleteTime"`
 	OneUse      bool   `json:"oneUse"`
+	MaxViews    int    `json:"maxViews"`
+	ViewsLeft   int    `json:"viewsLeft"`
 	IsPrivate   bool   `json:"isPrivate"`
 	IsFile      bool   `json:"isFile"`
 	FileName    string `json:"fileName"`
 	MimeType    string `json:"mimeType"`
 	IsURL       bool   `json:"isUrl"`
 	OriginalURL string `json:"originalUrl"`
+	Encrypted   bool   `json:"encrypted"`
 }
 
 // PasteSummaryResult represents a paste summary
@@ -97,7 +107,15 @@ type CreatePasteResult struct {
 }
 
 // ResolveHealth resolves the healthz query
+// While the database circuit is open, cached pastes are served read-only
 func (r *Resolvers) ResolveHealth() *HealthResult {
+	if r.db != nil && r.db.Unavailable() {
+		return &HealthResult{
+			OK:      false,
+			Status:  "degraded",
+			Version: r.version,
+		}
+	}
 	return &HealthResult{
 		OK:      true,
 		Status:  "healthy",
@@ -128,6 +146,14 @@ func (r *Resolvers) ResolvePaste(id string) (*PasteResult, error) {
 		return nil, errors.New("paste not found")
 	}
 
+	// Reading a one-use paste counts as a view, as in the REST API
+	if paste.OneUse {
+		paste.ViewsLeft, err = r.db.PasteView(id)
+		if err != nil {
+			return nil, errors.New("paste not found")
+		}
+	}
+
 	return &PasteResult{
 		ID:          paste.ID,
 		Title:       paste.Title,
@@ -136,12 +162,15 @@ func (r *Resolvers) ResolvePaste(id string) (*PasteResult, error) {
 		CreateTime:  paste.CreateTime,
 		DeleteTime:  paste.DeleteTime,
 		OneUse:      paste.OneUse,
+		MaxViews:    paste.MaxViews,
+		ViewsLeft:   paste.ViewsLeft,
 		IsPrivate:   paste.IsPrivate,
 		IsFile:      paste.IsFile,
 		FileName:    paste.FileName,
 		MimeType:    paste.MimeType,
 		IsURL:       paste.IsURL,
 		OriginalURL: paste.OriginalURL,
+		Encrypted:   paste.Encrypted,
 	}, nil
 }
 
@@ -151,8 +180,8 @@ func (r *Resolvers) ResolvePastes() ([]*PasteSummaryResult, error) {
 		return nil, errors.New("database not available")
 	}
 
-	// PasteList(limit, offset)
-	pastes, err := r.db.PasteList(100, 0)
+	// PasteList(limit, offset, tag)
+	pastes, err := r.db.PasteList(100, 0, "")
 	if err != nil {
 		return nil, err
 	}
@@ -192,10 +221,27 @@ func (r *Resolvers) ResolveCreatePaste(input map[string]interface{}) (*CreatePas
 	if oneUse, ok := input["oneUse"].(bool); ok {
 		paste.OneUse = oneUse
 	}
+	if maxViews, ok := input["maxViews"].(float64); ok {
+		if maxViews < 0 || maxViews > netshare.MaxViews {
+			return nil, fmt.Errorf("maxViews must be between 0 and %d", netshare.MaxViews)
+		}
+		paste.MaxViews = int(maxViews)
+	}
 	if isPrivate, ok := input["isPrivate"].(bool); ok {
 		paste.IsPrivate = isPrivate
 	}
 
+	// Apply the redaction policy (redact: Boolean overrides it when allowed)
+	requested := ""
+	if redactInput, ok := input["redact"].(bool); ok {
+		requested = strconv.FormatBool(redactInput)
+	}
+	if r.redaction.ShouldRedact(requested) {
+		report := &redact.Report{}
+		paste.Title = r.redaction.Redact(paste.Title, report)
+		paste.Body = r.redaction.Redact(paste.Body, report)
+	}
+
 	// PasteAdd returns (id, createTime, deleteTime, error)
 	id, _, _, err := r.db.PasteAdd(paste)
 	if err != nil {
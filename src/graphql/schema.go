@@ -104,12 +104,15 @@ func (s *Schema) buildSchema() {
 			{Name: "createTime", Type: &TypeRef{Kind: "SCALAR", Name: "Int"}},
 			{Name: "deleteTime", Type: &TypeRef{Kind: "SCALAR", Name: "Int"}},
 			{Name: "oneUse", Type: &TypeRef{Kind: "SCALAR", Name: "Boolean"}},
+			{Name: "maxViews", Type: &TypeRef{Kind: "SCALAR", Name: "Int"}},
+			{Name: "viewsLeft", Type: &TypeRef{Kind: "SCALAR", Name: "Int"}},
 			{Name: "isPrivate", Type: &TypeRef{Kind: "SCALAR", Name: "Boolean"}},
 			{Name: "isFile", Type: &TypeRef{Kind: "SCALAR", Name: "Boolean"}},
 			{Name: "fileName", Type: &TypeRef{Kind: "SCALAR", Name: "String"}},
 			{Name: "mimeType", Type: &TypeRef{Kind: "SCALAR", Name: "String"}},
 			{Name: "isUrl", Type: &TypeRef{Kind: "SCALAR", Name: "Boolean"}},
 			{Name: "originalUrl", Type: &TypeRef{Kind: "SCALAR", Name: "String"}},
+			{Name: "encrypted", Type: &TypeRef{Kind: "SCALAR", Name: "Boolean"}},
 		},
 	}
 
@@ -148,6 +151,7 @@ func (s *Schema) buildSchema() {
 			{Name: "syntax", Type: &TypeRef{Kind: "SCALAR", Name: "String"}},
 			{Name: "expiration", Type: &TypeRef{Kind: "SCALAR", Name: "String"}},
 			{Name: "oneUse", Type: &TypeRef{Kind: "SCALAR", Name: "Boolean"}},
+			{Name: "maxViews", Type: &TypeRef{Kind: "SCALAR", Name: "Int"}},
 			{Name: "isPrivate", Type: &TypeRef{Kind: "SCALAR", Name: "Boolean"}},
 		},
 	}
@@ -333,12 +337,15 @@ type Paste {
   createTime: Int
   deleteTime: Int
   oneUse: Boolean
+  maxViews: Int
+  viewsLeft: Int
   isPrivate: Boolean
   isFile: Boolean
   fileName: String
   mimeType: String
   isUrl: Boolean
   originalUrl: String
+  encrypted: Boolean
 }
 
 type PasteSummary {
@@ -359,6 +366,7 @@ input PasteInput {
   syntax: String
   expiration: String
   oneUse: Boolean
+  maxViews: Int
   isPrivate: Boolean
 }
 `
@@ -0,0 +1,152 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+// Package homoglyph detects look-alike (confusable) names
+// Names are reduced to a "skeleton" so that paypa1, pаypal (Cyrillic а) and
+// xn--pypal-4ve all compare equal to paypal
+package homoglyph
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/net/idna"
+)
+
+// confusables maps look-alike runes to their ASCII prototype
+var confusables = map[rune]rune{
+	// Digits and ASCII look-alikes
+	'0': 'o', '1': 'l', '3': 'e', '5': 's', '|': 'l', 'i': 'l',
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'һ': 'h', 'і': 'l', 'ї': 'l', 'ј': 'j',
+	'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p', 'с': 'c', 'ѕ': 's', 'т': 't',
+	'у': 'y', 'х': 'x', 'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w', 'ɡ': 'g',
+	// Greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'l', 'κ': 'k', 'ν': 'v', 'ο': 'o',
+	'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x', 'ω': 'w',
+	// Latin with diacritics and other look-alikes
+	'à': 'a', 'á': 'a', 'â': 'a', 'ã': 'a', 'ä': 'a', 'å': 'a', 'ā': 'a',
+	'ç': 'c', 'ć': 'c', 'č': 'c',
+	'è': 'e', 'é': 'e', 'ê': 'e', 'ë': 'e', 'ē': 'e',
+	'ì': 'l', 'í': 'l', 'î': 'l', 'ï': 'l', 'ı': 'l', 'ł': 'l',
+	'ñ': 'n', 'ń': 'n',
+	'ò': 'o', 'ó': 'o', 'ô': 'o', 'õ': 'o', 'ö': 'o', 'ø': 'o', 'ō': 'o',
+	'ù': 'u', 'ú': 'u', 'û': 'u', 'ü': 'u', 'ū': 'u',
+	'ý': 'y', 'ÿ': 'y', 'ś': 's', 'š': 's', 'ž': 'z', 'ź': 'z', 'ż': 'z',
+}
+
+// sequences are multi-character look-alikes, applied after rune mapping
+var sequences = strings.NewReplacer("rn", "m", "vv", "w", "cl", "d")
+
+// Skeleton reduces a name to its confusable skeleton
+// Punycode labels are decoded first; separators (., -, _) are dropped
+func Skeleton(s string) string {
+	if decoded, err := idna.ToUnicode(s); err == nil {
+		s = decoded
+	}
+	s = strings.ToLower(s)
+
+	var b strings.Builder
+	for _, r := range s {
+		if r == '.' || r == '-' || r == '_' {
+			continue
+		}
+		if proto, ok := confusables[r]; ok {
+			r = proto
+		}
+		b.WriteRune(r)
+	}
+	return sequences.Replace(b.String())
+}
+
+// IsMixedScript reports whether a label mixes Latin letters with Cyrillic or Greek
+// Legitimate IDN labels are single-script; mixing is the classic spoofing pattern
+func IsMixedScript(label string) bool {
+	if decoded, err := idna.ToUnicode(label); err == nil {
+		label = decoded
+	}
+
+	var latin, other bool
+	for _, r := range label {
+		switch {
+		case r < unicode.MaxASCII:
+			if unicode.IsLetter(r) {
+				latin = true
+			}
+		case unicode.In(r, unicode.Latin):
+			latin = true
+		case unicode.In(r, unicode.Cyrillic, unicode.Greek):
+			other = true
+		}
+	}
+	return latin && other
+}
+
+// Checker matches names against reserved words by skeleton
+// A nil *Checker matches nothing
+type Checker struct {
+	mu        sync.RWMutex
+	skeletons map[string]string
+}
+
+// NewChecker creates a checker for the given reserved words
+func NewChecker(words []string) *Checker {
+	c := &Checker{skeletons: make(map[string]string)}
+	c.Add(words...)
+	return c
+}
+
+// Add reserves additional words
+func (c *Checker) Add(words ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, w := range words {
+		w = strings.TrimSpace(w)
+		if w == "" {
+			continue
+		}
+		c.skeletons[Skeleton(w)] = w
+	}
+}
+
+// LoadFile reserves every word in a blocklist file (one per line, # comments)
+func (c *Checker) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	c.Add(words...)
+	return nil
+}
+
+// Match reports whether name is, or looks like, a reserved word and returns that word
+func (c *Checker) Match(name string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	word, ok := c.skeletons[Skeleton(name)]
+	return word, ok
+}
@@ -0,0 +1,387 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+// Package jwt provides HS256 JSON Web Tokens for stateless API authentication
+// Tokens are signed with the newest key in a rotating keyring; older keys are
+// retained for verification so rotation does not invalidate live tokens
+package jwt
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults
+const (
+	DefaultTTL          = 15 * time.Minute
+	DefaultRetainedKeys = 3
+	keySize             = 32
+	// How often a token signed with an unknown key may trigger a reload
+	reloadInterval = time.Minute
+)
+
+// Common errors
+var (
+	ErrInvalidToken  = errors.New("invalid token")
+	ErrTokenExpired  = errors.New("token expired")
+	ErrUnknownKey    = errors.New("token signed with unknown key")
+	ErrEmptyKeyring  = errors.New("keyring has no keys")
+	ErrInvalidIssuer = errors.New("invalid token issuer")
+)
+
+// Key is a single HMAC signing key
+type Key struct {
+	ID        string
+	Secret    []byte
+	CreatedAt int64
+}
+
+// Keyring holds signing keys, newest first
+type Keyring struct {
+	mu       sync.RWMutex
+	path     string
+	keys     []Key
+	retained int
+	reloaded time.Time
+}
+
+// LoadKeyring loads keys from path, creating the file with a fresh key if it does not exist
+// File format is one key per line: "<kid> <created_unix> <base64 secret>"
+func LoadKeyring(path string) (*Keyring, error) {
+	k := &Keyring{path: path, retained: DefaultRetainedKeys}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		if err := k.Rotate(); err != nil {
+			return nil, err
+		}
+		return k, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("jwt keyring %s: malformed line", path)
+		}
+		created, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("jwt keyring %s: invalid timestamp: %w", path, err)
+		}
+		secret, err := base64.StdEncoding.DecodeString(fields[2])
+		if err != nil || len(secret) < keySize {
+			return nil, fmt.Errorf("jwt keyring %s: invalid key %s", path, fields[0])
+		}
+		k.keys = append(k.keys, Key{ID: fields[0], Secret: secret, CreatedAt: created})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(k.keys) == 0 {
+		if err := k.Rotate(); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// NewKeyring creates an in-memory keyring from a single static secret
+// Useful when the key is provided by the environment instead of a file
+func NewKeyring(secret []byte) (*Keyring, error) {
+	if len(secret) < keySize {
+		return nil, fmt.Errorf("jwt secret must be at least %d bytes", keySize)
+	}
+	sum := sha256.Sum256(secret)
+	return &Keyring{
+		keys:     []Key{{ID: hex.EncodeToString(sum[:4]), Secret: secret, CreatedAt: time.Now().Unix()}},
+		retained: 1,
+	}, nil
+}
+
+// FileBacked reports whether the keyring is saved to a file; only those
+// can be rotated, since every replica reloads the new key from the file
+func (k *Keyring) FileBacked() bool {
+	return k.path != ""
+}
+
+// Current returns the active signing key
+func (k *Keyring) Current() (Key, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if len(k.keys) == 0 {
+		return Key{}, ErrEmptyKeyring
+	}
+	return k.keys[0], nil
+}
+
+// Lookup finds a key by ID
+func (k *Keyring) Lookup(id string) (Key, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	for _, key := range k.keys {
+		if key.ID == id {
+			return key, true
+		}
+	}
+	return Key{}, false
+}
+
+// Rotate generates a new signing key, keeps the previous ones for
+// verification, and persists the keyring when it is file-backed
+func (k *Keyring) Rotate() error {
+	secret := make([]byte, keySize)
+	if _, err := rand.Read(secret); err != nil {
+		return err
+	}
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.keys = append([]Key{{ID: hex.EncodeToString(id), Secret: secret, CreatedAt: time.Now().Unix()}}, k.keys...)
+	if len(k.keys) > k.retained {
+		k.keys = k.keys[:k.retained]
+	}
+
+	return k.save()
+}
+
+// Reload re-reads a file-backed keyring, so keys rotated by another
+// replica verify here too; in-memory keyrings are left as they are
+func (k *Keyring) Reload() error {
+	if k.path == "" {
+		return nil
+	}
+	fresh, err := LoadKeyring(k.path)
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys = fresh.keys
+	k.reloaded = time.Now()
+	return nil
+}
+
+// reloadDue reports whether an unknown key ID may trigger a reload
+// Reloads are throttled so forged key IDs cannot make every request read the file
+func (k *Keyring) reloadDue() bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.path != "" && time.Since(k.reloaded) >= reloadInterval
+}
+
+// RotateIfOlder rotates the keyring when the current key is older than maxAge
+func (k *Keyring) RotateIfOlder(maxAge time.Duration) (bool, error) {
+	if maxAge <= 0 {
+		return false, nil
+	}
+	current, err := k.Current()
+	if err == nil && time.Since(time.Unix(current.CreatedAt, 0)) < maxAge {
+		return false, nil
+	}
+	return true, k.Rotate()
+}
+
+// save writes the keyring to disk (caller holds the lock)
+func (k *Keyring) save() error {
+	if k.path == "" {
+		return nil
+	}
+
+	var b strings.Builder
+	b.WriteString("# CasPaste JWT signing keys - newest first. Keep this file secret.\n")
+	for _, key := range k.keys {
+		fmt.Fprintf(&b, "%s %d %s\n", key.ID, key.CreatedAt, base64.StdEncoding.EncodeToString(key.Secret))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(k.path), 0700); err != nil {
+		return err
+	}
+	tmp := k.path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, k.path)
+}
+
+// Claims are the JWT claims CasPaste issues
+type Claims struct {
+	Subject   string `json:"sub"`
+	Username  string `json:"usr,omitempty"`
+	Role      string `json:"role,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+	ID        string `json:"jti,omitempty"`
+}
+
+// UserID returns the numeric user ID from the subject claim
+func (c *Claims) UserID() (int64, error) {
+	return strconv.ParseInt(c.Subject, 10, 64)
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid"`
+}
+
+// Issuer signs and verifies tokens
+type Issuer struct {
+	keyring *Keyring
+	issuer  string
+	ttl     time.Duration
+}
+
+// NewIssuer creates a token issuer
+func NewIssuer(keyring *Keyring, issuer string, ttl time.Duration) *Issuer {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &Issuer{keyring: keyring, issuer: issuer, ttl: ttl}
+}
+
+// TTL returns the token lifetime
+func (i *Issuer) TTL() time.Duration {
+	return i.ttl
+}
+
+// Issue creates a signed token for a user
+func (i *Issuer) Issue(userID int64, username, role string) (string, int64, error) {
+	key, err := i.keyring.Current()
+	if err != nil {
+		return "", 0, err
+	}
+
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", 0, err
+	}
+
+	now := time.Now()
+	claims := Claims{
+		Subject:   strconv.FormatInt(userID, 10),
+		Username:  username,
+		Role:      role,
+		Issuer:    i.issuer,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(i.ttl).Unix(),
+		ID:        hex.EncodeToString(jti),
+	}
+
+	token, err := sign(key, claims)
+	if err != nil {
+		return "", 0, err
+	}
+	return token, claims.ExpiresAt, nil
+}
+
+// Parse verifies a token's signature, expiry and issuer and returns its claims
+func (i *Issuer) Parse(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var h header
+	if err := json.Unmarshal(headerJSON, &h); err != nil {
+		return nil, ErrInvalidToken
+	}
+	// Only HS256 is accepted; never trust "none" or asymmetric algs here
+	if h.Alg != "HS256" {
+		return nil, ErrInvalidToken
+	}
+
+	key, ok := i.keyring.Lookup(h.Kid)
+	if !ok && i.keyring.reloadDue() && i.keyring.Reload() == nil {
+		key, ok = i.keyring.Lookup(h.Kid)
+	}
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if !hmac.Equal(sig, signature(key.Secret, parts[0]+"."+parts[1])) {
+		return nil, ErrInvalidToken
+	}
+
+	claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var claims Claims
+	if err := json.Unmarshal(claimsJSON, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrTokenExpired
+	}
+	if i.issuer != "" && claims.Issuer != i.issuer {
+		return nil, ErrInvalidIssuer
+	}
+
+	return &claims, nil
+}
+
+// LooksLikeJWT reports whether a bearer credential has the three-part JWT shape
+func LooksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2 && strings.HasPrefix(token, "eyJ")
+}
+
+func sign(key Key, claims Claims) (string, error) {
+	headerJSON, err := json.Marshal(header{Alg: "HS256", Typ: "JWT", Kid: key.ID})
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature(key.Secret, signingInput)), nil
+}
+
+func signature(secret []byte, input string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(input))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,37 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package leader
+
+import (
+	"context"
+	"time"
+)
+
+// LeaseStore is implemented by storage.DB
+type LeaseStore interface {
+	LeaseAcquire(name, holder string, ttl time.Duration) (bool, error)
+	LeaseRelease(name, holder string) error
+}
+
+type databaseBackend struct {
+	store LeaseStore
+	name  string
+}
+
+// Database keeps the lease in a row of the shared database
+// Replica clocks must be kept in sync (NTP), as expiry uses local time
+func Database(store LeaseStore, name string) Backend {
+	return &databaseBackend{store: store, name: name}
+}
+
+func (b *databaseBackend) Acquire(_ context.Context, holder string, ttl time.Duration) (bool, error) {
+	return b.store.LeaseAcquire(b.name, holder, ttl)
+}
+
+func (b *databaseBackend) Release(_ context.Context, holder string) error {
+	return b.store.LeaseRelease(b.name, holder)
+}
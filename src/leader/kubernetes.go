@@ -0,0 +1,228 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package leader
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// serviceAccountDir holds the credentials Kubernetes mounts into every pod
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// microTime is the timestamp format of Lease renewTime and acquireTime
+const microTime = "2006-01-02T15:04:05.000000Z07:00"
+
+// errConflict means another replica changed the lease between read and write
+var errConflict = errors.New("lease was modified concurrently")
+
+type kubernetesBackend struct {
+	client    *http.Client
+	url       string
+	name      string
+	namespace string
+}
+
+// lease is the part of a coordination.k8s.io/v1 Lease that election uses
+type lease struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name            string `json:"name"`
+		Namespace       string `json:"namespace"`
+		ResourceVersion string `json:"resourceVersion,omitempty"`
+	} `json:"metadata"`
+	Spec struct {
+		HolderIdentity       string `json:"holderIdentity,omitempty"`
+		LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+		AcquireTime          string `json:"acquireTime,omitempty"`
+		RenewTime            string `json:"renewTime,omitempty"`
+		LeaseTransitions     int    `json:"leaseTransitions"`
+	} `json:"spec"`
+}
+
+// Kubernetes keeps the lease in a coordination.k8s.io Lease object, using the
+// pod's service account. The account needs get, create and update on leases
+// in the namespace (default: the pod's own namespace).
+func Kubernetes(name, namespace string) (Backend, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a Kubernetes pod (KUBERNETES_SERVICE_HOST is not set)")
+	}
+
+	if namespace == "" {
+		data, err := os.ReadFile(serviceAccountDir + "/namespace")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read pod namespace: %w", err)
+		}
+		namespace = strings.TrimSpace(string(data))
+	}
+
+	ca, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cluster CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("invalid cluster CA certificate")
+	}
+
+	return &kubernetesBackend{
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+		url:       "https://" + net.JoinHostPort(host, port) + "/apis/coordination.k8s.io/v1/namespaces/" + namespace + "/leases",
+		name:      name,
+		namespace: namespace,
+	}, nil
+}
+
+func (b *kubernetesBackend) Acquire(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	current, err := b.get(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if current == nil {
+		l := &lease{APIVersion: "coordination.k8s.io/v1", Kind: "Lease"}
+		l.Metadata.Name = b.name
+		l.Metadata.Namespace = b.namespace
+		l.Spec.HolderIdentity = holder
+		l.Spec.LeaseDurationSeconds = int(ttl.Seconds())
+		l.Spec.AcquireTime = now.UTC().Format(microTime)
+		l.Spec.RenewTime = l.Spec.AcquireTime
+		err = b.write(ctx, http.MethodPost, b.url, l)
+	} else {
+		if current.Spec.HolderIdentity != holder && !current.expired(now) {
+			return false, nil
+		}
+		if current.Spec.HolderIdentity != holder {
+			current.Spec.HolderIdentity = holder
+			current.Spec.AcquireTime = now.UTC().Format(microTime)
+			current.Spec.LeaseTransitions++
+		}
+		current.Spec.LeaseDurationSeconds = int(ttl.Seconds())
+		current.Spec.RenewTime = now.UTC().Format(microTime)
+		// resourceVersion makes the update fail if another replica wrote first
+		err = b.write(ctx, http.MethodPut, b.url+"/"+b.name, current)
+	}
+
+	if errors.Is(err, errConflict) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (b *kubernetesBackend) Release(ctx context.Context, holder string) error {
+	current, err := b.get(ctx)
+	if err != nil || current == nil || current.Spec.HolderIdentity != holder {
+		return err
+	}
+	// Same as client-go: an empty holder with a short lease lets others take over at once
+	current.Spec.HolderIdentity = ""
+	current.Spec.LeaseDurationSeconds = 1
+	current.Spec.RenewTime = time.Now().UTC().Format(microTime)
+	err = b.write(ctx, http.MethodPut, b.url+"/"+b.name, current)
+	if errors.Is(err, errConflict) {
+		return nil
+	}
+	return err
+}
+
+// get returns the lease, or nil if it does not exist yet
+func (b *kubernetesBackend) get(ctx context.Context) (*lease, error) {
+	resp, err := b.do(ctx, http.MethodGet, b.url+"/"+b.name, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp)
+	}
+
+	var l lease
+	if err := json.NewDecoder(resp.Body).Decode(&l); err != nil {
+		return nil, fmt.Errorf("failed to decode lease: %w", err)
+	}
+	return &l, nil
+}
+
+func (b *kubernetesBackend) write(ctx context.Context, method, url string, l *lease) error {
+	body, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	resp, err := b.do(ctx, method, url, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return nil
+	case http.StatusConflict:
+		return errConflict
+	default:
+		return statusError(resp)
+	}
+}
+
+func (b *kubernetesBackend) do(ctx context.Context, method, url string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	// The token is re-read on every request because the kubelet rotates it
+	token, err := os.ReadFile(serviceAccountDir + "/token")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account token: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return b.client.Do(req)
+}
+
+// expired reports whether the holder has stopped renewing the lease
+func (l *lease) expired(now time.Time) bool {
+	if l.Spec.HolderIdentity == "" {
+		return true
+	}
+	renewed, err := time.Parse(time.RFC3339Nano, l.Spec.RenewTime)
+	if err != nil {
+		return true
+	}
+	return now.After(renewed.Add(time.Duration(l.Spec.LeaseDurationSeconds) * time.Second))
+}
+
+func statusError(resp *http.Response) error {
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("forbidden: grant the service account get, create and update on leases (%s)", strings.TrimSpace(string(message)))
+	}
+	return fmt.Errorf("kubernetes API returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+}
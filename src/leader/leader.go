@@ -0,0 +1,150 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+// Package leader elects one replica to run background jobs
+// Replicas sharing a database would otherwise each delete expired pastes,
+// rebuild the mirror and take backups. The elected replica holds a lease that
+// it renews well before it expires; if it dies, another takes over once the
+// lease runs out.
+package leader
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultTTL is how long a lease is valid without renewal
+const DefaultTTL = 15 * time.Second
+
+// Backend stores the lease
+type Backend interface {
+	// Acquire takes or renews the lease for holder, reporting whether holder owns it
+	Acquire(ctx context.Context, holder string, ttl time.Duration) (bool, error)
+	// Release gives up the lease if holder owns it
+	Release(ctx context.Context, holder string) error
+}
+
+// Config configures an Elector
+type Config struct {
+	// Identity of this replica (default: hostname plus a random suffix)
+	Identity string
+	// Lease duration (0 = DefaultTTL); the lease is renewed every TTL/3
+	TTL time.Duration
+	// OnChange is called when this replica gains or loses leadership
+	OnChange func(leader bool)
+	// Logf reports backend errors (optional)
+	Logf func(format string, args ...interface{})
+}
+
+// Elector tracks whether this replica is the leader
+// An Elector without a backend is always the leader, for single-node installs
+type Elector struct {
+	backend  Backend
+	identity string
+	ttl      time.Duration
+	onChange func(bool)
+	logf     func(string, ...interface{})
+	leader   atomic.Bool
+}
+
+// New creates an elector; a nil backend disables election
+func New(backend Backend, cfg Config) *Elector {
+	e := &Elector{
+		backend:  backend,
+		identity: cfg.Identity,
+		ttl:      cfg.TTL,
+		onChange: cfg.OnChange,
+		logf:     cfg.Logf,
+	}
+	if e.identity == "" {
+		e.identity = defaultIdentity()
+	}
+	if e.ttl <= 0 {
+		e.ttl = DefaultTTL
+	}
+	if backend == nil {
+		e.leader.Store(true)
+	}
+	return e
+}
+
+// IsLeader reports whether this replica should run background jobs
+func (e *Elector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Identity returns the name this replica holds the lease under
+func (e *Elector) Identity() string {
+	return e.identity
+}
+
+// Run campaigns for the lease until ctx is done, then releases it
+func (e *Elector) Run(ctx context.Context) {
+	if e.backend == nil {
+		return
+	}
+
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+
+	var renewed time.Time
+	for {
+		acquired, err := e.backend.Acquire(ctx, e.identity, e.ttl)
+		if err != nil {
+			e.log("leader election: %v", err)
+			// Keep leading on transient errors until the lease would have expired
+			acquired = e.IsLeader() && time.Since(renewed) < e.ttl
+		} else if acquired {
+			renewed = time.Now()
+		}
+		e.set(acquired)
+
+		select {
+		case <-ctx.Done():
+			if e.IsLeader() {
+				releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				if err := e.backend.Release(releaseCtx, e.identity); err != nil {
+					e.log("leader election: release: %v", err)
+				}
+				cancel()
+			}
+			e.set(false)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (e *Elector) set(leader bool) {
+	if e.leader.Swap(leader) != leader && e.onChange != nil {
+		e.onChange(leader)
+	}
+}
+
+func (e *Elector) log(format string, args ...interface{}) {
+	if e.logf != nil {
+		e.logf(format, args...)
+	}
+}
+
+// defaultIdentity is unique per process, so two instances on one host never
+// both believe they hold the lease
+func defaultIdentity() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "caspaste"
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Sprintf("%s_%d", host, os.Getpid())
+	}
+	return host + "_" + hex.EncodeToString(suffix)
+}
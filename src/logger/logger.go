@@ -15,6 +15,7 @@ import (
 	"os"
 	"runtime"
 	"strconv"
+	"sync/atomic"
 	"time"
 )
 
@@ -55,6 +56,15 @@ type Logger struct {
 	debugMode  bool
 }
 
+// countryOf returns the country code of a client IP for access logs (nil = none)
+var countryOf atomic.Pointer[func(ip string) string]
+
+// SetCountry records the country code of clients in access logs
+// country returns "" for an IP it cannot place
+func SetCountry(country func(ip string) string) {
+	countryOf.Store(&country)
+}
+
 func New(timeFormat string) Logger {
 	return Logger{
 		TimeFormat: timeFormat,
@@ -250,6 +260,11 @@ func (cfg Logger) HttpRequest(req *http.Request, code int) {
 	if userAgent == "" {
 		userAgent = "-"
 	}
+	// Client country, when GeoIP is enabled
+	country := ""
+	if fn := countryOf.Load(); fn != nil {
+		country = (*fn)(clientIP)
+	}
 	
 	// Write to access.log file - HTTP request logs
 	if cfg.accessFile != nil {
@@ -265,30 +280,44 @@ func (cfg Logger) HttpRequest(req *http.Request, code int) {
 				"referer":    referer,
 				"user_agent": userAgent,
 			}
+			if country != "" {
+				entry["country"] = country
+			}
 			data, _ := json.Marshal(entry)
 			fmt.Fprintln(cfg.accessFile, string(data))
 			
 		case "nginx":
-			// Nginx Combined Log Format
+			// Nginx Combined Log Format, with the country as an extra field
 			timestamp := time.Now().Format("02/Jan/2006:15:04:05 -0700")
-			fmt.Fprintf(cfg.accessFile, "%s - - [%s] \"%s %s %s\" %d 0 \"%s\" \"%s\"\n",
-				clientIP, timestamp, method, path, req.Proto, code, referer, userAgent)
+			fmt.Fprintf(cfg.accessFile, "%s - - [%s] \"%s %s %s\" %d 0 \"%s\" \"%s\"%s\n",
+				clientIP, timestamp, method, path, req.Proto, code, referer, userAgent, countryField(country))
 			
 		case "text":
 			// Simple text format
 			timestamp := time.Now().Format(cfg.TimeFormat)
+			if country != "" {
+				clientIP += " " + country
+			}
 			fmt.Fprintf(cfg.accessFile, "%s %s %s %s %d %s\n",
 				timestamp, clientIP, method, path, code, userAgent)
 			
 		default: // "apache" or unspecified
-			// Apache Combined Log Format (default)
+			// Apache Combined Log Format (default), with the country as an extra field
 			timestamp := time.Now().Format("02/Jan/2006:15:04:05 -0700")
-			fmt.Fprintf(cfg.accessFile, "%s - - [%s] \"%s %s %s\" %d - \"%s\" \"%s\"\n",
-				clientIP, timestamp, method, path, req.Proto, code, referer, userAgent)
+			fmt.Fprintf(cfg.accessFile, "%s - - [%s] \"%s %s %s\" %d - \"%s\" \"%s\"%s\n",
+				clientIP, timestamp, method, path, req.Proto, code, referer, userAgent, countryField(country))
 		}
 	}
 }
 
+// countryField returns the country appended to combined log lines, or ""
+func countryField(country string) string {
+	if country == "" {
+		return ""
+	}
+	return ` "` + country + `"`
+}
+
 func (cfg Logger) HttpError(req *http.Request, e error) {
 	clientIP := netshare.GetClientAddr(req).String()
 	path := req.URL.Path
@@ -0,0 +1,207 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+// Package maintenance schedules maintenance windows
+// Requests are checked against the windows held in memory, so a window starts
+// and ends on time; the scheduler reloads them so every replica sees changes
+package maintenance
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/storage"
+)
+
+// ErrInvalidWindow is returned for a window with bad times or message
+var ErrInvalidWindow = errors.New("maintenance: invalid window")
+
+const (
+	// DefaultAnnounce is how long before a window the banner is shown when no
+	// announce time is given
+	DefaultAnnounce = 24 * time.Hour
+	// MessageMaxLength is the longest window message
+	MessageMaxLength = 500
+)
+
+// Store is implemented by storage.DB
+type Store interface {
+	MaintenanceWindowList() ([]storage.MaintenanceWindow, error)
+	MaintenanceWindowAdd(w storage.MaintenanceWindow) (storage.MaintenanceWindow, error)
+	MaintenanceWindowUpdate(w storage.MaintenanceWindow) error
+	MaintenanceWindowDelete(id string) error
+}
+
+// Schedule holds the maintenance windows; it is safe for concurrent use
+// A nil Schedule has no windows
+type Schedule struct {
+	store Store
+
+	mu      sync.RWMutex
+	windows []storage.MaintenanceWindow
+	active  string
+}
+
+// New creates a schedule backed by store; call Refresh to load it
+func New(store Store) *Schedule {
+	return &Schedule{store: store}
+}
+
+// Validate checks a window and fills in the default announce time
+func Validate(w *storage.MaintenanceWindow) error {
+	if w.StartsAt <= 0 || w.EndsAt <= w.StartsAt {
+		return fmt.Errorf("%w: ends_at must be after starts_at", ErrInvalidWindow)
+	}
+	if w.AnnounceAt == 0 {
+		w.AnnounceAt = w.StartsAt - int64(DefaultAnnounce/time.Second)
+	}
+	if w.AnnounceAt > w.StartsAt {
+		return fmt.Errorf("%w: announce_at must not be after starts_at", ErrInvalidWindow)
+	}
+	if len(w.Message) > MessageMaxLength {
+		return fmt.Errorf("%w: message is longer than %d characters", ErrInvalidWindow, MessageMaxLength)
+	}
+	return nil
+}
+
+// Refresh reloads the windows from the store
+// It returns the window that started or ended since the last Refresh, if any
+func (s *Schedule) Refresh(now time.Time) (started, ended *storage.MaintenanceWindow, err error) {
+	windows, err := s.store.MaintenanceWindowList()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, found := find(s.windows, s.active)
+	if !found {
+		// Deleted while it was running
+		previous.ID = s.active
+	}
+	s.windows = windows
+	current, ok := active(windows, now)
+	if current.ID == s.active {
+		return nil, nil, nil
+	}
+	if s.active != "" {
+		ended = &previous
+	}
+	if ok {
+		started = &current
+	}
+	s.active = current.ID
+	return started, ended, nil
+}
+
+// reload reads the windows after a change without touching the transition state
+func (s *Schedule) reload() error {
+	windows, err := s.store.MaintenanceWindowList()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.windows = windows
+	s.mu.Unlock()
+	return nil
+}
+
+// List returns all windows, earliest first
+func (s *Schedule) List() []storage.MaintenanceWindow {
+	if s == nil {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]storage.MaintenanceWindow{}, s.windows...)
+}
+
+// Add stores a new window
+func (s *Schedule) Add(w storage.MaintenanceWindow, now time.Time) (storage.MaintenanceWindow, error) {
+	if err := Validate(&w); err != nil {
+		return w, err
+	}
+	if w.EndsAt <= now.Unix() {
+		return w, fmt.Errorf("%w: the window has already ended", ErrInvalidWindow)
+	}
+	w, err := s.store.MaintenanceWindowAdd(w)
+	if err != nil {
+		return w, err
+	}
+	return w, s.reload()
+}
+
+// Update replaces the times and message of a window
+// Setting ends_at to now ends a running window early
+func (s *Schedule) Update(w storage.MaintenanceWindow) (storage.MaintenanceWindow, error) {
+	if err := Validate(&w); err != nil {
+		return w, err
+	}
+	if err := s.store.MaintenanceWindowUpdate(w); err != nil {
+		return w, err
+	}
+	return w, s.reload()
+}
+
+// Delete removes a window
+func (s *Schedule) Delete(id string) error {
+	if err := s.store.MaintenanceWindowDelete(id); err != nil {
+		return err
+	}
+	return s.reload()
+}
+
+// Active returns the window in effect at now
+func (s *Schedule) Active(now time.Time) (storage.MaintenanceWindow, bool) {
+	if s == nil {
+		return storage.MaintenanceWindow{}, false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return active(s.windows, now)
+}
+
+// Upcoming returns the next window whose announcement has begun
+func (s *Schedule) Upcoming(now time.Time) (storage.MaintenanceWindow, bool) {
+	if s == nil {
+		return storage.MaintenanceWindow{}, false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t := now.Unix()
+	for _, w := range s.windows {
+		if w.AnnounceAt <= t && t < w.StartsAt {
+			return w, true
+		}
+	}
+	return storage.MaintenanceWindow{}, false
+}
+
+// active returns the window covering now; overlapping windows are merged by
+// returning the one that ends last
+func active(windows []storage.MaintenanceWindow, now time.Time) (storage.MaintenanceWindow, bool) {
+	t := now.Unix()
+	var found storage.MaintenanceWindow
+	for _, w := range windows {
+		if w.StartsAt <= t && t < w.EndsAt && w.EndsAt > found.EndsAt {
+			found = w
+		}
+	}
+	return found, found.ID != ""
+}
+
+func find(windows []storage.MaintenanceWindow, id string) (storage.MaintenanceWindow, bool) {
+	for _, w := range windows {
+		if w.ID == id {
+			return w, true
+		}
+	}
+	return storage.MaintenanceWindow{}, false
+}
@@ -9,10 +9,14 @@
 package metric
 
 import (
+	"crypto/subtle"
+	"fmt"
+	"net"
 	"net/http"
 	"regexp"
 	"runtime"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -33,6 +37,13 @@ type Config struct {
 	IncludeRuntime bool
 	// Token for optional bearer token authentication
 	Token string
+	// Authorize, if set, also admits requests it accepts (e.g. API tokens with
+	// the metrics:read scope) and turns authentication on even without Token
+	Authorize func(r *http.Request) bool
+	// AllowedNets limits scrapes to these source networks; empty = any source
+	AllowedNets []*net.IPNet
+	// ClientIP returns the source address of a request (default: RemoteAddr)
+	ClientIP func(r *http.Request) net.IP
 	// DurationBuckets for request duration histogram
 	DurationBuckets []float64
 	// SizeBuckets for request/response size histogram
@@ -159,6 +170,20 @@ var (
 		[]string{"operation", "error_type"},
 	)
 
+	DBCircuitState = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "caspaste_db_circuit_state",
+			Help: "Database circuit breaker state (0 = closed, 2 = open)",
+		},
+	)
+
+	DBRejected = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "caspaste_db_rejected_total",
+			Help: "Database queries failed at once while the circuit was open",
+		},
+	)
+
 	// Authentication metrics (REQUIRED per AI.md PART 21)
 	AuthAttempts = promauto.NewCounterVec(
 		prometheus.CounterOpts{
@@ -233,6 +258,51 @@ var (
 		[]string{"limit"},
 	)
 
+	// GeoIP metrics
+	GeoIPCreationBlockedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "caspaste_geoip_creation_blocked_total",
+			Help: "Paste creations refused by the GeoIP policy, by country and reason (country, asn)",
+		},
+		[]string{"country", "reason"},
+	)
+	GeoIPViewingBlockedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "caspaste_geoip_viewing_blocked_total",
+			Help: "Requests refused by the GeoIP viewing policy, by country and reason (country, asn)",
+		},
+		[]string{"country", "reason"},
+	)
+	GeoIPRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "caspaste_geoip_requests_total",
+			Help: "Requests by client country and action (view, create)",
+		},
+		[]string{"country", "action"},
+	)
+
+	// Firewall metrics
+	FirewallBlockedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "caspaste_firewall_blocked_total",
+			Help: "Requests refused by a firewall ban, by ban source (admin, auto)",
+		},
+		[]string{"source"},
+	)
+	FirewallAutoBansTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "caspaste_firewall_auto_bans_total",
+			Help: "Addresses banned for repeated rate limit violations",
+		},
+	)
+	SpamHeldTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "caspaste_spam_held_total",
+			Help: "Pastes held for review by the spam filter, by the rule matched first",
+		},
+		[]string{"rule"},
+	)
+
 	// Go runtime metrics (if include_runtime: true)
 	GoGoroutines = promauto.NewGauge(
 		prometheus.GaugeOpts{
@@ -297,6 +367,64 @@ var (
 			Help: "Total bytes of all pastes",
 		},
 	)
+
+	PastesStoredTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "caspaste_pastes_stored_total",
+			Help: "Paste bodies written, by storage strategy (inline, gzip, blob)",
+		},
+		[]string{"strategy"},
+	)
+
+	// Outbound delivery metrics (notification emails, webhooks)
+	DispatchQueueDepth = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "caspaste_dispatch_queue_depth",
+			Help: "Outbound deliveries waiting for a worker",
+		},
+	)
+
+	DispatchDeliveriesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "caspaste_dispatch_deliveries_total",
+			Help: "Outbound deliveries by kind and result (success, failure, rejected, dropped)",
+		},
+		[]string{"kind", "result"},
+	)
+
+	DispatchDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "caspaste_dispatch_duration_seconds",
+			Help:    "Time taken by outbound deliveries",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"kind"},
+	)
+
+	DispatchCircuitState = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "caspaste_dispatch_circuit_state",
+			Help: "Circuit breaker state per destination (0 = closed, 1 = half-open, 2 = open)",
+		},
+		[]string{"destination"},
+	)
+
+	// Client telemetry from the X-Client-Version header
+	ClientRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "caspaste_client_requests_total",
+			Help: "API requests by client, client version and the API version it was built for",
+		},
+		[]string{"client", "version", "api"},
+	)
+
+	PasteBodySize = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "caspaste_paste_body_size_bytes",
+			Help:    "Size of paste bodies written, before compression",
+			Buckets: []float64{1024, 4096, 16384, 65536, 262144, 1048576, 4194304},
+		},
+	)
 )
 
 var (
@@ -305,6 +433,8 @@ var (
 	numericIDRegex = regexp.MustCompile(`/[0-9]+(?:/|$)`)
 	// CasPaste paste ID pattern (alphanumeric)
 	pasteIDRegex = regexp.MustCompile(`/[a-zA-Z0-9]{6,}(?:/|$)`)
+	// Client names and versions reported by clients
+	clientLabelRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._+-]{0,31}$`)
 
 	// Global state
 	startTime time.Time
@@ -402,28 +532,101 @@ func NormalizePath(path string) string {
 	return path
 }
 
+// ParseAllowedIPs parses the IP addresses and CIDR networks allowed to scrape
+func ParseAllowedIPs(entries []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, entry := range entries {
+		s := strings.TrimSpace(entry)
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("%q is not an IP address", entry)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a network", entry)
+		}
+		nets = append(nets, network)
+	}
+	return nets, nil
+}
+
+// remoteIP is the default ClientIP: the address of the connection
+func remoteIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
+
 // Handler returns the Prometheus metrics HTTP handler with optional auth
+// Sources outside AllowedNets get 403; a missing token gets 401 and a wrong
+// one 403
 func Handler(cfg Config) http.Handler {
 	promHandler := promhttp.Handler()
 
-	if cfg.Token == "" {
+	if cfg.Token == "" && cfg.Authorize == nil && len(cfg.AllowedNets) == 0 {
 		return promHandler
 	}
 
-	// Wrap with token authentication
+	clientIP := cfg.ClientIP
+	if clientIP == nil {
+		clientIP = remoteIP
+	}
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		auth := r.Header.Get("Authorization")
-		expected := "Bearer " + cfg.Token
+		if len(cfg.AllowedNets) > 0 && !allowed(cfg.AllowedNets, clientIP(r)) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		if cfg.Token == "" && cfg.Authorize == nil {
+			promHandler.ServeHTTP(w, r)
+			return
+		}
 
-		if auth != expected {
+		// Token authentication
+		auth := r.Header.Get("Authorization")
+		if auth == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
+		expected := "Bearer " + cfg.Token
+		tokenOK := cfg.Token != "" && subtle.ConstantTimeCompare([]byte(auth), []byte(expected)) == 1
+		if !tokenOK && (cfg.Authorize == nil || !cfg.Authorize(r)) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
 
 		promHandler.ServeHTTP(w, r)
 	})
 }
 
+// allowed checks if ip is in one of nets
+func allowed(nets []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
 // ResponseWriter wraps http.ResponseWriter to capture status and size
 type ResponseWriter struct {
 	http.ResponseWriter
@@ -444,6 +647,11 @@ func (rw *ResponseWriter) Write(b []byte) (int, error) {
 	return n, err
 }
 
+// Unwrap lets http.ResponseController reach the underlying writer
+func (rw *ResponseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 // NewResponseWriter creates a new metrics response writer
 func NewResponseWriter(w http.ResponseWriter) *ResponseWriter {
 	return &ResponseWriter{
@@ -454,9 +662,13 @@ func NewResponseWriter(w http.ResponseWriter) *ResponseWriter {
 
 // Middleware creates HTTP metrics middleware per AI.md PART 21
 func Middleware(cfg Config) func(http.Handler) http.Handler {
+	// Requests are counted for the admin dashboard even without Prometheus
 	if !cfg.Enabled {
 		return func(next http.Handler) http.Handler {
-			return next
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.add(time.Now())
+				next.ServeHTTP(w, r)
+			})
 		}
 	}
 
@@ -469,6 +681,7 @@ func Middleware(cfg Config) func(http.Handler) http.Handler {
 			}
 
 			start := time.Now()
+			requests.add(start)
 
 			// Track active requests
 			HTTPActiveRequests.Inc()
@@ -580,6 +793,37 @@ func UpdateDBConnections(open, inUse int) {
 	DBConnectionsInUse.Set(float64(inUse))
 }
 
+// UpdateDBCircuitState sets the state of the database circuit breaker
+func UpdateDBCircuitState(state string) {
+	mu.RLock()
+	enabled := config.Enabled
+	mu.RUnlock()
+
+	if !enabled {
+		return
+	}
+
+	value := 0.0
+	if state == "open" {
+		value = 2
+	}
+	DBCircuitState.Set(value)
+}
+
+// RecordDBRejected records a query failed at once while the database
+// circuit was open
+func RecordDBRejected() {
+	mu.RLock()
+	enabled := config.Enabled
+	mu.RUnlock()
+
+	if !enabled {
+		return
+	}
+
+	DBRejected.Inc()
+}
+
 // RecordRateLimit records a rate limit event
 func RecordRateLimit(limitType, status string) {
 	mu.RLock()
@@ -596,6 +840,84 @@ func RecordRateLimit(limitType, status string) {
 	}
 }
 
+// RecordGeoIPCreationBlocked records a paste creation refused by the GeoIP policy
+func RecordGeoIPCreationBlocked(country, reason string) {
+	mu.RLock()
+	enabled := config.Enabled
+	mu.RUnlock()
+
+	if !enabled {
+		return
+	}
+
+	GeoIPCreationBlockedTotal.WithLabelValues(country, reason).Inc()
+}
+
+// RecordGeoIPViewingBlocked records a request refused by the GeoIP viewing policy
+func RecordGeoIPViewingBlocked(country, reason string) {
+	mu.RLock()
+	enabled := config.Enabled
+	mu.RUnlock()
+
+	if !enabled {
+		return
+	}
+
+	GeoIPViewingBlockedTotal.WithLabelValues(country, reason).Inc()
+}
+
+// RecordGeoIPRequest records a request by the country of its client
+func RecordGeoIPRequest(country, action string) {
+	mu.RLock()
+	enabled := config.Enabled
+	mu.RUnlock()
+
+	if !enabled {
+		return
+	}
+
+	GeoIPRequestsTotal.WithLabelValues(country, action).Inc()
+}
+
+// RecordFirewallBlocked records a request refused by a firewall ban
+func RecordFirewallBlocked(source string) {
+	mu.RLock()
+	enabled := config.Enabled
+	mu.RUnlock()
+
+	if !enabled {
+		return
+	}
+
+	FirewallBlockedTotal.WithLabelValues(source).Inc()
+}
+
+// RecordFirewallAutoBan records an address banned for repeated rate limit violations
+func RecordFirewallAutoBan() {
+	mu.RLock()
+	enabled := config.Enabled
+	mu.RUnlock()
+
+	if !enabled {
+		return
+	}
+
+	FirewallAutoBansTotal.Inc()
+}
+
+// RecordPasteHeld records a paste held for review by the spam filter
+func RecordPasteHeld(rule string) {
+	mu.RLock()
+	enabled := config.Enabled
+	mu.RUnlock()
+
+	if !enabled {
+		return
+	}
+
+	SpamHeldTotal.WithLabelValues(rule).Inc()
+}
+
 // RecordPasteCreated records a paste creation
 func RecordPasteCreated() {
 	mu.RLock()
@@ -622,6 +944,20 @@ func RecordPasteDeleted() {
 	PastesDeletedTotal.Inc()
 }
 
+// RecordPasteStored records a paste body written with a storage strategy
+func RecordPasteStored(strategy string, size int) {
+	mu.RLock()
+	enabled := config.Enabled
+	mu.RUnlock()
+
+	if !enabled {
+		return
+	}
+
+	PastesStoredTotal.WithLabelValues(strategy).Inc()
+	PasteBodySize.Observe(float64(size))
+}
+
 // UpdatePasteStats updates paste statistics
 func UpdatePasteStats(total int64, totalBytes int64) {
 	mu.RLock()
@@ -662,6 +998,19 @@ func RecordCacheMiss(cacheName string) {
 	CacheMisses.WithLabelValues(cacheName).Inc()
 }
 
+// RecordCacheEvictions records entries evicted from a cache
+func RecordCacheEvictions(cacheName string, count int) {
+	mu.RLock()
+	enabled := config.Enabled
+	mu.RUnlock()
+
+	if !enabled {
+		return
+	}
+
+	CacheEvictions.WithLabelValues(cacheName).Add(float64(count))
+}
+
 // UpdateCacheSize updates cache size metrics
 func UpdateCacheSize(cacheName string, items int, bytes int64) {
 	mu.RLock()
@@ -676,6 +1025,108 @@ func UpdateCacheSize(cacheName string, items int, bytes int64) {
 	CacheBytes.WithLabelValues(cacheName).Set(float64(bytes))
 }
 
+// UpdateDispatchQueue sets the number of outbound deliveries waiting
+func UpdateDispatchQueue(depth int) {
+	mu.RLock()
+	enabled := config.Enabled
+	mu.RUnlock()
+
+	if !enabled {
+		return
+	}
+
+	DispatchQueueDepth.Set(float64(depth))
+}
+
+// maxClientLabels bounds the client label sets, since clients choose the values
+const maxClientLabels = 200
+
+var (
+	clientMu     sync.Mutex
+	clientLabels = map[string]bool{}
+)
+
+// RecordClient counts an API request by the client that made it
+// Values that are not plain names or versions, and label sets past
+// maxClientLabels, are counted as "other"
+func RecordClient(name, version, api string) {
+	mu.RLock()
+	enabled := config.Enabled
+	mu.RUnlock()
+
+	if !enabled {
+		return
+	}
+
+	labels := []string{name, version, api}
+	for i, value := range labels {
+		if value == "" {
+			labels[i] = "unknown"
+		} else if !clientLabelRegex.MatchString(value) {
+			labels[i] = "other"
+		}
+	}
+
+	key := strings.Join(labels, "/")
+	clientMu.Lock()
+	if !clientLabels[key] {
+		if len(clientLabels) < maxClientLabels {
+			clientLabels[key] = true
+		} else {
+			labels = []string{"other", "other", "other"}
+		}
+	}
+	clientMu.Unlock()
+
+	ClientRequestsTotal.WithLabelValues(labels...).Inc()
+}
+
+// RecordDelivery records the result of an outbound delivery
+func RecordDelivery(kind, result string) {
+	mu.RLock()
+	enabled := config.Enabled
+	mu.RUnlock()
+
+	if !enabled {
+		return
+	}
+
+	DispatchDeliveriesTotal.WithLabelValues(kind, result).Inc()
+}
+
+// RecordDeliveryDuration records how long an outbound delivery took
+func RecordDeliveryDuration(kind string, duration time.Duration) {
+	mu.RLock()
+	enabled := config.Enabled
+	mu.RUnlock()
+
+	if !enabled {
+		return
+	}
+
+	DispatchDuration.WithLabelValues(kind).Observe(duration.Seconds())
+}
+
+// UpdateCircuitState sets the circuit breaker state of a delivery destination
+func UpdateCircuitState(destination, state string) {
+	mu.RLock()
+	enabled := config.Enabled
+	mu.RUnlock()
+
+	if !enabled {
+		return
+	}
+
+	value := 0.0
+	switch state {
+	case "half-open":
+		value = 1
+	case "open":
+		value = 2
+	}
+	DispatchCircuitState.WithLabelValues(destination).Set(value)
+}
+
 // IsEnabled returns whether metrics are enabled
 func IsEnabled() bool {
 	mu.RLock()
@@ -0,0 +1,102 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package metric
+
+import (
+	"sync"
+	"time"
+)
+
+// rateMinutes is how many minutes of request counts are kept
+const rateMinutes = 60
+
+// rateAverageMinutes is the window RequestStats averages the rate over
+const rateAverageMinutes = 5
+
+// RequestStats describes recent HTTP traffic; it is counted whether or not
+// Prometheus metrics are enabled
+type RequestStats struct {
+	// Requests per minute over the last 5 minutes
+	PerMinute float64 `json:"per_minute"`
+	// Requests in the last hour
+	LastHour int64 `json:"last_hour"`
+	// Requests since midnight UTC
+	Today int64 `json:"today"`
+}
+
+// requestCounter counts requests per minute for the last hour
+type requestCounter struct {
+	mu      sync.Mutex
+	started time.Time
+	minutes [rateMinutes]struct {
+		minute int64
+		count  int64
+	}
+	day   int64
+	today int64
+}
+
+var requests = &requestCounter{started: time.Now()}
+
+// add counts a request made at now
+func (c *requestCounter) add(now time.Time) {
+	minute := now.Unix() / 60
+	day := now.Unix() / 86400
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b := &c.minutes[minute%rateMinutes]
+	if b.minute != minute {
+		b.minute = minute
+		b.count = 0
+	}
+	b.count++
+	if c.day != day {
+		c.day = day
+		c.today = 0
+	}
+	c.today++
+}
+
+// stats returns the counts as of now
+func (c *requestCounter) stats(now time.Time) RequestStats {
+	minute := now.Unix() / 60
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var stats RequestStats
+	var recent int64
+	for _, b := range c.minutes {
+		age := minute - b.minute
+		if age < 0 || age >= rateMinutes {
+			continue
+		}
+		stats.LastHour += b.count
+		if age < rateAverageMinutes {
+			recent += b.count
+		}
+	}
+	if c.day == now.Unix()/86400 {
+		stats.Today = c.today
+	}
+
+	// The current minute is only partly over, and the server may have
+	// started within the window; under a minute is not averaged
+	window := time.Duration(rateAverageMinutes-1)*time.Minute + time.Duration(now.Unix()%60)*time.Second
+	if up := now.Sub(c.started); up < window {
+		window = up
+	}
+	if window < time.Minute {
+		window = time.Minute
+	}
+	stats.PerMinute = float64(recent) / window.Minutes()
+	return stats
+}
+
+// Requests returns the recent request counts, for the admin dashboard
+func Requests() RequestStats {
+	return requests.stats(time.Now())
+}
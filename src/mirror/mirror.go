@@ -0,0 +1,148 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+// Package mirror keeps a static read-only copy of the public pastes up to date
+// The mirror is an archive export refreshed incrementally and optionally pushed
+// to an S3 bucket, so a CDN can keep serving reads while the instance is down
+package mirror
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/casjay-forks/caspaste/src/archive"
+	"github.com/casjay-forks/caspaste/src/s3"
+	"github.com/casjay-forks/caspaste/src/storage"
+)
+
+// syncStateFile records what has been uploaded to the bucket
+const syncStateFile = ".s3-sync.json"
+
+// Config describes where the mirror is written
+type Config struct {
+	// Local mirror directory (also the staging area for S3)
+	Dir string
+	// Site title used in page headers
+	Title string
+	// Optional bucket to push the mirror to (nil = local only)
+	Bucket *s3.Client
+}
+
+// Result summarises a mirror run
+type Result struct {
+	Archive  *archive.Result
+	Uploaded int
+	Deleted  int
+}
+
+// Run regenerates the mirror and syncs it to the bucket if one is configured
+func Run(ctx context.Context, db storage.DB, cfg Config) (*Result, error) {
+	res, err := archive.Export(db, archive.Options{
+		Dir:         cfg.Dir,
+		Title:       cfg.Title,
+		Incremental: true,
+		// A mirror reflects the live instance, so expired pastes disappear
+		Prune: true,
+	})
+	result := &Result{Archive: res}
+	if err != nil || cfg.Bucket == nil {
+		return result, err
+	}
+
+	result.Uploaded, result.Deleted, err = syncBucket(ctx, cfg.Dir, cfg.Bucket)
+	return result, err
+}
+
+// syncBucket uploads files whose content changed since the last successful upload
+// and deletes objects that no longer exist locally. State is saved even after a
+// failure so the next run resumes where this one stopped.
+func syncBucket(ctx context.Context, dir string, bucket *s3.Client) (int, int, error) {
+	state := make(map[string]string)
+	if data, err := os.ReadFile(filepath.Join(dir, syncStateFile)); err == nil {
+		json.Unmarshal(data, &state)
+	}
+
+	local := make(map[string]string)
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == syncStateFile || strings.HasSuffix(rel, ".tmp") {
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		local[rel] = hex.EncodeToString(sum[:])
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var uploaded, deleted int
+	save := func() {
+		if data, err := json.Marshal(state); err == nil {
+			os.WriteFile(filepath.Join(dir, syncStateFile), data, 0644)
+		}
+	}
+	defer save()
+
+	for rel, hash := range local {
+		if state[rel] == hash {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return uploaded, deleted, err
+		}
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(rel)))
+		if err != nil {
+			return uploaded, deleted, err
+		}
+		if err := bucket.Put(ctx, rel, data, contentType(rel, data)); err != nil {
+			return uploaded, deleted, err
+		}
+		state[rel] = hash
+		uploaded++
+	}
+
+	for rel := range state {
+		if _, ok := local[rel]; ok {
+			continue
+		}
+		if err := bucket.Delete(ctx, rel); err != nil {
+			return uploaded, deleted, err
+		}
+		delete(state, rel)
+		deleted++
+	}
+
+	return uploaded, deleted, nil
+}
+
+// contentType picks a type by extension, sniffing raw paste files
+func contentType(rel string, data []byte) string {
+	if ct := mime.TypeByExtension(path.Ext(rel)); ct != "" {
+		return ct
+	}
+	return http.DetectContentType(data)
+}
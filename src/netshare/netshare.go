@@ -13,6 +13,8 @@ import (
 const (
 	// Max length for paste author name, email and URL
 	MaxLengthAuthorAll = 100
+	// Max views of a burn-after-reading paste
+	MaxViews = 9999
 )
 
 var (
@@ -8,34 +8,75 @@ package netshare
 
 import (
 	"encoding/base64"
+	"errors"
 	"io"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 	"unicode/utf8"
 
+	"github.com/casjay-forks/caspaste/src/asciicast"
 	"github.com/casjay-forks/caspaste/src/lineend"
+	"github.com/casjay-forks/caspaste/src/redact"
 	"github.com/casjay-forks/caspaste/src/storage"
 )
 
-func PasteAddFromForm(req *http.Request, db storage.DB, rateSys *RateLimitSystem, titleMaxLen int, bodyMaxLen int, maxLifeTime int64, lexerNames []string) (string, int64, int64, error) {
+// PasteAddFromForm creates a paste from a form post
+// When redaction applies, the returned report lists what was masked (nil otherwise)
+func PasteAddFromForm(req *http.Request, db storage.DB, rateSys *RateLimitSystem, titleMaxLen int, bodyMaxLen int, maxLifeTime int64, lexerNames []string, redaction *redact.Policy) (string, int64, int64, *redact.Report, error) {
 	// Check HTTP method
 	if req.Method != "POST" {
-		return "", 0, 0, ErrMethodNotAllowed
+		return "", 0, 0, nil, ErrMethodNotAllowed
 	}
 
 	// Check rate limit
 	err := rateSys.CheckAndUse(GetClientAddr(req))
 	if err != nil {
-		return "", 0, 0, err
+		return "", 0, 0, nil, err
 	}
 
+	// Check the form
+	form, err := PasteCheckForm(req, db, titleMaxLen, bodyMaxLen, maxLifeTime, lexerNames, redaction)
+	if err != nil {
+		return "", 0, 0, nil, err
+	}
+
+	// Create paste
+	// A paste held for review is stored, so it keeps its signature
+	pasteID, createTime, deleteTime, err := db.PasteAdd(form.Paste)
+	held := errors.Is(err, storage.ErrHeldForReview)
+	if err != nil && !held {
+		return pasteID, createTime, deleteTime, nil, err
+	}
+	if form.Signature != "" {
+		if err := db.PasteSignatureSet(pasteID, form.Signature, form.PublicKey); err != nil {
+			return pasteID, createTime, deleteTime, nil, err
+		}
+	}
+
+	return pasteID, createTime, deleteTime, form.Redaction, err
+}
+
+// PasteForm is a paste read from a creation form and checked, ready to be stored
+type PasteForm struct {
+	Paste storage.Paste
+	// What redaction masked; nil when it did not run
+	Redaction *redact.Report
+	// Checked signature of the body, if one was sent
+	Signature string
+	PublicKey string
+}
+
+// PasteCheckForm reads a paste from a creation form and runs every check
+// PasteAddFromForm does, except the method and rate limit, without storing it
+func PasteCheckForm(req *http.Request, db storage.DB, titleMaxLen int, bodyMaxLen int, maxLifeTime int64, lexerNames []string, redaction *redact.Policy) (PasteForm, error) {
 	// Parse form data (both URL-encoded and multipart)
 	// ParseForm handles application/x-www-form-urlencoded
-	err = req.ParseForm()
+	err := req.ParseForm()
 	if err != nil {
-		return "", 0, 0, err
+		return PasteForm{}, err
 	}
 	// ParseMultipartForm handles multipart/form-data (includes file uploads)
 	// 50MB max - ignores error as it's optional for non-multipart
@@ -54,6 +95,7 @@ func PasteAddFromForm(req *http.Request, db storage.DB, rateSys *RateLimitSystem
 		IsPrivate:   req.PostFormValue("private") == "true",
 		IsURL:       req.PostFormValue("url") == "true",
 		OriginalURL: req.PostFormValue("originalURL"),
+		Encrypted:   req.PostFormValue("encrypted") == "true",
 	}
 
 	// Handle file upload
@@ -64,24 +106,30 @@ func PasteAddFromForm(req *http.Request, db storage.DB, rateSys *RateLimitSystem
 		// Read file contents
 		fileData, err := io.ReadAll(file)
 		if err != nil {
-			return "", 0, 0, err
+			return PasteForm{}, err
 		}
 
-		// Set file fields
-		paste.IsFile = true
-		paste.FileName = handler.Filename
-		paste.MimeType = handler.Header.Get("Content-Type")
-		if paste.MimeType == "" {
-			paste.MimeType = "application/octet-stream"
-		}
+		if asciicast.IsCastFile(handler.Filename) && utf8.Valid(fileData) {
+			// Terminal recordings are stored as text so they can be played back
+			paste.Body = string(fileData)
+			paste.Syntax = asciicast.Syntax
+		} else {
+			// Set file fields
+			paste.IsFile = true
+			paste.FileName = handler.Filename
+			paste.MimeType = handler.Header.Get("Content-Type")
+			if paste.MimeType == "" {
+				paste.MimeType = "application/octet-stream"
+			}
 
-		// Store file data as base64 in Body field to handle binary data safely
-		// This prevents UTF-8 encoding errors in databases like PostgreSQL
-		paste.Body = base64.StdEncoding.EncodeToString(fileData)
+			// Store file data as base64 in Body field to handle binary data safely
+			// This prevents UTF-8 encoding errors in databases like PostgreSQL
+			paste.Body = base64.StdEncoding.EncodeToString(fileData)
 
-		// Default syntax for files (use plaintext as it's always valid)
-		if paste.Syntax == "" {
-			paste.Syntax = "plaintext"
+			// Default syntax for files (use plaintext as it's always valid)
+			if paste.Syntax == "" {
+				paste.Syntax = "plaintext"
+			}
 		}
 	}
 
@@ -92,25 +140,30 @@ func PasteAddFromForm(req *http.Request, db storage.DB, rateSys *RateLimitSystem
 
 	// Check title
 	if utf8.RuneCountInString(paste.Title) > titleMaxLen && titleMaxLen >= 0 {
-		return "", 0, 0, ErrPayloadTooLarge
+		return PasteForm{}, ErrPayloadTooLarge
 	}
 
 	// Check paste body (allow empty for URL shortener)
 	if paste.Body == "" && !paste.IsURL {
-		return "", 0, 0, ErrBadRequest
+		return PasteForm{}, ErrBadRequest
+	}
+
+	// Encrypted pastes are text sealed by the client; files and short URLs are not
+	if paste.Encrypted && (paste.IsFile || paste.IsURL || !IsCiphertext(paste.Body)) {
+		return PasteForm{}, ErrBadRequest
 	}
 	
 	// For URL shortener, validate originalURL is provided
 	if paste.IsURL && paste.OriginalURL == "" {
-		return "", 0, 0, ErrBadRequest
+		return PasteForm{}, ErrBadRequest
 	}
 
 	if utf8.RuneCountInString(paste.Body) > bodyMaxLen && bodyMaxLen > 0 {
-		return "", 0, 0, ErrPayloadTooLarge
+		return PasteForm{}, ErrPayloadTooLarge
 	}
 
 	// Change paste body lines end (skip for file uploads to preserve binary data)
-	if !paste.IsFile {
+	if !paste.IsFile && !paste.Encrypted {
 		switch req.PostForm.Get("lineEnd") {
 		case "", "LF", "lf":
 			paste.Body = lineend.UnknownToUnix(paste.Body)
@@ -122,81 +175,59 @@ func PasteAddFromForm(req *http.Request, db storage.DB, rateSys *RateLimitSystem
 			paste.Body = lineend.UnknownToOldMac(paste.Body)
 
 		default:
-			return "", 0, 0, ErrBadRequest
+			return PasteForm{}, ErrBadRequest
 		}
 	}
 
-	// Check syntax
-	if paste.Syntax == "" {
-		paste.Syntax = "plaintext"
-	}
-
-	// Validate syntax (allow "autodetect" as special value)
-	// Syntax matching is case-insensitive for user convenience
-	syntaxOk := false
-	if strings.EqualFold(paste.Syntax, "autodetect") {
-		syntaxOk = true
-		paste.Syntax = "autodetect"
-	} else {
-		for _, name := range lexerNames {
-			if strings.EqualFold(name, paste.Syntax) {
-				syntaxOk = true
-				// Normalize to the official lexer name for proper highlighting
-				paste.Syntax = name
-				break
-			}
+	// Mask sensitive values before storage (uploaded files are left untouched)
+	var report *redact.Report
+	if !paste.IsFile && redaction.ShouldRedact(req.PostFormValue("redact")) {
+		report = &redact.Report{}
+		paste.Title = redaction.Redact(paste.Title, report)
+		if !paste.Encrypted {
+			paste.Body = redaction.Redact(paste.Body, report)
 		}
 	}
 
-	if !syntaxOk {
-		return "", 0, 0, ErrBadRequest
+	// Check syntax; the server cannot detect it from an encrypted body
+	if paste.Syntax == "" || (paste.Encrypted && strings.EqualFold(paste.Syntax, "autodetect")) {
+		paste.Syntax = "plaintext"
 	}
 
-	// Get delete time
-	expirStr := req.PostForm.Get("expiration")
-	if expirStr != "" {
-		// Convert string to int
-		expir, err := strconv.ParseInt(expirStr, 10, 64)
+	// Recordings must be valid asciicast v2 for the player
+	if strings.EqualFold(paste.Syntax, asciicast.Syntax) {
+		header, err := asciicast.Parse(paste.Body)
 		if err != nil {
-			return "", 0, 0, ErrBadRequest
+			return PasteForm{}, ErrBadRequest
 		}
-
-		// Check limits
-		if maxLifeTime > 0 {
-			if expir > maxLifeTime || expir <= 0 {
-				return "", 0, 0, ErrBadRequest
-			}
+		if paste.Title == "" && (titleMaxLen < 0 || utf8.RuneCountInString(header.Title) <= titleMaxLen) {
+			paste.Title = strings.Join(strings.Fields(header.Title), " ")
 		}
+	}
 
-		// Save if ok
-		if expir > 0 {
-			paste.DeleteTime = time.Now().Unix() + expir
-		}
+	// Validate syntax
+	syntax, syntaxOk := matchSyntax(paste.Syntax, lexerNames)
+	if !syntaxOk {
+		return PasteForm{}, ErrBadRequest
 	}
+	paste.Syntax = syntax
 
-	// Get "one use" (burn after reading) parameter
-	// Accepts "true" for backward compatibility or numeric values for view count
-	oneUseVal := req.PostForm.Get("oneUse")
-	if oneUseVal == "true" || oneUseVal == "1" {
-		paste.OneUse = true
-	} else if oneUseVal != "" && oneUseVal != "false" {
-		// Check if it's a numeric value > 0 (custom view count)
-		if viewCount, err := strconv.Atoi(oneUseVal); err == nil && viewCount > 0 {
-			paste.OneUse = true
-		}
+	// Get delete time, views and tags
+	if err := pasteOptions(req.PostForm, &paste, maxLifeTime); err != nil {
+		return PasteForm{}, err
 	}
 
 	// Check author name, email and URL length.
 	if utf8.RuneCountInString(paste.Author) > MaxLengthAuthorAll {
-		return "", 0, 0, ErrPayloadTooLarge
+		return PasteForm{}, ErrPayloadTooLarge
 	}
 
 	if utf8.RuneCountInString(paste.AuthorEmail) > MaxLengthAuthorAll {
-		return "", 0, 0, ErrPayloadTooLarge
+		return PasteForm{}, ErrPayloadTooLarge
 	}
 
 	if utf8.RuneCountInString(paste.AuthorURL) > MaxLengthAuthorAll {
-		return "", 0, 0, ErrPayloadTooLarge
+		return PasteForm{}, ErrPayloadTooLarge
 	}
 
 	// Validate Author URL scheme to prevent XSS via javascript: or data: URLs
@@ -206,7 +237,7 @@ func PasteAddFromForm(req *http.Request, db storage.DB, rateSys *RateLimitSystem
 
 		// Only allow http:// and https:// schemes
 		if !strings.HasPrefix(urlLower, "http://") && !strings.HasPrefix(urlLower, "https://") {
-			return "", 0, 0, ErrBadRequest
+			return PasteForm{}, ErrBadRequest
 		}
 
 		// Prevent data:, javascript:, vbscript:, file:, etc.
@@ -214,7 +245,7 @@ func PasteAddFromForm(req *http.Request, db storage.DB, rateSys *RateLimitSystem
 		   strings.Contains(urlLower, "data:") ||
 		   strings.Contains(urlLower, "vbscript:") ||
 		   strings.Contains(urlLower, "file:") {
-			return "", 0, 0, ErrBadRequest
+			return PasteForm{}, ErrBadRequest
 		}
 	}
 	
@@ -224,7 +255,7 @@ func PasteAddFromForm(req *http.Request, db storage.DB, rateSys *RateLimitSystem
 		
 		// Only allow http:// and https:// schemes
 		if !strings.HasPrefix(urlLower, "http://") && !strings.HasPrefix(urlLower, "https://") {
-			return "", 0, 0, ErrBadRequest
+			return PasteForm{}, ErrBadRequest
 		}
 		
 		// Prevent data:, javascript:, vbscript:, file:, etc.
@@ -232,15 +263,252 @@ func PasteAddFromForm(req *http.Request, db storage.DB, rateSys *RateLimitSystem
 		   strings.Contains(urlLower, "data:") ||
 		   strings.Contains(urlLower, "vbscript:") ||
 		   strings.Contains(urlLower, "file:") {
-			return "", 0, 0, ErrBadRequest
+			return PasteForm{}, ErrBadRequest
 		}
 	}
 
-	// Create paste
-	pasteID, createTime, deleteTime, err := db.PasteAdd(paste)
+	// Check the signature against the body as it will be stored
+	signature, publicKey, err := pasteSignature(req.PostForm, db, paste)
+	if err != nil {
+		return PasteForm{}, err
+	}
+
+	return PasteForm{Paste: paste, Redaction: report, Signature: signature, PublicKey: publicKey}, nil
+}
+
+// pasteOptions sets the delete time, view limit and tags of a new paste
+// from form values
+func pasteOptions(form url.Values, paste *storage.Paste, maxLifeTime int64) error {
+	// Get delete time
+	expirStr := form.Get("expiration")
+	if expirStr != "" {
+		// Convert string to int
+		expir, err := strconv.ParseInt(expirStr, 10, 64)
+		if err != nil {
+			return ErrBadRequest
+		}
+
+		// Check limits
+		if maxLifeTime > 0 {
+			if expir > maxLifeTime || expir <= 0 {
+				return ErrBadRequest
+			}
+		}
+
+		// Save if ok
+		if expir > 0 {
+			paste.DeleteTime = time.Now().Unix() + expir
+		}
+	}
+
+	// Get "one use" (burn after reading) parameter
+	// Accepts "true" for backward compatibility or numeric values for view
+	// count; maxViews sets the count directly
+	oneUseVal := form.Get("oneUse")
+	if oneUseVal == "custom" {
+		oneUseVal = form.Get("oneUseCustom")
+	}
+	if maxViews := form.Get("maxViews"); maxViews != "" {
+		oneUseVal = maxViews
+	}
+	if oneUseVal == "true" {
+		paste.MaxViews = 1
+	} else if oneUseVal != "" && oneUseVal != "false" {
+		viewCount, err := strconv.Atoi(oneUseVal)
+		if err != nil || viewCount < 0 || viewCount > MaxViews {
+			return ErrBadRequest
+		}
+		paste.MaxViews = viewCount
+	}
+	paste.OneUse = paste.MaxViews > 0
+
+	// Tags are comma-separated: tags=deploy,nginx
+	if tags := form.Get("tags"); tags != "" {
+		var err error
+		paste.Tags, err = storage.NormalizeTags(strings.Split(tags, ","))
+		if err != nil {
+			return ErrBadRequest
+		}
+	}
+	return nil
+}
+
+// PasteUpdateFromForm changes the title, body, syntax and expiration of a
+// paste from a form; fields left out of the form are kept
+// Anyone may edit a paste created as editable, but not its expiration; the
+// server's owners (owner = true) may edit any paste
+// Returns the updated paste and the names of the fields that changed
+func PasteUpdateFromForm(req *http.Request, id string, owner bool, db storage.DB, rateSys *RateLimitSystem, titleMaxLen int, bodyMaxLen int, maxLifeTime int64, lexerNames []string, redaction *redact.Policy) (storage.Paste, []string, *redact.Report, error) {
+	// Editing is limited like creating
+	if err := rateSys.CheckAndUse(GetClientAddr(req)); err != nil {
+		return storage.Paste{}, nil, nil, err
+	}
+
+	if err := req.ParseForm(); err != nil {
+		return storage.Paste{}, nil, nil, ErrBadRequest
+	}
+
+	paste, err := db.PasteGet(id)
 	if err != nil {
-		return pasteID, createTime, deleteTime, err
+		return storage.Paste{}, nil, nil, err
+	}
+	old := paste
+
+	if !owner {
+		// Only pastes created as editable can change
+		if !paste.IsEditable {
+			return storage.Paste{}, nil, nil, ErrUnauthorized
+		}
+		// One-use pastes are gone once read, so nobody else can have seen them to edit
+		if paste.OneUse {
+			return storage.Paste{}, nil, nil, ErrBadRequest
+		}
+	}
+
+	if _, ok := req.PostForm["title"]; ok {
+		title := strings.NewReplacer("\n", "", "\r", "", "\t", " ").Replace(req.PostForm.Get("title"))
+		if utf8.RuneCountInString(title) > titleMaxLen && titleMaxLen >= 0 {
+			return storage.Paste{}, nil, nil, ErrPayloadTooLarge
+		}
+		paste.Title = title
 	}
 
-	return pasteID, createTime, deleteTime, nil
+	// Files and short URLs have no text body
+	_, setBody := req.PostForm["body"]
+	setSyntax := req.PostForm.Get("syntax") != ""
+	if (setBody || setSyntax) && (paste.IsFile || paste.IsURL) {
+		return storage.Paste{}, nil, nil, ErrBadRequest
+	}
+
+	if setBody {
+		body := req.PostForm.Get("body")
+		if body == "" || (paste.Encrypted && !IsCiphertext(body)) {
+			return storage.Paste{}, nil, nil, ErrBadRequest
+		}
+		if utf8.RuneCountInString(body) > bodyMaxLen && bodyMaxLen > 0 {
+			return storage.Paste{}, nil, nil, ErrPayloadTooLarge
+		}
+
+		switch req.PostForm.Get("lineEnd") {
+		case "", "LF", "lf":
+			paste.Body = lineend.UnknownToUnix(body)
+		case "CRLF", "crlf":
+			paste.Body = lineend.UnknownToDos(body)
+		case "CR", "cr":
+			paste.Body = lineend.UnknownToOldMac(body)
+		default:
+			return storage.Paste{}, nil, nil, ErrBadRequest
+		}
+		// Line ends are inside the ciphertext
+		if paste.Encrypted {
+			paste.Body = body
+		}
+	}
+
+	if setSyntax {
+		syntax, ok := matchSyntax(req.PostForm.Get("syntax"), lexerNames)
+		if !ok {
+			return storage.Paste{}, nil, nil, ErrBadRequest
+		}
+		paste.Syntax = syntax
+	}
+	if strings.EqualFold(paste.Syntax, asciicast.Syntax) && paste.Body != old.Body {
+		if _, err := asciicast.Parse(paste.Body); err != nil {
+			return storage.Paste{}, nil, nil, ErrBadRequest
+		}
+	}
+
+	// New lifetime in seconds from now, as when creating; 0 = never expire
+	if expirStr := req.PostForm.Get("expiration"); expirStr != "" {
+		if !owner {
+			return storage.Paste{}, nil, nil, ErrUnauthorized
+		}
+		expir, err := strconv.ParseInt(expirStr, 10, 64)
+		if err != nil || expir < 0 {
+			return storage.Paste{}, nil, nil, ErrBadRequest
+		}
+		if maxLifeTime > 0 && (expir > maxLifeTime || expir == 0) {
+			return storage.Paste{}, nil, nil, ErrBadRequest
+		}
+		paste.DeleteTime = 0
+		if expir > 0 {
+			paste.DeleteTime = time.Now().Unix() + expir
+		}
+	}
+
+	// Mask sensitive values before storage, as when creating
+	var report *redact.Report
+	if !paste.IsFile && redaction.ShouldRedact(req.PostFormValue("redact")) {
+		report = &redact.Report{}
+		paste.Title = redaction.Redact(paste.Title, report)
+		if !paste.Encrypted {
+			paste.Body = redaction.Redact(paste.Body, report)
+		}
+	}
+
+	var changed []string
+	if paste.Title != old.Title {
+		changed = append(changed, "title")
+	}
+	if paste.Body != old.Body {
+		changed = append(changed, "body")
+	}
+	if paste.Syntax != old.Syntax {
+		changed = append(changed, "syntax")
+	}
+	if paste.DeleteTime != old.DeleteTime {
+		changed = append(changed, "expiration")
+	}
+
+	// A changed body no longer matches the old signature, which shows as bad
+	// until a new one is sent
+	signature, publicKey, err := pasteSignature(req.PostForm, db, paste)
+	if err != nil {
+		return paste, nil, nil, err
+	}
+	if signature != "" {
+		changed = append(changed, "signature")
+	}
+	if len(changed) == 0 {
+		return paste, nil, report, nil
+	}
+
+	if err := db.PasteUpdate(paste); err != nil {
+		return paste, nil, nil, err
+	}
+	if signature != "" {
+		if err := db.PasteSignatureSet(paste.ID, signature, publicKey); err != nil {
+			return paste, nil, nil, err
+		}
+	}
+	return paste, changed, report, nil
+}
+
+// matchSyntax checks a syntax name against the lexers, ignoring case, and
+// returns the official lexer name for proper highlighting
+// "autodetect" is accepted as a special value
+func matchSyntax(syntax string, lexerNames []string) (string, bool) {
+	if strings.EqualFold(syntax, "autodetect") {
+		return "autodetect", true
+	}
+	for _, name := range lexerNames {
+		if strings.EqualFold(name, syntax) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// Encrypted paste bodies are base64 of a 12-byte AES-GCM nonce followed by the
+// ciphertext and its 16-byte tag
+const (
+	ciphertextNonceSize = 12
+	ciphertextTagSize   = 16
+)
+
+// IsCiphertext reports whether a body has the form of an encrypted paste
+// The server never has the key, so it can only check the shape
+func IsCiphertext(body string) bool {
+	data, err := base64.StdEncoding.DecodeString(body)
+	return err == nil && len(data) >= ciphertextNonceSize+ciphertextTagSize
 }
@@ -7,15 +7,54 @@
 package netshare
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
 	"net"
+	"sort"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/casjay-forks/caspaste/src/redis"
 )
 
+// rateLimitStoreTimeout bounds each call to a shared rate limit store; the
+// local counters decide when it is slower
+const rateLimitStoreTimeout = 200 * time.Millisecond
+
+// RateLimitStore keeps rate limit counters shared between replicas, e.g. Redis
+type RateLimitStore interface {
+	// Incr counts a use of key in a window started by its first use, and
+	// returns the count and the time left in the window
+	Incr(ctx context.Context, key string, window time.Duration) (int64, time.Duration, error)
+}
+
 type RateLimitSystem struct {
 	per5Min  *RateLimit
 	per15Min *RateLimit
 	per1Hour *RateLimit
+
+	// Exemptions and bans shared by all route classes (nil = none)
+	rules *RateLimitRules
+	// Stricter limits for addresses with a bad reputation (nil = none)
+	reputation Reputation
+	// Told about each request over a limit (nil = none)
+	violations Violations
+}
+
+// Reputation gives stricter rate limits to addresses with a bad reputation
+type Reputation interface {
+	// LimitDivisor returns what the limits of ip are divided by; 0 or 1
+	// leaves them as set
+	LimitDivisor(ip net.IP) uint
+}
+
+// Violations is told about each request refused for being over a limit,
+// e.g. to ban addresses that keep hitting them; bans are not counted
+type Violations interface {
+	RateLimited(ip net.IP)
 }
 
 func NewRateLimitSystem(per5Min, per15Min, per1Hour uint) *RateLimitSystem {
@@ -26,22 +65,103 @@ func NewRateLimitSystem(per5Min, per15Min, per1Hour uint) *RateLimitSystem {
 	}
 }
 
+// SetLimits changes the limits of a running system; counts already used are kept
+func (rateSys *RateLimitSystem) SetLimits(per5Min, per15Min, per1Hour uint) {
+	rateSys.per5Min.SetLimit(per5Min)
+	rateSys.per15Min.SetLimit(per15Min)
+	rateSys.per1Hour.SetLimit(per1Hour)
+}
+
+// Limits returns the max request count of each period (0 = unlimited)
+func (rateSys *RateLimitSystem) Limits() (per5Min, per15Min, per1Hour uint) {
+	return rateSys.per5Min.limit(), rateSys.per15Min.limit(), rateSys.per1Hour.limit()
+}
+
+// SetStore shares the counters through store under the given name (e.g.
+// "get"); the local counters still decide while store is unreachable
+func (rateSys *RateLimitSystem) SetStore(store RateLimitStore, name string) {
+	for _, rateLimit := range []*RateLimit{rateSys.per5Min, rateSys.per15Min, rateSys.per1Hour} {
+		rateLimit.setStore(store, fmt.Sprintf("caspaste:ratelimit:%s:%d:", name, rateLimit.limitPeriod))
+	}
+}
+
+// SetRules sets the exemptions and bans checked before the limits
+func (rateSys *RateLimitSystem) SetRules(rules *RateLimitRules) {
+	rateSys.rules = rules
+}
+
+// SetReputation divides the limits of addresses rep flags
+func (rateSys *RateLimitSystem) SetReputation(rep Reputation) {
+	rateSys.reputation = rep
+}
+
+// SetViolations reports the requests over a limit to v
+func (rateSys *RateLimitSystem) SetViolations(v Violations) {
+	rateSys.violations = v
+}
+
+// RateLimitUsage is the request count of one IP in each period
+type RateLimitUsage struct {
+	IP       string `json:"ip"`
+	Per5Min  uint   `json:"per_5min"`
+	Per15Min uint   `json:"per_15min"`
+	Per1Hour uint   `json:"per_1hour"`
+}
+
+// Usage returns the current counters, busiest IP first
+func (rateSys *RateLimitSystem) Usage() []RateLimitUsage {
+	byIP := make(map[string]*RateLimitUsage)
+	add := func(rateLimit *RateLimit, set func(u *RateLimitUsage, count uint)) {
+		for ip, count := range rateLimit.counts() {
+			if byIP[ip] == nil {
+				byIP[ip] = &RateLimitUsage{IP: ip}
+			}
+			set(byIP[ip], count)
+		}
+	}
+	add(rateSys.per5Min, func(u *RateLimitUsage, count uint) { u.Per5Min = count })
+	add(rateSys.per15Min, func(u *RateLimitUsage, count uint) { u.Per15Min = count })
+	add(rateSys.per1Hour, func(u *RateLimitUsage, count uint) { u.Per1Hour = count })
+
+	usage := make([]RateLimitUsage, 0, len(byIP))
+	for _, u := range byIP {
+		usage = append(usage, *u)
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].Per1Hour != usage[j].Per1Hour {
+			return usage[i].Per1Hour > usage[j].Per1Hour
+		}
+		return usage[i].IP < usage[j].IP
+	})
+	return usage
+}
+
 func (rateSys *RateLimitSystem) CheckAndUse(ip net.IP) error {
 	var tmp int64
 
-	tmp = rateSys.per5Min.CheckAndUse(ip)
-	if tmp != 0 {
-		return ErrTooManyRequestsNew(tmp)
+	if rateSys.rules != nil {
+		exempt, banned := rateSys.rules.Check(ip, time.Now())
+		if exempt {
+			return nil
+		}
+		if banned != 0 {
+			return ErrTooManyRequestsNew(banned)
+		}
 	}
 
-	tmp = rateSys.per15Min.CheckAndUse(ip)
-	if tmp != 0 {
-		return ErrTooManyRequestsNew(tmp)
+	var divisor uint = 1
+	if rateSys.reputation != nil {
+		divisor = max(rateSys.reputation.LimitDivisor(ip), 1)
 	}
 
-	tmp = rateSys.per1Hour.CheckAndUse(ip)
-	if tmp != 0 {
-		return ErrTooManyRequestsNew(tmp)
+	for _, rateLimit := range []*RateLimit{rateSys.per5Min, rateSys.per15Min, rateSys.per1Hour} {
+		tmp = rateLimit.checkAndUse(ip, divisor)
+		if tmp != 0 {
+			if rateSys.violations != nil {
+				rateSys.violations.RateLimited(ip)
+			}
+			return ErrTooManyRequestsNew(tmp)
+		}
 	}
 
 	return nil
@@ -57,6 +177,10 @@ type RateLimit struct {
 
 	// Rate limit bucket
 	list map[string]rateLimitIP
+
+	// Shared counters (nil = local only) and the key prefix in it
+	store    RateLimitStore
+	storeKey string
 }
 
 type rateLimitIP struct {
@@ -95,16 +219,94 @@ func (rateLimit *RateLimit) runWorker() {
 	}
 }
 
+// SetLimit changes the max request count per period (0 = unlimited)
+func (rateLimit *RateLimit) SetLimit(limitCount uint) {
+	rateLimit.Lock()
+	rateLimit.limitCount = limitCount
+	rateLimit.Unlock()
+}
+
+func (rateLimit *RateLimit) limit() uint {
+	rateLimit.RLock()
+	defer rateLimit.RUnlock()
+	return rateLimit.limitCount
+}
+
+// counts returns the request count of each IP in the current period
+func (rateLimit *RateLimit) counts() map[string]uint {
+	rateLimit.RLock()
+	defer rateLimit.RUnlock()
+
+	timeNow := time.Now().Unix()
+	counts := make(map[string]uint, len(rateLimit.list))
+	for ipStr, data := range rateLimit.list {
+		if data.UseTime+int64(rateLimit.limitPeriod) > timeNow {
+			counts[ipStr] = data.UseCount
+		}
+	}
+	return counts
+}
+
+func (rateLimit *RateLimit) setStore(store RateLimitStore, key string) {
+	rateLimit.Lock()
+	rateLimit.store = store
+	rateLimit.storeKey = key
+	rateLimit.Unlock()
+}
+
+// CheckAndUse counts a request and returns 0, or the seconds to wait when ip
+// is over the limit; with a store, the shared count decides
 func (rateLimit *RateLimit) CheckAndUse(ip net.IP) int64 {
-	// If rate limit not need
-	if rateLimit.limitCount == 0 {
+	return rateLimit.checkAndUse(ip, 1)
+}
+
+// scaledLimit divides a limit, keeping at least one request; 0 stays
+// unlimited
+func scaledLimit(limitCount, divisor uint) uint {
+	if limitCount == 0 || divisor <= 1 {
+		return limitCount
+	}
+	return max(limitCount/divisor, 1)
+}
+
+// checkAndUse is CheckAndUse with the limit divided by divisor
+func (rateLimit *RateLimit) checkAndUse(ip net.IP, divisor uint) int64 {
+	wait := rateLimit.checkAndUseLocal(ip, divisor)
+
+	rateLimit.RLock()
+	store, key, limitCount := rateLimit.store, rateLimit.storeKey, scaledLimit(rateLimit.limitCount, divisor)
+	rateLimit.RUnlock()
+	if store == nil || limitCount == 0 {
+		return wait
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rateLimitStoreTimeout)
+	defer cancel()
+	count, left, err := store.Incr(ctx, key+ip.String(), time.Duration(rateLimit.limitPeriod)*time.Second)
+	if err != nil {
+		if !errors.Is(err, redis.ErrUnavailable) {
+			log.Printf("[WARN] netshare: rate limit store: %v", err)
+		}
+		return wait
+	}
+	if count <= int64(limitCount) {
 		return 0
 	}
+	return max(int64((left+time.Second-1)/time.Second), 1)
+}
 
+// checkAndUseLocal counts a request in this process only
+func (rateLimit *RateLimit) checkAndUseLocal(ip net.IP, divisor uint) int64 {
 	// Lock
 	rateLimit.Lock()
 	defer rateLimit.Unlock()
 
+	// If rate limit not need
+	limitCount := scaledLimit(rateLimit.limitCount, divisor)
+	if limitCount == 0 {
+		return 0
+	}
+
 	ipStr := ip.String()
 	timeNow := time.Now().Unix()
 
@@ -119,7 +321,7 @@ func (rateLimit *RateLimit) CheckAndUse(ip net.IP) int64 {
 
 		// Else
 	} else {
-		if rateLimit.list[ipStr].UseCount < rateLimit.limitCount {
+		if rateLimit.list[ipStr].UseCount < limitCount {
 			tmp := rateLimit.list[ipStr]
 			tmp.UseCount = tmp.UseCount + 1
 			rateLimit.list[ipStr] = tmp
@@ -129,3 +331,152 @@ func (rateLimit *RateLimit) CheckAndUse(ip net.IP) int64 {
 
 	return rateLimit.list[ipStr].UseTime + int64(rateLimit.limitPeriod) - timeNow
 }
+
+var (
+	// ErrInvalidRateLimitRule is returned for an exemption or ban that cannot be parsed
+	ErrInvalidRateLimitRule = errors.New("invalid rate limit rule")
+	// ErrRateLimitRuleNotFound is returned when removing a rule that does not exist
+	ErrRateLimitRuleNotFound = errors.New("rate limit rule not found")
+)
+
+// banRetryAfter is the Retry-After sent for a ban without an end time
+const banRetryAfter = 24 * 60 * 60
+
+// RateLimitRule exempts an IP address or network from rate limits, or bans it
+type RateLimitRule struct {
+	// IP address or CIDR network
+	IP string `yaml:"ip" json:"ip"`
+	// Until is an RFC 3339 time; empty = no end
+	Until string `yaml:"until,omitempty" json:"until,omitempty"`
+	// Reason is a note for admins
+	Reason string `yaml:"reason,omitempty" json:"reason,omitempty"`
+}
+
+// Network parses the IP address or network of the rule
+func (rule RateLimitRule) Network() (*net.IPNet, error) {
+	s := strings.TrimSpace(rule.IP)
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("%w: %q is not an IP address", ErrInvalidRateLimitRule, rule.IP)
+		}
+		bits := 128
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, network, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q is not a network", ErrInvalidRateLimitRule, rule.IP)
+	}
+	return network, nil
+}
+
+// Expiry parses the end time of the rule; zero = no end
+func (rule RateLimitRule) Expiry() (time.Time, error) {
+	if rule.Until == "" {
+		return time.Time{}, nil
+	}
+	until, err := time.Parse(time.RFC3339, rule.Until)
+	if err != nil {
+		return until, fmt.Errorf("%w: until %q is not an RFC 3339 time", ErrInvalidRateLimitRule, rule.Until)
+	}
+	return until, nil
+}
+
+// Expired reports whether the rule has ended
+func (rule RateLimitRule) Expired(now time.Time) bool {
+	until, err := rule.Expiry()
+	return err == nil && !until.IsZero() && !now.Before(until)
+}
+
+type compiledRule struct {
+	network *net.IPNet
+	until   time.Time
+}
+
+// RateLimitRules holds the exemptions and bans; it is safe for concurrent use
+type RateLimitRules struct {
+	mu     sync.RWMutex
+	exempt []compiledRule
+	ban    []compiledRule
+
+	// As set, for display and saving
+	exemptRules []RateLimitRule
+	banRules    []RateLimitRule
+}
+
+// NewRateLimitRules creates an empty rule set
+func NewRateLimitRules() *RateLimitRules {
+	return &RateLimitRules{}
+}
+
+// Set replaces the exemptions and bans; nothing changes if a rule is invalid
+func (rules *RateLimitRules) Set(exempt, ban []RateLimitRule) error {
+	compiledExempt, err := compileRules(exempt)
+	if err != nil {
+		return err
+	}
+	compiledBan, err := compileRules(ban)
+	if err != nil {
+		return err
+	}
+
+	rules.mu.Lock()
+	rules.exempt = compiledExempt
+	rules.ban = compiledBan
+	rules.exemptRules = append([]RateLimitRule{}, exempt...)
+	rules.banRules = append([]RateLimitRule{}, ban...)
+	rules.mu.Unlock()
+	return nil
+}
+
+// Rules returns the exemptions and bans as set
+func (rules *RateLimitRules) Rules() (exempt, ban []RateLimitRule) {
+	rules.mu.RLock()
+	defer rules.mu.RUnlock()
+	return append([]RateLimitRule{}, rules.exemptRules...), append([]RateLimitRule{}, rules.banRules...)
+}
+
+// Check reports whether ip is exempt, or the seconds left on its ban
+// An exemption wins over a ban
+func (rules *RateLimitRules) Check(ip net.IP, now time.Time) (exempt bool, banned int64) {
+	rules.mu.RLock()
+	defer rules.mu.RUnlock()
+
+	for _, rule := range rules.exempt {
+		if rule.matches(ip, now) {
+			return true, 0
+		}
+	}
+	for _, rule := range rules.ban {
+		if rule.matches(ip, now) {
+			if rule.until.IsZero() {
+				return false, banRetryAfter
+			}
+			return false, int64(rule.until.Sub(now).Seconds()) + 1
+		}
+	}
+	return false, 0
+}
+
+func (rule compiledRule) matches(ip net.IP, now time.Time) bool {
+	return rule.network.Contains(ip) && (rule.until.IsZero() || now.Before(rule.until))
+}
+
+func compileRules(list []RateLimitRule) ([]compiledRule, error) {
+	compiled := make([]compiledRule, 0, len(list))
+	for _, rule := range list {
+		network, err := rule.Network()
+		if err != nil {
+			return nil, err
+		}
+		until, err := rule.Expiry()
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, compiledRule{network: network, until: until})
+	}
+	return compiled, nil
+}
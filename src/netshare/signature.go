@@ -0,0 +1,55 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package netshare
+
+import (
+	"encoding/base64"
+	"net/url"
+
+	"github.com/casjay-forks/caspaste/src/storage"
+)
+
+// Limits of the signature and publicKey form fields
+const (
+	maxSignatureLen = 16 << 10
+	maxPublicKeyLen = 64 << 10
+)
+
+// PasteContent returns the content of a paste as /raw/ serves it (file
+// bodies decoded), which is what a signature of the paste covers
+func PasteContent(paste storage.Paste) []byte {
+	if paste.IsFile {
+		// File upload: try to decode base64, fall back to raw for legacy data
+		if data, err := base64.StdEncoding.DecodeString(paste.Body); err == nil {
+			return data
+		}
+	}
+	return []byte(paste.Body)
+}
+
+// pasteSignature reads the detached PGP signature sent with a paste in the
+// signature form field, and the key that made it in publicKey (empty when
+// the key is registered), and checks it against the paste as it will be
+// stored; signature is "" when none was sent
+func pasteSignature(form url.Values, db storage.DB, paste storage.Paste) (signature, publicKey string, err error) {
+	signature, publicKey = form.Get("signature"), form.Get("publicKey")
+	if signature == "" {
+		return "", "", nil
+	}
+	if len(signature) > maxSignatureLen || len(publicKey) > maxPublicKeyLen {
+		return "", "", ErrPayloadTooLarge
+	}
+	// The server cannot show what an encrypted paste says, so it cannot
+	// vouch for who wrote it
+	if paste.Encrypted || paste.IsURL {
+		return "", "", ErrBadRequest
+	}
+
+	if _, err := db.SignatureVerify(PasteContent(paste), signature, publicKey); err != nil {
+		return "", "", err
+	}
+	return signature, publicKey, nil
+}
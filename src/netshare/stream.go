@@ -0,0 +1,131 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package netshare
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/casjay-forks/caspaste/src/asciicast"
+	"github.com/casjay-forks/caspaste/src/storage"
+)
+
+// streamFieldMaxLen limits the form fields sent before a streamed body
+const streamFieldMaxLen = 64 << 10
+
+// PasteAddFromStream creates a paste from a streamed upload and writes the
+// body straight to the blob store as it arrives, so it is never held in memory
+// The body is the request body, or the "file" (or "body") part of a multipart
+// form; the other fields come from the query string and, for forms, from the
+// parts before the body. A body is a file when it has a file name (fileName
+// in the query, or the file name of the part)
+// Streamed text is stored as sent: line ends are kept and nothing is redacted
+func PasteAddFromStream(req *http.Request, db storage.DB, rateSys *RateLimitSystem, titleMaxLen int, maxSize int64, maxLifeTime int64, lexerNames []string) (string, int64, int64, error) {
+	// Check HTTP method
+	if req.Method != "POST" {
+		return "", 0, 0, ErrMethodNotAllowed
+	}
+
+	// Check rate limit
+	err := rateSys.CheckAndUse(GetClientAddr(req))
+	if err != nil {
+		return "", 0, 0, err
+	}
+
+	fields := req.URL.Query()
+	body := io.Reader(req.Body)
+	fileName := fields.Get("fileName")
+	mimeType := req.Header.Get("Content-Type")
+
+	mediaType, _, _ := mime.ParseMediaType(mimeType)
+	if mediaType == "multipart/form-data" {
+		mr, err := req.MultipartReader()
+		if err != nil {
+			return "", 0, 0, ErrBadRequest
+		}
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				// No body part
+				return "", 0, 0, ErrBadRequest
+			}
+			name := part.FormName()
+			if name == "file" || name == "body" {
+				body = part
+				fileName = part.FileName()
+				mimeType = part.Header.Get("Content-Type")
+				break
+			}
+			value, err := io.ReadAll(io.LimitReader(part, streamFieldMaxLen+1))
+			if err != nil {
+				return "", 0, 0, ErrBadRequest
+			}
+			if len(value) > streamFieldMaxLen {
+				return "", 0, 0, ErrPayloadTooLarge
+			}
+			fields.Set(name, string(value))
+		}
+	}
+
+	paste := storage.Paste{
+		Title:      fields.Get("title"),
+		Syntax:     fields.Get("syntax"),
+		Author:     fields.Get("author"),
+		IsEditable: fields.Get("editable") == "true",
+		IsPrivate:  fields.Get("private") == "true",
+	}
+	if fileName != "" {
+		paste.IsFile = true
+		paste.FileName = fileName
+		paste.MimeType = mimeType
+		if paste.MimeType == "" {
+			paste.MimeType = "application/octet-stream"
+		}
+	}
+
+	// Remove new line from title
+	paste.Title = strings.Replace(paste.Title, "\n", "", -1)
+	paste.Title = strings.Replace(paste.Title, "\r", "", -1)
+	paste.Title = strings.Replace(paste.Title, "\t", " ", -1)
+
+	// Check title and author
+	if utf8.RuneCountInString(paste.Title) > titleMaxLen && titleMaxLen >= 0 {
+		return "", 0, 0, ErrPayloadTooLarge
+	}
+	if utf8.RuneCountInString(paste.Author) > MaxLengthAuthorAll {
+		return "", 0, 0, ErrPayloadTooLarge
+	}
+
+	// Check syntax; the server cannot detect it without reading the body, and
+	// recordings cannot be checked for the player
+	if paste.Syntax == "" || strings.EqualFold(paste.Syntax, "autodetect") {
+		paste.Syntax = "plaintext"
+	}
+	syntax, syntaxOk := matchSyntax(paste.Syntax, lexerNames)
+	if !syntaxOk || strings.EqualFold(syntax, asciicast.Syntax) {
+		return "", 0, 0, ErrBadRequest
+	}
+	paste.Syntax = syntax
+
+	// Get delete time, views and tags
+	if err := pasteOptions(fields, &paste, maxLifeTime); err != nil {
+		return "", 0, 0, err
+	}
+
+	// Create paste
+	pasteID, createTime, deleteTime, err := db.PasteAddStream(paste, body, maxSize)
+	switch {
+	case errors.Is(err, storage.ErrBodyTooLarge):
+		return "", 0, 0, ErrPayloadTooLarge
+	case errors.Is(err, storage.ErrBodyEmpty):
+		return "", 0, 0, ErrBadRequest
+	}
+	return pasteID, createTime, deleteTime, err
+}
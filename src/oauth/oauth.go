@@ -0,0 +1,595 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+// Package oauth provides an OAuth2 authorization server for the CasPaste API
+package oauth
+
+import (
+	"database/sql"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/securetoken"
+)
+
+// Token prefix constants
+const (
+	PrefixClientID     = "ocl_"
+	PrefixClientSecret = "ocs_"
+	PrefixCode         = "oac_"
+	PrefixAccessToken  = "oat_"
+	PrefixRefreshToken = "ort_"
+)
+
+// Scope constants
+const (
+	ScopePastesRead  = "pastes:read"
+	ScopePastesWrite = "pastes:write"
+	ScopeProfileRead = "profile:read"
+)
+
+// Default lifetimes
+const (
+	DefaultCodeTTL         = 10 * time.Minute
+	DefaultAccessTokenTTL  = time.Hour
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// Common errors
+var (
+	ErrClientNotFound      = errors.New("oauth client not found")
+	ErrInvalidClient       = errors.New("invalid client credentials")
+	ErrInvalidRedirectURI  = errors.New("invalid redirect uri")
+	ErrInvalidScope        = errors.New("invalid scope")
+	ErrInvalidGrant        = errors.New("invalid or expired grant")
+	ErrInvalidCodeVerifier = errors.New("invalid code verifier")
+	ErrPKCERequired        = errors.New("pkce code challenge required")
+	ErrTokenNotFound       = errors.New("oauth token not found")
+)
+
+// AllScopes lists every scope a client may request
+var AllScopes = []string{ScopePastesRead, ScopePastesWrite, ScopeProfileRead}
+
+// Client represents a registered third-party application
+type Client struct {
+	ID           int64    `json:"id"`
+	ClientID     string   `json:"client_id"`
+	SecretHash   string   `json:"-"`
+	OwnerID      int64    `json:"owner_id"`
+	Name         string   `json:"name"`
+	Homepage     string   `json:"homepage,omitempty"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes"`
+	Public       bool     `json:"public"`
+	CreatedAt    int64    `json:"created_at"`
+}
+
+// RegisterClientInput contains fields for registering a client
+type RegisterClientInput struct {
+	OwnerID      int64
+	Name         string
+	Homepage     string
+	RedirectURIs []string
+	Scopes       []string
+	// Public clients (SPAs, native apps) have no secret and must use PKCE
+	Public bool
+}
+
+// AuthorizeInput contains the parameters of an approved authorization request
+type AuthorizeInput struct {
+	ClientID            string
+	UserID              int64
+	RedirectURI         string
+	Scopes              []string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// TokenPair is the result of a successful token grant
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int64
+	Scopes       []string
+}
+
+// Grant describes a validated access token
+type Grant struct {
+	ClientID  string
+	UserID    int64
+	Scopes    []string
+	ExpiresAt int64
+}
+
+// HasScope reports whether the grant includes the given scope
+func (g *Grant) HasScope(scope string) bool {
+	for _, s := range g.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Service provides OAuth2 client and token operations
+type Service struct {
+	db              *sql.DB
+	codeTTL         time.Duration
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+}
+
+// NewService creates a new OAuth2 service
+func NewService(db *sql.DB) *Service {
+	return &Service{
+		db:              db,
+		codeTTL:         DefaultCodeTTL,
+		accessTokenTTL:  DefaultAccessTokenTTL,
+		refreshTokenTTL: DefaultRefreshTokenTTL,
+	}
+}
+
+// SetTTLs overrides the default code and token lifetimes (zero keeps the default)
+func (s *Service) SetTTLs(code, access, refresh time.Duration) {
+	if code > 0 {
+		s.codeTTL = code
+	}
+	if access > 0 {
+		s.accessTokenTTL = access
+	}
+	if refresh > 0 {
+		s.refreshTokenTTL = refresh
+	}
+}
+
+// RegisterClient registers a new client and returns its secret (empty for public clients)
+func (s *Service) RegisterClient(input RegisterClientInput) (*Client, string, error) {
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		return nil, "", errors.New("client name is required")
+	}
+	if len(input.RedirectURIs) == 0 {
+		return nil, "", ErrInvalidRedirectURI
+	}
+	for _, uri := range input.RedirectURIs {
+		if err := ValidateRedirectURI(uri); err != nil {
+			return nil, "", err
+		}
+	}
+	scopes, err := NormalizeScopes(input.Scopes)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(scopes) == 0 {
+		scopes = AllScopes
+	}
+
+	rawID, err := securetoken.Hex(16)
+	if err != nil {
+		return nil, "", err
+	}
+	clientID := PrefixClientID + rawID
+
+	var secret, secretHash string
+	if !input.Public {
+		rawSecret, err := securetoken.Hex(32)
+		if err != nil {
+			return nil, "", err
+		}
+		secret = PrefixClientSecret + rawSecret
+		secretHash = securetoken.Hash(secret)
+	}
+
+	now := time.Now().Unix()
+	result, err := s.db.Exec(`
+		INSERT INTO oauth_clients (client_id, secret_hash, owner_id, name, homepage, redirect_uris, scopes, is_public, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, clientID, secretHash, input.OwnerID, input.Name, input.Homepage,
+		strings.Join(input.RedirectURIs, " "), strings.Join(scopes, " "), input.Public, now)
+	if err != nil {
+		return nil, "", err
+	}
+
+	id, _ := result.LastInsertId()
+
+	return &Client{
+		ID:           id,
+		ClientID:     clientID,
+		SecretHash:   secretHash,
+		OwnerID:      input.OwnerID,
+		Name:         input.Name,
+		Homepage:     input.Homepage,
+		RedirectURIs: input.RedirectURIs,
+		Scopes:       scopes,
+		Public:       input.Public,
+		CreatedAt:    now,
+	}, secret, nil
+}
+
+// GetClient retrieves a client by its public client ID
+func (s *Service) GetClient(clientID string) (*Client, error) {
+	row := s.db.QueryRow(`
+		SELECT id, client_id, secret_hash, owner_id, name, homepage, redirect_uris, scopes, is_public, created_at
+		FROM oauth_clients WHERE client_id = ?
+	`, clientID)
+	return scanClient(row)
+}
+
+// ListClients lists clients owned by a user
+func (s *Service) ListClients(ownerID int64) ([]Client, error) {
+	rows, err := s.db.Query(`
+		SELECT id, client_id, secret_hash, owner_id, name, homepage, redirect_uris, scopes, is_public, created_at
+		FROM oauth_clients WHERE owner_id = ? ORDER BY created_at DESC
+	`, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var clients []Client
+	for rows.Next() {
+		c, err := scanClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, *c)
+	}
+	return clients, rows.Err()
+}
+
+// DeleteClient deletes a client owned by a user and revokes all of its tokens
+func (s *Service) DeleteClient(ownerID int64, clientID string) error {
+	result, err := s.db.Exec("DELETE FROM oauth_clients WHERE client_id = ? AND owner_id = ?", clientID, ownerID)
+	if err != nil {
+		return err
+	}
+	affected, _ := result.RowsAffected()
+	if affected == 0 {
+		return ErrClientNotFound
+	}
+
+	s.db.Exec("DELETE FROM oauth_codes WHERE client_id = ?", clientID)
+	s.db.Exec("DELETE FROM oauth_tokens WHERE client_id = ?", clientID)
+	return nil
+}
+
+// AuthenticateClient verifies a client's credentials
+// Public clients authenticate with their client ID alone and rely on PKCE
+func (s *Service) AuthenticateClient(clientID, secret string) (*Client, error) {
+	client, err := s.GetClient(clientID)
+	if err != nil {
+		return nil, ErrInvalidClient
+	}
+	if client.Public {
+		return client, nil
+	}
+	if secret == "" || !securetoken.MatchesHash(secret, client.SecretHash) {
+		return nil, ErrInvalidClient
+	}
+	return client, nil
+}
+
+// HasRedirectURI reports whether uri exactly matches a registered redirect URI
+func (c *Client) HasRedirectURI(uri string) bool {
+	for _, u := range c.RedirectURIs {
+		if u == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsScopes reports whether every requested scope was granted at registration
+func (c *Client) AllowsScopes(scopes []string) bool {
+	for _, requested := range scopes {
+		found := false
+		for _, allowed := range c.Scopes {
+			if requested == allowed {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// CreateAuthorizationCode issues a single-use authorization code after user consent
+func (s *Service) CreateAuthorizationCode(input AuthorizeInput) (string, error) {
+	client, err := s.GetClient(input.ClientID)
+	if err != nil {
+		return "", err
+	}
+	if !client.HasRedirectURI(input.RedirectURI) {
+		return "", ErrInvalidRedirectURI
+	}
+	if !client.AllowsScopes(input.Scopes) {
+		return "", ErrInvalidScope
+	}
+
+	// PKCE is mandatory for public clients and optional for confidential ones
+	if input.CodeChallenge == "" && client.Public {
+		return "", ErrPKCERequired
+	}
+	if input.CodeChallenge != "" {
+		if input.CodeChallengeMethod == "" {
+			input.CodeChallengeMethod = PKCEMethodPlain
+		}
+		if input.CodeChallengeMethod != PKCEMethodS256 && input.CodeChallengeMethod != PKCEMethodPlain {
+			return "", ErrInvalidCodeVerifier
+		}
+	}
+
+	rawCode, err := securetoken.Hex(32)
+	if err != nil {
+		return "", err
+	}
+	code := PrefixCode + rawCode
+
+	now := time.Now()
+	_, err = s.db.Exec(`
+		INSERT INTO oauth_codes (code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, code_challenge_method, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, securetoken.Hash(code), client.ClientID, input.UserID, input.RedirectURI, strings.Join(input.Scopes, " "),
+		input.CodeChallenge, input.CodeChallengeMethod, now.Add(s.codeTTL).Unix(), now.Unix())
+	if err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// ExchangeCode redeems an authorization code for an access and refresh token
+// A code is redeemed once; presenting it again revokes the tokens it issued
+func (s *Service) ExchangeCode(client *Client, code, redirectURI, codeVerifier string) (*TokenPair, error) {
+	codeHash := securetoken.Hash(code)
+
+	var (
+		clientID, storedRedirect, scopes string
+		challenge, challengeMethod       string
+		userID, expiresAt                int64
+	)
+	err := s.db.QueryRow(`
+		SELECT client_id, user_id, redirect_uri, scopes, code_challenge, code_challenge_method, expires_at
+		FROM oauth_codes WHERE code_hash = ?
+	`, codeHash).Scan(&clientID, &userID, &storedRedirect, &scopes, &challenge, &challengeMethod, &expiresAt)
+	if err != nil {
+		return nil, ErrInvalidGrant
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Codes are single use regardless of outcome; the claim holds the row
+	// until commit, so a concurrent exchange waits and then sees it used
+	res, err := tx.Exec("UPDATE oauth_codes SET used_at = ? WHERE code_hash = ? AND used_at = 0",
+		time.Now().Unix(), codeHash)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n != 1 {
+		tx.Rollback()
+		s.db.Exec("DELETE FROM oauth_tokens WHERE code_hash = ?", codeHash)
+		return nil, ErrInvalidGrant
+	}
+
+	var grantErr error
+	switch {
+	case clientID != client.ClientID || storedRedirect != redirectURI:
+		grantErr = ErrInvalidGrant
+	case time.Now().Unix() > expiresAt:
+		grantErr = ErrInvalidGrant
+	case challenge != "" && !VerifyPKCE(codeVerifier, challenge, challengeMethod):
+		grantErr = ErrInvalidCodeVerifier
+	case challenge == "" && client.Public:
+		grantErr = ErrPKCERequired
+	}
+	if grantErr != nil {
+		// Keep the claim so a failed attempt still uses up the code
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		return nil, grantErr
+	}
+
+	pair, err := s.issueTokens(tx, client.ClientID, userID, strings.Fields(scopes), codeHash)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// Refresh rotates a refresh token, revoking the old pair and issuing a new one
+func (s *Service) Refresh(client *Client, refreshToken string) (*TokenPair, error) {
+	var (
+		id, userID, expiresAt      int64
+		clientID, scopes, codeHash string
+	)
+	err := s.db.QueryRow(`
+		SELECT id, client_id, user_id, scopes, refresh_expires_at, code_hash
+		FROM oauth_tokens WHERE refresh_hash = ?
+	`, securetoken.Hash(refreshToken)).Scan(&id, &clientID, &userID, &scopes, &expiresAt, &codeHash)
+	if err != nil {
+		return nil, ErrInvalidGrant
+	}
+	if clientID != client.ClientID || time.Now().Unix() > expiresAt {
+		return nil, ErrInvalidGrant
+	}
+
+	res, err := s.db.Exec("DELETE FROM oauth_tokens WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	// A concurrent refresh already rotated this token
+	if n, err := res.RowsAffected(); err != nil || n != 1 {
+		return nil, ErrInvalidGrant
+	}
+
+	// The new pair keeps the code it descends from, so a replay revokes it too
+	return s.issueTokens(s.db, client.ClientID, userID, strings.Fields(scopes), codeHash)
+}
+
+// Revoke revokes the token pair containing the given access or refresh token
+// Unknown tokens are not an error per RFC 7009
+func (s *Service) Revoke(client *Client, tokenValue string) error {
+	h := securetoken.Hash(tokenValue)
+	_, err := s.db.Exec(
+		"DELETE FROM oauth_tokens WHERE client_id = ? AND (access_hash = ? OR refresh_hash = ?)",
+		client.ClientID, h, h,
+	)
+	return err
+}
+
+// RevokeAllForUser revokes every token a user has granted to a client
+func (s *Service) RevokeAllForUser(userID int64, clientID string) error {
+	_, err := s.db.Exec("DELETE FROM oauth_tokens WHERE user_id = ? AND client_id = ?", userID, clientID)
+	return err
+}
+
+// ValidateAccessToken validates an access token and returns its grant
+func (s *Service) ValidateAccessToken(accessToken string) (*Grant, error) {
+	if !strings.HasPrefix(accessToken, PrefixAccessToken) {
+		return nil, ErrTokenNotFound
+	}
+
+	var grant Grant
+	var scopes string
+	err := s.db.QueryRow(`
+		SELECT client_id, user_id, scopes, access_expires_at
+		FROM oauth_tokens WHERE access_hash = ?
+	`, securetoken.Hash(accessToken)).Scan(&grant.ClientID, &grant.UserID, &scopes, &grant.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().Unix() > grant.ExpiresAt {
+		return nil, ErrTokenNotFound
+	}
+
+	grant.Scopes = strings.Fields(scopes)
+	return &grant, nil
+}
+
+// DeleteExpired removes expired codes and tokens
+func (s *Service) DeleteExpired() error {
+	now := time.Now().Unix()
+	if _, err := s.db.Exec("DELETE FROM oauth_codes WHERE expires_at < ?", now); err != nil {
+		return err
+	}
+	_, err := s.db.Exec("DELETE FROM oauth_tokens WHERE refresh_expires_at < ?", now)
+	return err
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func (s *Service) issueTokens(db execer, clientID string, userID int64, scopes []string, codeHash string) (*TokenPair, error) {
+	rawAccess, err := securetoken.Hex(32)
+	if err != nil {
+		return nil, err
+	}
+	rawRefresh, err := securetoken.Hex(32)
+	if err != nil {
+		return nil, err
+	}
+	access := PrefixAccessToken + rawAccess
+	refresh := PrefixRefreshToken + rawRefresh
+
+	now := time.Now()
+	_, err = db.Exec(`
+		INSERT INTO oauth_tokens (access_hash, refresh_hash, client_id, user_id, scopes, access_expires_at, refresh_expires_at, code_hash, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, securetoken.Hash(access), securetoken.Hash(refresh), clientID, userID, strings.Join(scopes, " "),
+		now.Add(s.accessTokenTTL).Unix(), now.Add(s.refreshTokenTTL).Unix(), codeHash, now.Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		ExpiresIn:    int64(s.accessTokenTTL.Seconds()),
+		Scopes:       scopes,
+	}, nil
+}
+
+// ValidateRedirectURI checks that a redirect URI is absolute, has no fragment,
+// and uses https unless it points at a loopback address
+func ValidateRedirectURI(uri string) error {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme == "" || u.Host == "" || u.Fragment != "" {
+		return ErrInvalidRedirectURI
+	}
+	host := u.Hostname()
+	if u.Scheme == "http" && (host == "localhost" || host == "127.0.0.1" || host == "::1") {
+		return nil
+	}
+	if u.Scheme != "https" {
+		return ErrInvalidRedirectURI
+	}
+	return nil
+}
+
+// NormalizeScopes de-duplicates scopes and rejects unknown ones
+func NormalizeScopes(scopes []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var result []string
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		if scope == "" || seen[scope] {
+			continue
+		}
+		known := false
+		for _, s := range AllScopes {
+			if s == scope {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, ErrInvalidScope
+		}
+		seen[scope] = true
+		result = append(result, scope)
+	}
+	return result, nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanClient(row scanner) (*Client, error) {
+	var c Client
+	var redirectURIs, scopes string
+	var homepage, secretHash sql.NullString
+	err := row.Scan(&c.ID, &c.ClientID, &secretHash, &c.OwnerID, &c.Name, &homepage,
+		&redirectURIs, &scopes, &c.Public, &c.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrClientNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.SecretHash = secretHash.String
+	c.Homepage = homepage.String
+	c.RedirectURIs = strings.Fields(redirectURIs)
+	c.Scopes = strings.Fields(scopes)
+	return &c, nil
+}
@@ -0,0 +1,66 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package oauth
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/casjay-forks/caspaste/src/storage/migrations"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestExchangeCodeReplay(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "oauth.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := migrations.Up(db, "sqlite"); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewService(db)
+	client, _, err := s.RegisterClient(RegisterClientInput{
+		OwnerID:      1,
+		Name:         "test",
+		RedirectURIs: []string{"https://example.com/callback"},
+		Scopes:       []string{ScopePastesRead},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := s.CreateAuthorizationCode(AuthorizeInput{
+		ClientID:    client.ClientID,
+		UserID:      1,
+		RedirectURI: "https://example.com/callback",
+		Scopes:      []string{ScopePastesRead},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pair, err := s.ExchangeCode(client, code, "https://example.com/callback", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ValidateAccessToken(pair.AccessToken); err != nil {
+		t.Error("expected", nil, "but got", err)
+	}
+
+	// A replayed code is refused and revokes what the first exchange issued
+	if _, err := s.ExchangeCode(client, code, "https://example.com/callback", ""); err != ErrInvalidGrant {
+		t.Error("expected", ErrInvalidGrant, "but got", err)
+	}
+	if _, err := s.ValidateAccessToken(pair.AccessToken); err != ErrTokenNotFound {
+		t.Error("expected", ErrTokenNotFound, "but got", err)
+	}
+	if _, err := s.Refresh(client, pair.RefreshToken); err != ErrInvalidGrant {
+		t.Error("expected", ErrInvalidGrant, "but got", err)
+	}
+}
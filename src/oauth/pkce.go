@@ -0,0 +1,45 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package oauth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+)
+
+// PKCE code challenge methods per RFC 7636
+const (
+	PKCEMethodS256  = "S256"
+	PKCEMethodPlain = "plain"
+)
+
+// S256Challenge derives the S256 code challenge for a verifier
+func S256Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// VerifyPKCE checks a code verifier against the stored challenge
+// Verifiers must be 43-128 characters per RFC 7636 section 4.1
+func VerifyPKCE(verifier, challenge, method string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+
+	var computed string
+	switch method {
+	case PKCEMethodS256:
+		computed = S256Challenge(verifier)
+	case PKCEMethodPlain, "":
+		computed = verifier
+	default:
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
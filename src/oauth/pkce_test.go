@@ -0,0 +1,41 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package oauth
+
+import (
+	"testing"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	// Challenge computed with: printf %s "$verifier" | openssl dgst -sha256 -binary | base64url
+	verifier := "dBjftJeZ4CVP-mB92K1uhbHNuAPMyD4XgP7yW9bc6Y0"
+	challenge := "T0ETIncXUSa0A2UPwMhILZA-xU2cf8fxmLp2sz1_eyc"
+
+	if res := S256Challenge(verifier); res != challenge {
+		t.Error("expected", challenge, "but got", res)
+	}
+
+	if !VerifyPKCE(verifier, challenge, PKCEMethodS256) {
+		t.Error("valid S256 verifier rejected")
+	}
+
+	if VerifyPKCE(verifier+"x", challenge, PKCEMethodS256) {
+		t.Error("invalid S256 verifier accepted")
+	}
+
+	if !VerifyPKCE(verifier, verifier, PKCEMethodPlain) {
+		t.Error("valid plain verifier rejected")
+	}
+
+	if VerifyPKCE("short", "short", PKCEMethodPlain) {
+		t.Error("verifier shorter than 43 characters accepted")
+	}
+
+	if VerifyPKCE(verifier, challenge, "unknown") {
+		t.Error("unknown method accepted")
+	}
+}
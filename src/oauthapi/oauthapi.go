@@ -0,0 +1,547 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+// Package oauthapi provides OAuth2 provider handlers (client registration,
+// consent, token issuance, refresh and revocation)
+package oauthapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/casjay-forks/caspaste/src/cli"
+	"github.com/casjay-forks/caspaste/src/config"
+	"github.com/casjay-forks/caspaste/src/httputil"
+	"github.com/casjay-forks/caspaste/src/oauth"
+	"github.com/casjay-forks/caspaste/src/web"
+)
+
+// Service provides OAuth2 provider API operations
+type Service struct {
+	oauthService *oauth.Service
+	config       *config.UsersConfig
+	serverTitle  string
+	csrfToken    func(r *http.Request) string
+}
+
+// NewService creates a new OAuth2 provider API service
+func NewService(oauthSvc *oauth.Service, cfg *config.UsersConfig, serverTitle string) *Service {
+	if cfg != nil {
+		accessTTL, _ := cli.ParseDuration(cfg.OAuth.AccessTokenTTL)
+		refreshTTL, _ := cli.ParseDuration(cfg.OAuth.RefreshTokenTTL)
+		oauthSvc.SetTTLs(0, accessTTL, refreshTTL)
+	}
+	return &Service{
+		oauthService: oauthSvc,
+		config:       cfg,
+		serverTitle:  serverTitle,
+	}
+}
+
+// SetCSRFTokenFunc sets how the consent form gets the CSRF token for a request
+func (s *Service) SetCSRFTokenFunc(fn func(r *http.Request) string) {
+	s.csrfToken = fn
+}
+
+// APIResponse is the unified response format per PART 16
+type APIResponse struct {
+	OK      bool        `json:"ok"`
+	Data    interface{} `json:"data,omitempty"`
+	Error   string      `json:"error,omitempty"`
+	Message string      `json:"message,omitempty"`
+}
+
+// RegisterClientRequest is the request body for registering a client
+type RegisterClientRequest struct {
+	Name         string   `json:"name"`
+	Homepage     string   `json:"homepage,omitempty"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes,omitempty"`
+	Public       bool     `json:"public,omitempty"`
+}
+
+// RegisterClientResponse is returned once after registration
+// The client secret is never retrievable again
+type RegisterClientResponse struct {
+	Client       *oauth.Client `json:"client"`
+	ClientSecret string        `json:"client_secret,omitempty"`
+}
+
+// TokenResponse is the RFC 6749 section 5.1 token response
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// tokenError is the RFC 6749 section 5.2 error response
+type tokenError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// HandleClients handles GET/POST /api/v1/oauth/clients
+func (s *Service) HandleClients(w http.ResponseWriter, r *http.Request) error {
+	if !s.enabled() {
+		return writeError(w, r, http.StatusNotFound, "NOT_FOUND", "OAuth provider is disabled")
+	}
+
+	authUser := web.GetAuthUser(r.Context())
+	if authUser == nil {
+		return writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required")
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		clients, err := s.oauthService.ListClients(authUser.ID)
+		if err != nil {
+			return writeError(w, r, http.StatusInternalServerError, "SERVER_ERROR", "Failed to list clients")
+		}
+		if clients == nil {
+			clients = []oauth.Client{}
+		}
+
+		var text strings.Builder
+		for _, c := range clients {
+			fmt.Fprintf(&text, "%s\t%s\n", c.ClientID, c.Name)
+		}
+		return writeSuccess(w, r, clients, fmt.Sprintf("%d clients", len(clients)), text.String())
+
+	case http.MethodPost:
+		var req RegisterClientRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return writeError(w, r, http.StatusBadRequest, "BAD_REQUEST", "Invalid request body")
+		}
+		if req.Public && !s.config.OAuth.AllowPublicClients {
+			return writeError(w, r, http.StatusForbidden, "FORBIDDEN", "Public clients are not allowed")
+		}
+
+		client, secret, err := s.oauthService.RegisterClient(oauth.RegisterClientInput{
+			OwnerID:      authUser.ID,
+			Name:         req.Name,
+			Homepage:     req.Homepage,
+			RedirectURIs: req.RedirectURIs,
+			Scopes:       req.Scopes,
+			Public:       req.Public,
+		})
+		if err != nil {
+			return writeError(w, r, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		}
+
+		textData := "client_id: " + client.ClientID
+		if secret != "" {
+			textData += "\nclient_secret: " + secret
+		}
+		return writeSuccessCode(w, r, http.StatusCreated, RegisterClientResponse{Client: client, ClientSecret: secret}, "Client registered", textData)
+
+	default:
+		return writeError(w, r, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+	}
+}
+
+// HandleClientDelete handles DELETE /api/v1/oauth/clients/{client_id}
+func (s *Service) HandleClientDelete(w http.ResponseWriter, r *http.Request, clientID string) error {
+	if !s.enabled() {
+		return writeError(w, r, http.StatusNotFound, "NOT_FOUND", "OAuth provider is disabled")
+	}
+	if r.Method != http.MethodDelete {
+		return writeError(w, r, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+	}
+
+	authUser := web.GetAuthUser(r.Context())
+	if authUser == nil {
+		return writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required")
+	}
+
+	if err := s.oauthService.DeleteClient(authUser.ID, clientID); err != nil {
+		if errors.Is(err, oauth.ErrClientNotFound) {
+			return writeError(w, r, http.StatusNotFound, "NOT_FOUND", "Client not found")
+		}
+		return writeError(w, r, http.StatusInternalServerError, "SERVER_ERROR", "Failed to delete client")
+	}
+
+	return writeSuccess(w, r, nil, "Client deleted", "")
+}
+
+// HandleAuthorizationDelete handles DELETE /api/v1/oauth/authorizations/{client_id}
+// Revokes every token the user has granted to the client
+func (s *Service) HandleAuthorizationDelete(w http.ResponseWriter, r *http.Request, clientID string) error {
+	if !s.enabled() {
+		return writeError(w, r, http.StatusNotFound, "NOT_FOUND", "OAuth provider is disabled")
+	}
+
+	authUser := web.GetAuthUser(r.Context())
+	if authUser == nil {
+		return writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required")
+	}
+	if r.Method != http.MethodDelete {
+		return writeError(w, r, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+	}
+
+	if err := s.oauthService.RevokeAllForUser(authUser.ID, clientID); err != nil {
+		return writeError(w, r, http.StatusInternalServerError, "SERVER_ERROR", "Failed to revoke access")
+	}
+
+	return writeSuccess(w, r, nil, "Access revoked", "")
+}
+
+// HandleAuthorize handles GET/POST /oauth/authorize
+// GET renders the consent screen, POST records the user's decision
+func (s *Service) HandleAuthorize(w http.ResponseWriter, r *http.Request) error {
+	if !s.enabled() {
+		http.NotFound(w, r)
+		return nil
+	}
+
+	// The consent screen requires a logged-in user
+	authUser := web.GetAuthUser(r.Context())
+	if authUser == nil {
+		http.Redirect(w, r, "/login?redirect="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+		return nil
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return writeError(w, r, http.StatusBadRequest, "BAD_REQUEST", "Invalid request")
+	}
+
+	clientID := r.Form.Get("client_id")
+	redirectURI := r.Form.Get("redirect_uri")
+	state := r.Form.Get("state")
+
+	// Errors before the redirect URI is validated must not redirect per RFC 6749 section 4.1.2.1
+	client, err := s.oauthService.GetClient(clientID)
+	if err != nil {
+		return writeError(w, r, http.StatusBadRequest, "INVALID_CLIENT", "Unknown client")
+	}
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	}
+	if !client.HasRedirectURI(redirectURI) {
+		return writeError(w, r, http.StatusBadRequest, "INVALID_REDIRECT_URI", "Redirect URI is not registered for this client")
+	}
+
+	if r.Form.Get("response_type") != "code" {
+		redirectWithError(w, r, redirectURI, "unsupported_response_type", state)
+		return nil
+	}
+
+	scopes, err := oauth.NormalizeScopes(strings.Fields(r.Form.Get("scope")))
+	if err != nil || !client.AllowsScopes(scopes) {
+		redirectWithError(w, r, redirectURI, "invalid_scope", state)
+		return nil
+	}
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+
+	challenge := r.Form.Get("code_challenge")
+	challengeMethod := r.Form.Get("code_challenge_method")
+	if challenge == "" && client.Public {
+		redirectWithError(w, r, redirectURI, "invalid_request", state)
+		return nil
+	}
+
+	if r.Method == http.MethodGet {
+		return s.renderConsent(w, r, client, redirectURI, scopes)
+	}
+	if r.Method != http.MethodPost {
+		return writeError(w, r, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+	}
+
+	if r.Form.Get("decision") != "approve" {
+		redirectWithError(w, r, redirectURI, "access_denied", state)
+		return nil
+	}
+
+	code, err := s.oauthService.CreateAuthorizationCode(oauth.AuthorizeInput{
+		ClientID:            client.ClientID,
+		UserID:              authUser.ID,
+		RedirectURI:         redirectURI,
+		Scopes:              scopes,
+		CodeChallenge:       challenge,
+		CodeChallengeMethod: challengeMethod,
+	})
+	if err != nil {
+		redirectWithError(w, r, redirectURI, "server_error", state)
+		return nil
+	}
+
+	params := url.Values{}
+	params.Set("code", code)
+	if state != "" {
+		params.Set("state", state)
+	}
+	http.Redirect(w, r, appendQuery(redirectURI, params), http.StatusFound)
+	return nil
+}
+
+// HandleToken handles POST /oauth/token
+// Supports the authorization_code and refresh_token grants
+func (s *Service) HandleToken(w http.ResponseWriter, r *http.Request) error {
+	if !s.enabled() {
+		http.NotFound(w, r)
+		return nil
+	}
+	if r.Method != http.MethodPost {
+		return writeTokenError(w, http.StatusMethodNotAllowed, "invalid_request", "POST required")
+	}
+	if err := r.ParseForm(); err != nil {
+		return writeTokenError(w, http.StatusBadRequest, "invalid_request", "Invalid form body")
+	}
+
+	client, err := s.authenticateClient(r)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		return writeTokenError(w, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+	}
+
+	var pair *oauth.TokenPair
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		pair, err = s.oauthService.ExchangeCode(client, r.PostForm.Get("code"), r.PostForm.Get("redirect_uri"), r.PostForm.Get("code_verifier"))
+	case "refresh_token":
+		pair, err = s.oauthService.Refresh(client, r.PostForm.Get("refresh_token"))
+	default:
+		return writeTokenError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+	}
+	if err != nil {
+		return writeTokenError(w, http.StatusBadRequest, "invalid_grant", err.Error())
+	}
+
+	// Token responses must not be cached per RFC 6749 section 5.1
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	return writeJSON(w, TokenResponse{
+		AccessToken:  pair.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    pair.ExpiresIn,
+		RefreshToken: pair.RefreshToken,
+		Scope:        strings.Join(pair.Scopes, " "),
+	})
+}
+
+// HandleRevoke handles POST /oauth/revoke per RFC 7009
+func (s *Service) HandleRevoke(w http.ResponseWriter, r *http.Request) error {
+	if !s.enabled() {
+		http.NotFound(w, r)
+		return nil
+	}
+	if r.Method != http.MethodPost {
+		return writeTokenError(w, http.StatusMethodNotAllowed, "invalid_request", "POST required")
+	}
+	if err := r.ParseForm(); err != nil {
+		return writeTokenError(w, http.StatusBadRequest, "invalid_request", "Invalid form body")
+	}
+
+	client, err := s.authenticateClient(r)
+	if err != nil {
+		return writeTokenError(w, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+	}
+
+	if err := s.oauthService.Revoke(client, r.PostForm.Get("token")); err != nil {
+		return writeTokenError(w, http.StatusInternalServerError, "server_error", "")
+	}
+
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// enabled reports whether the OAuth provider is turned on
+func (s *Service) enabled() bool {
+	return s.config != nil && s.config.Enabled && s.config.OAuth.Enabled
+}
+
+// authenticateClient reads client credentials from HTTP Basic auth or the form body
+func (s *Service) authenticateClient(r *http.Request) (*oauth.Client, error) {
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		clientID = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+	return s.oauthService.AuthenticateClient(clientID, secret)
+}
+
+// renderConsent writes the consent screen
+func (s *Service) renderConsent(w http.ResponseWriter, r *http.Request, client *oauth.Client, redirectURI string, scopes []string) error {
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	// Prevent clickjacking of the approve button
+	w.Header().Set("X-Frame-Options", "DENY")
+
+	var scopeList strings.Builder
+	for _, scope := range scopes {
+		scopeList.WriteString("\t\t\t<li>" + html.EscapeString(scopeDescription(scope)) + "</li>\n")
+	}
+
+	var hidden strings.Builder
+	for _, key := range []string{"client_id", "response_type", "state", "code_challenge", "code_challenge_method"} {
+		if v := r.Form.Get(key); v != "" {
+			hidden.WriteString(`			<input type="hidden" name="` + key + `" value="` + html.EscapeString(v) + `">` + "\n")
+		}
+	}
+	hidden.WriteString(`			<input type="hidden" name="redirect_uri" value="` + html.EscapeString(redirectURI) + `">` + "\n")
+	hidden.WriteString(`			<input type="hidden" name="scope" value="` + html.EscapeString(strings.Join(scopes, " ")) + `">` + "\n")
+	if s.csrfToken != nil {
+		hidden.WriteString(`			<input type="hidden" name="csrf_token" value="` + html.EscapeString(s.csrfToken(r)) + `">` + "\n")
+	}
+
+	homepage := ""
+	if client.Homepage != "" {
+		homepage = ` (<a href="` + html.EscapeString(client.Homepage) + `" rel="noopener noreferrer">` + html.EscapeString(client.Homepage) + `</a>)`
+	}
+
+	page := `<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="UTF-8">
+	<title>Authorize ` + html.EscapeString(client.Name) + ` - ` + html.EscapeString(s.serverTitle) + `</title>
+	<link rel="stylesheet" href="/style.css">
+</head>
+<body>
+	<div class="container">
+		<h1>Authorize application</h1>
+		<p><strong>` + html.EscapeString(client.Name) + `</strong>` + homepage + ` is requesting access to your account:</p>
+		<ul>
+` + scopeList.String() + `		</ul>
+		<p>You will be redirected to <code>` + html.EscapeString(redirectURI) + `</code></p>
+		<form action="/oauth/authorize" method="POST">
+` + hidden.String() + `			<button type="submit" name="decision" value="approve">Authorize</button>
+			<button type="submit" name="decision" value="deny">Deny</button>
+		</form>
+	</div>
+</body>
+</html>`
+
+	_, err := w.Write([]byte(page))
+	return err
+}
+
+// scopeDescription returns a human-readable description of a scope
+func scopeDescription(scope string) string {
+	switch scope {
+	case oauth.ScopePastesRead:
+		return "Read your pastes, including private ones"
+	case oauth.ScopePastesWrite:
+		return "Create, edit and delete pastes on your behalf"
+	case oauth.ScopeProfileRead:
+		return "Read your profile (username, display name, email)"
+	default:
+		return scope
+	}
+}
+
+// redirectWithError sends an RFC 6749 error back to the client's redirect URI
+func redirectWithError(w http.ResponseWriter, r *http.Request, redirectURI, errCode, state string) {
+	params := url.Values{}
+	params.Set("error", errCode)
+	if state != "" {
+		params.Set("state", state)
+	}
+	http.Redirect(w, r, appendQuery(redirectURI, params), http.StatusFound)
+}
+
+// appendQuery appends params to a URI that may already have a query string
+func appendQuery(uri string, params url.Values) string {
+	sep := "?"
+	if strings.Contains(uri, "?") {
+		sep = "&"
+	}
+	return uri + sep + params.Encode()
+}
+
+// Response helpers
+
+func writeTokenError(w http.ResponseWriter, code int, errCode, description string) error {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	data, err := json.MarshalIndent(tokenError{Error: errCode, ErrorDescription: description}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+func writeSuccess(w http.ResponseWriter, r *http.Request, data interface{}, textMsg string, textData string) error {
+	return writeSuccessCode(w, r, http.StatusOK, data, textMsg, textData)
+}
+
+// writeSuccessCode is writeSuccess with a status other than 200; the status
+// is written after the Content-Type header, which it would otherwise freeze
+func writeSuccessCode(w http.ResponseWriter, r *http.Request, code int, data interface{}, textMsg string, textData string) error {
+	format := httputil.GetAPIResponseFormat(r)
+
+	switch format {
+	case httputil.FormatText:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(code)
+		if textMsg != "" {
+			fmt.Fprintf(w, "OK: %s\n", textMsg)
+		}
+		if textData != "" {
+			fmt.Fprint(w, textData)
+			if textData[len(textData)-1] != '\n' {
+				fmt.Fprint(w, "\n")
+			}
+		}
+		return nil
+	default:
+		return writeJSONCode(w, code, APIResponse{
+			OK:   true,
+			Data: data,
+		})
+	}
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, code int, errCode, message string) error {
+	format := httputil.GetAPIResponseFormat(r)
+
+	switch format {
+	case httputil.FormatText:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(code)
+		fmt.Fprintf(w, "ERROR: %s: %s\n", errCode, message)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		resp := APIResponse{
+			OK:      false,
+			Error:   errCode,
+			Message: message,
+		}
+		jsonData, _ := json.MarshalIndent(resp, "", "  ")
+		w.Write(jsonData)
+		w.Write([]byte("\n"))
+	}
+
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) error {
+	return writeJSONCode(w, http.StatusOK, v)
+}
+
+func writeJSONCode(w http.ResponseWriter, code int, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_, err = w.Write(data)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write([]byte("\n"))
+	return err
+}
@@ -7,11 +7,13 @@
 package org
 
 import (
-	"database/sql"
+	"context"
 	"errors"
 	"regexp"
 	"strings"
 	"time"
+
+	"github.com/casjay-forks/caspaste/src/homoglyph"
 )
 
 // Role constants
@@ -110,23 +112,29 @@ type UpdateOrgInput struct {
 
 // Service provides organization operations
 type Service struct {
-	db *sql.DB
+	store    Store
+	reserved *homoglyph.Checker
 }
 
 // NewService creates a new organization service
-func NewService(db *sql.DB) *Service {
-	return &Service{db: db}
+func NewService(store Store) *Service {
+	return &Service{store: store}
+}
+
+// SetReservedChecker blocks slugs that are, or look like, reserved words
+func (s *Service) SetReservedChecker(c *homoglyph.Checker) {
+	s.reserved = c
 }
 
 // Create creates a new organization
-func (s *Service) Create(input CreateOrgInput, ownerID int64) (*Org, error) {
+func (s *Service) Create(ctx context.Context, input CreateOrgInput, ownerID int64) (*Org, error) {
 	// Validate slug
 	if err := ValidateSlug(input.Slug); err != nil {
 		return nil, err
 	}
 
 	// Check if slug is available (users and orgs share namespace)
-	if err := s.CheckSlugAvailable(input.Slug); err != nil {
+	if err := s.CheckSlugAvailable(ctx, input.Slug); err != nil {
 		return nil, err
 	}
 
@@ -137,192 +145,64 @@ func (s *Service) Create(input CreateOrgInput, ownerID int64) (*Org, error) {
 	}
 
 	now := time.Now().Unix()
-	slug := strings.ToLower(input.Slug)
-
-	// Start transaction
-	tx, err := s.db.Begin()
-	if err != nil {
-		return nil, err
-	}
-	defer tx.Rollback()
-
-	// Create organization
-	result, err := tx.Exec(`
-		INSERT INTO orgs (slug, name, description, website, location, visibility, owner_id, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, slug, input.Name, input.Description, input.Website, input.Location, visibility, ownerID, now, now)
-	if err != nil {
-		return nil, err
-	}
-
-	orgID, err := result.LastInsertId()
-	if err != nil {
-		return nil, err
-	}
-
-	// Add owner as member with owner role
-	_, err = tx.Exec(`
-		INSERT INTO org_members (org_id, user_id, role, created_at)
-		VALUES (?, ?, ?, ?)
-	`, orgID, ownerID, RoleOwner, now)
-	if err != nil {
-		return nil, err
-	}
 
-	// Create default preferences
-	_, err = tx.Exec(`
-		INSERT INTO org_preferences (org_id, created_at, updated_at)
-		VALUES (?, ?, ?)
-	`, orgID, now, now)
+	// The owner is added as a member with the owner role
+	orgID, err := s.store.Insert(ctx, &Org{
+		Slug:        strings.ToLower(input.Slug),
+		Name:        input.Name,
+		Description: input.Description,
+		Website:     input.Website,
+		Location:    input.Location,
+		Visibility:  visibility,
+		OwnerID:     ownerID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	// Commit transaction
-	if err := tx.Commit(); err != nil {
-		return nil, err
-	}
-
-	return s.GetByID(orgID)
+	return s.GetByID(ctx, orgID)
 }
 
 // GetByID retrieves an organization by ID
-func (s *Service) GetByID(id int64) (*Org, error) {
-	org := &Org{}
-	var emailVerified int
-
-	err := s.db.QueryRow(`
-		SELECT id, slug, name, description, avatar_type, avatar_url, website, location,
-		       visibility, owner_id, email, email_verified, created_at, updated_at
-		FROM orgs WHERE id = ?
-	`, id).Scan(
-		&org.ID, &org.Slug, &org.Name, &org.Description, &org.AvatarType, &org.AvatarURL,
-		&org.Website, &org.Location, &org.Visibility, &org.OwnerID, &org.Email,
-		&emailVerified, &org.CreatedAt, &org.UpdatedAt,
-	)
-	if err == sql.ErrNoRows {
-		return nil, ErrOrgNotFound
-	}
-	if err != nil {
-		return nil, err
-	}
-
-	org.EmailVerified = emailVerified == 1
-
-	return org, nil
+func (s *Service) GetByID(ctx context.Context, id int64) (*Org, error) {
+	return s.store.GetByID(ctx, id)
 }
 
 // GetBySlug retrieves an organization by slug
-func (s *Service) GetBySlug(slug string) (*Org, error) {
-	org := &Org{}
-	var emailVerified int
-
-	err := s.db.QueryRow(`
-		SELECT id, slug, name, description, avatar_type, avatar_url, website, location,
-		       visibility, owner_id, email, email_verified, created_at, updated_at
-		FROM orgs WHERE LOWER(slug) = LOWER(?)
-	`, slug).Scan(
-		&org.ID, &org.Slug, &org.Name, &org.Description, &org.AvatarType, &org.AvatarURL,
-		&org.Website, &org.Location, &org.Visibility, &org.OwnerID, &org.Email,
-		&emailVerified, &org.CreatedAt, &org.UpdatedAt,
-	)
-	if err == sql.ErrNoRows {
-		return nil, ErrOrgNotFound
-	}
-	if err != nil {
-		return nil, err
-	}
-
-	org.EmailVerified = emailVerified == 1
-
-	return org, nil
+func (s *Service) GetBySlug(ctx context.Context, slug string) (*Org, error) {
+	return s.store.GetBySlug(ctx, slug)
 }
 
 // Update updates an organization
-func (s *Service) Update(id int64, input UpdateOrgInput) error {
-	var updates []string
-	var args []interface{}
-
-	if input.Name != nil {
-		updates = append(updates, "name = ?")
-		args = append(args, *input.Name)
-	}
-	if input.Description != nil {
-		updates = append(updates, "description = ?")
-		args = append(args, *input.Description)
-	}
-	if input.AvatarType != nil {
-		updates = append(updates, "avatar_type = ?")
-		args = append(args, *input.AvatarType)
-	}
-	if input.AvatarURL != nil {
-		updates = append(updates, "avatar_url = ?")
-		args = append(args, *input.AvatarURL)
-	}
-	if input.Website != nil {
-		updates = append(updates, "website = ?")
-		args = append(args, *input.Website)
-	}
-	if input.Location != nil {
-		updates = append(updates, "location = ?")
-		args = append(args, *input.Location)
-	}
-	if input.Visibility != nil {
-		updates = append(updates, "visibility = ?")
-		args = append(args, *input.Visibility)
-	}
-	if input.Email != nil {
-		updates = append(updates, "email = ?")
-		args = append(args, *input.Email)
-	}
-
-	if len(updates) == 0 {
-		return nil
-	}
-
-	updates = append(updates, "updated_at = ?")
-	args = append(args, time.Now().Unix())
-	args = append(args, id)
-
-	query := "UPDATE orgs SET " + strings.Join(updates, ", ") + " WHERE id = ?"
-	_, err := s.db.Exec(query, args...)
-	return err
+func (s *Service) Update(ctx context.Context, id int64, input UpdateOrgInput) error {
+	return s.store.Update(ctx, id, input)
 }
 
 // Delete removes an organization
-func (s *Service) Delete(id int64) error {
-	_, err := s.db.Exec("DELETE FROM orgs WHERE id = ?", id)
-	return err
+func (s *Service) Delete(ctx context.Context, id int64) error {
+	return s.store.Delete(ctx, id)
 }
 
 // CheckSlugAvailable checks if a slug is available (orgs and users share namespace)
-func (s *Service) CheckSlugAvailable(slug string) error {
-	slug = strings.ToLower(slug)
-
-	// Check if org exists
-	var count int
-	err := s.db.QueryRow("SELECT COUNT(*) FROM orgs WHERE LOWER(slug) = ?", slug).Scan(&count)
-	if err != nil {
-		return err
+// Reserved slugs and their look-alikes are never available
+func (s *Service) CheckSlugAvailable(ctx context.Context, slug string) error {
+	if _, blocked := s.reserved.Match(slug); blocked {
+		return ErrSlugBlocked
 	}
-	if count > 0 {
-		return ErrSlugTaken
-	}
-
-	// Check if username exists
-	err = s.db.QueryRow("SELECT COUNT(*) FROM users WHERE LOWER(username) = ?", slug).Scan(&count)
+	taken, err := s.store.SlugTaken(ctx, slug)
 	if err != nil {
 		return err
 	}
-	if count > 0 {
+	if taken {
 		return ErrSlugTaken
 	}
-
 	return nil
 }
 
 // AddMember adds a user to an organization
-func (s *Service) AddMember(orgID, userID int64, role string) error {
+func (s *Service) AddMember(ctx context.Context, orgID, userID int64, role string) error {
 	// Validate role
 	if role == "" {
 		role = RoleMember
@@ -332,22 +212,22 @@ func (s *Service) AddMember(orgID, userID int64, role string) error {
 	}
 
 	// Check if already a member
-	if s.IsMember(orgID, userID) {
+	if s.IsMember(ctx, orgID, userID) {
 		return ErrAlreadyMember
 	}
 
-	now := time.Now().Unix()
-	_, err := s.db.Exec(`
-		INSERT INTO org_members (org_id, user_id, role, created_at)
-		VALUES (?, ?, ?, ?)
-	`, orgID, userID, role, now)
-	return err
+	return s.store.AddMember(ctx, &OrgMember{
+		OrgID:     orgID,
+		UserID:    userID,
+		Role:      role,
+		CreatedAt: time.Now().Unix(),
+	})
 }
 
 // RemoveMember removes a user from an organization
-func (s *Service) RemoveMember(orgID, userID int64) error {
+func (s *Service) RemoveMember(ctx context.Context, orgID, userID int64) error {
 	// Check if this is the owner
-	org, err := s.GetByID(orgID)
+	org, err := s.GetByID(ctx, orgID)
 	if err != nil {
 		return err
 	}
@@ -355,26 +235,18 @@ func (s *Service) RemoveMember(orgID, userID int64) error {
 		return ErrCannotRemoveOwner
 	}
 
-	result, err := s.db.Exec("DELETE FROM org_members WHERE org_id = ? AND user_id = ?", orgID, userID)
-	if err != nil {
-		return err
-	}
-	rows, _ := result.RowsAffected()
-	if rows == 0 {
-		return ErrNotMember
-	}
-	return nil
+	return s.store.RemoveMember(ctx, orgID, userID)
 }
 
 // UpdateMemberRole updates a member's role
-func (s *Service) UpdateMemberRole(orgID, userID int64, role string) error {
+func (s *Service) UpdateMemberRole(ctx context.Context, orgID, userID int64, role string) error {
 	// Validate role
 	if role != RoleMember && role != RoleAdmin && role != RoleOwner {
 		return errors.New("invalid role")
 	}
 
 	// Cannot change owner's role
-	org, err := s.GetByID(orgID)
+	org, err := s.GetByID(ctx, orgID)
 	if err != nil {
 		return err
 	}
@@ -382,97 +254,27 @@ func (s *Service) UpdateMemberRole(orgID, userID int64, role string) error {
 		return errors.New("cannot change owner's role, transfer ownership instead")
 	}
 
-	result, err := s.db.Exec("UPDATE org_members SET role = ? WHERE org_id = ? AND user_id = ?",
-		role, orgID, userID)
-	if err != nil {
-		return err
-	}
-	rows, _ := result.RowsAffected()
-	if rows == 0 {
-		return ErrNotMember
-	}
-	return nil
+	return s.store.SetMemberRole(ctx, orgID, userID, role)
 }
 
 // GetMembers returns all members of an organization
-func (s *Service) GetMembers(orgID int64) ([]OrgMember, error) {
-	rows, err := s.db.Query(`
-		SELECT m.id, m.org_id, m.user_id, m.role, m.created_at,
-		       u.username, u.display_name, u.avatar_type, u.avatar_url
-		FROM org_members m
-		JOIN users u ON u.id = m.user_id
-		WHERE m.org_id = ?
-		ORDER BY m.role = 'owner' DESC, m.role = 'admin' DESC, m.created_at
-	`, orgID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var members []OrgMember
-	for rows.Next() {
-		var m OrgMember
-		err := rows.Scan(
-			&m.ID, &m.OrgID, &m.UserID, &m.Role, &m.CreatedAt,
-			&m.Username, &m.DisplayName, &m.AvatarType, &m.AvatarURL,
-		)
-		if err != nil {
-			return nil, err
-		}
-		members = append(members, m)
-	}
-
-	return members, nil
+func (s *Service) GetMembers(ctx context.Context, orgID int64) ([]OrgMember, error) {
+	return s.store.Members(ctx, orgID)
 }
 
 // GetUserOrgs returns all organizations a user is a member of
-func (s *Service) GetUserOrgs(userID int64) ([]Org, error) {
-	rows, err := s.db.Query(`
-		SELECT o.id, o.slug, o.name, o.description, o.avatar_type, o.avatar_url,
-		       o.website, o.location, o.visibility, o.owner_id, o.email,
-		       o.email_verified, o.created_at, o.updated_at
-		FROM orgs o
-		JOIN org_members m ON m.org_id = o.id
-		WHERE m.user_id = ?
-		ORDER BY o.name
-	`, userID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var orgs []Org
-	for rows.Next() {
-		var org Org
-		var emailVerified int
-
-		err := rows.Scan(
-			&org.ID, &org.Slug, &org.Name, &org.Description, &org.AvatarType, &org.AvatarURL,
-			&org.Website, &org.Location, &org.Visibility, &org.OwnerID, &org.Email,
-			&emailVerified, &org.CreatedAt, &org.UpdatedAt,
-		)
-		if err != nil {
-			return nil, err
-		}
-
-		org.EmailVerified = emailVerified == 1
-		orgs = append(orgs, org)
-	}
-
-	return orgs, nil
+func (s *Service) GetUserOrgs(ctx context.Context, userID int64) ([]Org, error) {
+	return s.store.UserOrgs(ctx, userID)
 }
 
 // IsMember checks if a user is a member of an organization
-func (s *Service) IsMember(orgID, userID int64) bool {
-	var count int
-	s.db.QueryRow("SELECT COUNT(*) FROM org_members WHERE org_id = ? AND user_id = ?", orgID, userID).Scan(&count)
-	return count > 0
+func (s *Service) IsMember(ctx context.Context, orgID, userID int64) bool {
+	return s.GetMemberRole(ctx, orgID, userID) != ""
 }
 
 // GetMemberRole returns a user's role in an organization
-func (s *Service) GetMemberRole(orgID, userID int64) string {
-	var role string
-	err := s.db.QueryRow("SELECT role FROM org_members WHERE org_id = ? AND user_id = ?", orgID, userID).Scan(&role)
+func (s *Service) GetMemberRole(ctx context.Context, orgID, userID int64) string {
+	role, err := s.store.MemberRole(ctx, orgID, userID)
 	if err != nil {
 		return ""
 	}
@@ -480,9 +282,9 @@ func (s *Service) GetMemberRole(orgID, userID int64) string {
 }
 
 // TransferOwnership transfers ownership to another member
-func (s *Service) TransferOwnership(orgID, currentOwnerID, newOwnerID int64) error {
+func (s *Service) TransferOwnership(ctx context.Context, orgID, currentOwnerID, newOwnerID int64) error {
 	// Verify current owner
-	org, err := s.GetByID(orgID)
+	org, err := s.GetByID(ctx, orgID)
 	if err != nil {
 		return err
 	}
@@ -491,56 +293,27 @@ func (s *Service) TransferOwnership(orgID, currentOwnerID, newOwnerID int64) err
 	}
 
 	// Verify new owner is a member
-	if !s.IsMember(orgID, newOwnerID) {
+	if !s.IsMember(ctx, orgID, newOwnerID) {
 		return ErrNotMember
 	}
 
-	// Start transaction
-	tx, err := s.db.Begin()
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
-
-	// Update organization owner
-	_, err = tx.Exec("UPDATE orgs SET owner_id = ?, updated_at = ? WHERE id = ?",
-		newOwnerID, time.Now().Unix(), orgID)
-	if err != nil {
-		return err
-	}
-
-	// Update member roles
-	_, err = tx.Exec("UPDATE org_members SET role = ? WHERE org_id = ? AND user_id = ?",
-		RoleAdmin, orgID, currentOwnerID)
-	if err != nil {
-		return err
-	}
-
-	_, err = tx.Exec("UPDATE org_members SET role = ? WHERE org_id = ? AND user_id = ?",
-		RoleOwner, orgID, newOwnerID)
-	if err != nil {
-		return err
-	}
-
-	return tx.Commit()
+	return s.store.TransferOwnership(ctx, orgID, currentOwnerID, newOwnerID)
 }
 
 // GetMemberCount returns the number of members in an organization
-func (s *Service) GetMemberCount(orgID int64) (int, error) {
-	var count int
-	err := s.db.QueryRow("SELECT COUNT(*) FROM org_members WHERE org_id = ?", orgID).Scan(&count)
-	return count, err
+func (s *Service) GetMemberCount(ctx context.Context, orgID int64) (int, error) {
+	return s.store.MemberCount(ctx, orgID)
 }
 
 // CanManageMembers checks if a user can manage members
-func (s *Service) CanManageMembers(orgID, userID int64) bool {
-	role := s.GetMemberRole(orgID, userID)
+func (s *Service) CanManageMembers(ctx context.Context, orgID, userID int64) bool {
+	role := s.GetMemberRole(ctx, orgID, userID)
 	return role == RoleOwner || role == RoleAdmin
 }
 
 // CanDeleteOrg checks if a user can delete the organization
-func (s *Service) CanDeleteOrg(orgID, userID int64) bool {
-	org, err := s.GetByID(orgID)
+func (s *Service) CanDeleteOrg(ctx context.Context, orgID, userID int64) bool {
+	org, err := s.GetByID(ctx, orgID)
 	if err != nil {
 		return false
 	}
@@ -0,0 +1,378 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package org
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// queryTimeout bounds each call to the database, on top of the caller's context
+const queryTimeout = 5 * time.Second
+
+// orgColumns are the columns scanOrg reads, in order
+const orgColumns = `o.id, o.slug, o.name, COALESCE(o.description, ''), o.avatar_type,
+	COALESCE(o.avatar_url, ''), COALESCE(o.website, ''), COALESCE(o.location, ''),
+	o.visibility, o.owner_id, COALESCE(o.email, ''), o.email_verified,
+	o.created_at, o.updated_at`
+
+// sqlStore keeps organizations in the orgs, org_members and org_preferences
+// tables of a SQLite or PostgreSQL database
+type sqlStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore returns a Store backed by an open database
+func NewSQLStore(db *sql.DB) Store {
+	return &sqlStore{db: db}
+}
+
+// scanner is a *sql.Row or *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanOrg(row scanner) (*Org, error) {
+	org := &Org{}
+	var emailVerified int
+
+	err := row.Scan(
+		&org.ID, &org.Slug, &org.Name, &org.Description, &org.AvatarType, &org.AvatarURL,
+		&org.Website, &org.Location, &org.Visibility, &org.OwnerID, &org.Email,
+		&emailVerified, &org.CreatedAt, &org.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrOrgNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	org.EmailVerified = emailVerified == 1
+	return org, nil
+}
+
+func (s *sqlStore) Insert(ctx context.Context, o *Org) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	// Start transaction
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Create organization
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO orgs (slug, name, description, website, location, visibility, owner_id, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, o.Slug, o.Name, o.Description, o.Website, o.Location, o.Visibility, o.OwnerID, o.CreatedAt, o.UpdatedAt)
+	if err != nil {
+		return 0, err
+	}
+
+	orgID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	// Add owner as member with owner role
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO org_members (org_id, user_id, role, created_at)
+		VALUES (?, ?, ?, ?)
+	`, orgID, o.OwnerID, RoleOwner, o.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+
+	// Create default preferences
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO org_preferences (org_id, created_at, updated_at)
+		VALUES (?, ?, ?)
+	`, orgID, o.CreatedAt, o.UpdatedAt)
+	if err != nil {
+		return 0, err
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return orgID, nil
+}
+
+func (s *sqlStore) GetByID(ctx context.Context, id int64) (*Org, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	return scanOrg(s.db.QueryRowContext(ctx, "SELECT "+orgColumns+" FROM orgs o WHERE o.id = ?", id))
+}
+
+func (s *sqlStore) GetBySlug(ctx context.Context, slug string) (*Org, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	return scanOrg(s.db.QueryRowContext(ctx, "SELECT "+orgColumns+" FROM orgs o WHERE LOWER(o.slug) = LOWER(?)", slug))
+}
+
+func (s *sqlStore) Update(ctx context.Context, id int64, input UpdateOrgInput) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	var updates []string
+	var args []interface{}
+
+	if input.Name != nil {
+		updates = append(updates, "name = ?")
+		args = append(args, *input.Name)
+	}
+	if input.Description != nil {
+		updates = append(updates, "description = ?")
+		args = append(args, *input.Description)
+	}
+	if input.AvatarType != nil {
+		updates = append(updates, "avatar_type = ?")
+		args = append(args, *input.AvatarType)
+	}
+	if input.AvatarURL != nil {
+		updates = append(updates, "avatar_url = ?")
+		args = append(args, *input.AvatarURL)
+	}
+	if input.Website != nil {
+		updates = append(updates, "website = ?")
+		args = append(args, *input.Website)
+	}
+	if input.Location != nil {
+		updates = append(updates, "location = ?")
+		args = append(args, *input.Location)
+	}
+	if input.Visibility != nil {
+		updates = append(updates, "visibility = ?")
+		args = append(args, *input.Visibility)
+	}
+	if input.Email != nil {
+		updates = append(updates, "email = ?")
+		args = append(args, *input.Email)
+	}
+
+	if len(updates) == 0 {
+		return nil
+	}
+
+	updates = append(updates, "updated_at = ?")
+	args = append(args, time.Now().Unix())
+	args = append(args, id)
+
+	query := "UPDATE orgs SET " + strings.Join(updates, ", ") + " WHERE id = ?"
+	_, err := s.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (s *sqlStore) Delete(ctx context.Context, id int64) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, "DELETE FROM orgs WHERE id = ?", id)
+	return err
+}
+
+func (s *sqlStore) SlugTaken(ctx context.Context, slug string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	slug = strings.ToLower(slug)
+
+	// Check if org exists
+	var count int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM orgs WHERE LOWER(slug) = ?", slug).Scan(&count)
+	if err != nil || count > 0 {
+		return count > 0, err
+	}
+
+	// Check if username exists
+	err = s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE LOWER(username) = ?", slug).Scan(&count)
+	return count > 0, err
+}
+
+func (s *sqlStore) AddMember(ctx context.Context, m *OrgMember) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO org_members (org_id, user_id, role, created_at)
+		VALUES (?, ?, ?, ?)
+	`, m.OrgID, m.UserID, m.Role, m.CreatedAt)
+	return err
+}
+
+func (s *sqlStore) RemoveMember(ctx context.Context, orgID, userID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, "DELETE FROM org_members WHERE org_id = ? AND user_id = ?", orgID, userID)
+	return memberAffected(result, err)
+}
+
+func (s *sqlStore) SetMemberRole(ctx context.Context, orgID, userID int64, role string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, "UPDATE org_members SET role = ? WHERE org_id = ? AND user_id = ?",
+		role, orgID, userID)
+	return memberAffected(result, err)
+}
+
+// memberAffected turns a change that matched no membership into ErrNotMember
+func memberAffected(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return ErrNotMember
+	}
+	return nil
+}
+
+func (s *sqlStore) MemberRole(ctx context.Context, orgID, userID int64) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	var role string
+	err := s.db.QueryRowContext(ctx, "SELECT role FROM org_members WHERE org_id = ? AND user_id = ?", orgID, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return role, err
+}
+
+func (s *sqlStore) Members(ctx context.Context, orgID int64) ([]OrgMember, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT m.id, m.org_id, m.user_id, m.role, m.created_at,
+		       u.username, u.display_name, u.avatar_type, u.avatar_url
+		FROM org_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.org_id = ?
+		ORDER BY m.role = 'owner' DESC, m.role = 'admin' DESC, m.created_at
+	`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []OrgMember
+	for rows.Next() {
+		var m OrgMember
+		err := rows.Scan(
+			&m.ID, &m.OrgID, &m.UserID, &m.Role, &m.CreatedAt,
+			&m.Username, &m.DisplayName, &m.AvatarType, &m.AvatarURL,
+		)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+
+	return members, nil
+}
+
+func (s *sqlStore) MemberCount(ctx context.Context, orgID int64) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	var count int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM org_members WHERE org_id = ?", orgID).Scan(&count)
+	return count, err
+}
+
+func (s *sqlStore) List(ctx context.Context) ([]Org, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, "SELECT "+orgColumns+" FROM orgs o ORDER BY o.id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orgs []Org
+	for rows.Next() {
+		org, err := scanOrg(rows)
+		if err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, *org)
+	}
+	return orgs, rows.Err()
+}
+
+func (s *sqlStore) UserOrgs(ctx context.Context, userID int64) ([]Org, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+orgColumns+`
+		FROM orgs o
+		JOIN org_members m ON m.org_id = o.id
+		WHERE m.user_id = ?
+		ORDER BY o.name
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orgs []Org
+	for rows.Next() {
+		org, err := scanOrg(rows)
+		if err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, *org)
+	}
+
+	return orgs, nil
+}
+
+func (s *sqlStore) TransferOwnership(ctx context.Context, orgID, currentOwnerID, newOwnerID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	// Start transaction
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Update organization owner
+	_, err = tx.ExecContext(ctx, "UPDATE orgs SET owner_id = ?, updated_at = ? WHERE id = ?",
+		newOwnerID, time.Now().Unix(), orgID)
+	if err != nil {
+		return err
+	}
+
+	// Update member roles
+	_, err = tx.ExecContext(ctx, "UPDATE org_members SET role = ? WHERE org_id = ? AND user_id = ?",
+		RoleAdmin, orgID, currentOwnerID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE org_members SET role = ? WHERE org_id = ? AND user_id = ?",
+		RoleOwner, orgID, newOwnerID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,41 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package org
+
+import (
+	"context"
+)
+
+// Store persists organizations and their members
+// Implementations return ErrOrgNotFound for missing organizations and
+// ErrNotMember when a membership to change does not exist
+type Store interface {
+	// Insert adds an organization with its owner as a member, and returns its ID
+	Insert(ctx context.Context, o *Org) (int64, error)
+	GetByID(ctx context.Context, id int64) (*Org, error)
+	// GetBySlug matches case-insensitively
+	GetBySlug(ctx context.Context, slug string) (*Org, error)
+	// Update changes the fields that are set in input
+	Update(ctx context.Context, id int64, input UpdateOrgInput) error
+	Delete(ctx context.Context, id int64) error
+	// List returns every organization, oldest first
+	List(ctx context.Context) ([]Org, error)
+	// SlugTaken reports whether an organization or a user already has the name
+	SlugTaken(ctx context.Context, slug string) (bool, error)
+
+	AddMember(ctx context.Context, m *OrgMember) error
+	RemoveMember(ctx context.Context, orgID, userID int64) error
+	SetMemberRole(ctx context.Context, orgID, userID int64, role string) error
+	// MemberRole returns "" when the user is not a member
+	MemberRole(ctx context.Context, orgID, userID int64) (string, error)
+	// Members lists members with their user profile, owner and admins first
+	Members(ctx context.Context, orgID int64) ([]OrgMember, error)
+	MemberCount(ctx context.Context, orgID int64) (int, error)
+	// UserOrgs lists the organizations a user is a member of, by name
+	UserOrgs(ctx context.Context, userID int64) ([]Org, error)
+	// TransferOwnership makes newOwnerID the owner, and the old owner an admin
+	TransferOwnership(ctx context.Context, orgID, currentOwnerID, newOwnerID int64) error
+}
@@ -140,7 +140,7 @@ func (s *Service) HandleCreateOrg(w http.ResponseWriter, r *http.Request) error
 		Visibility:  req.Visibility,
 	}
 
-	newOrg, err := s.orgService.Create(input, authUser.ID)
+	newOrg, err := s.orgService.Create(r.Context(), input, authUser.ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, org.ErrInvalidSlug):
@@ -168,7 +168,7 @@ func (s *Service) HandleListOrgs(w http.ResponseWriter, r *http.Request) error {
 		return writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required")
 	}
 
-	orgs, err := s.orgService.GetUserOrgs(authUser.ID)
+	orgs, err := s.orgService.GetUserOrgs(r.Context(), authUser.ID)
 	if err != nil {
 		return writeError(w, r, http.StatusInternalServerError, "LIST_FAILED", "Failed to list organizations")
 	}
@@ -184,7 +184,7 @@ func (s *Service) HandleGetOrg(w http.ResponseWriter, r *http.Request, slug stri
 		return writeError(w, r, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
 	}
 
-	o, err := s.orgService.GetBySlug(slug)
+	o, err := s.orgService.GetBySlug(r.Context(), slug)
 	if err != nil {
 		if errors.Is(err, org.ErrOrgNotFound) {
 			return writeError(w, r, http.StatusNotFound, "ORG_NOT_FOUND", "Organization not found")
@@ -195,7 +195,7 @@ func (s *Service) HandleGetOrg(w http.ResponseWriter, r *http.Request, slug stri
 	// Check visibility
 	authUser := web.GetAuthUser(r.Context())
 	if o.Visibility == "private" {
-		if authUser == nil || !s.orgService.IsMember(o.ID, authUser.ID) {
+		if authUser == nil || !s.orgService.IsMember(r.Context(), o.ID, authUser.ID) {
 			return writeError(w, r, http.StatusNotFound, "ORG_NOT_FOUND", "Organization not found")
 		}
 	}
@@ -203,7 +203,7 @@ func (s *Service) HandleGetOrg(w http.ResponseWriter, r *http.Request, slug stri
 	// Get member role if authenticated
 	var memberRole string
 	if authUser != nil {
-		memberRole = s.orgService.GetMemberRole(o.ID, authUser.ID)
+		memberRole = s.orgService.GetMemberRole(r.Context(), o.ID, authUser.ID)
 	}
 
 	return writeSuccess(w, r, map[string]interface{}{
@@ -223,13 +223,13 @@ func (s *Service) HandleUpdateOrg(w http.ResponseWriter, r *http.Request, slug s
 		return writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required")
 	}
 
-	o, err := s.orgService.GetBySlug(slug)
+	o, err := s.orgService.GetBySlug(r.Context(), slug)
 	if err != nil {
 		return writeError(w, r, http.StatusNotFound, "ORG_NOT_FOUND", "Organization not found")
 	}
 
 	// Check permission (admin or owner)
-	role := s.orgService.GetMemberRole(o.ID, authUser.ID)
+	role := s.orgService.GetMemberRole(r.Context(), o.ID, authUser.ID)
 	if role != "owner" && role != "admin" {
 		return writeError(w, r, http.StatusForbidden, "FORBIDDEN", "You don't have permission to update this organization")
 	}
@@ -249,12 +249,12 @@ func (s *Service) HandleUpdateOrg(w http.ResponseWriter, r *http.Request, slug s
 		Email:       req.Email,
 	}
 
-	if err := s.orgService.Update(o.ID, input); err != nil {
+	if err := s.orgService.Update(r.Context(), o.ID, input); err != nil {
 		return writeError(w, r, http.StatusInternalServerError, "UPDATE_FAILED", "Failed to update organization")
 	}
 
 	// Get updated org
-	o, _ = s.orgService.GetBySlug(slug)
+	o, _ = s.orgService.GetBySlug(r.Context(), slug)
 
 	return writeSuccess(w, r, o, "Organization updated", "Organization updated successfully")
 }
@@ -270,7 +270,7 @@ func (s *Service) HandleDeleteOrg(w http.ResponseWriter, r *http.Request, slug s
 		return writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required")
 	}
 
-	o, err := s.orgService.GetBySlug(slug)
+	o, err := s.orgService.GetBySlug(r.Context(), slug)
 	if err != nil {
 		return writeError(w, r, http.StatusNotFound, "ORG_NOT_FOUND", "Organization not found")
 	}
@@ -280,7 +280,7 @@ func (s *Service) HandleDeleteOrg(w http.ResponseWriter, r *http.Request, slug s
 		return writeError(w, r, http.StatusForbidden, "FORBIDDEN", "Only the owner can delete this organization")
 	}
 
-	if err := s.orgService.Delete(o.ID); err != nil {
+	if err := s.orgService.Delete(r.Context(), o.ID); err != nil {
 		return writeError(w, r, http.StatusInternalServerError, "DELETE_FAILED", "Failed to delete organization")
 	}
 
@@ -293,7 +293,7 @@ func (s *Service) HandleGetMembers(w http.ResponseWriter, r *http.Request, slug
 		return writeError(w, r, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
 	}
 
-	o, err := s.orgService.GetBySlug(slug)
+	o, err := s.orgService.GetBySlug(r.Context(), slug)
 	if err != nil {
 		return writeError(w, r, http.StatusNotFound, "ORG_NOT_FOUND", "Organization not found")
 	}
@@ -301,12 +301,12 @@ func (s *Service) HandleGetMembers(w http.ResponseWriter, r *http.Request, slug
 	// Check visibility for private orgs
 	authUser := web.GetAuthUser(r.Context())
 	if o.Visibility == "private" {
-		if authUser == nil || !s.orgService.IsMember(o.ID, authUser.ID) {
+		if authUser == nil || !s.orgService.IsMember(r.Context(), o.ID, authUser.ID) {
 			return writeError(w, r, http.StatusNotFound, "ORG_NOT_FOUND", "Organization not found")
 		}
 	}
 
-	members, err := s.orgService.GetMembers(o.ID)
+	members, err := s.orgService.GetMembers(r.Context(), o.ID)
 	if err != nil {
 		return writeError(w, r, http.StatusInternalServerError, "LIST_FAILED", "Failed to list members")
 	}
@@ -327,13 +327,13 @@ func (s *Service) HandleAddMember(w http.ResponseWriter, r *http.Request, slug s
 		return writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required")
 	}
 
-	o, err := s.orgService.GetBySlug(slug)
+	o, err := s.orgService.GetBySlug(r.Context(), slug)
 	if err != nil {
 		return writeError(w, r, http.StatusNotFound, "ORG_NOT_FOUND", "Organization not found")
 	}
 
 	// Check permission (admin or owner)
-	role := s.orgService.GetMemberRole(o.ID, authUser.ID)
+	role := s.orgService.GetMemberRole(r.Context(), o.ID, authUser.ID)
 	if role != "owner" && role != "admin" {
 		return writeError(w, r, http.StatusForbidden, "FORBIDDEN", "You don't have permission to add members")
 	}
@@ -358,13 +358,13 @@ func (s *Service) HandleAddMember(w http.ResponseWriter, r *http.Request, slug s
 	}
 
 	// Get user by username
-	u, err := s.userService.GetByUsername(req.Username)
+	u, err := s.userService.GetByUsername(r.Context(), req.Username)
 	if err != nil {
 		return writeError(w, r, http.StatusNotFound, "USER_NOT_FOUND", "User not found")
 	}
 
 	// Add member
-	if err := s.orgService.AddMember(o.ID, u.ID, req.Role); err != nil {
+	if err := s.orgService.AddMember(r.Context(), o.ID, u.ID, req.Role); err != nil {
 		if errors.Is(err, org.ErrAlreadyMember) {
 			return writeError(w, r, http.StatusConflict, "ALREADY_MEMBER", "User is already a member")
 		}
@@ -388,7 +388,7 @@ func (s *Service) HandleUpdateMember(w http.ResponseWriter, r *http.Request, slu
 		return writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required")
 	}
 
-	o, err := s.orgService.GetBySlug(slug)
+	o, err := s.orgService.GetBySlug(r.Context(), slug)
 	if err != nil {
 		return writeError(w, r, http.StatusNotFound, "ORG_NOT_FOUND", "Organization not found")
 	}
@@ -408,7 +408,7 @@ func (s *Service) HandleUpdateMember(w http.ResponseWriter, r *http.Request, slu
 	}
 
 	// Get user
-	u, err := s.userService.GetByUsername(username)
+	u, err := s.userService.GetByUsername(r.Context(), username)
 	if err != nil {
 		return writeError(w, r, http.StatusNotFound, "USER_NOT_FOUND", "User not found")
 	}
@@ -419,7 +419,7 @@ func (s *Service) HandleUpdateMember(w http.ResponseWriter, r *http.Request, slu
 	}
 
 	// Update role
-	if err := s.orgService.UpdateMemberRole(o.ID, u.ID, req.Role); err != nil {
+	if err := s.orgService.UpdateMemberRole(r.Context(), o.ID, u.ID, req.Role); err != nil {
 		if errors.Is(err, org.ErrNotMember) {
 			return writeError(w, r, http.StatusNotFound, "NOT_MEMBER", "User is not a member")
 		}
@@ -443,20 +443,20 @@ func (s *Service) HandleRemoveMember(w http.ResponseWriter, r *http.Request, slu
 		return writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required")
 	}
 
-	o, err := s.orgService.GetBySlug(slug)
+	o, err := s.orgService.GetBySlug(r.Context(), slug)
 	if err != nil {
 		return writeError(w, r, http.StatusNotFound, "ORG_NOT_FOUND", "Organization not found")
 	}
 
 	// Get user to remove
-	u, err := s.userService.GetByUsername(username)
+	u, err := s.userService.GetByUsername(r.Context(), username)
 	if err != nil {
 		return writeError(w, r, http.StatusNotFound, "USER_NOT_FOUND", "User not found")
 	}
 
 	// Check permission
-	role := s.orgService.GetMemberRole(o.ID, authUser.ID)
-	targetRole := s.orgService.GetMemberRole(o.ID, u.ID)
+	role := s.orgService.GetMemberRole(r.Context(), o.ID, authUser.ID)
+	targetRole := s.orgService.GetMemberRole(r.Context(), o.ID, u.ID)
 
 	// Users can remove themselves
 	if u.ID == authUser.ID {
@@ -479,7 +479,7 @@ func (s *Service) HandleRemoveMember(w http.ResponseWriter, r *http.Request, slu
 		}
 	}
 
-	if err := s.orgService.RemoveMember(o.ID, u.ID); err != nil {
+	if err := s.orgService.RemoveMember(r.Context(), o.ID, u.ID); err != nil {
 		if errors.Is(err, org.ErrNotMember) {
 			return writeError(w, r, http.StatusNotFound, "NOT_MEMBER", "User is not a member")
 		}
@@ -500,7 +500,7 @@ func (s *Service) HandleTransferOwnership(w http.ResponseWriter, r *http.Request
 		return writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required")
 	}
 
-	o, err := s.orgService.GetBySlug(slug)
+	o, err := s.orgService.GetBySlug(r.Context(), slug)
 	if err != nil {
 		return writeError(w, r, http.StatusNotFound, "ORG_NOT_FOUND", "Organization not found")
 	}
@@ -522,17 +522,17 @@ func (s *Service) HandleTransferOwnership(w http.ResponseWriter, r *http.Request
 	}
 
 	// Get new owner
-	newOwner, err := s.userService.GetByUsername(req.Username)
+	newOwner, err := s.userService.GetByUsername(r.Context(), req.Username)
 	if err != nil {
 		return writeError(w, r, http.StatusNotFound, "USER_NOT_FOUND", "User not found")
 	}
 
 	// Must be a member
-	if !s.orgService.IsMember(o.ID, newOwner.ID) {
+	if !s.orgService.IsMember(r.Context(), o.ID, newOwner.ID) {
 		return writeError(w, r, http.StatusBadRequest, "NOT_MEMBER", "New owner must be a member of the organization")
 	}
 
-	if err := s.orgService.TransferOwnership(o.ID, authUser.ID, newOwner.ID); err != nil {
+	if err := s.orgService.TransferOwnership(r.Context(), o.ID, authUser.ID, newOwner.ID); err != nil {
 		return writeError(w, r, http.StatusInternalServerError, "TRANSFER_FAILED", "Failed to transfer ownership")
 	}
 
@@ -550,13 +550,13 @@ func (s *Service) HandleGetOrgSettings(w http.ResponseWriter, r *http.Request, s
 		return writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required")
 	}
 
-	o, err := s.orgService.GetBySlug(slug)
+	o, err := s.orgService.GetBySlug(r.Context(), slug)
 	if err != nil {
 		return writeError(w, r, http.StatusNotFound, "ORG_NOT_FOUND", "Organization not found")
 	}
 
 	// Check permission (admin or owner)
-	role := s.orgService.GetMemberRole(o.ID, authUser.ID)
+	role := s.orgService.GetMemberRole(r.Context(), o.ID, authUser.ID)
 	if role != "owner" && role != "admin" {
 		return writeError(w, r, http.StatusForbidden, "FORBIDDEN", "You don't have permission to view settings")
 	}
@@ -580,13 +580,13 @@ func (s *Service) HandleUpdateOrgSettings(w http.ResponseWriter, r *http.Request
 		return writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required")
 	}
 
-	o, err := s.orgService.GetBySlug(slug)
+	o, err := s.orgService.GetBySlug(r.Context(), slug)
 	if err != nil {
 		return writeError(w, r, http.StatusNotFound, "ORG_NOT_FOUND", "Organization not found")
 	}
 
 	// Check permission (admin or owner)
-	role := s.orgService.GetMemberRole(o.ID, authUser.ID)
+	role := s.orgService.GetMemberRole(r.Context(), o.ID, authUser.ID)
 	if role != "owner" && role != "admin" {
 		return writeError(w, r, http.StatusForbidden, "FORBIDDEN", "You don't have permission to update settings")
 	}
@@ -614,13 +614,13 @@ func (s *Service) HandleListOrgTokens(w http.ResponseWriter, r *http.Request, sl
 		return writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required")
 	}
 
-	o, err := s.orgService.GetBySlug(slug)
+	o, err := s.orgService.GetBySlug(r.Context(), slug)
 	if err != nil {
 		return writeError(w, r, http.StatusNotFound, "ORG_NOT_FOUND", "Organization not found")
 	}
 
 	// Check permission (admin or owner)
-	role := s.orgService.GetMemberRole(o.ID, authUser.ID)
+	role := s.orgService.GetMemberRole(r.Context(), o.ID, authUser.ID)
 	if role != "owner" && role != "admin" {
 		return writeError(w, r, http.StatusForbidden, "FORBIDDEN", "You don't have permission to view tokens")
 	}
@@ -646,13 +646,13 @@ func (s *Service) HandleCreateOrgToken(w http.ResponseWriter, r *http.Request, s
 		return writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required")
 	}
 
-	o, err := s.orgService.GetBySlug(slug)
+	o, err := s.orgService.GetBySlug(r.Context(), slug)
 	if err != nil {
 		return writeError(w, r, http.StatusNotFound, "ORG_NOT_FOUND", "Organization not found")
 	}
 
 	// Check permission (admin or owner)
-	role := s.orgService.GetMemberRole(o.ID, authUser.ID)
+	role := s.orgService.GetMemberRole(r.Context(), o.ID, authUser.ID)
 	if role != "owner" && role != "admin" {
 		return writeError(w, r, http.StatusForbidden, "FORBIDDEN", "You don't have permission to create tokens")
 	}
@@ -700,13 +700,13 @@ func (s *Service) HandleRevokeOrgToken(w http.ResponseWriter, r *http.Request, s
 		return writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required")
 	}
 
-	o, err := s.orgService.GetBySlug(slug)
+	o, err := s.orgService.GetBySlug(r.Context(), slug)
 	if err != nil {
 		return writeError(w, r, http.StatusNotFound, "ORG_NOT_FOUND", "Organization not found")
 	}
 
 	// Check permission (admin or owner)
-	role := s.orgService.GetMemberRole(o.ID, authUser.ID)
+	role := s.orgService.GetMemberRole(r.Context(), o.ID, authUser.ID)
 	if role != "owner" && role != "admin" {
 		return writeError(w, r, http.StatusForbidden, "FORBIDDEN", "You don't have permission to revoke tokens")
 	}
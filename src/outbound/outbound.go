@@ -0,0 +1,314 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+// Package outbound is how the server reaches other hosts: HTTP clients and
+// TCP connections that go through the configured proxy and trust the
+// configured CA certificates besides the system ones
+// Until Configure is called, the proxy comes from HTTPS_PROXY, HTTP_PROXY
+// and NO_PROXY, as for any Go program
+// In offline mode, features that reach the internet (public IP discovery,
+// update checks, ACME, telemetry, the directory, GeoIP downloads) check
+// Offline and stay off; connections to configured hosts such as the mail
+// server or a backup target are still made
+package outbound
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/net/proxy"
+
+	"github.com/casjay-forks/caspaste/src/cryptopolicy"
+)
+
+// ProxyNone connects directly, ignoring the proxy environment variables
+const ProxyNone = "none"
+
+// dialTimeout bounds connecting, through the proxy or not
+const dialTimeout = 30 * time.Second
+
+// ErrOffline is returned by features that reach the internet in offline mode
+var ErrOffline = errors.New("offline mode: internet access is turned off (network.offline)")
+
+// Config describes the proxy and CA certificates for outbound connections
+type Config struct {
+	// Proxy URL: http, https, socks5 or socks5h; "" uses the environment
+	// variables, ProxyNone connects directly
+	Proxy string
+	// Comma-separated hosts, domains and CIDRs reached without the proxy,
+	// as in NO_PROXY
+	NoProxy string
+	// PEM file of CA certificates trusted besides the system roots
+	CAFile string
+	// Turn off the features that reach the internet
+	Offline bool
+}
+
+// settings is what Configure sets up
+type settings struct {
+	proxy     func(*url.URL) (*url.URL, error)
+	roots     *x509.CertPool
+	transport *http.Transport
+	offline   bool
+}
+
+var (
+	mu      sync.RWMutex
+	current *settings
+)
+
+// Configure sets the proxy and CA certificates for every outbound
+// connection made after it returns
+func Configure(cfg Config) error {
+	s, err := newSettings(cfg)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	current = s
+	return nil
+}
+
+// Check reports whether Configure would accept cfg, without applying it
+func Check(cfg Config) error {
+	_, err := newSettings(cfg)
+	return err
+}
+
+func newSettings(cfg Config) (*settings, error) {
+	s := &settings{offline: cfg.Offline}
+	switch cfg.Proxy {
+	case "":
+		env := httpproxy.FromEnvironment()
+		if cfg.NoProxy != "" {
+			env.NoProxy = cfg.NoProxy
+		}
+		s.proxy = env.ProxyFunc()
+	case ProxyNone:
+	default:
+		if _, err := ParseProxy(cfg.Proxy); err != nil {
+			return nil, err
+		}
+		s.proxy = (&httpproxy.Config{HTTPProxy: cfg.Proxy, HTTPSProxy: cfg.Proxy, NoProxy: cfg.NoProxy}).ProxyFunc()
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("outbound: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("outbound: no PEM certificates in %s", cfg.CAFile)
+		}
+		s.roots = pool
+	}
+
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = nil
+	if s.proxy != nil {
+		t.Proxy = func(r *http.Request) (*url.URL, error) {
+			return s.proxy(r.URL)
+		}
+	}
+	t.TLSClientConfig = cryptopolicy.ApplyTLS(&tls.Config{RootCAs: s.roots})
+	s.transport = t
+	return s, nil
+}
+
+// ParseProxy checks a proxy URL
+func ParseProxy(value string) (*url.URL, error) {
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("outbound: proxy %q is not a URL such as http://proxy:3128 or socks5://proxy:1080", value)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+		return u, nil
+	}
+	return nil, fmt.Errorf("outbound: proxy scheme %q is not one of http, https, socks5, socks5h", u.Scheme)
+}
+
+// get returns the settings, made from the environment if Configure was not called
+func get() *settings {
+	mu.RLock()
+	s := current
+	mu.RUnlock()
+	if s != nil {
+		return s
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if current == nil {
+		current, _ = newSettings(Config{})
+	}
+	return current
+}
+
+// Offline reports whether features that reach the internet are turned off
+func Offline() bool {
+	return get().offline
+}
+
+// Transport returns the shared transport for outbound HTTP requests
+func Transport() *http.Transport {
+	return get().transport
+}
+
+// Client returns an HTTP client on the shared transport; 0 = no timeout
+func Client(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: Transport()}
+}
+
+// TLSConfig returns a TLS config for serverName that trusts the configured
+// CA certificates, for protocols other than HTTP
+func TLSConfig(serverName string) *tls.Config {
+	return cryptopolicy.ApplyTLS(&tls.Config{ServerName: serverName, RootCAs: get().roots})
+}
+
+// DialContext opens a TCP connection to addr, as host:port, through the
+// proxy: SOCKS5, or an HTTP CONNECT tunnel, which proxies may only allow to
+// some ports
+func DialContext(ctx context.Context, addr string) (net.Conn, error) {
+	s := get()
+	var proxyURL *url.URL
+	if s.proxy != nil {
+		// The proxy is chosen as for an HTTPS request, which is what a
+		// tunnel is
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if proxyURL, err = s.proxy(&url.URL{Scheme: "https", Host: host}); err != nil {
+			return nil, err
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	if proxyURL == nil {
+		return dialer.DialContext(ctx, "tcp", addr)
+	}
+	switch proxyURL.Scheme {
+	case "socks5", "socks5h":
+		return dialSOCKS(ctx, dialer, proxyURL, addr)
+	case "http", "https":
+		return dialTunnel(ctx, dialer, s, proxyURL, addr)
+	}
+	return nil, fmt.Errorf("outbound: proxy scheme %q is not supported", proxyURL.Scheme)
+}
+
+// Dial is DialContext with a timeout
+func Dial(addr string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return DialContext(ctx, addr)
+}
+
+func dialSOCKS(ctx context.Context, dialer *net.Dialer, proxyURL *url.URL, addr string) (net.Conn, error) {
+	var auth *proxy.Auth
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		auth = &proxy.Auth{User: proxyURL.User.Username(), Password: password}
+	}
+	socks, err := proxy.SOCKS5("tcp", proxyAddr(proxyURL, "1080"), auth, dialer)
+	if err != nil {
+		return nil, fmt.Errorf("outbound: %w", err)
+	}
+	conn, err := socks.(proxy.ContextDialer).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("outbound: proxy %s: %w", proxyURL.Host, err)
+	}
+	return conn, nil
+}
+
+// dialTunnel asks an HTTP proxy to CONNECT to addr
+func dialTunnel(ctx context.Context, dialer *net.Dialer, s *settings, proxyURL *url.URL, addr string) (net.Conn, error) {
+	defaultPort := "80"
+	if proxyURL.Scheme == "https" {
+		defaultPort = "443"
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", proxyAddr(proxyURL, defaultPort))
+	if err != nil {
+		return nil, fmt.Errorf("outbound: proxy %s: %w", proxyURL.Host, err)
+	}
+	if proxyURL.Scheme == "https" {
+		conn = tls.Client(conn, cryptopolicy.ApplyTLS(&tls.Config{ServerName: proxyURL.Hostname(), RootCAs: s.roots}))
+	}
+
+	deadline := time.Now().Add(dialTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		credentials := proxyURL.User.Username() + ":" + password
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)))
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("outbound: proxy %s: %w", proxyURL.Host, err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("outbound: proxy %s: %w", proxyURL.Host, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("outbound: proxy %s refused the tunnel to %s: %s", proxyURL.Host, addr, resp.Status)
+	}
+
+	conn.SetDeadline(time.Time{})
+	if br.Buffered() > 0 {
+		// The server spoke first and its bytes were read with the reply
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn reads what was buffered while reading the proxy's reply first
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// proxyAddr is the host:port of a proxy URL
+func proxyAddr(u *url.URL, defaultPort string) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	return net.JoinHostPort(u.Hostname(), defaultPort)
+}
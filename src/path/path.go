@@ -10,6 +10,8 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+
+	"github.com/casjay-forks/caspaste/src/privilege"
 )
 
 const (
@@ -17,9 +19,26 @@ const (
 	projectName = "caspaste"
 )
 
-// IsRoot returns true if running as root/Administrator
+// IsRoot returns true if running as root/Administrator. On Windows this
+// selects the machine-wide ProgramData directories over the per-user ones.
 func IsRoot() bool {
-	return os.Geteuid() == 0
+	return privilege.IsAdmin()
+}
+
+// windowsDir returns a Windows folder from its environment variable, falling
+// back to the default location so paths are never relative
+func windowsDir(env string) string {
+	if dir := os.Getenv(env); dir != "" {
+		return dir
+	}
+	if env == "ProgramData" {
+		return `C:\ProgramData`
+	}
+	home, _ := os.UserHomeDir()
+	if env == "APPDATA" {
+		return filepath.Join(home, "AppData", "Roaming")
+	}
+	return filepath.Join(home, "AppData", "Local")
 }
 
 // IsDocker returns true if running inside a Docker container
@@ -40,9 +59,9 @@ func ConfigDir() string {
 	switch runtime.GOOS {
 	case "windows":
 		if IsRoot() {
-			return filepath.Join(os.Getenv("ProgramData"), projectOrg, projectName)
+			return filepath.Join(windowsDir("ProgramData"), projectOrg, projectName)
 		}
-		return filepath.Join(os.Getenv("APPDATA"), projectOrg, projectName)
+		return filepath.Join(windowsDir("APPDATA"), projectOrg, projectName)
 	case "darwin":
 		if IsRoot() {
 			return filepath.Join("/Library/Application Support", projectOrg, projectName)
@@ -69,9 +88,9 @@ func DataDir() string {
 	switch runtime.GOOS {
 	case "windows":
 		if IsRoot() {
-			return filepath.Join(os.Getenv("ProgramData"), projectOrg, projectName, "data")
+			return filepath.Join(windowsDir("ProgramData"), projectOrg, projectName, "data")
 		}
-		return filepath.Join(os.Getenv("LOCALAPPDATA"), projectOrg, projectName)
+		return filepath.Join(windowsDir("LOCALAPPDATA"), projectOrg, projectName)
 	case "darwin":
 		if IsRoot() {
 			return filepath.Join("/Library/Application Support", projectOrg, projectName, "data")
@@ -98,9 +117,9 @@ func CacheDir() string {
 	switch runtime.GOOS {
 	case "windows":
 		if IsRoot() {
-			return filepath.Join(os.Getenv("ProgramData"), projectOrg, projectName, "cache")
+			return filepath.Join(windowsDir("ProgramData"), projectOrg, projectName, "cache")
 		}
-		return filepath.Join(os.Getenv("LOCALAPPDATA"), projectOrg, projectName, "cache")
+		return filepath.Join(windowsDir("LOCALAPPDATA"), projectOrg, projectName, "cache")
 	case "darwin":
 		if IsRoot() {
 			return filepath.Join("/Library/Caches", projectOrg, projectName)
@@ -127,9 +146,9 @@ func LogDir() string {
 	switch runtime.GOOS {
 	case "windows":
 		if IsRoot() {
-			return filepath.Join(os.Getenv("ProgramData"), projectOrg, projectName, "logs")
+			return filepath.Join(windowsDir("ProgramData"), projectOrg, projectName, "logs")
 		}
-		return filepath.Join(os.Getenv("LOCALAPPDATA"), projectOrg, projectName, "logs")
+		return filepath.Join(windowsDir("LOCALAPPDATA"), projectOrg, projectName, "logs")
 	case "darwin":
 		if IsRoot() {
 			return filepath.Join("/Library/Logs", projectOrg, projectName)
@@ -156,9 +175,9 @@ func BackupDir() string {
 	switch runtime.GOOS {
 	case "windows":
 		if IsRoot() {
-			return filepath.Join(os.Getenv("ProgramData"), "Backups", projectOrg, projectName)
+			return filepath.Join(windowsDir("ProgramData"), "Backups", projectOrg, projectName)
 		}
-		return filepath.Join(os.Getenv("LOCALAPPDATA"), "Backups", projectOrg, projectName)
+		return filepath.Join(windowsDir("LOCALAPPDATA"), "Backups", projectOrg, projectName)
 	case "darwin":
 		if IsRoot() {
 			return filepath.Join("/Library/Backups", projectOrg, projectName)
@@ -185,9 +204,9 @@ func DbDir() string {
 	switch runtime.GOOS {
 	case "windows":
 		if IsRoot() {
-			return filepath.Join(os.Getenv("ProgramData"), projectOrg, projectName, "db")
+			return filepath.Join(windowsDir("ProgramData"), projectOrg, projectName, "db")
 		}
-		return filepath.Join(os.Getenv("LOCALAPPDATA"), projectOrg, projectName, "db")
+		return filepath.Join(windowsDir("LOCALAPPDATA"), projectOrg, projectName, "db")
 	case "darwin":
 		if IsRoot() {
 			return filepath.Join("/Library/Application Support", projectOrg, projectName, "db")
@@ -214,9 +233,9 @@ func SSLDir() string {
 	switch runtime.GOOS {
 	case "windows":
 		if IsRoot() {
-			return filepath.Join(os.Getenv("ProgramData"), projectOrg, projectName, "ssl")
+			return filepath.Join(windowsDir("ProgramData"), projectOrg, projectName, "ssl")
 		}
-		return filepath.Join(os.Getenv("APPDATA"), projectOrg, projectName, "ssl")
+		return filepath.Join(windowsDir("APPDATA"), projectOrg, projectName, "ssl")
 	case "darwin":
 		if IsRoot() {
 			return filepath.Join("/Library/Application Support", projectOrg, projectName, "ssl")
@@ -243,9 +262,9 @@ func SecurityDir() string {
 	switch runtime.GOOS {
 	case "windows":
 		if IsRoot() {
-			return filepath.Join(os.Getenv("ProgramData"), projectOrg, projectName, "security")
+			return filepath.Join(windowsDir("ProgramData"), projectOrg, projectName, "security")
 		}
-		return filepath.Join(os.Getenv("APPDATA"), projectOrg, projectName, "security")
+		return filepath.Join(windowsDir("APPDATA"), projectOrg, projectName, "security")
 	case "darwin":
 		if IsRoot() {
 			return filepath.Join("/Library/Application Support", projectOrg, projectName, "security")
@@ -306,7 +325,7 @@ func BinaryDir() string {
 		if IsRoot() {
 			return filepath.Join(os.Getenv("ProgramFiles"), projectOrg, projectName)
 		}
-		return filepath.Join(os.Getenv("LOCALAPPDATA"), projectOrg, projectName)
+		return filepath.Join(windowsDir("LOCALAPPDATA"), projectOrg, projectName)
 	default:
 		// Linux, macOS, BSD
 		if IsRoot() {
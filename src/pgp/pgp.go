@@ -0,0 +1,528 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+// Package pgp checks detached OpenPGP signatures (RFC 4880) on pastes
+// Only what that needs is here: v4 RSA and Ed25519 public keys, v4
+// signatures over binary or text documents with SHA-2 hashes, and ASCII armor
+package pgp
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidKey       = errors.New("pgp: not a valid public key")
+	ErrInvalidSignature = errors.New("pgp: not a valid detached signature")
+	ErrUnsupported      = errors.New("pgp: unsupported key or signature algorithm")
+	ErrWrongKey         = errors.New("pgp: signature was made by another key")
+	ErrBadSignature     = errors.New("pgp: signature does not match the content")
+)
+
+// Packet tags
+const (
+	tagSignature = 2
+	tagPublicKey = 6
+	tagUserID    = 13
+	tagSubkey    = 14
+)
+
+// Public key algorithms
+const (
+	algoRSA         = 1
+	algoRSASignOnly = 3
+	algoEdDSA       = 22
+	algoEd25519     = 27
+)
+
+// oidEd25519 is the curve OID of legacy EdDSA keys
+var oidEd25519 = []byte{0x2b, 0x06, 0x01, 0x04, 0x01, 0xda, 0x47, 0x0f, 0x01}
+
+var hashes = map[byte]crypto.Hash{
+	8:  crypto.SHA256,
+	9:  crypto.SHA384,
+	10: crypto.SHA512,
+	11: crypto.SHA224,
+}
+
+// Key is a public key with its subkeys
+type Key struct {
+	// Hex fingerprint of the primary key
+	Fingerprint string
+	// User IDs, e.g. "Jane Doe <jane@example.com>"
+	UserIDs []string
+	// Creation time of the primary key
+	Created time.Time
+
+	// Primary key first; keys that cannot sign are skipped
+	keys []publicKey
+	// Key IDs of the primary key and every subkey
+	keyIDs []string
+}
+
+type publicKey struct {
+	fingerprint string
+	algo        byte
+	rsa         *rsa.PublicKey
+	ed25519     ed25519.PublicKey
+}
+
+// Signature is a detached signature
+type Signature struct {
+	// Creation time, zero if the signature does not say
+	Created time.Time
+	// Hex fingerprint of the signing key, empty if the signature only has
+	// its key ID
+	IssuerFingerprint string
+	// Hex key ID of the signing key, empty if the signature does not say
+	IssuerKeyID string
+
+	sigType  byte
+	algo     byte
+	hash     crypto.Hash
+	hashed   []byte
+	hashLeft []byte
+	// RSA: one value; EdDSA: R and S
+	values [][]byte
+}
+
+// ParseKey reads an armored or binary public key
+func ParseKey(data []byte) (*Key, error) {
+	packets, err := readPackets(decode(data, "PUBLIC KEY BLOCK"), ErrInvalidKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(packets) == 0 || packets[0].tag != tagPublicKey {
+		return nil, ErrInvalidKey
+	}
+
+	key := &Key{}
+	for _, p := range packets {
+		switch p.tag {
+		case tagPublicKey, tagSubkey:
+			if p.tag == tagPublicKey && key.Fingerprint != "" {
+				// A second key in the block
+				return nil, ErrInvalidKey
+			}
+			pub, created, err := parsePublicKey(p.body)
+			if err != nil && p.tag == tagPublicKey {
+				return nil, err
+			}
+			if p.tag == tagPublicKey {
+				key.Fingerprint = pub.fingerprint
+				key.Created = created
+			}
+			if pub.fingerprint != "" {
+				key.keyIDs = append(key.keyIDs, keyID(pub.fingerprint))
+			}
+			if err == nil && (pub.rsa != nil || pub.ed25519 != nil) {
+				key.keys = append(key.keys, pub)
+			}
+		case tagUserID:
+			key.UserIDs = append(key.UserIDs, string(p.body))
+		}
+	}
+	if len(key.keys) == 0 {
+		return nil, ErrUnsupported
+	}
+	return key, nil
+}
+
+// KeyIDs returns the hex key IDs of the primary key and its subkeys
+func (key *Key) KeyIDs() []string {
+	return append([]string{}, key.keyIDs...)
+}
+
+// ParseSignature reads an armored or binary detached signature
+func ParseSignature(data []byte) (*Signature, error) {
+	packets, err := readPackets(decode(data, "SIGNATURE"), ErrInvalidSignature)
+	if err != nil {
+		return nil, err
+	}
+	if len(packets) != 1 || packets[0].tag != tagSignature {
+		return nil, ErrInvalidSignature
+	}
+	return parseSignature(packets[0].body)
+}
+
+// Verify checks that sig was made over data by this key or one of its subkeys
+func (key *Key) Verify(data []byte, sig *Signature) error {
+	candidates := key.keys
+	if sig.IssuerFingerprint != "" || sig.IssuerKeyID != "" {
+		candidates = nil
+		for _, pub := range key.keys {
+			if pub.fingerprint == sig.IssuerFingerprint || keyID(pub.fingerprint) == sig.IssuerKeyID {
+				candidates = append(candidates, pub)
+			}
+		}
+		if len(candidates) == 0 {
+			return ErrWrongKey
+		}
+	}
+
+	digest := sig.digest(data)
+	if !bytes.Equal(digest[:2], sig.hashLeft) {
+		return ErrBadSignature
+	}
+	for _, pub := range candidates {
+		if pub.algo == sig.algo && pub.verify(sig, digest) {
+			return nil
+		}
+	}
+	return ErrBadSignature
+}
+
+func (pub publicKey) verify(sig *Signature, digest []byte) bool {
+	switch pub.algo {
+	case algoRSA, algoRSASignOnly:
+		if len(sig.values) != 1 {
+			return false
+		}
+		return rsa.VerifyPKCS1v15(pub.rsa, sig.hash, digest, leftPad(sig.values[0], pub.rsa.Size())) == nil
+	case algoEdDSA, algoEd25519:
+		if len(sig.values) != 2 || len(sig.values[0]) > 32 || len(sig.values[1]) > 32 {
+			return false
+		}
+		return ed25519.Verify(pub.ed25519, digest, append(leftPad(sig.values[0], 32), leftPad(sig.values[1], 32)...))
+	}
+	return false
+}
+
+// digest hashes data the way the signature says it was signed
+func (sig *Signature) digest(data []byte) []byte {
+	if sig.sigType == 0x01 {
+		data = canonicalText(data)
+	}
+	h := sig.hash.New()
+	h.Write(data)
+	h.Write(sig.hashed)
+	trailer := []byte{0x04, 0xff, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(trailer[2:], uint32(len(sig.hashed)))
+	h.Write(trailer)
+	return h.Sum(nil)
+}
+
+func parsePublicKey(body []byte) (publicKey, time.Time, error) {
+	var pub publicKey
+	if len(body) < 6 || body[0] != 4 {
+		return pub, time.Time{}, ErrUnsupported
+	}
+
+	// v4 fingerprint: SHA-1 of 0x99, the two-byte length and the body
+	h := sha1.New()
+	h.Write([]byte{0x99, byte(len(body) >> 8), byte(len(body))})
+	h.Write(body)
+	pub.fingerprint = strings.ToUpper(hex.EncodeToString(h.Sum(nil)))
+
+	created := time.Unix(int64(binary.BigEndian.Uint32(body[1:5])), 0).UTC()
+	pub.algo = body[5]
+	r := reader{data: body[6:]}
+
+	switch pub.algo {
+	case algoRSA, algoRSASignOnly:
+		n, e := r.mpi(), r.mpi()
+		if r.err || len(e) > 4 {
+			return pub, created, ErrInvalidKey
+		}
+		pub.rsa = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	case algoEdDSA:
+		oid := r.bytes(int(r.byte()))
+		point := r.mpi()
+		if r.err {
+			return pub, created, ErrInvalidKey
+		}
+		if !bytes.Equal(oid, oidEd25519) {
+			return pub, created, ErrUnsupported
+		}
+		if len(point) != 33 || point[0] != 0x40 {
+			return pub, created, ErrInvalidKey
+		}
+		pub.ed25519 = ed25519.PublicKey(point[1:])
+	case algoEd25519:
+		point := r.bytes(ed25519.PublicKeySize)
+		if r.err {
+			return pub, created, ErrInvalidKey
+		}
+		pub.ed25519 = ed25519.PublicKey(point)
+	default:
+		return pub, created, ErrUnsupported
+	}
+	return pub, created, nil
+}
+
+func parseSignature(body []byte) (*Signature, error) {
+	if len(body) < 1 || body[0] != 4 {
+		return nil, ErrUnsupported
+	}
+	r := reader{data: body[1:]}
+	sig := &Signature{sigType: r.byte(), algo: r.byte()}
+	hashAlgo := r.byte()
+	hashedLen := int(r.uint16())
+	hashedArea := r.bytes(hashedLen)
+	unhashedArea := r.bytes(int(r.uint16()))
+	sig.hashLeft = r.bytes(2)
+	if r.err {
+		return nil, ErrInvalidSignature
+	}
+	sig.hashed = body[:6+hashedLen]
+
+	// Only signatures of a document, binary (0x00) or text (0x01)
+	if sig.sigType > 0x01 {
+		return nil, ErrInvalidSignature
+	}
+	hash, ok := hashes[hashAlgo]
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	sig.hash = hash
+
+	switch sig.algo {
+	case algoRSA, algoRSASignOnly:
+		sig.values = [][]byte{r.mpi()}
+	case algoEdDSA:
+		sig.values = [][]byte{r.mpi(), r.mpi()}
+	case algoEd25519:
+		raw := r.bytes(ed25519.SignatureSize)
+		sig.values = [][]byte{raw[:32:32], raw[32:]}
+	default:
+		return nil, ErrUnsupported
+	}
+	if r.err {
+		return nil, ErrInvalidSignature
+	}
+
+	for _, area := range [][]byte{hashedArea, unhashedArea} {
+		if err := sig.readSubpackets(area); err != nil {
+			return nil, err
+		}
+	}
+	if sig.IssuerFingerprint != "" && sig.IssuerKeyID == "" {
+		sig.IssuerKeyID = keyID(sig.IssuerFingerprint)
+	}
+	return sig, nil
+}
+
+// readSubpackets takes the creation time and issuer from a subpacket area
+func (sig *Signature) readSubpackets(area []byte) error {
+	r := reader{data: area}
+	for len(r.data) > 0 && !r.err {
+		var n int
+		switch first := int(r.byte()); {
+		case first < 192:
+			n = first
+		case first < 255:
+			n = (first-192)<<8 + int(r.byte()) + 192
+		default:
+			n = int(r.uint32())
+		}
+		sub := r.bytes(n)
+		if r.err || len(sub) == 0 {
+			return ErrInvalidSignature
+		}
+		switch kind, value := sub[0]&0x7f, sub[1:]; {
+		case kind == 2 && len(value) == 4:
+			sig.Created = time.Unix(int64(binary.BigEndian.Uint32(value)), 0).UTC()
+		case kind == 16 && len(value) == 8:
+			sig.IssuerKeyID = strings.ToUpper(hex.EncodeToString(value))
+		case kind == 33 && len(value) == 21 && value[0] == 4:
+			sig.IssuerFingerprint = strings.ToUpper(hex.EncodeToString(value[1:]))
+		}
+	}
+	if r.err {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+type packet struct {
+	tag  byte
+	body []byte
+}
+
+// readPackets splits an OpenPGP message into packets
+func readPackets(data []byte, invalid error) ([]packet, error) {
+	var packets []packet
+	r := reader{data: data}
+	for len(r.data) > 0 {
+		header := r.byte()
+		if header&0x80 == 0 {
+			return nil, invalid
+		}
+
+		var p packet
+		if header&0x40 == 0 {
+			// Old format: tag and length type in the header
+			p.tag = (header >> 2) & 0x0f
+			switch header & 0x03 {
+			case 0:
+				p.body = r.bytes(int(r.byte()))
+			case 1:
+				p.body = r.bytes(int(r.uint16()))
+			case 2:
+				p.body = r.bytes(int(r.uint32()))
+			default:
+				p.body = r.bytes(len(r.data))
+			}
+		} else {
+			// New format, possibly in partial lengths
+			p.tag = header & 0x3f
+			for {
+				first := int(r.byte())
+				if first >= 224 && first < 255 {
+					p.body = append(p.body, r.bytes(1<<(first&0x1f))...)
+					if r.err {
+						break
+					}
+					continue
+				}
+				var n int
+				switch {
+				case first < 192:
+					n = first
+				case first < 224:
+					n = (first-192)<<8 + int(r.byte()) + 192
+				default:
+					n = int(r.uint32())
+				}
+				p.body = append(p.body, r.bytes(n)...)
+				break
+			}
+		}
+		if r.err {
+			return nil, invalid
+		}
+		packets = append(packets, p)
+	}
+	return packets, nil
+}
+
+// decode returns the binary of an armored block of the given type, or data
+// itself when it is not armored
+func decode(data []byte, blockType string) []byte {
+	begin := "-----BEGIN PGP " + blockType + "-----"
+	text := string(data)
+	start := strings.Index(text, begin)
+	if start < 0 {
+		return data
+	}
+	text = text[start+len(begin):]
+	if end := strings.Index(text, "-----END PGP "+blockType+"-----"); end >= 0 {
+		text = text[:end]
+	}
+
+	var b64 strings.Builder
+	var checksum string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "", strings.Contains(line, ": "):
+			// Blank lines and armor headers
+		case strings.HasPrefix(line, "=") && len(line) == 5:
+			checksum = line[1:]
+		default:
+			b64.WriteString(line)
+		}
+	}
+	bin, err := base64.StdEncoding.DecodeString(b64.String())
+	if err != nil {
+		return nil
+	}
+	if checksum != "" {
+		sum, err := base64.StdEncoding.DecodeString(checksum)
+		if err != nil || len(sum) != 3 || crc24(bin) != uint32(sum[0])<<16|uint32(sum[1])<<8|uint32(sum[2]) {
+			return nil
+		}
+	}
+	return bin
+}
+
+// crc24 is the armor checksum
+func crc24(data []byte) uint32 {
+	crc := uint32(0xb704ce)
+	for _, b := range data {
+		crc ^= uint32(b) << 16
+		for i := 0; i < 8; i++ {
+			crc <<= 1
+			if crc&0x1000000 != 0 {
+				crc ^= 0x1864cfb
+			}
+		}
+	}
+	return crc & 0xffffff
+}
+
+// canonicalText converts line endings to CRLF, as text signatures are made
+func canonicalText(data []byte) []byte {
+	var out bytes.Buffer
+	for i, b := range data {
+		if b == '\n' && (i == 0 || data[i-1] != '\r') {
+			out.WriteByte('\r')
+		}
+		out.WriteByte(b)
+	}
+	return out.Bytes()
+}
+
+func keyID(fingerprint string) string {
+	if len(fingerprint) < 16 {
+		return ""
+	}
+	return fingerprint[len(fingerprint)-16:]
+}
+
+func leftPad(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+	return append(make([]byte, size-len(b)), b...)
+}
+
+// reader reads big-endian fields; err is set once it runs out of data
+type reader struct {
+	data []byte
+	err  bool
+}
+
+func (r *reader) bytes(n int) []byte {
+	if n < 0 || n > len(r.data) {
+		// Zeros, so fixed-size reads after the end need no checks
+		r.err = true
+		r.data = nil
+		return make([]byte, min(max(n, 0), ed25519.SignatureSize))
+	}
+	b := r.data[:n:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *reader) byte() byte {
+	return r.bytes(1)[0]
+}
+
+func (r *reader) uint16() uint16 {
+	return binary.BigEndian.Uint16(r.bytes(2))
+}
+
+func (r *reader) uint32() uint32 {
+	return binary.BigEndian.Uint32(r.bytes(4))
+}
+
+// mpi reads a multiprecision integer: a bit count, then the bytes
+func (r *reader) mpi() []byte {
+	bits := int(r.uint16())
+	return r.bytes((bits + 7) / 8)
+}
@@ -0,0 +1,17 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+//go:build !windows
+// +build !windows
+
+package privilege
+
+import "os"
+
+// IsAdmin returns true if running as root
+func IsAdmin() bool {
+	return os.Geteuid() == 0
+}
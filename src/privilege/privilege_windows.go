@@ -9,11 +9,19 @@
 
 package privilege
 
+import "golang.org/x/sys/windows"
+
 const (
 	CasPasteUser  = "CasPaste"
 	CasPasteGroup = "CasPaste"
 )
 
+// IsAdmin returns true if the process token is elevated, which includes
+// services running as LocalSystem
+func IsAdmin() bool {
+	return windows.GetCurrentProcessToken().IsElevated()
+}
+
 // EnsureUser - Windows doesn't support privilege dropping in the same way
 // User creation should be done via Windows Computer Management or net user command
 func EnsureUser() (int, int, error) {
@@ -21,6 +21,14 @@ type Data struct {
 	RateLimitGet *netshare.RateLimitSystem
 
 	Version string
+
+	// X-Robots-Tag for raw paste responses (empty = none)
+	RobotsTag string
+}
+
+// db binds the storage to a request, so its queries stop when the client goes away
+func (data *Data) db(req *http.Request) storage.DB {
+	return data.DB.WithContext(req.Context())
 }
 
 func Load(db storage.DB, cfg config.Config) *Data {
@@ -29,11 +37,15 @@ func Load(db storage.DB, cfg config.Config) *Data {
 		Log:          cfg.Log,
 		RateLimitGet: cfg.RateLimitGet,
 		Version:      cfg.Version,
+		RobotsTag:    cfg.SiteRobotsPasteTag,
 	}
 }
 
 func (data *Data) Hand(rw http.ResponseWriter, req *http.Request) {
 	rw.Header().Set("Server", config.Software+"/"+data.Version)
+	if data.RobotsTag != "" {
+		rw.Header().Set("X-Robots-Tag", data.RobotsTag)
+	}
 
 	err := data.rawHand(rw, req)
 
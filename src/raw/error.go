@@ -31,6 +31,11 @@ func (data *Data) writeError(rw http.ResponseWriter, req *http.Request, e error)
 		errText = "429 Too Many Requests"
 		rw.Header().Set("Retry-After", strconv.FormatInt(eTmp429.RetryAfter, 10))
 
+	} else if errors.Is(e, storage.ErrUnavailable) {
+		errCode = 503
+		errText = "503 Service Unavailable"
+		rw.Header().Set("Retry-After", strconv.Itoa(data.DB.Breaker().RetryAfter()))
+
 	} else {
 		errCode = 500
 		errText = "500 Internal Server Error"
@@ -7,11 +7,13 @@
 package raw
 
 import (
+	"crypto/sha256"
 	"encoding/base64"
-	"io"
+	"encoding/hex"
 	"net/http"
 
 	"github.com/casjay-forks/caspaste/src/netshare"
+	"github.com/casjay-forks/caspaste/src/storage"
 )
 
 // Pattern: /raw/
@@ -25,48 +27,65 @@ func (data *Data) rawHand(rw http.ResponseWriter, req *http.Request) error {
 	// Read DB
 	pasteID := string([]rune(req.URL.Path)[5:])
 
-	paste, err := data.DB.PasteGet(pasteID)
+	paste, err := data.db(req).PasteGet(pasteID)
 	if err != nil {
 		return err
 	}
 
-	// If "one use" paste
+	// If "one use" paste, count the view (deleted after the last one)
 	if paste.OneUse {
-		// Delete paste
-		err = data.DB.PasteDelete(pasteID)
+		paste.ViewsLeft, err = data.db(req).PasteView(pasteID)
 		if err != nil {
 			return err
 		}
 	}
 
+	return WritePaste(rw, paste)
+}
+
+// WritePaste writes the body of a paste as /raw/ serves it
+func WritePaste(rw http.ResponseWriter, paste storage.Paste) error {
+	content := Content(paste)
+	SetDigest(rw.Header(), content)
+
 	// Write result based on whether this is a file or regular paste
 	if paste.IsFile {
-		// File upload: try to decode base64, fall back to raw for legacy data
-		var fileContent []byte
-		fileData, err := base64.StdEncoding.DecodeString(paste.Body)
-		if err != nil {
-			// Legacy data stored without base64 encoding - use as-is
-			fileContent = []byte(paste.Body)
-		} else {
-			fileContent = fileData
-		}
 		contentType := paste.MimeType
 		if contentType == "" {
 			contentType = "application/octet-stream"
 		}
 		rw.Header().Set("Content-Type", contentType)
-		_, err = rw.Write(fileContent)
-		if err != nil {
-			return err
-		}
 	} else {
 		// Regular paste: serve as plain text
-		rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		_, err = io.WriteString(rw, paste.Body)
-		if err != nil {
-			return err
+		// An encrypted body is served as stored; only the key holder can read it
+		if paste.Encrypted {
+			rw.Header().Set("X-Robots-Tag", "noindex, nofollow")
 		}
+		rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	}
 
-	return nil
+	_, err := rw.Write(content)
+	return err
+}
+
+// Content returns the bytes /raw/ serves for a paste
+func Content(paste storage.Paste) []byte {
+	return netshare.PasteContent(paste)
+}
+
+// Digest returns the hex SHA-256 of content, as /api/v1/pastes/{id}/verify
+// reports it
+func Digest(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// SetDigest sets the SHA-256 of content in the Repr-Digest header (RFC 9530)
+// and, for older clients, the Digest header (RFC 3230), so a client can tell
+// a corrupted or truncated download
+func SetDigest(h http.Header, content []byte) {
+	sum := sha256.Sum256(content)
+	b64 := base64.StdEncoding.EncodeToString(sum[:])
+	h.Set("Repr-Digest", "sha-256=:"+b64+":")
+	h.Set("Digest", "sha-256="+b64)
 }
@@ -0,0 +1,199 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+// Package redact masks sensitive values (IPs, emails, tokens) in paste content
+// before it is stored
+package redact
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultReplacement is used when no replacement is configured; {name} is the rule name
+const DefaultReplacement = "[REDACTED:{name}]"
+
+// builtin describes a predefined rule; validate filters out false positives
+type builtin struct {
+	pattern  string
+	validate func(string) bool
+}
+
+// Builtins are the predefined rules that can be enabled by name
+var Builtins = map[string]builtin{
+	"private_key":    {pattern: `-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`},
+	"jwt":            {pattern: `\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`},
+	"bearer_token":   {pattern: `(?i)\bbearer\s+[A-Za-z0-9._~+/-]{8,}=*`},
+	"aws_access_key": {pattern: `\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`},
+	"github_token":   {pattern: `\b(?:gh[pousr]_[A-Za-z0-9]{36,255}|github_pat_[A-Za-z0-9_]{22,255})\b`},
+	"slack_token":    {pattern: `\bxox[abprs]-[A-Za-z0-9-]{10,}\b`},
+	"email":          {pattern: `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`},
+	"ipv4":           {pattern: `\b(?:\d{1,3}\.){3}\d{1,3}\b`, validate: validIP},
+	"ipv6":           {pattern: `(?i)[0-9a-f]{0,4}(?::[0-9a-f]{0,4}){2,7}(?:%[0-9a-z]+)?`, validate: validIPv6},
+}
+
+// DefaultBuiltins is the order builtins are applied in; secrets that contain
+// other matches (keys, tokens) run before emails and IPs
+var DefaultBuiltins = []string{
+	"private_key", "jwt", "bearer_token", "aws_access_key", "github_token", "slack_token",
+	"email", "ipv4", "ipv6",
+}
+
+func validIP(s string) bool {
+	return net.ParseIP(s) != nil
+}
+
+func validIPv6(s string) bool {
+	if i := strings.IndexByte(s, '%'); i >= 0 {
+		s = s[:i]
+	}
+	return strings.Count(s, ":") >= 2 && net.ParseIP(s) != nil
+}
+
+// Pattern is a custom rule from config
+type Pattern struct {
+	Name        string `yaml:"name"`
+	Regex       string `yaml:"regex"`
+	Replacement string `yaml:"replacement"`
+}
+
+// Config describes the redaction policy
+type Config struct {
+	// Redact every new paste unless the request opts out (when allowed)
+	Enabled bool
+	// Honor a per-request redact=true/false
+	AllowOverride bool
+	// Builtin rule names to apply (nil = DefaultBuiltins)
+	Builtins []string
+	// Additional custom rules
+	Patterns []Pattern
+	// Replacement text for builtins and patterns without one (default: DefaultReplacement)
+	Replacement string
+}
+
+type rule struct {
+	name        string
+	re          *regexp.Regexp
+	validate    func(string) bool
+	replacement string
+}
+
+// Policy applies the configured rules
+type Policy struct {
+	enabled       bool
+	allowOverride bool
+	rules         []rule
+}
+
+// Report lists what was redacted from a paste
+type Report struct {
+	Total   int            `json:"total"`
+	Matches map[string]int `json:"matches"`
+}
+
+// String summarises the report, e.g. "3 (email: 2, ipv4: 1)"
+func (r *Report) String() string {
+	if r == nil || r.Total == 0 {
+		return "0"
+	}
+	names := make([]string, 0, len(r.Matches))
+	for name := range r.Matches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s: %d", name, r.Matches[name]))
+	}
+	return fmt.Sprintf("%d (%s)", r.Total, strings.Join(parts, ", "))
+}
+
+// NewPolicy compiles a policy; unknown builtins and bad regexes are errors
+func NewPolicy(cfg Config) (*Policy, error) {
+	replacement := cfg.Replacement
+	if replacement == "" {
+		replacement = DefaultReplacement
+	}
+
+	names := cfg.Builtins
+	if names == nil {
+		names = DefaultBuiltins
+	}
+
+	p := &Policy{enabled: cfg.Enabled, allowOverride: cfg.AllowOverride}
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		b, ok := Builtins[name]
+		if !ok {
+			return nil, fmt.Errorf("redact: unknown builtin rule %q", name)
+		}
+		p.rules = append(p.rules, rule{
+			name:        name,
+			re:          regexp.MustCompile(b.pattern),
+			validate:    b.validate,
+			replacement: replacement,
+		})
+	}
+
+	for _, pat := range cfg.Patterns {
+		if pat.Name == "" {
+			return nil, fmt.Errorf("redact: pattern %q has no name", pat.Regex)
+		}
+		re, err := regexp.Compile(pat.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("redact: pattern %q: %w", pat.Name, err)
+		}
+		r := rule{name: pat.Name, re: re, replacement: pat.Replacement}
+		if r.replacement == "" {
+			r.replacement = replacement
+		}
+		p.rules = append(p.rules, r)
+	}
+
+	return p, nil
+}
+
+// ShouldRedact decides whether a paste is redacted given the request's
+// redact parameter ("", "true" or "false"); nil policies never redact
+func (p *Policy) ShouldRedact(requested string) bool {
+	if p == nil || len(p.rules) == 0 {
+		return false
+	}
+	if p.allowOverride {
+		switch strings.ToLower(requested) {
+		case "true", "1", "yes":
+			return true
+		case "false", "0", "no":
+			return false
+		}
+	}
+	return p.enabled
+}
+
+// Redact masks every match in text and adds counts to report
+func (p *Policy) Redact(text string, report *Report) string {
+	if p == nil {
+		return text
+	}
+	for _, r := range p.rules {
+		replacement := strings.ReplaceAll(r.replacement, "{name}", r.name)
+		text = r.re.ReplaceAllStringFunc(text, func(match string) string {
+			if r.validate != nil && !r.validate(match) {
+				return match
+			}
+			if report.Matches == nil {
+				report.Matches = make(map[string]int)
+			}
+			report.Matches[r.name]++
+			report.Total++
+			return replacement
+		})
+	}
+	return text
+}
@@ -0,0 +1,378 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+// Package redis is a minimal Redis client for the shared paste cache and
+// rate limit counters
+// It speaks RESP2 over TCP, or TLS for rediss:// addresses, and keeps a few
+// idle connections. When the server cannot be reached it fails fast with
+// ErrUnavailable for a while, so callers use their in-process state instead
+package redis
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/cryptopolicy"
+)
+
+// ErrUnavailable is returned while the server cannot be reached
+var ErrUnavailable = errors.New("redis: server unreachable")
+
+// ErrNoAddress is returned when no address is configured
+var ErrNoAddress = errors.New("redis: address is required")
+
+// retryAfter is how long the client fails fast after losing the server
+const retryAfter = 5 * time.Second
+
+// Config describes a Redis server
+type Config struct {
+	// host:port, or redis://[:password@]host:port[/db] (rediss:// for TLS)
+	Address string
+	// Password, if not in Address
+	Password string
+	// Database number, if not in Address
+	DB int
+	// Limit of dialing and of each command (default: 200ms)
+	Timeout time.Duration
+	// Idle connections kept (default: 4)
+	MaxIdle int
+}
+
+// Error is an error reply from the server
+type Error string
+
+func (e Error) Error() string {
+	return "redis: " + string(e)
+}
+
+// Client sends commands to one server
+type Client struct {
+	cfg Config
+	tls *tls.Config
+
+	mu        sync.Mutex
+	idle      []*conn
+	down      bool
+	downUntil time.Time
+}
+
+type conn struct {
+	nc net.Conn
+	r  *bufio.Reader
+}
+
+// New creates a client from config; it connects on first use
+func New(cfg Config) (*Client, error) {
+	c := &Client{cfg: cfg}
+
+	if strings.Contains(cfg.Address, "://") {
+		u, err := url.Parse(cfg.Address)
+		if err != nil {
+			return nil, fmt.Errorf("redis: %w", err)
+		}
+		switch u.Scheme {
+		case "redis":
+		case "rediss":
+			c.tls = cryptopolicy.ApplyTLS(&tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12})
+		default:
+			return nil, fmt.Errorf("redis: unknown scheme %q", u.Scheme)
+		}
+		c.cfg.Address = u.Host
+		if pass, ok := u.User.Password(); ok {
+			c.cfg.Password = pass
+		}
+		if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+			n, err := strconv.Atoi(db)
+			if err != nil {
+				return nil, fmt.Errorf("redis: invalid database %q", db)
+			}
+			c.cfg.DB = n
+		}
+	}
+	if c.cfg.Address == "" {
+		return nil, ErrNoAddress
+	}
+	if c.cfg.Timeout <= 0 {
+		c.cfg.Timeout = 200 * time.Millisecond
+	}
+	if c.cfg.MaxIdle <= 0 {
+		c.cfg.MaxIdle = 4
+	}
+	return c, nil
+}
+
+// Address returns the host:port of the server
+func (c *Client) Address() string {
+	return c.cfg.Address
+}
+
+// Available reports whether the last command reached the server
+func (c *Client) Available() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return !c.down
+}
+
+// Ping checks that the server answers
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.Do(ctx, "PING")
+	return err
+}
+
+// Get returns the value of a key; ok is false when it is not set
+func (c *Client) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	reply, err := c.Do(ctx, "GET", key)
+	if err != nil || reply == nil {
+		return nil, false, err
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("redis: unexpected reply to GET")
+	}
+	return value, true, nil
+}
+
+// Set sets a key that expires after ttl (0 = never)
+func (c *Client) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	args := []string{"SET", key, string(value)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(max(ttl.Milliseconds(), 1), 10))
+	}
+	_, err := c.Do(ctx, args...)
+	return err
+}
+
+// Delete removes a key; removing a missing key is not an error
+func (c *Client) Delete(ctx context.Context, key string) error {
+	_, err := c.Do(ctx, "DEL", key)
+	return err
+}
+
+// incrScript counts a use in a fixed window: the first use starts the
+// window, and the count and the time left in it are returned
+const incrScript = `local n = redis.call('INCR', KEYS[1])
+local t = redis.call('PTTL', KEYS[1])
+if t < 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+	t = tonumber(ARGV[1])
+end
+return {n, t}`
+
+// Incr adds one to a counter that resets window after its first use, and
+// returns the count and the time until it resets
+func (c *Client) Incr(ctx context.Context, key string, window time.Duration) (int64, time.Duration, error) {
+	reply, err := c.Do(ctx, "EVAL", incrScript, "1", key, strconv.FormatInt(window.Milliseconds(), 10))
+	if err != nil {
+		return 0, 0, err
+	}
+	values, ok := reply.([]any)
+	if !ok || len(values) != 2 {
+		return 0, 0, fmt.Errorf("redis: unexpected reply to EVAL")
+	}
+	count, ok1 := values[0].(int64)
+	left, ok2 := values[1].(int64)
+	if !ok1 || !ok2 {
+		return 0, 0, fmt.Errorf("redis: unexpected reply to EVAL")
+	}
+	return count, time.Duration(left) * time.Millisecond, nil
+}
+
+// Do sends a command and returns its reply: string for status replies,
+// int64, []byte or nil for bulk strings, and []any for arrays
+func (c *Client) Do(ctx context.Context, args ...string) (any, error) {
+	c.mu.Lock()
+	if c.down && time.Now().Before(c.downUntil) {
+		c.mu.Unlock()
+		return nil, ErrUnavailable
+	}
+	c.mu.Unlock()
+
+	cn, err := c.conn(ctx)
+	if err != nil {
+		return nil, c.lost(err)
+	}
+	reply, err := cn.do(ctx, c.cfg.Timeout, args)
+	var replyErr Error
+	if err != nil && !errors.As(err, &replyErr) {
+		cn.nc.Close()
+		return nil, c.lost(err)
+	}
+	c.release(cn)
+	c.reached()
+	return reply, err
+}
+
+// conn returns an idle connection or dials a new one
+func (c *Client) conn(ctx context.Context) (*conn, error) {
+	c.mu.Lock()
+	if n := len(c.idle); n > 0 {
+		cn := c.idle[n-1]
+		c.idle = c.idle[:n-1]
+		c.mu.Unlock()
+		return cn, nil
+	}
+	c.mu.Unlock()
+
+	dialer := &net.Dialer{Timeout: c.cfg.Timeout}
+	var nc net.Conn
+	var err error
+	if c.tls != nil {
+		nc, err = (&tls.Dialer{NetDialer: dialer, Config: c.tls}).DialContext(ctx, "tcp", c.cfg.Address)
+	} else {
+		nc, err = dialer.DialContext(ctx, "tcp", c.cfg.Address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cn := &conn{nc: nc, r: bufio.NewReader(nc)}
+	if c.cfg.Password != "" {
+		if _, err := cn.do(ctx, c.cfg.Timeout, []string{"AUTH", c.cfg.Password}); err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+	if c.cfg.DB != 0 {
+		if _, err := cn.do(ctx, c.cfg.Timeout, []string{"SELECT", strconv.Itoa(c.cfg.DB)}); err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+	return cn, nil
+}
+
+// release keeps a connection for reuse, or closes it when enough are idle
+func (c *Client) release(cn *conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.idle) < c.cfg.MaxIdle {
+		c.idle = append(c.idle, cn)
+		return
+	}
+	cn.nc.Close()
+}
+
+// lost marks the server unreachable for retryAfter, logging the first failure
+func (c *Client) lost(err error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.down {
+		log.Printf("[WARN] redis: %s unreachable, using in-process state: %v", c.cfg.Address, err)
+	}
+	c.down = true
+	c.downUntil = time.Now().Add(retryAfter)
+	for _, cn := range c.idle {
+		cn.nc.Close()
+	}
+	c.idle = nil
+	return fmt.Errorf("%w: %v", ErrUnavailable, err)
+}
+
+// reached clears the mark set by lost
+func (c *Client) reached() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.down {
+		log.Printf("[INFO] redis: %s reachable again", c.cfg.Address)
+		c.down = false
+	}
+}
+
+// Close closes the idle connections
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, cn := range c.idle {
+		cn.nc.Close()
+	}
+	c.idle = nil
+	return nil
+}
+
+// do writes a command and reads its reply within timeout
+func (cn *conn) do(ctx context.Context, timeout time.Duration, args []string) (any, error) {
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := cn.nc.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(cn.nc, b.String()); err != nil {
+		return nil, err
+	}
+	return readReply(cn.r)
+}
+
+// readReply reads one RESP2 reply
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, fmt.Errorf("redis: malformed reply")
+	}
+	kind, rest := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return rest, nil
+	case '-':
+		return nil, Error(rest)
+	case ':':
+		n, err := strconv.ParseInt(rest, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed integer reply")
+		}
+		return n, nil
+	case '$':
+		n, err := strconv.Atoi(rest)
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed bulk reply")
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(rest)
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed array reply")
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		values := make([]any, n)
+		for i := range values {
+			if values[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("redis: unknown reply type %q", kind)
+}
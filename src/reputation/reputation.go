@@ -0,0 +1,411 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+// Package reputation scores client IPs from DNS blocklists (DNSBL) and an
+// AbuseIPDB-style API, so addresses with a bad reputation can be given
+// stricter rate limits or refused writes
+// Scores are cached; an address that cannot be scored is treated as clean
+package reputation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/outbound"
+	"github.com/casjay-forks/caspaste/src/resolver"
+)
+
+const (
+	// DefaultAPIURL is the AbuseIPDB check endpoint
+	DefaultAPIURL = "https://api.abuseipdb.com/api/v2/check"
+	// DefaultThreshold is the score from which an address is bad
+	DefaultThreshold = 50
+	// DefaultLimitDivisor divides the rate limits of bad addresses
+	DefaultLimitDivisor = 4
+	// DefaultCacheTTL is how long a score is kept
+	DefaultCacheTTL = time.Hour
+	// DefaultTimeout bounds the lookups of one address
+	DefaultTimeout = 2 * time.Second
+
+	// listedScore is the score of an address listed by a DNSBL
+	listedScore = 100
+	// failedTTL is how long an address that could not be scored is left
+	// alone before trying again
+	failedTTL = time.Minute
+	// maxCacheEntries bounds the cache; expired entries are dropped first
+	maxCacheEntries = 100000
+	// apiMaxAgeDays is how far back the API counts reports
+	apiMaxAgeDays = 90
+)
+
+// Config selects the sources and what a bad reputation costs
+type Config struct {
+	Enabled bool
+	// DNSBL zones, e.g. zen.spamhaus.org; a listing scores 100
+	DNSBL []string
+	// AbuseIPDB-style check endpoint and key; no key = no API lookups
+	APIURL string
+	APIKey string
+	// Score (1-100) from which an address is bad
+	Threshold int
+	// Score from which writes are refused (0 = never)
+	BlockThreshold int
+	// Rate limits of bad addresses are divided by this
+	LimitDivisor uint
+	// How long scores are kept
+	CacheTTL time.Duration
+	// Bound on the lookups of one address
+	Timeout time.Duration
+	// Resolver for DNSBL lookups (nil = the system resolver)
+	Resolver *resolver.Resolver
+}
+
+// Score is the reputation of an address
+type Score struct {
+	// 0 (clean) to 100 (known abuser)
+	Score int `json:"score"`
+	// DNSBL zones listing the address, and "api" when the API reported it
+	Sources []string `json:"sources,omitempty"`
+	// Bad addresses get stricter rate limits
+	Bad bool `json:"bad"`
+	// Blocked addresses are refused writes
+	Blocked bool `json:"blocked"`
+}
+
+type entry struct {
+	score   Score
+	scored  bool
+	expires time.Time
+	// Closed once the lookups are done
+	ready chan struct{}
+}
+
+// Checker scores addresses; it is safe for concurrent use
+type Checker struct {
+	mu    sync.Mutex
+	cfg   Config
+	cache map[string]*entry
+}
+
+// New creates a checker
+func New(cfg Config) *Checker {
+	return &Checker{cfg: withDefaults(cfg), cache: make(map[string]*entry)}
+}
+
+// withDefaults fills the unset fields of cfg
+func withDefaults(cfg Config) Config {
+	if cfg.APIURL == "" {
+		cfg.APIURL = DefaultAPIURL
+	}
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = DefaultThreshold
+	}
+	if cfg.LimitDivisor == 0 {
+		cfg.LimitDivisor = DefaultLimitDivisor
+	}
+	if cfg.CacheTTL <= 0 {
+		cfg.CacheTTL = DefaultCacheTTL
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	return cfg
+}
+
+// SetConfig replaces the config and forgets the cached scores
+func (c *Checker) SetConfig(cfg Config) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cfg = withDefaults(cfg)
+	c.cache = make(map[string]*entry)
+}
+
+// Enabled reports whether addresses are scored
+func (c *Checker) Enabled() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.active(c.cfg)
+}
+
+// active reports whether cfg has a source to score with
+func (c *Checker) active(cfg Config) bool {
+	return cfg.Enabled && !outbound.Offline() && (len(cfg.DNSBL) > 0 || cfg.APIKey != "")
+}
+
+// Check returns the score of ip, looking it up unless cached; ok is false
+// when ip is not scored: disabled, a private address, or lookups failed
+// Without wait, an uncached address is looked up in the background
+func (c *Checker) Check(ip net.IP, wait bool) (score Score, ok bool) {
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() {
+		return Score{}, false
+	}
+	key := ip.String()
+
+	c.mu.Lock()
+	cfg := c.cfg
+	if !c.active(cfg) {
+		c.mu.Unlock()
+		return Score{}, false
+	}
+	e, found := c.cache[key]
+	if found && time.Now().After(e.expires) && isClosed(e.ready) {
+		found = false
+	}
+	if !found {
+		e = &entry{ready: make(chan struct{}), expires: time.Now().Add(cfg.Timeout)}
+		c.store(key, e)
+		go c.lookup(cfg, ip, e)
+	}
+	c.mu.Unlock()
+
+	if wait {
+		<-e.ready
+	} else if !isClosed(e.ready) {
+		return Score{}, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return e.score, e.scored
+}
+
+// Cached returns the score of ip if it has one, without looking it up
+func (c *Checker) Cached(ip net.IP) (Score, bool) {
+	if ip == nil {
+		return Score{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, found := c.cache[ip.String()]
+	if !found || !e.scored || time.Now().After(e.expires) {
+		return Score{}, false
+	}
+	return e.score, true
+}
+
+// CachedScore is Cached by address string, for the audit log
+func (c *Checker) CachedScore(ip string) (int, bool) {
+	score, ok := c.Cached(net.ParseIP(ip))
+	return score.Score, ok
+}
+
+// LimitDivisor divides the rate limits of bad addresses; it implements
+// netshare.Reputation
+func (c *Checker) LimitDivisor(ip net.IP) uint {
+	score, ok := c.Cached(ip)
+	if !ok || !score.Bad {
+		return 1
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cfg.LimitDivisor
+}
+
+// store adds e to the cache, making room if it is full
+// The caller holds c.mu
+func (c *Checker) store(key string, e *entry) {
+	if len(c.cache) >= maxCacheEntries {
+		now := time.Now()
+		for k, old := range c.cache {
+			if now.After(old.expires) && isClosed(old.ready) {
+				delete(c.cache, k)
+			}
+		}
+		// Still full: drop any finished entry
+		for k, old := range c.cache {
+			if len(c.cache) < maxCacheEntries {
+				break
+			}
+			if isClosed(old.ready) {
+				delete(c.cache, k)
+			}
+		}
+	}
+	c.cache[key] = e
+}
+
+// lookup queries every source at once and scores ip by the worst answer
+func (c *Checker) lookup(cfg Config, ip net.IP, e *entry) {
+	type answer struct {
+		source string
+		score  int
+		err    error
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancel()
+
+	answers := make(chan answer, len(cfg.DNSBL)+1)
+	asked := 0
+	for _, zone := range cfg.DNSBL {
+		asked++
+		go func(zone string) {
+			score, err := checkDNSBL(ctx, cfg.Resolver, ip, zone)
+			answers <- answer{zone, score, err}
+		}(zone)
+	}
+	if cfg.APIKey != "" {
+		asked++
+		go func() {
+			score, err := checkAPI(ctx, cfg, ip)
+			answers <- answer{"api", score, err}
+		}()
+	}
+
+	var score Score
+	scored := false
+	for i := 0; i < asked; i++ {
+		var a answer
+		select {
+		case a = <-answers:
+		case <-ctx.Done():
+			a.err = ctx.Err()
+		}
+		if a.err != nil {
+			continue
+		}
+		scored = true
+		if a.score > 0 {
+			score.Sources = append(score.Sources, a.source)
+			score.Score = max(score.Score, a.score)
+		}
+	}
+	score.Bad = score.Score >= cfg.Threshold
+	score.Blocked = cfg.BlockThreshold > 0 && score.Score >= cfg.BlockThreshold
+
+	c.mu.Lock()
+	e.score, e.scored = score, scored
+	if scored {
+		e.expires = time.Now().Add(cfg.CacheTTL)
+	} else {
+		e.expires = time.Now().Add(failedTTL)
+	}
+	c.mu.Unlock()
+	close(e.ready)
+}
+
+// checkDNSBL scores ip 100 when zone lists it, else 0
+func checkDNSBL(ctx context.Context, res *resolver.Resolver, ip net.IP, zone string) (int, error) {
+	name := reverseName(ip) + "." + strings.Trim(zone, ".")
+
+	type result struct {
+		ips []net.IP
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		ips, err := res.LookupIP(name)
+		done <- result{ips, err}
+	}()
+
+	var r result
+	select {
+	case r = <-done:
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(r.err, &dnsErr) && dnsErr.IsNotFound || errors.Is(r.err, resolver.ErrNoAnswer) {
+		return 0, nil
+	}
+	if r.err != nil {
+		return 0, r.err
+	}
+	for _, answer := range r.ips {
+		answer = answer.To4()
+		// 127.255.255.x is a refusal, e.g. of queries from public resolvers
+		if answer != nil && answer[0] == 127 && !(answer[1] == 255 && answer[2] == 255) {
+			return listedScore, nil
+		}
+	}
+	if len(r.ips) > 0 {
+		return 0, fmt.Errorf("reputation: %s refused the query", zone)
+	}
+	return 0, nil
+}
+
+// reverseName is the DNSBL query name of ip: the reversed octets of an IPv4
+// address, or the reversed nibbles of an IPv6 one
+func reverseName(ip net.IP) string {
+	if v4 := ip.To4(); v4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d", v4[3], v4[2], v4[1], v4[0])
+	}
+	const hexDigits = "0123456789abcdef"
+	v6 := ip.To16()
+	nibbles := make([]string, 0, 32)
+	for i := len(v6) - 1; i >= 0; i-- {
+		nibbles = append(nibbles, string(hexDigits[v6[i]&0x0f]), string(hexDigits[v6[i]>>4]))
+	}
+	return strings.Join(nibbles, ".")
+}
+
+// checkAPI returns the abuse confidence score (0-100) the API gives ip
+func checkAPI(ctx context.Context, cfg Config, ip net.IP) (int, error) {
+	u, err := url.Parse(cfg.APIURL)
+	if err != nil {
+		return 0, fmt.Errorf("reputation: invalid API URL: %w", err)
+	}
+	query := u.Query()
+	query.Set("ipAddress", ip.String())
+	query.Set("maxAgeInDays", fmt.Sprint(apiMaxAgeDays))
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Key", cfg.APIKey)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := outbound.Client(cfg.Timeout).Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("reputation: API returned %s", resp.Status)
+	}
+
+	var body struct {
+		Data struct {
+			AbuseConfidenceScore int `json:"abuseConfidenceScore"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return 0, fmt.Errorf("reputation: invalid API response: %w", err)
+	}
+	return min(max(body.Data.AbuseConfidenceScore, 0), 100), nil
+}
+
+// isClosed reports whether ch is closed
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+type contextKey struct{}
+
+// NewContext returns ctx annotated with the score of its client
+func NewContext(ctx context.Context, score Score) context.Context {
+	return context.WithValue(ctx, contextKey{}, score)
+}
+
+// FromContext returns the score of the client of a request, if it has one
+func FromContext(ctx context.Context) (Score, bool) {
+	score, ok := ctx.Value(contextKey{}).(Score)
+	return score, ok
+}
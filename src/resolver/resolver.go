@@ -0,0 +1,299 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+// Package resolver provides DNS lookups against configurable upstreams
+// Containers often have split DNS, so domain checks can be pointed at specific
+// nameservers or DNS-over-HTTPS endpoints instead of the system resolver
+package resolver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DefaultTimeout is the per-upstream lookup timeout
+const DefaultTimeout = 5 * time.Second
+
+// ErrNoAnswer is returned when a DoH response has no matching records
+var ErrNoAnswer = errors.New("no DNS records found")
+
+// Config selects the upstreams used for lookups
+// Servers are tried first, then DoH endpoints; with neither, the system resolver is used
+type Config struct {
+	// Nameserver IPs, with optional port (e.g. "1.1.1.1", "10.0.0.2:5353")
+	Servers []string
+	// DNS-over-HTTPS endpoints (RFC 8484, e.g. "https://cloudflare-dns.com/dns-query")
+	DoH []string
+	// Per-upstream timeout (0 = DefaultTimeout)
+	Timeout time.Duration
+}
+
+type upstream struct {
+	name string
+	net  *net.Resolver
+	doh  string
+}
+
+// Resolver performs lookups against the configured upstreams in order
+// A nil *Resolver uses the system resolver
+type Resolver struct {
+	upstreams []upstream
+	timeout   time.Duration
+	client    *http.Client
+	logf      func(format string, args ...interface{})
+}
+
+// New creates a resolver from config
+func New(cfg Config) *Resolver {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	r := &Resolver{
+		timeout: timeout,
+		client:  &http.Client{Timeout: timeout},
+		logf:    log.Printf,
+	}
+
+	for _, server := range cfg.Servers {
+		addr := server
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(addr, "53")
+		}
+		dialer := &net.Dialer{Timeout: timeout}
+		r.upstreams = append(r.upstreams, upstream{
+			name: addr,
+			net: &net.Resolver{
+				PreferGo: true,
+				Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+					return dialer.DialContext(ctx, network, addr)
+				},
+			},
+		})
+	}
+	for _, endpoint := range cfg.DoH {
+		r.upstreams = append(r.upstreams, upstream{name: endpoint, doh: endpoint})
+	}
+	if len(r.upstreams) == 0 {
+		r.upstreams = []upstream{{name: "system", net: net.DefaultResolver}}
+	}
+
+	return r
+}
+
+// SetLogger overrides where per-check resolver logs go (nil disables logging)
+func (r *Resolver) SetLogger(logf func(format string, args ...interface{})) {
+	r.logf = logf
+}
+
+// LookupIP returns the IPv4 and IPv6 addresses of host
+func (r *Resolver) LookupIP(host string) ([]net.IP, error) {
+	if r == nil {
+		return net.LookupIP(host)
+	}
+
+	var ips []net.IP
+	err := r.lookup("A/AAAA", host, func(ctx context.Context, u upstream) error {
+		var err error
+		if u.doh != "" {
+			ips, err = r.dohIPs(ctx, u.doh, host)
+		} else {
+			ips, err = u.net.LookupIP(ctx, "ip", host)
+		}
+		return err
+	})
+	return ips, err
+}
+
+// LookupTXT returns the TXT records of name
+func (r *Resolver) LookupTXT(name string) ([]string, error) {
+	if r == nil {
+		return net.LookupTXT(name)
+	}
+
+	var records []string
+	err := r.lookup("TXT", name, func(ctx context.Context, u upstream) error {
+		var err error
+		if u.doh != "" {
+			records, err = r.dohTXT(ctx, u.doh, name)
+		} else {
+			records, err = u.net.LookupTXT(ctx, name)
+		}
+		return err
+	})
+	return records, err
+}
+
+// LookupCNAME returns the canonical name of host, following CNAME chains
+func (r *Resolver) LookupCNAME(host string) (string, error) {
+	if r == nil {
+		return net.LookupCNAME(host)
+	}
+
+	var cname string
+	err := r.lookup("CNAME", host, func(ctx context.Context, u upstream) error {
+		var err error
+		if u.doh != "" {
+			cname, err = r.dohCNAME(ctx, u.doh, host)
+		} else {
+			cname, err = u.net.LookupCNAME(ctx, host)
+		}
+		return err
+	})
+	return cname, err
+}
+
+// lookup runs fn against each upstream until one answers, logging which one did
+func (r *Resolver) lookup(kind, name string, fn func(ctx context.Context, u upstream) error) error {
+	var lastErr error
+	for _, u := range r.upstreams {
+		ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+		err := fn(ctx, u)
+		cancel()
+		if err == nil {
+			r.log("[INFO] dns: %s %s answered by %s", kind, name, u.name)
+			return nil
+		}
+		r.log("[WARN] dns: %s %s failed via %s: %v", kind, name, u.name, err)
+		lastErr = err
+	}
+	return lastErr
+}
+
+func (r *Resolver) log(format string, args ...interface{}) {
+	if r.logf != nil {
+		r.logf(format, args...)
+	}
+}
+
+func (r *Resolver) dohIPs(ctx context.Context, endpoint, host string) ([]net.IP, error) {
+	var ips []net.IP
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		answers, err := r.dohQuery(ctx, endpoint, host, qtype)
+		if err != nil {
+			return nil, err
+		}
+		for _, ans := range answers {
+			switch body := ans.Body.(type) {
+			case *dnsmessage.AResource:
+				ips = append(ips, net.IP(body.A[:]))
+			case *dnsmessage.AAAAResource:
+				ips = append(ips, net.IP(body.AAAA[:]))
+			}
+		}
+	}
+	if len(ips) == 0 {
+		return nil, ErrNoAnswer
+	}
+	return ips, nil
+}
+
+func (r *Resolver) dohTXT(ctx context.Context, endpoint, name string) ([]string, error) {
+	answers, err := r.dohQuery(ctx, endpoint, name, dnsmessage.TypeTXT)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []string
+	for _, ans := range answers {
+		if body, ok := ans.Body.(*dnsmessage.TXTResource); ok {
+			// Long TXT values are split into 255-byte strings; join them like net.LookupTXT
+			records = append(records, strings.Join(body.TXT, ""))
+		}
+	}
+	if len(records) == 0 {
+		return nil, ErrNoAnswer
+	}
+	return records, nil
+}
+
+func (r *Resolver) dohCNAME(ctx context.Context, endpoint, host string) (string, error) {
+	answers, err := r.dohQuery(ctx, endpoint, host, dnsmessage.TypeA)
+	if err != nil {
+		return "", err
+	}
+
+	// The answer section holds the CNAME chain; the last target is canonical
+	cname := fqdn(host)
+	for _, ans := range answers {
+		if body, ok := ans.Body.(*dnsmessage.CNAMEResource); ok {
+			cname = body.CNAME.String()
+		}
+	}
+	return cname, nil
+}
+
+// dohQuery sends a single RFC 8484 wire-format query
+func (r *Resolver) dohQuery(ctx context.Context, endpoint, name string, qtype dnsmessage.Type) ([]dnsmessage.Resource, error) {
+	qname, err := dnsmessage.NewName(fqdn(name))
+	if err != nil {
+		return nil, err
+	}
+
+	query := dnsmessage.Message{
+		// ID 0 is recommended for DoH so responses are cache friendly
+		Header:    dnsmessage.Header{RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: qname, Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(packed))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DoH server returned %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, err
+	}
+
+	var msg dnsmessage.Message
+	if err := msg.Unpack(body); err != nil {
+		return nil, err
+	}
+	switch msg.Header.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		return nil, fmt.Errorf("%s: no such host", name)
+	default:
+		return nil, fmt.Errorf("DNS error: %s", msg.Header.RCode)
+	}
+	return msg.Answers, nil
+}
+
+// fqdn returns name as a fully qualified DNS name with a trailing dot
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
@@ -0,0 +1,187 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+// Package s3 is a minimal client for S3-compatible object storage
+// Only object PUT and DELETE are supported, signed with AWS Signature V4
+// and addressed path-style so MinIO, R2, B2 and AWS all work
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/outbound"
+)
+
+// ErrIncompleteConfig is returned when required settings are missing
+var ErrIncompleteConfig = errors.New("s3: endpoint, bucket, access key and secret key are required")
+
+// Config describes an S3 bucket
+type Config struct {
+	// Endpoint URL (e.g. "https://s3.us-east-1.amazonaws.com", "http://minio:9000")
+	Endpoint string
+	// Region (default: us-east-1)
+	Region string
+	// Bucket name
+	Bucket string
+	// Key prefix prepended to every object (e.g. "mirror/")
+	Prefix string
+	// Credentials
+	AccessKey string
+	SecretKey string
+}
+
+// Client uploads and deletes objects in one bucket
+type Client struct {
+	cfg    Config
+	client *http.Client
+}
+
+// New creates a client from config
+func New(cfg Config) (*Client, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" || cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, ErrIncompleteConfig
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	cfg.Endpoint = strings.TrimSuffix(cfg.Endpoint, "/")
+
+	return &Client{
+		cfg:    cfg,
+		client: outbound.Client(60 * time.Second),
+	}, nil
+}
+
+// Put uploads an object
+func (c *Client) Put(ctx context.Context, key string, body []byte, contentType string) error {
+	return c.do(ctx, c.client, http.MethodPut, key, bytes.NewReader(body), int64(len(body)), sha256Hex(body), contentType)
+}
+
+// PutFile uploads a file without holding it in memory; it is read twice,
+// once for the payload hash the signature covers and once to send it
+// Only ctx limits how long the upload takes
+func (c *Client) PutFile(ctx context.Context, key, path, contentType string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	client := *c.client
+	client.Timeout = 0
+	return c.do(ctx, &client, http.MethodPut, key, io.LimitReader(f, size), size, hex.EncodeToString(hash.Sum(nil)), contentType)
+}
+
+// Delete removes an object; deleting a missing object is not an error
+func (c *Client) Delete(ctx context.Context, key string) error {
+	return c.do(ctx, c.client, http.MethodDelete, key, nil, 0, sha256Hex(nil), "")
+}
+
+func (c *Client) do(ctx context.Context, client *http.Client, method, key string, body io.Reader, size int64, payloadHash, contentType string) error {
+	url := c.cfg.Endpoint + "/" + c.cfg.Bucket + "/" + escapePath(c.cfg.Prefix+key)
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	c.sign(req, payloadHash, time.Now().UTC())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("s3: %s %s: %s: %s", method, key, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// sign adds an AWS Signature V4 Authorization header
+func (c *Client) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + c.cfg.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+c.cfg.SecretKey), date)
+	key = hmacSHA256(key, c.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+c.cfg.AccessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// escapePath percent-encodes everything except RFC 3986 unreserved characters and "/"
+// This matches the canonical URI encoding S3 expects
+func escapePath(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		ch := path[i]
+		if ch == '/' || ch == '-' || ch == '_' || ch == '.' || ch == '~' ||
+			('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z') || ('0' <= ch && ch <= '9') {
+			b.WriteByte(ch)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", ch)
+	}
+	return b.String()
+}
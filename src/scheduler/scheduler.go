@@ -40,7 +40,11 @@ type Task struct {
 	Enabled      bool
 	Skippable    bool
 	RetryOnFail  bool
+	// LeaderOnly tasks run on one replica only, see Config.IsLeader
+	LeaderOnly   bool
 	RetryDelay   time.Duration
+	// Timeout ends a run that takes longer (default: 5 minutes)
+	Timeout      time.Duration
 	Handler      func(ctx context.Context) error
 	LastRun      time.Time
 	NextRun      time.Time
@@ -58,6 +62,8 @@ type Config struct {
 	Timezone string
 	// CatchUpWindow is the duration within which missed tasks are run
 	CatchUpWindow time.Duration
+	// IsLeader reports whether this replica runs LeaderOnly tasks (nil = always)
+	IsLeader func() bool
 }
 
 // DefaultConfig returns the default scheduler configuration
@@ -242,10 +248,25 @@ func (s *Scheduler) runTask(task *Task) {
 		task.mu.Unlock()
 		return
 	}
+	if task.LeaderOnly && s.config.IsLeader != nil && !s.config.IsLeader() {
+		// Another replica runs it; just move on to the next slot
+		task.LastStatus = StatusSkipped
+		if task.cronExpr != nil {
+			task.NextRun = task.cronExpr.Next(time.Now().In(s.location))
+		} else {
+			task.NextRun = time.Time{}
+		}
+		task.mu.Unlock()
+		return
+	}
 	task.LastStatus = StatusRunning
 	task.mu.Unlock()
 
-	ctx, cancel := context.WithTimeout(s.ctx, 5*time.Minute)
+	timeout := task.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Minute
+	}
+	ctx, cancel := context.WithTimeout(s.ctx, timeout)
 	defer cancel()
 
 	err := task.Handler(ctx)
@@ -302,6 +323,35 @@ func (s *Scheduler) RunNow(id string) error {
 	return nil
 }
 
+// TaskState is the run state of a task at one moment
+type TaskState struct {
+	LastRun    time.Time
+	NextRun    time.Time
+	LastStatus TaskStatus
+	LastError  string
+	RunCount   int64
+	FailCount  int64
+}
+
+// State returns the run state of a task
+func (s *Scheduler) State(id string) (TaskState, bool) {
+	task, ok := s.GetTask(id)
+	if !ok {
+		return TaskState{}, false
+	}
+
+	task.mu.RLock()
+	defer task.mu.RUnlock()
+	return TaskState{
+		LastRun:    task.LastRun,
+		NextRun:    task.NextRun,
+		LastStatus: task.LastStatus,
+		LastError:  task.LastError,
+		RunCount:   task.RunCount,
+		FailCount:  task.FailCount,
+	}, true
+}
+
 // GetStatus returns the scheduler status
 func (s *Scheduler) GetStatus() map[string]interface{} {
 	s.mu.RLock()
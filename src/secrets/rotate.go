@@ -0,0 +1,101 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package secrets
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Column identifies an encrypted database column
+type Column struct {
+	Table  string
+	Column string
+}
+
+// EncryptedColumns lists every column protected with envelope encryption
+// Hardcoded whitelist: table and column names are interpolated into SQL
+var EncryptedColumns = []Column{
+	{Table: "users", Column: "totp_secret"},
+	{Table: "custom_domains", Column: "ssl_credentials"},
+}
+
+// RotateResult summarizes a re-wrap pass over one column
+type RotateResult struct {
+	Column    Column
+	Scanned   int
+	Rewrapped int
+}
+
+// RewrapAll re-wraps every encrypted column with the current master key,
+// encrypting any legacy plaintext values along the way
+func RewrapAll(db *sql.DB, c *Cipher) ([]RotateResult, error) {
+	var results []RotateResult
+	for _, col := range EncryptedColumns {
+		res, err := rewrapColumn(db, c, col)
+		if err != nil {
+			return results, fmt.Errorf("%s.%s: %w", col.Table, col.Column, err)
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+func rewrapColumn(db *sql.DB, c *Cipher, col Column) (RotateResult, error) {
+	res := RotateResult{Column: col}
+
+	rows, err := db.Query("SELECT id, " + col.Column + " FROM " + col.Table +
+		" WHERE " + col.Column + " IS NOT NULL AND " + col.Column + " != ''")
+	if err != nil {
+		return res, err
+	}
+
+	type pending struct {
+		id    int64
+		value string
+	}
+	var updates []pending
+	for rows.Next() {
+		var id int64
+		var value string
+		if err := rows.Scan(&id, &value); err != nil {
+			rows.Close()
+			return res, err
+		}
+		res.Scanned++
+
+		newValue, changed, err := c.Rewrap(value)
+		if err != nil {
+			rows.Close()
+			return res, fmt.Errorf("row %d: %w", id, err)
+		}
+		if changed {
+			updates = append(updates, pending{id: id, value: newValue})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return res, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return res, err
+	}
+	for _, u := range updates {
+		if _, err := tx.Exec("UPDATE "+col.Table+" SET "+col.Column+" = ? WHERE id = ?", u.value, u.id); err != nil {
+			tx.Rollback()
+			return res, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return res, err
+	}
+
+	res.Rewrapped = len(updates)
+	return res, nil
+}
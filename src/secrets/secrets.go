@@ -0,0 +1,385 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+// Package secrets provides envelope encryption for sensitive database columns
+// Each value is encrypted with a random data key (AES-256-GCM) and the data key
+// is wrapped with a server master key. Rotating the master key only re-wraps
+// data keys; values themselves are never re-encrypted.
+package secrets
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Envelope format: enc:v1:<key id>:<wrapped data key>:<ciphertext>
+const (
+	envelopePrefix = "enc:v1:"
+	keySize        = 32
+)
+
+// Common errors
+var (
+	ErrNoMasterKey    = errors.New("no master key configured")
+	ErrUnknownKey     = errors.New("value encrypted with unknown master key")
+	ErrMalformed      = errors.New("malformed encrypted value")
+	ErrRotateReadOnly = errors.New("master keys from environment or command must be rotated at the source")
+)
+
+// Source describes where the master keyring comes from
+// Command takes priority over Env, which takes priority over File
+type Source struct {
+	// Keyring file, created with a fresh key if missing
+	File string
+	// Environment variable holding a base64 key or keyring lines
+	Env string
+	// External command (e.g. a KMS CLI) printing a base64 key or keyring lines
+	Command string
+}
+
+// MasterKey is a key-encryption key
+type MasterKey struct {
+	ID        string
+	Key       []byte
+	CreatedAt int64
+}
+
+// Keyring holds master keys, newest first
+type Keyring struct {
+	mu       sync.RWMutex
+	path     string
+	readOnly bool
+	keys     []MasterKey
+}
+
+// LoadKeyring loads the master keyring from the configured source
+func LoadKeyring(src Source) (*Keyring, error) {
+	if src.Command != "" {
+		fields := strings.Fields(src.Command)
+		out, err := exec.Command(fields[0], fields[1:]...).Output()
+		if err != nil {
+			return nil, fmt.Errorf("master key command failed: %w", err)
+		}
+		return parseKeyring(out, "", true)
+	}
+
+	if src.Env != "" {
+		if v := os.Getenv(src.Env); v != "" {
+			return parseKeyring([]byte(v), "", true)
+		}
+	}
+
+	if src.File == "" {
+		return nil, ErrNoMasterKey
+	}
+
+	data, err := os.ReadFile(src.File)
+	if os.IsNotExist(err) {
+		k := &Keyring{path: src.File}
+		if err := k.Rotate(); err != nil {
+			return nil, err
+		}
+		return k, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseKeyring(data, src.File, false)
+}
+
+// parseKeyring accepts either a bare base64 key or keyring lines
+// of the form "<kid> <created_unix> <base64 key>"
+func parseKeyring(data []byte, path string, readOnly bool) (*Keyring, error) {
+	k := &Keyring{path: path, readOnly: readOnly}
+
+	trimmed := strings.TrimSpace(string(data))
+	if !strings.ContainsAny(trimmed, " \n") && trimmed != "" {
+		key, err := base64.StdEncoding.DecodeString(trimmed)
+		if err != nil || len(key) != keySize {
+			return nil, fmt.Errorf("master key must be %d base64-encoded bytes", keySize)
+		}
+		k.keys = append(k.keys, MasterKey{ID: "default", Key: key})
+		return k, nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var id, encoded string
+		var created int64
+		if _, err := fmt.Sscanf(line, "%s %d %s", &id, &created, &encoded); err != nil {
+			return nil, fmt.Errorf("malformed master keyring line: %w", err)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != keySize {
+			return nil, fmt.Errorf("invalid master key %s", id)
+		}
+		k.keys = append(k.keys, MasterKey{ID: id, Key: key, CreatedAt: created})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(k.keys) == 0 {
+		return nil, ErrNoMasterKey
+	}
+	return k, nil
+}
+
+// Current returns the key used for new encryptions
+func (k *Keyring) Current() (MasterKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if len(k.keys) == 0 {
+		return MasterKey{}, ErrNoMasterKey
+	}
+	return k.keys[0], nil
+}
+
+// Lookup finds a master key by ID
+func (k *Keyring) Lookup(id string) (MasterKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	for _, key := range k.keys {
+		if key.ID == id {
+			return key, true
+		}
+	}
+	return MasterKey{}, false
+}
+
+// Rotate adds a new current master key, keeping older keys for decryption
+func (k *Keyring) Rotate() error {
+	if k.readOnly {
+		return ErrRotateReadOnly
+	}
+
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys = append([]MasterKey{{ID: hex.EncodeToString(id), Key: key, CreatedAt: time.Now().Unix()}}, k.keys...)
+	return k.save()
+}
+
+// Prune drops every key except the current one
+// Call only after all values have been re-wrapped with the current key
+func (k *Keyring) Prune() error {
+	if k.readOnly {
+		return nil
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if len(k.keys) > 1 {
+		k.keys = k.keys[:1]
+	}
+	return k.save()
+}
+
+// save writes the keyring to disk (caller holds the lock)
+func (k *Keyring) save() error {
+	if k.path == "" {
+		return nil
+	}
+
+	var b strings.Builder
+	b.WriteString("# CasPaste master keys - newest first. Losing this file makes encrypted secrets unrecoverable.\n")
+	for _, key := range k.keys {
+		fmt.Fprintf(&b, "%s %d %s\n", key.ID, key.CreatedAt, base64.StdEncoding.EncodeToString(key.Key))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(k.path), 0700); err != nil {
+		return err
+	}
+	tmp := k.path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, k.path)
+}
+
+// Cipher encrypts and decrypts column values
+// A nil *Cipher passes values through unchanged so services work without a master key
+type Cipher struct {
+	keyring *Keyring
+}
+
+// NewCipher creates a cipher backed by a keyring
+func NewCipher(keyring *Keyring) *Cipher {
+	return &Cipher{keyring: keyring}
+}
+
+// IsEncrypted reports whether a stored value is an envelope
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, envelopePrefix)
+}
+
+// Encrypt seals a value; empty values stay empty
+func (c *Cipher) Encrypt(plaintext string) (string, error) {
+	if c == nil || plaintext == "" {
+		return plaintext, nil
+	}
+
+	master, err := c.keyring.Current()
+	if err != nil {
+		return "", err
+	}
+
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+
+	wrapped, err := seal(master.Key, dataKey)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := seal(dataKey, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+
+	return envelopePrefix + master.ID + ":" +
+		base64.RawStdEncoding.EncodeToString(wrapped) + ":" +
+		base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens an envelope; legacy plaintext values are returned as-is
+func (c *Cipher) Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	if c == nil {
+		return "", ErrNoMasterKey
+	}
+
+	_, dataKey, sealed, err := c.unwrap(value)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(dataKey, sealed)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// Rewrap re-wraps a value's data key with the current master key
+// Plaintext values are encrypted. Returns the new value and whether it changed.
+func (c *Cipher) Rewrap(value string) (string, bool, error) {
+	if c == nil || value == "" {
+		return value, false, nil
+	}
+	if !IsEncrypted(value) {
+		encrypted, err := c.Encrypt(value)
+		return encrypted, err == nil, err
+	}
+
+	master, err := c.keyring.Current()
+	if err != nil {
+		return "", false, err
+	}
+
+	keyID, dataKey, sealed, err := c.unwrap(value)
+	if err != nil {
+		return "", false, err
+	}
+	if keyID == master.ID {
+		return value, false, nil
+	}
+
+	wrapped, err := seal(master.Key, dataKey)
+	if err != nil {
+		return "", false, err
+	}
+	return envelopePrefix + master.ID + ":" +
+		base64.RawStdEncoding.EncodeToString(wrapped) + ":" +
+		base64.RawStdEncoding.EncodeToString(sealed), true, nil
+}
+
+// unwrap parses an envelope and recovers its data key
+func (c *Cipher) unwrap(value string) (string, []byte, []byte, error) {
+	parts := strings.Split(strings.TrimPrefix(value, envelopePrefix), ":")
+	if len(parts) != 3 {
+		return "", nil, nil, ErrMalformed
+	}
+
+	master, ok := c.keyring.Lookup(parts[0])
+	if !ok {
+		return "", nil, nil, ErrUnknownKey
+	}
+
+	wrapped, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, nil, ErrMalformed
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, nil, ErrMalformed
+	}
+
+	dataKey, err := open(master.Key, wrapped)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return parts[0], dataKey, sealed, nil
+}
+
+// seal encrypts with AES-256-GCM, prefixing the random nonce
+func seal(key, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// open decrypts a nonce-prefixed AES-256-GCM ciphertext
+func open(key, sealed []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrMalformed
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+}
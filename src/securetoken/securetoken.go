@@ -0,0 +1,76 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+// Package securetoken generates, hashes and compares secret tokens
+// All randomness comes from crypto/rand; never use math/rand or time for secrets
+package securetoken
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"math/big"
+)
+
+// Character sets for GenerateString
+const (
+	AlphaNum      = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	LowerAlphaNum = "abcdefghijklmnopqrstuvwxyz0123456789"
+	// Password adds symbols to AlphaNum
+	Password = AlphaNum + "!@#$%^&*"
+)
+
+// ErrInvalidLength is returned for non-positive lengths or an empty charset
+var ErrInvalidLength = errors.New("securetoken: invalid length")
+
+// Hex returns n random bytes encoded as 2n hex characters
+func Hex(n int) (string, error) {
+	if n <= 0 {
+		return "", ErrInvalidLength
+	}
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// GenerateString returns length characters drawn uniformly from charset
+// Uses rejection sampling via crypto/rand.Int so there is no modulo bias
+func GenerateString(length int, charset string) (string, error) {
+	if length <= 0 || charset == "" {
+		return "", ErrInvalidLength
+	}
+
+	max := big.NewInt(int64(len(charset)))
+	out := make([]byte, length)
+	for i := range out {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		out[i] = charset[n.Int64()]
+	}
+	return string(out), nil
+}
+
+// Hash returns the SHA-256 hex digest used to store tokens at rest
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Equal compares two secrets in constant time
+func Equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// MatchesHash reports whether token hashes to storedHash, in constant time
+func MatchesHash(token, storedHash string) bool {
+	return Equal(Hash(token), storedHash)
+}
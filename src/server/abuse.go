@@ -0,0 +1,67 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"strconv"
+
+	"github.com/casjay-forks/caspaste/src/config"
+	"github.com/casjay-forks/caspaste/src/email"
+)
+
+// abuseTickets returns the mailer and address abuse tickets are sent to
+// The mailer is nil when tickets are off
+func abuseTickets(yamlCfg *config.YAMLConfig) (*email.Client, string, error) {
+	abuse := yamlCfg.Server.Abuse
+	if !abuse.Tickets {
+		return nil, "", nil
+	}
+	smtpCfg := yamlCfg.Server.SMTP
+	to := abuse.Email
+	if to == "" {
+		to = yamlCfg.Server.Administrator.Email
+	}
+	if _, err := mail.ParseAddress(to); err != nil {
+		return nil, "", fmt.Errorf("invalid abuse address %q: %w", to, err)
+	}
+	from, err := mail.ParseAddress(yamlCfg.Server.Administrator.From)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid server.administrator.from: %w", err)
+	}
+
+	// The client applies the SMTP_* environment variables
+	client := email.NewClient(&email.Config{
+		Host:      smtpCfg.Host,
+		Port:      smtpCfg.Port,
+		Username:  smtpCfg.Username,
+		Password:  smtpCfg.Password,
+		TLS:       smtpCfg.TLS,
+		FromName:  from.Name,
+		FromEmail: from.Address,
+	})
+	if client.GetConfig()["host"] == "" {
+		return nil, "", errors.New("server.abuse.tickets needs server.smtp.host")
+	}
+	return client, to, nil
+}
+
+// siteURL returns the public URL of the server, for links in emails
+func siteURL(fqdn string, httpPort, httpsPort int) string {
+	switch {
+	case httpsPort == 443 || httpPort == 443:
+		return "https://" + fqdn
+	case httpsPort > 0:
+		return "https://" + net.JoinHostPort(fqdn, strconv.Itoa(httpsPort))
+	case httpPort == 80:
+		return "http://" + fqdn
+	}
+	return "http://" + net.JoinHostPort(fqdn, strconv.Itoa(httpPort))
+}
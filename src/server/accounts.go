@@ -0,0 +1,314 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/authapi"
+	"github.com/casjay-forks/caspaste/src/bootstrap"
+	"github.com/casjay-forks/caspaste/src/cli"
+	"github.com/casjay-forks/caspaste/src/config"
+	"github.com/casjay-forks/caspaste/src/domain"
+	"github.com/casjay-forks/caspaste/src/domainapi"
+	"github.com/casjay-forks/caspaste/src/httputil"
+	"github.com/casjay-forks/caspaste/src/jwt"
+	"github.com/casjay-forks/caspaste/src/leader"
+	"github.com/casjay-forks/caspaste/src/logger"
+	"github.com/casjay-forks/caspaste/src/oauth"
+	"github.com/casjay-forks/caspaste/src/oauthapi"
+	"github.com/casjay-forks/caspaste/src/org"
+	"github.com/casjay-forks/caspaste/src/recovery"
+	"github.com/casjay-forks/caspaste/src/scheduler"
+	"github.com/casjay-forks/caspaste/src/secrets"
+	"github.com/casjay-forks/caspaste/src/session"
+	"github.com/casjay-forks/caspaste/src/storage"
+	"github.com/casjay-forks/caspaste/src/token"
+	"github.com/casjay-forks/caspaste/src/user"
+	"github.com/casjay-forks/caspaste/src/web"
+)
+
+// accounts holds the database-backed account services
+// Every handler and the bootstrap share one instance of each service, so
+// secrets at rest go through the same cipher everywhere
+type accounts struct {
+	cfg       config.UsersConfig
+	features  config.FeaturesConfig
+	users     *user.Service
+	orgs      *org.Service
+	tokens    *token.Service
+	domains   *domain.Service
+	sessions  *session.Service
+	auth      *authapi.Service
+	oauth     *oauth.Service
+	oauthAPI  *oauthapi.Service
+	domainAPI *domainapi.Service
+	// JWT signing keys; nil unless users.auth.jwt is on
+	jwtKeys *jwt.Keyring
+	log     logger.Logger
+}
+
+// usersConfig reads the users section
+func usersConfig(yamlCfg *config.YAMLConfig) (config.UsersConfig, error) {
+	cfg := yamlCfg.UsersConfig()
+	jwtCfg := cfg.Auth.JWT
+	if jwtCfg.RotateDays < 0 {
+		return cfg, fmt.Errorf("invalid users.auth.jwt.rotate_days %d", jwtCfg.RotateDays)
+	}
+	// A secret from the environment is the only key and is never saved, so
+	// rotating it would lock every replica out of the tokens it signed
+	if jwtCfg.Enabled && jwtCfg.RotateDays > 0 && jwtCfg.SecretEnv != "" && os.Getenv(jwtCfg.SecretEnv) != "" {
+		return cfg, fmt.Errorf("invalid users.auth.jwt.rotate_days %d, must be 0 when %s is set", jwtCfg.RotateDays, jwtCfg.SecretEnv)
+	}
+	durations := map[string]string{
+		"users.auth.jwt.ttl":            cfg.Auth.JWT.TTL,
+		"users.oauth.access_token_ttl":  cfg.OAuth.AccessTokenTTL,
+		"users.oauth.refresh_token_ttl": cfg.OAuth.RefreshTokenTTL,
+	}
+	for name, value := range durations {
+		if d, err := cli.ParseDuration(value); err != nil || d <= 0 {
+			return cfg, fmt.Errorf("invalid %s %q", name, value)
+		}
+	}
+	return cfg, nil
+}
+
+// jwtKeyring loads the users.auth.jwt signing keys: a fixed secret from
+// the environment, or the rotating keyring file
+func jwtKeyring(cfg config.JWTConfig, configDir string) (*jwt.Keyring, error) {
+	if cfg.SecretEnv != "" {
+		if secret := os.Getenv(cfg.SecretEnv); secret != "" {
+			keys, err := jwt.NewKeyring([]byte(secret))
+			if err != nil {
+				return nil, fmt.Errorf("invalid users.auth.jwt secret in %s: %w", cfg.SecretEnv, err)
+			}
+			return keys, nil
+		}
+	}
+	path := cfg.KeyFile
+	if path == "" {
+		path = filepath.Join(configDir, "jwt.keys")
+	}
+	keys, err := jwt.LoadKeyring(path)
+	if err != nil {
+		return nil, fmt.Errorf("users.auth.jwt.key_file: %w", err)
+	}
+	return keys, nil
+}
+
+// newAccounts builds the account services; the sign-in, user and OAuth
+// endpoints are only served when users.enabled is on
+func newAccounts(yamlCfg *config.YAMLConfig, db storage.DB, fqdn, configDir string, cipher *secrets.Cipher, log logger.Logger) (*accounts, error) {
+	cfg, err := usersConfig(yamlCfg)
+	if err != nil {
+		return nil, err
+	}
+	features, err := featuresConfig(yamlCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &accounts{
+		cfg:      cfg,
+		features: features,
+		users:    user.NewService(db.Users()),
+		orgs:     org.NewService(db.Orgs()),
+		tokens:   token.NewService(db.Pool()),
+		domains:  domain.NewService(db.Domains(), fqdn),
+		sessions: session.NewService(db.Pool()),
+		oauth:    oauth.NewService(db.Pool()),
+		log:      log,
+	}
+	a.users.SetCipher(cipher)
+	a.domains.SetCipher(cipher)
+	a.domains.SetResolver(dnsResolver(yamlCfg, 0))
+	discovery, err := ipDiscovery(yamlCfg)
+	if err == nil {
+		err = a.domains.SetIPDiscovery(discovery)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	orgReserved, domainReserved, err := reservedCheckers(features)
+	if err != nil {
+		return nil, err
+	}
+	a.orgs.SetReservedChecker(orgReserved)
+	a.domains.SetReservedChecker(domainReserved)
+
+	a.auth = authapi.NewService(db.Pool(), a.users, a.sessions, recovery.NewService(db.Pool()), &a.cfg)
+	a.oauthAPI = oauthapi.NewService(a.oauth, &a.cfg, yamlCfg.Server.Title)
+	a.domainAPI = domainapi.NewService(db.Pool(), a.domains, a.orgs, &a.features.CustomDomains)
+
+	// Stateless JWTs on sign-in, verified with keys every replica shares
+	if jwtCfg := cfg.Auth.JWT; cfg.Enabled && jwtCfg.Enabled {
+		keys, err := jwtKeyring(jwtCfg, configDir)
+		if err != nil {
+			return nil, err
+		}
+		ttl, _ := cli.ParseDuration(jwtCfg.TTL)
+		issuer := jwtCfg.Issuer
+		if issuer == "" {
+			issuer = fqdn
+		}
+		a.jwtKeys = keys
+		a.auth.SetJWTIssuer(jwt.NewIssuer(keys, issuer, ttl))
+	}
+	return a, nil
+}
+
+// bootstrap returns the services provisioning goes through
+func (a *accounts) bootstrap() bootstrap.Services {
+	return bootstrap.Services{
+		Users:   a.users,
+		Orgs:    a.orgs,
+		Tokens:  a.tokens,
+		Domains: a.domains,
+	}
+}
+
+// middleware resolves the session cookie and bearer credentials to a user
+// for the account pages and endpoints
+func (a *accounts) middleware() func(http.Handler) http.Handler {
+	return web.APIAuthMiddleware(
+		a.auth.SessionAuthenticator(),
+		authapi.TokenAuthenticator(a.tokens, a.users),
+		a.auth.JWTAuthenticator(),
+	)
+}
+
+// handler serves the account endpoints and passes any other path to next
+func (a *accounts) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handle := a.route(r)
+		if handle == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err := handle(w, r); err != nil {
+			a.log.HttpError(r, err)
+		}
+	})
+}
+
+// route returns the handler of an account endpoint, or nil
+func (a *accounts) route(r *http.Request) func(http.ResponseWriter, *http.Request) error {
+	apiBase := config.APIBasePath()
+	path := httputil.StripTxtExtension(r.URL.Path)
+
+	switch path {
+	case apiBase + "/auth/register":
+		return a.auth.HandleRegister
+	case apiBase + "/auth/login":
+		return a.auth.HandleLogin
+	case apiBase + "/auth/logout":
+		return a.auth.HandleLogout
+	case apiBase + "/auth/password/forgot":
+		return a.auth.HandlePasswordForgot
+	case apiBase + "/auth/password/reset":
+		return a.auth.HandlePasswordReset
+	case apiBase + "/auth/verify-email":
+		return a.auth.HandleVerifyEmail
+	case apiBase + "/auth/recovery/use":
+		return a.auth.HandleRecoveryUse
+	case "/oauth/authorize":
+		return a.oauthAPI.HandleAuthorize
+	case "/oauth/token":
+		return a.oauthAPI.HandleToken
+	case "/oauth/revoke":
+		return a.oauthAPI.HandleRevoke
+	case apiBase + "/oauth/clients":
+		return a.oauthAPI.HandleClients
+	}
+
+	if code, ok := strings.CutPrefix(path, apiBase+"/auth/invite/"); ok && code != "" {
+		return func(w http.ResponseWriter, r *http.Request) error {
+			return a.auth.HandleInviteGet(w, r, code)
+		}
+	}
+	if clientID, ok := strings.CutPrefix(path, apiBase+"/oauth/clients/"); ok && clientID != "" {
+		return func(w http.ResponseWriter, r *http.Request) error {
+			return a.oauthAPI.HandleClientDelete(w, r, clientID)
+		}
+	}
+	if clientID, ok := strings.CutPrefix(path, apiBase+"/oauth/authorizations/"); ok && clientID != "" {
+		return func(w http.ResponseWriter, r *http.Request) error {
+			return a.oauthAPI.HandleAuthorizationDelete(w, r, clientID)
+		}
+	}
+	return a.domainRoute(r, path)
+}
+
+// startOAuthScheduler removes expired authorization codes and tokens hourly
+func startOAuthScheduler(a *accounts, log logger.Logger, elector *leader.Elector) {
+	schedCfg := scheduler.DefaultConfig()
+	schedCfg.IsLeader = elector.IsLeader
+	sched := scheduler.New(schedCfg)
+	err := sched.AddTask(&scheduler.Task{
+		ID:          "oauth-expired",
+		Name:        "Expired OAuth tokens",
+		Description: "Remove expired OAuth authorization codes and tokens",
+		Schedule:    "@hourly",
+		Enabled:     true,
+		Skippable:   true,
+		LeaderOnly:  true,
+		Handler: func(ctx context.Context) error {
+			if err := a.oauth.DeleteExpired(); err != nil {
+				log.Error(errors.New("Expired OAuth tokens: " + err.Error()))
+				return err
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		log.Error(errors.New("Expired OAuth token cleanup disabled: " + err.Error()))
+		return
+	}
+	sched.Start()
+}
+
+// startJWTScheduler rotates the JWT signing key from the leader once it is
+// users.auth.jwt.rotate_days old; the other replicas load the new key when
+// they first see a token signed with it
+func startJWTScheduler(a *accounts, log logger.Logger, elector *leader.Elector) {
+	maxAge := time.Duration(a.cfg.Auth.JWT.RotateDays) * 24 * time.Hour
+	schedCfg := scheduler.DefaultConfig()
+	schedCfg.IsLeader = elector.IsLeader
+	sched := scheduler.New(schedCfg)
+	err := sched.AddTask(&scheduler.Task{
+		ID:          "jwt-rotation",
+		Name:        "JWT key rotation",
+		Description: "Replace the JWT signing key once it is users.auth.jwt.rotate_days old",
+		Schedule:    "@hourly",
+		Enabled:     true,
+		Skippable:   true,
+		LeaderOnly:  true,
+		Handler: func(ctx context.Context) error {
+			rotated, err := a.jwtKeys.RotateIfOlder(maxAge)
+			if err != nil {
+				log.Error(errors.New("JWT key rotation: " + err.Error()))
+				return err
+			}
+			if rotated {
+				log.Info("JWT signing key rotated")
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		log.Error(errors.New("JWT key rotation disabled: " + err.Error()))
+		return
+	}
+	sched.Start()
+}
@@ -0,0 +1,324 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/admin"
+	"github.com/casjay-forks/caspaste/src/config"
+	"github.com/casjay-forks/caspaste/src/leader"
+	"github.com/casjay-forks/caspaste/src/logger"
+	"github.com/casjay-forks/caspaste/src/s3"
+	"github.com/casjay-forks/caspaste/src/scheduler"
+	"github.com/casjay-forks/caspaste/src/sftp"
+	"github.com/casjay-forks/caspaste/src/storage"
+)
+
+// Scheduled backups are the archives of "caspaste --maintenance backup",
+// named auto-YYYYMMDD-HHMMSS.tar.gz so rotation never touches manual ones
+
+// autoBackupPrefix starts the name of every scheduled archive
+const autoBackupPrefix = "auto-"
+
+// autoBackupTimeout is the longest a scheduled backup, uploads included, may take
+const autoBackupTimeout = 6 * time.Hour
+
+// backupJob takes scheduled backups and reports on them to the admin panel
+type backupJob struct {
+	dir       string
+	dataDir   string
+	configDir string
+	dbDriver  string
+	dbSource  string
+	schedule  string
+	retention int
+	db        storage.DB
+	bucket    *s3.Client
+	sftp      *sftp.Config
+	uploads   []string
+	sched     *scheduler.Scheduler
+	elector   *leader.Elector
+	log       logger.Logger
+}
+
+// newBackupJob reads the backup settings; archives are written to dir, the
+// backup directory
+func newBackupJob(yamlCfg *config.YAMLConfig, db storage.DB, dataDir, configDir, dir string, log logger.Logger, elector *leader.Elector) (*backupJob, error) {
+	cfg := yamlCfg.Backup
+	j := &backupJob{
+		dir:       dir,
+		dataDir:   dataDir,
+		configDir: configDir,
+		dbDriver:  yamlCfg.Database.Driver,
+		dbSource:  yamlCfg.Database.Source,
+		schedule:  cfg.Schedule,
+		retention: cfg.Retention,
+		db:        db,
+		uploads:   []string{},
+		elector:   elector,
+		log:       log,
+	}
+	if j.dir == "" {
+		j.dir = filepath.Join(dataDir, "backups")
+	}
+	if j.schedule == "" {
+		j.schedule = "@daily"
+	}
+	if j.retention <= 0 {
+		j.retention = 7
+	}
+
+	if cfg.S3.Endpoint != "" {
+		bucket, err := s3.New(s3.Config{
+			Endpoint:  cfg.S3.Endpoint,
+			Region:    cfg.S3.Region,
+			Bucket:    cfg.S3.Bucket,
+			Prefix:    cfg.S3.Prefix,
+			AccessKey: cfg.S3.AccessKey,
+			SecretKey: cfg.S3.SecretKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+		j.bucket = bucket
+		j.uploads = append(j.uploads, "s3://"+cfg.S3.Bucket+"/"+cfg.S3.Prefix)
+	}
+	if cfg.SFTP.Host != "" {
+		port := cfg.SFTP.Port
+		if port == 0 {
+			port = 22
+		}
+		j.sftp = &sftp.Config{
+			Address:    net.JoinHostPort(cfg.SFTP.Host, strconv.Itoa(port)),
+			User:       cfg.SFTP.User,
+			Password:   cfg.SFTP.Password,
+			KeyFile:    cfg.SFTP.KeyFile,
+			KnownHosts: cfg.SFTP.KnownHosts,
+			Dir:        cfg.SFTP.Dir,
+		}
+		if j.sftp.User == "" || j.sftp.KnownHosts == "" || (j.sftp.Password == "" && j.sftp.KeyFile == "") {
+			return nil, sftp.ErrIncompleteConfig
+		}
+		j.uploads = append(j.uploads, "sftp://"+j.sftp.Address+"/"+strings.TrimPrefix(cfg.SFTP.Dir, "/"))
+	}
+	return j, nil
+}
+
+// run takes one backup, uploads it and removes the archives past retention
+// A failed upload fails the run, but the local archive is kept
+func (j *backupJob) run(ctx context.Context) error {
+	if err := os.MkdirAll(j.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	name := autoBackupPrefix + time.Now().Format("20060102-150405") + ".tar.gz"
+	backupPath := filepath.Join(j.dir, name)
+
+	// The database is in use, so SQLite is archived from a consistent copy
+	opts := backupOptions{}
+	if j.dbDriver == "sqlite" {
+		snapshot := backupPath + ".db.tmp"
+		os.Remove(snapshot)
+		if err := j.db.Snapshot(snapshot); err != nil {
+			return fmt.Errorf("failed to copy the database: %w", err)
+		}
+		defer os.Remove(snapshot)
+		opts.DB, opts.DBSnapshot = j.dbSource, snapshot
+	}
+	externalDB := backupExternalDB(j.dbDriver, j.dbSource, j.dataDir)
+	if err := writeBackup(backupPath, j.dataDir, j.configDir, externalDB, opts); err != nil {
+		return fmt.Errorf("backup failed: %w", err)
+	}
+
+	var size int64
+	if info, err := os.Stat(backupPath); err == nil {
+		size = info.Size()
+	}
+	j.log.Info(fmt.Sprintf("Backup written: %s (%.2f MB)", backupPath, float64(size)/1024/1024))
+
+	removed, err := j.rotate()
+	if err != nil {
+		j.log.Error(errors.New("Backup rotation: " + err.Error()))
+	}
+	return j.upload(ctx, name, backupPath, removed)
+}
+
+// rotate removes the oldest scheduled archives past the retention count and
+// returns their names
+func (j *backupJob) rotate() ([]string, error) {
+	entries, err := os.ReadDir(j.dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix(name, autoBackupPrefix) && strings.HasSuffix(name, ".tar.gz") {
+			names = append(names, name)
+		}
+	}
+	if len(names) <= j.retention {
+		return nil, nil
+	}
+
+	// The timestamp in the name sorts them oldest first
+	sort.Strings(names)
+	var removed []string
+	var errs []error
+	for _, name := range names[:len(names)-j.retention] {
+		if err := os.Remove(filepath.Join(j.dir, name)); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		removed = append(removed, name)
+	}
+	if len(removed) > 0 {
+		j.log.Info("Removed old backups: " + strings.Join(removed, ", "))
+	}
+	return removed, errors.Join(errs...)
+}
+
+// upload copies a new archive to the bucket and SFTP server, and removes the
+// archives rotated out locally from them
+func (j *backupJob) upload(ctx context.Context, name, backupPath string, removed []string) error {
+	var errs []error
+	if j.bucket != nil {
+		if err := j.bucket.PutFile(ctx, name, backupPath, "application/gzip"); err != nil {
+			errs = append(errs, err)
+		} else {
+			j.log.Info("Backup uploaded to " + j.uploads[0])
+		}
+		for _, old := range removed {
+			if err := j.bucket.Delete(ctx, old); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if j.sftp != nil {
+		if err := j.uploadSFTP(ctx, name, backupPath, removed); err != nil {
+			errs = append(errs, err)
+		} else {
+			j.log.Info("Backup uploaded to " + j.uploads[len(j.uploads)-1])
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (j *backupJob) uploadSFTP(ctx context.Context, name, backupPath string, removed []string) error {
+	client, err := sftp.Dial(ctx, *j.sftp)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if err := client.PutFile(ctx, name, backupPath); err != nil {
+		return err
+	}
+	for _, old := range removed {
+		if err := client.Remove(old); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BackupStatus reports the job and lists the archives in the backup directory
+func (j *backupJob) BackupStatus() (admin.BackupStatus, error) {
+	status := admin.BackupStatus{
+		Schedule:  j.schedule,
+		Retention: j.retention,
+		Dir:       j.dir,
+		Uploads:   j.uploads,
+		Leader:    j.elector.IsLeader(),
+		Archives:  []admin.BackupArchive{},
+	}
+	if state, ok := j.sched.State("backup"); ok {
+		status.LastRun = state.LastRun
+		status.LastStatus = string(state.LastStatus)
+		status.LastError = state.LastError
+		status.NextRun = state.NextRun
+	}
+
+	entries, err := os.ReadDir(j.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return status, nil
+	}
+	if err != nil {
+		return status, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".tar.gz") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		status.Archives = append(status.Archives, admin.BackupArchive{
+			Name:      entry.Name(),
+			Size:      info.Size(),
+			Created:   info.ModTime(),
+			Scheduled: strings.HasPrefix(entry.Name(), autoBackupPrefix),
+		})
+	}
+	sort.Slice(status.Archives, func(a, b int) bool {
+		return status.Archives[a].Created.After(status.Archives[b].Created)
+	})
+	return status, nil
+}
+
+// RunBackup starts a backup now, on the leader only
+func (j *backupJob) RunBackup() error {
+	if !j.elector.IsLeader() {
+		return errors.New("only the leader replica takes backups")
+	}
+	if state, ok := j.sched.State("backup"); ok && state.LastStatus == scheduler.StatusRunning {
+		return errors.New("a backup is already running")
+	}
+	return j.sched.RunNow("backup")
+}
+
+// startBackupScheduler takes backups from the leader on a schedule
+func startBackupScheduler(job *backupJob) error {
+	if job.dbDriver != "sqlite" {
+		job.log.Info("Scheduled backups hold the data and config directories; back up the " + job.dbDriver + " database with its own tools or caspaste --maintenance export")
+	}
+
+	schedCfg := scheduler.DefaultConfig()
+	schedCfg.IsLeader = job.elector.IsLeader
+	job.sched = scheduler.New(schedCfg)
+	err := job.sched.AddTask(&scheduler.Task{
+		ID:          "backup",
+		Name:        "Backup",
+		Description: "Archive the data and config directories, keep the newest, and upload them",
+		Schedule:    job.schedule,
+		Enabled:     true,
+		Skippable:   true,
+		LeaderOnly:  true,
+		Timeout:     autoBackupTimeout,
+		Handler: func(ctx context.Context) error {
+			err := job.run(ctx)
+			if err != nil {
+				job.log.Error(errors.New("Backup: " + err.Error()))
+			}
+			return err
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return job.sched.Start()
+}
@@ -0,0 +1,514 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// Backup archives are gzipped tars of data/, config/ and external-db/,
+// written and read in Go so no tar or cp binary is needed
+// The last entry, SHA256SUMS, has the checksum of every file in the format
+// of sha256sum, so an extracted backup can also be checked with
+// "sha256sum -c SHA256SUMS"
+
+// backupManifest is the name of the checksum manifest in a backup archive
+const backupManifest = "SHA256SUMS"
+
+// backupSkipped reports whether a file or directory is left out of backups
+func backupSkipped(name string) bool {
+	switch name {
+	case "backups", ".backup-temp", ".restore-temp":
+		return true
+	}
+	return strings.HasSuffix(name, ".tmp") || strings.HasSuffix(name, ".lock") || strings.HasSuffix(name, ".partial")
+}
+
+// backupProgress reports how much of an archive has been written or read;
+// on a terminal the line is rewritten in place, otherwise printed now and then
+type backupProgress struct {
+	verb  string
+	files int
+	bytes int64
+	tty   bool
+	last  time.Time
+}
+
+func newBackupProgress(verb string) *backupProgress {
+	return &backupProgress{verb: verb, tty: term.IsTerminal(int(os.Stdout.Fd())), last: time.Now()}
+}
+
+func (p *backupProgress) add(size int64) {
+	if p == nil {
+		return
+	}
+	p.files++
+	p.bytes += size
+
+	interval := 5 * time.Second
+	if p.tty {
+		interval = 200 * time.Millisecond
+	}
+	if time.Since(p.last) < interval {
+		return
+	}
+	p.last = time.Now()
+	if p.tty {
+		fmt.Printf("\r  %s %d files, %.2f MB", p.verb, p.files, float64(p.bytes)/1024/1024)
+	} else {
+		fmt.Printf("  %s %d files, %.2f MB\n", p.verb, p.files, float64(p.bytes)/1024/1024)
+	}
+}
+
+func (p *backupProgress) done() {
+	if p == nil {
+		return
+	}
+	if p.tty {
+		fmt.Print("\r")
+	}
+	fmt.Printf("  %s %d files, %.2f MB\n", p.verb, p.files, float64(p.bytes)/1024/1024)
+}
+
+// backupWriter adds files to a backup archive and records their checksums
+type backupWriter struct {
+	tw       *tar.Writer
+	sums     map[string]string
+	progress *backupProgress
+	// Not backed up, as it holds the archive being written
+	backupDir string
+	// SQLite database archived from a consistent copy, see backupOptions
+	db, dbSnapshot string
+}
+
+// backupOptions change how writeBackup works
+type backupOptions struct {
+	// Print progress; the scheduled job runs quietly
+	Progress bool
+	// A SQLite database in use is archived from DBSnapshot, a consistent copy
+	// of DB made with VACUUM INTO, and its journal files are left out, as
+	// they belong to the live file
+	DB, DBSnapshot string
+}
+
+// addDir adds the files under dir as prefix/...
+func (w *backupWriter) addDir(dir, prefix string) error {
+	return filepath.WalkDir(dir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != dir && backupSkipped(entry.Name()) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() && samePath(p, w.backupDir) {
+			return filepath.SkipDir
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		name := prefix
+		if rel != "." {
+			name = prefix + "/" + filepath.ToSlash(rel)
+		}
+
+		switch {
+		case entry.IsDir():
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			header, err := tar.FileInfoHeader(info, "")
+			if err != nil {
+				return err
+			}
+			header.Name = name + "/"
+			return w.tw.WriteHeader(header)
+		case entry.Type().IsRegular():
+			if w.dbSnapshot != "" && w.isDBJournal(p) {
+				return nil
+			}
+			return w.addFile(p, name)
+		}
+		// Symlinks, sockets and devices are not data
+		return nil
+	})
+}
+
+// isDBJournal reports whether p is a journal file of the snapshotted database
+func (w *backupWriter) isDBJournal(p string) bool {
+	for _, suffix := range []string{"-journal", "-wal", "-shm"} {
+		if samePath(p, w.db+suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// addFile adds one file as name
+func (w *backupWriter) addFile(p, name string) error {
+	if w.dbSnapshot != "" && samePath(p, w.db) {
+		p = w.dbSnapshot
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if err := w.tw.WriteHeader(header); err != nil {
+		return err
+	}
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(w.tw, hash), io.LimitReader(f, header.Size))
+	if err != nil {
+		return fmt.Errorf("%s: %w", p, err)
+	}
+	if n != header.Size {
+		return fmt.Errorf("%s: file shrank while it was backed up", p)
+	}
+	w.sums[name] = hex.EncodeToString(hash.Sum(nil))
+	w.progress.add(n)
+	return nil
+}
+
+// addManifest adds SHA256SUMS, sorted by name
+func (w *backupWriter) addManifest() error {
+	names := make([]string, 0, len(w.sums))
+	for name := range w.sums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var manifest strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&manifest, "%s  %s\n", w.sums[name], name)
+	}
+	header := &tar.Header{
+		Name:    backupManifest,
+		Mode:    0644,
+		Size:    int64(manifest.Len()),
+		ModTime: time.Now(),
+	}
+	if err := w.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w.tw, manifest.String())
+	return err
+}
+
+// writeBackup archives dataDir, configDir if it exists, and externalDB
+// unless it is "", to backupPath; the archive is written beside its final
+// name, so a failed backup leaves none
+func writeBackup(backupPath, dataDir, configDir, externalDB string, opts backupOptions) error {
+	partialPath := backupPath + ".partial"
+	file, err := os.OpenFile(partialPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(partialPath)
+	defer file.Close()
+
+	gz := gzip.NewWriter(file)
+	w := &backupWriter{
+		tw:        tar.NewWriter(gz),
+		sums:      make(map[string]string),
+		backupDir: filepath.Dir(backupPath),
+	}
+	if opts.Progress {
+		w.progress = newBackupProgress("Backed up")
+	}
+	if opts.DBSnapshot != "" {
+		w.db, w.dbSnapshot = opts.DB, opts.DBSnapshot
+	}
+
+	if err := w.addDir(dataDir, "data"); err != nil {
+		return err
+	}
+	if configDir != "" {
+		if _, err := os.Stat(configDir); err == nil {
+			if err := w.addDir(configDir, "config"); err != nil {
+				return err
+			}
+		}
+	}
+	if externalDB != "" {
+		if err := w.addFile(externalDB, "external-db/caspaste.db"); err != nil {
+			return err
+		}
+	}
+	if err := w.addManifest(); err != nil {
+		return err
+	}
+
+	// Closed here rather than deferred, so a failed write is reported
+	if err := w.tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	w.progress.done()
+	return os.Rename(partialPath, backupPath)
+}
+
+// backupExternalDB returns the SQLite database file if it is outside
+// dataDir/db, so it is archived on its own, or ""
+func backupExternalDB(dbDriver, dbSource, dataDir string) string {
+	expectedDbPath := filepath.Join(dataDir, "db") + string(filepath.Separator)
+	if !strings.HasPrefix(dbSource, expectedDbPath) && (dbDriver == "sqlite3" || dbDriver == "sqlite") {
+		return dbSource
+	}
+	return ""
+}
+
+// samePath reports whether two paths name the same file or directory
+func samePath(a, b string) bool {
+	if b == "" {
+		return false
+	}
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// readBackup calls fn with each entry of a backup archive
+func readBackup(backupPath string, fn func(header *tar.Header, r io.Reader) error) error {
+	f, err := os.Open(backupPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return fmt.Errorf("failed to read backup: %w", err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read backup: %w", err)
+		}
+		if err := fn(header, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// verifyBackup reads a whole backup and checks every file against its
+// manifest; it returns false, and no error, for a readable backup made
+// before manifests were written, which cannot be checked further
+func verifyBackup(backupPath string) (bool, error) {
+	progress := newBackupProgress("Verified")
+	sums := make(map[string]string)
+	var manifest []byte
+	err := readBackup(backupPath, func(header *tar.Header, r io.Reader) error {
+		if header.Typeflag != tar.TypeReg {
+			return nil
+		}
+		if header.Name == backupManifest {
+			var err error
+			manifest, err = io.ReadAll(r)
+			return err
+		}
+		hash := sha256.New()
+		n, err := io.Copy(hash, r)
+		if err != nil {
+			return fmt.Errorf("failed to read backup: %w", err)
+		}
+		sums[strings.TrimPrefix(header.Name, "./")] = hex.EncodeToString(hash.Sum(nil))
+		progress.add(n)
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	progress.done()
+	if manifest == nil {
+		return false, nil
+	}
+
+	expected := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(manifest)), "\n") {
+		if line == "" {
+			continue
+		}
+		sum, name, ok := strings.Cut(line, "  ")
+		if !ok {
+			return true, fmt.Errorf("malformed %s line: %q", backupManifest, line)
+		}
+		expected[name] = sum
+	}
+
+	var problems []string
+	for name, sum := range expected {
+		actual, ok := sums[name]
+		switch {
+		case !ok:
+			problems = append(problems, "missing "+name)
+		case actual != sum:
+			problems = append(problems, "checksum mismatch "+name)
+		}
+	}
+	for name := range sums {
+		if _, ok := expected[name]; !ok {
+			problems = append(problems, "not in manifest "+name)
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		for _, problem := range problems {
+			fmt.Printf("  %s\n", problem)
+		}
+		return true, errors.New("backup is corrupt; see the files listed above")
+	}
+	return true, nil
+}
+
+// extractBackup writes each file of a backup to where target says, skipping
+// those it returns "" for; each file is written beside its target first, so
+// a failed write leaves the old file
+func extractBackup(backupPath string, target func(name string) string) error {
+	progress := newBackupProgress("Restored")
+	err := readBackup(backupPath, func(header *tar.Header, r io.Reader) error {
+		dest := target(header.Name)
+		if dest == "" {
+			return nil
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			return os.MkdirAll(dest, 0755)
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+				return err
+			}
+			tmp := dest + ".restore.tmp"
+			f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, header.FileInfo().Mode().Perm())
+			if err != nil {
+				return err
+			}
+			n, err := io.Copy(f, r)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err == nil {
+				err = os.Rename(tmp, dest)
+			}
+			if err != nil {
+				os.Remove(tmp)
+				return fmt.Errorf("failed to restore %s: %w", dest, err)
+			}
+			progress.add(n)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	progress.done()
+	return nil
+}
+
+// latestBackup returns the name of the newest .tar.gz in backupDir
+func latestBackup(backupDir string) (string, error) {
+	entries, err := os.ReadDir(backupDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	var latestFile string
+	var latestTime int64
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".tar.gz") {
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			if info.ModTime().Unix() > latestTime {
+				latestTime = info.ModTime().Unix()
+				latestFile = entry.Name()
+			}
+		}
+	}
+	if latestFile == "" {
+		return "", fmt.Errorf("no backup files found in %s", backupDir)
+	}
+	return latestFile, nil
+}
+
+// backupFilePath returns the path of an archive named on the command line,
+// which is in backupDir unless a path is given
+func backupFilePath(backupDir, filename string) string {
+	if filepath.IsAbs(filename) || strings.ContainsRune(filename, filepath.Separator) {
+		return filename
+	}
+	return filepath.Join(backupDir, filename)
+}
+
+// performVerify checks a backup against its manifest (default: the latest)
+func performVerify(backupDir, filename string) error {
+	if filename == "" {
+		latest, err := latestBackup(backupDir)
+		if err != nil {
+			return err
+		}
+		filename = latest
+	}
+	backupPath := backupFilePath(backupDir, filename)
+	if _, err := os.Stat(backupPath); err != nil {
+		return fmt.Errorf("backup file not found: %s", backupPath)
+	}
+
+	fmt.Printf("Verifying %s\n", backupPath)
+	checked, err := verifyBackup(backupPath)
+	if err != nil {
+		return err
+	}
+	if !checked {
+		fmt.Println("Backup is readable, but has no checksum manifest: it was made by an older release")
+		return nil
+	}
+	fmt.Println("Backup is intact")
+	return nil
+}
@@ -0,0 +1,117 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/casjay-forks/caspaste/src/blob"
+	"github.com/casjay-forks/caspaste/src/config"
+	"github.com/casjay-forks/caspaste/src/logger"
+	"github.com/casjay-forks/caspaste/src/web"
+)
+
+// brandingManager saves admin panel branding changes to the config file
+// and applies them to the running pages
+type brandingManager struct {
+	configPath string
+	blobs      blob.Store
+	web        *web.Data
+	log        logger.Logger
+}
+
+// Branding returns the branding in effect
+func (m *brandingManager) Branding() config.Branding {
+	return m.web.Branding()
+}
+
+// UpdateBranding validates, saves and applies branding
+func (m *brandingManager) UpdateBranding(b config.Branding) (config.Branding, error) {
+	configWriteMu.Lock()
+	defer configWriteMu.Unlock()
+	return b, m.apply(b)
+}
+
+// UploadBrandingAsset stores a logo or favicon and points the branding at it
+// The URL carries a content hash so browsers fetch the new file
+func (m *brandingManager) UploadBrandingAsset(ctx context.Context, kind string, data []byte) (config.Branding, error) {
+	configWriteMu.Lock()
+	defer configWriteMu.Unlock()
+
+	b := m.web.Branding()
+	field, err := brandingAssetField(&b, kind)
+	if err != nil {
+		return b, err
+	}
+	if err := m.blobs.Put(ctx, "branding/"+kind, data); err != nil {
+		return b, err
+	}
+	sum := sha256.Sum256(data)
+	*field = config.BrandingAssetPath + kind + "?v=" + hex.EncodeToString(sum[:4])
+	return b, m.apply(b)
+}
+
+// DeleteBrandingAsset removes an uploaded logo or favicon and goes back to
+// the default
+func (m *brandingManager) DeleteBrandingAsset(ctx context.Context, kind string) (config.Branding, error) {
+	configWriteMu.Lock()
+	defer configWriteMu.Unlock()
+
+	b := m.web.Branding()
+	field, err := brandingAssetField(&b, kind)
+	if err != nil {
+		return b, err
+	}
+	*field = ""
+	if err := m.apply(b); err != nil {
+		return b, err
+	}
+	if err := m.blobs.Delete(ctx, "branding/"+kind); err != nil {
+		m.log.Error(fmt.Errorf("Branding: %w", err))
+	}
+	return b, nil
+}
+
+// apply saves branding to the config file, then updates the pages
+// The config reloader sees the file change but finds nothing new to apply
+func (m *brandingManager) apply(b config.Branding) error {
+	if err := b.Validate(); err != nil {
+		return err
+	}
+	if m.configPath == "(environment)" {
+		return config.ErrBrandingReadOnly
+	}
+
+	// Start from the file as written so environment overrides and resolved
+	// placeholders are not saved into it
+	yamlCfg, err := config.LoadYAMLConfig(m.configPath)
+	if err != nil {
+		return err
+	}
+	yamlCfg.SetBranding(b)
+	if err := config.SaveYAMLConfig(m.configPath, yamlCfg); err != nil {
+		return err
+	}
+
+	m.web.SetBranding(b)
+	m.log.Info("Branding updated")
+	return nil
+}
+
+// brandingAssetField returns the branding field for an asset kind
+func brandingAssetField(b *config.Branding, kind string) (*string, error) {
+	switch kind {
+	case "logo":
+		return &b.Logo, nil
+	case "favicon":
+		return &b.Favicon, nil
+	}
+	return nil, fmt.Errorf("%w: unknown asset %q", config.ErrInvalidBranding, kind)
+}
@@ -0,0 +1,63 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/config"
+	"github.com/casjay-forks/caspaste/src/logger"
+	"github.com/casjay-forks/caspaste/src/storage"
+)
+
+// newDBBreaker creates the circuit breaker of database.breaker, or nil when
+// it is off; the circuit opening and closing is logged
+func newDBBreaker(yamlCfg *config.YAMLConfig, log logger.Logger) (*storage.Breaker, error) {
+	if !yamlCfg.Database.Breaker.Enabled {
+		return nil, nil
+	}
+	cfg, err := dbBreakerConfig(yamlCfg)
+	if err != nil {
+		return nil, err
+	}
+	breaker := storage.NewBreaker(cfg)
+	breaker.OnChange(func(open bool, err error) {
+		if open {
+			log.Error(fmt.Errorf("Database unavailable, serving cached pastes read-only: %w", err))
+			return
+		}
+		log.Info("Database available again")
+	})
+	return breaker, nil
+}
+
+// dbBreakerConfig reads database.breaker; empty durations use the defaults
+func dbBreakerConfig(yamlCfg *config.YAMLConfig) (storage.BreakerConfig, error) {
+	b := yamlCfg.Database.Breaker
+	cfg := storage.BreakerConfig{Failures: b.Failures}
+	if b.Failures < 0 {
+		return cfg, fmt.Errorf("invalid database.breaker.failures %d", b.Failures)
+	}
+	for _, d := range []struct {
+		name  string
+		value string
+		into  *time.Duration
+	}{
+		{"interval", b.Interval, &cfg.Interval},
+		{"timeout", b.Timeout, &cfg.Timeout},
+	} {
+		if d.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(d.value)
+		if err != nil || parsed <= 0 {
+			return cfg, fmt.Errorf("invalid database.breaker.%s %q", d.name, d.value)
+		}
+		*d.into = parsed
+	}
+	return cfg, nil
+}
@@ -24,30 +24,51 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	chromaLexers "github.com/alecthomas/chroma/v2/lexers"
 
+	"github.com/casjay-forks/caspaste/src/abuse"
 	"github.com/casjay-forks/caspaste/src/admin"
 	"github.com/casjay-forks/caspaste/src/apiv1"
+	"github.com/casjay-forks/caspaste/src/archive"
 	"github.com/casjay-forks/caspaste/src/audit"
+	"github.com/casjay-forks/caspaste/src/blob"
+	"github.com/casjay-forks/caspaste/src/bootstrap"
 	"github.com/casjay-forks/caspaste/src/caspasswd"
 	"github.com/casjay-forks/caspaste/src/cli"
 	"github.com/casjay-forks/caspaste/src/completion"
 	"github.com/casjay-forks/caspaste/src/config"
+	"github.com/casjay-forks/caspaste/src/content"
+	"github.com/casjay-forks/caspaste/src/cryptopolicy"
+	"github.com/casjay-forks/caspaste/src/csp"
+	"github.com/casjay-forks/caspaste/src/directory"
+	"github.com/casjay-forks/caspaste/src/leader"
 	"github.com/casjay-forks/caspaste/src/logger"
+	"github.com/casjay-forks/caspaste/src/maintenance"
 	"github.com/casjay-forks/caspaste/src/metric"
+	"github.com/casjay-forks/caspaste/src/mirror"
 	"github.com/casjay-forks/caspaste/src/netshare"
 	"github.com/casjay-forks/caspaste/src/portutil"
 	"github.com/casjay-forks/caspaste/src/privilege"
 	"github.com/casjay-forks/caspaste/src/raw"
+	"github.com/casjay-forks/caspaste/src/redact"
+	"github.com/casjay-forks/caspaste/src/redis"
+	"github.com/casjay-forks/caspaste/src/reputation"
+	"github.com/casjay-forks/caspaste/src/s3"
+	"github.com/casjay-forks/caspaste/src/scheduler"
+	"github.com/casjay-forks/caspaste/src/secrets"
 	"github.com/casjay-forks/caspaste/src/service"
+	"github.com/casjay-forks/caspaste/src/setup"
 	"github.com/casjay-forks/caspaste/src/storage"
 	"github.com/casjay-forks/caspaste/src/swagger"
+	"github.com/casjay-forks/caspaste/src/token"
 	"github.com/casjay-forks/caspaste/src/graphql"
 	"github.com/casjay-forks/caspaste/src/template"
 	"github.com/casjay-forks/caspaste/src/updater"
+	"github.com/casjay-forks/caspaste/src/user"
 	"github.com/casjay-forks/caspaste/src/validation"
 	"github.com/casjay-forks/caspaste/src/web"
 )
@@ -102,6 +123,15 @@ func exitOnError(e error) {
 	os.Exit(1)
 }
 
+// openLogFile opens name in dir for appending, exiting if it cannot
+func openLogFile(dir, name string) *os.File {
+	f, err := os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		exitOnError(fmt.Errorf("failed to open %s: %w", name, err))
+	}
+	return f
+}
+
 // retryWithBackoff retries a function with exponential backoff
 func retryWithBackoff(operation func() error, maxAttempts int, initialDelay time.Duration, maxDelay time.Duration, description string) error {
 	var err error
@@ -188,21 +218,22 @@ func getDisplayAddress(listenAddr string) string {
 
 // isRunningAsRoot checks if the process is running with root/admin privileges
 func isRunningAsRoot() bool {
-	switch runtime.GOOS {
-	case "windows":
-		// On Windows, check if running as administrator
-		// Simple heuristic: try to create a file in Windows system directory
-		testPath := os.Getenv("WINDIR") + "\\Temp\\.caspaste-test"
-		if f, err := os.Create(testPath); err == nil {
-			f.Close()
-			os.Remove(testPath)
-			return true
+	return privilege.IsAdmin()
+}
+
+// getWindowsDir returns a directory under %ProgramData%\CasPaste when running
+// as a service or elevated, and under %LOCALAPPDATA%\CasPaste otherwise
+func getWindowsDir(elem ...string) string {
+	var base string
+	if isRunningAsRoot() {
+		if base = os.Getenv("ProgramData"); base == "" {
+			base = `C:\ProgramData`
 		}
-		return false
-	default:
-		// Unix-like systems: check if UID is 0
-		return os.Geteuid() == 0
+	} else if base = os.Getenv("LOCALAPPDATA"); base == "" {
+		home, _ := os.UserHomeDir()
+		base = filepath.Join(home, "AppData", "Local")
 	}
+	return filepath.Join(append([]string{base, "CasPaste"}, elem...)...)
 }
 
 // getDefaultDataDir returns the platform-specific default data directory
@@ -213,10 +244,7 @@ func getDefaultDataDir() string {
 	}
 	switch runtime.GOOS {
 	case "windows":
-		if localAppData := os.Getenv("LOCALAPPDATA"); localAppData != "" {
-			return localAppData + "\\CasPaste\\Data"
-		}
-		return os.Getenv("PROGRAMDATA") + "\\CasPaste\\Data"
+		return getWindowsDir("Data")
 	case "darwin":
 		if isRunningAsRoot() {
 			return "/var/lib/casjay-forks/caspaste"
@@ -245,10 +273,7 @@ func getDefaultConfigDir() string {
 	}
 	switch runtime.GOOS {
 	case "windows":
-		if localAppData := os.Getenv("LOCALAPPDATA"); localAppData != "" {
-			return localAppData + "\\CasPaste\\Config"
-		}
-		return os.Getenv("PROGRAMDATA") + "\\CasPaste\\Config"
+		return getWindowsDir("Config")
 	case "darwin":
 		if isRunningAsRoot() {
 			return "/etc/casjay-forks/caspaste"
@@ -278,10 +303,7 @@ func getPIDFilePath(dataDir string) string {
 		if dataDir != "" {
 			return filepath.Join(dataDir, "caspaste.pid")
 		}
-		if localAppData := os.Getenv("LOCALAPPDATA"); localAppData != "" {
-			return localAppData + "\\CasPaste\\caspaste.pid"
-		}
-		return "C:\\ProgramData\\CasPaste\\caspaste.pid"
+		return getWindowsDir("caspaste.pid")
 	case "darwin":
 		if isRunningAsRoot() {
 			return "/var/run/caspaste.pid"
@@ -411,9 +433,8 @@ func formatDatabaseDisplay(driver, source string) string {
 	}
 
 	// For file paths (SQLite), show driver and filename
-	if strings.Contains(source, "/") {
-		filename := source[strings.LastIndex(source, "/")+1:]
-		return fmt.Sprintf("%s (%s)", driver, filename)
+	if strings.ContainsAny(source, `/\`) {
+		return fmt.Sprintf("%s (%s)", driver, filepath.Base(source))
 	}
 
 	// Fallback - just show driver
@@ -496,14 +517,8 @@ func handleUpdateCommand(command, currentVersion string) {
 		os.Exit(0)
 	}
 
-	// Configuration for updates
-	cfg := updater.Config{
-		CurrentVersion: currentVersion,
-		Branch:         "stable", // Default branch
-		GithubOwner:    "casjay-forks",
-		GithubRepo:     "caspaste",
-		BinaryName:     "caspaste",
-	}
+	// Configuration for updates (stable branch, release key of this build)
+	cfg := updater.DefaultConfig(currentVersion)
 
 	switch cmd {
 	case "check":
@@ -608,6 +623,8 @@ func handleServiceCommand(command, address, dbSource, dataDir, configDir string)
 		err = mgr.Restart()
 	case "reload":
 		err = mgr.Reload()
+	case "status":
+		err = mgr.Status()
 	case "--install", "install":
 		err = mgr.Install()
 	case "--uninstall", "uninstall":
@@ -663,6 +680,7 @@ func printServiceHelp() {
 	fmt.Println("  stop         - Stop the service")
 	fmt.Println("  restart      - Restart the service")
 	fmt.Println("  reload       - Reload service configuration")
+	fmt.Println("  status       - Show service status")
 	fmt.Println("  --install    - Install service for automatic startup")
 	fmt.Println("  --uninstall  - Remove service")
 	fmt.Println("  --disable    - Disable service from starting at boot")
@@ -671,7 +689,7 @@ func printServiceHelp() {
 }
 
 // handleMaintenanceCommand processes --maintenance flag commands
-func handleMaintenanceCommand(command, dbDriver, dbSource, dataDir, configDir, backupDir string) {
+func handleMaintenanceCommand(command, dbDriver, dbSource, dataDir, configDir, backupDir string, yamlCfg *config.YAMLConfig, opts maintenanceOptions) {
 	parts := strings.Fields(command)
 	if len(parts) == 0 {
 		fmt.Fprintf(os.Stderr, "Maintenance command required\n")
@@ -685,6 +703,14 @@ func handleMaintenanceCommand(command, dbDriver, dbSource, dataDir, configDir, b
 		arg = parts[1]
 	}
 
+	switch action {
+	case "backup", "verify", "mode", "export-archive", "export":
+		if opts.DryRun {
+			fmt.Fprintf(os.Stderr, "--dry-run is not supported by %s\n", action)
+			os.Exit(1)
+		}
+	}
+
 	switch action {
 	case "backup":
 		err := performBackup(dbDriver, dbSource, dataDir, configDir, backupDir, arg)
@@ -694,14 +720,58 @@ func handleMaintenanceCommand(command, dbDriver, dbSource, dataDir, configDir, b
 		}
 		os.Exit(0)
 
+	case "verify":
+		err := performVerify(backupDir, arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Verify failed: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+
 	case "restore":
-		err := performRestore(dbDriver, dbSource, dataDir, configDir, backupDir, arg)
+		err := performRestore(dbDriver, dbSource, dataDir, configDir, backupDir, arg, opts)
+		exitMaintenance("Restore", err)
+
+	case "cleanup":
+		err := performCleanup(dbDriver, dbSource, dataDir, opts)
+		exitMaintenance("Cleanup", err)
+
+	case "migrate":
+		err := performMigrate(dbDriver, dbSource, dataDir, configDir, backupDir, opts)
+		exitMaintenance("Migration", err)
+
+	case "gc":
+		err := performGC(yamlCfg, dbDriver, dbSource, dataDir, opts)
+		exitMaintenance("Garbage collection", err)
+
+	case "fsck":
+		err := performFsck(dbDriver, dbSource, dataDir, arg, opts)
+		exitMaintenance("Fsck", err)
+
+	case "compress":
+		err := performCompress(yamlCfg, dbDriver, dbSource, dataDir, opts)
+		exitMaintenance("Compression", err)
+
+	case "export-archive":
+		err := performExportArchive(dbDriver, dbSource, dataDir, parts[1:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Archive export failed: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+
+	case "export":
+		err := performExport(dbDriver, dbSource, dataDir, backupDir, parts[1:])
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Restore failed: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Export failed: %v\n", err)
 			os.Exit(1)
 		}
 		os.Exit(0)
 
+	case "import":
+		err := performImport(yamlCfg, dbDriver, dbSource, dataDir, arg, opts)
+		exitMaintenance("Import", err)
+
 	case "mode":
 		if arg == "" {
 			fmt.Fprintf(os.Stderr, "Mode argument required: enabled or disabled\n")
@@ -730,42 +800,106 @@ func printMaintenanceHelp() {
 	fmt.Println()
 	fmt.Println("Commands:")
 	fmt.Println("  backup [filename]         - Full disaster recovery backup (default: backup-YYYYMMDD-HHMMSS.tar.gz)")
-	fmt.Println("  restore [filename]        - Restore from backup (default: latest backup)")
+	fmt.Println("  restore [filename]        - Restore from backup (default: latest backup); verified before anything is written")
+	fmt.Println("  verify [filename]         - Check a backup against its SHA-256 manifest (default: latest backup)")
+	fmt.Println("  cleanup                   - Delete expired pastes now")
+	fmt.Println("  migrate                   - Copy pastes to the database the config now points at")
+	fmt.Println("  gc                        - Remove orphaned rows, expired sessions and unused blobs")
+	fmt.Println("  fsck [repair]             - Check references, paste bodies and expiry; repair what can be repaired")
+	fmt.Println("  compress                  - Compress the bodies of existing pastes as new ones are")
 	fmt.Println("  mode {enabled|disabled}   - Enable or disable maintenance mode")
+	fmt.Println("  export-archive [dir] [incremental] [prune]")
+	fmt.Println("                            - Render public pastes to a static HTML + raw tree (default: {data}/archive)")
+	fmt.Println("  export [file] [accounts]  - Export pastes, and users and organizations with accounts, independent of the")
+	fmt.Println("                              database (.jsonl, .jsonl.gz, .tar or .tar.gz; default: export-YYYYMMDD-HHMMSS.jsonl.gz)")
+	fmt.Println("  import {file}             - Add the pastes, users and organizations of an export that are not here yet")
+	fmt.Println()
+	fmt.Println("Options:")
+	fmt.Println("  --dry-run                 - Show what restore, cleanup, migrate, gc, fsck repair, compress or import would change, and change nothing")
+	fmt.Println("  --yes                     - Do not ask before restore, cleanup, migrate, gc, fsck repair, compress or import (required without a terminal)")
 	fmt.Println()
 	fmt.Println("Backup includes:")
 	fmt.Println("  - Config directory (server.yml and all config files)")
 	fmt.Println("  - Data directory (db/caspaste.db and all data)")
 	fmt.Println("  - External SQLite database (if located outside data_dir/db/)")
+	fmt.Println("  - SHA256SUMS, the checksum of every file in the backup")
 	fmt.Println()
 	fmt.Println("Note: When using PostgreSQL/MariaDB, db/caspaste.db is a synchronized cache")
 	fmt.Println("      that's included in backups for instant disaster recovery.")
 	fmt.Println()
 }
 
-// checkAndMigrateDatabase checks if database driver/source changed and auto-migrates if needed
-func checkAndMigrateDatabase(dataDir, configDir, backupDir, newDriver, newSource string) error {
-	stateFile := dataDir + "/.db-state"
+// masterKeySource builds the master keyring source from config
+func masterKeySource(yamlCfg *config.YAMLConfig, configDir string) secrets.Source {
+	src := secrets.Source{
+		File:    yamlCfg.Security.MasterKey.File,
+		Env:     yamlCfg.Security.MasterKey.Env,
+		Command: yamlCfg.Security.MasterKey.Command,
+	}
+	if src.File == "" {
+		src.File = filepath.Join(configDir, "master.key")
+	}
+	return src
+}
 
-	// Read previous database state if exists
-	oldStateData, err := os.ReadFile(stateFile)
-	var oldDriver, oldSource string
-	if err == nil {
-		parts := strings.SplitN(string(oldStateData), "\n", 2)
-		if len(parts) >= 1 {
-			oldDriver = strings.TrimSpace(parts[0])
-		}
-		if len(parts) >= 2 {
-			oldSource = strings.TrimSpace(parts[1])
-		}
+// masterCipher loads the master keyring; a missing keyring file is created
+func masterCipher(yamlCfg *config.YAMLConfig, configDir string) (*secrets.Cipher, error) {
+	keyring, err := secrets.LoadKeyring(masterKeySource(yamlCfg, configDir))
+	if err != nil {
+		return nil, fmt.Errorf("security.master_key: %w", err)
 	}
+	return secrets.NewCipher(keyring), nil
+}
 
-	// Normalize driver names for comparison
-	normalizedNew := normalizeDriverName(newDriver)
-	normalizedOld := normalizeDriverName(oldDriver)
+// handleRotateKeysCommand rotates the master key and re-wraps every encrypted secret
+// Values still stored in plaintext are encrypted during the same pass
+func handleRotateKeysCommand(yamlCfg *config.YAMLConfig, configDir string) {
+	keyring, err := secrets.LoadKeyring(masterKeySource(yamlCfg, configDir))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load master key: %v\n", err)
+		os.Exit(1)
+	}
+
+	// File-backed keyrings get a fresh key; env/command keyrings are rotated at the
+	// source and must list the new key first with old keys kept below it
+	if err := keyring.Rotate(); err != nil && !errors.Is(err, secrets.ErrRotateReadOnly) {
+		fmt.Fprintf(os.Stderr, "Failed to generate new master key: %v\n", err)
+		os.Exit(1)
+	}
+	current, _ := keyring.Current()
+	fmt.Printf("Current master key: %s\n", current.ID)
+
+	db, err := storage.NewPool(yamlCfg.Database.Driver, yamlCfg.Database.Source, 1, 0, yamlCfg.Directories.Data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open database: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	results, err := secrets.RewrapAll(db.Pool(), secrets.NewCipher(keyring))
+	for _, res := range results {
+		fmt.Printf("  %s.%s: %d scanned, %d re-wrapped\n", res.Column.Table, res.Column.Column, res.Scanned, res.Rewrapped)
+	}
+	if err != nil {
+		// Old keys are kept so already re-wrapped rows and pending rows both stay readable
+		fmt.Fprintf(os.Stderr, "Key rotation incomplete: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Old keys were kept; re-run --rotate-keys to finish.\n")
+		os.Exit(1)
+	}
+
+	if err := keyring.Prune(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to remove retired master keys: %v\n", err)
+	}
+	fmt.Println("Key rotation complete")
+	fmt.Println("Start the servers again to load the new master key.")
+}
+
+// checkAndMigrateDatabase checks if database driver/source changed and auto-migrates if needed
+func checkAndMigrateDatabase(dataDir, configDir, backupDir, newDriver, newSource string) error {
+	stateFile := filepath.Join(dataDir, ".db-state")
 
 	// If driver changed, perform automatic migration
-	if oldDriver != "" && oldSource != "" && (normalizedOld != normalizedNew || oldSource != newSource) {
+	if oldDriver, oldSource, ok := pendingMigration(dataDir, newDriver, newSource); ok {
 		fmt.Println()
 		fmt.Println("⚠️  Database configuration change detected!")
 		fmt.Printf("Old: %s (%s)\n", oldDriver, oldSource)
@@ -777,7 +911,7 @@ func checkAndMigrateDatabase(dataDir, configDir, backupDir, newDriver, newSource
 
 		// Create backup before migration
 		backupFilename := "pre-migration-" + time.Now().Format("20060102-150405") + ".tar.gz"
-		fmt.Printf("Creating safety backup: %s\n", backupDir+"/"+backupFilename)
+		fmt.Printf("Creating safety backup: %s\n", filepath.Join(backupDir, backupFilename))
 		performBackup(oldDriver, oldSource, dataDir, configDir, backupDir, backupFilename)
 
 		// Perform migration
@@ -799,7 +933,7 @@ func checkAndMigrateDatabase(dataDir, configDir, backupDir, newDriver, newSource
 
 	// Save current database state for next startup
 	stateData := newDriver + "\n" + newSource
-	err = os.WriteFile(stateFile, []byte(stateData), 0644)
+	err := os.WriteFile(stateFile, []byte(stateData), 0644)
 	if err != nil {
 		fmt.Printf("Warning: failed to save database state: %v\n", err)
 	}
@@ -807,6 +941,29 @@ func checkAndMigrateDatabase(dataDir, configDir, backupDir, newDriver, newSource
 	return nil
 }
 
+// pendingMigration reports the database the server last ran with when the
+// config now points at a different one
+func pendingMigration(dataDir, newDriver, newSource string) (oldDriver, oldSource string, ok bool) {
+	// Read previous database state if exists
+	oldStateData, err := os.ReadFile(filepath.Join(dataDir, ".db-state"))
+	if err == nil {
+		parts := strings.SplitN(string(oldStateData), "\n", 2)
+		if len(parts) >= 1 {
+			oldDriver = strings.TrimSpace(parts[0])
+		}
+		if len(parts) >= 2 {
+			oldSource = strings.TrimSpace(parts[1])
+		}
+	}
+
+	// Normalize driver names for comparison
+	normalizedNew := normalizeDriverName(newDriver)
+	normalizedOld := normalizeDriverName(oldDriver)
+
+	ok = oldDriver != "" && oldSource != "" && (normalizedOld != normalizedNew || oldSource != newSource)
+	return oldDriver, oldSource, ok
+}
+
 // normalizeDriverName normalizes driver names for comparison and usage
 func normalizeDriverName(driver string) string {
 	driver = strings.ToLower(driver)
@@ -838,60 +995,23 @@ func performBackup(dbDriver, dbSource, dataDir, configDir, backupDir, filename s
 		return fmt.Errorf("failed to create backup directory: %w", err)
 	}
 
-	backupPath := backupDir + "/" + filename
+	backupPath := filepath.Join(backupDir, filename)
 
 	fmt.Println("Creating disaster recovery backup...")
 	fmt.Println("Backing up:")
 	fmt.Printf("  - Config: %s\n", configDir)
 	fmt.Printf("  - Data: %s\n", dataDir)
 
-	// Check if database is outside data_dir/db
-	expectedDbPath := dataDir + "/db/"
-	dbIsExternal := false
-	if !strings.HasPrefix(dbSource, expectedDbPath) && (dbDriver == "sqlite3" || dbDriver == "sqlite") {
-		dbIsExternal = true
+	externalDB := backupExternalDB(dbDriver, dbSource, dataDir)
+	if externalDB != "" {
 		fmt.Printf("  - Database: %s (external)\n", dbSource)
 	}
 
 	fmt.Printf("Destination: %s\n", backupPath)
 	fmt.Println()
 
-	// Create temporary directory for staging backup
-	tempDir := dataDir + "/.backup-temp"
-	os.MkdirAll(tempDir, 0755)
-	defer os.RemoveAll(tempDir)
-
-	// Copy data directory
-	cmd := exec.Command("cp", "-r", dataDir, tempDir+"/data")
-	cmd.Run()
-
-	// Copy config directory if exists
-	if configDir != "" {
-		if _, err := os.Stat(configDir); err == nil {
-			cmd = exec.Command("cp", "-r", configDir, tempDir+"/config")
-			cmd.Run()
-		}
-	}
-
-	// Copy external database if needed
-	if dbIsExternal {
-		os.MkdirAll(tempDir+"/external-db", 0755)
-		cmd = exec.Command("cp", dbSource, tempDir+"/external-db/caspaste.db")
-		cmd.Run()
-	}
-
-	// Create tar.gz archive
-	cmd = exec.Command("tar", "-czf", backupPath,
-		"--exclude=backups",
-		"--exclude=.backup-temp",
-		"--exclude=*.tmp",
-		"--exclude=*.lock",
-		"-C", tempDir,
-		".")
-
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("backup failed: %w\nOutput: %s", err, string(output))
+	if err := writeBackup(backupPath, dataDir, configDir, externalDB, backupOptions{Progress: true}); err != nil {
+		return fmt.Errorf("backup failed: %w", err)
 	}
 
 	// Get backup file size
@@ -906,97 +1026,58 @@ func performBackup(dbDriver, dbSource, dataDir, configDir, backupDir, filename s
 }
 
 // performRestore performs full disaster recovery restore from backup archive
-func performRestore(dbDriver, dbSource, dataDir, configDir, backupDir, filename string) error {
+func performRestore(dbDriver, dbSource, dataDir, configDir, backupDir, filename string, opts maintenanceOptions) error {
 	if dataDir == "" {
 		dataDir = getDefaultDataDir()
 	}
 
 	// If no filename, find latest backup
 	if filename == "" {
-		entries, err := os.ReadDir(backupDir)
+		latest, err := latestBackup(backupDir)
 		if err != nil {
-			return fmt.Errorf("failed to read backup directory: %w", err)
-		}
-
-		var latestFile string
-		var latestTime int64
-
-		for _, entry := range entries {
-			if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".tar.gz") {
-				info, err := entry.Info()
-				if err != nil {
-					continue
-				}
-				if info.ModTime().Unix() > latestTime {
-					latestTime = info.ModTime().Unix()
-					latestFile = entry.Name()
-				}
-			}
-		}
-
-		if latestFile == "" {
-			return fmt.Errorf("no backup files found in %s", backupDir)
+			return err
 		}
-
-		filename = latestFile
+		filename = latest
 		fmt.Printf("Using latest backup: %s\n", filename)
 	}
 
-	backupPath := backupDir + "/" + filename
+	backupPath := backupFilePath(backupDir, filename)
 
 	// Check backup exists
 	if _, err := os.Stat(backupPath); err != nil {
 		return fmt.Errorf("backup file not found: %s", backupPath)
 	}
 
-	// Create safety backup of current state
-	fmt.Println("Creating safety backup of current state...")
-	performBackup(dbDriver, dbSource, dataDir, configDir, backupDir, "pre-restore-"+time.Now().Format("20060102-150405")+".tar.gz")
-
-	// Create temporary extraction directory
-	tempDir := dataDir + "/.restore-temp"
-	os.MkdirAll(tempDir, 0755)
-	defer os.RemoveAll(tempDir)
-
-	// Extract backup archive to temp directory
-	fmt.Printf("Restoring from: %s\n", backupPath)
-	fmt.Println("Extracting backup archive...")
+	if opts.DryRun {
+		return printRestorePlan(dbDriver, dbSource, dataDir, configDir, backupDir, backupPath)
+	}
+	if err := confirmMaintenance(fmt.Sprintf("Restore %s over %s?", filename, dataDir), opts); err != nil {
+		return err
+	}
 
-	cmd := exec.Command("tar", "-xzf", backupPath, "-C", tempDir)
-	output, err := cmd.CombinedOutput()
+	// Nothing is written until the whole archive has been read back
+	fmt.Printf("Verifying %s\n", backupPath)
+	checked, err := verifyBackup(backupPath)
 	if err != nil {
-		return fmt.Errorf("restore failed: %w\nOutput: %s", err, string(output))
+		return err
 	}
-
-	// Restore data directory
-	if _, err := os.Stat(tempDir + "/data"); err == nil {
-		fmt.Println("Restoring data directory...")
-		cmd = exec.Command("cp", "-r", tempDir+"/data/.", dataDir)
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("failed to restore data directory: %w", err)
-		}
+	if !checked {
+		fmt.Println("Backup has no checksum manifest (made by an older release); it was only checked for being readable")
 	}
 
-	// Restore config directory
-	if configDir != "" {
-		if _, err := os.Stat(tempDir + "/config"); err == nil {
-			fmt.Println("Restoring config directory...")
-			cmd = exec.Command("cp", "-r", tempDir+"/config/.", configDir)
-			if err := cmd.Run(); err != nil {
-				return fmt.Errorf("failed to restore config directory: %w", err)
-			}
-		}
+	// Create safety backup of current state
+	fmt.Println("Creating safety backup of current state...")
+	if err := performBackup(dbDriver, dbSource, dataDir, configDir, backupDir, "pre-restore-"+time.Now().Format("20060102-150405")+".tar.gz"); err != nil {
+		return fmt.Errorf("safety backup failed, nothing was restored: %w", err)
 	}
 
-	// Restore external database if exists
-	if _, err := os.Stat(tempDir + "/external-db/caspaste.db"); err == nil {
-		fmt.Println("Restoring external database...")
-		if dbDriver == "sqlite3" || dbDriver == "sqlite" {
-			cmd = exec.Command("cp", tempDir+"/external-db/caspaste.db", dbSource)
-			if err := cmd.Run(); err != nil {
-				return fmt.Errorf("failed to restore external database: %w", err)
-			}
-		}
+	// Data, config and the external database are written over in place
+	fmt.Printf("Restoring from: %s\n", backupPath)
+	err = extractBackup(backupPath, func(name string) string {
+		return restoreTarget(name, dbDriver, dbSource, dataDir, configDir)
+	})
+	if err != nil {
+		return err
 	}
 
 	fmt.Println()
@@ -1009,6 +1090,152 @@ func performRestore(dbDriver, dbSource, dataDir, configDir, backupDir, filename
 	return nil
 }
 
+// performExportArchive renders all public pastes to a static tree
+// Arguments are an optional output directory plus the keywords "incremental" and "prune"
+func performExportArchive(dbDriver, dbSource, dataDir string, args []string) error {
+	if dataDir == "" {
+		dataDir = getDefaultDataDir()
+	}
+
+	opts := archive.Options{Dir: filepath.Join(dataDir, "archive")}
+	for _, arg := range args {
+		switch arg {
+		case "incremental":
+			opts.Incremental = true
+		case "prune":
+			opts.Prune = true
+		default:
+			opts.Dir = arg
+		}
+	}
+
+	db, err := storage.NewPool(dbDriver, dbSource, 1, 0, dataDir)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	// Large paste bodies may be in the blob store; nothing is written, so no thresholds
+	blobStore, err := blob.NewFS(filepath.Join(dataDir, "blobs"))
+	if err != nil {
+		return err
+	}
+	db.SetBodyPolicy(storage.NewBodyPolicy(storage.BodyPolicyConfig{}, blobStore))
+
+	fmt.Printf("Exporting public pastes to %s\n", opts.Dir)
+	result, err := archive.Export(db, opts)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Exported %d pastes (%d written, %d unchanged, %d files removed)\n",
+		result.Total, result.Written, result.Unchanged, len(result.Removed))
+	return nil
+}
+
+// startMirrorScheduler schedules regeneration of the static read-only mirror
+func startMirrorScheduler(yamlCfg *config.YAMLConfig, db storage.DB, log logger.Logger, elector *leader.Elector) {
+	mirrorCfg := mirror.Config{
+		Dir:   yamlCfg.Server.Mirror.Dir,
+		Title: yamlCfg.Server.Title,
+	}
+
+	bucketCfg := yamlCfg.Server.Mirror.S3
+	if bucketCfg.Endpoint != "" {
+		bucket, err := s3.New(s3.Config{
+			Endpoint:  bucketCfg.Endpoint,
+			Region:    bucketCfg.Region,
+			Bucket:    bucketCfg.Bucket,
+			Prefix:    bucketCfg.Prefix,
+			AccessKey: bucketCfg.AccessKey,
+			SecretKey: bucketCfg.SecretKey,
+		})
+		if err != nil {
+			log.Error(errors.New("Mirror disabled: " + err.Error()))
+			return
+		}
+		mirrorCfg.Bucket = bucket
+	}
+
+	schedule := yamlCfg.Server.Mirror.Schedule
+	if schedule == "" {
+		schedule = "0 * * * *"
+	}
+
+	schedCfg := scheduler.DefaultConfig()
+	schedCfg.IsLeader = elector.IsLeader
+	sched := scheduler.New(schedCfg)
+	err := sched.AddTask(&scheduler.Task{
+		ID:          "static-mirror",
+		Name:        "Static mirror",
+		Description: "Regenerate the static read-only mirror of public pastes",
+		Schedule:    schedule,
+		Enabled:     true,
+		Skippable:   true,
+		LeaderOnly:  true,
+		Handler: func(ctx context.Context) error {
+			result, err := mirror.Run(ctx, db, mirrorCfg)
+			if err != nil {
+				log.Error(errors.New("Mirror: " + err.Error()))
+				return err
+			}
+			log.Info(fmt.Sprintf("Mirror updated: %d pastes, %d written, %d uploaded, %d deleted",
+				result.Archive.Total, result.Archive.Written, result.Uploaded, result.Deleted))
+			return nil
+		},
+	})
+	if err != nil {
+		log.Error(errors.New("Mirror disabled: " + err.Error()))
+		return
+	}
+	sched.Start()
+
+	// Build the mirror right away rather than waiting for the first slot
+	go sched.RunNow("static-mirror")
+}
+
+// startMaintenanceScheduler reloads the maintenance windows every minute so
+// changes made on another replica are seen, and logs windows starting and ending
+// Requests are checked against the window times directly, not this job
+func startMaintenanceScheduler(schedule *maintenance.Schedule, log logger.Logger, elector *leader.Elector) {
+	sched := scheduler.New(scheduler.DefaultConfig())
+	err := sched.AddTask(&scheduler.Task{
+		ID:          "maintenance-windows",
+		Name:        "Maintenance windows",
+		Description: "Enter and leave scheduled maintenance windows",
+		Schedule:    "* * * * *",
+		Enabled:     true,
+		Skippable:   true,
+		Handler: func(ctx context.Context) error {
+			started, ended, err := schedule.Refresh(time.Now())
+			if err != nil {
+				log.Error(errors.New("Maintenance windows: " + err.Error()))
+				return err
+			}
+			// Every replica logs its own state; the audit log gets one entry
+			if ended != nil {
+				log.Info("Maintenance window " + ended.ID + " ended")
+				if elector.IsLeader() {
+					audit.MaintenanceWindow(audit.EventMaintenanceExit, ended.ID, ended.EndsAt)
+				}
+			}
+			if started != nil {
+				log.Info(fmt.Sprintf("Maintenance window %s started, ends %s", started.ID,
+					time.Unix(started.EndsAt, 0).UTC().Format(time.RFC3339)))
+				if elector.IsLeader() {
+					audit.MaintenanceWindow(audit.EventMaintenanceEnter, started.ID, started.EndsAt)
+				}
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		log.Error(errors.New("Maintenance windows: " + err.Error()))
+		return
+	}
+	sched.Start()
+}
+
 // setMaintenanceMode enables or disables maintenance mode
 func setMaintenanceMode(dataDir, mode string) error {
 	// Ensure data directory exists
@@ -1125,6 +1352,7 @@ func handleDebugConfig(cfg *config.YAMLConfig) http.HandlerFunc {
 				"public":      cfg.Server.Public,
 				"listen":      cfg.Server.Listen,
 				"port":        cfg.Server.Port,
+				"listeners":   cfg.Server.Listeners,
 				"timeouts": map[string]interface{}{
 					"read":  cfg.Server.Timeouts.Read,
 					"write": cfg.Server.Timeouts.Write,
@@ -1218,6 +1446,12 @@ func main() {
 		return
 	}
 
+	// The Windows service manager expects a reply within seconds of starting
+	if service.RunningAsService() {
+		service.Start("caspaste")
+		defer service.Stopped()
+	}
+
 	var err error
 
 	// Set timezone from TZ environment variable (default: America/New_York)
@@ -1274,8 +1508,15 @@ func main() {
 	flagDaemon := c.AddBoolVar("daemon", "Start in background (daemon mode)")
 	flagDebug := c.AddBoolVar("debug", "Enable debug logging to debug.log")
 	flagStatus := c.AddBoolVar("status", "Check server health and database connectivity. Exit codes: 0=healthy, 1=unhealthy, 2=error")
+	flagConfigCheck := c.AddBoolVar("config-check", "Check every setting of the config file and exit. Exit codes: 0=valid, 1=invalid")
 	flagService := c.AddStringVar("service", "", "Service management: start, stop, restart, reload, install, uninstall, disable, help", nil)
-	flagMaintenance := c.AddStringVar("maintenance", "", "Maintenance mode: backup [filename], restore [filename], mode {enabled|disabled}", nil)
+	flagMaintenance := c.AddStringVar("maintenance", "", "Maintenance mode: backup [filename], restore [filename], cleanup, migrate, gc, fsck [repair], compress, mode {enabled|disabled}, export-archive [dir]", nil)
+	flagDryRun := c.AddBoolVar("dry-run", "With --maintenance: report what restore, cleanup, migrate or gc would change without changing anything")
+	flagYes := c.AddBoolVar("yes", "With --maintenance: do not ask for confirmation, for automation")
+	flagRotateKeys := c.AddBoolVar("rotate-keys", "Rotate the master key and re-encrypt stored secrets, then exit")
+	flagMigrate := c.AddStringVar("migrate", "", "Schema migrations: status, up (apply pending), down (roll back the latest)", nil)
+	flagTelemetry := c.AddStringVar("telemetry", "", "Telemetry: show (print the opt-in usage ping payload)", nil)
+	flagContainer := c.AddBoolVar("container", "Container mode: JSON logs on stdout/stderr, settings from the environment, no PID file, user switching or self-update (auto-detected)")
 
 	// Directory flags
 	flagPort := c.AddStringVar("port", "", "Port to listen on (alternative to specifying in --address). Examples: 80, 8080, 443.", nil)
@@ -1302,6 +1543,7 @@ func main() {
 		fmt.Println("  --version           Show version information")
 		fmt.Println("  --daemon            Start in background (daemon mode)")
 		fmt.Println("  --debug             Enable debug logging")
+		fmt.Println("  --container         Container mode (auto-detected; CASPASTE_CONTAINER=false to disable)")
 		fmt.Println("\nServer Configuration:")
 		fmt.Println("  --address ADDR      Listen address (default: :80)")
 		fmt.Println("  --port PORT         Listen port (alternative to --address)")
@@ -1315,9 +1557,15 @@ func main() {
 		fmt.Println("  --pid FILE          PID file path")
 		fmt.Println("\nCommands:")
 		fmt.Println("  --status            Check server health")
+		fmt.Println("  --config-check      Check the config file and exit")
 		fmt.Println("  --service CMD       Service management (start|stop|restart|reload|install|uninstall|disable)")
-		fmt.Println("  --maintenance CMD   Maintenance operations (backup|restore|mode)")
+		fmt.Println("  --maintenance CMD   Maintenance operations (backup|restore|cleanup|migrate|gc|fsck|compress|mode|export-archive)")
+		fmt.Println("  --dry-run           With --maintenance: show what would change, change nothing")
+		fmt.Println("  --yes               With --maintenance: skip confirmation prompts")
 		fmt.Println("  --update [CMD]      Check/perform updates (--update --help for details)")
+		fmt.Println("  --rotate-keys       Rotate the master key for secrets at rest")
+		fmt.Println("  --migrate CMD       Schema migrations (status|up|down)")
+		fmt.Println("  --telemetry show    Print what the opt-in usage ping sends")
 		fmt.Println("\nShell Completions:")
 		fmt.Println("  --shell completions [SHELL]   Print shell completion script")
 		fmt.Println("  --shell init [SHELL]          Print shell init command for eval")
@@ -1351,6 +1599,15 @@ func main() {
 		}
 	}
 
+	// Container mode: the runtime supervises, logs and updates the process,
+	// so flags that manage the host are refused before any side effects
+	containerMode := isContainerMode(*flagContainer)
+	if containerMode {
+		if err := checkContainerFlags(*flagDaemon, *flagService, *flagUpdate); err != nil {
+			exitOnError(err)
+		}
+	}
+
 	// Setup log directory (needed early for daemon mode)
 	if *flagLog == "" && *flagLogsDir != "" {
 		*flagLog = *flagLogsDir
@@ -1358,7 +1615,9 @@ func main() {
 	if *flagLog == "" {
 		*flagLog = "/var/log/casjay-forks/caspaste"
 	}
-	os.MkdirAll(*flagLog, 0755)
+	if !containerMode {
+		os.MkdirAll(*flagLog, 0755)
+	}
 
 	// Handle --daemon mode (fork process and exit)
 	if *flagDaemon {
@@ -1440,12 +1699,12 @@ func main() {
 		if dataDir == "" {
 			dataDir = getDefaultDataDir()
 		}
-		if cfg.Database.Driver == "sqlite" && !strings.HasPrefix(cfg.Database.Source, "/") {
+		if cfg.Database.Driver == "sqlite" && !filepath.IsAbs(cfg.Database.Source) {
 			dbDir := os.Getenv("CASPASTE_DB_DIR")
 			if dbDir == "" {
-				dbDir = dataDir + "/db"
+				dbDir = filepath.Join(dataDir, "db")
 			}
-			cfg.Database.Source = dbDir + "/caspaste.db"
+			cfg.Database.Source = filepath.Join(dbDir, "caspaste.db")
 		}
 
 		// Run health check and exit
@@ -1489,17 +1748,22 @@ func main() {
 	configPaths := []string{}
 	if *flagConfigDir != "" {
 		// When --config is explicitly set, ONLY look in that directory
-		configPaths = append(configPaths, *flagConfigDir+"/server.yml")
+		configPaths = append(configPaths, filepath.Join(*flagConfigDir, "server.yml"))
 	} else {
 		// When --config is NOT set, search platform-specific and standard locations
 		defaultConfigDir := getDefaultConfigDir()
 		configPaths = append(configPaths,
-			defaultConfigDir+"/server.yml",
+			filepath.Join(defaultConfigDir, "server.yml"),
 			"/etc/casjay-forks/caspaste/server.yml",
 			"/config/server.yml",
 		)
 	}
 
+	// Checked before a missing config file would be generated
+	if *flagConfigCheck {
+		handleConfigCheck(configPaths, containerMode)
+	}
+
 	for _, path := range configPaths {
 		cfg, err := config.LoadYAMLConfig(path)
 		if err == nil {
@@ -1513,13 +1777,17 @@ func main() {
 	isFirstRun := false
 	
 	// If no config file found, create default config
-	if yamlCfg == nil {
+	// Containers build it from defaults and the environment without writing it
+	if yamlCfg == nil && containerMode {
+		yamlCfg = config.DefaultYAMLConfig()
+		configFilePath = "(environment)"
+	} else if yamlCfg == nil {
 		isFirstRun = true
 		var defaultConfigPath string
 		if *flagConfigDir != "" {
-			defaultConfigPath = *flagConfigDir + "/server.yml"
+			defaultConfigPath = filepath.Join(*flagConfigDir, "server.yml")
 		} else {
-			defaultConfigPath = getDefaultConfigDir() + "/server.yml"
+			defaultConfigPath = filepath.Join(getDefaultConfigDir(), "server.yml")
 		}
 
 		if err := config.GenerateDefaultYAMLConfig(defaultConfigPath); err != nil {
@@ -1535,6 +1803,15 @@ func main() {
 		configFilePath = defaultConfigPath
 	}
 
+	// Containers take environment variables and CLI flags on every run,
+	// and listen on a fixed port rather than a generated one
+	if containerMode {
+		isFirstRun = true
+		if yamlCfg.Server.Port == "" {
+			yamlCfg.Server.Port = containerPort
+		}
+	}
+
 	// ONLY apply environment variables and CLI flags on FIRST RUN
 	// After first run, config file is the source of truth
 	if isFirstRun {
@@ -1547,6 +1824,38 @@ func main() {
 	// This allows containerized deployments to change auth settings without deleting config
 	config.ApplyCriticalOverrides(yamlCfg)
 
+	// Fail fast on misconfiguration instead of starting with surprises
+	if containerMode {
+		if err := validateContainerConfig(yamlCfg); err != nil {
+			exitOnError(fmt.Errorf("invalid configuration:\n%w", err))
+		}
+	}
+
+	// The crypto policy and Argon2id parameters are set before any password
+	// is hashed or connection is made
+	cryptopolicy.SetStrict(yamlCfg.Security.FIPS)
+	if err := caspasswd.SetParams(caspasswd.Params{
+		Time:    yamlCfg.Security.PasswordHashing.Time,
+		Memory:  yamlCfg.Security.PasswordHashing.Memory,
+		Threads: yamlCfg.Security.PasswordHashing.Threads,
+	}); err != nil {
+		exitOnError(fmt.Errorf("invalid security.password_hashing: %w", err))
+	}
+
+	// Admin credentials provided by the deployment (e.g. a Helm secret)
+	bootstrapAdmin, err := bootstrap.AdminFromEnv()
+	if err != nil {
+		exitOnError(err)
+	}
+
+	// A fresh interactive install finishes setup in the browser, unless the
+	// deployment already provisions the admin through the environment
+	if isFirstRun && !containerMode && bootstrapAdmin == nil {
+		if err := setup.MarkPending(filepath.Dir(configFilePath)); err != nil {
+			exitOnError(fmt.Errorf("failed to start setup: %w", err))
+		}
+	}
+
 	// Handle authentication setup
 	// If server.public=false (private instance), auto-generate admin credentials if needed
 	// These will be displayed in the startup banner
@@ -1559,8 +1868,12 @@ func main() {
 			yamlCfg.Security.PasswordFile = passwordFile
 		}
 
-		// Check if password file exists and has users
-		if !caspasswd.FileExistsAndHasUsers(passwordFile) {
+		if bootstrapAdmin != nil {
+			// Known credentials: nothing to generate or show in the banner
+			if err := caspasswd.SetUserHash(passwordFile, bootstrapAdmin.Username, bootstrapAdmin.PasswordHash); err != nil {
+				exitOnError(fmt.Errorf("failed to set admin credentials: %w", err))
+			}
+		} else if !caspasswd.FileExistsAndHasUsers(passwordFile) {
 			// Auto-generate admin credentials (will be shown in startup banner)
 			var err error
 			generatedUser, generatedPass, err = caspasswd.GenerateCredentialsFile(passwordFile)
@@ -1613,6 +1926,11 @@ func main() {
 		fmt.Printf("Auto-detected database driver: %s\n", detectedDriver)
 	}
 
+	// Refuse drivers no storage backend is registered for
+	if err := checkDatabaseDriver(yamlCfg.Database.Driver); err != nil {
+		exitOnError(err)
+	}
+
 	// Normalize database driver name (sqlite3 → sqlite, mariadb → mysql)
 	yamlCfg.Database.Driver = validation.NormalizeDriver(yamlCfg.Database.Driver)
 
@@ -1654,25 +1972,22 @@ func main() {
 	driver := yamlCfg.Database.Driver
 	if driver == "sqlite" {
 		// If database source is relative, make it absolute based on data directory
-		if !strings.HasPrefix(dbSource, "/") && dataDir != "" {
+		if !filepath.IsAbs(dbSource) && dataDir != "" {
 			// Check for environment variable ONLY on first run
 			if isFirstRun {
 				dbDir = os.Getenv("CASPASTE_DB_DIR")
 			}
 			if dbDir == "" {
 				// Default: {dataDir}/db
-				dbDir = dataDir + "/db"
+				dbDir = filepath.Join(dataDir, "db")
 			}
-			yamlCfg.Database.Source = dbDir + "/caspaste.db"
+			yamlCfg.Database.Source = filepath.Join(dbDir, "caspaste.db")
 			dbSource = yamlCfg.Database.Source
 		}
 
 		// Extract directory from database source path
-		if strings.Contains(dbSource, "/") {
-			lastSlash := strings.LastIndex(dbSource, "/")
-			if lastSlash > 0 {
-				dbDir = dbSource[:lastSlash]
-			}
+		if dir := filepath.Dir(dbSource); dir != "." {
+			dbDir = dir
 		}
 	}
 
@@ -1684,6 +1999,9 @@ func main() {
 	} else if isFirstRun {
 		backupDir = os.Getenv("CASPASTE_BACKUP_DIR")
 	}
+	if backupDir == "" {
+		backupDir = yamlCfg.Backup.Dir
+	}
 	if backupDir == "" && dataDir != "" {
 		// Platform-specific defaults
 		isRoot := isRunningAsRoot()
@@ -1695,7 +2013,7 @@ func main() {
 				if home := os.Getenv("HOME"); home != "" {
 					backupDir = home + "/.local/share/casjay-forks/caspaste/backups"
 				} else {
-					backupDir = dataDir + "/backups"
+					backupDir = filepath.Join(dataDir, "backups")
 				}
 			}
 		case "darwin":
@@ -1705,23 +2023,11 @@ func main() {
 				if home := os.Getenv("HOME"); home != "" {
 					backupDir = home + "/Library/Application Support/CasPaste/Backups"
 				} else {
-					backupDir = dataDir + "/backups"
+					backupDir = filepath.Join(dataDir, "backups")
 				}
 			}
 		case "windows":
-			if isRoot {
-				if programData := os.Getenv("ProgramData"); programData != "" {
-					backupDir = programData + "\\CasPaste\\Backups"
-				} else {
-					backupDir = "C:\\ProgramData\\CasPaste\\Backups"
-				}
-			} else {
-				if appdata := os.Getenv("APPDATA"); appdata != "" {
-					backupDir = appdata + "\\CasPaste\\Backups"
-				} else {
-					backupDir = dataDir + "/backups"
-				}
-			}
+			backupDir = getWindowsDir("Backups")
 		case "freebsd", "openbsd":
 			if isRoot {
 				backupDir = "/var/backups/caspaste"
@@ -1729,11 +2035,11 @@ func main() {
 				if home := os.Getenv("HOME"); home != "" {
 					backupDir = home + "/.caspaste/backups"
 				} else {
-					backupDir = dataDir + "/backups"
+					backupDir = filepath.Join(dataDir, "backups")
 				}
 			}
 		default:
-			backupDir = dataDir + "/backups"
+			backupDir = filepath.Join(dataDir, "backups")
 		}
 	}
 
@@ -1749,7 +2055,7 @@ func main() {
 				if home := os.Getenv("HOME"); home != "" {
 					cacheDir = home + "/.cache/caspaste"
 				} else {
-					cacheDir = dataDir + "/cache"
+					cacheDir = filepath.Join(dataDir, "cache")
 				}
 			}
 		case "darwin":
@@ -1759,19 +2065,11 @@ func main() {
 				if home := os.Getenv("HOME"); home != "" {
 					cacheDir = home + "/Library/Caches/CasPaste"
 				} else {
-					cacheDir = dataDir + "/cache"
+					cacheDir = filepath.Join(dataDir, "cache")
 				}
 			}
 		case "windows":
-			if isRoot {
-				cacheDir = "C:\\ProgramData\\CasPaste\\Cache"
-			} else {
-				if localAppData := os.Getenv("LOCALAPPDATA"); localAppData != "" {
-					cacheDir = localAppData + "\\CasPaste\\Cache"
-				} else {
-					cacheDir = dataDir + "/cache"
-				}
-			}
+			cacheDir = getWindowsDir("Cache")
 		case "freebsd", "openbsd":
 			if isRoot {
 				cacheDir = "/var/cache/caspaste"
@@ -1779,11 +2077,11 @@ func main() {
 				if home := os.Getenv("HOME"); home != "" {
 					cacheDir = home + "/.cache/caspaste"
 				} else {
-					cacheDir = dataDir + "/cache"
+					cacheDir = filepath.Join(dataDir, "cache")
 				}
 			}
 		default:
-			cacheDir = dataDir + "/cache"
+			cacheDir = filepath.Join(dataDir, "cache")
 		}
 	}
 
@@ -1802,7 +2100,7 @@ func main() {
 				if home := os.Getenv("HOME"); home != "" {
 					logsDir = home + "/.local/log/casjay-forks/caspaste"
 				} else {
-					logsDir = dataDir + "/logs"
+					logsDir = filepath.Join(dataDir, "logs")
 				}
 			}
 		case "darwin":
@@ -1812,19 +2110,11 @@ func main() {
 				if home := os.Getenv("HOME"); home != "" {
 					logsDir = home + "/Library/Logs/CasPaste"
 				} else {
-					logsDir = dataDir + "/logs"
+					logsDir = filepath.Join(dataDir, "logs")
 				}
 			}
 		case "windows":
-			if isRoot {
-				logsDir = "C:\\ProgramData\\CasPaste\\Logs"
-			} else {
-				if localAppData := os.Getenv("LOCALAPPDATA"); localAppData != "" {
-					logsDir = localAppData + "\\CasPaste\\Logs"
-				} else {
-					logsDir = dataDir + "/logs"
-				}
-			}
+			logsDir = getWindowsDir("Logs")
 		case "freebsd", "openbsd":
 			if isRoot {
 				logsDir = "/var/log/casjay-forks/caspaste"
@@ -1832,11 +2122,11 @@ func main() {
 				if home := os.Getenv("HOME"); home != "" {
 					logsDir = home + "/.local/log/casjay-forks/caspaste"
 				} else {
-					logsDir = dataDir + "/logs"
+					logsDir = filepath.Join(dataDir, "logs")
 				}
 			}
 		default:
-			logsDir = dataDir + "/logs"
+			logsDir = filepath.Join(dataDir, "logs")
 		}
 	}
 
@@ -1845,7 +2135,7 @@ func main() {
 	if configDir == "" {
 		configDir = getDefaultConfigDir()
 	}
-	saveConfigPath := configDir + "/server.yml"
+	saveConfigPath := filepath.Join(configDir, "server.yml")
 
 	// Save all determined directories to config NOW (before any privilege changes)
 	yamlCfg.Directories.Data = dataDir
@@ -1854,13 +2144,17 @@ func main() {
 	yamlCfg.Directories.Cache = cacheDir
 	yamlCfg.Directories.Logs = logsDir
 
-	if err := config.SaveYAMLConfig(saveConfigPath, yamlCfg); err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: failed to save directories to config: %v\n", err)
+	// Containers keep the environment as the source of truth (the config dir may be read-only)
+	if !containerMode {
+		if err := config.SaveYAMLConfig(saveConfigPath, yamlCfg); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save directories to config: %v\n", err)
+		}
 	}
 
 	// Setup user (Linux/BSD/macOS only) - must be done before creating directories
+	// Containers run as the user the image or runtime chose
 	var uid, gid int
-	if runtime.GOOS != "windows" {
+	if runtime.GOOS != "windows" && !containerMode {
 		var err error
 		uid, gid, err = privilege.EnsureUser()
 		if err != nil {
@@ -1894,9 +2188,9 @@ func main() {
 	// Handle --maintenance command (reads from config, no flags needed)
 	if *flagMaintenance != "" {
 		// Load config to get all paths
-		configPath := getDefaultConfigDir() + "/server.yml"
+		configPath := filepath.Join(getDefaultConfigDir(), "server.yml")
 		if *flagConfigDir != "" {
-			configPath = *flagConfigDir + "/server.yml"
+			configPath = filepath.Join(*flagConfigDir, "server.yml")
 		} else {
 			// Try to find config in standard locations
 			if _, err := os.Stat("/etc/casjay-forks/caspaste/server.yml"); err == nil {
@@ -1927,17 +2221,21 @@ func main() {
 		
 		// Determine backup directory
 		backupDirPath := ""
-		if _, err := os.Stat("/mnt/Backups/caspaste"); err == nil {
+		if cfg.Backup.Dir != "" {
+			backupDirPath = cfg.Backup.Dir
+		} else if _, err := os.Stat("/mnt/Backups/caspaste"); err == nil {
 			backupDirPath = "/mnt/Backups/caspaste"
 		} else {
 			home := os.Getenv("HOME")
 			if home != "" {
 				backupDirPath = home + "/.local/backups/caspaste"
 			} else {
-				backupDirPath = dataDir + "/backups"
+				backupDirPath = filepath.Join(dataDir, "backups")
 			}
 		}
-		os.MkdirAll(backupDirPath, 0755)
+		if !*flagDryRun {
+			os.MkdirAll(backupDirPath, 0755)
+		}
 		
 		fmt.Printf("Using configuration from: %s\n", configPath)
 		fmt.Printf("Data directory: %s\n", dataDir)
@@ -1945,7 +2243,32 @@ func main() {
 		fmt.Printf("Backup directory: %s\n", backupDirPath)
 		fmt.Println()
 		
-		handleMaintenanceCommand(*flagMaintenance, cfg.Database.Driver, cfg.Database.Source, dataDir, cfgDir, backupDirPath)
+		opts := maintenanceOptions{DryRun: *flagDryRun, Yes: *flagYes}
+		handleMaintenanceCommand(*flagMaintenance, cfg.Database.Driver, cfg.Database.Source, dataDir, cfgDir, backupDirPath, cfg, opts)
+		return
+	}
+
+	// Outbound connections, from the commands below too, go through the
+	// configured proxy, and offline mode holds for them as well
+	if err := configureOutbound(yamlCfg); err != nil {
+		exitOnError(fmt.Errorf("invalid network.outbound: %w", err))
+	}
+
+	// Handle --rotate-keys (needs resolved directories and database config)
+	if *flagRotateKeys {
+		handleRotateKeysCommand(yamlCfg, configDir)
+		return
+	}
+
+	// Handle --migrate (needs the database config)
+	if *flagMigrate != "" || hasArg("--migrate") {
+		handleMigrateCommand(*flagMigrate, yamlCfg)
+		return
+	}
+
+	// Handle --telemetry show (needs the database config for the paste count)
+	if *flagTelemetry != "" || hasArg("--telemetry") {
+		handleTelemetryCommand(*flagTelemetry, yamlCfg)
 		return
 	}
 
@@ -1976,6 +2299,12 @@ func main() {
 		maxLifeTime = int64(duration / time.Second)
 	}
 
+	switch yamlCfg.Server.Registration {
+	case "", config.RegistrationPublic, config.RegistrationPrivate, config.RegistrationDisabled:
+	default:
+		exitOnError(fmt.Errorf("invalid server.registration %q in config: use public, private or disabled", yamlCfg.Server.Registration))
+	}
+
 	// Determine FQDN for variable replacement
 	// Falls back to global IP if no valid FQDN found (never localhost)
 	fqdn, err := validation.DetermineFQDN("", yamlCfg.Server.FQDN)
@@ -1984,28 +2313,6 @@ func main() {
 		exitOnError(fmt.Errorf("failed to determine server address: %w", err))
 	}
 
-	// Load content with embedded defaults + file override
-	// Embedded files in src/web/data/ are used by default
-	// Config paths override embedded content if specified and file exists
-	serverAbout, err := web.LoadContentWithOverride("data/about.txt", yamlCfg.Web.Content.About)
-	if err != nil {
-		// Log warning but continue with empty content
-		fmt.Fprintf(os.Stderr, "Warning: failed to load about content: %v\n", err)
-		serverAbout = ""
-	}
-
-	serverRules, err := web.LoadContentWithOverride("data/rules.txt", yamlCfg.Web.Content.Rules)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: failed to load rules content: %v\n", err)
-		serverRules = ""
-	}
-
-	serverTermsOfUse, err := web.LoadContentWithOverride("data/terms.txt", yamlCfg.Web.Content.Terms)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: failed to load terms content: %v\n", err)
-		serverTermsOfUse = ""
-	}
-
 	// security.txt is auto-generated, not embedded
 	securityTxt := ""
 	if yamlCfg.Web.Content.Security != "" {
@@ -2042,9 +2349,6 @@ func main() {
 	}
 
 	// Apply variable replacement to content files
-	serverAbout = template.ReplaceVariables(serverAbout, templateVars)
-	serverRules = template.ReplaceVariables(serverRules, templateVars)
-	serverTermsOfUse = template.ReplaceVariables(serverTermsOfUse, templateVars)
 	securityTxt = template.ReplaceVariables(securityTxt, templateVars)
 
 	// Use replaced values in config (not raw values with variables)
@@ -2071,34 +2375,18 @@ func main() {
 		debugLogFile = "debug.log"
 	}
 	
-	// Open access.log - HTTP requests only
-	accessLogPath := filepath.Join(logsDir, accessLogFile)
-	accessLogFd, err := os.OpenFile(accessLogPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-	if err != nil {
-		exitOnError(fmt.Errorf("failed to open %s: %w", accessLogFile, err))
-	}
-	
-	// Open error.log - ERROR messages only
-	errorLogPath := filepath.Join(logsDir, errorLogFile)
-	errorLogFd, err := os.OpenFile(errorLogPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-	if err != nil {
-		exitOnError(fmt.Errorf("failed to open %s: %w", errorLogFile, err))
-	}
-	
-	// Open caspaste.log - Application log (INFO messages)
-	serverLogPath := filepath.Join(logsDir, serverLogFile)
-	serverLogFd, err := os.OpenFile(serverLogPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-	if err != nil {
-		exitOnError(fmt.Errorf("failed to open %s: %w", serverLogFile, err))
-	}
-	
-	// Open debug.log - DEBUG messages (only when --debug flag is used)
-	var debugLogFd *os.File
-	if *flagDebug {
-		debugLogPath := filepath.Join(logsDir, debugLogFile)
-		debugLogFd, err = os.OpenFile(debugLogPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-		if err != nil {
-			exitOnError(fmt.Errorf("failed to open %s: %w", debugLogFile, err))
+	// Containers log to stdout/stderr only, so no files are opened
+	var accessLogFd, errorLogFd, serverLogFd, debugLogFd *os.File
+	if !containerMode {
+		// access.log - HTTP requests only
+		accessLogFd = openLogFile(logsDir, accessLogFile)
+		// error.log - ERROR messages only
+		errorLogFd = openLogFile(logsDir, errorLogFile)
+		// caspaste.log - Application log (INFO messages)
+		serverLogFd = openLogFile(logsDir, serverLogFile)
+		// debug.log - DEBUG messages (only when --debug flag is used)
+		if *flagDebug {
+			debugLogFd = openLogFile(logsDir, debugLogFile)
 		}
 	}
 	// Note: Do NOT defer close - these files must stay open for the entire application lifetime
@@ -2116,6 +2404,9 @@ func main() {
 			MaskEmails:       yamlCfg.Logging.Audit.MaskEmails,
 			IncludeUserAgent: yamlCfg.Logging.Audit.IncludeUserAgent,
 		}
+		if containerMode {
+			auditCfg.Writer = os.Stdout
+		}
 		if err := audit.Init(auditCfg); err != nil {
 			exitOnError(fmt.Errorf("failed to initialize audit logging: %w", err))
 		}
@@ -2131,6 +2422,11 @@ func main() {
 		DurationBuckets: yamlCfg.Server.Metrics.DurationBuckets,
 		SizeBuckets:     yamlCfg.Server.Metrics.SizeBuckets,
 	}
+	metricsCfg.AllowedNets, err = metric.ParseAllowedIPs(yamlCfg.Server.Metrics.AllowedIPs)
+	if err != nil {
+		exitOnError(fmt.Errorf("invalid server.metrics.allowed_ips in config: %w", err))
+	}
+	metricsCfg.ClientIP = netshare.GetClientAddr
 	// Set defaults if not configured
 	if metricsCfg.Endpoint == "" {
 		metricsCfg.Endpoint = "/metrics"
@@ -2193,6 +2489,17 @@ func main() {
 		log.SetDebugWriter(debugLogFd)            // Debug logs
 	}
 	log.SetDebugMode(*flagDebug)
+
+	// Containers emit JSON lines: errors on stderr, everything else on stdout
+	if containerMode {
+		log.SetFormat(logger.LogFormat{Access: "json", Error: "json", Server: "json", Debug: "json"})
+		log.SetFileWriters(nil, nil)
+		log.SetWriters(os.Stdout, os.Stderr)
+		log.SetAccessLogWriter(os.Stdout)
+		if *flagDebug {
+			log.SetDebugWriter(os.Stdout)
+		}
+	}
 	
 	log.Debug("Configuration loaded from: " + configFilePath)
 	log.Debug("Data directory: " + *flagDataDir)
@@ -2218,17 +2525,136 @@ func main() {
 	}
 	log.Debug("Database connection pool created successfully")
 
+	// WORM mode must be set before db is copied into the handlers
+	if yamlCfg.Security.WORM {
+		db.SetWORM(true)
+		log.Info("WORM mode enabled: pastes cannot be edited or deleted before expiry")
+	}
+	logCryptoPolicy(yamlCfg, log)
+
+	// Uploaded branding assets and large paste bodies; created before the
+	// chown below so the server can still write them after dropping privileges
+	blobStore, err := blob.NewFS(filepath.Join(dataDir, "blobs"))
+	if err != nil {
+		exitOnError(err)
+	}
+
+	// Paste body storage policy, likewise set before db is copied
+	bodyCfg, err := bodyPolicyConfig(yamlCfg)
+	if err != nil {
+		exitOnError(err)
+	}
+	db.SetBodyPolicy(storage.NewBodyPolicy(bodyCfg, blobStore))
+
+	// Redis shares the paste cache and rate limit counters between replicas;
+	// the in-process ones are used while it is unreachable
+	var redisClient *redis.Client
+	switch driver := yamlCfg.Database.Cache.Driver; driver {
+	case "", "memory":
+	case "redis":
+		redisCfg := yamlCfg.Database.Cache.Redis
+		redisClient, err = redis.New(redis.Config{
+			Address:  redisCfg.Address,
+			Password: redisCfg.Password,
+			DB:       redisCfg.DB,
+		})
+		if err != nil {
+			exitOnError(fmt.Errorf("invalid database.cache.redis in config: %w", err))
+		}
+		if err := redisClient.Ping(context.Background()); err == nil {
+			log.Info("Sharing the paste cache and rate limits through Redis at " + redisClient.Address())
+		}
+	default:
+		exitOnError(fmt.Errorf("invalid database.cache.driver in config: %q (memory, redis)", driver))
+	}
+
+	// Paste cache, likewise set before db is copied
+	if cacheCfg := yamlCfg.Database.Cache; cacheCfg.Enabled {
+		ttl, err := time.ParseDuration(cacheCfg.TTL)
+		if err != nil {
+			exitOnError(fmt.Errorf("invalid database.cache.ttl in config: %w", err))
+		}
+		pasteCache := storage.NewPasteCache(storage.PasteCacheConfig{
+			MaxItems:     cacheCfg.MaxItems,
+			MaxBytes:     cacheCfg.MaxMemory,
+			MaxPasteSize: cacheCfg.MaxPasteSize,
+			TTL:          ttl,
+		})
+		if redisClient != nil {
+			pasteCache.SetTier(redisClient)
+		}
+		db.SetPasteCache(pasteCache)
+	}
+
+	// Spam filter, likewise set before db is copied; held pastes are frozen
+	// for review in the admin panel
+	spamFilter, err := newSpamFilter(yamlCfg, log)
+	if err != nil {
+		exitOnError(err)
+	}
+	db.SetScanner(spamFilter)
+
+	// Circuit breaker, likewise set before db is copied; while the database
+	// is down, cached pastes are served and everything else fails with 503
+	dbBreaker, err := newDBBreaker(yamlCfg, log)
+	if err != nil {
+		exitOnError(err)
+	}
+	if dbBreaker != nil {
+		db.SetBreaker(dbBreaker)
+		dbBreaker.Start()
+	}
+
+	// Merge named AI crawler presets into the robots deny list
+	robotsAgentsDeny, err := config.ExpandCrawlerPresets(yamlCfg.Web.SEO.Robots.Agents.Presets, yamlCfg.Web.SEO.Robots.Agents.Deny)
+	if err != nil {
+		exitOnError(err)
+	}
+
+	// Compile the paste redaction policy
+	redaction, err := redact.NewPolicy(redact.Config{
+		Enabled:       yamlCfg.Security.Redaction.Enabled,
+		AllowOverride: yamlCfg.Security.Redaction.AllowOverride,
+		Builtins:      yamlCfg.Security.Redaction.Builtins,
+		Patterns:      yamlCfg.Security.Redaction.Patterns,
+		Replacement:   yamlCfg.Security.Redaction.Replacement,
+	})
+	if err != nil {
+		exitOnError(err)
+	}
+
+	// Load the about, rules and terms pages with embedded defaults + file override
+	// The admin panel edits and republishes them without a restart
+	contentPages := &contentManager{
+		configPath: configFilePath,
+		vars:       templateVars,
+		pages:      content.NewSet(),
+		db:         db,
+		log:        log,
+		paths: map[string]string{
+			content.About: yamlCfg.Web.Content.About,
+			content.Rules: yamlCfg.Web.Content.Rules,
+			content.Terms: yamlCfg.Web.Content.Terms,
+		},
+	}
+	for _, name := range content.Names {
+		contentPages.publish(name)
+	}
+
 	cfg := config.Config{
 		Log:               log,
 		RateLimitGet:      netshare.NewRateLimitSystem(yamlCfg.Limits.RateLimit.GetPastes.Per5Min, yamlCfg.Limits.RateLimit.GetPastes.Per15Min, yamlCfg.Limits.RateLimit.GetPastes.Per1Hour),
 		RateLimitNew:      netshare.NewRateLimitSystem(yamlCfg.Limits.RateLimit.NewPastes.Per5Min, yamlCfg.Limits.RateLimit.NewPastes.Per15Min, yamlCfg.Limits.RateLimit.NewPastes.Per1Hour),
+		RateLimitAuth:     netshare.NewRateLimitSystem(yamlCfg.Limits.RateLimit.Auth.Per5Min, yamlCfg.Limits.RateLimit.Auth.Per15Min, yamlCfg.Limits.RateLimit.Auth.Per1Hour),
+		RateLimitAdmin:    netshare.NewRateLimitSystem(yamlCfg.Limits.RateLimit.Admin.Per5Min, yamlCfg.Limits.RateLimit.Admin.Per15Min, yamlCfg.Limits.RateLimit.Admin.Per1Hour),
+		RateLimitRules:    netshare.NewRateLimitRules(),
 		Version:           Version,
 		TitleMaxLen:       yamlCfg.Limits.TitleMaxLength,
 		BodyMaxLen:        yamlCfg.Limits.BodyMaxLength,
+		StreamMaxSize:     yamlCfg.Database.Bodies.StreamMaxSize,
 		MaxLifeTime:       maxLifeTime,
-		ServerAbout:       serverAbout,
-		ServerRules:       serverRules,
-		ServerTermsOfUse:  serverTermsOfUse,
+		Redaction:         redaction,
+		Content:           contentPages.pages,
 		SecurityTxt:       securityTxt,
 		FQDN:              fqdn,
 		ServerTitle:       yamlCfg.Server.Title,
@@ -2238,16 +2664,58 @@ func main() {
 		SecurityContactName:  yamlCfg.Web.Security.Contact.Name,
 		SiteRobotsAllow:      yamlCfg.Web.SEO.Robots.Allow,
 		SiteRobotsDeny:       yamlCfg.Web.SEO.Robots.Deny,
-		SiteRobotsAgentsDeny: yamlCfg.Web.SEO.Robots.Agents.Deny,
-		Logo:                 yamlCfg.Web.Branding.Logo,
-		Favicon:              yamlCfg.Web.Branding.Favicon,
+		SiteRobotsAgentsDeny: robotsAgentsDeny,
+		SiteRobotsPasteTag:   config.PasteRobotsTag(yamlCfg.Web.SEO.Robots.XRobotsTag, yamlCfg.Web.SEO.Robots.NoindexPastes),
+		Branding:             yamlCfg.Branding(),
 		TrustedProxies:       yamlCfg.Server.Proxy.Allowed,
 		UiDefaultLifetime:    yamlCfg.Web.UI.DefaultLifetime,
 		UiDefaultTheme:       yamlCfg.Web.UI.DefaultTheme,
 		UiThemesDir:          yamlCfg.Web.UI.ThemesDir,
+		UiRelatedPastes:      yamlCfg.Web.UI.RelatedPastes,
 		Public:               yamlCfg.Server.Public,
 		CasPasswdFile:        yamlCfg.Security.PasswordFile,
 	}
+	if err := applyRateLimits(&cfg, yamlCfg); err != nil {
+		exitOnError(fmt.Errorf("invalid limits.rate_limit in config: %w", err))
+	}
+	// IP reputation: bad addresses get stricter rate limits, and their
+	// scores are recorded in audit events
+	reputationCfg, err := reputationConfig(yamlCfg)
+	if err != nil {
+		exitOnError(err)
+	}
+	ipReputation := reputation.New(reputationCfg)
+	if ipReputation.Enabled() {
+		log.Info(fmt.Sprintf("IP reputation enabled: %d DNSBL zones, API lookups %v", len(reputationCfg.DNSBL), reputationCfg.APIKey != ""))
+	}
+	audit.SetReputation(ipReputation.CachedScore)
+
+	// GeoIP: paste creation and viewing can be refused by country or
+	// network, and access and audit logs record the client country
+	geoIP, err := newGeoIPClient(yamlCfg, log)
+	if err != nil {
+		exitOnError(err)
+	}
+	if geoIP != nil {
+		audit.SetCountry(geoIP.Country)
+		logger.SetCountry(geoIP.Country)
+	}
+
+	// Firewall: banned addresses are refused every request, and addresses
+	// that keep hitting the rate limits are banned for a while
+	ipFirewall, err := newFirewall(yamlCfg, db, log)
+	if err != nil {
+		exitOnError(err)
+	}
+	for _, class := range config.RateLimitClasses {
+		cfg.RateLimitSystem(class).SetRules(cfg.RateLimitRules)
+		cfg.RateLimitSystem(class).SetReputation(ipReputation)
+		cfg.RateLimitSystem(class).SetViolations(ipFirewall)
+		if redisClient != nil {
+			cfg.RateLimitSystem(class).SetStore(redisClient, class)
+		}
+	}
+	user.SetReservedSlugs(yamlCfg.Limits.ReservedSlugs)
 
 	apiv1Data := apiv1.Load(db, cfg)
 
@@ -2268,6 +2736,7 @@ func main() {
 		exitOnError(err)
 	}
 	log.Debug("Database schema initialized successfully")
+	startFirewall(ipFirewall, yamlCfg, log)
 
 	// Auto-detect and perform database migration if driver changed
 	// NOW safe to migrate since destination database is initialized
@@ -2279,6 +2748,42 @@ func main() {
 		}
 	}
 
+	// Master key for TOTP secrets and SSL credentials at rest; services
+	// decrypt with it, so it is loaded before anything reads them
+	secretsCipher, err := masterCipher(yamlCfg, configDir)
+	if err != nil {
+		exitOnError(err)
+	}
+
+	// Database-backed accounts (users.enabled): sign-in, the user pages and
+	// the OAuth provider, whose access tokens the paste API accepts
+	// Built before the directories are chowned, so new key files are too
+	userAccounts, err := newAccounts(yamlCfg, db, fqdn, configDir, secretsCipher, log)
+	if err != nil {
+		exitOnError(err)
+	}
+	if userAccounts.cfg.Enabled && userAccounts.cfg.OAuth.Enabled {
+		apiv1Data.OAuth = userAccounts.oauth
+	}
+
+	// Provision the admin account and bootstrap.yml on every start; both are
+	// idempotent, and failing here lets the orchestrator retry
+	bootstrapFile, err := bootstrap.LoadFile(bootstrap.FilePath(*flagConfigDir))
+	if err != nil {
+		exitOnError(fmt.Errorf("bootstrap: %w", err))
+	}
+	if bootstrapAdmin != nil && bootstrapAdmin.Email == "" {
+		bootstrapAdmin.Email = yamlCfg.Server.Administrator.Email
+	}
+	if bootstrapAdmin != nil || bootstrapFile != nil {
+		err := bootstrap.Apply(context.Background(), userAccounts.bootstrap(), bootstrapAdmin, bootstrapFile, func(format string, args ...interface{}) {
+			log.Info(fmt.Sprintf(format, args...))
+		})
+		if err != nil {
+			exitOnError(fmt.Errorf("bootstrap: %w", err))
+		}
+	}
+
 	// Chown directories AGAIN after database initialization to ensure DB file has correct ownership
 	// The database file was just created, so it needs to be chowned before privilege drop
 	if os.Geteuid() == 0 && uid > 0 && gid > 0 {
@@ -2301,10 +2806,54 @@ func main() {
 	if err != nil {
 		exitOnError(err)
 	}
+	webData.Blobs = blobStore
+	webData.SetRegistration(yamlCfg.Server.Registration)
+
+	// Scheduled maintenance windows, reloaded every minute by the scheduler
+	maintenanceSchedule := maintenance.New(db)
+	if _, _, err := maintenanceSchedule.Refresh(time.Now()); err != nil {
+		log.Error(errors.New("Maintenance windows: " + err.Error()))
+	}
+	webData.Maintenance = maintenanceSchedule
+
+	// Outbound deliveries run on a bounded pool of workers
+	dispatcher, err := newDispatcher(yamlCfg)
+	if err != nil {
+		exitOnError(err)
+	}
+
+	// Abuse reports; tickets are set up once the ports are known
+	abuseQueue := abuse.New(db, log)
+	abuseQueue.SetDispatcher(dispatcher)
+	apiv1Data.Abuse = abuseQueue
+
+	// API tokens; monitoring scopes open /metrics and the server stats
+	tokenService := userAccounts.tokens
+	apiv1Data.Tokens = tokenService
+
+	if yamlCfg.Network.Offline {
+		log.Info("Offline mode: public IP discovery, update checks, ACME, telemetry, the directory and GeoIP downloads are off")
+	}
+
+	// Instance directory; the peers are fetched by the directory job
+	if yamlCfg.Server.Directory.URL != "" && !yamlCfg.Network.Offline {
+		apiv1Data.Directory = directory.New(yamlCfg.Server.Directory.URL)
+	}
+
+	// Security headers per AI.md PART 11, with per-path overrides
+	securityHeadersCfg, cspReports, err := securityHeaders(yamlCfg)
+	if err != nil {
+		exitOnError(err)
+	}
 
 	// Handlers
 	mux := http.NewServeMux()
 
+	// Browsers post CSP violations here; the admin panel lists them
+	if cspReports != nil {
+		mux.Handle(csp.ReportPath, cspReports)
+	}
+
 	// External API Compatibility routes per AI.md "External API Compatibility"
 	// These are registered before "/" to ensure specific matching
 	// sprunge.us compatibility
@@ -2342,8 +2891,27 @@ func main() {
 	mux.HandleFunc("/paste", func(rw http.ResponseWriter, req *http.Request) {
 		apiv1Data.Hand(rw, req)
 	})
+	// hastebin compatibility
+	mux.HandleFunc("/documents", func(rw http.ResponseWriter, req *http.Request) {
+		apiv1Data.Hand(rw, req)
+	})
+	mux.HandleFunc("/documents/", func(rw http.ResponseWriter, req *http.Request) {
+		apiv1Data.Hand(rw, req)
+	})
+	// GitHub Gist compatibility (also under /api/v3/gists)
+	mux.HandleFunc("/gists", func(rw http.ResponseWriter, req *http.Request) {
+		apiv1Data.Hand(rw, req)
+	})
+	mux.HandleFunc("/gists/", func(rw http.ResponseWriter, req *http.Request) {
+		apiv1Data.Hand(rw, req)
+	})
 
 	mux.HandleFunc("/", func(rw http.ResponseWriter, req *http.Request) {
+		// PrivateBin clients use the server root
+		if apiv1.IsPrivateBinRequest(req) {
+			apiv1Data.Hand(rw, req)
+			return
+		}
 		webData.Handler(rw, req)
 	})
 	mux.HandleFunc("/raw/", func(rw http.ResponseWriter, req *http.Request) {
@@ -2352,6 +2920,14 @@ func main() {
 	mux.HandleFunc("/api/", func(rw http.ResponseWriter, req *http.Request) {
 		apiv1Data.Hand(rw, req)
 	})
+	if userAccounts.cfg.Enabled {
+		apiHandler := http.HandlerFunc(apiv1Data.Hand)
+		mux.Handle(config.APIBasePath()+"/auth/", userAccounts.handler(apiHandler))
+		mux.Handle(config.APIBasePath()+"/oauth/", userAccounts.handler(apiHandler))
+		mux.Handle("/oauth/", userAccounts.handler(http.HandlerFunc(webData.Handler)))
+		mux.Handle(config.APIBasePath()+"/users/", userAccounts.handler(apiHandler))
+		mux.Handle(config.APIBasePath()+"/orgs/", userAccounts.handler(apiHandler))
+	}
 
 	// Register admin panel and API per AI.md PART 17
 	// Admin panel at /{admin_path}/ and API at /api/{version}/{admin_path}/
@@ -2361,15 +2937,86 @@ func main() {
 		Enabled:    true,
 	}
 	adminPanel := admin.New(adminCfg)
+	adminPanel.SetPasteStore(db)
+	adminPanel.SetDomainService(userAccounts.domains)
+	adminPanel.SetBrandingService(&brandingManager{
+		configPath: configFilePath,
+		blobs:      blobStore,
+		web:        webData,
+		log:        log,
+	})
+	adminPanel.SetContentService(contentPages)
+	adminPanel.SetMaintenanceSchedule(maintenanceSchedule)
+	adminPanel.SetAbuseQueue(abuseQueue)
+	adminPanel.SetNetworkStatus(networkStatus(yamlCfg))
+	adminPanel.SetCSP(cspStatus(securityHeadersCfg), cspReports)
+	adminPanel.SetFirewall(ipFirewall)
+	adminPanel.SetGeoIP(geoIP)
+	adminPanel.SetSpamFilter(spamFilter)
+	if !containerMode {
+		logFiles := map[string]string{"access": accessLogFile, "error": errorLogFile, "server": serverLogFile}
+		if *flagDebug {
+			logFiles["debug"] = debugLogFile
+		}
+		adminPanel.SetLogFiles(logsDir, logFiles)
+	}
+	adminPanel.SetRateLimitService(&rateLimitManager{
+		configPath: configFilePath,
+		cfg:        &cfg,
+		log:        log,
+	})
+	adminPanel.SetPolicyService(&policyManager{
+		configPath: configFilePath,
+		cfg:        &cfg,
+		log:        log,
+	})
+	if yamlCfg.Security.CSRF.Enabled {
+		adminPanel.SetCSRFTokenFunc(func(r *http.Request) string {
+			return web.GetCSRFToken(r, yamlCfg.Security.CSRF.TokenLength)
+		})
+		if userAccounts.cfg.Enabled {
+			userAccounts.oauthAPI.SetCSRFTokenFunc(func(r *http.Request) string {
+				return web.GetCSRFToken(r, yamlCfg.Security.CSRF.TokenLength)
+			})
+		}
+	}
 	adminBasePath := config.AdminBasePath()
 	adminAPIPath := config.AdminAPIPath()
 
 	// Admin panel UI handler
-	mux.Handle(adminBasePath+"/", http.StripPrefix(adminBasePath, adminPanel.Handler()))
+	adminUI := http.StripPrefix(adminBasePath, adminPanel.Handler())
+	mux.Handle(adminBasePath+"/", adminUI)
+	// URL normalization drops the trailing slash, so the dashboard is at the bare path
+	mux.HandleFunc(adminBasePath, func(w http.ResponseWriter, r *http.Request) {
+		root := r.Clone(r.Context())
+		root.URL.Path = adminBasePath + "/"
+		root.URL.RawPath = ""
+		adminUI.ServeHTTP(w, root)
+	})
 
 	// Admin API handler
 	mux.Handle(adminAPIPath+"/", http.StripPrefix(adminAPIPath, adminPanel.APIHandler()))
 
+	// First-run setup wizard, locked by a token printed on the console
+	var setupWizard *setup.Wizard
+	if !containerMode && bootstrapAdmin == nil && setup.Pending(filepath.Dir(configFilePath)) {
+		passwordFile := yamlCfg.Security.PasswordFile
+		if passwordFile == "" {
+			passwordFile = filepath.Join(filepath.Dir(configFilePath), ".auth")
+		}
+		setupWizard, err = setup.New(setup.Config{
+			ConfigPath:   configFilePath,
+			PasswordFile: passwordFile,
+			Logf: func(format string, args ...interface{}) {
+				log.Info(fmt.Sprintf(format, args...))
+			},
+		})
+		if err != nil {
+			exitOnError(fmt.Errorf("failed to start setup: %w", err))
+		}
+		mux.Handle("/setup", setupWizard)
+	}
+
 	// Register debug/pprof endpoints per AI.md PART 6
 	// Only enabled when --debug flag is set
 	if *flagDebug {
@@ -2417,6 +3064,7 @@ func main() {
 		MaxBodyLen:  cfg.BodyMaxLen,
 		MaxTitleLen: cfg.TitleMaxLen,
 		Lexers:      chromaLexers.Names(false),
+		Redaction:   cfg.Redaction,
 	})
 	graphqlHandler := graphql.NewHandler(&graphql.Config{
 		Title:   yamlCfg.Server.Title,
@@ -2426,7 +3074,14 @@ func main() {
 
 	// Register Prometheus metrics endpoint per AI.md PART 21
 	// INTERNAL ONLY - should be firewalled from public access
+	// Private instances, or a metrics token, require a bearer token; API
+	// tokens with the metrics:read scope are accepted as well
 	if metricsCfg.Enabled {
+		if metricsCfg.Token != "" || !yamlCfg.Server.Public {
+			metricsCfg.Authorize = func(r *http.Request) bool {
+				return tokenService.Authorize(r, token.ScopeMetricsRead)
+			}
+		}
 		mux.Handle(metricsCfg.Endpoint, metric.Handler(metricsCfg))
 	}
 
@@ -2441,17 +3096,6 @@ func main() {
 		exitOnError(fmt.Errorf("invalid database.cleanup_period in config: %w", err))
 	}
 
-	// Security headers config from yaml per AI.md PART 11
-	securityHeadersCfg := web.SecurityHeadersConfig{
-		XFrameOptions:           yamlCfg.Security.Headers.XFrameOptions,
-		XContentTypeOptions:     yamlCfg.Security.Headers.XContentTypeOptions,
-		XSSProtection:           yamlCfg.Security.Headers.XSSProtection,
-		ContentSecurityPolicy:   yamlCfg.Security.Headers.ContentSecurityPolicy,
-		ReferrerPolicy:          yamlCfg.Security.Headers.ReferrerPolicy,
-		PermissionsPolicy:       yamlCfg.Security.Headers.PermissionsPolicy,
-		StrictTransportSecurity: yamlCfg.Security.Headers.StrictTransportSecurity,
-	}
-
 	// CSRF protection config per AI.md PART 11
 	csrfCfg := web.CSRFConfig{
 		Enabled:     yamlCfg.Security.CSRF.Enabled,
@@ -2461,21 +3105,70 @@ func main() {
 		FieldName:   yamlCfg.Security.CSRF.FieldName,
 		Secure:      yamlCfg.Security.CSRF.Secure,
 		// Exempt API and compatibility endpoints from CSRF (they use tokens, not cookies)
+		// The setup wizard checks its own one-time token
 		ExemptPaths: []string{
+			"/setup",
 			"/sprunge", "/sprunge/",
 			"/ix", "/ix/",
 			"/termbin", "/nc",
 			"/upload", "/p",
 			"/compat", "/paste",
+			"/documents",
+			"/gists",
+			csp.ReportPath,
+			// OAuth clients authenticate with their own credentials
+			"/oauth/token", "/oauth/revoke",
 		},
 		ExemptPrefixes: []string{
 			"/api/",
 			"/raw/",
+			"/documents/",
+			"/gists/",
 		},
+		// PrivateBin clients post to the server root; like the other API
+		// routes, their handler does not use the session cookie
+		ExemptRequest: apiv1.IsPrivateBinRequest,
+	}
+
+	// Denied crawlers get 403 only when enforcement is on; otherwise robots.txt is advisory
+	var enforcedAgents []string
+	if yamlCfg.Web.SEO.Robots.Agents.Enforce {
+		enforcedAgents = robotsAgentsDeny
+	}
+
+	// The paste handlers check the get and new limits themselves
+	rateLimitRoutes := []web.RateLimitRoute{
+		{Limits: cfg.RateLimitAuth, Match: web.IsAuthSubmission},
+		{Limits: cfg.RateLimitAdmin, Match: func(r *http.Request) bool {
+			return strings.HasPrefix(r.URL.Path, adminBasePath+"/") || strings.HasPrefix(r.URL.Path, adminAPIPath+"/")
+		}},
+	}
+
+	// Signed-in users and API token holders, for the GeoIP exemption lists
+	creationUser := func(r *http.Request) string {
+		if user, ok := web.SessionUser(r); ok {
+			return user
+		}
+		if scheme, credential, _ := strings.Cut(r.Header.Get("Authorization"), " "); strings.EqualFold(scheme, "Bearer") {
+			if info, err := tokenService.Validate(strings.TrimSpace(credential)); err == nil {
+				return fmt.Sprintf("%s:%d", info.Type, info.OwnerID)
+			}
+		}
+		return ""
+	}
+
+	// Signed-in users of users.enabled are resolved just before the app
+	var app http.Handler = mux
+	if userAccounts.cfg.Enabled {
+		app = userAccounts.middleware()(mux)
+	}
+	// Requests to a verified custom domain carry it in their context
+	if userAccounts.features.CustomDomains.Enabled {
+		app = web.CustomDomainMiddleware(userAccounts.domains.HostResolver())(app)
 	}
 
 	// Apply middleware chain per AI.md:
-	// URLNormalize → PathSecurity → PanicRecovery → RequestID → Metrics → SecurityHeaders → CORS → CSRF → Maintenance → App
+	// URLNormalize → PathSecurity → PanicRecovery → RequestID → Metrics → Firewall → CrawlerBlock → SecurityHeaders → CORS → Reputation → GeoIP → RateLimit → CSRF → Maintenance → CustomDomain → Auth → App
 	// Per AI.md PART 14: URL normalization (trailing slashes) must be first
 	// Per AI.md PART 11: Path security blocks traversal attacks early
 	// Per AI.md PART 6: Panic recovery must catch all panics
@@ -2486,29 +3179,153 @@ func main() {
 			web.PanicRecoveryMiddleware(*flagDebug)(
 				web.RequestIDMiddleware(
 					metric.Middleware(metricsCfg)(
-						web.SecurityHeadersMiddleware(securityHeadersCfg)(
-							web.CORSMiddleware(
-								web.CSRFMiddleware(csrfCfg)(
-									web.MaintenanceMiddleware(dataDirectory, mux)))))))))
+						web.FirewallMiddleware(ipFirewall)(
+							web.CrawlerBlockMiddleware(enforcedAgents)(
+								web.SecurityHeadersMiddleware(securityHeadersCfg)(
+									web.CORSMiddleware(
+										// Admins are never refused, so they can lift bans from anywhere
+										web.ReputationMiddleware(ipReputation, []string{adminBasePath + "/", adminAPIPath + "/"})(
+											web.GeoIPMiddleware(geoIP, creationUser, []string{adminBasePath + "/", adminAPIPath + "/"})(
+												web.RateLimitMiddleware(rateLimitRoutes)(
+													web.CSRFMiddleware(csrfCfg)(
+														web.MaintenanceMiddleware(web.MaintenanceConfig{
+															DataDir:  dataDirectory,
+															Schedule: maintenanceSchedule,
+															// Admins can still reach the panel to end a window early
+															ExemptPrefixes: []string{adminBasePath + "/", adminAPIPath + "/"},
+														}, app))))))))))))))
+
+	// Elect one replica to run background jobs when several share the database
+	elector, err := newElector(yamlCfg, db, log)
+	if err != nil {
+		exitOnError(err)
+	}
+	clusterCtx, stopCluster := context.WithCancel(context.Background())
+	electorDone := make(chan struct{})
+	go func() {
+		elector.Run(clusterCtx)
+		close(electorDone)
+	}()
 
 	// Run background job
-	go func(cleanJobPeriod time.Duration) {
+	// The period is atomic so a config reload can change it
+	var cleanupJobPeriod atomic.Int64
+	cleanupJobPeriod.Store(int64(cleanupPeriod))
+	go func() {
 		for {
-			// Delete expired pastes
-			count, err := db.PasteDeleteExpired()
-			if err != nil {
-				log.Error(errors.New("Delete expired: " + err.Error()))
-			}
+			// Only the leader deletes; the others keep polling in case they take over
+			if elector.IsLeader() {
+				// Delete expired pastes
+				count, err := db.PasteDeleteExpired()
+				if err != nil {
+					log.Error(errors.New("Delete expired: " + err.Error()))
+				}
 
-			// Only log if pastes were actually deleted
-			if count > 0 {
-				log.Info("Deleted " + strconv.FormatInt(count, 10) + " expired pastes")
+				// Only log if pastes were actually deleted
+				if count > 0 {
+					log.Info("Deleted " + strconv.FormatInt(count, 10) + " expired pastes")
+				}
 			}
 
 			// Wait
-			time.Sleep(cleanJobPeriod)
+			time.Sleep(time.Duration(cleanupJobPeriod.Load()))
+		}
+	}()
+
+	// Maintenance windows job per AI.md PART 19 (built-in scheduler)
+	startMaintenanceScheduler(maintenanceSchedule, log, elector)
+
+	// Garbage collector job per AI.md PART 19 (built-in scheduler)
+	if yamlCfg.Database.GC.Enabled {
+		startGCScheduler(yamlCfg, db, log, elector)
+	}
+
+	// Static mirror job per AI.md PART 19 (built-in scheduler)
+	if yamlCfg.Server.Mirror.Enabled {
+		startMirrorScheduler(yamlCfg, db, log, elector)
+	}
+
+	// Instance directory job per AI.md PART 19 (built-in scheduler)
+	if apiv1Data.Directory != nil {
+		startDirectoryScheduler(apiv1Data.Directory, yamlCfg, db, maxLifeTime, log, elector)
+	}
+
+	// Expired OAuth codes and tokens per AI.md PART 19 (built-in scheduler)
+	// Learn the public IPs before the first custom domain is verified
+	if userAccounts.features.CustomDomains.Enabled {
+		go userAccounts.domains.RefreshPublicIPs()
+	}
+	if userAccounts.cfg.Enabled && userAccounts.cfg.OAuth.Enabled {
+		startOAuthScheduler(userAccounts, log, elector)
+	}
+
+	// JWT signing key rotation per AI.md PART 19 (built-in scheduler)
+	if userAccounts.jwtKeys != nil && userAccounts.jwtKeys.FileBacked() && userAccounts.cfg.Auth.JWT.RotateDays > 0 {
+		startJWTScheduler(userAccounts, log, elector)
+	}
+
+	// GeoIP database updates per AI.md PART 20 (built-in scheduler)
+	if geoIP != nil {
+		startGeoIPScheduler(geoIP, geoipDir(yamlCfg), log)
+	}
+
+	// Opt-in telemetry ping per AI.md PART 19 (built-in scheduler)
+	if yamlCfg.Server.Telemetry.Enabled && !yamlCfg.Network.Offline {
+		startTelemetryScheduler(yamlCfg, db, log, elector)
+	}
+
+	// Scheduled backups per AI.md PART 19 (built-in scheduler)
+	if yamlCfg.Backup.Enabled {
+		job, err := newBackupJob(yamlCfg, db, dataDir, configDir, backupDir, log, elector)
+		if err == nil {
+			err = startBackupScheduler(job)
+		}
+		if err != nil {
+			log.Error(errors.New("Scheduled backups disabled: " + err.Error()))
+		} else {
+			adminPanel.SetBackupService(job)
+		}
+	}
+
+	// Pick up config file changes (e.g. a ConfigMap update) and SIGHUP
+	reloader := &configReloader{
+		path:            configFilePath,
+		containerMode:   containerMode,
+		log:             log,
+		cfg:             &cfg,
+		cleanupPeriod:   &cleanupJobPeriod,
+		setBranding:     webData.SetBranding,
+		setContent:      contentPages.setPath,
+		setRegistration: webData.SetRegistration,
+		setReputation:   ipReputation.SetConfig,
+		setAutoBan:      ipFirewall.SetAutoBan,
+		setSpam:         spamFilter.SetConfig,
+		setIPDiscovery:  userAccounts.setIPDiscovery,
+		geoIP:           geoIP,
+	}
+	adminPanel.SetSettingsService(&settingsManager{
+		configPath: configFilePath,
+		reload:     reloader.apply,
+	})
+	if _, err := os.Stat(configFilePath); err == nil {
+		reloader.reload()
+		interval, err := configReloadInterval(yamlCfg)
+		if err != nil {
+			exitOnError(err)
+		}
+		if interval > 0 {
+			go config.WatchFile(clusterCtx, configFilePath, interval, reloader.reload)
 		}
-	}(cleanupPeriod)
+
+		hupChan := make(chan os.Signal, 1)
+		signal.Notify(hupChan, syscall.SIGHUP)
+		go func() {
+			for range hupChan {
+				log.Info("Received SIGHUP, reloading config")
+				reloader.reload()
+			}
+		}()
+	}
 
 	// Determine ports (HTTP and optionally HTTPS)
 	var httpPort, httpsPort int
@@ -2519,7 +3336,16 @@ func main() {
 		portEnv = os.Getenv("CASPASTE_PORT")
 	}
 
-	if portEnv != "" {
+	// server.listeners replaces listen and port; their ports are then only
+	// used in URLs
+	listeners, err := serverListeners(yamlCfg)
+	if err != nil {
+		exitOnError(err)
+	}
+
+	if len(listeners) > 0 {
+		httpPort, httpsPort = listenerPorts(listeners)
+	} else if portEnv != "" {
 		// ENV overrides config
 		httpPort, httpsPort, err = portutil.ParsePorts(portEnv)
 		if err != nil {
@@ -2548,6 +3374,13 @@ func main() {
 		}
 	}
 
+	// Email a ticket for each abuse report
+	if mailer, to, err := abuseTickets(yamlCfg); err != nil {
+		log.Error(fmt.Errorf("Abuse tickets disabled: %w", err))
+	} else if mailer != nil {
+		abuseQueue.SetTickets(mailer, to, siteURL(fqdn, httpPort, httpsPort))
+	}
+
 	// Update flagAddress to use determined port
 	// Extract host from current address
 	host := *flagAddress
@@ -2560,38 +3393,60 @@ func main() {
 	}
 	*flagAddress = net.JoinHostPort(host, strconv.Itoa(httpPort))
 
-	// Convert listen address ("all" → "::", or use as-is)
-	listenAddr := yamlCfg.Server.Listen
-	if listenAddr == "all" || listenAddr == "" {
-		listenAddr = "::" // IPv4 + IPv6 dual stack
-	}
-
-	// Create HTTP listener (must be done as root for ports < 1024 on Unix)
-	httpAddr := net.JoinHostPort(listenAddr, strconv.Itoa(httpPort))
-	httpListener, err := net.Listen("tcp", httpAddr)
-	if err != nil {
-		exitOnError(fmt.Errorf("failed to bind HTTP to %s: %w", httpAddr, err))
-	}
+	// Bind every address now, as root for ports < 1024 on Unix
+	var httpListeners, httpsListeners []net.Listener
+	var tlsCert tls.Certificate
+	if len(listeners) > 0 {
+		for _, l := range listeners {
+			ln, err := bindListener(l, uid, gid)
+			if err != nil {
+				exitOnError(fmt.Errorf("failed to bind %s: %w", l.Address, err))
+			}
+			if l.TLS {
+				httpsListeners = append(httpsListeners, ln)
+			} else {
+				httpListeners = append(httpListeners, ln)
+			}
+		}
+		if len(httpsListeners) > 0 {
+			_, tlsCert, err = serverTLSCert(yamlCfg, fqdn)
+			if err != nil {
+				exitOnError(fmt.Errorf("server.listeners has TLS addresses but no certificate: %w", err))
+			}
+		}
+	} else {
+		// Convert listen address ("all" → "::", or use as-is)
+		listenAddr := yamlCfg.Server.Listen
+		if listenAddr == "all" || listenAddr == "" {
+			listenAddr = "::" // IPv4 + IPv6 dual stack
+		}
 
-	// Create HTTPS listener if dual port configured
-	var httpsListener net.Listener
-	var tlsCert *validation.TLSCertPaths
-	if httpsPort > 0 {
-		httpsAddr := net.JoinHostPort(listenAddr, strconv.Itoa(httpsPort))
-		httpsListener, err = net.Listen("tcp", httpsAddr)
+		httpAddr := net.JoinHostPort(listenAddr, strconv.Itoa(httpPort))
+		httpListener, err := net.Listen("tcp", httpAddr)
 		if err != nil {
-			exitOnError(fmt.Errorf("failed to bind HTTPS to %s: %w", httpsAddr, err))
+			exitOnError(fmt.Errorf("failed to bind HTTP to %s: %w", httpAddr, err))
 		}
+		httpListeners = append(httpListeners, httpListener)
 
-		// Auto-detect Let's Encrypt certificates
-		tlsCert, err = validation.FindLetsEncryptCerts(fqdn)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: HTTPS port configured but no TLS cert found: %v\n", err)
-			fmt.Fprintf(os.Stderr, "HTTPS server will not start. Configure TLS cert or remove HTTPS port.\n")
-			httpsListener.Close()
-			httpsListener = nil
-		} else {
-			fmt.Printf("Found TLS certificate for domain: %s\n", tlsCert.Domain)
+		// Create HTTPS listener if dual port configured
+		if httpsPort > 0 {
+			httpsAddr := net.JoinHostPort(listenAddr, strconv.Itoa(httpsPort))
+			httpsListener, err := net.Listen("tcp", httpsAddr)
+			if err != nil {
+				exitOnError(fmt.Errorf("failed to bind HTTPS to %s: %w", httpsAddr, err))
+			}
+
+			// security.tls.cert_file, or an auto-detected Let's Encrypt certificate
+			certPaths, cert, err := serverTLSCert(yamlCfg, fqdn)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: HTTPS port configured but no TLS cert found: %v\n", err)
+				fmt.Fprintf(os.Stderr, "HTTPS server will not start. Configure TLS cert or remove HTTPS port.\n")
+				httpsListener.Close()
+			} else {
+				fmt.Printf("Found TLS certificate for domain: %s\n", certPaths.Domain)
+				tlsCert = cert
+				httpsListeners = append(httpsListeners, httpsListener)
+			}
 		}
 	}
 
@@ -2605,7 +3460,24 @@ func main() {
 
 	// Print startup banner with database info
 	dbDisplay := formatDatabaseDisplay(yamlCfg.Database.Driver, yamlCfg.Database.Source)
-	printStartupBanner(Version, fqdn, yamlCfg.Server.Title, configFilePath, dbDisplay, httpPort, httpsPort, generatedUser, generatedPass)
+	if containerMode {
+		// The banner is not JSON; log the same facts instead
+		log.Info(fmt.Sprintf("CasPaste v%s listening on port %d (database: %s)", Version, httpPort, dbDisplay))
+		if generatedUser != "" {
+			log.Warn(fmt.Sprintf("Generated admin credentials: %s / %s (save them now, they are not shown again)", generatedUser, generatedPass))
+		}
+	} else {
+		printStartupBanner(Version, fqdn, yamlCfg.Server.Title, configFilePath, dbDisplay, httpPort, httpsPort, generatedUser, generatedPass)
+	}
+	if setupWizard != nil {
+		setupURL := "http://" + net.JoinHostPort(fqdn, strconv.Itoa(httpPort))
+		if httpPort == 80 {
+			setupURL = "http://" + fqdn
+		}
+		fmt.Printf("Finish setup in your browser: %s/setup?token=%s\n", setupURL, setupWizard.Token())
+		fmt.Println("The token works until setup is complete; restarting prints a new one")
+		fmt.Println()
+	}
 
 	// Track server start time for uptime calculation
 	serverStartTime := time.Now()
@@ -2629,57 +3501,38 @@ func main() {
 	// Works on Windows, macOS, BSD, and Linux
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
+	service.Notify(sigChan)
 
-	// Start HTTP server in a goroutine
-	httpErrors := make(chan error, 1)
-	go func() {
-		httpErrors <- srv.Serve(httpListener)
-	}()
+	// Start the HTTP servers, one goroutine per address
+	httpErrors := make(chan error, len(httpListeners))
+	for _, ln := range httpListeners {
+		if len(listeners) > 0 {
+			log.Info("Run HTTP server on " + ln.Addr().String())
+		}
+		go func(ln net.Listener) {
+			httpErrors <- srv.Serve(ln)
+		}(ln)
+	}
 
-	// Start HTTPS server if configured and cert available
+	// Start the HTTPS servers if configured and cert available
 	var httpsErrors chan error
 	var srvHTTPS *http.Server
-	if httpsListener != nil && tlsCert != nil {
-		httpsErrors = make(chan error, 1)
-		
-		// Configure TLS security settings
-		tlsConfig := &tls.Config{
-			MinVersion: tls.VersionTLS12, // Default to TLS 1.2
-			CipherSuites: []uint16{
-				tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
-				tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
-				tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
-				tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
-				tls.TLS_CHACHA20_POLY1305_SHA256,
-			},
-			PreferServerCipherSuites: true,
-		}
-		
-		// Apply configured TLS min version
-		switch yamlCfg.Security.TLS.MinVersion {
-		case "1.3":
-			tlsConfig.MinVersion = tls.VersionTLS13
-		case "1.2":
-			tlsConfig.MinVersion = tls.VersionTLS12
-		case "1.1":
-			tlsConfig.MinVersion = tls.VersionTLS11
-		case "1.0":
-			tlsConfig.MinVersion = tls.VersionTLS10
-		}
-		
+	if len(httpsListeners) > 0 {
+		httpsErrors = make(chan error, len(httpsListeners))
 		srvHTTPS = &http.Server{
 			Handler:      handler,
 			ReadTimeout:  15 * time.Second,
 			WriteTimeout: 15 * time.Second,
 			IdleTimeout:  60 * time.Second,
-			TLSConfig:    tlsConfig,
+			TLSConfig:    serverTLSConfig(yamlCfg, tlsCert),
 		}
 
-		go func() {
-			httpsAddr := net.JoinHostPort(listenAddr, strconv.Itoa(httpsPort))
-			log.Info("Run HTTPS server on " + httpsAddr)
-			httpsErrors <- srvHTTPS.ServeTLS(httpsListener, tlsCert.CertFile, tlsCert.KeyFile)
-		}()
+		for _, ln := range httpsListeners {
+			log.Info("Run HTTPS server on " + ln.Addr().String())
+			go func(ln net.Listener) {
+				httpsErrors <- srvHTTPS.ServeTLS(ln, "", "")
+			}(ln)
+		}
 	}
 
 	// Wait for interrupt signal or server error
@@ -2697,6 +3550,10 @@ func main() {
 	case sig := <-sigChan:
 		log.Info(fmt.Sprintf("Received signal %v, shutting down gracefully...", sig))
 
+		// Hand the lease over before the HTTP servers drain
+		stopCluster()
+		<-electorDone
+
 		// Log server stopped event to audit log per AI.md PART 11
 		uptime := time.Since(serverStartTime)
 		audit.ServerStopped(fmt.Sprintf("signal: %v", sig), uptime)
@@ -2706,6 +3563,9 @@ func main() {
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
 
+		// Followed admin logs never finish on their own
+		adminPanel.CloseStreams()
+
 		// Attempt graceful shutdown for both servers
 		if err := srv.Shutdown(ctx); err != nil {
 			log.Error(fmt.Errorf("HTTP server shutdown error: %w", err))
@@ -2719,6 +3579,11 @@ func main() {
 			}
 		}
 
+		// Deliveries queued by the last requests still go out
+		if err := dispatcher.Stop(ctx); err != nil {
+			log.Error(fmt.Errorf("Outbound deliveries not sent: %w", err))
+		}
+
 		log.Info("Server stopped")
 	}
 }
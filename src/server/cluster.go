@@ -0,0 +1,347 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/cli"
+	"github.com/casjay-forks/caspaste/src/config"
+	"github.com/casjay-forks/caspaste/src/content"
+	"github.com/casjay-forks/caspaste/src/domain"
+	"github.com/casjay-forks/caspaste/src/firewall"
+	"github.com/casjay-forks/caspaste/src/geoip"
+	"github.com/casjay-forks/caspaste/src/leader"
+	"github.com/casjay-forks/caspaste/src/logger"
+	"github.com/casjay-forks/caspaste/src/reputation"
+	"github.com/casjay-forks/caspaste/src/spam"
+	"github.com/casjay-forks/caspaste/src/storage"
+	"github.com/casjay-forks/caspaste/src/user"
+	"github.com/casjay-forks/caspaste/src/validation"
+)
+
+// newElector picks the leader election backend from server.cluster
+// With no backend the elector is always the leader, as on a single node
+func newElector(yamlCfg *config.YAMLConfig, db storage.DB, log logger.Logger) (*leader.Elector, error) {
+	cluster := yamlCfg.Server.Cluster
+	ttl, mode, err := clusterLease(yamlCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	name := cluster.LeaseName
+	if name == "" {
+		name = "caspaste"
+	}
+
+	var backend leader.Backend
+	switch mode {
+	case "database":
+		backend = leader.Database(db, name)
+	case "kubernetes":
+		backend, err = leader.Kubernetes(name, cluster.Namespace)
+		if err != nil {
+			return nil, fmt.Errorf("kubernetes leader election: %w", err)
+		}
+	}
+
+	return leader.New(backend, leader.Config{
+		TTL: ttl,
+		OnChange: func(isLeader bool) {
+			if isLeader {
+				log.Info("This replica is now the leader and runs background jobs")
+			} else {
+				log.Info("This replica is no longer the leader")
+			}
+		},
+		Logf: func(format string, args ...interface{}) {
+			log.Error(fmt.Errorf(format, args...))
+		},
+	}), nil
+}
+
+// clusterLease reads the lease duration and leader election mode ("none",
+// "database" or "kubernetes") of server.cluster
+func clusterLease(yamlCfg *config.YAMLConfig) (time.Duration, string, error) {
+	cluster := yamlCfg.Server.Cluster
+
+	ttl := leader.DefaultTTL
+	if cluster.LeaseDuration != "" {
+		d, err := time.ParseDuration(cluster.LeaseDuration)
+		if err != nil {
+			return 0, "", fmt.Errorf("invalid server.cluster.lease_duration: %w", err)
+		}
+		if d < 3*time.Second {
+			return 0, "", errors.New("server.cluster.lease_duration cannot be less than 3s")
+		}
+		ttl = d
+	}
+
+	mode := strings.ToLower(cluster.LeaderElection)
+	switch mode {
+	case "", "auto":
+		// Replicas can only share a network database
+		mode = "none"
+		if yamlCfg.Database.Driver == "postgres" || yamlCfg.Database.Driver == "mysql" {
+			mode = "database"
+		}
+	case "none", "database", "kubernetes":
+	default:
+		return 0, "", fmt.Errorf("invalid server.cluster.leader_election %q: use auto, database, kubernetes or none", cluster.LeaderElection)
+	}
+	return ttl, mode, nil
+}
+
+// configReloadInterval returns how often server.config_reload checks the
+// config file for changes; 0 = never
+func configReloadInterval(yamlCfg *config.YAMLConfig) (time.Duration, error) {
+	reloadInterval := yamlCfg.Server.ConfigReload
+	if reloadInterval == "" {
+		reloadInterval = "10s"
+	}
+	if enabled, ok := validation.ParseBool(reloadInterval); ok && !enabled {
+		return 0, nil
+	}
+	interval, err := time.ParseDuration(reloadInterval)
+	if err != nil || interval <= 0 {
+		return 0, fmt.Errorf("invalid server.config_reload %q: use a duration or off", reloadInterval)
+	}
+	return interval, nil
+}
+
+// configReloader applies changes to the config file without a restart
+// Only settings the running server reads live are applied; the rest are
+// reported so the operator knows a restart is needed
+type configReloader struct {
+	path          string
+	containerMode bool
+	log           logger.Logger
+	cfg           *config.Config
+	cleanupPeriod *atomic.Int64
+	setBranding   func(config.Branding)
+	setContent    func(name, path string)
+	// Registration mode, see config.RegistrationPublic
+	setRegistration func(mode string)
+	setReputation   func(reputation.Config)
+	setAutoBan      func(firewall.AutoBan)
+	setSpam         func(spam.Config) error
+	setIPDiscovery  func(domain.IPDiscoveryConfig) error
+	// nil when GeoIP is disabled
+	geoIP *geoip.Client
+
+	mu      sync.Mutex
+	current *config.YAMLConfig
+}
+
+// load reads the config file the way startup does
+func (r *configReloader) load() (*config.YAMLConfig, error) {
+	yamlCfg, err := config.LoadYAMLConfig(r.path)
+	if err != nil {
+		return nil, err
+	}
+	if r.containerMode {
+		config.ApplyEnvironmentOverrides(yamlCfg)
+	}
+	config.ApplyCriticalOverrides(yamlCfg)
+	return yamlCfg, nil
+}
+
+// reload re-reads the config file and applies what changed
+func (r *configReloader) reload() {
+	r.apply()
+}
+
+// apply re-reads the config file and applies what changed, returning the
+// keys applied and those waiting for a restart
+func (r *configReloader) apply() (applied, pending []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next, err := r.load()
+	if err != nil {
+		r.log.Error(fmt.Errorf("Config reload: %w (keeping the running config)", err))
+		return nil, nil
+	}
+	if r.current == nil {
+		r.current = next
+		return nil, nil
+	}
+
+	changed := changedSettings(reflect.ValueOf(*r.current), reflect.ValueOf(*next), "")
+	if len(changed) == 0 {
+		return nil, nil
+	}
+
+	var branding, reputationKeys, geoipKeys, autoBanKeys, spamKeys, publicIPKeys []string
+	for _, key := range changed {
+		switch {
+		case key == "database.cleanup_period":
+			period, err := cli.ParseDuration(next.Database.CleanupPeriod)
+			if err != nil || period <= 0 {
+				r.log.Error(fmt.Errorf("Config reload: invalid database.cleanup_period %q", next.Database.CleanupPeriod))
+				next.Database.CleanupPeriod = r.current.Database.CleanupPeriod
+				continue
+			}
+			r.cleanupPeriod.Store(int64(period))
+			applied = append(applied, key)
+		case strings.HasPrefix(key, "limits.rate_limit."):
+			applied = append(applied, key)
+		case key == "limits.reserved_slugs":
+			user.SetReservedSlugs(next.Limits.ReservedSlugs)
+			applied = append(applied, key)
+		case key == "web.content.about":
+			r.setContent(content.About, next.Web.Content.About)
+			applied = append(applied, key)
+		case key == "web.content.rules":
+			r.setContent(content.Rules, next.Web.Content.Rules)
+			applied = append(applied, key)
+		case key == "web.content.terms":
+			r.setContent(content.Terms, next.Web.Content.Terms)
+			applied = append(applied, key)
+		case key == "server.registration":
+			switch next.Server.Registration {
+			case "", config.RegistrationPublic, config.RegistrationPrivate, config.RegistrationDisabled:
+				r.setRegistration(next.Server.Registration)
+				applied = append(applied, key)
+			default:
+				r.log.Error(fmt.Errorf("Config reload: invalid server.registration %q", next.Server.Registration))
+				next.Server.Registration = r.current.Server.Registration
+			}
+		case key == "server.title" || key == "server.tagline" || strings.HasPrefix(key, "web.branding."):
+			branding = append(branding, key)
+		case strings.HasPrefix(key, "security.reputation."):
+			reputationKeys = append(reputationKeys, key)
+		case strings.HasPrefix(key, "security.firewall.auto_ban."):
+			autoBanKeys = append(autoBanKeys, key)
+		case strings.HasPrefix(key, "security.spam."):
+			spamKeys = append(spamKeys, key)
+		case strings.HasPrefix(key, "server.public_ip."):
+			publicIPKeys = append(publicIPKeys, key)
+		case (strings.HasPrefix(key, "server.geoip.creation.") || strings.HasPrefix(key, "server.geoip.viewing.")) && r.geoIP != nil:
+			geoipKeys = append(geoipKeys, key)
+		default:
+			pending = append(pending, key)
+		}
+	}
+
+	if err := applyRateLimits(r.cfg, next); err != nil {
+		r.log.Error(fmt.Errorf("Config reload: %w (keeping the running exemptions and bans)", err))
+	}
+
+	if len(branding) > 0 {
+		if err := next.Branding().Validate(); err != nil {
+			r.log.Error(fmt.Errorf("Config reload: %w (keeping the running branding)", err))
+		} else {
+			r.setBranding(next.Branding())
+			applied = append(applied, branding...)
+		}
+	}
+
+	if len(reputationKeys) > 0 {
+		if repCfg, err := reputationConfig(next); err != nil {
+			r.log.Error(fmt.Errorf("Config reload: %w (keeping the running IP reputation)", err))
+			next.Security.Reputation = r.current.Security.Reputation
+		} else {
+			r.setReputation(repCfg)
+			applied = append(applied, reputationKeys...)
+		}
+	}
+
+	if len(autoBanKeys) > 0 {
+		if auto, err := firewallAutoBan(next); err != nil {
+			r.log.Error(fmt.Errorf("Config reload: %w (keeping the running automatic bans)", err))
+			next.Security.Firewall.AutoBan = r.current.Security.Firewall.AutoBan
+		} else {
+			r.setAutoBan(auto)
+			applied = append(applied, autoBanKeys...)
+		}
+	}
+
+	if len(spamKeys) > 0 {
+		spamCfg, err := spamConfig(next)
+		if err == nil {
+			if err = r.setSpam(spamCfg); err != nil {
+				err = fmt.Errorf("invalid security.spam: %w", err)
+			}
+		}
+		if err != nil {
+			r.log.Error(fmt.Errorf("Config reload: %w (keeping the running spam filter)", err))
+			next.Security.Spam = r.current.Security.Spam
+		} else {
+			applied = append(applied, spamKeys...)
+		}
+	}
+
+	if len(publicIPKeys) > 0 {
+		discovery, err := ipDiscovery(next)
+		if err == nil {
+			err = r.setIPDiscovery(discovery)
+		}
+		if err != nil {
+			r.log.Error(fmt.Errorf("Config reload: %w (keeping the running public IP discovery)", err))
+			next.Server.PublicIP = r.current.Server.PublicIP
+		} else {
+			applied = append(applied, publicIPKeys...)
+		}
+	}
+
+	if len(geoipKeys) > 0 {
+		creation, err := geoipCreationPolicy(next)
+		var viewing geoip.Policy
+		if err == nil {
+			viewing, err = geoipViewingPolicy(next)
+		}
+		if err != nil {
+			r.log.Error(fmt.Errorf("Config reload: %w (keeping the running GeoIP policies)", err))
+			next.Server.GeoIP.Creation = r.current.Server.GeoIP.Creation
+			next.Server.GeoIP.Viewing = r.current.Server.GeoIP.Viewing
+		} else {
+			r.geoIP.SetCreationPolicy(creation)
+			r.geoIP.SetViewingPolicy(viewing)
+			applied = append(applied, geoipKeys...)
+		}
+	}
+
+	if len(applied) > 0 {
+		r.log.Info("Config reloaded: " + strings.Join(applied, ", "))
+	}
+	if len(pending) > 0 {
+		r.log.Warn("Config changes take effect after a restart: " + strings.Join(pending, ", "))
+	}
+	r.current = next
+	return applied, pending
+}
+
+// changedSettings returns the yaml keys whose values differ between a and b
+func changedSettings(a, b reflect.Value, prefix string) []string {
+	var changed []string
+	for i := 0; i < a.NumField(); i++ {
+		field := a.Type().Field(i)
+		key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if field.Type.Kind() == reflect.Struct {
+			changed = append(changed, changedSettings(a.Field(i), b.Field(i), key)...)
+		} else if field.Type.Kind() == reflect.Slice && a.Field(i).Len() == 0 && b.Field(i).Len() == 0 {
+			// An empty list and a missing one mean the same
+			continue
+		} else if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			changed = append(changed, key)
+		}
+	}
+	return changed
+}
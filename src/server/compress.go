@@ -0,0 +1,109 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/casjay-forks/caspaste/src/blob"
+	"github.com/casjay-forks/caspaste/src/config"
+	"github.com/casjay-forks/caspaste/src/storage"
+)
+
+// bodyPolicyConfig reads the paste body storage settings
+func bodyPolicyConfig(yamlCfg *config.YAMLConfig) (storage.BodyPolicyConfig, error) {
+	bodies := yamlCfg.Database.Bodies
+	cfg := storage.BodyPolicyConfig{
+		CompressMinSize:    bodies.CompressMinSize,
+		CompressMinSavings: bodies.CompressMinSavings,
+		BlobMinSize:        bodies.BlobMinSize,
+		Adaptive:           bodies.Adaptive,
+	}
+	switch bodies.Compression {
+	case "", "zstd":
+		cfg.Algorithm = storage.BodyZstd
+	case "gzip":
+		cfg.Algorithm = storage.BodyGzip
+	case "off":
+		cfg.CompressMinSize = 0
+	default:
+		return cfg, fmt.Errorf("invalid database.bodies.compression %q (use zstd, gzip or off)", bodies.Compression)
+	}
+	return cfg, nil
+}
+
+// performCompress compresses the bodies of existing pastes as new ones are
+// compressed; with --dry-run it only reports how many would be
+func performCompress(yamlCfg *config.YAMLConfig, dbDriver, dbSource, dataDir string, opts maintenanceOptions) error {
+	if dataDir == "" {
+		dataDir = getDefaultDataDir()
+	}
+
+	bodyCfg, err := bodyPolicyConfig(yamlCfg)
+	if err != nil {
+		return err
+	}
+
+	// Opening a missing SQLite file would create it
+	if normalizeDriverName(dbDriver) == "sqlite" {
+		if _, err := os.Stat(dbSource); err != nil {
+			return fmt.Errorf("database not found: %s", dbSource)
+		}
+	}
+
+	db, err := storage.NewPool(dbDriver, dbSource, 1, 0, dataDir)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	// Blob-stored bodies stay in the blob store
+	blobStore, err := blob.NewFS(filepath.Join(dataDir, "blobs"))
+	if err != nil {
+		return err
+	}
+	db.SetBodyPolicy(storage.NewBodyPolicy(bodyCfg, blobStore))
+
+	// Always count first, so the prompt says what will change
+	plan, err := db.CompressBodies(true)
+	if errors.Is(err, storage.ErrNoCompression) {
+		return errors.New("compression is off: set database.bodies.compression and compress_min_size")
+	}
+	if err != nil {
+		return err
+	}
+
+	if opts.DryRun {
+		fmt.Println("Dry run: nothing will be changed")
+	}
+	fmt.Printf("Checked %d paste bodies stored in the database\n", plan.Checked)
+	if plan.Compressed == 0 {
+		fmt.Println("Nothing to compress")
+		return nil
+	}
+	fmt.Printf("Bodies to compress with %s: %d (%.2f MB now, %.2f MB after)\n",
+		bodyCfg.Algorithm, plan.Compressed, megabytes(plan.BytesBefore), megabytes(plan.BytesAfter))
+	if opts.DryRun {
+		return nil
+	}
+	if err := confirmMaintenance(fmt.Sprintf("Compress %d paste bodies?", plan.Compressed), opts); err != nil {
+		return err
+	}
+
+	result, err := db.CompressBodies(false)
+	if err != nil {
+		return fmt.Errorf("compressed %d bodies, then: %w", result.Compressed, err)
+	}
+	fmt.Printf("Compressed %d bodies: %.2f MB to %.2f MB\n", result.Compressed, megabytes(result.BytesBefore), megabytes(result.BytesAfter))
+	return nil
+}
+
+func megabytes(n int64) float64 {
+	return float64(n) / 1024 / 1024
+}
@@ -0,0 +1,191 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/caspasswd"
+	"github.com/casjay-forks/caspaste/src/cli"
+	"github.com/casjay-forks/caspaste/src/config"
+	"github.com/casjay-forks/caspaste/src/logger"
+	"github.com/casjay-forks/caspaste/src/metric"
+	"github.com/casjay-forks/caspaste/src/netshare"
+	"github.com/casjay-forks/caspaste/src/outbound"
+	"github.com/casjay-forks/caspaste/src/portutil"
+	"github.com/casjay-forks/caspaste/src/storage"
+	"github.com/casjay-forks/caspaste/src/validation"
+)
+
+// checkDatabaseDriver refuses a database.driver no storage driver is
+// registered for; an empty driver is detected from the source at startup
+func checkDatabaseDriver(driver string) error {
+	names := storage.Drivers()
+	if driver == "" || slices.Contains(names, validation.NormalizeDriver(driver)) {
+		return nil
+	}
+	return fmt.Errorf("invalid database.driver %q (%s)", driver, strings.Join(names, ", "))
+}
+
+// checkConfig reads every setting the way startup and reloads do, returning
+// a config.SettingsError naming each invalid one, or nil
+// Nothing is applied, opened or dialed
+func checkConfig(yamlCfg *config.YAMLConfig) error {
+	var errs config.SettingsError
+	add := func(field string, err error) {
+		if err != nil {
+			errs = append(errs, config.FieldError{Field: field, Message: err.Error()})
+		}
+	}
+
+	var invalid config.SettingsError
+	if err := yamlCfg.Settings().Validate(); errors.As(err, &invalid) {
+		errs = append(errs, invalid...)
+	}
+	add("web.branding", yamlCfg.Branding().Validate())
+
+	hashing := yamlCfg.Security.PasswordHashing
+	add("security.password_hashing", caspasswd.CheckParams(caspasswd.Params{
+		Time:    hashing.Time,
+		Memory:  hashing.Memory,
+		Threads: hashing.Threads,
+	}))
+	out := yamlCfg.Network.Outbound
+	add("network.outbound", outbound.Check(outbound.Config{
+		Proxy:   out.Proxy,
+		NoProxy: out.NoProxy,
+		CAFile:  out.CAFile,
+		Offline: yamlCfg.Network.Offline,
+	}))
+
+	if port := yamlCfg.Server.Port; port != "" {
+		_, _, err := portutil.ParsePorts(port)
+		add("server.port", err)
+	}
+	_, err := serverListeners(yamlCfg)
+	add("server.listeners", err)
+	_, err = configReloadInterval(yamlCfg)
+	add("server.config_reload", err)
+	_, _, err = clusterLease(yamlCfg)
+	add("server.cluster", err)
+	_, err = metric.ParseAllowedIPs(yamlCfg.Server.Metrics.AllowedIPs)
+	add("server.metrics.allowed_ips", err)
+	d := yamlCfg.Server.Dispatch
+	_, err = dispatchDuration("cooldown", d.Cooldown)
+	add("server.dispatch.cooldown", err)
+	_, err = dispatchDuration("timeout", d.Timeout)
+	add("server.dispatch.timeout", err)
+	_, _, err = abuseTickets(yamlCfg)
+	add("server.abuse", err)
+
+	if yamlCfg.Server.GeoIP.Enabled {
+		_, err = geoipMaxMind(yamlCfg)
+		add("server.geoip.source", err)
+		_, err = geoipViewingPolicy(yamlCfg)
+		add("server.geoip.viewing", err)
+		_, err = geoipCreationPolicy(yamlCfg)
+		add("server.geoip.creation", err)
+	}
+
+	add("database.driver", checkDatabaseDriver(yamlCfg.Database.Driver))
+	cache := yamlCfg.Database.Cache
+	switch cache.Driver {
+	case "", "memory", "redis":
+	default:
+		add("database.cache.driver", fmt.Errorf("invalid database.cache.driver %q (memory, redis)", cache.Driver))
+	}
+	if cache.Enabled {
+		if _, err := time.ParseDuration(cache.TTL); err != nil {
+			add("database.cache.ttl", fmt.Errorf("invalid database.cache.ttl: %w", err))
+		}
+	}
+	if _, err := cli.ParseDuration(yamlCfg.Database.CleanupPeriod); err != nil {
+		add("database.cleanup_period", fmt.Errorf("invalid database.cleanup_period: %w", err))
+	}
+	_, err = bodyPolicyConfig(yamlCfg)
+	add("database.bodies.compression", err)
+	_, err = gcOptions(yamlCfg)
+	add("database.gc.audit_retention", err)
+	_, err = dbBreakerConfig(yamlCfg)
+	add("database.breaker", err)
+
+	_, err = firewallAutoBan(yamlCfg)
+	add("security.firewall.auto_ban", err)
+	_, err = firewallDuration("refresh", yamlCfg.Security.Firewall.Refresh)
+	add("security.firewall.refresh", err)
+	_, err = reputationConfig(yamlCfg)
+	add("security.reputation", err)
+	_, err = newSpamFilter(yamlCfg, logger.Logger{})
+	add("security.spam", err)
+	add("security.headers.paths", config.ValidateHeaderPaths(config.HeaderPaths(yamlCfg)))
+
+	limits := yamlCfg.Limits.RateLimit
+	add("limits.rate_limit", netshare.NewRateLimitRules().Set(limits.Exempt, limits.Ban))
+
+	_, err = usersConfig(yamlCfg)
+	add("users", err)
+	_, err = ipDiscovery(yamlCfg)
+	add("server.public_ip", err)
+	features, err := featuresConfig(yamlCfg)
+	add("features", err)
+	_, _, err = reservedCheckers(features)
+	add("features", err)
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// handleConfigCheck is --config-check: it checks the first config file
+// found in configPaths, or in container mode the config built from the
+// environment, and exits 0 when it is valid and 1 when it is not
+func handleConfigCheck(configPaths []string, containerMode bool) {
+	var yamlCfg *config.YAMLConfig
+	var configFilePath string
+	for _, path := range configPaths {
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		cfg, err := config.LoadYAMLConfig(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			os.Exit(1)
+		}
+		yamlCfg, configFilePath = cfg, path
+		break
+	}
+	switch {
+	case yamlCfg == nil && containerMode:
+		yamlCfg = config.DefaultYAMLConfig()
+		config.ApplyEnvironmentOverrides(yamlCfg)
+		configFilePath = "(environment)"
+	case yamlCfg == nil:
+		fmt.Fprintf(os.Stderr, "No config file found; looked for:\n")
+		for _, path := range configPaths {
+			fmt.Fprintf(os.Stderr, "  %s\n", path)
+		}
+		os.Exit(1)
+	}
+	config.ApplyCriticalOverrides(yamlCfg)
+
+	err := checkConfig(yamlCfg)
+	var invalid config.SettingsError
+	if errors.As(err, &invalid) {
+		fmt.Fprintf(os.Stderr, "%s: %d invalid settings\n", configFilePath, len(invalid))
+		for _, f := range invalid {
+			fmt.Fprintf(os.Stderr, "  %s: %s\n", f.Field, f.Message)
+		}
+		os.Exit(1)
+	}
+	fmt.Printf("%s: configuration is valid\n", configFilePath)
+	os.Exit(0)
+}
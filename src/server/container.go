@@ -0,0 +1,108 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/cli"
+	"github.com/casjay-forks/caspaste/src/config"
+	"github.com/casjay-forks/caspaste/src/path"
+	"github.com/casjay-forks/caspaste/src/portutil"
+	"github.com/casjay-forks/caspaste/src/validation"
+)
+
+// containerPort is used when neither the environment nor a mounted config sets a port
+const containerPort = "80"
+
+// isContainerMode reports whether to run in container mode: --container,
+// CASPASTE_CONTAINER=true, or a detected container runtime. CASPASTE_CONTAINER=false
+// turns detection off.
+func isContainerMode(flag bool) bool {
+	if flag {
+		return true
+	}
+	if value, ok := validation.ParseBool(os.Getenv("CASPASTE_CONTAINER")); ok {
+		return value
+	}
+	if path.IsDocker() {
+		return true
+	}
+	// Podman
+	if _, err := os.Stat("/run/.containerenv"); err == nil {
+		return true
+	}
+	return os.Getenv("KUBERNETES_SERVICE_HOST") != ""
+}
+
+// checkContainerFlags rejects flags that manage the host rather than the process
+func checkContainerFlags(daemon bool, service, update string) error {
+	switch {
+	case daemon:
+		return errors.New("--daemon is not supported in container mode; the container runtime supervises the process")
+	case service != "":
+		return errors.New("--service is not supported in container mode; use the container runtime's restart policy")
+	case update != "" || hasArg("--update"):
+		return errors.New("self-update is disabled in container mode; pull a new image instead")
+	}
+	return nil
+}
+
+// validateContainerConfig checks the settings that would otherwise fail late
+// or fall back to interactive defaults, reporting every problem at once
+func validateContainerConfig(cfg *config.YAMLConfig) error {
+	var errs []error
+
+	if cfg.Database.Source == "" {
+		errs = append(errs, errors.New("database source is not set (CASPASTE_DB_SOURCE)"))
+	}
+	driver := cfg.Database.Driver
+	if driver == "" && cfg.Database.Source != "" {
+		detected, err := validation.DetectDriver(cfg.Database.Source)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		driver = detected
+	}
+	if err := checkDatabaseDriver(driver); err != nil {
+		errs = append(errs, fmt.Errorf("%w, from CASPASTE_DB_DRIVER", err))
+	}
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = os.Getenv("CASPASTE_PORT")
+	}
+	if port == "" {
+		port = cfg.Server.Port
+	}
+	if _, _, err := portutil.ParsePorts(port); err != nil {
+		errs = append(errs, fmt.Errorf("invalid port %q: %w", port, err))
+	}
+
+	if cfg.Limits.BodyMaxLength == 0 {
+		errs = append(errs, errors.New("limits.body_max_length cannot be 0 (CASPASTE_BODY_MAX_LENGTH)"))
+	}
+	if lifetime := cfg.Limits.MaxPasteLifetime; lifetime != "" && lifetime != "never" && lifetime != "unlimited" {
+		duration, err := cli.ParseDuration(lifetime)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid max paste lifetime %q (CASPASTE_MAX_PASTE_LIFETIME): %w", lifetime, err))
+		} else if duration < 10*time.Minute {
+			errs = append(errs, errors.New("max paste lifetime cannot be less than 10 minutes (CASPASTE_MAX_PASTE_LIFETIME)"))
+		}
+	}
+
+	switch cfg.Logging.Level {
+	case "", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("invalid log level %q (CASPASTE_LOG_LEVEL): use info, warn or error", cfg.Logging.Level))
+	}
+
+	return errors.Join(errs...)
+}
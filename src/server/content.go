@@ -0,0 +1,207 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/casjay-forks/caspaste/src/config"
+	"github.com/casjay-forks/caspaste/src/content"
+	"github.com/casjay-forks/caspaste/src/logger"
+	"github.com/casjay-forks/caspaste/src/storage"
+	"github.com/casjay-forks/caspaste/src/template"
+	"github.com/casjay-forks/caspaste/src/web"
+)
+
+// contentManager loads, saves and publishes the about, rules and terms pages
+// Pages live in the files named by web.content; with no file configured the
+// embedded text is used until the first save creates one next to server.yml
+type contentManager struct {
+	configPath string
+	vars       template.Variables
+	pages      *content.Set
+	db         storage.DB
+	log        logger.Logger
+
+	mu    sync.Mutex
+	paths map[string]string
+}
+
+// source reads a page as stored
+func (m *contentManager) source(name string) (content.Source, error) {
+	if !content.Valid(name) {
+		return content.Source{}, content.ErrUnknownPage
+	}
+
+	m.mu.Lock()
+	path := m.paths[name]
+	m.mu.Unlock()
+
+	src := content.Source{Name: name, Path: path, Markdown: content.IsMarkdownPath(path)}
+	if path != "" {
+		body, err := os.ReadFile(path)
+		if err == nil {
+			src.Body = string(body)
+			return src, nil
+		}
+		if !os.IsNotExist(err) {
+			return src, err
+		}
+	}
+
+	// Embedded default, as at startup when the file is missing
+	body, err := web.LoadContentWithOverride("data/"+name+".txt", "")
+	if err != nil {
+		return src, err
+	}
+	src.Body = body
+	src.Markdown = false
+	src.Default = true
+	return src, nil
+}
+
+// publish loads a page and makes it live, logging a warning if it cannot be read
+func (m *contentManager) publish(name string) {
+	src, err := m.source(name)
+	if err != nil {
+		m.log.Warn(fmt.Sprintf("Failed to load %s content: %v", name, err))
+	}
+	m.pages.Put(name, content.Page{
+		Text:     template.ReplaceVariables(src.Body, m.vars),
+		Markdown: src.Markdown,
+	})
+}
+
+// setPath points a page at another file and publishes it (config reload)
+func (m *contentManager) setPath(name, path string) {
+	m.mu.Lock()
+	m.paths[name] = path
+	m.mu.Unlock()
+	m.publish(name)
+}
+
+// ContentPage returns a page as stored
+func (m *contentManager) ContentPage(name string) (content.Source, error) {
+	return m.source(name)
+}
+
+// PreviewContentPage renders a page body as it would be published
+func (m *contentManager) PreviewContentPage(body string, markdown bool) string {
+	body = template.ReplaceVariables(body, m.vars)
+	if markdown {
+		return string(web.RenderMarkdown(body))
+	}
+	return "<pre>" + html.EscapeString(body) + "</pre>"
+}
+
+// SaveContentPage writes a page, records a revision and publishes it
+// Switching between markdown and text renames the file (.md or .txt) and
+// updates web.content in server.yml
+func (m *contentManager) SaveContentPage(name, body string, markdown bool, author string) (storage.ContentRevision, error) {
+	if !content.Valid(name) {
+		return storage.ContentRevision{}, content.ErrUnknownPage
+	}
+	if len(body) > content.MaxSize {
+		return storage.ContentRevision{}, content.ErrTooLarge
+	}
+
+	current, err := m.source(name)
+	if err != nil {
+		return storage.ContentRevision{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ext := ".txt"
+	if markdown {
+		ext = ".md"
+	}
+	path := m.paths[name]
+	switch {
+	case path == "":
+		path = filepath.Join(filepath.Dir(m.configPath), "content", name+ext)
+	case content.IsMarkdownPath(path) != markdown:
+		path = strings.TrimSuffix(path, filepath.Ext(path)) + ext
+	}
+	if path != m.paths[name] && m.configPath == "(environment)" {
+		return storage.ContentRevision{}, content.ErrReadOnly
+	}
+
+	// Keep what was live before the first edit so it can be restored
+	if history, err := m.db.ContentRevisionList(name, 1); err == nil && len(history) == 0 {
+		if _, err := m.db.ContentRevisionAdd(name, current.Body, current.Markdown, "original"); err != nil {
+			return storage.ContentRevision{}, err
+		}
+	}
+
+	if err := writeContentFile(path, body); err != nil {
+		return storage.ContentRevision{}, err
+	}
+	if path != m.paths[name] {
+		configWriteMu.Lock()
+		defer configWriteMu.Unlock()
+
+		yamlCfg, err := config.LoadYAMLConfig(m.configPath)
+		if err != nil {
+			return storage.ContentRevision{}, err
+		}
+		switch name {
+		case content.About:
+			yamlCfg.Web.Content.About = path
+		case content.Rules:
+			yamlCfg.Web.Content.Rules = path
+		case content.Terms:
+			yamlCfg.Web.Content.Terms = path
+		}
+		if err := config.SaveYAMLConfig(m.configPath, yamlCfg); err != nil {
+			return storage.ContentRevision{}, err
+		}
+		m.paths[name] = path
+	}
+
+	m.pages.Put(name, content.Page{
+		Text:     template.ReplaceVariables(body, m.vars),
+		Markdown: markdown,
+	})
+	m.log.Info(fmt.Sprintf("Published %s page (%s)", name, path))
+
+	return m.db.ContentRevisionAdd(name, body, markdown, author)
+}
+
+// ContentRevisions lists the newest revisions of a page
+func (m *contentManager) ContentRevisions(name string, limit int) ([]storage.ContentRevision, error) {
+	if !content.Valid(name) {
+		return nil, content.ErrUnknownPage
+	}
+	return m.db.ContentRevisionList(name, limit)
+}
+
+// ContentRevision returns one revision of a page
+func (m *contentManager) ContentRevision(name string, revision int64) (storage.ContentRevision, error) {
+	if !content.Valid(name) {
+		return storage.ContentRevision{}, content.ErrUnknownPage
+	}
+	return m.db.ContentRevisionGet(name, revision)
+}
+
+// writeContentFile replaces a content file atomically
+func writeContentFile(path, body string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(body), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,72 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/casjay-forks/caspaste/src/caspasswd"
+	"github.com/casjay-forks/caspaste/src/config"
+	"github.com/casjay-forks/caspaste/src/cryptopolicy"
+	"github.com/casjay-forks/caspaste/src/logger"
+)
+
+// logCryptoPolicy reports the active crypto policy at startup; in strict
+// mode every line is logged, otherwise only for debugging
+func logCryptoPolicy(yamlCfg *config.YAMLConfig, log logger.Logger) {
+	lines := cryptoReport(yamlCfg)
+	if !cryptopolicy.Strict() {
+		for _, line := range lines {
+			log.Debug(line)
+		}
+		return
+	}
+	for _, line := range lines {
+		log.Info(line)
+	}
+	if !cryptopolicy.ModuleEnabled() {
+		log.Warn("Strict crypto without the Go FIPS 140-3 module: only approved algorithms are used, but not the validated implementations; build with GOFIPS140=v1.0.0 or set GODEBUG=fips140=on")
+	}
+}
+
+// cryptoReport describes the crypto policy, one line per area
+func cryptoReport(yamlCfg *config.YAMLConfig) []string {
+	if !cryptopolicy.Strict() {
+		p := caspasswd.CurrentParams()
+		return []string{
+			"Crypto policy: default (security.fips: false)",
+			fmt.Sprintf("Crypto: TLS %s or later; passwords Argon2id (m=%d, t=%d, p=%d)",
+				tlsMinVersion(yamlCfg), p.Memory, p.Time, p.Threads),
+		}
+	}
+
+	module := "off"
+	if cryptopolicy.ModuleEnabled() {
+		module = "on"
+	}
+	return []string{
+		fmt.Sprintf("Crypto policy: strict, FIPS-approved algorithms only (from: %s)", strings.Join(cryptopolicy.Sources(), ", ")),
+		"Crypto: Go FIPS 140-3 module " + module,
+		fmt.Sprintf("Crypto: TLS %s or later, ECDHE with AES-GCM, curves P-256, P-384, P-521", tlsMinVersion(yamlCfg)),
+		fmt.Sprintf("Crypto: passwords PBKDF2-HMAC-SHA256 (%d iterations); other hashes are replaced at the next login", caspasswd.PBKDF2Iterations),
+		"Crypto: SFTP uploads use ECDH on NIST curves, AES and HMAC-SHA2",
+		"Crypto: tokens from crypto/rand, stored as SHA-256; secrets at rest AES-256-GCM",
+	}
+}
+
+// tlsMinVersion is the lowest TLS version the HTTPS listener accepts
+func tlsMinVersion(yamlCfg *config.YAMLConfig) string {
+	switch v := yamlCfg.Security.TLS.MinVersion; v {
+	case "1.3":
+		return v
+	case "1.0", "1.1":
+		if !cryptopolicy.Strict() {
+			return v
+		}
+	}
+	return "1.2"
+}
@@ -0,0 +1,114 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/casjay-forks/caspaste/src/config"
+	"github.com/casjay-forks/caspaste/src/directory"
+	"github.com/casjay-forks/caspaste/src/leader"
+	"github.com/casjay-forks/caspaste/src/logger"
+	"github.com/casjay-forks/caspaste/src/scheduler"
+	"github.com/casjay-forks/caspaste/src/storage"
+	"github.com/casjay-forks/caspaste/src/telemetry"
+)
+
+// directoryPublicURL is the URL this instance is listed under
+func directoryPublicURL(yamlCfg *config.YAMLConfig) string {
+	if url := yamlCfg.Server.Directory.PublicURL; url != "" {
+		return strings.TrimSuffix(url, "/")
+	}
+	if yamlCfg.Server.FQDN != "" {
+		return "https://" + yamlCfg.Server.FQDN
+	}
+	return ""
+}
+
+// directoryEntry describes this instance for the directory
+func directoryEntry(yamlCfg *config.YAMLConfig, db storage.DB, maxLifeTime int64) (directory.Entry, error) {
+	stats, err := db.PasteStats()
+	if err != nil {
+		return directory.Entry{}, err
+	}
+
+	url := directoryPublicURL(yamlCfg)
+	name := yamlCfg.Server.Directory.Name
+	if name == "" {
+		name = yamlCfg.Server.Title
+	}
+	return directory.Entry{
+		Name:    name,
+		URL:     url,
+		Version: Version,
+		Policies: directory.Policies{
+			Public:      yamlCfg.Server.Public,
+			MaxLifeTime: maxLifeTime,
+			TermsURL:    url + "/terms",
+		},
+		Capacity: directory.Capacity{
+			BodyMaxLength:  yamlCfg.Limits.BodyMaxLength,
+			TitleMaxLength: yamlCfg.Limits.TitleMaxLength,
+			Pastes:         telemetry.PasteBucket(stats.Total),
+		},
+	}, nil
+}
+
+// startDirectoryScheduler refreshes the peers on every replica and, when
+// registration is on, announces this instance from the leader
+func startDirectoryScheduler(svc *directory.Service, yamlCfg *config.YAMLConfig, db storage.DB, maxLifeTime int64, log logger.Logger, elector *leader.Elector) {
+	register := yamlCfg.Server.Directory.Register
+	switch {
+	case register && !yamlCfg.Server.Public:
+		log.Error(errors.New("Directory: private instances are not registered; set server.public or directory.register: false"))
+		register = false
+	case register && directoryPublicURL(yamlCfg) == "":
+		log.Error(errors.New("Directory: set server.directory.public_url or server.fqdn to register"))
+		register = false
+	}
+
+	schedule := yamlCfg.Server.Directory.Schedule
+	if schedule == "" {
+		schedule = "@daily"
+	}
+
+	sched := scheduler.New(scheduler.DefaultConfig())
+	err := sched.AddTask(&scheduler.Task{
+		ID:          "directory",
+		Name:        "Instance directory",
+		Description: "Register with the instance directory and refresh the list of peers",
+		Schedule:    schedule,
+		Enabled:     true,
+		Skippable:   true,
+		Handler: func(ctx context.Context) error {
+			if register && elector.IsLeader() {
+				entry, err := directoryEntry(yamlCfg, db, maxLifeTime)
+				if err == nil {
+					err = svc.Register(ctx, entry)
+				}
+				if err != nil {
+					log.Error(errors.New("Directory registration: " + err.Error()))
+				}
+			}
+			if err := svc.Refresh(ctx); err != nil {
+				log.Error(errors.New("Directory peers: " + err.Error()))
+				return err
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		log.Error(errors.New("Directory disabled: " + err.Error()))
+		return
+	}
+	sched.Start()
+
+	// Fill the list of peers right away rather than waiting for the first slot
+	go sched.RunNow("directory")
+}
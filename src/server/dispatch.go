@@ -0,0 +1,46 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/config"
+	"github.com/casjay-forks/caspaste/src/dispatch"
+)
+
+// newDispatcher starts the pool of workers outbound deliveries run on
+func newDispatcher(yamlCfg *config.YAMLConfig) (*dispatch.Pool, error) {
+	d := yamlCfg.Server.Dispatch
+	cfg := dispatch.Config{
+		Workers:          d.Workers,
+		QueueSize:        d.Queue,
+		FailureThreshold: d.FailureThreshold,
+	}
+
+	var err error
+	if cfg.Cooldown, err = dispatchDuration("cooldown", d.Cooldown); err != nil {
+		return nil, err
+	}
+	if cfg.Timeout, err = dispatchDuration("timeout", d.Timeout); err != nil {
+		return nil, err
+	}
+	return dispatch.New(cfg), nil
+}
+
+// dispatchDuration parses a server.dispatch duration; empty = the default
+func dispatchDuration(name, value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid server.dispatch.%s %q", name, value)
+	}
+	return d, nil
+}
@@ -0,0 +1,171 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/casjay-forks/caspaste/src/config"
+	"github.com/casjay-forks/caspaste/src/domain"
+	"github.com/casjay-forks/caspaste/src/homoglyph"
+)
+
+// featuresConfig reads the features section
+func featuresConfig(yamlCfg *config.YAMLConfig) (config.FeaturesConfig, error) {
+	cfg := yamlCfg.FeaturesConfig()
+	limits := map[string]int{
+		"features.custom_domains.max_domains_per_user": cfg.CustomDomains.MaxDomainsPerUser,
+		"features.custom_domains.max_domains_per_org":  cfg.CustomDomains.MaxDomainsPerOrg,
+		"features.custom_domains.ssl_renewal_days":     cfg.CustomDomains.SSLRenewalDays,
+	}
+	for name, value := range limits {
+		if value < 0 {
+			return cfg, fmt.Errorf("invalid %s %d", name, value)
+		}
+	}
+	return cfg, nil
+}
+
+// reservedCheckers builds the look-alike checks of organization slugs, from
+// reserved_slugs and its blocklist file, and of custom domain labels, from
+// the custom_domains blocklist file
+func reservedCheckers(cfg config.FeaturesConfig) (orgs, domains *homoglyph.Checker, err error) {
+	orgs = homoglyph.NewChecker(cfg.Organizations.ReservedSlugs)
+	if path := cfg.Organizations.BlocklistFile; path != "" {
+		if err := orgs.LoadFile(path); err != nil {
+			return nil, nil, fmt.Errorf("features.organizations.blocklist_file: %w", err)
+		}
+	}
+
+	// Reserved slugs such as www are common domain labels, so domains only
+	// get the words of their own list
+	if path := cfg.CustomDomains.BlocklistFile; path != "" {
+		domains = homoglyph.NewChecker(nil)
+		if err := domains.LoadFile(path); err != nil {
+			return nil, nil, fmt.Errorf("features.custom_domains.blocklist_file: %w", err)
+		}
+	}
+	return orgs, domains, nil
+}
+
+// setIPDiscovery applies new server.public_ip settings; with custom domains
+// on, the public IPs are looked up again in the background
+func (a *accounts) setIPDiscovery(cfg domain.IPDiscoveryConfig) error {
+	if err := a.domains.SetIPDiscovery(cfg); err != nil {
+		return err
+	}
+	if a.features.CustomDomains.Enabled {
+		go a.domains.RefreshPublicIPs()
+	}
+	return nil
+}
+
+// splitDomainPath splits what follows "domains" in a domain API path into the
+// domain and the action after it; ok is false when it is not a domain path
+func splitDomainPath(rest string) (domainStr, action string, ok bool) {
+	if rest == "" {
+		return "", "", true
+	}
+	rest, ok = strings.CutPrefix(rest, "/")
+	if !ok || rest == "" {
+		return "", "", false
+	}
+	domainStr, action, _ = strings.Cut(rest, "/")
+	return domainStr, action, !strings.Contains(action, "/")
+}
+
+// domainRoute returns the handler of a custom domain endpoint, or nil
+func (a *accounts) domainRoute(r *http.Request, path string) func(http.ResponseWriter, *http.Request) error {
+	apiBase := config.APIBasePath()
+
+	if rest, ok := strings.CutPrefix(path, apiBase+"/users/domains"); ok {
+		if domainStr, action, ok := splitDomainPath(rest); ok {
+			return a.userDomainRoute(r.Method, domainStr, action)
+		}
+		return nil
+	}
+
+	if rest, ok := strings.CutPrefix(path, apiBase+"/orgs/"); ok {
+		slug, rest, _ := strings.Cut(rest, "/")
+		rest, ok := strings.CutPrefix(rest, "domains")
+		if slug == "" || !ok {
+			return nil
+		}
+		if domainStr, action, ok := splitDomainPath(rest); ok {
+			return a.orgDomainRoute(r.Method, slug, domainStr, action)
+		}
+	}
+	return nil
+}
+
+// userDomainRoute maps /api/v1/users/domains[/{domain}[/{action}]]
+func (a *accounts) userDomainRoute(method, domainStr, action string) func(http.ResponseWriter, *http.Request) error {
+	api := a.domainAPI
+	if domainStr == "" {
+		if method == http.MethodPost {
+			return api.HandleAddUserDomain
+		}
+		return api.HandleListUserDomains
+	}
+
+	with := func(handle func(http.ResponseWriter, *http.Request, string) error) func(http.ResponseWriter, *http.Request) error {
+		return func(w http.ResponseWriter, r *http.Request) error {
+			return handle(w, r, domainStr)
+		}
+	}
+	switch action {
+	case "":
+		if method == http.MethodDelete {
+			return with(api.HandleDeleteUserDomain)
+		}
+		return with(api.HandleGetUserDomain)
+	case "verify":
+		return with(api.HandleVerifyUserDomain)
+	case "dns":
+		return with(api.HandleGetUserDomainDNS)
+	case "ssl":
+		if method == http.MethodPost {
+			return with(api.HandleConfigureUserDomainSSL)
+		}
+		return with(api.HandleGetUserDomainSSL)
+	case "subdomains":
+		return with(api.HandleUserDomainSubdomains)
+	}
+	return nil
+}
+
+// orgDomainRoute maps /api/v1/orgs/{slug}/domains[/{domain}[/{action}]]
+func (a *accounts) orgDomainRoute(method, slug, domainStr, action string) func(http.ResponseWriter, *http.Request) error {
+	api := a.domainAPI
+	if domainStr == "" {
+		return func(w http.ResponseWriter, r *http.Request) error {
+			if method == http.MethodPost {
+				return api.HandleAddOrgDomain(w, r, slug)
+			}
+			return api.HandleListOrgDomains(w, r, slug)
+		}
+	}
+
+	with := func(handle func(http.ResponseWriter, *http.Request, string, string) error) func(http.ResponseWriter, *http.Request) error {
+		return func(w http.ResponseWriter, r *http.Request) error {
+			return handle(w, r, slug, domainStr)
+		}
+	}
+	switch action {
+	case "":
+		if method == http.MethodDelete {
+			return with(api.HandleDeleteOrgDomain)
+		}
+		return with(api.HandleGetOrgDomain)
+	case "verify":
+		return with(api.HandleVerifyOrgDomain)
+	case "subdomains":
+		return with(api.HandleOrgDomainSubdomains)
+	}
+	return nil
+}
@@ -0,0 +1,346 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/blob"
+	"github.com/casjay-forks/caspaste/src/config"
+	"github.com/casjay-forks/caspaste/src/storage"
+)
+
+// Logical export and import, see storage/export.go for the records
+// The file name picks the format: .jsonl and .jsonl.gz hold one record per
+// line; .tar, .tar.gz and .tgz hold the same lines split into
+// manifest.json, users.jsonl, orgs.jsonl and pastes.jsonl
+
+// exportSections are the files of a tar export, in the order they are
+// written and must be read
+var exportSections = []struct {
+	name   string
+	record string
+}{
+	{"manifest.json", storage.ExportHeaderRecord},
+	{"users.jsonl", storage.ExportUserRecord},
+	{"orgs.jsonl", storage.ExportOrgRecord},
+	{"pastes.jsonl", storage.ExportPasteRecord},
+}
+
+// exportKind returns whether a file is a tar export, and whether it is
+// compressed
+func exportKind(path string) (isTar, isGzip bool, err error) {
+	lower := strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(lower, ".jsonl"):
+		return false, false, nil
+	case strings.HasSuffix(lower, ".jsonl.gz"):
+		return false, true, nil
+	case strings.HasSuffix(lower, ".tar"):
+		return true, false, nil
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return true, true, nil
+	}
+	return false, false, fmt.Errorf("unknown export format: %s (use .jsonl, .jsonl.gz, .tar or .tar.gz)", path)
+}
+
+// performExport writes every paste, and users and organizations with
+// "accounts", to a file (default: {backup}/export-YYYYMMDD-HHMMSS.jsonl.gz)
+func performExport(dbDriver, dbSource, dataDir, backupDir string, args []string) error {
+	if dataDir == "" {
+		dataDir = getDefaultDataDir()
+	}
+
+	var path string
+	accounts := false
+	for _, arg := range args {
+		if arg == "accounts" {
+			accounts = true
+		} else {
+			path = arg
+		}
+	}
+	if path == "" {
+		if err := os.MkdirAll(backupDir, 0755); err != nil {
+			return fmt.Errorf("failed to create backup directory: %w", err)
+		}
+		path = filepath.Join(backupDir, fmt.Sprintf("export-%s.jsonl.gz", time.Now().Format("20060102-150405")))
+	}
+	isTar, isGzip, err := exportKind(path)
+	if err != nil {
+		return err
+	}
+
+	// Opening a missing SQLite file would create it
+	if normalizeDriverName(dbDriver) == "sqlite" {
+		if _, err := os.Stat(dbSource); err != nil {
+			return fmt.Errorf("database not found: %s", dbSource)
+		}
+	}
+
+	db, err := storage.NewPool(dbDriver, dbSource, 1, 0, dataDir)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	// Large paste bodies may be in the blob store; nothing is written, so no thresholds
+	blobStore, err := blob.NewFS(filepath.Join(dataDir, "blobs"))
+	if err != nil {
+		return err
+	}
+	db.SetBodyPolicy(storage.NewBodyPolicy(storage.BodyPolicyConfig{}, blobStore))
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create export file: %w", err)
+	}
+	defer file.Close()
+
+	var out io.Writer = file
+	if isGzip {
+		gz := gzip.NewWriter(file)
+		defer gz.Close()
+		out = gz
+	}
+
+	fmt.Printf("Exporting to %s\n", path)
+	counts := make(map[string]int)
+	if isTar {
+		err = exportTar(db, accounts, out, counts)
+	} else {
+		enc := json.NewEncoder(out)
+		err = db.Export(accounts, func(rec storage.ExportRecord) error {
+			counts[rec.Type]++
+			return enc.Encode(rec)
+		})
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	// Closed here rather than deferred, so a failed write is reported
+	if gz, ok := out.(*gzip.Writer); ok {
+		if err := gz.Close(); err != nil {
+			return err
+		}
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	if accounts {
+		fmt.Printf("Exported %d pastes, %d users and %d organizations\n",
+			counts[storage.ExportPasteRecord], counts[storage.ExportUserRecord], counts[storage.ExportOrgRecord])
+		fmt.Println("The file holds private pastes and password hashes; keep it safe")
+	} else {
+		fmt.Printf("Exported %d pastes\n", counts[storage.ExportPasteRecord])
+		fmt.Println("The file holds private pastes; keep it safe")
+	}
+	return nil
+}
+
+// exportTar writes the records to one temporary file per section, as a tar
+// entry needs its size before its content, then adds them to the archive
+func exportTar(db storage.DB, accounts bool, out io.Writer, counts map[string]int) error {
+	tmpDir, err := os.MkdirTemp("", "caspaste-export-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	files := make(map[string]*os.File)
+	encoders := make(map[string]*json.Encoder)
+	for _, section := range exportSections {
+		f, err := os.Create(filepath.Join(tmpDir, section.name))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		files[section.record] = f
+		encoders[section.record] = json.NewEncoder(f)
+	}
+
+	err = db.Export(accounts, func(rec storage.ExportRecord) error {
+		counts[rec.Type]++
+		return encoders[rec.Type].Encode(rec)
+	})
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(out)
+	for _, section := range exportSections {
+		f := files[section.record]
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		header := &tar.Header{
+			Name:    section.name,
+			Mode:    0600,
+			Size:    info.Size(),
+			ModTime: time.Now(),
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, f); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// performImport adds the pastes, users and organizations of an export that
+// the database does not have yet; nothing already there is changed
+func performImport(yamlCfg *config.YAMLConfig, dbDriver, dbSource, dataDir, path string, opts maintenanceOptions) error {
+	if dataDir == "" {
+		dataDir = getDefaultDataDir()
+	}
+	if path == "" {
+		return errors.New("export file required: caspaste --maintenance \"import FILE\"")
+	}
+	if _, _, err := exportKind(path); err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("export file not found: %s", path)
+	}
+
+	// A new database gets its schema first; a dry run changes nothing
+	if opts.DryRun {
+		if normalizeDriverName(dbDriver) == "sqlite" {
+			if _, err := os.Stat(dbSource); err != nil {
+				return fmt.Errorf("database not found: %s", dbSource)
+			}
+		}
+	} else if err := storage.InitDB(dbDriver, dbSource); err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+
+	db, err := storage.NewPool(dbDriver, dbSource, 1, 0, dataDir)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	// Bodies are stored as the server would store them
+	blobStore, err := blob.NewFS(filepath.Join(dataDir, "blobs"))
+	if err != nil {
+		return err
+	}
+	bodyCfg, err := bodyPolicyConfig(yamlCfg)
+	if err != nil {
+		return err
+	}
+	db.SetBodyPolicy(storage.NewBodyPolicy(bodyCfg, blobStore))
+
+	// Always count first, so the prompt says what will be added
+	plan := db.NewImporter(true)
+	if err := readExport(path, plan); err != nil {
+		return err
+	}
+	if opts.DryRun {
+		fmt.Println("Dry run: nothing will be changed")
+	}
+	fmt.Printf("Import from %s:\n", path)
+	fmt.Printf("  Pastes:        %d\n", plan.Stats.Pastes)
+	fmt.Printf("  Users:         %d\n", plan.Stats.Users)
+	fmt.Printf("  Organizations: %d\n", plan.Stats.Orgs)
+	fmt.Printf("  Already here:  %d (skipped)\n", plan.Stats.Skipped)
+	if opts.DryRun {
+		return nil
+	}
+	if plan.Stats.Pastes+plan.Stats.Users+plan.Stats.Orgs == 0 {
+		fmt.Println("Nothing to import")
+		return nil
+	}
+	if err := confirmMaintenance("Import these records?", opts); err != nil {
+		return err
+	}
+
+	im := db.NewImporter(false)
+	err = readExport(path, im)
+	fmt.Printf("Imported %d pastes, %d users and %d organizations\n", im.Stats.Pastes, im.Stats.Users, im.Stats.Orgs)
+	if err == nil && im.Stats.Users > 0 {
+		fmt.Println("Imported users have no two-factor authentication; they can enable it again")
+	}
+	return err
+}
+
+// readExport passes every record of an export file to im
+func readExport(path string, im *storage.Importer) error {
+	isTar, isGzip, err := exportKind(path)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var in io.Reader = file
+	if isGzip {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("failed to read export: %w", err)
+		}
+		defer gz.Close()
+		in = gz
+	}
+	if !isTar {
+		return importRecords(in, im)
+	}
+
+	tr := tar.NewReader(in)
+	for _, section := range exportSections {
+		header, err := tr.Next()
+		if err != nil {
+			return fmt.Errorf("failed to read export: %w", err)
+		}
+		if header.Name != section.name {
+			return fmt.Errorf("failed to read export: %s found where %s was expected", header.Name, section.name)
+		}
+		if err := importRecords(tr, im); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importRecords passes each record of a stream of JSON records to im
+func importRecords(r io.Reader, im *storage.Importer) error {
+	dec := json.NewDecoder(r)
+	for n := 1; ; n++ {
+		var rec storage.ExportRecord
+		err := dec.Decode(&rec)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read export record %d: %w", n, err)
+		}
+		if err := im.Add(rec); err != nil {
+			return fmt.Errorf("record %d: %w", n, err)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+//go:build fips
+// +build fips
+
+// A fips build uses Go's FIPS 140-3 module unless GODEBUG says otherwise
+
+//go:debug fips140=on
+
+package main
@@ -0,0 +1,84 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/audit"
+	"github.com/casjay-forks/caspaste/src/cli"
+	"github.com/casjay-forks/caspaste/src/config"
+	"github.com/casjay-forks/caspaste/src/firewall"
+	"github.com/casjay-forks/caspaste/src/logger"
+	"github.com/casjay-forks/caspaste/src/metric"
+	"github.com/casjay-forks/caspaste/src/storage"
+)
+
+// newFirewall creates the firewall of security.firewall; its bans are
+// loaded by startFirewall once the schema is ready
+func newFirewall(yamlCfg *config.YAMLConfig, db storage.DB, log logger.Logger) (*firewall.Firewall, error) {
+	auto, err := firewallAutoBan(yamlCfg)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := firewallDuration("refresh", yamlCfg.Security.Firewall.Refresh); err != nil {
+		return nil, err
+	}
+
+	fw := firewall.New(db, auto)
+	fw.OnAutoBan(func(ban storage.IPBan) {
+		log.Warn(fmt.Sprintf("Firewall: banned %s until %s: %s", ban.Network, time.Unix(ban.ExpiresAt, 0).UTC().Format(time.RFC3339), ban.Reason))
+		audit.IPBan(audit.EventIPBanned, ban.Network, ban.Reason, ban.ExpiresAt, "", nil)
+		metric.RecordFirewallAutoBan()
+	})
+	return fw, nil
+}
+
+// startFirewall loads the bans and keeps them in step with other replicas
+func startFirewall(fw *firewall.Firewall, yamlCfg *config.YAMLConfig, log logger.Logger) {
+	if err := fw.Refresh(); err != nil {
+		log.Error(errors.New("Firewall: " + err.Error()))
+	}
+	refresh, _ := firewallDuration("refresh", yamlCfg.Security.Firewall.Refresh)
+	fw.Start(refresh, func(err error) {
+		log.Error(errors.New("Firewall: " + err.Error()))
+	})
+}
+
+// firewallAutoBan reads security.firewall.auto_ban
+func firewallAutoBan(yamlCfg *config.YAMLConfig) (firewall.AutoBan, error) {
+	cfg := yamlCfg.Security.Firewall.AutoBan
+	auto := firewall.AutoBan{Enabled: cfg.Enabled, Violations: cfg.Violations}
+	if cfg.Violations < 0 {
+		return auto, fmt.Errorf("invalid security.firewall.auto_ban.violations %d", cfg.Violations)
+	}
+	var err error
+	if auto.Window, err = firewallDuration("auto_ban.window", cfg.Window); err != nil {
+		return auto, err
+	}
+	if auto.Duration, err = firewallDuration("auto_ban.duration", cfg.Duration); err != nil {
+		return auto, err
+	}
+	return auto, nil
+}
+
+// firewallDuration parses a security.firewall duration, e.g. 30s or 7d;
+// empty = the default
+func firewallDuration(name, value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		d, err = cli.ParseDuration(value)
+	}
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid security.firewall.%s %q", name, value)
+	}
+	return d, nil
+}
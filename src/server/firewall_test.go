@@ -0,0 +1,41 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFirewallDuration(t *testing.T) {
+	testData := map[string]time.Duration{
+		"":      0,
+		"30s":   30 * time.Second,
+		"1h30m": 90 * time.Minute,
+		"10m":   10 * time.Minute,
+		"7d":    7 * 24 * time.Hour,
+		"1h 1d": 25 * time.Hour,
+		"1h1d":  25 * time.Hour,
+		"2w":    14 * 24 * time.Hour,
+	}
+
+	for s, exp := range testData {
+		res, err := firewallDuration("ban_duration", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if exp != res {
+			t.Error("expected", exp, "but got", res, "(input:", s, ")")
+		}
+	}
+
+	for _, s := range []string{"soon", "-1h", "5x"} {
+		if _, err := firewallDuration("ban_duration", s); err == nil {
+			t.Error("expected an error for", s)
+		}
+	}
+}
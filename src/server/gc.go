@@ -0,0 +1,163 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/casjay-forks/caspaste/src/blob"
+	"github.com/casjay-forks/caspaste/src/cli"
+	"github.com/casjay-forks/caspaste/src/config"
+	"github.com/casjay-forks/caspaste/src/leader"
+	"github.com/casjay-forks/caspaste/src/logger"
+	"github.com/casjay-forks/caspaste/src/scheduler"
+	"github.com/casjay-forks/caspaste/src/storage"
+)
+
+// gcOptions reads the garbage collector settings
+func gcOptions(yamlCfg *config.YAMLConfig) (storage.GCOptions, error) {
+	var opts storage.GCOptions
+	retention := yamlCfg.Database.GC.AuditRetention
+	if retention == "" {
+		retention = "90d"
+	}
+	d, err := cli.ParseDuration(retention)
+	if err != nil {
+		return opts, fmt.Errorf("invalid database.gc.audit_retention: %w", err)
+	}
+	opts.AuditRetention = d
+	return opts, nil
+}
+
+// gcSummary formats the non-zero results of a garbage collection
+func gcSummary(results []storage.GCResult) string {
+	var parts []string
+	for _, r := range results {
+		if r.Count > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", r.Count, r.Name))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// startGCScheduler runs the garbage collector from the leader on a schedule
+func startGCScheduler(yamlCfg *config.YAMLConfig, db storage.DB, log logger.Logger, elector *leader.Elector) {
+	opts, err := gcOptions(yamlCfg)
+	if err != nil {
+		log.Error(errors.New("Garbage collector disabled: " + err.Error()))
+		return
+	}
+	schedule := yamlCfg.Database.GC.Schedule
+	if schedule == "" {
+		schedule = "@daily"
+	}
+
+	schedCfg := scheduler.DefaultConfig()
+	schedCfg.IsLeader = elector.IsLeader
+	sched := scheduler.New(schedCfg)
+	err = sched.AddTask(&scheduler.Task{
+		ID:          "gc",
+		Name:        "Garbage collector",
+		Description: "Remove orphaned rows, expired sessions and unused blobs (caspaste --maintenance gc --dry-run)",
+		Schedule:    schedule,
+		Enabled:     true,
+		Skippable:   true,
+		LeaderOnly:  true,
+		Handler: func(ctx context.Context) error {
+			results, err := db.GarbageCollect(opts)
+			if err != nil {
+				log.Error(errors.New("Garbage collector: " + err.Error()))
+				return err
+			}
+			// Only log if something was actually removed
+			if summary := gcSummary(results); summary != "" {
+				log.Info("Garbage collector removed " + summary)
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		log.Error(errors.New("Garbage collector disabled: " + err.Error()))
+		return
+	}
+	sched.Start()
+}
+
+// performGC runs the garbage collector once; with --dry-run it only reports
+// what it would remove
+func performGC(yamlCfg *config.YAMLConfig, dbDriver, dbSource, dataDir string, opts maintenanceOptions) error {
+	if dataDir == "" {
+		dataDir = getDefaultDataDir()
+	}
+
+	gcOpts, err := gcOptions(yamlCfg)
+	if err != nil {
+		return err
+	}
+
+	// Opening a missing SQLite file would create it
+	if normalizeDriverName(dbDriver) == "sqlite" {
+		if _, err := os.Stat(dbSource); err != nil {
+			return fmt.Errorf("database not found: %s", dbSource)
+		}
+	}
+
+	db, err := storage.NewPool(dbDriver, dbSource, 1, 0, dataDir)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	// Paste bodies in the blob store are checked too
+	blobStore, err := blob.NewFS(filepath.Join(dataDir, "blobs"))
+	if err != nil {
+		return err
+	}
+	db.SetBodyPolicy(storage.NewBodyPolicy(storage.BodyPolicyConfig{}, blobStore))
+
+	// Always report first, so the prompt says what will go
+	gcOpts.DryRun = true
+	results, err := db.GarbageCollect(gcOpts)
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	for _, r := range results {
+		total += r.Count
+	}
+	if opts.DryRun {
+		fmt.Println("Dry run: nothing will be changed")
+	}
+	fmt.Println("Garbage collection report:")
+	for _, r := range results {
+		fmt.Printf("  %6d  %s\n", r.Count, r.Name)
+	}
+	if total == 0 {
+		fmt.Println("Nothing to remove")
+		return nil
+	}
+	if opts.DryRun {
+		return nil
+	}
+	if err := confirmMaintenance(fmt.Sprintf("Remove %d items?", total), opts); err != nil {
+		return err
+	}
+
+	gcOpts.DryRun = false
+	results, err = db.GarbageCollect(gcOpts)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Removed " + gcSummary(results))
+	return nil
+}
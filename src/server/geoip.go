@@ -0,0 +1,172 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/casjay-forks/caspaste/src/config"
+	"github.com/casjay-forks/caspaste/src/geoip"
+	"github.com/casjay-forks/caspaste/src/logger"
+	"github.com/casjay-forks/caspaste/src/outbound"
+	"github.com/casjay-forks/caspaste/src/path"
+	"github.com/casjay-forks/caspaste/src/scheduler"
+)
+
+// geoipUpdateSchedule refreshes the databases weekly, Sunday 03:00
+const geoipUpdateSchedule = "0 3 * * 0"
+
+// newGeoIPClient opens the GeoIP databases of server.geoip; nil when disabled
+func newGeoIPClient(yamlCfg *config.YAMLConfig, log logger.Logger) (*geoip.Client, error) {
+	if !yamlCfg.Server.GeoIP.Enabled {
+		return nil, nil
+	}
+	creation, err := geoipCreationPolicy(yamlCfg)
+	if err != nil {
+		return nil, err
+	}
+	viewing, err := geoipViewingPolicy(yamlCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	maxMind, err := geoipMaxMind(yamlCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	client := geoip.NewClient(&geoip.Config{
+		Enabled:        true,
+		Dir:            geoipDir(yamlCfg),
+		DenyCountries:  []string{},
+		ASNEnabled:     true,
+		CountryEnabled: true,
+		MaxMind:        maxMind,
+	})
+	client.SetCreationPolicy(creation)
+	client.SetViewingPolicy(viewing)
+	if err := client.Load(); err != nil {
+		log.Error(errors.New("GeoIP: " + err.Error()))
+	}
+	return client, nil
+}
+
+// geoipMaxMind reads server.geoip.source and the MaxMind account; nil =
+// the free ip-location-db databases
+func geoipMaxMind(yamlCfg *config.YAMLConfig) (*geoip.MaxMindConfig, error) {
+	switch source := yamlCfg.Server.GeoIP.Source; source {
+	case "", geoip.SourceIPLocationDB:
+		return nil, nil
+	case geoip.SourceMaxMind:
+		mm := yamlCfg.Server.GeoIP.MaxMind
+		if mm.AccountID == "" || mm.LicenseKey == "" {
+			return nil, errors.New("server.geoip.source maxmind needs server.geoip.maxmind.account_id and license_key")
+		}
+		return &geoip.MaxMindConfig{
+			AccountID:      mm.AccountID,
+			LicenseKey:     mm.LicenseKey,
+			CountryEdition: mm.CountryEdition,
+			ASNEdition:     mm.ASNEdition,
+		}, nil
+	default:
+		return nil, fmt.Errorf("invalid server.geoip.source %q: use ip-location-db or maxmind", source)
+	}
+}
+
+// geoipDir is where the GeoIP databases are kept
+func geoipDir(yamlCfg *config.YAMLConfig) string {
+	if yamlCfg.Server.GeoIP.Dir != "" {
+		return yamlCfg.Server.GeoIP.Dir
+	}
+	return filepath.Join(path.SecurityDir(), "geoip")
+}
+
+// geoipCreationPolicy reads server.geoip.creation
+func geoipCreationPolicy(yamlCfg *config.YAMLConfig) (geoip.Policy, error) {
+	creation := yamlCfg.Server.GeoIP.Creation
+	return geoipPolicy("server.geoip.creation", geoip.Policy{
+		DenyCountries:  creation.DenyCountries,
+		AllowCountries: creation.AllowCountries,
+		DenyASNs:       creation.DenyASNs,
+		ExemptUsers:    creation.ExemptUsers,
+		Status:         creation.Status,
+	})
+}
+
+// geoipViewingPolicy reads server.geoip.viewing
+func geoipViewingPolicy(yamlCfg *config.YAMLConfig) (geoip.Policy, error) {
+	viewing := yamlCfg.Server.GeoIP.Viewing
+	return geoipPolicy("server.geoip.viewing", geoip.Policy{
+		DenyCountries:  viewing.DenyCountries,
+		AllowCountries: viewing.AllowCountries,
+		DenyASNs:       viewing.DenyASNs,
+		ExemptUsers:    viewing.ExemptUsers,
+		Status:         viewing.Status,
+	})
+}
+
+// geoipPolicy checks the status and country codes of the policy at key
+func geoipPolicy(key string, policy geoip.Policy) (geoip.Policy, error) {
+	switch policy.Status {
+	case 0, http.StatusUnavailableForLegalReasons, http.StatusForbidden:
+	default:
+		return policy, fmt.Errorf("invalid %s.status %d: use 451 or 403", key, policy.Status)
+	}
+	for _, codes := range [][]string{policy.DenyCountries, policy.AllowCountries} {
+		for _, code := range codes {
+			if len(code) != 2 {
+				return policy, fmt.Errorf("invalid country code %q in %s: use ISO 3166-1 alpha-2 codes", code, key)
+			}
+		}
+	}
+	return policy, nil
+}
+
+// startGeoIPScheduler downloads the databases on every replica, as each
+// keeps its own files: right away when they are missing, then weekly
+func startGeoIPScheduler(client *geoip.Client, dir string, log logger.Logger) {
+	if outbound.Offline() {
+		if !client.Loaded() {
+			log.Warn("GeoIP: no databases in " + dir + " and downloads are off in offline mode")
+		}
+		return
+	}
+
+	sched := scheduler.New(scheduler.DefaultConfig())
+	err := sched.AddTask(&scheduler.Task{
+		ID:          "geoip_update",
+		Name:        "GeoIP update",
+		Description: "Download the latest GeoIP country and ASN databases from " + client.Source(),
+		Schedule:    geoipUpdateSchedule,
+		Enabled:     true,
+		Skippable:   true,
+		Handler: func(ctx context.Context) error {
+			if err := client.UpdateDatabases(); err != nil {
+				log.Error(errors.New("GeoIP update: " + err.Error()))
+				return err
+			}
+			if err := client.Load(); err != nil {
+				log.Error(errors.New("GeoIP: " + err.Error()))
+				return err
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		log.Error(errors.New("GeoIP updates disabled: " + err.Error()))
+		return
+	}
+	sched.Start()
+
+	if _, err := os.Stat(filepath.Join(dir, "country.mmdb")); err != nil {
+		go sched.RunNow("geoip_update")
+	}
+}
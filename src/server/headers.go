@@ -0,0 +1,74 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"github.com/casjay-forks/caspaste/src/admin"
+	"github.com/casjay-forks/caspaste/src/config"
+	"github.com/casjay-forks/caspaste/src/csp"
+	"github.com/casjay-forks/caspaste/src/web"
+)
+
+// cspReportsKept is how many recent CSP violation reports are kept
+const cspReportsKept = 200
+
+// securityHeaders builds the security headers from the config, and the
+// collector of CSP violation reports, nil when reports are off
+func securityHeaders(yamlCfg *config.YAMLConfig) (web.SecurityHeadersConfig, *csp.Collector, error) {
+	h := yamlCfg.Security.Headers
+	paths := config.HeaderPaths(yamlCfg)
+	if err := config.ValidateHeaderPaths(paths); err != nil {
+		return web.SecurityHeadersConfig{}, nil, err
+	}
+
+	cfg := web.SecurityHeadersConfig{
+		XFrameOptions:           h.XFrameOptions,
+		XContentTypeOptions:     h.XContentTypeOptions,
+		XSSProtection:           h.XSSProtection,
+		ContentSecurityPolicy:   h.ContentSecurityPolicy,
+		ReferrerPolicy:          h.ReferrerPolicy,
+		PermissionsPolicy:       h.PermissionsPolicy,
+		StrictTransportSecurity: h.StrictTransportSecurity,
+		CSPReportOnly:           h.CSPReportOnly,
+	}
+	for _, p := range paths {
+		cfg.Paths = append(cfg.Paths, web.SecurityHeadersPath{
+			Pattern:               p.Path,
+			ContentSecurityPolicy: p.ContentSecurityPolicy,
+			XFrameOptions:         p.XFrameOptions,
+			CSPReportOnly:         p.CSPReportOnly,
+		})
+	}
+
+	var reports *csp.Collector
+	if !h.DisableCSPReports {
+		cfg.CSPReportURI = csp.ReportPath
+		reports = csp.NewCollector(cspReportsKept)
+	}
+	return cfg, reports, nil
+}
+
+// cspStatus lists the policy of each path for the admin panel
+func cspStatus(cfg web.SecurityHeadersConfig) admin.CSPStatus {
+	status := admin.CSPStatus{Reports: cfg.CSPReportURI != ""}
+	for _, p := range cfg.Paths {
+		policy := p.ContentSecurityPolicy
+		if policy == "" {
+			policy = cfg.ContentSecurityPolicy
+		}
+		status.Policies = append(status.Policies, admin.CSPPolicy{
+			Path:       p.Pattern,
+			Policy:     policy,
+			ReportOnly: cfg.CSPReportOnly || p.CSPReportOnly,
+		})
+	}
+	status.Policies = append(status.Policies, admin.CSPPolicy{
+		Path:       "*",
+		Policy:     cfg.ContentSecurityPolicy,
+		ReportOnly: cfg.CSPReportOnly,
+	})
+	return status
+}
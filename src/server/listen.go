@@ -0,0 +1,158 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/casjay-forks/caspaste/src/config"
+	"github.com/casjay-forks/caspaste/src/cryptopolicy"
+	"github.com/casjay-forks/caspaste/src/privilege"
+	"github.com/casjay-forks/caspaste/src/validation"
+)
+
+// serverListeners reads server.listeners; when there are none the server
+// binds server.listen and server.port
+func serverListeners(yamlCfg *config.YAMLConfig) ([]config.Listener, error) {
+	listeners := yamlCfg.Server.Listeners
+	if err := config.ValidateListeners(listeners); err != nil {
+		return nil, err
+	}
+	return listeners, nil
+}
+
+// listenerPorts returns the ports of the first HTTP and HTTPS listeners, for
+// building URLs; with only unix sockets the server is behind a proxy, taken
+// to serve port 80
+func listenerPorts(listeners []config.Listener) (httpPort, httpsPort int) {
+	for _, l := range listeners {
+		port := l.Port()
+		switch {
+		case port == 0:
+		case l.TLS && httpsPort == 0:
+			httpsPort = port
+		case !l.TLS && httpPort == 0:
+			httpPort = port
+		}
+	}
+	if httpPort == 0 && httpsPort == 0 {
+		httpPort = 80
+	}
+	return httpPort, httpsPort
+}
+
+// bindListener opens a listener; done as root, before privileges are
+// dropped. A unix socket left behind by an earlier run is replaced, and the
+// new one is owned by uid:gid (when set) and writable by its group, so a
+// reverse proxy in that group can connect
+func bindListener(l config.Listener, uid, gid int) (net.Listener, error) {
+	path := l.Unix()
+	if path == "" {
+		return net.Listen("tcp", l.Address)
+	}
+
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0660); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	if uid > 0 && gid > 0 {
+		if err := privilege.ChownPath(path, uid, gid); err != nil {
+			ln.Close()
+			return nil, err
+		}
+	}
+	return unixListener{ln}, nil
+}
+
+// unixListener reports its connections as coming from the loopback address:
+// unix sockets have no client address, and what connects to one is a local
+// proxy whose forwarding headers are trusted
+type unixListener struct {
+	net.Listener
+}
+
+func (l unixListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return unixConn{conn}, nil
+}
+
+type unixConn struct {
+	net.Conn
+}
+
+func (unixConn) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}
+}
+
+// serverTLSCert finds and loads the certificate HTTPS is served with:
+// security.tls.cert_file and key_file when the cert file exists, else a
+// Let's Encrypt certificate found for fqdn; the defaults name files that are
+// usually missing, so a missing one is not an error
+// Call before privileges are dropped, as keys are often readable by root only
+func serverTLSCert(yamlCfg *config.YAMLConfig, fqdn string) (*validation.TLSCertPaths, tls.Certificate, error) {
+	t := yamlCfg.Security.TLS
+	paths := &validation.TLSCertPaths{CertFile: t.CertFile, KeyFile: t.KeyFile, Domain: fqdn}
+	if _, err := os.Stat(t.CertFile); t.CertFile == "" || err != nil {
+		if paths, err = validation.FindLetsEncryptCerts(fqdn); err != nil {
+			return nil, tls.Certificate{}, err
+		}
+	}
+	cert, err := tls.LoadX509KeyPair(paths.CertFile, paths.KeyFile)
+	if err != nil {
+		return nil, tls.Certificate{}, err
+	}
+	return paths, cert, nil
+}
+
+// serverTLSConfig returns the TLS settings of the HTTPS listeners
+func serverTLSConfig(yamlCfg *config.YAMLConfig, cert tls.Certificate) *tls.Config {
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12, // Default to TLS 1.2
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_CHACHA20_POLY1305_SHA256,
+		},
+		PreferServerCipherSuites: true,
+	}
+
+	// Apply configured TLS min version
+	switch yamlCfg.Security.TLS.MinVersion {
+	case "1.3":
+		tlsConfig.MinVersion = tls.VersionTLS13
+	case "1.2":
+		tlsConfig.MinVersion = tls.VersionTLS12
+	case "1.1":
+		tlsConfig.MinVersion = tls.VersionTLS11
+	case "1.0":
+		tlsConfig.MinVersion = tls.VersionTLS10
+	}
+
+	// Strict crypto keeps only FIPS-approved versions, suites and curves
+	cryptopolicy.ApplyTLS(tlsConfig)
+	return tlsConfig
+}
@@ -0,0 +1,308 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/casjay-forks/caspaste/src/blob"
+	"github.com/casjay-forks/caspaste/src/storage"
+)
+
+// maintenanceOptions are the flags shared by the --maintenance commands
+type maintenanceOptions struct {
+	// Report what would change without changing anything
+	DryRun bool
+	// Skip the confirmation prompt
+	Yes bool
+}
+
+var errMaintenanceAborted = errors.New("aborted")
+
+// confirmMaintenance asks before a destructive command runs
+// Without a terminal to ask on, --yes is required so automation fails fast
+// instead of waiting for an answer
+func confirmMaintenance(prompt string, opts maintenanceOptions) error {
+	if opts.Yes {
+		return nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return errors.New("confirmation required: re-run with --yes, or with --dry-run to see what would change")
+	}
+
+	fmt.Printf("%s [y/N]: ", prompt)
+	input, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	input = strings.ToLower(strings.TrimSpace(input))
+	if input != "y" && input != "yes" {
+		return errMaintenanceAborted
+	}
+	return nil
+}
+
+// exitMaintenance ends a maintenance command with its result
+func exitMaintenance(name string, err error) {
+	switch {
+	case errors.Is(err, errMaintenanceAborted):
+		fmt.Println("Aborted")
+		os.Exit(1)
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "%s failed: %v\n", name, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// printRestorePlan lists the files a restore from backupPath would write
+// Restores copy over the current directories, so files missing from the
+// backup are kept
+func printRestorePlan(dbDriver, dbSource, dataDir, configDir, backupDir, backupPath string) error {
+	fmt.Println("Dry run: nothing will be changed")
+	fmt.Printf("Would create safety backup: %s\n", filepath.Join(backupDir, "pre-restore-"+time.Now().Format("20060102-150405")+".tar.gz"))
+	fmt.Printf("Would restore from: %s\n", backupPath)
+	fmt.Println()
+
+	var replaced, created int
+	err := readBackup(backupPath, func(hdr *tar.Header, r io.Reader) error {
+		if hdr.Typeflag != tar.TypeReg {
+			return nil
+		}
+
+		target := restoreTarget(hdr.Name, dbDriver, dbSource, dataDir, configDir)
+		if target == "" {
+			return nil
+		}
+		action := "create "
+		if _, err := os.Stat(target); err == nil {
+			action = "replace"
+			replaced++
+		} else {
+			created++
+		}
+		fmt.Printf("  %s %s (%d bytes)\n", action, target, hdr.Size)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Printf("Would replace %d files and create %d; files not in the backup are kept\n", replaced, created)
+	return nil
+}
+
+// restoreTarget returns where performRestore copies a file of the backup
+// archive, or "" if it is not restored
+func restoreTarget(name, dbDriver, dbSource, dataDir, configDir string) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	dir, rel, _ := strings.Cut(name, "/")
+	switch dir {
+	case "data":
+		return filepath.Join(dataDir, filepath.FromSlash(rel))
+	case "config":
+		if configDir != "" {
+			return filepath.Join(configDir, filepath.FromSlash(rel))
+		}
+	case "external-db":
+		if rel == "caspaste.db" && (dbDriver == "sqlite3" || dbDriver == "sqlite") {
+			return dbSource
+		}
+	}
+	return ""
+}
+
+// performCleanup deletes expired pastes, as the cleanup job of a running
+// server does
+func performCleanup(dbDriver, dbSource, dataDir string, opts maintenanceOptions) error {
+	if dataDir == "" {
+		dataDir = getDefaultDataDir()
+	}
+
+	// Opening a missing SQLite file would create it
+	if normalizeDriverName(dbDriver) == "sqlite" {
+		if _, err := os.Stat(dbSource); err != nil {
+			return fmt.Errorf("database not found: %s", dbSource)
+		}
+	}
+
+	db, err := storage.NewPool(dbDriver, dbSource, 1, 0, dataDir)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	pastes, err := db.PasteListExpired()
+	if err != nil {
+		return err
+	}
+	if len(pastes) == 0 {
+		fmt.Println("No expired pastes")
+		return nil
+	}
+
+	if opts.DryRun {
+		fmt.Println("Dry run: nothing will be changed")
+	}
+	fmt.Printf("Expired pastes to delete: %d\n", len(pastes))
+	for _, paste := range pastes {
+		line := fmt.Sprintf("  %s  expired %s", paste.ID, time.Unix(paste.DeleteTime, 0).Format(time.RFC3339))
+		if paste.Blob {
+			line += ", blob body"
+		}
+		if paste.Tags > 0 {
+			line += fmt.Sprintf(", %d tags", paste.Tags)
+		}
+		fmt.Println(line)
+	}
+	if opts.DryRun {
+		return nil
+	}
+	if err := confirmMaintenance(fmt.Sprintf("Delete %d expired pastes?", len(pastes)), opts); err != nil {
+		return err
+	}
+
+	// Blob-stored bodies are deleted with their pastes
+	blobStore, err := blob.NewFS(filepath.Join(dataDir, "blobs"))
+	if err != nil {
+		return err
+	}
+	db.SetBodyPolicy(storage.NewBodyPolicy(storage.BodyPolicyConfig{}, blobStore))
+
+	count, err := db.PasteDeleteExpired()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Deleted %d expired pastes\n", count)
+	return nil
+}
+
+// performMigrate runs the migration the server would run on its next start
+// because database.driver or database.source changed
+func performMigrate(dbDriver, dbSource, dataDir, configDir, backupDir string, opts maintenanceOptions) error {
+	if dataDir == "" {
+		dataDir = getDefaultDataDir()
+	}
+
+	oldDriver, oldSource, ok := pendingMigration(dataDir, dbDriver, dbSource)
+	if !ok {
+		fmt.Println("No database migration pending")
+		return nil
+	}
+
+	if opts.DryRun {
+		ids, err := storage.MigratePlan(normalizeDriverName(oldDriver), oldSource)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Dry run: nothing will be changed")
+		fmt.Printf("From: %s (%s)\n", oldDriver, oldSource)
+		fmt.Printf("To: %s (%s)\n", dbDriver, dbSource)
+		fmt.Printf("Would create safety backup: %s\n", filepath.Join(backupDir, "pre-migration-"+time.Now().Format("20060102-150405")+".tar.gz"))
+		fmt.Printf("Would copy %d pastes:\n", len(ids))
+		for _, id := range ids {
+			fmt.Printf("  %s\n", id)
+		}
+		fmt.Printf("Would record %s as the current database in %s\n", dbDriver, filepath.Join(dataDir, ".db-state"))
+		return nil
+	}
+
+	prompt := fmt.Sprintf("Copy pastes from %s (%s) to %s (%s)?", oldDriver, oldSource, dbDriver, dbSource)
+	if err := confirmMaintenance(prompt, opts); err != nil {
+		return err
+	}
+	return checkAndMigrateDatabase(dataDir, configDir, backupDir, dbDriver, dbSource)
+}
+
+// performFsck checks the database and blob store; "repair" as argument fixes
+// what can be fixed
+// Problems left unrepaired make the command fail, so scripts notice them
+func performFsck(dbDriver, dbSource, dataDir, arg string, opts maintenanceOptions) error {
+	if dataDir == "" {
+		dataDir = getDefaultDataDir()
+	}
+	repair := false
+	switch arg {
+	case "":
+	case "repair":
+		repair = true
+	default:
+		return fmt.Errorf("unknown fsck argument %q (use: fsck [repair])", arg)
+	}
+
+	// Opening a missing SQLite file would create it
+	if normalizeDriverName(dbDriver) == "sqlite" {
+		if _, err := os.Stat(dbSource); err != nil {
+			return fmt.Errorf("database not found: %s", dbSource)
+		}
+	}
+
+	db, err := storage.NewPool(dbDriver, dbSource, 1, 0, dataDir)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	// Blob-stored bodies are checked against their checksums
+	blobStore, err := blob.NewFS(filepath.Join(dataDir, "blobs"))
+	if err != nil {
+		return err
+	}
+	db.SetBodyPolicy(storage.NewBodyPolicy(storage.BodyPolicyConfig{}, blobStore))
+
+	report, err := db.Fsck()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Checked %d pastes\n", report.Pastes)
+	if len(report.Issues) == 0 {
+		fmt.Println("No problems found")
+		return nil
+	}
+	for _, issue := range report.Issues {
+		fmt.Printf("  [%s] %s: %s\n", issue.Check, issue.Item, issue.Problem)
+		if issue.Repair != "" {
+			fmt.Printf("      repair: %s\n", issue.Repair)
+		}
+	}
+	repairable := report.Repairable()
+	fmt.Printf("Found %d problems, %d repairable\n", len(report.Issues), repairable)
+
+	if !repair || repairable == 0 {
+		if repairable > 0 {
+			fmt.Println("Run 'caspaste --maintenance \"fsck repair\"' to repair them")
+		}
+		return fmt.Errorf("%d problems found", len(report.Issues))
+	}
+	if opts.DryRun {
+		fmt.Println("Dry run: nothing was repaired")
+		return nil
+	}
+	if err := confirmMaintenance(fmt.Sprintf("Repair %d problems?", repairable), opts); err != nil {
+		return err
+	}
+
+	repaired, err := db.FsckRepair(report)
+	if err != nil {
+		return fmt.Errorf("repaired %d problems, then: %w", repaired, err)
+	}
+	fmt.Printf("Repaired %d problems\n", repaired)
+	if left := len(report.Issues) - repaired; left > 0 {
+		return fmt.Errorf("%d problems need manual attention", left)
+	}
+	return nil
+}
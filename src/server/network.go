@@ -0,0 +1,176 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/admin"
+	"github.com/casjay-forks/caspaste/src/config"
+	"github.com/casjay-forks/caspaste/src/domain"
+	"github.com/casjay-forks/caspaste/src/outbound"
+	"github.com/casjay-forks/caspaste/src/reputation"
+	"github.com/casjay-forks/caspaste/src/resolver"
+	"github.com/casjay-forks/caspaste/src/spam"
+)
+
+// offlineDetail is why a feature that reaches the internet is off
+const offlineDetail = "Turned off by offline mode (network.offline)"
+
+// configureOutbound sets the proxy, CA certificates and offline mode for
+// the connections the server makes
+func configureOutbound(yamlCfg *config.YAMLConfig) error {
+	out := yamlCfg.Network.Outbound
+	return outbound.Configure(outbound.Config{
+		Proxy:   out.Proxy,
+		NoProxy: out.NoProxy,
+		CAFile:  out.CAFile,
+		Offline: yamlCfg.Network.Offline,
+	})
+}
+
+// dnsResolver sends lookups to the server.dns upstreams, each bounded by
+// timeout, or by server.dns.timeout when it is 0
+func dnsResolver(yamlCfg *config.YAMLConfig, timeout time.Duration) *resolver.Resolver {
+	dns := yamlCfg.Server.DNS
+	if timeout == 0 {
+		timeout = time.Duration(dns.Timeout) * time.Second
+	}
+	return resolver.New(resolver.Config{Servers: dns.Servers, DoH: dns.DoH, Timeout: timeout})
+}
+
+// ipDiscovery reads server.public_ip, the way custom domain checks learn
+// the addresses A records must point at
+func ipDiscovery(yamlCfg *config.YAMLConfig) (domain.IPDiscoveryConfig, error) {
+	pub := yamlCfg.Server.PublicIP
+	for _, ip := range pub.Static {
+		if net.ParseIP(strings.TrimSpace(ip)) == nil {
+			return domain.IPDiscoveryConfig{}, fmt.Errorf("invalid server.public_ip.static %q", ip)
+		}
+	}
+	cfg := domain.IPDiscoveryConfig{
+		StaticIPs:   pub.Static,
+		Disabled:    pub.DisableDiscovery,
+		Services:    pub.Services,
+		STUNServers: pub.STUN,
+	}
+	// An empty list keeps the built-in services
+	if len(cfg.Services) == 0 {
+		cfg.Services = nil
+	}
+	return cfg, nil
+}
+
+// networkStatus lists the features that connect to other hosts for the
+// admin panel: those that reach the internet are off in offline mode, while
+// the configured mail server and upload targets are still used
+func networkStatus(yamlCfg *config.YAMLConfig) admin.NetworkStatus {
+	offline := yamlCfg.Network.Offline
+	status := admin.NetworkStatus{
+		Offline: offline,
+		Proxy:   redactProxy(yamlCfg.Network.Outbound.Proxy),
+	}
+
+	// internet is a feature that reaches the internet: off in offline mode
+	internet := func(name string, on bool, detail, off string) {
+		f := admin.OutboundFeature{Name: name, Enabled: on && !offline, Detail: detail}
+		switch {
+		case offline:
+			f.Detail = offlineDetail
+		case !on:
+			f.Detail = off
+		}
+		status.Features = append(status.Features, f)
+	}
+	// configured is a feature that reaches a host set in the config
+	configured := func(name, host, off string) {
+		f := admin.OutboundFeature{Name: name, Enabled: host != "", Detail: host}
+		if host == "" {
+			f.Detail = off
+		}
+		status.Features = append(status.Features, f)
+	}
+
+	pub := yamlCfg.Server.PublicIP
+	ipOff := "Turned off (server.public_ip.disable_discovery)"
+	if len(pub.Static) > 0 {
+		ipOff = "Static IPs: " + strings.Join(pub.Static, ", ")
+	}
+	internet("Public IP discovery", len(pub.Static) == 0 && !pub.DisableDiscovery,
+		"STUN and HTTP IP services, for custom domain checks", ipOff)
+	internet("Update checks", true, "caspaste --update", "")
+	internet("ACME certificates", true, "Let's Encrypt", "")
+
+	tel := yamlCfg.Server.Telemetry
+	internet("Telemetry", tel.Enabled && tel.Endpoint != "", tel.Endpoint, "Turned off (server.telemetry.enabled)")
+
+	dir := yamlCfg.Server.Directory
+	internet("Instance directory", dir.URL != "", dir.URL, "No directory (server.directory.url)")
+	geoipSource := "ip-location-db database updates"
+	if yamlCfg.Server.GeoIP.Source == "maxmind" {
+		geoipSource = "MaxMind database updates"
+	}
+	internet("GeoIP downloads", yamlCfg.Server.GeoIP.Enabled, geoipSource, "Turned off (server.geoip.enabled)")
+
+	rep := yamlCfg.Security.Reputation
+	var sources []string
+	sources = append(sources, rep.DNSBL...)
+	if rep.APIKey != "" {
+		apiURL := rep.APIURL
+		if apiURL == "" {
+			apiURL = reputation.DefaultAPIURL
+		}
+		sources = append(sources, apiURL)
+	}
+	repOff := "Turned off (security.reputation.enabled)"
+	if rep.Enabled {
+		repOff = "No DNSBL zones or API key (security.reputation)"
+	}
+	internet("IP reputation", rep.Enabled && len(sources) > 0, strings.Join(sources, ", "), repOff)
+
+	sb := yamlCfg.Security.Spam.SafeBrowsing
+	sbURL := sb.APIURL
+	if sbURL == "" {
+		sbURL = spam.DefaultSafeBrowsingURL
+	}
+	sbOff := "Turned off (security.spam.enabled)"
+	if yamlCfg.Security.Spam.Enabled {
+		sbOff = "No API key (security.spam.safe_browsing.api_key)"
+	}
+	internet("Safe Browsing", yamlCfg.Security.Spam.Enabled && sb.APIKey != "", sbURL, sbOff)
+
+	smtp := yamlCfg.Server.SMTP
+	smtpHost := ""
+	if smtp.Host != "" {
+		smtpHost = fmt.Sprintf("%s:%d", smtp.Host, smtp.Port)
+	}
+	configured("Email", smtpHost, "No mail server (server.smtp.host)")
+
+	backup := yamlCfg.Backup
+	var uploads []string
+	if backup.S3.Endpoint != "" {
+		uploads = append(uploads, backup.S3.Endpoint)
+	}
+	if backup.SFTP.Host != "" {
+		uploads = append(uploads, "sftp://"+backup.SFTP.Host)
+	}
+	configured("Backup uploads", strings.Join(uploads, ", "), "No upload target (backup.s3, backup.sftp)")
+	configured("Mirror upload", yamlCfg.Server.Mirror.S3.Endpoint, "No upload target (server.mirror.s3)")
+	return status
+}
+
+// redactProxy drops the password from a proxy URL
+func redactProxy(proxy string) string {
+	u, err := url.Parse(proxy)
+	if err != nil || u.User == nil {
+		return proxy
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,95 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/casjay-forks/caspaste/src/admin"
+	"github.com/casjay-forks/caspaste/src/config"
+	"github.com/casjay-forks/caspaste/src/logger"
+	"github.com/casjay-forks/caspaste/src/user"
+)
+
+// policyManager exports and imports policy bundles for the admin API,
+// saving them to the config file
+type policyManager struct {
+	configPath string
+	cfg        *config.Config
+	log        logger.Logger
+}
+
+// ExportPolicies returns the policies of the config file
+func (m *policyManager) ExportPolicies() (config.PolicyBundle, error) {
+	configWriteMu.Lock()
+	defer configWriteMu.Unlock()
+
+	if m.configPath == "(environment)" {
+		return config.PolicyBundle{}, config.ErrPoliciesReadOnly
+	}
+	yamlCfg, err := config.LoadYAMLConfig(m.configPath)
+	if err != nil {
+		return config.PolicyBundle{}, err
+	}
+	return yamlCfg.Policies(), nil
+}
+
+// ImportPolicies replaces the policies in the config file
+// Rate limits and reserved slugs apply at once; the rest, like other config
+// changes, take effect after a restart
+// The config reloader sees the file change but finds nothing new to apply
+func (m *policyManager) ImportPolicies(bundle config.PolicyBundle) (admin.PolicyImport, error) {
+	configWriteMu.Lock()
+	defer configWriteMu.Unlock()
+
+	result := admin.PolicyImport{Changed: []string{}, Applied: []string{}, Restart: []string{}}
+	if m.configPath == "(environment)" {
+		return result, config.ErrPoliciesReadOnly
+	}
+	if err := bundle.Validate(); err != nil {
+		return result, err
+	}
+
+	// Start from the file as written so environment overrides and resolved
+	// placeholders are not saved into it
+	yamlCfg, err := config.LoadYAMLConfig(m.configPath)
+	if err != nil {
+		return result, err
+	}
+	before := *yamlCfg
+	yamlCfg.SetPolicies(bundle)
+
+	changed := changedSettings(reflect.ValueOf(before), reflect.ValueOf(*yamlCfg), "")
+	if len(changed) == 0 {
+		return result, nil
+	}
+	result.Changed = changed
+
+	// The rest of the file is checked too, as startup would read it
+	if err := checkConfig(yamlCfg); err != nil {
+		return result, err
+	}
+	if err := config.SaveYAMLConfig(m.configPath, yamlCfg); err != nil {
+		return result, err
+	}
+
+	if err := applyRateLimits(m.cfg, yamlCfg); err != nil {
+		return result, err
+	}
+	user.SetReservedSlugs(yamlCfg.Limits.ReservedSlugs)
+	for _, key := range result.Changed {
+		if strings.HasPrefix(key, "limits.rate_limit.") || key == "limits.reserved_slugs" {
+			result.Applied = append(result.Applied, key)
+		} else {
+			result.Restart = append(result.Restart, key)
+		}
+	}
+
+	m.log.Info("Policy bundle imported: " + strings.Join(result.Changed, ", "))
+	return result, nil
+}
@@ -0,0 +1,178 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/admin"
+	"github.com/casjay-forks/caspaste/src/config"
+	"github.com/casjay-forks/caspaste/src/logger"
+	"github.com/casjay-forks/caspaste/src/netshare"
+)
+
+// maxRateLimitUsage is the number of IPs shown per route class
+const maxRateLimitUsage = 100
+
+// applyRateLimits sets the running limits, exemptions and bans from the config
+// The exemptions and bans are left unchanged if one of them is invalid
+func applyRateLimits(cfg *config.Config, yamlCfg *config.YAMLConfig) error {
+	for _, class := range config.RateLimitClasses {
+		w := yamlCfg.RateLimitClass(class)
+		cfg.RateLimitSystem(class).SetLimits(w.Per5Min, w.Per15Min, w.Per1Hour)
+	}
+	limits := yamlCfg.Limits.RateLimit
+	return cfg.RateLimitRules.Set(limits.Exempt, limits.Ban)
+}
+
+// rateLimitManager changes rate limits, exemptions and bans from the admin
+// panel, saving them to the config file
+type rateLimitManager struct {
+	configPath string
+	cfg        *config.Config
+	log        logger.Logger
+}
+
+// RateLimitClasses returns the limits and busiest IPs of each route class
+func (m *rateLimitManager) RateLimitClasses() []admin.RateLimitClass {
+	classes := make([]admin.RateLimitClass, 0, len(config.RateLimitClasses))
+	for _, class := range config.RateLimitClasses {
+		rateSys := m.cfg.RateLimitSystem(class)
+		per5Min, per15Min, per1Hour := rateSys.Limits()
+		usage := rateSys.Usage()
+		if len(usage) > maxRateLimitUsage {
+			usage = usage[:maxRateLimitUsage]
+		}
+		classes = append(classes, admin.RateLimitClass{
+			Name:   class,
+			Limits: config.RateLimitWindows{Per5Min: per5Min, Per15Min: per15Min, Per1Hour: per1Hour},
+			Usage:  usage,
+		})
+	}
+	return classes
+}
+
+// RateLimitRules returns the exemptions and bans in effect
+func (m *rateLimitManager) RateLimitRules() (exempt, ban []netshare.RateLimitRule) {
+	return m.cfg.RateLimitRules.Rules()
+}
+
+// SetRateLimit changes the limits of a route class
+func (m *rateLimitManager) SetRateLimit(class string, limits config.RateLimitWindows) error {
+	return m.update(func(yamlCfg *config.YAMLConfig) error {
+		w := yamlCfg.RateLimitClass(class)
+		if w == nil {
+			return fmt.Errorf("%w: unknown route class %q", netshare.ErrInvalidRateLimitRule, class)
+		}
+		*w = limits
+		m.log.Info(fmt.Sprintf("Rate limit %s set to %d/5m, %d/15m, %d/1h", class, limits.Per5Min, limits.Per15Min, limits.Per1Hour))
+		return nil
+	})
+}
+
+// AddRateLimitRule adds an exemption or ban, replacing one for the same IP
+func (m *rateLimitManager) AddRateLimitRule(kind string, rule netshare.RateLimitRule) error {
+	rule.IP = strings.TrimSpace(rule.IP)
+	if _, err := rule.Network(); err != nil {
+		return err
+	}
+	if _, err := rule.Expiry(); err != nil {
+		return err
+	}
+	return m.update(func(yamlCfg *config.YAMLConfig) error {
+		list, err := rateLimitRuleList(yamlCfg, kind)
+		if err != nil {
+			return err
+		}
+		kept := (*list)[:0]
+		for _, r := range *list {
+			if r.IP != rule.IP {
+				kept = append(kept, r)
+			}
+		}
+		*list = append(kept, rule)
+		m.log.Info(fmt.Sprintf("Rate limit %s added for %s", kind, rule.IP))
+		return nil
+	})
+}
+
+// RemoveRateLimitRule removes the exemption or ban of an IP
+func (m *rateLimitManager) RemoveRateLimitRule(kind, ip string) error {
+	return m.update(func(yamlCfg *config.YAMLConfig) error {
+		list, err := rateLimitRuleList(yamlCfg, kind)
+		if err != nil {
+			return err
+		}
+		for i, r := range *list {
+			if r.IP == ip {
+				*list = append((*list)[:i], (*list)[i+1:]...)
+				m.log.Info(fmt.Sprintf("Rate limit %s removed for %s", kind, ip))
+				return nil
+			}
+		}
+		return netshare.ErrRateLimitRuleNotFound
+	})
+}
+
+// update changes the rate limits in the config file, dropping expired
+// exemptions and bans, then applies them
+// The config reloader sees the file change but finds nothing new to apply
+func (m *rateLimitManager) update(change func(yamlCfg *config.YAMLConfig) error) error {
+	configWriteMu.Lock()
+	defer configWriteMu.Unlock()
+
+	if m.configPath == "(environment)" {
+		return config.ErrRateLimitsReadOnly
+	}
+
+	// Start from the file as written so environment overrides and resolved
+	// placeholders are not saved into it
+	yamlCfg, err := config.LoadYAMLConfig(m.configPath)
+	if err != nil {
+		return err
+	}
+	if err := change(yamlCfg); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	limits := &yamlCfg.Limits.RateLimit
+	limits.Exempt = unexpiredRules(limits.Exempt, now)
+	limits.Ban = unexpiredRules(limits.Ban, now)
+
+	// Validate before saving so a bad rule never reaches the file
+	if err := netshare.NewRateLimitRules().Set(limits.Exempt, limits.Ban); err != nil {
+		return err
+	}
+	if err := config.SaveYAMLConfig(m.configPath, yamlCfg); err != nil {
+		return err
+	}
+	return applyRateLimits(m.cfg, yamlCfg)
+}
+
+// rateLimitRuleList returns the exemption or ban list of the config
+func rateLimitRuleList(yamlCfg *config.YAMLConfig, kind string) (*[]netshare.RateLimitRule, error) {
+	switch kind {
+	case "exempt":
+		return &yamlCfg.Limits.RateLimit.Exempt, nil
+	case "ban":
+		return &yamlCfg.Limits.RateLimit.Ban, nil
+	}
+	return nil, fmt.Errorf("%w: unknown rule kind %q", netshare.ErrInvalidRateLimitRule, kind)
+}
+
+func unexpiredRules(rules []netshare.RateLimitRule, now time.Time) []netshare.RateLimitRule {
+	kept := []netshare.RateLimitRule{}
+	for _, rule := range rules {
+		if !rule.Expired(now) {
+			kept = append(kept, rule)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,65 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/config"
+	"github.com/casjay-forks/caspaste/src/reputation"
+)
+
+// reputationConfig reads security.reputation; DNSBL lookups go through the
+// server.dns upstreams
+func reputationConfig(yamlCfg *config.YAMLConfig) (reputation.Config, error) {
+	rep := yamlCfg.Security.Reputation
+	cfg := reputation.Config{
+		Enabled:        rep.Enabled,
+		APIURL:         rep.APIURL,
+		APIKey:         rep.APIKey,
+		Threshold:      rep.Threshold,
+		BlockThreshold: rep.BlockThreshold,
+		LimitDivisor:   rep.LimitDivisor,
+	}
+	for _, zone := range rep.DNSBL {
+		if zone = strings.Trim(strings.TrimSpace(zone), "."); zone != "" {
+			cfg.DNSBL = append(cfg.DNSBL, zone)
+		}
+	}
+
+	if rep.Threshold < 0 || rep.Threshold > 100 {
+		return cfg, fmt.Errorf("invalid security.reputation.threshold %d: must be 1-100", rep.Threshold)
+	}
+	if rep.BlockThreshold < 0 || rep.BlockThreshold > 100 {
+		return cfg, fmt.Errorf("invalid security.reputation.block_threshold %d: must be 0-100", rep.BlockThreshold)
+	}
+	var err error
+	if cfg.CacheTTL, err = reputationDuration("cache_ttl", rep.CacheTTL); err != nil {
+		return cfg, err
+	}
+	if cfg.Timeout, err = reputationDuration("timeout", rep.Timeout); err != nil {
+		return cfg, err
+	}
+
+	// Each lookup is bounded by the reputation timeout, not the DNS one
+	cfg.Resolver = dnsResolver(yamlCfg, cfg.Timeout)
+	cfg.Resolver.SetLogger(nil)
+	return cfg, nil
+}
+
+// reputationDuration parses a security.reputation duration; empty = the default
+func reputationDuration(name, value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid security.reputation.%s %q", name, value)
+	}
+	return d, nil
+}
@@ -0,0 +1,83 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/config"
+	"github.com/casjay-forks/caspaste/src/storage"
+	"github.com/casjay-forks/caspaste/src/storage/migrations"
+)
+
+// handleMigrateCommand handles --migrate status|up|down, the numbered
+// schema migrations; the server applies pending ones on start, so a
+// rolled back migration comes back unless an older release is started
+func handleMigrateCommand(cmd string, yamlCfg *config.YAMLConfig) {
+	if cmd != "status" && cmd != "up" && cmd != "down" {
+		fmt.Fprintln(os.Stderr, "Usage: caspaste --migrate {status|up|down}")
+		os.Exit(1)
+	}
+
+	driver := yamlCfg.Database.Driver
+	db, err := storage.NewPool(driver, yamlCfg.Database.Source, 1, 0, yamlCfg.Directories.Data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open database: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	switch cmd {
+	case "up":
+		done, err := migrations.Up(db.Pool(), driver)
+		for _, m := range done {
+			fmt.Printf("Applied %d %s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed: %v\n", err)
+			os.Exit(1)
+		}
+		if len(done) == 0 {
+			fmt.Println("The schema is up to date")
+		}
+	case "down":
+		m, err := migrations.Down(db.Pool(), driver)
+		if errors.Is(err, migrations.ErrIrreversible) {
+			fmt.Fprintf(os.Stderr, "Migration %d %s cannot be rolled back; restore a backup instead\n", m.Version, m.Name)
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Rolled back %d %s\n", m.Version, m.Name)
+		fmt.Println("Starting the server applies it again")
+		return
+	}
+
+	states, err := migrations.Status(db.Pool())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read the applied migrations: %v\n", err)
+		os.Exit(1)
+	}
+	current := 0
+	for _, s := range states {
+		if s.Applied {
+			current = s.Version
+		}
+	}
+	fmt.Printf("Database: %s, schema version %d of %d\n", driver, current, migrations.Latest())
+	for _, s := range states {
+		applied := "pending"
+		if s.Applied {
+			applied = "applied " + time.Unix(s.AppliedAt, 0).Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("  %4d  %-20s %s\n", s.Version, s.Name, applied)
+	}
+}
@@ -0,0 +1,94 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/casjay-forks/caspaste/src/admin"
+	"github.com/casjay-forks/caspaste/src/config"
+)
+
+// configWriteMu is held by every admin editor while it loads, changes and
+// saves the config file, so one save never drops another editor's change
+var configWriteMu sync.Mutex
+
+// settingsManager edits the server settings for the admin panel: changes
+// are validated, saved to the config file and applied by a reload
+type settingsManager struct {
+	configPath string
+	// Reloads the config file, returning the keys applied and pending
+	reload func() (applied, pending []string)
+}
+
+// Settings returns the settings as written in the config file
+func (m *settingsManager) Settings() (config.Settings, error) {
+	if m.configPath == "(environment)" {
+		return config.Settings{}, config.ErrSettingsReadOnly
+	}
+	yamlCfg, err := config.LoadYAMLConfig(m.configPath)
+	if err != nil {
+		return config.Settings{}, err
+	}
+	return yamlCfg.Settings(), nil
+}
+
+// SaveSettings validates the settings, saves them and reloads the config
+func (m *settingsManager) SaveSettings(s config.Settings) (admin.SettingsResult, error) {
+	configWriteMu.Lock()
+	defer configWriteMu.Unlock()
+
+	yamlCfg, result, err := m.prepare(s)
+	if err != nil || len(result.Changed) == 0 {
+		return result, err
+	}
+	if err := config.SaveYAMLConfig(m.configPath, yamlCfg); err != nil {
+		return admin.SettingsResult{}, err
+	}
+	result.Applied, result.Pending = m.reload()
+	return result, nil
+}
+
+// CheckSettings validates the settings and returns what saving them would
+// change, without saving
+func (m *settingsManager) CheckSettings(s config.Settings) (admin.SettingsResult, error) {
+	configWriteMu.Lock()
+	defer configWriteMu.Unlock()
+
+	_, result, err := m.prepare(s)
+	result.DryRun = err == nil
+	return result, err
+}
+
+// prepare returns the config file with s applied, once the whole of it is
+// valid, and the keys that change
+func (m *settingsManager) prepare(s config.Settings) (*config.YAMLConfig, admin.SettingsResult, error) {
+	if err := s.Validate(); err != nil {
+		return nil, admin.SettingsResult{}, err
+	}
+	if m.configPath == "(environment)" {
+		return nil, admin.SettingsResult{}, config.ErrSettingsReadOnly
+	}
+
+	// Start from the file as written so environment overrides and resolved
+	// placeholders are not saved into it
+	yamlCfg, err := config.LoadYAMLConfig(m.configPath)
+	if err != nil {
+		return nil, admin.SettingsResult{}, err
+	}
+	before := *yamlCfg
+	yamlCfg.SetSettings(s)
+
+	// The rest of the file is checked too, as startup would read it
+	if err := checkConfig(yamlCfg); err != nil {
+		return nil, admin.SettingsResult{}, err
+	}
+	result := admin.SettingsResult{
+		Changed: changedSettings(reflect.ValueOf(before), reflect.ValueOf(*yamlCfg), ""),
+	}
+	return yamlCfg, result, nil
+}
@@ -0,0 +1,66 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/audit"
+	"github.com/casjay-forks/caspaste/src/config"
+	"github.com/casjay-forks/caspaste/src/logger"
+	"github.com/casjay-forks/caspaste/src/metric"
+	"github.com/casjay-forks/caspaste/src/spam"
+)
+
+// newSpamFilter creates the spam filter of security.spam; a held paste is
+// logged, audited and counted
+func newSpamFilter(yamlCfg *config.YAMLConfig, log logger.Logger) (*spam.Filter, error) {
+	cfg, err := spamConfig(yamlCfg)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := spam.New(cfg, log)
+	if err != nil {
+		return nil, fmt.Errorf("invalid security.spam: %w", err)
+	}
+	filter.OnHeld(func(pasteID, reason, ip string, matches []spam.Match) {
+		log.Info(fmt.Sprintf("Spam filter: held paste %s for review: %s", pasteID, reason))
+		audit.PasteHeld(pasteID, reason, ip)
+		metric.RecordPasteHeld(matches[0].Rule)
+	})
+	return filter, nil
+}
+
+// spamConfig reads security.spam; patterns are compiled by spam.New
+func spamConfig(yamlCfg *config.YAMLConfig) (spam.Config, error) {
+	s := yamlCfg.Security.Spam
+	dumps := s.CredentialDumps
+	cfg := spam.Config{
+		Enabled:       s.Enabled,
+		Keywords:      s.Keywords,
+		Patterns:      s.Patterns,
+		BadReputation: s.BadReputation,
+		CredentialDumps: spam.DumpConfig{
+			Enabled:   dumps.Enabled,
+			MinLines:  dumps.MinLines,
+			MinLength: dumps.MinLength,
+			Entropy:   dumps.Entropy,
+		},
+		SafeBrowsing: spam.SafeBrowsingConfig{
+			APIKey: s.SafeBrowsing.APIKey,
+			APIURL: s.SafeBrowsing.APIURL,
+		},
+	}
+	if timeout := s.SafeBrowsing.Timeout; timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("invalid security.spam.safe_browsing.timeout %q", timeout)
+		}
+		cfg.SafeBrowsing.Timeout = d
+	}
+	return cfg, nil
+}
@@ -0,0 +1,110 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/casjay-forks/caspaste/src/config"
+	"github.com/casjay-forks/caspaste/src/leader"
+	"github.com/casjay-forks/caspaste/src/logger"
+	"github.com/casjay-forks/caspaste/src/scheduler"
+	"github.com/casjay-forks/caspaste/src/storage"
+	"github.com/casjay-forks/caspaste/src/telemetry"
+)
+
+// telemetryReport builds the ping from the live paste count
+func telemetryReport(yamlCfg *config.YAMLConfig, db storage.DB) (telemetry.Report, error) {
+	stats, err := db.PasteStats()
+	if err != nil {
+		return telemetry.Report{}, err
+	}
+	return telemetry.NewReport(Version, yamlCfg.Database.Driver, stats.Total), nil
+}
+
+// handleTelemetryCommand prints exactly what the telemetry ping would send
+func handleTelemetryCommand(cmd string, yamlCfg *config.YAMLConfig) {
+	if cmd != "show" {
+		fmt.Fprintln(os.Stderr, "Usage: caspaste --telemetry show")
+		os.Exit(1)
+	}
+
+	db, err := storage.NewPool(yamlCfg.Database.Driver, yamlCfg.Database.Source, 1, 0, yamlCfg.Directories.Data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open database: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	report, err := telemetryReport(yamlCfg, db)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to count pastes: %v\n", err)
+		os.Exit(1)
+	}
+
+	tel := yamlCfg.Server.Telemetry
+	switch {
+	case yamlCfg.Network.Offline:
+		fmt.Println("Offline mode is on (network.offline); nothing is sent")
+	case !tel.Enabled:
+		fmt.Println("Telemetry is disabled (server.telemetry.enabled); nothing is sent")
+	case tel.Endpoint == "":
+		fmt.Println("Telemetry is enabled but server.telemetry.endpoint is empty; nothing is sent")
+	default:
+		fmt.Printf("Telemetry is enabled; sent %s to %s\n", tel.Schedule, tel.Endpoint)
+	}
+	fmt.Println("Payload:")
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+}
+
+// startTelemetryScheduler sends the opt-in ping from the leader on a schedule
+func startTelemetryScheduler(yamlCfg *config.YAMLConfig, db storage.DB, log logger.Logger, elector *leader.Elector) {
+	tel := yamlCfg.Server.Telemetry
+	if tel.Endpoint == "" {
+		log.Error(errors.New("Telemetry disabled: server.telemetry.endpoint is empty"))
+		return
+	}
+	schedule := tel.Schedule
+	if schedule == "" {
+		schedule = "@weekly"
+	}
+
+	schedCfg := scheduler.DefaultConfig()
+	schedCfg.IsLeader = elector.IsLeader
+	sched := scheduler.New(schedCfg)
+	err := sched.AddTask(&scheduler.Task{
+		ID:          "telemetry",
+		Name:        "Telemetry",
+		Description: "Send the opt-in usage ping (caspaste --telemetry show)",
+		Schedule:    schedule,
+		Enabled:     true,
+		Skippable:   true,
+		LeaderOnly:  true,
+		Handler: func(ctx context.Context) error {
+			report, err := telemetryReport(yamlCfg, db)
+			if err != nil {
+				log.Error(errors.New("Telemetry: " + err.Error()))
+				return err
+			}
+			if err := telemetry.Send(ctx, tel.Endpoint, report); err != nil {
+				log.Error(errors.New("Telemetry: " + err.Error()))
+				return err
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		log.Error(errors.New("Telemetry disabled: " + err.Error()))
+		return
+	}
+	sched.Start()
+}
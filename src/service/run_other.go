@@ -0,0 +1,27 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+//go:build !windows
+// +build !windows
+
+package service
+
+import "os"
+
+// RunningAsService returns true if the service manager started this process.
+// systemd, launchd and rc.d deliver signals, so there is nothing to detect.
+func RunningAsService() bool {
+	return false
+}
+
+// Start is only needed by the Windows service manager
+func Start(name string) {}
+
+// Notify is only needed by the Windows service manager
+func Notify(c chan<- os.Signal) {}
+
+// Stopped is only needed by the Windows service manager
+func Stopped() {}
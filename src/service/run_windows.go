@@ -0,0 +1,83 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+//go:build windows
+// +build windows
+
+package service
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/windows/svc"
+)
+
+var (
+	// stopRequests receives a stop or shutdown request from the service manager
+	stopRequests = make(chan os.Signal, 1)
+	// stopped is closed once the server has shut down
+	stopped = make(chan struct{})
+	// finished is closed when the dispatcher returns
+	finished = make(chan struct{})
+)
+
+// handler reports the server as running and forwards stop requests
+type handler struct{}
+
+func (handler) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	const accepts = svc.AcceptStop | svc.AcceptShutdown
+	status <- svc.Status{State: svc.Running, Accepts: accepts}
+
+	for {
+		select {
+		case r := <-requests:
+			switch r.Cmd {
+			case svc.Interrogate:
+				status <- r.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				stopRequests <- os.Interrupt
+				<-stopped
+				return false, 0
+			}
+		case <-stopped:
+			return false, 0
+		}
+	}
+}
+
+// RunningAsService returns true if the service manager started this process
+func RunningAsService() bool {
+	ok, err := svc.IsWindowsService()
+	return err == nil && ok
+}
+
+// Start connects to the service manager. It must be called early in main
+// when RunningAsService is true, and Stopped must be called before exiting.
+func Start(name string) {
+	go func() {
+		defer close(finished)
+		if err := svc.Run(name, handler{}); err != nil {
+			fmt.Fprintf(os.Stderr, "Service dispatcher failed: %v\n", err)
+		}
+	}()
+}
+
+// Notify forwards stop requests from the service manager to c as os.Interrupt
+func Notify(c chan<- os.Signal) {
+	go func() {
+		for sig := range stopRequests {
+			c <- sig
+		}
+	}()
+}
+
+// Stopped reports the service as stopped and waits for the dispatcher
+func Stopped() {
+	close(stopped)
+	<-finished
+}
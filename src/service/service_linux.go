@@ -24,6 +24,7 @@ Type=simple
 User=%s
 WorkingDirectory=%s
 ExecStart=%s %s
+ExecReload=/bin/kill -HUP $MAINPID
 Restart=on-failure
 RestartSec=5
 
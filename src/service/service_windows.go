@@ -10,43 +10,101 @@
 package service
 
 import (
+	"errors"
 	"fmt"
+	"time"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
 )
 
-func (m *Manager) install() error {
-	binPath := fmt.Sprintf("\"%s\" %s", m.config.Executable, m.buildArgs())
+// stateTimeout is how long start and stop wait for the service to settle
+const stateTimeout = 30 * time.Second
 
-	args := []string{
-		"create",
-		m.config.Name,
-		"binPath=", binPath,
-		"DisplayName=", m.config.DisplayName,
-		"start=", "auto",
+// connect opens the service control manager, which requires an elevated prompt
+func connect() (*mgr.Mgr, error) {
+	scm, err := mgr.Connect()
+	if errors.Is(err, windows.ERROR_ACCESS_DENIED) {
+		return nil, fmt.Errorf("administrator privileges required: run from an elevated prompt")
 	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to service manager: %w", err)
+	}
+	return scm, nil
+}
 
-	if err := runCommand("sc", args...); err != nil {
-		return fmt.Errorf("failed to create service: %w", err)
+// install creates the service, or updates it in place if it already exists,
+// so installers can run it on both fresh installs and upgrades
+func (m *Manager) install() error {
+	scm, err := connect()
+	if err != nil {
+		return err
 	}
+	defer scm.Disconnect()
 
-	// Set description
-	if m.config.Description != "" {
-		descArgs := []string{
-			"description",
-			m.config.Name,
-			m.config.Description,
+	s, err := scm.OpenService(m.config.Name)
+	if err == nil {
+		defer s.Close()
+		cfg, err := s.Config()
+		if err != nil {
+			return fmt.Errorf("failed to read service config: %w", err)
+		}
+		cfg.BinaryPathName = binaryPath(m.config.Executable, m.config.Args)
+		cfg.DisplayName = m.config.DisplayName
+		cfg.Description = m.config.Description
+		cfg.StartType = mgr.StartAutomatic
+		if err := s.UpdateConfig(cfg); err != nil {
+			return fmt.Errorf("failed to update service: %w", err)
 		}
-		runCommand("sc", descArgs...) // Ignore error as description is optional
+		fmt.Printf("Service %s updated\n", m.config.Name)
+	} else {
+		s, err = scm.CreateService(m.config.Name, m.config.Executable, mgr.Config{
+			DisplayName: m.config.DisplayName,
+			Description: m.config.Description,
+			StartType:   mgr.StartAutomatic,
+		}, m.config.Args...)
+		if err != nil {
+			return fmt.Errorf("failed to create service: %w", err)
+		}
+		defer s.Close()
+		fmt.Printf("Service %s installed successfully\n", m.config.Name)
 	}
 
-	fmt.Printf("Service %s installed successfully\n", m.config.Name)
+	// Restart after a crash, resetting the failure count after a day
+	actions := []mgr.RecoveryAction{
+		{Type: mgr.ServiceRestart, Delay: 5 * time.Second},
+		{Type: mgr.ServiceRestart, Delay: 30 * time.Second},
+		{Type: mgr.ServiceRestart, Delay: time.Minute},
+	}
+	if err := s.SetRecoveryActions(actions, 86400); err != nil {
+		fmt.Printf("Warning: failed to set recovery actions: %v\n", err)
+	}
 	return nil
 }
 
+// uninstall stops and removes the service; a missing service is not an error
 func (m *Manager) uninstall() error {
-	// Stop service first
-	runCommand("sc", "stop", m.config.Name)
+	scm, err := connect()
+	if err != nil {
+		return err
+	}
+	defer scm.Disconnect()
+
+	s, err := scm.OpenService(m.config.Name)
+	if errors.Is(err, windows.ERROR_SERVICE_DOES_NOT_EXIST) {
+		fmt.Printf("Service %s is not installed\n", m.config.Name)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open service: %w", err)
+	}
+	defer s.Close()
 
-	if err := runCommand("sc", "delete", m.config.Name); err != nil {
+	if err := stopService(s); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	if err := s.Delete(); err != nil {
 		return fmt.Errorf("failed to delete service: %w", err)
 	}
 
@@ -55,30 +113,163 @@ func (m *Manager) uninstall() error {
 }
 
 func (m *Manager) control(action string) error {
-	var scAction string
+	if action == "reload" {
+		return fmt.Errorf("reload not supported on Windows, use restart instead")
+	}
+
+	scm, err := connect()
+	if err != nil {
+		return err
+	}
+	defer scm.Disconnect()
+
+	s, err := scm.OpenService(m.config.Name)
+	if err != nil {
+		return fmt.Errorf("failed to open service %s: %w", m.config.Name, err)
+	}
+	defer s.Close()
+
 	switch action {
 	case "start":
-		scAction = "start"
+		return startService(s)
 	case "stop":
-		scAction = "stop"
+		return stopService(s)
 	case "restart":
-		if err := runCommand("sc", "stop", m.config.Name); err != nil {
+		if err := stopService(s); err != nil {
 			return err
 		}
-		scAction = "start"
-	case "reload":
-		return fmt.Errorf("reload not supported on Windows, use restart instead")
+		return startService(s)
 	default:
 		return fmt.Errorf("unknown action: %s", action)
 	}
-
-	return runCommand("sc", scAction, m.config.Name)
 }
 
 func (m *Manager) disable() error {
-	return runCommand("sc", "config", m.config.Name, "start=", "disabled")
+	scm, err := connect()
+	if err != nil {
+		return err
+	}
+	defer scm.Disconnect()
+
+	s, err := scm.OpenService(m.config.Name)
+	if err != nil {
+		return fmt.Errorf("failed to open service %s: %w", m.config.Name, err)
+	}
+	defer s.Close()
+
+	cfg, err := s.Config()
+	if err != nil {
+		return fmt.Errorf("failed to read service config: %w", err)
+	}
+	cfg.StartType = mgr.StartDisabled
+	return s.UpdateConfig(cfg)
 }
 
 func (m *Manager) status() error {
-	return runCommand("sc", "query", m.config.Name)
+	scm, err := connect()
+	if err != nil {
+		return err
+	}
+	defer scm.Disconnect()
+
+	s, err := scm.OpenService(m.config.Name)
+	if errors.Is(err, windows.ERROR_SERVICE_DOES_NOT_EXIST) {
+		return fmt.Errorf("service %s is not installed", m.config.Name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open service %s: %w", m.config.Name, err)
+	}
+	defer s.Close()
+
+	st, err := s.Query()
+	if err != nil {
+		return fmt.Errorf("failed to query service: %w", err)
+	}
+	fmt.Printf("Service %s: %s\n", m.config.Name, stateName(st.State))
+	if st.ProcessId != 0 {
+		fmt.Printf("PID: %d\n", st.ProcessId)
+	}
+	return nil
+}
+
+// startService starts s unless it is already running
+func startService(s *mgr.Service) error {
+	st, err := s.Query()
+	if err != nil {
+		return fmt.Errorf("failed to query service: %w", err)
+	}
+	if st.State == svc.Running {
+		return nil
+	}
+	if err := s.Start(); err != nil {
+		return fmt.Errorf("failed to start service: %w", err)
+	}
+	return waitForState(s, svc.Running)
+}
+
+// stopService stops s unless it is already stopped
+func stopService(s *mgr.Service) error {
+	st, err := s.Query()
+	if err != nil {
+		return fmt.Errorf("failed to query service: %w", err)
+	}
+	if st.State == svc.Stopped {
+		return nil
+	}
+	if st.State != svc.StopPending {
+		if _, err := s.Control(svc.Stop); err != nil {
+			return fmt.Errorf("failed to stop service: %w", err)
+		}
+	}
+	return waitForState(s, svc.Stopped)
+}
+
+func waitForState(s *mgr.Service, want svc.State) error {
+	deadline := time.Now().Add(stateTimeout)
+	for {
+		st, err := s.Query()
+		if err != nil {
+			return fmt.Errorf("failed to query service: %w", err)
+		}
+		if st.State == want {
+			return nil
+		}
+		if st.State == svc.Stopped && want == svc.Running {
+			return fmt.Errorf("service stopped during startup (exit code %d), see the server log", st.Win32ExitCode)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for service to become %s", stateName(want))
+		}
+		time.Sleep(300 * time.Millisecond)
+	}
+}
+
+func stateName(state svc.State) string {
+	switch state {
+	case svc.Stopped:
+		return "stopped"
+	case svc.StartPending:
+		return "starting"
+	case svc.StopPending:
+		return "stopping"
+	case svc.Running:
+		return "running"
+	case svc.ContinuePending:
+		return "resuming"
+	case svc.PausePending:
+		return "pausing"
+	case svc.Paused:
+		return "paused"
+	default:
+		return fmt.Sprintf("unknown (%d)", state)
+	}
+}
+
+// binaryPath quotes the executable and arguments the way CreateService does
+func binaryPath(executable string, args []string) string {
+	path := windows.EscapeArg(executable)
+	for _, arg := range args {
+		path += " " + windows.EscapeArg(arg)
+	}
+	return path
 }
@@ -7,12 +7,11 @@
 package session
 
 import (
-	"crypto/rand"
-	"crypto/sha256"
 	"database/sql"
-	"encoding/hex"
 	"errors"
 	"time"
+
+	"github.com/casjay-forks/caspaste/src/securetoken"
 )
 
 // Common errors
@@ -59,13 +58,13 @@ func (s *Service) SetDuration(d time.Duration) {
 // Create creates a new session for a user and returns the token
 func (s *Service) Create(userID int64, device, ipAddress, userAgent string) (string, error) {
 	// Generate random token
-	token, err := generateToken(32)
+	token, err := securetoken.Hex(32)
 	if err != nil {
 		return "", err
 	}
 
 	// Hash the token for storage
-	tokenHash := hashToken(token)
+	tokenHash := securetoken.Hash(token)
 
 	now := time.Now().Unix()
 	expiresAt := time.Now().Add(s.duration).Unix()
@@ -87,7 +86,7 @@ func (s *Service) Validate(token string) (*Session, error) {
 		return nil, ErrInvalidToken
 	}
 
-	tokenHash := hashToken(token)
+	tokenHash := securetoken.Hash(token)
 
 	session := &Session{}
 	err := s.db.QueryRow(`
@@ -126,7 +125,7 @@ func (s *Service) GetUserID(token string) (int64, error) {
 
 // Delete deletes a session by token
 func (s *Service) Delete(token string) error {
-	tokenHash := hashToken(token)
+	tokenHash := securetoken.Hash(token)
 	_, err := s.db.Exec("DELETE FROM user_sessions WHERE token_hash = ?", tokenHash)
 	return err
 }
@@ -145,7 +144,7 @@ func (s *Service) DeleteAllForUser(userID int64) error {
 
 // DeleteAllExcept deletes all sessions for a user except the current one
 func (s *Service) DeleteAllExcept(userID int64, currentToken string) error {
-	tokenHash := hashToken(currentToken)
+	tokenHash := securetoken.Hash(currentToken)
 	_, err := s.db.Exec("DELETE FROM user_sessions WHERE user_id = ? AND token_hash != ?", userID, tokenHash)
 	return err
 }
@@ -188,28 +187,12 @@ func (s *Service) CleanupExpired() (int64, error) {
 
 // Extend extends the session expiration
 func (s *Service) Extend(token string) error {
-	tokenHash := hashToken(token)
+	tokenHash := securetoken.Hash(token)
 	expiresAt := time.Now().Add(s.duration).Unix()
 	_, err := s.db.Exec("UPDATE user_sessions SET expires_at = ? WHERE token_hash = ?", expiresAt, tokenHash)
 	return err
 }
 
-// generateToken generates a cryptographically secure random token
-func generateToken(length int) (string, error) {
-	bytes := make([]byte, length)
-	_, err := rand.Read(bytes)
-	if err != nil {
-		return "", err
-	}
-	return hex.EncodeToString(bytes), nil
-}
-
-// hashToken hashes a token using SHA-256
-func hashToken(token string) string {
-	hash := sha256.Sum256([]byte(token))
-	return hex.EncodeToString(hash[:])
-}
-
 // IsExpired checks if a session is expired
 func (session *Session) IsExpired() bool {
 	return session.ExpiresAt < time.Now().Unix()
@@ -0,0 +1,374 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+// Package setup serves the first-run web wizard at /setup
+// The wizard asks for the admin account, FQDN, public or private mode, the
+// database and SMTP settings, then writes server.yml. It only answers
+// requests carrying the one-time token printed on the server console, and
+// locks itself once setup is complete.
+package setup
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/casjay-forks/caspaste/src/caspasswd"
+	"github.com/casjay-forks/caspaste/src/config"
+	"github.com/casjay-forks/caspaste/src/email"
+	"github.com/casjay-forks/caspaste/src/securetoken"
+	"github.com/casjay-forks/caspaste/src/storage"
+	"github.com/casjay-forks/caspaste/src/user"
+	"github.com/casjay-forks/caspaste/src/validation"
+)
+
+// PendingFile marks a config directory whose setup is not finished
+const PendingFile = "setup.pending"
+
+// Config configures the wizard
+type Config struct {
+	// ConfigPath is the server.yml the wizard writes
+	ConfigPath string
+	// PasswordFile receives the admin credentials
+	PasswordFile string
+	// Logf reports completed setup (optional)
+	Logf func(format string, args ...interface{})
+}
+
+// Wizard serves /setup until setup is complete
+type Wizard struct {
+	cfg   Config
+	token string
+	done  atomic.Bool
+	// mu serializes submissions so two browsers cannot both complete setup
+	mu sync.Mutex
+}
+
+// MarkPending records that setup is needed, on first run
+func MarkPending(configDir string) error {
+	return os.WriteFile(filepath.Join(configDir, PendingFile), nil, 0600)
+}
+
+// Pending reports whether the setup of configDir is not finished
+func Pending(configDir string) bool {
+	_, err := os.Stat(filepath.Join(configDir, PendingFile))
+	return err == nil
+}
+
+// New creates a wizard with a fresh token; a restart issues a new one
+func New(cfg Config) (*Wizard, error) {
+	token, err := securetoken.Hex(16)
+	if err != nil {
+		return nil, err
+	}
+	return &Wizard{cfg: cfg, token: token}, nil
+}
+
+// Token returns the token that must accompany every request
+func (w *Wizard) Token() string {
+	return w.token
+}
+
+// Done reports whether setup has been completed
+func (w *Wizard) Done() bool {
+	return w.done.Load()
+}
+
+// ServeHTTP handles GET and POST /setup
+func (w *Wizard) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if w.Done() || req.URL.Path != "/setup" {
+		http.NotFound(rw, req)
+		return
+	}
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.Header().Set("X-Robots-Tag", "noindex, nofollow")
+
+	switch req.Method {
+	case http.MethodGet:
+		if !w.validToken(req.URL.Query().Get("token")) {
+			w.render(rw, http.StatusForbidden, &page{Locked: true})
+			return
+		}
+		w.render(rw, http.StatusOK, w.defaults())
+	case http.MethodPost:
+		if err := req.ParseForm(); err != nil || !w.validToken(req.PostFormValue("token")) {
+			w.render(rw, http.StatusForbidden, &page{Locked: true})
+			return
+		}
+		p := readForm(req)
+		if req.PostFormValue("action") == "test-smtp" {
+			w.testSMTP(rw, p)
+			return
+		}
+		w.complete(rw, req, p)
+	default:
+		rw.Header().Set("Allow", "GET, POST")
+		http.Error(rw, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (w *Wizard) validToken(token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(w.token)) == 1
+}
+
+// defaults fills the form from the generated server.yml
+func (w *Wizard) defaults() *page {
+	p := &page{Token: w.token, Public: true, DBDriver: "sqlite", SMTPPort: "587", SMTPTLS: "auto"}
+	yamlCfg, err := config.LoadYAMLConfig(w.cfg.ConfigPath)
+	if err != nil {
+		return p
+	}
+	p.FQDN = yamlCfg.Server.FQDN
+	p.Public = yamlCfg.Server.Public
+	p.DBDriver = validation.NormalizeDriver(yamlCfg.Database.Driver)
+	if p.DBDriver != "sqlite" {
+		p.DBSource = yamlCfg.Database.Source
+	}
+	if yamlCfg.Server.SMTP.Port > 0 {
+		p.SMTPPort = strconv.Itoa(yamlCfg.Server.SMTP.Port)
+	}
+	return p
+}
+
+// testSMTP sends a test message to the admin email with the submitted settings
+func (w *Wizard) testSMTP(rw http.ResponseWriter, p *page) {
+	if err := validation.ValidateEmail(p.AdminEmail); err != nil {
+		p.Error = "Enter the admin email first; the test message is sent there"
+		w.render(rw, http.StatusBadRequest, p)
+		return
+	}
+	client, err := p.smtpClient()
+	if err == nil {
+		err = client.TestConnection()
+	}
+	if err == nil {
+		err = client.Send(p.AdminEmail, "CasPaste test email", "SMTP is configured correctly.\r\n")
+	}
+	if err != nil {
+		p.Error = "SMTP test failed: " + err.Error()
+		w.render(rw, http.StatusOK, p)
+		return
+	}
+	p.Message = "Test email sent to " + p.AdminEmail
+	w.render(rw, http.StatusOK, p)
+}
+
+// complete validates the form, writes server.yml and the admin credentials,
+// and locks the wizard
+func (w *Wizard) complete(rw http.ResponseWriter, req *http.Request, p *page) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.Done() {
+		http.NotFound(rw, req)
+		return
+	}
+
+	if err := p.validate(); err != nil {
+		p.Error = err.Error()
+		w.render(rw, http.StatusBadRequest, p)
+		return
+	}
+
+	yamlCfg, err := config.LoadYAMLConfig(w.cfg.ConfigPath)
+	if err != nil {
+		p.Error = "Failed to read " + w.cfg.ConfigPath + ": " + err.Error()
+		w.render(rw, http.StatusInternalServerError, p)
+		return
+	}
+
+	yamlCfg.Server.FQDN = p.FQDN
+	yamlCfg.Server.Public = p.Public
+	yamlCfg.Server.Administrator.Email = p.AdminEmail
+	if p.DBDriver != "sqlite" {
+		yamlCfg.Database.Driver = p.DBDriver
+		yamlCfg.Database.Source = p.DBSource
+	} else if validation.NormalizeDriver(yamlCfg.Database.Driver) != "sqlite" {
+		defaults := config.DefaultYAMLConfig()
+		yamlCfg.Database.Driver = defaults.Database.Driver
+		yamlCfg.Database.Source = defaults.Database.Source
+	}
+	yamlCfg.Server.SMTP.Host = p.SMTPHost
+	yamlCfg.Server.SMTP.Port, _ = strconv.Atoi(p.SMTPPort)
+	yamlCfg.Server.SMTP.Username = p.SMTPUser
+	yamlCfg.Server.SMTP.Password = p.SMTPPassword
+	yamlCfg.Server.SMTP.TLS = p.SMTPTLS
+	if p.SMTPFrom != "" {
+		yamlCfg.Server.Administrator.From = p.SMTPFrom
+	}
+	if yamlCfg.Security.PasswordFile == "" {
+		yamlCfg.Security.PasswordFile = w.cfg.PasswordFile
+	}
+
+	hash, err := caspasswd.HashPassword(p.AdminPassword)
+	if err == nil {
+		err = caspasswd.SetUserHash(w.cfg.PasswordFile, p.AdminUser, hash)
+	}
+	if err != nil {
+		p.Error = "Failed to save the admin account: " + err.Error()
+		w.render(rw, http.StatusInternalServerError, p)
+		return
+	}
+
+	if err := config.SaveYAMLConfig(w.cfg.ConfigPath, yamlCfg); err != nil {
+		p.Error = err.Error()
+		w.render(rw, http.StatusInternalServerError, p)
+		return
+	}
+
+	// Lock the wizard for good: the marker is gone, so it is not served after a restart
+	err = os.Remove(filepath.Join(filepath.Dir(w.cfg.ConfigPath), PendingFile))
+	if err != nil && !os.IsNotExist(err) {
+		p.Error = "Setup was saved, but the wizard could not lock itself: " + err.Error()
+		w.render(rw, http.StatusInternalServerError, p)
+		return
+	}
+	w.done.Store(true)
+	if w.cfg.Logf != nil {
+		w.cfg.Logf("Setup completed by %s; restart to apply the new configuration", p.AdminUser)
+	}
+
+	w.render(rw, http.StatusOK, &page{Complete: true, ConfigPath: w.cfg.ConfigPath})
+}
+
+// page is the wizard form and its result
+type page struct {
+	Token string
+
+	AdminUser            string
+	AdminEmail           string
+	AdminPassword        string
+	AdminPasswordConfirm string
+
+	FQDN   string
+	Public bool
+
+	DBDriver string
+	DBSource string
+
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUser     string
+	SMTPPassword string
+	SMTPTLS      string
+	SMTPFrom     string
+
+	Message    string
+	Error      string
+	Locked     bool
+	Complete   bool
+	ConfigPath string
+}
+
+func readForm(req *http.Request) *page {
+	value := func(name string) string {
+		return strings.TrimSpace(req.PostFormValue(name))
+	}
+	return &page{
+		Token:                value("token"),
+		AdminUser:            value("admin_user"),
+		AdminEmail:           value("admin_email"),
+		AdminPassword:        req.PostFormValue("admin_password"),
+		AdminPasswordConfirm: req.PostFormValue("admin_password_confirm"),
+		FQDN:                 value("fqdn"),
+		Public:               value("mode") != "private",
+		DBDriver:             validation.NormalizeDriver(value("db_driver")),
+		DBSource:             value("db_source"),
+		SMTPHost:             value("smtp_host"),
+		SMTPPort:             value("smtp_port"),
+		SMTPUser:             value("smtp_user"),
+		SMTPPassword:         req.PostFormValue("smtp_password"),
+		SMTPTLS:              value("smtp_tls"),
+		SMTPFrom:             value("smtp_from"),
+	}
+}
+
+func (p *page) validate() error {
+	if p.AdminUser == "" || strings.ContainsAny(p.AdminUser, ": \t") {
+		return errors.New("Admin username is required and cannot contain spaces or ':'")
+	}
+	if err := validation.ValidateEmail(p.AdminEmail); err != nil {
+		return fmt.Errorf("Admin email: %w", err)
+	}
+	if err := user.ValidatePassword(p.AdminPassword); err != nil {
+		return fmt.Errorf("Admin password: %w", err)
+	}
+	if p.AdminPassword != p.AdminPasswordConfirm {
+		return errors.New("Admin passwords do not match")
+	}
+
+	if p.FQDN != "" {
+		if err := validation.ValidateFQDN(p.FQDN); err != nil {
+			return err
+		}
+	}
+
+	switch p.DBDriver {
+	case "sqlite":
+	case "postgres", "mysql":
+		if p.DBSource == "" {
+			return errors.New("Database connection string is required for " + p.DBDriver)
+		}
+		source := validation.NormalizeConnectionString(p.DBDriver, p.DBSource)
+		if err := storage.Ping(p.DBDriver, source); err != nil {
+			return fmt.Errorf("Cannot connect to the database: %w", err)
+		}
+	default:
+		return fmt.Errorf("Unsupported database %q", p.DBDriver)
+	}
+
+	if p.SMTPHost != "" {
+		if port, err := strconv.Atoi(p.SMTPPort); err != nil || port < 1 || port > 65535 {
+			return errors.New("SMTP port must be a number between 1 and 65535")
+		}
+		switch p.SMTPTLS {
+		case "auto", "starttls", "tls", "none":
+		default:
+			return errors.New("SMTP TLS must be auto, starttls, tls or none")
+		}
+		if p.SMTPFrom != "" {
+			if _, err := mail.ParseAddress(p.SMTPFrom); err != nil {
+				return fmt.Errorf("SMTP from address: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// smtpClient builds an email client from the submitted SMTP settings
+func (p *page) smtpClient() (*email.Client, error) {
+	if p.SMTPHost == "" {
+		return nil, errors.New("SMTP host is empty")
+	}
+	port, err := strconv.Atoi(p.SMTPPort)
+	if err != nil {
+		return nil, errors.New("invalid SMTP port")
+	}
+	from := &mail.Address{Name: "CasPaste", Address: "no-reply@" + p.FQDN}
+	if p.SMTPFrom != "" {
+		if from, err = mail.ParseAddress(p.SMTPFrom); err != nil {
+			return nil, fmt.Errorf("invalid from address: %w", err)
+		}
+	} else if p.FQDN == "" {
+		return nil, errors.New("set the FQDN or a from address")
+	}
+	return email.NewClient(&email.Config{
+		Host:      p.SMTPHost,
+		Port:      port,
+		Username:  p.SMTPUser,
+		Password:  p.SMTPPassword,
+		TLS:       p.SMTPTLS,
+		FromName:  from.Name,
+		FromEmail: from.Address,
+	}), nil
+}
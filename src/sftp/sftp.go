@@ -0,0 +1,414 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+// Package sftp is a minimal SFTP client for uploading files
+// Only file upload, rename and remove are supported, over SFTP version 3 as
+// spoken by OpenSSH; the server key must be in a known_hosts file
+package sftp
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/casjay-forks/caspaste/src/cryptopolicy"
+	"github.com/casjay-forks/caspaste/src/outbound"
+)
+
+// ErrIncompleteConfig is returned when required settings are missing
+var ErrIncompleteConfig = errors.New("sftp: address, user, known_hosts and a password or key file are required")
+
+// Packet types and flags of SFTP version 3 (draft-ietf-secsh-filexfer-02)
+const (
+	fxpInit    = 1
+	fxpVersion = 2
+	fxpOpen    = 3
+	fxpClose   = 4
+	fxpWrite   = 6
+	fxpRemove  = 13
+	fxpRename  = 18
+	fxpStatus  = 101
+	fxpHandle  = 102
+
+	fxfWrite = 0x02
+	fxfCreat = 0x08
+	fxfTrunc = 0x10
+
+	fxOK         = 0
+	fxNoSuchFile = 2
+)
+
+// writeChunk is the data sent per write request; writeWindow requests are
+// sent before waiting for replies, so latency does not set the speed
+const (
+	writeChunk  = 32 * 1024
+	writeWindow = 16
+)
+
+// Config describes an SFTP server
+type Config struct {
+	// Address as host:port
+	Address string
+	// Login; a password, a private key file, or both
+	User     string
+	Password string
+	KeyFile  string
+	// known_hosts file with the server's key
+	KnownHosts string
+	// Remote directory files are put in (default: the login directory)
+	Dir string
+}
+
+// Client puts files in one directory of an SFTP server
+type Client struct {
+	cfg     Config
+	conn    *ssh.Client
+	session *ssh.Session
+	in      io.WriteCloser
+	out     io.Reader
+
+	mu     sync.Mutex
+	nextID uint32
+}
+
+// Dial connects and starts the SFTP subsystem
+func Dial(ctx context.Context, cfg Config) (*Client, error) {
+	if cfg.Address == "" || cfg.User == "" || cfg.KnownHosts == "" || (cfg.Password == "" && cfg.KeyFile == "") {
+		return nil, ErrIncompleteConfig
+	}
+
+	hostKey, err := knownhosts.New(cfg.KnownHosts)
+	if err != nil {
+		return nil, fmt.Errorf("sftp: %w", err)
+	}
+	var auth []ssh.AuthMethod
+	if cfg.KeyFile != "" {
+		pem, err := os.ReadFile(cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("sftp: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(pem)
+		if err != nil {
+			return nil, fmt.Errorf("sftp: %s: %w (keys with a passphrase are not supported)", cfg.KeyFile, err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if cfg.Password != "" {
+		auth = append(auth, ssh.Password(cfg.Password))
+	}
+	sshCfg := &ssh.ClientConfig{
+		User:            cfg.User,
+		Auth:            auth,
+		HostKeyCallback: hostKey,
+		Timeout:         30 * time.Second,
+	}
+	if cryptopolicy.Strict() {
+		sshCfg.KeyExchanges = cryptopolicy.SSHKeyExchanges
+		sshCfg.Ciphers = cryptopolicy.SSHCiphers
+		sshCfg.MACs = cryptopolicy.SSHMACs
+		sshCfg.HostKeyAlgorithms = cryptopolicy.SSHHostKeyAlgorithms
+	}
+
+	netConn, err := outbound.DialContext(ctx, cfg.Address)
+	if err != nil {
+		return nil, fmt.Errorf("sftp: %w", err)
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(netConn, cfg.Address, sshCfg)
+	if err != nil {
+		netConn.Close()
+		return nil, fmt.Errorf("sftp: %w", err)
+	}
+
+	c := &Client{cfg: cfg, conn: ssh.NewClient(sshConn, chans, reqs)}
+	if err := c.start(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// start opens the subsystem and agrees on version 3
+func (c *Client) start() error {
+	session, err := c.conn.NewSession()
+	if err != nil {
+		return fmt.Errorf("sftp: %w", err)
+	}
+	c.session = session
+	if c.in, err = session.StdinPipe(); err != nil {
+		return fmt.Errorf("sftp: %w", err)
+	}
+	if c.out, err = session.StdoutPipe(); err != nil {
+		return fmt.Errorf("sftp: %w", err)
+	}
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		return fmt.Errorf("sftp: subsystem refused: %w", err)
+	}
+
+	if err := c.send(fxpInit, uint32(3)); err != nil {
+		return err
+	}
+	typ, _, err := c.recv()
+	if err != nil {
+		return err
+	}
+	if typ != fxpVersion {
+		return fmt.Errorf("sftp: unexpected reply %d to init", typ)
+	}
+	return nil
+}
+
+// Close ends the session and the connection
+func (c *Client) Close() error {
+	if c.session != nil {
+		c.session.Close()
+	}
+	return c.conn.Close()
+}
+
+// PutFile uploads a local file as name; it is written as name.partial and
+// renamed when complete, so a failed upload never looks like a finished one
+func (c *Client) PutFile(ctx context.Context, name, localPath string) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	remote := c.remotePath(name)
+	partial := remote + ".partial"
+	handle, err := c.open(partial)
+	if err != nil {
+		return err
+	}
+	if err := c.write(ctx, handle, f); err != nil {
+		c.close(handle)
+		c.remove(partial)
+		return err
+	}
+	if err := c.close(handle); err != nil {
+		c.remove(partial)
+		return err
+	}
+	if err := c.request(fxpRename, partial, remote); err != nil {
+		c.remove(partial)
+		return err
+	}
+	return nil
+}
+
+// Remove deletes a file; removing a missing file is not an error
+func (c *Client) Remove(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.remove(c.remotePath(name))
+}
+
+func (c *Client) remotePath(name string) string {
+	if c.cfg.Dir == "" {
+		return name
+	}
+	return path.Join(c.cfg.Dir, name)
+}
+
+func (c *Client) remove(remote string) error {
+	err := c.request(fxpRemove, remote)
+	var status *StatusError
+	if errors.As(err, &status) && status.Code == fxNoSuchFile {
+		return nil
+	}
+	return err
+}
+
+// open creates or truncates a remote file for writing
+func (c *Client) open(remote string) (string, error) {
+	id, err := c.sendRequest(fxpOpen, remote, uint32(fxfWrite|fxfCreat|fxfTrunc), uint32(0))
+	if err != nil {
+		return "", err
+	}
+	typ, data, err := c.reply(id)
+	if err != nil {
+		return "", err
+	}
+	switch typ {
+	case fxpHandle:
+		handle, _, err := readString(data)
+		return handle, err
+	case fxpStatus:
+		return "", statusError(data)
+	}
+	return "", fmt.Errorf("sftp: unexpected reply %d to open", typ)
+}
+
+func (c *Client) close(handle string) error {
+	return c.request(fxpClose, handle)
+}
+
+// write sends r to the open file, keeping writeWindow requests in flight
+func (c *Client) write(ctx context.Context, handle string, r io.Reader) error {
+	buf := make([]byte, writeChunk)
+	var offset uint64
+	inFlight := 0
+	done := false
+	for !done || inFlight > 0 {
+		for !done && inFlight < writeWindow {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			n, err := io.ReadFull(r, buf)
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				done = true
+			} else if err != nil {
+				return err
+			}
+			if n == 0 {
+				break
+			}
+			if _, err := c.sendRequest(fxpWrite, handle, offset, string(buf[:n])); err != nil {
+				return err
+			}
+			offset += uint64(n)
+			inFlight++
+		}
+		if inFlight == 0 {
+			break
+		}
+		typ, data, err := c.recv()
+		if err != nil {
+			return err
+		}
+		inFlight--
+		if typ != fxpStatus || len(data) < 4 {
+			return fmt.Errorf("sftp: unexpected reply %d to write", typ)
+		}
+		if err := statusError(data[4:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// request sends a request answered by a status and returns it as an error
+func (c *Client) request(typ byte, args ...interface{}) error {
+	id, err := c.sendRequest(typ, args...)
+	if err != nil {
+		return err
+	}
+	replyType, data, err := c.reply(id)
+	if err != nil {
+		return err
+	}
+	if replyType != fxpStatus {
+		return fmt.Errorf("sftp: unexpected reply %d to request %d", replyType, typ)
+	}
+	return statusError(data)
+}
+
+// sendRequest sends a packet with a new request ID
+func (c *Client) sendRequest(typ byte, args ...interface{}) (uint32, error) {
+	c.nextID++
+	id := c.nextID
+	return id, c.send(typ, append([]interface{}{id}, args...)...)
+}
+
+// reply reads the reply to request id and returns it without the ID
+// Replies to earlier requests, left unread when a write failed, are skipped
+func (c *Client) reply(id uint32) (byte, []byte, error) {
+	for {
+		typ, data, err := c.recv()
+		if err != nil {
+			return 0, nil, err
+		}
+		if len(data) < 4 {
+			return 0, nil, errors.New("sftp: short packet")
+		}
+		if binary.BigEndian.Uint32(data) == id {
+			return typ, data[4:], nil
+		}
+	}
+}
+
+// send writes one packet of uint32, uint64 and string fields
+func (c *Client) send(typ byte, args ...interface{}) error {
+	packet := []byte{0, 0, 0, 0, typ}
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case uint32:
+			packet = binary.BigEndian.AppendUint32(packet, v)
+		case uint64:
+			packet = binary.BigEndian.AppendUint64(packet, v)
+		case string:
+			packet = binary.BigEndian.AppendUint32(packet, uint32(len(v)))
+			packet = append(packet, v...)
+		default:
+			panic(fmt.Sprintf("sftp: cannot send %T", arg))
+		}
+	}
+	binary.BigEndian.PutUint32(packet, uint32(len(packet)-4))
+	_, err := c.in.Write(packet)
+	return err
+}
+
+// recv reads one packet
+func (c *Client) recv() (byte, []byte, error) {
+	var head [5]byte
+	if _, err := io.ReadFull(c.out, head[:]); err != nil {
+		return 0, nil, fmt.Errorf("sftp: %w", err)
+	}
+	length := binary.BigEndian.Uint32(head[:4])
+	if length < 1 || length > 256*1024 {
+		return 0, nil, fmt.Errorf("sftp: bad packet length %d", length)
+	}
+	data := make([]byte, length-1)
+	if _, err := io.ReadFull(c.out, data); err != nil {
+		return 0, nil, fmt.Errorf("sftp: %w", err)
+	}
+	return head[4], data, nil
+}
+
+// StatusError is a status other than OK sent by the server
+type StatusError struct {
+	Code    uint32
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("sftp: status %d: %s", e.Code, e.Message)
+}
+
+// statusError returns the status in data, after the request ID, as an error
+func statusError(data []byte) error {
+	if len(data) < 4 {
+		return errors.New("sftp: short status")
+	}
+	code := binary.BigEndian.Uint32(data)
+	if code == fxOK {
+		return nil
+	}
+	msg, _, _ := readString(data[4:])
+	return &StatusError{Code: code, Message: msg}
+}
+
+func readString(data []byte) (string, []byte, error) {
+	if len(data) < 4 {
+		return "", nil, errors.New("sftp: short packet")
+	}
+	n := binary.BigEndian.Uint32(data)
+	if uint32(len(data)-4) < n {
+		return "", nil, errors.New("sftp: short packet")
+	}
+	return string(data[4 : 4+n]), data[4+n:], nil
+}
@@ -0,0 +1,137 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package spam
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/outbound"
+)
+
+const (
+	// DefaultSafeBrowsingURL is the Google Safe Browsing v4 Lookup API
+	DefaultSafeBrowsingURL = "https://safebrowsing.googleapis.com/v4/threatMatches:find"
+	// safeBrowsingMaxURLs is the most links one lookup may ask about
+	safeBrowsingMaxURLs = 500
+)
+
+// SafeBrowsingConfig is the Google Safe Browsing account links are looked
+// up with; no API key = no lookups
+type SafeBrowsingConfig struct {
+	APIKey string
+	// Lookup API endpoint (default: DefaultSafeBrowsingURL)
+	APIURL string
+	// Bound on one lookup
+	Timeout time.Duration
+}
+
+// safeBrowsingThreats are the lists links are looked up in
+var safeBrowsingThreats = []string{"MALWARE", "SOCIAL_ENGINEERING", "UNWANTED_SOFTWARE", "POTENTIALLY_HARMFUL_APPLICATION"}
+
+// linkRegex matches http and https links in text
+var linkRegex = regexp.MustCompile(`(?i)\bhttps?://[^\s<>"'` + "`" + `]+`)
+
+// extractURLs returns the distinct links in text
+func extractURLs(text string) []string {
+	var links []string
+	seen := map[string]bool{}
+	for _, link := range linkRegex.FindAllString(text, -1) {
+		// Punctuation after a link is part of the sentence
+		link = strings.TrimRight(link, ".,;:!?)]}")
+		if u, err := url.Parse(link); err != nil || u.Host == "" {
+			continue
+		}
+		if !seen[link] {
+			seen[link] = true
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+// lookupSafeBrowsing returns the links Safe Browsing lists, as
+// "THREAT_TYPE link"; at most safeBrowsingMaxURLs links are looked up
+func lookupSafeBrowsing(ctx context.Context, cfg SafeBrowsingConfig, links []string) ([]string, error) {
+	if len(links) == 0 {
+		return nil, nil
+	}
+	if len(links) > safeBrowsingMaxURLs {
+		links = links[:safeBrowsingMaxURLs]
+	}
+
+	type entry struct {
+		URL string `json:"url"`
+	}
+	var request struct {
+		Client struct {
+			ClientID string `json:"clientId"`
+		} `json:"client"`
+		ThreatInfo struct {
+			ThreatTypes      []string `json:"threatTypes"`
+			PlatformTypes    []string `json:"platformTypes"`
+			ThreatEntryTypes []string `json:"threatEntryTypes"`
+			ThreatEntries    []entry  `json:"threatEntries"`
+		} `json:"threatInfo"`
+	}
+	request.Client.ClientID = "caspaste"
+	request.ThreatInfo.ThreatTypes = safeBrowsingThreats
+	request.ThreatInfo.PlatformTypes = []string{"ANY_PLATFORM"}
+	request.ThreatInfo.ThreatEntryTypes = []string{"URL"}
+	for _, link := range links {
+		request.ThreatInfo.ThreatEntries = append(request.ThreatInfo.ThreatEntries, entry{URL: link})
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.APIURL+"?key="+url.QueryEscape(cfg.APIKey), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := outbound.Client(0).Do(req)
+	if err != nil {
+		// The error names the URL, and so the key
+		return nil, fmt.Errorf("request failed: %w", errors.Unwrap(err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("lookup returned status %d", resp.StatusCode)
+	}
+
+	var answer struct {
+		Matches []struct {
+			ThreatType string `json:"threatType"`
+			Threat     entry  `json:"threat"`
+		} `json:"matches"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&answer); err != nil {
+		return nil, fmt.Errorf("invalid answer: %w", err)
+	}
+	var listed []string
+	seen := map[string]bool{}
+	for _, m := range answer.Matches {
+		if !seen[m.Threat.URL] {
+			seen[m.Threat.URL] = true
+			listed = append(listed, m.ThreatType+" "+m.Threat.URL)
+		}
+	}
+	return listed, nil
+}
@@ -0,0 +1,385 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+// Package spam scans new and edited pastes for spam and abuse: keyword and
+// regex blocklists, credential dumps found by their shape and entropy, and
+// links listed by Google Safe Browsing, and optionally pastes from addresses
+// with a bad IP reputation
+// A paste that matches is not published but held for an admin to review
+package spam
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/logger"
+	"github.com/casjay-forks/caspaste/src/outbound"
+	"github.com/casjay-forks/caspaste/src/reputation"
+	"github.com/casjay-forks/caspaste/src/storage"
+)
+
+// Rules, as named in matches and metrics
+const (
+	RuleKeyword        = "keyword"
+	RulePattern        = "pattern"
+	RuleCredentialDump = "credential_dump"
+	RuleSafeBrowsing   = "safe_browsing"
+	RuleReputation     = "reputation"
+)
+
+const (
+	// DefaultDumpMinLines is how many credential lines make a dump
+	DefaultDumpMinLines = 20
+	// DefaultDumpMinLength is the shortest lone token counted as a secret
+	DefaultDumpMinLength = 20
+	// DefaultDumpEntropy is the Shannon entropy, in bits per character,
+	// from which a lone token looks random
+	DefaultDumpEntropy = 4.0
+	// DefaultSafeBrowsingTimeout bounds a Safe Browsing lookup
+	DefaultSafeBrowsingTimeout = 5 * time.Second
+)
+
+// Config selects the checks new pastes go through
+type Config struct {
+	Enabled bool
+	// Words and phrases, matched case-insensitively
+	Keywords []string
+	// Regular expressions (RE2 syntax)
+	Patterns []string
+	// Hold every paste whose request carries a bad reputation.Score
+	BadReputation bool
+	// Lists of logins and passwords, keys or tokens
+	CredentialDumps DumpConfig
+	// Links in pastes are looked up when an API key is set
+	SafeBrowsing SafeBrowsingConfig
+}
+
+// DumpConfig tunes the credential dump heuristic
+// A line counts as a credential when it is "login:secret" (also with ;
+// or |), or a lone token of at least MinLength characters whose entropy
+// is at least Entropy; a paste is a dump when at least MinLines lines,
+// and half of its lines, count
+type DumpConfig struct {
+	Enabled   bool
+	MinLines  int
+	MinLength int
+	Entropy   float64
+}
+
+// Match is a check a paste failed
+type Match struct {
+	// One of the Rule constants
+	Rule string `json:"rule"`
+	// What matched, e.g. the keyword or the listed link
+	Detail string `json:"detail"`
+}
+
+func (m Match) String() string {
+	return m.Rule + ": " + m.Detail
+}
+
+// Stats counts the pastes scanned and held since the server started
+type Stats struct {
+	Scanned int64 `json:"scanned"`
+	Held    int64 `json:"held"`
+	// Held pastes by the rule that matched first
+	ByRule map[string]int64 `json:"by_rule"`
+	// Safe Browsing lookups that failed; their pastes were published
+	LookupErrors int64 `json:"lookup_errors"`
+}
+
+// rules is a compiled Config
+type rules struct {
+	cfg      Config
+	keywords []string
+	patterns []*regexp.Regexp
+}
+
+// Filter scans pastes; it is safe for concurrent use and implements
+// storage.PasteScanner
+type Filter struct {
+	mu    sync.RWMutex
+	rules *rules
+	log   logger.Logger
+
+	scanned      atomic.Int64
+	held         atomic.Int64
+	lookupErrors atomic.Int64
+	byRule       sync.Map // rule -> *atomic.Int64
+	onHeld       func(pasteID, reason, ip string, matches []Match)
+}
+
+// New creates a filter; an invalid pattern is an error
+func New(cfg Config, log logger.Logger) (*Filter, error) {
+	r, err := compile(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Filter{rules: r, log: log}, nil
+}
+
+// compile checks cfg and fills its defaults
+func compile(cfg Config) (*rules, error) {
+	r := &rules{cfg: cfg}
+	for _, keyword := range cfg.Keywords {
+		if keyword = strings.ToLower(strings.TrimSpace(keyword)); keyword != "" {
+			r.keywords = append(r.keywords, keyword)
+		}
+	}
+	for i, pattern := range cfg.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("pattern %d: %w", i+1, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+
+	dumps := &r.cfg.CredentialDumps
+	if dumps.MinLines < 0 || dumps.MinLength < 0 || dumps.Entropy < 0 {
+		return nil, errors.New("credential_dumps settings cannot be negative")
+	}
+	if dumps.MinLines == 0 {
+		dumps.MinLines = DefaultDumpMinLines
+	}
+	if dumps.MinLength == 0 {
+		dumps.MinLength = DefaultDumpMinLength
+	}
+	if dumps.Entropy == 0 {
+		dumps.Entropy = DefaultDumpEntropy
+	}
+	if r.cfg.SafeBrowsing.APIURL == "" {
+		r.cfg.SafeBrowsing.APIURL = DefaultSafeBrowsingURL
+	}
+	if r.cfg.SafeBrowsing.Timeout <= 0 {
+		r.cfg.SafeBrowsing.Timeout = DefaultSafeBrowsingTimeout
+	}
+	return r, nil
+}
+
+// SetConfig replaces the checks; an invalid pattern keeps the old ones
+func (f *Filter) SetConfig(cfg Config) error {
+	r, err := compile(cfg)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rules = r
+	return nil
+}
+
+// OnHeld sets what is done when a paste is held, e.g. auditing it
+func (f *Filter) OnHeld(fn func(pasteID, reason, ip string, matches []Match)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.onHeld = fn
+}
+
+// Config returns the checks in use, with their defaults
+func (f *Filter) Config() Config {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.rules.cfg
+}
+
+// Enabled reports whether pastes are scanned
+func (f *Filter) Enabled() bool {
+	return f.Config().Enabled
+}
+
+// SafeBrowsingEnabled reports whether links are looked up
+func (f *Filter) SafeBrowsingEnabled() bool {
+	cfg := f.Config()
+	return cfg.Enabled && cfg.SafeBrowsing.APIKey != "" && !outbound.Offline()
+}
+
+// Stats returns the counters since the server started
+func (f *Filter) Stats() Stats {
+	s := Stats{
+		Scanned:      f.scanned.Load(),
+		Held:         f.held.Load(),
+		LookupErrors: f.lookupErrors.Load(),
+		ByRule:       map[string]int64{},
+	}
+	f.byRule.Range(func(rule, n any) bool {
+		s.ByRule[rule.(string)] = n.(*atomic.Int64).Load()
+		return true
+	})
+	return s
+}
+
+// Scan runs every check on a title and body, and looks up urls and the
+// links in the body with Safe Browsing when the local checks pass
+// Scan works while the filter is disabled, for testing rules
+func (f *Filter) Scan(ctx context.Context, title, body string, urls []string) []Match {
+	f.mu.RLock()
+	r := f.rules
+	f.mu.RUnlock()
+
+	matches := r.scanText(title + "\n" + body)
+	if r.cfg.CredentialDumps.Enabled {
+		if n := credentialLines(body, r.cfg.CredentialDumps); n > 0 {
+			matches = append(matches, Match{Rule: RuleCredentialDump, Detail: fmt.Sprintf("%d credential lines", n)})
+		}
+	}
+	if len(matches) > 0 || r.cfg.SafeBrowsing.APIKey == "" || outbound.Offline() {
+		return matches
+	}
+
+	links := append(append([]string(nil), urls...), extractURLs(body)...)
+	listed, err := lookupSafeBrowsing(ctx, r.cfg.SafeBrowsing, links)
+	if err != nil {
+		f.lookupErrors.Add(1)
+		f.log.Warn("Spam filter: Safe Browsing lookup failed, the paste is published: " + err.Error())
+		return matches
+	}
+	for _, threat := range listed {
+		matches = append(matches, Match{Rule: RuleSafeBrowsing, Detail: threat})
+	}
+	return matches
+}
+
+// ScanPaste implements storage.PasteScanner: it returns why a paste is held
+// for review, or "" to publish it
+// Encrypted bodies and file contents cannot be read, so only their titles
+// and links are checked
+func (f *Filter) ScanPaste(ctx context.Context, paste storage.Paste) string {
+	if !f.Enabled() {
+		return ""
+	}
+	f.scanned.Add(1)
+
+	body := paste.Body
+	if paste.Encrypted || paste.IsFile {
+		body = ""
+	}
+	var urls []string
+	if paste.IsURL && paste.OriginalURL != "" {
+		urls = append(urls, paste.OriginalURL)
+	}
+	matches := f.Scan(ctx, paste.Title, body, urls)
+	if score, ok := reputation.FromContext(ctx); ok && score.Bad && f.Config().BadReputation {
+		matches = append(matches, Match{Rule: RuleReputation, Detail: fmt.Sprintf("score %d", score.Score)})
+	}
+	if len(matches) == 0 {
+		return ""
+	}
+	return reason(matches)
+}
+
+// Held implements storage.PasteScanner; it counts the paste and calls the
+// OnHeld function
+func (f *Filter) Held(pasteID, reason, ip string) {
+	f.held.Add(1)
+	rule, _, _ := strings.Cut(reason, ":")
+	n, _ := f.byRule.LoadOrStore(rule, new(atomic.Int64))
+	n.(*atomic.Int64).Add(1)
+
+	f.mu.RLock()
+	fn := f.onHeld
+	f.mu.RUnlock()
+	if fn != nil {
+		fn(pasteID, reason, ip, parseReason(reason))
+	}
+}
+
+// reason describes matches as the freeze reason of a paste
+func reason(matches []Match) string {
+	parts := make([]string, len(matches))
+	for i, m := range matches {
+		parts[i] = m.String()
+	}
+	return strings.Join(parts, "; ")
+}
+
+// parseReason returns the matches a reason describes
+func parseReason(reason string) []Match {
+	var matches []Match
+	for _, part := range strings.Split(reason, "; ") {
+		rule, detail, _ := strings.Cut(part, ": ")
+		matches = append(matches, Match{Rule: rule, Detail: detail})
+	}
+	return matches
+}
+
+// scanText runs the keyword and pattern checks
+func (r *rules) scanText(text string) []Match {
+	var matches []Match
+	lower := strings.ToLower(text)
+	for _, keyword := range r.keywords {
+		if strings.Contains(lower, keyword) {
+			matches = append(matches, Match{Rule: RuleKeyword, Detail: keyword})
+		}
+	}
+	for i, re := range r.patterns {
+		if re.MatchString(text) {
+			matches = append(matches, Match{Rule: RulePattern, Detail: fmt.Sprintf("%d (%s)", i+1, re.String())})
+		}
+	}
+	return matches
+}
+
+// credentialLine is "login:secret", with : ; or | between them
+var credentialLine = regexp.MustCompile(`^[\w.+-]+(?:@[\w-]+(?:\.[\w-]+)+)?[:;|][^\s:;|]{4,128}$`)
+
+// credentialLines returns how many lines of body are credentials, when
+// there are enough of them to make a dump, else 0
+// Lines inside PEM blocks other than private keys are skipped, so pasted
+// certificates are not taken for dumps
+func credentialLines(body string, cfg DumpConfig) int {
+	counted, total := 0, 0
+	inPEM, skipPEM := false, false
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "-----BEGIN ") {
+			inPEM, skipPEM = true, !strings.Contains(line, "PRIVATE KEY")
+			continue
+		}
+		if strings.HasPrefix(line, "-----END ") {
+			inPEM = false
+			continue
+		}
+		if inPEM && skipPEM {
+			continue
+		}
+		total++
+		switch {
+		case credentialLine.MatchString(line):
+			counted++
+		case !strings.ContainsAny(line, " \t") && len(line) >= cfg.MinLength && entropy(line) >= cfg.Entropy:
+			counted++
+		}
+	}
+	if counted < cfg.MinLines || counted*2 < total {
+		return 0
+	}
+	return counted
+}
+
+// entropy returns the Shannon entropy of s in bits per character
+func entropy(s string) float64 {
+	counts := map[rune]int{}
+	n := 0
+	for _, c := range s {
+		counts[c]++
+		n++
+	}
+	var bits float64
+	for _, count := range counts {
+		p := float64(count) / float64(n)
+		bits -= p * math.Log2(p)
+	}
+	return bits
+}
@@ -20,6 +20,9 @@ import (
 
 	"golang.org/x/crypto/acme"
 	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/casjay-forks/caspaste/src/cryptopolicy"
+	"github.com/casjay-forks/caspaste/src/outbound"
 )
 
 // ACMEConfig holds ACME/Let's Encrypt configuration
@@ -46,6 +49,9 @@ func NewACMEManager(cfg *ACMEConfig) (*ACMEManager, error) {
 	if cfg == nil || !cfg.Enabled {
 		return &ACMEManager{enabled: false}, nil
 	}
+	if outbound.Offline() {
+		return nil, fmt.Errorf("ACME: %w", outbound.ErrOffline)
+	}
 
 	// Ensure cache directory exists
 	cacheDir := cfg.CacheDir
@@ -73,11 +79,10 @@ func NewACMEManager(cfg *ACMEConfig) (*ACMEManager, error) {
 		RenewBefore: 30 * 24 * time.Hour,
 	}
 
-	// Set staging directory if configured
-	if cfg.Staging {
-		m.Client = &acme.Client{
-			DirectoryURL: directoryURL,
-		}
+	// Requests to the CA go through the outbound proxy
+	m.Client = &acme.Client{
+		DirectoryURL: directoryURL,
+		HTTPClient:   outbound.Client(0),
 	}
 
 	return &ACMEManager{
@@ -117,11 +122,11 @@ func (m *ACMEManager) GetTLSConfig() *tls.Config {
 		return nil
 	}
 
-	return &tls.Config{
+	return cryptopolicy.ApplyTLS(&tls.Config{
 		GetCertificate: m.autocert.GetCertificate,
 		NextProtos:     []string{"h2", "http/1.1", acme.ALPNProto},
 		MinVersion:     tls.VersionTLS12,
-	}
+	})
 }
 
 // HTTPHandler returns the HTTP-01 challenge handler
@@ -15,6 +15,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/casjay-forks/caspaste/src/cryptopolicy"
 	"github.com/casjay-forks/caspaste/src/path"
 )
 
@@ -203,7 +204,7 @@ func (m *Manager) GetTLSConfig(cert *Certificate) (*tls.Config, error) {
 		return nil, fmt.Errorf("failed to load certificate: %w", err)
 	}
 
-	return &tls.Config{
+	return cryptopolicy.ApplyTLS(&tls.Config{
 		Certificates: []tls.Certificate{tlsCert},
 		MinVersion:   tls.VersionTLS12,
 		CipherSuites: []uint16{
@@ -214,7 +215,7 @@ func (m *Manager) GetTLSConfig(cert *Certificate) (*tls.Config, error) {
 			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
 			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
 		},
-	}, nil
+	}), nil
 }
 
 // AutoDiscover attempts to find certificates automatically
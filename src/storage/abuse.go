@@ -0,0 +1,159 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrAbuseReportNotFound = errors.New("db: abuse report not found")
+
+// Abuse report states
+const (
+	AbuseReportOpen     = "open"
+	AbuseReportResolved = "resolved"
+)
+
+// What closing an abuse report did; AbuseResolutionNone is a report
+// resolved without saying, or one that is open
+const (
+	AbuseResolutionNone      = ""
+	AbuseResolutionDismissed = "dismissed"
+	AbuseResolutionDeleted   = "deleted"
+	AbuseResolutionBanned    = "banned"
+)
+
+// Abuse report ticket states
+const (
+	AbuseTicketNone   = ""
+	AbuseTicketSent   = "sent"
+	AbuseTicketFailed = "failed"
+)
+
+// AbuseReport is a report about a paste in the moderation queue
+// Times are unix seconds; ResolvedAt is 0 while the report is open
+type AbuseReport struct {
+	ID         string `json:"id"`
+	PasteID    string `json:"paste_id"`
+	Reason     string `json:"reason"`
+	Email      string `json:"email"`
+	IP         string `json:"ip"`
+	State      string `json:"state"`
+	Ticket     string `json:"ticket"`
+	Resolution string `json:"resolution"`
+	CreatedAt  int64  `json:"created_at"`
+	ResolvedAt int64  `json:"resolved_at"`
+}
+
+const abuseReportColumns = `id, paste_id, reason, email, ip, state, ticket, resolution, created_at, resolved_at`
+
+func scanAbuseReport(row interface{ Scan(...any) error }) (AbuseReport, error) {
+	var r AbuseReport
+	err := row.Scan(&r.ID, &r.PasteID, &r.Reason, &r.Email, &r.IP, &r.State, &r.Ticket, &r.Resolution, &r.CreatedAt, &r.ResolvedAt)
+	return r, err
+}
+
+// AbuseReportList returns the reports in a state ("" = all), newest first
+func (db DB) AbuseReportList(state string) ([]AbuseReport, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultListTimeout)
+	defer cancel()
+
+	query := `SELECT ` + abuseReportColumns + ` FROM abuse_reports ORDER BY created_at DESC`
+	args := []any{}
+	if state != "" {
+		query = `SELECT ` + abuseReportColumns + ` FROM abuse_reports WHERE state = $1 ORDER BY created_at DESC`
+		args = append(args, state)
+	}
+	rows, err := db.pool.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := []AbuseReport{}
+	for rows.Next() {
+		r, err := scanAbuseReport(rows)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, r)
+	}
+	return reports, rows.Err()
+}
+
+// AbuseReportGet returns a report by ID
+func (db DB) AbuseReportGet(id string) (AbuseReport, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	r, err := scanAbuseReport(db.pool.QueryRowContext(ctx,
+		`SELECT `+abuseReportColumns+` FROM abuse_reports WHERE id = $1`, id,
+	))
+	if err == sql.ErrNoRows {
+		return r, ErrAbuseReportNotFound
+	}
+	return r, err
+}
+
+// AbuseReportAdd stores a new open report and returns it with its ID
+func (db DB) AbuseReportAdd(r AbuseReport) (AbuseReport, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	var err error
+	r.ID, err = genTokenCrypto(8)
+	if err != nil {
+		return r, err
+	}
+	r.State, r.Ticket, r.Resolution = AbuseReportOpen, AbuseTicketNone, AbuseResolutionNone
+	r.CreatedAt, r.ResolvedAt = time.Now().Unix(), 0
+
+	_, err = db.pool.ExecContext(ctx,
+		`INSERT INTO abuse_reports (`+abuseReportColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		r.ID, r.PasteID, r.Reason, r.Email, r.IP, r.State, r.Ticket, r.Resolution, r.CreatedAt, r.ResolvedAt,
+	)
+	return r, err
+}
+
+// AbuseReportSetState opens or resolves a report; resolution says what
+// resolving it did and is cleared when it is reopened
+func (db DB) AbuseReportSetState(id, state, resolution string) error {
+	resolvedAt := int64(0)
+	if state == AbuseReportResolved {
+		resolvedAt = time.Now().Unix()
+	} else {
+		resolution = AbuseResolutionNone
+	}
+	return db.abuseReportExec(`UPDATE abuse_reports SET state = $2, resolution = $3, resolved_at = $4 WHERE id = $1`,
+		id, state, resolution, resolvedAt)
+}
+
+// AbuseReportSetTicket records whether the ticket email of a report was sent
+func (db DB) AbuseReportSetTicket(id, ticket string) error {
+	return db.abuseReportExec(`UPDATE abuse_reports SET ticket = $2 WHERE id = $1`, id, ticket)
+}
+
+func (db DB) abuseReportExec(query string, args ...any) error {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	result, err := db.pool.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrAbuseReportNotFound
+	}
+	return nil
+}
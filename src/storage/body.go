@@ -0,0 +1,498 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/casjay-forks/caspaste/src/blob"
+	"github.com/casjay-forks/caspaste/src/metric"
+)
+
+// Paste bodies are stored in one of four ways, recorded per paste in
+// pastes.body_storage: inline in the row (pastes from before have an empty
+// value), zstd or gzip compressed and base64 encoded in the row, or in the
+// blob store
+const (
+	BodyInline = "inline"
+	BodyZstd   = "zstd"
+	BodyGzip   = "gzip"
+	BodyBlob   = "blob"
+)
+
+// ErrNoBlobStore is returned when reading a blob-stored body without a blob store
+var ErrNoBlobStore = errors.New("db: paste body is in the blob store, which is not configured")
+
+// Errors of streamed bodies (see PasteAddStream)
+var (
+	ErrNoStreaming  = errors.New("db: streamed paste bodies need a blob store")
+	ErrBodyTooLarge = errors.New("db: paste body too large")
+	ErrBodyEmpty    = errors.New("db: paste body is empty")
+)
+
+const (
+	// adaptiveWarmup is how many bodies of a kind are compressed before the
+	// policy judges whether compressing that kind pays off
+	adaptiveWarmup = 8
+	// adaptiveProbe retries compression on one in this many skipped bodies,
+	// so a kind that starts compressing well again is noticed
+	adaptiveProbe = 16
+	// savingsWeight is the weight of the newest body in the moving average
+	savingsWeight = 0.2
+)
+
+// BodyPolicyConfig holds the size thresholds of the body storage policy
+// Sizes are in bytes; 0 = never
+type BodyPolicyConfig struct {
+	// Compress bodies at least this big
+	CompressMinSize int `json:"compress_min_size"`
+	// BodyZstd or BodyGzip (default: BodyZstd)
+	Algorithm string `json:"algorithm"`
+	// Keep a compressed body only if it saves this many percent
+	CompressMinSavings int `json:"compress_min_savings"`
+	// Keep bodies at least this big in the blob store
+	BlobMinSize int `json:"blob_min_size"`
+	// Stop compressing kinds of paste (text, file) that have not been
+	// saving CompressMinSavings, apart from the odd probe
+	Adaptive bool `json:"adaptive"`
+}
+
+// BodyPolicy chooses how each paste body is stored and keeps the figures
+// behind its decisions
+type BodyPolicy struct {
+	cfg   BodyPolicyConfig
+	blobs blob.Store
+
+	mu         sync.Mutex
+	kinds      map[string]*compressionStats
+	strategies map[string]*strategyStats
+}
+
+// compressionStats tracks how well a kind of paste compresses
+type compressionStats struct {
+	samples int64
+	savings float64
+	skipped int64
+}
+
+// strategyStats tracks the bodies stored and read with a strategy since start
+type strategyStats struct {
+	writes    int64
+	reads     int64
+	bytes     int64
+	writeTime time.Duration
+	readTime  time.Duration
+}
+
+// NewBodyPolicy creates a policy; blobs may be nil, which turns off the blob strategy
+func NewBodyPolicy(cfg BodyPolicyConfig, blobs blob.Store) *BodyPolicy {
+	if cfg.Algorithm == "" {
+		cfg.Algorithm = BodyZstd
+	}
+	return &BodyPolicy{
+		cfg:        cfg,
+		blobs:      blobs,
+		kinds:      make(map[string]*compressionStats),
+		strategies: make(map[string]*strategyStats),
+	}
+}
+
+// SetBodyPolicy sets how paste bodies are stored; without one they are inline
+// Call before the DB value is copied into handlers
+func (db *DB) SetBodyPolicy(p *BodyPolicy) {
+	db.bodies = p
+}
+
+// BodyPolicy returns the body storage policy, or nil
+func (db DB) BodyPolicy() *BodyPolicy {
+	return db.bodies
+}
+
+// bodyKind groups pastes that compress alike
+func bodyKind(paste Paste) string {
+	if paste.IsFile {
+		return "file"
+	}
+	return "text"
+}
+
+// blobKey is where a paste body is kept in the blob store
+func blobKey(id string) string {
+	return "pastes/" + id
+}
+
+// bodyDigest is kept in the body column of blob-stored pastes so a blob can
+// be checked against what was written (see Fsck)
+func bodyDigest(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// contentHash is the digest of a paste body, as for blobs, whose body
+// column already holds it
+func contentHash(paste Paste, body, strategy string) string {
+	if strategy == BodyBlob {
+		return body
+	}
+	return bodyDigest(paste.Body)
+}
+
+// encode stores a body and returns the value for the body column and its strategy
+func (p *BodyPolicy) encode(ctx context.Context, paste Paste) (string, string, error) {
+	size := len(paste.Body)
+	if p == nil {
+		return paste.Body, BodyInline, nil
+	}
+
+	if p.blobs != nil && p.cfg.BlobMinSize > 0 && size >= p.cfg.BlobMinSize {
+		if err := p.blobs.Put(ctx, blobKey(paste.ID), []byte(paste.Body)); err != nil {
+			return "", "", fmt.Errorf("db: store paste body: %w", err)
+		}
+		return bodyDigest(paste.Body), BodyBlob, nil
+	}
+
+	if p.cfg.CompressMinSize > 0 && size >= p.cfg.CompressMinSize {
+		kind := bodyKind(paste)
+		if p.tryCompress(kind) {
+			encoded, err := compressBody(p.cfg.Algorithm, paste.Body)
+			if err != nil {
+				return "", "", err
+			}
+			saved := 1 - float64(len(encoded))/float64(size)
+			p.recordSavings(kind, saved)
+			if saved*100 >= float64(p.cfg.CompressMinSavings) {
+				return encoded, p.cfg.Algorithm, nil
+			}
+		}
+	}
+
+	return paste.Body, BodyInline, nil
+}
+
+// encodeStream writes a body read from r to the blob store and returns the
+// value for the body column and the size of the stored body
+// Bodies of file pastes are base64 encoded on the way, as encode gets them
+func (p *BodyPolicy) encodeStream(ctx context.Context, paste Paste, r io.Reader, maxSize int64) (string, int, error) {
+	if p == nil || p.blobs == nil {
+		return "", 0, ErrNoStreaming
+	}
+	streamer, ok := p.blobs.(blob.Streamer)
+	if !ok {
+		return "", 0, ErrNoStreaming
+	}
+
+	r = &streamLimit{r: r, max: maxSize}
+	if paste.IsFile {
+		pr, pw := io.Pipe()
+		// Unblocks the encoder if the blob store stops reading early
+		defer pr.Close()
+		go func(src io.Reader) {
+			enc := base64.NewEncoder(base64.StdEncoding, pw)
+			_, err := io.Copy(enc, src)
+			if err == nil {
+				err = enc.Close()
+			}
+			pw.CloseWithError(err)
+		}(r)
+		r = pr
+	}
+
+	sum := sha256.New()
+	size, err := streamer.PutStream(ctx, blobKey(paste.ID), io.TeeReader(r, sum))
+	if err != nil {
+		return "", 0, fmt.Errorf("db: store paste body: %w", err)
+	}
+	return "sha256:" + hex.EncodeToString(sum.Sum(nil)), int(size), nil
+}
+
+// streamLimit fails reading a body that is empty or bigger than max bytes
+// (0 = no limit), so the blob store drops what it wrote
+type streamLimit struct {
+	r   io.Reader
+	n   int64
+	max int64
+}
+
+func (l *streamLimit) Read(b []byte) (int, error) {
+	n, err := l.r.Read(b)
+	l.n += int64(n)
+	if l.max > 0 && l.n > l.max {
+		return n, ErrBodyTooLarge
+	}
+	if err == io.EOF && l.n == 0 {
+		return n, ErrBodyEmpty
+	}
+	return n, err
+}
+
+// decode returns the body of a paste from its body column and strategy
+func (p *BodyPolicy) decode(ctx context.Context, id, stored, strategy string) (string, error) {
+	switch strategy {
+	case "", BodyInline:
+		return stored, nil
+	case BodyZstd, BodyGzip:
+		return decompressBody(strategy, stored)
+	case BodyBlob:
+		if p == nil || p.blobs == nil {
+			return "", ErrNoBlobStore
+		}
+		data, err := p.blobs.Get(ctx, blobKey(id))
+		if err != nil {
+			return "", fmt.Errorf("db: read paste body: %w", err)
+		}
+		return string(data), nil
+	}
+	return "", fmt.Errorf("db: unknown body storage %q for paste %s", strategy, id)
+}
+
+// removeBlobs deletes the blob-stored bodies of deleted pastes
+func (p *BodyPolicy) removeBlobs(ids []string) {
+	if p == nil || p.blobs == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), defaultBatchTimeout)
+	defer cancel()
+	for _, id := range ids {
+		if err := p.blobs.Delete(ctx, blobKey(id)); err != nil && !errors.Is(err, blob.ErrNotFound) {
+			log.Printf("[WARN] storage: delete body of paste %s: %v", id, err)
+		}
+	}
+}
+
+// tryCompress decides whether to compress a body of a kind: always while
+// learning, then only if the kind has been saving enough, plus the odd probe
+func (p *BodyPolicy) tryCompress(kind string) bool {
+	if !p.cfg.Adaptive {
+		return true
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	k := p.kind(kind)
+	if k.samples < adaptiveWarmup || k.savings*100 >= float64(p.cfg.CompressMinSavings) {
+		return true
+	}
+	k.skipped++
+	return k.skipped%adaptiveProbe == 0
+}
+
+func (p *BodyPolicy) recordSavings(kind string, saved float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	k := p.kind(kind)
+	if k.samples == 0 {
+		k.savings = saved
+	} else {
+		k.savings += savingsWeight * (saved - k.savings)
+	}
+	k.samples++
+}
+
+// kind returns the stats of a kind; p.mu must be held
+func (p *BodyPolicy) kind(kind string) *compressionStats {
+	k, ok := p.kinds[kind]
+	if !ok {
+		k = &compressionStats{}
+		p.kinds[kind] = k
+	}
+	return k
+}
+
+// strategy returns the stats of a strategy; p.mu must be held
+func (p *BodyPolicy) strategy(strategy string) *strategyStats {
+	if strategy == "" {
+		strategy = BodyInline
+	}
+	s, ok := p.strategies[strategy]
+	if !ok {
+		s = &strategyStats{}
+		p.strategies[strategy] = s
+	}
+	return s
+}
+
+// recordWrite counts a stored body of size bytes
+func (p *BodyPolicy) recordWrite(strategy string, size int, took time.Duration) {
+	metric.RecordPasteStored(strategy, size)
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s := p.strategy(strategy)
+	s.writes++
+	s.bytes += int64(size)
+	s.writeTime += took
+}
+
+// recordRead counts a body read back
+func (p *BodyPolicy) recordRead(strategy string, took time.Duration) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s := p.strategy(strategy)
+	s.reads++
+	s.readTime += took
+}
+
+// BodyStrategyStats shows the bodies stored and read with a strategy since start
+type BodyStrategyStats struct {
+	Strategy   string  `json:"strategy"`
+	Writes     int64   `json:"writes"`
+	Reads      int64   `json:"reads"`
+	Bytes      int64   `json:"bytes"`
+	AvgWriteMs float64 `json:"avg_write_ms"`
+	AvgReadMs  float64 `json:"avg_read_ms"`
+}
+
+// BodyCompressionStats shows how well a kind of paste compresses
+type BodyCompressionStats struct {
+	Kind        string  `json:"kind"`
+	Samples     int64   `json:"samples"`
+	Savings     float64 `json:"savings_percent"`
+	Compressing bool    `json:"compressing"`
+}
+
+// BodyPolicyStats is a snapshot of the policy and its decisions
+type BodyPolicyStats struct {
+	Config      BodyPolicyConfig       `json:"config"`
+	BlobStore   bool                   `json:"blob_store"`
+	Strategies  []BodyStrategyStats    `json:"strategies"`
+	Compression []BodyCompressionStats `json:"compression"`
+}
+
+// Stats returns a snapshot of the policy
+func (p *BodyPolicy) Stats() BodyPolicyStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := BodyPolicyStats{
+		Config:      p.cfg,
+		BlobStore:   p.blobs != nil,
+		Strategies:  []BodyStrategyStats{},
+		Compression: []BodyCompressionStats{},
+	}
+	for name, s := range p.strategies {
+		st := BodyStrategyStats{Strategy: name, Writes: s.writes, Reads: s.reads, Bytes: s.bytes}
+		if s.writes > 0 {
+			st.AvgWriteMs = float64(s.writeTime.Microseconds()) / 1000 / float64(s.writes)
+		}
+		if s.reads > 0 {
+			st.AvgReadMs = float64(s.readTime.Microseconds()) / 1000 / float64(s.reads)
+		}
+		stats.Strategies = append(stats.Strategies, st)
+	}
+	for name, k := range p.kinds {
+		stats.Compression = append(stats.Compression, BodyCompressionStats{
+			Kind:        name,
+			Samples:     k.samples,
+			Savings:     k.savings * 100,
+			Compressing: !p.cfg.Adaptive || k.samples < adaptiveWarmup || k.savings*100 >= float64(p.cfg.CompressMinSavings),
+		})
+	}
+	sort.Slice(stats.Strategies, func(i, j int) bool { return stats.Strategies[i].Strategy < stats.Strategies[j].Strategy })
+	sort.Slice(stats.Compression, func(i, j int) bool { return stats.Compression[i].Kind < stats.Compression[j].Kind })
+	return stats
+}
+
+// compressBody compresses a body with an algorithm, BodyZstd or BodyGzip,
+// and base64 encodes it for the body column
+func compressBody(algorithm, body string) (string, error) {
+	switch algorithm {
+	case BodyZstd:
+		enc, err := zstdEncoder()
+		if err != nil {
+			return "", err
+		}
+		return base64.StdEncoding.EncodeToString(enc.EncodeAll([]byte(body), nil)), nil
+	case BodyGzip:
+		return gzipBody(body)
+	}
+	return "", fmt.Errorf("db: unknown compression %q", algorithm)
+}
+
+// decompressBody reverses compressBody
+func decompressBody(algorithm, stored string) (string, error) {
+	switch algorithm {
+	case BodyZstd:
+		dec, err := zstdDecoder()
+		if err != nil {
+			return "", err
+		}
+		data, err := base64.StdEncoding.DecodeString(stored)
+		if err != nil {
+			return "", fmt.Errorf("db: decode compressed body: %w", err)
+		}
+		body, err := dec.DecodeAll(data, nil)
+		if err != nil {
+			return "", fmt.Errorf("db: decode compressed body: %w", err)
+		}
+		return string(body), nil
+	case BodyGzip:
+		return gunzipBody(stored)
+	}
+	return "", fmt.Errorf("db: unknown compression %q", algorithm)
+}
+
+// The zstd encoder and decoder are safe for concurrent use, and made on
+// first use as each keeps buffers around
+var (
+	zstdEncoder = sync.OnceValues(func() (*zstd.Encoder, error) {
+		return zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+	})
+	zstdDecoder = sync.OnceValues(func() (*zstd.Decoder, error) {
+		return zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+	})
+)
+
+func gzipBody(body string) (string, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(body)); err != nil {
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+func gunzipBody(stored string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(stored)
+	if err != nil {
+		return "", fmt.Errorf("db: decode compressed body: %w", err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("db: decode compressed body: %w", err)
+	}
+	defer zr.Close()
+	body, err := io.ReadAll(zr)
+	if err != nil {
+		return "", fmt.Errorf("db: decode compressed body: %w", err)
+	}
+	return string(body), nil
+}
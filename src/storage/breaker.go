@@ -0,0 +1,237 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/metric"
+)
+
+// A circuit breaker checks the database now and then; once it stops
+// answering, the circuit opens and queries fail at once with ErrUnavailable
+// instead of each waiting on a dead pool: cached pastes are still served,
+// everything else gets 503 until a check succeeds and the circuit closes
+
+// ErrUnavailable is returned, without reaching the database, while the
+// circuit is open
+var ErrUnavailable = errors.New("db: database is unavailable")
+
+// Defaults for zero config values
+const (
+	DefaultBreakerInterval = 5 * time.Second
+	DefaultBreakerTimeout  = 2 * time.Second
+	DefaultBreakerFailures = 2
+)
+
+// circuit states
+const (
+	CircuitClosed = "closed"
+	CircuitOpen   = "open"
+)
+
+// BreakerConfig holds how the database is checked; zero values use the
+// defaults
+type BreakerConfig struct {
+	// How often the database is checked
+	Interval time.Duration
+	// Longest a check may take
+	Timeout time.Duration
+	// Failed checks in a row that open the circuit
+	Failures int
+}
+
+// Breaker is the circuit breaker of a database
+type Breaker struct {
+	cfg  BreakerConfig
+	pool *sql.DB
+	// Read on every query, so kept apart from mu
+	open     atomic.Bool
+	rejected atomic.Int64
+
+	mu        sync.Mutex
+	failures  int
+	since     time.Time
+	lastCheck time.Time
+	lastError string
+	opened    int64
+	onChange  func(open bool, err error)
+}
+
+// NewBreaker creates a closed circuit breaker; it checks nothing until it
+// is set on a DB and started
+func NewBreaker(cfg BreakerConfig) *Breaker {
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultBreakerInterval
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultBreakerTimeout
+	}
+	if cfg.Failures <= 0 {
+		cfg.Failures = DefaultBreakerFailures
+	}
+	return &Breaker{cfg: cfg, since: time.Now()}
+}
+
+// SetBreaker fails queries at once while b finds the database down
+// Call before the DB value is copied into handlers
+func (db *DB) SetBreaker(b *Breaker) {
+	b.pool = db.pool
+	db.breaker = b
+}
+
+// Breaker returns the circuit breaker, or nil
+func (db DB) Breaker() *Breaker {
+	return db.breaker
+}
+
+// Unavailable reports whether the circuit is open, so queries fail with
+// ErrUnavailable
+func (db DB) Unavailable() bool {
+	return db.breaker != nil && db.breaker.open.Load()
+}
+
+// reject counts a query refused while the circuit is open
+func (db DB) reject() error {
+	db.breaker.rejected.Add(1)
+	metric.RecordDBRejected()
+	return ErrUnavailable
+}
+
+// OnChange is called when the circuit opens, with the error of the last
+// check, and when it closes again
+func (b *Breaker) OnChange(fn func(open bool, err error)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.onChange = fn
+}
+
+// Start checks the database every interval, for as long as the server runs
+func (b *Breaker) Start() {
+	go func() {
+		for range time.Tick(b.cfg.Interval) {
+			b.Check()
+		}
+	}()
+}
+
+// RetryAfter is how many seconds a client refused while the circuit is
+// open should wait, the time until the next check
+func (b *Breaker) RetryAfter() int {
+	interval := DefaultBreakerInterval
+	if b != nil {
+		interval = b.cfg.Interval
+	}
+	return int((interval + time.Second - 1) / time.Second)
+}
+
+// Check pings the database and updates the circuit: it opens after the
+// configured failures in a row and closes on the first success
+func (b *Breaker) Check() error {
+	ctx, cancel := context.WithTimeout(context.Background(), b.cfg.Timeout)
+	defer cancel()
+	err := b.pool.PingContext(ctx)
+
+	b.mu.Lock()
+	b.lastCheck = time.Now()
+	changed := false
+	if err == nil {
+		b.failures = 0
+		if b.open.Load() {
+			b.open.Store(false)
+			b.since, changed = b.lastCheck, true
+		}
+	} else {
+		b.failures++
+		b.lastError = err.Error()
+		if !b.open.Load() && b.failures >= b.cfg.Failures {
+			b.open.Store(true)
+			b.opened++
+			b.since, changed = b.lastCheck, true
+		}
+	}
+	onChange := b.onChange
+	open := b.open.Load()
+	b.mu.Unlock()
+
+	if !changed {
+		return err
+	}
+	state := CircuitClosed
+	if open {
+		state = CircuitOpen
+	}
+	metric.UpdateDBCircuitState(state)
+	if onChange != nil {
+		onChange(open, err)
+	}
+	return err
+}
+
+// unavailableContext is the parent of queries while the circuit is open: it
+// is already done with ErrUnavailable, so database/sql fails each query
+// before taking a connection, and the timeouts derived from it end the same
+// way; values still come from the request
+type unavailableContext struct {
+	context.Context
+}
+
+var closedDone = func() chan struct{} {
+	done := make(chan struct{})
+	close(done)
+	return done
+}()
+
+func (unavailableContext) Done() <-chan struct{} {
+	return closedDone
+}
+
+func (unavailableContext) Err() error {
+	return ErrUnavailable
+}
+
+// BreakerStats is a snapshot of the circuit breaker
+type BreakerStats struct {
+	State string `json:"state"`
+	// Unix time the circuit last opened or closed, or the breaker started
+	Since     int64  `json:"since"`
+	LastCheck int64  `json:"last_check"`
+	LastError string `json:"last_error,omitempty"`
+	// Failed checks in a row
+	Failures int `json:"failures"`
+	// Times the circuit opened, and queries failed at once while it was
+	Opened   int64  `json:"opened"`
+	Rejected int64  `json:"rejected"`
+	Interval string `json:"interval"`
+}
+
+// Stats returns a snapshot of the breaker; counts are since start
+func (b *Breaker) Stats() BreakerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats := BreakerStats{
+		State:     CircuitClosed,
+		Since:     b.since.Unix(),
+		LastError: b.lastError,
+		Failures:  b.failures,
+		Opened:    b.opened,
+		Rejected:  b.rejected.Load(),
+		Interval:  b.cfg.Interval.String(),
+	}
+	if b.open.Load() {
+		stats.State = CircuitOpen
+	}
+	if !b.lastCheck.IsZero() {
+		stats.LastCheck = b.lastCheck.Unix()
+	}
+	return stats
+}
@@ -0,0 +1,79 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestBreaker(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "caspaste.db")
+	if err := InitDB("sqlite", src); err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewPool("sqlite", src, 5, 2, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	db.SetPasteCache(NewPasteCache(PasteCacheConfig{MaxItems: 10, MaxBytes: 1 << 20, MaxPasteSize: 1 << 20}))
+	b := NewBreaker(BreakerConfig{Failures: 2})
+	db.SetBreaker(b)
+
+	id, _, _, err := db.PasteAdd(Paste{Title: "cached", Body: "hello", Syntax: "plaintext"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Reading it once puts it in the cache
+	if _, err := db.PasteGet(id); err != nil {
+		t.Fatal(err)
+	}
+
+	// A closed pool fails every ping
+	dead, err := sql.Open("sqlite", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead.Close()
+	b.pool = dead
+
+	b.Check()
+	if db.Unavailable() {
+		t.Error("expected the circuit to stay closed after 1 failure")
+	}
+	b.Check()
+	if !db.Unavailable() {
+		t.Error("expected the circuit to open after 2 failures")
+	}
+
+	paste, err := db.PasteGet(id)
+	if err != nil || paste.Body != "hello" {
+		t.Error("expected cached paste", "hello", "but got", paste.Body, err)
+	}
+	if _, err := db.PasteGet("missing"); !errors.Is(err, ErrUnavailable) {
+		t.Error("expected", ErrUnavailable, "but got", err)
+	}
+	if _, _, _, err := db.PasteAdd(Paste{Body: "refused"}); !errors.Is(err, ErrUnavailable) {
+		t.Error("expected", ErrUnavailable, "but got", err)
+	}
+
+	// The first successful check closes the circuit again
+	b.pool = db.pool
+	if err := b.Check(); err != nil {
+		t.Fatal(err)
+	}
+	if db.Unavailable() {
+		t.Error("expected the circuit to close after a successful check")
+	}
+	if _, err := db.PasteGet("missing"); errors.Is(err, ErrUnavailable) {
+		t.Error("expected a lookup error but got", err)
+	}
+}
@@ -0,0 +1,252 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Bulk actions let admins clean up a spam wave: the pastes matching a filter
+// are listed first, then deleted or expired together. Legal holds and WORM
+// mode apply to each paste as to a single delete
+
+var ErrBulkFilterEmpty = errors.New("db: a bulk action needs at least one filter")
+
+// Bulk actions
+const (
+	BulkDelete = "delete"
+	// Expire sets the expiry time to now, so the pastes are hidden at once
+	// and removed by the next cleanup
+	BulkExpire = "expire"
+)
+
+// contentHashRegex is a body digest, with or without its prefix
+var contentHashRegex = regexp.MustCompile(`^(sha256:)?[0-9a-f]{64}$`)
+
+// BulkFilter selects the pastes of a bulk action; every field that is set
+// must match, and at least one must be set
+type BulkFilter struct {
+	// An address, or a CIDR range, the pastes were created from
+	IPRange string
+	// Created at or after From and before To; zero times are open
+	From time.Time
+	To   time.Time
+	// Digest of the body, "sha256:" and 64 hex digits; the prefix may be
+	// left out
+	ContentHash string
+	// Username of the owner, or the author name given with the paste
+	User string
+}
+
+// Check reports whether the filter is usable, normalizing the content hash
+func (f *BulkFilter) Check() error {
+	f.IPRange = strings.TrimSpace(f.IPRange)
+	f.User = strings.TrimSpace(f.User)
+	f.ContentHash = strings.ToLower(strings.TrimSpace(f.ContentHash))
+
+	if f.IPRange == "" && f.From.IsZero() && f.To.IsZero() && f.ContentHash == "" && f.User == "" {
+		return ErrBulkFilterEmpty
+	}
+	if f.IPRange != "" {
+		if _, err := f.ipNet(); err != nil {
+			return err
+		}
+	}
+	if f.ContentHash != "" {
+		if !contentHashRegex.MatchString(f.ContentHash) {
+			return fmt.Errorf("db: content hash %q is not a SHA-256 digest", f.ContentHash)
+		}
+		if !strings.HasPrefix(f.ContentHash, "sha256:") {
+			f.ContentHash = "sha256:" + f.ContentHash
+		}
+	}
+	return nil
+}
+
+// ipNet is the range of IPRange, nil for a single address
+func (f BulkFilter) ipNet() (*net.IPNet, error) {
+	if !strings.Contains(f.IPRange, "/") {
+		if net.ParseIP(f.IPRange) == nil {
+			return nil, fmt.Errorf("db: %q is not an IP address or CIDR range", f.IPRange)
+		}
+		return nil, nil
+	}
+	_, ipNet, err := net.ParseCIDR(f.IPRange)
+	if err != nil {
+		return nil, fmt.Errorf("db: %q is not an IP address or CIDR range", f.IPRange)
+	}
+	return ipNet, nil
+}
+
+// String describes the filter for the audit log
+func (f BulkFilter) String() string {
+	var parts []string
+	if f.IPRange != "" {
+		parts = append(parts, "ip="+f.IPRange)
+	}
+	if !f.From.IsZero() {
+		parts = append(parts, "from="+f.From.UTC().Format(time.RFC3339))
+	}
+	if !f.To.IsZero() {
+		parts = append(parts, "to="+f.To.UTC().Format(time.RFC3339))
+	}
+	if f.ContentHash != "" {
+		parts = append(parts, "content_hash="+f.ContentHash)
+	}
+	if f.User != "" {
+		parts = append(parts, "user="+f.User)
+	}
+	return strings.Join(parts, " ")
+}
+
+// BulkResult counts what a bulk action did to the pastes it was given
+type BulkResult struct {
+	Action  string `json:"action"`
+	Matched int    `json:"matched"`
+	Done    int    `json:"done"`
+	// Under legal hold, write-once, or already gone
+	Skipped int `json:"skipped"`
+	Failed  int `json:"failed"`
+}
+
+// PasteBulkMatch returns every paste matching filter, newest first, frozen
+// and private ones included
+func (db DB) PasteBulkMatch(filter BulkFilter) ([]ModerationItem, error) {
+	if err := filter.Check(); err != nil {
+		return nil, err
+	}
+	ipNet, _ := filter.ipNet()
+
+	var conds []string
+	var args []any
+	add := func(cond string, value any) {
+		args = append(args, value)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	switch {
+	case filter.IPRange == "":
+	case ipNet == nil:
+		add("p.creator_ip = $%d", filter.IPRange)
+	default:
+		// Ranges are matched below, on the pastes that have an address
+		conds = append(conds, "p.creator_ip <> ''")
+	}
+	if !filter.From.IsZero() {
+		add("p.create_time >= $%d", filter.From.Unix())
+	}
+	if !filter.To.IsZero() {
+		add("p.create_time < $%d", filter.To.Unix())
+	}
+	if filter.ContentHash != "" {
+		add("p.content_hash = $%d", filter.ContentHash)
+	}
+	if filter.User != "" {
+		args = append(args, filter.User)
+		conds = append(conds, fmt.Sprintf("(u.username = $%d OR p.author = $%d)", len(args), len(args)))
+	}
+
+	ctx, cancel := context.WithTimeout(db.context(), defaultBatchTimeout)
+	defer cancel()
+
+	rows, err := db.pool.QueryContext(ctx,
+		`SELECT `+moderationColumns+moderationFrom+`
+		WHERE `+strings.Join(conds, " AND ")+`
+		ORDER BY p.create_time DESC, p.id`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []ModerationItem{}
+	for rows.Next() {
+		item, err := scanModerationItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		if ipNet != nil {
+			ip := net.ParseIP(item.CreatorIP)
+			if ip == nil || !ipNet.Contains(ip) {
+				continue
+			}
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// PasteBulkApply deletes or expires the pastes with the given IDs, skipping
+// those that may not be changed
+func (db DB) PasteBulkApply(action string, ids []string) (BulkResult, error) {
+	result := BulkResult{Action: action, Matched: len(ids)}
+	if action != BulkDelete && action != BulkExpire {
+		return result, fmt.Errorf("db: unknown bulk action %q", action)
+	}
+
+	for _, id := range ids {
+		var err error
+		if action == BulkDelete {
+			err = db.PasteDelete(id)
+		} else {
+			err = db.pasteExpire(id)
+		}
+		switch {
+		case err == nil:
+			result.Done++
+		case errors.Is(err, ErrLegalHold), errors.Is(err, ErrWORM), errors.Is(err, ErrNotFoundID):
+			result.Skipped++
+		default:
+			result.Failed++
+		}
+	}
+	return result, nil
+}
+
+// pasteExpire makes a paste expire now, if it could be deleted now
+func (db DB) pasteExpire(id string) error {
+	if err := db.checkDelete(id); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	// One second in the past, so it is expired wherever it is checked
+	result, err := db.pool.ExecContext(ctx,
+		`UPDATE pastes SET delete_time = $2 WHERE id = $1`,
+		id, time.Now().Unix()-1,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFoundID
+	}
+	db.cache.invalidate(id)
+	return nil
+}
+
+// PasteContentHash returns the digest of a paste body, empty for pastes
+// created before it was recorded
+func (db DB) PasteContentHash(id string) (string, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	var hash string
+	err := db.pool.QueryRowContext(ctx, `SELECT COALESCE(content_hash, '') FROM pastes WHERE id = $1`, id).Scan(&hash)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFoundID
+	}
+	return hash, err
+}
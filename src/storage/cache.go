@@ -0,0 +1,348 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package storage
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/metric"
+	"github.com/casjay-forks/caspaste/src/redis"
+)
+
+// pasteCacheName labels the paste cache in metrics
+const pasteCacheName = "pastes"
+
+// tierTimeout bounds each call to the shared cache tier, which must never
+// make a read slower than going to the database
+const tierTimeout = 200 * time.Millisecond
+
+// PasteCacheConfig holds the limits of the paste cache
+type PasteCacheConfig struct {
+	// Most pastes kept in memory
+	MaxItems int `json:"max_items"`
+	// Most bytes of paste bodies kept in memory
+	MaxBytes int64 `json:"max_bytes"`
+	// Bigger pastes are not cached
+	MaxPasteSize int `json:"max_paste_size"`
+	// How long a paste is served from cache before it is read again, 0 = until
+	// it is evicted; bounds how stale a paste edited on another replica can be
+	TTL time.Duration `json:"-"`
+}
+
+// CacheTier is a shared cache level behind the in-memory one, e.g. Redis,
+// so replicas share fetched pastes and see each other's invalidations
+type CacheTier interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+}
+
+// PasteCache keeps recently fetched pastes in memory, least recently used
+// first out, so a popular paste is not read from the database on every view
+type PasteCache struct {
+	cfg PasteCacheConfig
+
+	mu      sync.Mutex
+	tier    CacheTier
+	order   *list.List
+	entries map[string]*list.Element
+	bytes   int64
+
+	hits      int64
+	misses    int64
+	evictions int64
+}
+
+type cacheEntry struct {
+	paste Paste
+	size  int64
+	// Zero = kept until evicted
+	expires time.Time
+}
+
+// NewPasteCache creates an empty paste cache
+func NewPasteCache(cfg PasteCacheConfig) *PasteCache {
+	return &PasteCache{
+		cfg:     cfg,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// SetTier adds a shared cache level; nil removes it
+func (c *PasteCache) SetTier(tier CacheTier) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tier = tier
+}
+
+// SetPasteCache caches fetched pastes; without one every read hits the database
+// Call before the DB value is copied into handlers
+func (db *DB) SetPasteCache(c *PasteCache) {
+	db.cache = c
+}
+
+// PasteCache returns the paste cache, or nil
+func (db DB) PasteCache() *PasteCache {
+	return db.cache
+}
+
+// get returns a cached paste that has neither expired nor outlived the TTL
+func (c *PasteCache) get(id string) (Paste, bool) {
+	if c == nil {
+		return Paste{}, false
+	}
+
+	c.mu.Lock()
+	el, ok := c.entries[id]
+	if ok {
+		entry := el.Value.(*cacheEntry)
+		if c.fresh(entry) {
+			c.order.MoveToFront(el)
+			c.hits++
+			c.mu.Unlock()
+			metric.RecordCacheHit(pasteCacheName)
+			return entry.paste, true
+		}
+		c.remove(el)
+	}
+	tier := c.tier
+	c.mu.Unlock()
+
+	if tier != nil {
+		if paste, ok := c.tierGet(tier, id); ok {
+			c.mu.Lock()
+			c.hits++
+			c.add(paste)
+			c.mu.Unlock()
+			c.updateMetrics()
+			metric.RecordCacheHit(pasteCacheName)
+			return paste, true
+		}
+	}
+
+	c.mu.Lock()
+	c.misses++
+	c.mu.Unlock()
+	metric.RecordCacheMiss(pasteCacheName)
+	return Paste{}, false
+}
+
+// stale returns a cached paste that has not expired, even if it outlived
+// the TTL, for when the database cannot be read; only the in-memory level
+// keeps pastes past the TTL
+func (c *PasteCache) stale(id string) (Paste, bool) {
+	if c == nil {
+		return Paste{}, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[id]
+	if !ok {
+		return Paste{}, false
+	}
+	paste := el.Value.(*cacheEntry).paste
+	if paste.DeleteTime > 0 && paste.DeleteTime <= time.Now().Unix() {
+		return Paste{}, false
+	}
+	c.order.MoveToFront(el)
+	c.hits++
+	metric.RecordCacheHit(pasteCacheName)
+	return paste, true
+}
+
+// put caches a paste read from the database
+// One-use pastes are gone after this read and are never cached
+func (c *PasteCache) put(paste Paste) {
+	if c == nil || paste.OneUse || len(paste.Body) > c.cfg.MaxPasteSize {
+		return
+	}
+
+	c.mu.Lock()
+	c.add(paste)
+	tier := c.tier
+	c.mu.Unlock()
+	c.updateMetrics()
+
+	if tier != nil {
+		data, err := json.Marshal(paste)
+		if err != nil {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), tierTimeout)
+		defer cancel()
+		if err := tier.Set(ctx, cacheKey(paste.ID), data, c.ttl(paste)); err != nil {
+			tierError(err)
+		}
+	}
+}
+
+// invalidate drops edited or deleted pastes from every cache level
+func (c *PasteCache) invalidate(ids ...string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	for _, id := range ids {
+		if el, ok := c.entries[id]; ok {
+			c.remove(el)
+		}
+	}
+	tier := c.tier
+	c.mu.Unlock()
+	c.updateMetrics()
+
+	if tier != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), tierTimeout)
+		defer cancel()
+		for _, id := range ids {
+			if err := tier.Delete(ctx, cacheKey(id)); err != nil {
+				tierError(err)
+			}
+		}
+	}
+}
+
+// add stores a paste and evicts the least recently used ones over the limits
+// c.mu must be held
+func (c *PasteCache) add(paste Paste) {
+	if el, ok := c.entries[paste.ID]; ok {
+		c.remove(el)
+	}
+
+	entry := &cacheEntry{
+		paste: paste,
+		size:  int64(len(paste.Body) + len(paste.Title)),
+	}
+	if ttl := c.ttl(paste); ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+	c.entries[paste.ID] = c.order.PushFront(entry)
+	c.bytes += entry.size
+
+	evicted := 0
+	for (c.cfg.MaxItems > 0 && c.order.Len() > c.cfg.MaxItems) || (c.cfg.MaxBytes > 0 && c.bytes > c.cfg.MaxBytes) {
+		c.remove(c.order.Back())
+		c.evictions++
+		evicted++
+	}
+	if evicted > 0 {
+		metric.RecordCacheEvictions(pasteCacheName, evicted)
+	}
+}
+
+// remove drops an entry; c.mu must be held
+func (c *PasteCache) remove(el *list.Element) {
+	entry := c.order.Remove(el).(*cacheEntry)
+	delete(c.entries, entry.paste.ID)
+	c.bytes -= entry.size
+}
+
+// fresh reports whether an entry may still be served
+func (c *PasteCache) fresh(entry *cacheEntry) bool {
+	now := time.Now()
+	if !entry.expires.IsZero() && now.After(entry.expires) {
+		return false
+	}
+	return entry.paste.DeleteTime == 0 || entry.paste.DeleteTime > now.Unix()
+}
+
+// ttl is the configured TTL, cut short for a paste that expires sooner
+// 0 = no limit
+func (c *PasteCache) ttl(paste Paste) time.Duration {
+	ttl := c.cfg.TTL
+	if paste.DeleteTime > 0 {
+		if left := time.Until(time.Unix(paste.DeleteTime, 0)); ttl == 0 || left < ttl {
+			ttl = max(left, time.Second)
+		}
+	}
+	return ttl
+}
+
+func (c *PasteCache) tierGet(tier CacheTier, id string) (Paste, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), tierTimeout)
+	defer cancel()
+
+	data, ok, err := tier.Get(ctx, cacheKey(id))
+	if err != nil {
+		tierError(err)
+		return Paste{}, false
+	}
+	if !ok {
+		return Paste{}, false
+	}
+	var paste Paste
+	if err := json.Unmarshal(data, &paste); err != nil || paste.ID != id {
+		return Paste{}, false
+	}
+	if paste.DeleteTime > 0 && paste.DeleteTime <= time.Now().Unix() {
+		return Paste{}, false
+	}
+	return paste, true
+}
+
+func (c *PasteCache) updateMetrics() {
+	c.mu.Lock()
+	items, bytes := c.order.Len(), c.bytes
+	c.mu.Unlock()
+	metric.UpdateCacheSize(pasteCacheName, items, bytes)
+}
+
+// tierError logs a failed call to the shared cache tier; the Redis client
+// logs losing its server once, and the in-memory level is used meanwhile
+func tierError(err error) {
+	if !errors.Is(err, redis.ErrUnavailable) {
+		log.Printf("[WARN] storage: paste cache tier: %v", err)
+	}
+}
+
+// cacheKey is the key of a paste in the shared cache tier
+func cacheKey(id string) string {
+	return "caspaste:paste:" + id
+}
+
+// PasteCacheStats is a snapshot of the paste cache
+type PasteCacheStats struct {
+	Config    PasteCacheConfig `json:"config"`
+	TTL       string           `json:"ttl"`
+	Tier      bool             `json:"tier"`
+	Items     int              `json:"items"`
+	Bytes     int64            `json:"bytes"`
+	Hits      int64            `json:"hits"`
+	Misses    int64            `json:"misses"`
+	Evictions int64            `json:"evictions"`
+	HitRate   float64          `json:"hit_rate_percent"`
+}
+
+// Stats returns a snapshot of the cache; counts are since start
+func (c *PasteCache) Stats() PasteCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := PasteCacheStats{
+		Config:    c.cfg,
+		TTL:       c.cfg.TTL.String(),
+		Tier:      c.tier != nil,
+		Items:     c.order.Len(),
+		Bytes:     c.bytes,
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+	}
+	if total := c.hits + c.misses; total > 0 {
+		stats.HitRate = float64(c.hits) * 100 / float64(total)
+	}
+	return stats
+}
@@ -0,0 +1,166 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"log"
+)
+
+// compressBatch is how many pastes CompressBodies reads at a time
+const compressBatch = 100
+
+// ErrNoCompression is returned by CompressBodies when the body policy does
+// not compress
+var ErrNoCompression = errors.New("db: paste body compression is off")
+
+// CompressResult counts what CompressBodies did, or would do
+type CompressResult struct {
+	// Bodies stored in the database that were looked at
+	Checked int64 `json:"checked"`
+	// Bodies compressed with the configured algorithm
+	Compressed int64 `json:"compressed"`
+	// Size of the compressed bodies in the database, before and after
+	BytesBefore int64 `json:"bytes_before"`
+	BytesAfter  int64 `json:"bytes_after"`
+}
+
+// CompressBodies stores the bodies of existing pastes the way the body policy
+// stores new ones: inline bodies, and bodies compressed with the other
+// algorithm, are compressed when they are big enough and it saves enough
+// Blob-stored bodies are left where they are. With dryRun nothing is written
+func (db DB) CompressBodies(dryRun bool) (CompressResult, error) {
+	var result CompressResult
+	p := db.bodies
+	if p == nil || p.cfg.CompressMinSize <= 0 {
+		return result, ErrNoCompression
+	}
+
+	last := ""
+	for {
+		rows, err := db.compressCandidates(last)
+		if err != nil {
+			return result, err
+		}
+		if len(rows) == 0 {
+			return result, nil
+		}
+		last = rows[len(rows)-1].id
+
+		for _, row := range rows {
+			result.Checked++
+			body, err := decompressStored(row.strategy, row.stored)
+			if err != nil {
+				// Left for fsck to report
+				log.Printf("[WARN] storage: paste %s: %v", row.id, err)
+				continue
+			}
+			if len(body) < p.cfg.CompressMinSize {
+				continue
+			}
+			encoded, err := compressBody(p.cfg.Algorithm, body)
+			if err != nil {
+				return result, err
+			}
+			saved := 1 - float64(len(encoded))/float64(len(body))
+			if saved*100 < float64(p.cfg.CompressMinSavings) || len(encoded) >= len(row.stored) {
+				continue
+			}
+
+			if !dryRun {
+				ok, err := db.compressUpdate(row, encoded, p.cfg.Algorithm, len(body))
+				if err != nil {
+					return result, err
+				}
+				if !ok {
+					// Edited or deleted since it was read
+					continue
+				}
+			}
+			result.Compressed++
+			result.BytesBefore += int64(len(row.stored))
+			result.BytesAfter += int64(len(encoded))
+		}
+	}
+}
+
+// compressRow is a paste body as stored in the database
+type compressRow struct {
+	id       string
+	stored   string
+	strategy string
+}
+
+// compressCandidates returns the next pastes after id last whose bodies are
+// in the database and not compressed with the configured algorithm
+func (db DB) compressCandidates(last string) ([]compressRow, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultListTimeout)
+	defer cancel()
+
+	rows, err := db.pool.QueryContext(ctx,
+		`SELECT id, body, COALESCE(body_storage, '') FROM pastes
+		WHERE id > $1 AND COALESCE(body_storage, '') NOT IN ($2, $3)
+		ORDER BY id LIMIT $4`,
+		last, BodyBlob, db.bodies.cfg.Algorithm, compressBatch,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []compressRow
+	for rows.Next() {
+		var row compressRow
+		if err := rows.Scan(&row.id, &row.stored, &row.strategy); err != nil {
+			return nil, err
+		}
+		list = append(list, row)
+	}
+	return list, rows.Err()
+}
+
+// compressUpdate replaces a body with its compressed form, unless the paste
+// changed since it was read; it reports whether the row was replaced
+func (db DB) compressUpdate(row compressRow, encoded, strategy string, size int) (bool, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	result, err := db.pool.ExecContext(ctx,
+		`UPDATE pastes SET body = $2, body_storage = $3, body_size = $4
+		WHERE id = $1 AND COALESCE(body_storage, '') = $5 AND body = $6`,
+		row.id, encoded, strategy, size, row.strategy, row.stored,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil || n == 0 {
+		return false, err
+	}
+	db.cache.invalidate(row.id)
+
+	if db.backupPool != nil {
+		backupCtx, backupCancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+		defer backupCancel()
+		_, backupErr := db.backupPool.ExecContext(backupCtx,
+			`UPDATE pastes SET body = ?, body_storage = ?, body_size = ? WHERE id = ?`,
+			encoded, strategy, size, row.id,
+		)
+		if backupErr != nil {
+			log.Printf("[WARN] storage: backup update failed for paste %s: %v", row.id, backupErr)
+		}
+	}
+	return true, nil
+}
+
+// decompressStored returns the body of an inline or compressed paste
+func decompressStored(strategy, stored string) (string, error) {
+	if strategy == "" || strategy == BodyInline {
+		return stored, nil
+	}
+	return decompressBody(strategy, stored)
+}
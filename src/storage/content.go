@@ -0,0 +1,97 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrContentRevisionNotFound = errors.New("db: content revision not found")
+
+// ContentRevision is a saved version of an about, rules or terms page
+type ContentRevision struct {
+	Page      string `json:"page"`
+	Revision  int64  `json:"revision"`
+	Body      string `json:"body,omitempty"`
+	Markdown  bool   `json:"markdown"`
+	Author    string `json:"author"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// ContentRevisionAdd stores a new revision of a page and returns it
+func (db DB) ContentRevisionAdd(page, body string, markdown bool, author string) (ContentRevision, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	r := ContentRevision{
+		Page:      page,
+		Body:      body,
+		Markdown:  markdown,
+		Author:    author,
+		CreatedAt: time.Now().Unix(),
+	}
+	err := db.pool.QueryRowContext(ctx,
+		`SELECT COALESCE(MAX(revision), 0) + 1 FROM content_revisions WHERE page = $1`,
+		page,
+	).Scan(&r.Revision)
+	if err != nil {
+		return r, err
+	}
+
+	_, err = db.pool.ExecContext(ctx,
+		`INSERT INTO content_revisions (page, revision, body, markdown, author, created_at) VALUES ($1, $2, $3, $4, $5, $6)`,
+		r.Page, r.Revision, r.Body, r.Markdown, r.Author, r.CreatedAt,
+	)
+	return r, err
+}
+
+// ContentRevisionList returns the newest revisions of a page without their bodies
+func (db DB) ContentRevisionList(page string, limit int) ([]ContentRevision, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultListTimeout)
+	defer cancel()
+
+	rows, err := db.pool.QueryContext(ctx,
+		`SELECT page, revision, markdown, author, created_at FROM content_revisions WHERE page = $1 ORDER BY revision DESC LIMIT $2`,
+		page, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []ContentRevision{}
+	for rows.Next() {
+		var r ContentRevision
+		if err := rows.Scan(&r.Page, &r.Revision, &r.Markdown, &r.Author, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, r)
+	}
+	return revisions, rows.Err()
+}
+
+// ContentRevisionGet returns one revision of a page
+func (db DB) ContentRevisionGet(page string, revision int64) (ContentRevision, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	var r ContentRevision
+	err := db.pool.QueryRowContext(ctx,
+		`SELECT page, revision, body, markdown, author, created_at FROM content_revisions WHERE page = $1 AND revision = $2`,
+		page, revision,
+	).Scan(&r.Page, &r.Revision, &r.Body, &r.Markdown, &r.Author, &r.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return r, ErrContentRevisionNotFound
+		}
+		return r, err
+	}
+	return r, nil
+}
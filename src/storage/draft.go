@@ -0,0 +1,141 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"time"
+)
+
+// MaxDrafts is the number of drafts kept per user
+const MaxDrafts = 50
+
+var (
+	ErrDraftNotFound = errors.New("db: draft not found")
+	ErrDraftID       = errors.New("db: draft id must be 1-64 characters of a-z, A-Z, 0-9, '-' or '_'")
+	ErrDraftLimit    = errors.New("db: too many drafts")
+)
+
+var draftIDRegex = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Draft is an unsubmitted paste autosaved from the create page
+// The ID is chosen by the browser tab that owns the draft
+type Draft struct {
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	Body      string `json:"body"`
+	Syntax    string `json:"syntax"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+// ValidDraftID reports whether id can be used as a draft ID
+func ValidDraftID(id string) bool {
+	return draftIDRegex.MatchString(id)
+}
+
+// DraftList returns the drafts of a user, most recently updated first
+func (db DB) DraftList(owner string) ([]Draft, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultListTimeout)
+	defer cancel()
+
+	rows, err := db.pool.QueryContext(ctx,
+		`SELECT id, title, body, syntax, updated_at FROM paste_drafts WHERE owner = $1 ORDER BY updated_at DESC`,
+		owner,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	drafts := []Draft{}
+	for rows.Next() {
+		var d Draft
+		if err := rows.Scan(&d.ID, &d.Title, &d.Body, &d.Syntax, &d.UpdatedAt); err != nil {
+			return nil, err
+		}
+		drafts = append(drafts, d)
+	}
+	return drafts, rows.Err()
+}
+
+// DraftGet returns one draft of a user
+func (db DB) DraftGet(owner, id string) (Draft, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	var d Draft
+	err := db.pool.QueryRowContext(ctx,
+		`SELECT id, title, body, syntax, updated_at FROM paste_drafts WHERE owner = $1 AND id = $2`,
+		owner, id,
+	).Scan(&d.ID, &d.Title, &d.Body, &d.Syntax, &d.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return d, ErrDraftNotFound
+		}
+		return d, err
+	}
+	return d, nil
+}
+
+// DraftSave creates or replaces a draft and returns it with the new update time
+func (db DB) DraftSave(owner string, d Draft) (Draft, error) {
+	if !ValidDraftID(d.ID) {
+		return d, ErrDraftID
+	}
+
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	d.UpdatedAt = time.Now().Unix()
+	result, err := db.pool.ExecContext(ctx,
+		`UPDATE paste_drafts SET title = $3, body = $4, syntax = $5, updated_at = $6 WHERE owner = $1 AND id = $2`,
+		owner, d.ID, d.Title, d.Body, d.Syntax, d.UpdatedAt,
+	)
+	if err != nil {
+		return d, err
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected > 0 {
+		return d, err
+	}
+
+	var count int
+	err = db.pool.QueryRowContext(ctx, `SELECT COUNT(*) FROM paste_drafts WHERE owner = $1`, owner).Scan(&count)
+	if err != nil {
+		return d, err
+	}
+	if count >= MaxDrafts {
+		return d, ErrDraftLimit
+	}
+
+	_, err = db.pool.ExecContext(ctx,
+		`INSERT INTO paste_drafts (owner, id, title, body, syntax, updated_at) VALUES ($1, $2, $3, $4, $5, $6)`,
+		owner, d.ID, d.Title, d.Body, d.Syntax, d.UpdatedAt,
+	)
+	return d, err
+}
+
+// DraftDelete removes a draft of a user
+func (db DB) DraftDelete(owner, id string) error {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	result, err := db.pool.ExecContext(ctx, `DELETE FROM paste_drafts WHERE owner = $1 AND id = $2`, owner, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrDraftNotFound
+	}
+	return nil
+}
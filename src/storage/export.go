@@ -0,0 +1,444 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/org"
+	"github.com/casjay-forks/caspaste/src/user"
+)
+
+// Logical export, see docs/admin.md "Export and Import"
+// An export is a stream of records that does not depend on the database
+// driver: a header, then users and organizations when asked for, then every
+// paste that has not expired, with its body decoded, its tags and fork link
+// Accounts keep their password hashes but not their two-factor secrets,
+// which are encrypted with the key of the instance they come from
+
+// ExportFormat names the format in the header of an export
+const ExportFormat = "caspaste-export"
+
+// ExportVersion is the version of the format written; imports read it and
+// older versions
+const ExportVersion = 1
+
+// Record types of an export
+const (
+	ExportHeaderRecord = "header"
+	ExportUserRecord   = "user"
+	ExportOrgRecord    = "org"
+	ExportPasteRecord  = "paste"
+)
+
+var ErrExportFormat = errors.New("storage: not a CasPaste export, or one from a newer version")
+
+// ExportRecord is one line of an export; the field named by Type is set
+type ExportRecord struct {
+	Type   string        `json:"type"`
+	Header *ExportHeader `json:"header,omitempty"`
+	User   *ExportUser   `json:"user,omitempty"`
+	Org    *ExportOrg    `json:"org,omitempty"`
+	Paste  *ExportPaste  `json:"paste,omitempty"`
+}
+
+// ExportHeader is the first record of an export
+type ExportHeader struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+	Created int64  `json:"created"`
+	// Database driver the export was made from, for information only
+	Driver   string `json:"driver"`
+	Accounts bool   `json:"accounts"`
+}
+
+// ExportUser is a user account; users are matched by username on import
+type ExportUser struct {
+	Username      string `json:"username"`
+	Email         string `json:"email"`
+	PasswordHash  string `json:"passwordHash"`
+	DisplayName   string `json:"displayName,omitempty"`
+	Role          string `json:"role"`
+	EmailVerified bool   `json:"emailVerified"`
+	CreatedAt     int64  `json:"createdAt"`
+}
+
+// ExportOrg is an organization with its members, by username; organizations
+// are matched by name on import
+type ExportOrg struct {
+	Slug        string         `json:"slug"`
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Website     string         `json:"website,omitempty"`
+	Location    string         `json:"location,omitempty"`
+	Visibility  string         `json:"visibility"`
+	Owner       string         `json:"owner"`
+	Members     []ExportMember `json:"members,omitempty"`
+	CreatedAt   int64          `json:"createdAt"`
+}
+
+// ExportMember is a member of an exported organization
+type ExportMember struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+// ExportPaste is a paste with its body decoded
+type ExportPaste struct {
+	Paste
+	// "user:{username}" or "org:{name}"; only set when accounts are exported
+	Owner string `json:"owner,omitempty"`
+}
+
+// Export calls fn with each record of an export of the database, the header
+// first; accounts adds users and organizations
+func (db DB) Export(accounts bool, fn func(ExportRecord) error) error {
+	header := &ExportHeader{
+		Format:   ExportFormat,
+		Version:  ExportVersion,
+		Created:  time.Now().Unix(),
+		Driver:   db.driver,
+		Accounts: accounts,
+	}
+	if err := fn(ExportRecord{Type: ExportHeaderRecord, Header: header}); err != nil {
+		return err
+	}
+
+	// Owners of pastes are exported by name, as IDs differ between databases
+	usernames := make(map[int64]string)
+	slugs := make(map[int64]string)
+	if accounts {
+		ctx, cancel := context.WithTimeout(db.context(), migrationTimeout)
+		defer cancel()
+
+		users, err := db.Users().List(ctx)
+		if err != nil {
+			return err
+		}
+		for _, u := range users {
+			usernames[u.ID] = u.Username
+			rec := &ExportUser{
+				Username:      u.Username,
+				Email:         u.Email,
+				PasswordHash:  u.PasswordHash,
+				DisplayName:   u.DisplayName,
+				Role:          u.Role,
+				EmailVerified: u.EmailVerified,
+				CreatedAt:     u.CreatedAt,
+			}
+			if err := fn(ExportRecord{Type: ExportUserRecord, User: rec}); err != nil {
+				return err
+			}
+		}
+
+		orgs, err := db.Orgs().List(ctx)
+		if err != nil {
+			return err
+		}
+		for _, o := range orgs {
+			slugs[o.ID] = o.Slug
+			members, err := db.Orgs().Members(ctx, o.ID)
+			if err != nil {
+				return err
+			}
+			rec := &ExportOrg{
+				Slug:        o.Slug,
+				Name:        o.Name,
+				Description: o.Description,
+				Website:     o.Website,
+				Location:    o.Location,
+				Visibility:  o.Visibility,
+				Owner:       usernames[o.OwnerID],
+				CreatedAt:   o.CreatedAt,
+			}
+			for _, m := range members {
+				if m.UserID != o.OwnerID {
+					rec.Members = append(rec.Members, ExportMember{Username: m.Username, Role: m.Role})
+				}
+			}
+			if err := fn(ExportRecord{Type: ExportOrgRecord, Org: rec}); err != nil {
+				return err
+			}
+		}
+	}
+
+	owned, err := db.exportPasteIDs()
+	if err != nil {
+		return err
+	}
+	for _, p := range owned {
+		paste, err := db.PasteGet(p.id)
+		// Expired since it was listed
+		if err == ErrNotFoundID {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		rec := &ExportPaste{Paste: paste}
+		if name, ok := usernames[p.owner.UserID]; ok {
+			rec.Owner = "user:" + name
+		} else if name, ok := slugs[p.owner.OrgID]; ok {
+			rec.Owner = "org:" + name
+		}
+		if err := fn(ExportRecord{Type: ExportPasteRecord, Paste: rec}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type exportPasteID struct {
+	id    string
+	owner PasteOwner
+}
+
+// exportPasteIDs lists the pastes to export, oldest first so a fork comes
+// after its parent; read up front, as the pool may have one connection
+func (db DB) exportPasteIDs() ([]exportPasteID, error) {
+	ctx, cancel := context.WithTimeout(db.context(), migrationTimeout)
+	defer cancel()
+
+	rows, err := db.pool.QueryContext(ctx,
+		`SELECT id, COALESCE(user_id, 0), COALESCE(org_id, 0) FROM pastes
+		WHERE delete_time = 0 OR delete_time > $1
+		OR id IN (SELECT paste_id FROM paste_pins WHERE keep_after_expiry = $2)
+		ORDER BY create_time, id`,
+		time.Now().Unix(), true,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []exportPasteID
+	for rows.Next() {
+		var p exportPasteID
+		if err := rows.Scan(&p.id, &p.owner.UserID, &p.owner.OrgID); err != nil {
+			return nil, err
+		}
+		ids = append(ids, p)
+	}
+	return ids, rows.Err()
+}
+
+// ImportStats counts what an import added, and what was already there
+type ImportStats struct {
+	Users   int
+	Orgs    int
+	Pastes  int
+	Skipped int
+}
+
+// Importer adds the records of an export to the database, in the order
+// they were exported; a paste whose ID, a user whose username or an
+// organization whose name is already taken is skipped
+type Importer struct {
+	db     DB
+	dryRun bool
+	header bool
+	Stats  ImportStats
+
+	// IDs in this database by lowercase name; 0 for one a dry run would add
+	users map[string]int64
+	orgs  map[string]int64
+}
+
+// NewImporter returns an Importer; a dry run counts what would be imported
+// and changes nothing
+func (db DB) NewImporter(dryRun bool) *Importer {
+	return &Importer{
+		db:     db,
+		dryRun: dryRun,
+		users:  make(map[string]int64),
+		orgs:   make(map[string]int64),
+	}
+}
+
+// Add imports one record; the first must be the header
+func (im *Importer) Add(rec ExportRecord) error {
+	if !im.header {
+		if rec.Type != ExportHeaderRecord || rec.Header == nil ||
+			rec.Header.Format != ExportFormat || rec.Header.Version > ExportVersion {
+			return ErrExportFormat
+		}
+		im.header = true
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(im.db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	switch {
+	case rec.Type == ExportUserRecord && rec.User != nil:
+		return im.addUser(ctx, rec.User)
+	case rec.Type == ExportOrgRecord && rec.Org != nil:
+		return im.addOrg(ctx, rec.Org)
+	case rec.Type == ExportPasteRecord && rec.Paste != nil:
+		return im.addPaste(ctx, rec.Paste)
+	}
+	return ErrExportFormat
+}
+
+func (im *Importer) addUser(ctx context.Context, rec *ExportUser) error {
+	key := strings.ToLower(rec.Username)
+	existing, err := im.db.Users().GetByUsername(ctx, rec.Username)
+	if err == nil {
+		im.users[key] = existing.ID
+		im.Stats.Skipped++
+		return nil
+	}
+	if err != user.ErrUserNotFound {
+		return err
+	}
+	im.Stats.Users++
+	if im.dryRun {
+		im.users[key] = 0
+		return nil
+	}
+
+	u := &user.User{
+		Username:     rec.Username,
+		Email:        rec.Email,
+		PasswordHash: rec.PasswordHash,
+		DisplayName:  rec.DisplayName,
+		Role:         rec.Role,
+		CreatedAt:    rec.CreatedAt,
+		UpdatedAt:    time.Now().Unix(),
+	}
+	id, err := im.db.Users().Insert(ctx, u)
+	if err != nil {
+		return err
+	}
+	im.users[key] = id
+	if rec.EmailVerified {
+		return im.db.Users().SetEmailVerified(ctx, id, true)
+	}
+	return nil
+}
+
+// userID returns the ID here of a username, and whether it is known
+func (im *Importer) userID(ctx context.Context, username string) (int64, bool, error) {
+	if id, ok := im.users[strings.ToLower(username)]; ok {
+		return id, true, nil
+	}
+	u, err := im.db.Users().GetByUsername(ctx, username)
+	if err == user.ErrUserNotFound {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	im.users[strings.ToLower(username)] = u.ID
+	return u.ID, true, nil
+}
+
+func (im *Importer) addOrg(ctx context.Context, rec *ExportOrg) error {
+	key := strings.ToLower(rec.Slug)
+	existing, err := im.db.Orgs().GetBySlug(ctx, rec.Slug)
+	if err == nil {
+		im.orgs[key] = existing.ID
+		im.Stats.Skipped++
+		return nil
+	}
+	if err != org.ErrOrgNotFound {
+		return err
+	}
+	// An organization cannot be without its owner
+	ownerID, ok, err := im.userID(ctx, rec.Owner)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		im.Stats.Skipped++
+		return nil
+	}
+	im.Stats.Orgs++
+	if im.dryRun {
+		im.orgs[key] = 0
+		return nil
+	}
+
+	o := &org.Org{
+		Slug:        rec.Slug,
+		Name:        rec.Name,
+		Description: rec.Description,
+		Website:     rec.Website,
+		Location:    rec.Location,
+		Visibility:  rec.Visibility,
+		OwnerID:     ownerID,
+		CreatedAt:   rec.CreatedAt,
+		UpdatedAt:   time.Now().Unix(),
+	}
+	id, err := im.db.Orgs().Insert(ctx, o)
+	if err != nil {
+		return err
+	}
+	im.orgs[key] = id
+
+	for _, m := range rec.Members {
+		userID, ok, err := im.userID(ctx, m.Username)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		member := &org.OrgMember{OrgID: id, UserID: userID, Role: m.Role, CreatedAt: o.CreatedAt}
+		if err := im.db.Orgs().AddMember(ctx, member); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (im *Importer) addPaste(ctx context.Context, rec *ExportPaste) error {
+	var exists int
+	err := im.db.pool.QueryRowContext(ctx, `SELECT COUNT(*) FROM pastes WHERE id = $1`, rec.ID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists > 0 || rec.ID == "" {
+		im.Stats.Skipped++
+		return nil
+	}
+	im.Stats.Pastes++
+	if im.dryRun {
+		return nil
+	}
+
+	paste := rec.Paste
+	paste.Tags, err = NormalizeTags(paste.Tags)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	body, strategy, err := im.db.bodies.encode(ctx, paste)
+	if err != nil {
+		return err
+	}
+	if err := im.db.pasteInsert(ctx, paste, body, strategy, len(paste.Body), start); err != nil {
+		return err
+	}
+
+	// Owners that were not imported leave the paste without one
+	kind, name, _ := strings.Cut(rec.Owner, ":")
+	var owner PasteOwner
+	switch kind {
+	case "user":
+		owner.UserID, _, err = im.userID(ctx, name)
+	case "org":
+		owner.OrgID = im.orgs[strings.ToLower(name)]
+	}
+	if err != nil || owner == (PasteOwner{}) {
+		return err
+	}
+	return im.db.PasteOwnerSet(paste.ID, owner)
+}
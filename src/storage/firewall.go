@@ -0,0 +1,123 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrIPBanNotFound = errors.New("db: IP ban not found")
+
+// IPBan bans an IP address or CIDR network from the whole server
+// Times are unix seconds; ExpiresAt is 0 for a ban without an end
+type IPBan struct {
+	ID string `json:"id"`
+	// Canonical IP address or CIDR network, e.g. 203.0.113.7 or 10.0.0.0/8
+	Network string `json:"network"`
+	Reason  string `json:"reason"`
+	// "admin" or "auto" (repeated rate limit violations)
+	Source    string `json:"source"`
+	CreatedBy string `json:"created_by"`
+	CreatedAt int64  `json:"created_at"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+const ipBanColumns = `id, network, reason, source, created_by, created_at, expires_at`
+
+func scanIPBan(row interface{ Scan(...any) error }) (IPBan, error) {
+	var b IPBan
+	err := row.Scan(&b.ID, &b.Network, &b.Reason, &b.Source, &b.CreatedBy, &b.CreatedAt, &b.ExpiresAt)
+	return b, err
+}
+
+// IPBanList returns the bans that have not expired, newest first
+func (db DB) IPBanList() ([]IPBan, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultListTimeout)
+	defer cancel()
+
+	rows, err := db.pool.QueryContext(ctx,
+		`SELECT `+ipBanColumns+` FROM ip_bans WHERE expires_at = 0 OR expires_at > $1 ORDER BY created_at DESC`,
+		time.Now().Unix(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bans := []IPBan{}
+	for rows.Next() {
+		b, err := scanIPBan(rows)
+		if err != nil {
+			return nil, err
+		}
+		bans = append(bans, b)
+	}
+	return bans, rows.Err()
+}
+
+// IPBanGet returns a ban by ID
+func (db DB) IPBanGet(id string) (IPBan, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	b, err := scanIPBan(db.pool.QueryRowContext(ctx,
+		`SELECT `+ipBanColumns+` FROM ip_bans WHERE id = $1`, id,
+	))
+	if err == sql.ErrNoRows {
+		return b, ErrIPBanNotFound
+	}
+	return b, err
+}
+
+// IPBanAdd stores a new ban and returns it with its ID
+func (db DB) IPBanAdd(b IPBan) (IPBan, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	var err error
+	b.ID, err = genTokenCrypto(8)
+	if err != nil {
+		return b, err
+	}
+	b.CreatedAt = time.Now().Unix()
+
+	_, err = db.pool.ExecContext(ctx,
+		`INSERT INTO ip_bans (`+ipBanColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		b.ID, b.Network, b.Reason, b.Source, b.CreatedBy, b.CreatedAt, b.ExpiresAt,
+	)
+	return b, err
+}
+
+// IPBanUpdate changes the reason and end time of a ban
+func (db DB) IPBanUpdate(id, reason string, expiresAt int64) error {
+	return db.ipBanExec(`UPDATE ip_bans SET reason = $2, expires_at = $3 WHERE id = $1`, id, reason, expiresAt)
+}
+
+// IPBanDelete lifts a ban
+func (db DB) IPBanDelete(id string) error {
+	return db.ipBanExec(`DELETE FROM ip_bans WHERE id = $1`, id)
+}
+
+func (db DB) ipBanExec(query string, args ...any) error {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	result, err := db.pool.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrIPBanNotFound
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package storage
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Forks are copies of a paste that link back to it
+// The link is kept when the parent is deleted, so a fork still names the
+// paste it came from; it goes when the fork itself is deleted
+
+// pasteForkAdd records that a new paste was forked from parentID
+func (db DB) pasteForkAdd(ctx context.Context, id, parentID string) error {
+	_, err := db.pool.ExecContext(ctx, `INSERT INTO paste_forks (paste_id, parent_id) VALUES ($1, $2)`, id, parentID)
+	if err != nil {
+		return err
+	}
+	// The cached parent has the old fork count
+	db.cache.invalidate(parentID)
+	return nil
+}
+
+// pasteForkInfo returns the paste a paste was forked from ("" if none) and
+// its number of forks
+func (db DB) pasteForkInfo(ctx context.Context, id string) (string, int, error) {
+	var parentID string
+	err := db.pool.QueryRowContext(ctx, `SELECT parent_id FROM paste_forks WHERE paste_id = $1`, id).Scan(&parentID)
+	if err != nil && err != sql.ErrNoRows {
+		return "", 0, err
+	}
+
+	var forks int
+	err = db.pool.QueryRowContext(ctx, `SELECT COUNT(*) FROM paste_forks WHERE parent_id = $1`, id).Scan(&forks)
+	if err != nil {
+		return "", 0, err
+	}
+	return parentID, forks, nil
+}
+
+// pasteForkDelete drops the link of a deleted paste to its parent
+func (db DB) pasteForkDelete(ctx context.Context, id string) error {
+	var parentID string
+	err := db.pool.QueryRowContext(ctx, `SELECT parent_id FROM paste_forks WHERE paste_id = $1`, id).Scan(&parentID)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if _, err := db.pool.ExecContext(ctx, `DELETE FROM paste_forks WHERE paste_id = $1`, id); err != nil {
+		return err
+	}
+	db.cache.invalidate(parentID)
+	return nil
+}
+
+// pasteForksCleanup removes the links of forks that no longer exist
+func (db DB) pasteForksCleanup(ctx context.Context) error {
+	_, err := db.pool.ExecContext(ctx, `DELETE FROM paste_forks WHERE paste_id NOT IN (SELECT id FROM pastes)`)
+	return err
+}
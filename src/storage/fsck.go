@@ -0,0 +1,376 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/blob"
+)
+
+// Fsck checks the database for rows that refer to missing pastes, users,
+// orgs and domains, paste bodies that cannot be read back as written, and
+// pastes that break the expiry rules
+// Each problem says what FsckRepair would do about it; problems without a
+// repair need a person (e.g. restoring a lost blob from a backup)
+
+// Fsck check names
+const (
+	FsckReferences = "references"
+	FsckBodies     = "bodies"
+	FsckExpiry     = "expiry"
+)
+
+// fsckExpiryGrace is how long an expired paste may wait for the cleanup job
+// before it is reported
+const fsckExpiryGrace = time.Hour
+
+// FsckIssue is a problem found by Fsck
+type FsckIssue struct {
+	Check   string `json:"check"`
+	Item    string `json:"item"`
+	Problem string `json:"problem"`
+	// What FsckRepair does about it; "" when it cannot be repaired
+	Repair string `json:"repair,omitempty"`
+
+	fix func(ctx context.Context) error
+}
+
+// FsckReport is the result of Fsck
+type FsckReport struct {
+	Pastes int64       `json:"pastes"`
+	Issues []FsckIssue `json:"issues"`
+}
+
+// Repairable counts the issues FsckRepair can fix
+func (r FsckReport) Repairable() int {
+	n := 0
+	for _, issue := range r.Issues {
+		if issue.fix != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// fsckRef selects rows of a table that refer to something missing
+type fsckRef struct {
+	table   string
+	where   string
+	missing string
+	// "delete" removes the rows, "null" clears column, "" reports only
+	repair string
+	column string
+}
+
+func fsckRefs() []fsckRef {
+	missing := func(column, table string) string {
+		return column + ` IS NOT NULL AND ` + column + ` NOT IN (SELECT id FROM ` + table + `)`
+	}
+	return []fsckRef{
+		{"paste_tags", missing("paste_id", "pastes"), "pastes", "delete", ""},
+		{"paste_forks", missing("paste_id", "pastes"), "pastes", "delete", ""},
+		{"paste_pins", missing("paste_id", "pastes"), "pastes", "delete", ""},
+		{"paste_legal_holds", missing("paste_id", "pastes"), "pastes", "", ""},
+		{"paste_freezes", missing("paste_id", "pastes"), "pastes", "delete", ""},
+		{"paste_series_parts", missing("paste_id", "pastes"), "pastes", "delete", ""},
+		{"share_links", missing("paste_id", "pastes"), "pastes", "delete", ""},
+		{"paste_signatures", missing("paste_id", "pastes"), "pastes", "delete", ""},
+		{"pastes", missing("user_id", "users"), "users", "null", "user_id"},
+		{"pastes", missing("org_id", "orgs"), "orgs", "null", "org_id"},
+		{"user_sessions", missing("user_id", "users"), "users", "delete", ""},
+		{"user_tokens", missing("user_id", "users"), "users", "delete", ""},
+		{"recovery_keys", missing("user_id", "users"), "users", "delete", ""},
+		{"password_resets", missing("user_id", "users"), "users", "delete", ""},
+		{"email_verifications", missing("user_id", "users"), "users", "delete", ""},
+		{"user_preferences", missing("user_id", "users"), "users", "delete", ""},
+		{"orgs", missing("owner_id", "users"), "users", "", ""},
+		{"org_members", missing("user_id", "users"), "users", "delete", ""},
+		{"org_members", missing("org_id", "orgs"), "orgs", "delete", ""},
+		{"org_tokens", missing("org_id", "orgs"), "orgs", "delete", ""},
+		{"org_preferences", missing("org_id", "orgs"), "orgs", "delete", ""},
+		{"custom_domains", `owner_type = 'user' AND ` + missing("owner_id", "users"), "users", "", ""},
+		{"custom_domains", `owner_type = 'org' AND ` + missing("owner_id", "orgs"), "orgs", "", ""},
+		{"custom_domain_subdomains", missing("domain_id", "custom_domains"), "domains", "delete", ""},
+		{"custom_domain_subdomains", missing("user_id", "users"), "users", "delete", ""},
+		{"custom_domain_audit", missing("domain_id", "custom_domains"), "domains", "delete", ""},
+		{"oauth_clients", missing("owner_id", "users"), "users", "delete", ""},
+		{"oauth_codes", missing("user_id", "users"), "users", "delete", ""},
+		{"oauth_tokens", missing("user_id", "users"), "users", "delete", ""},
+	}
+}
+
+// Fsck checks the database and the blob store and reports what it found
+func (db DB) Fsck() (FsckReport, error) {
+	var report FsckReport
+
+	ctx, cancel := context.WithTimeout(db.context(), defaultBatchTimeout)
+	defer cancel()
+
+	for _, ref := range fsckRefs() {
+		var count int64
+		err := db.pool.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+ref.table+` WHERE `+ref.where).Scan(&count)
+		if err != nil {
+			return report, err
+		}
+		if count == 0 {
+			continue
+		}
+
+		issue := FsckIssue{
+			Check:   FsckReferences,
+			Item:    ref.table,
+			Problem: fmt.Sprintf("%d rows refer to missing %s", count, ref.missing),
+		}
+		switch ref.repair {
+		case "delete":
+			issue.Repair = "delete the rows"
+			issue.fix = func(ctx context.Context) error {
+				_, err := db.pool.ExecContext(ctx, `DELETE FROM `+ref.table+` WHERE `+ref.where)
+				return err
+			}
+		case "null":
+			issue.Repair = "clear " + ref.column
+			issue.fix = func(ctx context.Context) error {
+				_, err := db.pool.ExecContext(ctx, `UPDATE `+ref.table+` SET `+ref.column+` = NULL WHERE `+ref.where)
+				return err
+			}
+		}
+		report.Issues = append(report.Issues, issue)
+	}
+
+	// Bodies are read one by one, so this gets its own time limit
+	pastes, bodyIssues, err := db.fsckBodies()
+	if err != nil {
+		return report, err
+	}
+	report.Pastes = pastes
+	report.Issues = append(report.Issues, bodyIssues...)
+
+	expiryIssues, err := db.fsckExpiry(ctx)
+	if err != nil {
+		return report, err
+	}
+	report.Issues = append(report.Issues, expiryIssues...)
+
+	return report, nil
+}
+
+// fsckBodies reads every paste body back and checks it against its recorded
+// size and, for blobs, checksum
+func (db DB) fsckBodies() (int64, []FsckIssue, error) {
+	ctx := db.context()
+
+	rows, err := db.pool.QueryContext(ctx,
+		`SELECT id, body, COALESCE(body_storage, ''), COALESCE(body_size, 0) FROM pastes ORDER BY id`,
+	)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer rows.Close()
+
+	var checked int64
+	var issues []FsckIssue
+	for rows.Next() {
+		var id, stored, strategy string
+		var size int
+		if err := rows.Scan(&id, &stored, &strategy, &size); err != nil {
+			return checked, nil, err
+		}
+		checked++
+
+		issue := FsckIssue{Check: FsckBodies, Item: "paste " + id}
+		var body string
+		switch strategy {
+		case "", BodyInline:
+			body = stored
+		case BodyZstd, BodyGzip:
+			body, err = decompressBody(strategy, stored)
+			if err != nil {
+				issue.Problem = "compressed body cannot be read: " + err.Error()
+				issues = append(issues, issue)
+				continue
+			}
+		case BodyBlob:
+			if db.bodies == nil || db.bodies.blobs == nil {
+				issue.Problem = "body is in the blob store, which is not configured"
+				issues = append(issues, issue)
+				continue
+			}
+			data, err := db.bodies.blobs.Get(ctx, blobKey(id))
+			if errors.Is(err, blob.ErrNotFound) {
+				issue.Problem = "body is missing from the blob store"
+				issues = append(issues, issue)
+				continue
+			} else if err != nil {
+				return checked, nil, err
+			}
+			body = string(data)
+
+			digest := bodyDigest(body)
+			if stored == "" {
+				// Stored before checksums were kept
+				issue.Problem = "blob has no recorded checksum"
+				issue.Repair = "record the checksum of the blob"
+				issue.fix = func(ctx context.Context) error {
+					_, err := db.pool.ExecContext(ctx, `UPDATE pastes SET body = $2 WHERE id = $1 AND body = ''`, id, digest)
+					return err
+				}
+				issues = append(issues, issue)
+				continue
+			}
+			if stored != digest {
+				issue.Problem = "blob does not match its checksum"
+				issues = append(issues, issue)
+				continue
+			}
+		default:
+			issue.Problem = fmt.Sprintf("unknown body storage %q", strategy)
+			issues = append(issues, issue)
+			continue
+		}
+
+		// Pastes from before body_size existed have 0
+		if size > 0 && len(body) != size {
+			// The body read back is what readers get, so the size is what is wrong
+			issue.Problem = fmt.Sprintf("body is %d bytes, %d recorded", len(body), size)
+			actual := len(body)
+			issue.Repair = "record the actual size"
+			issue.fix = func(ctx context.Context) error {
+				_, err := db.pool.ExecContext(ctx, `UPDATE pastes SET body_size = $2 WHERE id = $1`, id, actual)
+				db.cache.invalidate(id)
+				return err
+			}
+			issues = append(issues, issue)
+		}
+	}
+	return checked, issues, rows.Err()
+}
+
+// PasteBodyIntact reports whether a body returned by PasteGet matches the
+// checksum recorded when it was stored in the blob store; bodies stored
+// without one (inline, compressed and older blobs) count as intact
+func (db DB) PasteBodyIntact(paste Paste) (bool, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	var digest string
+	err := db.pool.QueryRowContext(ctx,
+		`SELECT CASE WHEN body_storage = $2 THEN body ELSE '' END FROM pastes WHERE id = $1`,
+		paste.ID, BodyBlob,
+	).Scan(&digest)
+	if err == sql.ErrNoRows {
+		return false, ErrNotFoundID
+	} else if err != nil {
+		return false, err
+	}
+	return digest == "" || digest == bodyDigest(paste.Body), nil
+}
+
+// fsckExpiry checks the delete and view counters of pastes
+func (db DB) fsckExpiry(ctx context.Context) ([]FsckIssue, error) {
+	now := time.Now()
+	var issues []FsckIssue
+
+	rows, err := db.pool.QueryContext(ctx,
+		`SELECT id, create_time, delete_time, one_use, COALESCE(max_views, 0), COALESCE(views_left, 0) FROM pastes
+		WHERE delete_time < 0 OR (delete_time > 0 AND delete_time < create_time) OR create_time > $1
+		OR (max_views > 0 AND views_left <= 0)
+		ORDER BY id`,
+		now.Add(24*time.Hour).Unix(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var createTime, deleteTime int64
+		var oneUse bool
+		var maxViews, viewsLeft int
+		if err := rows.Scan(&id, &createTime, &deleteTime, &oneUse, &maxViews, &viewsLeft); err != nil {
+			return nil, err
+		}
+
+		issue := FsckIssue{Check: FsckExpiry, Item: "paste " + id}
+		switch {
+		case deleteTime < 0:
+			issue.Problem = fmt.Sprintf("negative delete time %d", deleteTime)
+			issue.Repair = "never expire, as new pastes with a negative delete time do"
+			issue.fix = func(ctx context.Context) error {
+				_, err := db.pool.ExecContext(ctx, `UPDATE pastes SET delete_time = 0 WHERE id = $1`, id)
+				db.cache.invalidate(id)
+				return err
+			}
+		case deleteTime > 0 && deleteTime < createTime:
+			issue.Problem = "expires before it was created"
+		case createTime > now.Unix():
+			issue.Problem = "created in the future, " + time.Unix(createTime, 0).UTC().Format(time.RFC3339)
+		default:
+			// Views are used up, so readers already get 404
+			issue.Problem = fmt.Sprintf("all %d views used but not deleted", maxViews)
+			issue.Repair = "delete the paste"
+			issue.fix = func(ctx context.Context) error {
+				return db.PasteDelete(id)
+			}
+		}
+		issues = append(issues, issue)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	// Expired pastes are deleted by the cleanup job every cleanup_period
+	expired, err := db.PasteListExpired()
+	if err != nil {
+		return nil, err
+	}
+	var overdue []string
+	for _, paste := range expired {
+		if now.Unix()-paste.DeleteTime > int64(fsckExpiryGrace/time.Second) {
+			overdue = append(overdue, paste.ID)
+		}
+	}
+	if len(overdue) > 0 {
+		issues = append(issues, FsckIssue{
+			Check:   FsckExpiry,
+			Item:    "pastes",
+			Problem: fmt.Sprintf("%d pastes expired over %s ago but were not deleted: %s", len(overdue), fsckExpiryGrace, strings.Join(overdue, ", ")),
+			Repair:  "delete expired pastes",
+			fix: func(ctx context.Context) error {
+				_, err := db.PasteDeleteExpired()
+				return err
+			},
+		})
+	}
+	return issues, nil
+}
+
+// FsckRepair fixes the issues of a report that can be fixed and returns how
+// many were; it stops at the first repair that fails
+func (db DB) FsckRepair(report FsckReport) (int, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultBatchTimeout)
+	defer cancel()
+
+	repaired := 0
+	for _, issue := range report.Issues {
+		if issue.fix == nil {
+			continue
+		}
+		if err := issue.fix(ctx); err != nil {
+			return repaired, fmt.Errorf("%s: %w", issue.Item, err)
+		}
+		repaired++
+	}
+	return repaired, nil
+}
@@ -0,0 +1,180 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package storage
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/blob"
+)
+
+// Garbage collection removes data nothing refers to any more: rows left
+// behind by deleted pastes, users and orgs, expired sessions and codes,
+// audit rows past their retention and blobs without a paste
+// Deleting a paste or user already removes most of this; the collector
+// catches what crashes, old versions and SQLite without foreign keys missed
+
+// gcBlobMinAge keeps blobs and unfinished writes this young, since the
+// paste row of a body just written may not be committed yet
+const gcBlobMinAge = time.Hour
+
+// GCOptions controls a garbage collection
+type GCOptions struct {
+	// Count what would be removed without removing it
+	DryRun bool
+	// Domain audit rows older than this are removed (0 = kept)
+	AuditRetention time.Duration
+}
+
+// GCResult is the number of items of one kind found (and removed, unless
+// it was a dry run)
+type GCResult struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+// gcRule selects rows of a table to collect
+type gcRule struct {
+	name  string
+	table string
+	where string
+	args  []any
+}
+
+func gcRules(now, auditCutoff int64) []gcRule {
+	const noPaste = `paste_id NOT IN (SELECT id FROM pastes)`
+	const noUser = `user_id NOT IN (SELECT id FROM users)`
+	const noOrg = `org_id NOT IN (SELECT id FROM orgs)`
+	const noDomain = `domain_id NOT IN (SELECT id FROM custom_domains)`
+
+	rules := []gcRule{
+		{"paste tags of deleted pastes", "paste_tags", noPaste, nil},
+		{"fork links of deleted pastes", "paste_forks", noPaste, nil},
+		{"pins of deleted pastes", "paste_pins", noPaste, nil},
+		{"signatures of deleted pastes", "paste_signatures", noPaste, nil},
+		{"freezes of deleted pastes", "paste_freezes", noPaste, nil},
+		{"series parts of deleted pastes", "paste_series_parts", noPaste, nil},
+		{"series left with no parts", "paste_series", `id NOT IN (SELECT series_id FROM paste_series_parts)`, nil},
+		{"expired share links", "share_links", `expires_at <= $1 OR ` + noPaste, []any{now}},
+		{"expired sessions", "user_sessions", `expires_at <= $1 OR ` + noUser, []any{now}},
+		{"API tokens of deleted users", "user_tokens", noUser, nil},
+		{"recovery keys of deleted users", "recovery_keys", noUser, nil},
+		{"expired password resets", "password_resets", `expires_at <= $1 OR ` + noUser, []any{now}},
+		{"expired email verifications", "email_verifications", `expires_at <= $1 OR ` + noUser, []any{now}},
+		{"preferences of deleted users", "user_preferences", noUser, nil},
+		{"memberships of deleted users and orgs", "org_members", noUser + ` OR ` + noOrg, nil},
+		{"tokens of deleted orgs", "org_tokens", noOrg, nil},
+		{"preferences of deleted orgs", "org_preferences", noOrg, nil},
+		{"expired OAuth codes", "oauth_codes", `expires_at <= $1 OR ` + noUser, []any{now}},
+		{"expired OAuth tokens", "oauth_tokens", `refresh_expires_at <= $1 OR ` + noUser, []any{now}},
+		{"audit rows of deleted domains", "custom_domain_audit", noDomain, nil},
+		{"expired IP bans", "ip_bans", `expires_at != 0 AND expires_at <= $1`, []any{now}},
+	}
+	if auditCutoff > 0 {
+		rules = append(rules, gcRule{"domain audit rows past retention", "custom_domain_audit", `created_at < $1 AND NOT (` + noDomain + `)`, []any{auditCutoff}})
+	}
+	return rules
+}
+
+// GarbageCollect finds orphaned and stale data and removes it unless
+// opts.DryRun is set; results with a count of 0 are included
+func (db DB) GarbageCollect(opts GCOptions) ([]GCResult, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultBatchTimeout)
+	defer cancel()
+
+	now := time.Now()
+	var auditCutoff int64
+	if opts.AuditRetention > 0 {
+		auditCutoff = now.Add(-opts.AuditRetention).Unix()
+	}
+
+	var results []GCResult
+	for _, rule := range gcRules(now.Unix(), auditCutoff) {
+		var count int64
+		if opts.DryRun {
+			err := db.pool.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+rule.table+` WHERE `+rule.where, rule.args...).Scan(&count)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			result, err := db.pool.ExecContext(ctx, `DELETE FROM `+rule.table+` WHERE `+rule.where, rule.args...)
+			if err != nil {
+				return nil, err
+			}
+			if count, err = result.RowsAffected(); err != nil {
+				return nil, err
+			}
+		}
+		results = append(results, GCResult{Name: rule.name, Count: count})
+	}
+
+	blobResults, err := db.gcBlobs(ctx, now, opts.DryRun)
+	if err != nil {
+		return nil, err
+	}
+	return append(results, blobResults...), nil
+}
+
+// gcBlobs removes paste bodies in the blob store that no paste uses, and
+// the temporary files of writes that never finished
+func (db DB) gcBlobs(ctx context.Context, now time.Time, dryRun bool) ([]GCResult, error) {
+	if db.bodies == nil || db.bodies.blobs == nil {
+		return nil, nil
+	}
+	lister, ok := db.bodies.blobs.(blob.Lister)
+	if !ok {
+		return nil, nil
+	}
+
+	infos, err := lister.List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	used := make(map[string]bool)
+	rows, err := db.pool.QueryContext(ctx, `SELECT id FROM pastes WHERE body_storage = $1`, BodyBlob)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		used[blobKey(id)] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var orphans, temps int64
+	for _, info := range infos {
+		if now.Sub(info.ModTime) < gcBlobMinAge {
+			continue
+		}
+		switch {
+		case info.Temp:
+			temps++
+		case strings.HasPrefix(info.Key, blobKey("")) && !used[info.Key]:
+			orphans++
+		default:
+			continue
+		}
+		if !dryRun {
+			if err := db.bodies.blobs.Delete(ctx, info.Key); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return []GCResult{
+		{Name: "paste bodies without a paste", Count: orphans},
+		{Name: "abandoned uploads", Count: temps},
+	}, nil
+}
@@ -0,0 +1,219 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// Gists group pastes as the files of one GitHub style gist
+// Each file is a paste of its own, so it has its own URL, raw view and
+// expiry; the gist takes the ID of its first file
+
+var ErrGistEmpty = errors.New("db: a gist needs at least one file")
+
+// Gist is a set of pastes shown as the files of a gist
+type Gist struct {
+	ID          string     `json:"id"`
+	Description string     `json:"description"`
+	Owner       string     `json:"owner"`
+	Public      bool       `json:"public"`
+	CreateTime  int64      `json:"createTime"`
+	UpdateTime  int64      `json:"updateTime"`
+	Files       []GistFile `json:"files"`
+}
+
+// GistFile is one file of a gist; files keep the order they were given in
+type GistFile struct {
+	Name  string `json:"name"`
+	Paste Paste  `json:"paste"`
+}
+
+// GistAdd adds the pastes of a gist's files and groups them; the pastes
+// added so far are deleted again if one fails
+func (db DB) GistAdd(gist Gist) (Gist, error) {
+	if len(gist.Files) == 0 {
+		return gist, ErrGistEmpty
+	}
+
+	for i := range gist.Files {
+		paste := &gist.Files[i].Paste
+		id, createTime, deleteTime, err := db.PasteAdd(*paste)
+		if err != nil {
+			db.gistDeletePastes(gist.Files[:i])
+			return gist, err
+		}
+		paste.ID, paste.CreateTime, paste.DeleteTime = id, createTime, deleteTime
+	}
+	gist.ID = gist.Files[0].Paste.ID
+	gist.CreateTime = gist.Files[0].Paste.CreateTime
+	gist.UpdateTime = gist.CreateTime
+
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	err := db.gistInsert(ctx, gist)
+	if err != nil {
+		db.gistDeletePastes(gist.Files)
+	}
+	return gist, err
+}
+
+func (db DB) gistInsert(ctx context.Context, gist Gist) error {
+	tx, err := db.pool.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO paste_gists (id, description, owner, is_public, create_time, update_time) VALUES ($1, $2, $3, $4, $5, $6)`,
+		gist.ID, gist.Description, gist.Owner, gist.Public, gist.CreateTime, gist.UpdateTime,
+	)
+	if err != nil {
+		return err
+	}
+	for i, file := range gist.Files {
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO paste_gist_files (gist_id, position, paste_id, file_name) VALUES ($1, $2, $3, $4)`,
+			gist.ID, i, file.Paste.ID, file.Name,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (db DB) gistDeletePastes(files []GistFile) {
+	for _, file := range files {
+		db.pasteDelete(file.Paste.ID)
+	}
+}
+
+// GistGet returns a gist with the files that still exist; a gist whose
+// files have all expired or been deleted is not found
+func (db DB) GistGet(id string) (Gist, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	gist := Gist{ID: id}
+	err := db.pool.QueryRowContext(ctx,
+		`SELECT description, owner, is_public, create_time, update_time FROM paste_gists WHERE id = $1`, id,
+	).Scan(&gist.Description, &gist.Owner, &gist.Public, &gist.CreateTime, &gist.UpdateTime)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return gist, ErrNotFoundID
+		}
+		return gist, err
+	}
+
+	gist.Files, err = db.gistFiles(ctx, id)
+	if err != nil {
+		return gist, err
+	}
+	if len(gist.Files) == 0 {
+		return gist, ErrNotFoundID
+	}
+	return gist, nil
+}
+
+func (db DB) gistFiles(ctx context.Context, id string) ([]GistFile, error) {
+	rows, err := db.pool.QueryContext(ctx,
+		`SELECT paste_id, file_name FROM paste_gist_files WHERE gist_id = $1 ORDER BY position`, id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	var files []GistFile
+	for rows.Next() {
+		var file GistFile
+		if err := rows.Scan(&file.Paste.ID, &file.Name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Read after the rows are closed; PasteGet may delete an expired paste
+	found := files[:0]
+	for _, file := range files {
+		paste, err := db.PasteGet(file.Paste.ID)
+		if err == ErrNotFoundID {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		file.Paste = paste
+		found = append(found, file)
+	}
+	return found, nil
+}
+
+// GistList returns the gists of owner, or the public gists of everyone when
+// owner is "", newest first
+func (db DB) GistList(owner string, limit int, offset int) ([]Gist, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	query := `SELECT id FROM paste_gists WHERE owner = $1 ORDER BY create_time DESC, id LIMIT $2 OFFSET $3`
+	args := []interface{}{owner, limit, offset}
+	if owner == "" {
+		query = `SELECT id FROM paste_gists WHERE is_public = $1 ORDER BY create_time DESC, id LIMIT $2 OFFSET $3`
+		args[0] = true
+	}
+	rows, err := db.pool.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	gists := []Gist{}
+	for _, id := range ids {
+		gist, err := db.GistGet(id)
+		if err == ErrNotFoundID {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		gists = append(gists, gist)
+	}
+	return gists, nil
+}
+
+// gistFilesCleanup drops the files of deleted pastes, and gists left with none
+func (db DB) gistFilesCleanup(ctx context.Context) error {
+	_, err := db.pool.ExecContext(ctx,
+		`DELETE FROM paste_gist_files WHERE paste_id NOT IN (SELECT id FROM pastes)`,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = db.pool.ExecContext(ctx,
+		`DELETE FROM paste_gists WHERE id NOT IN (SELECT gist_id FROM paste_gist_files)`,
+	)
+	return err
+}
@@ -0,0 +1,66 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// LeaseAcquire takes the named lease for holder, or extends it if holder
+// already owns it. It reports false while another holder's lease is unexpired.
+func (db DB) LeaseAcquire(name, holder string, ttl time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	now := time.Now()
+	expiresAt := now.Add(ttl).Unix()
+
+	result, err := db.pool.ExecContext(ctx,
+		`UPDATE leases SET holder = $2, expires_at = $3 WHERE name = $1 AND (holder = $2 OR expires_at <= $4)`,
+		name, holder, expiresAt, now.Unix(),
+	)
+	if err != nil {
+		return false, err
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected > 0 {
+		return err == nil, err
+	}
+
+	// No row was updated: either the lease is held by someone else or it does not exist yet
+	var current string
+	err = db.pool.QueryRowContext(ctx, `SELECT holder FROM leases WHERE name = $1`, name).Scan(&current)
+	if err == nil {
+		return false, nil
+	}
+	if err != sql.ErrNoRows {
+		return false, err
+	}
+
+	_, err = db.pool.ExecContext(ctx,
+		`INSERT INTO leases (name, holder, expires_at) VALUES ($1, $2, $3)`,
+		name, holder, expiresAt,
+	)
+	if err != nil {
+		// Another replica inserted the row first
+		if db.pool.QueryRowContext(ctx, `SELECT holder FROM leases WHERE name = $1`, name).Scan(&current) == nil {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// LeaseRelease gives up the named lease if holder owns it
+func (db DB) LeaseRelease(name, holder string) error {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	_, err := db.pool.ExecContext(ctx, `DELETE FROM leases WHERE name = $1 AND holder = $2`, name, holder)
+	return err
+}
@@ -0,0 +1,110 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrMaintenanceWindowNotFound = errors.New("db: maintenance window not found")
+
+// MaintenanceWindow is a scheduled period of maintenance mode
+// Times are unix seconds; the banner is shown from AnnounceAt until StartsAt
+type MaintenanceWindow struct {
+	ID         string `json:"id"`
+	StartsAt   int64  `json:"starts_at"`
+	EndsAt     int64  `json:"ends_at"`
+	AnnounceAt int64  `json:"announce_at"`
+	Message    string `json:"message"`
+	CreatedAt  int64  `json:"created_at"`
+}
+
+// MaintenanceWindowList returns all maintenance windows, earliest first
+func (db DB) MaintenanceWindowList() ([]MaintenanceWindow, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultListTimeout)
+	defer cancel()
+
+	rows, err := db.pool.QueryContext(ctx,
+		`SELECT id, starts_at, ends_at, announce_at, message, created_at FROM maintenance_windows ORDER BY starts_at`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	windows := []MaintenanceWindow{}
+	for rows.Next() {
+		var w MaintenanceWindow
+		if err := rows.Scan(&w.ID, &w.StartsAt, &w.EndsAt, &w.AnnounceAt, &w.Message, &w.CreatedAt); err != nil {
+			return nil, err
+		}
+		windows = append(windows, w)
+	}
+	return windows, rows.Err()
+}
+
+// MaintenanceWindowAdd stores a new maintenance window and returns it with its ID
+func (db DB) MaintenanceWindowAdd(w MaintenanceWindow) (MaintenanceWindow, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	var err error
+	w.ID, err = genTokenCrypto(8)
+	if err != nil {
+		return w, err
+	}
+	w.CreatedAt = time.Now().Unix()
+
+	_, err = db.pool.ExecContext(ctx,
+		`INSERT INTO maintenance_windows (id, starts_at, ends_at, announce_at, message, created_at) VALUES ($1, $2, $3, $4, $5, $6)`,
+		w.ID, w.StartsAt, w.EndsAt, w.AnnounceAt, w.Message, w.CreatedAt,
+	)
+	return w, err
+}
+
+// MaintenanceWindowUpdate replaces the times and message of a maintenance window
+func (db DB) MaintenanceWindowUpdate(w MaintenanceWindow) error {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	result, err := db.pool.ExecContext(ctx,
+		`UPDATE maintenance_windows SET starts_at = $2, ends_at = $3, announce_at = $4, message = $5 WHERE id = $1`,
+		w.ID, w.StartsAt, w.EndsAt, w.AnnounceAt, w.Message,
+	)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrMaintenanceWindowNotFound
+	}
+	return nil
+}
+
+// MaintenanceWindowDelete removes a maintenance window
+func (db DB) MaintenanceWindowDelete(id string) error {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	result, err := db.pool.ExecContext(ctx, `DELETE FROM maintenance_windows WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrMaintenanceWindowNotFound
+	}
+	return nil
+}
@@ -7,7 +7,6 @@
 package storage
 
 import (
-	"context"
 	"fmt"
 	"time"
 )
@@ -15,7 +14,28 @@ import (
 // Migration timeout - longer for batch operations
 const migrationTimeout = 5 * time.Minute
 
+// MigratePlan returns the IDs of the pastes MigrateDatabase would copy,
+// without opening the destination
+func MigratePlan(sourceDriver, sourceSource string) ([]string, error) {
+	source, err := Open(sourceDriver, sourceSource)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open source database: %w", err)
+	}
+	defer source.Close()
+
+	var ids []string
+	err = source.PasteEach(func(paste StoredPaste) error {
+		ids = append(ids, paste.ID)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read source database: %w", err)
+	}
+	return ids, nil
+}
+
 // MigrateDatabase migrates all data from source database to destination database
+// Both ends go through their registered Driver, so any two backends can be used
 func MigrateDatabase(sourceDriver, sourceSource, destDriver, destSource string) error {
 	fmt.Println("Database Migration")
 	fmt.Println("==================")
@@ -23,79 +43,39 @@ func MigrateDatabase(sourceDriver, sourceSource, destDriver, destSource string)
 	fmt.Printf("Destination: %s (%s)\n", destDriver, destSource)
 	fmt.Println()
 
-	// Open source database
-	fmt.Println("Opening source database...")
-	sourceDB, err := NewPool(sourceDriver, sourceSource, 25, 5, "")
+	dest, err := lookupDriver(destDriver)
 	if err != nil {
-		return fmt.Errorf("failed to open source database: %w", err)
+		return err
 	}
-	defer sourceDB.Close()
 
-	// Open destination database
-	fmt.Println("Opening destination database...")
-	destDB, err := NewPool(destDriver, destSource, 25, 5, "")
+	// Open source database
+	fmt.Println("Opening source database...")
+	source, err := Open(sourceDriver, sourceSource)
 	if err != nil {
-		return fmt.Errorf("failed to open destination database: %w", err)
+		return fmt.Errorf("failed to open source database: %w", err)
 	}
-	defer destDB.Close()
+	defer source.Close()
 
 	// Initialize destination database schema
 	fmt.Println("Initializing destination schema...")
-	err = InitDB(destDriver, destSource)
+	err = dest.Init(destSource)
 	if err != nil {
 		return fmt.Errorf("failed to initialize destination schema: %w", err)
 	}
 
-	// Migration timeout per AI.md PART 10
-	ctx, cancel := context.WithTimeout(context.Background(), migrationTimeout)
-	defer cancel()
-
-	// Query all pastes from source
-	fmt.Println("Reading pastes from source database...")
-	rows, err := sourceDB.pool.QueryContext(ctx, `
-		SELECT id, title, body, syntax, create_time, delete_time, one_use,
-		       author, author_email, author_url,
-		       COALESCE(is_file, 0), COALESCE(file_name, ''), COALESCE(mime_type, ''),
-		       COALESCE(is_editable, 0), COALESCE(is_private, 0),
-		       COALESCE(is_url, 0), COALESCE(original_url, '')
-		FROM pastes
-	`)
+	// Open destination database
+	fmt.Println("Opening destination database...")
+	destDB, err := dest.Open(destSource)
 	if err != nil {
-		return fmt.Errorf("failed to read source database: %w", err)
+		return fmt.Errorf("failed to open destination database: %w", err)
 	}
-	defer rows.Close()
+	defer destDB.Close()
 
 	// Migrate each paste
 	count := 0
 	fmt.Println("Migrating pastes...")
-	for rows.Next() {
-		var paste Paste
-		err := rows.Scan(
-			&paste.ID, &paste.Title, &paste.Body, &paste.Syntax,
-			&paste.CreateTime, &paste.DeleteTime, &paste.OneUse,
-			&paste.Author, &paste.AuthorEmail, &paste.AuthorURL,
-			&paste.IsFile, &paste.FileName, &paste.MimeType,
-			&paste.IsEditable, &paste.IsPrivate, &paste.IsURL, &paste.OriginalURL,
-		)
-		if err != nil {
-			return fmt.Errorf("failed to scan paste: %w", err)
-		}
-
-		// Insert into destination database with timeout
-		insertCtx, insertCancel := context.WithTimeout(context.Background(), defaultQueryTimeout)
-		_, err = destDB.pool.ExecContext(insertCtx, `
-			INSERT INTO pastes (id, title, body, syntax, create_time, delete_time, one_use,
-			                    author, author_email, author_url,
-			                    is_file, file_name, mime_type, is_editable, is_private, is_url, original_url)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
-		`, paste.ID, paste.Title, paste.Body, paste.Syntax,
-			paste.CreateTime, paste.DeleteTime, paste.OneUse,
-			paste.Author, paste.AuthorEmail, paste.AuthorURL,
-			paste.IsFile, paste.FileName, paste.MimeType,
-			paste.IsEditable, paste.IsPrivate, paste.IsURL, paste.OriginalURL)
-		insertCancel()
-
-		if err != nil {
+	err = source.PasteEach(func(paste StoredPaste) error {
+		if err := destDB.PasteImport(paste); err != nil {
 			return fmt.Errorf("failed to insert paste %s: %w", paste.ID, err)
 		}
 
@@ -103,10 +83,10 @@ func MigrateDatabase(sourceDriver, sourceSource, destDriver, destSource string)
 		if count%100 == 0 {
 			fmt.Printf("Migrated %d pastes...\n", count)
 		}
-	}
-
-	if err = rows.Err(); err != nil {
-		return fmt.Errorf("error reading source rows: %w", err)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to migrate pastes: %w", err)
 	}
 
 	fmt.Println()
@@ -0,0 +1,730 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package migrations
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// The schema as it was before numbered migrations; every statement is
+// idempotent, so databases created by earlier releases are adopted as they
+// are. It cannot be rolled back
+func init() {
+	register(Migration{Version: 1, Name: "baseline", Up: baselineUp})
+}
+
+func baselineUp(tx *sql.Tx, driver string) error {
+	// Create pastes table
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS pastes (
+			id          TEXT    PRIMARY KEY,
+			title       TEXT    NOT NULL,
+			body        TEXT    NOT NULL,
+			syntax      TEXT    NOT NULL,
+			create_time INTEGER NOT NULL,
+			delete_time INTEGER NOT NULL,
+			one_use     BOOL    NOT NULL
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create legal holds table (WORM mode)
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS paste_legal_holds (
+			paste_id   TEXT    PRIMARY KEY,
+			reason     TEXT    NOT NULL,
+			created_by TEXT    NOT NULL,
+			created_at INTEGER NOT NULL
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create pinned pastes table
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS paste_pins (
+			paste_id          TEXT    PRIMARY KEY,
+			position          INTEGER NOT NULL,
+			keep_after_expiry BOOLEAN NOT NULL,
+			created_by        TEXT    NOT NULL,
+			created_at        INTEGER NOT NULL
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create paste tags table (one row per paste and tag)
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS paste_tags (
+			paste_id TEXT NOT NULL,
+			tag      TEXT NOT NULL,
+			PRIMARY KEY (paste_id, tag)
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create paste forks table (each fork and the paste it was copied from)
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS paste_forks (
+			paste_id  TEXT NOT NULL PRIMARY KEY,
+			parent_id TEXT NOT NULL
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create share links table (time-limited URLs that open a paste)
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS share_links (
+			token_hash TEXT    NOT NULL PRIMARY KEY,
+			id         TEXT    NOT NULL,
+			paste_id   TEXT    NOT NULL,
+			created_by TEXT    NOT NULL,
+			created_at INTEGER NOT NULL,
+			expires_at INTEGER NOT NULL
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create paste signatures table (detached PGP signatures)
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS paste_signatures (
+			paste_id   TEXT    NOT NULL PRIMARY KEY,
+			signature  TEXT    NOT NULL,
+			public_key TEXT    NOT NULL,
+			created_at INTEGER NOT NULL
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create PGP keys table (public keys users sign pastes with)
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS pgp_keys (
+			fingerprint TEXT    NOT NULL PRIMARY KEY,
+			owner       TEXT    NOT NULL,
+			key_ids     TEXT    NOT NULL,
+			user_ids    TEXT    NOT NULL,
+			public_key  TEXT    NOT NULL,
+			created_at  INTEGER NOT NULL
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create paste templates table
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS paste_templates (
+			name        TEXT    PRIMARY KEY,
+			description TEXT    NOT NULL,
+			title       TEXT    NOT NULL,
+			body        TEXT    NOT NULL,
+			syntax      TEXT    NOT NULL,
+			created_at  INTEGER NOT NULL,
+			updated_at  INTEGER NOT NULL
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create paste drafts table (create page autosave)
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS paste_drafts (
+			owner      TEXT    NOT NULL,
+			id         TEXT    NOT NULL,
+			title      TEXT    NOT NULL,
+			body       TEXT    NOT NULL,
+			syntax     TEXT    NOT NULL,
+			updated_at INTEGER NOT NULL,
+			PRIMARY KEY (owner, id)
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create content revisions table (about, rules and terms page history)
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS content_revisions (
+			page       TEXT    NOT NULL,
+			revision   INTEGER NOT NULL,
+			body       TEXT    NOT NULL,
+			markdown   BOOL    NOT NULL,
+			author     TEXT    NOT NULL,
+			created_at INTEGER NOT NULL,
+			PRIMARY KEY (page, revision)
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create abuse reports table (moderation queue)
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS abuse_reports (
+			id          TEXT    PRIMARY KEY,
+			paste_id    TEXT    NOT NULL,
+			reason      TEXT    NOT NULL,
+			email       TEXT    NOT NULL,
+			ip          TEXT    NOT NULL,
+			state       TEXT    NOT NULL,
+			ticket      TEXT    NOT NULL,
+			created_at  INTEGER NOT NULL,
+			resolved_at INTEGER NOT NULL
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create maintenance windows table (scheduled maintenance mode)
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS maintenance_windows (
+			id          TEXT    PRIMARY KEY,
+			starts_at   INTEGER NOT NULL,
+			ends_at     INTEGER NOT NULL,
+			announce_at INTEGER NOT NULL,
+			message     TEXT    NOT NULL,
+			created_at  INTEGER NOT NULL
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create leases table (leader election between replicas)
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS leases (
+			name       TEXT    PRIMARY KEY,
+			holder     TEXT    NOT NULL,
+			expires_at INTEGER NOT NULL
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create users table (PART 34: Multi-User)
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS users (
+			id              INTEGER PRIMARY KEY AUTOINCREMENT,
+			username        TEXT NOT NULL UNIQUE,
+			email           TEXT NOT NULL UNIQUE,
+			password_hash   TEXT NOT NULL,
+			display_name    TEXT,
+			avatar_type     TEXT NOT NULL DEFAULT 'gravatar',
+			avatar_url      TEXT,
+			bio             TEXT,
+			location        TEXT,
+			website         TEXT,
+			visibility      TEXT NOT NULL DEFAULT 'public',
+			org_visibility  INTEGER NOT NULL DEFAULT 1,
+			timezone        TEXT,
+			language        TEXT DEFAULT 'en',
+			role            TEXT NOT NULL DEFAULT 'user',
+			email_verified  INTEGER NOT NULL DEFAULT 0,
+			totp_enabled    INTEGER NOT NULL DEFAULT 0,
+			totp_secret     TEXT,
+			last_login      INTEGER,
+			failed_attempts INTEGER NOT NULL DEFAULT 0,
+			locked_until    INTEGER,
+			created_at      INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+			updated_at      INTEGER NOT NULL DEFAULT (strftime('%s', 'now'))
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create user_sessions table
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS user_sessions (
+			id          INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id     INTEGER NOT NULL,
+			token_hash  TEXT NOT NULL UNIQUE,
+			device      TEXT,
+			ip_address  TEXT,
+			user_agent  TEXT,
+			expires_at  INTEGER NOT NULL,
+			created_at  INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create user_tokens table (API tokens with usr_ prefix)
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS user_tokens (
+			id           INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id      INTEGER NOT NULL,
+			name         TEXT NOT NULL,
+			token_prefix TEXT NOT NULL,
+			token_hash   TEXT NOT NULL UNIQUE,
+			scopes       TEXT,
+			last_used_at INTEGER,
+			expires_at   INTEGER,
+			created_at   INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create recovery_keys table (hashed, single use)
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS recovery_keys (
+			id         INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id    INTEGER NOT NULL,
+			key_hash   TEXT NOT NULL UNIQUE,
+			used_at    INTEGER,
+			created_at INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create password_resets table
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS password_resets (
+			id         INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id    INTEGER NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			expires_at INTEGER NOT NULL,
+			used_at    INTEGER,
+			created_at INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create email_verifications table
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS email_verifications (
+			id          INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id     INTEGER NOT NULL,
+			email       TEXT NOT NULL,
+			token_hash  TEXT NOT NULL UNIQUE,
+			expires_at  INTEGER NOT NULL,
+			verified_at INTEGER,
+			created_at  INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create user_invites table (admin-generated)
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS user_invites (
+			id         INTEGER PRIMARY KEY AUTOINCREMENT,
+			username   TEXT NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			created_by INTEGER NOT NULL,
+			expires_at INTEGER NOT NULL,
+			used_at    INTEGER,
+			created_at INTEGER NOT NULL DEFAULT (strftime('%s', 'now'))
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create user_preferences table
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS user_preferences (
+			id               INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id          INTEGER NOT NULL UNIQUE,
+			show_email       INTEGER NOT NULL DEFAULT 0,
+			show_activity    INTEGER NOT NULL DEFAULT 1,
+			show_orgs        INTEGER NOT NULL DEFAULT 1,
+			searchable       INTEGER NOT NULL DEFAULT 1,
+			email_security   INTEGER NOT NULL DEFAULT 1,
+			email_mentions   INTEGER NOT NULL DEFAULT 1,
+			email_updates    INTEGER NOT NULL DEFAULT 0,
+			email_digest     TEXT DEFAULT 'weekly',
+			theme            TEXT DEFAULT 'dark',
+			font_size        TEXT DEFAULT 'medium',
+			reduce_motion    INTEGER NOT NULL DEFAULT 0,
+			date_format      TEXT DEFAULT 'YYYY-MM-DD',
+			time_format      TEXT DEFAULT '24h',
+			created_at       INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+			updated_at       INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create orgs table (PART 35: Organizations)
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS orgs (
+			id             INTEGER PRIMARY KEY AUTOINCREMENT,
+			slug           TEXT NOT NULL UNIQUE,
+			name           TEXT NOT NULL,
+			description    TEXT,
+			avatar_type    TEXT NOT NULL DEFAULT 'gravatar',
+			avatar_url     TEXT,
+			website        TEXT,
+			location       TEXT,
+			visibility     TEXT NOT NULL DEFAULT 'public',
+			owner_id       INTEGER NOT NULL,
+			email          TEXT,
+			email_verified INTEGER NOT NULL DEFAULT 0,
+			created_at     INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+			updated_at     INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+			FOREIGN KEY (owner_id) REFERENCES users(id)
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create org_members table
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS org_members (
+			id         INTEGER PRIMARY KEY AUTOINCREMENT,
+			org_id     INTEGER NOT NULL,
+			user_id    INTEGER NOT NULL,
+			role       TEXT NOT NULL DEFAULT 'member',
+			created_at INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+			UNIQUE(org_id, user_id),
+			FOREIGN KEY (org_id) REFERENCES orgs(id) ON DELETE CASCADE,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create org_tokens table (API tokens with org_ prefix)
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS org_tokens (
+			id           INTEGER PRIMARY KEY AUTOINCREMENT,
+			org_id       INTEGER NOT NULL,
+			created_by   INTEGER NOT NULL,
+			name         TEXT NOT NULL,
+			token_prefix TEXT NOT NULL,
+			token_hash   TEXT NOT NULL UNIQUE,
+			scopes       TEXT,
+			last_used_at INTEGER,
+			expires_at   INTEGER,
+			created_at   INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+			FOREIGN KEY (org_id) REFERENCES orgs(id) ON DELETE CASCADE,
+			FOREIGN KEY (created_by) REFERENCES users(id)
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create org_preferences table
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS org_preferences (
+			id                   INTEGER PRIMARY KEY AUTOINCREMENT,
+			org_id               INTEGER NOT NULL UNIQUE,
+			default_role         TEXT DEFAULT 'member',
+			require_2fa          INTEGER NOT NULL DEFAULT 0,
+			notify_member_join   INTEGER NOT NULL DEFAULT 1,
+			notify_member_leave  INTEGER NOT NULL DEFAULT 1,
+			notify_role_change   INTEGER NOT NULL DEFAULT 1,
+			notify_token_activity INTEGER NOT NULL DEFAULT 1,
+			created_at           INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+			updated_at           INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+			FOREIGN KEY (org_id) REFERENCES orgs(id) ON DELETE CASCADE
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create custom_domains table (PART 36: Custom Domains)
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS custom_domains (
+			id                  INTEGER PRIMARY KEY AUTOINCREMENT,
+			owner_type          TEXT NOT NULL,
+			owner_id            INTEGER NOT NULL,
+			domain              TEXT NOT NULL UNIQUE,
+			is_apex             INTEGER NOT NULL DEFAULT 0,
+			is_wildcard         INTEGER NOT NULL DEFAULT 0,
+			verification_status TEXT NOT NULL DEFAULT 'pending',
+			verification_method TEXT NOT NULL DEFAULT 'a_record',
+			verification_token  TEXT,
+			subdomain_mode      TEXT NOT NULL DEFAULT 'owner',
+			verified_at         INTEGER,
+			verified_ip         TEXT,
+			last_check_at       INTEGER,
+			check_count         INTEGER NOT NULL DEFAULT 0,
+			ssl_enabled         INTEGER NOT NULL DEFAULT 0,
+			ssl_status          TEXT NOT NULL DEFAULT 'none',
+			ssl_challenge       TEXT,
+			ssl_provider        TEXT,
+			ssl_credentials     TEXT,
+			ssl_cert_pem        TEXT,
+			ssl_key_pem         TEXT,
+			ssl_issued_at       INTEGER,
+			ssl_expires_at      INTEGER,
+			ssl_last_error      TEXT,
+			status              TEXT NOT NULL DEFAULT 'pending',
+			suspended_reason    TEXT,
+			created_at          INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+			updated_at          INTEGER NOT NULL DEFAULT (strftime('%s', 'now'))
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Add columns to custom_domains tables created before they existed
+	for _, col := range []string{
+		"verification_method TEXT NOT NULL DEFAULT 'a_record'",
+		"verification_token TEXT",
+		"subdomain_mode TEXT NOT NULL DEFAULT 'owner'",
+	} {
+		// Using string formatting is safe here because column definitions are hardcoded
+		_, err := tx.Exec(`ALTER TABLE custom_domains ADD COLUMN ` + col)
+		if err != nil && !strings.Contains(err.Error(), "duplicate column") {
+			return err
+		}
+	}
+
+	// Create custom_domain_subdomains table (explicit wildcard subdomain mappings)
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS custom_domain_subdomains (
+			id         INTEGER PRIMARY KEY AUTOINCREMENT,
+			domain_id  INTEGER NOT NULL,
+			label      TEXT NOT NULL,
+			user_id    INTEGER NOT NULL,
+			created_at INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+			UNIQUE(domain_id, label),
+			FOREIGN KEY (domain_id) REFERENCES custom_domains(id) ON DELETE CASCADE,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create custom_domain_audit table
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS custom_domain_audit (
+			id         INTEGER PRIMARY KEY AUTOINCREMENT,
+			domain_id  INTEGER NOT NULL,
+			action     TEXT NOT NULL,
+			actor_type TEXT NOT NULL,
+			actor_id   INTEGER,
+			details    TEXT,
+			created_at INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+			FOREIGN KEY (domain_id) REFERENCES custom_domains(id) ON DELETE CASCADE
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create oauth_clients table (third-party applications, secret hashed)
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS oauth_clients (
+			id            INTEGER PRIMARY KEY AUTOINCREMENT,
+			client_id     TEXT NOT NULL UNIQUE,
+			secret_hash   TEXT,
+			owner_id      INTEGER NOT NULL,
+			name          TEXT NOT NULL,
+			homepage      TEXT,
+			redirect_uris TEXT NOT NULL,
+			scopes        TEXT NOT NULL,
+			is_public     INTEGER NOT NULL DEFAULT 0,
+			created_at    INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+			FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE CASCADE
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create oauth_codes table (hashed, single use, short lived)
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS oauth_codes (
+			id                    INTEGER PRIMARY KEY AUTOINCREMENT,
+			code_hash             TEXT NOT NULL UNIQUE,
+			client_id             TEXT NOT NULL,
+			user_id               INTEGER NOT NULL,
+			redirect_uri          TEXT NOT NULL,
+			scopes                TEXT NOT NULL,
+			code_challenge        TEXT,
+			code_challenge_method TEXT,
+			expires_at            INTEGER NOT NULL,
+			created_at            INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create oauth_tokens table (access/refresh pairs, hashed)
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS oauth_tokens (
+			id                 INTEGER PRIMARY KEY AUTOINCREMENT,
+			access_hash        TEXT NOT NULL UNIQUE,
+			refresh_hash       TEXT NOT NULL UNIQUE,
+			client_id          TEXT NOT NULL,
+			user_id            INTEGER NOT NULL,
+			scopes             TEXT NOT NULL,
+			access_expires_at  INTEGER NOT NULL,
+			refresh_expires_at INTEGER NOT NULL,
+			created_at         INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Create indexes
+	_, _ = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_paste_tags_tag ON paste_tags(tag);`)
+	_, _ = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_paste_forks_parent ON paste_forks(parent_id);`)
+	_, _ = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_share_links_paste ON share_links(paste_id);`)
+	_, _ = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_pgp_keys_owner ON pgp_keys(owner);`)
+	_, _ = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_users_username ON users(username);`)
+	_, _ = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);`)
+	_, _ = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_user_sessions_user ON user_sessions(user_id);`)
+	_, _ = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_user_sessions_token ON user_sessions(token_hash);`)
+	_, _ = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_user_tokens_user ON user_tokens(user_id);`)
+	_, _ = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_recovery_keys_user ON recovery_keys(user_id);`)
+	_, _ = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_orgs_slug ON orgs(slug);`)
+	_, _ = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_orgs_owner ON orgs(owner_id);`)
+	_, _ = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_org_members_org ON org_members(org_id);`)
+	_, _ = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_org_members_user ON org_members(user_id);`)
+	_, _ = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_custom_domains_domain ON custom_domains(domain);`)
+	_, _ = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_custom_domains_owner ON custom_domains(owner_type, owner_id);`)
+	_, _ = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_custom_domains_status ON custom_domains(status);`)
+	_, _ = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_custom_domains_ssl_expires ON custom_domains(ssl_expires_at);`)
+	_, _ = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_domain_audit_domain ON custom_domain_audit(domain_id);`)
+	_, _ = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_oauth_clients_owner ON oauth_clients(owner_id);`)
+	_, _ = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_oauth_tokens_user ON oauth_tokens(user_id, client_id);`)
+
+	// Handle database-specific column additions for pastes table
+	// Define allowed columns with validation (prevents SQL injection)
+	type columnDef struct {
+		name       string
+		definition string
+	}
+
+	var columns []columnDef
+	if driver == "sqlite3" || driver == "sqlite" {
+		// SQLite: ALTER TABLE ADD COLUMN (ignores duplicate errors)
+		columns = []columnDef{
+			{"author", "TEXT NOT NULL DEFAULT ''"},
+			{"author_email", "TEXT NOT NULL DEFAULT ''"},
+			{"author_url", "TEXT NOT NULL DEFAULT ''"},
+			{"is_file", "BOOL NOT NULL DEFAULT 0"},
+			{"file_name", "TEXT NOT NULL DEFAULT ''"},
+			{"mime_type", "TEXT NOT NULL DEFAULT ''"},
+			{"is_editable", "BOOL NOT NULL DEFAULT 0"},
+			{"is_private", "BOOL NOT NULL DEFAULT 0"},
+			{"is_url", "BOOL NOT NULL DEFAULT 0"},
+			{"original_url", "TEXT NOT NULL DEFAULT ''"},
+			{"user_id", "INTEGER"},
+			{"org_id", "INTEGER"},
+			{"body_storage", "TEXT NOT NULL DEFAULT ''"},
+			{"body_size", "INTEGER NOT NULL DEFAULT 0"},
+			{"is_encrypted", "BOOL NOT NULL DEFAULT 0"},
+			{"max_views", "INTEGER NOT NULL DEFAULT 0"},
+			{"views_left", "INTEGER NOT NULL DEFAULT 0"},
+		}
+		for _, col := range columns {
+			// Using string formatting is safe here because column name is from hardcoded whitelist
+			_, err := tx.Exec(fmt.Sprintf(`ALTER TABLE pastes ADD COLUMN %s %s`, col.name, col.definition))
+			// Ignore "duplicate column" errors
+			if err != nil && !strings.Contains(err.Error(), "duplicate column") {
+				return err
+			}
+		}
+
+		// Create indexes for pastes user/org columns
+		_, _ = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_pastes_user ON pastes(user_id);`)
+		_, _ = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_pastes_org ON pastes(org_id);`)
+
+	} else if driver == "mysql" || driver == "mariadb" {
+		// MySQL/MariaDB: Use ALTER TABLE ADD COLUMN IF NOT EXISTS (MariaDB 10.0+)
+		columns = []columnDef{
+			{"author", "TEXT NOT NULL DEFAULT ''"},
+			{"author_email", "TEXT NOT NULL DEFAULT ''"},
+			{"author_url", "TEXT NOT NULL DEFAULT ''"},
+			{"is_file", "BOOLEAN NOT NULL DEFAULT false"},
+			{"file_name", "TEXT NOT NULL DEFAULT ''"},
+			{"mime_type", "TEXT NOT NULL DEFAULT ''"},
+			{"is_editable", "BOOLEAN NOT NULL DEFAULT false"},
+			{"is_private", "BOOLEAN NOT NULL DEFAULT false"},
+			{"is_url", "BOOLEAN NOT NULL DEFAULT false"},
+			{"original_url", "TEXT NOT NULL DEFAULT ''"},
+			{"user_id", "INTEGER"},
+			{"org_id", "INTEGER"},
+			{"body_storage", "TEXT NOT NULL DEFAULT ''"},
+			{"body_size", "INTEGER NOT NULL DEFAULT 0"},
+			{"is_encrypted", "BOOLEAN NOT NULL DEFAULT false"},
+			{"max_views", "INTEGER NOT NULL DEFAULT 0"},
+			{"views_left", "INTEGER NOT NULL DEFAULT 0"},
+		}
+		for _, col := range columns {
+			// Using string formatting is safe here because column name is from hardcoded whitelist
+			_, err := tx.Exec(fmt.Sprintf(`ALTER TABLE pastes ADD COLUMN IF NOT EXISTS %s %s`, col.name, col.definition))
+			if err != nil {
+				return err
+			}
+		}
+
+	} else {
+		// PostgreSQL: supports IF NOT EXISTS
+		_, err = tx.Exec(`
+			ALTER TABLE pastes ADD COLUMN IF NOT EXISTS author       TEXT NOT NULL DEFAULT '';
+			ALTER TABLE pastes ADD COLUMN IF NOT EXISTS author_email TEXT NOT NULL DEFAULT '';
+			ALTER TABLE pastes ADD COLUMN IF NOT EXISTS author_url   TEXT NOT NULL DEFAULT '';
+			ALTER TABLE pastes ADD COLUMN IF NOT EXISTS is_file      BOOL NOT NULL DEFAULT false;
+			ALTER TABLE pastes ADD COLUMN IF NOT EXISTS file_name    TEXT NOT NULL DEFAULT '';
+			ALTER TABLE pastes ADD COLUMN IF NOT EXISTS mime_type    TEXT NOT NULL DEFAULT '';
+			ALTER TABLE pastes ADD COLUMN IF NOT EXISTS is_editable  BOOL NOT NULL DEFAULT false;
+			ALTER TABLE pastes ADD COLUMN IF NOT EXISTS is_private   BOOL NOT NULL DEFAULT false;
+			ALTER TABLE pastes ADD COLUMN IF NOT EXISTS is_url       BOOL NOT NULL DEFAULT false;
+			ALTER TABLE pastes ADD COLUMN IF NOT EXISTS original_url TEXT NOT NULL DEFAULT '';
+			ALTER TABLE pastes ADD COLUMN IF NOT EXISTS user_id      INTEGER;
+			ALTER TABLE pastes ADD COLUMN IF NOT EXISTS org_id       INTEGER;
+			ALTER TABLE pastes ADD COLUMN IF NOT EXISTS body_storage TEXT NOT NULL DEFAULT '';
+			ALTER TABLE pastes ADD COLUMN IF NOT EXISTS body_size    INTEGER NOT NULL DEFAULT 0;
+			ALTER TABLE pastes ADD COLUMN IF NOT EXISTS is_encrypted BOOL NOT NULL DEFAULT false;
+			ALTER TABLE pastes ADD COLUMN IF NOT EXISTS max_views    INTEGER NOT NULL DEFAULT 0;
+			ALTER TABLE pastes ADD COLUMN IF NOT EXISTS views_left   INTEGER NOT NULL DEFAULT 0;
+		`)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
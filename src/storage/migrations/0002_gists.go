@@ -0,0 +1,54 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package migrations
+
+import "database/sql"
+
+// Gists: pastes grouped as the files of a gist, see storage.GistAdd
+func init() {
+	register(Migration{Version: 2, Name: "gists", Up: gistsUp, Down: gistsDown})
+}
+
+func gistsUp(tx *sql.Tx, driver string) error {
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS paste_gists (
+			id          TEXT    NOT NULL PRIMARY KEY,
+			description TEXT    NOT NULL,
+			owner       TEXT    NOT NULL,
+			is_public   BOOLEAN NOT NULL,
+			create_time INTEGER NOT NULL,
+			update_time INTEGER NOT NULL
+		);
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS paste_gist_files (
+			gist_id   TEXT    NOT NULL,
+			position  INTEGER NOT NULL,
+			paste_id  TEXT    NOT NULL,
+			file_name TEXT    NOT NULL,
+			PRIMARY KEY (gist_id, position)
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, _ = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_paste_gists_owner ON paste_gists(owner);`)
+	_, _ = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_paste_gist_files_paste ON paste_gist_files(paste_id);`)
+	return nil
+}
+
+// The pastes of the gists are kept
+func gistsDown(tx *sql.Tx, driver string) error {
+	if _, err := tx.Exec(`DROP TABLE IF EXISTS paste_gist_files;`); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`DROP TABLE IF EXISTS paste_gists;`)
+	return err
+}
@@ -0,0 +1,59 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package migrations
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// Moderation: the address each paste was created from, and pastes frozen
+// by an admin pending review, see storage.PasteFreeze
+func init() {
+	register(Migration{Version: 3, Name: "moderation", Up: moderationUp, Down: moderationDown})
+}
+
+func moderationUp(tx *sql.Tx, driver string) error {
+	var err error
+	switch driver {
+	case "sqlite3", "sqlite":
+		// SQLite has no ADD COLUMN IF NOT EXISTS
+		_, err = tx.Exec(`ALTER TABLE pastes ADD COLUMN creator_ip TEXT NOT NULL DEFAULT ''`)
+		if err != nil && strings.Contains(err.Error(), "duplicate column") {
+			err = nil
+		}
+	default:
+		_, err = tx.Exec(`ALTER TABLE pastes ADD COLUMN IF NOT EXISTS creator_ip TEXT NOT NULL DEFAULT ''`)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS paste_freezes (
+			paste_id  TEXT    PRIMARY KEY,
+			reason    TEXT    NOT NULL,
+			frozen_by TEXT    NOT NULL,
+			frozen_at INTEGER NOT NULL
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, _ = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_pastes_creator_ip ON pastes(creator_ip);`)
+	return nil
+}
+
+// Frozen pastes become visible again
+func moderationDown(tx *sql.Tx, driver string) error {
+	if _, err := tx.Exec(`DROP TABLE IF EXISTS paste_freezes;`); err != nil {
+		return err
+	}
+	_, _ = tx.Exec(`DROP INDEX IF EXISTS idx_pastes_creator_ip;`)
+	_, err := tx.Exec(`ALTER TABLE pastes DROP COLUMN creator_ip`)
+	return err
+}
@@ -0,0 +1,30 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package migrations
+
+import "database/sql"
+
+// Indexes for the admin lists of pastes and users, which are filtered by
+// date and sorted by these columns
+func init() {
+	register(Migration{Version: 4, Name: "list_indexes", Up: listIndexesUp, Down: listIndexesDown})
+}
+
+func listIndexesUp(tx *sql.Tx, driver string) error {
+	_, _ = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_pastes_create_time ON pastes(create_time);`)
+	_, _ = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_pastes_delete_time ON pastes(delete_time);`)
+	_, _ = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_users_created_at ON users(created_at);`)
+	_, _ = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_users_last_login ON users(last_login);`)
+	return nil
+}
+
+func listIndexesDown(tx *sql.Tx, driver string) error {
+	_, _ = tx.Exec(`DROP INDEX IF EXISTS idx_pastes_create_time;`)
+	_, _ = tx.Exec(`DROP INDEX IF EXISTS idx_pastes_delete_time;`)
+	_, _ = tx.Exec(`DROP INDEX IF EXISTS idx_users_created_at;`)
+	_, _ = tx.Exec(`DROP INDEX IF EXISTS idx_users_last_login;`)
+	return nil
+}
@@ -0,0 +1,49 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package migrations
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// The SHA-256 of each paste body, so admins can find every copy of the
+// same content; pastes from before this migration have none
+func init() {
+	register(Migration{Version: 5, Name: "content_hash", Up: contentHashUp, Down: contentHashDown})
+}
+
+func contentHashUp(tx *sql.Tx, driver string) error {
+	var err error
+	switch driver {
+	case "sqlite3", "sqlite":
+		// SQLite has no ADD COLUMN IF NOT EXISTS
+		_, err = tx.Exec(`ALTER TABLE pastes ADD COLUMN content_hash TEXT NOT NULL DEFAULT ''`)
+		if err != nil && strings.Contains(err.Error(), "duplicate column") {
+			err = nil
+		}
+	default:
+		_, err = tx.Exec(`ALTER TABLE pastes ADD COLUMN IF NOT EXISTS content_hash TEXT NOT NULL DEFAULT ''`)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Blob-stored bodies already keep their digest in the body column
+	_, err = tx.Exec(`UPDATE pastes SET content_hash = body WHERE body_storage = 'blob' AND body LIKE 'sha256:%'`)
+	if err != nil {
+		return err
+	}
+
+	_, _ = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_pastes_content_hash ON pastes(content_hash);`)
+	return nil
+}
+
+func contentHashDown(tx *sql.Tx, driver string) error {
+	_, _ = tx.Exec(`DROP INDEX IF EXISTS idx_pastes_content_hash;`)
+	_, err := tx.Exec(`ALTER TABLE pastes DROP COLUMN content_hash`)
+	return err
+}
@@ -0,0 +1,42 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package migrations
+
+import (
+	"database/sql"
+)
+
+// Firewall: banned addresses and networks, shared by every replica, see
+// storage.IPBanAdd
+func init() {
+	register(Migration{Version: 6, Name: "firewall", Up: firewallUp, Down: firewallDown})
+}
+
+func firewallUp(tx *sql.Tx, driver string) error {
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS ip_bans (
+			id         TEXT    PRIMARY KEY,
+			network    TEXT    NOT NULL,
+			reason     TEXT    NOT NULL,
+			source     TEXT    NOT NULL,
+			created_by TEXT    NOT NULL,
+			created_at INTEGER NOT NULL,
+			expires_at INTEGER NOT NULL
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, _ = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_ip_bans_expires_at ON ip_bans(expires_at);`)
+	return nil
+}
+
+func firewallDown(tx *sql.Tx, driver string) error {
+	_, _ = tx.Exec(`DROP INDEX IF EXISTS idx_ip_bans_expires_at;`)
+	_, err := tx.Exec(`DROP TABLE IF EXISTS ip_bans;`)
+	return err
+}
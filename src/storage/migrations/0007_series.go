@@ -0,0 +1,53 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package migrations
+
+import (
+	"database/sql"
+)
+
+// Series: pastes linked as the numbered parts of one text, see
+// storage.SeriesStart
+func init() {
+	register(Migration{Version: 7, Name: "series", Up: seriesUp, Down: seriesDown})
+}
+
+func seriesUp(tx *sql.Tx, driver string) error {
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS paste_series (
+			id          TEXT    NOT NULL PRIMARY KEY,
+			key_hash    TEXT    NOT NULL,
+			create_time INTEGER NOT NULL
+		);
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		CREATE TABLE IF NOT EXISTS paste_series_parts (
+			series_id TEXT    NOT NULL,
+			part      INTEGER NOT NULL,
+			paste_id  TEXT    NOT NULL,
+			PRIMARY KEY (series_id, part)
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, _ = tx.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_paste_series_parts_paste ON paste_series_parts(paste_id);`)
+	return nil
+}
+
+// The pastes of the series are kept
+func seriesDown(tx *sql.Tx, driver string) error {
+	_, _ = tx.Exec(`DROP INDEX IF EXISTS idx_paste_series_parts_paste;`)
+	if _, err := tx.Exec(`DROP TABLE IF EXISTS paste_series_parts;`); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`DROP TABLE IF EXISTS paste_series;`)
+	return err
+}
@@ -0,0 +1,37 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package migrations
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// What closing an abuse report did: dismissed it, deleted the paste, or
+// banned its creator; reports closed before this migration have none
+func init() {
+	register(Migration{Version: 8, Name: "abuse_resolution", Up: abuseResolutionUp, Down: abuseResolutionDown})
+}
+
+func abuseResolutionUp(tx *sql.Tx, driver string) error {
+	var err error
+	switch driver {
+	case "sqlite3", "sqlite":
+		// SQLite has no ADD COLUMN IF NOT EXISTS
+		_, err = tx.Exec(`ALTER TABLE abuse_reports ADD COLUMN resolution TEXT NOT NULL DEFAULT ''`)
+		if err != nil && strings.Contains(err.Error(), "duplicate column") {
+			err = nil
+		}
+	default:
+		_, err = tx.Exec(`ALTER TABLE abuse_reports ADD COLUMN IF NOT EXISTS resolution TEXT NOT NULL DEFAULT ''`)
+	}
+	return err
+}
+
+func abuseResolutionDown(tx *sql.Tx, driver string) error {
+	_, err := tx.Exec(`ALTER TABLE abuse_reports DROP COLUMN resolution`)
+	return err
+}
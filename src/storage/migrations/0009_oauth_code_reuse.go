@@ -0,0 +1,52 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package migrations
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// Authorization codes are marked used instead of deleted, and tokens remember
+// the code they came from, so a replayed code revokes them (RFC 6749 4.1.2)
+func init() {
+	register(Migration{Version: 9, Name: "oauth_code_reuse", Up: oauthCodeReuseUp, Down: oauthCodeReuseDown})
+}
+
+func oauthCodeReuseUp(tx *sql.Tx, driver string) error {
+	columns := []struct{ table, column string }{
+		{"oauth_codes", "used_at INTEGER NOT NULL DEFAULT 0"},
+		{"oauth_tokens", "code_hash TEXT NOT NULL DEFAULT ''"},
+	}
+	for _, c := range columns {
+		var err error
+		switch driver {
+		case "sqlite3", "sqlite":
+			// SQLite has no ADD COLUMN IF NOT EXISTS
+			_, err = tx.Exec(`ALTER TABLE ` + c.table + ` ADD COLUMN ` + c.column)
+			if err != nil && strings.Contains(err.Error(), "duplicate column") {
+				err = nil
+			}
+		default:
+			_, err = tx.Exec(`ALTER TABLE ` + c.table + ` ADD COLUMN IF NOT EXISTS ` + c.column)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	_, _ = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_oauth_tokens_code_hash ON oauth_tokens(code_hash);`)
+	return nil
+}
+
+func oauthCodeReuseDown(tx *sql.Tx, driver string) error {
+	_, _ = tx.Exec(`DROP INDEX IF EXISTS idx_oauth_tokens_code_hash;`)
+	if _, err := tx.Exec(`ALTER TABLE oauth_tokens DROP COLUMN code_hash`); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`ALTER TABLE oauth_codes DROP COLUMN used_at`)
+	return err
+}
@@ -0,0 +1,194 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+// Package migrations keeps the database schema in numbered steps
+// Each migration is applied once, in version order, and recorded in the
+// schema_migrations table; a new schema change is a new file here with the
+// next version, never an edit to one that has shipped
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+var (
+	ErrIrreversible = errors.New("migrations: the latest migration cannot be rolled back")
+	ErrNoneApplied  = errors.New("migrations: no migration has been applied")
+)
+
+// How long one migration may take
+const migrationTimeout = 5 * time.Minute
+
+// Migration is one schema change; driver is the database/sql driver name,
+// for the statements that differ between databases
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *sql.Tx, driver string) error
+	// nil when the change cannot be undone
+	Down func(tx *sql.Tx, driver string) error
+}
+
+// State is a migration and whether the database has it
+type State struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt int64
+}
+
+var all []Migration
+
+// register adds a migration; called from the init of each migration file
+func register(m Migration) {
+	for _, other := range all {
+		if other.Version == m.Version {
+			panic(fmt.Sprintf("migrations: version %d registered twice", m.Version))
+		}
+	}
+	all = append(all, m)
+	sort.Slice(all, func(i, j int) bool { return all[i].Version < all[j].Version })
+}
+
+// Latest returns the version the schema has once every migration is applied
+func Latest() int {
+	if len(all) == 0 {
+		return 0
+	}
+	return all[len(all)-1].Version
+}
+
+// Status lists every migration, oldest first, with whether it is applied
+func Status(db *sql.DB) ([]State, error) {
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]State, 0, len(all))
+	for _, m := range all {
+		at, ok := applied[m.Version]
+		states = append(states, State{Version: m.Version, Name: m.Name, Applied: ok, AppliedAt: at})
+	}
+	return states, nil
+}
+
+// Up applies the migrations the database does not have, in order, and
+// returns them; it stops at the first that fails
+func Up(db *sql.DB, driver string) ([]Migration, error) {
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, m := range all {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		err := inTx(db, func(ctx context.Context, tx *sql.Tx) error {
+			if err := m.Up(tx, driver); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx,
+				`INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)`,
+				m.Version, m.Name, time.Now().Unix(),
+			)
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// Down rolls back the latest applied migration and returns it
+func Down(db *sql.DB, driver string) (Migration, error) {
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return Migration{}, err
+	}
+
+	for i := len(all) - 1; i >= 0; i-- {
+		m := all[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if m.Down == nil {
+			return m, ErrIrreversible
+		}
+		err := inTx(db, func(ctx context.Context, tx *sql.Tx) error {
+			if err := m.Down(tx, driver); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, m.Version)
+			return err
+		})
+		if err != nil {
+			return m, fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		return m, nil
+	}
+	return Migration{}, ErrNoneApplied
+}
+
+// appliedVersions returns when each applied version was applied, creating
+// the schema_migrations table on first use
+func appliedVersions(db *sql.DB) (map[int]int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), migrationTimeout)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    INTEGER NOT NULL PRIMARY KEY,
+			name       TEXT    NOT NULL,
+			applied_at INTEGER NOT NULL
+		);
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]int64)
+	for rows.Next() {
+		var version int
+		var at int64
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// inTx runs fn in a transaction; MySQL commits schema changes as they are
+// made, so a migration that fails there may need its tables dropped by hand
+func inTx(db *sql.DB, fn func(ctx context.Context, tx *sql.Tx) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), migrationTimeout)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(ctx, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,318 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Moderation lets admins list every paste, private ones included, find the
+// pastes created from an address or by a user, and freeze a paste: a frozen
+// paste is hidden as if it did not exist until an admin unfreezes or deletes it
+
+var (
+	ErrFrozen    = errors.New("db: paste is already frozen")
+	ErrNotFrozen = errors.New("db: paste is not frozen")
+)
+
+// PasteFreeze describes a paste hidden pending review
+type PasteFreeze struct {
+	PasteID  string `json:"paste_id"`
+	Reason   string `json:"reason"`
+	FrozenBy string `json:"frozen_by"`
+	FrozenAt int64  `json:"frozen_at"`
+}
+
+// Paste statuses a ModerationFilter can select
+const (
+	// Not expired and not frozen
+	ModerationActive  = "active"
+	ModerationExpired = "expired"
+	ModerationFrozen  = "frozen"
+	ModerationPrivate = "private"
+	ModerationPublic  = "public"
+	// Burn after reading
+	ModerationOneUse    = "one_use"
+	ModerationEncrypted = "encrypted"
+)
+
+// ModerationFilter selects and sorts the pastes PasteModerationList
+// returns; empty fields match every paste
+type ModerationFilter struct {
+	// Address the pastes were created from
+	IP string
+	// Username of the owner, or the author name given with the paste
+	User string
+	// The paste ID, or part of the title, case-insensitively
+	Search string
+	// One of the Moderation statuses
+	Status string
+	// Created at or after From and before To; zero times are open
+	From time.Time
+	To   time.Time
+	// "created", "expires", "size" or "title"; created by default
+	Sort string
+	// Newest, largest or last first
+	Desc bool
+}
+
+// moderationSortColumns are the columns PasteModerationList sorts by
+var moderationSortColumns = map[string]string{
+	"created": "p.create_time",
+	"expires": "p.delete_time",
+	"size":    "COALESCE(p.body_size, 0)",
+	"title":   "p.title",
+}
+
+// where returns the conditions of the filter and their arguments, numbered
+// from $1
+func (f ModerationFilter) where() (string, []any) {
+	var conds []string
+	var args []any
+	add := func(cond string, values ...any) {
+		for _, v := range values {
+			args = append(args, v)
+			cond = strings.Replace(cond, "?", "$"+strconv.Itoa(len(args)), 1)
+		}
+		conds = append(conds, cond)
+	}
+
+	if ip := strings.TrimSpace(f.IP); ip != "" {
+		add("p.creator_ip = ?", ip)
+	}
+	if user := strings.TrimSpace(f.User); user != "" {
+		add("(u.username = ? OR p.author = ?)", user, user)
+	}
+	if search := strings.TrimSpace(f.Search); search != "" {
+		add("(p.id = ? OR LOWER(p.title) LIKE ?)", search, "%"+strings.ToLower(search)+"%")
+	}
+	now := time.Now().Unix()
+	switch f.Status {
+	case ModerationActive:
+		add("(p.delete_time = 0 OR p.delete_time > ?) AND f.paste_id IS NULL", now)
+	case ModerationExpired:
+		add("p.delete_time > 0 AND p.delete_time <= ?", now)
+	case ModerationFrozen:
+		add("f.paste_id IS NOT NULL")
+	case ModerationPrivate:
+		add("p.is_private = true")
+	case ModerationPublic:
+		add("p.is_private = false")
+	case ModerationOneUse:
+		add("p.one_use = true")
+	case ModerationEncrypted:
+		add("p.is_encrypted = true")
+	}
+	if !f.From.IsZero() {
+		add("p.create_time >= ?", f.From.Unix())
+	}
+	if !f.To.IsZero() {
+		add("p.create_time < ?", f.To.Unix())
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// ModerationItem is a paste as admins see it when moderating
+type ModerationItem struct {
+	ID         string `json:"id"`
+	Title      string `json:"title"`
+	Syntax     string `json:"syntax"`
+	CreateTime int64  `json:"create_time"`
+	DeleteTime int64  `json:"delete_time"`
+	Author     string `json:"author"`
+	// Username of the account that owns the paste, empty for anonymous ones
+	Owner string `json:"owner"`
+	// Empty for pastes created before addresses were recorded
+	CreatorIP string `json:"creator_ip"`
+	// Digest of the body, empty for pastes created before it was recorded
+	ContentHash string `json:"content_hash"`
+	Private     bool   `json:"private"`
+	OneUse      bool   `json:"one_use"`
+	Encrypted   bool   `json:"encrypted"`
+	Size        int64  `json:"size"`
+	// Set while the paste is frozen
+	Frozen *PasteFreeze `json:"frozen,omitempty"`
+}
+
+// moderationFrom joins what PasteModerationList shows about a paste
+const moderationFrom = `
+	FROM pastes p
+	LEFT JOIN users u ON u.id = p.user_id
+	LEFT JOIN paste_freezes f ON f.paste_id = p.id`
+
+// PasteModerationList returns a page of every paste matching filter, newest
+// first unless the filter sorts otherwise, with the number of matching pastes
+func (db DB) PasteModerationList(filter ModerationFilter, limit int, offset int) ([]ModerationItem, int, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	where, args := filter.where()
+
+	ctx, cancel := context.WithTimeout(db.context(), defaultListTimeout)
+	defer cancel()
+
+	var total int
+	err := db.pool.QueryRowContext(ctx, `SELECT COUNT(*)`+moderationFrom+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	order := "p.create_time DESC"
+	if column, ok := moderationSortColumns[filter.Sort]; ok {
+		order = column + " ASC"
+		if filter.Desc {
+			order = column + " DESC"
+		}
+	}
+	n := len(args)
+	rows, err := db.pool.QueryContext(ctx,
+		`SELECT `+moderationColumns+moderationFrom+where+`
+		ORDER BY `+order+`, p.id
+		LIMIT $`+strconv.Itoa(n+1)+` OFFSET $`+strconv.Itoa(n+2),
+		append(args, limit, offset)...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	items := []ModerationItem{}
+	for rows.Next() {
+		item, err := scanModerationItem(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		items = append(items, item)
+	}
+	return items, total, rows.Err()
+}
+
+// moderationColumns are what scanModerationItem reads, from moderationFrom
+const moderationColumns = `p.id, p.title, p.syntax, p.create_time, p.delete_time, p.author, COALESCE(u.username, ''),
+		COALESCE(p.creator_ip, ''), COALESCE(p.content_hash, ''), p.is_private, p.one_use, p.is_encrypted, COALESCE(p.body_size, 0),
+		COALESCE(f.reason, ''), COALESCE(f.frozen_by, ''), COALESCE(f.frozen_at, 0)`
+
+func scanModerationItem(row interface{ Scan(...any) error }) (ModerationItem, error) {
+	var item ModerationItem
+	var freeze PasteFreeze
+	err := row.Scan(&item.ID, &item.Title, &item.Syntax, &item.CreateTime, &item.DeleteTime, &item.Author, &item.Owner,
+		&item.CreatorIP, &item.ContentHash, &item.Private, &item.OneUse, &item.Encrypted, &item.Size,
+		&freeze.Reason, &freeze.FrozenBy, &freeze.FrozenAt)
+	if err != nil {
+		return item, err
+	}
+	if freeze.FrozenAt != 0 {
+		freeze.PasteID = item.ID
+		item.Frozen = &freeze
+	}
+	return item, nil
+}
+
+// PasteFreeze hides a paste pending review; a reason is required
+func (db DB) PasteFreeze(id, reason, frozenBy string) error {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return ErrReasonRequired
+	}
+
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	var exists int
+	err := db.pool.QueryRowContext(ctx, `SELECT 1 FROM pastes WHERE id = $1`, id).Scan(&exists)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFoundID
+		}
+		return err
+	}
+
+	if frozen, err := db.PasteFreezeGet(id); err == nil && frozen != nil {
+		return ErrFrozen
+	}
+
+	_, err = db.pool.ExecContext(ctx,
+		`INSERT INTO paste_freezes (paste_id, reason, frozen_by, frozen_at) VALUES ($1, $2, $3, $4)`,
+		id, reason, frozenBy, time.Now().Unix(),
+	)
+	if err != nil {
+		return err
+	}
+	// A cached copy would still be served
+	db.cache.invalidate(id)
+	return nil
+}
+
+// PasteUnfreeze makes a frozen paste visible again
+func (db DB) PasteUnfreeze(id string) error {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	result, err := db.pool.ExecContext(ctx, `DELETE FROM paste_freezes WHERE paste_id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFrozen
+	}
+	return nil
+}
+
+// PasteFreezeGet returns the freeze on a paste, or ErrNotFrozen
+func (db DB) PasteFreezeGet(id string) (*PasteFreeze, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	var freeze PasteFreeze
+	err := db.pool.QueryRowContext(ctx,
+		`SELECT paste_id, reason, frozen_by, frozen_at FROM paste_freezes WHERE paste_id = $1`,
+		id,
+	).Scan(&freeze.PasteID, &freeze.Reason, &freeze.FrozenBy, &freeze.FrozenAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFrozen
+		}
+		return nil, err
+	}
+	return &freeze, nil
+}
+
+// PasteGetForReview returns a paste even when it is frozen, for admins
+// reviewing it
+func (db DB) PasteGetForReview(id string) (Paste, error) {
+	return db.pasteGet(id, false)
+}
+
+// PasteCreatorIP returns the address a paste was created from; it is empty
+// for pastes created before addresses were recorded
+func (db DB) PasteCreatorIP(id string) (string, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	var ip string
+	err := db.pool.QueryRowContext(ctx,
+		`SELECT COALESCE(creator_ip, '') FROM pastes WHERE id = $1`, id,
+	).Scan(&ip)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFoundID
+	}
+	return ip, err
+}
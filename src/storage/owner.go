@@ -0,0 +1,104 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Pastes made with an API token through the editor API record the user or
+// org the token belongs to, so the token can list and edit them later
+// Other pastes have no owner
+
+// PasteOwner is the user or org a paste belongs to; at most one is set
+type PasteOwner struct {
+	UserID int64
+	OrgID  int64
+}
+
+// PasteOwnerSet records who a paste belongs to
+func (db DB) PasteOwnerSet(id string, owner PasteOwner) error {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	res, err := db.pool.ExecContext(ctx,
+		`UPDATE pastes SET user_id = $1, org_id = $2 WHERE id = $3`,
+		nullID(owner.UserID), nullID(owner.OrgID), id,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFoundID
+	}
+	return nil
+}
+
+// PasteOwnerGet returns who a paste belongs to; the zero PasteOwner when nobody
+func (db DB) PasteOwnerGet(id string) (PasteOwner, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	var userID, orgID sql.NullInt64
+	err := db.pool.QueryRowContext(ctx, `SELECT user_id, org_id FROM pastes WHERE id = $1`, id).Scan(&userID, &orgID)
+	if err == sql.ErrNoRows {
+		return PasteOwner{}, ErrNotFoundID
+	}
+	if err != nil {
+		return PasteOwner{}, err
+	}
+	return PasteOwner{UserID: userID.Int64, OrgID: orgID.Int64}, nil
+}
+
+// PasteListOwned returns a page of the pastes of an owner that have not
+// expired, private ones included, newest first
+func (db DB) PasteListOwned(owner PasteOwner, limit int, offset int) ([]PasteListItem, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	ctx, cancel := context.WithTimeout(db.context(), defaultListTimeout)
+	defer cancel()
+
+	column := "user_id"
+	id := owner.UserID
+	if owner.OrgID != 0 {
+		column, id = "org_id", owner.OrgID
+	}
+	// Using string formatting is safe here because column is one of two names
+	rows, err := db.pool.QueryContext(ctx,
+		`SELECT id, title, syntax, create_time, delete_time FROM pastes
+		WHERE `+column+` = $1 AND (delete_time > $2 OR delete_time = 0)
+		AND id NOT IN (SELECT paste_id FROM paste_freezes)
+		ORDER BY create_time DESC
+		LIMIT $3 OFFSET $4`,
+		id, time.Now().Unix(), limit, offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pastes := []PasteListItem{}
+	for rows.Next() {
+		var paste PasteListItem
+		if err := rows.Scan(&paste.ID, &paste.Title, &paste.Syntax, &paste.CreateTime, &paste.DeleteTime); err != nil {
+			return nil, err
+		}
+		pastes = append(pastes, paste)
+	}
+	return pastes, rows.Err()
+}
+
+// nullID stores 0 as NULL, as the owner columns have no owner that way
+func nullID(id int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: id, Valid: id != 0}
+}
@@ -9,7 +9,9 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"io"
 	"log"
+	"strings"
 	"time"
 )
 
@@ -33,6 +35,10 @@ type Paste struct {
 	DeleteTime int64  `json:"deleteTime"`
 	OneUse     bool   `json:"oneUse"`
 	Syntax     string `json:"syntax"`
+	// Views before a one-use paste is deleted; 0 on older pastes means 1
+	MaxViews int `json:"maxViews"`
+	// Views left; ignored when creating
+	ViewsLeft int `json:"viewsLeft"`
 
 	Author      string `json:"author"`
 	AuthorEmail string `json:"authorEmail"`
@@ -53,15 +59,88 @@ type Paste struct {
 	IsURL bool `json:"isURL"`
 	// Original URL for shortener
 	OriginalURL string `json:"originalURL"`
+	// Body encrypted by the client; the key is never sent to the server
+	Encrypted bool `json:"encrypted"`
+	// Topic labels, normalized and sorted; see NormalizeTags
+	Tags []string `json:"tags,omitempty"`
+	// Paste this one was forked from; the parent may since have been deleted
+	ForkOf string `json:"forkOf,omitempty"`
+	// Number of forks of this paste; ignored when creating
+	Forks int `json:"forks"`
+	// Series this paste is a part of, and its part number; ignored when
+	// creating, see SeriesStart
+	Series     string `json:"series,omitempty"`
+	SeriesPart int    `json:"seriesPart,omitempty"`
 }
 
+// PasteAdd creates a paste and returns its ID, create and delete times
+// A paste the scanner holds is stored, and ErrHeldForReview returned
 func (db DB) PasteAdd(paste Paste) (string, int64, int64, error) {
+	if err := pastePrepare(&paste); err != nil {
+		return paste.ID, paste.CreateTime, paste.DeleteTime, err
+	}
+	// Scanned before the query timeout starts, as it may look up links
+	held := db.scan(paste)
+
+	// Query timeout per AI.md PART 10
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	// Choose how the body is stored
+	start := time.Now()
+	body, strategy, err := db.bodies.encode(ctx, paste)
+	if err != nil {
+		return paste.ID, paste.CreateTime, paste.DeleteTime, err
+	}
+
+	err = db.pasteInsert(ctx, paste, body, strategy, len(paste.Body), start)
+	if err == nil && held != "" {
+		err = db.hold(paste.ID, held, true)
+	}
+	return paste.ID, paste.CreateTime, paste.DeleteTime, err
+}
+
+// PasteAddStream creates a paste like PasteAdd, but reads the body from r
+// straight into the blob store, so a large body is never held in memory
+// paste.Body is ignored; the body of a file paste is base64 encoded on the
+// way in. More than maxSize bytes from r fails with ErrBodyTooLarge
+// (0 = no limit) and an empty body with ErrBodyEmpty
+// A paste the scanner holds is stored, and ErrHeldForReview returned
+func (db DB) PasteAddStream(paste Paste, r io.Reader, maxSize int64) (string, int64, int64, error) {
+	paste.Body = ""
+	if err := pastePrepare(&paste); err != nil {
+		return paste.ID, paste.CreateTime, paste.DeleteTime, err
+	}
+	// The body is never in memory, so only the title and link are scanned
+	held := db.scan(paste)
+
+	// Reading the body takes as long as the client takes to send it, so
+	// only the request context limits it
+	start := time.Now()
+	body, size, err := db.bodies.encodeStream(db.context(), paste, r, maxSize)
+	if err != nil {
+		return paste.ID, paste.CreateTime, paste.DeleteTime, err
+	}
+
+	// Query timeout per AI.md PART 10
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	err = db.pasteInsert(ctx, paste, body, BodyBlob, size, start)
+	if err == nil && held != "" {
+		err = db.hold(paste.ID, held, true)
+	}
+	return paste.ID, paste.CreateTime, paste.DeleteTime, err
+}
+
+// pastePrepare sets the ID, create time and view counter of a new paste
+func pastePrepare(paste *Paste) error {
 	var err error
 
 	// Generate ID
 	paste.ID, err = genTokenCrypto(8)
 	if err != nil {
-		return paste.ID, paste.CreateTime, paste.DeleteTime, err
+		return err
 	}
 
 	// Set paste create time
@@ -72,33 +151,60 @@ func (db DB) PasteAdd(paste Paste) (string, int64, int64, error) {
 		paste.DeleteTime = 0
 	}
 
-	// Query timeout per AI.md PART 10
-	ctx, cancel := context.WithTimeout(context.Background(), defaultQueryTimeout)
-	defer cancel()
+	// Burn after reading is a view counter; one use is one view
+	if paste.MaxViews > 0 {
+		paste.OneUse = true
+	} else if paste.OneUse {
+		paste.MaxViews = 1
+	}
+	paste.ViewsLeft = paste.MaxViews
+
+	paste.Tags, err = NormalizeTags(paste.Tags)
+	return err
+}
+
+// pasteInsert adds a new paste row whose body, of size bytes, is already
+// stored with strategy; a stored blob is removed again if that fails
+func (db DB) pasteInsert(ctx context.Context, paste Paste, body, strategy string, size int, start time.Time) error {
+	hash := contentHash(paste, body, strategy)
 
 	// Add to primary database
-	_, err = db.pool.ExecContext(ctx,
-		`INSERT INTO pastes (id, title, body, syntax, create_time, delete_time, one_use, author, author_email, author_url, is_file, file_name, mime_type, is_editable, is_private, is_url, original_url)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)`,
-		paste.ID, paste.Title, paste.Body, paste.Syntax, paste.CreateTime, paste.DeleteTime, paste.OneUse,
+	_, err := db.pool.ExecContext(ctx,
+		`INSERT INTO pastes (id, title, body, syntax, create_time, delete_time, one_use, author, author_email, author_url, is_file, file_name, mime_type, is_editable, is_private, is_url, original_url, body_storage, body_size, is_encrypted, max_views, views_left, creator_ip, content_hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24)`,
+		paste.ID, paste.Title, body, paste.Syntax, paste.CreateTime, paste.DeleteTime, paste.OneUse,
 		paste.Author, paste.AuthorEmail, paste.AuthorURL,
 		paste.IsFile, paste.FileName, paste.MimeType, paste.IsEditable, paste.IsPrivate, paste.IsURL, paste.OriginalURL,
+		strategy, size, paste.Encrypted, paste.MaxViews, paste.ViewsLeft, db.clientIP, hash,
 	)
 	if err != nil {
-		return paste.ID, paste.CreateTime, paste.DeleteTime, err
+		if strategy == BodyBlob {
+			db.bodies.removeBlobs([]string{paste.ID})
+		}
+		return err
+	}
+	db.bodies.recordWrite(strategy, size, time.Since(start))
+	if err := db.pasteTagsAdd(ctx, paste.ID, paste.Tags); err != nil {
+		return err
+	}
+	if paste.ForkOf != "" {
+		if err := db.pasteForkAdd(ctx, paste.ID, paste.ForkOf); err != nil {
+			return err
+		}
 	}
 
 	// Also add to SQLite backup/cache if available
 	if db.backupPool != nil {
 		// Backup uses separate context
-		backupCtx, backupCancel := context.WithTimeout(context.Background(), defaultQueryTimeout)
+		backupCtx, backupCancel := context.WithTimeout(db.context(), defaultQueryTimeout)
 		defer backupCancel()
 		_, backupErr := db.backupPool.ExecContext(backupCtx,
-			`INSERT OR REPLACE INTO pastes (id, title, body, syntax, create_time, delete_time, one_use, author, author_email, author_url, is_file, file_name, mime_type, is_editable, is_private, is_url, original_url)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-			paste.ID, paste.Title, paste.Body, paste.Syntax, paste.CreateTime, paste.DeleteTime, paste.OneUse,
+			`INSERT OR REPLACE INTO pastes (id, title, body, syntax, create_time, delete_time, one_use, author, author_email, author_url, is_file, file_name, mime_type, is_editable, is_private, is_url, original_url, body_storage, body_size, is_encrypted, max_views, views_left, creator_ip, content_hash)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			paste.ID, paste.Title, body, paste.Syntax, paste.CreateTime, paste.DeleteTime, paste.OneUse,
 			paste.Author, paste.AuthorEmail, paste.AuthorURL,
 			paste.IsFile, paste.FileName, paste.MimeType, paste.IsEditable, paste.IsPrivate, paste.IsURL, paste.OriginalURL,
+			strategy, size, paste.Encrypted, paste.MaxViews, paste.ViewsLeft, db.clientIP, hash,
 		)
 		// Log backup errors but don't fail primary operation
 		// Per AI.md PART 11: warn level for recoverable issues
@@ -107,27 +213,64 @@ func (db DB) PasteAdd(paste Paste) (string, int64, int64, error) {
 		}
 	}
 
-	return paste.ID, paste.CreateTime, paste.DeleteTime, nil
+	return nil
 }
 
+// PasteUpdate replaces a paste; an edit the scanner holds is saved, the
+// paste frozen and ErrHeldForReview returned
 func (db DB) PasteUpdate(paste Paste) error {
+	// Pastes are immutable in WORM mode and while under legal hold
+	if db.worm {
+		return ErrWORM
+	}
+	if held, err := db.PasteLegalHoldGet(paste.ID); err == nil && held != nil {
+		return ErrLegalHold
+	}
+	held := db.scan(paste)
+
 	// Query timeout per AI.md PART 10
-	ctx, cancel := context.WithTimeout(context.Background(), defaultQueryTimeout)
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
 	defer cancel()
 
+	// The old body is replaced, so a blob left behind by it must go
+	var oldStrategy string
+	err := db.pool.QueryRowContext(ctx, `SELECT body_storage FROM pastes WHERE id = $1`, paste.ID).Scan(&oldStrategy)
+	if err == sql.ErrNoRows {
+		return ErrNotFoundID
+	} else if err != nil {
+		return err
+	}
+
+	// Choose how the body is stored
+	start := time.Now()
+	body, strategy, err := db.bodies.encode(ctx, paste)
+	if err != nil {
+		return err
+	}
+
 	// Update in primary database
 	result, err := db.pool.ExecContext(ctx,
 		`UPDATE pastes SET title = $2, body = $3, syntax = $4, delete_time = $5, one_use = $6,
 		author = $7, author_email = $8, author_url = $9,
-		is_file = $10, file_name = $11, mime_type = $12, is_editable = $13, is_private = $14, is_url = $15, original_url = $16
+		is_file = $10, file_name = $11, mime_type = $12, is_editable = $13, is_private = $14, is_url = $15, original_url = $16,
+		body_storage = $17, body_size = $18, is_encrypted = $19, content_hash = $20
 		WHERE id = $1`,
-		paste.ID, paste.Title, paste.Body, paste.Syntax, paste.DeleteTime, paste.OneUse,
+		paste.ID, paste.Title, body, paste.Syntax, paste.DeleteTime, paste.OneUse,
 		paste.Author, paste.AuthorEmail, paste.AuthorURL,
 		paste.IsFile, paste.FileName, paste.MimeType, paste.IsEditable, paste.IsPrivate, paste.IsURL, paste.OriginalURL,
+		strategy, len(paste.Body), paste.Encrypted, contentHash(paste, body, strategy),
 	)
 	if err != nil {
+		if strategy == BodyBlob && oldStrategy != BodyBlob {
+			db.bodies.removeBlobs([]string{paste.ID})
+		}
 		return err
 	}
+	db.bodies.recordWrite(strategy, len(paste.Body), time.Since(start))
+	db.cache.invalidate(paste.ID)
+	if oldStrategy == BodyBlob && strategy != BodyBlob {
+		db.bodies.removeBlobs([]string{paste.ID})
+	}
 
 	// Check result
 	rowsAffected, err := result.RowsAffected()
@@ -141,16 +284,18 @@ func (db DB) PasteUpdate(paste Paste) error {
 
 	// Also update in SQLite backup/cache if available
 	if db.backupPool != nil {
-		backupCtx, backupCancel := context.WithTimeout(context.Background(), defaultQueryTimeout)
+		backupCtx, backupCancel := context.WithTimeout(db.context(), defaultQueryTimeout)
 		defer backupCancel()
 		_, backupErr := db.backupPool.ExecContext(backupCtx,
 			`UPDATE pastes SET title = ?, body = ?, syntax = ?, delete_time = ?, one_use = ?,
 			author = ?, author_email = ?, author_url = ?,
-			is_file = ?, file_name = ?, mime_type = ?, is_editable = ?, is_private = ?, is_url = ?, original_url = ?
+			is_file = ?, file_name = ?, mime_type = ?, is_editable = ?, is_private = ?, is_url = ?, original_url = ?,
+			body_storage = ?, body_size = ?, is_encrypted = ?, content_hash = ?
 			WHERE id = ?`,
-			paste.Title, paste.Body, paste.Syntax, paste.DeleteTime, paste.OneUse,
+			paste.Title, body, paste.Syntax, paste.DeleteTime, paste.OneUse,
 			paste.Author, paste.AuthorEmail, paste.AuthorURL,
 			paste.IsFile, paste.FileName, paste.MimeType, paste.IsEditable, paste.IsPrivate, paste.IsURL, paste.OriginalURL,
+			strategy, len(paste.Body), paste.Encrypted, contentHash(paste, body, strategy),
 			paste.ID,
 		)
 		// Log backup errors but don't fail primary operation
@@ -159,12 +304,70 @@ func (db DB) PasteUpdate(paste Paste) error {
 		}
 	}
 
+	if held != "" {
+		return db.hold(paste.ID, held, false)
+	}
 	return nil
 }
 
 func (db DB) PasteDelete(id string) error {
+	if err := db.checkDelete(id); err != nil {
+		return err
+	}
+	return db.pasteDelete(id)
+}
+
+// PasteView counts a view of a one-use paste and deletes it after the last
+// one, returning the views left. The count goes down in a single UPDATE, so
+// concurrent readers never get more than MaxViews views between them: once
+// they are used up, ErrNotFoundID is returned even before the row is gone
+func (db DB) PasteView(id string) (int, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	result, err := db.pool.ExecContext(ctx,
+		`UPDATE pastes SET views_left = views_left - 1 WHERE id = $1 AND views_left > 0`,
+		id,
+	)
+	if err != nil {
+		return 0, err
+	}
+	counted, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	var maxViews, left int
+	err = db.pool.QueryRowContext(ctx,
+		`SELECT max_views, views_left FROM pastes WHERE id = $1`,
+		id,
+	).Scan(&maxViews, &left)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrNotFoundID
+		}
+		return 0, err
+	}
+
+	// Pastes from before view counts have one view
+	if counted == 0 && maxViews > 0 {
+		return 0, ErrNotFoundID
+	}
+	if left > 0 {
+		return left, nil
+	}
+
+	// Pastes under legal hold are kept after the last view
+	err = db.PasteDelete(id)
+	if err != nil && err != ErrLegalHold && err != ErrNotFoundID {
+		return 0, err
+	}
+	return 0, nil
+}
+
+func (db DB) pasteDelete(id string) error {
 	// Query timeout per AI.md PART 10
-	ctx, cancel := context.WithTimeout(context.Background(), defaultQueryTimeout)
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
 	defer cancel()
 
 	// Delete from primary database
@@ -186,9 +389,37 @@ func (db DB) PasteDelete(id string) error {
 		return ErrNotFoundID
 	}
 
+	// A deleted paste is no longer pinned or tagged
+	if _, err := db.pool.ExecContext(ctx, `DELETE FROM paste_pins WHERE paste_id = $1`, id); err != nil {
+		return err
+	}
+	if _, err := db.pool.ExecContext(ctx, `DELETE FROM paste_tags WHERE paste_id = $1`, id); err != nil {
+		return err
+	}
+	if err := db.pasteForkDelete(ctx, id); err != nil {
+		return err
+	}
+	if _, err := db.pool.ExecContext(ctx, `DELETE FROM paste_signatures WHERE paste_id = $1`, id); err != nil {
+		return err
+	}
+	if _, err := db.pool.ExecContext(ctx, `DELETE FROM share_links WHERE paste_id = $1`, id); err != nil {
+		return err
+	}
+	if _, err := db.pool.ExecContext(ctx, `DELETE FROM paste_gist_files WHERE paste_id = $1`, id); err != nil {
+		return err
+	}
+	if _, err := db.pool.ExecContext(ctx, `DELETE FROM paste_series_parts WHERE paste_id = $1`, id); err != nil {
+		return err
+	}
+	if _, err := db.pool.ExecContext(ctx, `DELETE FROM paste_freezes WHERE paste_id = $1`, id); err != nil {
+		return err
+	}
+	db.bodies.removeBlobs([]string{id})
+	db.cache.invalidate(id)
+
 	// Also delete from SQLite backup/cache if available
 	if db.backupPool != nil {
-		backupCtx, backupCancel := context.WithTimeout(context.Background(), defaultQueryTimeout)
+		backupCtx, backupCancel := context.WithTimeout(db.context(), defaultQueryTimeout)
 		defer backupCancel()
 		_, backupErr := db.backupPool.ExecContext(backupCtx, `DELETE FROM pastes WHERE id = ?`, id)
 		// Log backup errors but don't fail primary operation
@@ -200,25 +431,49 @@ func (db DB) PasteDelete(id string) error {
 	return nil
 }
 
+// PasteGet returns a paste; frozen pastes are not found, see moderation.go
 func (db DB) PasteGet(id string) (Paste, error) {
+	// Popular pastes are served from memory; the cache drops expired ones
+	// While the database is unavailable, cached pastes are served however
+	// long ago they were read, and the rest cannot be
+	if db.Unavailable() {
+		if paste, ok := db.cache.stale(id); ok {
+			return paste, nil
+		}
+		return Paste{}, db.reject()
+	}
+	if paste, ok := db.cache.get(id); ok {
+		return paste, nil
+	}
+	return db.pasteGet(id, true)
+}
+
+// pasteGet reads a paste from the database; hideFrozen makes a frozen paste
+// not found, and only visible pastes are cached
+func (db DB) pasteGet(id string, hideFrozen bool) (Paste, error) {
 	var paste Paste
 
 	// Query timeout per AI.md PART 10
-	ctx, cancel := context.WithTimeout(context.Background(), defaultQueryTimeout)
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
 	defer cancel()
 
 	// Make query
+	start := time.Now()
 	row := db.pool.QueryRowContext(ctx,
 		`SELECT id, title, body, syntax, create_time, delete_time, one_use, author, author_email, author_url,
-		is_file, file_name, mime_type, is_editable, is_private, is_url, original_url
+		is_file, file_name, mime_type, is_editable, is_private, is_url, original_url, body_storage, is_encrypted,
+		max_views, views_left, id IN (SELECT paste_id FROM paste_freezes)
 		FROM pastes WHERE id = $1`,
 		id,
 	)
 
 	// Read query
+	var strategy string
+	var frozen bool
 	err := row.Scan(&paste.ID, &paste.Title, &paste.Body, &paste.Syntax, &paste.CreateTime, &paste.DeleteTime, &paste.OneUse,
 		&paste.Author, &paste.AuthorEmail, &paste.AuthorURL,
-		&paste.IsFile, &paste.FileName, &paste.MimeType, &paste.IsEditable, &paste.IsPrivate, &paste.IsURL, &paste.OriginalURL)
+		&paste.IsFile, &paste.FileName, &paste.MimeType, &paste.IsEditable, &paste.IsPrivate, &paste.IsURL, &paste.OriginalURL,
+		&strategy, &paste.Encrypted, &paste.MaxViews, &paste.ViewsLeft, &frozen)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return paste, ErrNotFoundID
@@ -226,22 +481,54 @@ func (db DB) PasteGet(id string) (Paste, error) {
 
 		return paste, err
 	}
+	if frozen && hideFrozen {
+		return Paste{}, ErrNotFoundID
+	}
 
 	// Check paste expiration
 	if paste.DeleteTime < time.Now().Unix() && paste.DeleteTime > 0 {
-		// Delete expired paste with timeout
-		delCtx, delCancel := context.WithTimeout(context.Background(), defaultQueryTimeout)
-		defer delCancel()
-		_, err = db.pool.ExecContext(delCtx,
-			`DELETE FROM pastes WHERE id = $1`,
-			paste.ID,
-		)
-		if err != nil {
+		// Pinned pastes can be kept after they expire
+		if keep, err := db.keptAfterExpiry(paste.ID); err != nil {
 			return Paste{}, err
+		} else if !keep {
+			// Delete expired paste with timeout (pastes under legal hold are kept)
+			delCtx, delCancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+			defer delCancel()
+			result, err := db.pool.ExecContext(delCtx,
+				`DELETE FROM pastes WHERE id = $1 AND id NOT IN (SELECT paste_id FROM paste_legal_holds)`,
+				paste.ID,
+			)
+			if err != nil {
+				return Paste{}, err
+			}
+			if n, _ := result.RowsAffected(); n > 0 && strategy == BodyBlob {
+				db.bodies.removeBlobs([]string{paste.ID})
+			}
+
+			// Return ErrNotFound
+			return Paste{}, ErrNotFoundID
 		}
+	}
 
-		// Return ErrNotFound
-		return Paste{}, ErrNotFoundID
+	paste.Body, err = db.bodies.decode(ctx, paste.ID, paste.Body, strategy)
+	if err != nil {
+		return Paste{}, err
+	}
+	paste.Tags, err = db.pasteTags(ctx, paste.ID)
+	if err != nil {
+		return Paste{}, err
+	}
+	paste.ForkOf, paste.Forks, err = db.pasteForkInfo(ctx, paste.ID)
+	if err != nil {
+		return Paste{}, err
+	}
+	paste.Series, paste.SeriesPart, err = db.pasteSeriesInfo(ctx, paste.ID)
+	if err != nil {
+		return Paste{}, err
+	}
+	db.bodies.recordRead(strategy, time.Since(start))
+	if !frozen {
+		db.cache.put(paste)
 	}
 
 	return paste, nil
@@ -249,17 +536,63 @@ func (db DB) PasteGet(id string) (Paste, error) {
 
 func (db DB) PasteDeleteExpired() (int64, error) {
 	// Batch timeout per AI.md PART 10 (longer for batch operations)
-	ctx, cancel := context.WithTimeout(context.Background(), defaultBatchTimeout)
+	ctx, cancel := context.WithTimeout(db.context(), defaultBatchTimeout)
 	defer cancel()
 
+	// Blob-stored bodies of the expired pastes are deleted with them
+	now := time.Now().Unix()
+	var blobIDs []string
+	if db.bodies != nil {
+		rows, err := db.pool.QueryContext(ctx,
+			`SELECT id FROM pastes WHERE (delete_time < $1) AND (delete_time > 0) AND body_storage = $2
+			AND id NOT IN (SELECT paste_id FROM paste_legal_holds)
+			AND id NOT IN (SELECT paste_id FROM paste_pins WHERE keep_after_expiry = true)`,
+			now, BodyBlob,
+		)
+		if err != nil {
+			return 0, err
+		}
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return 0, err
+			}
+			blobIDs = append(blobIDs, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+	}
+
 	// Delete from primary database
 	result, err := db.pool.ExecContext(ctx,
-		`DELETE FROM pastes WHERE (delete_time < $1) AND (delete_time > 0)`,
-		time.Now().Unix(),
+		`DELETE FROM pastes WHERE (delete_time < $1) AND (delete_time > 0)
+		AND id NOT IN (SELECT paste_id FROM paste_legal_holds)
+		AND id NOT IN (SELECT paste_id FROM paste_pins WHERE keep_after_expiry = true)`,
+		now,
 	)
 	if err != nil {
 		return 0, err
 	}
+	db.bodies.removeBlobs(blobIDs)
+	// Also drops the tags of pastes deleted when they were read after expiry
+	if err := db.pasteTagsCleanup(ctx); err != nil {
+		return 0, err
+	}
+	if err := db.pasteForksCleanup(ctx); err != nil {
+		return 0, err
+	}
+	if err := db.shareLinksCleanup(ctx); err != nil {
+		return 0, err
+	}
+	if err := db.gistFilesCleanup(ctx); err != nil {
+		return 0, err
+	}
+	if err := db.seriesCleanup(ctx); err != nil {
+		return 0, err
+	}
 
 	// Check result
 	rowsAffected, err := result.RowsAffected()
@@ -269,12 +602,9 @@ func (db DB) PasteDeleteExpired() (int64, error) {
 
 	// Also delete from SQLite backup/cache if available
 	if db.backupPool != nil {
-		backupCtx, backupCancel := context.WithTimeout(context.Background(), defaultBatchTimeout)
+		backupCtx, backupCancel := context.WithTimeout(db.context(), defaultBatchTimeout)
 		defer backupCancel()
-		_, backupErr := db.backupPool.ExecContext(backupCtx,
-			`DELETE FROM pastes WHERE (delete_time < ?) AND (delete_time > 0)`,
-			time.Now().Unix(),
-		)
+		backupErr := db.backupDeleteExpired(backupCtx, ctx, now)
 		// Log backup errors but don't fail primary operation
 		if backupErr != nil {
 			log.Printf("[WARN] storage: backup delete expired failed: %v", backupErr)
@@ -284,15 +614,95 @@ func (db DB) PasteDeleteExpired() (int64, error) {
 	return rowsAffected, nil
 }
 
+// backupDeleteExpired deletes the expired pastes from the backup database
+// Legal holds and pins are kept in the primary database only, so the expired
+// pastes still there after its delete are the held ones, and are kept too
+func (db DB) backupDeleteExpired(backupCtx, ctx context.Context, now int64) error {
+	rows, err := db.pool.QueryContext(ctx,
+		`SELECT id FROM pastes WHERE (delete_time < $1) AND (delete_time > 0)`, now)
+	if err != nil {
+		return err
+	}
+	args := []interface{}{now}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		args = append(args, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	query := `DELETE FROM pastes WHERE (delete_time < ?) AND (delete_time > 0)`
+	if len(args) > 1 {
+		query += ` AND id NOT IN (?` + strings.Repeat(`, ?`, len(args)-2) + `)`
+	}
+	_, err = db.backupPool.ExecContext(backupCtx, query, args...)
+	return err
+}
+
+// ExpiredPaste is a paste PasteDeleteExpired would delete
+type ExpiredPaste struct {
+	ID         string
+	DeleteTime int64
+	// True when the body is in the blob store and is deleted with the paste
+	Blob bool
+	// Number of tags deleted with the paste
+	Tags int
+}
+
+// PasteListExpired returns the pastes PasteDeleteExpired would delete,
+// without deleting them
+func (db DB) PasteListExpired() ([]ExpiredPaste, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultBatchTimeout)
+	defer cancel()
+
+	rows, err := db.pool.QueryContext(ctx,
+		`SELECT p.id, p.delete_time, COALESCE(p.body_storage, ''),
+			(SELECT COUNT(*) FROM paste_tags pt WHERE pt.paste_id = p.id)
+		FROM pastes p
+		WHERE (p.delete_time < $1) AND (p.delete_time > 0)
+		AND p.id NOT IN (SELECT paste_id FROM paste_legal_holds)
+		AND p.id NOT IN (SELECT paste_id FROM paste_pins WHERE keep_after_expiry = true)
+		ORDER BY p.delete_time, p.id`,
+		time.Now().Unix(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pastes []ExpiredPaste
+	for rows.Next() {
+		var paste ExpiredPaste
+		var bodyStorage string
+		if err := rows.Scan(&paste.ID, &paste.DeleteTime, &bodyStorage, &paste.Tags); err != nil {
+			return nil, err
+		}
+		paste.Blob = bodyStorage == BodyBlob
+		pastes = append(pastes, paste)
+	}
+	return pastes, rows.Err()
+}
+
 type PasteListItem struct {
 	ID         string `json:"id"`
 	Title      string `json:"title"`
 	Syntax     string `json:"syntax"`
 	CreateTime int64  `json:"createTime"`
 	DeleteTime int64  `json:"deleteTime"`
+	// True for pastes pinned by an admin, which are listed first
+	Pinned bool     `json:"pinned"`
+	Tags   []string `json:"tags,omitempty"`
 }
 
-func (db DB) PasteList(limit int, offset int) ([]PasteListItem, error) {
+// PasteList returns a page of the public list; a non-empty tag lists only
+// the pastes with that tag
+func (db DB) PasteList(limit int, offset int, tag string) ([]PasteListItem, error) {
 	if limit <= 0 || limit > 100 {
 		limit = 50 // Default limit
 	}
@@ -301,20 +711,24 @@ func (db DB) PasteList(limit int, offset int) ([]PasteListItem, error) {
 	}
 
 	// List timeout per AI.md PART 10 (longer for list queries)
-	ctx, cancel := context.WithTimeout(context.Background(), defaultListTimeout)
+	ctx, cancel := context.WithTimeout(db.context(), defaultListTimeout)
 	defer cancel()
 
 	// Query pastes (exclude expired, one-use, and private pastes)
+	// Pinned pastes come first, including expired ones kept by their pin
 	rows, err := db.pool.QueryContext(ctx,
-		`SELECT id, title, syntax, create_time, delete_time
-		FROM pastes
-		WHERE (delete_time > $1 OR delete_time = 0)
-		AND is_private = false
-		ORDER BY create_time DESC
+		`SELECT p.id, p.title, p.syntax, p.create_time, p.delete_time, pp.paste_id IS NOT NULL
+		FROM pastes p LEFT JOIN paste_pins pp ON pp.paste_id = p.id
+		WHERE (p.delete_time > $1 OR p.delete_time = 0 OR pp.keep_after_expiry = true)
+		AND p.is_private = false
+		AND p.id NOT IN (SELECT paste_id FROM paste_freezes)
+		AND ($4 = '' OR p.id IN (SELECT paste_id FROM paste_tags WHERE tag = $4))
+		ORDER BY CASE WHEN pp.paste_id IS NULL THEN 1 ELSE 0 END, pp.position, p.create_time DESC
 		LIMIT $2 OFFSET $3`,
 		time.Now().Unix(),
 		limit,
 		offset,
+		tag,
 	)
 	if err != nil {
 		return nil, err
@@ -324,7 +738,7 @@ func (db DB) PasteList(limit int, offset int) ([]PasteListItem, error) {
 	var pastes []PasteListItem
 	for rows.Next() {
 		var paste PasteListItem
-		err := rows.Scan(&paste.ID, &paste.Title, &paste.Syntax, &paste.CreateTime, &paste.DeleteTime)
+		err := rows.Scan(&paste.ID, &paste.Title, &paste.Syntax, &paste.CreateTime, &paste.DeleteTime, &paste.Pinned)
 		if err != nil {
 			return nil, err
 		}
@@ -334,6 +748,133 @@ func (db DB) PasteList(limit int, offset int) ([]PasteListItem, error) {
 	if err = rows.Err(); err != nil {
 		return nil, err
 	}
+	rows.Close()
+
+	if err = db.pasteTagsFill(ctx, pastes); err != nil {
+		return nil, err
+	}
 
 	return pastes, nil
 }
+
+// PasteListCount returns how many pastes PasteList has for tag
+func (db DB) PasteListCount(tag string) (int, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultListTimeout)
+	defer cancel()
+
+	var count int
+	err := db.pool.QueryRowContext(ctx,
+		`SELECT COUNT(*)
+		FROM pastes p LEFT JOIN paste_pins pp ON pp.paste_id = p.id
+		WHERE (p.delete_time > $1 OR p.delete_time = 0 OR pp.keep_after_expiry = true)
+		AND p.is_private = false
+		AND p.id NOT IN (SELECT paste_id FROM paste_freezes)
+		AND ($2 = '' OR p.id IN (SELECT paste_id FROM paste_tags WHERE tag = $2))`,
+		time.Now().Unix(),
+		tag,
+	).Scan(&count)
+	return count, err
+}
+
+// PasteRelated returns other public pastes by the same author or with the same syntax
+// Same-author pastes are listed first; plaintext syntax alone is not considered related
+func (db DB) PasteRelated(paste Paste, limit int) ([]PasteListItem, error) {
+	if limit <= 0 || limit > 20 {
+		limit = 5
+	}
+
+	syntax := paste.Syntax
+	if syntax == "plaintext" {
+		syntax = ""
+	}
+	if paste.Author == "" && syntax == "" {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(db.context(), defaultListTimeout)
+	defer cancel()
+
+	rows, err := db.pool.QueryContext(ctx,
+		`SELECT id, title, syntax, create_time, delete_time
+		FROM pastes
+		WHERE (delete_time > $1 OR delete_time = 0)
+		AND is_private = false AND one_use = false AND is_url = false AND is_encrypted = false
+		AND id != $2 AND id NOT IN (SELECT paste_id FROM paste_freezes)
+		AND ((author != '' AND author = $3) OR (syntax != '' AND syntax = $4))
+		ORDER BY CASE WHEN author = $5 THEN 0 ELSE 1 END, create_time DESC
+		LIMIT $6`,
+		time.Now().Unix(),
+		paste.ID,
+		paste.Author,
+		syntax,
+		paste.Author,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pastes []PasteListItem
+	for rows.Next() {
+		var item PasteListItem
+		err := rows.Scan(&item.ID, &item.Title, &item.Syntax, &item.CreateTime, &item.DeleteTime)
+		if err != nil {
+			return nil, err
+		}
+		pastes = append(pastes, item)
+	}
+
+	return pastes, rows.Err()
+}
+
+// PasteListPublic returns full public pastes oldest first, for exports
+// One-use, private, encrypted, URL-shortener and expired pastes are excluded
+func (db DB) PasteListPublic(limit int, offset int) ([]Paste, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	ctx, cancel := context.WithTimeout(db.context(), defaultBatchTimeout)
+	defer cancel()
+
+	rows, err := db.pool.QueryContext(ctx,
+		`SELECT id, title, body, syntax, create_time, delete_time, one_use, author, author_email, author_url,
+		is_file, file_name, mime_type, is_editable, is_private, is_url, original_url, body_storage, is_encrypted
+		FROM pastes
+		WHERE (delete_time > $1 OR delete_time = 0)
+		AND is_private = false AND one_use = false AND is_url = false AND is_encrypted = false
+		AND id NOT IN (SELECT paste_id FROM paste_freezes)
+		ORDER BY create_time ASC, id ASC
+		LIMIT $2 OFFSET $3`,
+		time.Now().Unix(),
+		limit,
+		offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pastes []Paste
+	for rows.Next() {
+		var paste Paste
+		var strategy string
+		err := rows.Scan(&paste.ID, &paste.Title, &paste.Body, &paste.Syntax, &paste.CreateTime, &paste.DeleteTime, &paste.OneUse,
+			&paste.Author, &paste.AuthorEmail, &paste.AuthorURL,
+			&paste.IsFile, &paste.FileName, &paste.MimeType, &paste.IsEditable, &paste.IsPrivate, &paste.IsURL, &paste.OriginalURL,
+			&strategy, &paste.Encrypted)
+		if err != nil {
+			return nil, err
+		}
+		if paste.Body, err = db.bodies.decode(ctx, paste.ID, paste.Body, strategy); err != nil {
+			return nil, err
+		}
+		pastes = append(pastes, paste)
+	}
+
+	return pastes, rows.Err()
+}
@@ -0,0 +1,73 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package storage
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPasteDeleteExpiredKeepsHeld(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "caspaste.db")
+	if err := InitDB("sqlite", src); err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewPool("sqlite", src, 5, 2, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// The backup database a postgres or mysql server keeps next to the primary
+	backupSrc := filepath.Join(dir, "backup.db")
+	if err := InitDB("sqlite", backupSrc); err != nil {
+		t.Fatal(err)
+	}
+	db.backupPool, err = sql.Open("sqlite", backupSrc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := map[string]string{}
+	for _, name := range []string{"held", "pinned", "expired"} {
+		id, _, _, err := db.PasteAdd(Paste{Title: name, Body: name, Syntax: "plaintext"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[name] = id
+	}
+	if err := db.PasteLegalHoldSet(ids["held"], "litigation", "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.PastePinSet(PastePin{PasteID: ids["pinned"], KeepAfterExpiry: true, CreatedBy: "admin"}); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Hour).Unix()
+	for _, pool := range []*sql.DB{db.pool, db.backupPool} {
+		if _, err := pool.Exec(`UPDATE pastes SET delete_time = ?`, past); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := db.PasteDeleteExpired(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, pool := range map[string]*sql.DB{"primary": db.pool, "backup": db.backupPool} {
+		for paste, exp := range map[string]bool{"held": true, "pinned": true, "expired": false} {
+			var n int
+			if err := pool.QueryRow(`SELECT COUNT(*) FROM pastes WHERE id = ?`, ids[paste]).Scan(&n); err != nil {
+				t.Fatal(err)
+			}
+			if res := n == 1; res != exp {
+				t.Error("expected", paste, "paste kept in", name, exp, "but got", res)
+			}
+		}
+	}
+}
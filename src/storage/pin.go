@@ -0,0 +1,191 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Pinned pastes are listed first on the public list and on the homepage
+// An admin can also keep a pinned paste after it expires, for server docs and
+// announcements that should stay up
+
+var (
+	ErrNotPinned     = errors.New("db: paste is not pinned")
+	ErrPinNotAllowed = errors.New("db: private and burn-after-reading pastes cannot be pinned")
+)
+
+// PastePin places a paste at the top of the public list
+// Pins are ordered by Position, lowest first
+type PastePin struct {
+	PasteID         string `json:"paste_id"`
+	Title           string `json:"title"`
+	Position        int    `json:"position"`
+	KeepAfterExpiry bool   `json:"keep_after_expiry"`
+	CreatedBy       string `json:"created_by"`
+	CreatedAt       int64  `json:"created_at"`
+}
+
+// PastePinSet pins a paste, or changes the position and expiry of its pin
+func (db DB) PastePinSet(pin PastePin) (PastePin, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	// Expired pastes may still be in the table; they can be pinned to keep them
+	var private, oneUse bool
+	err := db.pool.QueryRowContext(ctx,
+		`SELECT title, is_private, one_use FROM pastes WHERE id = $1`, pin.PasteID,
+	).Scan(&pin.Title, &private, &oneUse)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return pin, ErrNotFoundID
+		}
+		return pin, err
+	}
+	if private || oneUse {
+		return pin, ErrPinNotAllowed
+	}
+
+	result, err := db.pool.ExecContext(ctx,
+		`UPDATE paste_pins SET position = $2, keep_after_expiry = $3 WHERE paste_id = $1`,
+		pin.PasteID, pin.Position, pin.KeepAfterExpiry,
+	)
+	if err != nil {
+		return pin, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return pin, err
+	}
+	if rowsAffected > 0 {
+		return db.PastePinGet(pin.PasteID)
+	}
+
+	pin.CreatedAt = time.Now().Unix()
+	_, err = db.pool.ExecContext(ctx,
+		`INSERT INTO paste_pins (paste_id, position, keep_after_expiry, created_by, created_at) VALUES ($1, $2, $3, $4, $5)`,
+		pin.PasteID, pin.Position, pin.KeepAfterExpiry, pin.CreatedBy, pin.CreatedAt,
+	)
+	return pin, err
+}
+
+// PastePinRemove unpins a paste
+func (db DB) PastePinRemove(id string) error {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	result, err := db.pool.ExecContext(ctx, `DELETE FROM paste_pins WHERE paste_id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotPinned
+	}
+	return nil
+}
+
+// PastePinGet returns the pin of a paste, or ErrNotPinned
+func (db DB) PastePinGet(id string) (PastePin, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	var pin PastePin
+	err := db.pool.QueryRowContext(ctx,
+		`SELECT pp.paste_id, p.title, pp.position, pp.keep_after_expiry, pp.created_by, pp.created_at
+		FROM paste_pins pp JOIN pastes p ON p.id = pp.paste_id
+		WHERE pp.paste_id = $1`,
+		id,
+	).Scan(&pin.PasteID, &pin.Title, &pin.Position, &pin.KeepAfterExpiry, &pin.CreatedBy, &pin.CreatedAt)
+	if err == sql.ErrNoRows {
+		return pin, ErrNotPinned
+	}
+	return pin, err
+}
+
+// PastePins lists every pin in display order, including pins of expired pastes
+func (db DB) PastePins() ([]PastePin, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultListTimeout)
+	defer cancel()
+
+	rows, err := db.pool.QueryContext(ctx,
+		`SELECT pp.paste_id, p.title, pp.position, pp.keep_after_expiry, pp.created_by, pp.created_at
+		FROM paste_pins pp JOIN pastes p ON p.id = pp.paste_id
+		ORDER BY pp.position, pp.created_at`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pins := []PastePin{}
+	for rows.Next() {
+		var pin PastePin
+		if err := rows.Scan(&pin.PasteID, &pin.Title, &pin.Position, &pin.KeepAfterExpiry, &pin.CreatedBy, &pin.CreatedAt); err != nil {
+			return nil, err
+		}
+		pins = append(pins, pin)
+	}
+	return pins, rows.Err()
+}
+
+// PastePinned returns the pinned pastes visitors can see, in display order
+func (db DB) PastePinned(limit int) ([]PasteListItem, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 10
+	}
+
+	ctx, cancel := context.WithTimeout(db.context(), defaultListTimeout)
+	defer cancel()
+
+	rows, err := db.pool.QueryContext(ctx,
+		`SELECT p.id, p.title, p.syntax, p.create_time, p.delete_time
+		FROM paste_pins pp JOIN pastes p ON p.id = pp.paste_id
+		WHERE (p.delete_time > $1 OR p.delete_time = 0 OR pp.keep_after_expiry = true)
+		AND p.is_private = false
+		AND p.id NOT IN (SELECT paste_id FROM paste_freezes)
+		ORDER BY pp.position, pp.created_at
+		LIMIT $2`,
+		time.Now().Unix(),
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pastes []PasteListItem
+	for rows.Next() {
+		item := PasteListItem{Pinned: true}
+		if err := rows.Scan(&item.ID, &item.Title, &item.Syntax, &item.CreateTime, &item.DeleteTime); err != nil {
+			return nil, err
+		}
+		pastes = append(pastes, item)
+	}
+	return pastes, rows.Err()
+}
+
+// keptAfterExpiry reports whether a paste is pinned to outlive its expiry
+func (db DB) keptAfterExpiry(id string) (bool, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	var keep bool
+	err := db.pool.QueryRowContext(ctx,
+		`SELECT keep_after_expiry FROM paste_pins WHERE paste_id = $1`, id,
+	).Scan(&keep)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return keep, err
+}
@@ -0,0 +1,68 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"log"
+)
+
+// New and edited pastes can be scanned for spam and abuse; a paste that
+// matches is stored frozen, by HeldBy, so it stays hidden until an admin
+// unfreezes (approves) or deletes it
+
+// ErrHeldForReview is returned with the ID of a paste that was stored but
+// frozen by the scanner
+var ErrHeldForReview = errors.New("db: paste is held for review")
+
+// HeldBy is who pastes held by the scanner are frozen by
+const HeldBy = "spam filter"
+
+// PasteScanner decides whether a new or edited paste is published
+type PasteScanner interface {
+	// ScanPaste returns why paste is held for review, or "" to publish it
+	ScanPaste(ctx context.Context, paste Paste) string
+	// Held is called once a paste is stored frozen, with the address it
+	// came from
+	Held(pasteID, reason, ip string)
+}
+
+// SetScanner scans new and edited pastes; without one all are published
+// Call before the DB value is copied into handlers
+func (db *DB) SetScanner(s PasteScanner) {
+	db.scanner = s
+}
+
+// scan returns why paste is held for review, or ""
+func (db DB) scan(paste Paste) string {
+	if db.scanner == nil {
+		return ""
+	}
+	return db.scanner.ScanPaste(db.context(), paste)
+}
+
+// hold freezes a stored paste for the reason scan gave and returns
+// ErrHeldForReview; an edited paste that is already frozen stays frozen
+// A new paste that cannot be frozen is deleted rather than published
+func (db DB) hold(id, reason string, created bool) error {
+	err := db.PasteFreeze(id, reason, HeldBy)
+	if errors.Is(err, ErrFrozen) {
+		return ErrHeldForReview
+	}
+	if err != nil {
+		log.Printf("[WARN] storage: cannot hold paste %s for review: %v", id, err)
+		if !created {
+			return err
+		}
+		if err := db.pasteDelete(id); err != nil {
+			log.Printf("[WARN] storage: cannot delete paste %s after failing to hold it: %v", id, err)
+		}
+		return err
+	}
+	db.scanner.Held(id, reason, db.clientIP)
+	return ErrHeldForReview
+}
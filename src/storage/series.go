@@ -0,0 +1,215 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/securetoken"
+)
+
+// A series links pastes as the numbered parts of one text, e.g. a log
+// dump larger than the body size limit
+// The series takes the ID of its first part. Appending needs the key
+// returned when the series was started; only a hash of it is stored
+
+var (
+	ErrSeriesKey  = errors.New("db: wrong series key")
+	ErrSeriesFull = errors.New("db: series has too many parts")
+)
+
+// MaxSeriesParts is the most parts a series can have
+const MaxSeriesParts = 1000
+
+// Series is the parts of a series that still exist, in order
+type Series struct {
+	ID         string       `json:"id"`
+	CreateTime int64        `json:"createTime"`
+	Parts      []SeriesPart `json:"parts"`
+}
+
+// SeriesPart is one paste of a series; Part counts from 1 and keeps its
+// number when other parts are deleted
+type SeriesPart struct {
+	Part       int    `json:"part"`
+	ID         string `json:"id"`
+	Title      string `json:"title"`
+	CreateTime int64  `json:"createTime"`
+	DeleteTime int64  `json:"deleteTime"`
+	// Body size in bytes
+	Size int64 `json:"size"`
+}
+
+// SeriesStart makes pasteID part 1 of a new series and returns the key
+// later parts are appended with
+func (db DB) SeriesStart(pasteID string) (string, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	key, err := genTokenCrypto(32)
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := db.pool.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO paste_series (id, key_hash, create_time) VALUES ($1, $2, $3)`,
+		pasteID, securetoken.Hash(key), time.Now().Unix(),
+	)
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO paste_series_parts (series_id, part, paste_id) VALUES ($1, $2, $3)`,
+		pasteID, 1, pasteID,
+	)
+	if err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	db.cache.invalidate(pasteID)
+	return key, nil
+}
+
+// seriesCheckKey returns ErrNotFoundID if there is no series id and
+// ErrSeriesKey if key is not its key
+func (db DB) seriesCheckKey(ctx context.Context, tx *sql.Tx, id, key string) error {
+	var keyHash string
+	err := tx.QueryRowContext(ctx, `SELECT key_hash FROM paste_series WHERE id = $1`, id).Scan(&keyHash)
+	if err == sql.ErrNoRows {
+		return ErrNotFoundID
+	} else if err != nil {
+		return err
+	}
+	if !securetoken.MatchesHash(key, keyHash) {
+		return ErrSeriesKey
+	}
+	return nil
+}
+
+// SeriesAppend adds pasteID as the next part of series id and returns its
+// part number
+func (db DB) SeriesAppend(id, key, pasteID string) (int, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	tx, err := db.pool.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := db.seriesCheckKey(ctx, tx, id, key); err != nil {
+		return 0, err
+	}
+	var last int
+	err = tx.QueryRowContext(ctx,
+		`SELECT COALESCE(MAX(part), 0) FROM paste_series_parts WHERE series_id = $1`, id,
+	).Scan(&last)
+	if err != nil {
+		return 0, err
+	}
+	if last >= MaxSeriesParts {
+		return 0, ErrSeriesFull
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO paste_series_parts (series_id, part, paste_id) VALUES ($1, $2, $3)`,
+		id, last+1, pasteID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	db.cache.invalidate(pasteID)
+	return last + 1, nil
+}
+
+// SeriesGet returns the parts of a series that can still be read; a series
+// whose parts have all expired or been deleted is not found
+func (db DB) SeriesGet(id string) (Series, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultListTimeout)
+	defer cancel()
+
+	series := Series{ID: id, Parts: []SeriesPart{}}
+	err := db.pool.QueryRowContext(ctx, `SELECT create_time FROM paste_series WHERE id = $1`, id).Scan(&series.CreateTime)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return series, ErrNotFoundID
+		}
+		return series, err
+	}
+
+	// Expired parts are left for the expiry job, unless pinned to be kept
+	rows, err := db.pool.QueryContext(ctx,
+		`SELECT s.part, p.id, p.title, p.create_time, p.delete_time, p.body_size
+		FROM paste_series_parts s JOIN pastes p ON p.id = s.paste_id
+		WHERE s.series_id = $1
+		AND (p.delete_time = 0 OR p.delete_time >= $2
+			OR p.id IN (SELECT paste_id FROM paste_pins WHERE keep_after_expiry = true))
+		AND p.id NOT IN (SELECT paste_id FROM paste_freezes)
+		ORDER BY s.part`,
+		id, time.Now().Unix(),
+	)
+	if err != nil {
+		return series, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var part SeriesPart
+		if err := rows.Scan(&part.Part, &part.ID, &part.Title, &part.CreateTime, &part.DeleteTime, &part.Size); err != nil {
+			return series, err
+		}
+		series.Parts = append(series.Parts, part)
+	}
+	if err := rows.Err(); err != nil {
+		return series, err
+	}
+	if len(series.Parts) == 0 {
+		return series, ErrNotFoundID
+	}
+	return series, nil
+}
+
+// pasteSeriesInfo returns the series a paste is part of ("" if none) and
+// its part number
+func (db DB) pasteSeriesInfo(ctx context.Context, id string) (string, int, error) {
+	var seriesID string
+	var part int
+	err := db.pool.QueryRowContext(ctx,
+		`SELECT series_id, part FROM paste_series_parts WHERE paste_id = $1`, id,
+	).Scan(&seriesID, &part)
+	if err == sql.ErrNoRows {
+		return "", 0, nil
+	}
+	return seriesID, part, err
+}
+
+// seriesCleanup drops the parts of deleted pastes, and series left with none
+func (db DB) seriesCleanup(ctx context.Context) error {
+	_, err := db.pool.ExecContext(ctx,
+		`DELETE FROM paste_series_parts WHERE paste_id NOT IN (SELECT id FROM pastes)`,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = db.pool.ExecContext(ctx,
+		`DELETE FROM paste_series WHERE id NOT IN (SELECT series_id FROM paste_series_parts)`,
+	)
+	return err
+}
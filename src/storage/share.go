@@ -7,26 +7,9 @@
 package storage
 
 import (
-	"crypto/rand"
-	"math/big"
+	"github.com/casjay-forks/caspaste/src/securetoken"
 )
 
 func genTokenCrypto(tokenLen int) (string, error) {
-	// Generate token
-	var chars = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
-	charsLen := int64(len(chars))
-	charsLenBig := big.NewInt(charsLen)
-
-	token := ""
-
-	for i := 0; i < tokenLen; i++ {
-		randInt, err := rand.Int(rand.Reader, charsLenBig)
-		if err != nil {
-			return "", err
-		}
-
-		token = token + string(chars[randInt.Int64()])
-	}
-
-	return token, nil
+	return securetoken.GenerateString(tokenLen, securetoken.AlphaNum)
 }
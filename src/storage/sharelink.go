@@ -0,0 +1,142 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/securetoken"
+)
+
+var ErrShareLinkNotFound = errors.New("db: share link not found")
+
+// ShareLinkMaxTTL is the longest a share link can stay valid
+const ShareLinkMaxTTL = 30 * 24 * time.Hour
+
+// ShareLink is a time-limited URL (/s/{token}) that opens a paste without
+// logging in, whatever the paste's own expiration
+// Only a hash of the token is stored, so the token is shown once at creation;
+// ID names the link when listing and revoking. Times are unix seconds
+type ShareLink struct {
+	ID        string `json:"id"`
+	PasteID   string `json:"pasteId"`
+	CreatedBy string `json:"createdBy"`
+	CreatedAt int64  `json:"createdAt"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+const shareLinkColumns = `id, paste_id, created_by, created_at, expires_at`
+
+func scanShareLink(row interface{ Scan(...any) error }) (ShareLink, error) {
+	var l ShareLink
+	err := row.Scan(&l.ID, &l.PasteID, &l.CreatedBy, &l.CreatedAt, &l.ExpiresAt)
+	return l, err
+}
+
+// ShareLinkAdd creates a link to a paste that is valid for ttl and returns
+// its token with the link
+func (db DB) ShareLinkAdd(pasteID, createdBy string, ttl time.Duration) (string, ShareLink, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	link := ShareLink{
+		PasteID:   pasteID,
+		CreatedBy: createdBy,
+		CreatedAt: time.Now().Unix(),
+	}
+	link.ExpiresAt = link.CreatedAt + int64(ttl/time.Second)
+
+	var err error
+	link.ID, err = genTokenCrypto(8)
+	if err != nil {
+		return "", link, err
+	}
+	token, err := genTokenCrypto(32)
+	if err != nil {
+		return "", link, err
+	}
+
+	_, err = db.pool.ExecContext(ctx,
+		`INSERT INTO share_links (token_hash, `+shareLinkColumns+`) VALUES ($1, $2, $3, $4, $5, $6)`,
+		securetoken.Hash(token), link.ID, link.PasteID, link.CreatedBy, link.CreatedAt, link.ExpiresAt,
+	)
+	if err != nil {
+		return "", link, err
+	}
+	return token, link, nil
+}
+
+// ShareLinkGet returns the link of a token, or ErrShareLinkNotFound if there
+// is none or it expired
+func (db DB) ShareLinkGet(token string) (ShareLink, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	l, err := scanShareLink(db.pool.QueryRowContext(ctx,
+		`SELECT `+shareLinkColumns+` FROM share_links WHERE token_hash = $1 AND expires_at > $2`,
+		securetoken.Hash(token), time.Now().Unix(),
+	))
+	if err == sql.ErrNoRows {
+		return l, ErrShareLinkNotFound
+	}
+	return l, err
+}
+
+// ShareLinkList returns the links of a paste that have not expired, newest first
+func (db DB) ShareLinkList(pasteID string) ([]ShareLink, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultListTimeout)
+	defer cancel()
+
+	rows, err := db.pool.QueryContext(ctx,
+		`SELECT `+shareLinkColumns+` FROM share_links WHERE paste_id = $1 AND expires_at > $2 ORDER BY created_at DESC`,
+		pasteID, time.Now().Unix(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []ShareLink{}
+	for rows.Next() {
+		l, err := scanShareLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, l)
+	}
+	return links, rows.Err()
+}
+
+// ShareLinkDelete revokes a link of a paste
+func (db DB) ShareLinkDelete(pasteID, id string) error {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	result, err := db.pool.ExecContext(ctx, `DELETE FROM share_links WHERE paste_id = $1 AND id = $2`, pasteID, id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrShareLinkNotFound
+	}
+	return nil
+}
+
+// shareLinksCleanup removes expired links and those of deleted pastes
+func (db DB) shareLinksCleanup(ctx context.Context) error {
+	_, err := db.pool.ExecContext(ctx,
+		`DELETE FROM share_links WHERE expires_at <= $1 OR paste_id NOT IN (SELECT id FROM pastes)`,
+		time.Now().Unix(),
+	)
+	return err
+}
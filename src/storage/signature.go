@@ -0,0 +1,305 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/pgp"
+)
+
+// MaxPGPKeys is the number of PGP keys kept per user
+const MaxPGPKeys = 10
+
+var (
+	ErrPGPKeyNotFound = errors.New("db: PGP key not found")
+	ErrPGPKeyExists   = errors.New("db: PGP key is already registered")
+	ErrPGPKeyLimit    = errors.New("db: too many PGP keys")
+	ErrPGPKeyProof    = errors.New("db: the proof is not a signature of the key's challenge")
+	ErrSignatureKey   = errors.New("db: no public key for the signature; register it or send it with the paste")
+)
+
+// Signature statuses
+const (
+	SignatureGood       = "good"
+	SignatureBad        = "bad"
+	SignatureUnknownKey = "unknown_key"
+)
+
+// PGPKey is a public key a user registered to sign pastes with
+type PGPKey struct {
+	Fingerprint string   `json:"fingerprint"`
+	UserIDs     []string `json:"userIds"`
+	PublicKey   string   `json:"publicKey"`
+	CreatedAt   int64    `json:"createdAt"`
+}
+
+// PGPKeyChallenge is the text a user signs with a key to register it, so
+// nobody can claim a key they do not hold
+func PGPKeyChallenge(owner string) string {
+	return "caspaste-pgp-key:" + owner
+}
+
+// PGPKeyAdd registers a public key for owner; proof is a detached signature
+// of PGPKeyChallenge(owner) made with it
+func (db DB) PGPKeyAdd(owner, publicKey, proof string) (PGPKey, error) {
+	key, err := pgp.ParseKey([]byte(publicKey))
+	if err != nil {
+		return PGPKey{}, err
+	}
+	sig, err := pgp.ParseSignature([]byte(proof))
+	if err != nil {
+		return PGPKey{}, err
+	}
+	if err := key.Verify([]byte(PGPKeyChallenge(owner)), sig); err != nil {
+		return PGPKey{}, ErrPGPKeyProof
+	}
+
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	var count int
+	err = db.pool.QueryRowContext(ctx, `SELECT COUNT(*) FROM pgp_keys WHERE owner = $1`, owner).Scan(&count)
+	if err != nil {
+		return PGPKey{}, err
+	}
+	if count >= MaxPGPKeys {
+		return PGPKey{}, ErrPGPKeyLimit
+	}
+
+	var exists int
+	err = db.pool.QueryRowContext(ctx, `SELECT COUNT(*) FROM pgp_keys WHERE fingerprint = $1`, key.Fingerprint).Scan(&exists)
+	if err != nil {
+		return PGPKey{}, err
+	}
+	if exists > 0 {
+		return PGPKey{}, ErrPGPKeyExists
+	}
+
+	// Key IDs are space-delimited so a LIKE finds whole IDs
+	result := PGPKey{
+		Fingerprint: key.Fingerprint,
+		UserIDs:     key.UserIDs,
+		PublicKey:   publicKey,
+		CreatedAt:   time.Now().Unix(),
+	}
+	_, err = db.pool.ExecContext(ctx,
+		`INSERT INTO pgp_keys (fingerprint, owner, key_ids, user_ids, public_key, created_at) VALUES ($1, $2, $3, $4, $5, $6)`,
+		result.Fingerprint, owner, " "+strings.Join(key.KeyIDs(), " ")+" ", strings.Join(key.UserIDs, "\n"), publicKey, result.CreatedAt,
+	)
+	if err != nil {
+		return PGPKey{}, err
+	}
+	return result, nil
+}
+
+// PGPKeyList returns the keys of a user, oldest first
+func (db DB) PGPKeyList(owner string) ([]PGPKey, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultListTimeout)
+	defer cancel()
+
+	rows, err := db.pool.QueryContext(ctx,
+		`SELECT fingerprint, user_ids, public_key, created_at FROM pgp_keys WHERE owner = $1 ORDER BY created_at`,
+		owner,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []PGPKey{}
+	for rows.Next() {
+		var k PGPKey
+		var userIDs string
+		if err := rows.Scan(&k.Fingerprint, &userIDs, &k.PublicKey, &k.CreatedAt); err != nil {
+			return nil, err
+		}
+		k.UserIDs = splitUserIDs(userIDs)
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// PGPKeyDelete removes a key of a user; pastes signed with it then show an
+// unknown key unless the key came with them
+func (db DB) PGPKeyDelete(owner, fingerprint string) error {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	result, err := db.pool.ExecContext(ctx, `DELETE FROM pgp_keys WHERE owner = $1 AND fingerprint = $2`, owner, strings.ToUpper(fingerprint))
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrPGPKeyNotFound
+	}
+	return nil
+}
+
+// SignatureStatus is the result of checking the signature of a paste
+type SignatureStatus struct {
+	// good, bad (the content does not match) or unknown_key
+	Status string `json:"status"`
+	// Primary key that made the signature, if known
+	Fingerprint string   `json:"fingerprint,omitempty"`
+	UserIDs     []string `json:"userIds,omitempty"`
+	// User that registered the key; empty when it only came with the paste
+	Owner string `json:"owner,omitempty"`
+	// Unix time the signature was made, if it says
+	SignedAt int64 `json:"signedAt,omitempty"`
+	// The armored signature as sent
+	Signature string `json:"signature"`
+
+	// Why the signature is not good
+	err error
+}
+
+// SignatureVerify checks a detached signature of content, against publicKey
+// or, when that is empty, the registered keys
+// Only a good signature returns no error
+func (db DB) SignatureVerify(content []byte, signature, publicKey string) (SignatureStatus, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	status, err := db.signatureVerify(ctx, content, signature, publicKey)
+	if err != nil {
+		return status, err
+	}
+	return status, status.err
+}
+
+// signatureVerify checks a signature; why it is not good is in status.err,
+// and only database errors are returned
+func (db DB) signatureVerify(ctx context.Context, content []byte, signature, publicKey string) (SignatureStatus, error) {
+	status := SignatureStatus{Status: SignatureUnknownKey, Signature: signature}
+
+	sig, err := pgp.ParseSignature([]byte(signature))
+	if err != nil {
+		status.err = err
+		return status, nil
+	}
+	if !sig.Created.IsZero() {
+		status.SignedAt = sig.Created.Unix()
+	}
+
+	// Candidate keys: the one sent with the paste, else registered ones
+	type candidate struct {
+		owner     string
+		publicKey string
+	}
+	var candidates []candidate
+	if publicKey != "" {
+		candidates = append(candidates, candidate{publicKey: publicKey})
+	} else if sig.IssuerKeyID != "" {
+		rows, err := db.pool.QueryContext(ctx,
+			`SELECT owner, public_key FROM pgp_keys WHERE key_ids LIKE $1`,
+			"% "+sig.IssuerKeyID+" %",
+		)
+		if err != nil {
+			return status, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var c candidate
+			if err := rows.Scan(&c.owner, &c.publicKey); err != nil {
+				return status, err
+			}
+			candidates = append(candidates, c)
+		}
+		if err := rows.Err(); err != nil {
+			return status, err
+		}
+	}
+
+	status.err = ErrSignatureKey
+	for _, c := range candidates {
+		key, err := pgp.ParseKey([]byte(c.publicKey))
+		if err != nil {
+			status.err = err
+			continue
+		}
+		status.err = key.Verify(content, sig)
+		if errors.Is(status.err, pgp.ErrWrongKey) {
+			continue
+		}
+
+		status.Fingerprint = key.Fingerprint
+		status.UserIDs = key.UserIDs
+		status.Owner = c.owner
+		if status.Owner == "" {
+			// A key sent with the paste may also be registered
+			ownerErr := db.pool.QueryRowContext(ctx, `SELECT owner FROM pgp_keys WHERE fingerprint = $1`, key.Fingerprint).Scan(&status.Owner)
+			if ownerErr != nil && ownerErr != sql.ErrNoRows {
+				return status, ownerErr
+			}
+		}
+		status.Status = SignatureGood
+		if status.err != nil {
+			status.Status = SignatureBad
+		}
+		return status, nil
+	}
+	return status, nil
+}
+
+// PasteSignatureSet attaches a signature, checked with SignatureVerify, to a
+// paste; publicKey may be empty when the key is registered
+func (db DB) PasteSignatureSet(id, signature, publicKey string) error {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	if _, err := db.pool.ExecContext(ctx, `DELETE FROM paste_signatures WHERE paste_id = $1`, id); err != nil {
+		return err
+	}
+	_, err := db.pool.ExecContext(ctx,
+		`INSERT INTO paste_signatures (paste_id, signature, public_key, created_at) VALUES ($1, $2, $3, $4)`,
+		id, signature, publicKey, time.Now().Unix(),
+	)
+	return err
+}
+
+// PasteSignatureGet checks the signature of a paste against its content, as
+// /raw/{id} serves it; nil when the paste is not signed
+// A signature that cannot be checked any more is reported, not returned as
+// an error
+func (db DB) PasteSignatureGet(id string, content []byte) (*SignatureStatus, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	var signature, publicKey string
+	err := db.pool.QueryRowContext(ctx, `SELECT signature, public_key FROM paste_signatures WHERE paste_id = $1`, id).Scan(&signature, &publicKey)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	status, err := db.signatureVerify(ctx, content, signature, publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// PasteSignatureDelete removes the signature of a paste, if it has one
+func (db DB) PasteSignatureDelete(id string) error {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	_, err := db.pool.ExecContext(ctx, `DELETE FROM paste_signatures WHERE paste_id = $1`, id)
+	return err
+}
+
+func splitUserIDs(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, "\n")
+}
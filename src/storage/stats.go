@@ -0,0 +1,183 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// PasteStats counts the pastes that have not expired
+// Bytes is the size of the bodies before compression (files are base64 encoded)
+type PasteStats struct {
+	Total   int64 `json:"total"`
+	Private int64 `json:"private"`
+	OneUse  int64 `json:"oneUse"`
+	Files   int64 `json:"files"`
+	URLs    int64 `json:"urls"`
+	Bytes   int64 `json:"bytes"`
+}
+
+// PasteStats returns counts of the live pastes, for monitoring
+func (db DB) PasteStats() (PasteStats, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultListTimeout)
+	defer cancel()
+
+	var stats PasteStats
+	err := db.pool.QueryRowContext(ctx,
+		`SELECT COUNT(*),
+			COALESCE(SUM(CASE WHEN is_private = true THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN one_use = true THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN is_file = true THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN is_url = true THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN body_size > 0 THEN body_size ELSE LENGTH(body) END), 0)
+		FROM pastes
+		WHERE delete_time > $1 OR delete_time = 0`,
+		time.Now().Unix(),
+	).Scan(&stats.Total, &stats.Private, &stats.OneUse, &stats.Files, &stats.URLs, &stats.Bytes)
+	return stats, err
+}
+
+// PasteSizeBucket counts the live pastes in a size range, by how their bodies are stored
+type PasteSizeBucket struct {
+	// Label of the range, e.g. "4K-16K"
+	Range  string `json:"range"`
+	Inline int64  `json:"inline"`
+	Zstd   int64  `json:"zstd"`
+	Gzip   int64  `json:"gzip"`
+	Blob   int64  `json:"blob"`
+	// Size of the bodies before compression
+	Bytes int64 `json:"bytes"`
+}
+
+// pasteSizeRanges are the upper bounds of the size buckets; the last is open
+var pasteSizeRanges = []struct {
+	label string
+	max   int64
+}{
+	{"<1K", 1 << 10},
+	{"1K-4K", 4 << 10},
+	{"4K-16K", 16 << 10},
+	{"16K-64K", 64 << 10},
+	{"64K-256K", 256 << 10},
+	{"256K-1M", 1 << 20},
+	{"1M-4M", 4 << 20},
+	{">=4M", 0},
+}
+
+// PasteSizes returns the size distribution of the live pastes
+func (db DB) PasteSizes() ([]PasteSizeBucket, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultListTimeout)
+	defer cancel()
+
+	// Pastes from before body_size existed are measured as stored
+	rows, err := db.pool.QueryContext(ctx,
+		`SELECT body_storage, CASE WHEN body_size > 0 THEN body_size ELSE LENGTH(body) END
+		FROM pastes
+		WHERE delete_time > $1 OR delete_time = 0`,
+		time.Now().Unix(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	buckets := make([]PasteSizeBucket, len(pasteSizeRanges))
+	for i, r := range pasteSizeRanges {
+		buckets[i].Range = r.label
+	}
+	for rows.Next() {
+		var strategy string
+		var size int64
+		if err := rows.Scan(&strategy, &size); err != nil {
+			return nil, err
+		}
+
+		i := len(pasteSizeRanges) - 1
+		for j, r := range pasteSizeRanges[:i] {
+			if size < r.max {
+				i = j
+				break
+			}
+		}
+		switch strategy {
+		case BodyZstd:
+			buckets[i].Zstd++
+		case BodyGzip:
+			buckets[i].Gzip++
+		case BodyBlob:
+			buckets[i].Blob++
+		default:
+			buckets[i].Inline++
+		}
+		buckets[i].Bytes += size
+	}
+
+	return buckets, rows.Err()
+}
+
+// SyntaxCount is how many live pastes use a syntax
+type SyntaxCount struct {
+	Syntax string `json:"syntax"`
+	Count  int64  `json:"count"`
+}
+
+// PasteCountSince counts the live pastes created at or after since
+func (db DB) PasteCountSince(since time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultListTimeout)
+	defer cancel()
+
+	var count int64
+	err := db.pool.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM pastes
+		WHERE create_time >= $1 AND (delete_time > $2 OR delete_time = 0)`,
+		since.Unix(), time.Now().Unix(),
+	).Scan(&count)
+	return count, err
+}
+
+// PasteTopSyntaxes returns the syntaxes most used by live pastes, most used first
+func (db DB) PasteTopSyntaxes(limit int) ([]SyntaxCount, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultListTimeout)
+	defer cancel()
+
+	rows, err := db.pool.QueryContext(ctx,
+		`SELECT syntax, COUNT(*) FROM pastes
+		WHERE delete_time > $1 OR delete_time = 0
+		GROUP BY syntax
+		ORDER BY COUNT(*) DESC, syntax
+		LIMIT $2`,
+		time.Now().Unix(), limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var syntaxes []SyntaxCount
+	for rows.Next() {
+		var s SyntaxCount
+		if err := rows.Scan(&s.Syntax, &s.Count); err != nil {
+			return nil, err
+		}
+		syntaxes = append(syntaxes, s)
+	}
+	return syntaxes, rows.Err()
+}
+
+// ActiveUserCount counts the users with a session that has not expired
+func (db DB) ActiveUserCount() (int64, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultListTimeout)
+	defer cancel()
+
+	var count int64
+	err := db.pool.QueryRowContext(ctx,
+		`SELECT COUNT(DISTINCT user_id) FROM user_sessions WHERE expires_at > $1`,
+		time.Now().Unix(),
+	).Scan(&count)
+	return count, err
+}
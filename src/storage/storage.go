@@ -7,12 +7,15 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
 	"errors"
-	"fmt"
+	"net"
 	"os"
 	"runtime"
-	"strings"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/storage/migrations"
 
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/jackc/pgx/v5/stdlib"
@@ -27,6 +30,44 @@ type DB struct {
 	pool       *sql.DB
 	backupPool *sql.DB // SQLite backup/cache when using postgres/mysql
 	driver     string
+	worm       bool            // write-once mode, see worm.go
+	bodies     *BodyPolicy     // how paste bodies are stored, see body.go
+	cache      *PasteCache     // recently fetched pastes, see cache.go
+	scanner    PasteScanner    // holds spam for review, see scan.go
+	breaker    *Breaker        // fails queries at once while the database is down, see breaker.go
+	ctx        context.Context // request the queries run for, see WithContext
+	clientIP   string          // address new pastes are recorded as created from, see WithClientIP
+}
+
+// WithContext returns a copy of db whose queries end when ctx does, so a
+// client that goes away stops its queries; each query keeps its own timeout
+func (db DB) WithContext(ctx context.Context) DB {
+	db.ctx = ctx
+	return db
+}
+
+// WithClientIP returns a copy of db that records ip as the address the
+// pastes it creates come from, for moderation
+func (db DB) WithClientIP(ip net.IP) DB {
+	db.clientIP = ""
+	if ip != nil {
+		db.clientIP = ip.String()
+	}
+	return db
+}
+
+// context is the parent of each query's timeout; while the circuit is open
+// it is already done, see breaker.go
+func (db DB) context() context.Context {
+	ctx := db.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if db.Unavailable() {
+		db.reject()
+		return unavailableContext{ctx}
+	}
+	return ctx
 }
 
 func NewPool(driverName string, dataSourceName string, maxOpenConns int, maxIdleConns int, dataDir string) (DB, error) {
@@ -69,6 +110,29 @@ func NewPool(driverName string, dataSourceName string, maxOpenConns int, maxIdle
 	return db, nil
 }
 
+// Ping checks that a database is reachable without keeping a connection open
+func Ping(driverName, dataSourceName string) error {
+	pool, err := sql.Open(driverName, dataSourceName)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return pool.PingContext(ctx)
+}
+
+// Snapshot writes a consistent copy of a SQLite database to path, which
+// must not exist, while the database stays in use
+func (db DB) Snapshot(path string) error {
+	if db.driver != "sqlite" {
+		return errors.New("db: snapshots need a sqlite database, not " + db.driver)
+	}
+	_, err := db.pool.ExecContext(db.context(), `VACUUM INTO ?`, path)
+	return err
+}
+
 // getSQLiteCachePath determines the SQLite cache database path
 // Priority: CASPASTE_DB_DIR env var > dataDir/db/ > platform-specific default
 func getSQLiteCachePath(dataDir string) string {
@@ -117,6 +181,11 @@ func isRunningAsRoot() bool {
 	return os.Geteuid() == 0
 }
 
+// Pool returns the primary connection pool for services that run their own queries
+func (db DB) Pool() *sql.DB {
+	return db.pool
+}
+
 func (db DB) Close() error {
 	// Close backup pool first if it exists
 	if db.backupPool != nil {
@@ -128,6 +197,8 @@ func (db DB) Close() error {
 	return db.pool.Close()
 }
 
+// InitDB brings the schema of a database up to date by applying the
+// migrations it has not had yet, see the migrations package
 func InitDB(driverName string, dataSourceName string) error {
 	// Open DB
 	db, err := NewPool(driverName, dataSourceName, 1, 0, "")
@@ -136,413 +207,8 @@ func InitDB(driverName string, dataSourceName string) error {
 	}
 	defer db.Close()
 
-	// Create pastes table
-	_, err = db.pool.Exec(`
-		CREATE TABLE IF NOT EXISTS pastes (
-			id          TEXT    PRIMARY KEY,
-			title       TEXT    NOT NULL,
-			body        TEXT    NOT NULL,
-			syntax      TEXT    NOT NULL,
-			create_time INTEGER NOT NULL,
-			delete_time INTEGER NOT NULL,
-			one_use     BOOL    NOT NULL
-		);
-	`)
-	if err != nil {
+	if _, err = migrations.Up(db.pool, driverName); err != nil {
 		return err
 	}
-
-	// Create users table (PART 34: Multi-User)
-	_, err = db.pool.Exec(`
-		CREATE TABLE IF NOT EXISTS users (
-			id              INTEGER PRIMARY KEY AUTOINCREMENT,
-			username        TEXT NOT NULL UNIQUE,
-			email           TEXT NOT NULL UNIQUE,
-			password_hash   TEXT NOT NULL,
-			display_name    TEXT,
-			avatar_type     TEXT NOT NULL DEFAULT 'gravatar',
-			avatar_url      TEXT,
-			bio             TEXT,
-			location        TEXT,
-			website         TEXT,
-			visibility      TEXT NOT NULL DEFAULT 'public',
-			org_visibility  INTEGER NOT NULL DEFAULT 1,
-			timezone        TEXT,
-			language        TEXT DEFAULT 'en',
-			role            TEXT NOT NULL DEFAULT 'user',
-			email_verified  INTEGER NOT NULL DEFAULT 0,
-			totp_enabled    INTEGER NOT NULL DEFAULT 0,
-			totp_secret     TEXT,
-			last_login      INTEGER,
-			failed_attempts INTEGER NOT NULL DEFAULT 0,
-			locked_until    INTEGER,
-			created_at      INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
-			updated_at      INTEGER NOT NULL DEFAULT (strftime('%s', 'now'))
-		);
-	`)
-	if err != nil {
-		return err
-	}
-
-	// Create user_sessions table
-	_, err = db.pool.Exec(`
-		CREATE TABLE IF NOT EXISTS user_sessions (
-			id          INTEGER PRIMARY KEY AUTOINCREMENT,
-			user_id     INTEGER NOT NULL,
-			token_hash  TEXT NOT NULL UNIQUE,
-			device      TEXT,
-			ip_address  TEXT,
-			user_agent  TEXT,
-			expires_at  INTEGER NOT NULL,
-			created_at  INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
-			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-		);
-	`)
-	if err != nil {
-		return err
-	}
-
-	// Create user_tokens table (API tokens with usr_ prefix)
-	_, err = db.pool.Exec(`
-		CREATE TABLE IF NOT EXISTS user_tokens (
-			id           INTEGER PRIMARY KEY AUTOINCREMENT,
-			user_id      INTEGER NOT NULL,
-			name         TEXT NOT NULL,
-			token_prefix TEXT NOT NULL,
-			token_hash   TEXT NOT NULL UNIQUE,
-			scopes       TEXT,
-			last_used_at INTEGER,
-			expires_at   INTEGER,
-			created_at   INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
-			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-		);
-	`)
-	if err != nil {
-		return err
-	}
-
-	// Create recovery_keys table (hashed, single use)
-	_, err = db.pool.Exec(`
-		CREATE TABLE IF NOT EXISTS recovery_keys (
-			id         INTEGER PRIMARY KEY AUTOINCREMENT,
-			user_id    INTEGER NOT NULL,
-			key_hash   TEXT NOT NULL UNIQUE,
-			used_at    INTEGER,
-			created_at INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
-			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-		);
-	`)
-	if err != nil {
-		return err
-	}
-
-	// Create password_resets table
-	_, err = db.pool.Exec(`
-		CREATE TABLE IF NOT EXISTS password_resets (
-			id         INTEGER PRIMARY KEY AUTOINCREMENT,
-			user_id    INTEGER NOT NULL,
-			token_hash TEXT NOT NULL UNIQUE,
-			expires_at INTEGER NOT NULL,
-			used_at    INTEGER,
-			created_at INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
-			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-		);
-	`)
-	if err != nil {
-		return err
-	}
-
-	// Create email_verifications table
-	_, err = db.pool.Exec(`
-		CREATE TABLE IF NOT EXISTS email_verifications (
-			id          INTEGER PRIMARY KEY AUTOINCREMENT,
-			user_id     INTEGER NOT NULL,
-			email       TEXT NOT NULL,
-			token_hash  TEXT NOT NULL UNIQUE,
-			expires_at  INTEGER NOT NULL,
-			verified_at INTEGER,
-			created_at  INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
-			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-		);
-	`)
-	if err != nil {
-		return err
-	}
-
-	// Create user_invites table (admin-generated)
-	_, err = db.pool.Exec(`
-		CREATE TABLE IF NOT EXISTS user_invites (
-			id         INTEGER PRIMARY KEY AUTOINCREMENT,
-			username   TEXT NOT NULL,
-			token_hash TEXT NOT NULL UNIQUE,
-			created_by INTEGER NOT NULL,
-			expires_at INTEGER NOT NULL,
-			used_at    INTEGER,
-			created_at INTEGER NOT NULL DEFAULT (strftime('%s', 'now'))
-		);
-	`)
-	if err != nil {
-		return err
-	}
-
-	// Create user_preferences table
-	_, err = db.pool.Exec(`
-		CREATE TABLE IF NOT EXISTS user_preferences (
-			id               INTEGER PRIMARY KEY AUTOINCREMENT,
-			user_id          INTEGER NOT NULL UNIQUE,
-			show_email       INTEGER NOT NULL DEFAULT 0,
-			show_activity    INTEGER NOT NULL DEFAULT 1,
-			show_orgs        INTEGER NOT NULL DEFAULT 1,
-			searchable       INTEGER NOT NULL DEFAULT 1,
-			email_security   INTEGER NOT NULL DEFAULT 1,
-			email_mentions   INTEGER NOT NULL DEFAULT 1,
-			email_updates    INTEGER NOT NULL DEFAULT 0,
-			email_digest     TEXT DEFAULT 'weekly',
-			theme            TEXT DEFAULT 'dark',
-			font_size        TEXT DEFAULT 'medium',
-			reduce_motion    INTEGER NOT NULL DEFAULT 0,
-			date_format      TEXT DEFAULT 'YYYY-MM-DD',
-			time_format      TEXT DEFAULT '24h',
-			created_at       INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
-			updated_at       INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
-			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-		);
-	`)
-	if err != nil {
-		return err
-	}
-
-	// Create orgs table (PART 35: Organizations)
-	_, err = db.pool.Exec(`
-		CREATE TABLE IF NOT EXISTS orgs (
-			id             INTEGER PRIMARY KEY AUTOINCREMENT,
-			slug           TEXT NOT NULL UNIQUE,
-			name           TEXT NOT NULL,
-			description    TEXT,
-			avatar_type    TEXT NOT NULL DEFAULT 'gravatar',
-			avatar_url     TEXT,
-			website        TEXT,
-			location       TEXT,
-			visibility     TEXT NOT NULL DEFAULT 'public',
-			owner_id       INTEGER NOT NULL,
-			email          TEXT,
-			email_verified INTEGER NOT NULL DEFAULT 0,
-			created_at     INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
-			updated_at     INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
-			FOREIGN KEY (owner_id) REFERENCES users(id)
-		);
-	`)
-	if err != nil {
-		return err
-	}
-
-	// Create org_members table
-	_, err = db.pool.Exec(`
-		CREATE TABLE IF NOT EXISTS org_members (
-			id         INTEGER PRIMARY KEY AUTOINCREMENT,
-			org_id     INTEGER NOT NULL,
-			user_id    INTEGER NOT NULL,
-			role       TEXT NOT NULL DEFAULT 'member',
-			created_at INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
-			UNIQUE(org_id, user_id),
-			FOREIGN KEY (org_id) REFERENCES orgs(id) ON DELETE CASCADE,
-			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-		);
-	`)
-	if err != nil {
-		return err
-	}
-
-	// Create org_tokens table (API tokens with org_ prefix)
-	_, err = db.pool.Exec(`
-		CREATE TABLE IF NOT EXISTS org_tokens (
-			id           INTEGER PRIMARY KEY AUTOINCREMENT,
-			org_id       INTEGER NOT NULL,
-			created_by   INTEGER NOT NULL,
-			name         TEXT NOT NULL,
-			token_prefix TEXT NOT NULL,
-			token_hash   TEXT NOT NULL UNIQUE,
-			scopes       TEXT,
-			last_used_at INTEGER,
-			expires_at   INTEGER,
-			created_at   INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
-			FOREIGN KEY (org_id) REFERENCES orgs(id) ON DELETE CASCADE,
-			FOREIGN KEY (created_by) REFERENCES users(id)
-		);
-	`)
-	if err != nil {
-		return err
-	}
-
-	// Create org_preferences table
-	_, err = db.pool.Exec(`
-		CREATE TABLE IF NOT EXISTS org_preferences (
-			id                   INTEGER PRIMARY KEY AUTOINCREMENT,
-			org_id               INTEGER NOT NULL UNIQUE,
-			default_role         TEXT DEFAULT 'member',
-			require_2fa          INTEGER NOT NULL DEFAULT 0,
-			notify_member_join   INTEGER NOT NULL DEFAULT 1,
-			notify_member_leave  INTEGER NOT NULL DEFAULT 1,
-			notify_role_change   INTEGER NOT NULL DEFAULT 1,
-			notify_token_activity INTEGER NOT NULL DEFAULT 1,
-			created_at           INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
-			updated_at           INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
-			FOREIGN KEY (org_id) REFERENCES orgs(id) ON DELETE CASCADE
-		);
-	`)
-	if err != nil {
-		return err
-	}
-
-	// Create custom_domains table (PART 36: Custom Domains)
-	_, err = db.pool.Exec(`
-		CREATE TABLE IF NOT EXISTS custom_domains (
-			id                  INTEGER PRIMARY KEY AUTOINCREMENT,
-			owner_type          TEXT NOT NULL,
-			owner_id            INTEGER NOT NULL,
-			domain              TEXT NOT NULL UNIQUE,
-			is_apex             INTEGER NOT NULL DEFAULT 0,
-			is_wildcard         INTEGER NOT NULL DEFAULT 0,
-			verification_status TEXT NOT NULL DEFAULT 'pending',
-			verified_at         INTEGER,
-			verified_ip         TEXT,
-			last_check_at       INTEGER,
-			check_count         INTEGER NOT NULL DEFAULT 0,
-			ssl_enabled         INTEGER NOT NULL DEFAULT 0,
-			ssl_status          TEXT NOT NULL DEFAULT 'none',
-			ssl_challenge       TEXT,
-			ssl_provider        TEXT,
-			ssl_credentials     TEXT,
-			ssl_cert_pem        TEXT,
-			ssl_key_pem         TEXT,
-			ssl_issued_at       INTEGER,
-			ssl_expires_at      INTEGER,
-			ssl_last_error      TEXT,
-			status              TEXT NOT NULL DEFAULT 'pending',
-			suspended_reason    TEXT,
-			created_at          INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
-			updated_at          INTEGER NOT NULL DEFAULT (strftime('%s', 'now'))
-		);
-	`)
-	if err != nil {
-		return err
-	}
-
-	// Create custom_domain_audit table
-	_, err = db.pool.Exec(`
-		CREATE TABLE IF NOT EXISTS custom_domain_audit (
-			id         INTEGER PRIMARY KEY AUTOINCREMENT,
-			domain_id  INTEGER NOT NULL,
-			action     TEXT NOT NULL,
-			actor_type TEXT NOT NULL,
-			actor_id   INTEGER,
-			details    TEXT,
-			created_at INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
-			FOREIGN KEY (domain_id) REFERENCES custom_domains(id) ON DELETE CASCADE
-		);
-	`)
-	if err != nil {
-		return err
-	}
-
-	// Create indexes
-	_, _ = db.pool.Exec(`CREATE INDEX IF NOT EXISTS idx_users_username ON users(username);`)
-	_, _ = db.pool.Exec(`CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);`)
-	_, _ = db.pool.Exec(`CREATE INDEX IF NOT EXISTS idx_user_sessions_user ON user_sessions(user_id);`)
-	_, _ = db.pool.Exec(`CREATE INDEX IF NOT EXISTS idx_user_sessions_token ON user_sessions(token_hash);`)
-	_, _ = db.pool.Exec(`CREATE INDEX IF NOT EXISTS idx_user_tokens_user ON user_tokens(user_id);`)
-	_, _ = db.pool.Exec(`CREATE INDEX IF NOT EXISTS idx_recovery_keys_user ON recovery_keys(user_id);`)
-	_, _ = db.pool.Exec(`CREATE INDEX IF NOT EXISTS idx_orgs_slug ON orgs(slug);`)
-	_, _ = db.pool.Exec(`CREATE INDEX IF NOT EXISTS idx_orgs_owner ON orgs(owner_id);`)
-	_, _ = db.pool.Exec(`CREATE INDEX IF NOT EXISTS idx_org_members_org ON org_members(org_id);`)
-	_, _ = db.pool.Exec(`CREATE INDEX IF NOT EXISTS idx_org_members_user ON org_members(user_id);`)
-	_, _ = db.pool.Exec(`CREATE INDEX IF NOT EXISTS idx_custom_domains_domain ON custom_domains(domain);`)
-	_, _ = db.pool.Exec(`CREATE INDEX IF NOT EXISTS idx_custom_domains_owner ON custom_domains(owner_type, owner_id);`)
-	_, _ = db.pool.Exec(`CREATE INDEX IF NOT EXISTS idx_custom_domains_status ON custom_domains(status);`)
-	_, _ = db.pool.Exec(`CREATE INDEX IF NOT EXISTS idx_custom_domains_ssl_expires ON custom_domains(ssl_expires_at);`)
-	_, _ = db.pool.Exec(`CREATE INDEX IF NOT EXISTS idx_domain_audit_domain ON custom_domain_audit(domain_id);`)
-
-	// Handle database-specific column additions for pastes table
-	// Define allowed columns with validation (prevents SQL injection)
-	type columnDef struct {
-		name       string
-		definition string
-	}
-
-	var columns []columnDef
-	if driverName == "sqlite3" || driverName == "sqlite" {
-		// SQLite: ALTER TABLE ADD COLUMN (ignores duplicate errors)
-		columns = []columnDef{
-			{"author", "TEXT NOT NULL DEFAULT ''"},
-			{"author_email", "TEXT NOT NULL DEFAULT ''"},
-			{"author_url", "TEXT NOT NULL DEFAULT ''"},
-			{"is_file", "BOOL NOT NULL DEFAULT 0"},
-			{"file_name", "TEXT NOT NULL DEFAULT ''"},
-			{"mime_type", "TEXT NOT NULL DEFAULT ''"},
-			{"is_editable", "BOOL NOT NULL DEFAULT 0"},
-			{"is_private", "BOOL NOT NULL DEFAULT 0"},
-			{"is_url", "BOOL NOT NULL DEFAULT 0"},
-			{"original_url", "TEXT NOT NULL DEFAULT ''"},
-			{"user_id", "INTEGER"},
-			{"org_id", "INTEGER"},
-		}
-		for _, col := range columns {
-			// Using string formatting is safe here because column name is from hardcoded whitelist
-			_, err := db.pool.Exec(fmt.Sprintf(`ALTER TABLE pastes ADD COLUMN %s %s`, col.name, col.definition))
-			// Ignore "duplicate column" errors
-			if err != nil && !strings.Contains(err.Error(), "duplicate column") {
-				return err
-			}
-		}
-
-		// Create indexes for pastes user/org columns
-		_, _ = db.pool.Exec(`CREATE INDEX IF NOT EXISTS idx_pastes_user ON pastes(user_id);`)
-		_, _ = db.pool.Exec(`CREATE INDEX IF NOT EXISTS idx_pastes_org ON pastes(org_id);`)
-
-	} else if driverName == "mysql" || driverName == "mariadb" {
-		// MySQL/MariaDB: Use ALTER TABLE ADD COLUMN IF NOT EXISTS (MariaDB 10.0+)
-		columns = []columnDef{
-			{"author", "TEXT NOT NULL DEFAULT ''"},
-			{"author_email", "TEXT NOT NULL DEFAULT ''"},
-			{"author_url", "TEXT NOT NULL DEFAULT ''"},
-			{"is_file", "BOOLEAN NOT NULL DEFAULT false"},
-			{"file_name", "TEXT NOT NULL DEFAULT ''"},
-			{"mime_type", "TEXT NOT NULL DEFAULT ''"},
-			{"is_editable", "BOOLEAN NOT NULL DEFAULT false"},
-			{"is_private", "BOOLEAN NOT NULL DEFAULT false"},
-			{"is_url", "BOOLEAN NOT NULL DEFAULT false"},
-			{"original_url", "TEXT NOT NULL DEFAULT ''"},
-			{"user_id", "INTEGER"},
-			{"org_id", "INTEGER"},
-		}
-		for _, col := range columns {
-			// Using string formatting is safe here because column name is from hardcoded whitelist
-			_, err := db.pool.Exec(fmt.Sprintf(`ALTER TABLE pastes ADD COLUMN IF NOT EXISTS %s %s`, col.name, col.definition))
-			if err != nil {
-				return err
-			}
-		}
-
-	} else {
-		// PostgreSQL: supports IF NOT EXISTS
-		_, err = db.pool.Exec(`
-			ALTER TABLE pastes ADD COLUMN IF NOT EXISTS author       TEXT NOT NULL DEFAULT '';
-			ALTER TABLE pastes ADD COLUMN IF NOT EXISTS author_email TEXT NOT NULL DEFAULT '';
-			ALTER TABLE pastes ADD COLUMN IF NOT EXISTS author_url   TEXT NOT NULL DEFAULT '';
-			ALTER TABLE pastes ADD COLUMN IF NOT EXISTS is_file      BOOL NOT NULL DEFAULT false;
-			ALTER TABLE pastes ADD COLUMN IF NOT EXISTS file_name    TEXT NOT NULL DEFAULT '';
-			ALTER TABLE pastes ADD COLUMN IF NOT EXISTS mime_type    TEXT NOT NULL DEFAULT '';
-			ALTER TABLE pastes ADD COLUMN IF NOT EXISTS is_editable  BOOL NOT NULL DEFAULT false;
-			ALTER TABLE pastes ADD COLUMN IF NOT EXISTS is_private   BOOL NOT NULL DEFAULT false;
-			ALTER TABLE pastes ADD COLUMN IF NOT EXISTS is_url       BOOL NOT NULL DEFAULT false;
-			ALTER TABLE pastes ADD COLUMN IF NOT EXISTS original_url TEXT NOT NULL DEFAULT '';
-			ALTER TABLE pastes ADD COLUMN IF NOT EXISTS user_id      INTEGER;
-			ALTER TABLE pastes ADD COLUMN IF NOT EXISTS org_id       INTEGER;
-		`)
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return db.seedPasteTemplates()
 }
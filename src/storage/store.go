@@ -0,0 +1,226 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/casjay-forks/caspaste/src/domain"
+	"github.com/casjay-forks/caspaste/src/org"
+	"github.com/casjay-forks/caspaste/src/user"
+)
+
+// PasteStore persists pastes
+type PasteStore interface {
+	PasteAdd(paste Paste) (string, int64, int64, error)
+	PasteAddStream(paste Paste, r io.Reader, maxSize int64) (string, int64, int64, error)
+	PasteGet(id string) (Paste, error)
+	PasteUpdate(paste Paste) error
+	PasteDelete(id string) error
+	PasteView(id string) (int, error)
+	PasteDeleteExpired() (int64, error)
+	PasteList(limit int, offset int, tag string) ([]PasteListItem, error)
+	PasteListCount(tag string) (int, error)
+	PasteListPublic(limit int, offset int) ([]Paste, error)
+
+	// PasteEach calls fn with every paste as stored, stopping at its first error
+	PasteEach(fn func(StoredPaste) error) error
+	// PasteImport adds a paste read by PasteEach from another store as it is
+	PasteImport(paste StoredPaste) error
+}
+
+// StoredPaste is a paste as it is kept by a store: a body moved to the blob
+// store is a reference to it, and is copied as such
+type StoredPaste struct {
+	Paste
+	// Where the body is kept, see body.go
+	BodyStorage string
+	BodySize    int64
+	// Address the paste was created from, see DB.WithClientIP
+	CreatorIP string
+	// Digest of the body, see PasteBulkMatch
+	ContentHash string
+}
+
+// Stores for the account side of the server, implemented next to their services
+type (
+	UserStore   = user.Store
+	OrgStore    = org.Store
+	DomainStore = domain.Store
+)
+
+// Storage is everything a backend keeps
+type Storage interface {
+	PasteStore
+	Users() UserStore
+	Orgs() OrgStore
+	Domains() DomainStore
+	Close() error
+}
+
+// Driver opens one kind of backend
+type Driver interface {
+	// Init creates the schema at source, or brings it up to date
+	Init(source string) error
+	Open(source string) (Storage, error)
+}
+
+var (
+	driversMu sync.RWMutex
+	drivers   = map[string]Driver{}
+)
+
+// Register makes a driver available under a name, as used in the database
+// driver setting; registering a name twice panics
+func Register(name string, driver Driver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+
+	if _, dup := drivers[name]; dup {
+		panic("storage: Register called twice for driver " + name)
+	}
+	drivers[name] = driver
+}
+
+// Drivers returns the names of the registered drivers, sorted
+func Drivers() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+
+	names := make([]string, 0, len(drivers))
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookupDriver(name string) (Driver, error) {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+
+	driver, ok := drivers[name]
+	if !ok {
+		return nil, fmt.Errorf("storage: unknown driver %q", name)
+	}
+	return driver, nil
+}
+
+// Open opens the backend at source with a registered driver
+func Open(driverName, source string) (Storage, error) {
+	driver, err := lookupDriver(driverName)
+	if err != nil {
+		return nil, err
+	}
+	return driver.Open(source)
+}
+
+// sqlDriver opens a database/sql database, keeping everything in its tables
+type sqlDriver struct {
+	name string
+}
+
+func init() {
+	for _, name := range []string{"sqlite", "postgres", "pgx", "mysql"} {
+		Register(name, sqlDriver{name: name})
+	}
+}
+
+func (d sqlDriver) Init(source string) error {
+	return InitDB(d.name, source)
+}
+
+func (d sqlDriver) Open(source string) (Storage, error) {
+	db, err := NewPool(d.name, source, 25, 5, "")
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Users returns the user accounts kept in the database
+func (db DB) Users() UserStore {
+	return user.NewSQLStore(db.pool)
+}
+
+// Orgs returns the organizations kept in the database
+func (db DB) Orgs() OrgStore {
+	return org.NewSQLStore(db.pool)
+}
+
+// Domains returns the custom domains kept in the database
+func (db DB) Domains() DomainStore {
+	return domain.NewSQLStore(db.pool)
+}
+
+// PasteEach reads every paste, so it is bounded by the migration timeout
+// rather than the query timeout
+func (db DB) PasteEach(fn func(StoredPaste) error) error {
+	ctx, cancel := context.WithTimeout(db.context(), migrationTimeout)
+	defer cancel()
+
+	rows, err := db.pool.QueryContext(ctx, `
+		SELECT id, title, body, syntax, create_time, delete_time, one_use,
+		       author, author_email, author_url,
+		       COALESCE(is_file, 0), COALESCE(file_name, ''), COALESCE(mime_type, ''),
+		       COALESCE(is_editable, 0), COALESCE(is_private, 0),
+		       COALESCE(is_url, 0), COALESCE(original_url, ''),
+		       COALESCE(body_storage, ''), COALESCE(body_size, 0), COALESCE(is_encrypted, 0),
+		       COALESCE(max_views, 0), COALESCE(views_left, 0), COALESCE(creator_ip, ''),
+		       COALESCE(content_hash, '')
+		FROM pastes ORDER BY id
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var paste StoredPaste
+		err := rows.Scan(
+			&paste.ID, &paste.Title, &paste.Body, &paste.Syntax,
+			&paste.CreateTime, &paste.DeleteTime, &paste.OneUse,
+			&paste.Author, &paste.AuthorEmail, &paste.AuthorURL,
+			&paste.IsFile, &paste.FileName, &paste.MimeType,
+			&paste.IsEditable, &paste.IsPrivate, &paste.IsURL, &paste.OriginalURL,
+			&paste.BodyStorage, &paste.BodySize, &paste.Encrypted,
+			&paste.MaxViews, &paste.ViewsLeft, &paste.CreatorIP, &paste.ContentHash,
+		)
+		if err != nil {
+			return err
+		}
+		if err := fn(paste); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (db DB) PasteImport(paste StoredPaste) error {
+	// Query timeout per AI.md PART 10
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	_, err := db.pool.ExecContext(ctx, `
+		INSERT INTO pastes (id, title, body, syntax, create_time, delete_time, one_use,
+		                    author, author_email, author_url,
+		                    is_file, file_name, mime_type, is_editable, is_private, is_url, original_url,
+		                    body_storage, body_size, is_encrypted, max_views, views_left, creator_ip, content_hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24)
+	`, paste.ID, paste.Title, paste.Body, paste.Syntax,
+		paste.CreateTime, paste.DeleteTime, paste.OneUse,
+		paste.Author, paste.AuthorEmail, paste.AuthorURL,
+		paste.IsFile, paste.FileName, paste.MimeType,
+		paste.IsEditable, paste.IsPrivate, paste.IsURL, paste.OriginalURL,
+		paste.BodyStorage, paste.BodySize, paste.Encrypted, paste.MaxViews, paste.ViewsLeft, paste.CreatorIP, paste.ContentHash)
+	return err
+}
+
+var _ Storage = DB{}
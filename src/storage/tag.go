@@ -0,0 +1,188 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tags label pastes by topic so the public list can be browsed by them
+// A tag is 1-32 lowercase letters, digits, '-', '_' or '.', starting with a
+// letter or digit; a paste has at most MaxTags of them
+
+const (
+	MaxTags      = 10
+	MaxTagLength = 32
+)
+
+var ErrBadTag = errors.New("db: tags are 1-32 characters of a-z, 0-9, '-', '_' and '.', at most 10 per paste")
+
+// TagCount is a tag with the number of listed pastes that carry it
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// NormalizeTags lowercases and trims tags, drops empty and repeated ones and
+// checks the rest
+func NormalizeTags(tags []string) ([]string, error) {
+	var out []string
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || containsTag(out, tag) {
+			continue
+		}
+		if !ValidTag(tag) {
+			return nil, ErrBadTag
+		}
+		out = append(out, tag)
+	}
+	if len(out) > MaxTags {
+		return nil, ErrBadTag
+	}
+	return out, nil
+}
+
+// ValidTag reports whether tag is a normalized tag
+func ValidTag(tag string) bool {
+	if tag == "" || len(tag) > MaxTagLength {
+		return false
+	}
+	for i, c := range tag {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+		case (c == '-' || c == '_' || c == '.') && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func containsTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// pasteTagsAdd stores the tags of a new paste
+func (db DB) pasteTagsAdd(ctx context.Context, id string, tags []string) error {
+	for _, tag := range tags {
+		_, err := db.pool.ExecContext(ctx, `INSERT INTO paste_tags (paste_id, tag) VALUES ($1, $2)`, id, tag)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pasteTags returns the tags of a paste in alphabetical order
+func (db DB) pasteTags(ctx context.Context, id string) ([]string, error) {
+	rows, err := db.pool.QueryContext(ctx, `SELECT tag FROM paste_tags WHERE paste_id = $1 ORDER BY tag`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []string
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// pasteTagsFill sets the tags of listed pastes with one query
+func (db DB) pasteTagsFill(ctx context.Context, pastes []PasteListItem) error {
+	if len(pastes) == 0 {
+		return nil
+	}
+
+	index := make(map[string]int, len(pastes))
+	params := make([]string, len(pastes))
+	args := make([]interface{}, len(pastes))
+	for i, paste := range pastes {
+		index[paste.ID] = i
+		params[i] = "$" + strconv.Itoa(i+1)
+		args[i] = paste.ID
+	}
+
+	rows, err := db.pool.QueryContext(ctx,
+		`SELECT paste_id, tag FROM paste_tags WHERE paste_id IN (`+strings.Join(params, ", ")+`) ORDER BY tag`,
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, tag string
+		if err := rows.Scan(&id, &tag); err != nil {
+			return err
+		}
+		if i, ok := index[id]; ok {
+			pastes[i].Tags = append(pastes[i].Tags, tag)
+		}
+	}
+	return rows.Err()
+}
+
+// PasteTagCounts returns the most used tags of the pastes on the public list,
+// most used first
+func (db DB) PasteTagCounts(limit int) ([]TagCount, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+
+	ctx, cancel := context.WithTimeout(db.context(), defaultListTimeout)
+	defer cancel()
+
+	rows, err := db.pool.QueryContext(ctx,
+		`SELECT pt.tag, COUNT(*) AS uses
+		FROM paste_tags pt
+		JOIN pastes p ON p.id = pt.paste_id
+		LEFT JOIN paste_pins pp ON pp.paste_id = p.id
+		WHERE (p.delete_time > $1 OR p.delete_time = 0 OR pp.keep_after_expiry = true)
+		AND p.is_private = false
+		AND p.id NOT IN (SELECT paste_id FROM paste_freezes)
+		GROUP BY pt.tag
+		ORDER BY uses DESC, pt.tag
+		LIMIT $2`,
+		time.Now().Unix(),
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []TagCount{}
+	for rows.Next() {
+		var count TagCount
+		if err := rows.Scan(&count.Tag, &count.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+	return counts, rows.Err()
+}
+
+// pasteTagsCleanup removes the tags of pastes that no longer exist
+func (db DB) pasteTagsCleanup(ctx context.Context) error {
+	_, err := db.pool.ExecContext(ctx, `DELETE FROM paste_tags WHERE paste_id NOT IN (SELECT id FROM pastes)`)
+	return err
+}
@@ -0,0 +1,228 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"time"
+)
+
+var (
+	ErrTemplateNotFound = errors.New("db: template not found")
+	ErrTemplateName     = errors.New("db: template name must be 1-32 characters of a-z, 0-9, '-' or '_'")
+)
+
+var templateNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// PasteTemplate pre-fills the new paste form with a title, body skeleton and syntax
+type PasteTemplate struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Title       string `json:"title"`
+	Body        string `json:"body"`
+	Syntax      string `json:"syntax"`
+	CreatedAt   int64  `json:"created_at"`
+	UpdatedAt   int64  `json:"updated_at"`
+}
+
+// DefaultPasteTemplates are seeded into an empty templates table
+// Admins may edit or delete them afterwards
+var DefaultPasteTemplates = []PasteTemplate{
+	{
+		Name:        "incident",
+		Description: "Incident report",
+		Title:       "Incident: <short summary>",
+		Syntax:      "markdown",
+		Body: `# Incident: <short summary>
+
+**Severity:** SEV-?
+**Status:** investigating | identified | monitoring | resolved
+**Started:** YYYY-MM-DD HH:MM UTC
+**Detected by:**
+**Incident lead:**
+
+## Impact
+
+## Timeline (UTC)
+
+- HH:MM -
+
+## Root cause
+
+## Mitigation
+
+## Follow-up actions
+
+- [ ]
+`,
+	},
+	{
+		Name:        "stacktrace",
+		Description: "Stack trace with environment details",
+		Title:       "Stack trace: <error message>",
+		Syntax:      "plaintext",
+		Body: `Application:
+Version:
+Environment:
+OS / runtime:
+Steps to reproduce:
+
+--- stack trace ---
+
+`,
+	},
+	{
+		Name:        "config-diff",
+		Description: "Configuration change as a unified diff",
+		Title:       "Config diff: <file or service>",
+		Syntax:      "Diff",
+		Body: `# Service:
+# Reason for change:
+--- a/path/to/config
++++ b/path/to/config
+@@ -1,1 +1,1 @@
+-old
++new
+`,
+	},
+	{
+		Name:        "sql-explain",
+		Description: "SQL query with its execution plan",
+		Title:       "SQL explain: <query purpose>",
+		Syntax:      "SQL",
+		Body: `-- Database / version:
+-- Table sizes:
+
+-- Query
+SELECT ...;
+
+-- EXPLAIN ANALYZE output
+/*
+
+*/
+`,
+	},
+}
+
+// ValidTemplateName reports whether name can be used as a template name
+func ValidTemplateName(name string) bool {
+	return templateNameRegex.MatchString(name)
+}
+
+// seedPasteTemplates inserts the default templates if the table is empty
+func (db DB) seedPasteTemplates() error {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	var count int
+	if err := db.pool.QueryRowContext(ctx, `SELECT COUNT(*) FROM paste_templates`).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	for _, t := range DefaultPasteTemplates {
+		if err := db.TemplateSave(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TemplateList returns every template sorted by name
+func (db DB) TemplateList() ([]PasteTemplate, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultListTimeout)
+	defer cancel()
+
+	rows, err := db.pool.QueryContext(ctx,
+		`SELECT name, description, title, body, syntax, created_at, updated_at FROM paste_templates ORDER BY name`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []PasteTemplate{}
+	for rows.Next() {
+		var t PasteTemplate
+		if err := rows.Scan(&t.Name, &t.Description, &t.Title, &t.Body, &t.Syntax, &t.CreatedAt, &t.UpdatedAt); err != nil {
+			return nil, err
+		}
+		templates = append(templates, t)
+	}
+	return templates, rows.Err()
+}
+
+// TemplateGet returns one template by name
+func (db DB) TemplateGet(name string) (PasteTemplate, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	var t PasteTemplate
+	err := db.pool.QueryRowContext(ctx,
+		`SELECT name, description, title, body, syntax, created_at, updated_at FROM paste_templates WHERE name = $1`,
+		name,
+	).Scan(&t.Name, &t.Description, &t.Title, &t.Body, &t.Syntax, &t.CreatedAt, &t.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return t, ErrTemplateNotFound
+		}
+		return t, err
+	}
+	return t, nil
+}
+
+// TemplateSave creates a template or replaces an existing one with the same name
+func (db DB) TemplateSave(t PasteTemplate) error {
+	if !ValidTemplateName(t.Name) {
+		return ErrTemplateName
+	}
+
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	now := time.Now().Unix()
+	result, err := db.pool.ExecContext(ctx,
+		`UPDATE paste_templates SET description = $2, title = $3, body = $4, syntax = $5, updated_at = $6 WHERE name = $1`,
+		t.Name, t.Description, t.Title, t.Body, t.Syntax, now,
+	)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected > 0 {
+		return err
+	}
+
+	_, err = db.pool.ExecContext(ctx,
+		`INSERT INTO paste_templates (name, description, title, body, syntax, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $6)`,
+		t.Name, t.Description, t.Title, t.Body, t.Syntax, now,
+	)
+	return err
+}
+
+// TemplateDelete removes a template
+func (db DB) TemplateDelete(name string) error {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	result, err := db.pool.ExecContext(ctx, `DELETE FROM paste_templates WHERE name = $1`, name)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrTemplateNotFound
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// WORM (write-once, read-many) mode makes pastes tamper-proof until they expire
+// Edits are refused, and deletes are only allowed for expired and one-use pastes
+// Admins can place a legal hold, which keeps a paste even after it expires, and
+// can remove a paste before expiry with a documented legal delete
+
+var (
+	ErrWORM           = errors.New("db: paste is write-once and cannot be changed before it expires")
+	ErrLegalHold      = errors.New("db: paste is under legal hold")
+	ErrNoLegalHold    = errors.New("db: paste is not under legal hold")
+	ErrReasonRequired = errors.New("db: a reason is required")
+)
+
+// LegalHold describes a paste that must be preserved
+type LegalHold struct {
+	PasteID   string `json:"paste_id"`
+	Reason    string `json:"reason"`
+	CreatedBy string `json:"created_by"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// SetWORM enables or disables write-once mode
+// Call before the DB value is copied into handlers
+func (db *DB) SetWORM(enabled bool) {
+	db.worm = enabled
+}
+
+// WORM reports whether write-once mode is enabled
+func (db DB) WORM() bool {
+	return db.worm
+}
+
+// checkDelete returns an error if the paste may not be deleted right now
+func (db DB) checkDelete(id string) error {
+	held, err := db.PasteLegalHoldGet(id)
+	if err != nil && err != ErrNoLegalHold {
+		return err
+	}
+	if held != nil {
+		return ErrLegalHold
+	}
+
+	if !db.worm {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	var oneUse bool
+	var deleteTime int64
+	err = db.pool.QueryRowContext(ctx,
+		`SELECT one_use, delete_time FROM pastes WHERE id = $1`,
+		id,
+	).Scan(&oneUse, &deleteTime)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFoundID
+		}
+		return err
+	}
+
+	// Burn-after-reading pastes are deleted by design, expired ones by policy
+	if oneUse || (deleteTime > 0 && deleteTime < time.Now().Unix()) {
+		return nil
+	}
+	return ErrWORM
+}
+
+// PasteLegalHoldSet places a paste under legal hold
+func (db DB) PasteLegalHoldSet(id, reason, createdBy string) error {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return ErrReasonRequired
+	}
+
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	// Expired pastes may still exist and can be held, so check the table directly
+	var exists int
+	err := db.pool.QueryRowContext(ctx, `SELECT 1 FROM pastes WHERE id = $1`, id).Scan(&exists)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFoundID
+		}
+		return err
+	}
+
+	if held, err := db.PasteLegalHoldGet(id); err == nil && held != nil {
+		return ErrLegalHold
+	}
+
+	_, err = db.pool.ExecContext(ctx,
+		`INSERT INTO paste_legal_holds (paste_id, reason, created_by, created_at) VALUES ($1, $2, $3, $4)`,
+		id, reason, createdBy, time.Now().Unix(),
+	)
+	return err
+}
+
+// PasteLegalHoldRelease removes a legal hold
+func (db DB) PasteLegalHoldRelease(id string) error {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	result, err := db.pool.ExecContext(ctx, `DELETE FROM paste_legal_holds WHERE paste_id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNoLegalHold
+	}
+	return nil
+}
+
+// PasteLegalHoldGet returns the legal hold on a paste, or ErrNoLegalHold
+func (db DB) PasteLegalHoldGet(id string) (*LegalHold, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultQueryTimeout)
+	defer cancel()
+
+	var hold LegalHold
+	err := db.pool.QueryRowContext(ctx,
+		`SELECT paste_id, reason, created_by, created_at FROM paste_legal_holds WHERE paste_id = $1`,
+		id,
+	).Scan(&hold.PasteID, &hold.Reason, &hold.CreatedBy, &hold.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNoLegalHold
+		}
+		return nil, err
+	}
+	return &hold, nil
+}
+
+// PasteLegalHolds lists every legal hold, newest first
+func (db DB) PasteLegalHolds() ([]LegalHold, error) {
+	ctx, cancel := context.WithTimeout(db.context(), defaultListTimeout)
+	defer cancel()
+
+	rows, err := db.pool.QueryContext(ctx,
+		`SELECT paste_id, reason, created_by, created_at FROM paste_legal_holds ORDER BY created_at DESC`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var holds []LegalHold
+	for rows.Next() {
+		var hold LegalHold
+		if err := rows.Scan(&hold.PasteID, &hold.Reason, &hold.CreatedBy, &hold.CreatedAt); err != nil {
+			return nil, err
+		}
+		holds = append(holds, hold)
+	}
+	return holds, rows.Err()
+}
+
+// PasteLegalDelete removes a paste before expiry, bypassing WORM mode
+// This is the documented admin path for court orders and takedowns; a paste
+// under legal hold must be released first
+func (db DB) PasteLegalDelete(id, reason string) error {
+	if strings.TrimSpace(reason) == "" {
+		return ErrReasonRequired
+	}
+	if held, err := db.PasteLegalHoldGet(id); err == nil && held != nil {
+		return ErrLegalHold
+	}
+	return db.pasteDelete(id)
+}
@@ -300,6 +300,46 @@ func (h *Handler) generateSpec() *Spec {
 						},
 					},
 				},
+				Put: updatePasteOperation("updatePaste", "query",
+					"Changes a paste; fields left out are kept. Anyone may edit a paste created as editable; with Basic auth or a read-write API token any paste and its expiration"),
+				Delete: &Operation{
+					Tags:        []string{"pastes"},
+					Summary:     "Delete a paste",
+					Description: "Needs Basic auth or an API token with the read-write scope",
+					OperationID: "deletePaste",
+					Parameters: []Parameter{
+						{Name: "id", In: "query", Required: true, Description: "Paste ID", Schema: &Schema{Type: "string"}},
+					},
+					Responses: map[string]Response{
+						"200": {
+							Description: "Paste deleted",
+						},
+						"401": {
+							Description: "Authentication required",
+							Content: map[string]Media{
+								"application/json": {
+									Schema: &Schema{Ref: "#/components/schemas/Error"},
+								},
+							},
+						},
+						"403": {
+							Description: "Paste is write-once or under legal hold",
+							Content: map[string]Media{
+								"application/json": {
+									Schema: &Schema{Ref: "#/components/schemas/Error"},
+								},
+							},
+						},
+						"404": {
+							Description: "Paste not found",
+							Content: map[string]Media{
+								"application/json": {
+									Schema: &Schema{Ref: "#/components/schemas/Error"},
+								},
+							},
+						},
+					},
+				},
 			},
 			config.APIBasePath() + "/server/info": {
 				Get: &Operation{
@@ -319,6 +359,172 @@ func (h *Handler) generateSpec() *Spec {
 					},
 				},
 			},
+			config.APIBasePath() + "/server/info/stats": {
+				Get: &Operation{
+					Tags:        []string{"server"},
+					Summary:     "Get server stats",
+					Description: "Returns uptime and counts of live pastes; private instances need Basic auth or a token with the status:read scope",
+					OperationID: "getServerStats",
+					Responses: map[string]Response{
+						"200": {
+							Description: "Server stats",
+						},
+						"401": {
+							Description: "Authentication required",
+						},
+					},
+				},
+			},
+			config.APIBasePath() + "/pastes/{id}": {
+				Put: updatePasteOperation("replacePaste", "path",
+					"Changes any paste and its expiration; fields left out are kept. Needs Basic auth or an API token with the read-write scope"),
+				Patch: updatePasteOperation("patchPaste", "path",
+					"Same as PUT"),
+			},
+			config.APIBasePath() + "/pastes/{id}/format": {
+				Post: &Operation{
+					Tags:        []string{"pastes"},
+					Summary:     "Format a paste",
+					Description: "Runs the built-in formatter for the paste syntax (Go, JSON, YAML) and returns the result; save=true stores it on editable pastes",
+					OperationID: "formatPaste",
+					Parameters: []Parameter{
+						{Name: "id", In: "path", Required: true, Description: "Paste ID", Schema: &Schema{Type: "string"}},
+						{Name: "save", In: "query", Description: "Store the formatted body", Schema: &Schema{Type: "boolean"}},
+					},
+					Responses: map[string]Response{
+						"200": {
+							Description: "Formatted paste",
+						},
+						"400": {
+							Description: "No formatter for this syntax",
+							Content: map[string]Media{
+								"application/json": {
+									Schema: &Schema{Ref: "#/components/schemas/Error"},
+								},
+							},
+						},
+						"422": {
+							Description: "Paste content could not be parsed",
+							Content: map[string]Media{
+								"application/json": {
+									Schema: &Schema{Ref: "#/components/schemas/Error"},
+								},
+							},
+						},
+					},
+				},
+			},
+			config.APIBasePath() + "/templates": {
+				Get: &Operation{
+					Tags:        []string{"templates"},
+					Summary:     "List paste templates",
+					Description: "Returns the paste templates, or a single template when name is given",
+					OperationID: "listTemplates",
+					Parameters: []Parameter{
+						{Name: "name", In: "query", Description: "Template name", Schema: &Schema{Type: "string"}},
+					},
+					Responses: map[string]Response{
+						"200": {
+							Description: "Paste templates",
+						},
+						"404": {
+							Description: "Template not found",
+							Content: map[string]Media{
+								"application/json": {
+									Schema: &Schema{Ref: "#/components/schemas/Error"},
+								},
+							},
+						},
+					},
+				},
+			},
+			config.APIBasePath() + "/users/drafts": {
+				Get: &Operation{
+					Tags:        []string{"drafts"},
+					Summary:     "List drafts",
+					Description: "Returns the autosaved drafts of the logged-in user (session or Basic auth), newest first",
+					OperationID: "listDrafts",
+					Responses: map[string]Response{
+						"200": {
+							Description: "Drafts",
+						},
+						"401": {
+							Description: "Authentication required",
+							Content: map[string]Media{
+								"application/json": {
+									Schema: &Schema{Ref: "#/components/schemas/Error"},
+								},
+							},
+						},
+					},
+				},
+			},
+			config.APIBasePath() + "/users/drafts/{id}": {
+				Get: &Operation{
+					Tags:        []string{"drafts"},
+					Summary:     "Get a draft",
+					OperationID: "getDraft",
+					Parameters: []Parameter{
+						{Name: "id", In: "path", Required: true, Description: "Draft ID", Schema: &Schema{Type: "string"}},
+					},
+					Responses: map[string]Response{
+						"200": {
+							Description: "Draft",
+						},
+						"404": {
+							Description: "Draft not found",
+							Content: map[string]Media{
+								"application/json": {
+									Schema: &Schema{Ref: "#/components/schemas/Error"},
+								},
+							},
+						},
+					},
+				},
+				Put: &Operation{
+					Tags:        []string{"drafts"},
+					Summary:     "Save a draft",
+					Description: "Creates or replaces a draft from title, body and syntax (JSON or form fields)",
+					OperationID: "saveDraft",
+					Parameters: []Parameter{
+						{Name: "id", In: "path", Required: true, Description: "Draft ID", Schema: &Schema{Type: "string"}},
+					},
+					Responses: map[string]Response{
+						"200": {
+							Description: "Saved draft",
+						},
+						"409": {
+							Description: "Draft limit reached",
+							Content: map[string]Media{
+								"application/json": {
+									Schema: &Schema{Ref: "#/components/schemas/Error"},
+								},
+							},
+						},
+					},
+				},
+				Delete: &Operation{
+					Tags:        []string{"drafts"},
+					Summary:     "Delete a draft",
+					OperationID: "deleteDraft",
+					Parameters: []Parameter{
+						{Name: "id", In: "path", Required: true, Description: "Draft ID", Schema: &Schema{Type: "string"}},
+					},
+					Responses: map[string]Response{
+						"200": {
+							Description: "Draft deleted",
+						},
+						"404": {
+							Description: "Draft not found",
+							Content: map[string]Media{
+								"application/json": {
+									Schema: &Schema{Ref: "#/components/schemas/Error"},
+								},
+							},
+						},
+					},
+				},
+			},
 		},
 		Components: Components{
 			Schemas: map[string]*Schema{
@@ -470,3 +676,46 @@ func generateSwaggerUIHTML(theme string) string {
 </body>
 </html>`
 }
+
+// updatePasteOperation describes a paste update, with the ID in the query or path
+func updatePasteOperation(operationID, idIn, description string) *Operation {
+	errorContent := map[string]Media{
+		"application/json": {
+			Schema: &Schema{Ref: "#/components/schemas/Error"},
+		},
+	}
+	return &Operation{
+		Tags:        []string{"pastes"},
+		Summary:     "Update a paste",
+		Description: description,
+		OperationID: operationID,
+		Parameters: []Parameter{
+			{Name: "id", In: idIn, Required: true, Description: "Paste ID", Schema: &Schema{Type: "string"}},
+		},
+		RequestBody: &RequestBody{
+			Required:    true,
+			Description: "Fields to change",
+			Content: map[string]Media{
+				"application/x-www-form-urlencoded": {
+					Schema: &Schema{
+						Type: "object",
+						Properties: map[string]*Schema{
+							"title":      {Type: "string"},
+							"body":       {Type: "string"},
+							"syntax":     {Type: "string"},
+							"expiration": {Type: "integer"},
+							"lineEnd":    {Type: "string"},
+						},
+					},
+				},
+			},
+		},
+		Responses: map[string]Response{
+			"200": {Description: "Paste updated"},
+			"400": {Description: "Invalid fields, or a body or syntax for a file or short URL", Content: errorContent},
+			"401": {Description: "Paste is not editable, or authentication required", Content: errorContent},
+			"403": {Description: "Paste is write-once or under legal hold", Content: errorContent},
+			"404": {Description: "Paste not found", Content: errorContent},
+		},
+	}
+}
@@ -0,0 +1,104 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+// Package telemetry builds and sends the opt-in usage ping
+// The payload is only what Report holds: nothing identifies the instance,
+// its users or its pastes, and the paste count is rounded to a bucket
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/casjay-forks/caspaste/src/outbound"
+)
+
+// Schema is raised when fields are added to or removed from Report
+const Schema = 1
+
+const sendTimeout = 30 * time.Second
+
+// Report is the complete telemetry payload
+type Report struct {
+	Schema  int    `json:"schema"`
+	Version string `json:"version"`
+	OS      string `json:"os"`
+	Arch    string `json:"arch"`
+	Driver  string `json:"driver"`
+	Pastes  string `json:"pastes"`
+}
+
+// pasteBuckets are the lower bounds of the paste count buckets
+var pasteBuckets = []struct {
+	min   int64
+	label string
+}{
+	{1000000, "1M+"},
+	{100000, "100k-1M"},
+	{10000, "10k-100k"},
+	{1000, "1k-10k"},
+	{100, "100-1k"},
+	{1, "1-100"},
+}
+
+// PasteBucket rounds a paste count to its bucket
+func PasteBucket(count int64) string {
+	for _, b := range pasteBuckets {
+		if count >= b.min {
+			return b.label
+		}
+	}
+	return "0"
+}
+
+// NewReport builds the payload for this build and instance
+func NewReport(version, driver string, pastes int64) Report {
+	return Report{
+		Schema:  Schema,
+		Version: version,
+		OS:      runtime.GOOS,
+		Arch:    runtime.GOARCH,
+		Driver:  driver,
+		Pastes:  PasteBucket(pastes),
+	}
+}
+
+// Send posts the report as JSON to endpoint
+func Send(ctx context.Context, endpoint string, report Report) error {
+	if endpoint == "" {
+		return errors.New("no endpoint configured")
+	}
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "CasPaste/"+report.Version)
+
+	resp, err := outbound.Client(0).Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("endpoint returned %s", resp.Status)
+	}
+	return nil
+}
@@ -7,13 +7,13 @@
 package token
 
 import (
-	"crypto/rand"
-	"crypto/sha256"
 	"database/sql"
-	"encoding/hex"
 	"errors"
+	"net/http"
 	"strings"
 	"time"
+
+	"github.com/casjay-forks/caspaste/src/securetoken"
 )
 
 // Token prefix constants per PART 34
@@ -24,10 +24,17 @@ const (
 )
 
 // Scope constants
+// metrics:read and status:read are for monitoring tools: they only reach
+// /metrics, the health checks and the server stats, even on private instances
+// editor is for editor plugins: it only reaches /api/v1/editor, where it
+// creates pastes and lists and edits the ones it created
 const (
-	ScopeGlobal    = "global"
-	ScopeReadWrite = "read-write"
-	ScopeRead      = "read"
+	ScopeGlobal      = "global"
+	ScopeReadWrite   = "read-write"
+	ScopeRead        = "read"
+	ScopeMetricsRead = "metrics:read"
+	ScopeStatusRead  = "status:read"
+	ScopeEditor      = "editor"
 )
 
 // Common errors
@@ -75,7 +82,7 @@ func NewService(db *sql.DB) *Service {
 // CreateUserToken creates a new API token for a user
 func (s *Service) CreateUserToken(userID int64, name string, scopes []string, expiresAt *int64) (string, *Token, error) {
 	// Generate token
-	rawToken, err := generateRawToken(32)
+	rawToken, err := securetoken.Hex(32)
 	if err != nil {
 		return "", nil, err
 	}
@@ -84,7 +91,7 @@ func (s *Service) CreateUserToken(userID int64, name string, scopes []string, ex
 	fullToken := PrefixUser + rawToken
 
 	// Hash for storage
-	tokenHash := hashToken(fullToken)
+	tokenHash := securetoken.Hash(fullToken)
 
 	// Prefix for display
 	tokenPrefix := fullToken[:12] + "..."
@@ -120,7 +127,7 @@ func (s *Service) CreateUserToken(userID int64, name string, scopes []string, ex
 // CreateOrgToken creates a new API token for an organization
 func (s *Service) CreateOrgToken(orgID, createdBy int64, name string, scopes []string, expiresAt *int64) (string, *Token, error) {
 	// Generate token
-	rawToken, err := generateRawToken(32)
+	rawToken, err := securetoken.Hex(32)
 	if err != nil {
 		return "", nil, err
 	}
@@ -129,7 +136,7 @@ func (s *Service) CreateOrgToken(orgID, createdBy int64, name string, scopes []s
 	fullToken := PrefixOrg + rawToken
 
 	// Hash for storage
-	tokenHash := hashToken(fullToken)
+	tokenHash := securetoken.Hash(fullToken)
 
 	// Prefix for display
 	tokenPrefix := fullToken[:12] + "..."
@@ -163,6 +170,59 @@ func (s *Service) CreateOrgToken(orgID, createdBy int64, name string, scopes []s
 	return fullToken, token, nil
 }
 
+// ImportUserToken stores a token generated outside the server, e.g. by a
+// deployment tool. The name identifies the token: importing a new value under
+// the same name replaces the old one. Importing the same value again is a no-op.
+func (s *Service) ImportUserToken(userID int64, name, fullToken string, scopes []string) error {
+	if !strings.HasPrefix(fullToken, PrefixUser) || len(fullToken) < len(PrefixUser)+32 {
+		return ErrInvalidToken
+	}
+	return s.importToken("user_tokens", "user_id", userID, 0, name, fullToken, scopes)
+}
+
+// ImportOrgToken is ImportUserToken for organization tokens
+func (s *Service) ImportOrgToken(orgID, createdBy int64, name, fullToken string, scopes []string) error {
+	if !strings.HasPrefix(fullToken, PrefixOrg) || len(fullToken) < len(PrefixOrg)+32 {
+		return ErrInvalidToken
+	}
+	return s.importToken("org_tokens", "org_id", orgID, createdBy, name, fullToken, scopes)
+}
+
+func (s *Service) importToken(table, ownerColumn string, ownerID, createdBy int64, name, fullToken string, scopes []string) error {
+	tokenHash := securetoken.Hash(fullToken)
+
+	var existing int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE token_hash = ?", tokenHash).Scan(&existing)
+	if err != nil {
+		return err
+	}
+	if existing > 0 {
+		return nil
+	}
+
+	// A new value under an existing name rotates the token
+	if _, err := s.db.Exec("DELETE FROM "+table+" WHERE "+ownerColumn+" = ? AND name = ?", ownerID, name); err != nil {
+		return err
+	}
+
+	tokenPrefix := fullToken[:12] + "..."
+	scopeStr := strings.Join(scopes, ",")
+	now := time.Now().Unix()
+
+	if table == "org_tokens" {
+		_, err = s.db.Exec(`
+			INSERT INTO org_tokens (org_id, created_by, name, token_prefix, token_hash, scopes, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, ownerID, createdBy, name, tokenPrefix, tokenHash, scopeStr, now)
+	} else {
+		_, err = s.db.Exec(`
+			INSERT INTO user_tokens (user_id, name, token_prefix, token_hash, scopes, created_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, ownerID, name, tokenPrefix, tokenHash, scopeStr, now)
+	}
+	return err
+}
+
 // Validate validates an API token and returns token info
 func (s *Service) Validate(token string) (*TokenInfo, error) {
 	if token == "" {
@@ -181,7 +241,7 @@ func (s *Service) Validate(token string) (*TokenInfo, error) {
 		return nil, ErrInvalidToken
 	}
 
-	tokenHash := hashToken(token)
+	tokenHash := securetoken.Hash(token)
 
 	switch tokenType {
 	case "user":
@@ -399,22 +459,6 @@ func (s *Service) CountOrgTokens(orgID int64) (int, error) {
 	return count, err
 }
 
-// generateRawToken generates a cryptographically secure random token
-func generateRawToken(length int) (string, error) {
-	bytes := make([]byte, length)
-	_, err := rand.Read(bytes)
-	if err != nil {
-		return "", err
-	}
-	return hex.EncodeToString(bytes), nil
-}
-
-// hashToken hashes a token using SHA-256
-func hashToken(token string) string {
-	hash := sha256.Sum256([]byte(token))
-	return hex.EncodeToString(hash[:])
-}
-
 // HasScope checks if a token has a specific scope
 func (info *TokenInfo) HasScope(scope string) bool {
 	// Global scope has all permissions
@@ -426,6 +470,48 @@ func (info *TokenInfo) HasScope(scope string) bool {
 	return false
 }
 
+// IsMonitoringOnly checks if the token only has monitoring scopes, so it must
+// not be accepted as the credentials of its owner
+func (info *TokenInfo) IsMonitoringOnly() bool {
+	if len(info.Scopes) == 0 {
+		return false
+	}
+	for _, s := range info.Scopes {
+		if s != ScopeMetricsRead && s != ScopeStatusRead {
+			return false
+		}
+	}
+	return true
+}
+
+// IsEditorOnly checks if the token only has the editor scope, so, like a
+// monitoring token, it must not be accepted as the credentials of its owner
+func (info *TokenInfo) IsEditorOnly() bool {
+	return len(info.Scopes) == 1 && info.Scopes[0] == ScopeEditor
+}
+
+// IsValidScope checks if scope is a known token scope
+func IsValidScope(scope string) bool {
+	switch scope {
+	case ScopeGlobal, ScopeReadWrite, ScopeRead, ScopeMetricsRead, ScopeStatusRead, ScopeEditor:
+		return true
+	}
+	return false
+}
+
+// Authorize checks if the request carries a valid bearer token with scope
+func (s *Service) Authorize(r *http.Request, scope string) bool {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	info, err := s.Validate(strings.TrimSpace(strings.TrimPrefix(auth, "Bearer ")))
+	if err != nil {
+		return false
+	}
+	return info.HasScope(scope)
+}
+
 // CanWrite checks if the token has write permissions
 func (info *TokenInfo) CanWrite() bool {
 	return info.HasScope(ScopeGlobal) || info.HasScope(ScopeReadWrite)
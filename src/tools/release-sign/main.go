@@ -0,0 +1,101 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+// release-sign writes the .sha256 and .sig files the self-updater checks
+// next to each release binary
+// The private key is read from RELEASE_SIGNING_KEY, so it never has to be in
+// the build directory; without it only checksums are written
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	if len(os.Args) == 2 && os.Args[1] == "keygen" {
+		keygen()
+		return
+	}
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stdout, "Usage:", os.Args[0], "keygen")
+		fmt.Fprintln(os.Stdout, "      ", os.Args[0], "[FILE]...")
+		os.Exit(1)
+	}
+
+	var key ed25519.PrivateKey
+	if env := os.Getenv("RELEASE_SIGNING_KEY"); env != "" {
+		var err error
+		key, err = parseKey(env)
+		if err != nil {
+			exitOnError(err)
+		}
+	}
+
+	for _, path := range os.Args[1:] {
+		// Globs like release/* also match the files written by an earlier run
+		if strings.HasSuffix(path, ".sha256") || strings.HasSuffix(path, ".sig") {
+			continue
+		}
+		if err := sign(path, key); err != nil {
+			exitOnError(err)
+		}
+	}
+}
+
+func exitOnError(err error) {
+	fmt.Fprintln(os.Stderr, "error:", err)
+	os.Exit(1)
+}
+
+// keygen prints a new key pair: the private key goes in RELEASE_SIGNING_KEY,
+// the public key in RELEASE_PUBLIC_KEY, which is built into the binaries
+func keygen() {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		exitOnError(err)
+	}
+	fmt.Println("RELEASE_SIGNING_KEY (keep secret):", base64.StdEncoding.EncodeToString(priv.Seed()))
+	fmt.Println("RELEASE_PUBLIC_KEY:               ", base64.StdEncoding.EncodeToString(pub))
+}
+
+// parseKey decodes a base64 private key seed printed by keygen
+func parseKey(value string) (ed25519.PrivateKey, error) {
+	seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("RELEASE_SIGNING_KEY is not a key printed by keygen")
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// sign writes path.sha256 and, with a key, path.sig
+func sign(path string, key ed25519.PrivateKey) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:]) + "  " + filepath.Base(path) + "\n"
+	if err := os.WriteFile(path+".sha256", []byte(checksum), 0644); err != nil {
+		return err
+	}
+
+	if key != nil {
+		sig := base64.StdEncoding.EncodeToString(ed25519.Sign(key, data)) + "\n"
+		if err := os.WriteFile(path+".sig", []byte(sig), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -10,6 +10,8 @@ package updater
 
 import (
 	"os/exec"
+
+	"golang.org/x/sys/windows/svc"
 )
 
 // RestartService restarts the service after update (Windows)
@@ -31,6 +33,6 @@ func RestartService(serviceName string) error {
 
 // IsRunningAsService checks if running as a Windows service
 func IsRunningAsService() bool {
-	// This is a heuristic, not perfect
-	return false // Conservative default
+	ok, err := svc.IsWindowsService()
+	return err == nil && ok
 }
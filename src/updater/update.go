@@ -10,7 +10,9 @@ package updater
 
 import (
 	"context"
+	"crypto/ed25519"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -21,8 +23,16 @@ import (
 	"runtime"
 	"strings"
 	"time"
+
+	"github.com/casjay-forks/caspaste/src/outbound"
 )
 
+// ReleaseKey is the base64 ed25519 public key release binaries are signed
+// with, set at build time:
+// -ldflags "-X github.com/casjay-forks/caspaste/src/updater.ReleaseKey=..."
+// Builds without one verify checksums only
+var ReleaseKey string
+
 // Config holds update configuration
 type Config struct {
 	// CurrentVersion is the current running version
@@ -35,6 +45,9 @@ type Config struct {
 	GithubRepo string
 	// BinaryName is the base name of the binary (without platform suffix)
 	BinaryName string
+	// PublicKey is the base64 ed25519 key that signs release binaries; when
+	// set, a binary without a valid .sig asset is refused
+	PublicKey string
 }
 
 // DefaultConfig returns default update configuration
@@ -45,6 +58,7 @@ func DefaultConfig(version string) Config {
 		GithubOwner:    "casjay-forks",
 		GithubRepo:     "caspaste",
 		BinaryName:     "caspaste",
+		PublicKey:      ReleaseKey,
 	}
 }
 
@@ -76,6 +90,9 @@ type UpdateResult struct {
 
 // CheckForUpdate checks GitHub releases for updates per AI.md PART 23
 func CheckForUpdate(ctx context.Context, cfg Config) (*UpdateResult, error) {
+	if outbound.Offline() {
+		return nil, outbound.ErrOffline
+	}
 	result := &UpdateResult{
 		CurrentVersion: cfg.CurrentVersion,
 	}
@@ -99,7 +116,7 @@ func CheckForUpdate(ctx context.Context, cfg Config) (*UpdateResult, error) {
 	req.Header.Set("Accept", "application/vnd.github.v3+json")
 	req.Header.Set("User-Agent", fmt.Sprintf("%s/%s", cfg.BinaryName, cfg.CurrentVersion))
 
-	client := &http.Client{Timeout: 30 * time.Second}
+	client := outbound.Client(30 * time.Second)
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to check for updates: %w", err)
@@ -173,17 +190,23 @@ func matchesBranch(r Release, branch string) bool {
 
 // DoUpdate downloads and installs the update per AI.md PART 23
 func DoUpdate(ctx context.Context, cfg Config, release *Release) error {
+	if outbound.Offline() {
+		return outbound.ErrOffline
+	}
 	// Find the right asset for this platform
 	assetName := getBinaryName(cfg.BinaryName)
 	var downloadURL string
 	var checksumURL string
+	var signatureURL string
 
 	for _, asset := range release.Assets {
-		if asset.Name == assetName {
+		switch asset.Name {
+		case assetName:
 			downloadURL = asset.BrowserDownloadURL
-		}
-		if asset.Name == assetName+".sha256" {
+		case assetName + ".sha256":
 			checksumURL = asset.BrowserDownloadURL
+		case assetName + ".sig":
+			signatureURL = asset.BrowserDownloadURL
 		}
 	}
 
@@ -191,11 +214,25 @@ func DoUpdate(ctx context.Context, cfg Config, release *Release) error {
 		return fmt.Errorf("no binary found for %s/%s (looking for %s)",
 			runtime.GOOS, runtime.GOARCH, assetName)
 	}
+	if cfg.PublicKey != "" && signatureURL == "" {
+		return fmt.Errorf("release %s has no signature for %s", release.TagName, assetName)
+	}
+
+	// Get current binary path
+	currentPath, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to get executable path: %w", err)
+	}
+	currentPath, err = filepath.EvalSymlinks(currentPath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve symlinks: %w", err)
+	}
 
 	fmt.Printf("Downloading %s...\n", assetName)
 
-	// Download to temp file
-	tmpFile, err := os.CreateTemp("", cfg.BinaryName+"-update-*")
+	// Download next to the binary, so it is swapped in with a rename on the
+	// same filesystem (a rename across filesystems is not atomic, or fails)
+	tmpFile, err := os.CreateTemp(filepath.Dir(currentPath), "."+cfg.BinaryName+"-update-*")
 	if err != nil {
 		return fmt.Errorf("failed to create temp file: %w", err)
 	}
@@ -214,7 +251,7 @@ func DoUpdate(ctx context.Context, cfg Config, release *Release) error {
 	}
 	req.Header.Set("User-Agent", fmt.Sprintf("%s/%s", cfg.BinaryName, cfg.CurrentVersion))
 
-	client := &http.Client{Timeout: 5 * time.Minute}
+	client := outbound.Client(5 * time.Minute)
 	resp, err := client.Do(req)
 	if err != nil {
 		tmpFile.Close()
@@ -246,6 +283,15 @@ func DoUpdate(ctx context.Context, cfg Config, release *Release) error {
 		fmt.Println("Checksum verified")
 	}
 
+	// Verify signature if the build carries a release key
+	if cfg.PublicKey != "" {
+		fmt.Println("Verifying signature...")
+		if err := verifySignatureFromURL(ctx, tmpPath, signatureURL, cfg); err != nil {
+			return fmt.Errorf("signature verification failed: %w", err)
+		}
+		fmt.Println("Signature verified")
+	}
+
 	// Make executable (Unix)
 	if runtime.GOOS != "windows" {
 		if err := os.Chmod(tmpPath, 0755); err != nil {
@@ -253,16 +299,6 @@ func DoUpdate(ctx context.Context, cfg Config, release *Release) error {
 		}
 	}
 
-	// Get current binary path
-	currentPath, err := os.Executable()
-	if err != nil {
-		return fmt.Errorf("failed to get executable path: %w", err)
-	}
-	currentPath, err = filepath.EvalSymlinks(currentPath)
-	if err != nil {
-		return fmt.Errorf("failed to resolve symlinks: %w", err)
-	}
-
 	fmt.Printf("Replacing %s...\n", currentPath)
 
 	// Replace binary (platform-specific)
@@ -285,37 +321,68 @@ func getBinaryName(baseName string) string {
 
 // verifyChecksumFromURL downloads and verifies checksum
 func verifyChecksumFromURL(ctx context.Context, filePath, checksumURL string, cfg Config) error {
-	req, err := http.NewRequestWithContext(ctx, "GET", checksumURL, nil)
+	// Read checksum file (format: "hash  filename" or just "hash")
+	data, err := fetchAsset(ctx, checksumURL, cfg)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to download checksum: %w", err)
 	}
-	req.Header.Set("User-Agent", fmt.Sprintf("%s/%s", cfg.BinaryName, cfg.CurrentVersion))
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
+	// Parse checksum (first field)
+	parts := strings.Fields(string(data))
+	if len(parts) == 0 {
+		return fmt.Errorf("empty checksum file")
 	}
-	defer resp.Body.Close()
+	expectedHash := strings.ToLower(parts[0])
 
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("failed to download checksum: %d", resp.StatusCode)
+	return verifyChecksum(filePath, expectedHash)
+}
+
+// verifySignatureFromURL downloads the base64 ed25519 signature of a binary
+// and checks it against the configured public key
+func verifySignatureFromURL(ctx context.Context, filePath, signatureURL string, cfg Config) error {
+	key, err := base64.StdEncoding.DecodeString(cfg.PublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid release public key")
 	}
 
-	// Read checksum file (format: "hash  filename" or just "hash")
-	data, err := io.ReadAll(resp.Body)
+	data, err := fetchAsset(ctx, signatureURL, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to download signature: %w", err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return fmt.Errorf("malformed signature: %w", err)
+	}
+
+	binary, err := os.ReadFile(filePath)
 	if err != nil {
 		return err
 	}
+	if !ed25519.Verify(ed25519.PublicKey(key), binary, sig) {
+		return fmt.Errorf("binary is not signed by the release key")
+	}
+	return nil
+}
 
-	// Parse checksum (first field)
-	parts := strings.Fields(string(data))
-	if len(parts) == 0 {
-		return fmt.Errorf("empty checksum file")
+// fetchAsset downloads a small release asset such as a checksum or signature
+func fetchAsset(ctx context.Context, assetURL string, cfg Config) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", assetURL, nil)
+	if err != nil {
+		return nil, err
 	}
-	expectedHash := strings.ToLower(parts[0])
+	req.Header.Set("User-Agent", fmt.Sprintf("%s/%s", cfg.BinaryName, cfg.CurrentVersion))
 
-	return verifyChecksum(filePath, expectedHash)
+	client := outbound.Client(30 * time.Second)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 64<<10))
 }
 
 // verifyChecksum verifies SHA256 checksum per AI.md PART 23
@@ -0,0 +1,345 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package user
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// queryTimeout bounds each call to the database, on top of the caller's context
+const queryTimeout = 5 * time.Second
+
+// userColumns are the columns scanUser reads, in order
+const userColumns = `id, username, email, password_hash, COALESCE(display_name, ''), avatar_type,
+	COALESCE(avatar_url, ''), COALESCE(bio, ''), COALESCE(location, ''),
+	COALESCE(website, ''), visibility, org_visibility, COALESCE(timezone, ''),
+	COALESCE(language, ''), role, email_verified, totp_enabled,
+	COALESCE(totp_secret, ''), COALESCE(last_login, 0), failed_attempts,
+	COALESCE(locked_until, 0), created_at, updated_at`
+
+// sqlStore keeps users in the users table of a SQLite or PostgreSQL database
+type sqlStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore returns a Store backed by an open database
+func NewSQLStore(db *sql.DB) Store {
+	return &sqlStore{db: db}
+}
+
+func (s *sqlStore) Insert(ctx context.Context, u *User) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO users (username, email, password_hash, display_name, role, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, u.Username, u.Email, u.PasswordHash, u.DisplayName, u.Role, u.CreatedAt, u.UpdatedAt)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get user ID: %w", err)
+	}
+	return id, nil
+}
+
+func (s *sqlStore) GetByID(ctx context.Context, id int64) (*User, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	return scanUser(s.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id = ?", id))
+}
+
+func (s *sqlStore) GetByUsername(ctx context.Context, username string) (*User, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	return scanUser(s.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE LOWER(username) = LOWER(?)", username))
+}
+
+func (s *sqlStore) GetByEmail(ctx context.Context, email string) (*User, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	return scanUser(s.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE LOWER(email) = LOWER(?)", email))
+}
+
+func (s *sqlStore) List(ctx context.Context) ([]User, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, "SELECT "+userColumns+" FROM users ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+	return users, rows.Err()
+}
+
+// userSortColumns are the columns Search sorts by
+var userSortColumns = map[string]string{
+	"created":    "created_at",
+	"username":   "username",
+	"email":      "email",
+	"last_login": "COALESCE(last_login, 0)",
+}
+
+func (s *sqlStore) Search(ctx context.Context, q Query) ([]User, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	var where []string
+	var args []interface{}
+	if search := strings.TrimSpace(q.Search); search != "" {
+		like := "%" + strings.ToLower(search) + "%"
+		where = append(where, "(LOWER(username) LIKE ? OR LOWER(email) LIKE ? OR LOWER(COALESCE(display_name, '')) LIKE ?)")
+		args = append(args, like, like, like)
+	}
+	if q.Role != "" {
+		where = append(where, "role = ?")
+		args = append(args, q.Role)
+	}
+	now := time.Now().Unix()
+	switch q.Status {
+	case StatusActive:
+		where = append(where, "COALESCE(locked_until, 0) <= ?")
+		args = append(args, now)
+	case StatusLocked:
+		where = append(where, "COALESCE(locked_until, 0) > ?")
+		args = append(args, now)
+	case StatusUnverified:
+		where = append(where, "email_verified = 0")
+	case StatusMFA:
+		where = append(where, "totp_enabled = 1")
+	}
+	if q.From > 0 {
+		where = append(where, "created_at >= ?")
+		args = append(args, q.From)
+	}
+	if q.To > 0 {
+		where = append(where, "created_at < ?")
+		args = append(args, q.To)
+	}
+	clause := ""
+	if len(where) > 0 {
+		clause = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users"+clause, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	column, ok := userSortColumns[q.Sort]
+	if !ok {
+		column = userSortColumns["created"]
+	}
+	order := "ASC"
+	if q.Desc {
+		order = "DESC"
+	}
+	query := fmt.Sprintf("SELECT %s FROM users%s ORDER BY %s %s, id %s LIMIT ? OFFSET ?",
+		userColumns, clause, column, order, order)
+	rows, err := s.db.QueryContext(ctx, query, append(args, q.Limit, q.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, *user)
+	}
+	return users, total, rows.Err()
+}
+
+// scanner is a *sql.Row or *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanUser(row scanner) (*User, error) {
+	user := &User{}
+	var orgVisibility int
+	var emailVerified, totpEnabled int
+
+	err := row.Scan(
+		&user.ID, &user.Username, &user.Email, &user.PasswordHash,
+		&user.DisplayName, &user.AvatarType, &user.AvatarURL,
+		&user.Bio, &user.Location, &user.Website, &user.Visibility,
+		&orgVisibility, &user.Timezone, &user.Language, &user.Role,
+		&emailVerified, &totpEnabled, &user.TOTPSecret, &user.LastLogin,
+		&user.FailedAttempts, &user.LockedUntil, &user.CreatedAt, &user.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user.OrgVisibility = orgVisibility == 1
+	user.EmailVerified = emailVerified == 1
+	user.TOTPEnabled = totpEnabled == 1
+	return user, nil
+}
+
+func (s *sqlStore) Update(ctx context.Context, id int64, input UpdateUserInput) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	// Build update query dynamically
+	var updates []string
+	var args []interface{}
+
+	if input.DisplayName != nil {
+		updates = append(updates, "display_name = ?")
+		args = append(args, *input.DisplayName)
+	}
+	if input.AvatarType != nil {
+		updates = append(updates, "avatar_type = ?")
+		args = append(args, *input.AvatarType)
+	}
+	if input.AvatarURL != nil {
+		updates = append(updates, "avatar_url = ?")
+		args = append(args, *input.AvatarURL)
+	}
+	if input.Bio != nil {
+		updates = append(updates, "bio = ?")
+		args = append(args, *input.Bio)
+	}
+	if input.Location != nil {
+		updates = append(updates, "location = ?")
+		args = append(args, *input.Location)
+	}
+	if input.Website != nil {
+		updates = append(updates, "website = ?")
+		args = append(args, *input.Website)
+	}
+	if input.Visibility != nil {
+		updates = append(updates, "visibility = ?")
+		args = append(args, *input.Visibility)
+	}
+	if input.OrgVisibility != nil {
+		updates = append(updates, "org_visibility = ?")
+		args = append(args, boolToInt(*input.OrgVisibility))
+	}
+	if input.Timezone != nil {
+		updates = append(updates, "timezone = ?")
+		args = append(args, *input.Timezone)
+	}
+	if input.Language != nil {
+		updates = append(updates, "language = ?")
+		args = append(args, *input.Language)
+	}
+
+	if len(updates) == 0 {
+		return nil
+	}
+
+	// Add updated_at
+	updates = append(updates, "updated_at = ?")
+	args = append(args, time.Now().Unix())
+
+	// Add ID
+	args = append(args, id)
+
+	query := fmt.Sprintf("UPDATE users SET %s WHERE id = ?", strings.Join(updates, ", "))
+	_, err := s.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (s *sqlStore) Delete(ctx context.Context, id int64) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, "DELETE FROM users WHERE id = ?", id)
+	return err
+}
+
+func (s *sqlStore) SetPasswordHash(ctx context.Context, id int64, passwordHash string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, "UPDATE users SET password_hash = ?, updated_at = ? WHERE id = ?",
+		passwordHash, time.Now().Unix(), id)
+	return err
+}
+
+func (s *sqlStore) SetRole(ctx context.Context, id int64, role string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, "UPDATE users SET role = ?, updated_at = ? WHERE id = ?",
+		role, time.Now().Unix(), id)
+	return err
+}
+
+func (s *sqlStore) SetFailedAttempts(ctx context.Context, id int64, attempts int, lockedUntil int64) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	var locked interface{}
+	if lockedUntil > 0 {
+		locked = lockedUntil
+	}
+	_, err := s.db.ExecContext(ctx, "UPDATE users SET failed_attempts = ?, locked_until = ? WHERE id = ?",
+		attempts, locked, id)
+	return err
+}
+
+func (s *sqlStore) SetLastLogin(ctx context.Context, id int64, at int64) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, "UPDATE users SET last_login = ? WHERE id = ?", at, id)
+	return err
+}
+
+func (s *sqlStore) SetEmailVerified(ctx context.Context, id int64, verified bool) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, "UPDATE users SET email_verified = ?, updated_at = ? WHERE id = ?",
+		boolToInt(verified), time.Now().Unix(), id)
+	return err
+}
+
+func (s *sqlStore) SetTOTP(ctx context.Context, id int64, enabled bool, secret string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, "UPDATE users SET totp_enabled = ?, totp_secret = ?, updated_at = ? WHERE id = ?",
+		boolToInt(enabled), secret, time.Now().Unix(), id)
+	return err
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
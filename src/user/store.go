@@ -0,0 +1,63 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package user
+
+import (
+	"context"
+)
+
+// Store persists user accounts
+// Implementations return ErrUserNotFound for missing users, and leave
+// TOTPSecret as stored; the Service validates, hashes and encrypts
+type Store interface {
+	// Insert adds a user and returns its ID
+	Insert(ctx context.Context, u *User) (int64, error)
+	GetByID(ctx context.Context, id int64) (*User, error)
+	// GetByUsername and GetByEmail match case-insensitively
+	GetByUsername(ctx context.Context, username string) (*User, error)
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	// Update changes the profile fields that are set in input
+	Update(ctx context.Context, id int64, input UpdateUserInput) error
+	Delete(ctx context.Context, id int64) error
+	// List returns every user, oldest first
+	List(ctx context.Context) ([]User, error)
+	// Search returns a page of the users matching q, and how many match
+	Search(ctx context.Context, q Query) ([]User, int, error)
+
+	SetPasswordHash(ctx context.Context, id int64, passwordHash string) error
+	SetRole(ctx context.Context, id int64, role string) error
+	// SetFailedAttempts records failed logins; lockedUntil 0 unlocks
+	SetFailedAttempts(ctx context.Context, id int64, attempts int, lockedUntil int64) error
+	SetLastLogin(ctx context.Context, id int64, at int64) error
+	SetEmailVerified(ctx context.Context, id int64, verified bool) error
+	SetTOTP(ctx context.Context, id int64, enabled bool, secret string) error
+}
+
+// User statuses a Query can filter on
+const (
+	StatusActive     = "active"
+	StatusLocked     = "locked"
+	StatusUnverified = "unverified"
+	StatusMFA        = "mfa"
+)
+
+// Query selects, sorts and pages users; empty fields match every user
+type Query struct {
+	// Part of the username, email or display name, case-insensitively
+	Search string
+	Role   string
+	// StatusActive, StatusLocked, StatusUnverified or StatusMFA
+	Status string
+	// Created at or after From and before To, Unix times; 0 is open
+	From int64
+	To   int64
+	// "created", "username", "email" or "last_login"; created by default
+	Sort  string
+	Desc  bool
+	Limit int
+	// Offset is how many matching users are skipped
+	Offset int
+}
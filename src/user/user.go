@@ -7,8 +7,8 @@
 package user
 
 import (
-	"crypto/sha256"
-	"database/sql"
+	"context"
+	"crypto/subtle"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -17,6 +17,9 @@ import (
 	"time"
 
 	"golang.org/x/crypto/argon2"
+
+	"github.com/casjay-forks/caspaste/src/caspasswd"
+	"github.com/casjay-forks/caspaste/src/secrets"
 )
 
 // User role constants
@@ -96,8 +99,13 @@ type CreateUserInput struct {
 	Username    string
 	Email       string
 	Password    string
-	DisplayName string
-	Role        string
+	// PasswordHash is used instead of Password when provisioning from a
+	// pre-hashed secret (argon2id, pbkdf2-sha256 or bcrypt)
+	PasswordHash string
+	DisplayName  string
+	Role         string
+	// AllowReserved skips the username blocklist for operator-provisioned accounts
+	AllowReserved bool
 }
 
 // UpdateUserInput contains fields for updating a user
@@ -116,41 +124,58 @@ type UpdateUserInput struct {
 
 // Service provides user operations
 type Service struct {
-	db *sql.DB
+	store  Store
+	cipher *secrets.Cipher
 }
 
 // NewService creates a new user service
-func NewService(db *sql.DB) *Service {
-	return &Service{db: db}
+func NewService(store Store) *Service {
+	return &Service{store: store}
+}
+
+// SetCipher enables envelope encryption of TOTP secrets at rest
+func (s *Service) SetCipher(c *secrets.Cipher) {
+	s.cipher = c
 }
 
 // Create creates a new user
-func (s *Service) Create(input CreateUserInput) (*User, error) {
+func (s *Service) Create(ctx context.Context, input CreateUserInput) (*User, error) {
 	// Validate input
-	if err := ValidateUsername(input.Username); err != nil {
+	if err := ValidateUsername(input.Username); err != nil && !(input.AllowReserved && err == ErrUsernameBlocked) {
 		return nil, err
 	}
 	if err := ValidateEmail(input.Email); err != nil {
 		return nil, err
 	}
-	if err := ValidatePassword(input.Password); err != nil {
+	if input.PasswordHash != "" {
+		if !caspasswd.ValidHash(input.PasswordHash) {
+			return nil, errors.New("password hash must be argon2id, pbkdf2-sha256 or bcrypt")
+		}
+	} else if err := ValidatePassword(input.Password); err != nil {
 		return nil, err
 	}
 
 	// Check if username is taken
-	existing, _ := s.GetByUsername(input.Username)
+	existing, _ := s.GetByUsername(ctx, input.Username)
 	if existing != nil {
 		return nil, ErrUsernameTaken
 	}
 
 	// Check if email is taken
-	existing, _ = s.GetByEmail(input.Email)
+	existing, _ = s.GetByEmail(ctx, input.Email)
 	if existing != nil {
 		return nil, ErrEmailTaken
 	}
 
 	// Hash password with Argon2id (per PART 11)
-	passwordHash := HashPassword(input.Password)
+	passwordHash := input.PasswordHash
+	if passwordHash == "" {
+		var err error
+		passwordHash, err = HashPassword(input.Password)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	// Set defaults
 	role := input.Role
@@ -161,223 +186,102 @@ func (s *Service) Create(input CreateUserInput) (*User, error) {
 	now := time.Now().Unix()
 
 	// Insert user
-	result, err := s.db.Exec(`
-		INSERT INTO users (username, email, password_hash, display_name, role, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
-	`, strings.ToLower(input.Username), strings.ToLower(input.Email), passwordHash, input.DisplayName, role, now, now)
+	id, err := s.store.Insert(ctx, &User{
+		Username:     strings.ToLower(input.Username),
+		Email:        strings.ToLower(input.Email),
+		PasswordHash: passwordHash,
+		DisplayName:  input.DisplayName,
+		Role:         role,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create user: %w", err)
-	}
-
-	id, err := result.LastInsertId()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get user ID: %w", err)
+		return nil, err
 	}
 
-	return s.GetByID(id)
+	return s.GetByID(ctx, id)
 }
 
 // GetByID retrieves a user by ID
-func (s *Service) GetByID(id int64) (*User, error) {
-	user := &User{}
-	var orgVisibility int
-	var emailVerified, totpEnabled int
-
-	err := s.db.QueryRow(`
-		SELECT id, username, email, password_hash, display_name, avatar_type, avatar_url,
-		       bio, location, website, visibility, org_visibility, timezone, language, role,
-		       email_verified, totp_enabled, totp_secret, last_login, failed_attempts,
-		       locked_until, created_at, updated_at
-		FROM users WHERE id = ?
-	`, id).Scan(
-		&user.ID, &user.Username, &user.Email, &user.PasswordHash,
-		&user.DisplayName, &user.AvatarType, &user.AvatarURL,
-		&user.Bio, &user.Location, &user.Website, &user.Visibility,
-		&orgVisibility, &user.Timezone, &user.Language, &user.Role,
-		&emailVerified, &totpEnabled, &user.TOTPSecret, &user.LastLogin,
-		&user.FailedAttempts, &user.LockedUntil, &user.CreatedAt, &user.UpdatedAt,
-	)
-	if err == sql.ErrNoRows {
-		return nil, ErrUserNotFound
-	}
-	if err != nil {
-		return nil, err
-	}
-
-	user.OrgVisibility = orgVisibility == 1
-	user.EmailVerified = emailVerified == 1
-	user.TOTPEnabled = totpEnabled == 1
-
-	return user, nil
+func (s *Service) GetByID(ctx context.Context, id int64) (*User, error) {
+	return s.decrypt(s.store.GetByID(ctx, id))
 }
 
 // GetByUsername retrieves a user by username (case-insensitive)
-func (s *Service) GetByUsername(username string) (*User, error) {
-	user := &User{}
-	var orgVisibility int
-	var emailVerified, totpEnabled int
-
-	err := s.db.QueryRow(`
-		SELECT id, username, email, password_hash, display_name, avatar_type, avatar_url,
-		       bio, location, website, visibility, org_visibility, timezone, language, role,
-		       email_verified, totp_enabled, totp_secret, last_login, failed_attempts,
-		       locked_until, created_at, updated_at
-		FROM users WHERE LOWER(username) = LOWER(?)
-	`, username).Scan(
-		&user.ID, &user.Username, &user.Email, &user.PasswordHash,
-		&user.DisplayName, &user.AvatarType, &user.AvatarURL,
-		&user.Bio, &user.Location, &user.Website, &user.Visibility,
-		&orgVisibility, &user.Timezone, &user.Language, &user.Role,
-		&emailVerified, &totpEnabled, &user.TOTPSecret, &user.LastLogin,
-		&user.FailedAttempts, &user.LockedUntil, &user.CreatedAt, &user.UpdatedAt,
-	)
-	if err == sql.ErrNoRows {
-		return nil, ErrUserNotFound
-	}
-	if err != nil {
-		return nil, err
-	}
-
-	user.OrgVisibility = orgVisibility == 1
-	user.EmailVerified = emailVerified == 1
-	user.TOTPEnabled = totpEnabled == 1
-
-	return user, nil
+func (s *Service) GetByUsername(ctx context.Context, username string) (*User, error) {
+	return s.decrypt(s.store.GetByUsername(ctx, username))
 }
 
 // GetByEmail retrieves a user by email (case-insensitive)
-func (s *Service) GetByEmail(email string) (*User, error) {
-	user := &User{}
-	var orgVisibility int
-	var emailVerified, totpEnabled int
-
-	err := s.db.QueryRow(`
-		SELECT id, username, email, password_hash, display_name, avatar_type, avatar_url,
-		       bio, location, website, visibility, org_visibility, timezone, language, role,
-		       email_verified, totp_enabled, totp_secret, last_login, failed_attempts,
-		       locked_until, created_at, updated_at
-		FROM users WHERE LOWER(email) = LOWER(?)
-	`, email).Scan(
-		&user.ID, &user.Username, &user.Email, &user.PasswordHash,
-		&user.DisplayName, &user.AvatarType, &user.AvatarURL,
-		&user.Bio, &user.Location, &user.Website, &user.Visibility,
-		&orgVisibility, &user.Timezone, &user.Language, &user.Role,
-		&emailVerified, &totpEnabled, &user.TOTPSecret, &user.LastLogin,
-		&user.FailedAttempts, &user.LockedUntil, &user.CreatedAt, &user.UpdatedAt,
-	)
-	if err == sql.ErrNoRows {
-		return nil, ErrUserNotFound
+func (s *Service) GetByEmail(ctx context.Context, email string) (*User, error) {
+	return s.decrypt(s.store.GetByEmail(ctx, email))
+}
+
+// decrypt opens the TOTP secret of a user read from the store
+func (s *Service) decrypt(user *User, err error) (*User, error) {
+	if err != nil {
+		return nil, err
 	}
+	user.TOTPSecret, err = s.cipher.Decrypt(user.TOTPSecret)
 	if err != nil {
 		return nil, err
 	}
-
-	user.OrgVisibility = orgVisibility == 1
-	user.EmailVerified = emailVerified == 1
-	user.TOTPEnabled = totpEnabled == 1
-
 	return user, nil
 }
 
 // GetByIdentifier retrieves a user by ID, username, or email
-func (s *Service) GetByIdentifier(identifier string) (*User, error) {
+func (s *Service) GetByIdentifier(ctx context.Context, identifier string) (*User, error) {
 	identType := DetectIdentifierType(identifier)
 
 	switch identType {
 	case "user_id":
 		var id int64
 		fmt.Sscanf(identifier, "%d", &id)
-		return s.GetByID(id)
+		return s.GetByID(ctx, id)
 	case "email":
-		return s.GetByEmail(identifier)
+		return s.GetByEmail(ctx, identifier)
 	default:
-		return s.GetByUsername(identifier)
+		return s.GetByUsername(ctx, identifier)
 	}
 }
 
 // Update updates a user's profile
-func (s *Service) Update(id int64, input UpdateUserInput) error {
-	// Build update query dynamically
-	var updates []string
-	var args []interface{}
-
-	if input.DisplayName != nil {
-		updates = append(updates, "display_name = ?")
-		args = append(args, *input.DisplayName)
-	}
-	if input.AvatarType != nil {
-		updates = append(updates, "avatar_type = ?")
-		args = append(args, *input.AvatarType)
-	}
-	if input.AvatarURL != nil {
-		updates = append(updates, "avatar_url = ?")
-		args = append(args, *input.AvatarURL)
-	}
-	if input.Bio != nil {
-		updates = append(updates, "bio = ?")
-		args = append(args, *input.Bio)
-	}
-	if input.Location != nil {
-		updates = append(updates, "location = ?")
-		args = append(args, *input.Location)
-	}
-	if input.Website != nil {
-		updates = append(updates, "website = ?")
-		args = append(args, *input.Website)
-	}
-	if input.Visibility != nil {
-		updates = append(updates, "visibility = ?")
-		args = append(args, *input.Visibility)
-	}
-	if input.OrgVisibility != nil {
-		orgVis := 0
-		if *input.OrgVisibility {
-			orgVis = 1
-		}
-		updates = append(updates, "org_visibility = ?")
-		args = append(args, orgVis)
-	}
-	if input.Timezone != nil {
-		updates = append(updates, "timezone = ?")
-		args = append(args, *input.Timezone)
-	}
-	if input.Language != nil {
-		updates = append(updates, "language = ?")
-		args = append(args, *input.Language)
-	}
-
-	if len(updates) == 0 {
-		return nil
-	}
-
-	// Add updated_at
-	updates = append(updates, "updated_at = ?")
-	args = append(args, time.Now().Unix())
-
-	// Add ID
-	args = append(args, id)
-
-	query := fmt.Sprintf("UPDATE users SET %s WHERE id = ?", strings.Join(updates, ", "))
-	_, err := s.db.Exec(query, args...)
-	return err
+func (s *Service) Update(ctx context.Context, id int64, input UpdateUserInput) error {
+	return s.store.Update(ctx, id, input)
 }
 
 // Delete removes a user
-func (s *Service) Delete(id int64) error {
-	_, err := s.db.Exec("DELETE FROM users WHERE id = ?", id)
-	return err
+func (s *Service) Delete(ctx context.Context, id int64) error {
+	return s.store.Delete(ctx, id)
 }
 
 // UpdatePassword updates a user's password
-func (s *Service) UpdatePassword(id int64, newPassword string) error {
+func (s *Service) UpdatePassword(ctx context.Context, id int64, newPassword string) error {
 	if err := ValidatePassword(newPassword); err != nil {
 		return err
 	}
 
-	passwordHash := HashPassword(newPassword)
-	_, err := s.db.Exec("UPDATE users SET password_hash = ?, updated_at = ? WHERE id = ?",
-		passwordHash, time.Now().Unix(), id)
-	return err
+	passwordHash, err := HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	return s.store.SetPasswordHash(ctx, id, passwordHash)
+}
+
+// SetPasswordHash replaces a user's password hash with a pre-hashed secret
+func (s *Service) SetPasswordHash(ctx context.Context, id int64, passwordHash string) error {
+	if !caspasswd.ValidHash(passwordHash) {
+		return errors.New("password hash must be argon2id, pbkdf2-sha256 or bcrypt")
+	}
+	return s.store.SetPasswordHash(ctx, id, passwordHash)
+}
+
+// SetRole changes a user's role
+func (s *Service) SetRole(ctx context.Context, id int64, role string) error {
+	if role != RoleUser && role != RoleAdmin {
+		return fmt.Errorf("invalid role %q", role)
+	}
+	return s.store.SetRole(ctx, id, role)
 }
 
 // VerifyPassword checks if the provided password matches the user's hash
@@ -386,8 +290,8 @@ func (s *Service) VerifyPassword(user *User, password string) bool {
 }
 
 // Authenticate authenticates a user by identifier and password
-func (s *Service) Authenticate(identifier, password string) (*User, error) {
-	user, err := s.GetByIdentifier(identifier)
+func (s *Service) Authenticate(ctx context.Context, identifier, password string) (*User, error) {
+	user, err := s.GetByIdentifier(ctx, identifier)
 	if err != nil {
 		return nil, ErrInvalidCredentials
 	}
@@ -400,26 +304,30 @@ func (s *Service) Authenticate(identifier, password string) (*User, error) {
 	// Verify password
 	if !VerifyPassword(password, user.PasswordHash) {
 		// Increment failed attempts
-		s.incrementFailedAttempts(user.ID)
+		s.incrementFailedAttempts(ctx, user)
 		return nil, ErrInvalidCredentials
 	}
 
 	// Reset failed attempts on successful login
-	s.resetFailedAttempts(user.ID)
+	s.store.SetFailedAttempts(ctx, user.ID, 0, 0)
+
+	// Transparently upgrade legacy or weaker hashes now that we have the plaintext
+	if NeedsRehash(user.PasswordHash) {
+		if newHash, err := HashPassword(password); err == nil {
+			s.store.SetPasswordHash(ctx, user.ID, newHash)
+			user.PasswordHash = newHash
+		}
+	}
 
 	// Update last login
-	s.updateLastLogin(user.ID)
+	s.store.SetLastLogin(ctx, user.ID, time.Now().Unix())
 
 	return user, nil
 }
 
 // incrementFailedAttempts increases failed login counter and locks if needed
-func (s *Service) incrementFailedAttempts(userID int64) {
-	// Get current failed attempts
-	var failedAttempts int
-	s.db.QueryRow("SELECT failed_attempts FROM users WHERE id = ?", userID).Scan(&failedAttempts)
-
-	failedAttempts++
+func (s *Service) incrementFailedAttempts(ctx context.Context, user *User) {
+	failedAttempts := user.FailedAttempts + 1
 
 	// Lock for 15 minutes after 5 failed attempts (per PART 34)
 	var lockedUntil int64
@@ -427,40 +335,21 @@ func (s *Service) incrementFailedAttempts(userID int64) {
 		lockedUntil = time.Now().Add(15 * time.Minute).Unix()
 	}
 
-	s.db.Exec("UPDATE users SET failed_attempts = ?, locked_until = ? WHERE id = ?",
-		failedAttempts, lockedUntil, userID)
-}
-
-// resetFailedAttempts clears the failed attempts counter
-func (s *Service) resetFailedAttempts(userID int64) {
-	s.db.Exec("UPDATE users SET failed_attempts = 0, locked_until = NULL WHERE id = ?", userID)
-}
-
-// updateLastLogin sets the last login timestamp
-func (s *Service) updateLastLogin(userID int64) {
-	s.db.Exec("UPDATE users SET last_login = ? WHERE id = ?", time.Now().Unix(), userID)
+	s.store.SetFailedAttempts(ctx, user.ID, failedAttempts, lockedUntil)
 }
 
 // SetEmailVerified marks a user's email as verified
-func (s *Service) SetEmailVerified(userID int64, verified bool) error {
-	v := 0
-	if verified {
-		v = 1
-	}
-	_, err := s.db.Exec("UPDATE users SET email_verified = ?, updated_at = ? WHERE id = ?",
-		v, time.Now().Unix(), userID)
-	return err
+func (s *Service) SetEmailVerified(ctx context.Context, userID int64, verified bool) error {
+	return s.store.SetEmailVerified(ctx, userID, verified)
 }
 
 // SetTOTPEnabled enables or disables TOTP for a user
-func (s *Service) SetTOTPEnabled(userID int64, enabled bool, secret string) error {
-	v := 0
-	if enabled {
-		v = 1
+func (s *Service) SetTOTPEnabled(ctx context.Context, userID int64, enabled bool, secret string) error {
+	encrypted, err := s.cipher.Encrypt(secret)
+	if err != nil {
+		return err
 	}
-	_, err := s.db.Exec("UPDATE users SET totp_enabled = ?, totp_secret = ?, updated_at = ? WHERE id = ?",
-		v, secret, time.Now().Unix(), userID)
-	return err
+	return s.store.SetTOTP(ctx, userID, enabled, encrypted)
 }
 
 // ToPublic converts a user to public representation
@@ -492,38 +381,53 @@ func DetectIdentifierType(input string) string {
 	return "username"
 }
 
-// HashPassword hashes a password using Argon2id (per PART 11)
-func HashPassword(password string) string {
-	// Argon2id parameters (OWASP recommended)
-	salt := generateSalt()
-	time := uint32(3)
-	memory := uint32(64 * 1024) // 64 MB
-	threads := uint8(4)
-	keyLen := uint32(32)
-
-	hash := argon2.IDKey([]byte(password), salt, time, memory, threads, keyLen)
+// HashPassword hashes a password using Argon2id (per PART 11), or
+// PBKDF2-HMAC-SHA256 in strict crypto mode
+// Parameters come from caspasswd so server and user hashes share one config
+func HashPassword(password string) (string, error) {
+	return caspasswd.HashPassword(password)
+}
 
-	// Format: $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>
-	b64Salt := hex.EncodeToString(salt)
-	b64Hash := hex.EncodeToString(hash)
+// VerifyPassword verifies a password against a stored hash
+// Accepts standard argon2id/pbkdf2-sha256/bcrypt hashes and the legacy hex-encoded argon2id format
+func VerifyPassword(password, encodedHash string) bool {
+	if caspasswd.VerifyHash(encodedHash, password) {
+		return true
+	}
+	return verifyLegacyHexHash(password, encodedHash)
+}
 
-	return fmt.Sprintf("$argon2id$v=19$m=%d,t=%d,p=%d$%s$%s", memory, time, threads, b64Salt, b64Hash)
+// NeedsRehash reports whether a stored hash should be upgraded on next login
+func NeedsRehash(encodedHash string) bool {
+	if isLegacyHexHash(encodedHash) {
+		return true
+	}
+	return caspasswd.HashNeedsRehash(encodedHash)
 }
 
-// VerifyPassword verifies a password against an Argon2id hash
-func VerifyPassword(password, encodedHash string) bool {
-	// Parse the encoded hash
+// isLegacyHexHash reports whether a hash uses the old hex-encoded salt/hash format
+func isLegacyHexHash(encodedHash string) bool {
 	parts := strings.Split(encodedHash, "$")
-	if len(parts) != 6 {
+	if len(parts) != 6 || parts[1] != "argon2id" {
 		return false
 	}
+	_, err := hex.DecodeString(parts[4])
+	return err == nil && len(parts[4]) == 32
+}
+
+// verifyLegacyHexHash verifies hashes created before salts/hashes were base64 encoded
+func verifyLegacyHexHash(password, encodedHash string) bool {
+	if !isLegacyHexHash(encodedHash) {
+		return false
+	}
+	parts := strings.Split(encodedHash, "$")
 
-	// Parse parameters
 	var memory, time uint32
 	var threads uint8
-	fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads)
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false
+	}
 
-	// Decode salt and hash
 	salt, err := hex.DecodeString(parts[4])
 	if err != nil {
 		return false
@@ -533,26 +437,6 @@ func VerifyPassword(password, encodedHash string) bool {
 		return false
 	}
 
-	// Compute hash with same parameters
 	computedHash := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(storedHash)))
-
-	// Constant-time comparison
-	if len(storedHash) != len(computedHash) {
-		return false
-	}
-	var result byte
-	for i := 0; i < len(storedHash); i++ {
-		result |= storedHash[i] ^ computedHash[i]
-	}
-	return result == 0
-}
-
-// generateSalt generates a random salt
-func generateSalt() []byte {
-	salt := make([]byte, 16)
-	// Use SHA256 of current time + random as simple salt
-	// In production, use crypto/rand
-	h := sha256.Sum256([]byte(fmt.Sprintf("%d", time.Now().UnixNano())))
-	copy(salt, h[:16])
-	return salt
+	return subtle.ConstantTimeCompare(storedHash, computedHash) == 1
 }
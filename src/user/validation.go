@@ -10,6 +10,7 @@ import (
 	"errors"
 	"regexp"
 	"strings"
+	"sync"
 )
 
 // Username validation rules per PART 34
@@ -116,6 +117,25 @@ var criticalBlockedTerms = []string{
 	"admin", "root", "system", "mod", "official", "verified",
 }
 
+// Reserved by the server config (limits.reserved_slugs), replaced on reload
+var (
+	reservedMu    sync.RWMutex
+	reservedSlugs map[string]bool
+)
+
+// SetReservedSlugs reserves usernames on top of UsernameBlocklist
+func SetReservedSlugs(slugs []string) {
+	reserved := make(map[string]bool, len(slugs))
+	for _, slug := range slugs {
+		if slug = strings.ToLower(strings.TrimSpace(slug)); slug != "" {
+			reserved[slug] = true
+		}
+	}
+	reservedMu.Lock()
+	reservedSlugs = reserved
+	reservedMu.Unlock()
+}
+
 // ValidateUsername validates a username per PART 34 rules
 func ValidateUsername(username string) error {
 	username = strings.ToLower(strings.TrimSpace(username))
@@ -162,6 +182,13 @@ func checkUsernameBlocklist(username string) error {
 		}
 	}
 
+	reservedMu.RLock()
+	reserved := reservedSlugs[username]
+	reservedMu.RUnlock()
+	if reserved {
+		return ErrUsernameBlocked
+	}
+
 	// Critical terms substring check
 	for _, term := range criticalBlockedTerms {
 		if strings.Contains(username, term) {
@@ -123,7 +123,7 @@ func (s *Service) HandleGetCurrentUser(w http.ResponseWriter, r *http.Request) e
 	}
 
 	// Get full user data
-	u, err := s.userService.GetByID(authUser.ID)
+	u, err := s.userService.GetByID(r.Context(), authUser.ID)
 	if err != nil {
 		return writeError(w, r, http.StatusInternalServerError, "USER_NOT_FOUND", "User not found")
 	}
@@ -167,12 +167,12 @@ func (s *Service) HandleUpdateUser(w http.ResponseWriter, r *http.Request) error
 		Language:      req.Language,
 	}
 
-	if err := s.userService.Update(authUser.ID, input); err != nil {
+	if err := s.userService.Update(r.Context(), authUser.ID, input); err != nil {
 		return writeError(w, r, http.StatusInternalServerError, "UPDATE_FAILED", "Failed to update profile")
 	}
 
 	// Get updated user
-	u, _ := s.userService.GetByID(authUser.ID)
+	u, _ := s.userService.GetByID(r.Context(), authUser.ID)
 
 	return writeSuccess(w, r, u, "Profile updated", "Profile updated successfully")
 }
@@ -234,7 +234,7 @@ func (s *Service) HandleGetSecurity(w http.ResponseWriter, r *http.Request) erro
 	}
 
 	// Get full user to check TOTP status
-	u, err := s.userService.GetByID(authUser.ID)
+	u, err := s.userService.GetByID(r.Context(), authUser.ID)
 	if err != nil {
 		return writeError(w, r, http.StatusInternalServerError, "USER_NOT_FOUND", "User not found")
 	}
@@ -265,7 +265,7 @@ func (s *Service) HandleEnable2FA(w http.ResponseWriter, r *http.Request) error
 	}
 
 	// Check if 2FA is already enabled
-	u, _ := s.userService.GetByID(authUser.ID)
+	u, _ := s.userService.GetByID(r.Context(), authUser.ID)
 	if u.TOTPEnabled {
 		return writeError(w, r, http.StatusBadRequest, "2FA_ALREADY_ENABLED", "2FA is already enabled")
 	}
@@ -294,7 +294,7 @@ func (s *Service) HandleEnable2FA(w http.ResponseWriter, r *http.Request) error
 	}
 
 	// Enable 2FA
-	if err := s.userService.SetTOTPEnabled(authUser.ID, true, req.Secret); err != nil {
+	if err := s.userService.SetTOTPEnabled(r.Context(), authUser.ID, true, req.Secret); err != nil {
 		return writeError(w, r, http.StatusInternalServerError, "2FA_ENABLE_FAILED", "Failed to enable 2FA")
 	}
 
@@ -321,7 +321,7 @@ func (s *Service) HandleDisable2FA(w http.ResponseWriter, r *http.Request) error
 		return writeError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required")
 	}
 
-	u, _ := s.userService.GetByID(authUser.ID)
+	u, _ := s.userService.GetByID(r.Context(), authUser.ID)
 	if !u.TOTPEnabled {
 		return writeError(w, r, http.StatusBadRequest, "2FA_NOT_ENABLED", "2FA is not enabled")
 	}
@@ -342,7 +342,7 @@ func (s *Service) HandleDisable2FA(w http.ResponseWriter, r *http.Request) error
 	}
 
 	// Disable 2FA
-	if err := s.userService.SetTOTPEnabled(authUser.ID, false, ""); err != nil {
+	if err := s.userService.SetTOTPEnabled(r.Context(), authUser.ID, false, ""); err != nil {
 		return writeError(w, r, http.StatusInternalServerError, "2FA_DISABLE_FAILED", "Failed to disable 2FA")
 	}
 
@@ -375,13 +375,13 @@ func (s *Service) HandleChangePassword(w http.ResponseWriter, r *http.Request) e
 	}
 
 	// Get user and verify current password
-	u, _ := s.userService.GetByID(authUser.ID)
+	u, _ := s.userService.GetByID(r.Context(), authUser.ID)
 	if !s.userService.VerifyPassword(u, req.CurrentPassword) {
 		return writeError(w, r, http.StatusUnauthorized, "INVALID_PASSWORD", "Current password is incorrect")
 	}
 
 	// Update password
-	if err := s.userService.UpdatePassword(authUser.ID, req.NewPassword); err != nil {
+	if err := s.userService.UpdatePassword(r.Context(), authUser.ID, req.NewPassword); err != nil {
 		if errors.Is(err, user.ErrInvalidPassword) {
 			return writeError(w, r, http.StatusBadRequest, "INVALID_NEW_PASSWORD", "New password does not meet requirements")
 		}
@@ -575,7 +575,7 @@ func (s *Service) HandleRegenerateRecoveryKeys(w http.ResponseWriter, r *http.Re
 	}
 
 	// Verify 2FA is enabled
-	u, _ := s.userService.GetByID(authUser.ID)
+	u, _ := s.userService.GetByID(r.Context(), authUser.ID)
 	if !u.TOTPEnabled {
 		return writeError(w, r, http.StatusBadRequest, "2FA_NOT_ENABLED", "2FA must be enabled to generate recovery keys")
 	}
@@ -9,6 +9,8 @@ package web
 import (
 	"html/template"
 	"net/http"
+
+	"github.com/casjay-forks/caspaste/src/content"
 )
 
 type aboutTmpl struct {
@@ -17,8 +19,8 @@ type aboutTmpl struct {
 	BodyMaxLen  int
 	MaxLifeTime int64
 
-	ServerAbout      string
-	ServerRules      string
+	ServerAbout      template.HTML
+	ServerRules      template.HTML
 	ServerTermsExist bool
 
 	AdminName string
@@ -44,9 +46,9 @@ func (data *Data) handleAbout(rw http.ResponseWriter, req *http.Request) error {
 		TitleMaxLen:      data.TitleMaxLen,
 		BodyMaxLen:       data.BodyMaxLen,
 		MaxLifeTime:      data.MaxLifeTime,
-		ServerAbout:      data.ServerAbout,
-		ServerRules:      data.ServerRules,
-		ServerTermsExist: data.ServerTermsExist,
+		ServerAbout:      data.renderContent(req, content.About),
+		ServerRules:      data.renderContent(req, content.Rules),
+		ServerTermsExist: data.Content.Get(content.Terms).Text != "",
 		AdminName:        data.AdminName,
 		AdminMail:        data.AdminMail,
 		Language:         getCookie(req, "lang"),
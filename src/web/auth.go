@@ -100,7 +100,7 @@ func validateSessionToken(token string) (string, bool) {
 	h.Write(data)
 	expectedSig := base64.URLEncoding.EncodeToString(h.Sum(nil))
 
-	if parts[2] != expectedSig {
+	if !hmac.Equal([]byte(parts[2]), []byte(expectedSig)) {
 		return "", false
 	}
 
@@ -118,6 +118,16 @@ func (data *Data) isAuthenticated(req *http.Request) bool {
 	return valid
 }
 
+// SessionUser returns the user name of a valid login session cookie
+func SessionUser(req *http.Request) (string, bool) {
+	cookie, err := req.Cookie(sessionCookieName)
+	if err != nil {
+		return "", false
+	}
+
+	return validateSessionToken(cookie.Value)
+}
+
 // setSessionCookie sets a session cookie for authenticated users
 func setSessionCookie(rw http.ResponseWriter, req *http.Request, username string) {
 	token := generateSessionToken(username)
@@ -318,6 +328,10 @@ func IsPublicPath(path string) bool {
 		"/history.js",
 		"/code.js",
 		"/paste.js",
+		"/cast.js",
+		"/crypt.js",
+		"/shortcuts.js",
+		"/drafts.js",
 		"/manifest.json",
 		"/sw.js",
 		"/robots.txt",
@@ -336,9 +350,11 @@ func IsPublicPath(path string) bool {
 
 	// Prefix match paths - public info pages
 	publicPrefixes := []string{
-		"/about",  // /about, /about/authors, /about/license, /about/source_code
-		"/docs",   // /docs, /docs/apiv1, /docs/libraries, /docs/customize
-		"/terms",  // /terms
+		"/about",    // /about, /about/authors, /about/license, /about/source_code
+		"/docs",     // /docs, /docs/apiv1, /docs/libraries, /docs/customize
+		"/terms",    // /terms
+		"/branding", // /branding/logo, /branding/favicon
+		"/s",        // /s/{token} share links, checked by their token
 	}
 
 	for _, prefix := range publicPrefixes {
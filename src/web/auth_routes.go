@@ -9,13 +9,35 @@ package web
 import (
 	"net/http"
 	"strings"
+
+	"github.com/casjay-forks/caspaste/src/config"
+	"github.com/casjay-forks/caspaste/src/netshare"
 )
 
+// SetRegistration sets who can create an account, see config.RegistrationPublic
+func (data *Data) SetRegistration(mode string) {
+	data.registration.Store(&mode)
+}
+
+// Registration returns the registration mode in effect
+func (data *Data) Registration() string {
+	if mode := data.registration.Load(); mode != nil && *mode != "" {
+		return *mode
+	}
+	return config.RegistrationPublic
+}
+
 // handleRegisterPage handles GET /auth/register
 func (data *Data) handleRegisterPage(rw http.ResponseWriter, req *http.Request) error {
 	if req.Method != http.MethodGet {
 		return ErrMethodNotAllowed
 	}
+	switch data.Registration() {
+	case config.RegistrationDisabled:
+		return netshare.ErrNotFound
+	case config.RegistrationPrivate:
+		return data.handleInviteOnlyPage(rw)
+	}
 
 	rw.Header().Set("Content-Type", "text/html; charset=UTF-8")
 
@@ -59,6 +81,31 @@ func (data *Data) handleRegisterPage(rw http.ResponseWriter, req *http.Request)
 	return err
 }
 
+// handleInviteOnlyPage tells visitors of /auth/register that accounts are
+// created from invitations only
+func (data *Data) handleInviteOnlyPage(rw http.ResponseWriter) error {
+	rw.Header().Set("Content-Type", "text/html; charset=UTF-8")
+
+	html := `<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="UTF-8">
+	<title>Register - ` + data.ServerTitle + `</title>
+	<link rel="stylesheet" href="/style.css">
+</head>
+<body>
+	<div class="container">
+		<h1>Register</h1>
+		<p>Registration on ` + data.ServerTitle + ` is by invitation only. Follow the link in your invitation to create an account.</p>
+		<p>Already have an account? <a href="/login">Login</a></p>
+	</div>
+</body>
+</html>`
+
+	_, err := rw.Write([]byte(html))
+	return err
+}
+
 // handlePasswordForgotPage handles GET /auth/password/forgot
 func (data *Data) handlePasswordForgotPage(rw http.ResponseWriter, req *http.Request) error {
 	if req.Method != http.MethodGet {
@@ -238,6 +285,9 @@ func (data *Data) handleInvitePage(rw http.ResponseWriter, req *http.Request, to
 	if req.Method != http.MethodGet {
 		return ErrMethodNotAllowed
 	}
+	if data.Registration() == config.RegistrationDisabled {
+		return netshare.ErrNotFound
+	}
 
 	rw.Header().Set("Content-Type", "text/html; charset=UTF-8")
 
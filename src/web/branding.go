@@ -0,0 +1,142 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/casjay-forks/caspaste/src/blob"
+	"github.com/casjay-forks/caspaste/src/config"
+	"github.com/casjay-forks/caspaste/src/netshare"
+)
+
+// brandingState is the branding in effect and a hash of it for cache busting
+type brandingState struct {
+	config.Branding
+	version string
+}
+
+// SetBranding replaces the branding in effect; pages and style.css pick it
+// up on the next request
+func (data *Data) SetBranding(b config.Branding) {
+	raw, _ := json.Marshal(b)
+	sum := sha256.Sum256(raw)
+	data.branding.Store(&brandingState{Branding: b, version: hex.EncodeToString(sum[:4])})
+}
+
+// Branding returns the branding in effect
+func (data *Data) Branding() config.Branding {
+	return data.brandingState().Branding
+}
+
+func (data *Data) brandingState() *brandingState {
+	if b := data.branding.Load(); b != nil {
+		return b
+	}
+	return &brandingState{}
+}
+
+// assetURL returns the URL a page uses for the logo or favicon
+// Local files are served by handleBrandingAsset
+func assetURL(name, value string) string {
+	if value == "" || strings.HasPrefix(value, "http://") || strings.HasPrefix(value, "https://") || strings.HasPrefix(value, config.BrandingAssetPath) {
+		return value
+	}
+	return config.BrandingAssetPath + name
+}
+
+// templateFuncs are available to every page template
+func (data *Data) templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		// brand returns title, tagline, logo or version of the live branding
+		"brand": func(key string) string {
+			b := data.brandingState()
+			switch key {
+			case "title":
+				return b.Title
+			case "tagline":
+				return b.TagLine
+			case "logo":
+				return assetURL("logo", b.Logo)
+			case "version":
+				return b.version
+			}
+			return ""
+		},
+		"footerLinks": func() []config.FooterLink {
+			return data.brandingState().FooterLinks
+		},
+		"maintenanceBanner": data.maintenanceBanner,
+	}
+}
+
+// parsePage parses a page template together with the shared layout
+func (data *Data) parsePage(name string) (*template.Template, error) {
+	return template.New("base.tmpl").Funcs(data.templateFuncs()).ParseFS(embFS, "data/base.tmpl", "data/_header.tmpl", "data/_nav.tmpl", "data/_footer.tmpl", "data/"+name)
+}
+
+// brandColor maps theme keys to the branding color overriding them
+func (b *brandingState) brandColor(key string) string {
+	switch key {
+	case "color.Header":
+		return b.Colors.Header
+	case "color.HeaderFont":
+		return b.Colors.HeaderFont
+	case "color.Link":
+		return b.Colors.Link
+	case "color.ButtonGreen", "color.ButtonGreenHover":
+		return b.Colors.Accent
+	}
+	return ""
+}
+
+// Pattern: /branding/logo, /branding/favicon
+// Uploaded assets come from the blob store, configured paths from disk
+func (data *Data) handleBrandingAsset(rw http.ResponseWriter, req *http.Request) error {
+	name := strings.TrimPrefix(req.URL.Path, config.BrandingAssetPath)
+
+	var value string
+	switch name {
+	case "logo":
+		value = data.Branding().Logo
+	case "favicon":
+		value = data.Branding().Favicon
+	default:
+		return netshare.ErrNotFound
+	}
+
+	var content []byte
+	var err error
+	if strings.HasPrefix(value, config.BrandingAssetPath) {
+		if data.Blobs == nil {
+			return netshare.ErrNotFound
+		}
+		content, err = data.Blobs.Get(req.Context(), "branding/"+name)
+		if err == blob.ErrNotFound {
+			return netshare.ErrNotFound
+		}
+	} else if value != "" && assetURL(name, value) != value {
+		content, err = os.ReadFile(value)
+		if os.IsNotExist(err) {
+			return netshare.ErrNotFound
+		}
+	} else {
+		return netshare.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	ServeWithETag(rw, req, content, http.DetectContentType(content), "")
+	return nil
+}
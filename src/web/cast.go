@@ -0,0 +1,75 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/lexers"
+
+	"github.com/casjay-forks/caspaste/src/asciicast"
+)
+
+// Register asciicast as a syntax; the source view highlights it like JSON lines
+func init() {
+	lexers.Register(chroma.MustNewLexer(
+		&chroma.Config{
+			Name:      asciicast.Syntax,
+			Aliases:   []string{"asciicast", "cast"},
+			Filenames: []string{"*.cast"},
+			MimeTypes: []string{"application/x-asciicast"},
+		},
+		func() chroma.Rules {
+			return chroma.Rules{
+				"root": {
+					{Pattern: `"(?:[^"\\]|\\.)*"`, Type: chroma.LiteralString},
+					{Pattern: `-?\d+(?:\.\d+)?(?:[eE][+-]?\d+)?`, Type: chroma.LiteralNumber},
+					{Pattern: `[\[\]{},:]`, Type: chroma.Punctuation},
+					{Pattern: `\s+`, Type: chroma.Text},
+					{Pattern: `[^"\[\]{},:\s]+`, Type: chroma.Keyword},
+				},
+			}
+		},
+	))
+}
+
+// renderCastPlayer renders the player markup; cast.js does the playback
+// The recording is embedded as a JSON string so one-use pastes need no second request
+func (data *Data) renderCastPlayer(req *http.Request, body string) template.HTML {
+	translate := data.Locales.findLocale(req).translate
+
+	// json.Marshal escapes <, > and &, so the string cannot close the script element
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<div class="cast-player" data-play-label="%s" data-pause-label="%s">`,
+		translate("paste.CastPlay"), translate("paste.CastPause"))
+	// Without JavaScript the screen stays empty; the Source tab still works
+	b.WriteString(`<pre class="cast-screen"></pre><div class="cast-controls">`)
+	fmt.Fprintf(&b, `<button type="button" class="cast-play" aria-label="%s">&#9654;</button>`, translate("paste.CastPlay"))
+	fmt.Fprintf(&b, `<input type="range" class="cast-seek" min="0" max="0" step="0.1" value="0" aria-label="%s">`, translate("paste.CastPosition"))
+	b.WriteString(`<span class="cast-time"></span>`)
+	fmt.Fprintf(&b, `<select class="cast-speed" aria-label="%s">`, translate("paste.CastSpeed"))
+	for _, speed := range []string{"0.5", "1", "2", "4"} {
+		selected := ""
+		if speed == "1" {
+			selected = " selected"
+		}
+		fmt.Fprintf(&b, `<option value="%s"%s>%s&times;</option>`, speed, selected, speed)
+	}
+	b.WriteString(`</select></div>`)
+	fmt.Fprintf(&b, `<script type="application/json" class="cast-data">%s</script></div>`, payload)
+	return template.HTML(b.String())
+}
@@ -0,0 +1,25 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package web
+
+import (
+	"html/template"
+	"net/http"
+)
+
+// renderContent renders a published about, rules or terms page
+// Markdown pages become HTML; plain text keeps the highlighted block look
+func (data *Data) renderContent(req *http.Request, name string) template.HTML {
+	page := data.Content.Get(name)
+	if page.Text == "" {
+		return ""
+	}
+	if page.Markdown {
+		return `<div class="markdown-content">` + RenderMarkdown(page.Text) + `</div>`
+	}
+	return data.Themes.findTheme(req, data.UiDefaultTheme).tryHighlight(page.Text, "plaintext")
+}
@@ -38,6 +38,9 @@ type CSRFConfig struct {
 	ExemptPaths []string
 	// ExemptPrefixes are path prefixes that skip CSRF validation
 	ExemptPrefixes []string
+	// ExemptRequest, if set, exempts other requests, such as API calls that
+	// share a path with the web UI
+	ExemptRequest func(*http.Request) bool
 }
 
 // csrfTokenStore manages CSRF tokens per session
@@ -226,7 +229,7 @@ func CSRFMiddleware(config CSRFConfig) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Check if path is exempt from CSRF (API endpoints, compat endpoints)
-			if isCSRFExempt(r.URL.Path, config.ExemptPaths, config.ExemptPrefixes) {
+			if isCSRFExempt(r.URL.Path, config.ExemptPaths, config.ExemptPrefixes) || (config.ExemptRequest != nil && config.ExemptRequest(r)) {
 				next.ServeHTTP(w, r)
 				return
 			}
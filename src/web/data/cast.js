@@ -0,0 +1,637 @@
+/**
+ * This file is part of CasPaste.
+ * CasPaste is free software released under the MIT License.
+ * See LICENSE.md file for details.
+ */
+
+// Asciicast v2 player: a small VT100/xterm subset rendered into a <pre>
+
+(function() {
+	var PALETTE = [
+		"#000000", "#cd3131", "#0dbc79", "#e5e510", "#2472c8", "#bc3fbc", "#11a8cd", "#e5e5e5",
+		"#666666", "#f14c4c", "#23d18b", "#f5f543", "#3b8eea", "#d670d6", "#29b8db", "#ffffff"
+	];
+
+	function color256(n) {
+		if (n < 16) {
+			return PALETTE[n];
+		}
+		if (n < 232) {
+			n -= 16;
+			var steps = [0, 95, 135, 175, 215, 255];
+			return "rgb(" + steps[Math.floor(n / 36)] + "," + steps[Math.floor(n / 6) % 6] + "," + steps[n % 6] + ")";
+		}
+		var grey = 8 + (n - 232) * 10;
+		return "rgb(" + grey + "," + grey + "," + grey + ")";
+	}
+
+	function Terminal(width, height) {
+		this.resize(width, height);
+		this.reset();
+	}
+
+	Terminal.prototype.resize = function(width, height) {
+		this.width = width;
+		this.height = height;
+		var lines = this.lines || [];
+		this.lines = [];
+		for (var y = 0; y < height; y++) {
+			this.lines.push(this.fitLine(lines[y] || []));
+		}
+		this.top = 0;
+		this.bottom = height - 1;
+		this.x = Math.min(this.x || 0, width - 1);
+		this.y = Math.min(this.y || 0, height - 1);
+	};
+
+	Terminal.prototype.fitLine = function(line) {
+		line = line.slice(0, this.width);
+		while (line.length < this.width) {
+			line.push(this.blank());
+		}
+		return line;
+	};
+
+	Terminal.prototype.reset = function() {
+		this.x = 0;
+		this.y = 0;
+		this.wrap = false;
+		this.style = {};
+		this.saved = {x: 0, y: 0};
+		this.cursorVisible = true;
+		this.top = 0;
+		this.bottom = this.height - 1;
+		this.state = "text";
+		this.params = "";
+		for (var y = 0; y < this.height; y++) {
+			this.lines[y] = this.blankLine();
+		}
+	};
+
+	Terminal.prototype.blank = function() {
+		return {ch: " ", style: this.style || {}};
+	};
+
+	Terminal.prototype.blankLine = function() {
+		var line = [];
+		for (var x = 0; x < this.width; x++) {
+			line.push(this.blank());
+		}
+		return line;
+	};
+
+	Terminal.prototype.scrollUp = function(count) {
+		for (var i = 0; i < count; i++) {
+			this.lines.splice(this.top, 1);
+			this.lines.splice(this.bottom, 0, this.blankLine());
+		}
+	};
+
+	Terminal.prototype.scrollDown = function(count) {
+		for (var i = 0; i < count; i++) {
+			this.lines.splice(this.bottom, 1);
+			this.lines.splice(this.top, 0, this.blankLine());
+		}
+	};
+
+	Terminal.prototype.lineFeed = function() {
+		if (this.y === this.bottom) {
+			this.scrollUp(1);
+		} else if (this.y < this.height - 1) {
+			this.y++;
+		}
+	};
+
+	Terminal.prototype.put = function(ch) {
+		if (this.wrap) {
+			this.x = 0;
+			this.lineFeed();
+			this.wrap = false;
+		}
+		this.lines[this.y][this.x] = {ch: ch, style: this.style};
+		if (this.x === this.width - 1) {
+			this.wrap = true;
+		} else {
+			this.x++;
+		}
+	};
+
+	Terminal.prototype.write = function(data) {
+		for (var i = 0; i < data.length; i++) {
+			var ch = data[i];
+			var code = data.charCodeAt(i);
+
+			if (this.state === "esc") {
+				this.escape(ch);
+				continue;
+			}
+			if (this.state === "csi") {
+				if (code >= 0x40 && code <= 0x7e) {
+					this.state = "text";
+					this.csi(ch, this.params);
+				} else {
+					this.params += ch;
+				}
+				continue;
+			}
+			if (this.state === "osc") {
+				// Titles and other OSC strings end with BEL or ST
+				if (ch === "\x07") {
+					this.state = "text";
+				} else if (ch === "\x1b") {
+					this.state = "st";
+				}
+				continue;
+			}
+			if (this.state === "st" || this.state === "charset") {
+				this.state = "text";
+				continue;
+			}
+
+			switch (ch) {
+			case "\x1b":
+				this.state = "esc";
+				break;
+			case "\r":
+				this.x = 0;
+				this.wrap = false;
+				break;
+			case "\n":
+			case "\x0b":
+			case "\x0c":
+				this.lineFeed();
+				this.wrap = false;
+				break;
+			case "\b":
+				if (this.x > 0) {
+					this.x--;
+				}
+				this.wrap = false;
+				break;
+			case "\t":
+				this.x = Math.min(this.width - 1, (Math.floor(this.x / 8) + 1) * 8);
+				break;
+			case "\x07":
+				break;
+			default:
+				// Keep surrogate pairs (emoji and other astral characters) in one cell
+				if (code >= 0xd800 && code <= 0xdbff && i + 1 < data.length) {
+					ch = data.substr(i, 2);
+					i++;
+				}
+				if (code >= 0x20) {
+					this.put(ch);
+				}
+			}
+		}
+	};
+
+	Terminal.prototype.escape = function(ch) {
+		this.state = "text";
+		switch (ch) {
+		case "[":
+			this.state = "csi";
+			this.params = "";
+			break;
+		case "]":
+			this.state = "osc";
+			break;
+		case "(":
+		case ")":
+			this.state = "charset";
+			break;
+		case "7":
+			this.saved = {x: this.x, y: this.y, style: this.style};
+			break;
+		case "8":
+			this.x = this.saved.x;
+			this.y = this.saved.y;
+			this.style = this.saved.style || {};
+			break;
+		case "D":
+			this.lineFeed();
+			break;
+		case "E":
+			this.x = 0;
+			this.lineFeed();
+			break;
+		case "M":
+			if (this.y === this.top) {
+				this.scrollDown(1);
+			} else if (this.y > 0) {
+				this.y--;
+			}
+			break;
+		case "c":
+			this.reset();
+			break;
+		}
+	};
+
+	Terminal.prototype.csi = function(final, raw) {
+		var isPrivate = raw.charAt(0) === "?";
+		var params = raw.replace(/^[?>=]/, "").split(";").map(function(p) {
+			return p === "" ? 0 : parseInt(p, 10) || 0;
+		});
+		var n = Math.max(params[0] || 0, 1);
+		var x, y;
+		this.wrap = false;
+
+		switch (final) {
+		case "A":
+			this.y = Math.max(this.y - n, 0);
+			break;
+		case "B":
+		case "e":
+			this.y = Math.min(this.y + n, this.height - 1);
+			break;
+		case "C":
+		case "a":
+			this.x = Math.min(this.x + n, this.width - 1);
+			break;
+		case "D":
+			this.x = Math.max(this.x - n, 0);
+			break;
+		case "E":
+			this.x = 0;
+			this.y = Math.min(this.y + n, this.height - 1);
+			break;
+		case "F":
+			this.x = 0;
+			this.y = Math.max(this.y - n, 0);
+			break;
+		case "G":
+		case "`":
+			this.x = Math.min(n - 1, this.width - 1);
+			break;
+		case "d":
+			this.y = Math.min(n - 1, this.height - 1);
+			break;
+		case "H":
+		case "f":
+			this.y = Math.min(Math.max(params[0] || 1, 1) - 1, this.height - 1);
+			this.x = Math.min(Math.max(params[1] || 1, 1) - 1, this.width - 1);
+			break;
+		case "J":
+			if (params[0] === 0) {
+				this.eraseLine(this.y, this.x, this.width);
+				for (y = this.y + 1; y < this.height; y++) {
+					this.lines[y] = this.blankLine();
+				}
+			} else if (params[0] === 1) {
+				this.eraseLine(this.y, 0, this.x + 1);
+				for (y = 0; y < this.y; y++) {
+					this.lines[y] = this.blankLine();
+				}
+			} else {
+				for (y = 0; y < this.height; y++) {
+					this.lines[y] = this.blankLine();
+				}
+			}
+			break;
+		case "K":
+			if (params[0] === 0) {
+				this.eraseLine(this.y, this.x, this.width);
+			} else if (params[0] === 1) {
+				this.eraseLine(this.y, 0, this.x + 1);
+			} else {
+				this.eraseLine(this.y, 0, this.width);
+			}
+			break;
+		case "X":
+			this.eraseLine(this.y, this.x, Math.min(this.x + n, this.width));
+			break;
+		case "P":
+			this.lines[this.y].splice(this.x, n);
+			this.lines[this.y] = this.fitLine(this.lines[this.y]);
+			break;
+		case "@":
+			for (x = 0; x < n; x++) {
+				this.lines[this.y].splice(this.x, 0, this.blank());
+			}
+			this.lines[this.y] = this.fitLine(this.lines[this.y]);
+			break;
+		case "L":
+			if (this.y >= this.top && this.y <= this.bottom) {
+				for (y = 0; y < n; y++) {
+					this.lines.splice(this.bottom, 1);
+					this.lines.splice(this.y, 0, this.blankLine());
+				}
+			}
+			break;
+		case "M":
+			if (this.y >= this.top && this.y <= this.bottom) {
+				for (y = 0; y < n; y++) {
+					this.lines.splice(this.y, 1);
+					this.lines.splice(this.bottom, 0, this.blankLine());
+				}
+			}
+			break;
+		case "S":
+			this.scrollUp(n);
+			break;
+		case "T":
+			this.scrollDown(n);
+			break;
+		case "r":
+			this.top = Math.max((params[0] || 1) - 1, 0);
+			this.bottom = Math.min((params[1] || this.height) - 1, this.height - 1);
+			if (this.top >= this.bottom) {
+				this.top = 0;
+				this.bottom = this.height - 1;
+			}
+			this.x = 0;
+			this.y = 0;
+			break;
+		case "s":
+			this.saved = {x: this.x, y: this.y, style: this.style};
+			break;
+		case "u":
+			this.x = this.saved.x;
+			this.y = this.saved.y;
+			break;
+		case "h":
+		case "l":
+			if (isPrivate) {
+				var on = final === "h";
+				params.forEach(function(mode) {
+					if (mode === 25) {
+						this.cursorVisible = on;
+					} else if (mode === 1049 || mode === 47 || mode === 1047) {
+						// Alternate screen: start from a clean screen either way
+						for (y = 0; y < this.height; y++) {
+							this.lines[y] = this.blankLine();
+						}
+						if (!on) {
+							this.x = 0;
+							this.y = 0;
+						}
+					}
+				}, this);
+			}
+			break;
+		case "m":
+			this.sgr(params);
+			break;
+		}
+	};
+
+	Terminal.prototype.eraseLine = function(y, from, to) {
+		for (var x = from; x < to; x++) {
+			this.lines[y][x] = this.blank();
+		}
+	};
+
+	Terminal.prototype.sgr = function(params) {
+		var style = {};
+		for (var key in this.style) {
+			style[key] = this.style[key];
+		}
+		for (var i = 0; i < params.length; i++) {
+			var p = params[i];
+			if (p === 0) {
+				style = {};
+			} else if (p === 1) {
+				style.bold = true;
+			} else if (p === 2) {
+				style.faint = true;
+			} else if (p === 3) {
+				style.italic = true;
+			} else if (p === 4) {
+				style.underline = true;
+			} else if (p === 7) {
+				style.inverse = true;
+			} else if (p === 22) {
+				style.bold = false;
+				style.faint = false;
+			} else if (p === 23) {
+				style.italic = false;
+			} else if (p === 24) {
+				style.underline = false;
+			} else if (p === 27) {
+				style.inverse = false;
+			} else if (p >= 30 && p <= 37) {
+				style.fg = PALETTE[p - 30];
+			} else if (p >= 90 && p <= 97) {
+				style.fg = PALETTE[p - 90 + 8];
+			} else if (p === 39) {
+				style.fg = null;
+			} else if (p >= 40 && p <= 47) {
+				style.bg = PALETTE[p - 40];
+			} else if (p >= 100 && p <= 107) {
+				style.bg = PALETTE[p - 100 + 8];
+			} else if (p === 49) {
+				style.bg = null;
+			} else if ((p === 38 || p === 48) && params[i + 1] === 5) {
+				style[p === 38 ? "fg" : "bg"] = color256(params[i + 2] || 0);
+				i += 2;
+			} else if ((p === 38 || p === 48) && params[i + 1] === 2) {
+				style[p === 38 ? "fg" : "bg"] = "rgb(" + (params[i + 2] || 0) + "," + (params[i + 3] || 0) + "," + (params[i + 4] || 0) + ")";
+				i += 4;
+			}
+		}
+		this.style = style;
+	};
+
+	function styleCSS(style, cursor) {
+		var fg = style.fg, bg = style.bg;
+		// The cursor is drawn as an inverted cell
+		if (!!style.inverse !== !!cursor) {
+			var tmp = fg;
+			fg = bg || "var(--cast-bg)";
+			bg = tmp || "var(--cast-fg)";
+		}
+		var css = "";
+		if (fg) {
+			css += "color:" + fg + ";";
+		}
+		if (bg) {
+			css += "background:" + bg + ";";
+		}
+		if (style.bold) {
+			css += "font-weight:bold;";
+		}
+		if (style.faint) {
+			css += "opacity:0.7;";
+		}
+		if (style.italic) {
+			css += "font-style:italic;";
+		}
+		if (style.underline) {
+			css += "text-decoration:underline;";
+		}
+		return css;
+	}
+
+	Terminal.prototype.render = function(pre, showCursor) {
+		var fragment = document.createDocumentFragment();
+		for (var y = 0; y < this.height; y++) {
+			var line = this.lines[y];
+			var run = "", runCSS = null;
+			for (var x = 0; x <= this.width; x++) {
+				var css = null;
+				if (x < this.width) {
+					var cursor = showCursor && this.cursorVisible && x === this.x && y === this.y;
+					css = styleCSS(line[x].style, cursor);
+				}
+				if (x === this.width || (css !== runCSS && run !== "")) {
+					var span = document.createElement("span");
+					if (runCSS) {
+						span.setAttribute("style", runCSS);
+					}
+					span.textContent = run;
+					fragment.appendChild(span);
+					run = "";
+				}
+				if (x < this.width) {
+					runCSS = css;
+					run += line[x].ch;
+				}
+			}
+			fragment.appendChild(document.createTextNode("\n"));
+		}
+		pre.textContent = "";
+		pre.appendChild(fragment);
+	};
+
+	function formatTime(seconds) {
+		seconds = Math.floor(seconds);
+		var s = seconds % 60;
+		return Math.floor(seconds / 60) + ":" + (s < 10 ? "0" : "") + s;
+	}
+
+	// parseCast returns the header and events, with idle gaps capped
+	function parseCast(text) {
+		var lines = text.split("\n").filter(function(line) {
+			return line.trim() !== "";
+		});
+		var header = JSON.parse(lines[0]);
+		var limit = header.idle_time_limit || 0;
+		var events = [];
+		var last = 0, shift = 0;
+		for (var i = 1; i < lines.length; i++) {
+			var event = JSON.parse(lines[i]);
+			if (limit > 0 && event[0] - last > limit) {
+				shift += event[0] - last - limit;
+			}
+			last = event[0];
+			events.push([event[0] - shift, event[1], event[2]]);
+		}
+		return {header: header, events: events};
+	}
+
+	function Player(root) {
+		var data = root.querySelector(".cast-data");
+		var cast = parseCast(JSON.parse(data.textContent));
+
+		this.root = root;
+		this.header = cast.header;
+		this.events = cast.events;
+		this.duration = this.events.length ? this.events[this.events.length - 1][0] : 0;
+		this.screen = root.querySelector(".cast-screen");
+		this.playButton = root.querySelector(".cast-play");
+		this.seek = root.querySelector(".cast-seek");
+		this.timeLabel = root.querySelector(".cast-time");
+		this.speed = root.querySelector(".cast-speed");
+
+		this.seek.max = this.duration;
+		this.rewind();
+		this.render();
+
+		var player = this;
+		this.playButton.addEventListener("click", function() {
+			player.playing ? player.pause() : player.play();
+		});
+		this.seek.addEventListener("input", function() {
+			player.seekTo(parseFloat(player.seek.value));
+		});
+		this.speed.addEventListener("change", function() {
+			if (player.playing) {
+				player.pause();
+				player.play();
+			}
+		});
+	}
+
+	Player.prototype.rewind = function() {
+		this.term = new Terminal(this.header.width, this.header.height);
+		this.index = 0;
+		this.time = 0;
+	};
+
+	// advance applies every event up to time t
+	Player.prototype.advance = function(t) {
+		while (this.index < this.events.length && this.events[this.index][0] <= t) {
+			var event = this.events[this.index++];
+			if (event[1] === "o") {
+				this.term.write(event[2]);
+			} else if (event[1] === "r") {
+				var size = event[2].split("x");
+				this.term.resize(parseInt(size[0], 10) || this.term.width, parseInt(size[1], 10) || this.term.height);
+			}
+		}
+		this.time = t;
+	};
+
+	Player.prototype.render = function() {
+		this.term.render(this.screen, this.playing || this.time > 0);
+		this.seek.value = this.time;
+		this.timeLabel.textContent = formatTime(this.time) + " / " + formatTime(this.duration);
+	};
+
+	Player.prototype.seekTo = function(t) {
+		if (t < this.time) {
+			this.rewind();
+		}
+		this.advance(t);
+		this.render();
+	};
+
+	Player.prototype.play = function() {
+		if (this.time >= this.duration) {
+			this.rewind();
+		}
+		var player = this;
+		var speed = parseFloat(this.speed.value) || 1;
+		var startTime = this.time;
+		var startClock = performance.now();
+
+		this.playing = true;
+		this.playButton.textContent = "❚❚";
+		this.playButton.setAttribute("aria-label", this.root.getAttribute("data-pause-label"));
+
+		var tick = function(now) {
+			if (!player.playing) {
+				return;
+			}
+			var t = Math.min(startTime + (now - startClock) / 1000 * speed, player.duration);
+			player.advance(t);
+			player.render();
+			if (t >= player.duration) {
+				player.pause();
+				return;
+			}
+			player.frame = requestAnimationFrame(tick);
+		};
+		this.frame = requestAnimationFrame(tick);
+	};
+
+	Player.prototype.pause = function() {
+		this.playing = false;
+		cancelAnimationFrame(this.frame);
+		this.playButton.textContent = "▶";
+		this.playButton.setAttribute("aria-label", this.root.getAttribute("data-play-label"));
+		this.render();
+	};
+
+	document.addEventListener("DOMContentLoaded", function() {
+		document.querySelectorAll(".cast-player").forEach(function(root) {
+			try {
+				new Player(root);
+				root.classList.add("cast-ready");
+			} catch (e) {
+				console.error("cast player:", e);
+			}
+		});
+	});
+})();
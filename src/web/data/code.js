@@ -56,6 +56,17 @@ document.addEventListener("DOMContentLoaded", function() {
 			margin: 0;\
 			animation: fadeout .2s both;\
 		}\
+		@media (hover: none) {\
+			pre button {\
+				visibility: visible;\
+			}\
+			.copy-btn {\
+				top: 8px;\
+				right: 8px;\
+				min-width: 44px;\
+				min-height: 44px;\
+			}\
+		}\
 	";
 
 	var styleSheet = document.createElement("style");
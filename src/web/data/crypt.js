@@ -0,0 +1,150 @@
+/**
+ * This file is part of CasPaste.
+ * CasPaste is free software released under the MIT License.
+ * See LICENSE.md file for details.
+ */
+
+// End-to-end encrypted pastes: the body is sealed with AES-GCM in the browser
+// and the key only lives in the URL fragment, which is never sent to the server
+// Body format: base64(12-byte nonce || ciphertext || 16-byte tag)
+// Key format: 32 bytes, base64url without padding
+var pasteCrypt = (function() {
+	var nonceSize = 12;
+
+	function toBase64(bytes) {
+		var s = "";
+		for (var i = 0; i < bytes.length; i++) {
+			s += String.fromCharCode(bytes[i]);
+		}
+		return btoa(s);
+	}
+
+	function fromBase64(s) {
+		var raw = atob(s);
+		var bytes = new Uint8Array(raw.length);
+		for (var i = 0; i < raw.length; i++) {
+			bytes[i] = raw.charCodeAt(i);
+		}
+		return bytes;
+	}
+
+	function toBase64URL(bytes) {
+		return toBase64(bytes).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+	}
+
+	function fromBase64URL(s) {
+		s = s.replace(/-/g, "+").replace(/_/g, "/");
+		while (s.length % 4 !== 0) {
+			s += "=";
+		}
+		return fromBase64(s);
+	}
+
+	function importKey(raw) {
+		return crypto.subtle.importKey("raw", raw, {name: "AES-GCM"}, false, ["encrypt", "decrypt"]);
+	}
+
+	// encrypt resolves to {body, key} for a new random key
+	function encrypt(text) {
+		var raw = crypto.getRandomValues(new Uint8Array(32));
+		var nonce = crypto.getRandomValues(new Uint8Array(nonceSize));
+		return importKey(raw).then(function(key) {
+			return crypto.subtle.encrypt({name: "AES-GCM", iv: nonce}, key, new TextEncoder().encode(text));
+		}).then(function(sealed) {
+			var out = new Uint8Array(nonceSize + sealed.byteLength);
+			out.set(nonce);
+			out.set(new Uint8Array(sealed), nonceSize);
+			return {body: toBase64(out), key: toBase64URL(raw)};
+		});
+	}
+
+	// decrypt resolves to the text; it rejects on a wrong key or a changed body
+	function decrypt(body, key) {
+		var data = fromBase64(body.trim());
+		return importKey(fromBase64URL(key)).then(function(k) {
+			return crypto.subtle.decrypt({name: "AES-GCM", iv: data.slice(0, nonceSize)}, k, data.slice(nonceSize));
+		}).then(function(plain) {
+			return new TextDecoder().decode(plain);
+		});
+	}
+
+	return {
+		available: !!(window.crypto && window.crypto.subtle),
+		encrypt: encrypt,
+		decrypt: decrypt
+	};
+})();
+
+document.addEventListener("DOMContentLoaded", function() {
+	// Create page: encrypt the text before it leaves the browser
+	var form = document.getElementById("create-paste-form");
+	var toggle = document.getElementById("paste-encrypt");
+	if (form !== null && toggle !== null) {
+		form.addEventListener("submit", function(e) {
+			if (!toggle.checked) {
+				return;
+			}
+			e.preventDefault();
+
+			var editor = document.getElementById("editor");
+			var file = document.getElementById("paste-file");
+			var failed = function() {
+				if (window.showToast) {
+					window.showToast(toggle.dataset.failed, "error");
+				} else {
+					alert(toggle.dataset.failed);
+				}
+			};
+			if (!pasteCrypt.available || (file !== null && file.files.length > 0) || editor.value === "") {
+				failed();
+				return;
+			}
+
+			// Line ends are inside the ciphertext, so the browser applies them
+			var text = editor.value.replace(/\r\n?/g, "\n");
+			var lineEnd = form.elements.lineEnd ? form.elements.lineEnd.value : "LF";
+			if (lineEnd === "CRLF") {
+				text = text.replace(/\n/g, "\r\n");
+			} else if (lineEnd === "CR") {
+				text = text.replace(/\n/g, "\r");
+			}
+
+			pasteCrypt.encrypt(text).then(function(sealed) {
+				var fields = new FormData(form);
+				fields.set("body", sealed.body);
+				fields.set("encrypted", "true");
+				fields.delete("file");
+				return fetch(form.action, {method: "POST", body: fields, credentials: "same-origin"}).then(function(resp) {
+					if (!resp.ok) {
+						throw new Error("HTTP " + resp.status);
+					}
+					// The server redirects to the new paste; the key goes after #
+					window.location.href = resp.url.split("#")[0] + "#" + sealed.key;
+				});
+			}).catch(failed);
+		});
+	}
+
+	// Paste page: decrypt with the key from the link
+	var sealed = document.querySelector(".paste-encrypted");
+	if (sealed === null) {
+		return;
+	}
+	var notice = sealed.querySelector(".encrypted-notice");
+	var key = window.location.hash.slice(1);
+	if (key === "") {
+		return;
+	}
+	if (!pasteCrypt.available) {
+		notice.textContent = sealed.dataset.failed;
+		return;
+	}
+	pasteCrypt.decrypt(sealed.dataset.ciphertext, key).then(function(text) {
+		var pre = document.createElement("pre");
+		pre.className = "paste-decrypted";
+		pre.textContent = text;
+		sealed.replaceChild(pre, notice);
+	}).catch(function() {
+		notice.textContent = sealed.dataset.failed;
+	});
+});
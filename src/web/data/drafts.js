@@ -0,0 +1,267 @@
+/**
+ * This file is part of CasPaste.
+ * CasPaste is free software released under the MIT License.
+ * See LICENSE.md file for details.
+ */
+
+// Create page drafts: autosave to localStorage (and to the server for logged-in
+// users), one draft per tab, with a recovery prompt for drafts no open tab owns
+document.addEventListener("DOMContentLoaded", function() {
+	var form = document.getElementById("create-paste-form");
+	var editor = document.getElementById("editor");
+	if (form === null || editor === null) {
+		return;
+	}
+
+	var titleInput = document.getElementById("paste-title");
+	var syntaxSelect = document.getElementById("syntax");
+	var serverURL = form.dataset.draftsUrl || "";
+
+	var maxAge = 30 * 24 * 60 * 60 * 1000;
+	var maxDrafts = 20;
+
+	function loadDrafts() {
+		try {
+			return JSON.parse(localStorage.getItem("drafts")) || {};
+		} catch (e) {
+			return {};
+		}
+	}
+
+	function storeDrafts(drafts) {
+		try {
+			localStorage.setItem("drafts", JSON.stringify(drafts));
+		} catch (e) {
+			// Storage full or disabled (private browsing)
+		}
+	}
+
+	function newDraftID() {
+		return Date.now().toString(36) + Math.random().toString(36).slice(2, 10);
+	}
+
+	// sessionStorage keeps the draft across reloads of this tab; duplicated tabs
+	// copy it, so the newer tab switches to a fresh ID when the old one answers
+	var draftID;
+	try {
+		draftID = sessionStorage.getItem("draftID") || newDraftID();
+		sessionStorage.setItem("draftID", draftID);
+	} catch (e) {
+		draftID = newDraftID();
+	}
+
+	var openIDs = {};
+	var channel = window.BroadcastChannel ? new BroadcastChannel("caspaste-drafts") : null;
+	if (channel !== null) {
+		channel.onmessage = function(e) {
+			var msg = e.data;
+			if (msg.type === "hello") {
+				openIDs[msg.id] = true;
+				channel.postMessage({type: "here", id: draftID});
+			} else if (msg.type === "here") {
+				if (msg.id === draftID) {
+					draftID = newDraftID();
+					try {
+						sessionStorage.setItem("draftID", draftID);
+					} catch (err) {
+						// Keep the new ID for this page only
+					}
+				}
+				openIDs[msg.id] = true;
+			} else if (msg.type === "bye") {
+				delete openIDs[msg.id];
+			}
+		};
+		channel.postMessage({type: "hello", id: draftID});
+	}
+
+	function currentDraft() {
+		return {
+			title: titleInput !== null ? titleInput.value : "",
+			body: editor.value,
+			syntax: syntaxSelect !== null ? syntaxSelect.value : "",
+			updated: Date.now()
+		};
+	}
+
+	function saveLocal() {
+		var drafts = loadDrafts();
+		var draft = currentDraft();
+		if (draft.body === "" && draft.title === "") {
+			delete drafts[draftID];
+		} else {
+			drafts[draftID] = draft;
+		}
+
+		// Forget old drafts and keep the newest ones
+		var ids = Object.keys(drafts).filter(function(id) {
+			return Date.now() - drafts[id].updated < maxAge;
+		}).sort(function(a, b) {
+			return drafts[b].updated - drafts[a].updated;
+		});
+		var kept = {};
+		ids.slice(0, maxDrafts).forEach(function(id) {
+			kept[id] = drafts[id];
+		});
+		storeDrafts(kept);
+	}
+
+	function serverRequest(method, id, draft) {
+		if (serverURL === "") {
+			return Promise.resolve(null);
+		}
+		var options = {method: method, credentials: "same-origin", keepalive: true, headers: {"Accept": "application/json"}};
+		if (draft) {
+			options.headers["Content-Type"] = "application/json";
+			options.body = JSON.stringify({title: draft.title, body: draft.body, syntax: draft.syntax});
+		}
+		return fetch(serverURL + (id ? "/" + encodeURIComponent(id) : ""), options).then(function(resp) {
+			return resp.ok ? resp.json() : null;
+		}).catch(function() {
+			return null;
+		});
+	}
+
+	function saveServer() {
+		var draft = currentDraft();
+		if (draft.body === "" && draft.title === "") {
+			serverRequest("DELETE", draftID);
+		} else {
+			serverRequest("PUT", draftID, draft);
+		}
+	}
+
+	var localTimer = null;
+	var serverTimer = null;
+	var dirty = false;
+	var submitted = false;
+	function scheduleSave() {
+		dirty = true;
+		clearTimeout(localTimer);
+		localTimer = setTimeout(saveLocal, 1000);
+		if (serverURL !== "") {
+			clearTimeout(serverTimer);
+			serverTimer = setTimeout(saveServer, 5000);
+		}
+	}
+
+	editor.addEventListener("input", scheduleSave);
+	if (titleInput !== null) {
+		titleInput.addEventListener("input", scheduleSave);
+	}
+	if (syntaxSelect !== null) {
+		syntaxSelect.addEventListener("change", scheduleSave);
+	}
+
+	window.addEventListener("pagehide", function() {
+		if (channel !== null) {
+			channel.postMessage({type: "bye", id: draftID});
+		}
+		if (dirty && !submitted) {
+			saveLocal();
+		}
+	});
+
+	// A submitted draft has become a paste
+	form.addEventListener("submit", function() {
+		submitted = true;
+		clearTimeout(localTimer);
+		clearTimeout(serverTimer);
+		var drafts = loadDrafts();
+		delete drafts[draftID];
+		storeDrafts(drafts);
+		serverRequest("DELETE", draftID);
+	});
+
+	function restore(id, draft) {
+		if (titleInput !== null) {
+			titleInput.value = draft.title || "";
+		}
+		editor.value = draft.body || "";
+		if (syntaxSelect !== null && draft.syntax) {
+			syntaxSelect.value = draft.syntax;
+		}
+		editor.dispatchEvent(new Event("input"));
+
+		// This tab now owns the restored draft
+		draftID = id;
+		try {
+			sessionStorage.setItem("draftID", draftID);
+		} catch (e) {
+			// Keep the ID for this page only
+		}
+	}
+
+	function discard(id) {
+		var drafts = loadDrafts();
+		delete drafts[id];
+		storeDrafts(drafts);
+		serverRequest("DELETE", id);
+	}
+
+	function showRecovery(drafts) {
+		var ids = Object.keys(drafts).filter(function(id) {
+			return !openIDs[id] && drafts[id].body !== editor.value;
+		}).sort(function(a, b) {
+			return drafts[b].updated - drafts[a].updated;
+		}).slice(0, 5);
+		if (ids.length === 0) {
+			return;
+		}
+
+		var notice = document.createElement("div");
+		notice.className = "draft-notice";
+		notice.setAttribute("role", "status");
+
+		ids.forEach(function(id) {
+			var draft = drafts[id];
+			var row = document.createElement("div");
+
+			var label = document.createElement("span");
+			var name = draft.title || (draft.body || "").split("\n")[0].slice(0, 60) || "{{call .Translate `main.DraftUntitled`}}";
+			label.textContent = "{{call .Translate `main.DraftFound` `{date}`}}".replace("{date}", new Date(draft.updated).toLocaleString()) + ": " + name;
+			row.appendChild(label);
+
+			var restoreButton = document.createElement("button");
+			restoreButton.type = "button";
+			restoreButton.textContent = "{{call .Translate `main.DraftRestore`}}";
+			restoreButton.addEventListener("click", function() {
+				restore(id, draft);
+				notice.remove();
+			});
+			row.appendChild(restoreButton);
+
+			var discardButton = document.createElement("button");
+			discardButton.type = "button";
+			discardButton.textContent = "{{call .Translate `main.DraftDiscard`}}";
+			discardButton.addEventListener("click", function() {
+				discard(id);
+				row.remove();
+				if (notice.children.length === 0) {
+					notice.remove();
+				}
+			});
+			row.appendChild(discardButton);
+
+			notice.appendChild(row);
+		});
+
+		form.parentNode.insertBefore(notice, form);
+	}
+
+	// Give other tabs a moment to claim their drafts, then offer the rest
+	setTimeout(function() {
+		var drafts = loadDrafts();
+		serverRequest("GET").then(function(resp) {
+			if (resp !== null && resp.ok && resp.data) {
+				resp.data.forEach(function(draft) {
+					var updated = draft.updated_at * 1000;
+					if (!drafts[draft.id] || drafts[draft.id].updated < updated) {
+						drafts[draft.id] = {title: draft.title, body: draft.body, syntax: draft.syntax, updated: updated};
+					}
+				});
+			}
+			showRecovery(drafts);
+		});
+	}, 300);
+});
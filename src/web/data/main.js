@@ -171,6 +171,24 @@ document.addEventListener("DOMContentLoaded", function() {
 		}
 	});
 
+	// Show line numbers for content pre-filled from a template
+	if (editor.value !== "") {
+		editor.dispatchEvent(new Event("input"));
+	}
+
+	// Reload the form pre-filled with the selected template
+	var templateSelect = document.getElementById("paste-template");
+	if (templateSelect) {
+		var currentTemplate = templateSelect.value;
+		templateSelect.addEventListener("change", function() {
+			if (editor.value !== "" && !confirm("Replace the current content with this template?")) {
+				templateSelect.value = currentTemplate;
+				return;
+			}
+			window.location.search = templateSelect.value ? "?template=" + encodeURIComponent(templateSelect.value) : "";
+		});
+	}
+
 	// Add symbol counter
 	var symbolCounterContainer = document.getElementById("symbolCounterContainer");
 	if (symbolCounterContainer) {
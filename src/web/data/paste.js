@@ -30,4 +30,96 @@ document.addEventListener("DOMContentLoaded", function() {
 	if (deleteTime !== null) {
 		deleteTime.textContent = dateToString(new Date(deleteTime.textContent));
 	}
+
+	// Small screens: keep paste details collapsed so the content comes first
+	var meta = document.querySelector(".paste-meta");
+	if (meta !== null && window.matchMedia("(max-width: 719px)").matches) {
+		meta.open = false;
+	}
+
+	// Action bar: copy the raw paste text, share the link where supported
+	var copy = document.querySelector(".action-copy");
+	if (copy !== null) {
+		copy.addEventListener("click", function() {
+			var label = copy.textContent;
+			var done = function() {
+				copy.textContent = copy.dataset.copied;
+				setTimeout(function() {
+					copy.textContent = label;
+				}, 1500);
+			};
+			fetch(copy.dataset.raw).then(function(resp) {
+				return resp.text();
+			}).then(function(text) {
+				if (navigator.clipboard) {
+					return navigator.clipboard.writeText(text).then(done);
+				}
+				copyToClipboard(text);
+				done();
+			});
+		});
+	}
+
+	var share = document.querySelector(".action-share");
+	if (share !== null && navigator.share) {
+		share.hidden = false;
+		share.addEventListener("click", function() {
+			navigator.share({title: document.title, url: window.location.href}).catch(function() {});
+		});
+	}
+
+	// Structured data viewers: expand/collapse all for trees
+	var tree = document.querySelector(".viewer-tree");
+	var tabs = document.querySelector(".viewer-tabs");
+	if (tree !== null && tabs !== null) {
+		var addTreeButton = function(label, open) {
+			var button = document.createElement("button");
+			button.type = "button";
+			button.textContent = label;
+			button.addEventListener("click", function() {
+				tree.querySelectorAll("details").forEach(function(details) {
+					details.open = open;
+				});
+			});
+			tabs.appendChild(button);
+		};
+		addTreeButton("{{call .Translate `paste.ExpandAll`}}", true);
+		addTreeButton("{{call .Translate `paste.CollapseAll`}}", false);
+	}
+
+	// Sortable CSV tables: numeric columns sort numerically
+	document.querySelectorAll(".viewer-table").forEach(function(table) {
+		var body = table.tBodies[0];
+		table.querySelectorAll("th").forEach(function(th, column) {
+			th.tabIndex = 0;
+			var sort = function() {
+				var ascending = th.getAttribute("aria-sort") !== "ascending";
+				table.querySelectorAll("th").forEach(function(other) {
+					other.removeAttribute("aria-sort");
+				});
+				th.setAttribute("aria-sort", ascending ? "ascending" : "descending");
+
+				var rows = Array.prototype.slice.call(body.rows);
+				var cell = function(row) {
+					return row.cells[column] ? row.cells[column].textContent : "";
+				};
+				rows.sort(function(a, b) {
+					var x = cell(a), y = cell(b);
+					var nx = parseFloat(x), ny = parseFloat(y);
+					var result = (!isNaN(nx) && !isNaN(ny) && isFinite(x) && isFinite(y)) ? nx - ny : x.localeCompare(y);
+					return ascending ? result : -result;
+				});
+				rows.forEach(function(row) {
+					body.appendChild(row);
+				});
+			};
+			th.addEventListener("click", sort);
+			th.addEventListener("keydown", function(e) {
+				if (e.key === "Enter" || e.key === " ") {
+					e.preventDefault();
+					sort();
+				}
+			});
+		});
+	});
 });
@@ -0,0 +1,145 @@
+/**
+ * This file is part of CasPaste.
+ * CasPaste is free software released under the MIT License.
+ * See LICENSE.md file for details.
+ */
+
+// Keyboard shortcuts, disabled with the "shortcuts=off" cookie from /settings
+(function() {
+	if (/(^|;\s*)shortcuts=off(;|$)/.test(document.cookie)) {
+		return;
+	}
+
+	var shortcuts = [
+		["n", "{{call .Translate `shortcutsJS.NewPaste`}}"],
+		["Ctrl+Enter", "{{call .Translate `shortcutsJS.Submit`}}"],
+		["y", "{{call .Translate `shortcutsJS.CopyURL`}}"],
+		["r", "{{call .Translate `shortcutsJS.Raw`}}"],
+		["?", "{{call .Translate `shortcutsJS.Help`}}"]
+	];
+
+	var overlay = null;
+
+	function isEditable(element) {
+		if (element === null) {
+			return false;
+		}
+		var tag = element.tagName;
+		return tag === "INPUT" || tag === "TEXTAREA" || tag === "SELECT" || element.isContentEditable;
+	}
+
+	function hideHelp() {
+		if (overlay !== null) {
+			overlay.remove();
+			overlay = null;
+		}
+	}
+
+	function showHelp() {
+		if (overlay !== null) {
+			hideHelp();
+			return;
+		}
+
+		overlay = document.createElement("div");
+		overlay.className = "shortcuts-overlay";
+		overlay.addEventListener("click", function(e) {
+			if (e.target === overlay) {
+				hideHelp();
+			}
+		});
+
+		var dialog = document.createElement("div");
+		dialog.className = "shortcuts-dialog";
+		dialog.setAttribute("role", "dialog");
+		dialog.setAttribute("aria-modal", "true");
+		dialog.setAttribute("aria-labelledby", "shortcuts-title");
+
+		var title = document.createElement("h3");
+		title.id = "shortcuts-title";
+		title.textContent = "{{call .Translate `shortcutsJS.Title`}}";
+		dialog.appendChild(title);
+
+		var list = document.createElement("dl");
+		shortcuts.forEach(function(shortcut) {
+			var key = document.createElement("dt");
+			var kbd = document.createElement("kbd");
+			kbd.textContent = shortcut[0];
+			key.appendChild(kbd);
+			var description = document.createElement("dd");
+			description.textContent = shortcut[1];
+			list.appendChild(key);
+			list.appendChild(description);
+		});
+		dialog.appendChild(list);
+
+		var close = document.createElement("button");
+		close.type = "button";
+		close.textContent = "{{call .Translate `shortcutsJS.Close`}}";
+		close.addEventListener("click", hideHelp);
+		dialog.appendChild(close);
+
+		overlay.appendChild(dialog);
+		document.body.appendChild(overlay);
+		close.focus();
+	}
+
+	function copyURL() {
+		var done = function() {
+			if (typeof showToast === "function") {
+				showToast("{{call .Translate `shortcutsJS.URLCopied`}}", "success");
+			}
+		};
+		if (navigator.clipboard) {
+			navigator.clipboard.writeText(window.location.href).then(done);
+		}
+	}
+
+	document.addEventListener("keydown", function(e) {
+		// Ctrl+Enter (Cmd+Enter on macOS) submits the form being edited
+		if (e.key === "Enter" && (e.ctrlKey || e.metaKey)) {
+			var form = document.activeElement !== null && document.activeElement.form ? document.activeElement.form : document.getElementById("create-paste-form");
+			if (form) {
+				e.preventDefault();
+				if (form.requestSubmit) {
+					form.requestSubmit();
+				} else {
+					form.submit();
+				}
+			}
+			return;
+		}
+
+		if (e.key === "Escape") {
+			hideHelp();
+			return;
+		}
+
+		// Single-key shortcuts never fire while typing or with modifiers held
+		if (e.ctrlKey || e.metaKey || e.altKey || e.defaultPrevented || isEditable(document.activeElement)) {
+			return;
+		}
+
+		switch (e.key) {
+		case "n":
+			window.location.href = "/";
+			break;
+		case "y":
+			copyURL();
+			break;
+		case "r":
+			var raw = document.querySelector("a[href^='/raw/'], a[href^='/s/'][href$='/raw']");
+			if (raw === null) {
+				return;
+			}
+			window.location.href = raw.getAttribute("href");
+			break;
+		case "?":
+			showHelp();
+			break;
+		default:
+			return;
+		}
+		e.preventDefault();
+	});
+})();
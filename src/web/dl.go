@@ -15,6 +15,7 @@ import (
 	chromaLexers "github.com/alecthomas/chroma/v2/lexers"
 
 	"github.com/casjay-forks/caspaste/src/netshare"
+	"github.com/casjay-forks/caspaste/src/raw"
 )
 
 // Pattern: /dl/
@@ -28,15 +29,19 @@ func (data *Data) handleDownload(rw http.ResponseWriter, req *http.Request) erro
 	// Read DB
 	pasteID := string([]rune(req.URL.Path)[4:])
 
-	paste, err := data.DB.PasteGet(pasteID)
+	return data.downloadPaste(rw, req, pasteID)
+}
+
+// downloadPaste serves a paste as a file attachment
+func (data *Data) downloadPaste(rw http.ResponseWriter, req *http.Request, pasteID string) error {
+	paste, err := data.db(req).PasteGet(pasteID)
 	if err != nil {
 		return err
 	}
 
-	// If "one use" paste
+	// If "one use" paste, count the view (deleted after the last one)
 	if paste.OneUse {
-		// Delete paste
-		err = data.DB.PasteDelete(pasteID)
+		paste.ViewsLeft, err = data.db(req).PasteView(pasteID)
 		if err != nil {
 			return err
 		}
@@ -94,6 +99,7 @@ func (data *Data) handleDownload(rw http.ResponseWriter, req *http.Request) erro
 	rw.Header().Set("Content-Disposition", "attachment; filename="+fileName)
 	rw.Header().Set("Content-Transfer-Encoding", "binary")
 	rw.Header().Set("Expires", "0")
+	raw.SetDigest(rw.Header(), []byte(content))
 
 	http.ServeContent(rw, req, fileName, createTime, strings.NewReader(content))
 
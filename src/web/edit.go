@@ -7,8 +7,10 @@
 package web
 
 import (
+	"errors"
 	"net/http"
 
+	"github.com/casjay-forks/caspaste/src/audit"
 	"github.com/casjay-forks/caspaste/src/netshare"
 	"github.com/casjay-forks/caspaste/src/storage"
 )
@@ -30,7 +32,7 @@ func (data *Data) handleEditPaste(rw http.ResponseWriter, req *http.Request) err
 	}
 
 	// Get existing paste
-	paste, err := data.DB.PasteGet(id)
+	paste, err := data.db(req).PasteGet(id)
 	if err != nil {
 		return err
 	}
@@ -46,6 +48,10 @@ func (data *Data) handleEditPaste(rw http.ResponseWriter, req *http.Request) err
 	// Update paste fields
 	newBody := req.PostForm.Get("body")
 	if newBody != "" {
+		// The server cannot re-encrypt, so a new body must already be sealed
+		if paste.Encrypted && !netshare.IsCiphertext(newBody) {
+			return netshare.ErrBadRequest
+		}
 		paste.Body = newBody
 	}
 
@@ -73,9 +79,15 @@ func (data *Data) handleEditPaste(rw http.ResponseWriter, req *http.Request) err
 		IsPrivate:   paste.IsPrivate,
 		IsURL:       paste.IsURL,
 		OriginalURL: paste.OriginalURL,
+		Encrypted:   paste.Encrypted,
 	}
 
-	err = data.DB.PasteUpdate(updatedPaste)
+	err = data.db(req).PasteUpdate(updatedPaste)
+	if errors.Is(err, storage.ErrWORM) || errors.Is(err, storage.ErrLegalHold) {
+		// Record tampering attempts on write-once pastes
+		audit.PasteModifyDenied(id, "edit", netshare.GetClientAddr(req).String(), GetRequestID(req.Context()))
+		return netshare.ErrUnauthorized
+	}
 	if err != nil {
 		return err
 	}
@@ -44,7 +44,7 @@ func (data *Data) handleEmbedded(rw http.ResponseWriter, req *http.Request) erro
 	pasteID := string([]rune(req.URL.Path)[5:])
 
 	// Read DB
-	paste, err := data.DB.PasteGet(pasteID)
+	paste, err := data.db(req).PasteGet(pasteID)
 	if err != nil {
 		if err == storage.ErrNotFoundID {
 			errorNotFound = true
@@ -72,13 +72,19 @@ func (data *Data) handleEmbedded(rw http.ResponseWriter, req *http.Request) erro
 		bodyContent = paste.Body
 	}
 
+	// An encrypted body is shown as stored, without highlighting
+	syntax := paste.Syntax
+	if paste.Encrypted {
+		syntax = "plaintext"
+	}
+
 	tmplData := embTmpl{
 		ID:            paste.ID,
 		CreateTimeStr: createTime.Format("1 Jan, 2006"),
 		DeleteTime:    paste.DeleteTime,
 		OneUse:        paste.OneUse,
 		Title:         paste.Title,
-		Body:          tryHighlight(bodyContent, paste.Syntax, "monokai"),
+		Body:          tryHighlight(bodyContent, syntax, "monokai"),
 
 		ErrorNotFound: errorNotFound,
 		Language:      getCookie(req, "lang"),
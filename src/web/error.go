@@ -62,7 +62,11 @@ func (data *Data) writeError(rw http.ResponseWriter, req *http.Request, e error)
 	// Detect error type
 	var eTmp429 *netshare.RateLimitError
 
-	if e == netshare.ErrBadRequest {
+	if errors.Is(e, storage.ErrHeldForReview) {
+		// Not an error to the poster; the paste awaits an admin
+		errData.Code = 202
+
+	} else if e == netshare.ErrBadRequest {
 		errData.Code = 400
 
 	} else if e == netshare.ErrUnauthorized {
@@ -84,6 +88,10 @@ func (data *Data) writeError(rw http.ResponseWriter, req *http.Request, e error)
 		errData.Code = 429
 		rw.Header().Set("Retry-After", strconv.FormatInt(eTmp429.RetryAfter, 10))
 
+	} else if errors.Is(e, storage.ErrUnavailable) {
+		errData.Code = 503
+		rw.Header().Set("Retry-After", strconv.Itoa(data.DB.Breaker().RetryAfter()))
+
 	} else {
 		errData.Code = 500
 	}
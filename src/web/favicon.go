@@ -9,6 +9,9 @@ package web
 import (
 	"net/http"
 	"os"
+	"strings"
+
+	"github.com/casjay-forks/caspaste/src/config"
 )
 
 // defaultFavicon is a minimal 16x16 1-bit ICO file (70 bytes)
@@ -28,13 +31,31 @@ var defaultFavicon = []byte{
 // Pattern: /favicon.ico
 // Per AI.md PART 16: Serve embedded default or custom favicon
 func (data *Data) handleFavicon(rw http.ResponseWriter, req *http.Request) error {
+	favicon := data.Branding().Favicon
+
+	// Remote favicons are fetched by the browser
+	if strings.HasPrefix(favicon, "http://") || strings.HasPrefix(favicon, "https://") {
+		http.Redirect(rw, req, favicon, http.StatusFound)
+		return nil
+	}
+
+	// Uploaded favicon from the admin panel
+	if strings.HasPrefix(favicon, config.BrandingAssetPath) && data.Blobs != nil {
+		customFavicon, err := data.Blobs.Get(req.Context(), "branding/favicon")
+		if err == nil {
+			ServeWithETag(rw, req, customFavicon, http.DetectContentType(customFavicon), "")
+			return nil
+		}
+		// Fall through to default if the upload is gone
+	}
+
 	rw.Header().Set("Content-Type", "image/x-icon")
 	rw.Header().Set("Cache-Control", "public, max-age=86400")
 
 	// Check for custom favicon path
-	if data.Favicon != "" {
+	if favicon != "" && !strings.HasPrefix(favicon, config.BrandingAssetPath) {
 		// Try to read custom favicon from file
-		customFavicon, err := os.ReadFile(data.Favicon)
+		customFavicon, err := os.ReadFile(favicon)
 		if err == nil {
 			rw.Write(customFavicon)
 			return nil
@@ -0,0 +1,81 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/casjay-forks/caspaste/src/audit"
+	"github.com/casjay-forks/caspaste/src/firewall"
+	"github.com/casjay-forks/caspaste/src/httputil"
+	"github.com/casjay-forks/caspaste/src/metric"
+	"github.com/casjay-forks/caspaste/src/netshare"
+)
+
+// FirewallMiddleware refuses every request from a banned address or
+// network before anything else is done with it
+func FirewallMiddleware(fw *firewall.Firewall) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if fw == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := netshare.GetClientAddr(r)
+			if ban, banned := fw.Check(ip); banned {
+				audit.IPBlocked(ip.String(), r.URL.Path, "banned by firewall rule "+ban.Network, GetRequestID(r.Context()))
+				metric.RecordFirewallBlocked(ban.Source)
+				writeFirewallBanned(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// writeFirewallBanned writes a 403 response in the format the client expects
+func writeFirewallBanned(w http.ResponseWriter, r *http.Request) {
+	format := httputil.GetFrontendResponseFormat(r)
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		format = httputil.GetAPIResponseFormat(r)
+	}
+
+	message := "Your address is banned from this server"
+	switch format {
+	case httputil.FormatJSON:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ok":      false,
+			"error":   "IP_BANNED",
+			"message": message,
+		})
+	case httputil.FormatHTML:
+		w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprintf(w, `<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="UTF-8">
+	<title>Forbidden</title>
+	<style>
+		body { font-family: sans-serif; text-align: center; padding: 50px; }
+		h1 { color: #e74c3c; }
+	</style>
+</head>
+<body>
+	<h1>403 - Forbidden</h1>
+	<p>%s.</p>
+</body>
+</html>`, message)
+	default:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprintf(w, "ERROR: IP_BANNED: %s\n", message)
+	}
+}
@@ -0,0 +1,67 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package web
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/casjay-forks/caspaste/src/audit"
+	"github.com/casjay-forks/caspaste/src/format"
+	"github.com/casjay-forks/caspaste/src/netshare"
+	"github.com/casjay-forks/caspaste/src/storage"
+)
+
+// POST /format/{id} - Save the formatted body of an editable paste
+func (data *Data) handleFormatPaste(rw http.ResponseWriter, req *http.Request) error {
+	// Check method
+	if req.Method != "POST" {
+		return netshare.ErrMethodNotAllowed
+	}
+
+	// Get ID from path
+	id := req.URL.Path[len("/format/"):]
+
+	// Check rate limit
+	err := data.RateLimitNew.CheckAndUse(netshare.GetClientAddr(req))
+	if err != nil {
+		return err
+	}
+
+	// Get existing paste
+	paste, err := data.db(req).PasteGet(id)
+	if err != nil {
+		return err
+	}
+
+	// Check if paste is editable
+	if !paste.IsEditable || paste.IsFile || paste.IsURL || paste.Encrypted {
+		return netshare.ErrUnauthorized
+	}
+
+	body, err := format.Format(paste.Syntax, paste.Body)
+	if err != nil {
+		return netshare.ErrBadRequest
+	}
+
+	if body != paste.Body {
+		paste.Body = body
+		err = data.db(req).PasteUpdate(paste)
+		if errors.Is(err, storage.ErrWORM) || errors.Is(err, storage.ErrLegalHold) {
+			// Record tampering attempts on write-once pastes
+			audit.PasteModifyDenied(id, "format", netshare.GetClientAddr(req).String(), GetRequestID(req.Context()))
+			return netshare.ErrUnauthorized
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Redirect to paste page
+	http.Redirect(rw, req, "/"+id, http.StatusSeeOther)
+	return nil
+}
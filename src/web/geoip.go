@@ -0,0 +1,141 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/casjay-forks/caspaste/src/audit"
+	"github.com/casjay-forks/caspaste/src/config"
+	"github.com/casjay-forks/caspaste/src/geoip"
+	"github.com/casjay-forks/caspaste/src/httputil"
+	"github.com/casjay-forks/caspaste/src/metric"
+	"github.com/casjay-forks/caspaste/src/netshare"
+)
+
+// GeoIPMiddleware counts requests by the country of their client, and
+// refuses the countries and networks the GeoIP policies deny: the viewing
+// policy applies to every request, the creation policy to paste creation too
+// user returns who is signed in ("" = anonymous), for the exemption lists
+// Requests under exemptPrefixes are counted but never refused
+func GeoIPMiddleware(client *geoip.Client, user func(r *http.Request) string, exemptPrefixes []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if client == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !client.Loaded() {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ip := netshare.GetClientAddr(r)
+			result, err := client.Lookup(ip.String())
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			creation := IsPasteCreation(r)
+			action := geoip.ActionView
+			if creation {
+				action = geoip.ActionCreate
+			}
+			var refusal *geoip.Refusal
+			if !hasAnyPrefix(r.URL.Path, exemptPrefixes) {
+				refusal = client.Check(result, creation, func() string { return user(r) })
+			}
+			client.RecordRequest(result.CountryCode, action, refusal != nil)
+			metric.RecordGeoIPRequest(result.CountryCode, action)
+			if refusal == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			reason := "country " + refusal.CountryCode
+			if refusal.Reason == "asn" {
+				reason = fmt.Sprintf("AS%d", refusal.ASN)
+			}
+			if refusal.Action == geoip.ActionCreate {
+				audit.IPBlocked(ip.String(), r.URL.Path, "paste creation refused from "+reason, GetRequestID(r.Context()))
+				metric.RecordGeoIPCreationBlocked(refusal.CountryCode, refusal.Reason)
+			} else {
+				audit.IPBlocked(ip.String(), r.URL.Path, "access refused from "+reason, GetRequestID(r.Context()))
+				metric.RecordGeoIPViewingBlocked(refusal.CountryCode, refusal.Reason)
+			}
+			writeGeoIPRefused(w, r, refusal)
+		})
+	}
+}
+
+// IsPasteCreation matches the requests that create pastes: the web form and
+// PrivateBin at the server root, the API, forks, the editor API, and the
+// pastebin-compatible endpoints
+func IsPasteCreation(r *http.Request) bool {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		return false
+	}
+	apiBase := config.APIBasePath()
+	path := httputil.StripTxtExtension(r.URL.Path)
+	switch path {
+	case "/", apiBase + "/pastes", apiBase + "/editor/pastes",
+		"/api/v1/new", "/api/create", "/api/api_post.php",
+		"/sprunge", "/sprunge/", "/ix", "/ix/", "/termbin", "/nc",
+		"/upload", "/p", "/compat", "/paste", "/documents",
+		"/gists", "/api/v3/gists":
+		// PUT on the API updates a paste
+		return r.Method == http.MethodPost || !strings.HasPrefix(path, "/api/")
+	}
+	return r.Method == http.MethodPost && strings.HasPrefix(path, apiBase+"/pastes/") && strings.HasSuffix(path, "/fork")
+}
+
+// writeGeoIPRefused writes a 451 or 403 response in the format the client expects
+func writeGeoIPRefused(w http.ResponseWriter, r *http.Request, refusal *geoip.Refusal) {
+	format := httputil.GetFrontendResponseFormat(r)
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		format = httputil.GetAPIResponseFormat(r)
+	}
+
+	status := refusal.Status
+	message := "Pastes cannot be created from your country or network; existing pastes can still be read"
+	if refusal.Action == geoip.ActionView {
+		message = "This server is not available from your country or network"
+	}
+	switch format {
+	case httputil.FormatJSON:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ok":      false,
+			"error":   "REGION_BLOCKED",
+			"message": message,
+		})
+	case httputil.FormatHTML:
+		w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="UTF-8">
+	<title>%s</title>
+	<style>
+		body { font-family: sans-serif; text-align: center; padding: 50px; }
+		h1 { color: #e74c3c; }
+	</style>
+</head>
+<body>
+	<h1>%d - %s</h1>
+	<p>%s.</p>
+</body>
+</html>`, http.StatusText(status), status, http.StatusText(status), message)
+	default:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(status)
+		fmt.Fprintf(w, "ERROR: REGION_BLOCKED: %s\n", message)
+	}
+}
@@ -8,13 +8,17 @@ package web
 
 import (
 	"encoding/base64"
+	"errors"
 	"html/template"
 	"net/http"
+	"regexp"
 	"strings"
 	"time"
 
+	"github.com/casjay-forks/caspaste/src/format"
 	"github.com/casjay-forks/caspaste/src/lineend"
 	"github.com/casjay-forks/caspaste/src/netshare"
+	"github.com/casjay-forks/caspaste/src/storage"
 )
 
 // File type detection helpers
@@ -112,6 +116,12 @@ func isTextFileExtension(filename string) bool {
 	return textExts[ext]
 }
 
+// redactedRegex matches a redact.Report summary such as "3 (email: 2, ipv4: 1)"
+var redactedRegex = regexp.MustCompile(`^\d+ \([A-Za-z0-9_:, -]+\)$`)
+
+// largeBodyLines is the line count above which the browser renders paste lines lazily
+const largeBodyLines = 1000
+
 type pasteTmpl struct {
 	ID         string
 	Title      string
@@ -120,6 +130,11 @@ type pasteTmpl struct {
 	CreateTime int64
 	DeleteTime int64
 	OneUse     bool
+	ViewsLeft  int
+	Tags       []string
+	ForkOf     string
+	Forks      int
+	Signature  *storage.SignatureStatus
 
 	LineEnd       string
 	CreateTimeStr string
@@ -147,6 +162,40 @@ type pasteTmpl struct {
 	// Using template.URL to mark as safe for embedding
 	MediaDataURL template.URL
 
+	// End-to-end encrypted body, decrypted by crypt.js with the key from the URL
+	Encrypted  bool
+	Ciphertext string
+
+	// Other public pastes by the same author or with the same syntax
+	Related []storage.PasteListItem
+
+	// Position in the series the paste is part of, nil if none
+	Series *pasteSeries
+
+	// Redaction summary shown to the creator after redirect from the create form
+	Redacted string
+
+	// Structured data viewer (JSON/YAML tree, CSV table), nil for plain text
+	Viewer *pasteViewer
+
+	// Huge pastes skip rendering of off-screen lines (see largeBodyLines)
+	LargeBody bool
+
+	// Formatter support: Formattable shows the Format button, Formatted is set
+	// when viewing the formatted body (?format=1), FormatError when that failed
+	Formattable bool
+	Formatted   bool
+	FormatError string
+	IsEditable  bool
+	CSRFToken   string
+
+	// Links to the paste page, raw body and download; a paste opened through
+	// a share link (Shared) is served under /s/{token}
+	PageURL     string
+	RawURL      string
+	DownloadURL string
+	Shared      bool
+
 	Language  string
 	Theme     func(string) string
 	Translate func(string, ...interface{}) template.HTML
@@ -154,6 +203,7 @@ type pasteTmpl struct {
 
 type pasteContinueTmpl struct {
 	ID        string
+	PageURL   string
 	Language  string
 	Theme     func(string) string
 	Translate func(string, ...interface{}) template.HTML
@@ -171,12 +221,26 @@ func (data *Data) handleGetPaste(rw http.ResponseWriter, req *http.Request) erro
 	// Get paste ID
 	pasteID := string([]rune(req.URL.Path)[1:])
 
+	return data.showPaste(rw, req, pasteID, "")
+}
+
+// showPaste renders a paste, under /s/{shareToken} when opened through a
+// share link
+func (data *Data) showPaste(rw http.ResponseWriter, req *http.Request, pasteID, shareToken string) error {
 	// Read DB
-	paste, err := data.DB.PasteGet(pasteID)
+	paste, err := data.db(req).PasteGet(pasteID)
 	if err != nil {
 		return err
 	}
 
+	// Checked before the view is counted, which may delete the paste
+	// A paste served from cache while the database is unavailable has no
+	// signature status
+	signature, err := data.db(req).PasteSignatureGet(paste.ID, netshare.PasteContent(paste))
+	if err != nil && !errors.Is(err, storage.ErrUnavailable) {
+		return err
+	}
+
 	// If "one use" paste
 	if paste.OneUse {
 		// If continue button not pressed
@@ -185,17 +249,21 @@ func (data *Data) handleGetPaste(rw http.ResponseWriter, req *http.Request) erro
 		if req.PostForm.Get("oneUseContinue") != "true" {
 			tmplData := pasteContinueTmpl{
 				ID:        paste.ID,
+				PageURL:   "/" + paste.ID,
 				Language:  getCookie(req, "lang"),
 				Theme:     data.getThemeFunc(req),
 				Translate: data.Locales.findLocale(req).translate,
 				CSRFToken: GetCSRFToken(req, 32),
 			}
+			if shareToken != "" {
+				tmplData.PageURL = "/s/" + shareToken
+			}
 
 			return data.PasteContinue.Execute(rw, tmplData)
 		}
 
-		// If continue button pressed delete paste
-		err = data.DB.PasteDelete(pasteID)
+		// If continue button pressed count the view (deleted after the last one)
+		paste.ViewsLeft, err = data.db(req).PasteView(pasteID)
 		if err != nil {
 			return err
 		}
@@ -215,7 +283,14 @@ func (data *Data) handleGetPaste(rw http.ResponseWriter, req *http.Request) erro
 	// Detect if content is markdown
 	var isMarkdown bool
 
-	if paste.IsFile {
+	var isFormatted bool
+	var formatError string
+	var viewer *pasteViewer
+
+	if paste.Encrypted {
+		// Only the browser can read the body, so nothing is rendered or indexed
+		rw.Header().Set("X-Robots-Tag", "noindex, nofollow")
+	} else if paste.IsFile {
 		// File upload: try to decode base64, fall back to raw for legacy data
 		var base64Data string
 		fileData, err := base64.StdEncoding.DecodeString(paste.Body)
@@ -260,6 +335,7 @@ func (data *Data) handleGetPaste(rw http.ResponseWriter, req *http.Request) erro
 			}
 			// Text files can be syntax highlighted
 			bodyHTML = data.Themes.findTheme(req, data.UiDefaultTheme).tryHighlight(bodyContent, syntax)
+			viewer = data.renderViewer(req, bodyContent, syntax)
 		} else {
 			// Binary files - show file info, don't try to display content
 			bodyHTML = ""
@@ -274,7 +350,21 @@ func (data *Data) handleGetPaste(rw http.ResponseWriter, req *http.Request) erro
 			// Render markdown to HTML
 			bodyHTML = RenderMarkdown(bodyContent)
 		} else {
+			// Show the formatted body without saving it
+			if req.URL.Query().Get("format") == "1" && format.Supported(paste.Syntax) {
+				formatted, err := format.Format(paste.Syntax, bodyContent)
+				if err != nil {
+					// Parse errors can quote paste content, and translations are not escaped
+					formatError = template.HTMLEscapeString(err.Error())
+				} else {
+					bodyContent = formatted
+					isFormatted = true
+				}
+			}
 			bodyHTML = data.Themes.findTheme(req, data.UiDefaultTheme).tryHighlight(bodyContent, paste.Syntax)
+			if !isFormatted && formatError == "" {
+				viewer = data.renderViewer(req, bodyContent, paste.Syntax)
+			}
 		}
 	}
 
@@ -286,6 +376,11 @@ func (data *Data) handleGetPaste(rw http.ResponseWriter, req *http.Request) erro
 		CreateTime: paste.CreateTime,
 		DeleteTime: paste.DeleteTime,
 		OneUse:     paste.OneUse,
+		ViewsLeft:  paste.ViewsLeft,
+		Tags:       paste.Tags,
+		ForkOf:     paste.ForkOf,
+		Forks:      paste.Forks,
+		Signature:  signature,
 
 		CreateTimeStr: createTime.Format("Mon, 02 Jan 2006 15:04:05 -0700"),
 		DeleteTimeStr: deleteTime.Format("Mon, 02 Jan 2006 15:04:05 -0700"),
@@ -306,13 +401,38 @@ func (data *Data) handleGetPaste(rw http.ResponseWriter, req *http.Request) erro
 		IsMarkdown:   isMarkdown,
 		MediaDataURL: mediaDataURL,
 
+		Viewer: viewer,
+
+		Encrypted: paste.Encrypted,
+
+		Formattable: !paste.IsFile && !paste.OneUse && !paste.Encrypted && !isMarkdown && format.Supported(paste.Syntax),
+		Formatted:   isFormatted,
+		FormatError: formatError,
+		IsEditable:  paste.IsEditable,
+		CSRFToken:   GetCSRFToken(req, 32),
+
+		PageURL:     "/" + paste.ID,
+		RawURL:      "/raw/" + paste.ID,
+		DownloadURL: "/dl/" + paste.ID,
+
 		Language:  getCookie(req, "lang"),
 		Theme:     data.getThemeFunc(req),
 		Translate: data.Locales.findLocale(req).translate,
 	}
 
+	if paste.Encrypted {
+		tmplData.Ciphertext = paste.Body
+	}
+
+	if shareToken != "" {
+		tmplData.PageURL = "/s/" + shareToken
+		tmplData.RawURL = tmplData.PageURL + "/raw"
+		tmplData.DownloadURL = tmplData.PageURL + "/dl"
+		tmplData.Shared = true
+	}
+
 	// Get body line end (only for text content)
-	if !paste.IsFile || isText {
+	if (!paste.IsFile || isText) && !paste.Encrypted {
 		switch lineend.GetLineEnd(bodyContent) {
 		case "\r\n":
 			tmplData.LineEnd = "CRLF"
@@ -321,8 +441,62 @@ func (data *Data) handleGetPaste(rw http.ResponseWriter, req *http.Request) erro
 		default:
 			tmplData.LineEnd = "LF"
 		}
+		tmplData.LargeBody = strings.Count(bodyContent, "\n") >= largeBodyLines
+	}
+
+	// Only well-formed summaries are shown, since the value comes from the URL
+	if redacted := req.URL.Query().Get("redacted"); redactedRegex.MatchString(redacted) {
+		tmplData.Redacted = redacted
+	}
+
+	// Related pastes (disabled server-wide on privacy-focused instances)
+	// A share link opens one paste, not the others of its author
+	if data.UiRelatedPastes && !paste.OneUse && shareToken == "" {
+		related, err := data.db(req).PasteRelated(paste, 5)
+		if err != nil {
+			data.Log.HttpError(req, err)
+		}
+		tmplData.Related = related
+	}
+
+	// Series navigation; a share link opens one paste, not its series
+	if paste.Series != "" && shareToken == "" {
+		series, err := data.db(req).SeriesGet(paste.Series)
+		if err != nil && err != storage.ErrNotFoundID {
+			data.Log.HttpError(req, err)
+		}
+		tmplData.Series = newPasteSeries(series, paste.ID)
 	}
 
 	// Show paste
 	return data.PastePage.Execute(rw, tmplData)
 }
+
+// pasteSeries is where a paste stands in its series; Prev and Next are ""
+// at either end
+type pasteSeries struct {
+	ID    string
+	Part  int
+	Count int
+	Prev  string
+	Next  string
+}
+
+// newPasteSeries returns the position of paste id in series, nil if the
+// series does not list it
+func newPasteSeries(series storage.Series, id string) *pasteSeries {
+	for i, part := range series.Parts {
+		if part.ID != id {
+			continue
+		}
+		nav := &pasteSeries{ID: series.ID, Part: part.Part, Count: len(series.Parts)}
+		if i > 0 {
+			nav.Prev = series.Parts[i-1].ID
+		}
+		if i+1 < len(series.Parts) {
+			nav.Next = series.Parts[i+1].ID
+		}
+		return nav
+	}
+	return nil
+}
@@ -7,10 +7,13 @@ package web
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 	"time"
+
+	"github.com/casjay-forks/caspaste/src/storage"
 )
 
 type healthzResponse struct {
@@ -36,10 +39,14 @@ func (data *Data) handleAPIHealthz(rw http.ResponseWriter, req *http.Request) er
 	}
 
 	// Try to ping database
-	_, err := data.DB.PasteDeleteExpired()
+	_, err := data.db(req).PasteDeleteExpired()
 	if err != nil {
 		resp.Status = "degraded"
 		resp.Database = "error"
+		// The circuit breaker is open; cached pastes are served read-only
+		if errors.Is(err, storage.ErrUnavailable) {
+			resp.Database = "unavailable"
+		}
 	}
 
 	// Set status code and return response per AI.md PART 14 (indented JSON with newline)
@@ -63,10 +70,13 @@ func (data *Data) handleHealthz(rw http.ResponseWriter, req *http.Request) error
 	// Try database check
 	dbStatus := "Connected"
 	statusClass := "healthy"
-	_, err := data.DB.PasteDeleteExpired()
+	_, err := data.db(req).PasteDeleteExpired()
 	if err != nil {
 		dbStatus = "Error"
 		statusClass = "degraded"
+		if errors.Is(err, storage.ErrUnavailable) {
+			dbStatus = "Unavailable, serving cached pastes read-only"
+		}
 	}
 
 	html := `<!DOCTYPE html>
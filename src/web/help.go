@@ -38,7 +38,7 @@ func (data *Data) handleEmbeddedHelp(rw http.ResponseWriter, req *http.Request)
 	pasteID := string([]rune(req.URL.Path)[10:])
 
 	// Read DB
-	paste, err := data.DB.PasteGet(pasteID)
+	paste, err := data.db(req).PasteGet(pasteID)
 	if err != nil {
 		return err
 	}
@@ -10,8 +10,10 @@ import (
 "html/template"
 "net/http"
 "strconv"
+"strings"
 
 "github.com/casjay-forks/caspaste/src/netshare"
+"github.com/casjay-forks/caspaste/src/storage"
 )
 
 // GET /list
@@ -46,8 +48,19 @@ offset = parsedOffset
 }
 }
 
+// Browse by tag: /list?tag=nginx
+tag := strings.ToLower(query.Get("tag"))
+if tag != "" && !storage.ValidTag(tag) {
+return netshare.ErrBadRequest
+}
+
 // Get paste list from database
-pastes, err := data.DB.PasteList(limit, offset)
+pastes, err := data.db(req).PasteList(limit, offset, tag)
+if err != nil {
+return err
+}
+
+tags, err := data.db(req).PasteTagCounts(50)
 if err != nil {
 return err
 }
@@ -68,6 +81,8 @@ return themeMap[key]
 // Render template
 tmplData := struct {
 Pastes     interface{}
+Tag        string
+Tags       []storage.TagCount
 Limit      int
 Offset     int
 NextOffset int
@@ -79,6 +94,8 @@ Theme      func(string) string
 Translate  func(string, ...interface{}) template.HTML
 }{
 Pastes:     pastes,
+Tag:        tag,
+Tags:       tags,
 Limit:      limit,
 Offset:     offset,
 NextOffset: offset + limit,
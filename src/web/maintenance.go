@@ -0,0 +1,32 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package web
+
+import (
+	"time"
+)
+
+// maintenanceNotice is an upcoming maintenance window as shown in the banner
+type maintenanceNotice struct {
+	Starts  string
+	Ends    string
+	Message string
+}
+
+// maintenanceBanner returns the announced maintenance window, or nil
+func (data *Data) maintenanceBanner() *maintenanceNotice {
+	window, ok := data.Maintenance.Upcoming(time.Now())
+	if !ok {
+		return nil
+	}
+	const layout = "2006-01-02 15:04 MST"
+	return &maintenanceNotice{
+		Starts:  time.Unix(window.StartsAt, 0).UTC().Format(layout),
+		Ends:    time.Unix(window.EndsAt, 0).UTC().Format(layout),
+		Message: window.Message,
+	}
+}
@@ -8,24 +8,80 @@ package web
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"html/template"
 	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/casjay-forks/caspaste/src/csp"
+	"github.com/casjay-forks/caspaste/src/httputil"
+	"github.com/casjay-forks/caspaste/src/maintenance"
+	"github.com/casjay-forks/caspaste/src/storage"
 	"github.com/google/uuid"
 )
 
+// headerPolicy is the CSP and framing a request gets
+type headerPolicy struct {
+	// Content-Security-Policy or Content-Security-Policy-Report-Only
+	cspHeader     string
+	csp           string
+	xFrameOptions string
+}
+
+// newHeaderPolicy adds the report endpoint to policy and picks its header
+func newHeaderPolicy(policy, xFrameOptions string, reportOnly bool, reportURI string) headerPolicy {
+	p := headerPolicy{cspHeader: "Content-Security-Policy", csp: policy, xFrameOptions: xFrameOptions}
+	if reportOnly {
+		p.cspHeader = "Content-Security-Policy-Report-Only"
+	}
+	if policy != "" && reportURI != "" && !strings.Contains(policy, "report-uri") {
+		p.csp = strings.TrimRight(policy, "; ") + "; report-uri " + reportURI + "; report-to " + csp.EndpointName
+	}
+	return p
+}
+
 // SecurityHeadersMiddleware adds security headers to all responses per AI.md PART 11
+// The CSP and X-Frame-Options come from the first path override matching
+// the request, if any
 func SecurityHeadersMiddleware(cfg SecurityHeadersConfig) func(http.Handler) http.Handler {
+	def := newHeaderPolicy(cfg.ContentSecurityPolicy, cfg.XFrameOptions, cfg.CSPReportOnly, cfg.CSPReportURI)
+	overrides := make([]headerPolicy, len(cfg.Paths))
+	for i, p := range cfg.Paths {
+		policy, frame := p.ContentSecurityPolicy, p.XFrameOptions
+		if policy == "" {
+			policy = cfg.ContentSecurityPolicy
+		}
+		if frame == "" {
+			frame = cfg.XFrameOptions
+		}
+		overrides[i] = newHeaderPolicy(policy, frame, cfg.CSPReportOnly || p.CSPReportOnly, cfg.CSPReportURI)
+	}
+	var reportingEndpoints string
+	if cfg.CSPReportURI != "" {
+		reportingEndpoints = fmt.Sprintf("%s=%q", csp.EndpointName, cfg.CSPReportURI)
+	}
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			policy := def
+			for i, p := range cfg.Paths {
+				if ok, _ := path.Match(p.Pattern, r.URL.Path); ok {
+					policy = overrides[i]
+					break
+				}
+			}
+
 			// Anti-clickjacking
-			if cfg.XFrameOptions != "" {
-				w.Header().Set("X-Frame-Options", cfg.XFrameOptions)
+			if policy.xFrameOptions != "" {
+				w.Header().Set("X-Frame-Options", policy.xFrameOptions)
 			}
 
 			// Prevent MIME-sniffing
@@ -38,9 +94,12 @@ func SecurityHeadersMiddleware(cfg SecurityHeadersConfig) func(http.Handler) htt
 				w.Header().Set("X-XSS-Protection", cfg.XSSProtection)
 			}
 
-			// Content Security Policy
-			if cfg.ContentSecurityPolicy != "" {
-				w.Header().Set("Content-Security-Policy", cfg.ContentSecurityPolicy)
+			// Content Security Policy, reported to the collector when set
+			if policy.csp != "" {
+				w.Header().Set(policy.cspHeader, policy.csp)
+				if reportingEndpoints != "" {
+					w.Header().Set("Reporting-Endpoints", reportingEndpoints)
+				}
 			}
 
 			// Referrer policy
@@ -63,6 +122,35 @@ func SecurityHeadersMiddleware(cfg SecurityHeadersConfig) func(http.Handler) htt
 	}
 }
 
+// CrawlerBlockMiddleware rejects denied crawler user agents with 403
+// robots.txt stays reachable so crawlers can still read why they are blocked
+func CrawlerBlockMiddleware(agents []string) func(http.Handler) http.Handler {
+	var denied []string
+	for _, agent := range agents {
+		if agent = strings.ToLower(strings.TrimSpace(agent)); agent != "" {
+			denied = append(denied, agent)
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		if len(denied) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/robots.txt" {
+				ua := strings.ToLower(r.UserAgent())
+				for _, agent := range denied {
+					if strings.Contains(ua, agent) {
+						http.Error(w, "Crawling is not permitted", http.StatusForbidden)
+						return
+					}
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // CORSMiddleware adds CORS headers to all responses
 func CORSMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -82,19 +170,102 @@ func CORSMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-// MaintenanceMiddleware checks for maintenance mode file
-func MaintenanceMiddleware(dataDir string, next http.Handler) http.Handler {
+// MaintenanceConfig configures the maintenance mode middleware
+type MaintenanceConfig struct {
+	// DataDir holds the .maintenance file set by --maintenance mode
+	DataDir string
+	// Schedule holds the scheduled maintenance windows (nil = none)
+	Schedule *maintenance.Schedule
+	// ExemptPrefixes stay reachable during a scheduled window, so admins
+	// can end it early; the .maintenance file blocks everything
+	ExemptPrefixes []string
+}
+
+// MaintenanceMiddleware answers 503 while the maintenance file exists or a
+// scheduled window is running
+// API clients get a structured error with the window end time
+func MaintenanceMiddleware(cfg MaintenanceConfig, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		maintenanceFile := dataDir + "/.maintenance"
+		maintenanceFile := cfg.DataDir + "/.maintenance"
 
 		// Check if maintenance mode file exists
 		if _, err := os.Stat(maintenanceFile); err == nil {
-			// Maintenance mode is enabled
-			w.Header().Set("Content-Type", "text/html; charset=UTF-8")
-			w.Header().Set("Retry-After", "3600") // Retry after 1 hour
-			w.WriteHeader(http.StatusServiceUnavailable)
+			// Retry after 1 hour
+			writeMaintenance(w, r, storage.MaintenanceWindow{}, 3600)
+			return
+		}
+
+		now := time.Now()
+		if window, ok := cfg.Schedule.Active(now); ok && !hasAnyPrefix(r.URL.Path, cfg.ExemptPrefixes) {
+			writeMaintenance(w, r, window, window.EndsAt-now.Unix())
+			return
+		}
+
+		// Not in maintenance mode, continue normally
+		next.ServeHTTP(w, r)
+	})
+}
+
+// maintenanceResponse is the 503 body for API clients
+type maintenanceResponse struct {
+	OK         bool   `json:"ok"`
+	Error      string `json:"error"`
+	Message    string `json:"message"`
+	StartsAt   int64  `json:"starts_at,omitempty"`
+	EndsAt     int64  `json:"ends_at,omitempty"`
+	RetryAfter int64  `json:"retry_after"`
+}
 
-			html := `<!DOCTYPE html>
+// writeMaintenance writes the 503 response for a window; the zero window
+// stands for maintenance mode without an end time
+func writeMaintenance(w http.ResponseWriter, r *http.Request, window storage.MaintenanceWindow, retryAfter int64) {
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	message := window.Message
+	if message == "" {
+		message = "The server is currently in maintenance mode."
+	}
+	until := ""
+	if window.EndsAt != 0 {
+		until = time.Unix(window.EndsAt, 0).UTC().Format(time.RFC3339)
+	}
+
+	w.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+
+	format := httputil.GetFrontendResponseFormat(r)
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		format = httputil.GetAPIResponseFormat(r)
+	}
+
+	switch format {
+	case httputil.FormatJSON:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(maintenanceResponse{
+			OK:         false,
+			Error:      "MAINTENANCE",
+			Message:    message,
+			StartsAt:   window.StartsAt,
+			EndsAt:     window.EndsAt,
+			RetryAfter: retryAfter,
+		})
+	case httputil.FormatText:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "ERROR: MAINTENANCE: %s\n", message)
+		if until != "" {
+			fmt.Fprintf(w, "Until: %s\n", until)
+		}
+	default:
+		w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+		w.WriteHeader(http.StatusServiceUnavailable)
+
+		retry := "<p>Please try again later.</p>"
+		if until != "" {
+			retry = "<p>Expected back at " + until + ".</p>"
+		}
+		html := `<!DOCTYPE html>
 <html>
 <head>
 	<meta charset="UTF-8">
@@ -106,17 +277,22 @@ func MaintenanceMiddleware(dataDir string, next http.Handler) http.Handler {
 </head>
 <body>
 	<h1>503 - Service Unavailable</h1>
-	<p>The server is currently in maintenance mode.</p>
-	<p>Please try again later.</p>
+	<p>` + template.HTMLEscapeString(message) + `</p>
+	` + retry + `
 </body>
 </html>`
-			w.Write([]byte(html))
-			return
-		}
+		w.Write([]byte(html))
+	}
+}
 
-		// Not in maintenance mode, continue normally
-		next.ServeHTTP(w, r)
-	})
+// hasAnyPrefix reports whether path starts with one of prefixes
+func hasAnyPrefix(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
 }
 
 // uuidRegex validates UUID v4 format
@@ -409,3 +585,54 @@ func RequireOrgRole(w http.ResponseWriter, r *http.Request, minRole string) bool
 	}
 	return true
 }
+
+// APIAuthenticator resolves a bearer credential to a user
+// Returns ok=false when the credential is not one it understands or is invalid
+type APIAuthenticator func(r *http.Request, credential string) (user *AuthUser, ok bool)
+
+// APIAuthMiddleware populates the auth user context from the Authorization header
+// or session cookie, trying each authenticator in order (sessions, API tokens, JWTs).
+// Requests without valid credentials pass through unauthenticated; handlers decide
+// whether authentication is required.
+func APIAuthMiddleware(authenticators ...APIAuthenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			credential := ""
+			if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+				credential = strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+			} else if cookie, err := r.Cookie("session"); err == nil {
+				credential = cookie.Value
+			}
+
+			if credential != "" {
+				for _, authenticate := range authenticators {
+					if user, ok := authenticate(r, credential); ok {
+						ctx := SetAuthUser(r.Context(), user)
+						ctx = SetSessionToken(ctx, credential)
+						r = r.WithContext(ctx)
+						break
+					}
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// HostResolver maps a request host to a custom domain match
+// Returns ok=false when the host is not a custom domain
+type HostResolver func(ctx context.Context, host string) (match interface{}, ok bool)
+
+// CustomDomainMiddleware stores the custom domain serving the request host in context
+// Hosts that are not custom domains (including the server FQDN) pass through unchanged.
+func CustomDomainMiddleware(resolve HostResolver) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if match, ok := resolve(r.Context(), r.Host); ok {
+				r = r.WithContext(SetCustomDomain(r.Context(), match))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -9,10 +9,18 @@ package web
 import (
 	"html/template"
 	"net/http"
+	"net/url"
+	"strings"
 
+	"github.com/casjay-forks/caspaste/src/config"
+	"github.com/casjay-forks/caspaste/src/content"
 	"github.com/casjay-forks/caspaste/src/netshare"
+	"github.com/casjay-forks/caspaste/src/storage"
 )
 
+// pinnedHomepageLimit is how many pinned pastes the homepage lists
+const pinnedHomepageLimit = 10
+
 type createTmpl struct {
 	Language          string
 	Theme             func(string) string
@@ -28,6 +36,16 @@ type createTmpl struct {
 	AuthorEmailDefault string
 	AuthorURLDefault   string
 
+	// Paste templates; Template is the one selected with ?template=
+	Templates []storage.PasteTemplate
+	Template  storage.PasteTemplate
+
+	// Pastes pinned by an admin, shown above the form
+	Pinned []storage.PasteListItem
+
+	// Drafts API for logged-in users, empty when drafts are kept in the browser only
+	DraftsURL string
+
 	Translate func(string, ...interface{}) template.HTML
 
 	// CSRF token for form protection per AI.md PART 11
@@ -37,13 +55,17 @@ type createTmpl struct {
 func (data *Data) handleNewPaste(rw http.ResponseWriter, req *http.Request) error {
 	// Create paste if need
 	if req.Method == "POST" {
-		pasteID, _, _, err := netshare.PasteAddFromForm(req, data.DB, data.RateLimitNew, data.TitleMaxLen, data.BodyMaxLen, data.MaxLifeTime, data.Lexers)
+		pasteID, _, _, report, err := netshare.PasteAddFromForm(req, data.db(req), data.RateLimitNew, data.TitleMaxLen, data.BodyMaxLen, data.MaxLifeTime, data.Lexers, data.Redaction)
 		if err != nil {
 			return err
 		}
 
-		// Redirect to paste
-		writeRedirect(rw, req, "/"+pasteID, 302)
+		// Redirect to paste, telling the creator what was redacted
+		location := "/" + pasteID
+		if report != nil && report.Total > 0 {
+			location += "?redacted=" + url.QueryEscape(report.String())
+		}
+		writeRedirect(rw, req, location, 302)
 		return nil
 	}
 
@@ -60,6 +82,28 @@ func (data *Data) handleNewPaste(rw http.ResponseWriter, req *http.Request) erro
 		return themeMap[key]
 	}
 
+	// Templates are optional, so a lookup failure only hides the selector
+	templates, _ := data.db(req).TemplateList()
+	var selected storage.PasteTemplate
+	if name := req.URL.Query().Get("template"); name != "" {
+		for _, t := range templates {
+			if t.Name == name {
+				selected = t
+				break
+			}
+		}
+		// Match the syntax selector's lexer names
+		for _, lexer := range data.Lexers {
+			if strings.EqualFold(lexer, selected.Syntax) {
+				selected.Syntax = lexer
+				break
+			}
+		}
+	}
+
+	// Pinned pastes are optional too
+	pinned, _ := data.db(req).PastePinned(pinnedHomepageLimit)
+
 	// Else show create page
 	tmplData := createTmpl{
 		Language:           getCookie(req, "lang"),
@@ -70,14 +114,22 @@ func (data *Data) handleNewPaste(rw http.ResponseWriter, req *http.Request) erro
 		MaxLifeTime:        data.MaxLifeTime,
 		UiDefaultLifeTime:  data.UiDefaultLifeTime,
 		Lexers:             data.Lexers,
-		ServerTermsExist:   data.ServerTermsExist,
+		ServerTermsExist:   data.Content.Get(content.Terms).Text != "",
 		AuthorDefault:      getCookie(req, "author"),
 		AuthorEmailDefault: getCookie(req, "authorEmail"),
 		AuthorURLDefault:   getCookie(req, "authorURL"),
+		Templates:          templates,
+		Template:           selected,
+		Pinned:             pinned,
 		Translate:          data.Locales.findLocale(req).translate,
 		CSRFToken:          GetCSRFToken(req, 32),
 	}
 
+	// Logged-in users also keep drafts on the server
+	if _, ok := SessionUser(req); ok {
+		tmplData.DraftsURL = config.APIBasePath() + "/users/drafts"
+	}
+
 	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
 
 	return data.Main.Execute(rw, tmplData)
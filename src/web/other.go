@@ -44,6 +44,18 @@ func (data *Data) handleToastJS(rw http.ResponseWriter, req *http.Request) error
 	return nil
 }
 
+func (data *Data) handleCastJS(rw http.ResponseWriter, req *http.Request) error {
+	// Asciicast player for terminal recording pastes
+	ServeWithETag(rw, req, *data.CastJS, "application/javascript; charset=utf-8", "static")
+	return nil
+}
+
+func (data *Data) handleCryptJS(rw http.ResponseWriter, req *http.Request) error {
+	// Client-side encryption for end-to-end encrypted pastes
+	ServeWithETag(rw, req, *data.CryptJS, "application/javascript; charset=utf-8", "static")
+	return nil
+}
+
 func (data *Data) handleCodeJS(rw http.ResponseWriter, req *http.Request) error {
 	rw.Header().Set("Content-Type", "application/javascript; charset=utf-8")
 	return data.CodeJS.Execute(rw, jsTmpl{
@@ -70,3 +82,21 @@ func (data *Data) handlePasteJS(rw http.ResponseWriter, req *http.Request) error
 		Translate: data.Locales.findLocale(req).translate,
 	})
 }
+
+func (data *Data) handleShortcutsJS(rw http.ResponseWriter, req *http.Request) error {
+	rw.Header().Set("Content-Type", "application/javascript; charset=utf-8")
+	return data.ShortcutsJS.Execute(rw, jsTmpl{
+		Language:  getCookie(req, "lang"),
+		Theme:     data.getThemeFunc(req),
+		Translate: data.Locales.findLocale(req).translate,
+	})
+}
+
+func (data *Data) handleDraftsJS(rw http.ResponseWriter, req *http.Request) error {
+	rw.Header().Set("Content-Type", "application/javascript; charset=utf-8")
+	return data.DraftsJS.Execute(rw, jsTmpl{
+		Language:  getCookie(req, "lang"),
+		Theme:     data.getThemeFunc(req),
+		Translate: data.Locales.findLocale(req).translate,
+	})
+}
@@ -0,0 +1,100 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/casjay-forks/caspaste/src/httputil"
+	"github.com/casjay-forks/caspaste/src/netshare"
+)
+
+// RateLimitRoute applies a rate limit system to the requests it matches
+type RateLimitRoute struct {
+	Limits *netshare.RateLimitSystem
+	Match  func(r *http.Request) bool
+}
+
+// RateLimitMiddleware rate limits route classes that are not checked by
+// their handlers (the paste handlers check the get and new limits themselves)
+// The first matching route is used
+func RateLimitMiddleware(routes []RateLimitRoute) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, route := range routes {
+				if !route.Match(r) {
+					continue
+				}
+				err := route.Limits.CheckAndUse(netshare.GetClientAddr(r))
+				if rateErr, ok := err.(*netshare.RateLimitError); ok {
+					writeRateLimited(w, r, rateErr.RetryAfter)
+					return
+				}
+				break
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// IsAuthSubmission matches login, registration and password reset submissions
+func IsAuthSubmission(r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		return false
+	}
+	path := r.URL.Path
+	return path == "/login" || strings.HasPrefix(path, "/auth/") || strings.HasPrefix(path, "/api/v1/auth/")
+}
+
+// writeRateLimited writes a 429 response in the format the client expects
+func writeRateLimited(w http.ResponseWriter, r *http.Request, retryAfter int64) {
+	w.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+
+	format := httputil.GetFrontendResponseFormat(r)
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		format = httputil.GetAPIResponseFormat(r)
+	}
+
+	message := "Too many requests"
+	switch format {
+	case httputil.FormatJSON:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ok":          false,
+			"error":       "RATE_LIMITED",
+			"message":     message,
+			"retry_after": retryAfter,
+		})
+	case httputil.FormatHTML:
+		w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprintf(w, `<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="UTF-8">
+	<title>Too Many Requests</title>
+	<style>
+		body { font-family: sans-serif; text-align: center; padding: 50px; }
+		h1 { color: #e74c3c; }
+	</style>
+</head>
+<body>
+	<h1>429 - Too Many Requests</h1>
+	<p>Please try again in %d seconds.</p>
+</body>
+</html>`, retryAfter)
+	default:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprintf(w, "ERROR: RATE_LIMITED: %s, retry in %d seconds\n", message, retryAfter)
+	}
+}
@@ -0,0 +1,87 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/casjay-forks/caspaste/src/audit"
+	"github.com/casjay-forks/caspaste/src/httputil"
+	"github.com/casjay-forks/caspaste/src/netshare"
+	"github.com/casjay-forks/caspaste/src/reputation"
+)
+
+// ReputationMiddleware scores the client IP of each request and adds the
+// score to the request context; the rate limits read it from the checker
+// Writes wait for the score and are refused from blocked addresses, while
+// reads never wait: an unscored address is looked up in the background
+// Paths under exemptPrefixes, such as the admin panel, are never refused
+func ReputationMiddleware(checker *reputation.Checker, exemptPrefixes []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if checker == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			write := !isSafeMethod(r.Method)
+			ip := netshare.GetClientAddr(r)
+			score, ok := checker.Check(ip, write)
+			if ok {
+				if write && score.Blocked && !hasAnyPrefix(r.URL.Path, exemptPrefixes) {
+					audit.IPBlocked(ip.String(), r.URL.Path, fmt.Sprintf("IP reputation score %d", score.Score), GetRequestID(r.Context()))
+					writeReputationBlocked(w, r)
+					return
+				}
+				r = r.WithContext(reputation.NewContext(r.Context(), score))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// writeReputationBlocked writes a 403 response in the format the client expects
+func writeReputationBlocked(w http.ResponseWriter, r *http.Request) {
+	format := httputil.GetFrontendResponseFormat(r)
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		format = httputil.GetAPIResponseFormat(r)
+	}
+
+	message := "Requests from your network are not accepted; pastes can still be read"
+	switch format {
+	case httputil.FormatJSON:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ok":      false,
+			"error":   "IP_BLOCKED",
+			"message": message,
+		})
+	case httputil.FormatHTML:
+		w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprintf(w, `<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="UTF-8">
+	<title>Forbidden</title>
+	<style>
+		body { font-family: sans-serif; text-align: center; padding: 50px; }
+		h1 { color: #e74c3c; }
+	</style>
+</head>
+<body>
+	<h1>403 - Forbidden</h1>
+	<p>%s.</p>
+</body>
+</html>`, message)
+	default:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprintf(w, "ERROR: IP_BLOCKED: %s\n", message)
+	}
+}
@@ -22,6 +22,8 @@ type settingsTmpl struct {
 	ThemeCode     string
 	ThemeSelector map[string]string
 
+	Shortcuts bool
+
 	AuthorAllMaxLen int
 	Author          string
 	AuthorEmail     string
@@ -77,6 +79,7 @@ func (data *Data) handleSettings(rw http.ResponseWriter, req *http.Request) erro
 			LanguageSelector: data.LocalesList,
 			ThemeCode:        getCookie(req, "theme"),
 			ThemeSelector:    data.ThemesList.getForLocale(req),
+			Shortcuts:        getCookie(req, "shortcuts") != "off",
 			AuthorAllMaxLen:  netshare.MaxLengthAuthorAll,
 			Author:           getCookie(req, "author"),
 			AuthorEmail:      getCookie(req, "authorEmail"),
@@ -136,6 +139,22 @@ func (data *Data) handleSettings(rw http.ResponseWriter, req *http.Request) erro
 			})
 		}
 
+		// Shortcuts are on by default, so only the opt-out is stored
+		if req.PostForm.Get("shortcuts") == "" {
+			http.SetCookie(rw, &http.Cookie{
+				Name:   "shortcuts",
+				Value:  "off",
+				MaxAge: cookieMaxAge,
+			})
+
+		} else {
+			http.SetCookie(rw, &http.Cookie{
+				Name:   "shortcuts",
+				Value:  "",
+				MaxAge: -1,
+			})
+		}
+
 		author := req.PostForm.Get("author")
 		if author == "" {
 			http.SetCookie(rw, &http.Cookie{
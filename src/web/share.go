@@ -19,6 +19,21 @@ type SecurityHeadersConfig struct {
 	ReferrerPolicy          string
 	PermissionsPolicy       string
 	StrictTransportSecurity string
+	// Send the CSP as Content-Security-Policy-Report-Only
+	CSPReportOnly bool
+	// Where browsers send CSP violations; empty for nowhere
+	CSPReportURI string
+	// Overrides for some paths, first match wins
+	Paths []SecurityHeadersPath
+}
+
+// SecurityHeadersPath overrides the CSP and framing of the paths matching
+// Pattern, as in path.Match
+type SecurityHeadersPath struct {
+	Pattern               string
+	ContentSecurityPolicy string
+	XFrameOptions         string
+	CSPReportOnly         bool
 }
 
 func getCookie(req *http.Request, name string) string {
@@ -41,7 +56,11 @@ func (data *Data) getThemeFunc(req *http.Request) func(string) string {
 	if !exists {
 		themeMap = data.Themes[data.UiDefaultTheme]
 	}
+	branding := data.brandingState()
 	return func(key string) string {
+		if color := branding.brandColor(key); color != "" {
+			return color
+		}
 		return themeMap[key]
 	}
 }
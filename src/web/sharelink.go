@@ -0,0 +1,60 @@
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package web
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/casjay-forks/caspaste/src/netshare"
+	"github.com/casjay-forks/caspaste/src/raw"
+	"github.com/casjay-forks/caspaste/src/storage"
+)
+
+// Pattern: /s/{token}, /s/{token}/raw, /s/{token}/dl
+// Share links open a paste without logging in until they expire, so they are
+// public paths even on private servers
+func (data *Data) handleShareLink(rw http.ResponseWriter, req *http.Request) error {
+	// Check rate limit
+	err := data.RateLimitGet.CheckAndUse(netshare.GetClientAddr(req))
+	if err != nil {
+		return err
+	}
+
+	token, action, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, "/s/"), "/")
+	link, err := data.db(req).ShareLinkGet(token)
+	if err == storage.ErrShareLinkNotFound {
+		return netshare.ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	// Shared pastes are not for search engines
+	rw.Header().Set("X-Robots-Tag", "noindex, nofollow")
+
+	switch action {
+	case "":
+		return data.showPaste(rw, req, link.PasteID, token)
+
+	case "raw":
+		paste, err := data.db(req).PasteGet(link.PasteID)
+		if err != nil {
+			return err
+		}
+		// If "one use" paste, count the view (deleted after the last one)
+		if paste.OneUse {
+			if paste.ViewsLeft, err = data.db(req).PasteView(link.PasteID); err != nil {
+				return err
+			}
+		}
+		return raw.WritePaste(rw, paste)
+
+	case "dl":
+		return data.downloadPaste(rw, req, link.PasteID)
+	}
+
+	return netshare.ErrNotFound
+}
@@ -52,6 +52,13 @@ func (data *Data) handleRobotsTxt(rw http.ResponseWriter, req *http.Request) err
 	return nil
 }
 
+// setPasteRobotsTag sends the configured X-Robots-Tag on paste pages
+func (data *Data) setPasteRobotsTag(rw http.ResponseWriter) {
+	if data.SiteRobotsPasteTag != "" {
+		rw.Header().Set("X-Robots-Tag", data.SiteRobotsPasteTag)
+	}
+}
+
 func (data *Data) handleSitemap(rw http.ResponseWriter, req *http.Request) error {
 	// Check if sitemap is allowed
 	if data.SiteRobotsDeny == "/" {
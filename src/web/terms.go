@@ -9,10 +9,12 @@ package web
 import (
 	"html/template"
 	"net/http"
+
+	"github.com/casjay-forks/caspaste/src/content"
 )
 
 type termsOfUseTmpl struct {
-	TermsOfUse string
+	TermsOfUse template.HTML
 
 	Language  string
 	Theme     func(string) string
@@ -24,7 +26,7 @@ type termsOfUseTmpl struct {
 func (data *Data) handleTermsOfUse(rw http.ResponseWriter, req *http.Request) error {
 	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
 	return data.TermsOfUse.Execute(rw, termsOfUseTmpl{
-		TermsOfUse: data.ServerTermsOfUse,
+		TermsOfUse: data.renderContent(req, content.Terms),
 		Language:   getCookie(req, "lang"),
 		Theme:      data.getThemeFunc(req),
 		Highlight:  data.Themes.findTheme(req, data.UiDefaultTheme).tryHighlight,
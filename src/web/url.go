@@ -29,7 +29,7 @@ func (data *Data) handleURLRedirect(rw http.ResponseWriter, req *http.Request) e
 	}
 
 	// Get paste from database
-	paste, err := data.DB.PasteGet(id)
+	paste, err := data.db(req).PasteGet(id)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,478 @@
+
+// This file is part of CasPaste.
+
+// CasPaste is free software released under the MIT License.
+// See LICENSE.md file for details.
+
+package web
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"gopkg.in/yaml.v3"
+
+	"github.com/casjay-forks/caspaste/src/asciicast"
+)
+
+// Structured data viewers (JSON tree, YAML tree and JSON conversion, CSV table,
+// asciicast player)
+// Viewers are rendered server-side so they work without JavaScript; paste.js
+// only adds CSV column sorting and expand/collapse all
+
+// Limits keep huge pastes on the plain text view
+const (
+	viewerMaxSize  = 1 << 20
+	viewerMaxNodes = 20000
+	viewerMaxDepth = 100
+	viewerMaxRows  = 5000
+)
+
+var errViewerTooLarge = errors.New("web: paste too large for viewer")
+
+// Chroma has no CSV lexer, so register one to make CSV selectable as a syntax
+func init() {
+	lexers.Register(chroma.MustNewLexer(
+		&chroma.Config{
+			Name:      "CSV",
+			Aliases:   []string{"csv", "tsv"},
+			Filenames: []string{"*.csv", "*.tsv"},
+			MimeTypes: []string{"text/csv", "text/tab-separated-values"},
+		},
+		func() chroma.Rules {
+			return chroma.Rules{
+				"root": {
+					{Pattern: `"(?:[^"]|"")*"`, Type: chroma.LiteralString},
+					{Pattern: `[,;\t]`, Type: chroma.Punctuation},
+					{Pattern: `[^",;\t]+`, Type: chroma.Text},
+					{Pattern: `"`, Type: chroma.Text},
+				},
+			}
+		},
+	))
+}
+
+// viewerTab links to one view of a paste
+type viewerTab struct {
+	Name   string
+	Label  string
+	Active bool
+}
+
+// pasteViewer is the structured view of a paste
+// HTML is empty on the source tab, where the highlighted body is shown
+type pasteViewer struct {
+	Tabs []viewerTab
+	HTML template.HTML
+}
+
+// viewerKind returns the viewer for a syntax, or "" if there is none
+func viewerKind(syntax string) string {
+	switch strings.ToLower(syntax) {
+	case "json":
+		return "json"
+	case "yaml":
+		return "yaml"
+	case "csv", "tsv":
+		return "csv"
+	case "asciicast":
+		return "asciicast"
+	}
+	return ""
+}
+
+// renderViewer picks a viewer by syntax and renders the view selected with ?view=
+// It returns nil when there is no viewer or the body cannot be parsed, so the
+// caller falls back to plain text
+func (data *Data) renderViewer(req *http.Request, body, syntax string) *pasteViewer {
+	kind := viewerKind(syntax)
+	// Recordings are played in the browser, so only parsed views are size limited
+	if kind == "" || (kind != "asciicast" && len(body) > viewerMaxSize) {
+		return nil
+	}
+
+	var views []string
+	var trees []*treeNode
+	var table [][]string
+	var err error
+
+	switch kind {
+	case "json":
+		views = []string{"tree", "source"}
+		var tree *treeNode
+		tree, err = parseJSONTree(body)
+		trees = []*treeNode{tree}
+	case "yaml":
+		views = []string{"tree", "json", "source"}
+		trees, err = parseYAMLTrees(body)
+	case "csv":
+		views = []string{"table", "source"}
+		table, err = parseCSVTable(body)
+	case "asciicast":
+		views = []string{"player", "source"}
+		_, err = asciicast.Parse(body)
+	}
+	if err != nil {
+		return nil
+	}
+
+	view := req.URL.Query().Get("view")
+	if view == "" {
+		view = views[0]
+	}
+
+	viewer := &pasteViewer{}
+	for _, name := range views {
+		viewer.Tabs = append(viewer.Tabs, viewerTab{
+			Name:   name,
+			Label:  "paste.View" + strings.ToUpper(name[:1]) + name[1:],
+			Active: name == view,
+		})
+	}
+
+	switch view {
+	case "tree":
+		viewer.HTML = renderTrees(trees)
+	case "table":
+		viewer.HTML = renderTable(table)
+	case "player":
+		viewer.HTML = data.renderCastPlayer(req, body)
+	case "json":
+		if kind == "yaml" {
+			viewer.HTML = data.Themes.findTheme(req, data.UiDefaultTheme).tryHighlight(treesToJSON(trees), "JSON")
+		}
+	}
+	return viewer
+}
+
+// treeNode is a parsed JSON/YAML value that keeps the original key order
+type treeNode struct {
+	kind byte
+	// JSON literal for scalars
+	value    string
+	keys     []string
+	children []*treeNode
+}
+
+const (
+	nodeObject byte = 'o'
+	nodeArray  byte = 'a'
+	nodeString byte = 's'
+	nodeNumber byte = 'n'
+	nodeBool   byte = 'b'
+	nodeNull   byte = 'z'
+)
+
+// parseJSONTree parses one JSON value
+func parseJSONTree(body string) (*treeNode, error) {
+	dec := json.NewDecoder(strings.NewReader(body))
+	dec.UseNumber()
+
+	budget := viewerMaxNodes
+	tree, err := readJSONValue(dec, &budget, 0)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("web: trailing data after JSON value")
+	}
+	return tree, nil
+}
+
+func readJSONValue(dec *json.Decoder, budget *int, depth int) (*treeNode, error) {
+	if *budget--; *budget < 0 || depth > viewerMaxDepth {
+		return nil, errViewerTooLarge
+	}
+
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := tok.(type) {
+	case json.Delim:
+		node := &treeNode{kind: nodeArray}
+		if t == '{' {
+			node.kind = nodeObject
+		}
+		for dec.More() {
+			if node.kind == nodeObject {
+				keyTok, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				key, _ := keyTok.(string)
+				node.keys = append(node.keys, key)
+			}
+			child, err := readJSONValue(dec, budget, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			node.children = append(node.children, child)
+		}
+		// Closing delimiter
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return node, nil
+	case string:
+		return &treeNode{kind: nodeString, value: jsonString(t)}, nil
+	case json.Number:
+		return &treeNode{kind: nodeNumber, value: t.String()}, nil
+	case bool:
+		return &treeNode{kind: nodeBool, value: fmt.Sprint(t)}, nil
+	default:
+		return &treeNode{kind: nodeNull, value: "null"}, nil
+	}
+}
+
+// parseYAMLTrees parses every document in a YAML stream
+func parseYAMLTrees(body string) ([]*treeNode, error) {
+	dec := yaml.NewDecoder(strings.NewReader(body))
+	budget := viewerMaxNodes
+
+	var trees []*treeNode
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		tree, err := yamlTree(&doc, &budget, 0)
+		if err != nil {
+			return nil, err
+		}
+		trees = append(trees, tree)
+	}
+	if len(trees) == 0 {
+		return nil, errors.New("web: empty YAML document")
+	}
+	return trees, nil
+}
+
+func yamlTree(n *yaml.Node, budget *int, depth int) (*treeNode, error) {
+	// Aliases are expanded, so the budget also stops alias bombs
+	if *budget--; *budget < 0 || depth > viewerMaxDepth {
+		return nil, errViewerTooLarge
+	}
+
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			return &treeNode{kind: nodeNull, value: "null"}, nil
+		}
+		return yamlTree(n.Content[0], budget, depth)
+	case yaml.AliasNode:
+		return yamlTree(n.Alias, budget, depth+1)
+	case yaml.MappingNode:
+		node := &treeNode{kind: nodeObject}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key := n.Content[i]
+			if key.Kind != yaml.ScalarNode {
+				return nil, errors.New("web: complex YAML keys are not supported")
+			}
+			child, err := yamlTree(n.Content[i+1], budget, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			node.keys = append(node.keys, key.Value)
+			node.children = append(node.children, child)
+		}
+		return node, nil
+	case yaml.SequenceNode:
+		node := &treeNode{kind: nodeArray}
+		for _, item := range n.Content {
+			child, err := yamlTree(item, budget, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			node.children = append(node.children, child)
+		}
+		return node, nil
+	}
+
+	// Scalar: resolve the YAML type and keep its JSON form
+	var v interface{}
+	if err := n.Decode(&v); err != nil {
+		return nil, err
+	}
+	switch v.(type) {
+	case nil:
+		return &treeNode{kind: nodeNull, value: "null"}, nil
+	case bool:
+		return &treeNode{kind: nodeBool, value: fmt.Sprint(v)}, nil
+	case int, int64, uint64, float64:
+		// .inf and .nan have no JSON form and stay strings
+		if literal, err := json.Marshal(v); err == nil {
+			return &treeNode{kind: nodeNumber, value: string(literal)}, nil
+		}
+	}
+	// Strings, timestamps and anything else keep their source text
+	return &treeNode{kind: nodeString, value: jsonString(n.Value)}, nil
+}
+
+// jsonString quotes s as a JSON string without escaping HTML characters
+// (output is HTML-escaped when rendered)
+func jsonString(s string) string {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// renderTrees renders collapsible trees, one per document
+func renderTrees(trees []*treeNode) template.HTML {
+	var b strings.Builder
+	b.WriteString(`<div class="viewer-tree">`)
+	for i, tree := range trees {
+		if i > 0 {
+			b.WriteString(`<hr>`)
+		}
+		writeTreeHTML(&b, tree)
+	}
+	b.WriteString(`</div>`)
+	return template.HTML(b.String())
+}
+
+func writeTreeHTML(b *strings.Builder, n *treeNode) {
+	switch n.kind {
+	case nodeObject, nodeArray:
+		open, close := "[", "]"
+		if n.kind == nodeObject {
+			open, close = "{", "}"
+		}
+		if len(n.children) == 0 {
+			fmt.Fprintf(b, `<span class="viewer-punct">%s%s</span>`, open, close)
+			return
+		}
+		fmt.Fprintf(b, `<details open><summary data-close="%s"><span class="viewer-punct">%s</span> <span class="viewer-count">%d</span></summary><ul>`,
+			close, open, len(n.children))
+		for i, child := range n.children {
+			b.WriteString(`<li>`)
+			if n.kind == nodeObject {
+				fmt.Fprintf(b, `<span class="viewer-key">%s</span>: `, template.HTMLEscapeString(n.keys[i]))
+			}
+			writeTreeHTML(b, child)
+			b.WriteString(`</li>`)
+		}
+		fmt.Fprintf(b, `</ul><span class="viewer-punct">%s</span></details>`, close)
+	case nodeString:
+		fmt.Fprintf(b, `<span class="viewer-string">%s</span>`, template.HTMLEscapeString(n.value))
+	case nodeNumber:
+		fmt.Fprintf(b, `<span class="viewer-number">%s</span>`, template.HTMLEscapeString(n.value))
+	default:
+		fmt.Fprintf(b, `<span class="viewer-literal">%s</span>`, n.value)
+	}
+}
+
+// treesToJSON converts YAML documents to indented JSON, keeping key order
+func treesToJSON(trees []*treeNode) string {
+	var out strings.Builder
+	for _, tree := range trees {
+		var compact, indented bytes.Buffer
+		writeTreeJSON(&compact, tree)
+		if err := json.Indent(&indented, compact.Bytes(), "", "  "); err != nil {
+			indented = compact
+		}
+		out.Write(indented.Bytes())
+		out.WriteByte('\n')
+	}
+	return out.String()
+}
+
+func writeTreeJSON(b *bytes.Buffer, n *treeNode) {
+	switch n.kind {
+	case nodeObject:
+		b.WriteByte('{')
+		for i, child := range n.children {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(jsonString(n.keys[i]))
+			b.WriteByte(':')
+			writeTreeJSON(b, child)
+		}
+		b.WriteByte('}')
+	case nodeArray:
+		b.WriteByte('[')
+		for i, child := range n.children {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			writeTreeJSON(b, child)
+		}
+		b.WriteByte(']')
+	default:
+		b.WriteString(n.value)
+	}
+}
+
+// parseCSVTable reads a CSV or TSV paste; the delimiter is sniffed from the first line
+func parseCSVTable(body string) ([][]string, error) {
+	r := csv.NewReader(strings.NewReader(body))
+	r.Comma = sniffDelimiter(body)
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+
+	var rows [][]string
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(rows) > viewerMaxRows {
+			return nil, errViewerTooLarge
+		}
+		rows = append(rows, record)
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("web: empty CSV")
+	}
+	return rows, nil
+}
+
+func sniffDelimiter(body string) rune {
+	line, _, _ := strings.Cut(body, "\n")
+	best, bestCount := ',', strings.Count(line, ",")
+	for _, d := range []rune{'\t', ';'} {
+		if c := strings.Count(line, string(d)); c > bestCount {
+			best, bestCount = d, c
+		}
+	}
+	return best
+}
+
+// renderTable renders the first row as the header; paste.js makes columns sortable
+func renderTable(rows [][]string) template.HTML {
+	var b strings.Builder
+	b.WriteString(`<div class="viewer-table-wrap"><table class="viewer-table"><thead><tr>`)
+	for _, cell := range rows[0] {
+		fmt.Fprintf(&b, `<th scope="col">%s</th>`, template.HTMLEscapeString(cell))
+	}
+	b.WriteString(`</tr></thead><tbody>`)
+	for _, row := range rows[1:] {
+		b.WriteString(`<tr>`)
+		for _, cell := range row {
+			fmt.Fprintf(&b, `<td>%s</td>`, template.HTMLEscapeString(cell))
+		}
+		b.WriteString(`</tr>`)
+	}
+	b.WriteString(`</tbody></table></div>`)
+	return template.HTML(b.String())
+}
@@ -12,15 +12,20 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"sync/atomic"
 	textTemplate "text/template"
 	"time"
 
 	chromaLexers "github.com/alecthomas/chroma/v2/lexers"
 
+	"github.com/casjay-forks/caspaste/src/blob"
 	"github.com/casjay-forks/caspaste/src/caspasswd"
 	"github.com/casjay-forks/caspaste/src/config"
+	"github.com/casjay-forks/caspaste/src/content"
 	"github.com/casjay-forks/caspaste/src/logger"
+	"github.com/casjay-forks/caspaste/src/maintenance"
 	"github.com/casjay-forks/caspaste/src/netshare"
+	"github.com/casjay-forks/caspaste/src/redact"
 	"github.com/casjay-forks/caspaste/src/storage"
 )
 
@@ -46,10 +51,14 @@ type Data struct {
 	MainJS         *[]byte
 	BurnAfterJS    *[]byte
 	ToastJS        *[]byte
+	CastJS         *[]byte
+	CryptJS        *[]byte
 	HistoryJS      *textTemplate.Template
 	CodeJS         *textTemplate.Template
 	PastePage      *template.Template
 	PasteJS        *textTemplate.Template
+	ShortcutsJS    *textTemplate.Template
+	DraftsJS       *textTemplate.Template
 	PasteContinue  *template.Template
 	Settings       *template.Template
 	ListPage       *template.Template
@@ -75,10 +84,9 @@ type Data struct {
 	BodyMaxLen  int
 	MaxLifeTime int64
 
-	ServerAbout      string
-	ServerRules      string
-	ServerTermsExist bool
-	ServerTermsOfUse string
+	Redaction *redact.Policy
+
+	Content *content.Set
 	SecurityTxt      string
 
 	// Server info
@@ -95,10 +103,18 @@ type Data struct {
 	SiteRobotsAllow      string
 	SiteRobotsDeny       string
 	SiteRobotsAgentsDeny []string
+	SiteRobotsPasteTag   string
+
+	// Branding is swapped by the admin panel and config reloads; uploaded
+	// logo and favicon files live in Blobs
+	branding atomic.Pointer[brandingState]
+	Blobs    blob.Store
 
-	// Branding
-	Logo    string
-	Favicon string
+	// Registration mode, swapped by the admin panel and config reloads
+	registration atomic.Pointer[string]
+
+	// Maintenance windows are announced in a banner before they start
+	Maintenance *maintenance.Schedule
 
 	// true = open/public (no auth), false = auth required
 	Public        bool
@@ -109,6 +125,7 @@ type Data struct {
 
 	UiDefaultLifeTime string
 	UiDefaultTheme    string
+	UiRelatedPastes   bool
 }
 
 // LoadContentWithOverride loads content from embedded FS or overrides from file
@@ -135,6 +152,12 @@ func LoadContentWithOverride(embeddedPath, overridePath string) (string, error)
 	return string(content), nil
 }
 
+// db binds the storage to a request, so its queries stop when the client goes
+// away and the pastes it creates record the client's address
+func (data *Data) db(req *http.Request) storage.DB {
+	return data.DB.WithContext(req.Context()).WithClientIP(netshare.GetClientAddr(req))
+}
+
 func Load(db storage.DB, cfg config.Config) (*Data, error) {
 	var data Data
 	var err error
@@ -151,8 +174,10 @@ func Load(db storage.DB, cfg config.Config) (*Data, error) {
 	data.TitleMaxLen = cfg.TitleMaxLen
 	data.BodyMaxLen = cfg.BodyMaxLen
 	data.MaxLifeTime = cfg.MaxLifeTime
+	data.Redaction = cfg.Redaction
 	data.UiDefaultLifeTime = cfg.UiDefaultLifetime
 	data.UiDefaultTheme = cfg.UiDefaultTheme
+	data.UiRelatedPastes = cfg.UiRelatedPastes
 	data.Public = cfg.Public
 	data.CasPasswdFile = cfg.CasPasswdFile
 
@@ -160,15 +185,7 @@ func Load(db storage.DB, cfg config.Config) (*Data, error) {
 	// Per AI.md PART 11: 5 failed attempts = 15-minute lockout
 	data.BruteForce = caspasswd.NewBruteForceProtection(5, 15*time.Minute)
 
-	data.ServerAbout = cfg.ServerAbout
-	data.ServerRules = cfg.ServerRules
-	data.ServerTermsOfUse = cfg.ServerTermsOfUse
-
-	serverTermsExist := false
-	if cfg.ServerTermsOfUse != "" {
-		serverTermsExist = true
-	}
-	data.ServerTermsExist = serverTermsExist
+	data.Content = cfg.Content
 
 	data.AdminName = cfg.AdminName
 	data.AdminMail = cfg.AdminMail
@@ -181,8 +198,8 @@ func Load(db storage.DB, cfg config.Config) (*Data, error) {
 	data.SiteRobotsAllow = cfg.SiteRobotsAllow
 	data.SiteRobotsDeny = cfg.SiteRobotsDeny
 	data.SiteRobotsAgentsDeny = cfg.SiteRobotsAgentsDeny
-	data.Logo = cfg.Logo
-	data.Favicon = cfg.Favicon
+	data.SiteRobotsPasteTag = cfg.SiteRobotsPasteTag
+	data.SetBranding(cfg.Branding)
 
 	// Get Chroma lexers
 	data.Lexers = chromaLexers.Names(false)
@@ -206,7 +223,7 @@ func Load(db storage.DB, cfg config.Config) (*Data, error) {
 	}
 
 	// main.tmpl
-	data.Main, err = template.ParseFS(embFS, "data/base.tmpl", "data/_header.tmpl", "data/_nav.tmpl", "data/_footer.tmpl", "data/main.tmpl")
+	data.Main, err = data.parsePage("main.tmpl")
 	if err != nil {
 		return nil, err
 	}
@@ -232,6 +249,20 @@ func Load(db storage.DB, cfg config.Config) (*Data, error) {
 	}
 	data.ToastJS = &toastJS
 
+	// cast.js
+	castJS, err := embFS.ReadFile("data/cast.js")
+	if err != nil {
+		return nil, err
+	}
+	data.CastJS = &castJS
+
+	// crypt.js
+	cryptJS, err := embFS.ReadFile("data/crypt.js")
+	if err != nil {
+		return nil, err
+	}
+	data.CryptJS = &cryptJS
+
 	// history.js
 	data.HistoryJS, err = textTemplate.ParseFS(embFS, "data/history.js")
 	if err != nil {
@@ -245,7 +276,7 @@ func Load(db storage.DB, cfg config.Config) (*Data, error) {
 	}
 
 	// paste.tmpl
-	data.PastePage, err = template.ParseFS(embFS, "data/base.tmpl", "data/_header.tmpl", "data/_nav.tmpl", "data/_footer.tmpl", "data/paste.tmpl")
+	data.PastePage, err = data.parsePage("paste.tmpl")
 	if err != nil {
 		return nil, err
 	}
@@ -256,86 +287,98 @@ func Load(db storage.DB, cfg config.Config) (*Data, error) {
 		return nil, err
 	}
 
+	// shortcuts.js
+	data.ShortcutsJS, err = textTemplate.ParseFS(embFS, "data/shortcuts.js")
+	if err != nil {
+		return nil, err
+	}
+
+	// drafts.js
+	data.DraftsJS, err = textTemplate.ParseFS(embFS, "data/drafts.js")
+	if err != nil {
+		return nil, err
+	}
+
 	// paste_continue.tmpl
-	data.PasteContinue, err = template.ParseFS(embFS, "data/base.tmpl", "data/_header.tmpl", "data/_nav.tmpl", "data/_footer.tmpl", "data/paste_continue.tmpl")
+	data.PasteContinue, err = data.parsePage("paste_continue.tmpl")
 	if err != nil {
 		return nil, err
 	}
 
 	// settings.tmpl
-	data.Settings, err = template.ParseFS(embFS, "data/base.tmpl", "data/_header.tmpl", "data/_nav.tmpl", "data/_footer.tmpl", "data/settings.tmpl")
+	data.Settings, err = data.parsePage("settings.tmpl")
 	if err != nil {
 		return nil, err
 	}
 
 	// list.tmpl
-	data.ListPage, err = template.ParseFS(embFS, "data/base.tmpl", "data/_header.tmpl", "data/_nav.tmpl", "data/_footer.tmpl", "data/list.tmpl")
+	data.ListPage, err = data.parsePage("list.tmpl")
 	if err != nil {
 		return nil, err
 	}
 
 	// about.tmpl
-	data.About, err = template.ParseFS(embFS, "data/base.tmpl", "data/_header.tmpl", "data/_nav.tmpl", "data/_footer.tmpl", "data/about.tmpl")
+	data.About, err = data.parsePage("about.tmpl")
 	if err != nil {
 		return nil, err
 	}
 
 	// terms.tmpl
-	data.TermsOfUse, err = template.ParseFS(embFS, "data/base.tmpl", "data/_header.tmpl", "data/_nav.tmpl", "data/_footer.tmpl", "data/terms.tmpl")
+	data.TermsOfUse, err = data.parsePage("terms.tmpl")
 	if err != nil {
 		return nil, err
 	}
 
 	// authors.tmpl
-	data.Authors, err = template.ParseFS(embFS, "data/base.tmpl", "data/_header.tmpl", "data/_nav.tmpl", "data/_footer.tmpl", "data/authors.tmpl")
+	data.Authors, err = data.parsePage("authors.tmpl")
 	if err != nil {
 		return nil, err
 	}
 
 	// license.tmpl
-	data.License, err = template.ParseFS(embFS, "data/base.tmpl", "data/_header.tmpl", "data/_nav.tmpl", "data/_footer.tmpl", "data/license.tmpl")
+	data.License, err = data.parsePage("license.tmpl")
 	if err != nil {
 		return nil, err
 	}
 
 	// source_code.tmpl
-	data.SourceCodePage, err = template.ParseFS(embFS, "data/base.tmpl", "data/_header.tmpl", "data/_nav.tmpl", "data/_footer.tmpl", "data/source_code.tmpl")
+	data.SourceCodePage, err = data.parsePage("source_code.tmpl")
 	if err != nil {
 		return nil, err
 	}
 
 	// security_policy.tmpl
-	data.SecurityPolicy, err = template.ParseFS(embFS, "data/base.tmpl", "data/_header.tmpl", "data/_nav.tmpl", "data/_footer.tmpl", "data/security_policy.tmpl")
+	data.SecurityPolicy, err = data.parsePage("security_policy.tmpl")
 	if err != nil {
 		return nil, err
 	}
 
 	// docs.tmpl
-	data.Docs, err = template.ParseFS(embFS, "data/base.tmpl", "data/_header.tmpl", "data/_nav.tmpl", "data/_footer.tmpl", "data/docs.tmpl")
+	data.Docs, err = data.parsePage("docs.tmpl")
 	if err != nil {
 		return nil, err
 	}
 
 	// docs_apiv1.tmpl
-	data.DocsApiV1, err = template.ParseFS(embFS, "data/base.tmpl", "data/_header.tmpl", "data/_nav.tmpl", "data/_footer.tmpl", "data/docs_apiv1.tmpl")
+	data.DocsApiV1, err = data.parsePage("docs_apiv1.tmpl")
 	if err != nil {
 		return nil, err
 	}
 
 	// docs_libraries.tmpl
-	data.DocsLibraries, err = template.ParseFS(embFS, "data/base.tmpl", "data/_header.tmpl", "data/_nav.tmpl", "data/_footer.tmpl", "data/docs_libraries.tmpl")
+	data.DocsLibraries, err = data.parsePage("docs_libraries.tmpl")
 	if err != nil {
 		return nil, err
 	}
 
 	// docs_customize.tmpl
-	data.DocsCustomize, err = template.ParseFS(embFS, "data/base.tmpl", "data/_header.tmpl", "data/_nav.tmpl", "data/_footer.tmpl", "data/docs_customize.tmpl")
+	data.DocsCustomize, err = data.parsePage("docs_customize.tmpl")
 	if err != nil {
 		return nil, err
 	}
 
 	// error.tmpl
-	data.ErrorPage, err = template.ParseFS(embFS, "data/base.tmpl", "data/_header.tmpl", "data/_nav.tmpl", "data/_footer.tmpl", "data/error.tmpl")
+	data.ErrorPage, err = data.parsePage("error.tmpl")
 	if err != nil {
 		return nil, err
 	}
@@ -347,13 +390,13 @@ func Load(db storage.DB, cfg config.Config) (*Data, error) {
 	}
 
 	// emb_help.tmpl
-	data.EmbeddedHelpPage, err = template.ParseFS(embFS, "data/base.tmpl", "data/_header.tmpl", "data/_nav.tmpl", "data/_footer.tmpl", "data/emb_help.tmpl")
+	data.EmbeddedHelpPage, err = data.parsePage("emb_help.tmpl")
 	if err != nil {
 		return nil, err
 	}
 
 	// login.tmpl
-	data.Login, err = template.ParseFS(embFS, "data/base.tmpl", "data/_header.tmpl", "data/_nav.tmpl", "data/_footer.tmpl", "data/login.tmpl")
+	data.Login, err = data.parsePage("login.tmpl")
 	if err != nil {
 		return nil, err
 	}
@@ -388,6 +431,8 @@ func (data *Data) Handler(rw http.ResponseWriter, req *http.Request) {
 		err = data.handleSitemap(rw, req)
 	case "/favicon.ico":
 		err = data.handleFavicon(rw, req)
+	case "/branding/logo", "/branding/favicon":
+		err = data.handleBrandingAsset(rw, req)
 	// Security
 	case "/.well-known/security.txt":
 		err = data.handleSecurityTxt(rw, req)
@@ -406,6 +451,14 @@ func (data *Data) Handler(rw http.ResponseWriter, req *http.Request) {
 		err = data.handleCodeJS(rw, req)
 	case "/paste.js":
 		err = data.handlePasteJS(rw, req)
+	case "/shortcuts.js":
+		err = data.handleShortcutsJS(rw, req)
+	case "/drafts.js":
+		err = data.handleDraftsJS(rw, req)
+	case "/cast.js":
+		err = data.handleCastJS(rw, req)
+	case "/crypt.js":
+		err = data.handleCryptJS(rw, req)
 	// PWA Support
 	case "/manifest.json":
 		err = data.handleManifest(rw, req)
@@ -463,9 +516,14 @@ func (data *Data) Handler(rw http.ResponseWriter, req *http.Request) {
 	// Else
 	default:
 		if strings.HasPrefix(req.URL.Path, "/dl/") {
+			data.setPasteRobotsTag(rw)
 			err = data.handleDownload(rw, req)
 
+		} else if strings.HasPrefix(req.URL.Path, "/s/") {
+			err = data.handleShareLink(rw, req)
+
 		} else if strings.HasPrefix(req.URL.Path, "/emb/") {
+			data.setPasteRobotsTag(rw)
 			err = data.handleEmbedded(rw, req)
 
 		} else if strings.HasPrefix(req.URL.Path, "/emb_help/") {
@@ -480,6 +538,9 @@ func (data *Data) Handler(rw http.ResponseWriter, req *http.Request) {
 		} else if strings.HasPrefix(req.URL.Path, "/edit/") {
 			err = data.handleEditPaste(rw, req)
 
+		} else if strings.HasPrefix(req.URL.Path, "/format/") {
+			err = data.handleFormatPaste(rw, req)
+
 		} else if strings.HasPrefix(req.URL.Path, "/auth/") {
 			// Auth routes (PART 34)
 			err = data.routeAuth(rw, req)
@@ -489,6 +550,7 @@ func (data *Data) Handler(rw http.ResponseWriter, req *http.Request) {
 			err = data.routeOrgs(rw, req)
 
 		} else {
+			data.setPasteRobotsTag(rw)
 			err = data.handleGetPaste(rw, req)
 		}
 	}